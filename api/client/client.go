@@ -0,0 +1,246 @@
+// Package client is a typed Go client for the Shelly Manager REST API.
+//
+// Responses are unwrapped from the standard API envelope, so callers work with
+// the typed structs in this package instead of decoding JSON by hand:
+//
+//	c := client.New("http://localhost:8080", client.WithAPIKey(key))
+//	devices, err := c.ListDevices(ctx, nil)
+//
+// Errors returned by the server are reported as *Error, which carries the HTTP
+// status and the API error code.
+//
+// The request and response types and the methods calling each route are
+// generated from the server types and the route list in internal/gen; run go
+// generate here after changing either.
+package client
+
+//go:generate go run ./internal/gen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// APIPrefix is the path prefix of all versioned API routes
+const APIPrefix = "/api/v1"
+
+// DefaultUserAgent is sent unless WithUserAgent overrides it. The server
+// rejects requests without a user agent.
+const DefaultUserAgent = "shelly-manager-client/1"
+
+const defaultTimeout = 30 * time.Second
+
+// Client calls the Shelly Manager API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	userAgent  string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithAPIKey sets the admin API key sent as bearer token
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithUserAgent sets the User-Agent header
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// New returns a client for the server at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		userAgent:  DefaultUserAgent,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is an error response from the API
+type Error struct {
+	StatusCode int         `json:"-"`
+	Code       string      `json:"code"`
+	Message    string      `json:"message"`
+	Details    interface{} `json:"details,omitempty"`
+	RequestID  string      `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("api error %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("api error %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// IsNotFound reports whether err is an API 404 response
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// envelope is the standard API response wrapper
+type envelope struct {
+	Success   *bool           `json:"success"`
+	Data      json.RawMessage `json:"data"`
+	Error     *Error          `json:"error"`
+	Meta      *Meta           `json:"meta"`
+	RequestID string          `json:"request_id"`
+}
+
+// Meta is the metadata of a list response
+type Meta struct {
+	Pagination *Pagination `json:"pagination,omitempty"`
+	Count      *int        `json:"count,omitempty"`
+	TotalCount *int        `json:"total_count,omitempty"`
+}
+
+// ListOptions selects a page of a paginated list. A zero PageSize returns
+// every item.
+type ListOptions struct {
+	Page     int
+	PageSize int
+}
+
+// Route is an API route called by the client, with mux-style path variables
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Pagination describes the page returned by a paginated list
+type Pagination struct {
+	Page        int  `json:"page"`
+	PageSize    int  `json:"page_size"`
+	TotalPages  int  `json:"total_pages"`
+	HasNext     bool `json:"has_next"`
+	HasPrevious bool `json:"has_previous"`
+}
+
+// Do sends a request to path, relative to the server root, and decodes the
+// response data into out when it is non-nil. Enveloped responses are
+// unwrapped; plain JSON responses such as /healthz are decoded as is. The
+// envelope metadata is returned when present.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body, out interface{}) (*Meta, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if body != nil || method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch {
+		// Strict validation requires a content type on every write
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return decodeResponse(resp.StatusCode, data, out)
+}
+
+// decodeResponse unwraps the envelope of a response body
+func decodeResponse(status int, data []byte, out interface{}) (*Meta, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		if status >= 400 {
+			return nil, &Error{StatusCode: status, Message: http.StatusText(status)}
+		}
+		return nil, nil
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Success == nil {
+		// Not an envelope: plain JSON or text
+		if status >= 400 {
+			return nil, &Error{StatusCode: status, Message: strings.TrimSpace(string(data))}
+		}
+		if out == nil {
+			return nil, nil
+		}
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil, nil
+	}
+
+	if !*env.Success || status >= 400 {
+		apiErr := env.Error
+		if apiErr == nil {
+			apiErr = &Error{Message: http.StatusText(status)}
+		}
+		apiErr.StatusCode = status
+		apiErr.RequestID = env.RequestID
+		return env.Meta, apiErr
+	}
+	if out != nil && len(env.Data) > 0 && string(env.Data) != "null" {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			return env.Meta, fmt.Errorf("failed to decode response data: %w", err)
+		}
+	}
+	return env.Meta, nil
+}
+
+// get, post, put and del are shorthands for Do on API routes
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	_, err := c.Do(ctx, http.MethodGet, APIPrefix+path, query, nil, out)
+	return err
+}
+
+func (c *Client) post(ctx context.Context, path string, body, out interface{}) error {
+	_, err := c.Do(ctx, http.MethodPost, APIPrefix+path, nil, body, out)
+	return err
+}
+
+func (c *Client) put(ctx context.Context, path string, body, out interface{}) error {
+	_, err := c.Do(ctx, http.MethodPut, APIPrefix+path, nil, body, out)
+	return err
+}
+
+func (c *Client) del(ctx context.Context, path string) error {
+	_, err := c.Do(ctx, http.MethodDelete, APIPrefix+path, nil, nil, nil)
+	return err
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListDevicesUnwrapsEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/devices", r.URL.Path)
+		assert.Equal(t, "2", r.URL.Query().Get("page"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, DefaultUserAgent, r.Header.Get("User-Agent"))
+		_, _ = w.Write([]byte(`{"success":true,"data":{"devices":[{"id":3,"ip":"192.0.2.3","mac":"AA","name":"lamp"}]},
+			"meta":{"pagination":{"page":2,"page_size":1,"total_pages":3,"has_next":true,"has_previous":true}}}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL+"/", WithAPIKey("secret"))
+	list, err := c.ListDevices(context.Background(), &ListOptions{Page: 2, PageSize: 1})
+	require.NoError(t, err)
+	require.Len(t, list.Devices, 1)
+	assert.Equal(t, uint(3), list.Devices[0].ID)
+	assert.Equal(t, "lamp", list.Devices[0].Name)
+	require.NotNil(t, list.Pagination)
+	assert.Equal(t, 3, list.Pagination.TotalPages)
+	assert.True(t, list.Pagination.HasNext)
+}
+
+func TestErrorResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"success":false,"error":{"code":"NOT_FOUND","message":"Device not found"},"request_id":"req-1"}`))
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL).GetDevice(context.Background(), 9)
+	require.Error(t, err)
+	assert.True(t, IsNotFound(err))
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "NOT_FOUND", apiErr.Code)
+	assert.Equal(t, "req-1", apiErr.RequestID)
+}
+
+func TestPlainJSONResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	health, err := New(srv.URL).Health(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ok", health.Status)
+}
+
+func TestNonJSONError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL).Version(context.Background())
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+	assert.Equal(t, "bad gateway", apiErr.Message)
+}
+
+func TestStartBulkControlSetsAsync(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, true, body["async"])
+		assert.Equal(t, "off", body["action"])
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"success":true,"data":{"id":"job-1","status":"running","action":"off","total":2}}`))
+	}))
+	defer srv.Close()
+
+	job, err := New(srv.URL).StartBulkControl(context.Background(), BulkControlRequest{Tag: "lights", Action: "off"})
+	require.NoError(t, err)
+	assert.Equal(t, "job-1", job.ID)
+	assert.Equal(t, 2, job.Total)
+}
+
+// TestMethodsUseListedRoutes calls every client method and checks that each
+// request matches an entry of Routes
+func TestMethodsUseListedRoutes(t *testing.T) {
+	var mu sync.Mutex
+	var seen []Route
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, Route{r.Method, r.URL.Path})
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"success":true,"data":{}}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := New(srv.URL)
+	calls := []func() error{
+		func() error { _, err := c.Health(ctx); return err },
+		func() error { _, err := c.Version(ctx); return err },
+		func() error { _, err := c.ListDevices(ctx, nil); return err },
+		func() error { _, err := c.GetDevice(ctx, 1); return err },
+		func() error { _, err := c.CreateDevice(ctx, Device{}); return err },
+		func() error { _, err := c.UpdateDevice(ctx, 1, Device{}); return err },
+		func() error { return c.DeleteDevice(ctx, 1) },
+		func() error { _, err := c.ControlDevice(ctx, 1, "on", nil, false); return err },
+		func() error { _, err := c.DeviceStatus(ctx, 1); return err },
+		func() error { _, err := c.DeviceConfig(ctx, 1); return err },
+		func() error { _, err := c.DeviceEnergy(ctx, 1, 0); return err },
+		func() error { _, err := c.BulkControl(ctx, BulkControlRequest{}); return err },
+		func() error { _, err := c.StartBulkControl(ctx, BulkControlRequest{}); return err },
+		func() error { _, err := c.BulkControlJob(ctx, "job"); return err },
+		func() error { _, err := c.RecoveryActions(ctx, 1, 10); return err },
+		func() error { _, err := c.RunSupervisor(ctx, true); return err },
+		func() error { _, err := c.Preflight(ctx, PreflightRequest{}); return err },
+		func() error { _, err := c.ClockSkewReport(ctx, true); return err },
+		func() error { _, err := c.RemediateClockSkew(ctx, ClockSkewRemediation{}); return err },
+		func() error { _, err := c.ConfigLintReport(ctx, "t", "warning"); return err },
+		func() error { _, err := c.DeviceConfigLint(ctx, 1); return err },
+		func() error { _, err := c.StageWiFiRotation(ctx, WiFiRotationRequest{}); return err },
+		func() error { _, err := c.ListWiFiRotations(ctx); return err },
+		func() error { _, err := c.GetWiFiRotation(ctx, "r"); return err },
+		func() error { _, err := c.StartWiFiRotation(ctx, "r"); return err },
+		func() error { _, err := c.VerifyWiFiRotation(ctx, "r"); return err },
+		func() error { _, err := c.RescueWiFiRotation(ctx, "r"); return err },
+		func() error { _, err := c.ListSubnets(ctx); return err },
+		func() error { _, err := c.CreateSubnet(ctx, IPSubnet{}); return err },
+		func() error { return c.DeleteSubnet(ctx, 1) },
+		func() error { _, err := c.AddReservedRange(ctx, 1, IPReservedRange{}); return err },
+		func() error { return c.DeleteReservedRange(ctx, 1, 2) },
+		func() error { _, err := c.FreeAddresses(ctx, 1, 5); return err },
+		func() error { _, err := c.IPPlan(ctx); return err },
+		func() error { _, err := c.GenerateIPPlan(ctx, IPPlanRequest{}); return err },
+	}
+	for _, call := range calls {
+		require.NoError(t, call())
+	}
+
+	require.Len(t, seen, len(calls))
+	for _, got := range seen {
+		assert.True(t, routeListed(got), "%s %s is not in Routes", got.Method, got.Path)
+	}
+}
+
+// routeListed matches a concrete request against the route patterns
+func routeListed(got Route) bool {
+	parts := strings.Split(got.Path, "/")
+	for _, route := range Routes {
+		pattern := strings.Split(route.Path, "/")
+		if route.Method != got.Method || len(pattern) != len(parts) {
+			continue
+		}
+		match := true
+		for i, p := range pattern {
+			if !strings.HasPrefix(p, "{") && p != parts[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
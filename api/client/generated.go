@@ -0,0 +1,860 @@
+// Code generated by go run ./internal/gen; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Pre-flight check names
+const (
+	PreflightGateway = "gateway"
+	PreflightMQTT    = "mqtt"
+	PreflightSNTP    = "sntp"
+)
+
+// Routes lists every route the client calls. The server tests check that each
+// of them is registered, so the client cannot drift from the router.
+var Routes = []Route{
+	{"GET", "/healthz"},
+	{"GET", "/version"},
+	{"GET", APIPrefix + "/devices"},
+	{"GET", APIPrefix + "/devices/{id}"},
+	{"POST", APIPrefix + "/devices"},
+	{"PUT", APIPrefix + "/devices/{id}"},
+	{"DELETE", APIPrefix + "/devices/{id}"},
+	{"POST", APIPrefix + "/devices/{id}/control"},
+	{"GET", APIPrefix + "/devices/{id}/status"},
+	{"GET", APIPrefix + "/devices/{id}/config"},
+	{"GET", APIPrefix + "/devices/{id}/energy"},
+	{"POST", APIPrefix + "/devices/control"},
+	{"GET", APIPrefix + "/devices/control/jobs/{id}"},
+	{"GET", APIPrefix + "/supervisor/actions"},
+	{"POST", APIPrefix + "/supervisor/run"},
+	{"POST", APIPrefix + "/diagnostics/preflight"},
+	{"GET", APIPrefix + "/reports/clock-skew"},
+	{"POST", APIPrefix + "/reports/clock-skew/remediate"},
+	{"GET", APIPrefix + "/reports/config-lint"},
+	{"GET", APIPrefix + "/devices/{id}/config/lint"},
+	{"POST", APIPrefix + "/wifi-rotations"},
+	{"GET", APIPrefix + "/wifi-rotations"},
+	{"GET", APIPrefix + "/wifi-rotations/{id}"},
+	{"POST", APIPrefix + "/wifi-rotations/{id}/start"},
+	{"POST", APIPrefix + "/wifi-rotations/{id}/verify"},
+	{"POST", APIPrefix + "/wifi-rotations/{id}/rescue"},
+	{"GET", APIPrefix + "/ipam/subnets"},
+	{"POST", APIPrefix + "/ipam/subnets"},
+	{"DELETE", APIPrefix + "/ipam/subnets/{id}"},
+	{"POST", APIPrefix + "/ipam/subnets/{id}/ranges"},
+	{"DELETE", APIPrefix + "/ipam/subnets/{id}/ranges/{range_id}"},
+	{"GET", APIPrefix + "/ipam/subnets/{id}/free"},
+	{"GET", APIPrefix + "/ipam/plan"},
+	{"POST", APIPrefix + "/ipam/plan/generate"},
+}
+
+// Health is the response of /healthz
+type Health struct {
+	Status string `json:"status"` // ok or degraded
+}
+
+// VersionInfo is the response of /version
+type VersionInfo struct {
+	APIVersion              string `json:"api_version"`
+	ServerStartedAt         string `json:"server_started_at"`
+	DatabaseProviderName    string `json:"database_provider_name,omitempty"`
+	DatabaseProviderVersion string `json:"database_provider_version,omitempty"`
+}
+
+// Device represents a Shelly device in the database
+type Device struct {
+	ID        uint      `json:"id"`
+	IP        string    `json:"ip"`
+	MAC       string    `json:"mac"`
+	Type      string    `json:"type"`
+	Name      string    `json:"name"`
+	Firmware  string    `json:"firmware"`
+	Status    string    `json:"status"`
+	LastSeen  time.Time `json:"last_seen"`
+	Settings  string    `json:"settings"` // JSON string, may hold credentials
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Version is bumped by every edit through the API; clients send it back
+	// (If-Match or the body) so a stale edit is refused instead of applied
+	Version       int    `json:"version"`
+	TemplateIDs   string `json:"template_ids"`
+	Overrides     string `json:"overrides"`
+	DesiredConfig string `json:"desired_config"`
+	ConfigApplied bool   `json:"config_applied"`
+	// Profile is the active profile of devices whose outputs work either as
+	// relays or as a cover ("switch", "cover"); empty for other devices
+	Profile string `json:"profile,omitempty"`
+	// Asset holds purchase and warranty details, changed through
+	// PUT /devices/{id}/asset or the asset CSV import
+	Asset DeviceAsset `json:"asset"`
+}
+
+// ControlResult is the response of a device control action
+type ControlResult struct {
+	Status   string `json:"status"`
+	DeviceID uint   `json:"device_id"`
+	Action   string `json:"action"`
+}
+
+// DeviceConfig represents a device-specific configuration
+type DeviceConfig struct {
+	ID         uint            `json:"id"`
+	DeviceID   uint            `json:"device_id"`
+	TemplateID *uint           `json:"template_id"` // Optional template reference
+	Config     json.RawMessage `json:"config"`
+	LastSynced *time.Time      `json:"last_synced"`
+	SyncStatus string          `json:"sync_status"` // "synced", "pending", "error", "drift"
+	Version    int             `json:"version"`     // Bumped by every edit, see ErrVersionConflict
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// EnergyData represents energy consumption data
+type EnergyData struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Power         float64   `json:"power"`          // Current power in Watts
+	Total         float64   `json:"total"`          // Total energy in kWh
+	TotalReturned float64   `json:"total_returned"` // Total returned energy in kWh
+	Voltage       float64   `json:"voltage"`
+	Current       float64   `json:"current"`
+	PowerFactor   float64   `json:"pf,omitempty"` // Power factor
+}
+
+// BulkControlRequest selects devices and the action run on each of them
+type BulkControlRequest struct {
+	DeviceIDs   []uint                 `json:"device_ids,omitempty"`
+	Tag         string                 `json:"tag,omitempty"` // select devices carrying this tag
+	Action      string                 `json:"action"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	Concurrency int                    `json:"concurrency,omitempty"` // defaults to 10
+	Async       bool                   `json:"async"`
+	// Force attempts the action on devices marked offline; the API passes it
+	// on as the force parameter
+	Force bool `json:"force,omitempty"`
+}
+
+// BulkControlSummary is the response of a synchronous bulk control run
+type BulkControlSummary struct {
+	Action    string              `json:"action"`
+	Results   []BulkControlResult `json:"results"`
+	Total     int                 `json:"total"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+}
+
+// BulkControlJob tracks an asynchronous bulk control run
+type BulkControlJob struct {
+	ID          string              `json:"id"`
+	Status      string              `json:"status"`
+	Action      string              `json:"action"`
+	Total       int                 `json:"total"`
+	Succeeded   int                 `json:"succeeded"`
+	Failed      int                 `json:"failed"`
+	Results     []BulkControlResult `json:"results,omitempty"`
+	StartedAt   time.Time           `json:"started_at"`
+	CompletedAt *time.Time          `json:"completed_at,omitempty"`
+	RequestID   string              `json:"request_id,omitempty"` // request that started the job
+}
+
+// RecoveryAction is the audit record of a supervisor recovery action
+type RecoveryAction struct {
+	ID        uint      `json:"id"`
+	DeviceID  uint      `json:"device_id"`
+	Policy    string    `json:"policy"`
+	Action    string    `json:"action"` // reboot, wifi_roaming
+	Reason    string    `json:"reason"`
+	DryRun    bool      `json:"dry_run"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PreflightRequest selects the devices checked by Preflight
+type PreflightRequest struct {
+	DeviceIDs []uint `json:"device_ids,omitempty"` // empty selects every device
+	Tag       string `json:"tag,omitempty"`
+}
+
+// PreflightReport is the connectivity matrix for a set of devices
+type PreflightReport struct {
+	GeneratedAt time.Time                 `json:"generated_at"`
+	Devices     []PreflightDevice         `json:"devices"`
+	Targets     []PreflightTarget         `json:"targets"`
+	Summary     map[string]map[string]int `json:"summary"` // check -> result -> count
+	Unreachable int                       `json:"unreachable"`
+}
+
+// ClockSkewReport lists devices with their clock skew
+type ClockSkewReport struct {
+	CheckedAt        time.Time        `json:"checked_at"`
+	ThresholdSeconds int              `json:"threshold_seconds"`
+	Devices          []ClockSkewEntry `json:"devices"`
+	Flagged          int              `json:"flagged"`
+}
+
+// ClockSkewRemediation pushes an SNTP server to devices with a skewed clock
+type ClockSkewRemediation struct {
+	DeviceIDs  []uint `json:"device_ids,omitempty"` // empty selects flagged devices from the last report
+	SNTPServer string `json:"sntp_server,omitempty"`
+	DryRun     bool   `json:"dry_run"`
+}
+
+// ClockSkewCorrection is the remediation outcome for one device
+type ClockSkewCorrection struct {
+	DeviceID   uint   `json:"device_id"`
+	Name       string `json:"name"`
+	SNTPServer string `json:"sntp_server"`
+	Changed    bool   `json:"changed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ConfigLintSummary is the fleet view of configuration lint findings
+type ConfigLintSummary struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Devices     int                `json:"devices"`
+	Affected    int                `json:"affected"` // devices with at least one finding
+	BySeverity  map[string]int     `json:"by_severity"`
+	ByRule      map[string]int     `json:"by_rule"`
+	Reports     []DeviceLintReport `json:"reports"`
+	// InMaintenance counts the devices in maintenance, which are left out of
+	// Affected and the totals
+	InMaintenance int `json:"in_maintenance"`
+}
+
+// DeviceLintReport lists the best-practice findings for one device
+type DeviceLintReport struct {
+	DeviceID  uint          `json:"device_id"`
+	Name      string        `json:"name"`
+	Type      string        `json:"type"`
+	HasConfig bool          `json:"has_config"` // false when no configuration is stored yet
+	Findings  []LintFinding `json:"findings"`
+	Error     string        `json:"error,omitempty"`
+	// InMaintenance reports keep their findings, but fleet totals skip them
+	InMaintenance bool `json:"in_maintenance,omitempty"`
+}
+
+// WiFiRotationRequest stages new station credentials for a set of devices
+type WiFiRotationRequest struct {
+	SSID          string `json:"ssid"`
+	Password      string `json:"password"`
+	DeviceIDs     []uint `json:"device_ids,omitempty"`     // empty selects every device
+	Tag           string `json:"tag,omitempty"`            // restrict to devices carrying this tag
+	VerifyTimeout int    `json:"verify_timeout,omitempty"` // seconds, defaults to 90
+}
+
+// WiFiRotation is a staged or running Wi-Fi credential rollout. The
+// password is stored encrypted with the rotation and never returned.
+type WiFiRotation struct {
+	ID            string               `json:"id"`
+	Status        string               `json:"status"`
+	SSID          string               `json:"ssid"`
+	VerifyTimeout int                  `json:"verify_timeout"`
+	Devices       []WiFiRotationDevice `json:"devices"`
+	Summary       map[string]int       `json:"summary"`
+	CreatedAt     time.Time            `json:"created_at"`
+	StartedAt     *time.Time           `json:"started_at,omitempty"`
+	CompletedAt   *time.Time           `json:"completed_at,omitempty"`
+	RequestID     string               `json:"request_id,omitempty"` // request that last started the rollout
+}
+
+// IPSubnet is a subnet declared for static IP planning
+type IPSubnet struct {
+	ID          uint              `json:"id"`
+	Name        string            `json:"name"`
+	CIDR        string            `json:"cidr"`
+	Gateway     string            `json:"gateway,omitempty"`
+	DNS         string            `json:"dns,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Ranges      []IPReservedRange `json:"ranges"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// IPReservedRange is an address range inside a subnet that must not be
+// assigned to devices, e.g. the DHCP pool or infrastructure addresses
+type IPReservedRange struct {
+	ID          uint      `json:"id"`
+	SubnetID    uint      `json:"subnet_id"`
+	StartIP     string    `json:"start_ip"`
+	EndIP       string    `json:"end_ip"`
+	Purpose     string    `json:"purpose,omitempty"` // dhcp_pool, infrastructure, ...
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// IPPlanReport is the address management view over the inventory
+type IPPlanReport struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Subnets     []IPPlanSubnet `json:"subnets"`
+	Devices     []IPPlanDevice `json:"devices"`
+	Conflicts   []IPConflict   `json:"conflicts"`
+}
+
+// IPPlanRequest selects devices that get a static address in a subnet
+type IPPlanRequest struct {
+	SubnetID  uint   `json:"subnet_id"`
+	DeviceIDs []uint `json:"device_ids,omitempty"` // empty selects every device
+	Tag       string `json:"tag,omitempty"`        // restrict to devices carrying this tag
+}
+
+// IPPlanChange is the generated static addressing for one device
+type IPPlanChange struct {
+	DeviceID    uint                   `json:"device_id"`
+	Name        string                 `json:"name"`
+	MAC         string                 `json:"mac"`
+	CurrentIP   string                 `json:"current_ip"`
+	AssignedIP  string                 `json:"assigned_ip,omitempty"`
+	Changed     bool                   `json:"changed"` // the device is not yet configured this way
+	Config      map[string]interface{} `json:"config,omitempty"`
+	Reservation *DHCPReservation       `json:"dhcp_reservation,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+}
+
+// DeviceAsset is the asset record of a device
+type DeviceAsset struct {
+	Serial         string     `json:"serial,omitempty"`
+	Vendor         string     `json:"vendor,omitempty"`
+	PurchaseDate   *time.Time `json:"purchase_date,omitempty"`
+	WarrantyMonths int        `json:"warranty_months,omitempty"`
+	// WarrantyNotifiedAt is when the approaching expiry was notified; it is
+	// cleared when the warranty details change
+	WarrantyNotifiedAt *time.Time `json:"warranty_notified_at,omitempty"`
+}
+
+// BulkControlResult reports the outcome for one device
+type BulkControlResult struct {
+	DeviceID uint   `json:"device_id"`
+	Name     string `json:"name"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+}
+
+// PreflightDevice is one row of the connectivity matrix
+type PreflightDevice struct {
+	DeviceID uint                      `json:"device_id"`
+	Name     string                    `json:"name"`
+	IP       string                    `json:"ip"`
+	Checks   map[string]PreflightCheck `json:"checks,omitempty"`
+	Error    string                    `json:"error,omitempty"`
+}
+
+// PreflightTarget aggregates one infrastructure endpoint across devices. A
+// target most devices fail to reach is likely broken itself.
+type PreflightTarget struct {
+	Check  string `json:"check"`
+	Target string `json:"target"`
+	OK     int    `json:"ok"`
+	Failed int    `json:"failed"`
+}
+
+// ClockSkewEntry is one device's clock compared with server time
+type ClockSkewEntry struct {
+	DeviceID    uint       `json:"device_id"`
+	Name        string     `json:"name"`
+	IP          string     `json:"ip"`
+	DeviceTime  *time.Time `json:"device_time,omitempty"`
+	SkewSeconds float64    `json:"skew_seconds"` // device minus server; positive runs ahead
+	Synced      bool       `json:"synced"`       // the device reports a valid clock
+	Flagged     bool       `json:"flagged"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// LintFinding is a best-practice warning about a configuration. Unlike
+// validation errors it never blocks saving or applying the configuration.
+type LintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+// WiFiRotationDevice tracks the rollout on one device
+type WiFiRotationDevice struct {
+	DeviceID     uint       `json:"device_id"`
+	Name         string     `json:"name"`
+	IP           string     `json:"ip"`
+	MAC          string     `json:"mac"`
+	State        string     `json:"state"`
+	Error        string     `json:"error,omitempty"`
+	PushedAt     *time.Time `json:"pushed_at,omitempty"`
+	VerifiedAt   *time.Time `json:"verified_at,omitempty"`
+	RescueTaskID string     `json:"rescue_task_id,omitempty"`
+}
+
+// IPPlanSubnet is a declared subnet with its address usage
+type IPPlanSubnet struct {
+	IPSubnet
+	Size     int `json:"size"`     // usable host addresses
+	Used     int `json:"used"`     // addresses used or configured by devices
+	Reserved int `json:"reserved"` // addresses in reserved ranges
+	Free     int `json:"free"`
+}
+
+// IPPlanDevice is the addressing of one inventory device
+type IPPlanDevice struct {
+	DeviceID  uint   `json:"device_id"`
+	Name      string `json:"name"`
+	MAC       string `json:"mac"`
+	CurrentIP string `json:"current_ip"`
+	Mode      string `json:"mode"` // static, dhcp or unknown when no configuration is stored
+	StaticIP  string `json:"static_ip,omitempty"`
+	Subnet    string `json:"subnet,omitempty"`
+}
+
+// IPConflict is an addressing problem found in the plan
+type IPConflict struct {
+	Type      string `json:"type"`
+	IP        string `json:"ip"`
+	DeviceIDs []uint `json:"device_ids"`
+	Detail    string `json:"detail"`
+}
+
+// DHCPReservation represents a static DHCP reservation
+type DHCPReservation struct {
+	UUID        string `json:"uuid,omitempty"`
+	MAC         string `json:"mac"`
+	IP          string `json:"ip"`
+	Hostname    string `json:"hostname"`
+	Description string `json:"description,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+	Interface   string `json:"interface,omitempty"`
+}
+
+// PreflightCheck is one cell of the connectivity matrix
+type PreflightCheck struct {
+	Result string `json:"result"` // ok, failed, disabled, unknown
+	Target string `json:"target,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Health calls /healthz
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var out Health
+	_, err := c.Do(ctx, http.MethodGet, "/healthz", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Version calls /version
+func (c *Client) Version(ctx context.Context) (*VersionInfo, error) {
+	var out VersionInfo
+	_, err := c.Do(ctx, http.MethodGet, "/version", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDevices returns the devices, one page at a time when opts sets a page size
+func (c *Client) ListDevices(ctx context.Context, opts *ListOptions) (*DeviceList, error) {
+	query := url.Values{}
+	if opts != nil {
+		if opts.Page > 0 {
+			query.Set("page", strconv.Itoa(opts.Page))
+		}
+		if opts.PageSize > 0 {
+			query.Set("page_size", strconv.Itoa(opts.PageSize))
+		}
+	}
+	var out struct {
+		Items []Device `json:"devices"`
+	}
+	meta, err := c.Do(ctx, http.MethodGet, APIPrefix+"/devices", query, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	page := &DeviceList{Devices: out.Items}
+	if meta != nil {
+		page.Pagination = meta.Pagination
+	}
+	return page, nil
+}
+
+// DeviceList is one page of the ListDevices result
+type DeviceList struct {
+	Devices    []Device
+	Pagination *Pagination
+}
+
+// GetDevice returns one device
+func (c *Client) GetDevice(ctx context.Context, id uint) (*Device, error) {
+	var out Device
+	_, err := c.Do(ctx, http.MethodGet, fmt.Sprintf(APIPrefix+"/devices/%d", id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateDevice adds a device to the inventory
+func (c *Client) CreateDevice(ctx context.Context, device Device) (*Device, error) {
+	var out Device
+	_, err := c.Do(ctx, http.MethodPost, APIPrefix+"/devices", nil, device, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateDevice replaces the stored fields of a device
+func (c *Client) UpdateDevice(ctx context.Context, id uint, device Device) (*Device, error) {
+	var out Device
+	_, err := c.Do(ctx, http.MethodPut, fmt.Sprintf(APIPrefix+"/devices/%d", id), nil, device, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteDevice removes a device from the inventory
+func (c *Client) DeleteDevice(ctx context.Context, id uint) error {
+	_, err := c.Do(ctx, http.MethodDelete, fmt.Sprintf(APIPrefix+"/devices/%d", id), nil, nil, nil)
+	return err
+}
+
+// ControlDevice runs an action such as on, off, toggle or reboot on a device.
+// With force the action is attempted even if the device is marked offline.
+func (c *Client) ControlDevice(ctx context.Context, id uint, action string, params map[string]interface{}, force bool) (*ControlResult, error) {
+	body := map[string]interface{}{
+		"action": action,
+		"params": params,
+		"force":  force,
+	}
+	var out ControlResult
+	_, err := c.Do(ctx, http.MethodPost, fmt.Sprintf(APIPrefix+"/devices/%d/control", id), nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceStatus returns the live status read from a device. The layout depends
+// on the device generation.
+func (c *Client) DeviceStatus(ctx context.Context, id uint) (map[string]interface{}, error) {
+	var out map[string]interface{}
+	_, err := c.Do(ctx, http.MethodGet, fmt.Sprintf(APIPrefix+"/devices/%d/status", id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeviceConfig returns the stored configuration of a device and its sync status
+func (c *Client) DeviceConfig(ctx context.Context, id uint) (*DeviceConfig, error) {
+	var out DeviceConfig
+	_, err := c.Do(ctx, http.MethodGet, fmt.Sprintf(APIPrefix+"/devices/%d/config", id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceEnergy returns the energy reading of a device channel
+func (c *Client) DeviceEnergy(ctx context.Context, id uint, channel int) (*EnergyData, error) {
+	query := url.Values{}
+	query.Set("channel", strconv.Itoa(channel))
+	var out EnergyData
+	_, err := c.Do(ctx, http.MethodGet, fmt.Sprintf(APIPrefix+"/devices/%d/energy", id), query, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// BulkControl runs an action on the selected devices and waits for the results
+func (c *Client) BulkControl(ctx context.Context, req BulkControlRequest) (*BulkControlSummary, error) {
+	req.Async = false
+	var out BulkControlSummary
+	_, err := c.Do(ctx, http.MethodPost, APIPrefix+"/devices/control", nil, req, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StartBulkControl runs an action on the selected devices in the background
+// and returns the job to poll with BulkControlJob
+func (c *Client) StartBulkControl(ctx context.Context, req BulkControlRequest) (*BulkControlJob, error) {
+	req.Async = true
+	var out BulkControlJob
+	_, err := c.Do(ctx, http.MethodPost, APIPrefix+"/devices/control", nil, req, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// BulkControlJob returns the progress of an asynchronous bulk control run
+func (c *Client) BulkControlJob(ctx context.Context, id string) (*BulkControlJob, error) {
+	var out BulkControlJob
+	_, err := c.Do(ctx, http.MethodGet, fmt.Sprintf(APIPrefix+"/devices/control/jobs/%s", url.PathEscape(id)), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RecoveryActions returns supervisor recovery actions, newest first. A zero
+// deviceID returns actions for every device; a zero limit uses the server
+// default.
+func (c *Client) RecoveryActions(ctx context.Context, deviceID uint, limit int) ([]RecoveryAction, error) {
+	query := url.Values{}
+	if deviceID > 0 {
+		query.Set("device_id", strconv.FormatUint(uint64(deviceID), 10))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var out struct {
+		Items []RecoveryAction `json:"actions"`
+	}
+	_, err := c.Do(ctx, http.MethodGet, APIPrefix+"/supervisor/actions", query, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+// RunSupervisor runs one supervisor round; with dryRun the due actions are
+// returned without being taken
+func (c *Client) RunSupervisor(ctx context.Context, dryRun bool) ([]RecoveryAction, error) {
+	body := map[string]interface{}{
+		"dry_run": dryRun,
+	}
+	var out struct {
+		Items []RecoveryAction `json:"actions"`
+	}
+	_, err := c.Do(ctx, http.MethodPost, APIPrefix+"/supervisor/run", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+// Preflight checks whether the selected devices reach their gateway, MQTT
+// broker and SNTP server
+func (c *Client) Preflight(ctx context.Context, req PreflightRequest) (*PreflightReport, error) {
+	var out PreflightReport
+	_, err := c.Do(ctx, http.MethodPost, APIPrefix+"/diagnostics/preflight", nil, req, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ClockSkewReport returns the latest clock skew report; refresh reads device
+// clocks now
+func (c *Client) ClockSkewReport(ctx context.Context, refresh bool) (*ClockSkewReport, error) {
+	query := url.Values{}
+	if refresh {
+		query.Set("refresh", strconv.FormatBool(refresh))
+	}
+	var out struct {
+		Items ClockSkewReport `json:"report"`
+	}
+	_, err := c.Do(ctx, http.MethodGet, APIPrefix+"/reports/clock-skew", query, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out.Items, nil
+}
+
+// RemediateClockSkew pushes an SNTP server to devices with a skewed clock
+func (c *Client) RemediateClockSkew(ctx context.Context, req ClockSkewRemediation) ([]ClockSkewCorrection, error) {
+	var out struct {
+		Items []ClockSkewCorrection `json:"results"`
+	}
+	_, err := c.Do(ctx, http.MethodPost, APIPrefix+"/reports/clock-skew/remediate", nil, req, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+// ConfigLintReport lints the stored configuration of every device, optionally
+// only those carrying tag and only findings at or above minSeverity
+func (c *Client) ConfigLintReport(ctx context.Context, tag string, minSeverity string) (*ConfigLintSummary, error) {
+	query := url.Values{}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	if minSeverity != "" {
+		query.Set("min_severity", minSeverity)
+	}
+	var out ConfigLintSummary
+	_, err := c.Do(ctx, http.MethodGet, APIPrefix+"/reports/config-lint", query, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeviceConfigLint lints the stored configuration of one device
+func (c *Client) DeviceConfigLint(ctx context.Context, id uint) (*DeviceLintReport, error) {
+	var out DeviceLintReport
+	_, err := c.Do(ctx, http.MethodGet, fmt.Sprintf(APIPrefix+"/devices/%d/config/lint", id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StageWiFiRotation records new Wi-Fi credentials for the selected devices
+// without pushing them
+func (c *Client) StageWiFiRotation(ctx context.Context, req WiFiRotationRequest) (*WiFiRotation, error) {
+	var out WiFiRotation
+	_, err := c.Do(ctx, http.MethodPost, APIPrefix+"/wifi-rotations", nil, req, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListWiFiRotations returns the known Wi-Fi rotations
+func (c *Client) ListWiFiRotations(ctx context.Context) ([]WiFiRotation, error) {
+	var out struct {
+		Items []WiFiRotation `json:"rotations"`
+	}
+	_, err := c.Do(ctx, http.MethodGet, APIPrefix+"/wifi-rotations", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+// GetWiFiRotation returns one Wi-Fi rotation
+func (c *Client) GetWiFiRotation(ctx context.Context, id string) (*WiFiRotation, error) {
+	var out WiFiRotation
+	_, err := c.Do(ctx, http.MethodGet, fmt.Sprintf(APIPrefix+"/wifi-rotations/%s", url.PathEscape(id)), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StartWiFiRotation starts pushing a staged rotation; poll GetWiFiRotation
+// for progress
+func (c *Client) StartWiFiRotation(ctx context.Context, id string) (*WiFiRotation, error) {
+	var out WiFiRotation
+	_, err := c.Do(ctx, http.MethodPost, fmt.Sprintf(APIPrefix+"/wifi-rotations/%s/start", url.PathEscape(id)), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VerifyWiFiRotation probes stragglers and rescued devices again
+func (c *Client) VerifyWiFiRotation(ctx context.Context, id string) (*WiFiRotation, error) {
+	var out WiFiRotation
+	_, err := c.Do(ctx, http.MethodPost, fmt.Sprintf(APIPrefix+"/wifi-rotations/%s/verify", url.PathEscape(id)), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RescueWiFiRotation queues provisioning agent tasks for stragglers
+func (c *Client) RescueWiFiRotation(ctx context.Context, id string) (*WiFiRotation, error) {
+	var out WiFiRotation
+	_, err := c.Do(ctx, http.MethodPost, fmt.Sprintf(APIPrefix+"/wifi-rotations/%s/rescue", url.PathEscape(id)), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSubnets returns the declared subnets with their reserved ranges
+func (c *Client) ListSubnets(ctx context.Context) ([]IPSubnet, error) {
+	var out struct {
+		Items []IPSubnet `json:"subnets"`
+	}
+	_, err := c.Do(ctx, http.MethodGet, APIPrefix+"/ipam/subnets", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+// CreateSubnet declares a subnet for static IP planning
+func (c *Client) CreateSubnet(ctx context.Context, subnet IPSubnet) (*IPSubnet, error) {
+	var out IPSubnet
+	_, err := c.Do(ctx, http.MethodPost, APIPrefix+"/ipam/subnets", nil, subnet, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteSubnet removes a subnet and its reserved ranges
+func (c *Client) DeleteSubnet(ctx context.Context, subnetID uint) error {
+	_, err := c.Do(ctx, http.MethodDelete, fmt.Sprintf(APIPrefix+"/ipam/subnets/%d", subnetID), nil, nil, nil)
+	return err
+}
+
+// AddReservedRange reserves an address range inside a subnet
+func (c *Client) AddReservedRange(ctx context.Context, subnetID uint, rng IPReservedRange) (*IPReservedRange, error) {
+	var out IPReservedRange
+	_, err := c.Do(ctx, http.MethodPost, fmt.Sprintf(APIPrefix+"/ipam/subnets/%d/ranges", subnetID), nil, rng, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteReservedRange removes a reserved range
+func (c *Client) DeleteReservedRange(ctx context.Context, subnetID uint, rangeID uint) error {
+	_, err := c.Do(ctx, http.MethodDelete, fmt.Sprintf(APIPrefix+"/ipam/subnets/%d/ranges/%d", subnetID, rangeID), nil, nil, nil)
+	return err
+}
+
+// FreeAddresses suggests up to count addresses in a subnet that no device
+// uses; a zero count uses the server default
+func (c *Client) FreeAddresses(ctx context.Context, subnetID uint, count int) ([]string, error) {
+	query := url.Values{}
+	if count > 0 {
+		query.Set("count", strconv.Itoa(count))
+	}
+	var out struct {
+		Items []string `json:"addresses"`
+	}
+	_, err := c.Do(ctx, http.MethodGet, fmt.Sprintf(APIPrefix+"/ipam/subnets/%d/free", subnetID), query, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+// IPPlan returns subnet usage, device addressing and conflicts
+func (c *Client) IPPlan(ctx context.Context) (*IPPlanReport, error) {
+	var out IPPlanReport
+	_, err := c.Do(ctx, http.MethodGet, APIPrefix+"/ipam/plan", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GenerateIPPlan assigns static addresses in a subnet and returns the device
+// configuration and DHCP reservations; nothing is applied
+func (c *Client) GenerateIPPlan(ctx context.Context, req IPPlanRequest) ([]IPPlanChange, error) {
+	var out struct {
+		Items []IPPlanChange `json:"changes"`
+	}
+	_, err := c.Do(ctx, http.MethodPost, APIPrefix+"/ipam/plan/generate", nil, req, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
@@ -0,0 +1,535 @@
+// Command gen writes the generated part of the API client: the request and
+// response types, copied from the server types the handlers encode, and one
+// method per route listed in spec.go.
+//
+// Run it through go generate in api/client after changing a route or a type
+// the API returns; the test of this package fails while the output is stale.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// modulePath prefixes the import paths of the server packages
+const modulePath = "github.com/ginsys/shelly-manager"
+
+// output is the generated file, relative to the api/client directory
+const output = "generated.go"
+
+func main() {
+	root, err := moduleRoot()
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := generate(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "api", "client", output), src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// moduleRoot finds the directory holding go.mod above the working directory
+func moduleRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("go.mod not found")
+		}
+		dir = parent
+	}
+}
+
+// generator collects the types reachable from the operations and renders
+// them with their server doc comments
+type generator struct {
+	root    string
+	names   map[reflect.Type]string
+	order   []reflect.Type
+	docs    map[string]map[string]*ast.TypeSpec // package path -> type name -> spec
+	decls   map[*ast.TypeSpec]*ast.GenDecl
+	imports map[string]bool
+}
+
+func generate(root string) ([]byte, error) {
+	g := &generator{
+		root:    root,
+		names:   map[reflect.Type]string{},
+		docs:    map[string]map[string]*ast.TypeSpec{},
+		decls:   map[*ast.TypeSpec]*ast.GenDecl{},
+		imports: map[string]bool{},
+	}
+
+	var methods bytes.Buffer
+	for _, op := range operations {
+		if err := g.method(&methods, op); err != nil {
+			return nil, fmt.Errorf("%s: %w", op.Name, err)
+		}
+	}
+	for _, t := range types {
+		if _, err := g.typeExpr(t); err != nil {
+			return nil, err
+		}
+	}
+
+	var decls bytes.Buffer
+	for i := 0; i < len(g.order); i++ { // order grows while rendering
+		if err := g.typeDecl(&decls, g.order[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by go run ./internal/gen; DO NOT EDIT.\n\npackage client\n\n")
+	if len(g.imports) > 0 {
+		paths := make([]string, 0, len(g.imports))
+		for p := range g.imports {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		out.WriteString("import (\n")
+		for _, p := range paths {
+			fmt.Fprintf(&out, "%q\n", p)
+		}
+		out.WriteString(")\n\n")
+	}
+	if len(constants) > 0 {
+		out.WriteString("// Pre-flight check names\nconst (\n")
+		for _, c := range constants {
+			fmt.Fprintf(&out, "%s = %q\n", c.Name, c.Value)
+		}
+		out.WriteString(")\n\n")
+	}
+	routes(&out)
+	out.Write(decls.Bytes())
+	out.Write(methods.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+// routes renders the Routes table
+func routes(w *bytes.Buffer) {
+	w.WriteString("// Routes lists every route the client calls. The server tests check that each\n")
+	w.WriteString("// of them is registered, so the client cannot drift from the router.\n")
+	w.WriteString("var Routes = []Route{\n")
+	seen := map[string]bool{}
+	for _, op := range operations {
+		key := op.Method + " " + op.Path
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if op.Root {
+			fmt.Fprintf(w, "{%q, %q},\n", op.Method, op.Path)
+		} else {
+			fmt.Fprintf(w, "{%q, APIPrefix + %q},\n", op.Method, op.Path)
+		}
+	}
+	w.WriteString("}\n\n")
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// typeExpr returns the Go expression of t in the client package, queueing
+// server struct types for generation
+func (g *generator) typeExpr(t reflect.Type) (string, error) {
+	switch t {
+	case timeType:
+		g.imports["time"] = true
+		return "time.Time", nil
+	case rawType:
+		g.imports["encoding/json"] = true
+		return "json.RawMessage", nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem, err := g.typeExpr(t.Elem())
+		return "*" + elem, err
+	case reflect.Slice:
+		elem, err := g.typeExpr(t.Elem())
+		return "[]" + elem, err
+	case reflect.Map:
+		key, err := g.typeExpr(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := g.typeExpr(t.Elem())
+		return "map[" + key + "]" + elem, err
+	case reflect.Interface:
+		if t.NumMethod() > 0 {
+			return "", fmt.Errorf("interface type %s cannot be decoded", t)
+		}
+		return "interface{}", nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return "", fmt.Errorf("anonymous struct %s", t)
+		}
+		if !strings.HasPrefix(t.PkgPath(), modulePath+"/") {
+			return "", fmt.Errorf("type %s.%s is not a server type", t.PkgPath(), t.Name())
+		}
+		if name, ok := g.names[t]; ok {
+			return name, nil
+		}
+		for other, name := range g.names {
+			if name == t.Name() {
+				return "", fmt.Errorf("%s.%s and %s.%s share a name", t.PkgPath(), t.Name(), other.PkgPath(), name)
+			}
+		}
+		g.names[t] = t.Name()
+		g.order = append(g.order, t)
+		return t.Name(), nil
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return "", fmt.Errorf("type %s cannot be encoded", t)
+	}
+	// Named basic types such as a string enum become their kind
+	return t.Kind().String(), nil
+}
+
+// typeDecl renders the client copy of the server struct t
+func (g *generator) typeDecl(w *bytes.Buffer, t reflect.Type) error {
+	spec, err := g.spec(t)
+	if err != nil {
+		return err
+	}
+	fields := map[string]*ast.Field{}
+	if st, ok := spec.Type.(*ast.StructType); ok {
+		for _, f := range st.Fields.List {
+			for _, n := range f.Names {
+				fields[n.Name] = f
+			}
+			if len(f.Names) == 0 {
+				fields[embeddedName(f.Type)] = f
+			}
+		}
+	}
+
+	doc := spec.Doc
+	if doc == nil {
+		if decl := g.decls[spec]; len(decl.Specs) == 1 {
+			doc = decl.Doc
+		}
+	}
+	writeComment(w, "", doc)
+	fmt.Fprintf(w, "type %s struct {\n", g.names[t])
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		expr, err := g.typeExpr(f.Type)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), f.Name, err)
+		}
+		src := fields[f.Name]
+		if src != nil && strings.HasPrefix(src.Doc.Text(), f.Name+" ") {
+			// Only doc comments about the field itself; notes on the
+			// storage of a group of fields stay with the server
+			writeComment(w, "\t", src.Doc)
+		}
+		if f.Anonymous && tag == "" {
+			fmt.Fprintf(w, "\t%s", expr)
+		} else if tag == "" {
+			fmt.Fprintf(w, "\t%s %s", f.Name, expr)
+		} else {
+			fmt.Fprintf(w, "\t%s %s `json:%q`", f.Name, expr, tag)
+		}
+		if src != nil && src.Comment != nil {
+			fmt.Fprintf(w, " // %s", strings.TrimSpace(src.Comment.Text()))
+		}
+		w.WriteString("\n")
+	}
+	w.WriteString("}\n\n")
+	return nil
+}
+
+// spec finds the declaration of t in the server sources
+func (g *generator) spec(t reflect.Type) (*ast.TypeSpec, error) {
+	pkg := t.PkgPath()
+	if _, ok := g.docs[pkg]; !ok {
+		g.docs[pkg] = map[string]*ast.TypeSpec{}
+		dir := filepath.Join(g.root, filepath.FromSlash(strings.TrimPrefix(pkg, modulePath+"/")))
+		fset := token.NewFileSet()
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if strings.HasSuffix(file, "_test.go") {
+				continue
+			}
+			f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range f.Decls {
+				decl, ok := d.(*ast.GenDecl)
+				if !ok || decl.Tok != token.TYPE {
+					continue
+				}
+				for _, s := range decl.Specs {
+					ts := s.(*ast.TypeSpec)
+					g.docs[pkg][ts.Name.Name] = ts
+					g.decls[ts] = decl
+				}
+			}
+		}
+	}
+	spec, ok := g.docs[pkg][t.Name()]
+	if !ok {
+		return nil, fmt.Errorf("declaration of %s.%s not found", pkg, t.Name())
+	}
+	return spec, nil
+}
+
+// embeddedName is the field name of an embedded type expression
+func embeddedName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	case *ast.StarExpr:
+		return embeddedName(e.X)
+	}
+	return ""
+}
+
+// writeComment copies a doc comment with the given indent
+func writeComment(w *bytes.Buffer, indent string, doc *ast.CommentGroup) {
+	if doc == nil {
+		return
+	}
+	for _, c := range doc.List {
+		fmt.Fprintf(w, "%s%s\n", indent, c.Text)
+	}
+}
+
+var placeholder = regexp.MustCompile(`\{[^}]+\}`)
+
+// method renders the client method of op
+func (g *generator) method(w *bytes.Buffer, op operation) error {
+	g.imports["context"] = true
+	g.imports["net/http"] = true
+
+	params := []string{"ctx context.Context"}
+	for _, p := range op.Params {
+		params = append(params, p.Name+" "+p.Type)
+	}
+	for _, q := range op.Query {
+		params = append(params, q.Name+" "+q.Type)
+	}
+	if op.Page != "" {
+		params = append(params, "opts *ListOptions")
+	}
+	var bodyExpr string
+	switch {
+	case op.Body != nil:
+		expr, err := g.typeExpr(op.Body)
+		if err != nil {
+			return err
+		}
+		params = append(params, op.BodyName+" "+expr)
+		bodyExpr = op.BodyName
+	case len(op.BodyFields) > 0:
+		for _, f := range op.BodyFields {
+			params = append(params, f.Name+" "+f.Type)
+		}
+		bodyExpr = "body"
+	}
+
+	var result, ret string
+	if op.Result != nil {
+		expr, err := g.typeExpr(op.Result)
+		if err != nil {
+			return err
+		}
+		result = expr
+		switch {
+		case op.Page != "":
+			ret = "*" + op.Page
+		case op.Result.Kind() == reflect.Struct:
+			ret = "*" + expr
+		default:
+			ret = expr
+		}
+	}
+
+	// Path with its parameters
+	path := op.Path
+	if !op.Root {
+		path = "APIPrefix + " + fmt.Sprintf("%q", path)
+	} else {
+		path = fmt.Sprintf("%q", path)
+	}
+	if len(op.Params) > 0 {
+		holes := placeholder.FindAllString(op.Path, -1)
+		if len(holes) != len(op.Params) {
+			return fmt.Errorf("path %s has %d parameters, want %d", op.Path, len(holes), len(op.Params))
+		}
+		var values []string
+		for _, p := range op.Params {
+			value := p.Name
+			if p.Type == "string" {
+				value = "url.PathEscape(" + p.Name + ")"
+				g.imports["net/url"] = true
+			}
+			values = append(values, value)
+		}
+		i := 0
+		format := placeholder.ReplaceAllStringFunc(op.Path, func(string) string {
+			p := op.Params[i]
+			i++
+			if p.Type == "string" {
+				return "%s"
+			}
+			return "%d"
+		})
+		g.imports["fmt"] = true
+		prefix := "APIPrefix+"
+		if op.Root {
+			prefix = ""
+		}
+		path = fmt.Sprintf("fmt.Sprintf(%s%q, %s)", prefix, format, strings.Join(values, ", "))
+	}
+
+	writeDoc(w, op.Doc)
+	if ret == "" {
+		fmt.Fprintf(w, "func (c *Client) %s(%s) error {\n", op.Name, strings.Join(params, ", "))
+	} else {
+		fmt.Fprintf(w, "func (c *Client) %s(%s) (%s, error) {\n", op.Name, strings.Join(params, ", "), ret)
+	}
+
+	query := "nil"
+	if len(op.Query) > 0 || op.Page != "" {
+		g.imports["net/url"] = true
+		query = "query"
+		w.WriteString("query := url.Values{}\n")
+		for _, q := range op.Query {
+			if err := g.writeQuery(w, q); err != nil {
+				return err
+			}
+		}
+		if op.Page != "" {
+			g.imports["strconv"] = true
+			w.WriteString("if opts != nil {\n")
+			w.WriteString("if opts.Page > 0 {\nquery.Set(\"page\", strconv.Itoa(opts.Page))\n}\n")
+			w.WriteString("if opts.PageSize > 0 {\nquery.Set(\"page_size\", strconv.Itoa(opts.PageSize))\n}\n")
+			w.WriteString("}\n")
+		}
+	}
+	if len(op.BodyFields) > 0 {
+		w.WriteString("body := map[string]interface{}{\n")
+		for _, f := range op.BodyFields {
+			fmt.Fprintf(w, "%q: %s,\n", f.Key, f.Name)
+		}
+		w.WriteString("}\n")
+	}
+	if op.Set != "" {
+		w.WriteString(op.Set + "\n")
+	}
+	if bodyExpr == "" {
+		bodyExpr = "nil"
+	}
+
+	method := "http.Method" + strings.ToUpper(op.Method[:1]) + strings.ToLower(op.Method[1:])
+	if ret == "" {
+		fmt.Fprintf(w, "_, err := c.Do(ctx, %s, %s, %s, %s, nil)\nreturn err\n}\n\n", method, path, query, bodyExpr)
+		return nil
+	}
+
+	out := "out"
+	if op.Field != "" {
+		fmt.Fprintf(w, "var out struct {\nItems %s `json:%q`\n}\n", result, op.Field)
+		out = "out.Items"
+	} else {
+		fmt.Fprintf(w, "var out %s\n", result)
+	}
+	metaVar := "_"
+	if op.Page != "" {
+		metaVar = "meta"
+	}
+	fmt.Fprintf(w, "%s, err := c.Do(ctx, %s, %s, %s, %s, &out)\n", metaVar, method, path, query, bodyExpr)
+	w.WriteString("if err != nil {\nreturn nil, err\n}\n")
+	switch {
+	case op.Page != "":
+		fmt.Fprintf(w, "page := &%s{%s: %s}\n", op.Page, op.PageField, out)
+		w.WriteString("if meta != nil {\npage.Pagination = meta.Pagination\n}\nreturn page, nil\n")
+	case strings.HasPrefix(ret, "*"):
+		fmt.Fprintf(w, "return &%s, nil\n", out)
+	default:
+		fmt.Fprintf(w, "return %s, nil\n", out)
+	}
+	w.WriteString("}\n\n")
+
+	if op.Page != "" {
+		fmt.Fprintf(w, "// %s is one page of the %s result\n", op.Page, op.Name)
+		fmt.Fprintf(w, "type %s struct {\n%s %s\nPagination *Pagination\n}\n\n", op.Page, op.PageField, result)
+	}
+	return nil
+}
+
+// writeQuery sets query parameter q unless it is the zero value
+func (g *generator) writeQuery(w *bytes.Buffer, q arg) error {
+	var value, zero string
+	if q.Type != "string" {
+		g.imports["strconv"] = true
+	}
+	switch q.Type {
+	case "uint":
+		value, zero = "strconv.FormatUint(uint64("+q.Name+"), 10)", q.Name+" > 0"
+	case "int":
+		value, zero = "strconv.Itoa("+q.Name+")", q.Name+" > 0"
+	case "string":
+		value, zero = q.Name, q.Name+` != ""`
+	case "bool":
+		value, zero = "strconv.FormatBool("+q.Name+")", q.Name
+	default:
+		return fmt.Errorf("query parameter %s has unsupported type %s", q.Name, q.Type)
+	}
+	if q.Always {
+		fmt.Fprintf(w, "query.Set(%q, %s)\n", q.Key, value)
+		return nil
+	}
+	fmt.Fprintf(w, "if %s {\nquery.Set(%q, %s)\n}\n", zero, q.Key, value)
+	return nil
+}
+
+// writeDoc renders a method doc comment
+func writeDoc(w *bytes.Buffer, doc string) {
+	for _, line := range strings.Split(doc, "\n") {
+		fmt.Fprintf(w, "// %s\n", line)
+	}
+}
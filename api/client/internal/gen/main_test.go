@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGeneratedClientUpToDate fails when a route or server type changed
+// without running go generate in api/client
+func TestGeneratedClientUpToDate(t *testing.T) {
+	root, err := moduleRoot()
+	require.NoError(t, err)
+	want, err := generate(root)
+	require.NoError(t, err)
+	got, err := os.ReadFile(filepath.Join(root, "api", "client", output))
+	require.NoError(t, err)
+	require.Equal(t, string(want), string(got), "api/client/%s is stale; run go generate ./api/client", output)
+}
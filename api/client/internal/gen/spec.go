@@ -0,0 +1,307 @@
+package main
+
+import (
+	"reflect"
+
+	"github.com/ginsys/shelly-manager/internal/api"
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/service"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// typeOf returns the reflect type of T
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// arg is a method parameter. Path parameters fill the {placeholders} of the
+// route in order, query parameters are sent under Key.
+type arg struct {
+	Name string
+	Type string // uint, int, string, bool or a map type for body fields
+	Key  string // query parameter or body field name
+	// Always sends a query parameter even when it is the zero value
+	Always bool
+}
+
+// operation is one API route and the client method calling it
+type operation struct {
+	Name   string
+	Doc    string
+	Method string
+	Path   string // mux-style path below APIPrefix, e.g. /devices/{id}
+	Root   bool   // Path is relative to the server root instead of APIPrefix
+
+	Params []arg // path parameters
+	Query  []arg
+
+	// Body is sent as the request body, passed in as BodyName. BodyFields
+	// instead build a JSON object from method parameters.
+	Body       reflect.Type
+	BodyName   string
+	BodyFields []arg
+	// Set is a statement applied to the body before it is sent
+	Set string
+
+	// Result is the type of the response data, nil for none. With Field the
+	// result is the property of that name of the data object.
+	Result reflect.Type
+	Field  string
+
+	// Page makes the method take *ListOptions and return a type of this
+	// name holding the Field items and the pagination metadata
+	Page      string
+	PageField string
+}
+
+// types are generated even when no operation refers to them
+var types = []reflect.Type{
+	typeOf[service.PreflightRequest](),
+}
+
+// constants are copied from the server packages
+var constants = []struct {
+	Name  string
+	Value string
+}{
+	{"PreflightGateway", service.PreflightGateway},
+	{"PreflightMQTT", service.PreflightMQTT},
+	{"PreflightSNTP", service.PreflightSNTP},
+}
+
+var (
+	id       = arg{Name: "id", Type: "uint"}
+	stringID = arg{Name: "id", Type: "string"}
+	subnetID = arg{Name: "subnetID", Type: "uint"}
+)
+
+// operations lists the routes the client calls, in method order
+var operations = []operation{
+	{
+		Name: "Health", Doc: "Health calls /healthz",
+		Method: "GET", Path: "/healthz", Root: true,
+		Result: typeOf[api.Health](),
+	},
+	{
+		Name: "Version", Doc: "Version calls /version",
+		Method: "GET", Path: "/version", Root: true,
+		Result: typeOf[api.VersionInfo](),
+	},
+	{
+		Name: "ListDevices", Doc: "ListDevices returns the devices, one page at a time when opts sets a page size",
+		Method: "GET", Path: "/devices",
+		Result: typeOf[[]database.Device](), Field: "devices",
+		Page: "DeviceList", PageField: "Devices",
+	},
+	{
+		Name: "GetDevice", Doc: "GetDevice returns one device",
+		Method: "GET", Path: "/devices/{id}", Params: []arg{id},
+		Result: typeOf[database.Device](),
+	},
+	{
+		Name: "CreateDevice", Doc: "CreateDevice adds a device to the inventory",
+		Method: "POST", Path: "/devices",
+		Body: typeOf[database.Device](), BodyName: "device",
+		Result: typeOf[database.Device](),
+	},
+	{
+		Name: "UpdateDevice", Doc: "UpdateDevice replaces the stored fields of a device",
+		Method: "PUT", Path: "/devices/{id}", Params: []arg{id},
+		Body: typeOf[database.Device](), BodyName: "device",
+		Result: typeOf[database.Device](),
+	},
+	{
+		Name: "DeleteDevice", Doc: "DeleteDevice removes a device from the inventory",
+		Method: "DELETE", Path: "/devices/{id}", Params: []arg{id},
+	},
+	{
+		Name: "ControlDevice",
+		Doc: "ControlDevice runs an action such as on, off, toggle or reboot on a device.\n" +
+			"With force the action is attempted even if the device is marked offline.",
+		Method: "POST", Path: "/devices/{id}/control", Params: []arg{id},
+		BodyFields: []arg{
+			{Name: "action", Type: "string", Key: "action"},
+			{Name: "params", Type: "map[string]interface{}", Key: "params"},
+			{Name: "force", Type: "bool", Key: "force"},
+		},
+		Result: typeOf[api.ControlResult](),
+	},
+	{
+		Name: "DeviceStatus",
+		Doc: "DeviceStatus returns the live status read from a device. The layout depends\n" +
+			"on the device generation.",
+		Method: "GET", Path: "/devices/{id}/status", Params: []arg{id},
+		Result: typeOf[map[string]interface{}](),
+	},
+	{
+		Name: "DeviceConfig", Doc: "DeviceConfig returns the stored configuration of a device and its sync status",
+		Method: "GET", Path: "/devices/{id}/config", Params: []arg{id},
+		Result: typeOf[configuration.DeviceConfig](),
+	},
+	{
+		Name: "DeviceEnergy", Doc: "DeviceEnergy returns the energy reading of a device channel",
+		Method: "GET", Path: "/devices/{id}/energy", Params: []arg{id},
+		Query:  []arg{{Name: "channel", Type: "int", Key: "channel", Always: true}},
+		Result: typeOf[shelly.EnergyData](),
+	},
+	{
+		Name: "BulkControl", Doc: "BulkControl runs an action on the selected devices and waits for the results",
+		Method: "POST", Path: "/devices/control",
+		Body: typeOf[service.BulkControlRequest](), BodyName: "req", Set: "req.Async = false",
+		Result: typeOf[api.BulkControlSummary](),
+	},
+	{
+		Name: "StartBulkControl",
+		Doc: "StartBulkControl runs an action on the selected devices in the background\n" +
+			"and returns the job to poll with BulkControlJob",
+		Method: "POST", Path: "/devices/control",
+		Body: typeOf[service.BulkControlRequest](), BodyName: "req", Set: "req.Async = true",
+		Result: typeOf[service.BulkControlJob](),
+	},
+	{
+		Name: "BulkControlJob", Doc: "BulkControlJob returns the progress of an asynchronous bulk control run",
+		Method: "GET", Path: "/devices/control/jobs/{id}", Params: []arg{stringID},
+		Result: typeOf[service.BulkControlJob](),
+	},
+	{
+		Name: "RecoveryActions",
+		Doc: "RecoveryActions returns supervisor recovery actions, newest first. A zero\n" +
+			"deviceID returns actions for every device; a zero limit uses the server\n" +
+			"default.",
+		Method: "GET", Path: "/supervisor/actions",
+		Query: []arg{
+			{Name: "deviceID", Type: "uint", Key: "device_id"},
+			{Name: "limit", Type: "int", Key: "limit"},
+		},
+		Result: typeOf[[]database.RecoveryAction](), Field: "actions",
+	},
+	{
+		Name: "RunSupervisor",
+		Doc: "RunSupervisor runs one supervisor round; with dryRun the due actions are\n" +
+			"returned without being taken",
+		Method: "POST", Path: "/supervisor/run",
+		BodyFields: []arg{{Name: "dryRun", Type: "bool", Key: "dry_run"}},
+		Result:     typeOf[[]database.RecoveryAction](), Field: "actions",
+	},
+	{
+		Name: "Preflight",
+		Doc: "Preflight checks whether the selected devices reach their gateway, MQTT\n" +
+			"broker and SNTP server",
+		Method: "POST", Path: "/diagnostics/preflight",
+		Body: typeOf[service.PreflightRequest](), BodyName: "req",
+		Result: typeOf[service.PreflightReport](),
+	},
+	{
+		Name: "ClockSkewReport",
+		Doc: "ClockSkewReport returns the latest clock skew report; refresh reads device\n" +
+			"clocks now",
+		Method: "GET", Path: "/reports/clock-skew",
+		Query:  []arg{{Name: "refresh", Type: "bool", Key: "refresh"}},
+		Result: typeOf[service.ClockSkewReport](), Field: "report",
+	},
+	{
+		Name: "RemediateClockSkew", Doc: "RemediateClockSkew pushes an SNTP server to devices with a skewed clock",
+		Method: "POST", Path: "/reports/clock-skew/remediate",
+		Body: typeOf[service.ClockSkewRemediation](), BodyName: "req",
+		Result: typeOf[[]service.ClockSkewCorrection](), Field: "results",
+	},
+	{
+		Name: "ConfigLintReport",
+		Doc: "ConfigLintReport lints the stored configuration of every device, optionally\n" +
+			"only those carrying tag and only findings at or above minSeverity",
+		Method: "GET", Path: "/reports/config-lint",
+		Query: []arg{
+			{Name: "tag", Type: "string", Key: "tag"},
+			{Name: "minSeverity", Type: "string", Key: "min_severity"},
+		},
+		Result: typeOf[service.ConfigLintSummary](),
+	},
+	{
+		Name: "DeviceConfigLint", Doc: "DeviceConfigLint lints the stored configuration of one device",
+		Method: "GET", Path: "/devices/{id}/config/lint", Params: []arg{id},
+		Result: typeOf[service.DeviceLintReport](),
+	},
+	{
+		Name: "StageWiFiRotation",
+		Doc: "StageWiFiRotation records new Wi-Fi credentials for the selected devices\n" +
+			"without pushing them",
+		Method: "POST", Path: "/wifi-rotations",
+		Body: typeOf[service.WiFiRotationRequest](), BodyName: "req",
+		Result: typeOf[service.WiFiRotation](),
+	},
+	{
+		Name: "ListWiFiRotations", Doc: "ListWiFiRotations returns the known Wi-Fi rotations",
+		Method: "GET", Path: "/wifi-rotations",
+		Result: typeOf[[]service.WiFiRotation](), Field: "rotations",
+	},
+	{
+		Name: "GetWiFiRotation", Doc: "GetWiFiRotation returns one Wi-Fi rotation",
+		Method: "GET", Path: "/wifi-rotations/{id}", Params: []arg{stringID},
+		Result: typeOf[service.WiFiRotation](),
+	},
+	{
+		Name: "StartWiFiRotation",
+		Doc: "StartWiFiRotation starts pushing a staged rotation; poll GetWiFiRotation\n" +
+			"for progress",
+		Method: "POST", Path: "/wifi-rotations/{id}/start", Params: []arg{stringID},
+		Result: typeOf[service.WiFiRotation](),
+	},
+	{
+		Name: "VerifyWiFiRotation", Doc: "VerifyWiFiRotation probes stragglers and rescued devices again",
+		Method: "POST", Path: "/wifi-rotations/{id}/verify", Params: []arg{stringID},
+		Result: typeOf[service.WiFiRotation](),
+	},
+	{
+		Name: "RescueWiFiRotation", Doc: "RescueWiFiRotation queues provisioning agent tasks for stragglers",
+		Method: "POST", Path: "/wifi-rotations/{id}/rescue", Params: []arg{stringID},
+		Result: typeOf[service.WiFiRotation](),
+	},
+	{
+		Name: "ListSubnets", Doc: "ListSubnets returns the declared subnets with their reserved ranges",
+		Method: "GET", Path: "/ipam/subnets",
+		Result: typeOf[[]database.IPSubnet](), Field: "subnets",
+	},
+	{
+		Name: "CreateSubnet", Doc: "CreateSubnet declares a subnet for static IP planning",
+		Method: "POST", Path: "/ipam/subnets",
+		Body: typeOf[database.IPSubnet](), BodyName: "subnet",
+		Result: typeOf[database.IPSubnet](),
+	},
+	{
+		Name: "DeleteSubnet", Doc: "DeleteSubnet removes a subnet and its reserved ranges",
+		Method: "DELETE", Path: "/ipam/subnets/{id}", Params: []arg{subnetID},
+	},
+	{
+		Name: "AddReservedRange", Doc: "AddReservedRange reserves an address range inside a subnet",
+		Method: "POST", Path: "/ipam/subnets/{id}/ranges", Params: []arg{subnetID},
+		Body: typeOf[database.IPReservedRange](), BodyName: "rng",
+		Result: typeOf[database.IPReservedRange](),
+	},
+	{
+		Name: "DeleteReservedRange", Doc: "DeleteReservedRange removes a reserved range",
+		Method: "DELETE", Path: "/ipam/subnets/{id}/ranges/{range_id}",
+		Params: []arg{subnetID, {Name: "rangeID", Type: "uint"}},
+	},
+	{
+		Name: "FreeAddresses",
+		Doc: "FreeAddresses suggests up to count addresses in a subnet that no device\n" +
+			"uses; a zero count uses the server default",
+		Method: "GET", Path: "/ipam/subnets/{id}/free", Params: []arg{subnetID},
+		Query:  []arg{{Name: "count", Type: "int", Key: "count"}},
+		Result: typeOf[[]string](), Field: "addresses",
+	},
+	{
+		Name: "IPPlan", Doc: "IPPlan returns subnet usage, device addressing and conflicts",
+		Method: "GET", Path: "/ipam/plan",
+		Result: typeOf[service.IPPlanReport](),
+	},
+	{
+		Name: "GenerateIPPlan",
+		Doc: "GenerateIPPlan assigns static addresses in a subnet and returns the device\n" +
+			"configuration and DHCP reservations; nothing is applied",
+		Method: "POST", Path: "/ipam/plan/generate",
+		Body: typeOf[service.IPPlanRequest](), BodyName: "req",
+		Result: typeOf[[]service.IPPlanChange](), Field: "changes",
+	},
+}
@@ -7,31 +7,43 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 	"gorm.io/gorm"
 
+	"github.com/ginsys/shelly-manager/api/client"
 	"github.com/ginsys/shelly-manager/internal/api"
 	"github.com/ginsys/shelly-manager/internal/api/middleware"
+	"github.com/ginsys/shelly-manager/internal/cli"
+	"github.com/ginsys/shelly-manager/internal/cluster"
 	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/configuration"
 	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/intake"
 	"github.com/ginsys/shelly-manager/internal/logging"
 	"github.com/ginsys/shelly-manager/internal/metrics"
+	"github.com/ginsys/shelly-manager/internal/naming"
 	"github.com/ginsys/shelly-manager/internal/notification"
 	"github.com/ginsys/shelly-manager/internal/plugins"
 	"github.com/ginsys/shelly-manager/internal/plugins/sync/backup"
+	"github.com/ginsys/shelly-manager/internal/plugins/sync/docsexport"
 	"github.com/ginsys/shelly-manager/internal/plugins/sync/gitops"
 	"github.com/ginsys/shelly-manager/internal/plugins/sync/jsonexport"
 	"github.com/ginsys/shelly-manager/internal/plugins/sync/opnsense"
+	"github.com/ginsys/shelly-manager/internal/plugins/sync/promsd"
 	"github.com/ginsys/shelly-manager/internal/plugins/sync/registry"
 	"github.com/ginsys/shelly-manager/internal/plugins/sync/sma"
 	"github.com/ginsys/shelly-manager/internal/plugins/sync/yamlexport"
 	"github.com/ginsys/shelly-manager/internal/provisioning"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
 	"github.com/ginsys/shelly-manager/internal/security/secrets"
 	"github.com/ginsys/shelly-manager/internal/service"
+	"github.com/ginsys/shelly-manager/internal/shelly"
 	"github.com/ginsys/shelly-manager/internal/sync"
+	"github.com/ginsys/shelly-manager/internal/tui"
 )
 
 // Global variables
@@ -44,29 +56,58 @@ var (
 	metricsCollector    *metrics.Collector
 	metricsHandler      *metrics.Handler
 	syncEngine          *sync.SyncEngine
+	syncPluginNames     []string // sync plugins registered at startup
 	basePluginRegistry  *plugins.Registry
 	pluginRegistry      *registry.PluginRegistry
 	cfg                 *config.Config
 	logger              *logging.Logger
+	elector             *cluster.Elector // set when cluster.enabled
 	configFile          string
+
+	// Remote mode: commands call a running server instead of the database
+	serverURL string
+	apiKey    string
+	apiClient *client.Client
 )
 
+// remoteAnnotation marks commands that work in remote mode
+const remoteAnnotation = "remote"
+
 // Root command
 var rootCmd = &cobra.Command{
 	Use:   "shelly-manager",
 	Short: "Manage Shelly IoT devices",
 	Long: `A comprehensive tool for discovering, configuring, and managing 
 Shelly smart home devices on your network.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if apiClient != nil && !cli.Tooling(cmd) && cmd.Annotations[remoteAnnotation] != "true" {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%s does not support --server; run it on the server host", cmd.CommandPath())
+		}
+		return nil
+	},
 }
 
 // CLI Commands
 var listCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all devices",
+	Use:         "list",
+	Short:       "List all devices",
+	Annotations: map[string]string{remoteAnnotation: "true"},
 	Run: func(cmd *cobra.Command, args []string) {
-		devices, err := dbManager.GetDevices()
-		if err != nil {
-			log.Fatal("Error fetching devices:", err)
+		var devices []database.Device
+		if apiClient != nil {
+			list, err := apiClient.ListDevices(context.Background(), nil)
+			if err != nil {
+				log.Fatal("Error fetching devices:", err)
+			}
+			for _, d := range list.Devices {
+				devices = append(devices, database.Device{ID: d.ID, IP: d.IP, MAC: d.MAC, Type: d.Type, Name: d.Name, Status: d.Status})
+			}
+		} else {
+			var err error
+			if devices, err = dbManager.GetDevices(); err != nil {
+				log.Fatal("Error fetching devices:", err)
+			}
 		}
 
 		fmt.Printf("%-5s %-15s %-18s %-12s %-20s %-10s\n",
@@ -94,7 +135,7 @@ var discoverCmd = &cobra.Command{
 		}
 
 		if network == "auto" && len(cfg.Discovery.Networks) > 0 {
-			fmt.Printf("Discovering devices on configured networks: %v\n", cfg.Discovery.Networks)
+			fmt.Printf("Discovering devices on configured networks: %v\n", config.DiscoveryCIDRs(cfg.Discovery.Networks))
 		} else if network != "auto" {
 			fmt.Printf("Discovering devices on network %s...\n", network)
 		}
@@ -230,7 +271,7 @@ var provisionCmd = &cobra.Command{
 			targetPassword = args[1]
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.DeviceClient.Resolve("", 0).ProvisionTimeoutDuration())
 		defer cancel()
 
 		fmt.Printf("Searching for unprovisioned Shelly devices...\n")
@@ -257,11 +298,36 @@ var provisionCmd = &cobra.Command{
 		enableMQTT, _ := cmd.Flags().GetBool("enable-mqtt")
 		mqttServer, _ := cmd.Flags().GetString("mqtt-server")
 		timeout, _ := cmd.Flags().GetInt("timeout")
+		apPassword, _ := cmd.Flags().GetString("ap-password")
+		apQRCode, _ := cmd.Flags().GetString("ap-qr")
+		var apQR *provisioning.WiFiQRCode
+		if apQRCode != "" {
+			qr, err := provisioning.ParseWiFiQRCode(apQRCode)
+			if err != nil {
+				fmt.Printf("Invalid --ap-qr value: %v\n", err)
+				return
+			}
+			apQR = qr
+		}
+
+		// Names in use, for collision-free generated names
+		takenNames := naming.NameSet{}
+		if existing, err := dbManager.GetDevices(); err == nil {
+			for _, d := range existing {
+				takenNames.Add(d.Name)
+			}
+		}
+		namingPolicy := naming.NewPolicy(cfg.Naming)
 
 		successCount := 0
 		failCount := 0
 
 		for i, device := range devices {
+			// A scanned QR code identifies a single device AP
+			if apQR != nil && !apQR.MatchesDevice(device) {
+				continue
+			}
+
 			fmt.Printf("\n[%d/%d] Provisioning device: %s (%s)\n",
 				i+1, len(devices), device.SSID, device.Model)
 
@@ -277,12 +343,32 @@ var provisionCmd = &cobra.Command{
 				EnableMQTT:   enableMQTT,
 				MQTTServer:   mqttServer,
 				Timeout:      timeout,
+				APPassword:   apPassword,
+				APQRCode:     apQRCode,
 			}
 
-			// If no device name specified, generate one
+			// Pre-registered devices supply their AP password and name
+			if entry, err := shellyService.Intake.Find(ctx, device.MAC, device.SSID); err == nil && entry != nil {
+				if request.APPassword == "" && request.APQRCode == "" {
+					request.APPassword = entry.APPassword
+				}
+				if request.DeviceName == "" {
+					request.DeviceName = entry.Name
+				}
+			}
+
+			// If no device name specified, generate one from the naming template
+			if request.DeviceName == "" && namingPolicy.Enabled() {
+				name, err := namingPolicy.Name(naming.Subject{MAC: device.MAC, Model: device.Model, Generation: device.Generation}, takenNames)
+				if err != nil {
+					fmt.Printf("Warning: naming template failed: %v\n", err)
+				}
+				request.DeviceName = name
+			}
 			if request.DeviceName == "" {
 				request.DeviceName = fmt.Sprintf("Shelly-%s", device.MAC[len(device.MAC)-6:])
 			}
+			takenNames.Add(request.DeviceName)
 
 			result, err := provisioningManager.ProvisionDevice(ctx, device, request)
 			if err != nil {
@@ -312,6 +398,356 @@ var provisionCmd = &cobra.Command{
 	},
 }
 
+var renameCmd = &cobra.Command{
+	Use:   "rename [device-id...]",
+	Short: "Rename devices using the naming template",
+	Long: `Rename devices (all devices when no IDs are given) from naming.template or
+--template. Placeholders: {{site}}, {{room}} (from "site:"/"room:" tags),
+{{model}}, {{model_short}}, {{type}}, {{gen}}, {{mac}}, {{mac_suffix}},
+{{ip_last}} and {{seq}}.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		req := service.RenameRequest{}
+		for _, arg := range args {
+			id, err := strconv.ParseUint(arg, 10, 32)
+			if err != nil {
+				log.Fatal("Invalid device ID: ", arg)
+			}
+			req.DeviceIDs = append(req.DeviceIDs, uint(id))
+		}
+		req.Template, _ = cmd.Flags().GetString("template")
+		req.DryRun, _ = cmd.Flags().GetBool("dry-run")
+		req.Push, _ = cmd.Flags().GetBool("push")
+
+		results, err := shellyService.RenameDevices(context.Background(), req)
+		if err != nil {
+			log.Fatal("Rename failed: ", err)
+		}
+
+		fmt.Printf("%-5s %-25s %-25s %s\n", "ID", "Current", "New", "Result")
+		fmt.Println(strings.Repeat("-", 80))
+		for _, res := range results {
+			status := "unchanged"
+			switch {
+			case res.Error != "":
+				status = "✗ " + res.Error
+			case res.Changed && req.DryRun:
+				status = "would rename"
+			case res.Pushed:
+				status = "✓ renamed and pushed"
+			case res.Changed:
+				status = "✓ renamed"
+			}
+			fmt.Printf("%-5d %-25s %-25s %s\n", res.DeviceID, res.OldName, res.NewName, status)
+		}
+	},
+}
+
+var syncNamesCmd = &cobra.Command{
+	Use:   "sync-names [device-id...]",
+	Short: "Set device names on the devices to match the inventory",
+	Long: `Set each device's own name (Gen1 settings name, Gen2 Sys.SetConfig
+device.name) to its inventory name, keeping mDNS and router client lists
+readable. Selects all devices unless IDs or --tag are given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		req := service.NameSyncRequest{}
+		for _, arg := range args {
+			id, err := strconv.ParseUint(arg, 10, 32)
+			if err != nil {
+				log.Fatal("Invalid device ID: ", arg)
+			}
+			req.DeviceIDs = append(req.DeviceIDs, uint(id))
+		}
+		req.Tag, _ = cmd.Flags().GetString("tag")
+		req.DryRun, _ = cmd.Flags().GetBool("dry-run")
+		req.Force, _ = cmd.Flags().GetBool("force")
+
+		results, err := shellyService.SyncDeviceNames(context.Background(), req)
+		if err != nil {
+			log.Fatal("Name sync failed: ", err)
+		}
+
+		fmt.Printf("%-5s %-25s %-25s %s\n", "ID", "Inventory", "Device", "Result")
+		fmt.Println(strings.Repeat("-", 80))
+		for _, res := range results {
+			status := "in sync"
+			switch {
+			case res.Error != "":
+				status = "✗ " + res.Error
+			case res.Skipped != "":
+				status = "skipped: " + res.Skipped
+			case res.Changed && req.DryRun:
+				status = "would update"
+			case res.Changed:
+				status = "✓ updated"
+			}
+			fmt.Printf("%-5d %-25s %-25s %s\n", res.DeviceID, res.Name, res.DeviceName, status)
+		}
+	},
+}
+
+var cloudDisableCmd = &cobra.Command{
+	Use:   "cloud-disable [device-id...]",
+	Short: "Audit and disable Shelly Cloud across the fleet",
+	Long: `Read cloud.enable from each device and disable Shelly Cloud where it is
+on. Devices tagged cloud:required are reported but left alone. Selects all
+devices unless IDs or --tag are given; use --dry-run to preview.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		req := service.CloudDisableRequest{}
+		for _, arg := range args {
+			id, err := strconv.ParseUint(arg, 10, 32)
+			if err != nil {
+				log.Fatal("Invalid device ID: ", arg)
+			}
+			req.DeviceIDs = append(req.DeviceIDs, uint(id))
+		}
+		req.Tag, _ = cmd.Flags().GetString("tag")
+		req.DryRun, _ = cmd.Flags().GetBool("dry-run")
+		req.Force, _ = cmd.Flags().GetBool("force")
+
+		results, err := shellyService.DisableCloud(context.Background(), req)
+		if err != nil {
+			log.Fatal("Cloud disable failed: ", err)
+		}
+
+		fmt.Printf("%-5s %-25s %-8s %s\n", "ID", "Name", "Cloud", "Result")
+		fmt.Println(strings.Repeat("-", 80))
+		for _, res := range results {
+			cloud := "?"
+			if res.CloudEnabled != nil {
+				cloud = "off"
+				if *res.CloudEnabled {
+					cloud = "on"
+				}
+			}
+			status := "ok"
+			switch {
+			case res.Error != "":
+				status = "✗ " + res.Error
+			case res.Skipped != "":
+				status = "skipped: " + res.Skipped
+			case res.Changed && req.DryRun:
+				status = "would disable"
+			case res.Changed:
+				status = "✓ disabled"
+			}
+			fmt.Printf("%-5d %-25s %-8s %s\n", res.DeviceID, res.Name, cloud, status)
+		}
+	},
+}
+
+var preflightCmd = &cobra.Command{
+	Use:   "preflight [device-id...]",
+	Short: "Check device reachability of gateway, MQTT broker and SNTP server",
+	Long: `Read status and settings from each device and report whether it reaches
+its gateway, MQTT broker and SNTP server. Targets that most devices fail to
+reach point at broken infrastructure. Selects all devices unless IDs or --tag
+are given.`,
+	Annotations: map[string]string{remoteAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		req := service.PreflightRequest{}
+		for _, arg := range args {
+			id, err := strconv.ParseUint(arg, 10, 32)
+			if err != nil {
+				log.Fatal("Invalid device ID: ", arg)
+			}
+			req.DeviceIDs = append(req.DeviceIDs, uint(id))
+		}
+		req.Tag, _ = cmd.Flags().GetString("tag")
+
+		var report *service.PreflightReport
+		var err error
+		if apiClient != nil {
+			var remote *client.PreflightReport
+			remote, err = apiClient.Preflight(context.Background(), client.PreflightRequest{DeviceIDs: req.DeviceIDs, Tag: req.Tag})
+			if err == nil {
+				report = preflightFromClient(remote)
+			}
+		} else {
+			report, err = shellyService.Preflight(context.Background(), req)
+		}
+		if err != nil {
+			log.Fatal("Pre-flight check failed: ", err)
+		}
+
+		fmt.Printf("%-5s %-25s %-10s %-10s %-10s\n", "ID", "Name", "Gateway", "MQTT", "SNTP")
+		fmt.Println(strings.Repeat("-", 80))
+		for _, row := range report.Devices {
+			if row.Error != "" {
+				fmt.Printf("%-5d %-25s ✗ %s\n", row.DeviceID, row.Name, row.Error)
+				continue
+			}
+			fmt.Printf("%-5d %-25s %-10s %-10s %-10s\n", row.DeviceID, row.Name,
+				row.Checks[service.PreflightGateway].Result,
+				row.Checks[service.PreflightMQTT].Result,
+				row.Checks[service.PreflightSNTP].Result)
+		}
+
+		fmt.Printf("\n%-8s %-30s %6s %6s\n", "Check", "Target", "OK", "Failed")
+		fmt.Println(strings.Repeat("-", 80))
+		for _, t := range report.Targets {
+			fmt.Printf("%-8s %-30s %6d %6d\n", t.Check, t.Target, t.OK, t.Failed)
+		}
+		if report.Unreachable > 0 {
+			fmt.Printf("\n%d device(s) could not be read\n", report.Unreachable)
+		}
+	},
+}
+
+// preflightFromClient converts a report fetched over the API so remote and
+// local runs print the same way
+func preflightFromClient(r *client.PreflightReport) *service.PreflightReport {
+	report := &service.PreflightReport{
+		GeneratedAt: r.GeneratedAt,
+		Summary:     r.Summary,
+		Unreachable: r.Unreachable,
+	}
+	for _, d := range r.Devices {
+		row := service.PreflightDevice{DeviceID: d.DeviceID, Name: d.Name, IP: d.IP, Error: d.Error}
+		if d.Checks != nil {
+			row.Checks = make(map[string]service.PreflightCheck, len(d.Checks))
+			for name, c := range d.Checks {
+				row.Checks[name] = service.PreflightCheck(c)
+			}
+		}
+		report.Devices = append(report.Devices, row)
+	}
+	for _, t := range r.Targets {
+		report.Targets = append(report.Targets, service.PreflightTarget(t))
+	}
+	return report
+}
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Interactive terminal dashboard",
+	Long: `Show a live device table with switch state, power and configuration drift,
+refreshed periodically, with keys to switch the selected device and a tail of
+the log. Use --server to watch a running server over its API.
+
+Keys: up/down or j/k select, t or space toggle, o on, f off, r refresh,
+l show or hide the log, q quit.`,
+	Annotations: map[string]string{remoteAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		refresh, _ := cmd.Flags().GetDuration("refresh")
+
+		logs := tui.NewLogBuffer(500)
+		var source tui.Source
+		title := "(local)"
+		if apiClient != nil {
+			source = tui.NewClientSource(apiClient)
+			title = serverURL
+		} else {
+			source = tui.NewServiceSource(shellyService)
+			// Console logging would draw over the dashboard
+			restore := logging.RedirectConsole(logs)
+			defer restore()
+		}
+
+		return tui.Run(cmd.Context(), source, os.Stdin, os.Stdout, tui.Options{
+			Title:   title,
+			Refresh: refresh,
+			Logs:    logs,
+		})
+	},
+}
+
+var intakeCmd = &cobra.Command{
+	Use:   "intake",
+	Short: "Pre-register devices from box labels or QR codes",
+	Long: `Pre-register devices from the QR code or label on their box. Registered
+devices are recognised by MAC when they appear in an AP scan or discovery:
+provisioning uses their AP password and new inventory entries get their name.`,
+}
+
+var intakeAddCmd = &cobra.Command{
+	Use:   "add <qr-content>",
+	Short: "Register a device from QR code or label content",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		label, err := intake.ParseLabel(args[0])
+		if err != nil {
+			log.Fatal("Invalid label: ", err)
+		}
+		if name, _ := cmd.Flags().GetString("name"); name != "" {
+			label.Name = name
+		}
+		if apPassword, _ := cmd.Flags().GetString("ap-password"); apPassword != "" {
+			label.APPassword = apPassword
+		}
+
+		entry, err := shellyService.Intake.Register(context.Background(), *label, intake.SourceQR)
+		if err != nil {
+			log.Fatal("Failed to register device: ", err)
+		}
+		fmt.Printf("Registered %s (%s) as %q\n", entry.MAC, entry.Model, entry.Name)
+	},
+}
+
+var intakeImportCmd = &cobra.Command{
+	Use:   "import <file.csv>",
+	Short: "Register devices from a CSV of QR codes or label fields",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := os.Open(args[0])
+		if err != nil {
+			log.Fatal("Failed to open CSV: ", err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+
+		result, err := shellyService.Intake.ImportCSV(context.Background(), f)
+		if err != nil {
+			log.Fatal("Import failed: ", err)
+		}
+		for _, msg := range result.Errors {
+			fmt.Printf("✗ %s\n", msg)
+		}
+		fmt.Printf("Registered %d devices\n", len(result.Registered))
+	},
+}
+
+var intakeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List pre-registered devices",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, _ := cmd.Flags().GetString("status")
+		entries, err := shellyService.Intake.List(context.Background(), status)
+		if err != nil {
+			log.Fatal("Error fetching intake entries:", err)
+		}
+
+		fmt.Printf("%-5s %-14s %-20s %-20s %-8s %-10s\n",
+			"ID", "MAC", "Model", "Name", "AP Pass", "Status")
+		fmt.Println(strings.Repeat("-", 80))
+		for _, e := range entries {
+			hasPassword := "no"
+			if e.APPassword != "" {
+				hasPassword = "yes"
+			}
+			fmt.Printf("%-5d %-14s %-20s %-20s %-8s %-10s\n",
+				e.ID, e.MAC, e.Model, e.Name, hasPassword, e.Status)
+		}
+	},
+}
+
+var intakeRemoveCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Remove a pre-registered device",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			log.Fatal("Invalid intake ID: ", args[0])
+		}
+		if err := shellyService.Intake.Delete(context.Background(), uint(id)); err != nil {
+			log.Fatal("Failed to remove intake entry: ", err)
+		}
+		fmt.Printf("Removed intake entry %d\n", id)
+	},
+}
+
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start the HTTP API server",
@@ -322,6 +758,30 @@ var serverCmd = &cobra.Command{
 
 // startServer starts the HTTP API server
 func startServer() {
+	// Claim the scheduler lease before any periodic job starts, so their
+	// first runs already know whether this instance leads
+	if elector != nil {
+		leader := elector.Start(context.Background())
+		logger.WithFields(map[string]any{
+			"holder":    elector.Holder(),
+			"leader":    leader,
+			"lease_ttl": cfg.Cluster.LeaseTTLDuration().String(),
+			"component": "cluster",
+		}).Info("Cluster mode enabled")
+	}
+
+	// Collect metrics in the background (metrics.collection_interval)
+	if metricsCollector != nil {
+		go func() {
+			if err := metricsCollector.Start(context.Background()); err != nil {
+				logger.WithFields(map[string]any{
+					"error":     err.Error(),
+					"component": "metrics",
+				}).Error("Failed to start metrics collector")
+			}
+		}()
+	}
+
 	// Create API handler with service and logger
 	apiHandler := api.NewHandlerWithLogger(dbManager, shellyService, notificationHandler, metricsHandler, logger)
 
@@ -330,20 +790,225 @@ func startServer() {
 		apiHandler.SetAdminAPIKey(cfg.Security.AdminAPIKey)
 	}
 
+	// Sign users in through single sign-on when a backend is configured
+	if cfg != nil && cfg.Auth.Enabled() {
+		authn, err := auth.New(cfg.Auth, dbManager.GetDB(), logger)
+		if err != nil {
+			log.Fatal("Failed to initialize authentication: ", err)
+		}
+		apiHandler.SetAuthenticator(authn)
+	}
+
 	// Wire integration (7.2.d): emit notifications from configuration drift detection
 	if notificationHandler != nil && apiHandler.ConfigService != nil {
-		apiHandler.ConfigService.SetDriftNotifier(func(ctx context.Context, deviceID uint, deviceName string, differenceCount int) {
-			msg := fmt.Sprintf("%d configuration differences detected", differenceCount)
+		apiHandler.ConfigService.SetDriftNotifier(func(ctx context.Context, drift *configuration.ConfigDrift) {
+			// The drift score decides how loudly drift is alerted
+			level := notification.AlertLevelWarning
+			switch drift.Severity {
+			case configuration.DriftSeverityCritical:
+				level = notification.AlertLevelCritical
+			case configuration.DriftSeverityLow:
+				level = notification.AlertLevelInfo
+			}
+			msg := fmt.Sprintf("%d configuration differences detected (%s severity)", len(drift.Differences), drift.Severity)
+			deviceID := drift.DeviceID
 			_ = notificationHandler.NotifyEvent(ctx, &notification.NotificationEvent{
 				Type:       "drift_detected",
-				AlertLevel: notification.AlertLevelWarning,
+				AlertLevel: level,
 				DeviceID:   &deviceID,
-				DeviceName: deviceName,
+				DeviceName: drift.DeviceName,
 				Title:      "Configuration drift detected",
 				Message:    msg,
 				Timestamp:  time.Now(),
 				Categories: []string{"configuration", "drift"},
-				Metadata:   map[string]interface{}{"difference_count": differenceCount},
+				Metadata: map[string]interface{}{
+					"difference_count": len(drift.Differences),
+					"score":            drift.Score,
+					"severity":         drift.Severity,
+				},
+			})
+		})
+		apiHandler.ConfigService.SetDriftClearedNotifier(func(ctx context.Context, deviceID uint) {
+			_ = notificationHandler.ResolveEvent("drift_detected", &deviceID)
+		})
+	}
+
+	// Notify when a device starts rebooting more often than allowed
+	if notificationHandler != nil {
+		shellyService.SetRebootNotifier(func(ctx context.Context, deviceID uint, deviceName string, reboots int) {
+			_ = notificationHandler.NotifyEvent(ctx, &notification.NotificationEvent{
+				Type:       "device_flapping",
+				AlertLevel: notification.AlertLevelWarning,
+				DeviceID:   &deviceID,
+				DeviceName: deviceName,
+				Title:      "Device rebooting repeatedly",
+				Message:    fmt.Sprintf("%d unexpected reboots in the last 24 hours", reboots),
+				Timestamp:  time.Now(),
+				Categories: []string{"device", "health"},
+				Metadata:   map[string]interface{}{"reboots_24h": reboots},
+			})
+		})
+	}
+
+	// Notify when a device goes offline, or once for an outage taking many
+	// devices offline at once
+	if notificationHandler != nil {
+		shellyService.SetDeviceOfflineNotifier(func(ctx context.Context, deviceID uint, deviceName string, since time.Time) {
+			_ = notificationHandler.NotifyEvent(ctx, &notification.NotificationEvent{
+				Type:       "device_offline",
+				AlertLevel: notification.AlertLevelWarning,
+				DeviceID:   &deviceID,
+				DeviceName: deviceName,
+				Title:      "Device offline",
+				Message:    fmt.Sprintf("No answer since %s", since.Format(time.RFC3339)),
+				Timestamp:  time.Now(),
+				Categories: []string{"device", "health"},
+			})
+		})
+		shellyService.SetOutageNotifier(func(ctx context.Context, event service.OutageEvent) {
+			metadata := map[string]interface{}{
+				"devices":    event.Devices,
+				"recovered":  event.Recovered,
+				"fleet":      event.Fleet,
+				"started_at": event.StartedAt,
+			}
+			if event.Kind == service.OutageEnded {
+				_ = notificationHandler.ResolveEvent("outage_detected", nil)
+				_ = notificationHandler.NotifyEvent(ctx, &notification.NotificationEvent{
+					Type:       "outage_recovered",
+					AlertLevel: notification.AlertLevelInfo,
+					Title:      "Outage over",
+					Message:    fmt.Sprintf("%d of %d devices lost since %s answer again", event.Recovered, event.Devices, event.StartedAt.Format(time.RFC3339)),
+					Timestamp:  time.Now(),
+					Categories: []string{"device", "health"},
+					Metadata:   metadata,
+				})
+				return
+			}
+			_ = notificationHandler.NotifyEvent(ctx, &notification.NotificationEvent{
+				Type:       "outage_detected",
+				AlertLevel: notification.AlertLevelCritical,
+				Title:      "Outage detected",
+				Message:    fmt.Sprintf("%d of %d devices went offline at once; individual offline alerts are suppressed", event.Devices, event.Fleet),
+				Timestamp:  event.StartedAt,
+				Categories: []string{"device", "health"},
+				Metadata:   metadata,
+			})
+		})
+	}
+
+	// Notify about protection trips, and resolve the alert once a device
+	// reports none
+	if notificationHandler != nil {
+		shellyService.SetProtectionNotifier(func(ctx context.Context, trip database.ProtectionTrip, deviceName string) {
+			deviceID := trip.DeviceID
+			if trip.ClearedAt != nil {
+				_ = notificationHandler.ResolveEvent("protection_trip", &deviceID)
+				return
+			}
+			where := "the device"
+			if trip.Channel >= 0 {
+				where = fmt.Sprintf("channel %d", trip.Channel)
+			}
+			_ = notificationHandler.NotifyEvent(ctx, &notification.NotificationEvent{
+				Type:       "protection_trip",
+				AlertLevel: notification.AlertLevelCritical,
+				DeviceID:   &deviceID,
+				DeviceName: deviceName,
+				Title:      "Device protection tripped",
+				Message:    fmt.Sprintf("%s protection tripped on %s at %.1f W, %.1f °C", trip.Kind, where, trip.Power, trip.Temperature),
+				Timestamp:  trip.TrippedAt,
+				Categories: []string{"device", "health"},
+				Metadata: map[string]interface{}{
+					"kind":        trip.Kind,
+					"channel":     trip.Channel,
+					"power":       trip.Power,
+					"voltage":     trip.Voltage,
+					"current":     trip.Current,
+					"temperature": trip.Temperature,
+				},
+			})
+		})
+	}
+
+	// Notify when a power budget group stays over its limit, with the loads
+	// shed, and resolve the alert once every group is within its limit
+	if notificationHandler != nil {
+		shellyService.SetPowerBudgetNotifier(func(ctx context.Context, event service.PowerBudgetEvent) {
+			if event.Resolved {
+				if event.Exceeded == 0 {
+					_ = notificationHandler.ResolveEvent("power_budget_exceeded", nil)
+				}
+				return
+			}
+			message := fmt.Sprintf("%s draws %.0f W, over its %.0f W budget", event.Name, event.Watts, event.LimitWatts)
+			if len(event.Shed) > 0 {
+				message += fmt.Sprintf("; %d load(s) switched off", len(event.Shed))
+			}
+			_ = notificationHandler.NotifyEvent(ctx, &notification.NotificationEvent{
+				Type:       "power_budget_exceeded",
+				AlertLevel: notification.AlertLevelCritical,
+				Title:      "Power budget exceeded",
+				Message:    message,
+				Timestamp:  event.At,
+				Categories: []string{"power"},
+				Metadata: map[string]interface{}{
+					"group_id":    event.GroupID,
+					"group":       event.Name,
+					"watts":       event.Watts,
+					"limit_watts": event.LimitWatts,
+					"shed":        event.Shed,
+				},
+			})
+		})
+	}
+
+	// Notify about devices on the network that are not in the inventory
+	if notificationHandler != nil {
+		shellyService.SetNewDeviceNotifier(func(ctx context.Context, alert database.NewDeviceAlert) {
+			_ = notificationHandler.NotifyEvent(ctx, &notification.NotificationEvent{
+				Type:       "new_device_detected",
+				AlertLevel: notification.AlertLevelWarning,
+				Title:      "Unknown Shelly device detected",
+				Message:    fmt.Sprintf("%s %s (%s) found by %s is not in the inventory", alert.Model, alert.MAC, alert.IP, alert.Source),
+				Timestamp:  alert.FirstSeen,
+				Categories: []string{"device", "security"},
+				Metadata: map[string]interface{}{
+					"alert_id":   alert.ID,
+					"mac":        alert.MAC,
+					"ip":         alert.IP,
+					"model":      alert.Model,
+					"generation": alert.Generation,
+					"source":     alert.Source,
+					"adopt_url":  fmt.Sprintf("/api/v1/discovery/alerts/%d/adopt", alert.ID),
+					"ignore_url": fmt.Sprintf("/api/v1/discovery/alerts/%d/ignore", alert.ID),
+				},
+			})
+		})
+	}
+
+	// Notify once per device as its warranty approaches expiry
+	if notificationHandler != nil {
+		shellyService.SetWarrantyNotifier(func(ctx context.Context, device database.Device, expires time.Time) {
+			deviceID := device.ID
+			message := fmt.Sprintf("Warranty expires on %s", expires.Format("2006-01-02"))
+			if !expires.After(time.Now()) {
+				message = fmt.Sprintf("Warranty expired on %s", expires.Format("2006-01-02"))
+			}
+			_ = notificationHandler.NotifyEvent(ctx, &notification.NotificationEvent{
+				Type:       "warranty_expiring",
+				AlertLevel: notification.AlertLevelInfo,
+				DeviceID:   &deviceID,
+				DeviceName: device.Name,
+				Title:      "Device warranty expiring",
+				Message:    message,
+				Timestamp:  time.Now(),
+				Categories: []string{"device", "asset"},
+				Metadata: map[string]interface{}{
+					"serial":           device.Asset.Serial,
+					"vendor":           device.Asset.Vendor,
+					"warranty_expires": expires.Format("2006-01-02"),
+				},
 			})
 		})
 	}
@@ -360,10 +1025,66 @@ func startServer() {
 	}
 	apiHandler.ExportHandlers = syncHandlers
 	apiHandler.ImportHandlers = api.NewImportHandlers(syncEngine, logger)
+
+	// Run plugin exports on their cron schedules; in a cluster only the
+	// leader runs them
+	syncScheduler := sync.NewScheduler(syncEngine, logger)
+	if elector != nil {
+		syncScheduler.SetLeaderFunc(elector.IsLeader)
+	}
+	if notificationHandler != nil {
+		syncScheduler.SetFailureNotifier(func(ctx context.Context, schedule database.SyncSchedule, message string) {
+			_ = notificationHandler.NotifyEvent(ctx, &notification.NotificationEvent{
+				Type:       "sync_failed",
+				AlertLevel: notification.AlertLevelWarning,
+				Title:      fmt.Sprintf("Scheduled sync failed: %s", schedule.Name),
+				Message:    message,
+				Timestamp:  time.Now(),
+				Categories: []string{"sync"},
+				Metadata: map[string]interface{}{
+					"schedule_id": schedule.ID,
+					"plugin":      schedule.PluginName,
+				},
+			})
+		})
+	}
+	if err := syncScheduler.Start(context.Background()); err != nil {
+		logger.WithFields(map[string]any{
+			"error":     err.Error(),
+			"component": "sync_scheduler",
+		}).Warn("Failed to start sync scheduler")
+	} else {
+		syncHandlers.SetScheduler(syncScheduler)
+	}
 	if cfg != nil && cfg.Security.AdminAPIKey != "" {
 		apiHandler.ImportHandlers.SetAdminAPIKey(cfg.Security.AdminAPIKey)
 	}
 
+	// Subsystems /readyz checks besides the database and its migrations
+	apiHandler.AddReadinessCheck("sync_plugins", func(ctx context.Context) error {
+		var missing []string
+		for _, name := range syncPluginNames {
+			if _, err := syncEngine.GetPlugin(name); err != nil {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("plugins not registered: %s", strings.Join(missing, ", "))
+		}
+		return nil
+	})
+	if metricsCollector != nil {
+		apiHandler.AddReadinessCheck("metrics_collector", func(ctx context.Context) error {
+			if !metricsCollector.IsRunning() {
+				return fmt.Errorf("metrics collector is not running")
+			}
+			return nil
+		})
+	}
+	apiHandler.AddReadinessCheck("sync_scheduler", func(ctx context.Context) error {
+		return syncScheduler.Ready()
+	})
+
 	// Build security config from application config
 	secCfg := middleware.DefaultSecurityConfig()
 	if cfg != nil {
@@ -379,6 +1100,17 @@ func startServer() {
 		if cfg.Security.CORS.MaxAge > 0 {
 			secCfg.CORSMaxAge = cfg.Security.CORS.MaxAge
 		}
+		secCfg.IdempotencyTTL = time.Duration(cfg.Security.IdempotencyTTL) * time.Second
+		limits := cfg.Security.RequestLimits
+		for class, maxBytes := range map[string]int64{
+			middleware.RouteClassDefault: limits.DefaultMaxBytes,
+			middleware.RouteClassConfig:  limits.ConfigMaxBytes,
+			middleware.RouteClassImport:  limits.ImportMaxBytes,
+		} {
+			if maxBytes > 0 {
+				secCfg.SetClassLimit(class, maxBytes)
+			}
+		}
 	}
 	// Setup validation config based on main configuration
 	valCfg := middleware.DefaultValidationConfig()
@@ -460,6 +1192,14 @@ func startServer() {
 		}
 		wsHub := metricsHandler.GetWebSocketHub()
 		if wsHub != nil {
+			if cfg != nil {
+				wsHub.SetOptions(metrics.WebSocketOptions{
+					QueueSize:    cfg.Metrics.WebSocketQueueSize,
+					DropPolicy:   cfg.Metrics.WebSocketDropPolicy,
+					MaxDrops:     cfg.Metrics.WebSocketMaxDrops,
+					ResumeWindow: time.Duration(cfg.Metrics.WebSocketResumeWindow) * time.Second,
+				})
+			}
 			logger.WithFields(map[string]any{
 				"component": "websocket",
 			}).Info("Starting WebSocket hub for real-time metrics")
@@ -472,6 +1212,63 @@ func startServer() {
 		}
 	}
 
+	// Start the device supervisor (no-op unless supervisor.enabled)
+	if err := shellyService.StartSupervisor(); err != nil {
+		log.Fatal("Invalid supervisor configuration: ", err)
+	}
+
+	// Send held offline alerts and end outages (outage.enabled)
+	shellyService.StartOutageMonitor()
+
+	// Check for rows referring to deleted devices (integrity.enabled)
+	shellyService.StartIntegrityChecks()
+
+	// Roll old hourly energy and latency rows up into daily ones
+	shellyService.StartMetricsRollups()
+
+	// Follow devices DHCP moved to other addresses (identity.enabled)
+	shellyService.StartIdentityChecks()
+
+	// Keep Shelly Cloud names and rooms in line (shelly_cloud.sync_enabled)
+	shellyService.StartCloudSync()
+
+	// Notify about warranties approaching expiry (assets.warranty_checks)
+	shellyService.StartWarrantyChecks()
+
+	// Enforce the limits of power budget groups (power_budgets.enabled)
+	shellyService.StartPowerBudgetChecks()
+
+	// Rescan discovery networks that set an interval (discovery.networks)
+	shellyService.StartDiscoverySchedule()
+
+	// Collect Gen2 device debug logs streamed over UDP (device_logs.enabled)
+	if err := shellyService.StartDeviceLogCollector(); err != nil {
+		logger.WithFields(map[string]any{
+			"error":     err.Error(),
+			"component": "device_logs",
+		}).Error("Device log collector not started")
+	}
+
+	// Apply the export artifact lifecycle (export.lifecycle.enabled); in a
+	// cluster only the leader moves artifacts
+	if cfg.Export.Lifecycle.Enabled {
+		go func() {
+			ticker := time.NewTicker(cfg.Export.Lifecycle.IntervalDuration())
+			defer ticker.Stop()
+			for range ticker.C {
+				if elector != nil && !elector.IsLeader() {
+					continue
+				}
+				if _, err := syncEngine.RunArtifactLifecycle(context.Background()); err != nil {
+					logger.WithFields(map[string]any{
+						"error":     err.Error(),
+						"component": "artifact_lifecycle",
+					}).Warn("Artifact lifecycle run failed")
+				}
+			}
+		}()
+	}
+
 	// Start background cleanup process for discovered devices
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour) // Cleanup every hour
@@ -482,6 +1279,9 @@ func startServer() {
 		}).Info("Starting discovered devices cleanup scheduler")
 
 		for range ticker.C {
+			if elector != nil && !elector.IsLeader() {
+				continue
+			}
 			if deleted, err := dbManager.CleanupExpiredDiscoveredDevices(); err != nil {
 				logger.WithFields(map[string]any{
 					"error":     err.Error(),
@@ -530,6 +1330,21 @@ func countSuccessfulSteps(steps []provisioning.ProvisioningStep) int {
 func initApp() {
 	var err error
 
+	// Completion scripts and man pages describe the CLI; they need neither
+	// configuration nor database, and must print nothing else
+	if cli.ToolingArgs(rootCmd, os.Args[1:]) {
+		return
+	}
+
+	// Remote mode needs neither configuration nor database
+	if serverURL != "" {
+		if apiKey == "" {
+			apiKey, _ = secrets.GetEnvOrFile("SHELLY_SECURITY_ADMIN_API_KEY")
+		}
+		apiClient = client.New(serverURL, client.WithAPIKey(apiKey))
+		return
+	}
+
 	// Load configuration
 	cfg, err = config.Load(configFile)
 	if err != nil {
@@ -538,6 +1353,9 @@ func initApp() {
 
 	// Apply secret overrides (env and *_FILE)
 	secrets.ApplyToConfig(cfg)
+	if err := secrets.ConfigureColumnCipher(cfg); err != nil {
+		log.Fatal("Failed to configure database encryption:", err)
+	}
 
 	// Initialize logger from config
 	logger, err = logging.New(logging.Config{
@@ -569,6 +1387,13 @@ func initApp() {
 	// Initialize service with logger
 	shellyService = service.NewServiceWithLogger(dbManager, cfg, logger)
 
+	// Instances sharing a database run periodic jobs only while holding the
+	// scheduler lease; the server claims it in startServer
+	if cfg.Cluster.Enabled {
+		elector = cluster.NewElector(dbManager, cfg.Cluster.InstanceName(), cfg.Cluster.LeaseTTLDuration(), logger)
+		shellyService.SetLeaderFunc(elector.IsLeader)
+	}
+
 	// Initialize notification service
 	emailConfig := notification.EmailSMTPConfig{
 		Host:     cfg.Notifications.Email.SMTPHost,
@@ -581,26 +1406,59 @@ func initApp() {
 	notificationService := notification.NewService(dbManager.GetDB(), logger, emailConfig)
 	notificationHandler = notification.NewHandler(notificationService, logger)
 
+	// Hold back the alerts of devices under planned maintenance
+	notificationService.SetMaintenanceFunc(shellyService.InMaintenance)
+
+	// Send due summaries for channels in digest mode
+	if elector != nil {
+		notificationService.SetLeaderFunc(elector.IsLeader)
+	}
+	go notificationService.RunDigests(shellyService.Context(), time.Minute)
+
+	// Verify channels periodically and report failing ones through the others
+	if cfg.Notifications.HealthCheckInterval > 0 {
+		go notificationService.RunHealthChecks(shellyService.Context(), time.Duration(cfg.Notifications.HealthCheckInterval)*time.Second)
+	}
+
 	// Initialize metrics service if enabled
 	if cfg.Metrics.Enabled {
 		metricsService = metrics.NewService(dbManager.GetDB(), logger, nil)
 		metricsHandler = metrics.NewHandler(metricsService, logger)
 
-		// Start metrics collector if enabled
+		// Compare device clocks with server time on every collection; the
+		// clock check reads device uptime and times its requests too, so
+		// reboot and latency tracking only poll on their own when it is off
+		if cfg.Metrics.ClockSkewCheck {
+			metricsService.SetDeviceCollector(func(ctx context.Context) error {
+				report, err := shellyService.CheckClockSkew(shelly.WithTrafficClass(ctx, shelly.TrafficMetrics))
+				if err != nil {
+					return err
+				}
+				for _, e := range report.Devices {
+					if e.Synced {
+						metricsService.RecordClockSkew(strconv.FormatUint(uint64(e.DeviceID), 10), e.Name, e.SkewSeconds)
+					}
+				}
+				return nil
+			})
+		} else if cfg.Metrics.RebootCheck || cfg.Metrics.LatencyCheck {
+			metricsService.SetDeviceCollector(func(ctx context.Context) error {
+				return shellyService.CheckReboots(shelly.WithTrafficClass(ctx, shelly.TrafficMetrics))
+			})
+		}
+		shellyService.SetLatencyRecorder(func(deviceID uint, deviceName string, latency time.Duration, ok bool) {
+			metricsService.RecordDeviceLatency(strconv.FormatUint(uint64(deviceID), 10), deviceName, latency, ok)
+		})
+		shellyService.SetRateLimitRecorder(metricsService.RecordNetworkRequest)
+
+		// Create the metrics collector if enabled; the server starts it once
+		// it has claimed the scheduler lease
 		if cfg.Metrics.CollectionInterval > 0 {
 			collectionInterval := time.Duration(cfg.Metrics.CollectionInterval) * time.Second
 			metricsCollector = metrics.NewCollector(metricsService, logger, collectionInterval)
-
-			// Start collector in background
-			go func() {
-				ctx := context.Background()
-				if err := metricsCollector.Start(ctx); err != nil {
-					logger.WithFields(map[string]any{
-						"error":     err.Error(),
-						"component": "metrics",
-					}).Error("Failed to start metrics collector")
-				}
-			}()
+			if elector != nil {
+				metricsCollector.SetLeaderFunc(elector.IsLeader)
+			}
 		}
 
 		// Wire integration (7.2.d): emit notifications from metrics test alerts
@@ -683,6 +1541,46 @@ func initApp() {
 		}).Info("Export base directory configured for path validation")
 	}
 
+	// Sign backup and GitOps artifacts and verify them before import
+	if cfg.Export.Signing.Enabled() {
+		signer, err := sync.NewArtifactSigner(sync.SigningKeys{
+			Algorithm: cfg.Export.Signing.Algorithm,
+			Key:       cfg.Export.Signing.Key,
+			PublicKey: cfg.Export.Signing.PublicKey,
+		})
+		if err != nil {
+			log.Fatal("Failed to configure export signing:", err)
+		}
+		syncEngine.SetArtifactSigner(signer, cfg.Export.Signing.RequireSignature)
+		logger.WithFields(map[string]any{
+			"algorithm":         cfg.Export.Signing.Algorithm,
+			"key_id":            signer.KeyID(),
+			"require_signature": cfg.Export.Signing.RequireSignature,
+			"component":         "sync_engine",
+		}).Info("Export artifact signing configured")
+	}
+
+	// Move older export artifacts to object storage and delete them past
+	// retention (export.lifecycle)
+	if lc := cfg.Export.Lifecycle; lc.Enabled {
+		lifecycle := sync.ArtifactLifecycle{LocalFor: lc.LocalDuration(), RetainFor: lc.RetentionDuration()}
+		if bucket := lc.ObjectStorage; bucket.Enabled() {
+			store, err := sync.NewS3Store(bucket.Endpoint, bucket.Region, bucket.Bucket, bucket.AccessKey, bucket.SecretKey)
+			if err != nil {
+				log.Fatal("Invalid export lifecycle object storage:", err)
+			}
+			lifecycle.Store = store
+			lifecycle.Prefix = bucket.Prefix
+		}
+		syncEngine.SetArtifactLifecycle(lifecycle)
+		logger.WithFields(map[string]any{
+			"local_days":     lc.LocalDays,
+			"retention_days": lc.RetentionDays,
+			"object_storage": lc.ObjectStorage.Enabled(),
+			"component":      "artifact_lifecycle",
+		}).Info("Export artifact lifecycle configured")
+	}
+
 	// Register sync plugins directly with the sync engine using the old interface
 	syncPlugins := []sync.SyncPlugin{
 		backup.NewPlugin(),
@@ -691,9 +1589,12 @@ func initApp() {
 		sma.NewPlugin(),
 		jsonexport.NewPlugin(),
 		yamlexport.NewPlugin(),
+		promsd.NewPlugin(),
+		docsexport.NewPlugin(),
 	}
 
 	for _, plugin := range syncPlugins {
+		syncPluginNames = append(syncPluginNames, plugin.Info().Name)
 		if err := syncEngine.RegisterPlugin(plugin); err != nil {
 			logger.WithFields(map[string]any{
 				"plugin":    plugin.Info().Name,
@@ -721,6 +1622,23 @@ func initApp() {
 		logger.WithFields(map[string]any{"component": "sync_engine", "plugin": "backup", "error": err.Error()}).Warn("Backup plugin not found for DB manager injection")
 	}
 
+	// Let the documentation export capture live device state
+	if p, err := syncEngine.GetPlugin("inventory-docs"); err == nil {
+		if dp, ok := p.(*docsexport.Plugin); ok {
+			dp.SetSnapshotSource(docsexport.SnapshotSourceFunc(func(ctx context.Context, deviceID uint) (*docsexport.Snapshot, error) {
+				snapshot, err := shellyService.CaptureDeviceSnapshot(ctx, deviceID)
+				if err != nil {
+					return nil, err
+				}
+				status, err := json.Marshal(snapshot.Status)
+				if err != nil {
+					return nil, fmt.Errorf("failed to encode status: %w", err)
+				}
+				return &docsexport.Snapshot{CapturedAt: snapshot.CapturedAt, Status: status, Image: snapshot.Image, ImageType: snapshot.ImageType}, nil
+			}))
+		}
+	}
+
 	// Register backup plugin with database manager for enhanced functionality
 	if err := pluginRegistry.RegisterPluginWithDatabaseManager(dbManager); err != nil {
 		logger.WithFields(map[string]any{
@@ -731,14 +1649,14 @@ func initApp() {
 
 	logger.WithFields(map[string]any{
 		"db_path":   cfg.Database.Path,
-		"networks":  cfg.Discovery.Networks,
+		"networks":  config.DiscoveryCIDRs(cfg.Discovery.Networks),
 		"component": "app",
 	}).Info("Shelly Manager initialized")
 
 	fmt.Printf("Shelly Manager initialized\n")
 	fmt.Printf("Database: %s\n", cfg.Database.Path)
 	if len(cfg.Discovery.Networks) > 0 {
-		fmt.Printf("Discovery networks: %v\n", cfg.Discovery.Networks)
+		fmt.Printf("Discovery networks: %v\n", config.DiscoveryCIDRs(cfg.Discovery.Networks))
 	}
 }
 
@@ -746,6 +1664,10 @@ func init() {
 	// Add persistent flags
 	rootCmd.PersistentFlags().StringVar(&configFile, "config", "",
 		"config file (default is ./configs/shelly-manager.yaml)")
+	rootCmd.PersistentFlags().StringVar(&serverURL, "server", "",
+		"call the API of a running server, e.g. http://localhost:8080, instead of the local database")
+	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", "",
+		"admin API key for --server (default $SHELLY_SECURITY_ADMIN_API_KEY)")
 
 	// Add provisioning command flags
 	provisionCmd.Flags().String("name", "", "Device name (auto-generated if not specified)")
@@ -756,6 +1678,40 @@ func init() {
 	provisionCmd.Flags().Bool("enable-mqtt", false, "Enable MQTT")
 	provisionCmd.Flags().String("mqtt-server", "", "MQTT server address")
 	provisionCmd.Flags().Int("timeout", 300, "Provisioning timeout in seconds")
+	provisionCmd.Flags().String("ap-password", "", "Password of the device AP (printed on newer devices)")
+	provisionCmd.Flags().String("ap-qr", "", "WiFi QR code content from the device label (provisions only that device)")
+
+	// Add rename command flags
+	renameCmd.Flags().String("template", "", "Naming template (defaults to naming.template)")
+	renameCmd.Flags().Bool("dry-run", false, "Show the new names without applying them")
+	renameCmd.Flags().Bool("push", false, "Also set the new names on the devices")
+
+	// Add sync-names command flags
+	syncNamesCmd.Flags().String("tag", "", "Only devices with this tag")
+	syncNamesCmd.Flags().Bool("dry-run", false, "Report differences without changing devices")
+	syncNamesCmd.Flags().Bool("force", false, "Also try devices marked offline")
+
+	// Add cloud-disable command flags
+	cloudDisableCmd.Flags().String("tag", "", "Only devices with this tag")
+	cloudDisableCmd.Flags().Bool("dry-run", false, "Report cloud state without changing devices")
+	cloudDisableCmd.Flags().Bool("force", false, "Also try devices marked offline")
+
+	// Add preflight command flags
+	preflightCmd.Flags().String("tag", "", "Only devices with this tag")
+
+	// Add tui command flags
+	tuiCmd.Flags().Duration("refresh", 5*time.Second, "Device table refresh interval")
+
+	// Add intake command flags
+	intakeAddCmd.Flags().String("name", "", "Name given to the device when it is discovered")
+	intakeAddCmd.Flags().String("ap-password", "", "Device AP password (overrides the QR code)")
+	intakeListCmd.Flags().String("status", "", "Filter by status (pending, seen, matched)")
+	intakeCmd.AddCommand(intakeAddCmd, intakeImportCmd, intakeListCmd, intakeRemoveCmd)
+
+	// Complete device IDs from the server in remote mode
+	for _, cmd := range []*cobra.Command{renameCmd, syncNamesCmd, cloudDisableCmd, preflightCmd} {
+		cmd.ValidArgsFunction = completeDeviceIDs
+	}
 
 	// Add subcommands
 	rootCmd.AddCommand(listCmd)
@@ -763,7 +1719,51 @@ func init() {
 	rootCmd.AddCommand(addCmd)
 	rootCmd.AddCommand(scanAPCmd)
 	rootCmd.AddCommand(provisionCmd)
+	rootCmd.AddCommand(intakeCmd)
+	rootCmd.AddCommand(renameCmd)
+	rootCmd.AddCommand(syncNamesCmd)
+	rootCmd.AddCommand(cloudDisableCmd)
+	rootCmd.AddCommand(preflightCmd)
+	rootCmd.AddCommand(tuiCmd)
 	rootCmd.AddCommand(serverCmd)
+	rootCmd.AddCommand(cli.ManCommand(rootCmd))
+}
+
+// completeDeviceIDs completes device ID arguments, described by the device
+// name, from the server given with --server. Without it there is nothing to
+// ask: completion never opens the local database.
+func completeDeviceIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if serverURL == "" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	key := apiKey
+	if key == "" {
+		key, _ = secrets.GetEnvOrFile("SHELLY_SECURITY_ADMIN_API_KEY")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	list, err := client.New(serverURL, client.WithAPIKey(key)).ListDevices(ctx, nil)
+	if err != nil {
+		cobra.CompDebugln(fmt.Sprintf("device completion failed: %v", err), true)
+		return nil, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveError
+	}
+	given := make(map[string]bool, len(args))
+	for _, arg := range args {
+		given[arg] = true
+	}
+	completions := make([]string, 0, len(list.Devices))
+	for _, d := range list.Devices {
+		id := strconv.FormatUint(uint64(d.ID), 10)
+		if given[id] || !strings.HasPrefix(id, toComplete) {
+			continue
+		}
+		if d.Name == "" {
+			completions = append(completions, id)
+			continue
+		}
+		completions = append(completions, cobra.CompletionWithDesc(id, d.Name))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
 }
 
 func main() {
@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/ginsys/shelly-manager/api/client"
 	"github.com/ginsys/shelly-manager/internal/config"
 	"github.com/ginsys/shelly-manager/internal/database"
 	"github.com/ginsys/shelly-manager/internal/service"
@@ -29,16 +32,19 @@ func createTestEnvironment(t *testing.T) (*database.Manager, *service.ShellyServ
 
 	testCfg := &config.Config{
 		Discovery: struct {
-			Enabled         bool     `mapstructure:"enabled"`
-			Networks        []string `mapstructure:"networks"`
-			Interval        int      `mapstructure:"interval"`
-			Timeout         int      `mapstructure:"timeout"`
-			EnableMDNS      bool     `mapstructure:"enable_mdns"`
-			EnableSSDP      bool     `mapstructure:"enable_ssdp"`
-			ConcurrentScans int      `mapstructure:"concurrent_scans"`
+			Enabled         bool                       `mapstructure:"enabled"`
+			Networks        []config.DiscoveryNetwork  `mapstructure:"networks"`
+			Interval        int                        `mapstructure:"interval"`
+			Timeout         int                        `mapstructure:"timeout"`
+			EnableMDNS      bool                       `mapstructure:"enable_mdns"`
+			EnableSSDP      bool                       `mapstructure:"enable_ssdp"`
+			ConcurrentScans int                        `mapstructure:"concurrent_scans"`
+			Exclude         config.DiscoveryExclude    `mapstructure:"exclude"`
+			NewDeviceAlerts bool                       `mapstructure:"new_device_alerts"`
+			DHCPLeases      config.DiscoveryDHCPLeases `mapstructure:"dhcp_leases"`
 		}{
 			Enabled:  true,
-			Networks: []string{"192.168.1.0/24"},
+			Networks: []config.DiscoveryNetwork{{CIDR: "192.168.1.0/24"}},
 			Timeout:  5,
 		},
 	}
@@ -103,6 +109,43 @@ func TestListCommand_Direct(t *testing.T) {
 	}
 }
 
+func TestListCommand_Remote(t *testing.T) {
+	origClient, origDBManager := apiClient, dbManager
+	defer func() { apiClient, dbManager = origClient, origDBManager }()
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/api/v1/devices" {
+			t.Errorf("Unexpected request path %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"success":true,"data":{"devices":[{"id":1,"ip":"192.0.2.1","mac":"AA","name":"lamp"}]}}`))
+	}))
+	defer srv.Close()
+
+	// The database must not be touched in remote mode
+	dbManager = nil
+	apiClient = client.New(srv.URL)
+	listCmd.Run(listCmd, []string{})
+
+	if requests != 1 {
+		t.Errorf("Expected 1 API request, got %d", requests)
+	}
+}
+
+func TestRemoteModeRejectsLocalCommands(t *testing.T) {
+	origClient := apiClient
+	defer func() { apiClient = origClient }()
+	apiClient = client.New("http://127.0.0.1:1")
+
+	if err := rootCmd.PersistentPreRunE(discoverCmd, nil); err == nil {
+		t.Error("Expected discover to be rejected in remote mode")
+	}
+	if err := rootCmd.PersistentPreRunE(listCmd, nil); err != nil {
+		t.Errorf("Expected list to be allowed in remote mode, got %v", err)
+	}
+}
+
 func TestDiscoverCommand_Direct(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping discover command test in short mode due to network operations")
@@ -229,6 +272,9 @@ func TestServerCommand_Setup(t *testing.T) {
 			SlowQueryTime   int               `mapstructure:"slow_query_time"`
 			LogLevel        string            `mapstructure:"log_level"`
 			Options         map[string]string `mapstructure:"options"`
+
+			EncryptionKey          string   `mapstructure:"encryption_key"`
+			PreviousEncryptionKeys []string `mapstructure:"previous_encryption_keys"`
 		}{
 			Path: ":memory:",
 		},
@@ -108,7 +108,7 @@ metrics:
 			t.Errorf("Expected database path %s, got %s", dbPath, cfg.Database.Path)
 		}
 
-		if len(cfg.Discovery.Networks) != 1 || cfg.Discovery.Networks[0] != "192.168.1.0/24" {
+		if len(cfg.Discovery.Networks) != 1 || cfg.Discovery.Networks[0].CIDR != "192.168.1.0/24" {
 			t.Errorf("Expected discovery networks [192.168.1.0/24], got %v", cfg.Discovery.Networks)
 		}
 	})
@@ -178,6 +178,9 @@ func TestInitializationWithDefaults(t *testing.T) {
 			SlowQueryTime   int               `mapstructure:"slow_query_time"`
 			LogLevel        string            `mapstructure:"log_level"`
 			Options         map[string]string `mapstructure:"options"`
+
+			EncryptionKey          string   `mapstructure:"encryption_key"`
+			PreviousEncryptionKeys []string `mapstructure:"previous_encryption_keys"`
 		}{
 			Path: dbPath,
 		},
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -12,8 +13,10 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/ginsys/shelly-manager/internal/cli"
 	"github.com/ginsys/shelly-manager/internal/config"
 	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/naming"
 	"github.com/ginsys/shelly-manager/internal/provisioning"
 	"github.com/ginsys/shelly-manager/internal/security/secrets"
 )
@@ -24,6 +27,7 @@ var (
 	shellyProvisioner   *provisioning.ShellyProvisioner
 	netInterface        provisioning.NetworkInterface
 	apiClient           *provisioning.APIClient
+	healthTracker       *provisioning.HealthTracker
 	cfg                 *config.Config
 	logger              *logging.Logger
 	configFile          string
@@ -69,18 +73,17 @@ in AP mode. This command identifies devices that need provisioning.`,
 
 // Provision command - provision specific devices
 var provisionCmd = &cobra.Command{
-	Use:   "provision <ssid> [password]",
+	Use:   "provision [ssid] [password]",
 	Short: "Provision discovered devices to join WiFi network",
 	Long: `Provision unprovisioned Shelly devices to join a specific WiFi network.
-Devices must be in AP mode and accessible via WiFi interface.`,
-	Args: cobra.RangeArgs(1, 2),
+Devices must be in AP mode and accessible via WiFi interface.
+
+With --profile the WiFi network, credentials and device defaults come from a
+provisioning profile stored on the API server; arguments and flags given on
+the command line override them.`,
+	Args: cobra.MaximumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		targetSSID := args[0]
-		targetPassword := ""
-		if len(args) > 1 {
-			targetPassword = args[1]
-		}
-		provisionDevices(cmd, targetSSID, targetPassword)
+		provisionDevices(cmd, args)
 	},
 }
 
@@ -141,6 +144,10 @@ func runAgent() {
 		"component":     "agent",
 	}).Info("Agent started successfully")
 
+	if cfg.Provisioning.HealthListen != "" {
+		startHealthServer(ctx, cfg.Provisioning.HealthListen)
+	}
+
 	// Initial registration attempt
 	if err := registerWithAPI(); err != nil {
 		logger.WithFields(map[string]any{
@@ -148,7 +155,12 @@ func runAgent() {
 			"component": "agent",
 		}).Warn("Failed to register with API server")
 		fmt.Printf("Warning: Failed to register with API server: %v\n", err)
+	} else {
+		sendHeartbeat()
 	}
+	// Tasks run on the poll loop and can take minutes, so heartbeats keep
+	// their own schedule and report the task in progress
+	go runHeartbeats(ctx, heartbeatInterval)
 
 	for {
 		select {
@@ -216,12 +228,27 @@ func scanForAPDevices() {
 }
 
 // provisionDevices provisions discovered devices
-func provisionDevices(cmd *cobra.Command, targetSSID, targetPassword string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+func provisionDevices(cmd *cobra.Command, args []string) {
+	baseRequest, err := provisionRequest(cmd, args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	var apQR *provisioning.WiFiQRCode
+	if baseRequest.APQRCode != "" {
+		qr, err := provisioning.ParseWiFiQRCode(baseRequest.APQRCode)
+		if err != nil {
+			fmt.Printf("Invalid --ap-qr value: %v\n", err)
+			return
+		}
+		apQR = qr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DeviceClient.Resolve("", 0).ProvisionTimeoutDuration())
 	defer cancel()
 
 	logger.WithFields(map[string]any{
-		"target_ssid": targetSSID,
+		"target_ssid": baseRequest.SSID,
 		"component":   "provision",
 	}).Info("Starting device provisioning")
 
@@ -248,41 +275,36 @@ func provisionDevices(cmd *cobra.Command, targetSSID, targetPassword string) {
 
 	fmt.Printf("Found %d unprovisioned devices. Starting provisioning...\n", len(devices))
 
-	// Get additional configuration from flags
-	deviceName, _ := cmd.Flags().GetString("name")
-	enableAuth, _ := cmd.Flags().GetBool("enable-auth")
-	authUser, _ := cmd.Flags().GetString("auth-user")
-	authPassword, _ := cmd.Flags().GetString("auth-password")
-	enableCloud, _ := cmd.Flags().GetBool("enable-cloud")
-	enableMQTT, _ := cmd.Flags().GetBool("enable-mqtt")
-	mqttServer, _ := cmd.Flags().GetString("mqtt-server")
-	timeout, _ := cmd.Flags().GetInt("timeout")
+	// Names generated during this run, for collision-free generated names
+	takenNames := naming.NameSet{}
+	namingPolicy := naming.NewPolicy(cfg.Naming)
 
 	successCount := 0
 	failCount := 0
 
 	for i, device := range devices {
+		// A scanned QR code identifies a single device AP
+		if apQR != nil && !apQR.MatchesDevice(device) {
+			continue
+		}
+
 		fmt.Printf("\n[%d/%d] Provisioning device: %s (%s)\n",
 			i+1, len(devices), device.SSID, device.Model)
 
-		// Create provisioning request
-		request := provisioning.ProvisioningRequest{
-			SSID:         targetSSID,
-			Password:     targetPassword,
-			DeviceName:   deviceName,
-			EnableAuth:   enableAuth,
-			AuthUser:     authUser,
-			AuthPassword: authPassword,
-			EnableCloud:  enableCloud,
-			EnableMQTT:   enableMQTT,
-			MQTTServer:   mqttServer,
-			Timeout:      timeout,
-		}
+		request := baseRequest
 
-		// If no device name specified, generate one
+		// If no device name specified, generate one from the naming template
+		if request.DeviceName == "" && namingPolicy.Enabled() {
+			name, err := namingPolicy.Name(naming.Subject{MAC: device.MAC, Model: device.Model, Generation: device.Generation}, takenNames)
+			if err != nil {
+				fmt.Printf("Warning: naming template failed: %v\n", err)
+			}
+			request.DeviceName = name
+		}
 		if request.DeviceName == "" {
 			request.DeviceName = fmt.Sprintf("Shelly-%s", device.MAC[len(device.MAC)-6:])
 		}
+		takenNames.Add(request.DeviceName)
 
 		result, err := provisioningManager.ProvisionDevice(ctx, device, request)
 		if err != nil {
@@ -331,6 +353,65 @@ func provisionDevices(cmd *cobra.Command, targetSSID, targetPassword string) {
 	fmt.Printf("📊 Total: %d\n", len(devices))
 }
 
+// provisionRequest builds the request of a provision run: the defaults of
+// the --profile stored on the API server, overridden by the arguments and the
+// flags given on the command line
+func provisionRequest(cmd *cobra.Command, args []string) (provisioning.ProvisioningRequest, error) {
+	flags := cmd.Flags()
+	request := provisioning.ProvisioningRequest{}
+	request.AuthUser, _ = flags.GetString("auth-user")
+	request.Timeout, _ = flags.GetInt("timeout")
+
+	if profile, _ := flags.GetString("profile"); profile != "" {
+		if apiClient == nil {
+			return request, fmt.Errorf("--profile needs the API server (--api-url)")
+		}
+		config, err := apiClient.GetProvisioningProfile(profile)
+		if err != nil {
+			return request, err
+		}
+		request.ApplyConfig(config)
+	}
+
+	if len(args) > 0 {
+		request.SSID = args[0]
+	}
+	if len(args) > 1 {
+		request.Password = args[1]
+	}
+	for flag, field := range map[string]*string{
+		"name":          &request.DeviceName,
+		"auth-user":     &request.AuthUser,
+		"auth-password": &request.AuthPassword,
+		"mqtt-server":   &request.MQTTServer,
+		"ntp-server":    &request.NTPServer,
+		"timezone":      &request.Timezone,
+		"ap-password":   &request.APPassword,
+		"ap-qr":         &request.APQRCode,
+	} {
+		if flags.Changed(flag) {
+			*field, _ = flags.GetString(flag)
+		}
+	}
+	for flag, field := range map[string]*bool{
+		"enable-auth":  &request.EnableAuth,
+		"enable-cloud": &request.EnableCloud,
+		"enable-mqtt":  &request.EnableMQTT,
+	} {
+		if flags.Changed(flag) {
+			*field, _ = flags.GetBool(flag)
+		}
+	}
+	if flags.Changed("timeout") {
+		request.Timeout, _ = flags.GetInt("timeout")
+	}
+
+	if request.SSID == "" {
+		return request, fmt.Errorf("target SSID is required: pass it as argument or use --profile")
+	}
+	return request, nil
+}
+
 // checkStatus checks agent status and connectivity
 func checkStatus() {
 	fmt.Println("Shelly Provisioner Status")
@@ -441,6 +522,7 @@ func pollForTasks(ctx context.Context) error {
 	}
 
 	tasks, err := apiClient.PollTasks()
+	healthTracker.RecordPoll(err)
 	if err != nil {
 		return err
 	}
@@ -456,7 +538,12 @@ func pollForTasks(ctx context.Context) error {
 
 	// Process each task
 	for _, task := range tasks {
-		if err := processTask(ctx, task); err != nil {
+		healthTracker.StartTask(task.ID)
+		sendHeartbeat()
+		err := processTask(ctx, task)
+		healthTracker.FinishTask(task.ID, err)
+		sendHeartbeat()
+		if err != nil {
 			logger.WithFields(map[string]any{
 				"task_id":   task.ID,
 				"task_type": task.Type,
@@ -493,6 +580,63 @@ func pollForTasks(ctx context.Context) error {
 	return nil
 }
 
+// heartbeatInterval is how often the agent reports its health; the server
+// takes an agent silent for 5 minutes as offline
+const heartbeatInterval = time.Minute
+
+// runHeartbeats reports the agent's health every interval until ctx is
+// cancelled, independently of task polling and processing
+func runHeartbeats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sendHeartbeat()
+		}
+	}
+}
+
+// sendHeartbeat reports the agent's health to the API server
+func sendHeartbeat() {
+	if apiClient == nil || !apiClient.IsRegistered() {
+		return
+	}
+	err := apiClient.SendHeartbeat(healthTracker.Snapshot())
+	healthTracker.RecordHeartbeat(err)
+}
+
+// startHealthServer serves the agent's health on addr until ctx is cancelled
+func startHealthServer(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/health", healthTracker)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.WithFields(map[string]any{
+				"addr":      addr,
+				"error":     err.Error(),
+				"component": "agent",
+			}).Error("Health endpoint failed")
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logger.WithFields(map[string]any{
+		"addr":      addr,
+		"component": "agent",
+	}).Info("Serving agent health endpoint")
+	fmt.Printf("Health endpoint: http://%s/health\n", addr)
+}
+
 func testAPIConnectivity() error {
 	if apiClient == nil {
 		return fmt.Errorf("API client not initialized")
@@ -523,12 +667,22 @@ func processTask(ctx context.Context, task *provisioning.ProvisioningTask) error
 
 // processDeviceProvisioningTask handles device provisioning tasks
 func processDeviceProvisioningTask(ctx context.Context, task *provisioning.ProvisioningTask) error {
-	if task.TargetSSID == "" {
+	// Create provisioning request from task config; the server expands
+	// provisioning profiles into the task
+	request := provisioning.ProvisioningRequest{
+		Timeout: 300, // 5 minutes default
+	}
+	request.ApplyConfig(task.Config)
+	if task.TargetSSID != "" {
+		request.SSID = task.TargetSSID
+	}
+	if request.SSID == "" {
 		return fmt.Errorf("target SSID is required for provisioning task")
 	}
 
 	// First discover available devices
 	devices, err := shellyProvisioner.DiscoverUnprovisionedDevices(ctx)
+	healthTracker.RecordScan(len(devices), err)
 	if err != nil {
 		return fmt.Errorf("failed to discover devices: %w", err)
 	}
@@ -563,34 +717,6 @@ func processDeviceProvisioningTask(ctx context.Context, task *provisioning.Provi
 		return fmt.Errorf("no suitable device found")
 	}
 
-	// Create provisioning request from task config
-	request := provisioning.ProvisioningRequest{
-		SSID:    task.TargetSSID,
-		Timeout: 300, // 5 minutes default
-	}
-
-	// Extract additional configuration from task
-	if task.Config != nil {
-		if password, ok := task.Config["password"].(string); ok {
-			request.Password = password
-		}
-		if deviceName, ok := task.Config["device_name"].(string); ok {
-			request.DeviceName = deviceName
-		}
-		if enableAuth, ok := task.Config["enable_auth"].(bool); ok {
-			request.EnableAuth = enableAuth
-		}
-		if authUser, ok := task.Config["auth_user"].(string); ok {
-			request.AuthUser = authUser
-		}
-		if authPassword, ok := task.Config["auth_password"].(string); ok {
-			request.AuthPassword = authPassword
-		}
-		if timeout, ok := task.Config["timeout"].(float64); ok {
-			request.Timeout = int(timeout)
-		}
-	}
-
 	// Generate device name if not provided
 	if request.DeviceName == "" {
 		request.DeviceName = fmt.Sprintf("Shelly-%s", targetDevice.MAC[len(targetDevice.MAC)-6:])
@@ -617,6 +743,7 @@ func processDeviceProvisioningTask(ctx context.Context, task *provisioning.Provi
 // processDeviceDiscoveryTask handles device discovery tasks
 func processDeviceDiscoveryTask(ctx context.Context, task *provisioning.ProvisioningTask) error {
 	devices, err := shellyProvisioner.DiscoverUnprovisionedDevices(ctx)
+	healthTracker.RecordScan(len(devices), err)
 	if err != nil {
 		return fmt.Errorf("device discovery failed: %w", err)
 	}
@@ -668,6 +795,12 @@ func processDeviceDiscoveryTask(ctx context.Context, task *provisioning.Provisio
 func initApp() {
 	var err error
 
+	// Completion scripts and man pages describe the CLI; they need no
+	// configuration and must print nothing else
+	if cli.ToolingArgs(rootCmd, os.Args[1:]) {
+		return
+	}
+
 	// Load configuration
 	cfg, err = config.LoadWithName(configFile, "shelly-provisioner")
 	if err != nil {
@@ -722,6 +855,8 @@ func initApp() {
 	shellyProvisioner = provisioning.NewShellyProvisioner(logger, netInterface)
 	provisioningManager.SetDeviceProvisioner(shellyProvisioner)
 
+	healthTracker = provisioning.NewHealthTracker(generateAgentID(), netInterface)
+
 	// Initialize API client if API URL is provided
 	if apiURL != "" {
 		apiClient = provisioning.NewAPIClient(apiURL, apiKey, generateAgentID(), logger)
@@ -765,12 +900,45 @@ func init() {
 	provisionCmd.Flags().Bool("enable-mqtt", false, "Enable MQTT")
 	provisionCmd.Flags().String("mqtt-server", "", "MQTT server address")
 	provisionCmd.Flags().Int("timeout", 300, "Provisioning timeout in seconds")
+	provisionCmd.Flags().String("ap-password", "", "Password of the device AP (printed on newer devices)")
+	provisionCmd.Flags().String("ap-qr", "", "WiFi QR code content from the device label (provisions only that device)")
+	provisionCmd.Flags().String("ntp-server", "", "NTP server")
+	provisionCmd.Flags().String("timezone", "", "Timezone, e.g. Europe/Brussels")
+	provisionCmd.Flags().String("profile", "", "Provisioning profile stored on the API server")
+
+	// Complete profile names from the API server given with --api-url
+	_ = provisionCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
 
 	// Add subcommands
 	rootCmd.AddCommand(agentCmd)
 	rootCmd.AddCommand(scanAPCmd)
 	rootCmd.AddCommand(provisionCmd)
 	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(cli.ManCommand(rootCmd))
+}
+
+// completeProfiles completes --profile with the provisioning profiles stored
+// on the API server given with --api-url
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if apiURL == "" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	quiet, err := logging.New(logging.Config{Level: "error", Format: "text", Output: "stderr"})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveError
+	}
+	names, err := provisioning.NewAPIClient(apiURL, apiKey, "", quiet).ListProvisioningProfiles()
+	if err != nil {
+		cobra.CompDebugln(fmt.Sprintf("profile completion failed: %v", err), true)
+		return nil, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveError
+	}
+	completions := make([]string, 0, len(names))
+	for _, name := range names {
+		if strings.HasPrefix(name, toComplete) {
+			completions = append(completions, name)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
 }
 
 func main() {
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+// addArtifactRoutes registers the artifacts of exports and backups across
+// their storage tiers
+func (eh *SyncHandlers) addArtifactRoutes(api *mux.Router) {
+	api.HandleFunc("/artifacts", eh.ListArtifacts).Methods("GET")
+	api.HandleFunc("/artifacts/lifecycle", eh.RunArtifactLifecycle).Methods("POST")
+	api.HandleFunc("/artifacts/{id}", eh.GetArtifact).Methods("GET")
+	api.HandleFunc("/artifacts/{id}/download", eh.DownloadArtifact).Methods("GET")
+	api.HandleFunc("/artifacts/{id}/restore", eh.RestoreArtifact).Methods("POST")
+}
+
+// ListArtifacts handles GET /api/v1/artifacts. Artifacts of every plugin are
+// listed newest first with their tier and location; tier (local, object or
+// deleted) and plugin narrow the list.
+func (eh *SyncHandlers) ListArtifacts(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	page := parseIntDefault(q.Get("page"), 1)
+	pageSize := parseIntDefault(q.Get("page_size"), 20)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	filter := sync.ArtifactFilter{Tier: q.Get("tier"), Plugin: q.Get("plugin")}
+
+	artifacts, total, err := eh.syncEngine.ListArtifacts(r.Context(), filter, page, pageSize)
+	if err != nil {
+		if errors.Is(err, sync.ErrInvalidArtifactTier) {
+			apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "tier must be local, object or deleted")
+			return
+		}
+		apiresp.NewResponseWriter(eh.logger).WriteInternalError(w, r, err)
+		return
+	}
+	builder := apiresp.NewResponseBuilder(eh.logger).WithPagination(page, pageSize, total)
+	resp := builder.Success(map[string]interface{}{"artifacts": artifacts})
+	apiresp.NewResponseWriter(eh.logger).WriteSuccessWithMeta(w, r, resp.Data, resp.Meta)
+}
+
+// GetArtifact handles GET /api/v1/artifacts/{id}
+func (eh *SyncHandlers) GetArtifact(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	artifact, err := eh.syncEngine.GetArtifact(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		eh.writeArtifactError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, artifact)
+}
+
+// DownloadArtifact handles GET /api/v1/artifacts/{id}/download. Local
+// artifacts are served from disk with resumable downloads; artifacts in
+// object storage are streamed from there.
+func (eh *SyncHandlers) DownloadArtifact(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	artifact, err := eh.syncEngine.GetArtifact(r.Context(), id)
+	if err != nil {
+		eh.writeArtifactError(w, r, err)
+		return
+	}
+	if artifact.Tier == sync.ArtifactTierLocal {
+		eh.serveExportByID(w, r, id)
+		return
+	}
+	eh.streamArtifact(w, r, id)
+}
+
+// streamArtifact copies an artifact from its tier to the response
+func (eh *SyncHandlers) streamArtifact(w http.ResponseWriter, r *http.Request, id string) {
+	body, artifact, err := eh.syncEngine.OpenArtifact(r.Context(), id)
+	if err != nil {
+		eh.writeArtifactError(w, r, err)
+		return
+	}
+	defer func() { _ = body.Close() }()
+	name := path.Base(artifact.Location)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	setContentTypeForPath(w, name)
+	if artifact.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(artifact.Size, 10))
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		eh.logger.WithFields(map[string]any{
+			"export_id": id,
+			"error":     err.Error(),
+			"component": "artifact_lifecycle",
+		}).Warn("Artifact download interrupted")
+	}
+}
+
+// RestoreArtifact handles POST /api/v1/artifacts/{id}/restore and brings an
+// artifact back from object storage to local disk, where it can be imported
+func (eh *SyncHandlers) RestoreArtifact(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	artifact, err := eh.syncEngine.RestoreArtifact(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		eh.writeArtifactError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, artifact)
+}
+
+// RunArtifactLifecycle handles POST /api/v1/artifacts/lifecycle and applies
+// the lifecycle now instead of waiting for the next run
+func (eh *SyncHandlers) RunArtifactLifecycle(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	report, err := eh.syncEngine.RunArtifactLifecycle(r.Context())
+	if err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteInternalError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, report)
+}
+
+// writeArtifactError maps artifact errors to responses
+func (eh *SyncHandlers) writeArtifactError(w http.ResponseWriter, r *http.Request, err error) {
+	rw := apiresp.NewResponseWriter(eh.logger)
+	switch {
+	case errors.Is(err, sync.ErrArtifactNotFound):
+		rw.WriteNotFoundError(w, r, "Artifact")
+	case errors.Is(err, sync.ErrArtifactUnavailable):
+		rw.WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict, err.Error(), nil)
+	case errors.Is(err, sync.ErrObjectStorage):
+		rw.WriteError(w, r, http.StatusBadGateway, apiresp.ErrCodeExternalServiceError, err.Error(), nil)
+	default:
+		rw.WriteInternalError(w, r, err)
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/sync"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+// memObjectStore is an ObjectStore in memory
+type memObjectStore map[string][]byte
+
+func (m memObjectStore) Put(_ context.Context, key string, body io.Reader, _ int64, _ string) error {
+	data, err := io.ReadAll(body)
+	m[key] = data
+	return err
+}
+
+func (m memObjectStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	data, ok := m[key]
+	if !ok {
+		return nil, sync.ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m memObjectStore) Delete(_ context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func (m memObjectStore) Location(key string) string { return "mem://" + key }
+
+func TestArtifactHandlers(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+
+	store := memObjectStore{}
+	engine := sync.NewSyncEngine(db, logger)
+	engine.SetArtifactLifecycle(sync.ArtifactLifecycle{Store: store, LocalFor: 7 * 24 * time.Hour})
+	router := mux.NewRouter()
+	NewSyncHandlers(engine, logger).AddExportRoutes(router.PathPrefix("/api/v1").Subrouter())
+
+	path := filepath.Join(t.TempDir(), "weekly.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"devices":[]}`), 0o600))
+	require.NoError(t, db.GetDB().Create(&database.ExportHistory{
+		ExportID: "weekly", PluginName: "json", Format: "json", Success: true,
+		FilePath: path, FileSize: 14, StorageTier: sync.ArtifactTierLocal,
+		CreatedAt: time.Now().Add(-10 * 24 * time.Hour),
+	}).Error)
+
+	do := func(method, target string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		var wrap map[string]interface{}
+		_ = json.Unmarshal(rr.Body.Bytes(), &wrap)
+		return rr, wrap
+	}
+
+	rr, wrap := do("POST", "/api/v1/artifacts/lifecycle")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, float64(1), wrap["data"].(map[string]interface{})["transitioned"])
+	require.NoFileExists(t, path)
+
+	rr, wrap = do("GET", "/api/v1/artifacts?tier=object")
+	require.Equal(t, http.StatusOK, rr.Code)
+	artifacts := wrap["data"].(map[string]interface{})["artifacts"].([]interface{})
+	require.Len(t, artifacts, 1)
+	require.Equal(t, "mem://json/weekly/weekly.json", artifacts[0].(map[string]interface{})["location"])
+
+	// Downloads stream from object storage, also through the export URL
+	for _, target := range []string{"/api/v1/artifacts/weekly/download", "/api/v1/export/backup/weekly/download"} {
+		rr, _ = do("GET", target)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `{"devices":[]}`, rr.Body.String())
+		require.Contains(t, rr.Header().Get("Content-Disposition"), "weekly.json")
+	}
+
+	rr, wrap = do("POST", "/api/v1/artifacts/weekly/restore")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, sync.ArtifactTierLocal, wrap["data"].(map[string]interface{})["tier"])
+	require.FileExists(t, path)
+
+	rr, _ = do("GET", "/api/v1/artifacts?tier=glacier")
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	rr, _ = do("GET", "/api/v1/artifacts/missing")
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// SetDeviceAsset handles PUT /api/v1/devices/{id}/asset with body
+// {"serial", "vendor", "purchase_date" (YYYY-MM-DD), "warranty_months"}. The
+// body replaces the stored asset record; omitted fields are cleared.
+func (h *Handler) SetDeviceAsset(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.ipamID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Serial         string `json:"serial"`
+		Vendor         string `json:"vendor"`
+		PurchaseDate   string `json:"purchase_date"`
+		WarrantyMonths int    `json:"warranty_months"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	asset := database.DeviceAsset{Serial: req.Serial, Vendor: req.Vendor, WarrantyMonths: req.WarrantyMonths}
+	if req.PurchaseDate != "" {
+		date, err := service.ParseAssetDate(req.PurchaseDate)
+		if err != nil {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		asset.PurchaseDate = &date
+	}
+
+	device, err := h.Service.SetDeviceAsset(id, asset)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDeviceNotFound):
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+		case errors.Is(err, service.ErrInvalidAsset):
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+		default:
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, device.Asset)
+}
+
+// ImportDeviceAssets handles POST /api/v1/devices/assets/import with body
+// {"csv": "..."}. Rows that cannot be applied are listed in errors.
+func (h *Handler) ImportDeviceAssets(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		CSV string `json:"csv"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if strings.TrimSpace(req.CSV) == "" {
+		h.responseWriter().WriteValidationError(w, r, "csv content is required")
+		return
+	}
+
+	result, err := h.Service.ImportDeviceAssets(strings.NewReader(req.CSV))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAsset) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, result)
+}
+
+// GetAssetReport handles GET /api/v1/reports/assets. With format=csv the
+// report is downloaded as a CSV file.
+func (h *Handler) GetAssetReport(w http.ResponseWriter, r *http.Request) {
+	report, err := h.Service.GetAssetReport()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		h.responseWriter().WriteSuccess(w, r, report)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"assets-%s.csv\"", time.Now().Format("20060102")))
+		if err := service.WriteAssetReportCSV(w, report); err != nil {
+			h.logger.WithFields(map[string]any{
+				"error":     err.Error(),
+				"component": "api",
+			}).Warn("Failed to write asset report")
+		}
+	default:
+		h.responseWriter().WriteValidationError(w, r, "format must be json or csv")
+	}
+}
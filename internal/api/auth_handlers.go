@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
+)
+
+// GetAuthConfig handles GET /api/v1/auth/config and tells the UI whether
+// single sign-on is available and required
+func (h *Handler) GetAuthConfig(w http.ResponseWriter, r *http.Request) {
+	result := map[string]any{"enabled": false, "required": false}
+	if h.Auth != nil {
+		result["enabled"] = true
+		result["required"] = h.Auth.Required()
+		if h.Auth.OIDC() != nil {
+			result["oidc_login_url"] = "/api/v1/auth/oidc/login"
+		}
+	}
+	h.responseWriter().WriteSuccess(w, r, result)
+}
+
+// GetCurrentUser handles GET /api/v1/auth/me and returns the signed-in user
+func (h *Handler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	p := auth.FromContext(r.Context())
+	if p == nil {
+		h.responseWriter().WriteError(w, r, http.StatusUnauthorized, apiresp.ErrCodeUnauthorized, "Not signed in", nil)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, p)
+}
+
+// OIDCLogin handles GET /api/v1/auth/oidc/login and redirects the browser
+// to the identity provider; ?return_to is the local path to come back to
+func (h *Handler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if h.Auth == nil || h.Auth.OIDC() == nil {
+		h.responseWriter().WriteNotFoundError(w, r, "OIDC sign-in")
+		return
+	}
+	target, err := h.Auth.BeginLogin(w, r, r.URL.Query().Get("return_to"))
+	if err != nil {
+		h.logAuthEvent(r, "login_failed", "", err)
+		h.responseWriter().WriteError(w, r, http.StatusBadGateway, apiresp.ErrCodeExternalServiceError, "Identity provider unavailable", nil)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCCallback handles GET /api/v1/auth/oidc/callback, where the identity
+// provider sends the browser back; it starts a session and redirects to the
+// page the sign-in started from
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if h.Auth == nil || h.Auth.OIDC() == nil {
+		h.responseWriter().WriteNotFoundError(w, r, "OIDC sign-in")
+		return
+	}
+	p, returnTo, err := h.Auth.CompleteLogin(w, r)
+	if err != nil {
+		h.logAuthEvent(r, "login_failed", "", err)
+		if errors.Is(err, auth.ErrNoRole) {
+			h.responseWriter().WriteError(w, r, http.StatusForbidden, apiresp.ErrCodeForbidden, "Your account has no role in Shelly Manager", nil)
+			return
+		}
+		h.responseWriter().WriteError(w, r, http.StatusUnauthorized, apiresp.ErrCodeUnauthorized, "Sign-in failed", nil)
+		return
+	}
+	h.logAuthEvent(r, "login", p.Username, nil)
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+// Logout handles POST /api/v1/auth/logout and ends the browser session
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if h.Auth == nil {
+		h.responseWriter().WriteSuccess(w, r, map[string]any{"logged_out": true})
+		return
+	}
+	if err := h.Auth.EndSession(w, r); err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	username := ""
+	if p := auth.FromContext(r.Context()); p != nil {
+		username = p.Username
+	}
+	h.logAuthEvent(r, "logout", username, nil)
+	h.responseWriter().WriteSuccess(w, r, map[string]any{"logged_out": true})
+}
+
+// logAuthEvent logs sign-ins, sign-outs and failures for auditing
+func (h *Handler) logAuthEvent(r *http.Request, event, username string, err error) {
+	if h.logger == nil {
+		return
+	}
+	fields := map[string]any{
+		"component":  "auth",
+		"event":      event,
+		"username":   username,
+		"request_id": logging.GetRequestID(r.Context()),
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		h.logger.WithFields(fields).Warn("Sign-in failed")
+		return
+	}
+	h.logger.WithFields(fields).Info("Authentication event")
+}
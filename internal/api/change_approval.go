@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// ChangeRequestHeader names the approved change request a repeated request
+// executes
+const ChangeRequestHeader = "X-Change-Request"
+
+// gateChange enforces the two-person rule and then the bulk confirmation on
+// a configuration change. An approved change request stands in for the
+// confirmation. When the change may not run yet it writes the response and
+// returns false: 428 with the pending change request in the error details,
+// or an error for an unusable change request.
+func (h *Handler) gateChange(w http.ResponseWriter, r *http.Request, operation string, devices []database.Device, params any) bool {
+	if h.Service == nil {
+		return true
+	}
+	ids := make([]uint, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+	}
+	var changeID uint
+	if v := r.Header.Get(ChangeRequestHeader); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid "+ChangeRequestHeader+" header")
+			return false
+		}
+		changeID = uint(id)
+	}
+
+	change, err := h.Service.RequireApproval(service.BulkOperation{
+		Operation: operation,
+		DeviceIDs: ids,
+		Params:    params,
+	}, approvalIdentity(r), changeID)
+	switch {
+	case err == nil && change != nil:
+		return true
+	case err == nil:
+		return h.confirmBulk(w, r, operation, devices, params)
+	case errors.Is(err, service.ErrApprovalRequired):
+		h.responseWriter().WriteError(w, r, http.StatusPreconditionRequired, apiresp.ErrCodeApprovalRequired, err.Error(), change)
+	default:
+		h.writeChangeRequestError(w, r, err)
+	}
+	return false
+}
+
+// approvalIdentity names the caller of a change held for a second person:
+// the signed-in user. Headers such as X-User-ID are set by the client and
+// would let one person act as two, so callers without a signed-in user are
+// anonymous and refused.
+func approvalIdentity(r *http.Request) string {
+	p := auth.FromContext(r.Context())
+	if p == nil {
+		return ""
+	}
+	if p.Username != "" {
+		return p.Username
+	}
+	return p.Subject
+}
+
+// writeChangeRequestError maps change approval errors to responses
+func (h *Handler) writeChangeRequestError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrChangeRequestNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Change request")
+	case errors.Is(err, service.ErrChangeRequestState):
+		h.responseWriter().WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict, err.Error(), nil)
+	case errors.Is(err, service.ErrApprovalIdentity):
+		h.responseWriter().WriteError(w, r, http.StatusForbidden, apiresp.ErrCodeForbidden, err.Error(), nil)
+	case errors.Is(err, service.ErrInvalidChangeStatus):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
+	"github.com/ginsys/shelly-manager/internal/service"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestApplyConfigTemplate_Approval(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	svc := testShellyService(t, db)
+	svc.Config.ChangeApproval.Enabled = true
+	handler := NewHandlerWithLogger(db, svc, nil, nil, logging.GetDefault())
+	testutil.AssertNoError(t, db.AddDevice(&database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Name: "Relay"}))
+
+	apply := func(user, changeID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/devices/1/config/apply-template", bytes.NewReader([]byte(`{"template_id":99}`)))
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Username: user, Role: config.RoleAdmin}))
+		if changeID != "" {
+			req.Header.Set(ChangeRequestHeader, changeID)
+		}
+		w := httptest.NewRecorder()
+		handler.ApplyConfigTemplate(w, req)
+		return w
+	}
+	decide := func(user, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/change-requests/"+id+"/approve", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		if user != "" {
+			req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Username: user, Role: config.RoleAdmin}))
+		}
+		req.Header.Set("X-User-ID", "bob")
+		w := httptest.NewRecorder()
+		handler.ApproveChangeRequest(w, req)
+		return w
+	}
+
+	w := apply("alice", "")
+	testutil.AssertEqual(t, http.StatusPreconditionRequired, w.Code)
+	var pending struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				ID     uint   `json:"id"`
+				Status string `json:"status"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	testutil.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &pending))
+	testutil.AssertEqual(t, "APPROVAL_REQUIRED", pending.Error.Code)
+	testutil.AssertEqual(t, service.ChangePending, pending.Error.Details.Status)
+	id := strconv.FormatUint(uint64(pending.Error.Details.ID), 10)
+
+	testutil.AssertEqual(t, http.StatusForbidden, decide("alice", id).Code)
+	// A client-supplied X-User-ID is no identity
+	testutil.AssertEqual(t, http.StatusForbidden, decide("", id).Code)
+	testutil.AssertEqual(t, http.StatusOK, decide("bob", id).Code)
+	testutil.AssertEqual(t, http.StatusConflict, decide("carol", id).Code)
+
+	// The approved change runs once; the unknown template is reported as usual
+	testutil.AssertEqual(t, http.StatusNotFound, apply("alice", id).Code)
+	testutil.AssertEqual(t, http.StatusConflict, apply("alice", id).Code)
+
+	change, err := svc.GetChangeRequest(pending.Error.Details.ID)
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqual(t, service.ChangeExecuted, change.Status)
+	testutil.AssertEqual(t, "bob", change.DecidedBy)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+)
+
+// defaultChangeRequestLimit bounds the change requests listed by default
+const defaultChangeRequestLimit = 100
+
+// ListChangeRequests handles GET /api/v1/change-requests, newest first,
+// filtered by ?status= and bounded by ?limit=
+func (h *Handler) ListChangeRequests(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	limit := parseIntDefault(r.URL.Query().Get("limit"), defaultChangeRequestLimit)
+	changes, err := h.Service.ChangeRequests(r.URL.Query().Get("status"), limit)
+	if err != nil {
+		h.writeChangeRequestError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"change_requests": changes,
+		"total":           len(changes),
+	})
+}
+
+// GetChangeRequest handles GET /api/v1/change-requests/{id}
+func (h *Handler) GetChangeRequest(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.changeRequestID(w, r)
+	if !ok {
+		return
+	}
+	change, err := h.Service.GetChangeRequest(id)
+	if err != nil {
+		h.writeChangeRequestError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, change)
+}
+
+// ApproveChangeRequest handles POST /api/v1/change-requests/{id}/approve.
+// The approver is named by the X-User-ID header and must not be the
+// requester.
+func (h *Handler) ApproveChangeRequest(w http.ResponseWriter, r *http.Request) {
+	h.decideChangeRequest(w, r, true)
+}
+
+// RejectChangeRequest handles POST /api/v1/change-requests/{id}/reject
+func (h *Handler) RejectChangeRequest(w http.ResponseWriter, r *http.Request) {
+	h.decideChangeRequest(w, r, false)
+}
+
+// decideChangeRequest approves or rejects a pending change request with an
+// optional {"comment": ...} body
+func (h *Handler) decideChangeRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.changeRequestID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+			return
+		}
+	}
+
+	decide := h.Service.RejectChangeRequest
+	if approve {
+		decide = h.Service.ApproveChangeRequest
+	}
+	change, err := decide(id, approvalIdentity(r), req.Comment)
+	if err != nil {
+		h.writeChangeRequestError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, change)
+}
+
+// changeRequestID parses the {id} path variable
+func (h *Handler) changeRequestID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid change request ID", nil)
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/api/client"
+	"github.com/ginsys/shelly-manager/internal/api/middleware"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+// TestClientRoutesRegistered checks that every route called by the Go client
+// package is served by the production router
+func TestClientRoutesRegistered(t *testing.T) {
+	origTestMode := os.Getenv("SHELLY_SECURITY_VALIDATION_TEST_MODE")
+	_ = os.Unsetenv("SHELLY_SECURITY_VALIDATION_TEST_MODE")
+	defer func() {
+		if origTestMode != "" {
+			_ = os.Setenv("SHELLY_SECURITY_VALIDATION_TEST_MODE", origTestMode)
+		}
+	}()
+
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+
+	// Isolate Prometheus registrations so the router's HTTP metrics register cleanly
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+	h := NewHandlerWithLogger(db, nil, nil, nil, logger)
+	r := SetupRoutesWithSecurity(h, logger, middleware.DefaultSecurityConfig(), middleware.DefaultValidationConfig())
+
+	vars := regexp.MustCompile(`\{[^}]+\}`)
+	for _, route := range client.Routes {
+		req := httptest.NewRequest(route.Method, vars.ReplaceAllString(route.Path, "1"), nil)
+		var match mux.RouteMatch
+		assert.True(t, r.Match(req, &match) && match.MatchErr == nil,
+			"client route %s %s is not registered", route.Method, route.Path)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// The Gen1 compatibility endpoints answer the way a Gen1 device does: the
+// bare JSON document on success and a short plain-text message with the
+// status code otherwise, so legacy scripts parse them unchanged.
+
+// CompatRelay handles GET/POST /api/v1/compat/{device}/relay/{channel}. The
+// turn parameter (on, off, toggle) switches the relay; without it the relay
+// is only read. Timers are not supported.
+func (h *Handler) CompatRelay(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	channel, err := strconv.Atoi(vars["channel"])
+	if err != nil || channel < 0 {
+		http.Error(w, "Bad relay index!", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("timer") != "" {
+		http.Error(w, "Timers are not supported", http.StatusBadRequest)
+		return
+	}
+	relay, err := h.Service.CompatRelay(r.Context(), vars["device"], channel, r.FormValue("turn"))
+	if err != nil {
+		h.writeCompatError(w, err)
+		return
+	}
+	h.writeJSON(w, relay)
+}
+
+// CompatStatus handles GET /api/v1/compat/{device}/status
+func (h *Handler) CompatStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Service.CompatStatus(r.Context(), mux.Vars(r)["device"])
+	if err != nil {
+		h.writeCompatError(w, err)
+		return
+	}
+	h.writeJSON(w, status)
+}
+
+// CompatShelly handles GET /api/v1/compat/{device}/shelly
+func (h *Handler) CompatShelly(w http.ResponseWriter, r *http.Request) {
+	info, err := h.Service.CompatShelly(r.Context(), mux.Vars(r)["device"])
+	if err != nil {
+		h.writeCompatError(w, err)
+		return
+	}
+	h.writeJSON(w, info)
+}
+
+// writeCompatError maps a compatibility layer error to a plain-text answer
+func (h *Handler) writeCompatError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrCompatDisabled):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrDeviceNotFound):
+		http.Error(w, "Device not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrCompatRequest), errors.Is(err, service.ErrUnsupportedCapability):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrDeviceOffline), errors.Is(err, service.ErrDeviceNotResponding):
+		http.Error(w, "Device unreachable", http.StatusServiceUnavailable)
+	default:
+		if h.logger != nil {
+			h.logger.WithFields(map[string]any{
+				"error":     err.Error(),
+				"component": "compat",
+			}).Error("Gen1 compatibility request failed")
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/configuration"
+)
+
+// DeviceConfigPatchResponse is the patched configuration with the result of
+// validating it
+type DeviceConfigPatchResponse struct {
+	Config     *configuration.DeviceConfig     `json:"config"`
+	Validation *configuration.ValidationResult `json:"validation"`
+}
+
+// PatchDeviceConfig handles PATCH /api/v1/devices/{id}/config. The body is a
+// JSON Patch (application/json-patch+json) or a JSON Merge Patch
+// (application/merge-patch+json); with plain application/json an array is
+// taken as a JSON Patch and an object as a Merge Patch.
+func (h *Handler) PatchDeviceConfig(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil || !json.Valid(body) {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON in request body")
+		return
+	}
+	patchType, ok := configPatchType(r.Header.Get("Content-Type"), body)
+	if !ok {
+		h.responseWriter().WriteError(w, r, http.StatusUnsupportedMediaType, apiresp.ErrCodeUnsupportedMedia,
+			"Content-Type must be application/json-patch+json or application/merge-patch+json", nil)
+		return
+	}
+
+	if !h.checkConfigVersion(w, r, uint(id)) {
+		return
+	}
+
+	config, validation, err := h.Service.PatchDeviceConfig(uint(id), patchType, body)
+	if err != nil {
+		if h.writeConfigConflict(w, r, uint(id), err) {
+			return
+		}
+		switch {
+		case errors.Is(err, configuration.ErrStoredConfigNotFound):
+			h.responseWriter().WriteNotFoundError(w, r, "Stored configuration")
+		case errors.Is(err, configuration.ErrInvalidPatch):
+			h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, err.Error(), nil)
+		case errors.Is(err, configuration.ErrPatchFailed):
+			h.responseWriter().WriteError(w, r, http.StatusUnprocessableEntity, apiresp.ErrCodeBadRequest, err.Error(), nil)
+		case errors.Is(err, configuration.ErrPatchedConfigInvalid):
+			h.responseWriter().WriteError(w, r, http.StatusUnprocessableEntity, apiresp.ErrCodeValidationFailed, err.Error(), validation)
+		default:
+			h.logger.WithFields(map[string]any{
+				"device_id": id,
+				"error":     err.Error(),
+			}).Error("Failed to patch device config")
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+
+	setVersionETag(w, config.Version)
+	h.responseWriter().WriteSuccess(w, r, DeviceConfigPatchResponse{Config: config, Validation: validation})
+}
+
+// configPatchType returns the patch format of a request body from its
+// Content-Type, guessing it from the body for plain JSON
+func configPatchType(contentType string, body []byte) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	switch mediaType {
+	case configuration.PatchTypeJSON, configuration.PatchTypeMerge:
+		return mediaType, true
+	case "application/json":
+		var operations []json.RawMessage
+		if json.Unmarshal(body, &operations) == nil {
+			return configuration.PatchTypeJSON, true
+		}
+		return configuration.PatchTypeMerge, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestPatchDeviceConfig(t *testing.T) {
+	handler, cleanup := setupTemplateScopeHandler(t)
+	defer cleanup()
+
+	device := testutil.TestDevice()
+	require.NoError(t, handler.DB.AddDevice(device))
+	require.NoError(t, handler.DB.GetDB().Create(&configuration.DeviceConfig{DeviceID: device.ID,
+		Config: json.RawMessage(`{"name":"Hall","mode":"relay","wifi":{"ssid":"home"}}`)}).Error)
+	id := strconv.Itoa(int(device.ID))
+
+	patch := func(contentType, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/api/v1/devices/"+id+"/config", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.PatchDeviceConfig(w, mux.SetURLVars(req, map[string]string{"id": id}))
+		return w
+	}
+
+	w := patch("application/json-patch+json", `"1"`, `[{"op":"replace","path":"/wifi/ssid","value":"office"}]`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"valid":true`)
+
+	// Plain JSON objects are taken as a Merge Patch
+	w = patch("application/json", "", `{"name":"Hall Light","mode":null}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	config, err := handler.Service.GetDeviceConfig(device.ID)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"Hall Light","wifi":{"ssid":"office"}}`, string(config.Config))
+
+	// Outdated If-Match
+	w = patch("application/merge-patch+json", `"1"`, `{"name":"x"}`)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+
+	w = patch("text/plain", "", `{"name":"x"}`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code, w.Body.String())
+
+	w = patch("application/json-patch+json", "", `[{"op":"frobnicate","path":"/name"}]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	w = patch("application/json-patch+json", "", `[{"op":"test","path":"/wifi/ssid","value":"home"}]`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+
+	w = patch("application/merge-patch+json", "", `{"wifi":{"ssid":"this-ssid-is-far-too-long-for-any-device"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "SSID_TOO_LONG")
+}
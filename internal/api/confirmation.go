@@ -0,0 +1,40 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// ConfirmationTokenHeader carries the token that confirms a bulk operation
+const ConfirmationTokenHeader = "X-Confirmation-Token"
+
+// confirmBulk enforces the confirmation of a bulk operation on devices. When
+// the operation must be confirmed first it writes 428 with the change
+// summary and token in the error details and returns false.
+func (h *Handler) confirmBulk(w http.ResponseWriter, r *http.Request, operation string, devices []database.Device, params any) bool {
+	if h.Service == nil {
+		return true
+	}
+	ids := make([]uint, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+	}
+	challenge, err := h.Service.ConfirmBulkOperation(service.BulkOperation{
+		Operation: operation,
+		DeviceIDs: ids,
+		Params:    params,
+	}, r.Header.Get(ConfirmationTokenHeader))
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, service.ErrConfirmationRequired) {
+		h.responseWriter().WriteError(w, r, http.StatusPreconditionRequired, apiresp.ErrCodeConfirmationRequired, err.Error(), challenge)
+		return false
+	}
+	h.responseWriter().WriteInternalError(w, r, err)
+	return false
+}
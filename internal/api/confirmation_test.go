@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/service"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestBulkControlDevices_Confirmation(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	svc := testShellyService(t, db)
+	svc.Config.BulkConfirmation.Threshold = 1
+	handler := NewHandlerWithLogger(db, svc, nil, nil, logging.GetDefault())
+
+	for i, mac := range []string{"AABBCCDDEE01", "AABBCCDDEE02"} {
+		device := &database.Device{IP: "192.0.2." + strconv.Itoa(i+1), MAC: mac, Name: mac, Status: "offline"}
+		testutil.AssertNoError(t, db.AddDevice(device))
+	}
+	body := []byte(`{"tag":"","device_ids":[1,2],"action":"reboot","async":true}`)
+	call := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/devices/control", bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set(ConfirmationTokenHeader, token)
+		}
+		w := httptest.NewRecorder()
+		handler.BulkControlDevices(w, req)
+		return w
+	}
+
+	w := call("")
+	testutil.AssertEqual(t, http.StatusPreconditionRequired, w.Code)
+	var challenge struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				Token       string `json:"confirmation_token"`
+				DeviceCount int    `json:"device_count"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	testutil.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &challenge))
+	testutil.AssertEqual(t, "CONFIRMATION_REQUIRED", challenge.Error.Code)
+	testutil.AssertEqual(t, 2, challenge.Error.Details.DeviceCount)
+
+	w = call(challenge.Error.Details.Token)
+	testutil.AssertEqual(t, http.StatusAccepted, w.Code)
+	testutil.AssertEqual(t, http.StatusPreconditionRequired, call(challenge.Error.Details.Token).Code)
+
+	// Let the job finish before the database is closed
+	var accepted struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	testutil.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := svc.GetBulkControlJob(accepted.Data.ID)
+		testutil.AssertNoError(t, err)
+		if job.Status != service.JobStatusRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
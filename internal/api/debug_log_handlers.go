@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+// GetRecentLogs handles GET /api/v1/debug/logs. It returns the most recent
+// log entries, oldest first; request_id narrows them to one request (the
+// X-Request-ID response header), including the device calls, queries and
+// jobs it started, and limit caps how many are returned.
+func (h *Handler) GetRecentLogs(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	query := r.URL.Query()
+	limit := logging.DefaultRecentLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > logging.RecentLogEntries {
+			h.responseWriter().WriteValidationError(w, r,
+				"limit must be between 1 and "+strconv.Itoa(logging.RecentLogEntries))
+			return
+		}
+		limit = n
+	}
+	requestID := query.Get("request_id")
+	entries := logging.RecentEntries(requestID, limit)
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"request_id": requestID,
+		"count":      len(entries),
+		"entries":    entries,
+	})
+}
+
+// LoggingSettings are the runtime log levels
+type LoggingSettings struct {
+	Level      string              `json:"level"`
+	Components map[string]string   `json:"components"`
+	Subsystems map[string][]string `json:"subsystems,omitempty"`
+}
+
+// LoggingUpdate changes the runtime log levels. Components maps a subsystem
+// (api, discovery, configuration, metrics, provisioning) or a single
+// component value to a level; an empty level removes the override.
+type LoggingUpdate struct {
+	Level           string            `json:"level,omitempty"`
+	Components      map[string]string `json:"components,omitempty"`
+	ResetComponents bool              `json:"reset_components,omitempty"`
+}
+
+var componentNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// GetLogging handles GET /api/v1/admin/logging and returns the global log
+// level, the per-component overrides and the components of each subsystem
+func (h *Handler) GetLogging(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	levels := h.logger.Levels()
+	if levels == nil {
+		h.responseWriter().WriteError(w, r, http.StatusServiceUnavailable, apiresp.ErrCodeServiceUnavailable, "Log levels cannot be changed at runtime", nil)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, LoggingSettings{
+		Level:      levels.Level(),
+		Components: levels.ComponentLevels(),
+		Subsystems: logging.Subsystems,
+	})
+}
+
+// UpdateLogging handles PUT /api/v1/admin/logging. Changes take effect
+// immediately and last until the next restart.
+func (h *Handler) UpdateLogging(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	levels := h.logger.Levels()
+	if levels == nil {
+		h.responseWriter().WriteError(w, r, http.StatusServiceUnavailable, apiresp.ErrCodeServiceUnavailable, "Log levels cannot be changed at runtime", nil)
+		return
+	}
+	var req LoggingUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+
+	// Validate everything before changing anything
+	if req.Level != "" {
+		if _, err := logging.ParseLevel(req.Level); err != nil {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+	}
+	for component, level := range req.Components {
+		if !componentNamePattern.MatchString(component) {
+			h.responseWriter().WriteValidationError(w, r, fmt.Sprintf("invalid component %q", component))
+			return
+		}
+		if level != "" {
+			if _, err := logging.ParseLevel(level); err != nil {
+				h.responseWriter().WriteValidationError(w, r, fmt.Sprintf("%s: %v", component, err))
+				return
+			}
+		}
+	}
+
+	if req.ResetComponents {
+		levels.ResetComponents()
+	}
+	if req.Level != "" {
+		_ = levels.SetLevel(req.Level)
+	}
+	for component, level := range req.Components {
+		_ = levels.SetComponentLevel(component, level)
+	}
+
+	settings := LoggingSettings{Level: levels.Level(), Components: levels.ComponentLevels()}
+	h.logger.WithFields(map[string]any{
+		"level":      settings.Level,
+		"components": settings.Components,
+		"component":  "admin",
+	}).Warn("Log levels changed")
+	h.responseWriter().WriteSuccess(w, r, settings)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// StartDebugTrace handles POST /api/v1/devices/{id}/debug/trace. It starts
+// recording the device's HTTP/RPC exchanges, discarding any earlier trace.
+// Traces can hold device configuration, so all trace routes are admin only.
+func (h *Handler) StartDebugTrace(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.debugTraceDeviceID(w, r)
+	if !ok {
+		return
+	}
+	var req service.DebugTraceRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+			return
+		}
+	}
+
+	trace, err := h.Service.StartDebugTrace(id, req)
+	if err != nil {
+		h.writeDebugTraceError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteCreated(w, r, trace)
+}
+
+// GetDebugTrace handles GET /api/v1/devices/{id}/debug/trace
+func (h *Handler) GetDebugTrace(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.debugTraceDeviceID(w, r)
+	if !ok {
+		return
+	}
+	trace, err := h.Service.GetDebugTrace(id)
+	if err != nil {
+		h.writeDebugTraceError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, trace)
+}
+
+// StopDebugTrace handles DELETE /api/v1/devices/{id}/debug/trace
+func (h *Handler) StopDebugTrace(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.debugTraceDeviceID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Service.StopDebugTrace(id); err != nil {
+		h.writeDebugTraceError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"device_id": id, "stopped": true})
+}
+
+func (h *Handler) debugTraceDeviceID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *Handler) writeDebugTraceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrDeviceNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Device")
+	case errors.Is(err, service.ErrTraceNotEnabled):
+		h.responseWriter().WriteNotFoundError(w, r, "Debug trace")
+	case errors.Is(err, service.ErrInvalidTraceRequest):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
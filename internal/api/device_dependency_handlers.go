@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// ListDeviceDependencies handles GET /api/v1/devices/dependencies
+func (h *Handler) ListDeviceDependencies(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.Service.ListDeviceDependencies()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"dependencies": deps,
+		"count":        len(deps),
+	})
+}
+
+// AddDeviceDependency handles POST /api/v1/devices/dependencies with
+// {"device_id", "upstream_id", "note"}: the device reaches the network
+// through, or is powered by, the upstream device
+func (h *Handler) AddDeviceDependency(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		DeviceID   uint   `json:"device_id"`
+		UpstreamID uint   `json:"upstream_id"`
+		Note       string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	dep, err := h.Service.AddDeviceDependency(req.DeviceID, req.UpstreamID, req.Note)
+	if err != nil {
+		h.writeDependencyError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteCreated(w, r, dep)
+}
+
+// RemoveDeviceDependency handles DELETE /api/v1/devices/dependencies/{id}
+func (h *Handler) RemoveDeviceDependency(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid dependency ID", nil)
+		return
+	}
+	if err := h.Service.RemoveDeviceDependency(uint(id)); err != nil {
+		h.writeDependencyError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"deleted": id})
+}
+
+// SyncExtenderDependencies handles POST
+// /api/v1/devices/dependencies/sync-extenders. It reads the range extender
+// topology and records every bridged device as depending on its extender.
+func (h *Handler) SyncExtenderDependencies(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	result, err := h.Service.SyncExtenderDependencies(r.Context())
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, result)
+}
+
+// GetDependencyOrder handles POST /api/v1/devices/dependencies/order with
+// {"device_ids"}. It returns the devices in waves, upstream devices after
+// the devices depending on them, for tools running their own rollouts.
+func (h *Handler) GetDependencyOrder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DeviceIDs []uint `json:"device_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if len(req.DeviceIDs) == 0 {
+		h.responseWriter().WriteValidationError(w, r, "device_ids is required")
+		return
+	}
+	waves, err := h.Service.DependencyWaves(req.DeviceIDs)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"waves": waves})
+}
+
+// writeDependencyError maps device dependency errors to responses
+func (h *Handler) writeDependencyError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrDependencyNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Device dependency")
+	case errors.Is(err, service.ErrDeviceNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Device")
+	case errors.Is(err, service.ErrInvalidDependency):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
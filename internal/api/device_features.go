@@ -0,0 +1,37 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// deviceView is a device as returned by the API, with the operations it
+// supports so clients can hide controls that do not apply. The list is
+// omitted for models the registry does not know.
+type deviceView struct {
+	database.Device
+	SupportedOperations []string `json:"supported_operations,omitempty"`
+}
+
+// newDeviceView computes the supported operations of a device
+func newDeviceView(device *database.Device) deviceView {
+	view := deviceView{Device: *device}
+	if ops, known := service.DeviceOperations(device); known {
+		view.SupportedOperations = ops
+	}
+	return view
+}
+
+// writeUnsupported answers 422 UNSUPPORTED_CAPABILITY when err refuses an
+// operation the device does not support, and reports whether it did
+func (h *Handler) writeUnsupported(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, service.ErrUnsupportedCapability) {
+		return false
+	}
+	h.responseWriter().WriteError(w, r, http.StatusUnprocessableEntity, apiresp.ErrCodeUnsupported, err.Error(), nil)
+	return true
+}
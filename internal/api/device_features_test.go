@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestDeviceSupportedOperations(t *testing.T) {
+	h, db := newTestHandler(t)
+	sensor := &database.Device{IP: "10.0.0.20", MAC: "AA0000000020", Type: "SHHT-1", Name: "Attic",
+		Status: "online", Settings: `{"model":"SHHT-1","gen":1}`}
+	dimmer := &database.Device{IP: "10.0.0.21", MAC: "AA0000000021", Type: "SHDM-2", Name: "Hall",
+		Status: "online", Settings: `{"model":"SHDM-2","gen":1}`}
+	for _, d := range []*database.Device{sensor, dimmer} {
+		require.NoError(t, db.AddDevice(d))
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/devices/"+strconv.Itoa(int(dimmer.ID)), nil),
+		map[string]string{"id": strconv.Itoa(int(dimmer.ID))})
+	w := httptest.NewRecorder()
+	h.GetDevice(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var env struct {
+		Data struct {
+			Name                string   `json:"name"`
+			SupportedOperations []string `json:"supported_operations"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &env))
+	assert.Equal(t, "Hall", env.Data.Name)
+	assert.Equal(t, []string{"dimming", "power_metering", "schedules"}, env.Data.SupportedOperations)
+
+	// Switching a sensor is refused before the device is contacted
+	req = mux.SetURLVars(httptest.NewRequest("POST", "/api/v1/devices/"+strconv.Itoa(int(sensor.ID))+"/control",
+		strings.NewReader(`{"action":"on"}`)), map[string]string{"id": strconv.Itoa(int(sensor.ID))})
+	w = httptest.NewRecorder()
+	h.ControlDevice(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "UNSUPPORTED_CAPABILITY")
+}
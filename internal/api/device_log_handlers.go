@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// GetDeviceLogs handles GET /api/v1/devices/{id}/logs. It returns the most
+// recent debug log lines the device streamed, oldest first, filtered by
+// since and until (RFC 3339), level (the minimum severity), q (a substring
+// of the message) and limit. Debug logs can carry credentials and network
+// details, so reading them requires admin like streaming does.
+func (h *Handler) GetDeviceLogs(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.deviceLogID(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	q := service.DeviceLogQuery{Level: query.Get("level"), Search: query.Get("q")}
+	for name, target := range map[string]**time.Time{"since": &q.Since, "until": &q.Until} {
+		if raw := query.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				h.responseWriter().WriteValidationError(w, r, name+" must be an RFC 3339 time")
+				return
+			}
+			*target = &t
+		}
+	}
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			h.responseWriter().WriteValidationError(w, r, "limit must be a positive integer")
+			return
+		}
+		q.Limit = n
+	}
+
+	status, err := h.Service.DeviceLogStatus(id)
+	if errors.Is(err, service.ErrDeviceNotFound) {
+		h.responseWriter().WriteNotFoundError(w, r, "Device")
+		return
+	}
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	logs, err := h.Service.DeviceLogs(id, q)
+	if errors.Is(err, service.ErrInvalidDeviceLogQuery) {
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+		return
+	}
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"device_id": id,
+		"streaming": status.Streaming,
+		"stored":    status.Stored,
+		"count":     len(logs),
+		"logs":      logs,
+	})
+}
+
+// SetDeviceLogStreaming handles POST /api/v1/devices/{id}/logs/stream. Body:
+// {"enable": true}. The device's debug log is sent to device_logs.address.
+func (h *Handler) SetDeviceLogStreaming(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.deviceLogID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Enable bool `json:"enable"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	status, err := h.Service.SetDeviceLogStreaming(r.Context(), id, req.Enable)
+	if err != nil {
+		h.writeDeviceLogError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, status)
+}
+
+// deviceLogID parses the device ID path variable
+func (h *Handler) deviceLogID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *Handler) writeDeviceLogError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrDeviceNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Device")
+	case errors.Is(err, service.ErrDeviceLogsDisabled):
+		h.responseWriter().WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConfigurationError, err.Error(), nil)
+	case errors.Is(err, service.ErrDeviceLogsUnsupported):
+		h.responseWriter().WriteError(w, r, http.StatusUnprocessableEntity, apiresp.ErrCodeUnsupported, err.Error(), nil)
+	default:
+		h.responseWriter().WriteError(w, r, http.StatusBadGateway, apiresp.ErrCodeDeviceOffline, err.Error(), nil)
+	}
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+// TestGetDeviceLogs_RequiresAdmin checks that streamed debug logs, which can
+// carry credentials, are only returned with the admin key
+func TestGetDeviceLogs_RequiresAdmin(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+	require.NoError(t, db.AddDevice(&database.Device{IP: "192.0.2.30", MAC: "AABBCCDDEE30", Name: "plug"}))
+
+	h := NewHandlerWithLogger(db, testShellyService(t, db), nil, nil, logger)
+	h.SetAdminAPIKey("logs-secret")
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/devices/{id}/logs", h.GetDeviceLogs).Methods("GET")
+
+	for key, want := range map[string]int{"": http.StatusUnauthorized, "logs-secret": http.StatusOK} {
+		req := httptest.NewRequest("GET", "/api/v1/devices/1/logs", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		assert.Equal(t, want, rr.Code, "key %q: %s", key, rr.Body.String())
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/notification"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// overviewEventLimit bounds the recent config changes and notifications
+// included in a device overview
+const overviewEventLimit = 10
+
+// DeviceOverview aggregates what the device page needs in one response. Each
+// section is filled independently; a section that could not be loaded is nil
+// and its error is listed in Errors.
+type DeviceOverview struct {
+	Device       interface{}                        `json:"device"`
+	Status       map[string]interface{}             `json:"status"`
+	ConfigSync   *configuration.ImportStatus        `json:"config_sync"`
+	Drift        *DeviceOverviewDrift               `json:"drift"`
+	ConfigEvents []configuration.ConfigHistory      `json:"config_events"`
+	Alerts       []notification.NotificationHistory `json:"alerts"`
+	Reboots      *service.RebootStatus              `json:"reboots"`
+	Maintenance  *service.MaintenanceWindow         `json:"maintenance"` // nil when not in maintenance
+	Metrics      interface{}                        `json:"metrics"`
+	Errors       map[string]string                  `json:"errors,omitempty"`
+}
+
+// DeviceOverviewDrift summarises the latest drift report for the device
+type DeviceOverviewDrift struct {
+	ReportID    uint                       `json:"report_id"`
+	GeneratedAt time.Time                  `json:"generated_at"`
+	Summary     configuration.DriftSummary `json:"summary"`
+}
+
+// GetDeviceOverview handles GET /api/v1/devices/{id}/overview. It returns the
+// device record, live status, config sync state, latest drift summary, recent
+// events and an energy snapshot in a single round-trip. Live device calls run
+// concurrently and a failing section does not fail the response.
+func (h *Handler) GetDeviceOverview(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+	deviceID := uint(id)
+
+	device, err := h.DB.GetDevice(deviceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+		} else {
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+
+	overview := DeviceOverview{Device: device, Errors: map[string]string{}}
+	var mu sync.Mutex
+	fail := func(section string, err error) {
+		mu.Lock()
+		overview.Errors[section] = err.Error()
+		mu.Unlock()
+	}
+
+	// Live device calls are the slow part; run them alongside the DB queries
+	var wg sync.WaitGroup
+	if h.Service != nil {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			status, err := h.Service.GetDeviceStatusContext(r.Context(), deviceID)
+			if err != nil {
+				fail("status", overviewError(err))
+				return
+			}
+			mu.Lock()
+			overview.Status = status
+			mu.Unlock()
+		}()
+		go func() {
+			defer wg.Done()
+			energy, err := h.Service.GetDeviceEnergyContext(r.Context(), deviceID, 0)
+			if err != nil {
+				fail("metrics", overviewError(err))
+				return
+			}
+			mu.Lock()
+			overview.Metrics = energy
+			mu.Unlock()
+		}()
+	}
+
+	if h.ConfigService != nil {
+		if status, err := h.ConfigService.GetImportStatus(deviceID); err != nil {
+			fail("config_sync", err)
+		} else {
+			overview.ConfigSync = status
+		}
+
+		if reports, err := h.ConfigService.GetDriftReports("", &deviceID, 1); err != nil {
+			fail("drift", err)
+		} else if len(reports) > 0 {
+			overview.Drift = &DeviceOverviewDrift{
+				ReportID:    reports[0].ID,
+				GeneratedAt: reports[0].GeneratedAt,
+				Summary:     reports[0].Summary,
+			}
+		}
+
+		if history, err := h.ConfigService.GetConfigHistory(deviceID, overviewEventLimit); err != nil {
+			fail("config_events", err)
+		} else {
+			overview.ConfigEvents = history
+		}
+	}
+
+	if db := h.DB.GetDB(); db != nil {
+		var alerts []notification.NotificationHistory
+		if err := db.Where("device_id = ?", deviceID).Order("created_at DESC").Limit(overviewEventLimit).Find(&alerts).Error; err != nil {
+			fail("alerts", err)
+		} else {
+			overview.Alerts = alerts
+		}
+	}
+
+	if h.Service != nil {
+		if reboots, err := h.Service.DeviceRebootStatus(deviceID); err != nil {
+			fail("reboots", err)
+		} else {
+			overview.Reboots = reboots
+		}
+		if maintenance, err := h.Service.DeviceMaintenance(deviceID); err != nil {
+			fail("maintenance", err)
+		} else {
+			overview.Maintenance = maintenance
+		}
+	}
+
+	wg.Wait()
+	if len(overview.Errors) == 0 {
+		overview.Errors = nil
+	}
+	h.responseWriter().WriteSuccess(w, r, overview)
+}
+
+// overviewError shortens the offline error for the overview error list
+func overviewError(err error) error {
+	if errors.Is(err, service.ErrDeviceOffline) {
+		return service.ErrDeviceOffline
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestGetDeviceOverview_PartialFailure(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	svc := testShellyService(t, db)
+	notificationHandler := testNotificationHandler(t, db)
+	handler := NewHandlerWithLogger(db, svc, notificationHandler, nil, logging.GetDefault())
+
+	// An offline device fails the live sections without touching the network
+	device := testutil.TestDevice()
+	device.Status = "offline"
+	device.LastSeen = time.Now().Add(-time.Hour)
+	testutil.AssertNoError(t, db.AddDevice(device))
+	now := time.Now()
+	testutil.AssertNoError(t, db.GetDB().Create(&database.DeviceReboot{DeviceID: device.ID, BootedAt: now, DetectedAt: now}).Error)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/v1/devices/%d/overview", device.ID), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(device.ID))})
+	w := httptest.NewRecorder()
+	handler.GetDeviceOverview(w, req)
+
+	testutil.AssertEqual(t, http.StatusOK, w.Code)
+	var wrap struct {
+		Data struct {
+			Device     map[string]interface{} `json:"device"`
+			Status     map[string]interface{} `json:"status"`
+			ConfigSync map[string]interface{} `json:"config_sync"`
+			Reboots    map[string]interface{} `json:"reboots"`
+			Errors     map[string]string      `json:"errors"`
+		} `json:"data"`
+	}
+	testutil.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &wrap))
+	testutil.AssertEqual[interface{}](t, float64(device.ID), wrap.Data.Device["id"])
+	testutil.AssertEqual[interface{}](t, "not_imported", wrap.Data.ConfigSync["status"])
+	testutil.AssertEqual[interface{}](t, float64(1), wrap.Data.Reboots["reboots_24h"])
+	if wrap.Data.Status != nil {
+		t.Errorf("Expected no status for an offline device, got %v", wrap.Data.Status)
+	}
+	if wrap.Data.Errors["status"] == "" || wrap.Data.Errors["metrics"] == "" {
+		t.Errorf("Expected status and metrics errors, got %v", wrap.Data.Errors)
+	}
+}
+
+func TestGetDeviceOverview_NotFound(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	handler := NewHandlerWithLogger(db, testShellyService(t, db), testNotificationHandler(t, db), nil, logging.GetDefault())
+
+	req := httptest.NewRequest("GET", "/api/v1/devices/999/overview", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "999"})
+	w := httptest.NewRecorder()
+	handler.GetDeviceOverview(w, req)
+
+	testutil.AssertEqual(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// DeviceProfileRequest asks for a device profile switch
+type DeviceProfileRequest struct {
+	Profile string `json:"profile"`
+	Confirm bool   `json:"confirm"`
+}
+
+// SetDeviceProfile handles POST /api/v1/devices/{id}/profile. Without
+// confirm the response only shows the operations the device would gain and
+// lose; with it the device is switched and its configuration re-imported.
+func (h *Handler) SetDeviceProfile(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+	var req DeviceProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if req.Profile == "" {
+		h.responseWriter().WriteValidationError(w, r, "profile is required")
+		return
+	}
+
+	change, err := h.Service.SetDeviceProfile(r.Context(), uint(id), req.Profile, req.Confirm)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDeviceNotFound):
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+		case errors.Is(err, service.ErrProfileUnsupported):
+			h.responseWriter().WriteError(w, r, http.StatusUnprocessableEntity, apiresp.ErrCodeUnsupported, err.Error(), nil)
+		case errors.Is(err, service.ErrDeviceNotResponding):
+			h.responseWriter().WriteError(w, r, http.StatusBadGateway, apiresp.ErrCodeDeviceOffline, err.Error(), nil)
+		default:
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, change)
+}
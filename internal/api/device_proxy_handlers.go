@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// maxProxyRequestBody caps the body forwarded to a device
+const maxProxyRequestBody = 1 << 20
+
+// ProxyDevice handles GET/POST /api/v1/devices/{id}/proxy/{path}. It
+// forwards the request to the device with the server's credentials for it
+// and returns the device's response unchanged, so the web UI can show pages
+// hosted by devices it cannot reach itself. Device pages can hold
+// configuration, so the proxy is admin only.
+func (h *Handler) ProxyDevice(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+
+	var body []byte
+	if r.Method == http.MethodPost {
+		body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxProxyRequestBody))
+		if err != nil {
+			h.responseWriter().WriteError(w, r, http.StatusRequestEntityTooLarge, apiresp.ErrCodeRequestTooLarge, "Request body too large", nil)
+			return
+		}
+	}
+
+	resp, err := h.Service.ProxyDeviceRequest(r.Context(), uint(id), service.DeviceProxyRequest{
+		Method:      r.Method,
+		Path:        vars["path"],
+		RawQuery:    r.URL.RawQuery,
+		Body:        body,
+		ContentType: r.Header.Get("Content-Type"),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDeviceNotFound):
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+		case errors.Is(err, service.ErrProxyDisabled), errors.Is(err, service.ErrProxyPathNotAllowed):
+			h.responseWriter().WriteError(w, r, http.StatusForbidden, apiresp.ErrCodeForbidden, err.Error(), nil)
+		case errors.Is(err, service.ErrProxyUnsupported):
+			h.responseWriter().WriteError(w, r, http.StatusUnprocessableEntity, apiresp.ErrCodeUnsupported, err.Error(), nil)
+		case errors.Is(err, service.ErrDeviceNotResponding), errors.Is(err, service.ErrProxyResponseTooLarge):
+			h.responseWriter().WriteError(w, r, http.StatusBadGateway, apiresp.ErrCodeDeviceOffline, err.Error(), nil)
+		default:
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+
+	// Device pages are served from the API's origin; the sandbox keeps their
+	// scripts away from the UI's storage and credentials
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(resp.Body)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// DeviceRefreshResponse reports a device refresh with the capabilities that
+// follow from the refreshed model and generation
+type DeviceRefreshResponse struct {
+	*service.DeviceRefresh
+	Capabilities []string `json:"capabilities"`
+	// ConfigValidation checks the stored configuration's typed sections
+	// against the refreshed capabilities; absent without a stored config
+	ConfigValidation *configuration.ValidationResult `json:"config_validation,omitempty"`
+}
+
+// RefreshDevice handles POST /api/v1/devices/{id}/refresh. The device is
+// re-probed and its settings, type and firmware are updated; the stored
+// configuration is then validated against the capabilities of the
+// refreshed model and generation.
+func (h *Handler) RefreshDevice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+
+	refresh, err := h.Service.RefreshDevice(r.Context(), uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDeviceNotFound):
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+		case errors.Is(err, service.ErrDeviceNotResponding):
+			h.responseWriter().WriteError(w, r, http.StatusBadGateway, apiresp.ErrCodeDeviceOffline, err.Error(), nil)
+		case errors.Is(err, service.ErrDeviceMismatch):
+			h.responseWriter().WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict, err.Error(), nil)
+		default:
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+
+	device := refresh.Device
+	var settings struct {
+		Model string `json:"model"`
+	}
+	_ = json.Unmarshal([]byte(device.Settings), &settings)
+	model := settings.Model
+	if model == "" {
+		model = device.Type
+	}
+	generation := service.SettingsGeneration(device.Settings)
+	response := DeviceRefreshResponse{
+		DeviceRefresh: refresh,
+		Capabilities:  profileCapabilities(h.getDeviceCapabilities(model, generation), device.Profile),
+	}
+
+	if stored, err := h.Service.GetDeviceConfig(device.ID); err == nil && len(stored.Config) > 0 {
+		if typed, _, err := h.convertToTypedConfig(stored.Config, device); err == nil {
+			response.ConfigValidation = h.Service.ConfigSvc.ValidateTypedConfiguration(typed,
+				configuration.ValidationLevelBasic, model, generation, response.Capabilities)
+		}
+	}
+
+	h.responseWriter().WriteSuccess(w, r, response)
+}
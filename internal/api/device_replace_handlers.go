@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// ReplaceDevice handles POST /api/v1/devices/{id}/replace. The Gen1 device
+// {id} is replaced by the Gen2 device in new_device_id: its stored
+// configuration is translated and applied there, and its name and tags are
+// carried over. With dry_run only the translation is returned.
+func (h *Handler) ReplaceDevice(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+	var req service.DeviceReplaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+
+	result, err := h.Service.ReplaceDevice(r.Context(), uint(id), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDeviceNotFound):
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+		case errors.Is(err, service.ErrInvalidReplacement):
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+		default:
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, result)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// GetDeviceSheet handles GET /api/v1/devices/sheet. The sheet lists id,
+// version, name, group, tags and room of every device, for editing in a
+// spreadsheet and importing back; format=json returns the rows as JSON.
+func (h *Handler) GetDeviceSheet(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.Service.DeviceSheet()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"devices-%s.csv\"", time.Now().Format("20060102")))
+		if err := service.WriteDeviceSheetCSV(w, rows); err != nil {
+			h.logger.WithFields(map[string]any{
+				"error":     err.Error(),
+				"component": "api",
+			}).Warn("Failed to write device sheet")
+		}
+	case "json":
+		h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"devices": rows})
+	default:
+		h.responseWriter().WriteValidationError(w, r, "format must be csv or json")
+	}
+}
+
+// ImportDeviceSheet handles POST /api/v1/devices/sheet/import with body
+// {"csv": "...", "dry_run": true}. The response lists the changes; a sheet
+// with errors is not applied and answers 422 with the changes and errors.
+func (h *Handler) ImportDeviceSheet(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		CSV    string `json:"csv"`
+		DryRun bool   `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if strings.TrimSpace(req.CSV) == "" {
+		h.responseWriter().WriteValidationError(w, r, "csv content is required")
+		return
+	}
+
+	result, err := h.Service.ImportDeviceSheet(strings.NewReader(req.CSV), req.DryRun)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidDeviceSheet):
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+		case isVersionConflict(err):
+			h.responseWriter().WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict, err.Error(), nil)
+		default:
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+	if len(result.Errors) > 0 {
+		h.responseWriter().WriteError(w, r, http.StatusUnprocessableEntity, apiresp.ErrCodeValidationFailed,
+			"The device sheet was not applied", result)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, result)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// deviceSocketUpgrader accepts device connections; devices send no Origin
+// and authenticate with the token instead
+var deviceSocketUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// DeviceSocket handles GET /devices/ws, where Gen2 devices connect with
+// their outbound WebSocket. The connection stays open until the device or
+// the server closes it.
+func (h *Handler) DeviceSocket(w http.ResponseWriter, r *http.Request) {
+	if err := h.Service.AuthorizeDeviceSocket(r.URL.Query().Get("token")); err != nil {
+		if errors.Is(err, service.ErrDeviceSocketDisabled) {
+			h.responseWriter().WriteError(w, r, http.StatusNotFound, apiresp.ErrCodeNotFound, err.Error(), nil)
+			return
+		}
+		h.responseWriter().WriteError(w, r, http.StatusUnauthorized, apiresp.ErrCodeUnauthorized, "Invalid device token", nil)
+		return
+	}
+
+	conn, err := deviceSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.logger.WithFields(map[string]any{
+			"error":     err.Error(),
+			"component": "device_socket",
+		}).Error("Failed to upgrade device WebSocket connection")
+		return
+	}
+	// Matched against the device's IP, so proxy headers are not trusted
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	if err := h.Service.ServeDeviceSocket(conn, remoteIP); err != nil {
+		h.logger.WithFields(map[string]any{
+			"remote_ip": remoteIP,
+			"error":     err.Error(),
+			"component": "device_socket",
+		}).Warn("Rejected device WebSocket connection")
+	}
+}
+
+// GetDeviceSocket handles GET /api/v1/devices/{id}/socket
+func (h *Handler) GetDeviceSocket(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+	status, err := h.Service.GetDeviceSocketStatus(uint(id))
+	if err != nil {
+		h.writeDeviceSocketError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, status)
+}
+
+// ConfigureDeviceSocket handles POST /api/v1/devices/{id}/socket. Body:
+// {"enable": true}. The device is rebooted to apply the change.
+func (h *Handler) ConfigureDeviceSocket(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+	var req struct {
+		Enable bool `json:"enable"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if err := h.Service.ConfigureDeviceSocket(r.Context(), uint(id), req.Enable); err != nil {
+		h.writeDeviceSocketError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"device_id": id,
+		"enabled":   req.Enable,
+		"rebooting": true,
+	})
+}
+
+func (h *Handler) writeDeviceSocketError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrDeviceNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Device")
+	case errors.Is(err, service.ErrDeviceSocketDisabled):
+		h.responseWriter().WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConfigurationError, err.Error(), nil)
+	case errors.Is(err, service.ErrDeviceSocketUnsupported):
+		h.responseWriter().WriteError(w, r, http.StatusUnprocessableEntity, apiresp.ErrCodeUnsupported, err.Error(), nil)
+	default:
+		h.responseWriter().WriteError(w, r, http.StatusBadGateway, apiresp.ErrCodeDeviceOffline, err.Error(), nil)
+	}
+}
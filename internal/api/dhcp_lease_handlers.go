@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// ListDHCPLeaseCandidates handles GET /api/v1/discovery/dhcp-leases. It
+// reads the lease tables of the routers in discovery.dhcp_leases and returns
+// the leases that look like Shelly devices, without probing them.
+func (h *Handler) ListDHCPLeaseCandidates(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	report, err := h.Service.DHCPLeaseCandidates(r.Context())
+	if err != nil {
+		h.writeDHCPLeaseError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// ImportDHCPLeases handles POST /api/v1/discovery/dhcp-leases/import. The
+// lease address of every candidate not in the inventory is probed, and the
+// Shelly devices found are adopted like discovered ones.
+func (h *Handler) ImportDHCPLeases(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	report, err := h.Service.ImportDHCPLeases(r.Context())
+	if err != nil {
+		h.writeDHCPLeaseError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// writeDHCPLeaseError maps DHCP lease errors to responses
+func (h *Handler) writeDHCPLeaseError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrNoDHCPRouters) {
+		h.responseWriter().WriteError(w, r, http.StatusServiceUnavailable, apiresp.ErrCodeServiceUnavailable,
+			"No routers configured in discovery.dhcp_leases.routers", nil)
+		return
+	}
+	h.responseWriter().WriteInternalError(w, r, err)
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// RunPreflight handles POST /api/v1/diagnostics/preflight. It checks whether
+// the selected devices reach their gateway, MQTT broker and SNTP server and
+// returns the connectivity matrix with per-target totals.
+func (h *Handler) RunPreflight(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.PreflightRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+			return
+		}
+	}
+
+	report, err := h.Service.Preflight(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// GetClockSkewReport handles GET /api/v1/reports/clock-skew. It returns the
+// report from the latest metrics collection; refresh=true reads device clocks
+// now.
+func (h *Handler) GetClockSkewReport(w http.ResponseWriter, r *http.Request) {
+	report := h.Service.ClockSkew()
+	if report == nil || r.URL.Query().Get("refresh") == "true" {
+		var err error
+		if report, err = h.Service.CheckClockSkew(r.Context()); err != nil {
+			h.responseWriter().WriteInternalError(w, r, err)
+			return
+		}
+	}
+	flagged := []service.ClockSkewEntry{}
+	for _, e := range report.Devices {
+		if e.Flagged {
+			flagged = append(flagged, e)
+		}
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"report":          report,
+		"flagged_devices": flagged,
+	})
+}
+
+// RemediateClockSkew handles POST /api/v1/reports/clock-skew/remediate. It
+// pushes an SNTP server to the given devices, or to those flagged in the
+// latest report; with dry_run it only lists them.
+func (h *Handler) RemediateClockSkew(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.ClockSkewRemediation
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+			return
+		}
+	}
+
+	results, err := h.Service.CorrectClockSkew(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	failed := 0
+	for _, res := range results {
+		if res.Error != "" {
+			failed++
+		}
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"results": results,
+		"total":   len(results),
+		"failed":  failed,
+		"dry_run": req.DryRun,
+	})
+}
+
+// GetConfigLintReport handles GET /api/v1/reports/config-lint?tag=&min_severity=.
+// It lints the stored configuration of every device and returns the findings
+// with totals by severity and rule.
+func (h *Handler) GetConfigLintReport(w http.ResponseWriter, r *http.Request) {
+	req := service.ConfigLintRequest{
+		Tag:         r.URL.Query().Get("tag"),
+		MinSeverity: r.URL.Query().Get("min_severity"),
+	}
+	summary, err := h.Service.LintFleetConfig(req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidLintRequest) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, summary)
+}
+
+// SearchConfigs handles GET /api/v1/config/search?where=...&tag=. Each
+// where parameter is a condition such as mqtt.server!="10.0.0.5"; devices
+// whose stored configuration satisfies all of them are returned.
+func (h *Handler) SearchConfigs(w http.ResponseWriter, r *http.Request) {
+	req := service.ConfigSearchRequest{
+		Where: r.URL.Query()["where"],
+		Tag:   r.URL.Query().Get("tag"),
+	}
+	result, err := h.Service.SearchFleetConfig(req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidConfigSearch) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, result)
+}
+
+// PlanConfigReplace handles POST /api/v1/config/replace/plan. The plan
+// lists the devices and values that would change; nothing is changed until
+// it is applied.
+func (h *Handler) PlanConfigReplace(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.ConfigReplaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	plan, err := h.Service.PlanConfigReplace(req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidConfigReplace) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, plan)
+}
+
+// ApplyConfigReplace handles POST /api/v1/config/replace/apply with the
+// plan_id of a reviewed plan, staging its changes for export
+func (h *Handler) ApplyConfigReplace(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		PlanID string `json:"plan_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PlanID == "" {
+		h.responseWriter().WriteValidationError(w, r, "plan_id is required")
+		return
+	}
+	outcome, err := h.Service.ApplyConfigReplace(req.PlanID)
+	if err != nil {
+		if errors.Is(err, service.ErrReplacePlanNotFound) {
+			h.responseWriter().WriteNotFoundError(w, r, "Replace plan")
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, outcome)
+}
+
+// GetDeviceConfigLint handles GET /api/v1/devices/{id}/config/lint. The
+// findings are best-practice warnings and do not affect validation.
+func (h *Handler) GetDeviceConfigLint(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+	report, err := h.Service.LintDeviceConfig(uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// GetRebootReport handles GET /api/v1/reports/reboots. It lists the devices
+// that rebooted unexpectedly in the last 24 hours and flags those above
+// metrics.reboot_threshold as flapping.
+func (h *Handler) GetRebootReport(w http.ResponseWriter, r *http.Request) {
+	report, err := h.Service.RebootReport()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// GetDeviceReboots handles GET /api/v1/devices/{id}/reboots with the
+// device's reboot history, newest first, and whether it is flapping
+func (h *Handler) GetDeviceReboots(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+	deviceID := uint(id)
+	if _, err := h.DB.GetDevice(deviceID); err != nil {
+		h.responseWriter().WriteNotFoundError(w, r, "Device")
+		return
+	}
+	limit := parseIntDefault(r.URL.Query().Get("limit"), 50)
+
+	status, err := h.Service.DeviceRebootStatus(deviceID)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	reboots, err := h.Service.DeviceReboots(deviceID, limit)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"status":  status,
+		"reboots": reboots,
+	})
+}
+
+// GetProtectionReport handles GET /api/v1/reports/protection-trips. It lists
+// the devices that tripped overpower, overtemperature or other protections
+// in the last ?days (default 30) and flags those with at least ?min_trips
+// (default 3) trips, which likely need a larger relay.
+func (h *Handler) GetProtectionReport(w http.ResponseWriter, r *http.Request) {
+	days := parseIntDefault(r.URL.Query().Get("days"), 0)
+	minTrips := parseIntDefault(r.URL.Query().Get("min_trips"), 0)
+	report, err := h.Service.ProtectionReport(days, minTrips)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// GetDeviceProtectionTrips handles GET /api/v1/devices/{id}/protection-trips
+// with the device's protection trips and the values measured, newest first
+func (h *Handler) GetDeviceProtectionTrips(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+	deviceID := uint(id)
+	if _, err := h.DB.GetDevice(deviceID); err != nil {
+		h.responseWriter().WriteNotFoundError(w, r, "Device")
+		return
+	}
+	limit := parseIntDefault(r.URL.Query().Get("limit"), 50)
+
+	trips, err := h.Service.DeviceProtectionTrips(deviceID, limit)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"device_id": deviceID,
+		"trips":     trips,
+	})
+}
+
+// GetRangeExtenderTopology handles GET /api/v1/reports/range-extenders. It
+// reads every online Gen2+ device and returns the range extenders with
+// their clients and the inventory devices bridged through each.
+func (h *Handler) GetRangeExtenderTopology(w http.ResponseWriter, r *http.Request) {
+	topology, err := h.Service.RangeExtenderTopology(r.Context())
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, topology)
+}
+
+// GetDeviceRangeExtender handles GET /api/v1/devices/{id}/range-extender
+// with the device's access point and range extender state and the stations
+// connected to it
+func (h *Handler) GetDeviceRangeExtender(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+	status, err := h.Service.DeviceRangeExtender(r.Context(), uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDeviceNotFound):
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+		case errors.Is(err, service.ErrRangeExtenderUnsupported):
+			h.responseWriter().WriteError(w, r, http.StatusUnprocessableEntity, apiresp.ErrCodeUnsupported, err.Error(), nil)
+		case errors.Is(err, service.ErrDeviceNotResponding):
+			h.responseWriter().WriteError(w, r, http.StatusBadGateway, apiresp.ErrCodeDeviceOffline, err.Error(), nil)
+		default:
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, status)
+}
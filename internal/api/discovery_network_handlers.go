@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// ListDiscoveryNetworks handles GET /api/v1/discovery/networks
+func (h *Handler) ListDiscoveryNetworks(w http.ResponseWriter, r *http.Request) {
+	networks := h.Service.DiscoveryNetworks()
+	if networks == nil {
+		networks = []config.DiscoveryNetwork{}
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"networks": networks,
+		"count":    len(networks),
+	})
+}
+
+// ReplaceDiscoveryNetworks handles PUT /api/v1/discovery/networks. It
+// replaces every network until the next restart.
+func (h *Handler) ReplaceDiscoveryNetworks(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		Networks []config.DiscoveryNetwork `json:"networks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if err := h.Service.SetDiscoveryNetworks(req.Networks); err != nil {
+		h.writeDiscoveryNetworkError(w, r, err)
+		return
+	}
+	h.ListDiscoveryNetworks(w, r)
+}
+
+// AddDiscoveryNetwork handles POST /api/v1/discovery/networks
+func (h *Handler) AddDiscoveryNetwork(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var network config.DiscoveryNetwork
+	if err := json.NewDecoder(r.Body).Decode(&network); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if err := h.Service.AddDiscoveryNetwork(network); err != nil {
+		h.writeDiscoveryNetworkError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteCreated(w, r, network)
+}
+
+// UpdateDiscoveryNetwork handles PUT /api/v1/discovery/networks/{cidr}. The
+// body replaces the network's options; without a cidr it keeps its CIDR.
+func (h *Handler) UpdateDiscoveryNetwork(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	cidr := mux.Vars(r)["cidr"]
+	var network config.DiscoveryNetwork
+	if err := json.NewDecoder(r.Body).Decode(&network); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if network.CIDR == "" {
+		network.CIDR = cidr
+	}
+	if err := h.Service.UpdateDiscoveryNetwork(cidr, network); err != nil {
+		h.writeDiscoveryNetworkError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, network)
+}
+
+// RemoveDiscoveryNetwork handles DELETE /api/v1/discovery/networks/{cidr}
+func (h *Handler) RemoveDiscoveryNetwork(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	cidr := mux.Vars(r)["cidr"]
+	if err := h.Service.RemoveDiscoveryNetwork(cidr); err != nil {
+		h.writeDiscoveryNetworkError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"deleted": cidr})
+}
+
+// writeDiscoveryNetworkError maps discovery network errors to responses
+func (h *Handler) writeDiscoveryNetworkError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrDiscoveryNetworkNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Discovery network")
+	case errors.Is(err, service.ErrDiscoveryNetworkExists):
+		h.responseWriter().WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict, err.Error(), nil)
+	case errors.Is(err, service.ErrInvalidDiscoveryNetwork):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// CompareEnergy handles GET /api/v1/energy/compare. The current side names
+// one subject (device, tag or group) and a period (period, or from and to);
+// the baseline takes the same parameters prefixed with compare_. Without a
+// baseline the subject is compared with its previous period. interval sets
+// the bucket size (hour, day or month) and tz the time zone of calendar
+// periods and dates.
+func (h *Handler) CompareEnergy(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := service.EnergyCompareRequest{Interval: query.Get("interval"), Location: time.Local}
+	if tz := query.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			h.responseWriter().WriteValidationError(w, r, "tz must be an IANA time zone")
+			return
+		}
+		req.Location = loc
+	}
+	var msg string
+	if req.Current, msg = energyCompareSide(query, "", req.Location); msg != "" {
+		h.responseWriter().WriteValidationError(w, r, msg)
+		return
+	}
+	if req.Baseline, msg = energyCompareSide(query, "compare_", req.Location); msg != "" {
+		h.responseWriter().WriteValidationError(w, r, msg)
+		return
+	}
+
+	cmp, err := h.Service.CompareEnergy(req)
+	switch {
+	case errors.Is(err, service.ErrInvalidEnergyComparison):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	case errors.Is(err, service.ErrDeviceNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Device")
+	case errors.Is(err, service.ErrEnergySubjectNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Energy comparison subject")
+	case err != nil:
+		h.responseWriter().WriteInternalError(w, r, err)
+	default:
+		h.responseWriter().WriteSuccess(w, r, cmp)
+	}
+}
+
+// energyCompareSide reads one side of an energy comparison from the query
+// parameters with prefix. Dates are RFC 3339 times or YYYY-MM-DD days in loc.
+func energyCompareSide(query url.Values, prefix string, loc *time.Location) (service.EnergyCompareSide, string) {
+	side := service.EnergyCompareSide{
+		Subject: service.EnergySubject{Tag: query.Get(prefix + "tag"), Group: query.Get(prefix + "group")},
+		Period:  query.Get(prefix + "period"),
+	}
+	if raw := query.Get(prefix + "device"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil || id == 0 {
+			return side, prefix + "device must be a device ID"
+		}
+		side.Subject.DeviceID = uint(id)
+	}
+	for name, target := range map[string]*time.Time{prefix + "from": &side.From, prefix + "to": &side.To} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			if t, err = time.ParseInLocation(time.DateOnly, raw, loc); err != nil {
+				return side, name + " must be an RFC 3339 time or a YYYY-MM-DD date"
+			}
+		}
+		*target = t
+	}
+	if side.Period != "" && (!side.From.IsZero() || !side.To.IsZero()) {
+		return side, prefix + "period cannot be combined with " + prefix + "from and " + prefix + "to"
+	}
+	return side, ""
+}
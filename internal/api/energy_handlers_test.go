@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestCompareEnergy(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	svc := testShellyService(t, db)
+	handler := NewHandlerWithLogger(db, svc, nil, nil, logging.GetDefault())
+
+	device := &database.Device{IP: "192.0.2.10", MAC: "AABBCC000050", Name: "Oven"}
+	testutil.AssertNoError(t, db.AddDevice(device))
+	for day, wh := range map[int]float64{1: 200, 2: 300, 3: 250, 4: 150} {
+		usage := database.EnergyUsage{DeviceID: device.ID, Hour: time.Date(2026, 1, day, 18, 0, 0, 0, time.UTC), Wh: wh}
+		testutil.AssertNoError(t, db.GetDB().Create(&usage).Error)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/energy/compare?"+query, nil)
+		w := httptest.NewRecorder()
+		handler.CompareEnergy(w, req)
+		return w
+	}
+
+	// January 3-4 against the two days before
+	w := get("device=1&from=2026-01-03&to=2026-01-05&tz=UTC")
+	testutil.AssertEqual(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data struct {
+			Interval string `json:"interval"`
+			Points   []struct {
+				CurrentWh    float64 `json:"current_wh"`
+				BaselineWh   float64 `json:"baseline_wh"`
+				DeltaPercent float64 `json:"delta_percent"`
+			} `json:"points"`
+			Total struct {
+				CurrentWh    float64 `json:"current_wh"`
+				BaselineWh   float64 `json:"baseline_wh"`
+				DeltaPercent float64 `json:"delta_percent"`
+			} `json:"total"`
+		} `json:"data"`
+	}
+	testutil.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	testutil.AssertEqual(t, "day", resp.Data.Interval)
+	testutil.AssertEqual(t, 2, len(resp.Data.Points))
+	testutil.AssertEqual(t, 250.0, resp.Data.Points[0].CurrentWh)
+	testutil.AssertEqual(t, 200.0, resp.Data.Points[0].BaselineWh)
+	testutil.AssertEqual(t, 25.0, resp.Data.Points[0].DeltaPercent)
+	testutil.AssertEqual(t, 400.0, resp.Data.Total.CurrentWh)
+	testutil.AssertEqual(t, 500.0, resp.Data.Total.BaselineWh)
+	testutil.AssertEqual(t, -20.0, resp.Data.Total.DeltaPercent)
+
+	testutil.AssertEqual(t, http.StatusBadRequest, get("device=1&period=today&from=2026-01-03").Code)
+	testutil.AssertEqual(t, http.StatusBadRequest, get("device=1&period=today&tz=Mars/Olympus").Code)
+	testutil.AssertEqual(t, http.StatusBadRequest, get("period=today").Code)
+	testutil.AssertEqual(t, http.StatusNotFound, get("device=99&period=today").Code)
+	testutil.AssertEqual(t, http.StatusNotFound, get("tag=room:attic&period=today").Code)
+}
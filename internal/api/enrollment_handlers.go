@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// maxEnrollmentBody bounds the device info an enrolling device sends
+const maxEnrollmentBody = 8 << 10
+
+// Enroll handles POST /enroll, where a provisioned device presents the
+// one-time token of its provisioning task. Devices send no API key; the
+// token authenticates them. The device is adopted, the task's configuration
+// template applied and the task marked confirmed.
+func (h *Handler) Enroll(w http.ResponseWriter, r *http.Request) {
+	if h.Service == nil {
+		h.responseWriter().WriteError(w, r, http.StatusNotFound, apiresp.ErrCodeNotFound, service.ErrEnrollmentDisabled.Error(), nil)
+		return
+	}
+	var req service.EnrollmentRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxEnrollmentBody)).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	// Proxy headers are not trusted: the device's own address is wanted
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+
+	result, err := h.Service.Enroll(r.Context(), req, remoteIP)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrEnrollmentDisabled):
+			h.responseWriter().WriteError(w, r, http.StatusNotFound, apiresp.ErrCodeNotFound, err.Error(), nil)
+		case errors.Is(err, service.ErrEnrollmentUnauthorized):
+			h.logger.WithFields(map[string]any{
+				"remote_ip": remoteIP,
+				"mac":       req.MAC,
+				"error":     err.Error(),
+				"component": "enrollment",
+			}).Warn("Rejected device enrollment")
+			h.responseWriter().WriteError(w, r, http.StatusUnauthorized, apiresp.ErrCodeUnauthorized, "Invalid enrollment token", nil)
+		case errors.Is(err, service.ErrInvalidEnrollment):
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+		default:
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+
+	if result.TaskID != "" {
+		confirmProvisioningTask(result.TaskID, result.DeviceID)
+	}
+	h.responseWriter().WriteSuccess(w, r, result)
+}
+
+// withEnrollmentToken adds a one-time enrollment token to device
+// provisioning tasks, so the provisioned device can confirm the task itself.
+// The token is a task secret: it reaches the agent but no task listing.
+func (h *Handler) withEnrollmentToken(task *ProvisioningTask) {
+	if task.Type != "provision_device" || h.Service == nil || !h.Service.EnrollmentEnabled() {
+		return
+	}
+	ticket, err := h.Service.IssueEnrollmentToken(task.ID, task.DeviceMAC, postProvisionTemplateID(task.Config))
+	if err != nil {
+		h.logger.WithFields(map[string]any{
+			"task_id":   task.ID,
+			"error":     err.Error(),
+			"component": "enrollment",
+		}).Warn("Failed to issue enrollment token")
+		return
+	}
+	if task.Config == nil {
+		task.Config = map[string]interface{}{}
+	}
+	task.Config["enrollment_url"] = ticket.URL
+	setTaskSecret(task, "enrollment_token", ticket.Token)
+}
+
+// postProvisionTemplateID reads the configuration template a task template
+// or the task request set in the task configuration
+func postProvisionTemplateID(config map[string]interface{}) *uint {
+	var id uint
+	switch v := config["post_provision_template_id"].(type) {
+	case uint:
+		id = v
+	case int:
+		id = uint(max(v, 0))
+	case float64:
+		id = uint(max(v, 0))
+	}
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// confirmProvisioningTask marks a task confirmed by its enrolled device
+func confirmProvisioningTask(taskID string, deviceID uint) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if task, ok := registry.tasks[taskID]; ok {
+		task.Status = "confirmed"
+		task.DeviceID = deviceID
+		task.UpdatedAt = time.Now()
+	}
+}
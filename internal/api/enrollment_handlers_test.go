@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestEnroll_ConfirmsProvisioningTask(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	svc := testShellyService(t, db)
+	svc.Config.Enrollment = config.EnrollmentConfig{Enabled: true, URL: "http://manager.lan:8080/enroll"}
+	handler := NewHandlerWithLogger(db, svc, nil, nil, logging.GetDefault())
+
+	req := httptest.NewRequest("POST", "/api/v1/provisioner/tasks", bytes.NewReader([]byte(`{"type":"provision_device","device_mac":"AABBCC000041","target_ssid":"Home"}`)))
+	w := httptest.NewRecorder()
+	handler.CreateProvisioningTask(w, req)
+	testutil.AssertEqual(t, http.StatusCreated, w.Code)
+	var created struct {
+		Data struct {
+			TaskID string `json:"task_id"`
+		} `json:"data"`
+	}
+	testutil.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	registry.mu.RLock()
+	task := registry.tasks[created.Data.TaskID]
+	token, _ := task.Secrets["enrollment_token"].(string)
+	url := task.Config["enrollment_url"]
+	registry.mu.RUnlock()
+	testutil.AssertEqual(t, "http://manager.lan:8080/enroll", url)
+	if token == "" {
+		t.Fatalf("Expected an enrollment token in the task, got %v", task.Secrets)
+	}
+
+	// The token is kept out of the task listing
+	w = httptest.NewRecorder()
+	handler.GetProvisioningTasks(w, httptest.NewRequest("GET", "/api/v1/provisioner/tasks", nil))
+	testutil.AssertEqual(t, http.StatusOK, w.Code)
+	if bytes.Contains(w.Body.Bytes(), []byte(token)) {
+		t.Fatalf("Expected the enrollment token kept out of the task listing, got %s", w.Body.String())
+	}
+
+	enroll := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/enroll", bytes.NewReader([]byte(body)))
+		req.RemoteAddr = "10.0.0.41:51234"
+		w := httptest.NewRecorder()
+		handler.Enroll(w, req)
+		return w
+	}
+	body := `{"token":"` + token + `","id":"shellyplus1-aabbcc000041","mac":"AABBCC000041","model":"SNSW-001X16EU","gen":2,"ver":"1.4.0"}`
+	w = enroll(body)
+	testutil.AssertEqual(t, http.StatusOK, w.Code)
+
+	// The agent reporting completion afterwards keeps the task confirmed
+	statusReq := httptest.NewRequest("PUT", "/api/v1/provisioner/tasks/x/status", bytes.NewReader([]byte(`{"status":"completed"}`)))
+	statusReq = mux.SetURLVars(statusReq, map[string]string{"id": created.Data.TaskID})
+	handler.UpdateTaskStatus(httptest.NewRecorder(), statusReq)
+
+	registry.mu.RLock()
+	status, deviceID := task.Status, task.DeviceID
+	registry.mu.RUnlock()
+	testutil.AssertEqual(t, "confirmed", status)
+	device, err := db.GetDeviceByMAC("AABBCC000041")
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqual(t, device.ID, deviceID)
+	testutil.AssertEqual(t, "10.0.0.41", device.IP)
+
+	testutil.AssertEqual(t, http.StatusUnauthorized, enroll(body).Code)
+	testutil.AssertEqual(t, http.StatusBadRequest, enroll(`{"token":`).Code)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+// addExportStreamRoutes registers streamed exports and background export
+// jobs; they must precede the generic /export/{id} routes
+func (eh *SyncHandlers) addExportStreamRoutes(api *mux.Router) {
+	api.HandleFunc("/export/stream", eh.StreamExport).Methods("POST")
+	api.HandleFunc("/export/jobs", eh.ListExportJobs).Methods("GET")
+	api.HandleFunc("/export/jobs", eh.CreateExportJob).Methods("POST")
+	api.HandleFunc("/export/jobs/{id}", eh.GetExportJob).Methods("GET")
+}
+
+// StreamExport handles POST /api/v1/export/stream. The artifact is written
+// to the response as it is generated, using chunked transfer encoding, so
+// nothing is buffered or stored. The checksum and record count follow the
+// body as trailers.
+func (eh *SyncHandlers) StreamExport(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	var exportRequest sync.ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&exportRequest); err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "Invalid export request")
+		return
+	}
+	markAPIExport(&exportRequest)
+
+	fileName, err := eh.syncEngine.StreamFileName(exportRequest)
+	if err != nil {
+		eh.writeSyncError(w, r, err)
+		return
+	}
+
+	out := &startedWriter{w: w, start: func() {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+		setContentTypeForPath(w, fileName)
+		w.Header().Set("Trailer", "X-Export-Checksum, X-Export-Records")
+		w.WriteHeader(http.StatusOK)
+	}}
+	result, err := eh.syncEngine.ExportStream(r.Context(), exportRequest, out)
+	if result != nil {
+		_ = eh.syncEngine.SaveExportHistory(r.Context(), exportRequest, result, requesterFrom(r))
+	}
+	if err != nil {
+		if !out.started {
+			eh.writeSyncError(w, r, err)
+			return
+		}
+		// The status is already sent; the missing trailers tell the client
+		// the artifact is incomplete
+		eh.logger.Error("Streamed export aborted", "plugin", exportRequest.PluginName, "error", err)
+		return
+	}
+	if !out.started {
+		out.start()
+	}
+	w.Header().Set("X-Export-Checksum", "sha256:"+result.Checksum)
+	w.Header().Set("X-Export-Records", strconv.Itoa(result.RecordCount))
+}
+
+// startedWriter sends the response headers on the first write, so an export
+// failing before any output still gets a JSON error response
+type startedWriter struct {
+	w       http.ResponseWriter
+	start   func()
+	started bool
+}
+
+func (s *startedWriter) Write(b []byte) (int, error) {
+	if !s.started {
+		s.started = true
+		s.start()
+	}
+	return s.w.Write(b)
+}
+
+// CreateExportJob handles POST /api/v1/export/jobs. The export runs in the
+// background; poll GET /api/v1/export/jobs/{id} for its progress and
+// download the artifact through the export ID of its result.
+func (eh *SyncHandlers) CreateExportJob(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	var exportRequest sync.ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&exportRequest); err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "Invalid export request")
+		return
+	}
+	markAPIExport(&exportRequest)
+
+	job, err := eh.syncEngine.StartExportJob(r.Context(), exportRequest, requesterFrom(r))
+	if err != nil {
+		eh.writeSyncError(w, r, err)
+		return
+	}
+	eh.logger.WithFields(map[string]any{
+		"job_id":       job.ID,
+		"plugin":       job.PluginName,
+		"requested_by": job.RequestedBy,
+		"component":    "sync",
+	}).Info("Export job started via API")
+	apiresp.NewResponseWriter(eh.logger).WriteAccepted(w, r, job)
+}
+
+// ListExportJobs handles GET /api/v1/export/jobs
+func (eh *SyncHandlers) ListExportJobs(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, map[string]interface{}{
+		"jobs": eh.syncEngine.ListExportJobs(),
+	})
+}
+
+// GetExportJob handles GET /api/v1/export/jobs/{id}
+func (eh *SyncHandlers) GetExportJob(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	job, err := eh.syncEngine.GetExportJob(mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, sync.ErrExportJobNotFound) {
+			apiresp.NewResponseWriter(eh.logger).WriteNotFoundError(w, r, "Export job")
+			return
+		}
+		apiresp.NewResponseWriter(eh.logger).WriteInternalError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, job)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+// streamingPlugin streams a fixed body for the streaming endpoints
+type streamingPlugin struct{ mockSyncPlugin }
+
+func (streamingPlugin) Info() sync.PluginInfo {
+	return sync.PluginInfo{Name: "streaming", Version: "1.0.0", SupportedFormats: []string{"txt"}}
+}
+
+func (streamingPlugin) ExportStream(_ context.Context, _ *sync.ExportData, _ sync.ExportConfig, w io.Writer) (int, error) {
+	_, err := io.WriteString(w, "streamed body")
+	return 1, err
+}
+
+func (streamingPlugin) StreamFileName(sync.ExportConfig) string { return "stream.txt" }
+
+func TestStreamExport(t *testing.T) {
+	router, exp, _, cleanup := setupSecuredRouter(t, "")
+	defer cleanup()
+	require.NoError(t, exp.syncEngine.RegisterPlugin(&streamingPlugin{}))
+
+	post := func(plugin string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(map[string]interface{}{"plugin_name": plugin, "format": "txt"})
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/export/stream", bytes.NewReader(b)))
+		return rr
+	}
+
+	rr := post("streaming")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "streamed body", rr.Body.String())
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "stream.txt")
+	assert.Equal(t, fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("streamed body"))), rr.Header().Get("X-Export-Checksum"))
+	assert.Equal(t, "1", rr.Header().Get("X-Export-Records"))
+
+	// Plugins without streaming support are rejected before any output
+	rr = post("mockfile")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestExportJobsAndResumableDownload(t *testing.T) {
+	router, _, _, cleanup := setupSecuredRouter(t, "")
+	defer cleanup()
+
+	do := func(method, path string, body interface{}, header map[string]string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		var b []byte
+		if body != nil {
+			b, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(b))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var wrap map[string]interface{}
+		_ = json.Unmarshal(rr.Body.Bytes(), &wrap)
+		return rr, wrap
+	}
+
+	rr, wrap := do("POST", "/api/v1/export/jobs", map[string]interface{}{
+		"plugin_name": "mockfile",
+		"format":      "txt",
+		"output":      map[string]interface{}{"type": "file", "destination": filepath.Join(t.TempDir(), "big.txt")},
+	}, nil)
+	require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+	jobID := wrap["data"].(map[string]interface{})["id"].(string)
+
+	var job map[string]interface{}
+	require.Eventually(t, func() bool {
+		rr, wrap := do("GET", "/api/v1/export/jobs/"+jobID, nil, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		job = wrap["data"].(map[string]interface{})
+		return job["status"] != sync.ExportJobRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, sync.ExportJobCompleted, job["status"], job["error"])
+	assert.Equal(t, sync.ExportPhaseDone, job["progress"].(map[string]interface{})["phase"])
+
+	_, wrap = do("GET", "/api/v1/export/jobs", nil, nil)
+	assert.Len(t, wrap["data"].(map[string]interface{})["jobs"], 1)
+	rr, _ = do("GET", "/api/v1/export/jobs/unknown", nil, nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// The artifact downloads in ranges, so an interrupted download resumes
+	exportID := job["result"].(map[string]interface{})["export_id"].(string)
+	download := "/api/v1/export/" + exportID + "/download"
+	rr, _ = do("GET", download, nil, map[string]string{"Range": "bytes=6-"})
+	require.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, "world", rr.Body.String())
+	assert.Equal(t, "bytes", rr.Header().Get("Accept-Ranges"))
+}
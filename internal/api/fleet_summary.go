@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+)
+
+// GetFleetSummary handles GET /api/v1/summary. It returns device counts by
+// status, generation and model, the power of the metered devices,
+// configuration drift and pending syncs, recent alerts and the next runs of
+// the schedules, so the dashboard does not derive them from the device list.
+func (h *Handler) GetFleetSummary(w http.ResponseWriter, r *http.Request) {
+	summary, err := h.Service.FleetSummary(r.Context())
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, summary)
+}
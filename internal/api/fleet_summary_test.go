@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/notification"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+func TestGetFleetSummary(t *testing.T) {
+	h, db := newTestHandler(t)
+	gdb := db.GetDB()
+
+	devices := []*database.Device{
+		{IP: "10.0.0.1", MAC: "AA0000000001", Type: "SHSW-1", Name: "Kitchen", Status: "online", Settings: `{"gen":1}`},
+		{IP: "10.0.0.2", MAC: "AA0000000002", Type: "SHSW-1", Name: "Garage", Status: "offline", Settings: `{"gen":1}`},
+		{IP: "10.0.0.3", MAC: "AA0000000003", Type: "SNSW-001X16EU", Name: "Hall", Status: "online", Settings: `{"gen":2}`},
+	}
+	for _, d := range devices {
+		require.NoError(t, db.AddDevice(d))
+	}
+	require.NoError(t, gdb.Create(&configuration.DeviceConfig{DeviceID: devices[0].ID, Config: json.RawMessage(`{}`), SyncStatus: "drift"}).Error)
+	require.NoError(t, gdb.Create(&configuration.DeviceConfig{DeviceID: devices[1].ID, Config: json.RawMessage(`{}`), SyncStatus: "pending"}).Error)
+	require.NoError(t, gdb.Create(&configuration.DeviceConfig{DeviceID: devices[2].ID, Config: json.RawMessage(`{}`), SyncStatus: "synced"}).Error)
+
+	channel := notification.NotificationChannel{Name: "ops", Type: "webhook", Config: json.RawMessage(`{}`)}
+	require.NoError(t, gdb.Create(&channel).Error)
+	rule := notification.NotificationRule{Name: "drift", ChannelID: channel.ID}
+	require.NoError(t, gdb.Create(&rule).Error)
+	old := notification.NotificationHistory{RuleID: rule.ID, ChannelID: channel.ID, Subject: "Old", AlertLevel: "info", Status: "sent"}
+	require.NoError(t, gdb.Create(&old).Error)
+	require.NoError(t, gdb.Model(&old).Update("created_at", time.Now().Add(-48*time.Hour)).Error)
+	require.NoError(t, gdb.Create(&notification.NotificationHistory{RuleID: rule.ID, ChannelID: channel.ID, DeviceID: &devices[0].ID,
+		Subject: "Drift on Kitchen", AlertLevel: "warning", Status: "sent"}).Error)
+
+	lastHour := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+	require.NoError(t, gdb.Create(&database.EnergyUsage{DeviceID: devices[0].ID, Hour: lastHour, Wh: 100}).Error)
+	require.NoError(t, gdb.Create(&database.EnergyUsage{DeviceID: devices[2].ID, Hour: lastHour, Wh: 20.5}).Error)
+	require.NoError(t, gdb.Create(&database.EnergyUsage{DeviceID: devices[2].ID, Hour: lastHour.Add(time.Hour), Wh: 3}).Error)
+
+	later, sooner := time.Now().Add(6*time.Hour), time.Now().Add(time.Hour)
+	require.NoError(t, gdb.Create(&configuration.DriftDetectionSchedule{Name: "nightly", Enabled: true, CronSpec: "0 3 * * *", NextRun: &later}).Error)
+	require.NoError(t, gdb.Create(&configuration.DriftDetectionSchedule{Name: "hourly", Enabled: true, CronSpec: "0 * * * *", NextRun: &sooner}).Error)
+	disabled := configuration.DriftDetectionSchedule{Name: "paused", Enabled: true, CronSpec: "0 * * * *"}
+	require.NoError(t, gdb.Create(&disabled).Error)
+	require.NoError(t, gdb.Model(&disabled).Update("enabled", false).Error)
+
+	w := httptest.NewRecorder()
+	h.GetFleetSummary(w, httptest.NewRequest("GET", "/api/v1/summary", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var env struct {
+		Data service.FleetSummary `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &env))
+	summary := env.Data
+	assert.Empty(t, summary.Errors)
+
+	assert.Equal(t, int64(3), summary.Devices.Total)
+	assert.Equal(t, map[string]int64{"online": 2, "offline": 1}, summary.Devices.ByStatus)
+	assert.Equal(t, map[string]int64{"gen1": 2, "gen2": 1}, summary.Devices.ByGeneration)
+	assert.Equal(t, map[string]int64{"SHSW-1": 2, "SNSW-001X16EU": 1}, summary.Devices.ByModel)
+
+	require.NotNil(t, summary.Power)
+	assert.Equal(t, 120.5, summary.Power.Watts, "energy used in the last complete hour")
+	assert.Equal(t, int64(2), summary.Power.Devices)
+	assert.True(t, lastHour.Equal(summary.Power.Hour))
+
+	assert.Equal(t, int64(1), summary.Config.Drifted)
+	assert.Equal(t, int64(1), summary.Config.PendingSync)
+	assert.Equal(t, []service.FleetSummaryDevice{{ID: devices[0].ID, Name: "Kitchen"}}, summary.Config.DriftedDevices)
+
+	assert.Equal(t, int64(1), summary.Alerts.Last24h)
+	assert.Equal(t, map[string]int64{"warning": 1}, summary.Alerts.ByLevel)
+	require.Len(t, summary.Alerts.Recent, 2)
+	assert.Equal(t, "Drift on Kitchen", summary.Alerts.Recent[0].Subject)
+
+	require.Len(t, summary.Schedules, 2)
+	assert.Equal(t, "hourly", summary.Schedules[0].Name)
+	assert.Equal(t, "drift_detection", summary.Schedules[0].Type)
+	assert.Equal(t, "nightly", summary.Schedules[1].Name)
+}
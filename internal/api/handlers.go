@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,6 +19,7 @@ import (
 	"github.com/ginsys/shelly-manager/internal/logging"
 	"github.com/ginsys/shelly-manager/internal/metrics"
 	"github.com/ginsys/shelly-manager/internal/notification"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
 	"github.com/ginsys/shelly-manager/internal/service"
 )
 
@@ -34,6 +36,10 @@ type Handler struct {
 	securityMonitor     interface{} // Security monitor for metrics (using interface{} to avoid circular imports)
 	// AdminAPIKey provides simple guard for sensitive endpoints until full auth is implemented
 	AdminAPIKey string
+	// Auth signs users in through single sign-on; nil when it is disabled
+	Auth *auth.Authenticator
+	// readinessChecks are the subsystems /readyz checks after the database
+	readinessChecks []readinessCheck
 	// Version/banner support
 	serverStartedAt time.Time
 }
@@ -62,22 +68,33 @@ func NewHandlerWithLogger(db database.DatabaseInterface, svc *service.ShellyServ
 // SetAdminAPIKey sets the in-memory admin key for guarding sensitive operations.
 func (h *Handler) SetAdminAPIKey(key string) { h.AdminAPIKey = key }
 
-// requireAdmin checks Authorization or X-API-Key against AdminAPIKey.
+// SetAuthenticator enables single sign-on for the API and the metrics
+// WebSocket
+func (h *Handler) SetAuthenticator(authn *auth.Authenticator) {
+	h.Auth = authn
+	if h.MetricsHandler != nil {
+		h.MetricsHandler.SetAuthenticator(authn)
+	}
+}
+
+// requireAdmin checks Authorization or X-API-Key against AdminAPIKey, or
+// that the signed-in user is an admin.
 func (h *Handler) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
-	if h.AdminAPIKey == "" {
+	return writeAdminAccess(h.responseWriter(), w, r, h.AdminAPIKey)
+}
+
+// writeAdminAccess decides admin access for a request and writes the error
+// response when it is denied
+func writeAdminAccess(rw *apiresp.ResponseWriter, w http.ResponseWriter, r *http.Request, adminKey string) bool {
+	switch auth.AdminAccess(r, adminKey != "", auth.AdminKeyOK(r, adminKey)) {
+	case http.StatusOK:
 		return true
+	case http.StatusForbidden:
+		rw.WriteError(w, r, http.StatusForbidden, apiresp.ErrCodeForbidden, "Admin role required", nil)
+	default:
+		rw.WriteError(w, r, http.StatusUnauthorized, apiresp.ErrCodeUnauthorized, "Admin authorization required", nil)
 	}
-	auth := r.Header.Get("Authorization")
-	xKey := r.Header.Get("X-API-Key")
-	ok := strings.HasPrefix(auth, "Bearer ") && strings.TrimPrefix(auth, "Bearer ") == h.AdminAPIKey
-	if !ok && xKey != "" && xKey == h.AdminAPIKey {
-		ok = true
-	}
-	if !ok {
-		h.responseWriter().WriteError(w, r, http.StatusUnauthorized, apiresp.ErrCodeUnauthorized, "Admin authorization required", nil)
-		return false
-	}
-	return true
+	return false
 }
 
 // RotateAdminKey updates the in-memory admin key used by API/WS/export/import handlers.
@@ -116,7 +133,7 @@ func (h *Handler) RotateAdminKey(w http.ResponseWriter, r *http.Request) {
 		h.logger.WithFields(map[string]any{
 			"component":  "admin",
 			"action":     "rotate_admin_key",
-			"request_id": r.Context().Value("request_id"),
+			"request_id": logging.GetRequestID(r.Context()),
 		}).Info("Admin API key rotated")
 	}
 
@@ -148,9 +165,6 @@ func (h *Handler) responseWriter() *apiresp.ResponseWriter {
 
 // Healthz returns basic liveness: process is up and DB reachable.
 func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
-	type health struct {
-		Status string `json:"status"`
-	}
 	// Basic DB check via lightweight query
 	one := 0
 	dbErr := h.DB.GetDB().Raw("SELECT 1").Scan(&one).Error
@@ -158,8 +172,7 @@ func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
 	if dbErr != nil || one != 1 {
 		status = "degraded"
 	}
-	resp := health{Status: status}
-	h.writeJSON(w, resp)
+	h.writeJSON(w, Health{Status: status})
 }
 
 // FastHealthz - Optimized health endpoint for test mode
@@ -179,30 +192,17 @@ func (h *Handler) FastHealthz(w http.ResponseWriter, r *http.Request) {
 
 // Version returns minimal API version/build info for UI mismatch banner
 func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
-	resp := map[string]any{
-		"api_version":       "dev",
-		"server_started_at": h.serverStartedAt.Format(time.RFC3339),
+	resp := VersionInfo{
+		APIVersion:      "dev",
+		ServerStartedAt: h.serverStartedAt.Format(time.RFC3339),
 	}
 	// Try to include database provider info if available
 	if mgr, ok := h.DB.(interface{ GetProviderInfo() (string, string) }); ok {
-		name, ver := mgr.GetProviderInfo()
-		resp["database_provider_name"] = name
-		resp["database_provider_version"] = ver
+		resp.DatabaseProviderName, resp.DatabaseProviderVersion = mgr.GetProviderInfo()
 	}
 	h.writeJSON(w, apiresp.Success(resp))
 }
 
-// Readyz returns readiness: dependencies available (currently DB).
-func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
-	// Fail if DB not reachable
-	var one int
-	if err := h.DB.GetDB().Raw("SELECT 1").Scan(&one).Error; err != nil || one != 1 {
-		h.responseWriter().WriteError(w, r, http.StatusServiceUnavailable, apiresp.ErrCodeServiceUnavailable, "Dependency not ready (database)", nil)
-		return
-	}
-	h.responseWriter().WriteSuccess(w, r, map[string]any{"ready": true})
-}
-
 // GetDevices handles GET /api/v1/devices
 func (h *Handler) GetDevices(w http.ResponseWriter, r *http.Request) {
 	devices, err := h.DB.GetDevices()
@@ -263,7 +263,11 @@ func (h *Handler) GetDevices(w http.ResponseWriter, r *http.Request) {
 		TotalCount: intPtr(total),
 	}
 
-	h.responseWriter().WriteSuccessWithMeta(w, r, map[string]interface{}{"devices": pageDevices}, meta)
+	views := make([]deviceView, len(pageDevices))
+	for i := range pageDevices {
+		views[i] = newDeviceView(&pageDevices[i])
+	}
+	h.responseWriter().WriteSuccessWithMeta(w, r, map[string]interface{}{"devices": views}, meta)
 }
 
 // AddDevice handles POST /api/v1/devices
@@ -290,7 +294,7 @@ func (h *Handler) AddDevice(w http.ResponseWriter, r *http.Request) {
 			"settings":    device.Settings,
 			"component":   "api",
 			"operation":   "add_device",
-			"request_id":  r.Context().Value("request_id"),
+			"request_id":  logging.GetRequestID(r.Context()),
 		}).Error("AddDevice operation failed with detailed context")
 
 		// Check if it's a unique constraint violation and return appropriate error
@@ -332,7 +336,8 @@ func (h *Handler) GetDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.responseWriter().WriteSuccess(w, r, device)
+	setVersionETag(w, device.Version)
+	h.responseWriter().WriteSuccess(w, r, newDeviceView(device))
 }
 
 // UpdateDevice handles PUT /api/v1/devices/{id}
@@ -368,9 +373,24 @@ func (h *Handler) UpdateDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update existing device with new data
+	version, ok := h.checkVersion(w, r, updatedDevice.Version, existingDevice.Version, newDeviceView(existingDevice))
+	if !ok {
+		return
+	}
+
+	// Update existing device with new data. The profile follows the device
+	// and is changed through POST /devices/{id}/profile, the asset record
+	// through PUT /devices/{id}/asset.
 	updatedDevice.ID = existingDevice.ID
-	if err := h.DB.UpdateDevice(&updatedDevice); err != nil {
+	updatedDevice.Profile = existingDevice.Profile
+	updatedDevice.Asset = existingDevice.Asset
+	if err := h.DB.UpdateDeviceIfVersion(&updatedDevice, version); err != nil {
+		if isVersionConflict(err) {
+			if current, getErr := h.DB.GetDevice(uint(id)); getErr == nil {
+				h.writeVersionConflict(w, r, current.Version, newDeviceView(current))
+				return
+			}
+		}
 		h.logger.WithFields(map[string]any{
 			"error":      err.Error(),
 			"device_id":  updatedDevice.ID,
@@ -378,7 +398,7 @@ func (h *Handler) UpdateDevice(w http.ResponseWriter, r *http.Request) {
 			"device_mac": updatedDevice.MAC,
 			"component":  "api",
 			"operation":  "update_device",
-			"request_id": r.Context().Value("request_id"),
+			"request_id": logging.GetRequestID(r.Context()),
 		}).Error("UpdateDevice operation failed with detailed context")
 
 		if strings.Contains(strings.ToLower(err.Error()), "unique constraint") ||
@@ -397,6 +417,7 @@ func (h *Handler) UpdateDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setVersionETag(w, updatedDevice.Version)
 	h.responseWriter().WriteSuccess(w, r, updatedDevice)
 }
 
@@ -422,6 +443,237 @@ func (h *Handler) DeleteDevice(w http.ResponseWriter, r *http.Request) {
 
 func intPtr(i int) *int { return &i }
 
+// RenameDevices handles POST /api/v1/devices/rename. Names are generated from
+// the naming template (or the request template) for the selected devices;
+// dry_run only reports the plan and push also sets the name on the devices.
+func (h *Handler) RenameDevices(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.RenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+
+	policy := h.Service.NamingPolicy()
+	if req.Template != "" {
+		policy = policy.WithTemplate(req.Template)
+	}
+	if err := policy.Validate(); err != nil {
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+		return
+	}
+
+	results, err := h.Service.RenameDevices(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+
+	changed := 0
+	for _, res := range results {
+		if res.Changed {
+			changed++
+		}
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"results": results,
+		"total":   len(results),
+		"changed": changed,
+		"dry_run": req.DryRun,
+	})
+}
+
+// GetNameHygiene handles GET /api/v1/devices/names/hygiene. It reports
+// duplicate, cross-site and near-duplicate device names and names violating
+// the naming template, with suggested names and the rename request that
+// applies them.
+func (h *Handler) GetNameHygiene(w http.ResponseWriter, r *http.Request) {
+	report, err := h.Service.NameHygiene(r.Context())
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// SyncDeviceNames handles POST /api/v1/devices/sync-names. It sets each
+// selected device's own name to its inventory name so mDNS and router client
+// lists match the manager.
+func (h *Handler) SyncDeviceNames(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.NameSyncRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+			return
+		}
+	}
+
+	results, err := h.Service.SyncDeviceNames(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+
+	summary := map[string]int{"changed": 0, "in_sync": 0, "skipped": 0, "failed": 0}
+	for _, res := range results {
+		switch {
+		case res.Error != "":
+			summary["failed"]++
+		case res.Skipped != "":
+			summary["skipped"]++
+		case res.Changed:
+			summary["changed"]++
+		default:
+			summary["in_sync"]++
+		}
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"results": results,
+		"total":   len(results),
+		"summary": summary,
+		"dry_run": req.DryRun,
+	})
+}
+
+// DisableCloud handles POST /api/v1/devices/cloud/disable. It audits
+// cloud.enable across the fleet and turns Shelly Cloud off where it is on;
+// with dry_run it only previews the devices that would change.
+func (h *Handler) DisableCloud(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.CloudDisableRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+			return
+		}
+	}
+
+	if !req.DryRun {
+		targets, err := h.Service.SelectDevices(req.DeviceIDs, req.Tag)
+		if err != nil {
+			if errors.Is(err, service.ErrDeviceNotFound) {
+				h.responseWriter().WriteValidationError(w, r, err.Error())
+				return
+			}
+			h.responseWriter().WriteInternalError(w, r, err)
+			return
+		}
+		if !h.confirmBulk(w, r, "devices.cloud.disable", targets, map[string]any{"force": req.Force}) {
+			return
+		}
+	}
+
+	results, err := h.Service.DisableCloud(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+
+	summary := map[string]int{"disabled": 0, "already_off": 0, "requires_cloud": 0, "skipped": 0, "failed": 0}
+	for _, res := range results {
+		switch {
+		case res.Error != "":
+			summary["failed"]++
+		case res.RequiresCloud && res.CloudEnabled != nil && *res.CloudEnabled:
+			summary["requires_cloud"]++
+		case res.Skipped != "":
+			summary["skipped"]++
+		case res.Changed:
+			summary["disabled"]++
+		default:
+			summary["already_off"]++
+		}
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"results": results,
+		"total":   len(results),
+		"summary": summary,
+		"dry_run": req.DryRun,
+	})
+}
+
+// SyncCloud handles POST /api/v1/devices/cloud/sync. It pushes inventory
+// names and room tags to the configured Shelly Cloud account; with dry_run
+// it only previews the devices that would change.
+func (h *Handler) SyncCloud(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.CloudSyncRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+			return
+		}
+	}
+
+	if !req.DryRun {
+		targets, err := h.Service.SelectDevices(req.DeviceIDs, req.Tag)
+		if err != nil {
+			if errors.Is(err, service.ErrDeviceNotFound) {
+				h.responseWriter().WriteValidationError(w, r, err.Error())
+				return
+			}
+			h.responseWriter().WriteInternalError(w, r, err)
+			return
+		}
+		if !h.confirmBulk(w, r, "devices.cloud.sync", targets, map[string]any{"names": req.Names, "rooms": req.Rooms}) {
+			return
+		}
+	}
+
+	results, err := h.Service.SyncCloud(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		h.writeCloudError(w, r, err)
+		return
+	}
+
+	summary := map[string]int{"changed": 0, "in_sync": 0, "room_missing": 0, "skipped": 0, "failed": 0}
+	for _, res := range results {
+		switch {
+		case res.Error != "":
+			summary["failed"]++
+		case res.Skipped != "":
+			summary["skipped"]++
+		case res.NameChanged || res.RoomChanged:
+			summary["changed"]++
+		case res.RoomMissing:
+			summary["room_missing"]++
+		default:
+			summary["in_sync"]++
+		}
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"results": results,
+		"total":   len(results),
+		"summary": summary,
+		"dry_run": req.DryRun,
+	})
+}
+
 // DiscoverHandler handles POST /api/v1/discover
 func (h *Handler) DiscoverHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse optional network parameter
@@ -445,14 +697,17 @@ func (h *Handler) DiscoverHandler(w http.ResponseWriter, r *http.Request) {
 		req.ImportConfig = true
 	}
 
-	// Run discovery in background
+	// Run discovery in background, logged under this request's ID
+	ctx := logging.WithRequestID(context.Background(), logging.GetRequestID(r.Context()))
+	log := h.logger.WithContext(ctx)
+	db := h.DB.WithContext(ctx)
 	go func() {
 		network := req.Network
 		if network == "" {
 			network = "auto"
 		}
 
-		h.logger.WithFields(map[string]any{
+		log.WithFields(map[string]any{
 			"network":       network,
 			"import_config": req.ImportConfig,
 			"component":     "api",
@@ -461,14 +716,14 @@ func (h *Handler) DiscoverHandler(w http.ResponseWriter, r *http.Request) {
 		// Discover devices
 		devices, err := h.Service.DiscoverDevices(network)
 		if err != nil {
-			h.logger.WithFields(map[string]any{
+			log.WithFields(map[string]any{
 				"error":     err.Error(),
 				"component": "api",
 			}).Error("Discovery failed")
 			return
 		}
 
-		h.logger.WithFields(map[string]any{
+		log.WithFields(map[string]any{
 			"devices_found": len(devices),
 			"component":     "api",
 		}).Info("Discovery completed")
@@ -479,15 +734,15 @@ func (h *Handler) DiscoverHandler(w http.ResponseWriter, r *http.Request) {
 
 		for _, device := range devices {
 			// Check if device already exists by MAC
-			existing, err := h.DB.GetDeviceByMAC(device.MAC)
+			existing, err := db.GetDeviceByMAC(device.MAC)
 			if err == nil && existing != nil {
 				// Update existing device
 				existing.IP = device.IP
 				existing.Status = device.Status
 				existing.LastSeen = device.LastSeen
 				existing.Firmware = device.Firmware
-				if err := h.DB.UpdateDevice(existing); err != nil && h.logger != nil {
-					h.logger.Error("Failed to update device during import", "error", err, "deviceID", existing.ID)
+				if err := db.UpdateDevice(existing); err != nil && log != nil {
+					log.Error("Failed to update device during import", "error", err, "deviceID", existing.ID)
 				}
 
 				// Import config if requested
@@ -498,7 +753,7 @@ func (h *Handler) DiscoverHandler(w http.ResponseWriter, r *http.Request) {
 				}
 			} else {
 				// Add new device
-				if err := h.DB.AddDevice(&device); err == nil {
+				if err := db.AddDevice(&device); err == nil {
 					newDevices++
 
 					// Import config for new device if requested
@@ -506,7 +761,7 @@ func (h *Handler) DiscoverHandler(w http.ResponseWriter, r *http.Request) {
 						if _, err := h.Service.ImportDeviceConfig(device.ID); err == nil {
 							configsImported++
 						} else {
-							h.logger.WithFields(map[string]any{
+							log.WithFields(map[string]any{
 								"device_id": device.ID,
 								"device_ip": device.IP,
 								"error":     err.Error(),
@@ -518,7 +773,7 @@ func (h *Handler) DiscoverHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		h.logger.WithFields(map[string]any{
+		log.WithFields(map[string]any{
 			"total_devices":    len(devices),
 			"new_devices":      newDevices,
 			"configs_imported": configsImported,
@@ -600,7 +855,10 @@ func (h *Handler) ControlDevice(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Execute control command
-	if err := h.Service.ControlDevice(uint(id), req.Action, req.Params); err != nil {
+	if err := h.Service.ControlDeviceContext(r.Context(), uint(id), req.Action, req.Params); err != nil {
+		if h.writeUnsupported(w, r, err) {
+			return
+		}
 		if errors.Is(err, service.ErrDeviceOffline) {
 			h.responseWriter().WriteError(w, r, http.StatusServiceUnavailable, apiresp.ErrCodeDeviceOffline,
 				"Device is offline. Set \"force\": true to attempt anyway.", nil)
@@ -615,13 +873,101 @@ func (h *Handler) ControlDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
-		"status":    "success",
-		"device_id": id,
-		"action":    req.Action,
+	h.responseWriter().WriteSuccess(w, r, ControlResult{
+		Status:   "success",
+		DeviceID: uint(id),
+		Action:   req.Action,
+	})
+}
+
+// BulkControlDevices handles POST /api/v1/devices/control. It runs one action
+// on the devices selected by device_ids or tag and returns per-device results;
+// with async the run continues in the background and a job is returned.
+func (h *Handler) BulkControlDevices(w http.ResponseWriter, r *http.Request) {
+	// Bulk operations mutate every device; require admin before touching hardware.
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.BulkControlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if req.Force {
+		params := make(map[string]interface{}, len(req.Params)+1)
+		for k, v := range req.Params {
+			params[k] = v
+		}
+		params["force"] = true
+		req.Params = params
+	}
+
+	targets, err := h.Service.BulkControlTargets(req)
+	if err != nil {
+		h.writeBulkControlError(w, r, err)
+		return
+	}
+	if !h.confirmBulk(w, r, "devices.control", targets, map[string]any{"action": req.Action, "params": req.Params}) {
+		return
+	}
+
+	if req.Async {
+		job, err := h.Service.StartBulkControl(r.Context(), req)
+		if err != nil {
+			h.writeBulkControlError(w, r, err)
+			return
+		}
+		w.Header().Set("Location", "/api/v1/devices/control/jobs/"+job.ID)
+		h.responseWriter().WriteAccepted(w, r, job)
+		return
+	}
+
+	results, err := h.Service.BulkControl(r.Context(), req)
+	if err != nil {
+		h.writeBulkControlError(w, r, err)
+		return
+	}
+	succeeded := 0
+	for _, res := range results {
+		if res.Success {
+			succeeded++
+		}
+	}
+	h.responseWriter().WriteSuccess(w, r, BulkControlSummary{
+		Action:    req.Action,
+		Results:   results,
+		Total:     len(results),
+		Succeeded: succeeded,
+		Failed:    len(results) - succeeded,
 	})
 }
 
+// GetBulkControlJob handles GET /api/v1/devices/control/jobs/{id}
+func (h *Handler) GetBulkControlJob(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	job, err := h.Service.GetBulkControlJob(mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, service.ErrJobNotFound) {
+			h.responseWriter().WriteNotFoundError(w, r, "Job")
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, job)
+}
+
+// writeBulkControlError maps selector and validation errors to 400
+func (h *Handler) writeBulkControlError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrDeviceNotFound) || errors.Is(err, service.ErrInvalidControlRequest) {
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+		return
+	}
+	h.responseWriter().WriteInternalError(w, r, err)
+}
+
 // GetDeviceStatus handles GET /api/v1/devices/{id}/status
 func (h *Handler) GetDeviceStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -632,7 +978,7 @@ func (h *Handler) GetDeviceStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get device status
-	status, err := h.Service.GetDeviceStatus(uint(id))
+	status, err := h.Service.GetDeviceStatusContext(r.Context(), uint(id))
 	if err != nil {
 		if errors.Is(err, service.ErrDeviceOffline) {
 			h.responseWriter().WriteError(w, r, http.StatusServiceUnavailable, apiresp.ErrCodeDeviceOffline, "Device is offline", nil)
@@ -667,12 +1013,15 @@ func (h *Handler) GetDeviceEnergy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get energy data
-	energy, err := h.Service.GetDeviceEnergy(uint(id), channel)
+	energy, err := h.Service.GetDeviceEnergyContext(r.Context(), uint(id), channel)
 	if err != nil {
 		if errors.Is(err, service.ErrDeviceOffline) {
 			h.responseWriter().WriteError(w, r, http.StatusServiceUnavailable, apiresp.ErrCodeDeviceOffline, "Device is offline", nil)
 			return
 		}
+		if h.writeUnsupported(w, r, err) {
+			return
+		}
 		h.logger.WithFields(map[string]any{
 			"device_id": id,
 			"channel":   channel,
@@ -685,6 +1034,28 @@ func (h *Handler) GetDeviceEnergy(w http.ResponseWriter, r *http.Request) {
 	h.responseWriter().WriteSuccess(w, r, energy)
 }
 
+// GetDeviceEnergyTotals handles GET /api/v1/devices/{id}/energy/totals with
+// the manager-side cumulative energy per channel, which survives device
+// counter resets
+func (h *Handler) GetDeviceEnergyTotals(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+	if _, err := h.DB.GetDevice(uint(id)); err != nil {
+		h.responseWriter().WriteNotFoundError(w, r, "Device")
+		return
+	}
+
+	totals, err := h.Service.DeviceEnergyTotals(uint(id))
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, totals)
+}
+
 // GetDeviceConfig handles GET /api/v1/devices/{id}/config
 func (h *Handler) GetDeviceConfig(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -705,6 +1076,7 @@ func (h *Handler) GetDeviceConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setVersionETag(w, config.Version)
 	h.responseWriter().WriteSuccess(w, r, config)
 }
 
@@ -838,8 +1210,16 @@ func (h *Handler) ExportDeviceConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.gateChange(w, r, "config.export", []database.Device{{ID: uint(id)}}, nil) {
+		return
+	}
+
 	// Export configuration to device
 	if err := h.Service.ExportDeviceConfig(uint(id)); err != nil {
+		if errors.Is(err, service.ErrHookVeto) {
+			h.responseWriter().WriteError(w, r, http.StatusForbidden, apiresp.ErrCodeForbidden, err.Error(), nil)
+			return
+		}
 		h.logger.WithFields(map[string]any{
 			"device_id": id,
 			"error":     err.Error(),
@@ -872,6 +1252,9 @@ func (h *Handler) BulkImportConfigs(w http.ResponseWriter, r *http.Request) {
 		h.responseWriter().WriteInternalError(w, r, err)
 		return
 	}
+	if !h.confirmBulk(w, r, "config.bulk_import", devices, nil) {
+		return
+	}
 
 	type ImportResult struct {
 		DeviceID uint   `json:"device_id"`
@@ -940,6 +1323,9 @@ func (h *Handler) BulkExportConfigs(w http.ResponseWriter, r *http.Request) {
 		h.responseWriter().WriteInternalError(w, r, err)
 		return
 	}
+	if !h.gateChange(w, r, "config.bulk_export", devices, nil) {
+		return
+	}
 
 	type ExportResult struct {
 		DeviceID uint   `json:"device_id"`
@@ -1117,11 +1503,32 @@ func (h *Handler) UpdateConfigTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	current, err := h.Service.ConfigSvc.GetTemplate(uint(id))
+	if err != nil {
+		if errors.Is(err, configuration.ErrTemplateNotFound) {
+			h.responseWriter().WriteNotFoundError(w, r, "Template")
+		} else {
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+	version, ok := h.checkVersion(w, r, template.Version, current.Version, current)
+	if !ok {
+		return
+	}
+
 	template.ID = uint(id)
+	template.Version = version
 	if err := h.Service.ConfigSvc.UpdateTemplate(&template); err != nil {
 		if h.writeTemplateScopeError(w, r, err) {
 			return
 		}
+		if isVersionConflict(err) {
+			if latest, getErr := h.Service.ConfigSvc.GetTemplate(uint(id)); getErr == nil {
+				h.writeVersionConflict(w, r, latest.Version, latest)
+				return
+			}
+		}
 		h.logger.WithFields(map[string]any{
 			"template_id": id,
 			"error":       err.Error(),
@@ -1129,6 +1536,7 @@ func (h *Handler) UpdateConfigTemplate(w http.ResponseWriter, r *http.Request) {
 		h.responseWriter().WriteInternalError(w, r, err)
 		return
 	}
+	setVersionETag(w, template.Version)
 	h.responseWriter().WriteSuccess(w, r, template)
 }
 
@@ -1170,6 +1578,11 @@ func (h *Handler) ApplyConfigTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	params := map[string]any{"template_id": req.TemplateID, "variables": req.Variables}
+	if !h.gateChange(w, r, "config.apply_template", []database.Device{{ID: uint(id)}}, params) {
+		return
+	}
+
 	if err := h.Service.ApplyConfigTemplate(uint(id), req.TemplateID, req.Variables); err != nil {
 		if errors.Is(err, configuration.ErrTemplateNotFound) {
 			h.responseWriter().WriteNotFoundError(w, r, "Template")
@@ -1198,6 +1611,47 @@ func (h *Handler) ApplyConfigTemplate(w http.ResponseWriter, r *http.Request) {
 	h.responseWriter().WriteSuccess(w, r, response)
 }
 
+// PreviewConfigTemplateApply handles POST /api/v1/config/templates/{id}/preview-apply
+func (h *Handler) PreviewConfigTemplateApply(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid template ID", nil)
+		return
+	}
+
+	var req struct {
+		DeviceIDs []uint                 `json:"device_ids"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+			return
+		}
+	}
+
+	preview, err := h.Service.PreviewConfigTemplateApply(uint(id), req.DeviceIDs, req.Variables)
+	if err != nil {
+		if errors.Is(err, configuration.ErrTemplateNotFound) {
+			h.responseWriter().WriteNotFoundError(w, r, "Template")
+			return
+		}
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+			return
+		}
+		h.logger.WithFields(map[string]any{
+			"template_id": id,
+			"error":       err.Error(),
+		}).Error("Failed to preview config template")
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+
+	h.responseWriter().WriteSuccess(w, r, preview)
+}
+
 // GetConfigHistory handles GET /api/v1/devices/{id}/config/history
 func (h *Handler) GetConfigHistory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -1244,9 +1698,16 @@ func (h *Handler) UpdateDeviceConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.checkConfigVersion(w, r, uint(id)) {
+		return
+	}
+
 	// Update device configuration
 	err = h.Service.UpdateDeviceConfig(uint(id), configUpdate)
 	if err != nil {
+		if h.writeConfigConflict(w, r, uint(id), err) {
+			return
+		}
 		h.logger.WithFields(map[string]any{
 			"device_id": id,
 			"error":     err.Error(),
@@ -1262,6 +1723,7 @@ func (h *Handler) UpdateDeviceConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setVersionETag(w, config.Version)
 	h.responseWriter().WriteSuccess(w, r, config)
 }
 
@@ -1281,9 +1743,16 @@ func (h *Handler) UpdateRelayConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.checkConfigVersion(w, r, uint(id)) {
+		return
+	}
+
 	// Update relay configuration
 	err = h.Service.UpdateRelayConfig(uint(id), &relayConfig)
 	if err != nil {
+		if h.writeConfigConflict(w, r, uint(id), err) {
+			return
+		}
 		h.logger.WithFields(map[string]any{
 			"device_id": id,
 			"error":     err.Error(),
@@ -1311,9 +1780,19 @@ func (h *Handler) UpdateDimmingConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.checkConfigVersion(w, r, uint(id)) {
+		return
+	}
+
 	// Update dimming configuration
 	err = h.Service.UpdateDimmingConfig(uint(id), &dimmingConfig)
 	if err != nil {
+		if h.writeConfigConflict(w, r, uint(id), err) {
+			return
+		}
+		if h.writeUnsupported(w, r, err) {
+			return
+		}
 		h.logger.WithFields(map[string]any{
 			"device_id": id,
 			"error":     err.Error(),
@@ -1341,9 +1820,19 @@ func (h *Handler) UpdateRollerConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.checkConfigVersion(w, r, uint(id)) {
+		return
+	}
+
 	// Update roller configuration
 	err = h.Service.UpdateRollerConfig(uint(id), &rollerConfig)
 	if err != nil {
+		if h.writeConfigConflict(w, r, uint(id), err) {
+			return
+		}
+		if h.writeUnsupported(w, r, err) {
+			return
+		}
 		h.logger.WithFields(map[string]any{
 			"device_id": id,
 			"error":     err.Error(),
@@ -1371,9 +1860,19 @@ func (h *Handler) UpdatePowerMeteringConfig(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if !h.checkConfigVersion(w, r, uint(id)) {
+		return
+	}
+
 	// Update power metering configuration
 	err = h.Service.UpdatePowerMeteringConfig(uint(id), &powerConfig)
 	if err != nil {
+		if h.writeConfigConflict(w, r, uint(id), err) {
+			return
+		}
+		if h.writeUnsupported(w, r, err) {
+			return
+		}
 		h.logger.WithFields(map[string]any{
 			"device_id": id,
 			"error":     err.Error(),
@@ -1619,6 +2118,104 @@ func (h *Handler) GetDriftTrends(w http.ResponseWriter, r *http.Request) {
 	h.responseWriter().WriteSuccess(w, r, trends)
 }
 
+// GetDriftQueue handles GET /api/v1/config/drift-queue
+func (h *Handler) GetDriftQueue(w http.ResponseWriter, r *http.Request) {
+	severity := r.URL.Query().Get("severity")
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, parseErr := strconv.Atoi(limitStr); parseErr == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	queue, err := h.Service.GetDriftQueue(severity, limit)
+	if err != nil {
+		if errors.Is(err, configuration.ErrInvalidDriftQuery) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		h.logger.WithFields(map[string]any{
+			"severity": severity,
+			"error":    err.Error(),
+		}).Error("Failed to get drift queue")
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"devices": queue,
+		"total":   len(queue),
+	})
+}
+
+// PlanDriftRemediation handles POST /api/v1/config/drift-remediation/dry-run.
+// It projects remediating the drift queue under the selected policy without
+// contacting any device, so the plan can be reviewed before it is carried
+// out with a bulk export or import.
+func (h *Handler) PlanDriftRemediation(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.DriftRemediationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	plan, err := h.Service.PlanDriftRemediation(req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRemediationPlan) {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, plan)
+}
+
+// GetDeviceDriftTimeline handles GET /api/v1/devices/{id}/drift/timeline. It
+// returns the device's drift events oldest first, with the paths of each and
+// how it was remediated, for timeline charts.
+func (h *Handler) GetDeviceDriftTimeline(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+
+	var since *time.Time
+	if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+		t, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			h.responseWriter().WriteValidationError(w, r, "since must be an RFC 3339 time")
+			return
+		}
+		since = &t
+	}
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, parseErr := strconv.Atoi(limitStr); parseErr == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	timeline, err := h.Service.GetDriftTimeline(uint(id), since, limit)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+			return
+		}
+		h.logger.WithFields(map[string]any{
+			"device_id": id,
+			"error":     err.Error(),
+		}).Error("Failed to get drift timeline")
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+
+	h.responseWriter().WriteSuccess(w, r, timeline)
+}
+
 // MarkTrendResolved handles POST /api/v1/config/drift-trends/{id}/resolve
 func (h *Handler) MarkTrendResolved(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -29,6 +29,7 @@ type UpdateTemplateRequest struct {
 	Name        string                             `json:"name,omitempty"`
 	Description string                             `json:"description,omitempty"`
 	Config      *configuration.DeviceConfiguration `json:"config,omitempty"`
+	Version     int                                `json:"version,omitempty"` // version the edit is based on
 }
 
 // TemplateResponse represents a template in API responses
@@ -39,6 +40,7 @@ type TemplateResponse struct {
 	Scope       string                             `json:"scope"`
 	DeviceType  string                             `json:"device_type,omitempty"`
 	Config      *configuration.DeviceConfiguration `json:"config"`
+	Version     int                                `json:"version"`
 	CreatedAt   string                             `json:"created_at"`
 	UpdatedAt   string                             `json:"updated_at"`
 	// Secrets redaction indicators
@@ -176,6 +178,7 @@ func (h *Handler) GetNewConfigTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setVersionETag(w, template.Version)
 	rw.WriteSuccess(w, r, map[string]any{
 		"template": templateToResponse(template),
 	})
@@ -209,6 +212,10 @@ func (h *Handler) UpdateNewConfigTemplate(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if _, ok := h.checkVersion(w, r, req.Version, existing.Version, map[string]any{"template": templateToResponse(existing)}); !ok {
+		return
+	}
+
 	// Apply updates
 	if req.Name != "" {
 		existing.Name = req.Name
@@ -226,6 +233,12 @@ func (h *Handler) UpdateNewConfigTemplate(w http.ResponseWriter, r *http.Request
 	}
 
 	if err := h.ConfigService.ConfigurationSvc.UpdateTemplate(existing); err != nil {
+		if isVersionConflict(err) {
+			if current, getErr := h.ConfigService.ConfigurationSvc.GetTemplate(uint(id)); getErr == nil {
+				h.writeVersionConflict(w, r, current.Version, map[string]any{"template": templateToResponse(current)})
+				return
+			}
+		}
 		h.logger.WithFields(map[string]any{
 			"error":       err.Error(),
 			"template_id": id,
@@ -245,6 +258,7 @@ func (h *Handler) UpdateNewConfigTemplate(w http.ResponseWriter, r *http.Request
 		"component":        "api",
 	}).Info("Template updated via API")
 
+	setVersionETag(w, existing.Version)
 	rw.WriteSuccess(w, r, map[string]any{
 		"template":         templateToResponse(existing),
 		"affected_devices": len(affected),
@@ -301,6 +315,7 @@ func templateToResponse(tmpl *configuration.ServiceConfigTemplate) TemplateRespo
 		Description: tmpl.Description,
 		Scope:       tmpl.Scope,
 		DeviceType:  tmpl.DeviceType,
+		Version:     tmpl.Version,
 		CreatedAt:   tmpl.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		UpdatedAt:   tmpl.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 	}
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -60,6 +62,64 @@ func TestReadyz_OK(t *testing.T) {
 	}
 }
 
+func TestReadyz_Subsystems(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+
+	handler := NewHandlerWithLogger(db, nil, nil, nil, logging.GetDefault())
+	schedulerErr := errors.New("sync scheduler is not running")
+	handler.AddReadinessCheck("sync_plugins", func(context.Context) error { return nil })
+	handler.AddReadinessCheck("sync_scheduler", func(context.Context) error { return schedulerErr })
+
+	readyz := func() (int, map[string]SubsystemStatus) {
+		w := httptest.NewRecorder()
+		handler.Readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+		var body struct {
+			Data struct {
+				Subsystems map[string]SubsystemStatus `json:"subsystems"`
+			} `json:"data"`
+			Error struct {
+				Details struct {
+					Subsystems map[string]SubsystemStatus `json:"subsystems"`
+				} `json:"details"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if w.Code == http.StatusOK {
+			return w.Code, body.Data.Subsystems
+		}
+		return w.Code, body.Error.Details.Subsystems
+	}
+
+	code, subsystems := readyz()
+	testutil.AssertEqual(t, http.StatusServiceUnavailable, code)
+	for _, name := range []string{"database", "migrations", "sync_plugins"} {
+		if !subsystems[name].Ready {
+			t.Errorf("expected %s to be ready, got %+v", name, subsystems[name])
+		}
+	}
+	if s := subsystems["sync_scheduler"]; s.Ready || s.Error != schedulerErr.Error() {
+		t.Errorf("expected the scheduler not to be ready, got %+v", s)
+	}
+
+	schedulerErr = nil
+	code, subsystems = readyz()
+	testutil.AssertEqual(t, http.StatusOK, code)
+	testutil.AssertEqual(t, 4, len(subsystems))
+
+	// A schema missing a table is not migrated
+	if err := db.GetDB().Migrator().DropTable("power_budget_members"); err != nil {
+		t.Fatalf("failed to drop table: %v", err)
+	}
+	code, subsystems = readyz()
+	testutil.AssertEqual(t, http.StatusServiceUnavailable, code)
+	if !strings.Contains(subsystems["migrations"].Error, "power_budget_members") {
+		t.Errorf("expected the missing table to be reported, got %+v", subsystems["migrations"])
+	}
+}
+
 // TestHealthEndpointsWithCurlUserAgent ensures health endpoints are accessible
 // with curl user agent to prevent E2E test failures (regression test for GitHub Actions)
 func TestHealthEndpointsWithCurlUserAgent(t *testing.T) {
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// hookRequest is the body of hook create and update requests; the secret is
+// accepted but never returned
+type hookRequest struct {
+	database.OperationHook
+	Secret string `json:"secret,omitempty"`
+}
+
+// ListHooks handles GET /api/v1/hooks
+func (h *Handler) ListHooks(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	hooks, err := h.Service.ListHooks()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"hooks": hooks,
+		"count": len(hooks),
+	})
+}
+
+// CreateHook handles POST /api/v1/hooks. Hooks are enabled unless the body
+// sets "enabled": false.
+func (h *Handler) CreateHook(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	hook, ok := h.decodeHook(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Service.CreateHook(hook); err != nil {
+		h.writeHookError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteCreated(w, r, hook)
+}
+
+// GetHook handles GET /api/v1/hooks/{id}
+func (h *Handler) GetHook(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.ipamID(w, r, "id")
+	if !ok {
+		return
+	}
+	hook, err := h.Service.GetHook(id)
+	if err != nil {
+		h.writeHookError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, hook)
+}
+
+// UpdateHook handles PUT /api/v1/hooks/{id}
+func (h *Handler) UpdateHook(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.ipamID(w, r, "id")
+	if !ok {
+		return
+	}
+	hook, ok := h.decodeHook(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Service.UpdateHook(id, hook); err != nil {
+		h.writeHookError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, hook)
+}
+
+// DeleteHook handles DELETE /api/v1/hooks/{id}
+func (h *Handler) DeleteHook(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.ipamID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.Service.DeleteHook(id); err != nil {
+		h.writeHookError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"deleted": id})
+}
+
+// decodeHook reads a hook definition from the request body
+func (h *Handler) decodeHook(w http.ResponseWriter, r *http.Request) (*database.OperationHook, bool) {
+	req := hookRequest{OperationHook: database.OperationHook{Enabled: true}}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return nil, false
+	}
+	hook := req.OperationHook
+	hook.Secret = req.Secret
+	return &hook, true
+}
+
+// writeHookError maps unknown hooks to 404 and validation errors to 400
+func (h *Handler) writeHookError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrHookNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Hook")
+	case errors.Is(err, service.ErrInvalidHook):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
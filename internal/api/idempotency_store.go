@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ginsys/shelly-manager/internal/api/middleware"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// dbIdempotencyStore keeps idempotency keys in the database, so a retry is
+// recognised across restarts and by every instance sharing the database
+type dbIdempotencyStore struct {
+	db *gorm.DB
+}
+
+// newIdempotencyStore uses the database when the handler has one and falls
+// back to memory otherwise
+func newIdempotencyStore(handler *Handler) middleware.IdempotencyStore {
+	if handler != nil && handler.DB != nil {
+		if db := handler.DB.GetDB(); db != nil {
+			return &dbIdempotencyStore{db: db}
+		}
+	}
+	return middleware.NewMemoryIdempotencyStore()
+}
+
+// Begin implements middleware.IdempotencyStore. Claims are single
+// statements, so two instances receiving the same retry cannot both run it.
+func (s *dbIdempotencyStore) Begin(key, fingerprint string, ttl time.Duration) (*middleware.IdempotentResponse, error) {
+	now := time.Now()
+	if err := s.db.Where("expires_at < ?", now).Delete(&database.IdempotencyRecord{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to expire idempotency keys: %w", err)
+	}
+
+	record := database.IdempotencyRecord{KeyHash: key, Fingerprint: fingerprint, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to claim idempotency key: %w", result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return nil, nil
+	}
+
+	var existing database.IdempotencyRecord
+	if err := s.db.Where("key_hash = ?", key).First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Released or expired meanwhile; the client may retry
+			return nil, middleware.ErrIdempotencyInFlight
+		}
+		return nil, fmt.Errorf("failed to read idempotency key: %w", err)
+	}
+	switch {
+	case existing.Fingerprint != fingerprint:
+		return nil, middleware.ErrIdempotencyMismatch
+	case existing.Status != 0:
+		return &middleware.IdempotentResponse{
+			Status:      existing.Status,
+			ContentType: existing.ContentType,
+			Body:        existing.Body,
+		}, nil
+	}
+
+	// Take over a claim abandoned by a request that never completed
+	result = s.db.Model(&database.IdempotencyRecord{}).
+		Where("key_hash = ? AND status = 0 AND created_at < ?", key, now.Add(-middleware.IdempotencyClaimTimeout)).
+		Updates(map[string]interface{}{"created_at": now, "expires_at": record.ExpiresAt})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to claim idempotency key: %w", result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return nil, nil
+	}
+	return nil, middleware.ErrIdempotencyInFlight
+}
+
+// Complete implements middleware.IdempotencyStore
+func (s *dbIdempotencyStore) Complete(key string, resp *middleware.IdempotentResponse) error {
+	err := s.db.Model(&database.IdempotencyRecord{}).Where("key_hash = ?", key).
+		Updates(map[string]interface{}{"status": resp.Status, "content_type": resp.ContentType, "body": resp.Body}).Error
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release implements middleware.IdempotencyStore
+func (s *dbIdempotencyStore) Release(key string) error {
+	if err := s.db.Where("key_hash = ? AND status = 0", key).Delete(&database.IdempotencyRecord{}).Error; err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
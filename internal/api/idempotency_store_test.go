@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/api/middleware"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestIdempotencyKey_AddDeviceRetry(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	handler := NewHandlerWithLogger(db, nil, nil, nil, logging.GetDefault())
+	store := newIdempotencyStore(handler)
+	if _, ok := store.(*dbIdempotencyStore); !ok {
+		t.Fatalf("Expected the database store, got %T", store)
+	}
+	addDevice := middleware.IdempotencyMiddleware(middleware.DefaultSecurityConfig(), store, logging.GetDefault())(http.HandlerFunc(handler.AddDevice))
+
+	body := []byte(`{"ip":"192.168.1.50","mac":"A4:CF:12:00:00:50","type":"SHSW-1","name":"Porch"}`)
+	var responses []*httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/api/v1/devices", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(middleware.IdempotencyKeyHeader, "add-porch")
+		w := httptest.NewRecorder()
+		addDevice.ServeHTTP(w, req)
+		responses = append(responses, w)
+	}
+
+	// The retry replays the creation instead of failing on the duplicate IP
+	for _, w := range responses {
+		testutil.AssertEqual(t, http.StatusCreated, w.Code)
+	}
+	testutil.AssertEqual(t, "true", responses[1].Header().Get(middleware.IdempotentReplayedHeader))
+	testutil.AssertEqual(t, responses[0].Body.String(), responses[1].Body.String())
+	devices, err := db.GetDevices()
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqual(t, 1, len(devices))
+}
+
+func TestDBIdempotencyStore_Claims(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	store := &dbIdempotencyStore{db: db.GetDB()}
+
+	_, err := store.Begin("k", "f", time.Hour)
+	testutil.AssertNoError(t, err)
+	if _, err := store.Begin("k", "f", time.Hour); err != middleware.ErrIdempotencyInFlight {
+		t.Errorf("Expected in-flight error, got %v", err)
+	}
+	if _, err := store.Begin("k", "other", time.Hour); err != middleware.ErrIdempotencyMismatch {
+		t.Errorf("Expected mismatch error, got %v", err)
+	}
+
+	// An abandoned claim is taken over
+	old := time.Now().Add(-2 * middleware.IdempotencyClaimTimeout)
+	testutil.AssertNoError(t, db.GetDB().Model(&database.IdempotencyRecord{}).Where("key_hash = ?", "k").Update("created_at", old).Error)
+	_, err = store.Begin("k", "f", time.Hour)
+	testutil.AssertNoError(t, err)
+
+	testutil.AssertNoError(t, store.Complete("k", &middleware.IdempotentResponse{Status: 202, ContentType: "application/json", Body: []byte(`{}`)}))
+	resp, err := store.Begin("k", "f", time.Hour)
+	testutil.AssertNoError(t, err)
+	if resp == nil || resp.Status != 202 || string(resp.Body) != `{}` {
+		t.Errorf("Expected the stored response, got %+v", resp)
+	}
+
+	// Expired keys are dropped
+	_, err = store.Begin("short", "f", -time.Second)
+	testutil.AssertNoError(t, err)
+	_, err = store.Begin("short", "f", time.Hour)
+	testutil.AssertNoError(t, err)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// VerifyDeviceIdentities handles POST /api/v1/admin/identity/verify. It
+// probes every stored address and records the conflicts it finds; moves and
+// merges are only applied with ?fix=true.
+func (h *Handler) VerifyDeviceIdentities(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	fix := false
+	if v := r.URL.Query().Get("fix"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			h.responseWriter().WriteValidationError(w, r, "fix must be true or false")
+			return
+		}
+		fix = parsed
+	}
+	report, err := h.Service.VerifyDeviceIdentities(r.Context(), fix)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// GetIdentityConflicts handles GET /api/v1/admin/identity/conflicts and lists
+// the open identity conflicts, or all of them with ?all=true
+func (h *Handler) GetIdentityConflicts(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	conflicts, err := h.Service.ListIdentityConflicts(all)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]any{"conflicts": conflicts, "total": len(conflicts)})
+}
+
+// ResolveIdentityConflict handles POST
+// /api/v1/admin/identity/conflicts/{id}/resolve and marks a conflict reviewed
+func (h *Handler) ResolveIdentityConflict(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid conflict ID", nil)
+		return
+	}
+	conflict, err := h.Service.ResolveIdentityConflict(uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrIdentityConflictNotFound) {
+			h.responseWriter().WriteNotFoundError(w, r, "Identity conflict")
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, conflict)
+}
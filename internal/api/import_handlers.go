@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
 
 	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/database"
 	"github.com/ginsys/shelly-manager/internal/logging"
 	"github.com/ginsys/shelly-manager/internal/sync"
 )
@@ -35,20 +37,7 @@ func (ih *ImportHandlers) SetAdminAPIKey(key string) {
 }
 
 func (ih *ImportHandlers) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
-	if ih.adminAPIKey == "" {
-		return true
-	}
-	auth := r.Header.Get("Authorization")
-	xKey := r.Header.Get("X-API-Key")
-	ok := strings.HasPrefix(auth, "Bearer ") && strings.TrimPrefix(auth, "Bearer ") == ih.adminAPIKey
-	if !ok && xKey != "" && xKey == ih.adminAPIKey {
-		ok = true
-	}
-	if !ok {
-		apiresp.NewResponseWriter(ih.logger).WriteError(w, r, http.StatusUnauthorized, apiresp.ErrCodeUnauthorized, "Admin authorization required", nil)
-		return false
-	}
-	return true
+	return writeAdminAccess(apiresp.NewResponseWriter(ih.logger), w, r, ih.adminAPIKey)
 }
 
 // AddImportRoutes adds import routes to the router
@@ -56,6 +45,7 @@ func (ih *ImportHandlers) AddImportRoutes(api *mux.Router) {
 	// Backup import endpoints
 	api.HandleFunc("/import/backup", ih.RestoreBackup).Methods("POST")
 	api.HandleFunc("/import/backup/validate", ih.ValidateBackup).Methods("POST")
+	api.HandleFunc("/import/backup/verify-restore", ih.VerifyBackupRestore).Methods("POST")
 
 	// GitOps import endpoints
 	api.HandleFunc("/import/gitops", ih.ImportGitOps).Methods("POST")
@@ -66,6 +56,10 @@ func (ih *ImportHandlers) AddImportRoutes(api *mux.Router) {
 	api.HandleFunc("/import/history/{id}", ih.GetImportHistory).Methods("GET")
 	api.HandleFunc("/import/statistics", ih.GetImportStatistics).Methods("GET")
 
+	// Manual-review queue for import conflicts
+	api.HandleFunc("/import/conflicts", ih.ListImportConflicts).Methods("GET")
+	api.HandleFunc("/import/conflicts/{id:[0-9]+}/resolve", ih.ResolveImportConflict).Methods("POST")
+
 	// Generic import endpoints (after history to avoid route collisions)
 	api.HandleFunc("/import", ih.Import).Methods("POST")
 	api.HandleFunc("/import/preview", ih.PreviewImport).Methods("POST")
@@ -168,6 +162,34 @@ func (ih *ImportHandlers) ValidateBackup(w http.ResponseWriter, r *http.Request)
 	apiresp.NewResponseWriter(ih.logger).WriteSuccess(w, r, result)
 }
 
+// VerifyBackupRestore checks that a backup could be restored by loading it
+// into a temporary database, leaving the live database untouched
+func (ih *ImportHandlers) VerifyBackupRestore(w http.ResponseWriter, r *http.Request) {
+	if !ih.requireAdmin(w, r) {
+		return
+	}
+
+	var requestBody struct {
+		BackupPath string `json:"backup_path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		apiresp.NewResponseWriter(ih.logger).WriteValidationError(w, r, "Invalid request body")
+		return
+	}
+	if requestBody.BackupPath == "" {
+		apiresp.NewResponseWriter(ih.logger).WriteValidationError(w, r, "backup_path is required")
+		return
+	}
+
+	result, err := ih.syncEngine.VerifyBackupRestore(r.Context(), requestBody.BackupPath)
+	if err != nil {
+		ih.logger.Error("Backup restore verification failed", "error", err)
+		ih.writeSyncError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(ih.logger).WriteSuccess(w, r, result)
+}
+
 // ImportGitOps imports a GitOps configuration
 func (ih *ImportHandlers) ImportGitOps(w http.ResponseWriter, r *http.Request) {
 	if !ih.requireAdmin(w, r) {
@@ -355,9 +377,11 @@ func (ih *ImportHandlers) writeSyncError(w http.ResponseWriter, r *http.Request,
 		errors.Is(err, sync.ErrPluginNotFound),
 		errors.Is(err, sync.ErrUnsupportedFormat),
 		errors.Is(err, sync.ErrInvalidImportData),
+		errors.Is(err, sync.ErrArtifactSignature),
 		errors.Is(err, sync.ErrInvalidExportData):
 		apiresp.NewResponseWriter(ih.logger).WriteValidationError(w, r, err.Error())
-	case errors.Is(err, sync.ErrImportNotImplemented):
+	case errors.Is(err, sync.ErrImportNotImplemented),
+		errors.Is(err, database.ErrRestoreVerificationUnsupported):
 		apiresp.NewResponseWriter(ih.logger).WriteError(
 			w, r, http.StatusNotImplemented, apiresp.ErrCodeNotImplemented, err.Error(), nil,
 		)
@@ -366,6 +390,66 @@ func (ih *ImportHandlers) writeSyncError(w http.ResponseWriter, r *http.Request,
 	}
 }
 
+// ListImportConflicts lists import conflicts queued for manual review
+func (ih *ImportHandlers) ListImportConflicts(w http.ResponseWriter, r *http.Request) {
+	if !ih.requireAdmin(w, r) {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", sync.ConflictStatusPending, sync.ConflictStatusAccepted, sync.ConflictStatusRejected:
+	default:
+		apiresp.NewResponseWriter(ih.logger).WriteValidationError(w, r, "status must be pending, accepted or rejected")
+		return
+	}
+
+	items, err := ih.syncEngine.ListImportConflicts(r.Context(), status)
+	if err != nil {
+		apiresp.NewResponseWriter(ih.logger).WriteInternalError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(ih.logger).WriteSuccess(w, r, map[string]interface{}{
+		"conflicts": items,
+		"total":     len(items),
+	})
+}
+
+// ResolveImportConflict accepts or rejects a queued import conflict
+func (ih *ImportHandlers) ResolveImportConflict(w http.ResponseWriter, r *http.Request) {
+	if !ih.requireAdmin(w, r) {
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		apiresp.NewResponseWriter(ih.logger).WriteValidationError(w, r, "Invalid conflict ID")
+		return
+	}
+
+	var requestBody struct {
+		Action string `json:"action"` // "accept" or "reject"
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		apiresp.NewResponseWriter(ih.logger).WriteValidationError(w, r, "Invalid request body")
+		return
+	}
+	if requestBody.Action != "accept" && requestBody.Action != "reject" {
+		apiresp.NewResponseWriter(ih.logger).WriteValidationError(w, r, "action must be accept or reject")
+		return
+	}
+
+	item, err := ih.syncEngine.ResolveImportConflict(r.Context(), uint(id), requestBody.Action == "accept", requesterFrom(r))
+	switch {
+	case errors.Is(err, sync.ErrConflictNotFound):
+		apiresp.NewResponseWriter(ih.logger).WriteNotFoundError(w, r, "Import conflict")
+	case errors.Is(err, sync.ErrConflictResolved):
+		apiresp.NewResponseWriter(ih.logger).WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict, err.Error(), nil)
+	case err != nil:
+		apiresp.NewResponseWriter(ih.logger).WriteInternalError(w, r, err)
+	default:
+		apiresp.NewResponseWriter(ih.logger).WriteSuccess(w, r, item)
+	}
+}
+
 // GetImportResult returns the result of an import operation
 func (ih *ImportHandlers) GetImportResult(w http.ResponseWriter, r *http.Request) {
 	if !ih.requireAdmin(w, r) {
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/intake"
+	"github.com/ginsys/shelly-manager/internal/service"
+	"github.com/ginsys/shelly-manager/internal/shellycloud"
+)
+
+// intakeView is the API representation of a pre-registered device. The AP
+// password is never returned; has_ap_password tells whether one is stored.
+type intakeView struct {
+	database.DeviceIntake
+	HasAPPassword bool `json:"has_ap_password"`
+}
+
+func newIntakeView(e database.DeviceIntake) intakeView {
+	return intakeView{DeviceIntake: e, HasAPPassword: e.APPassword != ""}
+}
+
+// intakeService returns the shared intake service, falling back to one bound
+// to the handler database when no Shelly service is configured
+func (h *Handler) intakeService() *intake.Service {
+	if h.Service != nil && h.Service.Intake != nil {
+		return h.Service.Intake
+	}
+	return intake.NewService(h.DB.GetDB(), h.logger)
+}
+
+// ListIntake handles GET /api/v1/intake?status=pending|seen|matched
+func (h *Handler) ListIntake(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	entries, err := h.intakeService().List(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	views := make([]intakeView, 0, len(entries))
+	for _, e := range entries {
+		views = append(views, newIntakeView(e))
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"devices": views,
+		"count":   len(views),
+	})
+}
+
+// RegisterIntake handles POST /api/v1/intake. The body carries either raw QR
+// code content in "qr", explicit label fields, or both (fields override the QR).
+func (h *Handler) RegisterIntake(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		QR string `json:"qr"`
+		intake.Label
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+
+	label := req.Label
+	source := intake.SourceManual
+	if strings.TrimSpace(req.QR) != "" {
+		parsed, err := intake.ParseLabel(req.QR)
+		if err != nil {
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+			return
+		}
+		label.Merge(parsed)
+		source = intake.SourceQR
+	}
+	if err := label.Normalize(); err != nil {
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+		return
+	}
+
+	entry, err := h.intakeService().Register(r.Context(), label, source)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteCreated(w, r, newIntakeView(*entry))
+}
+
+// ImportIntakeCSV handles POST /api/v1/intake/csv with body {"csv": "..."}
+func (h *Handler) ImportIntakeCSV(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		CSV string `json:"csv"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if strings.TrimSpace(req.CSV) == "" {
+		h.responseWriter().WriteValidationError(w, r, "csv content is required")
+		return
+	}
+
+	result, err := h.intakeService().ImportCSV(r.Context(), strings.NewReader(req.CSV))
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	views := make([]intakeView, 0, len(result.Registered))
+	for _, e := range result.Registered {
+		views = append(views, newIntakeView(e))
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"registered": views,
+		"count":      len(views),
+		"errors":     result.Errors,
+	})
+}
+
+// DeleteIntake handles DELETE /api/v1/intake/{id}
+func (h *Handler) DeleteIntake(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid intake ID")
+		return
+	}
+	if err := h.intakeService().Delete(r.Context(), uint(id)); err != nil {
+		if errors.Is(err, intake.ErrNotFound) {
+			h.responseWriter().WriteNotFoundError(w, r, "Intake entry")
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"deleted": id})
+}
+
+// ImportIntakeCloud handles POST /api/v1/intake/cloud with body
+// {"server": "...", "auth_key": "...", "dry_run": false}. It reads the devices
+// of a Shelly Cloud account (the configured one when server and auth_key are
+// omitted) and pre-registers those not yet in the inventory. A key given in
+// the body is used for this request only.
+func (h *Handler) ImportIntakeCloud(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.CloudImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if h.Service == nil {
+		h.responseWriter().WriteError(w, r, http.StatusServiceUnavailable, apiresp.ErrCodeServiceUnavailable, "Device service not available", nil)
+		return
+	}
+
+	result, err := h.Service.ImportCloudDevices(r.Context(), req)
+	if err != nil {
+		h.writeCloudError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, result)
+}
+
+// writeCloudError reports a Shelly Cloud failure: a missing or rejected key
+// is the caller's to fix, an unreachable cloud a gateway error
+func (h *Handler) writeCloudError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, shellycloud.ErrInvalidAccount), errors.Is(err, shellycloud.ErrUnauthorized):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	case errors.Is(err, shellycloud.ErrUnavailable):
+		h.responseWriter().WriteError(w, r, http.StatusBadGateway, apiresp.ErrCodeExternalServiceError, err.Error(), nil)
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// RelinkRequest names the device whose history moves and the device it moves
+// to
+type RelinkRequest struct {
+	FromDeviceID uint `json:"from_device_id"`
+	ToDeviceID   uint `json:"to_device_id"`
+}
+
+// GetIntegrityReport handles GET /api/v1/admin/integrity and lists the rows
+// that refer to deleted devices without changing anything
+func (h *Handler) GetIntegrityReport(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	report, err := h.Service.CheckIntegrity(false)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// CleanupIntegrity handles POST /api/v1/admin/integrity/cleanup and deletes
+// the rows that refer to deleted devices
+func (h *Handler) CleanupIntegrity(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	report, err := h.Service.CheckIntegrity(true)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// RelinkDeviceHistory handles POST /api/v1/admin/integrity/relink and moves
+// the history of a replaced or deleted device to another device
+func (h *Handler) RelinkDeviceHistory(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req RelinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	relinked, err := h.Service.RelinkDeviceHistory(req.FromDeviceID, req.ToDeviceID)
+	if err != nil {
+		if errors.Is(err, database.ErrRelinkTarget) {
+			h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, err.Error(), nil)
+			return
+		}
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]any{
+		"from_device_id": req.FromDeviceID,
+		"to_device_id":   req.ToDeviceID,
+		"tables":         relinked,
+	})
+}
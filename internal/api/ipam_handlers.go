@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// ListSubnets handles GET /api/v1/ipam/subnets
+func (h *Handler) ListSubnets(w http.ResponseWriter, r *http.Request) {
+	subnets, err := h.Service.ListSubnets()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"subnets": subnets,
+		"count":   len(subnets),
+	})
+}
+
+// CreateSubnet handles POST /api/v1/ipam/subnets
+func (h *Handler) CreateSubnet(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var subnet database.IPSubnet
+	if err := json.NewDecoder(r.Body).Decode(&subnet); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if err := h.Service.CreateSubnet(&subnet); err != nil {
+		h.writeIPAMError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteCreated(w, r, subnet)
+}
+
+// DeleteSubnet handles DELETE /api/v1/ipam/subnets/{id}
+func (h *Handler) DeleteSubnet(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.ipamID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.Service.DeleteSubnet(id); err != nil {
+		h.writeIPAMError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"deleted": id})
+}
+
+// AddReservedRange handles POST /api/v1/ipam/subnets/{id}/ranges
+func (h *Handler) AddReservedRange(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.ipamID(w, r, "id")
+	if !ok {
+		return
+	}
+	var rng database.IPReservedRange
+	if err := json.NewDecoder(r.Body).Decode(&rng); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if err := h.Service.AddReservedRange(id, &rng); err != nil {
+		h.writeIPAMError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteCreated(w, r, rng)
+}
+
+// DeleteReservedRange handles DELETE /api/v1/ipam/subnets/{id}/ranges/{range_id}
+func (h *Handler) DeleteReservedRange(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.ipamID(w, r, "id")
+	if !ok {
+		return
+	}
+	rangeID, ok := h.ipamID(w, r, "range_id")
+	if !ok {
+		return
+	}
+	if err := h.Service.DeleteReservedRange(id, rangeID); err != nil {
+		h.writeIPAMError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"deleted": rangeID})
+}
+
+// GetFreeAddresses handles GET /api/v1/ipam/subnets/{id}/free?count= and
+// suggests addresses no device uses
+func (h *Handler) GetFreeAddresses(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.ipamID(w, r, "id")
+	if !ok {
+		return
+	}
+	count := 0
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			h.responseWriter().WriteValidationError(w, r, "count must be a positive integer")
+			return
+		}
+		count = n
+	}
+	free, err := h.Service.FreeAddresses(id, count)
+	if err != nil {
+		h.writeIPAMError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"addresses": free,
+		"count":     len(free),
+	})
+}
+
+// GetIPPlan handles GET /api/v1/ipam/plan. It returns subnet usage, the
+// addressing of every device and the conflicts found.
+func (h *Handler) GetIPPlan(w http.ResponseWriter, r *http.Request) {
+	report, err := h.Service.IPPlan()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// GenerateIPPlan handles POST /api/v1/ipam/plan/generate. It assigns static
+// addresses in a subnet and returns the device network configuration and
+// DHCP reservation for each device without applying them.
+func (h *Handler) GenerateIPPlan(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.IPPlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	if req.SubnetID == 0 {
+		h.responseWriter().WriteValidationError(w, r, "subnet_id is required")
+		return
+	}
+	changes, err := h.Service.GenerateIPPlan(req)
+	if err != nil {
+		h.writeIPAMError(w, r, err)
+		return
+	}
+	changed := 0
+	for _, c := range changes {
+		if c.Changed {
+			changed++
+		}
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"changes": changes,
+		"total":   len(changes),
+		"changed": changed,
+	})
+}
+
+// ipamID parses a numeric path variable
+func (h *Handler) ipamID(w http.ResponseWriter, r *http.Request, name string) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)[name], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid "+name, nil)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// writeIPAMError maps subnet errors to 404 and validation errors to 400
+func (h *Handler) writeIPAMError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrSubnetNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Subnet")
+	case errors.Is(err, service.ErrDeviceNotFound), errors.Is(err, service.ErrInvalidIPPlan):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// defaultLatencyHours is the period latency summaries cover by default
+const defaultLatencyHours = 24
+
+// latencyHours reads the hours query parameter
+func latencyHours(r *http.Request) int {
+	hours := parseIntDefault(r.URL.Query().Get("hours"), defaultLatencyHours)
+	if hours <= 0 {
+		return defaultLatencyHours
+	}
+	return hours
+}
+
+// GetLatencySummaries handles GET /api/v1/metrics/latency with each device's
+// status request latency, failures and link state over the last ?hours=
+func (h *Handler) GetLatencySummaries(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	hours := latencyHours(r)
+	summaries, err := h.Service.LatencySummaries(hours)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"hours":   hours,
+		"devices": summaries,
+	})
+}
+
+// GetDeviceLatencyTrend handles GET /api/v1/metrics/devices/{id}/latency
+// with the device's latency and failures over the last ?hours=, per hour or
+// day as ?resolution= selects
+func (h *Handler) GetDeviceLatencyTrend(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid device ID", nil)
+		return
+	}
+	trend, err := h.Service.DeviceLatencyTrend(uint(id), latencyHours(r), r.URL.Query().Get("resolution"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidLatencyResolution):
+			h.responseWriter().WriteValidationError(w, r, err.Error())
+		case errors.Is(err, service.ErrDeviceNotFound):
+			h.responseWriter().WriteNotFoundError(w, r, "Device")
+		default:
+			h.responseWriter().WriteInternalError(w, r, err)
+		}
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, trend)
+}
+
+// GetNetworkReport handles GET /api/v1/reports/network. It lists the ?limit=
+// devices with the worst network performance over the last ?hours=: dead
+// devices first, then by packet loss and average latency.
+func (h *Handler) GetNetworkReport(w http.ResponseWriter, r *http.Request) {
+	limit := parseIntDefault(r.URL.Query().Get("limit"), 10)
+	report, err := h.Service.NetworkReport(latencyHours(r), limit)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
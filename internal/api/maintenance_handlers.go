@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// ListMaintenance handles GET /api/v1/devices/maintenance with the devices
+// under planned maintenance
+func (h *Handler) ListMaintenance(w http.ResponseWriter, r *http.Request) {
+	windows, err := h.Service.MaintenanceWindows()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"devices": windows,
+		"total":   len(windows),
+	})
+}
+
+// SetMaintenance handles POST /api/v1/devices/maintenance. It puts the
+// devices selected by device_ids or tag into maintenance until the optional
+// until time or for minutes; their alerts are held back meanwhile.
+func (h *Handler) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	windows, err := h.Service.SetMaintenance(req)
+	if err != nil {
+		h.writeMaintenanceError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"devices": windows,
+		"total":   len(windows),
+	})
+}
+
+// ClearMaintenance handles POST /api/v1/devices/maintenance/clear, ending the
+// maintenance of the devices selected by device_ids or tag
+func (h *Handler) ClearMaintenance(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	cleared, err := h.Service.ClearMaintenance(req)
+	if err != nil {
+		h.writeMaintenanceError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"cleared": cleared,
+	})
+}
+
+// writeMaintenanceError maps maintenance service errors to responses
+func (h *Handler) writeMaintenanceError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrDeviceNotFound) || errors.Is(err, service.ErrInvalidMaintenanceRequest) {
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+		return
+	}
+	h.responseWriter().WriteInternalError(w, r, err)
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
+)
+
+// AuthPathPrefix holds the sign-in endpoints, which stay reachable without
+// a session
+const AuthPathPrefix = "/api/v1/auth/"
+
+// AuthMiddleware attaches the signed-in user of a request to its context.
+// Invalid tokens and sessions are rejected; viewers may only read. When
+// authentication is required, requests with neither a user nor the admin
+// API key are rejected. adminKey returns the current admin API key, which
+// can be rotated at runtime.
+func AuthMiddleware(authn *auth.Authenticator, adminKey func() string, logger *logging.Logger) func(http.Handler) http.Handler {
+	respWriter := response.NewResponseWriter(logger)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := auth.WithEnabled(r.Context())
+			authPath := strings.HasPrefix(r.URL.Path, AuthPathPrefix)
+
+			principal, err := authn.Authenticate(r)
+			if err != nil && !authPath {
+				logger.WithFields(map[string]any{
+					"path":      r.URL.Path,
+					"method":    r.Method,
+					"error":     err.Error(),
+					"component": "auth",
+					"event":     "authentication_failed",
+				}).Warn("Authentication failed")
+				respWriter.WriteError(w, r, http.StatusUnauthorized, response.ErrCodeUnauthorized, "Invalid or expired credentials", nil)
+				return
+			}
+
+			if principal != nil {
+				if !principal.CanWrite() && !isReadOnly(r) && !authPath {
+					respWriter.WriteError(w, r, http.StatusForbidden, response.ErrCodeForbidden, "Role "+principal.Role+" may not change anything", nil)
+					return
+				}
+				ctx = auth.WithPrincipal(ctx, principal)
+			} else if authn.Required() && !authPath && r.Method != http.MethodOptions && !auth.AdminKeyOK(r, adminKey()) {
+				respWriter.WriteError(w, r, http.StatusUnauthorized, response.ErrCodeUnauthorized, "Authentication required", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// isReadOnly reports whether a request only reads. GET is not enough: the
+// Gen1-compatible relay endpoint switches relays on GET
+// /api/v1/compat/{device}/relay/{channel}?turn=on, as devices do.
+func isReadOnly(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodGet:
+		return !isCompatRelayCommand(r)
+	default:
+		return false
+	}
+}
+
+// isCompatRelayCommand reports whether a request to the Gen1-compatible
+// relay endpoint carries a command
+func isCompatRelayCommand(r *http.Request) bool {
+	rest, ok := strings.CutPrefix(r.URL.Path, "/api/v1/compat/")
+	if !ok {
+		return false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 || parts[1] != "relay" {
+		return false
+	}
+	q := r.URL.Query()
+	return q.Has("turn") || q.Has("timer")
+}
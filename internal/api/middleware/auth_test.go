@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	logger, _ := logging.New(logging.Config{Level: "debug", Format: "text", Output: "stdout"})
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	authn, err := auth.New(config.AuthConfig{Required: true, InsecureCookies: true}, db, logger)
+	require.NoError(t, err)
+
+	var seen *auth.Principal
+	handler := AuthMiddleware(authn, func() string { return "admin-key" }, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = auth.FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// A viewer session, as the OIDC callback would start it
+	rec := httptest.NewRecorder()
+	require.NoError(t, authn.StartSession(rec, &auth.Principal{Username: "alice", Role: config.RoleViewer}))
+	session := rec.Result().Cookies()[0]
+
+	send := func(method, path string, prepare func(*http.Request)) int {
+		req := httptest.NewRequest(method, path, nil)
+		if prepare != nil {
+			prepare(req)
+		}
+		rec := httptest.NewRecorder()
+		seen = nil
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	withSession := func(r *http.Request) { r.AddCookie(session) }
+
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/v1/devices", nil))
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/v1/auth/config", nil))
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/v1/devices", func(r *http.Request) {
+		r.Header.Set("X-API-Key", "admin-key")
+	}))
+
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/v1/devices", withSession))
+	require.NotNil(t, seen)
+	assert.Equal(t, "alice", seen.Username)
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "/api/v1/devices", withSession))
+
+	// Gen1-compatible relay commands are writes even on GET
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/v1/compat/kitchen/relay/0", withSession))
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/api/v1/compat/kitchen/relay/0?turn=on", withSession))
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/api/v1/compat/kitchen/relay/0?timer=10", withSession))
+
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/v1/devices", func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: config.DefaultAuthSessionCookie, Value: "unknown", Expires: time.Now().Add(time.Hour)})
+	}))
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/v1/devices", func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer a.b.c")
+	}))
+}
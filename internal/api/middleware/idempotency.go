@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
+)
+
+// Idempotency headers
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// IdempotencyClaimTimeout is how long a key stays claimed by a request that
+// never completed, e.g. because the instance handling it stopped
+const IdempotencyClaimTimeout = 5 * time.Minute
+
+var (
+	// ErrIdempotencyInFlight is returned while the first request with a key
+	// is still being processed
+	ErrIdempotencyInFlight = errors.New("a request with this idempotency key is in progress")
+	// ErrIdempotencyMismatch is returned when a key is reused for a
+	// different request
+	ErrIdempotencyMismatch = errors.New("idempotency key was used for a different request")
+)
+
+// IdempotentResponse is a stored response replayed on retries
+type IdempotentResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyStore keeps the first response per idempotency key
+type IdempotencyStore interface {
+	// Begin claims a key for a request fingerprint. It returns the stored
+	// response if the key completed before, ErrIdempotencyInFlight while it
+	// is claimed, and ErrIdempotencyMismatch for a different fingerprint.
+	Begin(key, fingerprint string, ttl time.Duration) (*IdempotentResponse, error)
+	// Complete stores the response for a claimed key
+	Complete(key string, resp *IdempotentResponse) error
+	// Release drops a claim so the request can be retried
+	Release(key string) error
+}
+
+// MemoryIdempotencyStore keeps idempotency keys in memory. Keys are lost on
+// restart and not shared between instances.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryIdempotencyEntry
+}
+
+type memoryIdempotencyEntry struct {
+	fingerprint string
+	claimedAt   time.Time
+	expiresAt   time.Time
+	response    *IdempotentResponse
+}
+
+// NewMemoryIdempotencyStore creates an in-memory idempotency store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: map[string]*memoryIdempotencyEntry{}}
+}
+
+// Begin implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Begin(key, fingerprint string, ttl time.Duration) (*IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, e := range s.entries {
+		if now.After(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	if e, ok := s.entries[key]; ok {
+		switch {
+		case e.fingerprint != fingerprint:
+			return nil, ErrIdempotencyMismatch
+		case e.response != nil:
+			return e.response, nil
+		case now.Sub(e.claimedAt) < IdempotencyClaimTimeout:
+			return nil, ErrIdempotencyInFlight
+		}
+	}
+	s.entries[key] = &memoryIdempotencyEntry{fingerprint: fingerprint, claimedAt: now, expiresAt: now.Add(ttl)}
+	return nil, nil
+}
+
+// Complete implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Complete(key string, resp *IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.response = resp
+	}
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// IdempotencyMiddleware replays the first response of a POST request carrying
+// an Idempotency-Key header when a client retries it, instead of running it
+// again. Keys are scoped to the caller's credentials, method and path.
+// Server errors and confirmation challenges are not stored, so a failed
+// request can be retried and a confirmed one runs.
+func IdempotencyMiddleware(config *SecurityConfig, store IdempotencyStore, logger *logging.Logger) func(http.Handler) http.Handler {
+	respWriter := response.NewResponseWriter(logger)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if r.Method != http.MethodPost || key == "" || store == nil || config.IdempotencyTTL <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				respWriter.WriteValidationError(w, r, "Idempotency-Key must be at most 255 characters")
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				respWriter.WriteValidationError(w, r, "Failed to read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scoped := idempotencyScope(r, key)
+			fingerprint := hashParts(r.URL.RawQuery, string(body))
+			stored, err := store.Begin(scoped, fingerprint, config.IdempotencyTTL)
+			switch {
+			case errors.Is(err, ErrIdempotencyMismatch):
+				respWriter.WriteError(w, r, http.StatusUnprocessableEntity, response.ErrCodeValidationFailed, err.Error(), nil)
+				return
+			case errors.Is(err, ErrIdempotencyInFlight):
+				respWriter.WriteError(w, r, http.StatusConflict, response.ErrCodeConflict, err.Error(), nil)
+				return
+			case err != nil:
+				// Without the store the request runs as if no key was sent
+				logger.WithFields(map[string]any{
+					"error":     err.Error(),
+					"component": "idempotency",
+				}).Warn("Idempotency store unavailable")
+				next.ServeHTTP(w, r)
+				return
+			case stored != nil:
+				if stored.ContentType != "" {
+					w.Header().Set("Content-Type", stored.ContentType)
+				}
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(stored.Status)
+				_, _ = w.Write(stored.Body)
+				return
+			}
+
+			rec := &idempotencyRecorder{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				// A panic or server error leaves the key free for a retry
+				if !completed {
+					_ = store.Release(scoped)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+
+			// A confirmation challenge is answered by repeating the request
+			// with a token header, which must not replay the challenge
+			if rec.status >= http.StatusInternalServerError || rec.status == http.StatusTooManyRequests ||
+				rec.status == http.StatusPreconditionRequired {
+				return
+			}
+			if err := store.Complete(scoped, &IdempotentResponse{
+				Status:      rec.status,
+				ContentType: rec.Header().Get("Content-Type"),
+				Body:        rec.body.Bytes(),
+			}); err != nil {
+				logger.WithFields(map[string]any{
+					"error":     err.Error(),
+					"component": "idempotency",
+				}).Warn("Failed to store idempotent response")
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// idempotencyScope binds a key to the caller, method and path, so one client
+// cannot replay another's responses. The caller is the signed-in user put in
+// the context by AuthMiddleware, whatever carried the session; requests
+// without one are told apart by their API credentials.
+func idempotencyScope(r *http.Request, key string) string {
+	if p := auth.FromContext(r.Context()); p != nil && p.Subject != "" {
+		return hashParts("principal", p.Backend, p.Subject, r.Method, r.URL.Path, key)
+	}
+	credentials := r.Header.Get("Authorization") + "\n" + r.Header.Get("X-API-Key")
+	return hashParts("credentials", credentials, r.Method, r.URL.Path, key)
+}
+
+func hashParts(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		_, _ = io.WriteString(h, strconv.Itoa(len(p))+":"+p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotencyRecorder passes a response through and keeps a copy
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
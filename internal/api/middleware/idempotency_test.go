@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	logger, _ := logging.New(logging.Config{Level: "debug", Format: "text", Output: "stdout"})
+	config := DefaultSecurityConfig()
+
+	calls := 0
+	status := http.StatusCreated
+	handler := IdempotencyMiddleware(config, NewMemoryIdempotencyStore(), logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+
+	send := func(key, body, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/devices", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send("k1", `{"ip":"10.0.0.5"}`, "")
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+
+	retry := send("k1", `{"ip":"10.0.0.5"}`, "")
+	require.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, `{"id":1}`, retry.Body.String())
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+	assert.Equal(t, 1, calls)
+
+	// The same key with another body is rejected
+	assert.Equal(t, http.StatusUnprocessableEntity, send("k1", `{"ip":"10.0.0.6"}`, "").Code)
+
+	// Keys are scoped to the caller and requests without a key always run
+	assert.Equal(t, http.StatusCreated, send("k1", `{"ip":"10.0.0.5"}`, "Bearer other").Code)
+	send("", `{"ip":"10.0.0.5"}`, "")
+	assert.Equal(t, 3, calls)
+
+	// Server errors are not stored, so the retry runs again
+	status = http.StatusInternalServerError
+	send("k2", `{}`, "")
+	status = http.StatusCreated
+	assert.Equal(t, http.StatusCreated, send("k2", `{}`, "").Code)
+	assert.Equal(t, 5, calls)
+
+	// Neither are confirmation challenges, so the confirmed retry runs
+	status = http.StatusPreconditionRequired
+	send("k3", `{}`, "")
+	status = http.StatusCreated
+	assert.Equal(t, http.StatusCreated, send("k3", `{}`, "").Code)
+	assert.Equal(t, 7, calls)
+
+	assert.Equal(t, http.StatusBadRequest, send(strings.Repeat("x", 256), `{}`, "").Code)
+}
+
+func TestIdempotencyMiddleware_SessionPrincipals(t *testing.T) {
+	logger, _ := logging.New(logging.Config{Level: "error", Format: "text", Output: "stdout"})
+
+	calls := 0
+	handler := IdempotencyMiddleware(DefaultSecurityConfig(), NewMemoryIdempotencyStore(), logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"owner":"` + auth.FromContext(r.Context()).Username + `"}`))
+	}))
+
+	// Session users carry only a cookie, identical in shape for everyone
+	send := func(p *auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/devices", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "shared-key")
+		req.AddCookie(&http.Cookie{Name: "session", Value: "opaque"})
+		req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	alice := &auth.Principal{Subject: "oidc|alice", Username: "alice", Backend: "oidc"}
+	bob := &auth.Principal{Subject: "oidc|bob", Username: "bob", Backend: "oidc"}
+
+	assert.Equal(t, `{"owner":"alice"}`, send(alice).Body.String())
+	second := send(bob)
+	assert.Equal(t, `{"owner":"bob"}`, second.Body.String())
+	assert.Empty(t, second.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 2, calls)
+
+	// The same user retrying is replayed
+	retry := send(alice)
+	assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, `{"owner":"alice"}`, retry.Body.String())
+	assert.Equal(t, 2, calls)
+}
+
+func TestMemoryIdempotencyStore_InFlight(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	resp, err := store.Begin("k", "f", DefaultSecurityConfig().IdempotencyTTL)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	_, err = store.Begin("k", "f", DefaultSecurityConfig().IdempotencyTTL)
+	assert.ErrorIs(t, err, ErrIdempotencyInFlight)
+
+	require.NoError(t, store.Release("k"))
+	_, err = store.Begin("k", "f", DefaultSecurityConfig().IdempotencyTTL)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"mime"
+	"strings"
+)
+
+// Route classes with their own request body limits
+const (
+	RouteClassDefault = "default"
+	RouteClassConfig  = "config"
+	RouteClassImport  = "import"
+)
+
+// RequestLimit caps request bodies for one class of routes. Paths are matched
+// by prefix, segment by segment; a {placeholder} segment matches any value.
+type RequestLimit struct {
+	Class        string   // reported in 413/415 errors
+	PathPrefixes []string // e.g. "/api/v1/devices/{id}/config"
+	MaxBytes     int64    // maximum body size; 0 falls back to MaxRequestSize
+	ContentTypes []string // allowed media types; empty allows any
+}
+
+// DefaultRequestLimits returns the built-in route classes: configuration
+// updates take small JSON bodies, imports take larger JSON, text or multipart
+// uploads. Everything else uses MaxRequestSize.
+func DefaultRequestLimits() []RequestLimit {
+	return []RequestLimit{
+		{
+			Class: RouteClassConfig,
+			PathPrefixes: []string{
+				"/api/v1/config",
+				"/api/v1/devices/{id}/config",
+				"/api/v1/devices/{id}/desired-config",
+			},
+			MaxBytes:     1024 * 1024, // 1MB
+			ContentTypes: []string{"application/json", "application/json-patch+json", "application/merge-patch+json"},
+		},
+		{
+			Class: RouteClassImport,
+			PathPrefixes: []string{
+				"/api/v1/import",
+				"/api/v1/intake/csv",
+				"/api/v1/config/bulk-import",
+			},
+			MaxBytes:     10 * 1024 * 1024, // 10MB
+			ContentTypes: []string{"application/json", "multipart/form-data", "text/plain"},
+		},
+	}
+}
+
+// SetClassLimit overrides the body size limit of a route class. The default
+// class sets MaxRequestSize; unknown classes are ignored.
+func (c *SecurityConfig) SetClassLimit(class string, maxBytes int64) {
+	if class == RouteClassDefault {
+		c.MaxRequestSize = maxBytes
+		return
+	}
+	for i := range c.RequestLimits {
+		if c.RequestLimits[i].Class == class {
+			c.RequestLimits[i].MaxBytes = maxBytes
+		}
+	}
+}
+
+// requestLimitFor returns the limit for a path: the rule with the longest
+// matching prefix, or the default class with MaxRequestSize
+func (c *SecurityConfig) requestLimitFor(path string) RequestLimit {
+	best := RequestLimit{Class: RouteClassDefault, MaxBytes: c.MaxRequestSize}
+	bestLen := -1
+	for _, rule := range c.RequestLimits {
+		for _, prefix := range rule.PathPrefixes {
+			if n := matchPathPrefix(prefix, path); n > bestLen {
+				best, bestLen = rule, n
+			}
+		}
+	}
+	if best.MaxBytes <= 0 {
+		best.MaxBytes = c.MaxRequestSize
+	}
+	return best
+}
+
+// allowsContentType reports whether the rule accepts a Content-Type header value
+func (l RequestLimit) allowsContentType(contentType string) (string, bool) {
+	if len(l.ContentTypes) == 0 || contentType == "" {
+		return "", true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// Malformed headers are reported by the content type validation
+		return "", true
+	}
+	for _, allowed := range l.ContentTypes {
+		if strings.EqualFold(allowed, mediaType) {
+			return mediaType, true
+		}
+	}
+	return mediaType, false
+}
+
+// matchPathPrefix returns the number of segments in pattern when it is a
+// segment-wise prefix of path, or -1
+func matchPathPrefix(pattern, path string) int {
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	have := strings.Split(strings.Trim(path, "/"), "/")
+	if len(have) < len(want) {
+		return -1
+	}
+	for i, seg := range want {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			continue
+		}
+		if seg != have[i] {
+			return -1
+		}
+	}
+	return len(want)
+}
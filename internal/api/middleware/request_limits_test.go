@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+func TestRequestLimitFor(t *testing.T) {
+	config := DefaultSecurityConfig()
+
+	tests := []struct {
+		path  string
+		class string
+	}{
+		{"/api/v1/devices/12/config", RouteClassConfig},
+		{"/api/v1/devices/12/config/relay", RouteClassConfig},
+		{"/api/v1/config/templates", RouteClassConfig},
+		{"/api/v1/config/bulk-import", RouteClassImport},
+		{"/api/v1/import/backup", RouteClassImport},
+		{"/api/v1/intake/csv", RouteClassImport},
+		{"/api/v1/devices/12/control", RouteClassDefault},
+		{"/api/v1/configuration", RouteClassDefault},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.class, config.requestLimitFor(tt.path).Class, tt.path)
+	}
+
+	config.SetClassLimit(RouteClassImport, 42)
+	assert.Equal(t, int64(42), config.requestLimitFor("/api/v1/import").MaxBytes)
+	config.SetClassLimit(RouteClassDefault, 7)
+	assert.Equal(t, int64(7), config.requestLimitFor("/api/v1/devices").MaxBytes)
+}
+
+func TestRequestSizeMiddleware_RouteClasses(t *testing.T) {
+	logger, _ := logging.New(logging.Config{Level: "debug", Format: "text", Output: "stdout"})
+	config := DefaultSecurityConfig()
+	config.MaxRequestSize = 64
+	config.SetClassLimit(RouteClassConfig, 128)
+	config.SetClassLimit(RouteClassImport, 1024)
+
+	handler := RequestSizeMiddleware(config, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		size        int
+		status      int
+		class       string
+	}{
+		{"default within limit", "/api/v1/devices/control", "application/json", 60, http.StatusOK, ""},
+		{"default over limit", "/api/v1/devices/control", "application/json", 100, http.StatusRequestEntityTooLarge, RouteClassDefault},
+		{"config allows larger body", "/api/v1/devices/3/config", "application/json", 100, http.StatusOK, ""},
+		{"config rejects multipart", "/api/v1/devices/3/config", "multipart/form-data; boundary=x", 10, http.StatusUnsupportedMediaType, RouteClassConfig},
+		{"import accepts multipart", "/api/v1/import/backup", "multipart/form-data; boundary=x", 900, http.StatusOK, ""},
+		{"import over limit", "/api/v1/import/backup", "application/json", 2000, http.StatusRequestEntityTooLarge, RouteClassImport},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(strings.Repeat("x", tt.size)))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tt.status, rr.Code)
+			if tt.class == "" {
+				return
+			}
+			var body struct {
+				Success bool `json:"success"`
+				Error   struct {
+					Code    string                 `json:"code"`
+					Details map[string]interface{} `json:"details"`
+				} `json:"error"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			assert.False(t, body.Success)
+			assert.NotEmpty(t, body.Error.Code)
+			assert.Equal(t, tt.class, body.Error.Details["route_class"])
+		})
+	}
+
+	t.Run("chunked body over limit", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/devices/control", strings.NewReader(strings.Repeat("x", 100)))
+		req.ContentLength = -1
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	})
+}
@@ -14,6 +14,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ginsys/shelly-manager/internal/api/response"
 	"github.com/ginsys/shelly-manager/internal/logging"
 )
 
@@ -35,8 +36,11 @@ type SecurityConfig struct {
 	RateLimitByPath map[string]int // path-specific rate limits
 
 	// Request limits
-	MaxRequestSize int64         // maximum request body size in bytes
-	RequestTimeout time.Duration // maximum request processing time
+	MaxRequestSize int64          // maximum request body size in bytes
+	RequestLimits  []RequestLimit // per-route-class body size and content type limits
+	RequestTimeout time.Duration  // maximum request processing time
+	UntimedPaths   []string       // path suffixes exempt from RequestTimeout: downloads and streamed exports
+	IdempotencyTTL time.Duration  // how long Idempotency-Key responses are replayed; 0 disables
 
 	// Security headers
 	EnableHSTS        bool   // enable Strict-Transport-Security
@@ -74,14 +78,17 @@ func DefaultSecurityConfig() *SecurityConfig {
 			"/api/v1/provisioning":         50,  // provisioning endpoints
 			"/api/v1/config/bulk":          20,  // bulk operations
 		},
-		MaxRequestSize:     10 * 1024 * 1024, // 10MB
+		MaxRequestSize:     1024 * 1024, // 1MB
+		RequestLimits:      DefaultRequestLimits(),
 		RequestTimeout:     30 * time.Second,
+		UntimedPaths:       []string{"/download", "/export/stream"},
+		IdempotencyTTL:     24 * time.Hour,
 		EnableHSTS:         false,    // disabled by default, enable for HTTPS
 		HSTSMaxAge:         31536000, // 1 year
 		PermissionsPolicy:  "geolocation=(), camera=(), microphone=(), payment=()",
 		CORSAllowedOrigins: nil,
-		CORSAllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		CORSAllowedHeaders: []string{"Content-Type", "Authorization", "X-Requested-With"},
+		CORSAllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		CORSAllowedHeaders: []string{"Content-Type", "Authorization", "X-Requested-With", "Idempotency-Key", "X-Request-ID", "X-Confirmation-Token", "X-Change-Request", "X-User-ID"},
 		CORSMaxAge:         86400,
 		LogSecurityEvents:  true,
 		LogAllRequests:     false,     // enable for debugging
@@ -316,19 +323,39 @@ func RateLimitMiddleware(config *SecurityConfig, logger *logging.Logger) func(ht
 	}
 }
 
-// RequestSizeMiddleware limits request body size
+// RequestSizeMiddleware limits request body size per route class and rejects
+// content types the class does not accept, with structured 413/415 errors
 func RequestSizeMiddleware(config *SecurityConfig, logger *logging.Logger) func(http.Handler) http.Handler {
+	respWriter := response.NewResponseWriter(logger)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := config.requestLimitFor(r.URL.Path)
+
+			if r.ContentLength != 0 {
+				if mediaType, ok := limit.allowsContentType(r.Header.Get("Content-Type")); !ok {
+					logRequestLimitEvent(config, logger, r, limit, "unsupported_content_type")
+					respWriter.WriteError(w, r, http.StatusUnsupportedMediaType,
+						response.ErrCodeUnsupportedMedia,
+						fmt.Sprintf("Unsupported content type for %s routes: %s", limit.Class, mediaType),
+						map[string]interface{}{
+							"route_class":   limit.Class,
+							"allowed_types": limit.ContentTypes,
+						})
+					return
+				}
+			}
+
 			// Limit request body size
-			if config.MaxRequestSize > 0 {
+			if limit.MaxBytes > 0 {
 				// If Content-Length is known and exceeds the limit, reject immediately
-				if r.ContentLength > 0 && r.ContentLength > config.MaxRequestSize {
-					w.WriteHeader(http.StatusRequestEntityTooLarge)
+				if r.ContentLength > 0 && r.ContentLength > limit.MaxBytes {
+					logRequestLimitEvent(config, logger, r, limit, "request_too_large")
+					WriteRequestTooLarge(respWriter, w, r, limit.Class, limit.MaxBytes)
 					return
 				}
 				// Otherwise wrap the body to enforce a hard cap during reads
-				r.Body = http.MaxBytesReader(w, r.Body, config.MaxRequestSize)
+				r.Body = http.MaxBytesReader(w, r.Body, limit.MaxBytes)
 			}
 
 			next.ServeHTTP(w, r)
@@ -336,6 +363,34 @@ func RequestSizeMiddleware(config *SecurityConfig, logger *logging.Logger) func(
 	}
 }
 
+// WriteRequestTooLarge writes the structured 413 response for a body over its limit
+func WriteRequestTooLarge(respWriter *response.ResponseWriter, w http.ResponseWriter, r *http.Request, class string, maxBytes int64) {
+	details := map[string]interface{}{"max_bytes": maxBytes}
+	if class != "" {
+		details["route_class"] = class
+	}
+	respWriter.WriteError(w, r, http.StatusRequestEntityTooLarge, response.ErrCodeRequestTooLarge,
+		fmt.Sprintf("Request body exceeds %d bytes", maxBytes), details)
+}
+
+// logRequestLimitEvent records a rejected request as a security event
+func logRequestLimitEvent(config *SecurityConfig, logger *logging.Logger, r *http.Request, limit RequestLimit, event string) {
+	if logger == nil || !config.LogSecurityEvents {
+		return
+	}
+	logger.WithFields(map[string]any{
+		"method":         r.Method,
+		"path":           r.URL.Path,
+		"client_ip":      getClientIP(r),
+		"content_type":   r.Header.Get("Content-Type"),
+		"content_length": r.ContentLength,
+		"route_class":    limit.Class,
+		"max_bytes":      limit.MaxBytes,
+		"component":      "request_limits",
+		"security_event": event,
+	}).Warn("Request rejected by body limits")
+}
+
 // SecurityLoggingMiddleware provides comprehensive request/response logging for security monitoring
 func SecurityLoggingMiddleware(config *SecurityConfig, logger *logging.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -347,10 +402,11 @@ func SecurityLoggingMiddleware(config *SecurityConfig, logger *logging.Logger) f
 
 			start := time.Now()
 			clientIP := getClientIP(r)
+			log := logger.WithContext(r.Context())
 
 			// Log request details for security monitoring
 			if config.LogAllRequests || config.LogSecurityEvents {
-				logger.WithFields(map[string]any{
+				log.WithFields(map[string]any{
 					"method":       r.Method,
 					"path":         r.URL.Path,
 					"client_ip":    clientIP,
@@ -364,7 +420,7 @@ func SecurityLoggingMiddleware(config *SecurityConfig, logger *logging.Logger) f
 
 			// Check for suspicious patterns
 			if detectSuspiciousRequest(r) {
-				logger.WithFields(map[string]any{
+				log.WithFields(map[string]any{
 					"method":         r.Method,
 					"path":           r.URL.Path,
 					"client_ip":      clientIP,
@@ -386,7 +442,7 @@ func SecurityLoggingMiddleware(config *SecurityConfig, logger *logging.Logger) f
 			// Log response details
 			duration := time.Since(start).Milliseconds()
 			if config.LogAllRequests || (config.LogSecurityEvents && (wrapped.statusCode >= 400 || wrapped.statusCode == 401 || wrapped.statusCode == 403)) {
-				logger.WithFields(map[string]any{
+				log.WithFields(map[string]any{
 					"method":        r.Method,
 					"path":          r.URL.Path,
 					"client_ip":     clientIP,
@@ -405,7 +461,7 @@ func SecurityLoggingMiddleware(config *SecurityConfig, logger *logging.Logger) f
 func TimeoutMiddleware(config *SecurityConfig, logger *logging.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if config.RequestTimeout <= 0 {
+			if config.RequestTimeout <= 0 || config.untimed(r.URL.Path) {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -460,6 +516,16 @@ func TimeoutMiddleware(config *SecurityConfig, logger *logging.Logger) func(http
 	}
 }
 
+// untimed reports whether a path may run longer than RequestTimeout
+func (c *SecurityConfig) untimed(path string) bool {
+	for _, suffix := range c.UntimedPaths {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
 // Helper types and functions
 
 type securityResponseWriter struct {
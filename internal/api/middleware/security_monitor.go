@@ -627,6 +627,9 @@ func isSuspiciousHeaderName(name string) bool {
 // getRequestIDFromContext extracts request ID from request context
 func getRequestIDFromContext(r *http.Request) string {
 	if ctx := r.Context(); ctx != nil {
+		if requestID := logging.GetRequestID(ctx); requestID != "" {
+			return requestID
+		}
 		if requestID, ok := ctx.Value(response.RequestIDKey).(string); ok {
 			return requestID
 		}
@@ -353,6 +353,17 @@ func TestTimeoutMiddleware(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, rr.Code, tt.description)
 		})
 	}
+
+	t.Run("Untimed Download", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		})
+		req := httptest.NewRequest("GET", "/api/v1/export/backup/abc/download", nil)
+		rr := httptest.NewRecorder()
+		TimeoutMiddleware(config, logger)(handler).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "Downloads should not time out")
+	})
 }
 
 // Attack Simulation Tests
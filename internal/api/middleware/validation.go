@@ -3,6 +3,7 @@ package middleware
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
@@ -52,6 +53,8 @@ func DefaultValidationConfig() *ValidationConfig {
 	return &ValidationConfig{
 		AllowedContentTypes: map[string]bool{
 			"application/json":                  true,
+			"application/json-patch+json":       true, // RFC 6902 config patches
+			"application/merge-patch+json":      true, // RFC 7386 config patches
 			"application/x-www-form-urlencoded": true,
 			"multipart/form-data":               true,
 			"text/plain":                        true,
@@ -258,6 +261,11 @@ func ValidateJSONMiddleware(config *ValidationConfig, logger *logging.Logger) fu
 
 			// Read the entire body to validate JSON and restore it for subsequent handlers
 			bodyBytes, err := io.ReadAll(r.Body)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				WriteRequestTooLarge(respWriter, w, r, "", tooLarge.Limit)
+				return
+			}
 			if err != nil {
 				if logger != nil && config.LogValidationErrors {
 					logger.WithFields(map[string]any{
@@ -418,7 +426,7 @@ func isJSONRequest(r *http.Request) bool {
 	if err != nil {
 		return false
 	}
-	return mediaType == "application/json"
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
 }
 
 func containsSuspiciousContent(value string) bool {
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// ListNewDeviceAlerts handles GET /api/v1/discovery/alerts. The status
+// query parameter (pending, adopted or ignored) filters the alerts.
+func (h *Handler) ListNewDeviceAlerts(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", service.NewDevicePending, service.NewDeviceAdopted, service.NewDeviceIgnored:
+	default:
+		h.responseWriter().WriteValidationError(w, r, "status must be pending, adopted or ignored")
+		return
+	}
+	alerts, err := h.Service.ListNewDeviceAlerts(status)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+// AdoptNewDevice handles POST /api/v1/discovery/alerts/{id}/adopt. The
+// device is added to the inventory and the alert records who adopted it
+// (X-User-ID header).
+func (h *Handler) AdoptNewDevice(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.newDeviceAlertID(w, r)
+	if !ok {
+		return
+	}
+	alert, device, err := h.Service.AdoptNewDevice(r.Context(), id, requesterFrom(r))
+	if err != nil {
+		h.writeNewDeviceAlertError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"alert":  alert,
+		"device": device,
+	})
+}
+
+// IgnoreNewDevice handles POST /api/v1/discovery/alerts/{id}/ignore with an
+// optional {"note": ...} body. The device raises no further alerts.
+func (h *Handler) IgnoreNewDevice(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.newDeviceAlertID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+			return
+		}
+	}
+	alert, err := h.Service.IgnoreNewDevice(id, requesterFrom(r), req.Note)
+	if err != nil {
+		h.writeNewDeviceAlertError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, alert)
+}
+
+// ReportDeviceAnnounce handles POST /api/v1/discovery/announce with the
+// payload of a device's MQTT announce, relayed by an MQTT bridge
+func (h *Handler) ReportDeviceAnnounce(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var announce service.DeviceAnnounce
+	if err := json.NewDecoder(r.Body).Decode(&announce); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	result, err := h.Service.ReportDeviceAnnounce(r.Context(), announce)
+	if err != nil {
+		h.writeNewDeviceAlertError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, result)
+}
+
+// newDeviceAlertID parses the {id} path variable
+func (h *Handler) newDeviceAlertID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid alert ID", nil)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// writeNewDeviceAlertError maps new device alert errors to responses
+func (h *Handler) writeNewDeviceAlertError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrNewDeviceAlertNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "New device alert")
+	case errors.Is(err, service.ErrInvalidNewDeviceAlert):
+		h.responseWriter().WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict, err.Error(), nil)
+	case errors.Is(err, service.ErrInvalidAnnounce):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
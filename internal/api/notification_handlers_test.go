@@ -11,14 +11,24 @@ import (
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 
 	"github.com/ginsys/shelly-manager/internal/logging"
 	"github.com/ginsys/shelly-manager/internal/notification"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
 	"github.com/ginsys/shelly-manager/internal/testutil"
 )
 
 func setupNotificationTestRouter(t *testing.T) (*mux.Router, func()) {
 	t.Helper()
+	r, _, cleanup := setupNotificationTestRouterWithDB(t)
+	return r, cleanup
+}
+
+func setupNotificationTestRouterWithDB(t *testing.T) (*mux.Router, *gorm.DB, func()) {
+	t.Helper()
 
 	db, cleanup := testutil.TestDatabase(t)
 	logger := logging.GetDefault()
@@ -40,7 +50,9 @@ func setupNotificationTestRouter(t *testing.T) (*mux.Router, func()) {
 	api.HandleFunc("/notifications/rules", h.NotificationHandler.CreateRule).Methods("POST")
 	api.HandleFunc("/notifications/rules", h.NotificationHandler.GetRules).Methods("GET")
 	api.HandleFunc("/notifications/history", h.NotificationHandler.GetHistory).Methods("GET")
-	return r, cleanup
+	api.HandleFunc("/notifications/history/{id}/acknowledge", h.NotificationHandler.AcknowledgeAlert).Methods("POST")
+	api.HandleFunc("/notifications/history/{id}/resolve", h.NotificationHandler.ResolveAlert).Methods("POST")
+	return r, db.GetDB(), cleanup
 }
 
 func TestNotificationHandlers_ChannelsCRUD(t *testing.T) {
@@ -158,3 +170,63 @@ func TestNotificationHandlers_HistoryEmpty(t *testing.T) {
 		t.Fatalf("expected meta in response")
 	}
 }
+
+func TestNotificationHandlers_AlertLifecycleErrors(t *testing.T) {
+	router, cleanup := setupNotificationTestRouter(t)
+	defer cleanup()
+
+	cases := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"GET", "/api/v1/notifications/history?state=active", "", http.StatusOK},
+		{"GET", "/api/v1/notifications/history?state=closed", "", http.StatusBadRequest},
+		{"POST", "/api/v1/notifications/history/9999/acknowledge", "", http.StatusNotFound},
+		{"POST", "/api/v1/notifications/history/9999/resolve", "", http.StatusNotFound},
+		{"POST", "/api/v1/notifications/history/abc/acknowledge", "", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Test)")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tc.status {
+			t.Errorf("%s %s: expected %d, got %d body=%s", tc.method, tc.path, tc.status, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestNotificationHandlers_AlertActorFromIdentity(t *testing.T) {
+	router, db, cleanup := setupNotificationTestRouterWithDB(t)
+	defer cleanup()
+
+	channel := notification.NotificationChannel{Name: "Ops", Type: "webhook", Enabled: true}
+	require.NoError(t, db.Create(&channel).Error)
+	rule := notification.NotificationRule{Name: "Offline", ChannelID: channel.ID, Enabled: true}
+	require.NoError(t, db.Create(&rule).Error)
+	alert := notification.NotificationHistory{RuleID: rule.ID, ChannelID: channel.ID, Subject: "Plug offline",
+		AlertState: notification.AlertStateOpen, Status: "sent"}
+	require.NoError(t, db.Create(&alert).Error)
+
+	post := func(req *http.Request) notification.NotificationHistory {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var resp struct {
+			Data notification.NotificationHistory `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		return resp.Data
+	}
+	path := fmt.Sprintf("/api/v1/notifications/history/%d/", alert.ID)
+
+	// A body naming someone else does not override the audit identity
+	req := httptest.NewRequest("POST", path+"acknowledge", bytes.NewBufferString(`{"by":"mallory"}`))
+	req.Header.Set("X-User", "carol")
+	assert.Equal(t, "carol", post(req).AcknowledgedBy)
+
+	req = httptest.NewRequest("POST", path+"resolve", bytes.NewBufferString(`{"by":"mallory"}`))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Username: "dave"}))
+	assert.Equal(t, "dave", post(req).ResolvedBy)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// ListPowerBudgets handles GET /api/v1/power-budgets
+func (h *Handler) ListPowerBudgets(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.Service.ListPowerBudgets()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"groups": groups,
+		"count":  len(groups),
+	})
+}
+
+// GetPowerBudget handles GET /api/v1/power-budgets/{id}
+func (h *Handler) GetPowerBudget(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.powerBudgetID(w, r)
+	if !ok {
+		return
+	}
+	group, err := h.Service.GetPowerBudget(id)
+	if err != nil {
+		h.writePowerBudgetError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, group)
+}
+
+// GetPowerBudgetStatus handles GET /api/v1/power-budgets/{id}/status with
+// the group's summed power and whether it is over its limit
+func (h *Handler) GetPowerBudgetStatus(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.powerBudgetID(w, r)
+	if !ok {
+		return
+	}
+	status, err := h.Service.PowerBudgetStatus(id)
+	if err != nil {
+		h.writePowerBudgetError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, status)
+}
+
+// CreatePowerBudget handles POST /api/v1/power-budgets. Groups are enabled
+// unless the body says otherwise.
+func (h *Handler) CreatePowerBudget(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	group := database.PowerBudgetGroup{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	group.ID = 0
+	if err := h.Service.SavePowerBudget(&group); err != nil {
+		h.writePowerBudgetError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteCreated(w, r, group)
+}
+
+// UpdatePowerBudget handles PUT /api/v1/power-budgets/{id}. Fields left out
+// keep their values; members, when given, replace all members.
+func (h *Handler) UpdatePowerBudget(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.powerBudgetID(w, r)
+	if !ok {
+		return
+	}
+	group, err := h.Service.GetPowerBudget(id)
+	if err != nil {
+		h.writePowerBudgetError(w, r, err)
+		return
+	}
+	var body struct {
+		database.PowerBudgetGroup
+		Members *[]database.PowerBudgetMember `json:"members"`
+	}
+	body.PowerBudgetGroup = *group
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	updated := body.PowerBudgetGroup
+	updated.ID = id
+	updated.Members = group.Members
+	if body.Members != nil {
+		updated.Members = *body.Members
+	}
+	if err := h.Service.SavePowerBudget(&updated); err != nil {
+		h.writePowerBudgetError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, updated)
+}
+
+// DeletePowerBudget handles DELETE /api/v1/power-budgets/{id}
+func (h *Handler) DeletePowerBudget(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	id, ok := h.powerBudgetID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Service.DeletePowerBudget(id); err != nil {
+		h.writePowerBudgetError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"deleted": id})
+}
+
+// powerBudgetID parses the {id} path variable
+func (h *Handler) powerBudgetID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid power budget group ID", nil)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// writePowerBudgetError maps power budget errors to responses
+func (h *Handler) writePowerBudgetError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrPowerBudgetNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Power budget group")
+	case errors.Is(err, service.ErrPowerBudgetExists):
+		h.responseWriter().WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict, err.Error(), nil)
+	case errors.Is(err, service.ErrInvalidPowerBudget):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
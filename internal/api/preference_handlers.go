@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ginsys/shelly-manager/internal/preferences"
+)
+
+// preferenceService returns the shared preferences service, falling back to
+// one bound to the handler database when no Shelly service is configured
+func (h *Handler) preferenceService() *preferences.Service {
+	if h.Service != nil && h.Service.Preferences != nil {
+		return h.Service.Preferences
+	}
+	return preferences.NewService(h.DB.GetDB(), h.logger)
+}
+
+// preferenceOwner names whose preferences a request reads and writes: the
+// signed-in user, or else the X-User-ID of API clients
+func preferenceOwner(r *http.Request) string {
+	return requesterFrom(r)
+}
+
+// ListPreferences handles GET /api/v1/preferences with every preference of
+// the requesting user
+func (h *Handler) ListPreferences(w http.ResponseWriter, r *http.Request) {
+	owner := preferenceOwner(r)
+	prefs, err := h.preferenceService().List(r.Context(), owner)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"owner":       owner,
+		"preferences": prefs,
+	})
+}
+
+// UpdatePreferences handles PATCH /api/v1/preferences. The body is an object
+// of preferences to store; a null value deletes that preference.
+func (h *Handler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	var values map[string]json.RawMessage
+	if err := json.NewDecoder(io.LimitReader(r.Body, preferences.MaxKeys*preferences.MaxValueSize)).Decode(&values); err != nil || values == nil {
+		h.responseWriter().WriteValidationError(w, r, "Request body must be an object of preferences")
+		return
+	}
+	owner := preferenceOwner(r)
+	if err := h.preferenceService().Update(r.Context(), owner, values); err != nil {
+		h.writePreferenceError(w, r, err)
+		return
+	}
+	h.ListPreferences(w, r)
+}
+
+// ResetPreferences handles DELETE /api/v1/preferences and removes every
+// preference of the requesting user
+func (h *Handler) ResetPreferences(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.preferenceService().Reset(r.Context(), preferenceOwner(r))
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"deleted": deleted})
+}
+
+// GetPreference handles GET /api/v1/preferences/{key}
+func (h *Handler) GetPreference(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	value, err := h.preferenceService().Get(r.Context(), preferenceOwner(r), key)
+	if err != nil {
+		h.writePreferenceError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"key": key, "value": value})
+}
+
+// SetPreference handles PUT /api/v1/preferences/{key}. The body is the
+// preference's JSON value.
+func (h *Handler) SetPreference(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	body, err := io.ReadAll(io.LimitReader(r.Body, preferences.MaxValueSize+1))
+	if err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Failed to read request body")
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		h.responseWriter().WriteValidationError(w, r, "Request body must be the preference value")
+		return
+	}
+	value := json.RawMessage(body)
+	if err := h.preferenceService().Set(r.Context(), preferenceOwner(r), key, value); err != nil {
+		h.writePreferenceError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"key": key, "value": value})
+}
+
+// DeletePreference handles DELETE /api/v1/preferences/{key}
+func (h *Handler) DeletePreference(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if err := h.preferenceService().Delete(r.Context(), preferenceOwner(r), key); err != nil {
+		h.writePreferenceError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"deleted": key})
+}
+
+func (h *Handler) writePreferenceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, preferences.ErrNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Preference")
+	case errors.Is(err, preferences.ErrInvalid):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
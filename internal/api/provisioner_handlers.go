@@ -11,6 +11,8 @@ import (
 
 	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
 	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/provisioning"
+	"github.com/ginsys/shelly-manager/internal/service"
 )
 
 // ProvisionerAgent represents a registered provisioning agent
@@ -24,6 +26,10 @@ type ProvisionerAgent struct {
 	LastSeen     time.Time         `json:"last_seen"`
 	RegisteredAt time.Time         `json:"registered_at"`
 	Metadata     map[string]string `json:"metadata,omitempty"`
+
+	// Health is the state the agent reported in its last heartbeat
+	Health        *provisioning.AgentHealth `json:"health,omitempty"`
+	LastHeartbeat *time.Time                `json:"last_heartbeat,omitempty"`
 }
 
 // ProvisioningTask represents a task for a provisioning agent
@@ -38,6 +44,14 @@ type ProvisioningTask struct {
 	CreatedAt  time.Time              `json:"created_at"`
 	UpdatedAt  time.Time              `json:"updated_at"`
 	Priority   int                    `json:"priority,omitempty"`
+	DeviceID   uint                   `json:"device_id,omitempty"` // device that enrolled or was verified
+	// Verification is the check of the device on its target network after
+	// the agent reported success
+	Verification *service.ProvisioningVerification `json:"verification,omitempty"`
+	// Secrets are configuration values such as one-time tokens that only
+	// the agent running the task receives, merged into Config when it polls
+	// the task. They are never listed and are dropped once delivered.
+	Secrets map[string]interface{} `json:"-"`
 }
 
 // ProvisionerRegistry manages registered agents and tasks
@@ -151,6 +165,45 @@ func (h *Handler) GetProvisionerAgents(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// AgentHeartbeat handles POST /api/v1/provisioner/agents/{id}/heartbeat. The
+// agent reports its health (Wi-Fi interface, last scan and task, error
+// counters), which is kept with its registration and shown by the agent list.
+func (h *Handler) AgentHeartbeat(w http.ResponseWriter, r *http.Request) {
+	agentID := mux.Vars(r)["id"]
+
+	var health provisioning.AgentHealth
+	if err := json.NewDecoder(r.Body).Decode(&health); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	health.AgentID = agentID
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	agent, exists := registry.agents[agentID]
+	if !exists {
+		h.responseWriter().WriteNotFoundError(w, r, "Agent")
+		return
+	}
+
+	now := time.Now()
+	agent.LastSeen = now
+	agent.LastHeartbeat = &now
+	agent.Status = "online"
+	agent.Health = &health
+
+	h.logger.WithFields(map[string]any{
+		"agent_id": agentID,
+		"health":   health.Status,
+	}).Debug("Provisioning agent heartbeat")
+
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"agent_id":    agentID,
+		"received_at": now,
+	})
+}
+
 // PollTasks handles GET /api/v1/provisioner/agents/{id}/tasks
 func (h *Handler) PollTasks(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -181,7 +234,7 @@ func (h *Handler) PollTasks(w http.ResponseWriter, r *http.Request) {
 			task.AgentID = agentID
 			task.Status = "assigned"
 			task.UpdatedAt = time.Now()
-			availableTasks = append(availableTasks, task)
+			availableTasks = append(availableTasks, agentTask(task))
 		}
 	}
 
@@ -230,10 +283,27 @@ func (h *Handler) UpdateTaskStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update task status
-	task.Status = req.Status
+	// Update task status; a task the device confirmed by enrolling stays
+	// confirmed when the agent reports completion afterwards
+	verify := req.Status == "completed" && task.Status != "confirmed" && h.verifiesProvisioning(task)
+	switch {
+	case verify:
+		task.Status = "verifying"
+	case task.Status != "confirmed" || req.Status != "completed":
+		task.Status = req.Status
+	}
 	task.UpdatedAt = time.Now()
 
+	// Wi-Fi rotation rescues follow the task outcome, once verified
+	switch {
+	case verify:
+		h.Service.StartProvisioningVerification(r.Context(), task.DeviceMAC, task.TargetSSID, func(v *service.ProvisioningVerification) {
+			h.finishProvisioningVerification(taskID, v)
+		})
+	case h.Service != nil && (req.Status == "completed" || req.Status == "failed"):
+		h.Service.CompleteWiFiRescue(taskID, req.Status == "completed", req.Error)
+	}
+
 	h.logger.WithFields(map[string]any{
 		"task_id":  taskID,
 		"agent_id": req.AgentID,
@@ -251,6 +321,42 @@ func (h *Handler) UpdateTaskStatus(w http.ResponseWriter, r *http.Request) {
 	h.responseWriter().WriteSuccess(w, r, response)
 }
 
+// verifiesProvisioning reports whether a task the agent completed is
+// verified on the target network before it is marked completed
+func (h *Handler) verifiesProvisioning(task *ProvisioningTask) bool {
+	return task.Type == "provision_device" && task.DeviceMAC != "" &&
+		h.Service != nil && h.Service.ProvisioningVerificationEnabled()
+}
+
+// finishProvisioningVerification records the verification of a task's
+// device: a verified task is completed, a device seen on the network but not
+// answering is flagged joined_unreachable and anything else fails
+// verification. A task the device confirmed meanwhile stays confirmed.
+func (h *Handler) finishProvisioningVerification(taskID string, v *service.ProvisioningVerification) {
+	registry.mu.Lock()
+	task, ok := registry.tasks[taskID]
+	if ok {
+		task.Verification = v
+		if task.DeviceID == 0 {
+			task.DeviceID = v.DeviceID
+		}
+		if task.Status == "verifying" {
+			switch v.Result {
+			case service.ProvisioningVerified:
+				task.Status = "completed"
+			case service.ProvisioningJoinedUnreachable:
+				task.Status = "joined_unreachable"
+			default:
+				task.Status = "verification_failed"
+			}
+		}
+		task.UpdatedAt = time.Now()
+	}
+	registry.mu.Unlock()
+
+	h.Service.CompleteWiFiRescue(taskID, v.Result == service.ProvisioningVerified, v.Error)
+}
+
 // CreateProvisioningTask handles POST /api/v1/provisioner/tasks
 func (h *Handler) CreateProvisioningTask(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -258,6 +364,9 @@ func (h *Handler) CreateProvisioningTask(w http.ResponseWriter, r *http.Request)
 		DeviceMAC  string                 `json:"device_mac,omitempty"`
 		TargetSSID string                 `json:"target_ssid,omitempty"`
 		Config     map[string]interface{} `json:"config,omitempty"`
+		Profile    string                 `json:"profile,omitempty"`  // provisioning profile filling target_ssid and config
+		Template   string                 `json:"template,omitempty"` // provisioning task template, expanded with variables
+		Variables  map[string]string      `json:"variables,omitempty"`
 		AgentID    string                 `json:"agent_id,omitempty"`
 		Priority   int                    `json:"priority,omitempty"`
 	}
@@ -272,26 +381,38 @@ func (h *Handler) CreateProvisioningTask(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Generate task ID
-	taskID := fmt.Sprintf("task_%d", time.Now().UnixNano())
+	targetSSID, config, err := h.withProvisioningProfile(req.Profile, req.TargetSSID, req.Config)
+	if err != nil {
+		h.writeTaskProfileError(w, r, err)
+		return
+	}
 
-	registry.mu.Lock()
-	defer registry.mu.Unlock()
+	// Fill the AP password and name of pre-registered devices, ahead of the
+	// template's naming rule
+	var apPassword string
+	if req.DeviceMAC != "" {
+		config, apPassword = h.withIntakeDetails(r, req.DeviceMAC, config)
+	}
+	targetSSID, config, err = h.withTaskTemplate(req.Template, req.Variables, req.DeviceMAC, targetSSID, config)
+	if err != nil {
+		h.writeTaskTemplateError(w, r, err)
+		return
+	}
+	req.TargetSSID, req.Config = targetSSID, config
 
 	task := &ProvisioningTask{
-		ID:         taskID,
 		Type:       req.Type,
 		DeviceMAC:  req.DeviceMAC,
 		TargetSSID: req.TargetSSID,
 		Config:     req.Config,
-		Status:     "pending",
 		AgentID:    req.AgentID,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
 		Priority:   req.Priority,
 	}
-
-	registry.tasks[taskID] = task
+	if apPassword != "" {
+		setTaskSecret(task, "ap_password", apPassword)
+	}
+	task = enqueueProvisioningTask(task, h.withEnrollmentToken)
+	taskID := task.ID
 
 	h.logger.WithFields(map[string]any{
 		"task_id":     taskID,
@@ -312,6 +433,85 @@ func (h *Handler) CreateProvisioningTask(w http.ResponseWriter, r *http.Request)
 	h.responseWriter().WriteCreated(w, r, response)
 }
 
+// withIntakeDetails adds the name recorded at intake for mac to a task
+// configuration, keeping a name already set. It returns the AP password
+// recorded at intake, unless the configuration sets one, for the caller to
+// store as a task secret.
+func (h *Handler) withIntakeDetails(r *http.Request, mac string, config map[string]interface{}) (map[string]interface{}, string) {
+	entry, err := h.intakeService().Find(r.Context(), mac, "")
+	if err != nil {
+		h.logger.WithFields(map[string]any{
+			"device_mac": mac,
+			"error":      err.Error(),
+			"component":  "provisioner_handler",
+		}).Warn("Failed to look up device intake")
+		return config, ""
+	}
+	if entry == nil {
+		return config, ""
+	}
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	if _, ok := config["device_name"]; !ok && entry.Name != "" {
+		config["device_name"] = entry.Name
+	}
+	if _, ok := config["ap_password"]; ok {
+		return config, ""
+	}
+	return config, entry.APPassword
+}
+
+// enqueueProvisioningTask assigns an ID to a task and queues it as pending.
+// prepare, when given, completes the task once it has its ID, before agents
+// can poll it.
+func enqueueProvisioningTask(task *ProvisioningTask, prepare func(*ProvisioningTask)) *ProvisioningTask {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	now := time.Now()
+	task.ID = fmt.Sprintf("task_%d", now.UnixNano())
+	for n := 1; registry.tasks[task.ID] != nil; n++ {
+		task.ID = fmt.Sprintf("task_%d_%d", now.UnixNano(), n)
+	}
+	if prepare != nil {
+		prepare(task)
+	}
+	task.Status = "pending"
+	task.CreatedAt = now
+	task.UpdatedAt = now
+	registry.tasks[task.ID] = task
+	return task
+}
+
+// agentTask returns the copy of a task sent to the agent running it, with
+// the task's secrets in its configuration. The secrets are delivered once.
+// The caller holds registry.mu.
+func agentTask(task *ProvisioningTask) *ProvisioningTask {
+	if len(task.Secrets) == 0 {
+		return task
+	}
+	out := *task
+	out.Config = make(map[string]interface{}, len(task.Config)+len(task.Secrets))
+	for k, v := range task.Config {
+		out.Config[k] = v
+	}
+	for k, v := range task.Secrets {
+		out.Config[k] = v
+	}
+	out.Secrets = nil
+	task.Secrets = nil
+	return &out
+}
+
+// setTaskSecret stores a value only the agent running the task receives
+func setTaskSecret(task *ProvisioningTask, key string, value interface{}) {
+	if task.Secrets == nil {
+		task.Secrets = map[string]interface{}{}
+	}
+	task.Secrets[key] = value
+}
+
 // GetProvisioningTasks handles GET /api/v1/provisioner/tasks
 func (h *Handler) GetProvisioningTasks(w http.ResponseWriter, r *http.Request) {
 	registry.mu.RLock()
@@ -416,6 +616,8 @@ func (h *Handler) ReportDiscoveredDevices(w http.ResponseWriter, r *http.Request
 	// Process discovered devices
 	devicesProcessed := 0
 	devicesPersisted := 0
+	intakeMatches := []map[string]interface{}{}
+	intakeSvc := h.intakeService()
 	for _, device := range req.Devices {
 		// Log each discovered device
 		h.logger.WithFields(map[string]any{
@@ -455,6 +657,30 @@ func (h *Handler) ReportDiscoveredDevices(w http.ResponseWriter, r *http.Request
 			devicesPersisted++
 		}
 
+		// Match against pre-registered devices so they can be provisioned by name
+		if entry, err := intakeSvc.Find(r.Context(), device.MAC, device.SSID); err != nil {
+			h.logger.WithFields(map[string]any{
+				"mac":       device.MAC,
+				"error":     err.Error(),
+				"component": "provisioner_handler",
+			}).Warn("Failed to look up device intake")
+		} else if entry != nil {
+			if err := intakeSvc.MarkSeen(r.Context(), entry); err != nil {
+				h.logger.WithFields(map[string]any{
+					"mac":       device.MAC,
+					"error":     err.Error(),
+					"component": "provisioner_handler",
+				}).Warn("Failed to mark device intake as seen")
+			}
+			intakeMatches = append(intakeMatches, map[string]interface{}{
+				"intake_id":       entry.ID,
+				"mac":             device.MAC,
+				"ssid":            device.SSID,
+				"name":            entry.Name,
+				"has_ap_password": entry.APPassword != "",
+			})
+		}
+
 		devicesProcessed++
 	}
 
@@ -478,6 +704,7 @@ func (h *Handler) ReportDiscoveredDevices(w http.ResponseWriter, r *http.Request
 		"devices_received":  len(req.Devices),
 		"devices_processed": devicesProcessed,
 		"devices_persisted": devicesPersisted,
+		"intake_matches":    intakeMatches,
 		"timestamp":         time.Now(),
 		"message":           fmt.Sprintf("Successfully processed %d discovered devices (%d persisted)", devicesProcessed, devicesPersisted),
 	}
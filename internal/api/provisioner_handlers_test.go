@@ -1,10 +1,20 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/intake"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
 )
 
 func TestProvisioningTask(t *testing.T) {
@@ -317,3 +327,38 @@ func TestReportDiscoveredDevices(t *testing.T) {
 		assert.Contains(t, response["message"].(string), "Successfully processed")
 	})
 }
+
+func TestCreateProvisioningTask_IntakeAPPasswordIsSecret(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	handler := NewHandlerWithLogger(db, testShellyService(t, db), nil, nil, logging.GetDefault())
+	_, err := handler.intakeService().Register(context.Background(), intake.Label{
+		MAC: "AABBCC000042", Name: "Porch", APPassword: "label-secret",
+	}, "qr")
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/v1/provisioner/tasks", bytes.NewReader([]byte(`{"type":"provision_device","device_mac":"AABBCC000042","target_ssid":"Home"}`)))
+	w := httptest.NewRecorder()
+	handler.CreateProvisioningTask(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created struct {
+		Data struct {
+			TaskID string `json:"task_id"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	registry.mu.Lock()
+	task := registry.tasks[created.Data.TaskID]
+	assert.Equal(t, "Porch", task.Config["device_name"])
+	assert.NotContains(t, task.Config, "ap_password")
+	assert.Equal(t, "label-secret", task.Secrets["ap_password"])
+	// Only the agent running the task receives the password
+	assert.Equal(t, "label-secret", agentTask(task).Config["ap_password"])
+	registry.mu.Unlock()
+
+	w = httptest.NewRecorder()
+	handler.GetProvisioningTasks(w, httptest.NewRequest("GET", "/api/v1/provisioner/tasks", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "label-secret")
+}
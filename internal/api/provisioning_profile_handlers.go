@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// provisioningProfileView is the API representation of a provisioning
+// profile. Passwords are never returned; the has_ flags tell whether one is
+// stored.
+type provisioningProfileView struct {
+	database.ProvisioningProfile
+	HasWiFiPassword bool `json:"has_wifi_password"`
+	HasAuthPassword bool `json:"has_auth_password"`
+}
+
+func newProvisioningProfileView(p database.ProvisioningProfile) provisioningProfileView {
+	return provisioningProfileView{
+		ProvisioningProfile: p,
+		HasWiFiPassword:     p.WiFiPassword != "",
+		HasAuthPassword:     p.AuthPassword != "",
+	}
+}
+
+// ListProvisioningProfiles handles GET /api/v1/provisioning/profiles
+func (h *Handler) ListProvisioningProfiles(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	profiles, err := h.Service.ListProvisioningProfiles()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	views := make([]provisioningProfileView, 0, len(profiles))
+	for _, p := range profiles {
+		views = append(views, newProvisioningProfileView(p))
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"profiles": views,
+		"count":    len(views),
+	})
+}
+
+// GetProvisioningProfile handles GET /api/v1/provisioning/profiles/{name}
+func (h *Handler) GetProvisioningProfile(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	profile, err := h.Service.GetProvisioningProfile(mux.Vars(r)["name"])
+	if err != nil {
+		h.writeProvisioningProfileError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, newProvisioningProfileView(*profile))
+}
+
+// SaveProvisioningProfile handles PUT /api/v1/provisioning/profiles/{name}.
+// It creates the profile or replaces it; omitted passwords keep the stored
+// ones.
+func (h *Handler) SaveProvisioningProfile(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		database.ProvisioningProfile
+		WiFiPassword string `json:"wifi_password"`
+		AuthPassword string `json:"auth_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	profile := req.ProvisioningProfile
+	profile.Name = mux.Vars(r)["name"]
+	profile.WiFiPassword = req.WiFiPassword
+	profile.AuthPassword = req.AuthPassword
+	if err := h.Service.SaveProvisioningProfile(&profile); err != nil {
+		h.writeProvisioningProfileError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, newProvisioningProfileView(profile))
+}
+
+// DeleteProvisioningProfile handles DELETE /api/v1/provisioning/profiles/{name}
+func (h *Handler) DeleteProvisioningProfile(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if err := h.Service.DeleteProvisioningProfile(name); err != nil {
+		h.writeProvisioningProfileError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"deleted": name})
+}
+
+// GetProvisionerProfile handles GET /api/v1/provisioner/profiles/{name}. It
+// returns the profile as task configuration with its credentials, for
+// provisioner runs that name a profile.
+func (h *Handler) GetProvisionerProfile(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	config, err := h.Service.ProvisioningProfileConfig(mux.Vars(r)["name"])
+	if err != nil {
+		h.writeProvisioningProfileError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, config)
+}
+
+// withProvisioningProfile expands the named profile into a task
+// configuration and returns the task's target SSID. Values set on the task
+// take precedence over the profile.
+func (h *Handler) withProvisioningProfile(profile, targetSSID string, config map[string]interface{}) (string, map[string]interface{}, error) {
+	if profile == "" {
+		return targetSSID, config, nil
+	}
+	merged, err := h.Service.ApplyProvisioningProfile(profile, config)
+	if err != nil {
+		return "", nil, err
+	}
+	if ssid, ok := merged["ssid"].(string); ok {
+		if targetSSID == "" {
+			targetSSID = ssid
+		}
+		delete(merged, "ssid")
+	}
+	return targetSSID, merged, nil
+}
+
+// writeTaskProfileError reports a profile that cannot be applied to a task;
+// an unknown profile is an invalid request rather than a missing resource
+func (h *Handler) writeTaskProfileError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrProvisioningProfileNotFound) {
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+		return
+	}
+	h.responseWriter().WriteInternalError(w, r, err)
+}
+
+// writeProvisioningProfileError maps profile errors to responses
+func (h *Handler) writeProvisioningProfileError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrProvisioningProfileNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Provisioning profile")
+	case errors.Is(err, service.ErrInvalidProvisioningProfile):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// ListProvisioningTaskTemplates handles GET /api/v1/provisioning/task-templates
+func (h *Handler) ListProvisioningTaskTemplates(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	templates, err := h.Service.ListProvisioningTaskTemplates()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"templates": templates,
+		"count":     len(templates),
+	})
+}
+
+// GetProvisioningTaskTemplate handles GET /api/v1/provisioning/task-templates/{name}
+func (h *Handler) GetProvisioningTaskTemplate(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	template, err := h.Service.GetProvisioningTaskTemplate(mux.Vars(r)["name"])
+	if err != nil {
+		h.writeProvisioningTaskTemplateError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, template)
+}
+
+// SaveProvisioningTaskTemplate handles PUT /api/v1/provisioning/task-templates/{name}.
+// It creates the template or replaces it.
+func (h *Handler) SaveProvisioningTaskTemplate(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var template database.ProvisioningTaskTemplate
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+	template.Name = mux.Vars(r)["name"]
+	if err := h.Service.SaveProvisioningTaskTemplate(&template); err != nil {
+		h.writeProvisioningTaskTemplateError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, template)
+}
+
+// DeleteProvisioningTaskTemplate handles DELETE /api/v1/provisioning/task-templates/{name}
+func (h *Handler) DeleteProvisioningTaskTemplate(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if err := h.Service.DeleteProvisioningTaskTemplate(name); err != nil {
+		h.writeProvisioningTaskTemplateError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{"deleted": name})
+}
+
+// withTaskTemplate expands the named task template for a device into its
+// task; values set on the task take precedence over the template
+func (h *Handler) withTaskTemplate(template string, vars map[string]string, mac, targetSSID string, config map[string]interface{}) (string, map[string]interface{}, error) {
+	if template == "" {
+		return targetSSID, config, nil
+	}
+	return h.Service.ApplyProvisioningTaskTemplate(template, vars, mac, targetSSID, config)
+}
+
+// writeTaskTemplateError reports a task template that cannot be applied to
+// a task; an unknown template is an invalid request rather than a missing
+// resource
+func (h *Handler) writeTaskTemplateError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrProvisioningTaskTemplateNotFound) ||
+		errors.Is(err, service.ErrInvalidProvisioningTaskTemplate) ||
+		errors.Is(err, service.ErrProvisioningProfileNotFound) {
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+		return
+	}
+	h.responseWriter().WriteInternalError(w, r, err)
+}
+
+// writeProvisioningTaskTemplateError maps task template errors to responses
+func (h *Handler) writeProvisioningTaskTemplateError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrProvisioningTaskTemplateNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Provisioning task template")
+	case errors.Is(err, service.ErrInvalidProvisioningTaskTemplate):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
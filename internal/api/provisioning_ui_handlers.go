@@ -11,6 +11,7 @@ import (
 	"github.com/gorilla/mux"
 
 	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/service"
 )
 
 // UI-facing DTOs for the `/api/v1/provisioning/*` endpoints. Backend stores
@@ -33,31 +34,68 @@ type uiProvisioningTask struct {
 }
 
 type uiProvisioningAgent struct {
-	ID           string    `json:"id"`
-	Name         string    `json:"name"`
-	Status       string    `json:"status"`
-	Version      string    `json:"version"`
-	Capabilities []string  `json:"capabilities"`
-	LastSeen     time.Time `json:"lastSeen"`
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	Status       string         `json:"status"`
+	Version      string         `json:"version"`
+	Capabilities []string       `json:"capabilities"`
+	LastSeen     time.Time      `json:"lastSeen"`
+	Health       *uiAgentHealth `json:"health,omitempty"`
+}
+
+// uiAgentHealth is the agent's last heartbeat
+type uiAgentHealth struct {
+	Status          string                `json:"status"`
+	Problems        []string              `json:"problems"`
+	ReportedAt      time.Time             `json:"reportedAt"`
+	UptimeSeconds   int64                 `json:"uptimeSeconds"`
+	Interface       string                `json:"interface"`
+	InterfaceStatus string                `json:"interfaceStatus"`
+	CurrentTask     string                `json:"currentTask,omitempty"`
+	LastScanAt      *time.Time            `json:"lastScanAt,omitempty"`
+	LastScanDevices int                   `json:"lastScanDevices"`
+	LastScanError   string                `json:"lastScanError,omitempty"`
+	LastTaskAt      *time.Time            `json:"lastTaskAt,omitempty"`
+	LastTaskStatus  string                `json:"lastTaskStatus,omitempty"`
+	LastTaskError   string                `json:"lastTaskError,omitempty"`
+	Counters        uiAgentHealthCounters `json:"counters"`
+}
+
+type uiAgentHealthCounters struct {
+	Scans           int64 `json:"scans"`
+	ScanErrors      int64 `json:"scanErrors"`
+	Polls           int64 `json:"polls"`
+	PollErrors      int64 `json:"pollErrors"`
+	TasksCompleted  int64 `json:"tasksCompleted"`
+	TasksFailed     int64 `json:"tasksFailed"`
+	HeartbeatErrors int64 `json:"heartbeatErrors"`
 }
 
 type uiCreateTaskRequest struct {
 	DeviceID      string                 `json:"deviceId"`
 	TaskType      string                 `json:"taskType"`
 	Configuration map[string]interface{} `json:"config,omitempty"`
+	Profile       string                 `json:"profile,omitempty"`
+	Template      string                 `json:"template,omitempty"`
+	Variables     map[string]string      `json:"variables,omitempty"`
 }
 
 type uiBulkProvisionRequest struct {
 	DeviceIDs     []string               `json:"deviceIds"`
 	Configuration map[string]interface{} `json:"config,omitempty"`
+	Profile       string                 `json:"profile,omitempty"`
+	Template      string                 `json:"template,omitempty"`
+	Variables     map[string]string      `json:"variables,omitempty"`
 }
 
 // mapInternalToUIStatus collapses internal task statuses into the four
 // values the UI filter/state machine expects.
 func mapInternalToUIStatus(internal string) string {
 	switch internal {
-	case "assigned", "in_progress":
+	case "assigned", "in_progress", "verifying":
 		return "running"
+	case "verification_failed":
+		return "failed"
 	case "pending", "completed", "failed":
 		return internal
 	default:
@@ -67,10 +105,14 @@ func mapInternalToUIStatus(internal string) string {
 
 // agentStatus derives the UI-facing agent status from LastSeen timestamp,
 // mirroring the 5-minute freshness threshold used elsewhere in the registry.
+// An agent whose last heartbeat reports a task in progress is busy.
 func agentStatus(agent *ProvisionerAgent) string {
 	if time.Since(agent.LastSeen) > 5*time.Minute {
 		return "offline"
 	}
+	if agent.Health != nil && agent.Health.CurrentTask != "" {
+		return "busy"
+	}
 	if agent.Status != "" {
 		return agent.Status
 	}
@@ -101,6 +143,8 @@ func (h *Handler) toUITask(task *ProvisioningTask) uiProvisioningTask {
 	}
 	if errMsg, ok := task.Config["_error"].(string); ok {
 		out.Error = errMsg
+	} else if v := task.Verification; v != nil && v.Result != service.ProvisioningVerified {
+		out.Error = v.Error
 	}
 
 	return out
@@ -111,7 +155,7 @@ func toUIAgent(agent *ProvisionerAgent) uiProvisioningAgent {
 	if capabilities == nil {
 		capabilities = []string{}
 	}
-	return uiProvisioningAgent{
+	out := uiProvisioningAgent{
 		ID:           agent.ID,
 		Name:         agent.Hostname,
 		Status:       agentStatus(agent),
@@ -119,6 +163,29 @@ func toUIAgent(agent *ProvisionerAgent) uiProvisioningAgent {
 		Capabilities: capabilities,
 		LastSeen:     agent.LastSeen,
 	}
+	if health := agent.Health; health != nil && agent.LastHeartbeat != nil {
+		problems := health.Problems
+		if problems == nil {
+			problems = []string{}
+		}
+		out.Health = &uiAgentHealth{
+			Status:          health.Status,
+			Problems:        problems,
+			ReportedAt:      *agent.LastHeartbeat,
+			UptimeSeconds:   health.UptimeSeconds,
+			Interface:       health.Interface.Name,
+			InterfaceStatus: health.Interface.Status,
+			CurrentTask:     health.CurrentTask,
+			LastScanAt:      health.LastScanAt,
+			LastScanDevices: health.LastScanDevices,
+			LastScanError:   health.LastScanError,
+			LastTaskAt:      health.LastTaskAt,
+			LastTaskStatus:  health.LastTaskStatus,
+			LastTaskError:   health.LastTaskError,
+			Counters:        uiAgentHealthCounters(health.Counters),
+		}
+	}
+	return out
 }
 
 // resolveDeviceMAC looks up the MAC address for a numeric device ID carried
@@ -212,26 +279,38 @@ func (h *Handler) CreateProvisioningTaskUI(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	task := h.createTaskLocked(req.TaskType, mac, req.Configuration)
+	targetSSID, config, err := h.withProvisioningProfile(req.Profile, "", req.Configuration)
+	if err != nil {
+		h.writeTaskProfileError(w, r, err)
+		return
+	}
+	targetSSID, config, err = h.withTaskTemplate(req.Template, req.Variables, mac, targetSSID, config)
+	if err != nil {
+		h.writeTaskTemplateError(w, r, err)
+		return
+	}
+
+	task := h.createTaskLocked(req.TaskType, mac, targetSSID, config)
 	h.responseWriter().WriteCreated(w, r, h.toUITask(task))
 }
 
 // createTaskLocked builds and inserts a ProvisioningTask into the registry.
 // Separated so BulkProvisionUI can reuse the insertion logic.
-func (h *Handler) createTaskLocked(taskType, deviceMAC string, config map[string]interface{}) *ProvisioningTask {
+func (h *Handler) createTaskLocked(taskType, deviceMAC, targetSSID string, config map[string]interface{}) *ProvisioningTask {
 	taskID := fmt.Sprintf("task_%d", time.Now().UnixNano())
 	if config == nil {
 		config = map[string]interface{}{}
 	}
 	now := time.Now()
 	task := &ProvisioningTask{
-		ID:        taskID,
-		Type:      taskType,
-		DeviceMAC: deviceMAC,
-		Config:    config,
-		Status:    "pending",
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:         taskID,
+		Type:       taskType,
+		DeviceMAC:  deviceMAC,
+		TargetSSID: targetSSID,
+		Config:     config,
+		Status:     "pending",
+		CreatedAt:  now,
+		UpdatedAt:  now,
 	}
 	registry.mu.Lock()
 	registry.tasks[taskID] = task
@@ -247,6 +326,18 @@ func (h *Handler) createTaskLocked(taskType, deviceMAC string, config map[string
 	return task
 }
 
+// copyTaskConfig gives each task of a bulk request its own configuration
+func copyTaskConfig(config map[string]interface{}) map[string]interface{} {
+	if config == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		out[k] = v
+	}
+	return out
+}
+
 // CancelProvisioningTaskUI handles POST /api/v1/provisioning/tasks/{id}/cancel
 //
 // For unassigned tasks this is a clean flip to "failed" with error="canceled".
@@ -296,6 +387,12 @@ func (h *Handler) BulkProvisionUI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	targetSSID, config, err := h.withProvisioningProfile(req.Profile, "", req.Configuration)
+	if err != nil {
+		h.writeTaskProfileError(w, r, err)
+		return
+	}
+
 	uiTasks := make([]uiProvisioningTask, 0, len(req.DeviceIDs))
 	for _, devID := range req.DeviceIDs {
 		mac, err := h.resolveDeviceMAC(devID)
@@ -304,7 +401,13 @@ func (h *Handler) BulkProvisionUI(w http.ResponseWriter, r *http.Request) {
 				fmt.Sprintf("device %q: %s", devID, err.Error()), nil)
 			return
 		}
-		task := h.createTaskLocked("configure", mac, req.Configuration)
+		// The template is expanded per device, as its variables include the MAC
+		taskSSID, taskConfig, err := h.withTaskTemplate(req.Template, req.Variables, mac, targetSSID, copyTaskConfig(config))
+		if err != nil {
+			h.writeTaskTemplateError(w, r, err)
+			return
+		}
+		task := h.createTaskLocked("configure", mac, taskSSID, taskConfig)
 		uiTasks = append(uiTasks, h.toUITask(task))
 	}
 
@@ -320,22 +423,18 @@ func (h *Handler) ListProvisioningAgentsUI(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Translate under the lock; heartbeats update agents concurrently
 	registry.mu.RLock()
-	agents := make([]*ProvisionerAgent, 0, len(registry.agents))
+	uiAgents := make([]uiProvisioningAgent, 0, len(registry.agents))
 	for _, a := range registry.agents {
-		agents = append(agents, a)
+		uiAgents = append(uiAgents, toUIAgent(a))
 	}
 	registry.mu.RUnlock()
 
-	sort.Slice(agents, func(i, j int) bool {
-		return agents[i].Hostname < agents[j].Hostname
+	sort.Slice(uiAgents, func(i, j int) bool {
+		return uiAgents[i].Name < uiAgents[j].Name
 	})
 
-	uiAgents := make([]uiProvisioningAgent, 0, len(agents))
-	for _, a := range agents {
-		uiAgents = append(uiAgents, toUIAgent(a))
-	}
-
 	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
 		"agents": uiAgents,
 		"count":  len(uiAgents),
@@ -351,11 +450,15 @@ func (h *Handler) GetProvisioningAgentStatusUI(w http.ResponseWriter, r *http.Re
 	id := mux.Vars(r)["id"]
 	registry.mu.RLock()
 	agent, ok := registry.agents[id]
+	var out uiProvisioningAgent
+	if ok {
+		out = toUIAgent(agent)
+	}
 	registry.mu.RUnlock()
 	if !ok {
 		h.responseWriter().WriteNotFoundError(w, r, "Provisioning agent")
 		return
 	}
 
-	h.responseWriter().WriteSuccess(w, r, toUIAgent(agent))
+	h.responseWriter().WriteSuccess(w, r, out)
 }
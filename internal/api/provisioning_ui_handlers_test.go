@@ -13,8 +13,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ginsys/shelly-manager/internal/config"
 	"github.com/ginsys/shelly-manager/internal/database"
 	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/service"
 	"github.com/ginsys/shelly-manager/internal/testutil"
 )
 
@@ -340,6 +342,54 @@ func TestGetProvisioningAgentStatusUI(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
+func TestAgentHeartbeat_ShowsHealthInAgentList(t *testing.T) {
+	resetProvisioningRegistry()
+	h, _ := newTestHandler(t)
+
+	registry.mu.Lock()
+	registry.agents["a1"] = &ProvisionerAgent{ID: "a1", Hostname: "alpha", Status: "online", LastSeen: time.Now().Add(-time.Minute)}
+	registry.mu.Unlock()
+
+	heartbeat := func(id, body string) int {
+		req := httptest.NewRequest("POST", "/api/v1/provisioner/agents/"+id+"/heartbeat", bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		h.AgentHeartbeat(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusNotFound, heartbeat("missing", `{}`))
+	assert.Equal(t, http.StatusBadRequest, heartbeat("a1", `{`))
+	require.Equal(t, http.StatusOK, heartbeat("a1", `{
+		"status": "degraded",
+		"problems": ["Wi-Fi interface unavailable"],
+		"interface": {"name": "wlan0", "status": "unavailable"},
+		"current_task": "task_1",
+		"last_scan_devices": 2,
+		"counters": {"scans": 4, "scan_errors": 1}
+	}`))
+
+	req := httptest.NewRequest("GET", "/api/v1/provisioning/agents", nil)
+	w := httptest.NewRecorder()
+	h.ListProvisioningAgentsUI(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var env struct {
+		Data struct {
+			Agents []uiProvisioningAgent `json:"agents"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &env))
+	require.Len(t, env.Data.Agents, 1)
+	agent := env.Data.Agents[0]
+	assert.Equal(t, "busy", agent.Status)
+	require.NotNil(t, agent.Health)
+	assert.Equal(t, "degraded", agent.Health.Status)
+	assert.Equal(t, []string{"Wi-Fi interface unavailable"}, agent.Health.Problems)
+	assert.Equal(t, "wlan0", agent.Health.Interface)
+	assert.Equal(t, "unavailable", agent.Health.InterfaceStatus)
+	assert.Equal(t, int64(1), agent.Health.Counters.ScanErrors)
+	assert.WithinDuration(t, time.Now(), agent.LastSeen, 5*time.Second)
+}
+
 func TestProvisioningUI_RequiresAdminWhenKeyConfigured(t *testing.T) {
 	resetProvisioningRegistry()
 	h, _ := newTestHandler(t)
@@ -359,16 +409,96 @@ func TestProvisioningUI_RequiresAdminWhenKeyConfigured(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestUpdateTaskStatus_VerifiesProvisionedDevice(t *testing.T) {
+	resetProvisioningRegistry()
+	h, _ := newTestHandler(t)
+	h.Service.Config.Discovery.EnableMDNS = false
+	h.Service.Config.Provisioning.Verification = config.ProvisioningVerificationConfig{Enabled: true, Timeout: 1, Interval: 1}
+	registry.tasks["t_verify"] = &ProvisioningTask{
+		ID: "t_verify", Type: "provision_device", DeviceMAC: "E8DB84000081", TargetSSID: "Home", Status: "in_progress",
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/provisioner/tasks/t_verify/status", bytes.NewReader([]byte(`{"status":"completed"}`)))
+	req = mux.SetURLVars(req, map[string]string{"id": "t_verify"})
+	w := httptest.NewRecorder()
+	h.UpdateTaskStatus(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"verifying"`)
+
+	// Nothing answers for the MAC, so the agent's success is not confirmed
+	require.Eventually(t, func() bool {
+		registry.mu.RLock()
+		defer registry.mu.RUnlock()
+		return registry.tasks["t_verify"].Status != "verifying"
+	}, 10*time.Second, 20*time.Millisecond)
+	registry.mu.RLock()
+	task := *registry.tasks["t_verify"]
+	registry.mu.RUnlock()
+	assert.Equal(t, "verification_failed", task.Status)
+	require.NotNil(t, task.Verification)
+	assert.Equal(t, service.ProvisioningNotJoined, task.Verification.Result)
+	ui := h.toUITask(&task)
+	assert.Equal(t, "failed", ui.Status)
+	assert.NotEmpty(t, ui.Error)
+}
+
 func TestMapInternalToUIStatus(t *testing.T) {
 	cases := map[string]string{
-		"pending":     "pending",
-		"assigned":    "running",
-		"in_progress": "running",
-		"completed":   "completed",
-		"failed":      "failed",
-		"other":       "other",
+		"pending":             "pending",
+		"assigned":            "running",
+		"in_progress":         "running",
+		"completed":           "completed",
+		"failed":              "failed",
+		"verifying":           "running",
+		"verification_failed": "failed",
+		"joined_unreachable":  "joined_unreachable",
+		"other":               "other",
 	}
 	for in, want := range cases {
 		assert.Equal(t, want, mapInternalToUIStatus(in), "input=%s", in)
 	}
 }
+
+func TestCreateProvisioningTaskUI_Profile(t *testing.T) {
+	resetProvisioningRegistry()
+	h, db := newTestHandler(t)
+	dev := seedDevice(t, db, "10.0.0.1", "AA:BB:CC:DD:EE:01", "Living Room")
+
+	req := httptest.NewRequest("PUT", "/api/v1/provisioning/profiles/site-a",
+		bytes.NewReader([]byte(`{"ssid":"IoT","wifi_password":"wifi-secret","enable_mqtt":true,"mqtt_server":"10.0.0.5:1883"}`)))
+	req = mux.SetURLVars(req, map[string]string{"name": "site-a"})
+	w := httptest.NewRecorder()
+	h.SaveProvisioningProfile(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "wifi-secret")
+	assert.Contains(t, w.Body.String(), `"has_wifi_password":true`)
+
+	body := `{"deviceId":"` + strconv.FormatUint(uint64(dev.ID), 10) + `","taskType":"provision","profile":"site-a","config":{"device_name":"porch"}}`
+	req = httptest.NewRequest("POST", "/api/v1/provisioning/tasks", bytes.NewReader([]byte(body)))
+	w = httptest.NewRecorder()
+	h.CreateProvisioningTaskUI(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	registry.mu.RLock()
+	require.Len(t, registry.tasks, 1)
+	for _, task := range registry.tasks {
+		assert.Equal(t, "IoT", task.TargetSSID)
+		assert.Equal(t, "wifi-secret", task.Config["password"])
+		assert.Equal(t, "10.0.0.5:1883", task.Config["mqtt_server"])
+		assert.Equal(t, "porch", task.Config["device_name"])
+	}
+	registry.mu.RUnlock()
+
+	// The provisioner gets the profile with its credentials
+	req = mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/provisioner/profiles/site-a", nil), map[string]string{"name": "site-a"})
+	w = httptest.NewRecorder()
+	h.GetProvisionerProfile(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"password":"wifi-secret"`)
+
+	body = `{"deviceId":"` + strconv.FormatUint(uint64(dev.ID), 10) + `","taskType":"provision","profile":"unknown"}`
+	req = httptest.NewRequest("POST", "/api/v1/provisioning/tasks", bytes.NewReader([]byte(body)))
+	w = httptest.NewRecorder()
+	h.CreateProvisioningTaskUI(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
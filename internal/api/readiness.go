@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+)
+
+// ReadinessCheck reports why a subsystem is not ready to serve; nil means
+// it is ready
+type ReadinessCheck func(ctx context.Context) error
+
+type readinessCheck struct {
+	name  string
+	check ReadinessCheck
+}
+
+// SubsystemStatus is the readiness of one subsystem
+type SubsystemStatus struct {
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// AddReadinessCheck registers a subsystem that /readyz checks, such as the
+// sync plugins or a scheduler. Checks run on every request, so they only
+// read state the subsystem keeps.
+func (h *Handler) AddReadinessCheck(name string, check ReadinessCheck) {
+	h.readinessChecks = append(h.readinessChecks, readinessCheck{name: name, check: check})
+}
+
+// Readyz returns readiness per subsystem: the database is reachable, its
+// migrations completed, and every registered subsystem finished starting.
+// It answers 503 with the status of each subsystem while any is not ready,
+// so orchestrators keep traffic away from a half-initialized instance.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	subsystems := map[string]SubsystemStatus{}
+	var notReady []string
+	record := func(name string, err error) {
+		if err != nil {
+			subsystems[name] = SubsystemStatus{Error: err.Error()}
+			notReady = append(notReady, name)
+			return
+		}
+		subsystems[name] = SubsystemStatus{Ready: true}
+	}
+
+	var one int
+	if err := h.DB.GetDB().WithContext(r.Context()).Raw("SELECT 1").Scan(&one).Error; err != nil || one != 1 {
+		if err == nil {
+			err = fmt.Errorf("unexpected ping result")
+		}
+		record("database", err)
+	} else {
+		record("database", nil)
+		if mgr, ok := h.DB.(interface{ MissingTables() ([]string, error) }); ok {
+			missing, err := mgr.MissingTables()
+			if err == nil && len(missing) > 0 {
+				err = fmt.Errorf("missing tables: %s", strings.Join(missing, ", "))
+			}
+			record("migrations", err)
+		}
+	}
+	for _, c := range h.readinessChecks {
+		record(c.name, c.check(r.Context()))
+	}
+
+	if len(notReady) > 0 {
+		h.responseWriter().WriteError(w, r, http.StatusServiceUnavailable, apiresp.ErrCodeServiceUnavailable,
+			"Not ready: "+strings.Join(notReady, ", "), map[string]interface{}{"subsystems": subsystems})
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]any{"ready": true, "subsystems": subsystems})
+}
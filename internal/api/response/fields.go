@@ -0,0 +1,110 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// FieldsParam is the query parameter selecting the fields of list items,
+// e.g. ?fields=id,name,ip,status. Nested fields use dots: asset.serial.
+const FieldsParam = "fields"
+
+// fieldSet is a tree of selected fields; an empty set selects the whole value
+type fieldSet map[string]fieldSet
+
+// requestedFields parses the fields query parameter; nil when absent
+func requestedFields(r *http.Request) fieldSet {
+	if r == nil || r.URL == nil {
+		return nil
+	}
+	raw := r.URL.Query().Get(FieldsParam)
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	fields := fieldSet{}
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		node := fields
+		for _, part := range strings.Split(name, ".") {
+			child, ok := node[part]
+			if !ok {
+				child = fieldSet{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// selectFields reduces the list items in data to the requested fields. The
+// lists are data itself when it is an array, or the arrays directly under a
+// data object, such as {"devices": [...], "count": 2}; everything else is
+// returned as is, so single resources and counts are unaffected.
+func selectFields(data interface{}, fields fieldSet) (interface{}, error) {
+	if fields == nil || data == nil {
+		return data, nil
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // keep IDs and counts exactly as encoded
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	switch v := generic.(type) {
+	case []interface{}:
+		return projectList(v, fields), nil
+	case map[string]interface{}:
+		for key, value := range v {
+			if list, ok := value.([]interface{}); ok {
+				v[key] = projectList(list, fields)
+			}
+		}
+		return v, nil
+	}
+	return generic, nil
+}
+
+// projectList reduces every object of a list to the selected fields
+func projectList(list []interface{}, fields fieldSet) []interface{} {
+	for i, item := range list {
+		if obj, ok := item.(map[string]interface{}); ok {
+			list[i] = projectObject(obj, fields)
+		}
+	}
+	return list
+}
+
+// projectObject keeps the selected fields of obj; fields it lacks are left out
+func projectObject(obj map[string]interface{}, fields fieldSet) map[string]interface{} {
+	out := make(map[string]interface{}, len(fields))
+	for name, sub := range fields {
+		value, ok := obj[name]
+		if !ok {
+			continue
+		}
+		if len(sub) > 0 {
+			switch nested := value.(type) {
+			case map[string]interface{}:
+				value = projectObject(nested, sub)
+			case []interface{}:
+				value = projectList(nested, sub)
+			}
+		}
+		out[name] = value
+	}
+	return out
+}
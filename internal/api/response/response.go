@@ -76,6 +76,12 @@ const (
 	ErrCodeRateLimitExceeded = "RATE_LIMIT_EXCEEDED"
 	ErrCodeRequestTooLarge   = "REQUEST_TOO_LARGE"
 	ErrCodeUnsupportedMedia  = "UNSUPPORTED_MEDIA_TYPE"
+	// ErrCodeConfirmationRequired asks the client to repeat a bulk operation
+	// with the confirmation token from the error details
+	ErrCodeConfirmationRequired = "CONFIRMATION_REQUIRED"
+	// ErrCodeApprovalRequired reports a change held for approval by another
+	// user; the pending change request is in the error details
+	ErrCodeApprovalRequired = "APPROVAL_REQUIRED"
 
 	// Server errors (5xx)
 	ErrCodeInternalServer       = "INTERNAL_SERVER_ERROR"
@@ -93,6 +99,7 @@ const (
 	ErrCodeProvisioningError  = "PROVISIONING_ERROR"
 	ErrCodeMetricsError       = "METRICS_ERROR"
 	ErrCodeNotificationError  = "NOTIFICATION_ERROR"
+	ErrCodeUnsupported        = "UNSUPPORTED_CAPABILITY"
 )
 
 // ResponseBuilder provides a fluent interface for building responses
@@ -191,14 +198,15 @@ func NewResponseWriter(logger *logging.Logger) *ResponseWriter {
 	return &ResponseWriter{logger: logger}
 }
 
-// WriteSuccess writes a successful JSON response
+// WriteSuccess writes a successful JSON response. List items are reduced to
+// the fields named by the fields query parameter, if any.
 func (rw *ResponseWriter) WriteSuccess(w http.ResponseWriter, r *http.Request, data interface{}) {
 	builder := NewResponseBuilder(rw.logger)
 	if requestID := getRequestIDFromContext(r); requestID != "" {
 		builder.WithRequestID(requestID)
 	}
 
-	response := builder.Success(data)
+	response := builder.Success(rw.sparseData(r, data))
 	// Ensure version metadata is present for observability
 	if response.Meta == nil {
 		response.Meta = &Metadata{}
@@ -209,14 +217,15 @@ func (rw *ResponseWriter) WriteSuccess(w http.ResponseWriter, r *http.Request, d
 	rw.writeJSONResponse(w, http.StatusOK, response)
 }
 
-// WriteSuccessWithMeta writes a successful response with metadata
+// WriteSuccessWithMeta writes a successful response with metadata, reducing
+// list items to the requested fields like WriteSuccess
 func (rw *ResponseWriter) WriteSuccessWithMeta(w http.ResponseWriter, r *http.Request, data interface{}, meta *Metadata) {
 	builder := NewResponseBuilder(rw.logger)
 	if requestID := getRequestIDFromContext(r); requestID != "" {
 		builder.WithRequestID(requestID)
 	}
 
-	response := builder.WithMeta(meta).Success(data)
+	response := builder.WithMeta(meta).Success(rw.sparseData(r, data))
 	if response.Meta == nil {
 		response.Meta = &Metadata{}
 	}
@@ -226,6 +235,23 @@ func (rw *ResponseWriter) WriteSuccessWithMeta(w http.ResponseWriter, r *http.Re
 	rw.writeJSONResponse(w, http.StatusOK, response)
 }
 
+// sparseData applies the fields query parameter to data. Data that cannot
+// be filtered is returned whole rather than failing the request.
+func (rw *ResponseWriter) sparseData(r *http.Request, data interface{}) interface{} {
+	fields := requestedFields(r)
+	if fields == nil {
+		return data
+	}
+	filtered, err := selectFields(data, fields)
+	if err != nil {
+		if rw.logger != nil {
+			rw.logger.Warn("Failed to apply response fields", "error", err)
+		}
+		return data
+	}
+	return filtered
+}
+
 // WriteError writes an error response
 func (rw *ResponseWriter) WriteError(w http.ResponseWriter, r *http.Request, statusCode int, code, message string, details interface{}) {
 	builder := NewResponseBuilder(rw.logger)
@@ -302,6 +328,17 @@ func (rw *ResponseWriter) WriteCreated(w http.ResponseWriter, r *http.Request, d
 	rw.writeJSONResponse(w, http.StatusCreated, response)
 }
 
+// WriteAccepted writes an accepted response (202) for work continuing in the background
+func (rw *ResponseWriter) WriteAccepted(w http.ResponseWriter, r *http.Request, data interface{}) {
+	builder := NewResponseBuilder(rw.logger)
+	if requestID := getRequestIDFromContext(r); requestID != "" {
+		builder.WithRequestID(requestID)
+	}
+
+	response := builder.Success(data)
+	rw.writeJSONResponse(w, http.StatusAccepted, response)
+}
+
 // WriteNoContent writes a no content response (204)
 func (rw *ResponseWriter) WriteNoContent(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
@@ -856,3 +856,76 @@ func TestContentLengthMatchesBody(t *testing.T) {
 func intPtr(i int) *int {
 	return &i
 }
+
+func TestSparseFieldsets(t *testing.T) {
+	logger, _ := logging.New(logging.Config{Level: "debug", Format: "text", Output: "stdout"})
+	writer := NewResponseWriter(logger)
+
+	type asset struct {
+		Serial string `json:"serial"`
+		Room   string `json:"room"`
+	}
+	type device struct {
+		ID     uint   `json:"id"`
+		Name   string `json:"name"`
+		IP     string `json:"ip"`
+		Status string `json:"status"`
+		Asset  asset  `json:"asset"`
+	}
+	devices := []device{
+		{ID: 1, Name: "Hall", IP: "10.0.0.1", Status: "online", Asset: asset{Serial: "S1", Room: "hall"}},
+		{ID: 2, Name: "Shed", IP: "10.0.0.2", Status: "offline", Asset: asset{Serial: "S2", Room: "garden"}},
+	}
+
+	decode := func(t *testing.T, rr *httptest.ResponseRecorder) map[string]interface{} {
+		t.Helper()
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, strconv.Itoa(rr.Body.Len()), rr.Header().Get("Content-Length"))
+		return resp
+	}
+
+	t.Run("list under data object", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/devices?fields=id,%20name,asset.serial,missing", nil)
+		writer.WriteSuccessWithMeta(rr, req, map[string]interface{}{"devices": devices, "count": 2}, &Metadata{Version: "v1"})
+
+		resp := decode(t, rr)
+		data := resp["data"].(map[string]interface{})
+		assert.Equal(t, float64(2), data["count"])
+		items := data["devices"].([]interface{})
+		require.Len(t, items, 2)
+		assert.Equal(t, map[string]interface{}{
+			"id": float64(1), "name": "Hall", "asset": map[string]interface{}{"serial": "S1"},
+		}, items[0])
+		assert.NotNil(t, resp["meta"])
+	})
+
+	t.Run("top-level list", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/devices?fields=ip,status", nil)
+		writer.WriteSuccess(rr, req, devices)
+
+		items := decode(t, rr)["data"].([]interface{})
+		assert.Equal(t, map[string]interface{}{"ip": "10.0.0.2", "status": "offline"}, items[1])
+	})
+
+	t.Run("single resource unchanged", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/devices/1?fields=id", nil)
+		writer.WriteSuccess(rr, req, devices[0])
+
+		data := decode(t, rr)["data"].(map[string]interface{})
+		assert.Equal(t, "Hall", data["name"])
+		assert.Equal(t, "S1", data["asset"].(map[string]interface{})["serial"])
+	})
+
+	t.Run("no fields parameter", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/devices?fields=", nil)
+		writer.WriteSuccess(rr, req, devices)
+
+		items := decode(t, rr)["data"].([]interface{})
+		assert.Len(t, items[0].(map[string]interface{}), 5)
+	})
+}
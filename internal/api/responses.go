@@ -0,0 +1,35 @@
+package api
+
+import "github.com/ginsys/shelly-manager/internal/service"
+
+// Named response bodies of handlers that have no service type of their own.
+// The Go client in api/client is generated from these.
+
+// Health is the response of /healthz
+type Health struct {
+	Status string `json:"status"` // ok or degraded
+}
+
+// VersionInfo is the response of /version
+type VersionInfo struct {
+	APIVersion              string `json:"api_version"`
+	ServerStartedAt         string `json:"server_started_at"`
+	DatabaseProviderName    string `json:"database_provider_name,omitempty"`
+	DatabaseProviderVersion string `json:"database_provider_version,omitempty"`
+}
+
+// ControlResult is the response of a device control action
+type ControlResult struct {
+	Status   string `json:"status"`
+	DeviceID uint   `json:"device_id"`
+	Action   string `json:"action"`
+}
+
+// BulkControlSummary is the response of a synchronous bulk control run
+type BulkControlSummary struct {
+	Action    string                      `json:"action"`
+	Results   []service.BulkControlResult `json:"results"`
+	Total     int                         `json:"total"`
+	Succeeded int                         `json:"succeeded"`
+	Failed    int                         `json:"failed"`
+}
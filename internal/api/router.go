@@ -49,6 +49,7 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 	if handler != nil {
 		// Create a subrouter for health endpoints with only basic middleware
 		healthRouter := r.PathPrefix("/").Subrouter()
+		healthRouter.Use(logging.RequestIDMiddleware())
 		healthRouter.Use(logging.RecoveryMiddleware(logger))
 		healthRouter.Use(logging.HTTPMiddleware(logger))
 		healthRouter.HandleFunc("/healthz", handler.Healthz).Methods("GET")
@@ -66,15 +67,38 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 			}
 		}
 		wsRouter := r.PathPrefix("/").Subrouter()
+		wsRouter.Use(logging.RequestIDMiddleware())
 		wsRouter.Use(logging.RecoveryMiddleware(logger))
 		wsRouter.HandleFunc("/metrics/ws", handler.MetricsHandler.HandleWebSocket).Methods("GET")
 	}
 
+	// Device WebSocket endpoint, also with minimal middleware: Gen2 devices
+	// keep the connection open and authenticate with the device_socket token
+	if handler != nil {
+		deviceWSRouter := r.PathPrefix("/").Subrouter()
+		deviceWSRouter.Use(logging.RequestIDMiddleware())
+		deviceWSRouter.Use(logging.RecoveryMiddleware(logger))
+		deviceWSRouter.HandleFunc("/devices/ws", handler.DeviceSocket).Methods("GET")
+	}
+
+	// Device enrollment, also outside the API middleware: devices send no
+	// user agent or API key and authenticate with their one-time token
+	if handler != nil {
+		enrollRouter := r.PathPrefix("/").Subrouter()
+		enrollRouter.Use(logging.RequestIDMiddleware())
+		enrollRouter.Use(logging.RecoveryMiddleware(logger))
+		enrollRouter.Use(middleware.RateLimitMiddleware(securityConfig, logger))
+		enrollRouter.Use(logging.HTTPMiddleware(logger))
+		enrollRouter.HandleFunc("/enroll", handler.Enroll).Methods("POST")
+	}
+
 	// Create protected subrouter for all other routes with full security middleware
 	protected := r.PathPrefix("/").Subrouter()
 
 	// Apply security middleware in proper order:
-	// 1. Recovery middleware (catch panics first)
+	// 1. Request ID (returned to the client and attached to every later log)
+	// and recovery middleware (catch panics first)
+	protected.Use(logging.RequestIDMiddleware())
 	protected.Use(logging.RecoveryMiddleware(logger))
 
 	// 2. IP blocking middleware (block malicious IPs early)
@@ -120,6 +144,19 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 		protected.Use(hm.HTTPMiddleware())
 	}
 
+	// 13. Authentication middleware (attach the signed-in user, enforce roles)
+	if handler != nil && handler.Auth != nil {
+		protected.Use(middleware.AuthMiddleware(handler.Auth, func() string { return handler.AdminAPIKey }, logger))
+	}
+
+	// 14. Idempotency middleware (replay responses to retried POST requests)
+	protected.Use(middleware.IdempotencyMiddleware(securityConfig, newIdempotencyStore(handler), logger))
+
+	// 15. API usage (device traffic by client, after authentication)
+	if handler != nil && handler.Service != nil {
+		protected.Use(usageMiddleware(handler))
+	}
+
 	// API routes - use protected subrouter for full security middleware
 	api := protected.PathPrefix("/api/v1").Subrouter()
 
@@ -130,24 +167,85 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 		w.WriteHeader(http.StatusOK)
 	}))
 
+	// Sign-in routes (reachable without a session)
+	api.HandleFunc("/auth/config", handler.GetAuthConfig).Methods("GET")
+	api.HandleFunc("/auth/me", handler.GetCurrentUser).Methods("GET")
+	api.HandleFunc("/auth/oidc/login", handler.OIDCLogin).Methods("GET")
+	api.HandleFunc("/auth/oidc/callback", handler.OIDCCallback).Methods("GET")
+	api.HandleFunc("/auth/logout", handler.Logout).Methods("POST")
+
 	// Admin routes (guarded by simple admin key if configured)
 	api.HandleFunc("/admin/rotate-admin-key", handler.RotateAdminKey).Methods("POST")
+	api.HandleFunc("/admin/integrity", handler.GetIntegrityReport).Methods("GET")
+	api.HandleFunc("/admin/logging", handler.GetLogging).Methods("GET")
+	api.HandleFunc("/admin/logging", handler.UpdateLogging).Methods("PUT")
+	api.HandleFunc("/admin/integrity/cleanup", handler.CleanupIntegrity).Methods("POST")
+	api.HandleFunc("/admin/integrity/relink", handler.RelinkDeviceHistory).Methods("POST")
+	api.HandleFunc("/admin/identity/verify", handler.VerifyDeviceIdentities).Methods("POST")
+	api.HandleFunc("/admin/identity/conflicts", handler.GetIdentityConflicts).Methods("GET")
+	api.HandleFunc("/admin/identity/conflicts/{id:[0-9]+}/resolve", handler.ResolveIdentityConflict).Methods("POST")
+	api.HandleFunc("/admin/usage", handler.GetAPIUsage).Methods("GET")
+	api.HandleFunc("/admin/usage", handler.ResetAPIUsage).Methods("DELETE")
+
+	// Change requests held for approval under the two-person rule
+	api.HandleFunc("/change-requests", handler.ListChangeRequests).Methods("GET")
+	api.HandleFunc("/change-requests/{id:[0-9]+}", handler.GetChangeRequest).Methods("GET")
+	api.HandleFunc("/change-requests/{id:[0-9]+}/approve", handler.ApproveChangeRequest).Methods("POST")
+	api.HandleFunc("/change-requests/{id:[0-9]+}/reject", handler.RejectChangeRequest).Methods("POST")
+
+	// Operation hooks that enrich or veto adoption, config exports and drift alerts
+	api.HandleFunc("/hooks", handler.ListHooks).Methods("GET")
+	api.HandleFunc("/hooks", handler.CreateHook).Methods("POST")
+	api.HandleFunc("/hooks/{id:[0-9]+}", handler.GetHook).Methods("GET")
+	api.HandleFunc("/hooks/{id:[0-9]+}", handler.UpdateHook).Methods("PUT")
+	api.HandleFunc("/hooks/{id:[0-9]+}", handler.DeleteHook).Methods("DELETE")
+
+	// Fleet summary for the dashboard
+	api.HandleFunc("/summary", handler.GetFleetSummary).Methods("GET")
 
 	// Device routes
 	api.HandleFunc("/devices", handler.GetDevices).Methods("GET")
 	api.HandleFunc("/devices", handler.AddDevice).Methods("POST")
+	api.HandleFunc("/devices/rename", handler.RenameDevices).Methods("POST")
+	api.HandleFunc("/devices/sync-names", handler.SyncDeviceNames).Methods("POST")
+	api.HandleFunc("/devices/names/hygiene", handler.GetNameHygiene).Methods("GET")
+	api.HandleFunc("/devices/cloud/disable", handler.DisableCloud).Methods("POST")
+	api.HandleFunc("/devices/cloud/sync", handler.SyncCloud).Methods("POST")
+	api.HandleFunc("/devices/maintenance", handler.ListMaintenance).Methods("GET")
+	api.HandleFunc("/devices/maintenance", handler.SetMaintenance).Methods("POST")
+	api.HandleFunc("/devices/maintenance/clear", handler.ClearMaintenance).Methods("POST")
+	api.HandleFunc("/devices/control", handler.BulkControlDevices).Methods("POST")
+	api.HandleFunc("/devices/control/jobs/{id}", handler.GetBulkControlJob).Methods("GET")
+	api.HandleFunc("/devices/assets/import", handler.ImportDeviceAssets).Methods("POST")
+	api.HandleFunc("/devices/sheet", handler.GetDeviceSheet).Methods("GET")
+	api.HandleFunc("/devices/sheet/import", handler.ImportDeviceSheet).Methods("POST")
+	api.HandleFunc("/devices/dependencies", handler.ListDeviceDependencies).Methods("GET")
+	api.HandleFunc("/devices/dependencies", handler.AddDeviceDependency).Methods("POST")
+	api.HandleFunc("/devices/dependencies/{id:[0-9]+}", handler.RemoveDeviceDependency).Methods("DELETE")
+	api.HandleFunc("/devices/dependencies/sync-extenders", handler.SyncExtenderDependencies).Methods("POST")
+	api.HandleFunc("/devices/dependencies/order", handler.GetDependencyOrder).Methods("POST")
 	api.HandleFunc("/devices/{id}", handler.GetDevice).Methods("GET")
 	api.HandleFunc("/devices/{id}", handler.UpdateDevice).Methods("PUT")
 	api.HandleFunc("/devices/{id}", handler.DeleteDevice).Methods("DELETE")
+	api.HandleFunc("/devices/{id}/replace", handler.ReplaceDevice).Methods("POST")
+	api.HandleFunc("/devices/{id}/refresh", handler.RefreshDevice).Methods("POST")
+	api.HandleFunc("/devices/{id}/profile", handler.SetDeviceProfile).Methods("POST")
+	api.HandleFunc("/devices/{id}/asset", handler.SetDeviceAsset).Methods("PUT")
 
 	// Device control routes
 	api.HandleFunc("/devices/{id}/control", handler.ControlDevice).Methods("POST")
 	api.HandleFunc("/devices/{id}/status", handler.GetDeviceStatus).Methods("GET")
 	api.HandleFunc("/devices/{id}/energy", handler.GetDeviceEnergy).Methods("GET")
+	api.HandleFunc("/devices/{id}/energy/totals", handler.GetDeviceEnergyTotals).Methods("GET")
+	api.HandleFunc("/devices/{id}/overview", handler.GetDeviceOverview).Methods("GET")
+	api.HandleFunc("/devices/{id}/reboots", handler.GetDeviceReboots).Methods("GET")
+	api.HandleFunc("/devices/{id}/protection-trips", handler.GetDeviceProtectionTrips).Methods("GET")
+	api.HandleFunc("/devices/{id}/range-extender", handler.GetDeviceRangeExtender).Methods("GET")
 
 	// Device configuration routes
 	api.HandleFunc("/devices/{id}/config", handler.GetDeviceConfig).Methods("GET")
 	api.HandleFunc("/devices/{id}/config", handler.UpdateDeviceConfig).Methods("PUT")
+	api.HandleFunc("/devices/{id}/config", handler.PatchDeviceConfig).Methods("PATCH")
 	api.HandleFunc("/devices/{id}/config/current", handler.GetCurrentDeviceConfig).Methods("GET")
 	api.HandleFunc("/devices/{id}/config/current/normalized", handler.GetCurrentDeviceConfigNormalized).Methods("GET")
 	api.HandleFunc("/devices/{id}/config/typed/normalized", handler.GetTypedDeviceConfigNormalized).Methods("GET")
@@ -157,6 +255,19 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 	api.HandleFunc("/devices/{id}/config/drift", handler.DetectConfigDrift).Methods("GET")
 	api.HandleFunc("/devices/{id}/config/apply-template", handler.ApplyConfigTemplate).Methods("POST")
 	api.HandleFunc("/devices/{id}/config/history", handler.GetConfigHistory).Methods("GET")
+	api.HandleFunc("/devices/{id}/config/lint", handler.GetDeviceConfigLint).Methods("GET")
+	api.HandleFunc("/devices/{id}/debug/trace", handler.StartDebugTrace).Methods("POST")
+	api.HandleFunc("/devices/{id}/debug/trace", handler.GetDebugTrace).Methods("GET")
+	api.HandleFunc("/devices/{id}/debug/trace", handler.StopDebugTrace).Methods("DELETE")
+	api.HandleFunc("/devices/{id}/proxy/{path:.*}", handler.ProxyDevice).Methods("GET", "POST")
+	api.HandleFunc("/compat/{device}/relay/{channel}", handler.CompatRelay).Methods("GET", "POST")
+	api.HandleFunc("/compat/{device}/status", handler.CompatStatus).Methods("GET")
+	api.HandleFunc("/compat/{device}/shelly", handler.CompatShelly).Methods("GET")
+	api.HandleFunc("/devices/{id}/socket", handler.GetDeviceSocket).Methods("GET")
+	api.HandleFunc("/devices/{id}/socket", handler.ConfigureDeviceSocket).Methods("POST")
+	api.HandleFunc("/devices/{id}/logs", handler.GetDeviceLogs).Methods("GET")
+	api.HandleFunc("/devices/{id}/logs/stream", handler.SetDeviceLogStreaming).Methods("POST")
+	api.HandleFunc("/debug/logs", handler.GetRecentLogs).Methods("GET")
 
 	// Device capability-specific configuration routes
 	api.HandleFunc("/devices/{id}/config/relay", handler.UpdateRelayConfig).Methods("PUT")
@@ -170,6 +281,7 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 	api.HandleFunc("/config/templates", handler.CreateConfigTemplate).Methods("POST")
 	api.HandleFunc("/config/templates/{id}", handler.UpdateConfigTemplate).Methods("PUT")
 	api.HandleFunc("/config/templates/{id}", handler.DeleteConfigTemplate).Methods("DELETE")
+	api.HandleFunc("/config/templates/{id}/preview-apply", handler.PreviewConfigTemplateApply).Methods("POST")
 
 	// Typed configuration routes
 	api.HandleFunc("/devices/{id}/config/typed", handler.GetTypedDeviceConfig).Methods("GET")
@@ -179,6 +291,9 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 	api.HandleFunc("/config/convert-to-typed", handler.ConvertConfigToTyped).Methods("POST")
 	api.HandleFunc("/config/convert-to-raw", handler.ConvertTypedToRaw).Methods("POST")
 	api.HandleFunc("/config/schema", handler.GetConfigurationSchema).Methods("GET")
+	api.HandleFunc("/config/search", handler.SearchConfigs).Methods("GET")
+	api.HandleFunc("/config/replace/plan", handler.PlanConfigReplace).Methods("POST")
+	api.HandleFunc("/config/replace/apply", handler.ApplyConfigReplace).Methods("POST")
 	api.HandleFunc("/config/bulk-validate", handler.BulkValidateConfigs).Methods("POST")
 
 	// Bulk configuration operations
@@ -200,9 +315,12 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 	api.HandleFunc("/config/drift-reports", handler.GetDriftReports).Methods("GET")
 	api.HandleFunc("/config/drift-trends", handler.GetDriftTrends).Methods("GET")
 	api.HandleFunc("/config/drift-trends/{id}/resolve", handler.MarkTrendResolved).Methods("POST")
+	api.HandleFunc("/config/drift-queue", handler.GetDriftQueue).Methods("GET")
+	api.HandleFunc("/config/drift-remediation/dry-run", handler.PlanDriftRemediation).Methods("POST")
 
 	// Device-specific drift reporting
 	api.HandleFunc("/devices/{id}/drift-report", handler.GenerateDeviceDriftReport).Methods("POST")
+	api.HandleFunc("/devices/{id}/drift/timeline", handler.GetDeviceDriftTimeline).Methods("GET")
 
 	// New template management routes (pointer-based config system)
 	api.HandleFunc("/config/templates/new", handler.GetNewConfigTemplates).Methods("GET")
@@ -240,12 +358,16 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 	if handler != nil && handler.NotificationHandler != nil {
 		api.HandleFunc("/notifications/channels", handler.NotificationHandler.CreateChannel).Methods("POST")
 		api.HandleFunc("/notifications/channels", handler.NotificationHandler.GetChannels).Methods("GET")
+		api.HandleFunc("/notifications/channels/health", handler.NotificationHandler.GetChannelHealth).Methods("GET")
+		api.HandleFunc("/notifications/channels/health/check", handler.NotificationHandler.CheckChannelHealth).Methods("POST")
 		api.HandleFunc("/notifications/channels/{id}", handler.NotificationHandler.UpdateChannel).Methods("PUT")
 		api.HandleFunc("/notifications/channels/{id}", handler.NotificationHandler.DeleteChannel).Methods("DELETE")
 		api.HandleFunc("/notifications/channels/{id}/test", handler.NotificationHandler.TestChannel).Methods("POST")
 		api.HandleFunc("/notifications/rules", handler.NotificationHandler.CreateRule).Methods("POST")
 		api.HandleFunc("/notifications/rules", handler.NotificationHandler.GetRules).Methods("GET")
 		api.HandleFunc("/notifications/history", handler.NotificationHandler.GetHistory).Methods("GET")
+		api.HandleFunc("/notifications/history/{id}/acknowledge", handler.NotificationHandler.AcknowledgeAlert).Methods("POST")
+		api.HandleFunc("/notifications/history/{id}/resolve", handler.NotificationHandler.ResolveAlert).Methods("POST")
 	}
 
 	// Metrics routes (non-WebSocket) — under /api/v1 so the frontend's axios baseURL works
@@ -257,6 +379,7 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 		//   Gated (mutating): /enable /disable /collect /test-alert
 		//   Gated (data reads, consistent with /health /system /...): /status /dashboard
 		//     plus /health /system /devices /drift /notifications /resolution /security
+		//     and the device latency trends /latency /devices/{id}/latency
 		//   Public: /prometheus — standard scrapers do not send the admin bearer, and
 		//     it exposes only aggregate counters; secure it at the network layer instead.
 		//   The /metrics/ws real-time stream is a separate concern (see #247).
@@ -278,6 +401,8 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 		metricsAPI.HandleFunc("/drift", handler.MetricsHandler.GetDriftSummary).Methods("GET")
 		metricsAPI.HandleFunc("/notifications", handler.MetricsHandler.GetNotificationSummary).Methods("GET")
 		metricsAPI.HandleFunc("/resolution", handler.MetricsHandler.GetResolutionSummary).Methods("GET")
+		metricsAPI.HandleFunc("/latency", handler.GetLatencySummaries).Methods("GET")
+		metricsAPI.HandleFunc("/devices/{id:[0-9]+}/latency", handler.GetDeviceLatencyTrend).Methods("GET")
 
 		// Security metrics endpoint — exposes attacker IPs and activity, so gate it
 		// with the same admin key as the other protected metrics reads.
@@ -297,6 +422,17 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 
 	// Discovery route
 	api.HandleFunc("/discover", handler.DiscoverHandler).Methods("POST")
+	api.HandleFunc("/discovery/networks", handler.ListDiscoveryNetworks).Methods("GET")
+	api.HandleFunc("/discovery/networks", handler.ReplaceDiscoveryNetworks).Methods("PUT")
+	api.HandleFunc("/discovery/networks", handler.AddDiscoveryNetwork).Methods("POST")
+	api.HandleFunc("/discovery/networks/{cidr:.+}", handler.UpdateDiscoveryNetwork).Methods("PUT")
+	api.HandleFunc("/discovery/networks/{cidr:.+}", handler.RemoveDiscoveryNetwork).Methods("DELETE")
+	api.HandleFunc("/discovery/alerts", handler.ListNewDeviceAlerts).Methods("GET")
+	api.HandleFunc("/discovery/alerts/{id:[0-9]+}/adopt", handler.AdoptNewDevice).Methods("POST")
+	api.HandleFunc("/discovery/alerts/{id:[0-9]+}/ignore", handler.IgnoreNewDevice).Methods("POST")
+	api.HandleFunc("/discovery/announce", handler.ReportDeviceAnnounce).Methods("POST")
+	api.HandleFunc("/discovery/dhcp-leases", handler.ListDHCPLeaseCandidates).Methods("GET")
+	api.HandleFunc("/discovery/dhcp-leases/import", handler.ImportDHCPLeases).Methods("POST")
 
 	// Provisioning routes
 	api.HandleFunc("/provisioning/status", handler.GetProvisioningStatus).Methods("GET")
@@ -309,11 +445,20 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 	api.HandleFunc("/provisioning/tasks/{id}/cancel", handler.CancelProvisioningTaskUI).Methods("POST")
 	api.HandleFunc("/provisioning/bulk", handler.BulkProvisionUI).Methods("POST")
 	api.HandleFunc("/provisioning/agents", handler.ListProvisioningAgentsUI).Methods("GET")
+	api.HandleFunc("/provisioning/profiles", handler.ListProvisioningProfiles).Methods("GET")
+	api.HandleFunc("/provisioning/profiles/{name}", handler.GetProvisioningProfile).Methods("GET")
+	api.HandleFunc("/provisioning/profiles/{name}", handler.SaveProvisioningProfile).Methods("PUT")
+	api.HandleFunc("/provisioning/profiles/{name}", handler.DeleteProvisioningProfile).Methods("DELETE")
+	api.HandleFunc("/provisioning/task-templates", handler.ListProvisioningTaskTemplates).Methods("GET")
+	api.HandleFunc("/provisioning/task-templates/{name}", handler.GetProvisioningTaskTemplate).Methods("GET")
+	api.HandleFunc("/provisioning/task-templates/{name}", handler.SaveProvisioningTaskTemplate).Methods("PUT")
+	api.HandleFunc("/provisioning/task-templates/{name}", handler.DeleteProvisioningTaskTemplate).Methods("DELETE")
 	api.HandleFunc("/provisioning/agents/{id}/status", handler.GetProvisioningAgentStatusUI).Methods("GET")
 
 	// Provisioner agent management routes
 	api.HandleFunc("/provisioner/agents/register", handler.RegisterAgent).Methods("POST")
 	api.HandleFunc("/provisioner/agents", handler.GetProvisionerAgents).Methods("GET")
+	api.HandleFunc("/provisioner/agents/{id}/heartbeat", handler.AgentHeartbeat).Methods("POST")
 	api.HandleFunc("/provisioner/agents/{id}/tasks", handler.PollTasks).Methods("GET")
 	api.HandleFunc("/provisioner/tasks", handler.CreateProvisioningTask).Methods("POST")
 	api.HandleFunc("/provisioner/tasks", handler.GetProvisioningTasks).Methods("GET")
@@ -321,10 +466,73 @@ func SetupRoutesWithSecurity(handler *Handler, logger *logging.Logger, securityC
 	api.HandleFunc("/provisioner/discovered-devices", handler.ReportDiscoveredDevices).Methods("POST")
 	api.HandleFunc("/provisioner/discovered-devices", handler.GetDiscoveredDevices).Methods("GET")
 	api.HandleFunc("/provisioner/health", handler.ProvisionerHealthCheck).Methods("GET")
+	api.HandleFunc("/provisioner/profiles/{name}", handler.GetProvisionerProfile).Methods("GET")
+
+	// Device intake routes (pre-registration from box labels / QR codes)
+	api.HandleFunc("/intake", handler.ListIntake).Methods("GET")
+	api.HandleFunc("/intake", handler.RegisterIntake).Methods("POST")
+	api.HandleFunc("/intake/csv", handler.ImportIntakeCSV).Methods("POST")
+	api.HandleFunc("/intake/cloud", handler.ImportIntakeCloud).Methods("POST")
+	api.HandleFunc("/intake/{id:[0-9]+}", handler.DeleteIntake).Methods("DELETE")
+
+	// Per-user UI and API preferences
+	api.HandleFunc("/preferences", handler.ListPreferences).Methods("GET")
+	api.HandleFunc("/preferences", handler.UpdatePreferences).Methods("PATCH")
+	api.HandleFunc("/preferences", handler.ResetPreferences).Methods("DELETE")
+	api.HandleFunc("/preferences/{key}", handler.GetPreference).Methods("GET")
+	api.HandleFunc("/preferences/{key}", handler.SetPreference).Methods("PUT")
+	api.HandleFunc("/preferences/{key}", handler.DeletePreference).Methods("DELETE")
+
+	// Supervisor recovery routes
+	api.HandleFunc("/supervisor/actions", handler.ListRecoveryActions).Methods("GET")
+	api.HandleFunc("/supervisor/run", handler.RunSupervisor).Methods("POST")
+	api.HandleFunc("/supervisor/outage", handler.GetOutageStatus).Methods("GET")
+
+	// Diagnostics routes
+	api.HandleFunc("/diagnostics/preflight", handler.RunPreflight).Methods("POST")
+
+	// Report routes
+	api.HandleFunc("/reports/assets", handler.GetAssetReport).Methods("GET")
+	api.HandleFunc("/reports/clock-skew", handler.GetClockSkewReport).Methods("GET")
+	api.HandleFunc("/reports/clock-skew/remediate", handler.RemediateClockSkew).Methods("POST")
+	api.HandleFunc("/reports/config-lint", handler.GetConfigLintReport).Methods("GET")
+	api.HandleFunc("/reports/reboots", handler.GetRebootReport).Methods("GET")
+	api.HandleFunc("/reports/network", handler.GetNetworkReport).Methods("GET")
+	api.HandleFunc("/reports/protection-trips", handler.GetProtectionReport).Methods("GET")
+	api.HandleFunc("/reports/range-extenders", handler.GetRangeExtenderTopology).Methods("GET")
+
+	// Power budget routes
+	api.HandleFunc("/power-budgets", handler.ListPowerBudgets).Methods("GET")
+	api.HandleFunc("/power-budgets", handler.CreatePowerBudget).Methods("POST")
+	api.HandleFunc("/power-budgets/{id:[0-9]+}", handler.GetPowerBudget).Methods("GET")
+	api.HandleFunc("/power-budgets/{id:[0-9]+}", handler.UpdatePowerBudget).Methods("PUT")
+	api.HandleFunc("/power-budgets/{id:[0-9]+}", handler.DeletePowerBudget).Methods("DELETE")
+	api.HandleFunc("/power-budgets/{id:[0-9]+}/status", handler.GetPowerBudgetStatus).Methods("GET")
+
+	// Energy comparison across periods, devices, tags and groups
+	api.HandleFunc("/energy/compare", handler.CompareEnergy).Methods("GET")
+
+	// Wi-Fi credential rotation routes
+	api.HandleFunc("/wifi-rotations", handler.StageWiFiRotation).Methods("POST")
+	api.HandleFunc("/wifi-rotations", handler.ListWiFiRotations).Methods("GET")
+	api.HandleFunc("/wifi-rotations/{id}", handler.GetWiFiRotation).Methods("GET")
+	api.HandleFunc("/wifi-rotations/{id}/start", handler.StartWiFiRotation).Methods("POST")
+	api.HandleFunc("/wifi-rotations/{id}/verify", handler.VerifyWiFiRotation).Methods("POST")
+	api.HandleFunc("/wifi-rotations/{id}/rescue", handler.RescueWiFiRotation).Methods("POST")
 
 	// DHCP routes
 	api.HandleFunc("/dhcp/reservations", handler.GetDHCPReservations).Methods("GET")
 
+	// IP address management routes
+	api.HandleFunc("/ipam/subnets", handler.ListSubnets).Methods("GET")
+	api.HandleFunc("/ipam/subnets", handler.CreateSubnet).Methods("POST")
+	api.HandleFunc("/ipam/subnets/{id}", handler.DeleteSubnet).Methods("DELETE")
+	api.HandleFunc("/ipam/subnets/{id}/ranges", handler.AddReservedRange).Methods("POST")
+	api.HandleFunc("/ipam/subnets/{id}/ranges/{range_id}", handler.DeleteReservedRange).Methods("DELETE")
+	api.HandleFunc("/ipam/subnets/{id}/free", handler.GetFreeAddresses).Methods("GET")
+	api.HandleFunc("/ipam/plan", handler.GetIPPlan).Methods("GET")
+	api.HandleFunc("/ipam/plan/generate", handler.GenerateIPPlan).Methods("POST")
+
 	// Export/Import routes (if handlers are configured)
 	if handler.ExportHandlers != nil {
 		handler.ExportHandlers.AddExportRoutes(api)
@@ -363,11 +571,11 @@ func enhancedCORSMiddleware(logger *logging.Logger, config *middleware.SecurityC
 			w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
 			w.Header().Set("Vary", "Origin")
 
-			methods := "GET, POST, PUT, DELETE, OPTIONS"
+			methods := "GET, POST, PUT, PATCH, DELETE, OPTIONS"
 			if config != nil && len(config.CORSAllowedMethods) > 0 {
 				methods = strings.Join(config.CORSAllowedMethods, ", ")
 			}
-			headers := "Content-Type, Authorization, X-Requested-With"
+			headers := "Content-Type, Authorization, X-Requested-With, Idempotency-Key, X-Request-ID, X-Confirmation-Token, X-Change-Request, X-User-ID"
 			if config != nil && len(config.CORSAllowedHeaders) > 0 {
 				headers = strings.Join(config.CORSAllowedHeaders, ", ")
 			}
@@ -377,7 +585,7 @@ func enhancedCORSMiddleware(logger *logging.Logger, config *middleware.SecurityC
 			}
 			w.Header().Set("Access-Control-Allow-Methods", methods)
 			w.Header().Set("Access-Control-Allow-Headers", headers)
-			w.Header().Set("Access-Control-Expose-Headers", "X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
+			w.Header().Set("Access-Control-Expose-Headers", "X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Idempotent-Replayed, X-Request-ID")
 			w.Header().Set("Access-Control-Max-Age", maxAge)
 
 			// Log CORS requests for security monitoring
@@ -434,11 +642,17 @@ func SetupTestModeRoutes(handler *Handler, logger *logging.Logger) *mux.Router {
 	if handler.MetricsHandler != nil {
 		r.HandleFunc("/metrics/ws", handler.MetricsHandler.HandleWebSocket).Methods("GET")
 	}
+	if handler != nil {
+		r.HandleFunc("/devices/ws", handler.DeviceSocket).Methods("GET")
+		r.HandleFunc("/enroll", handler.Enroll).Methods("POST")
+	}
 
 	// API routes with only essential middleware
 	api := r.PathPrefix("/api/v1").Subrouter()
+	api.Use(logging.RequestIDMiddleware())      // Request ID for log correlation
 	api.Use(logging.RecoveryMiddleware(logger)) // Only recovery for error handling
 	api.Use(testModeCORSMiddleware(logger))     // Minimal CORS for browser tests
+	api.Use(middleware.IdempotencyMiddleware(middleware.DefaultSecurityConfig(), newIdempotencyStore(handler), logger))
 
 	// Register core API routes WITHOUT security middleware stack
 	if handler != nil {
@@ -466,8 +680,8 @@ func testModeCORSMiddleware(logger *logging.Logger) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Idempotency-Key, X-Request-ID, X-Confirmation-Token, X-Change-Request, X-User-ID")
 
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// ListRecoveryActions handles GET /api/v1/supervisor/actions?device_id=&limit=
+// and returns the supervisor recovery audit log, newest first
+func (h *Handler) ListRecoveryActions(w http.ResponseWriter, r *http.Request) {
+	var deviceID uint
+	if v := r.URL.Query().Get("device_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid device_id")
+			return
+		}
+		deviceID = uint(id)
+	}
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			h.responseWriter().WriteValidationError(w, r, "limit must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+
+	actions, err := h.Service.RecoveryActions(deviceID, limit)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"actions": actions,
+		"count":   len(actions),
+	})
+}
+
+// RunSupervisor handles POST /api/v1/supervisor/run. It runs one supervisor
+// round now; with dry_run the due actions are returned without being taken.
+func (h *Handler) RunSupervisor(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+			return
+		}
+	}
+
+	actions, err := h.Service.SuperviseOnce(r.Context(), req.DryRun)
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"actions": actions,
+		"count":   len(actions),
+		"dry_run": req.DryRun,
+	})
+}
+
+// GetOutageStatus handles GET /api/v1/supervisor/outage and reports whether
+// an outage is in progress, the devices lost in it and how many are back
+func (h *Handler) GetOutageStatus(w http.ResponseWriter, r *http.Request) {
+	h.responseWriter().WriteSuccess(w, r, h.Service.OutageStatus())
+}
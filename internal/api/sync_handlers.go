@@ -16,6 +16,8 @@ import (
 
 	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
 	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/plugins/sync/promsd"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
 	"github.com/ginsys/shelly-manager/internal/sync"
 )
 
@@ -27,6 +29,9 @@ type SyncHandlers struct {
 	// Security controls
 	adminAPIKey   string
 	exportBaseDir string
+
+	// Optional export scheduler; schedule endpoints answer 503 without it
+	scheduler *sync.Scheduler
 }
 
 // ExportHandlers provides backward compatibility
@@ -57,30 +62,21 @@ func (eh *SyncHandlers) SetExportBaseDir(dir string) {
 	eh.exportBaseDir = dir
 }
 
+// SetScheduler enables the sync schedule endpoints
+func (eh *SyncHandlers) SetScheduler(scheduler *sync.Scheduler) {
+	eh.scheduler = scheduler
+}
+
 // requireAdmin checks admin credentials if configured. It writes a standardized
 // error response and returns false when access is denied.
 func (eh *SyncHandlers) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
-	if eh.adminAPIKey == "" {
-		return true
-	}
-	auth := r.Header.Get("Authorization")
-	xKey := r.Header.Get("X-API-Key")
-	keyOK := false
-	if strings.HasPrefix(auth, "Bearer ") {
-		token := strings.TrimPrefix(auth, "Bearer ")
-		keyOK = token == eh.adminAPIKey
-	}
-	if !keyOK && xKey != "" {
-		keyOK = xKey == eh.adminAPIKey
-	}
-	if !keyOK {
+	if !writeAdminAccess(apiresp.NewResponseWriter(eh.logger), w, r, eh.adminAPIKey) {
 		eh.logger.WithFields(map[string]any{
 			"path":      r.URL.Path,
 			"method":    r.Method,
 			"component": "rbac",
 			"event":     "access_denied",
 		}).Warn("Admin RBAC check failed")
-		apiresp.NewResponseWriter(eh.logger).WriteError(w, r, http.StatusUnauthorized, apiresp.ErrCodeUnauthorized, "Admin authorization required", nil)
 		return false
 	}
 	return true
@@ -115,6 +111,10 @@ func (eh *SyncHandlers) AddExportRoutes(api *mux.Router) {
 	api.HandleFunc("/export/yaml", eh.CreateYAMLExport).Methods("POST")
 	api.HandleFunc("/export/yaml/{id}/download", eh.DownloadExport).Methods("GET")
 
+	// Prometheus service discovery: file_sd export plus a live http_sd endpoint
+	api.HandleFunc("/export/prometheus-sd", eh.GetPrometheusSDTargets).Methods("GET")
+	api.HandleFunc("/export/prometheus-sd", eh.CreatePrometheusSDExport).Methods("POST")
+
 	api.HandleFunc("/export/gitops", eh.CreateGitOpsExport).Methods("POST")
 	api.HandleFunc("/export/gitops/{id}/download", eh.DownloadGitOpsExport).Methods("GET")
 
@@ -122,6 +122,11 @@ func (eh *SyncHandlers) AddExportRoutes(api *mux.Router) {
 	api.HandleFunc("/export/history", eh.ListExportHistory).Methods("GET")
 	api.HandleFunc("/export/history/{id}", eh.GetExportHistory).Methods("GET")
 	api.HandleFunc("/export/statistics", eh.GetExportStatistics).Methods("GET")
+	eh.addSyncHistoryRoutes(api)
+	eh.addSyncScheduleRoutes(api)
+	eh.addSyncPluginConfigRoutes(api)
+	eh.addExportStreamRoutes(api)
+	eh.addArtifactRoutes(api)
 
 	// Generic export endpoints (after history to avoid route collisions)
 	api.HandleFunc("/export", eh.Export).Methods("POST")
@@ -510,6 +515,86 @@ func (eh *SyncHandlers) CreateYAMLExport(w http.ResponseWriter, r *http.Request)
 	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, result)
 }
 
+// CreatePrometheusSDExport writes a Prometheus file_sd targets file
+func (eh *SyncHandlers) CreatePrometheusSDExport(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	eh.logger.Info("Creating Prometheus SD export")
+	var requestBody struct {
+		Config  map[string]interface{} `json:"config"`
+		Filters sync.ExportFilters     `json:"filters"`
+		Options sync.ExportOptions     `json:"options"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		eh.logger.Error("Invalid request body", "error", err)
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "Invalid request body")
+		return
+	}
+	exportRequest := sync.ExportRequest{
+		PluginName: "prometheus-sd",
+		Format:     "json",
+		Config:     requestBody.Config,
+		Filters:    requestBody.Filters,
+		Output:     sync.OutputConfig{Type: "file"},
+		Options:    requestBody.Options,
+	}
+	markAPIExport(&exportRequest)
+	result, err := eh.syncEngine.Export(r.Context(), exportRequest)
+	if err != nil {
+		if result != nil {
+			_ = eh.syncEngine.SaveExportHistory(r.Context(), exportRequest, result, requesterFrom(r))
+		}
+		eh.logger.Error("Prometheus SD export failed", "error", err)
+		eh.writeSyncError(w, r, err)
+		return
+	}
+	_ = eh.syncEngine.SaveExportHistory(r.Context(), exportRequest, result, requesterFrom(r))
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, result)
+}
+
+// GetPrometheusSDTargets serves the device inventory in the Prometheus http_sd format.
+// The body is the bare target group array (no envelope) as required by Prometheus.
+// Query parameters: port, include_offline, metrics_path, type (repeatable), status (repeatable).
+func (eh *SyncHandlers) GetPrometheusSDTargets(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	opts := promsd.TargetOptions{
+		Port:           promsd.DefaultTargetPort,
+		IncludeOffline: q.Get("include_offline") == "true",
+		MetricsPath:    q.Get("metrics_path"),
+	}
+	if v := q.Get("port"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil || port < 0 || port > 65535 {
+			apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "port must be between 0 and 65535")
+			return
+		}
+		opts.Port = port
+	}
+
+	data, err := eh.syncEngine.LoadExportData(r.Context(), sync.ExportFilters{
+		DeviceTypes:  q["type"],
+		DeviceStatus: q["status"],
+	})
+	if err != nil {
+		eh.logger.Error("Failed to load devices for Prometheus SD", "error", err)
+		apiresp.NewResponseWriter(eh.logger).WriteInternalError(w, r, err)
+		return
+	}
+
+	body, err := json.Marshal(promsd.BuildTargetGroups(data.Devices, opts))
+	if err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
 // Export performs a generic export using any plugin
 func (eh *SyncHandlers) Export(w http.ResponseWriter, r *http.Request) {
 	if !eh.requireAdmin(w, r) {
@@ -584,6 +669,7 @@ func (eh *SyncHandlers) writeSyncError(w http.ResponseWriter, r *http.Request, e
 		errors.Is(err, sync.ErrPluginNotFound),
 		errors.Is(err, sync.ErrUnsupportedFormat),
 		errors.Is(err, sync.ErrInvalidImportData),
+		errors.Is(err, sync.ErrArtifactSignature),
 		errors.Is(err, sync.ErrInvalidExportData),
 		errors.Is(err, sync.ErrInvalidExportPath):
 		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, err.Error())
@@ -668,6 +754,11 @@ func (eh *SyncHandlers) serveExportByID(w http.ResponseWriter, r *http.Request,
 	if !ok || res == nil {
 		// Fallback to persisted history for file path
 		if rec, err := eh.syncEngine.GetExportHistory(r.Context(), id); err == nil && rec != nil {
+			if rec.StorageTier == sync.ArtifactTierObject || rec.StorageTier == sync.ArtifactTierDeleted {
+				// Moved off local disk by the artifact lifecycle
+				eh.streamArtifact(w, r, id)
+				return
+			}
 			if rec.FilePath != "" {
 				if eh.exportBaseDir != "" {
 					absBase, _ := filepath.Abs(eh.exportBaseDir)
@@ -681,6 +772,7 @@ func (eh *SyncHandlers) serveExportByID(w http.ResponseWriter, r *http.Request,
 				// Set a helpful filename for download
 				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(rec.FilePath)))
 				setContentTypeForPath(w, rec.FilePath)
+				setResumableHeaders(w, rec.Checksum)
 				http.ServeFile(w, r, rec.FilePath)
 				return
 			}
@@ -705,9 +797,20 @@ func (eh *SyncHandlers) serveExportByID(w http.ResponseWriter, r *http.Request,
 	// Set download filename and content type
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(res.OutputPath)))
 	setContentTypeForPath(w, res.OutputPath)
+	setResumableHeaders(w, res.Checksum)
 	http.ServeFile(w, r, res.OutputPath)
 }
 
+// setResumableHeaders lets clients resume an interrupted download with a
+// Range request; the checksum ETag makes If-Range reject a changed file.
+// http.ServeFile answers the Range itself.
+func setResumableHeaders(w http.ResponseWriter, checksum string) {
+	w.Header().Set("Accept-Ranges", "bytes")
+	if checksum != "" {
+		w.Header().Set("ETag", strconv.Quote(checksum))
+	}
+}
+
 // setContentTypeForPath sets Content-Type header based on file extension for better UX
 func setContentTypeForPath(w http.ResponseWriter, path string) {
 	ext := strings.ToLower(filepath.Ext(path))
@@ -725,6 +828,10 @@ func setContentTypeForPath(w http.ResponseWriter, path string) {
 		w.Header().Set("Content-Type", "application/gzip")
 	case ".sqlite":
 		w.Header().Set("Content-Type", "application/octet-stream")
+	case ".md":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	case ".html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	default:
 		// leave default; http.ServeFile may infer
 	}
@@ -973,13 +1080,7 @@ func parseIntDefault(s string, def int) int {
 	return def
 }
 
-// requesterFrom returns only the explicit, non-secret audit identity headers.
+// requesterFrom names who made a request for audit records
 func requesterFrom(r *http.Request) string {
-	if v := strings.TrimSpace(r.Header.Get("X-User-ID")); v != "" {
-		return v
-	}
-	if v := strings.TrimSpace(r.Header.Get("X-User")); v != "" {
-		return v
-	}
-	return "api"
+	return auth.Requester(r)
 }
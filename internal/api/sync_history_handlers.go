@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+// addSyncHistoryRoutes registers the run history shared by exports and imports
+func (eh *SyncHandlers) addSyncHistoryRoutes(api *mux.Router) {
+	api.HandleFunc("/sync/history", eh.ListSyncRuns).Methods("GET")
+	api.HandleFunc("/sync/history/{id}", eh.GetSyncRun).Methods("GET")
+	api.HandleFunc("/sync/history/{id}/rerun", eh.RerunSync).Methods("POST")
+	api.HandleFunc("/sync/history/{id}/download", eh.DownloadSyncRun).Methods("GET")
+}
+
+// ListSyncRuns handles GET /api/v1/sync/history. Runs of every plugin are
+// listed newest first; kind, plugin and success narrow the list.
+func (eh *SyncHandlers) ListSyncRuns(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	page := parseIntDefault(q.Get("page"), 1)
+	pageSize := parseIntDefault(q.Get("page_size"), 20)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	filter := sync.SyncRunFilter{Kind: q.Get("kind"), Plugin: q.Get("plugin")}
+	if v := strings.ToLower(q.Get("success")); v != "" {
+		b := v == "true" || v == "1" || v == "yes"
+		filter.Success = &b
+	}
+
+	runs, total, err := eh.syncEngine.ListSyncRuns(r.Context(), filter, page, pageSize)
+	if err != nil {
+		if errors.Is(err, sync.ErrInvalidRunKind) {
+			apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "kind must be export or import")
+			return
+		}
+		apiresp.NewResponseWriter(eh.logger).WriteInternalError(w, r, err)
+		return
+	}
+	builder := apiresp.NewResponseBuilder(eh.logger).WithPagination(page, pageSize, total)
+	resp := builder.Success(map[string]interface{}{"runs": runs})
+	apiresp.NewResponseWriter(eh.logger).WriteSuccessWithMeta(w, r, resp.Data, resp.Meta)
+}
+
+// GetSyncRun handles GET /api/v1/sync/history/{id}
+func (eh *SyncHandlers) GetSyncRun(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	run, err := eh.syncEngine.GetSyncRun(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteInternalError(w, r, err)
+		return
+	}
+	if run == nil {
+		apiresp.NewResponseWriter(eh.logger).WriteNotFoundError(w, r, "Sync run")
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, run)
+}
+
+// RerunSync handles POST /api/v1/sync/history/{id}/rerun. The export runs
+// again with its recorded parameters as a new run; an optional
+// {"config": {...}} body supplies the sensitive settings that are never
+// recorded and overrides recorded ones.
+func (eh *SyncHandlers) RerunSync(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	var body struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "Invalid request body")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	exportRequest, err := eh.syncEngine.RerunRequest(r.Context(), id, body.Config)
+	if err != nil {
+		switch {
+		case errors.Is(err, sync.ErrRunNotFound):
+			apiresp.NewResponseWriter(eh.logger).WriteNotFoundError(w, r, "Sync run")
+		case errors.Is(err, sync.ErrRunNotRerunnable):
+			apiresp.NewResponseWriter(eh.logger).WriteError(w, r, http.StatusUnprocessableEntity, apiresp.ErrCodeBadRequest, err.Error(), nil)
+		default:
+			apiresp.NewResponseWriter(eh.logger).WriteInternalError(w, r, err)
+		}
+		return
+	}
+	markAPIExport(&exportRequest)
+
+	result, err := eh.syncEngine.Export(r.Context(), exportRequest)
+	if err != nil {
+		if result != nil {
+			_ = eh.syncEngine.SaveExportHistory(r.Context(), exportRequest, result, requesterFrom(r))
+		}
+		eh.logger.Error("Export re-run failed", "run_id", id, "plugin", exportRequest.PluginName, "error", err)
+		eh.writeSyncError(w, r, err)
+		return
+	}
+	_ = eh.syncEngine.SaveExportHistory(r.Context(), exportRequest, result, requesterFrom(r))
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, result)
+}
+
+// DownloadSyncRun handles GET /api/v1/sync/history/{id}/download and serves
+// the artifact an export run wrote
+func (eh *SyncHandlers) DownloadSyncRun(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	run, err := eh.syncEngine.GetSyncRun(r.Context(), id)
+	if err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteInternalError(w, r, err)
+		return
+	}
+	if run == nil {
+		apiresp.NewResponseWriter(eh.logger).WriteNotFoundError(w, r, "Sync run")
+		return
+	}
+	if run.ArtifactPath == "" {
+		apiresp.NewResponseWriter(eh.logger).WriteError(w, r, http.StatusUnprocessableEntity, apiresp.ErrCodeBadRequest, "No artifact available for this run", nil)
+		return
+	}
+	eh.serveExportByID(w, r, id)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+// secretPlugin requires a sensitive api_key setting
+type secretPlugin struct{ mockSyncPlugin }
+
+func (secretPlugin) Info() sync.PluginInfo {
+	return sync.PluginInfo{Name: "secret", Version: "1.0.0", SupportedFormats: []string{"txt"}}
+}
+
+func (secretPlugin) ConfigSchema() sync.ConfigSchema {
+	return sync.ConfigSchema{Version: "1.0.0", Properties: map[string]sync.PropertySchema{
+		"host":    {Type: "string"},
+		"api_key": {Type: "string", Sensitive: true},
+	}}
+}
+
+func (secretPlugin) ValidateConfig(cfg map[string]interface{}) error {
+	if cfg["api_key"] == nil {
+		return fmt.Errorf("api_key is required")
+	}
+	return nil
+}
+
+func TestSyncRunHistory(t *testing.T) {
+	router, exp, _, cleanup := setupSecuredRouter(t, "")
+	defer cleanup()
+	require.NoError(t, exp.syncEngine.RegisterPlugin(&secretPlugin{}))
+
+	do := func(method, path string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		var b []byte
+		if body != nil {
+			b, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", "tester")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var wrap map[string]interface{}
+		_ = json.Unmarshal(rr.Body.Bytes(), &wrap)
+		return rr, wrap
+	}
+
+	dst := filepath.Join(t.TempDir(), "run.txt")
+	rr, wrap := do("POST", "/api/v1/export", map[string]interface{}{
+		"plugin_name": "secret",
+		"format":      "txt",
+		"config":      map[string]interface{}{"host": "fw.local", "api_key": "s3cr3t"},
+		"output":      map[string]interface{}{"type": "file", "destination": dst},
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	exportID := wrap["data"].(map[string]interface{})["export_id"].(string)
+
+	rr, _ = do("POST", "/api/v1/import", map[string]interface{}{
+		"plugin_name": "mockfile",
+		"format":      "txt",
+		"source":      map[string]interface{}{"type": "data", "data": "aGVsbG8="},
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// Both runs are listed; the sensitive key is not recorded
+	rr, wrap = do("GET", "/api/v1/sync/history", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NotContains(t, rr.Body.String(), "s3cr3t")
+	require.NotContains(t, rr.Body.String(), "aGVsbG8=")
+	runs := wrap["data"].(map[string]interface{})["runs"].([]interface{})
+	require.Len(t, runs, 2)
+
+	rr, wrap = do("GET", "/api/v1/sync/history?kind=export", nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	runs = wrap["data"].(map[string]interface{})["runs"].([]interface{})
+	require.Len(t, runs, 1)
+	run := runs[0].(map[string]interface{})
+	require.Equal(t, exportID, run["id"])
+	require.Equal(t, dst, run["artifact_path"])
+	require.Equal(t, true, run["rerunnable"])
+	require.Equal(t, "fw.local", run["parameters"].(map[string]interface{})["config"].(map[string]interface{})["host"])
+
+	rr, _ = do("GET", "/api/v1/sync/history?kind=backup", nil)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Download serves the artifact
+	rr, _ = do("GET", "/api/v1/sync/history/"+exportID+"/download", nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "hello world", rr.Body.String())
+
+	// Re-running needs the sensitive setting again and creates a new run
+	rr, _ = do("POST", "/api/v1/sync/history/"+exportID+"/rerun", nil)
+	require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+	rr, wrap = do("POST", "/api/v1/sync/history/"+exportID+"/rerun", map[string]interface{}{
+		"config": map[string]interface{}{"api_key": "s3cr3t"},
+	})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NotEqual(t, exportID, wrap["data"].(map[string]interface{})["export_id"])
+
+	rr, wrap = do("GET", "/api/v1/sync/history?kind=export", nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Len(t, wrap["data"].(map[string]interface{})["runs"], 3) // failed re-run included
+
+	// Imports are not re-run and have no artifact
+	rr, wrap = do("GET", "/api/v1/sync/history?kind=import", nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	importID := wrap["data"].(map[string]interface{})["runs"].([]interface{})[0].(map[string]interface{})["id"].(string)
+	rr, _ = do("POST", "/api/v1/sync/history/"+importID+"/rerun", nil)
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	rr, _ = do("GET", "/api/v1/sync/history/"+importID+"/download", nil)
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr, _ = do("GET", "/api/v1/sync/history/unknown", nil)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+	rr, _ = do("POST", "/api/v1/sync/history/unknown/rerun", nil)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
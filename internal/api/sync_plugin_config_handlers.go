@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+// addSyncPluginConfigRoutes registers the plugin catalogue and the named
+// plugin configurations set up at runtime
+func (eh *SyncHandlers) addSyncPluginConfigRoutes(api *mux.Router) {
+	api.HandleFunc("/sync/plugins", eh.DescribeSyncPlugins).Methods("GET")
+	api.HandleFunc("/sync/configs", eh.ListSyncPluginConfigs).Methods("GET")
+	api.HandleFunc("/sync/configs", eh.CreateSyncPluginConfig).Methods("POST")
+	api.HandleFunc("/sync/configs/validate", eh.ValidateSyncPluginConfig).Methods("POST")
+	api.HandleFunc("/sync/configs/{id:[0-9]+}", eh.GetSyncPluginConfig).Methods("GET")
+	api.HandleFunc("/sync/configs/{id:[0-9]+}", eh.UpdateSyncPluginConfig).Methods("PUT")
+	api.HandleFunc("/sync/configs/{id:[0-9]+}", eh.DeleteSyncPluginConfig).Methods("DELETE")
+	api.HandleFunc("/sync/configs/{id:[0-9]+}/run", eh.RunSyncPluginConfig).Methods("POST")
+}
+
+// DescribeSyncPlugins handles GET /api/v1/sync/plugins: every plugin with
+// its capabilities and its configuration as JSON Schema
+func (eh *SyncHandlers) DescribeSyncPlugins(w http.ResponseWriter, r *http.Request) {
+	plugins := eh.syncEngine.DescribePlugins()
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, map[string]interface{}{
+		"plugins": plugins,
+		"count":   len(plugins),
+	})
+}
+
+// ListSyncPluginConfigs handles GET /api/v1/sync/configs
+func (eh *SyncHandlers) ListSyncPluginConfigs(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	configs, err := eh.syncEngine.ListPluginConfigs(r.Context())
+	if err != nil {
+		eh.writePluginConfigError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, map[string]interface{}{"configs": configs})
+}
+
+// GetSyncPluginConfig handles GET /api/v1/sync/configs/{id}
+func (eh *SyncHandlers) GetSyncPluginConfig(w http.ResponseWriter, r *http.Request) {
+	id, ok := eh.pluginConfigID(w, r)
+	if !ok {
+		return
+	}
+	config, err := eh.syncEngine.GetPluginConfig(r.Context(), id)
+	if err != nil {
+		eh.writePluginConfigError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, config)
+}
+
+// CreateSyncPluginConfig handles POST /api/v1/sync/configs. The body names
+// the configuration and holds the export request it runs.
+func (eh *SyncHandlers) CreateSyncPluginConfig(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	var spec sync.PluginConfigSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "Invalid request body")
+		return
+	}
+	config, err := eh.syncEngine.CreatePluginConfig(r.Context(), spec, requesterFrom(r))
+	if err != nil {
+		eh.writePluginConfigError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteCreated(w, r, config)
+}
+
+// UpdateSyncPluginConfig handles PUT /api/v1/sync/configs/{id}. Fields left
+// out keep their values.
+func (eh *SyncHandlers) UpdateSyncPluginConfig(w http.ResponseWriter, r *http.Request) {
+	id, ok := eh.pluginConfigID(w, r)
+	if !ok {
+		return
+	}
+	var spec sync.PluginConfigSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "Invalid request body")
+		return
+	}
+	config, err := eh.syncEngine.UpdatePluginConfig(r.Context(), id, spec, requesterFrom(r))
+	if err != nil {
+		eh.writePluginConfigError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, config)
+}
+
+// DeleteSyncPluginConfig handles DELETE /api/v1/sync/configs/{id}
+func (eh *SyncHandlers) DeleteSyncPluginConfig(w http.ResponseWriter, r *http.Request) {
+	id, ok := eh.pluginConfigID(w, r)
+	if !ok {
+		return
+	}
+	if err := eh.syncEngine.DeletePluginConfig(r.Context(), id); err != nil {
+		eh.writePluginConfigError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, map[string]interface{}{"deleted": true, "id": id})
+}
+
+// ValidateSyncPluginConfig handles POST /api/v1/sync/configs/validate. The
+// body is an export request; the answer lists its problems by setting
+// without storing anything.
+func (eh *SyncHandlers) ValidateSyncPluginConfig(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireAdmin(w, r) {
+		return
+	}
+	var request sync.ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "Invalid request body")
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, eh.syncEngine.ValidatePluginConfig(request))
+}
+
+// RunSyncPluginConfig handles POST /api/v1/sync/configs/{id}/run and runs the
+// configuration's export now
+func (eh *SyncHandlers) RunSyncPluginConfig(w http.ResponseWriter, r *http.Request) {
+	id, ok := eh.pluginConfigID(w, r)
+	if !ok {
+		return
+	}
+	result, err := eh.syncEngine.RunPluginConfig(r.Context(), id, requesterFrom(r))
+	if err != nil {
+		eh.writePluginConfigError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, result)
+}
+
+func (eh *SyncHandlers) pluginConfigID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	if !eh.requireAdmin(w, r) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "Invalid plugin configuration ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (eh *SyncHandlers) writePluginConfigError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, sync.ErrPluginConfigNotFound):
+		apiresp.NewResponseWriter(eh.logger).WriteNotFoundError(w, r, "Plugin configuration")
+	case errors.Is(err, sync.ErrPluginConfigExists):
+		apiresp.NewResponseWriter(eh.logger).WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict, err.Error(), nil)
+	default:
+		eh.writeSyncError(w, r, err)
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+// addSyncScheduleRoutes registers the cron schedules of plugin exports
+func (eh *SyncHandlers) addSyncScheduleRoutes(api *mux.Router) {
+	api.HandleFunc("/sync/schedules", eh.ListSyncSchedules).Methods("GET")
+	api.HandleFunc("/sync/schedules", eh.CreateSyncSchedule).Methods("POST")
+	api.HandleFunc("/sync/schedules/{id:[0-9]+}", eh.GetSyncSchedule).Methods("GET")
+	api.HandleFunc("/sync/schedules/{id:[0-9]+}", eh.UpdateSyncSchedule).Methods("PUT")
+	api.HandleFunc("/sync/schedules/{id:[0-9]+}", eh.DeleteSyncSchedule).Methods("DELETE")
+	api.HandleFunc("/sync/schedules/{id:[0-9]+}/run", eh.RunSyncSchedule).Methods("POST")
+}
+
+// ListSyncSchedules handles GET /api/v1/sync/schedules
+func (eh *SyncHandlers) ListSyncSchedules(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireScheduler(w, r) {
+		return
+	}
+	schedules, err := eh.scheduler.ListSchedules(r.Context())
+	if err != nil {
+		eh.writeScheduleError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, map[string]interface{}{"schedules": schedules})
+}
+
+// GetSyncSchedule handles GET /api/v1/sync/schedules/{id}
+func (eh *SyncHandlers) GetSyncSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := eh.scheduleID(w, r)
+	if !ok {
+		return
+	}
+	schedule, err := eh.scheduler.GetSchedule(r.Context(), id)
+	if err != nil {
+		eh.writeScheduleError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, schedule)
+}
+
+// CreateSyncSchedule handles POST /api/v1/sync/schedules. The body names the
+// schedule, its cron expression and the export request to run.
+func (eh *SyncHandlers) CreateSyncSchedule(w http.ResponseWriter, r *http.Request) {
+	if !eh.requireScheduler(w, r) {
+		return
+	}
+	var spec sync.ScheduleSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "Invalid request body")
+		return
+	}
+	schedule, err := eh.scheduler.CreateSchedule(r.Context(), spec)
+	if err != nil {
+		eh.writeScheduleError(w, r, err)
+		return
+	}
+	eh.logger.WithFields(map[string]any{
+		"schedule_id":  schedule.ID,
+		"requested_by": requesterFrom(r),
+		"component":    "sync_scheduler",
+	}).Info("Sync schedule created via API")
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, schedule)
+}
+
+// UpdateSyncSchedule handles PUT /api/v1/sync/schedules/{id}. Fields left
+// out keep their values.
+func (eh *SyncHandlers) UpdateSyncSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := eh.scheduleID(w, r)
+	if !ok {
+		return
+	}
+	var spec sync.ScheduleSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "Invalid request body")
+		return
+	}
+	schedule, err := eh.scheduler.UpdateSchedule(r.Context(), id, spec)
+	if err != nil {
+		eh.writeScheduleError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, schedule)
+}
+
+// DeleteSyncSchedule handles DELETE /api/v1/sync/schedules/{id}
+func (eh *SyncHandlers) DeleteSyncSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := eh.scheduleID(w, r)
+	if !ok {
+		return
+	}
+	if err := eh.scheduler.DeleteSchedule(r.Context(), id); err != nil {
+		eh.writeScheduleError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, map[string]interface{}{"deleted": true, "id": id})
+}
+
+// RunSyncSchedule handles POST /api/v1/sync/schedules/{id}/run and runs the
+// schedule's export now. A run already in progress answers 409.
+func (eh *SyncHandlers) RunSyncSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := eh.scheduleID(w, r)
+	if !ok {
+		return
+	}
+	result, err := eh.scheduler.RunSchedule(r.Context(), id)
+	if err != nil {
+		eh.writeScheduleError(w, r, err)
+		return
+	}
+	apiresp.NewResponseWriter(eh.logger).WriteSuccess(w, r, result)
+}
+
+// requireScheduler checks admin access and that scheduling is enabled
+func (eh *SyncHandlers) requireScheduler(w http.ResponseWriter, r *http.Request) bool {
+	if !eh.requireAdmin(w, r) {
+		return false
+	}
+	if eh.scheduler == nil {
+		apiresp.NewResponseWriter(eh.logger).WriteError(w, r, http.StatusServiceUnavailable, apiresp.ErrCodeServiceUnavailable, "Sync scheduling is not available", nil)
+		return false
+	}
+	return true
+}
+
+func (eh *SyncHandlers) scheduleID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	if !eh.requireScheduler(w, r) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, "Invalid schedule ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (eh *SyncHandlers) writeScheduleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, sync.ErrScheduleNotFound):
+		apiresp.NewResponseWriter(eh.logger).WriteNotFoundError(w, r, "Sync schedule")
+	case errors.Is(err, sync.ErrScheduleExists), errors.Is(err, sync.ErrScheduleRunning):
+		apiresp.NewResponseWriter(eh.logger).WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict, err.Error(), nil)
+	case errors.Is(err, sync.ErrInvalidSchedule):
+		apiresp.NewResponseWriter(eh.logger).WriteValidationError(w, r, err.Error())
+	default:
+		eh.writeSyncError(w, r, err)
+	}
+}
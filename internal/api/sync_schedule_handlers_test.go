@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+func TestSyncSchedules(t *testing.T) {
+	router, exp, _, cleanup := setupSecuredRouter(t, "")
+	defer cleanup()
+	require.NoError(t, exp.syncEngine.RegisterPlugin(&secretPlugin{}))
+
+	do := func(method, path string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		var b []byte
+		if body != nil {
+			b, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var wrap map[string]interface{}
+		_ = json.Unmarshal(rr.Body.Bytes(), &wrap)
+		return rr, wrap
+	}
+
+	// Without a scheduler the endpoints are unavailable
+	rr, _ := do("GET", "/api/v1/sync/schedules", nil)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	exp.SetScheduler(sync.NewScheduler(exp.syncEngine, exp.logger))
+
+	schedule := map[string]interface{}{
+		"name":      "nightly",
+		"cron_spec": "0 2 * * *",
+		"request": map[string]interface{}{
+			"plugin_name": "secret",
+			"format":      "txt",
+			"config":      map[string]interface{}{"host": "fw.local", "api_key": "s3cr3t"},
+			"output":      map[string]interface{}{"type": "file", "destination": filepath.Join(t.TempDir(), "nightly.txt")},
+		},
+	}
+	rr, wrap := do("POST", "/api/v1/sync/schedules", schedule)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NotContains(t, rr.Body.String(), "s3cr3t")
+	id := uint(wrap["data"].(map[string]interface{})["id"].(float64))
+	path := fmt.Sprintf("/api/v1/sync/schedules/%d", id)
+
+	rr, _ = do("POST", "/api/v1/sync/schedules", schedule)
+	require.Equal(t, http.StatusConflict, rr.Code)
+	schedule["name"], schedule["cron_spec"] = "broken", "tomorrow"
+	rr, _ = do("POST", "/api/v1/sync/schedules", schedule)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr, wrap = do("GET", "/api/v1/sync/schedules", nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Len(t, wrap["data"].(map[string]interface{})["schedules"], 1)
+
+	rr, wrap = do("PUT", path, map[string]interface{}{"cron_spec": "@hourly", "enabled": false})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, false, wrap["data"].(map[string]interface{})["enabled"])
+
+	// Manual runs use the stored sensitive settings
+	rr, wrap = do("POST", path+"/run", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, true, wrap["data"].(map[string]interface{})["success"])
+	rr, wrap = do("GET", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "success", wrap["data"].(map[string]interface{})["last_status"])
+	require.Equal(t, float64(1), wrap["data"].(map[string]interface{})["run_count"])
+
+	rr, _ = do("DELETE", path, nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	rr, _ = do("POST", path+"/run", nil)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -13,6 +14,8 @@ import (
 	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
 	"github.com/ginsys/shelly-manager/internal/configuration"
 	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/service"
+	"github.com/ginsys/shelly-manager/internal/shelly"
 )
 
 // TypedConfigurationRequest represents a typed configuration request
@@ -22,6 +25,10 @@ type TypedConfigurationRequest struct {
 	DeviceModel     string                            `json:"device_model,omitempty"`
 	Generation      int                               `json:"generation,omitempty"`
 	Capabilities    []string                          `json:"capabilities,omitempty"`
+	// DeviceVerified also checks the configuration against the config keys and
+	// types a Gen2 device reports, flagging settings its firmware would ignore
+	DeviceVerified bool `json:"device_verified,omitempty"`
+	DeviceID       uint `json:"device_id,omitempty"` // Device to verify against on validate-typed
 }
 
 // TypedConfigurationResponse represents a typed configuration response
@@ -230,6 +237,9 @@ func (h *Handler) UpdateTypedDeviceConfig(w http.ResponseWriter, r *http.Request
 	}
 
 	validationResult := validator.ValidateConfiguration(configJSON)
+	if req.DeviceVerified && !h.verifyOnDevice(w, r, uint(id), req.Configuration, validationResult) {
+		return
+	}
 	if !validationResult.Valid {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -240,9 +250,16 @@ func (h *Handler) UpdateTypedDeviceConfig(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if !h.checkConfigVersion(w, r, uint(id)) {
+		return
+	}
+
 	// Update device configuration
 	err = h.Service.ConfigSvc.UpdateDeviceConfigFromJSON(uint(id), configJSON)
 	if err != nil {
+		if h.writeConfigConflict(w, r, uint(id), err) {
+			return
+		}
 		h.logger.WithFields(map[string]any{
 			"device_id": id,
 			"error":     err.Error(),
@@ -301,11 +318,43 @@ func (h *Handler) ValidateTypedConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	validationResult := validator.ValidateConfiguration(configJSON)
+	if req.DeviceVerified && !h.verifyOnDevice(w, r, req.DeviceID, req.Configuration, validationResult) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	h.writeJSON(w, validationResult)
 }
 
+// verifyOnDevice adds the findings of checking a configuration against the
+// device's live config to a validation result. It writes an error response
+// and returns false when the device cannot be checked.
+func (h *Handler) verifyOnDevice(w http.ResponseWriter, r *http.Request, deviceID uint, config *configuration.TypedConfiguration, result *configuration.ValidationResult) bool {
+	if deviceID == 0 {
+		http.Error(w, "device_id is required for device-verified validation", http.StatusBadRequest)
+		return false
+	}
+	verified, err := h.Service.VerifyTypedConfigOnDevice(r.Context(), deviceID, config)
+	switch {
+	case err == nil:
+		result.Merge(verified)
+		return true
+	case errors.Is(err, service.ErrDeviceNotFound):
+		http.Error(w, "Device not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrDeviceSchemaUnsupported):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, service.ErrDeviceNotResponding):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		h.logger.WithFields(map[string]any{
+			"device_id": deviceID,
+			"error":     err.Error(),
+		}).Error("Failed to verify configuration against device")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return false
+}
+
 // ConvertConfigToTyped handles POST /api/v1/configuration/convert-to-typed
 func (h *Handler) ConvertConfigToTyped(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -534,18 +583,20 @@ func (h *Handler) GetDeviceCapabilities(w http.ResponseWriter, r *http.Request)
 		generation = int(genFloat)
 	}
 
-	capabilities := h.getDeviceCapabilities(model, generation)
+	capabilities := profileCapabilities(h.getDeviceCapabilities(model, generation), device.Profile)
 
 	response := struct {
-		DeviceID     uint     `json:"device_id"`
-		DeviceModel  string   `json:"device_model"`
-		Generation   int      `json:"generation"`
-		Capabilities []string `json:"capabilities"`
+		DeviceID            uint     `json:"device_id"`
+		DeviceModel         string   `json:"device_model"`
+		Generation          int      `json:"generation"`
+		Capabilities        []string `json:"capabilities"`
+		SupportedOperations []string `json:"supported_operations,omitempty"`
 	}{
-		DeviceID:     device.ID,
-		DeviceModel:  model,
-		Generation:   generation,
-		Capabilities: capabilities,
+		DeviceID:            device.ID,
+		DeviceModel:         model,
+		Generation:          generation,
+		Capabilities:        capabilities,
+		SupportedOperations: newDeviceView(device).SupportedOperations,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -673,7 +724,7 @@ func (h *Handler) convertToTypedConfig(rawConfig json.RawMessage, device *databa
 	}
 
 	// Convert capability-specific configurations based on device model
-	deviceCapabilities := h.getDeviceCapabilities(model, generation)
+	deviceCapabilities := profileCapabilities(h.getDeviceCapabilities(model, generation), device.Profile)
 
 	// Convert Relay configuration
 	if contains(deviceCapabilities, "relay") {
@@ -784,7 +835,7 @@ func (h *Handler) createValidator(validationLevel string, device *database.Devic
 
 	deviceModel := device.Type
 	generation := h.extractGeneration(device.Firmware)
-	capabilities := h.getDeviceCapabilities(device.Type, generation)
+	capabilities := profileCapabilities(h.getDeviceCapabilities(device.Type, generation), device.Profile)
 
 	return configuration.NewConfigurationValidator(level, deviceModel, generation, capabilities)
 }
@@ -849,6 +900,21 @@ func (h *Handler) getDeviceCapabilities(model string, generation int) []string {
 	return capabilities
 }
 
+// profileCapabilities drops the relay section for devices in the cover
+// profile: their outputs drive a cover and relay settings do not apply
+func profileCapabilities(capabilities []string, profile string) []string {
+	if profile != shelly.ProfileCover {
+		return capabilities
+	}
+	filtered := make([]string, 0, len(capabilities))
+	for _, c := range capabilities {
+		if c != "relay" {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
 // Helper conversion functions
 
 func (h *Handler) convertWiFiConfig(data map[string]interface{}) (*configuration.WiFiConfiguration, []string) {
@@ -922,8 +988,12 @@ func (h *Handler) convertWiFiConfig(data map[string]interface{}) (*configuration
 		}
 	}
 
-	// Handle access point configuration (wifi_ap)
-	if apData, ok := data["wifi_ap"].(map[string]interface{}); ok {
+	// Handle access point configuration (Gen1 wifi_ap, Gen2 wifi.ap)
+	apData, ok := data["wifi_ap"].(map[string]interface{})
+	if !ok {
+		apData, ok = data["ap"].(map[string]interface{})
+	}
+	if ok {
 		ap := &configuration.AccessPointConfig{}
 
 		// Try both "enable" and "enabled" (Shelly devices use "enabled")
@@ -941,6 +1011,11 @@ func (h *Handler) convertWiFiConfig(data map[string]interface{}) (*configuration
 		if key, ok := apData["key"].(string); ok {
 			ap.Key = configuration.StringPtr(key)
 		}
+		if extender, ok := apData["range_extender"].(map[string]interface{}); ok {
+			if enable, ok := extender["enable"].(bool); ok {
+				ap.RangeExtender = configuration.BoolPtr(enable)
+			}
+		}
 
 		wifi.AccessPoint = ap
 	}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ginsys/shelly-manager/internal/security/auth"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// maxUsageClientName bounds client names taken from request headers
+const maxUsageClientName = 120
+
+// deviceRequestPath matches the API paths of one device
+var deviceRequestPath = regexp.MustCompile(`^/api/v1/devices/([0-9]+)(/|$)`)
+
+// usageMiddleware counts every API request against its client and lets the
+// device calls it causes, including those of jobs it starts, be counted too
+func usageMiddleware(handler *Handler) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var deviceID uint
+			if m := deviceRequestPath.FindStringSubmatch(r.URL.Path); m != nil {
+				if id, err := strconv.ParseUint(m[1], 10, 32); err == nil {
+					deviceID = uint(id)
+				}
+			}
+			ctx := handler.Service.TrackAPIRequest(r.Context(), usageClient(r, handler.AdminAPIKey), deviceID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// usageClient identifies the client of a request: the signed-in user, the
+// integration named in X-User-ID or X-User, the admin API key, the
+// User-Agent, or else the remote address
+func usageClient(r *http.Request, adminKey string) service.APIClient {
+	if p := auth.FromContext(r.Context()); p != nil && p.Username != "" {
+		return service.APIClient{Name: p.Username, Kind: service.APIClientUser}
+	}
+	for _, header := range []string{"X-User-ID", "X-User"} {
+		if v := strings.TrimSpace(r.Header.Get(header)); v != "" {
+			return service.APIClient{Name: truncateUsageName(v), Kind: service.APIClientIntegration}
+		}
+	}
+	if auth.AdminKeyOK(r, adminKey) {
+		return service.APIClient{Name: "admin", Kind: service.APIClientAPIKey}
+	}
+	if ua := strings.TrimSpace(r.UserAgent()); ua != "" {
+		return service.APIClient{Name: truncateUsageName(ua), Kind: service.APIClientUserAgent}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return service.APIClient{Name: host, Kind: service.APIClientAddress}
+}
+
+// truncateUsageName caps a client name taken from a request header
+func truncateUsageName(name string) string {
+	if len(name) > maxUsageClientName {
+		return name[:maxUsageClientName]
+	}
+	return name
+}
+
+// GetAPIUsage handles GET /api/v1/admin/usage with the requests and device
+// calls of each API client, the clients causing the most device calls first
+func (h *Handler) GetAPIUsage(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	report, err := h.Service.APIUsage()
+	if err != nil {
+		h.responseWriter().WriteInternalError(w, r, err)
+		return
+	}
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			h.responseWriter().WriteValidationError(w, r, "limit must be a positive number")
+			return
+		}
+		if len(report.Clients) > limit {
+			report.Clients = report.Clients[:limit]
+		}
+	}
+	h.responseWriter().WriteSuccess(w, r, report)
+}
+
+// ResetAPIUsage handles DELETE /api/v1/admin/usage and starts counting anew
+func (h *Handler) ResetAPIUsage(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	h.Service.ResetAPIUsage()
+	h.responseWriter().WriteSuccess(w, r, map[string]any{"reset": true})
+}
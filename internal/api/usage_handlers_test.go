@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/service"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestUsageClient(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/devices", nil)
+	req.RemoteAddr = "192.0.2.7:51234"
+	testutil.AssertEqual(t, service.APIClient{Name: "192.0.2.7", Kind: service.APIClientAddress}, usageClient(req, "k"))
+
+	req.Header.Set("User-Agent", "curl/8.5")
+	testutil.AssertEqual(t, service.APIClient{Name: "curl/8.5", Kind: service.APIClientUserAgent}, usageClient(req, "k"))
+
+	req.Header.Set("X-API-Key", "k")
+	testutil.AssertEqual(t, service.APIClient{Name: "admin", Kind: service.APIClientAPIKey}, usageClient(req, "k"))
+
+	req.Header.Set("X-User-ID", "home-assistant")
+	testutil.AssertEqual(t, service.APIClient{Name: "home-assistant", Kind: service.APIClientIntegration}, usageClient(req, "k"))
+}
+
+func TestGetAPIUsage(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	svc := testShellyService(t, db)
+	handler := NewHandlerWithLogger(db, svc, nil, nil, logging.GetDefault())
+
+	counted := usageMiddleware(handler)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for _, path := range []string{"/api/v1/devices/3/status", "/api/v1/devices/3", "/api/v1/devices"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-User-ID", "grafana")
+		counted.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	handler.GetAPIUsage(w, httptest.NewRequest("GET", "/api/v1/admin/usage?limit=5", nil))
+	testutil.AssertEqual(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data struct {
+			Clients []struct {
+				Name           string `json:"name"`
+				Kind           string `json:"kind"`
+				Requests       int64  `json:"requests"`
+				DeviceRequests int64  `json:"device_requests"`
+				Devices        []struct {
+					DeviceID uint  `json:"device_id"`
+					Requests int64 `json:"requests"`
+				} `json:"devices"`
+			} `json:"clients"`
+		} `json:"data"`
+	}
+	testutil.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	testutil.AssertEqual(t, 1, len(resp.Data.Clients))
+	client := resp.Data.Clients[0]
+	testutil.AssertEqual(t, "grafana", client.Name)
+	testutil.AssertEqual(t, service.APIClientIntegration, client.Kind)
+	testutil.AssertEqual(t, int64(3), client.Requests)
+	testutil.AssertEqual(t, int64(2), client.DeviceRequests)
+	testutil.AssertEqual(t, 1, len(client.Devices))
+	testutil.AssertEqual(t, uint(3), client.Devices[0].DeviceID)
+
+	w = httptest.NewRecorder()
+	handler.GetAPIUsage(w, httptest.NewRequest("GET", "/api/v1/admin/usage?limit=0", nil))
+	testutil.AssertEqual(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ResetAPIUsage(w, httptest.NewRequest("DELETE", "/api/v1/admin/usage", nil))
+	testutil.AssertEqual(t, http.StatusOK, w.Code)
+	report, err := svc.APIUsage()
+	testutil.AssertNoError(t, err)
+	testutil.AssertEqual(t, 0, len(report.Clients))
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
+	"github.com/ginsys/shelly-manager/internal/configuration"
+)
+
+// Optimistic concurrency: devices, device configs and templates carry a
+// version that every edit bumps. GET responses return it in the body and as
+// an ETag; an edit sends it back in If-Match (or as "version" in the body)
+// and is refused with 409 when the resource changed meanwhile. Edits without
+// a version still apply, as before.
+
+// versionETag renders a version as an ETag
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// setVersionETag sets the ETag of a versioned response
+func setVersionETag(w http.ResponseWriter, version int) {
+	if version > 0 {
+		w.Header().Set("ETag", versionETag(version))
+	}
+}
+
+// expectedVersion returns the version an edit is based on: the If-Match
+// header, else the version in the body. 0 means no precondition.
+func expectedVersion(r *http.Request, bodyVersion int) (int, error) {
+	match := strings.TrimSpace(r.Header.Get("If-Match"))
+	if match == "" || match == "*" {
+		if match == "" && bodyVersion > 0 {
+			return bodyVersion, nil
+		}
+		return 0, nil
+	}
+	tag := strings.Trim(strings.TrimPrefix(match, "W/"), `"`)
+	version, err := strconv.Atoi(tag)
+	if err != nil || version < 1 {
+		return 0, errors.New("If-Match must be an ETag returned by this API")
+	}
+	return version, nil
+}
+
+// checkVersion answers 400 for a malformed If-Match and 409 with the current
+// resource when the edit is based on an outdated version. It returns the
+// version to update from, and false when it has answered the request.
+func (h *Handler) checkVersion(w http.ResponseWriter, r *http.Request, bodyVersion, current int, resource interface{}) (int, bool) {
+	expected, err := expectedVersion(r, bodyVersion)
+	if err != nil {
+		h.responseWriter().WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, err.Error(), nil)
+		return 0, false
+	}
+	if expected != 0 && expected != current {
+		h.writeVersionConflict(w, r, current, resource)
+		return 0, false
+	}
+	return current, true
+}
+
+// writeVersionConflict answers 409 with the current version and resource
+func (h *Handler) writeVersionConflict(w http.ResponseWriter, r *http.Request, current int, resource interface{}) {
+	setVersionETag(w, current)
+	h.responseWriter().WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict,
+		"The resource was modified by another request; reload it and retry",
+		map[string]interface{}{"current_version": current, "current": resource})
+}
+
+// isVersionConflict reports whether an update lost a race with another one
+func isVersionConflict(err error) bool {
+	return errors.Is(err, configuration.ErrVersionConflict)
+}
+
+// checkConfigVersion applies an If-Match precondition to a device's stored
+// config. Config edits merge into the stored document, so the version is
+// only taken from If-Match, never from the body.
+func (h *Handler) checkConfigVersion(w http.ResponseWriter, r *http.Request, deviceID uint) bool {
+	config, err := h.Service.GetDeviceConfig(deviceID)
+	if err != nil {
+		// The update itself reports a missing config
+		return true
+	}
+	_, ok := h.checkVersion(w, r, 0, config.Version, config)
+	return ok
+}
+
+// writeConfigConflict answers 409 with the current config when a config
+// update lost a race, and reports whether it did
+func (h *Handler) writeConfigConflict(w http.ResponseWriter, r *http.Request, deviceID uint, err error) bool {
+	if !isVersionConflict(err) {
+		return false
+	}
+	config, getErr := h.Service.GetDeviceConfig(deviceID)
+	if getErr != nil {
+		return false
+	}
+	h.writeVersionConflict(w, r, config.Version, config)
+	return true
+}
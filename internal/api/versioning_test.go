@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func versionedRequest(method, path, id, ifMatch string, body any) *http.Request {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	return mux.SetURLVars(req, map[string]string{"id": id})
+}
+
+func conflictVersion(t *testing.T, w *httptest.ResponseRecorder) float64 {
+	t.Helper()
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	var resp struct {
+		Error struct {
+			Code    string         `json:"code"`
+			Details map[string]any `json:"details"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "CONFLICT", resp.Error.Code)
+	return resp.Error.Details["current_version"].(float64)
+}
+
+func TestOptimisticConcurrency_Device(t *testing.T) {
+	handler, cleanup := setupTemplateScopeHandler(t)
+	defer cleanup()
+
+	device := testutil.TestDevice()
+	require.NoError(t, handler.DB.AddDevice(device))
+	id := strconv.Itoa(int(device.ID))
+	path := "/api/v1/devices/" + id
+
+	w := httptest.NewRecorder()
+	handler.GetDevice(w, versionedRequest("GET", path, id, "", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	edit := map[string]any{"ip": device.IP, "mac": device.MAC, "type": device.Type, "name": "Tab A"}
+	w = httptest.NewRecorder()
+	handler.UpdateDevice(w, versionedRequest("PUT", path, id, `"1"`, edit))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// A second tab still holding version 1 is refused, by header or body
+	edit["name"] = "Tab B"
+	w = httptest.NewRecorder()
+	handler.UpdateDevice(w, versionedRequest("PUT", path, id, `"1"`, edit))
+	assert.Equal(t, float64(2), conflictVersion(t, w))
+	edit["version"] = 1
+	w = httptest.NewRecorder()
+	handler.UpdateDevice(w, versionedRequest("PUT", path, id, "", edit))
+	assert.Equal(t, float64(2), conflictVersion(t, w))
+
+	stored, err := handler.DB.GetDevice(device.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Tab A", stored.Name)
+
+	// Background saves of an older copy keep the version
+	device.Status = "online"
+	require.NoError(t, handler.DB.UpdateDevice(device))
+	stored, err = handler.DB.GetDevice(device.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stored.Version)
+
+	// Edits without a version still apply
+	delete(edit, "version")
+	w = httptest.NewRecorder()
+	handler.UpdateDevice(w, versionedRequest("PUT", path, id, "", edit))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	handler.UpdateDevice(w, versionedRequest("PUT", path, id, "bogus", edit))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOptimisticConcurrency_ConfigAndTemplate(t *testing.T) {
+	handler, cleanup := setupTemplateScopeHandler(t)
+	defer cleanup()
+
+	device := testutil.TestDevice()
+	require.NoError(t, handler.DB.AddDevice(device))
+	require.NoError(t, handler.DB.GetDB().Create(&configuration.DeviceConfig{DeviceID: device.ID, Config: json.RawMessage(`{}`)}).Error)
+	id := strconv.Itoa(int(device.ID))
+	path := fmt.Sprintf("/api/v1/devices/%s/config", id)
+
+	w := httptest.NewRecorder()
+	handler.UpdateDeviceConfig(w, versionedRequest("PUT", path, id, `"1"`, map[string]any{"name": "a"}))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	handler.UpdateDeviceConfig(w, versionedRequest("PUT", path, id, `"1"`, map[string]any{"name": "b"}))
+	assert.Equal(t, float64(2), conflictVersion(t, w))
+
+	template := &configuration.ServiceConfigTemplate{Name: "base", Scope: "global", Config: json.RawMessage(`{}`)}
+	require.NoError(t, handler.ConfigService.ConfigurationSvc.CreateTemplate(template))
+	tid := strconv.Itoa(int(template.ID))
+	tpath := "/api/v1/config/templates/new/" + tid
+
+	w = httptest.NewRecorder()
+	handler.GetNewConfigTemplate(w, versionedRequest("GET", tpath, tid, "", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	handler.UpdateNewConfigTemplate(w, versionedRequest("PUT", tpath, tid, `"1"`, map[string]any{"description": "first"}))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	handler.UpdateNewConfigTemplate(w, versionedRequest("PUT", tpath, tid, "", map[string]any{"description": "stale", "version": 1}))
+	assert.Equal(t, float64(2), conflictVersion(t, w))
+
+	// The legacy endpoint shares the template's version
+	legacy := map[string]any{"name": "base", "scope": "global", "config": json.RawMessage(`{}`), "version": 2}
+	w = httptest.NewRecorder()
+	handler.UpdateConfigTemplate(w, versionedRequest("PUT", "/api/v1/config/templates/"+tid, tid, "", legacy))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	handler.UpdateConfigTemplate(w, versionedRequest("PUT", "/api/v1/config/templates/"+tid, tid, "", legacy))
+	assert.Equal(t, float64(3), conflictVersion(t, w))
+}
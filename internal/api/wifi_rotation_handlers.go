@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// StageWiFiRotation handles POST /api/v1/wifi-rotations. It stages new
+// station credentials for the selected devices without pushing them.
+func (h *Handler) StageWiFiRotation(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req service.WiFiRotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+		return
+	}
+
+	rotation, err := h.Service.StageWiFiRotation(req)
+	if err != nil {
+		h.writeWiFiRotationError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteCreated(w, r, rotation)
+}
+
+// ListWiFiRotations handles GET /api/v1/wifi-rotations
+func (h *Handler) ListWiFiRotations(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	rotations := h.Service.ListWiFiRotations()
+	h.responseWriter().WriteSuccess(w, r, map[string]interface{}{
+		"rotations": rotations,
+		"count":     len(rotations),
+	})
+}
+
+// GetWiFiRotation handles GET /api/v1/wifi-rotations/{id} and reports the
+// per-device rollout state
+func (h *Handler) GetWiFiRotation(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	rotation, err := h.Service.GetWiFiRotation(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeWiFiRotationError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, rotation)
+}
+
+// StartWiFiRotation handles POST /api/v1/wifi-rotations/{id}/start. The
+// rollout runs in the background; poll the rotation for progress.
+func (h *Handler) StartWiFiRotation(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	rotation, err := h.Service.StartWiFiRotation(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeWiFiRotationError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteAccepted(w, r, rotation)
+}
+
+// VerifyWiFiRotation handles POST /api/v1/wifi-rotations/{id}/verify. It
+// probes stragglers and rescued devices again.
+func (h *Handler) VerifyWiFiRotation(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	rotation, err := h.Service.VerifyWiFiRotation(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeWiFiRotationError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, rotation)
+}
+
+// RescueWiFiRotation handles POST /api/v1/wifi-rotations/{id}/rescue. Every
+// straggler gets a provision_device task so a provisioning agent can join it
+// to the new network from AP mode. The new password is a task secret, only
+// handed to the agent that polls the task.
+func (h *Handler) RescueWiFiRotation(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		AgentID string `json:"agent_id,omitempty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.responseWriter().WriteValidationError(w, r, "Invalid JSON request body")
+			return
+		}
+	}
+
+	rotationID := mux.Vars(r)["id"]
+	rotation, err := h.Service.RescueWiFiStragglers(rotationID, func(d service.WiFiRotationDevice, ssid, password string) (string, error) {
+		config, apPassword := h.withIntakeDetails(r, d.MAC, map[string]interface{}{
+			"device_name":      d.Name,
+			"wifi_rotation_id": rotationID,
+		})
+		task := &ProvisioningTask{
+			Type:       "provision_device",
+			DeviceMAC:  d.MAC,
+			TargetSSID: ssid,
+			Config:     config,
+			Secrets:    map[string]interface{}{"password": password},
+			AgentID:    req.AgentID,
+		}
+		if apPassword != "" {
+			setTaskSecret(task, "ap_password", apPassword)
+		}
+		task = enqueueProvisioningTask(task, h.withEnrollmentToken)
+		return task.ID, nil
+	})
+	if err != nil {
+		h.writeWiFiRotationError(w, r, err)
+		return
+	}
+	h.responseWriter().WriteSuccess(w, r, rotation)
+}
+
+// writeWiFiRotationError maps rotation errors to 404 and 400
+func (h *Handler) writeWiFiRotationError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrWiFiRotationNotFound):
+		h.responseWriter().WriteNotFoundError(w, r, "Wi-Fi rotation")
+	case errors.Is(err, service.ErrDeviceNotFound), errors.Is(err, service.ErrInvalidWiFiRotation):
+		h.responseWriter().WriteValidationError(w, r, err.Error())
+	default:
+		h.responseWriter().WriteInternalError(w, r, err)
+	}
+}
@@ -0,0 +1,110 @@
+// Package cli holds what the shelly-manager and shelly-provisioner command
+// lines share: man page generation, and telling the commands that only
+// describe the CLI (completion scripts, man pages, help) from those that
+// need configuration, logging and a database.
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// ManCommandName names the command writing man pages
+const ManCommandName = "man"
+
+// toolingCommands describe the CLI itself and need no setup
+var toolingCommands = map[string]bool{
+	"completion":                    true,
+	"help":                          true,
+	ManCommandName:                  true,
+	cobra.ShellCompRequestCmd:       true,
+	cobra.ShellCompNoDescRequestCmd: true,
+}
+
+// Tooling reports whether cmd, or the top-level command it belongs to, only
+// describes the CLI: completion scripts, dynamic completions, man pages or
+// help. Such commands must not load configuration, open the database or
+// print anything besides their output.
+func Tooling(cmd *cobra.Command) bool {
+	for c := cmd; c != nil && c.HasParent(); c = c.Parent() {
+		if !c.Parent().HasParent() && toolingCommands[c.Name()] {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolingArgs reports whether the command line args (without the program
+// name) run a tooling command of root. Initializers use it, as they run
+// before the command is known to them.
+func ToolingArgs(root *cobra.Command, args []string) bool {
+	cmd, _, err := root.Find(args)
+	if err != nil {
+		return false
+	}
+	return Tooling(cmd)
+}
+
+// ManCommand returns a command writing a man page for root and each of its
+// subcommands into a directory
+func ManCommand(root *cobra.Command) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   ManCommandName,
+		Short: "Generate man pages",
+		Long: fmt.Sprintf(`Write a man page (section 1) for %[1]s and each of its commands into
+--dir, e.g. for /usr/local/share/man/man1. View one with: man -l %[1]s.1`, root.Name()),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, _ := cmd.Flags().GetString("dir")
+			n, err := GenerateManPages(root, dir)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Wrote %d man pages to %s\n", n, dir)
+			return nil
+		},
+	}
+	cmd.Flags().String("dir", "man", "Directory to write the man pages to")
+	return cmd
+}
+
+// GenerateManPages writes the man pages of root and its subcommands into dir
+// and returns how many were written. Hidden commands and the man and
+// completion commands are left out.
+func GenerateManPages(root *cobra.Command, dir string) (int, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create man page directory: %w", err)
+	}
+	header := &doc.GenManHeader{
+		Title:   strings.ToUpper(root.Name()),
+		Section: "1",
+		Source:  "Shelly Manager",
+		Manual:  "Shelly Manager Manual",
+	}
+	for _, c := range root.Commands() {
+		if c.Name() == ManCommandName || c.Name() == "completion" {
+			c.Hidden = true
+		}
+	}
+	root.DisableAutoGenTag = true
+	if err := doc.GenManTree(root, header, dir); err != nil {
+		return 0, fmt.Errorf("failed to generate man pages: %w", err)
+	}
+	return countPages(root), nil
+}
+
+// countPages counts the commands GenManTree writes a page for
+func countPages(cmd *cobra.Command) int {
+	if !cmd.IsAvailableCommand() || cmd.IsAdditionalHelpTopicCommand() {
+		return 0
+	}
+	n := 1
+	for _, c := range cmd.Commands() {
+		n += countPages(c)
+	}
+	return n
+}
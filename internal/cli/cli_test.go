@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func testRoot() *cobra.Command {
+	root := &cobra.Command{Use: "tool", Short: "A tool"}
+	run := func(*cobra.Command, []string) {}
+	list := &cobra.Command{Use: "list", Short: "List things", Run: run}
+	group := &cobra.Command{Use: "intake", Short: "Intake things"}
+	group.AddCommand(&cobra.Command{Use: "add", Short: "Add a thing", Run: run})
+	root.PersistentFlags().String("server", "", "server URL")
+	root.AddCommand(list, group, ManCommand(root))
+	root.InitDefaultHelpCmd()
+	root.InitDefaultCompletionCmd()
+	return root
+}
+
+func TestToolingArgs(t *testing.T) {
+	root := testRoot()
+	for _, tc := range []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"completion", "bash"}, true},
+		{[]string{"--server", "http://x", "man", "--dir", "out"}, true},
+		{[]string{"help", "list"}, true},
+		{[]string{"list"}, false},
+		{[]string{"intake", "add"}, false},
+		{[]string{}, false},
+	} {
+		if got := ToolingArgs(root, tc.args); got != tc.want {
+			t.Errorf("ToolingArgs(%v) = %v, expected %v", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestGenerateManPages(t *testing.T) {
+	root := testRoot()
+	dir := filepath.Join(t.TempDir(), "man")
+	n, err := GenerateManPages(root, dir)
+	if err != nil {
+		t.Fatalf("GenerateManPages failed: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read man pages: %v", err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if n != 4 || strings.Join(names, " ") != "tool-intake-add.1 tool-intake.1 tool-list.1 tool.1" {
+		t.Fatalf("Expected pages for the commands only, got %d: %v", n, names)
+	}
+	page, err := os.ReadFile(filepath.Join(dir, "tool-list.1"))
+	if err != nil {
+		t.Fatalf("Failed to read page: %v", err)
+	}
+	if !strings.Contains(string(page), `.TH "TOOL" "1"`) || !strings.Contains(string(page), "List things") {
+		t.Errorf("Unexpected page:\n%s", page)
+	}
+}
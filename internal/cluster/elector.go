@@ -0,0 +1,136 @@
+// Package cluster coordinates periodic jobs between server instances that
+// share a database. One instance at a time holds the scheduler lease and runs
+// the jobs; when it stops renewing the lease another instance takes over.
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+// SchedulerLease is the lease that guards every periodic job
+const SchedulerLease = "scheduler"
+
+// LeaseStore persists leases; database.Manager implements it
+type LeaseStore interface {
+	AcquireLease(name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(name, holder string) error
+}
+
+// Elector keeps this instance's claim on the scheduler lease fresh and
+// reports whether it currently leads
+type Elector struct {
+	store  LeaseStore
+	holder string
+	ttl    time.Duration
+	logger *logging.Logger
+
+	mu      sync.RWMutex
+	leader  bool
+	renewed time.Time
+}
+
+// NewElector creates an elector for holder with the given lease TTL
+func NewElector(store LeaseStore, holder string, ttl time.Duration, logger *logging.Logger) *Elector {
+	return &Elector{
+		store:  store,
+		holder: holder,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+// Holder returns the name this instance uses in the lease table
+func (e *Elector) Holder() string {
+	return e.holder
+}
+
+// Run claims or renews the lease every third of its TTL until ctx is
+// cancelled, then releases it so another instance can take over at once
+func (e *Elector) Run(ctx context.Context) {
+	e.Renew()
+	e.renewLoop(ctx)
+}
+
+// Start claims the lease before returning, so jobs started afterwards
+// already know whether this instance leads, and keeps renewing it in the
+// background like Run. It returns whether this instance leads.
+func (e *Elector) Start(ctx context.Context) bool {
+	leader := e.Renew()
+	go e.renewLoop(ctx)
+	return leader
+}
+
+func (e *Elector) renewLoop(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-ticker.C:
+			e.Renew()
+		}
+	}
+}
+
+// Renew claims or renews the lease once and returns whether this instance
+// now leads
+func (e *Elector) Renew() bool {
+	start := time.Now()
+	acquired, err := e.store.AcquireLease(SchedulerLease, e.holder, e.ttl)
+	if err != nil {
+		e.logger.WithFields(map[string]any{
+			"holder":    e.holder,
+			"error":     err.Error(),
+			"component": "cluster",
+		}).Warn("Failed to renew scheduler lease")
+	}
+
+	e.mu.Lock()
+	was := e.leader
+	e.leader = acquired
+	if acquired {
+		e.renewed = start
+	}
+	e.mu.Unlock()
+
+	if acquired != was {
+		e.logger.WithFields(map[string]any{
+			"holder":    e.holder,
+			"leader":    acquired,
+			"component": "cluster",
+		}).Info("Scheduler leadership changed")
+	}
+	return acquired
+}
+
+// IsLeader reports whether this instance holds an unexpired scheduler lease.
+// A leader that cannot reach the database stops leading once its last
+// renewal is a TTL old, when another instance may already have taken over.
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader && time.Since(e.renewed) < e.ttl
+}
+
+func (e *Elector) release() {
+	e.mu.Lock()
+	leader := e.leader
+	e.leader = false
+	e.mu.Unlock()
+	if !leader {
+		return
+	}
+	if err := e.store.ReleaseLease(SchedulerLease, e.holder); err != nil {
+		e.logger.WithFields(map[string]any{
+			"holder":    e.holder,
+			"error":     err.Error(),
+			"component": "cluster",
+		}).Warn("Failed to release scheduler lease")
+	}
+}
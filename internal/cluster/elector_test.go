@@ -0,0 +1,49 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+func TestElectorFailover(t *testing.T) {
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+	manager, err := database.NewManagerFromPathWithLogger(":memory:", logger)
+	require.NoError(t, err)
+	defer func() { _ = manager.Close() }()
+
+	ttl := 300 * time.Millisecond
+	a := NewElector(manager, "a", ttl, logger)
+	b := NewElector(manager, "b", ttl, logger)
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, a.IsLeader, time.Second, 10*time.Millisecond)
+
+	// Exactly one instance leads
+	assert.False(t, b.Renew())
+	assert.False(t, b.IsLeader())
+
+	// Stopping the leader releases the lease for the standby
+	stop()
+	<-done
+	assert.False(t, a.IsLeader())
+	assert.True(t, b.Renew())
+	assert.True(t, b.IsLeader())
+
+	// A leader that stops renewing loses the lease after its TTL
+	time.Sleep(ttl + 50*time.Millisecond)
+	assert.False(t, b.IsLeader())
+	assert.True(t, a.Renew())
+}
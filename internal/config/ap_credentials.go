@@ -0,0 +1,47 @@
+package config
+
+import "strings"
+
+// APCredential is the AP password for one device, typically the password
+// printed on the device label of newer Shelly models
+type APCredential struct {
+	MAC      string `mapstructure:"mac" json:"mac,omitempty"`   // full MAC or trailing hex digits, any separator
+	SSID     string `mapstructure:"ssid" json:"ssid,omitempty"` // AP SSID, case-insensitive
+	Password string `mapstructure:"password" json:"-"`
+}
+
+// Matches reports whether the credential applies to a device AP. MACs are
+// compared on their hex digits only; a short MAC matches as a suffix so the
+// last six digits shown in the AP SSID are enough; shorter MACs never match.
+func (c APCredential) Matches(mac, ssid string) bool {
+	if c.SSID != "" && strings.EqualFold(c.SSID, ssid) {
+		return true
+	}
+	want := NormalizeMAC(c.MAC)
+	if len(want) < 6 {
+		return false
+	}
+	if got := NormalizeMAC(mac); got != "" && strings.HasSuffix(got, want) {
+		return true
+	}
+	// AP SSIDs end with MAC digits, e.g. shelly1-AABBCC or ShellyPlus1-A8032AB1E2C4
+	if i := strings.LastIndex(ssid, "-"); i >= 0 {
+		suffix := NormalizeMAC(ssid[i+1:])
+		if len(suffix) != len(ssid)-i-1 || len(suffix) < 6 {
+			return false
+		}
+		return strings.HasSuffix(want, suffix) || strings.HasSuffix(suffix, want)
+	}
+	return false
+}
+
+// NormalizeMAC strips separators and upper-cases a MAC address
+func NormalizeMAC(mac string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(mac) {
+		if (r >= '0' && r <= '9') || (r >= 'A' && r <= 'F') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package config
+
+import "time"
+
+// Asset defaults
+const (
+	DefaultWarrantyCheckInterval = 24 // hours
+	DefaultWarrantyNoticeDays    = 30
+)
+
+// AssetsConfig controls the check that notifies when device warranties
+// approach expiry
+type AssetsConfig struct {
+	WarrantyChecks bool `mapstructure:"warranty_checks" json:"warranty_checks"`
+	// Interval between warranty checks in hours
+	Interval int `mapstructure:"interval" json:"interval,omitempty"`
+	// NoticeDays is how many days before expiry a warranty is notified
+	NoticeDays int `mapstructure:"notice_days" json:"notice_days,omitempty"`
+}
+
+// IntervalDuration returns the check interval, falling back to the default
+func (c AssetsConfig) IntervalDuration() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultWarrantyCheckInterval * time.Hour
+	}
+	return time.Duration(c.Interval) * time.Hour
+}
+
+// NoticeDuration returns how long before expiry a warranty is notified
+func (c AssetsConfig) NoticeDuration() time.Duration {
+	if c.NoticeDays <= 0 {
+		return DefaultWarrantyNoticeDays * 24 * time.Hour
+	}
+	return time.Duration(c.NoticeDays) * 24 * time.Hour
+}
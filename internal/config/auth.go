@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Roles of users signed in through single sign-on
+const (
+	RoleViewer   = "viewer"   // read-only API access
+	RoleOperator = "operator" // changes outside the admin endpoints
+	RoleAdmin    = "admin"    // everything, including the admin endpoints
+)
+
+// Defaults for single sign-on
+const (
+	DefaultAuthSessionTTL    = 8 * 3600 // seconds
+	DefaultAuthSessionCookie = "shelly_session"
+	DefaultOIDCGroupsClaim   = "groups"
+	DefaultOIDCUsernameClaim = "preferred_username"
+)
+
+// AuthConfig signs users in through an identity provider in addition to the
+// admin API key. Users get a role from their groups; the admin API key keeps
+// working for automation.
+type AuthConfig struct {
+	// Required rejects API requests without a valid session, token or admin
+	// API key; otherwise anonymous requests keep today's access
+	Required bool `mapstructure:"required"`
+	// DefaultRole is the role of users in none of the mapped groups; empty
+	// refuses them
+	DefaultRole string `mapstructure:"default_role"`
+	// RoleMappings gives the members of a group a role; the highest role of
+	// a user's groups applies
+	RoleMappings []AuthRoleMapping `mapstructure:"role_mappings"`
+	// SessionTTL is the lifetime of a browser session in seconds
+	SessionTTL int `mapstructure:"session_ttl"`
+	// SessionCookie names the browser session cookie
+	SessionCookie string `mapstructure:"session_cookie"`
+	// InsecureCookies drops the Secure flag, for HTTP-only test setups
+	InsecureCookies bool `mapstructure:"insecure_cookies"`
+	// OIDC signs users in through an OpenID Connect provider
+	OIDC OIDCConfig `mapstructure:"oidc"`
+}
+
+// AuthRoleMapping gives the members of an identity provider group a role
+type AuthRoleMapping struct {
+	Group string `mapstructure:"group" json:"group"`
+	Role  string `mapstructure:"role" json:"role"`
+}
+
+// OIDCConfig configures the OpenID Connect provider: browser sign-in with
+// the authorization code flow, and bearer tokens for API clients
+type OIDCConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Issuer is the provider's issuer URL; its discovery document is read
+	// from <issuer>/.well-known/openid-configuration
+	Issuer       string `mapstructure:"issuer"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// RedirectURL is this manager's callback,
+	// https://<host>/api/v1/auth/oidc/callback
+	RedirectURL string   `mapstructure:"redirect_url"`
+	Scopes      []string `mapstructure:"scopes"`
+	// Audiences are accepted in bearer tokens besides the client ID
+	Audiences []string `mapstructure:"audiences"`
+	// GroupsClaim is the claim listing a user's groups; a dotted path reads
+	// nested claims, e.g. "realm_access.roles"
+	GroupsClaim string `mapstructure:"groups_claim"`
+	// UsernameClaim names users; email and subject are used when it is unset
+	UsernameClaim string `mapstructure:"username_claim"`
+}
+
+// Enabled reports whether any sign-in backend is configured
+func (c AuthConfig) Enabled() bool {
+	return c.OIDC.Enabled
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	return role == RoleViewer || role == RoleOperator || role == RoleAdmin
+}
+
+// Validate checks the roles and, when enabled, the OIDC settings
+func (c AuthConfig) Validate() error {
+	if c.DefaultRole != "" && !ValidRole(c.DefaultRole) {
+		return fmt.Errorf("auth.default_role: unknown role %q (expected viewer, operator or admin)", c.DefaultRole)
+	}
+	for _, m := range c.RoleMappings {
+		if strings.TrimSpace(m.Group) == "" {
+			return fmt.Errorf("auth.role_mappings: group is required")
+		}
+		if !ValidRole(m.Role) {
+			return fmt.Errorf("auth.role_mappings: group %s has unknown role %q", m.Group, m.Role)
+		}
+	}
+	if c.SessionTTL < 0 {
+		return fmt.Errorf("auth.session_ttl must not be negative")
+	}
+	if !c.OIDC.Enabled {
+		return nil
+	}
+	if u, err := url.Parse(c.OIDC.Issuer); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("auth.oidc.issuer must be a URL")
+	}
+	if c.OIDC.ClientID == "" {
+		return fmt.Errorf("auth.oidc.client_id is required")
+	}
+	if c.OIDC.RedirectURL != "" {
+		if u, err := url.Parse(c.OIDC.RedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("auth.oidc.redirect_url must be an absolute URL")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package config
+
+import "time"
+
+// Bulk confirmation defaults
+const (
+	DefaultBulkConfirmationThreshold = 10  // devices
+	DefaultBulkConfirmationTTL       = 300 // seconds
+)
+
+// BulkConfirmationConfig controls the two-step confirmation of bulk
+// operations: a request touching more than Threshold devices is answered with
+// a change summary and a one-time token that must be sent back within TTL
+// seconds before anything is changed
+type BulkConfirmationConfig struct {
+	// Threshold is the number of devices an operation may affect without
+	// confirmation; 0 or less disables the confirmation
+	Threshold int `mapstructure:"threshold" json:"threshold"`
+	// TTL is how long a confirmation token stays valid, in seconds
+	TTL int `mapstructure:"ttl" json:"ttl,omitempty"`
+}
+
+// TTLDuration returns the token lifetime, falling back to the default
+func (c BulkConfirmationConfig) TTLDuration() time.Duration {
+	if c.TTL <= 0 {
+		return DefaultBulkConfirmationTTL * time.Second
+	}
+	return time.Duration(c.TTL) * time.Second
+}
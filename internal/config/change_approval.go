@@ -0,0 +1,32 @@
+package config
+
+import "time"
+
+// Change approval defaults
+const (
+	DefaultChangeApprovalMinDevices = 1  // devices
+	DefaultChangeApprovalTTL        = 24 // hours
+)
+
+// ChangeApprovalConfig controls the two-person rule for configuration
+// changes. When enabled, config exports and template applies affecting at
+// least MinDevices devices create a pending change request that another
+// identity must approve before the change runs.
+type ChangeApprovalConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// MinDevices is the number of devices from which an operation needs
+	// approval
+	MinDevices int `mapstructure:"min_devices" json:"min_devices"`
+	// TTL is how long a change request may wait for approval and then for
+	// its execution, in hours
+	TTL int `mapstructure:"ttl" json:"ttl,omitempty"`
+}
+
+// TTLDuration returns the change request lifetime, falling back to the
+// default
+func (c ChangeApprovalConfig) TTLDuration() time.Duration {
+	if c.TTL <= 0 {
+		return DefaultChangeApprovalTTL * time.Hour
+	}
+	return time.Duration(c.TTL) * time.Hour
+}
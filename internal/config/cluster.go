@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultClusterLeaseTTL is how long a scheduler lease survives without renewal
+const DefaultClusterLeaseTTL = 30 // seconds
+
+// ClusterConfig lets several server instances share one database. Periodic
+// jobs (metrics collection, the device supervisor, notification digests,
+// drift schedules and cleanup) then run only on the instance holding the
+// scheduler lease; another instance takes over once the lease lapses.
+type ClusterConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// InstanceID names this instance in the lease table; defaults to
+	// hostname-pid
+	InstanceID string `mapstructure:"instance_id" json:"instance_id,omitempty"`
+	// LeaseTTL is the failover time in seconds; the lease is renewed every
+	// third of it
+	LeaseTTL int `mapstructure:"lease_ttl" json:"lease_ttl,omitempty"`
+}
+
+// LeaseTTLDuration returns the lease TTL, falling back to the default
+func (c ClusterConfig) LeaseTTLDuration() time.Duration {
+	if c.LeaseTTL <= 0 {
+		return DefaultClusterLeaseTTL * time.Second
+	}
+	return time.Duration(c.LeaseTTL) * time.Second
+}
+
+// InstanceName returns the configured instance ID or hostname-pid
+func (c ClusterConfig) InstanceName() string {
+	if c.InstanceID != "" {
+		return c.InstanceID
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "shelly-manager"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
@@ -0,0 +1,35 @@
+package config
+
+// Gen1-style endpoints the compatibility layer can expose
+const (
+	CompatEndpointRelay  = "relay"
+	CompatEndpointStatus = "status"
+	CompatEndpointShelly = "shelly"
+)
+
+// CompatConfig controls /api/v1/compat/{device}/..., which answers Gen1-style
+// requests (/relay/0?turn=on, /status, /shelly) for managed devices of any
+// generation, so scripts and dashboards written for Gen1 devices keep working
+// while devices are migrated.
+type CompatConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// Endpoints lists the exposed endpoints (relay, status, shelly); empty
+	// exposes all of them
+	Endpoints []string `mapstructure:"endpoints" json:"endpoints,omitempty"`
+}
+
+// Allows reports whether an endpoint is exposed
+func (c CompatConfig) Allows(endpoint string) bool {
+	if !c.Enabled {
+		return false
+	}
+	if len(c.Endpoints) == 0 {
+		return true
+	}
+	for _, e := range c.Endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
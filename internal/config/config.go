@@ -35,15 +35,29 @@ type Config struct {
 		SlowQueryTime   int               `mapstructure:"slow_query_time"`    // milliseconds
 		LogLevel        string            `mapstructure:"log_level"`          // "silent", "error", "warn", "info"
 		Options         map[string]string `mapstructure:"options"`            // Provider-specific options
+
+		// Encryption at rest: column encryption of credentials and channel
+		// secrets on every provider
+		EncryptionKey          string   `mapstructure:"encryption_key"`
+		PreviousEncryptionKeys []string `mapstructure:"previous_encryption_keys"` // still decrypt, for key rotation
 	} `mapstructure:"database"`
 	Discovery struct {
-		Enabled         bool     `mapstructure:"enabled"`
-		Networks        []string `mapstructure:"networks"`
-		Interval        int      `mapstructure:"interval"`
-		Timeout         int      `mapstructure:"timeout"`
-		EnableMDNS      bool     `mapstructure:"enable_mdns"`
-		EnableSSDP      bool     `mapstructure:"enable_ssdp"`
-		ConcurrentScans int      `mapstructure:"concurrent_scans"`
+		Enabled bool `mapstructure:"enabled"`
+		// Networks are scanned with their own options; entries may be bare
+		// CIDRs
+		Networks        []DiscoveryNetwork `mapstructure:"networks"`
+		Interval        int                `mapstructure:"interval"`
+		Timeout         int                `mapstructure:"timeout"`
+		EnableMDNS      bool               `mapstructure:"enable_mdns"`
+		EnableSSDP      bool               `mapstructure:"enable_ssdp"`
+		ConcurrentScans int                `mapstructure:"concurrent_scans"`
+		// Exclude lists hosts no scanner may probe
+		Exclude DiscoveryExclude `mapstructure:"exclude"`
+		// NewDeviceAlerts holds devices that are not in the inventory as
+		// alerts to adopt or ignore instead of adding them
+		NewDeviceAlerts bool `mapstructure:"new_device_alerts"`
+		// DHCPLeases reads router lease tables for devices to probe
+		DHCPLeases DiscoveryDHCPLeases `mapstructure:"dhcp_leases"`
 	} `mapstructure:"discovery"`
 	Provisioning struct {
 		AuthEnabled       bool   `mapstructure:"auth_enabled"`
@@ -55,8 +69,64 @@ type Config struct {
 		DeviceNamePattern string `mapstructure:"device_name_pattern"`
 		AutoProvision     bool   `mapstructure:"auto_provision"`
 		ProvisionInterval int    `mapstructure:"provision_interval"`
+		// APCredentials supplies passwords for secured device access points,
+		// matched by device MAC (or MAC suffix) or AP SSID
+		APCredentials []APCredential `mapstructure:"ap_credentials"`
+		// HealthListen is the local address of the provisioning agent's
+		// health endpoint (e.g. 127.0.0.1:8091); empty disables it
+		HealthListen string `mapstructure:"health_listen"`
+		// Verification checks provisioned devices on the target network
+		// before their tasks are marked completed
+		Verification ProvisioningVerificationConfig `mapstructure:"verification"`
 	} `mapstructure:"provisioning"`
-	DHCP struct {
+	// DeviceClient controls HTTP timeouts and retries for device communication.
+	// Overrides apply per device class (model prefix and/or generation); individual
+	// devices may further override via the "client" key in their settings.
+	DeviceClient DeviceClientConfig `mapstructure:"device_client"`
+	// Naming generates device names from a template at adoption, provisioning
+	// and bulk rename
+	Naming NamingConfig `mapstructure:"naming"`
+	// Supervisor takes opt-in recovery actions on unhealthy devices
+	Supervisor SupervisorConfig `mapstructure:"supervisor"`
+	// Outage groups mass offline events into one and slows device polling
+	// while devices recover
+	Outage OutageConfig `mapstructure:"outage"`
+	// Integrity periodically checks for rows referring to deleted devices
+	Integrity IntegrityConfig `mapstructure:"integrity"`
+	// Identity periodically verifies that stored addresses reach the stored
+	// devices, following DHCP reassignments
+	Identity IdentityConfig `mapstructure:"identity"`
+	// ShellyCloud is the fleet's Shelly Cloud account, used to import devices
+	// and optionally keep cloud names and rooms in sync
+	ShellyCloud ShellyCloudConfig `mapstructure:"shelly_cloud"`
+	// BulkConfirmation requires a confirmation token before bulk operations
+	// on many devices
+	BulkConfirmation BulkConfirmationConfig `mapstructure:"bulk_confirmation"`
+	// ChangeApproval requires a second identity to approve config changes
+	ChangeApproval ChangeApprovalConfig `mapstructure:"change_approval"`
+	// Hooks bounds the operation hooks that enrich or veto operations
+	Hooks HooksConfig `mapstructure:"hooks"`
+	// DeviceProxy forwards allowlisted requests from the web UI to devices
+	DeviceProxy DeviceProxyConfig `mapstructure:"device_proxy"`
+	// Compat answers Gen1-style relay and status requests for any device
+	Compat CompatConfig `mapstructure:"compat"`
+	// DeviceSocket accepts outbound WebSocket connections from Gen2 devices
+	DeviceSocket DeviceSocketConfig `mapstructure:"device_socket"`
+	// Enrollment lets provisioned devices call home to be adopted
+	Enrollment EnrollmentConfig `mapstructure:"enrollment"`
+	// DeviceLogs collects Gen2 device debug logs streamed over UDP
+	DeviceLogs DeviceLogsConfig `mapstructure:"device_logs"`
+	// Assets notifies when device warranties approach expiry
+	Assets AssetsConfig `mapstructure:"assets"`
+	// PowerBudgets enforces the limits of power budget groups
+	PowerBudgets PowerBudgetConfig `mapstructure:"power_budgets"`
+	// DriftScoring weights configuration paths to rank drift by severity
+	DriftScoring DriftScoringConfig `mapstructure:"drift_scoring"`
+	// Auth signs users in through single sign-on, with roles from their groups
+	Auth AuthConfig `mapstructure:"auth"`
+	// Cluster runs periodic jobs on one of several instances sharing a database
+	Cluster ClusterConfig `mapstructure:"cluster"`
+	DHCP    struct {
 		Network     string `mapstructure:"network"`
 		StartIP     string `mapstructure:"start_ip"`
 		EndIP       string `mapstructure:"end_ip"`
@@ -84,7 +154,11 @@ type Config struct {
 	} `mapstructure:"api"`
 	Notifications struct {
 		Enabled bool `mapstructure:"enabled"`
-		Email   struct {
+		// HealthCheckInterval is the time in seconds between channel health
+		// checks; 0 disables them
+		HealthCheckInterval int `mapstructure:"health_check_interval"`
+
+		Email struct {
 			SMTPHost     string `mapstructure:"smtp_host"`
 			SMTPPort     int    `mapstructure:"smtp_port"`
 			SMTPUser     string `mapstructure:"smtp_user"`
@@ -118,6 +192,33 @@ type Config struct {
 		RetentionDays        int  `mapstructure:"retention_days"`
 		EnableHTTPMetrics    bool `mapstructure:"enable_http_metrics"`
 		EnableDetailedTiming bool `mapstructure:"enable_detailed_timing"`
+		// Clock skew: compare device clocks with server time on each collection
+		ClockSkewCheck      bool   `mapstructure:"clock_skew_check"`
+		ClockSkewThreshold  int    `mapstructure:"clock_skew_threshold"`   // seconds
+		ClockSkewSNTPServer string `mapstructure:"clock_skew_sntp_server"` // pushed by remediation
+		// Reboot tracking: read device uptime on each collection; devices
+		// rebooting unexpectedly more than RebootThreshold times a day flap
+		RebootCheck     bool `mapstructure:"reboot_check"`
+		RebootThreshold int  `mapstructure:"reboot_threshold"` // unexpected reboots per 24 hours
+		// Latency: poll device status on each collection for round-trip and
+		// failure trends; polls made for other checks are recorded either way
+		LatencyCheck         bool `mapstructure:"latency_check"`
+		LatencySlowThreshold int  `mapstructure:"latency_slow_threshold"` // milliseconds
+		// Latency history: hourly rows older than LatencyHourlyDays are
+		// rolled up into daily rows; all rows go after RetentionDays
+		LatencyHourlyDays int `mapstructure:"latency_hourly_days"`
+		// Energy history: hourly rows older than this are rolled up into
+		// daily rows, which are kept for as long as the device
+		EnergyHourlyDays int `mapstructure:"energy_hourly_days"`
+		// WebSocket clients: each queues up to WebSocketQueueSize messages;
+		// when the queue is full WebSocketDropPolicy (drop_oldest,
+		// drop_newest or disconnect) decides, and a client dropping
+		// WebSocketMaxDrops messages in a row is disconnected. A disconnected
+		// client can resume its session within WebSocketResumeWindow.
+		WebSocketQueueSize    int    `mapstructure:"websocket_queue_size"`
+		WebSocketDropPolicy   string `mapstructure:"websocket_drop_policy"`
+		WebSocketMaxDrops     int    `mapstructure:"websocket_max_drops"`
+		WebSocketResumeWindow int    `mapstructure:"websocket_resume_window"` // seconds
 	} `mapstructure:"metrics"`
 	Security struct {
 		UseProxyHeaders bool     `mapstructure:"use_proxy_headers"`
@@ -132,12 +233,24 @@ type Config struct {
 		AdminAPIKey string `mapstructure:"admin_api_key"`
 		// Test mode to bypass security validations (for E2E testing)
 		ValidationTestMode bool `mapstructure:"validation_test_mode"`
+		// Request body limits (bytes) per route class; 0 keeps the built-in limit
+		RequestLimits struct {
+			DefaultMaxBytes int64 `mapstructure:"default_max_bytes"`
+			ConfigMaxBytes  int64 `mapstructure:"config_max_bytes"`
+			ImportMaxBytes  int64 `mapstructure:"import_max_bytes"`
+		} `mapstructure:"request_limits"`
+		// Seconds a response to a POST with an Idempotency-Key header is replayed; 0 disables
+		IdempotencyTTL int `mapstructure:"idempotency_ttl"`
 	} `mapstructure:"security"`
 
 	// Export settings
 	Export struct {
 		// Optional base directory for generated export files. If set, downloads are restricted to this directory.
 		OutputDirectory string `mapstructure:"output_directory"`
+		// Signing signs backup and GitOps artifacts and verifies them on import
+		Signing ExportSigningConfig `mapstructure:"signing"`
+		// Lifecycle moves older artifacts to object storage and deletes them past retention
+		Lifecycle ExportLifecycleConfig `mapstructure:"lifecycle"`
 	} `mapstructure:"export"`
 
 	// Sync settings (import/export base directories for path traversal protection)
@@ -202,10 +315,32 @@ func LoadWithName(configFile string, configName string) (*Config, error) {
 	// Report which config file was loaded
 	configFilePath := viper.ConfigFileUsed()
 
+	normalizeDiscoveryNetworks()
+
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config from '%s': %w", configFilePath, err)
 	}
+	if err := config.DeviceClient.ValidateSettings(); err != nil {
+		return nil, fmt.Errorf("invalid device_client in '%s': %w", configFilePath, err)
+	}
+	if err := config.DeviceClient.ValidateNetwork(); err != nil {
+		return nil, fmt.Errorf("invalid device_client in '%s': %w", configFilePath, err)
+	}
+	if err := config.DeviceClient.RateLimit.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid device_client.rate_limit in '%s': %w", configFilePath, err)
+	}
+	if err := ValidateDiscoveryNetworks(config.Discovery.Networks); err != nil {
+		return nil, fmt.Errorf("invalid discovery.networks in '%s': %w", configFilePath, err)
+	}
+	if err := config.Auth.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid auth in '%s': %w", configFilePath, err)
+	}
+	switch config.Metrics.WebSocketDropPolicy {
+	case "drop_oldest", "drop_newest", "disconnect":
+	default:
+		return nil, fmt.Errorf("invalid metrics.websocket_drop_policy in '%s': %q is not drop_oldest, drop_newest or disconnect", configFilePath, config.Metrics.WebSocketDropPolicy)
+	}
 
 	return &config, nil
 }
@@ -232,6 +367,8 @@ func setDefaults() {
 	viper.SetDefault("database.conn_max_idle_time", 600) // 10 minutes
 	viper.SetDefault("database.slow_query_time", 500)    // 500ms
 	viper.SetDefault("database.log_level", "warn")
+	viper.SetDefault("database.encryption_key", "")
+	viper.SetDefault("database.previous_encryption_keys", []string{})
 	viper.SetDefault("database.options", map[string]string{
 		"foreign_keys": "true",
 		"journal_mode": "WAL",
@@ -246,6 +383,7 @@ func setDefaults() {
 	viper.SetDefault("discovery.interval", 300)
 	viper.SetDefault("discovery.timeout", 5)
 	viper.SetDefault("discovery.enable_mdns", true)
+	viper.SetDefault("discovery.new_device_alerts", false)
 	viper.SetDefault("discovery.enable_ssdp", true)
 	viper.SetDefault("discovery.concurrent_scans", 20)
 
@@ -257,6 +395,22 @@ func setDefaults() {
 	viper.SetDefault("provisioning.device_name_pattern", "shelly_{type}_{mac}")
 	viper.SetDefault("provisioning.auto_provision", false)
 	viper.SetDefault("provisioning.provision_interval", 600)
+	viper.SetDefault("provisioning.verification.enabled", true)
+	viper.SetDefault("provisioning.verification.timeout", DefaultProvisioningVerifyTimeout)
+	viper.SetDefault("provisioning.verification.interval", DefaultProvisioningVerifyInterval)
+
+	// Device client defaults
+	viper.SetDefault("device_client.timeout", DefaultDeviceTimeout)
+	viper.SetDefault("device_client.retry_attempts", DefaultDeviceRetryAttempts)
+	viper.SetDefault("device_client.retry_delay", DefaultDeviceRetryDelay)
+	viper.SetDefault("device_client.control_timeout", DefaultDeviceControlTimeout)
+	viper.SetDefault("device_client.import_timeout", DefaultDeviceImportTimeout)
+	viper.SetDefault("device_client.export_timeout", DefaultDeviceExportTimeout)
+	viper.SetDefault("device_client.provision_timeout", DefaultDeviceProvisionTimeout)
+	viper.SetDefault("device_client.user_agent", "")
+	viper.SetDefault("device_client.source_ip", "")
+	viper.SetDefault("device_client.interface", "")
+	viper.SetDefault("device_client.proxy", "")
 
 	// DHCP defaults
 	viper.SetDefault("dhcp.network", "192.168.1.0/24")
@@ -288,9 +442,23 @@ func setDefaults() {
 	viper.SetDefault("metrics.retention_days", 30)
 	viper.SetDefault("metrics.enable_http_metrics", true)
 	viper.SetDefault("metrics.enable_detailed_timing", false)
+	viper.SetDefault("metrics.clock_skew_check", false)
+	viper.SetDefault("metrics.clock_skew_threshold", 30)
+	viper.SetDefault("metrics.clock_skew_sntp_server", "pool.ntp.org")
+	viper.SetDefault("metrics.reboot_check", false)
+	viper.SetDefault("metrics.reboot_threshold", 3)
+	viper.SetDefault("metrics.latency_check", false)
+	viper.SetDefault("metrics.latency_slow_threshold", 1000)
+	viper.SetDefault("metrics.latency_hourly_days", 7)
+	viper.SetDefault("metrics.energy_hourly_days", 90)
+	viper.SetDefault("metrics.websocket_queue_size", 256)
+	viper.SetDefault("metrics.websocket_drop_policy", "drop_oldest")
+	viper.SetDefault("metrics.websocket_max_drops", 100)
+	viper.SetDefault("metrics.websocket_resume_window", 120)
 
 	// Notification defaults
 	viper.SetDefault("notifications.enabled", true)
+	viper.SetDefault("notifications.health_check_interval", 300)
 	viper.SetDefault("notifications.thresholds.critical_drift_count", 5)
 	viper.SetDefault("notifications.thresholds.warning_drift_count", 10)
 	viper.SetDefault("notifications.thresholds.max_per_hour", 20)
@@ -302,17 +470,105 @@ func setDefaults() {
 	viper.SetDefault("resolution.auto_fix_categories", []string{"network", "time"})
 	viper.SetDefault("resolution.excluded_paths", []string{"/debug", "/test"})
 
+	// Integrity check defaults: report rows of deleted devices daily, delete nothing
+	viper.SetDefault("integrity.enabled", true)
+	viper.SetDefault("integrity.interval", 24)
+	viper.SetDefault("integrity.cleanup", false)
+
+	// Identity check defaults: off; when enabled, follow moved devices hourly
+	viper.SetDefault("identity.enabled", false)
+	viper.SetDefault("identity.interval", DefaultIdentityInterval)
+	viper.SetDefault("identity.auto_fix", true)
+
+	// Shelly Cloud defaults: no account; when syncing, push names and rooms
+	viper.SetDefault("shelly_cloud.server", "")
+	viper.SetDefault("shelly_cloud.auth_key", "")
+	viper.SetDefault("shelly_cloud.sync_enabled", false)
+	viper.SetDefault("shelly_cloud.sync_interval", DefaultShellyCloudSyncInterval)
+	viper.SetDefault("shelly_cloud.sync_names", true)
+	viper.SetDefault("shelly_cloud.sync_rooms", true)
+
+	// Bulk confirmation defaults: confirm operations on more than 10 devices
+	viper.SetDefault("bulk_confirmation.threshold", DefaultBulkConfirmationThreshold)
+	viper.SetDefault("bulk_confirmation.ttl", DefaultBulkConfirmationTTL)
+
+	// Change approval defaults: off; when on, every gated change needs approval
+	viper.SetDefault("change_approval.enabled", false)
+	viper.SetDefault("change_approval.min_devices", DefaultChangeApprovalMinDevices)
+	viper.SetDefault("change_approval.ttl", DefaultChangeApprovalTTL)
+
+	// Operation hook defaults
+	viper.SetDefault("hooks.timeout", DefaultHookTimeout)
+
+	// Device proxy defaults: read-only pages, nothing that changes a device
+	viper.SetDefault("device_proxy.enabled", true)
+	viper.SetDefault("device_proxy.max_response_size", DefaultProxyMaxResponseSize)
+
+	// Gen1 compatibility defaults: off until legacy tooling needs it
+	viper.SetDefault("compat.enabled", false)
+
+	// Single sign-on defaults: off; anonymous requests keep today's access
+	viper.SetDefault("auth.oidc.enabled", false)
+	viper.SetDefault("auth.oidc.scopes", []string{"openid", "profile", "email"})
+	viper.SetDefault("auth.oidc.groups_claim", DefaultOIDCGroupsClaim)
+	viper.SetDefault("auth.oidc.username_claim", DefaultOIDCUsernameClaim)
+	viper.SetDefault("auth.session_ttl", DefaultAuthSessionTTL)
+	viper.SetDefault("auth.session_cookie", DefaultAuthSessionCookie)
+
+	// Device WebSocket defaults: off until the manager's URL is configured
+	viper.SetDefault("device_socket.enabled", false)
+
+	// Enrollment defaults: off until the manager's URL is configured
+	viper.SetDefault("enrollment.enabled", false)
+	viper.SetDefault("enrollment.token_ttl", DefaultEnrollmentTokenTTL)
+
+	// Device log defaults: off until the collector address is configured
+	viper.SetDefault("device_logs.enabled", false)
+	viper.SetDefault("device_logs.listen", DefaultDeviceLogsListen)
+	viper.SetDefault("device_logs.retention", DefaultDeviceLogsRetention)
+	viper.SetDefault("device_logs.max_entries", DefaultDeviceLogsMaxEntries)
+
+	// Export signing defaults: off until a key is set; then unsigned
+	// artifacts are refused on import
+	viper.SetDefault("export.signing.algorithm", "hmac-sha256")
+	viper.SetDefault("export.signing.require_signature", true)
+	viper.SetDefault("export.lifecycle.enabled", false)
+	viper.SetDefault("export.lifecycle.local_days", 30)
+	viper.SetDefault("export.lifecycle.retention_days", 365)
+	viper.SetDefault("export.lifecycle.interval", DefaultExportLifecycleInterval)
+	viper.SetDefault("export.lifecycle.object_storage.region", DefaultObjectStorageRegion)
+
+	// Asset defaults: check warranties daily and notify 30 days ahead
+	viper.SetDefault("assets.warranty_checks", true)
+	viper.SetDefault("assets.interval", DefaultWarrantyCheckInterval)
+	viper.SetDefault("assets.notice_days", DefaultWarrantyNoticeDays)
+
+	// Power budget defaults: check group limits every 15 seconds
+	viper.SetDefault("power_budgets.enabled", true)
+	viper.SetDefault("power_budgets.interval", DefaultPowerBudgetInterval)
+
+	// Outage defaults: 5 devices and 30% of the fleet offline within 5
+	// minutes is an outage
+	viper.SetDefault("outage.enabled", true)
+	viper.SetDefault("outage.min_devices", DefaultOutageMinDevices)
+	viper.SetDefault("outage.percent", DefaultOutagePercent)
+	viper.SetDefault("outage.window", DefaultOutageWindow)
+	viper.SetDefault("outage.recovered_percent", DefaultOutageRecoveredPercent)
+	viper.SetDefault("outage.probe_delay", DefaultOutageProbeDelay)
+
 	// Security defaults
 	viper.SetDefault("security.use_proxy_headers", false)
 	viper.SetDefault("security.trusted_proxies", []string{})
 	viper.SetDefault("security.cors.allowed_origins", []string{}) // empty => *
-	viper.SetDefault("security.cors.allowed_methods", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"})
-	viper.SetDefault("security.cors.allowed_headers", []string{"Content-Type", "Authorization", "X-Requested-With"})
+	viper.SetDefault("security.cors.allowed_methods", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	viper.SetDefault("security.cors.allowed_headers", []string{"Content-Type", "Authorization", "X-Requested-With", "Idempotency-Key", "X-Request-ID", "X-Confirmation-Token", "X-Change-Request", "X-User-ID"})
 	viper.SetDefault("security.cors.max_age", 86400)
 	// Admin API key disabled by default (empty)
 	viper.SetDefault("security.admin_api_key", "")
 	// Validation test mode disabled by default (security validations enabled)
 	viper.SetDefault("security.validation_test_mode", false)
+	// Idempotency-Key responses are replayed for 24 hours
+	viper.SetDefault("security.idempotency_ttl", 86400)
 
 	// Export defaults
 	viper.SetDefault("export.output_directory", "")
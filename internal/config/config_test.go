@@ -113,8 +113,8 @@ main_app:
 		t.Errorf("Expected %d networks, got %d", len(expectedNetworks), len(config.Discovery.Networks))
 	}
 	for i, network := range expectedNetworks {
-		if config.Discovery.Networks[i] != network {
-			t.Errorf("Expected network %s, got %s", network, config.Discovery.Networks[i])
+		if config.Discovery.Networks[i].CIDR != network {
+			t.Errorf("Expected network %s, got %s", network, config.Discovery.Networks[i].CIDR)
 		}
 	}
 	if config.Discovery.Interval != 600 {
@@ -305,8 +305,8 @@ server:
 	if len(config.Discovery.Networks) != len(expectedDefaultNetworks) {
 		t.Errorf("Expected %d default networks, got %d", len(expectedDefaultNetworks), len(config.Discovery.Networks))
 	}
-	if config.Discovery.Networks[0] != expectedDefaultNetworks[0] {
-		t.Errorf("Expected default network %s, got %s", expectedDefaultNetworks[0], config.Discovery.Networks[0])
+	if config.Discovery.Networks[0].CIDR != expectedDefaultNetworks[0] {
+		t.Errorf("Expected default network %s, got %s", expectedDefaultNetworks[0], config.Discovery.Networks[0].CIDR)
 	}
 	if config.Discovery.Interval != 300 {
 		t.Errorf("Expected default discovery interval 300, got %d", config.Discovery.Interval)
@@ -458,8 +458,8 @@ discovery:
 		t.Errorf("Expected %d networks, got %d", len(expectedNetworks), len(config.Discovery.Networks))
 	}
 	for i, network := range expectedNetworks {
-		if config.Discovery.Networks[i] != network {
-			t.Errorf("Expected network %s, got %s", network, config.Discovery.Networks[i])
+		if config.Discovery.Networks[i].CIDR != network {
+			t.Errorf("Expected network %s, got %s", network, config.Discovery.Networks[i].CIDR)
 		}
 	}
 
@@ -548,8 +548,8 @@ func TestSetDefaults(t *testing.T) {
 		t.Errorf("Expected %d default networks, got %d", len(expectedDefaultNetworks), len(config.Discovery.Networks))
 	}
 	for i, network := range expectedDefaultNetworks {
-		if config.Discovery.Networks[i] != network {
-			t.Errorf("Expected default network %s, got %s", network, config.Discovery.Networks[i])
+		if config.Discovery.Networks[i].CIDR != network {
+			t.Errorf("Expected default network %s, got %s", network, config.Discovery.Networks[i].CIDR)
 		}
 	}
 }
@@ -569,3 +569,48 @@ func containsAt(s, substr string) bool {
 	}
 	return false
 }
+
+func TestLoad_DiscoveryNetworks(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "discovery.yaml")
+
+	configContent := `discovery:
+  networks:
+    - "192.168.1.0/24"
+    - cidr: "10.20.0.0/24"
+      interval: 3600
+      scanners: ["http"]
+      site: "branch"
+      exclude:
+        networks: ["10.20.0.250-10.20.0.254"]
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	networks := cfg.Discovery.Networks
+	if len(networks) != 2 || networks[0].CIDR != "192.168.1.0/24" || !networks[0].UsesScanner(DiscoveryScannerMDNS) {
+		t.Fatalf("Expected the bare CIDR kept with default options, got %+v", networks)
+	}
+	if n := networks[1]; n.Interval != 3600 || n.Site != "branch" || n.UsesScanner(DiscoveryScannerMDNS) || len(n.Exclude.Networks) != 1 {
+		t.Errorf("Unexpected network options: %+v", n)
+	}
+
+	invalid := []string{
+		"discovery:\n  networks: [\"10.0.0.0\"]\n",
+		"discovery:\n  networks:\n    - cidr: \"10.0.0.0/24\"\n      scanners: [\"ssdp\"]\n",
+		"discovery:\n  networks: [\"10.0.0.0/24\", \"10.0.0.7/24\"]\n",
+	}
+	for _, content := range invalid {
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		if _, err := Load(configPath); err == nil {
+			t.Errorf("Expected the configuration refused:\n%s", content)
+		}
+	}
+}
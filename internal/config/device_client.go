@@ -0,0 +1,265 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DeviceClientSettings holds HTTP timeout and retry settings used when talking to devices.
+// Unset (nil) fields mean "inherit" when used as an override; a set field
+// applies even when zero, so retry_attempts: 0 disables retries.
+type DeviceClientSettings struct {
+	Timeout          *int `mapstructure:"timeout" json:"timeout,omitempty"`                     // per-request HTTP timeout (seconds)
+	RetryAttempts    *int `mapstructure:"retry_attempts" json:"retry_attempts,omitempty"`       // retries after the first attempt
+	RetryDelay       *int `mapstructure:"retry_delay" json:"retry_delay,omitempty"`             // delay between retries (milliseconds)
+	ControlTimeout   *int `mapstructure:"control_timeout" json:"control_timeout,omitempty"`     // control commands (seconds)
+	ImportTimeout    *int `mapstructure:"import_timeout" json:"import_timeout,omitempty"`       // configuration import (seconds)
+	ExportTimeout    *int `mapstructure:"export_timeout" json:"export_timeout,omitempty"`       // configuration export (seconds)
+	ProvisionTimeout *int `mapstructure:"provision_timeout" json:"provision_timeout,omitempty"` // provisioning run (seconds)
+}
+
+// IntPtr returns a pointer to v, for setting DeviceClientSettings fields
+func IntPtr(v int) *int {
+	return &v
+}
+
+// DeviceClientOverride applies settings to a class of devices.
+// A device matches when every non-empty selector matches.
+type DeviceClientOverride struct {
+	Name       string   `mapstructure:"name"`
+	Models     []string `mapstructure:"models"`     // case-insensitive model prefixes, e.g. "SPSW-", "SHSW-1"
+	Generation int      `mapstructure:"generation"` // 0 matches any generation
+
+	DeviceClientSettings `mapstructure:",squash"`
+}
+
+// DeviceClientConfig holds the global defaults and per-class overrides
+type DeviceClientConfig struct {
+	DeviceClientSettings `mapstructure:",squash"`
+	Overrides            []DeviceClientOverride `mapstructure:"overrides"`
+
+	// Identity and route of outbound device requests, including discovery
+	// probes. They apply to every device.
+	UserAgent string `mapstructure:"user_agent"` // empty keeps "shelly-manager/1.0"
+	SourceIP  string `mapstructure:"source_ip"`  // local address to send from
+	Interface string `mapstructure:"interface"`  // send from this interface's address instead
+	Proxy     string `mapstructure:"proxy"`      // http://, https://, socks5:// or socks5h:// URL
+
+	// RateLimit budgets device requests per network
+	RateLimit DeviceRateLimitConfig `mapstructure:"rate_limit"`
+}
+
+// ValidateSettings checks the global settings and those of every override
+func (c DeviceClientConfig) ValidateSettings() error {
+	if err := c.DeviceClientSettings.Validate(); err != nil {
+		return err
+	}
+	for _, o := range c.Overrides {
+		if err := o.DeviceClientSettings.Validate(); err != nil {
+			return fmt.Errorf("override %q: %w", o.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that set timeouts are positive and set retry values are
+// not negative
+func (s DeviceClientSettings) Validate() error {
+	for _, f := range s.fields() {
+		if *f.value != nil && !f.valid(**f.value) {
+			if f.timeout {
+				return fmt.Errorf("%s must be positive, got %d", f.name, **f.value)
+			}
+			return fmt.Errorf("%s must not be negative, got %d", f.name, **f.value)
+		}
+	}
+	return nil
+}
+
+// ValidOnly returns a copy of s with invalid fields unset, so they inherit.
+// Per-device settings are not checked at startup and go through it.
+func (s DeviceClientSettings) ValidOnly() DeviceClientSettings {
+	for _, f := range s.fields() {
+		if *f.value != nil && !f.valid(**f.value) {
+			*f.value = nil
+		}
+	}
+	return s
+}
+
+// deviceClientField is one setting of DeviceClientSettings
+type deviceClientField struct {
+	name    string
+	value   **int
+	timeout bool // timeouts must be positive, retry values not negative
+}
+
+func (f deviceClientField) valid(v int) bool {
+	if f.timeout {
+		return v > 0
+	}
+	return v >= 0
+}
+
+// fields lists the settings of s in a stable order
+func (s *DeviceClientSettings) fields() []deviceClientField {
+	return []deviceClientField{
+		{"timeout", &s.Timeout, true},
+		{"retry_attempts", &s.RetryAttempts, false},
+		{"retry_delay", &s.RetryDelay, false},
+		{"control_timeout", &s.ControlTimeout, true},
+		{"import_timeout", &s.ImportTimeout, true},
+		{"export_timeout", &s.ExportTimeout, true},
+		{"provision_timeout", &s.ProvisionTimeout, true},
+	}
+}
+
+// ValidateNetwork checks the source address, interface and proxy settings
+func (c DeviceClientConfig) ValidateNetwork() error {
+	if c.SourceIP != "" && c.Interface != "" {
+		return fmt.Errorf("source_ip and interface are mutually exclusive")
+	}
+	if c.SourceIP != "" && net.ParseIP(c.SourceIP) == nil {
+		return fmt.Errorf("invalid source_ip %q", c.SourceIP)
+	}
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("invalid proxy %q: scheme must be http, https, socks5 or socks5h", c.Proxy)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("invalid proxy %q: missing host", c.Proxy)
+		}
+	}
+	return nil
+}
+
+// Built-in defaults matching the previously hardcoded values
+const (
+	DefaultDeviceTimeout          = 10
+	DefaultDeviceRetryAttempts    = 3
+	DefaultDeviceRetryDelay       = 1000
+	DefaultDeviceControlTimeout   = 10
+	DefaultDeviceImportTimeout    = 15
+	DefaultDeviceExportTimeout    = 30
+	DefaultDeviceProvisionTimeout = 600
+)
+
+// Matches reports whether the override applies to a device with the given model and generation
+func (o DeviceClientOverride) Matches(model string, generation int) bool {
+	if o.Generation != 0 && o.Generation != generation {
+		return false
+	}
+	if len(o.Models) == 0 {
+		return o.Generation != 0
+	}
+	model = strings.ToLower(model)
+	for _, prefix := range o.Models {
+		if prefix != "" && strings.HasPrefix(model, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the effective settings for a device class, applying matching
+// overrides in order on top of the global defaults.
+func (c DeviceClientConfig) Resolve(model string, generation int) DeviceClientSettings {
+	settings := c.DeviceClientSettings.withDefaults()
+	for _, o := range c.Overrides {
+		if o.Matches(model, generation) {
+			settings = settings.Merge(o.DeviceClientSettings)
+		}
+	}
+	return settings
+}
+
+// Merge returns a copy of s with every set field of override applied
+func (s DeviceClientSettings) Merge(override DeviceClientSettings) DeviceClientSettings {
+	if override.Timeout != nil {
+		s.Timeout = override.Timeout
+	}
+	if override.RetryAttempts != nil {
+		s.RetryAttempts = override.RetryAttempts
+	}
+	if override.RetryDelay != nil {
+		s.RetryDelay = override.RetryDelay
+	}
+	if override.ControlTimeout != nil {
+		s.ControlTimeout = override.ControlTimeout
+	}
+	if override.ImportTimeout != nil {
+		s.ImportTimeout = override.ImportTimeout
+	}
+	if override.ExportTimeout != nil {
+		s.ExportTimeout = override.ExportTimeout
+	}
+	if override.ProvisionTimeout != nil {
+		s.ProvisionTimeout = override.ProvisionTimeout
+	}
+	return s
+}
+
+// withDefaults fills unset fields with the built-in defaults
+func (s DeviceClientSettings) withDefaults() DeviceClientSettings {
+	return DeviceClientSettings{
+		Timeout:          IntPtr(DefaultDeviceTimeout),
+		RetryAttempts:    IntPtr(DefaultDeviceRetryAttempts),
+		RetryDelay:       IntPtr(DefaultDeviceRetryDelay),
+		ControlTimeout:   IntPtr(DefaultDeviceControlTimeout),
+		ImportTimeout:    IntPtr(DefaultDeviceImportTimeout),
+		ExportTimeout:    IntPtr(DefaultDeviceExportTimeout),
+		ProvisionTimeout: IntPtr(DefaultDeviceProvisionTimeout),
+	}.Merge(s)
+}
+
+// settingOr returns a set value, or def when unset
+func settingOr(v *int, def int) int {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+// Retries returns the number of retries after the first attempt
+func (s DeviceClientSettings) Retries() int {
+	return settingOr(s.RetryAttempts, DefaultDeviceRetryAttempts)
+}
+
+// RequestTimeout returns the per-request HTTP timeout
+func (s DeviceClientSettings) RequestTimeout() time.Duration {
+	return time.Duration(settingOr(s.Timeout, DefaultDeviceTimeout)) * time.Second
+}
+
+// RetryDelayDuration returns the delay between retries
+func (s DeviceClientSettings) RetryDelayDuration() time.Duration {
+	return time.Duration(settingOr(s.RetryDelay, DefaultDeviceRetryDelay)) * time.Millisecond
+}
+
+// ControlTimeoutDuration returns the deadline for control commands
+func (s DeviceClientSettings) ControlTimeoutDuration() time.Duration {
+	return time.Duration(settingOr(s.ControlTimeout, DefaultDeviceControlTimeout)) * time.Second
+}
+
+// ImportTimeoutDuration returns the deadline for configuration imports
+func (s DeviceClientSettings) ImportTimeoutDuration() time.Duration {
+	return time.Duration(settingOr(s.ImportTimeout, DefaultDeviceImportTimeout)) * time.Second
+}
+
+// ExportTimeoutDuration returns the deadline for configuration exports
+func (s DeviceClientSettings) ExportTimeoutDuration() time.Duration {
+	return time.Duration(settingOr(s.ExportTimeout, DefaultDeviceExportTimeout)) * time.Second
+}
+
+// ProvisionTimeoutDuration returns the deadline for a provisioning run
+func (s DeviceClientSettings) ProvisionTimeoutDuration() time.Duration {
+	return time.Duration(settingOr(s.ProvisionTimeout, DefaultDeviceProvisionTimeout)) * time.Second
+}
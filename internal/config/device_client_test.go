@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeviceClientConfig_ResolveDefaults(t *testing.T) {
+	var cfg DeviceClientConfig
+
+	settings := cfg.Resolve("SHSW-1", 1)
+
+	if settings.RequestTimeout() != 10*time.Second {
+		t.Errorf("Expected default request timeout 10s, got %v", settings.RequestTimeout())
+	}
+	if settings.ImportTimeoutDuration() != 15*time.Second {
+		t.Errorf("Expected default import timeout 15s, got %v", settings.ImportTimeoutDuration())
+	}
+	if settings.ExportTimeoutDuration() != 30*time.Second {
+		t.Errorf("Expected default export timeout 30s, got %v", settings.ExportTimeoutDuration())
+	}
+	if settings.ProvisionTimeoutDuration() != 10*time.Minute {
+		t.Errorf("Expected default provision timeout 10m, got %v", settings.ProvisionTimeoutDuration())
+	}
+	if settings.Retries() != 3 || settings.RetryDelayDuration() != time.Second {
+		t.Errorf("Unexpected default retry settings: %d attempts, %v delay", settings.Retries(), settings.RetryDelayDuration())
+	}
+}
+
+func TestDeviceClientConfig_ResolveOverrides(t *testing.T) {
+	cfg := DeviceClientConfig{
+		DeviceClientSettings: DeviceClientSettings{Timeout: IntPtr(8)},
+		Overrides: []DeviceClientOverride{
+			{Name: "slow-wifi", Models: []string{"shsw-"}, DeviceClientSettings: DeviceClientSettings{Timeout: IntPtr(20), RetryAttempts: IntPtr(5)}},
+			{Name: "gen1", Generation: 1, DeviceClientSettings: DeviceClientSettings{ImportTimeout: IntPtr(40)}},
+			{Name: "pro", Models: []string{"SPSW-"}, Generation: 2, DeviceClientSettings: DeviceClientSettings{Timeout: IntPtr(3), RetryAttempts: IntPtr(0), RetryDelay: IntPtr(0)}},
+			{Name: "empty-selector", DeviceClientSettings: DeviceClientSettings{Timeout: IntPtr(99)}},
+		},
+	}
+
+	gen1 := cfg.Resolve("SHSW-25", 1)
+	if gen1.RequestTimeout() != 20*time.Second || gen1.Retries() != 5 || gen1.ImportTimeoutDuration() != 40*time.Second {
+		t.Errorf("Unexpected Gen1 settings: %+v", gen1)
+	}
+
+	// Explicit zeros override: the Pro class is not retried
+	pro := cfg.Resolve("SPSW-201XE16EU", 2)
+	if pro.RequestTimeout() != 3*time.Second || pro.ImportTimeoutDuration() != DefaultDeviceImportTimeout*time.Second {
+		t.Errorf("Unexpected Pro settings: %+v", pro)
+	}
+	if pro.Retries() != 0 || pro.RetryDelayDuration() != 0 {
+		t.Errorf("Expected retries disabled for Pro, got %d attempts, %v delay", pro.Retries(), pro.RetryDelayDuration())
+	}
+
+	other := cfg.Resolve("SNSW-001X16EU", 2)
+	if other.RequestTimeout() != 8*time.Second {
+		t.Errorf("Expected global timeout 8s for unmatched device, got %v", other.RequestTimeout())
+	}
+
+	device := other.Merge(DeviceClientSettings{ControlTimeout: IntPtr(25), RetryAttempts: IntPtr(0)})
+	if device.ControlTimeoutDuration() != 25*time.Second || device.RequestTimeout() != 8*time.Second || device.Retries() != 0 {
+		t.Errorf("Unexpected per-device merge result: %+v", device)
+	}
+}
+
+func TestDeviceClientConfig_ValidateSettings(t *testing.T) {
+	valid := DeviceClientConfig{
+		DeviceClientSettings: DeviceClientSettings{RetryAttempts: IntPtr(0), RetryDelay: IntPtr(0)},
+		Overrides:            []DeviceClientOverride{{Name: "plugs", DeviceClientSettings: DeviceClientSettings{Timeout: IntPtr(5)}}},
+	}
+	if err := valid.ValidateSettings(); err != nil {
+		t.Errorf("Expected %+v to be valid, got %v", valid, err)
+	}
+	invalid := []DeviceClientConfig{
+		{DeviceClientSettings: DeviceClientSettings{Timeout: IntPtr(0)}},
+		{DeviceClientSettings: DeviceClientSettings{RetryAttempts: IntPtr(-1)}},
+		{Overrides: []DeviceClientOverride{{Name: "plugs", DeviceClientSettings: DeviceClientSettings{ImportTimeout: IntPtr(0)}}}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.ValidateSettings(); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestLoad_DeviceClientOverrides(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "device_client.yaml")
+
+	configContent := `device_client:
+  timeout: 12
+  import_timeout: 20
+  overrides:
+    - name: "plugs"
+      models: ["SHPLG-"]
+      timeout: 25
+      retry_attempts: 6
+    - name: "pro"
+      models: ["SPSW-"]
+      retry_attempts: 0
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	global := cfg.DeviceClient.DeviceClientSettings
+	if global.RequestTimeout() != 12*time.Second || global.ExportTimeoutDuration() != DefaultDeviceExportTimeout*time.Second {
+		t.Errorf("Unexpected device client defaults: %+v", global)
+	}
+	if len(cfg.DeviceClient.Overrides) != 2 {
+		t.Fatalf("Expected 2 overrides, got %d", len(cfg.DeviceClient.Overrides))
+	}
+
+	settings := cfg.DeviceClient.Resolve("SHPLG-S", 1)
+	if settings.RequestTimeout() != 25*time.Second || settings.Retries() != 6 || settings.ImportTimeoutDuration() != 20*time.Second {
+		t.Errorf("Unexpected resolved settings: %+v", settings)
+	}
+
+	// An override that omits a field inherits it; one that sets zero applies it
+	pro := cfg.DeviceClient.Resolve("SPSW-201", 2)
+	if pro.Retries() != 0 || pro.RequestTimeout() != 12*time.Second {
+		t.Errorf("Unexpected Pro settings: %d retries, %v timeout", pro.Retries(), pro.RequestTimeout())
+	}
+}
+
+func TestDeviceClientConfig_ValidateNetwork(t *testing.T) {
+	valid := []DeviceClientConfig{
+		{},
+		{SourceIP: "10.0.5.2", Proxy: "socks5h://jump-host:1080"},
+		{Interface: "eth1", UserAgent: "fleet-probe/2"},
+	}
+	for _, cfg := range valid {
+		if err := cfg.ValidateNetwork(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", cfg, err)
+		}
+	}
+	invalid := []DeviceClientConfig{
+		{SourceIP: "10.0.5"},
+		{SourceIP: "10.0.5.2", Interface: "eth1"},
+		{Proxy: "jump-host:1080"},
+		{Proxy: "ftp://jump-host"},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.ValidateNetwork(); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
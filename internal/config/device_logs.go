@@ -0,0 +1,42 @@
+package config
+
+import "time"
+
+// Device log defaults
+const (
+	DefaultDeviceLogsListen     = ":5514"
+	DefaultDeviceLogsRetention  = 72    // hours
+	DefaultDeviceLogsMaxEntries = 10000 // per device
+)
+
+// DeviceLogsConfig controls the collection of Gen2 device debug logs. Devices
+// with streaming enabled send their log lines over UDP (Sys.SetConfig
+// debug.udp) to Address, which the manager listens on at Listen.
+type DeviceLogsConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// Listen is the UDP address the collector binds to
+	Listen string `mapstructure:"listen" json:"listen,omitempty"`
+	// Address is the collector as devices reach it, host:port
+	Address string `mapstructure:"address" json:"address,omitempty"`
+	// Retention is how long log lines are kept, in hours
+	Retention int `mapstructure:"retention" json:"retention,omitempty"`
+	// MaxEntries caps the log lines kept per device
+	MaxEntries int `mapstructure:"max_entries" json:"max_entries,omitempty"`
+}
+
+// RetentionDuration returns how long log lines are kept, falling back to
+// the default
+func (c DeviceLogsConfig) RetentionDuration() time.Duration {
+	if c.Retention <= 0 {
+		return DefaultDeviceLogsRetention * time.Hour
+	}
+	return time.Duration(c.Retention) * time.Hour
+}
+
+// MaxEntriesPerDevice returns the per-device cap, falling back to the default
+func (c DeviceLogsConfig) MaxEntriesPerDevice() int {
+	if c.MaxEntries <= 0 {
+		return DefaultDeviceLogsMaxEntries
+	}
+	return c.MaxEntries
+}
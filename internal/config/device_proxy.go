@@ -0,0 +1,77 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultProxyMaxResponseSize caps a proxied device response
+const DefaultProxyMaxResponseSize = 8 << 20 // bytes
+
+// DefaultProxyReadPaths are the device paths the proxy forwards GET requests
+// to unless configured otherwise: device info, status, settings and debug
+// pages. None of them change the device.
+var DefaultProxyReadPaths = []string{
+	"/shelly",
+	"/status",
+	"/settings",
+	"/debug/*",
+	"/rpc/Shelly.GetDeviceInfo",
+	"/rpc/Shelly.GetStatus",
+	"/rpc/Shelly.GetConfig",
+	"/rpc/Sys.GetStatus",
+}
+
+// DeviceProxyConfig controls GET/POST /api/v1/devices/{id}/proxy/*, which
+// lets the web UI reach pages hosted by a device through the server. Paths
+// ending in "*" match by prefix, other paths exactly.
+type DeviceProxyConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// ReadPaths are forwarded for GET; empty uses DefaultProxyReadPaths
+	ReadPaths []string `mapstructure:"read_paths" json:"read_paths,omitempty"`
+	// WritePaths are forwarded for POST, and for GET requests that change
+	// settings; none by default
+	WritePaths []string `mapstructure:"write_paths" json:"write_paths,omitempty"`
+	// MaxResponseSize caps a device response in bytes
+	MaxResponseSize int64 `mapstructure:"max_response_size" json:"max_response_size,omitempty"`
+}
+
+// Allows reports whether a request of method for path may be forwarded.
+// Gen1 devices change settings through GET requests with a query string, so
+// those need a write path.
+func (c DeviceProxyConfig) Allows(method, path, rawQuery string) bool {
+	write := method != http.MethodGet
+	if !write && rawQuery != "" && strings.HasPrefix(path, "/settings") {
+		write = true
+	}
+	if write {
+		return matchProxyPath(c.WritePaths, path)
+	}
+	paths := c.ReadPaths
+	if len(paths) == 0 {
+		paths = DefaultProxyReadPaths
+	}
+	return matchProxyPath(paths, path)
+}
+
+// MaxResponseBytes returns the response size cap, falling back to the
+// default
+func (c DeviceProxyConfig) MaxResponseBytes() int64 {
+	if c.MaxResponseSize <= 0 {
+		return DefaultProxyMaxResponseSize
+	}
+	return c.MaxResponseSize
+}
+
+func matchProxyPath(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package config
+
+import "net/url"
+
+// DeviceSocketConfig controls the outbound WebSocket that Gen2 devices open
+// to the manager (WS.SetConfig). Connected devices push their status over it
+// and receive control commands on the same connection.
+type DeviceSocketConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// URL is the manager's address as devices reach it, e.g.
+	// ws://manager.lan:8080/devices/ws
+	URL string `mapstructure:"url" json:"url,omitempty"`
+	// Token authenticates connecting devices and is added to URL as
+	// ?token=. Without a token a connection must come from the device's
+	// known IP address.
+	Token string `mapstructure:"token" json:"-"`
+}
+
+// DeviceURL returns the server address to configure on devices
+func (c DeviceSocketConfig) DeviceURL() string {
+	if c.Token == "" {
+		return c.URL
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return c.URL
+	}
+	q := u.Query()
+	q.Set("token", c.Token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
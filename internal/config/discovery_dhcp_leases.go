@@ -0,0 +1,34 @@
+package config
+
+// Router types DHCP leases can be read from
+const (
+	DHCPRouterOPNsense = "opnsense"
+	DHCPRouterOpenWrt  = "openwrt"  // ubus JSON-RPC, as used by LuCI
+	DHCPRouterMikroTik = "mikrotik" // RouterOS v7 REST API
+)
+
+// DiscoveryDHCPLeases lists the routers whose DHCP lease tables are read for
+// Shelly devices, so they can be probed by address where subnet scans are
+// not allowed
+type DiscoveryDHCPLeases struct {
+	Routers []DHCPLeaseRouter `mapstructure:"routers" json:"routers,omitempty"`
+	// ShellyOUIs are the MAC prefixes treated as Shelly devices besides
+	// lease hostnames starting with "shelly"; empty uses the built-in list
+	ShellyOUIs []string `mapstructure:"shelly_ouis" json:"shelly_ouis,omitempty"`
+}
+
+// DHCPLeaseRouter is a router to read DHCP leases from
+type DHCPLeaseRouter struct {
+	Name string `mapstructure:"name" json:"name"`
+	Type string `mapstructure:"type" json:"type"` // opnsense, openwrt or mikrotik
+	// URL is the base URL of the router, e.g. "https://192.168.1.1"
+	URL string `mapstructure:"url" json:"url"`
+	// Username and Password log in to OpenWrt and MikroTik
+	Username string `mapstructure:"username" json:"username,omitempty"`
+	Password string `mapstructure:"password" json:"-"`
+	// APIKey and APISecret authenticate to OPNsense
+	APIKey             string `mapstructure:"api_key" json:"-"`
+	APISecret          string `mapstructure:"api_secret" json:"-"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify" json:"insecure_skip_verify,omitempty"`
+	Timeout            int    `mapstructure:"timeout" json:"timeout,omitempty"` // seconds, 0 for 10
+}
@@ -0,0 +1,14 @@
+package config
+
+// DiscoveryExclude lists hosts that discovery must never probe, such as
+// printers, PLCs or IDS sensors that alert on scans
+type DiscoveryExclude struct {
+	// Networks holds CIDRs, single addresses or first-last ranges,
+	// e.g. "192.168.1.200-192.168.1.250"
+	Networks []string `mapstructure:"networks" json:"networks,omitempty"`
+	// MACPrefixes holds MAC or vendor (OUI) prefixes, e.g. "00:1B:A9"
+	MACPrefixes []string `mapstructure:"mac_prefixes" json:"mac_prefixes,omitempty"`
+	// Hostnames holds glob patterns matched against mDNS and reverse DNS
+	// names, e.g. "printer-*" or "*.ids.example.com"
+	Hostnames []string `mapstructure:"hostnames" json:"hostnames,omitempty"`
+}
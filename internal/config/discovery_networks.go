@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Discovery scanners a network can enable
+const (
+	DiscoveryScannerHTTP = "http" // probe every address of the network
+	DiscoveryScannerMDNS = "mdns" // keep devices announcing themselves over mDNS
+)
+
+// DiscoveryNetwork is a network discovery scans, with its own options.
+// In discovery.networks an entry is either a bare CIDR or a map with these
+// keys.
+type DiscoveryNetwork struct {
+	CIDR string `mapstructure:"cidr" json:"cidr"`
+	// Disabled keeps the network configured but out of scans
+	Disabled bool `mapstructure:"disabled" json:"disabled,omitempty"`
+	// Interval rescans the network every so many seconds; 0 scans it only
+	// on request
+	Interval int `mapstructure:"interval" json:"interval,omitempty"`
+	// Scanners lists the enabled scanners (http, mdns); empty enables all
+	Scanners []string `mapstructure:"scanners" json:"scanners,omitempty"`
+	// CredentialsProfile names the provisioning profile whose device
+	// credentials are stored for devices found on the network
+	CredentialsProfile string `mapstructure:"credentials_profile" json:"credentials_profile,omitempty"`
+	// Site tags devices found on the network with "site:<site>"
+	Site string `mapstructure:"site" json:"site,omitempty"`
+	// Exclude lists hosts of the network no scanner may probe, on top of
+	// discovery.exclude
+	Exclude DiscoveryExclude `mapstructure:"exclude" json:"exclude,omitempty"`
+}
+
+// UsesScanner reports whether the network enables a scanner
+func (n DiscoveryNetwork) UsesScanner(scanner string) bool {
+	if len(n.Scanners) == 0 {
+		return true
+	}
+	for _, s := range n.Scanners {
+		if s == scanner {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the CIDR, interval and scanners of a network
+func (n DiscoveryNetwork) Validate() error {
+	if _, _, err := net.ParseCIDR(n.CIDR); err != nil {
+		return fmt.Errorf("invalid network %q: expected a CIDR", n.CIDR)
+	}
+	if n.Interval < 0 {
+		return fmt.Errorf("network %s: interval must not be negative", n.CIDR)
+	}
+	for _, s := range n.Scanners {
+		if s != DiscoveryScannerHTTP && s != DiscoveryScannerMDNS {
+			return fmt.Errorf("network %s: unknown scanner %q (expected http or mdns)", n.CIDR, s)
+		}
+	}
+	if strings.ContainsAny(n.Site, " \t:") {
+		return fmt.Errorf("network %s: site %q must not contain spaces or colons", n.CIDR, n.Site)
+	}
+	return nil
+}
+
+// ValidateDiscoveryNetworks checks every network and that no CIDR is listed
+// twice
+func ValidateDiscoveryNetworks(networks []DiscoveryNetwork) error {
+	seen := make(map[string]bool, len(networks))
+	for _, n := range networks {
+		if err := n.Validate(); err != nil {
+			return err
+		}
+		key := DiscoveryNetworkKey(n.CIDR)
+		if seen[key] {
+			return fmt.Errorf("network %s is listed twice", n.CIDR)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// DiscoveryNetworkKey returns the canonical form of a CIDR, so
+// "10.0.0.1/24" and "10.0.0.0/24" name the same network
+func DiscoveryNetworkKey(cidr string) string {
+	if _, ipnet, err := net.ParseCIDR(cidr); err == nil {
+		return ipnet.String()
+	}
+	return cidr
+}
+
+// DiscoveryCIDRs returns the CIDRs of the enabled networks
+func DiscoveryCIDRs(networks []DiscoveryNetwork) []string {
+	var cidrs []string
+	for _, n := range networks {
+		if !n.Disabled {
+			cidrs = append(cidrs, n.CIDR)
+		}
+	}
+	return cidrs
+}
+
+// normalizeDiscoveryNetworks turns bare CIDRs in discovery.networks into
+// network maps, so flat lists from older configuration files keep working
+func normalizeDiscoveryNetworks() {
+	raw, ok := viper.Get("discovery.networks").([]interface{})
+	if !ok {
+		if list, isStrings := viper.Get("discovery.networks").([]string); isStrings {
+			for _, cidr := range list {
+				raw = append(raw, cidr)
+			}
+		} else {
+			return
+		}
+	}
+	networks := make([]interface{}, 0, len(raw))
+	for _, entry := range raw {
+		if cidr, isString := entry.(string); isString {
+			networks = append(networks, map[string]interface{}{"cidr": cidr})
+			continue
+		}
+		networks = append(networks, entry)
+	}
+	viper.Set("discovery.networks", networks)
+}
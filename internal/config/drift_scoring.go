@@ -0,0 +1,16 @@
+package config
+
+// DriftScoringConfig weights configuration paths when scoring drift. The
+// weights are checked before the built-in ones; the first matching path
+// decides the weight of a difference.
+type DriftScoringConfig struct {
+	Weights []DriftWeightConfig `mapstructure:"weights" json:"weights,omitempty"`
+}
+
+// DriftWeightConfig weights the differences under a configuration path.
+// A path covers its subtree; * matches within one key and ** any number of
+// keys, e.g. wifi.sta.ip, switch:*.name or **.pass.
+type DriftWeightConfig struct {
+	Path   string `mapstructure:"path" json:"path"`
+	Weight int    `mapstructure:"weight" json:"weight"` // 0-100
+}
@@ -0,0 +1,31 @@
+package config
+
+import "time"
+
+// Enrollment defaults
+const (
+	DefaultEnrollmentTokenTTL = 24 // hours
+)
+
+// EnrollmentConfig controls zero-touch enrollment. Provisioning tasks carry
+// a one-time token, and the provisioner installs a script on Gen2 and later
+// devices that presents it at URL once the device is on the target network.
+// The manager then adopts the device and applies its template.
+type EnrollmentConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// URL is the enrollment endpoint as devices reach it, e.g.
+	// http://manager.lan:8080/enroll
+	URL string `mapstructure:"url" json:"url,omitempty"`
+	// TokenTTL is how long a token can be used after its task was created,
+	// in hours
+	TokenTTL int `mapstructure:"token_ttl" json:"token_ttl,omitempty"`
+}
+
+// TokenTTLDuration returns how long tokens stay valid, falling back to the
+// default
+func (c EnrollmentConfig) TokenTTLDuration() time.Duration {
+	if c.TokenTTL <= 0 {
+		return DefaultEnrollmentTokenTTL * time.Hour
+	}
+	return time.Duration(c.TokenTTL) * time.Hour
+}
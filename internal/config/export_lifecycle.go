@@ -0,0 +1,70 @@
+package config
+
+import "time"
+
+// Defaults for export artifact lifecycle
+const (
+	DefaultExportLifecycleInterval = 60          // minutes
+	DefaultObjectStorageRegion     = "us-east-1" // region signed for S3-compatible stores
+)
+
+// ExportLifecycleConfig moves export and backup artifacts between storage
+// tiers: recent ones stay on local disk, older ones move to object storage
+// and those past retention are deleted
+type ExportLifecycleConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// LocalDays is how long artifacts stay on local disk before they move to
+	// object storage; 0 keeps them local
+	LocalDays int `mapstructure:"local_days" json:"local_days"`
+	// RetentionDays is how long artifacts are kept in any tier; 0 keeps them
+	RetentionDays int `mapstructure:"retention_days" json:"retention_days"`
+	// Interval is the time between lifecycle runs, in minutes
+	Interval int `mapstructure:"interval" json:"interval,omitempty"`
+	// ObjectStorage is the S3-compatible bucket older artifacts move to
+	ObjectStorage ObjectStorageConfig `mapstructure:"object_storage" json:"object_storage"`
+}
+
+// ObjectStorageConfig is an S3-compatible bucket (AWS S3, MinIO, Garage,
+// ...), addressed path-style
+type ObjectStorageConfig struct {
+	// Endpoint is the base URL of the store, e.g. https://s3.eu-west-1.amazonaws.com
+	Endpoint string `mapstructure:"endpoint" json:"endpoint,omitempty"`
+	Region   string `mapstructure:"region" json:"region,omitempty"`
+	Bucket   string `mapstructure:"bucket" json:"bucket,omitempty"`
+	// Prefix is prepended to every object key, e.g. "shelly-manager/"
+	Prefix    string `mapstructure:"prefix" json:"prefix,omitempty"`
+	AccessKey string `mapstructure:"access_key" json:"access_key,omitempty"`
+	// SecretKey signs requests. Prefer
+	// SHELLY_EXPORT_LIFECYCLE_OBJECT_STORAGE_SECRET_KEY(_FILE).
+	SecretKey string `mapstructure:"secret_key" json:"-"`
+}
+
+// Enabled reports whether an object store is configured
+func (c ObjectStorageConfig) Enabled() bool {
+	return c.Endpoint != "" && c.Bucket != ""
+}
+
+// LocalDuration returns how long artifacts stay local, 0 for ever
+func (c ExportLifecycleConfig) LocalDuration() time.Duration {
+	if c.LocalDays <= 0 {
+		return 0
+	}
+	return time.Duration(c.LocalDays) * 24 * time.Hour
+}
+
+// RetentionDuration returns how long artifacts are kept, 0 for ever
+func (c ExportLifecycleConfig) RetentionDuration() time.Duration {
+	if c.RetentionDays <= 0 {
+		return 0
+	}
+	return time.Duration(c.RetentionDays) * 24 * time.Hour
+}
+
+// IntervalDuration returns the time between lifecycle runs, falling back to
+// the default
+func (c ExportLifecycleConfig) IntervalDuration() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultExportLifecycleInterval * time.Minute
+	}
+	return time.Duration(c.Interval) * time.Minute
+}
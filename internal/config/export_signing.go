@@ -0,0 +1,22 @@
+package config
+
+// ExportSigningConfig signs backup and GitOps export artifacts and verifies
+// them before import. Signing is on when a key is set.
+type ExportSigningConfig struct {
+	// Algorithm is "hmac-sha256" (default) or "ed25519"
+	Algorithm string `mapstructure:"algorithm" json:"algorithm"`
+	// Key is the HMAC secret, or the base64 Ed25519 private key (seed or full
+	// key). Prefer SHELLY_EXPORT_SIGNING_KEY(_FILE).
+	Key string `mapstructure:"key" json:"-"`
+	// PublicKey is a base64 Ed25519 public key, for instances that only
+	// verify artifacts signed elsewhere
+	PublicKey string `mapstructure:"public_key" json:"public_key,omitempty"`
+	// RequireSignature refuses to import artifacts without a valid manifest;
+	// without it unsigned artifacts are imported with a warning
+	RequireSignature bool `mapstructure:"require_signature" json:"require_signature"`
+}
+
+// Enabled reports whether artifacts are signed or verified
+func (c ExportSigningConfig) Enabled() bool {
+	return c.Key != "" || c.PublicKey != ""
+}
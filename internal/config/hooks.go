@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+// DefaultHookTimeout is how long a webhook hook may take, in seconds
+const DefaultHookTimeout = 5
+
+// HooksConfig controls the operation hooks registered through the API
+type HooksConfig struct {
+	// Timeout bounds each webhook hook call, in seconds
+	Timeout int `mapstructure:"timeout" json:"timeout,omitempty"`
+}
+
+// TimeoutDuration returns the webhook hook timeout, falling back to the
+// default
+func (c HooksConfig) TimeoutDuration() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultHookTimeout * time.Second
+	}
+	return time.Duration(c.Timeout) * time.Second
+}
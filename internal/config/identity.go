@@ -0,0 +1,25 @@
+package config
+
+import "time"
+
+// DefaultIdentityInterval is how often device identities are verified
+const DefaultIdentityInterval = 60 // minutes
+
+// IdentityConfig controls the periodic check that stored device addresses
+// still reach the device with the stored MAC address
+type IdentityConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// Interval between checks in minutes
+	Interval int `mapstructure:"interval" json:"interval,omitempty"`
+	// AutoFix updates moved addresses and merges duplicate rows when the
+	// outcome is unambiguous; otherwise findings are only recorded
+	AutoFix bool `mapstructure:"auto_fix" json:"auto_fix"`
+}
+
+// IntervalDuration returns the check interval, falling back to the default
+func (c IdentityConfig) IntervalDuration() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultIdentityInterval * time.Minute
+	}
+	return time.Duration(c.Interval) * time.Minute
+}
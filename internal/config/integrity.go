@@ -0,0 +1,24 @@
+package config
+
+import "time"
+
+// DefaultIntegrityInterval is how often the integrity check runs
+const DefaultIntegrityInterval = 24 // hours
+
+// IntegrityConfig controls the periodic check for configs, history and other
+// rows that refer to deleted devices
+type IntegrityConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// Interval between checks in hours
+	Interval int `mapstructure:"interval" json:"interval,omitempty"`
+	// Cleanup deletes what the check finds; otherwise it is only reported
+	Cleanup bool `mapstructure:"cleanup" json:"cleanup"`
+}
+
+// IntervalDuration returns the check interval, falling back to the default
+func (c IntegrityConfig) IntervalDuration() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultIntegrityInterval * time.Hour
+	}
+	return time.Duration(c.Interval) * time.Hour
+}
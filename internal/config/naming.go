@@ -0,0 +1,19 @@
+package config
+
+// NamingConfig controls names generated for newly adopted or provisioned
+// devices and by bulk renames. An empty template keeps the built-in default
+// names ("Shelly-XXYYZZ" when provisioning, the device ID on discovery).
+type NamingConfig struct {
+	// Template uses {{var}} placeholders: site, room, model, model_short, type,
+	// gen, mac, mac_suffix, ip_last and seq,
+	// e.g. "{{site}}-{{room}}-{{model_short}}-{{seq}}"
+	Template string `mapstructure:"template" json:"template,omitempty"`
+	// Site is used when a device has no "site:<name>" tag
+	Site string `mapstructure:"site" json:"site,omitempty"`
+	// SeqWidth zero-pads {{seq}}, e.g. 2 renders 01, 02, ...
+	SeqWidth int `mapstructure:"seq_width" json:"seq_width,omitempty"`
+	// Lowercase lower-cases generated names
+	Lowercase bool `mapstructure:"lowercase" json:"lowercase,omitempty"`
+	// ModelAliases maps device models (case-insensitive) to short names for {{model_short}}
+	ModelAliases map[string]string `mapstructure:"model_aliases" json:"model_aliases,omitempty"`
+}
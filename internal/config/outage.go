@@ -0,0 +1,61 @@
+package config
+
+import "time"
+
+// Outage detection defaults
+const (
+	DefaultOutageMinDevices       = 5
+	DefaultOutagePercent          = 30
+	DefaultOutageWindow           = 300 // seconds
+	DefaultOutageRecoveredPercent = 90
+	DefaultOutageProbeDelay       = 500 // milliseconds
+)
+
+// OutageConfig detects outages such as a building-wide power cut: many
+// devices going offline at once. During an outage one event replaces the
+// individual offline alerts, and devices are polled one at a time while
+// they boot.
+type OutageConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// MinDevices and Percent of the fleet must go offline within Window
+	// (seconds) to declare an outage
+	MinDevices int `mapstructure:"min_devices" json:"min_devices,omitempty"`
+	Percent    int `mapstructure:"percent" json:"percent,omitempty"`
+	Window     int `mapstructure:"window" json:"window,omitempty"`
+	// RecoveredPercent of the devices lost in the outage must answer again
+	// to end it
+	RecoveredPercent int `mapstructure:"recovered_percent" json:"recovered_percent,omitempty"`
+	// ProbeDelay is the pause between device requests of the health and
+	// metrics jobs during an outage (milliseconds)
+	ProbeDelay int `mapstructure:"probe_delay" json:"probe_delay,omitempty"`
+}
+
+// WithDefaults returns the configuration with unset thresholds filled in
+func (c OutageConfig) WithDefaults() OutageConfig {
+	if c.MinDevices <= 0 {
+		c.MinDevices = DefaultOutageMinDevices
+	}
+	if c.Percent <= 0 || c.Percent > 100 {
+		c.Percent = DefaultOutagePercent
+	}
+	if c.Window <= 0 {
+		c.Window = DefaultOutageWindow
+	}
+	if c.RecoveredPercent <= 0 || c.RecoveredPercent > 100 {
+		c.RecoveredPercent = DefaultOutageRecoveredPercent
+	}
+	if c.ProbeDelay <= 0 {
+		c.ProbeDelay = DefaultOutageProbeDelay
+	}
+	return c
+}
+
+// WindowDuration returns the detection window, falling back to the default
+func (c OutageConfig) WindowDuration() time.Duration {
+	return time.Duration(c.WithDefaults().Window) * time.Second
+}
+
+// ProbeDelayDuration returns the pause between requests during an outage
+func (c OutageConfig) ProbeDelayDuration() time.Duration {
+	return time.Duration(c.WithDefaults().ProbeDelay) * time.Millisecond
+}
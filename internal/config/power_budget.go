@@ -0,0 +1,25 @@
+package config
+
+import "time"
+
+// Power budget defaults
+const (
+	DefaultPowerBudgetInterval = 15 // seconds
+)
+
+// PowerBudgetConfig controls the check that compares the summed power of
+// power budget groups, e.g. the loads on one circuit, with their limits
+type PowerBudgetConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// Interval between checks in seconds. Members whose last reading is
+	// older than two intervals have their status read.
+	Interval int `mapstructure:"interval" json:"interval,omitempty"`
+}
+
+// IntervalDuration returns the check interval, falling back to the default
+func (c PowerBudgetConfig) IntervalDuration() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultPowerBudgetInterval * time.Second
+	}
+	return time.Duration(c.Interval) * time.Second
+}
@@ -0,0 +1,37 @@
+package config
+
+import "time"
+
+// Provisioning verification defaults
+const (
+	DefaultProvisioningVerifyTimeout  = 180 // seconds
+	DefaultProvisioningVerifyInterval = 10  // seconds
+)
+
+// ProvisioningVerificationConfig checks a provisioned device on its target
+// network before its provisioning task is marked completed: the device must
+// be found by MAC, answer status and config requests and be adopted
+type ProvisioningVerificationConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// Timeout is how long a device may take to appear on the target network
+	// (seconds)
+	Timeout int `mapstructure:"timeout" json:"timeout,omitempty"`
+	// Interval is the pause between attempts to find the device (seconds)
+	Interval int `mapstructure:"interval" json:"interval,omitempty"`
+}
+
+// TimeoutDuration returns the verification timeout, defaulting when unset
+func (c ProvisioningVerificationConfig) TimeoutDuration() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultProvisioningVerifyTimeout * time.Second
+	}
+	return time.Duration(c.Timeout) * time.Second
+}
+
+// IntervalDuration returns the pause between attempts, defaulting when unset
+func (c ProvisioningVerificationConfig) IntervalDuration() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultProvisioningVerifyInterval * time.Second
+	}
+	return time.Duration(c.Interval) * time.Second
+}
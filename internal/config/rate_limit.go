@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+// DeviceRateLimitConfig budgets the requests sent to devices, so discovery
+// scans, metrics collection and health checks together never saturate a
+// constrained link such as a site-to-site VPN
+type DeviceRateLimitConfig struct {
+	// RequestsPerSecond per /24 (IPv4) or /64 (IPv6) subnet; 0 is unlimited
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	// Burst of requests sent at once; 0 allows one second of requests
+	Burst int `mapstructure:"burst"`
+	// Networks with their own budget, shared by all their devices
+	Networks []NetworkRateLimit `mapstructure:"networks"`
+}
+
+// NetworkRateLimit budgets the requests to one network
+type NetworkRateLimit struct {
+	CIDR              string  `mapstructure:"cidr"`
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"` // 0 is unlimited
+	Burst             int     `mapstructure:"burst"`
+}
+
+// Enabled reports whether any request budget is set
+func (c DeviceRateLimitConfig) Enabled() bool {
+	return c.RequestsPerSecond > 0 || len(c.Networks) > 0
+}
+
+// Validate checks the rates and network CIDRs
+func (c DeviceRateLimitConfig) Validate() error {
+	if c.RequestsPerSecond < 0 || c.Burst < 0 {
+		return fmt.Errorf("requests_per_second and burst must not be negative")
+	}
+	for _, n := range c.Networks {
+		if _, _, err := net.ParseCIDR(n.CIDR); err != nil {
+			return fmt.Errorf("invalid network %q: %w", n.CIDR, err)
+		}
+		if n.RequestsPerSecond < 0 || n.Burst < 0 {
+			return fmt.Errorf("network %s: requests_per_second and burst must not be negative", n.CIDR)
+		}
+	}
+	return nil
+}
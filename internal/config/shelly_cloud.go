@@ -0,0 +1,35 @@
+package config
+
+import "time"
+
+// DefaultShellyCloudSyncInterval is how often names and rooms are pushed to
+// Shelly Cloud
+const DefaultShellyCloudSyncInterval = 360 // minutes
+
+// ShellyCloudConfig names the Shelly Cloud account of the fleet and controls
+// the optional sync of inventory names and rooms to it
+type ShellyCloudConfig struct {
+	// Server is the account's server URI and AuthKey its authorization cloud
+	// key, both shown in the Shelly app under User settings
+	Server  string `mapstructure:"server" json:"server,omitempty"`
+	AuthKey string `mapstructure:"auth_key" json:"-"`
+	// SyncEnabled pushes names and rooms every SyncInterval minutes
+	SyncEnabled  bool `mapstructure:"sync_enabled" json:"sync_enabled"`
+	SyncInterval int  `mapstructure:"sync_interval" json:"sync_interval,omitempty"`
+	// SyncNames and SyncRooms select what the sync pushes
+	SyncNames bool `mapstructure:"sync_names" json:"sync_names"`
+	SyncRooms bool `mapstructure:"sync_rooms" json:"sync_rooms"`
+}
+
+// Configured reports whether an account is set
+func (c ShellyCloudConfig) Configured() bool {
+	return c.Server != "" && c.AuthKey != ""
+}
+
+// SyncIntervalDuration returns the sync interval, falling back to the default
+func (c ShellyCloudConfig) SyncIntervalDuration() time.Duration {
+	if c.SyncInterval <= 0 {
+		return DefaultShellyCloudSyncInterval * time.Minute
+	}
+	return time.Duration(c.SyncInterval) * time.Minute
+}
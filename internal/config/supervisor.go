@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Recovery actions supported by supervisor policies
+const (
+	RecoveryActionReboot      = "reboot"
+	RecoveryActionWiFiRoaming = "wifi_roaming"
+)
+
+// Built-in supervisor defaults
+const (
+	DefaultSupervisorInterval        = 300 // seconds
+	DefaultRecoveryUnreachable       = 15  // minutes
+	DefaultRecoveryCooldown          = 60  // minutes
+	DefaultRecoveryDisconnects       = 3
+	DefaultRecoveryWindow            = 60 // minutes
+	DefaultRecoveryRoamingThreshold  = -70
+	DefaultRecoveryHealthyNeighbours = 1
+)
+
+// SupervisorConfig enables automatic recovery actions on unhealthy devices.
+// Nothing happens unless the supervisor is enabled and a policy selects the
+// device by tag.
+type SupervisorConfig struct {
+	Enabled  bool             `mapstructure:"enabled" json:"enabled"`
+	Interval int              `mapstructure:"interval" json:"interval,omitempty"` // probe interval (seconds)
+	Policies []RecoveryPolicy `mapstructure:"policies" json:"policies,omitempty"`
+}
+
+// RecoveryPolicy describes one recovery action and when it is taken
+type RecoveryPolicy struct {
+	Name string `mapstructure:"name" json:"name"`
+	// Tag opts a group of devices in; it is required
+	Tag    string `mapstructure:"tag" json:"tag"`
+	Action string `mapstructure:"action" json:"action"` // reboot or wifi_roaming
+
+	// reboot: the device has been unreachable this long while at least
+	// HealthyNeighbours other devices on its subnet respond
+	UnreachableMinutes int `mapstructure:"unreachable_minutes" json:"unreachable_minutes,omitempty"`
+	HealthyNeighbours  int `mapstructure:"healthy_neighbours" json:"healthy_neighbours,omitempty"`
+
+	// wifi_roaming (Gen1): the device dropped off Disconnects times within
+	// WindowMinutes; AP roaming is enabled with RoamingThreshold (dBm)
+	Disconnects      int `mapstructure:"disconnects" json:"disconnects,omitempty"`
+	WindowMinutes    int `mapstructure:"window_minutes" json:"window_minutes,omitempty"`
+	RoamingThreshold int `mapstructure:"roaming_threshold" json:"roaming_threshold,omitempty"`
+
+	// CooldownMinutes is the minimum time between actions on one device
+	CooldownMinutes int `mapstructure:"cooldown_minutes" json:"cooldown_minutes,omitempty"`
+}
+
+// IntervalDuration returns the probe interval, falling back to the default
+func (c SupervisorConfig) IntervalDuration() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultSupervisorInterval * time.Second
+	}
+	return time.Duration(c.Interval) * time.Second
+}
+
+// Validate checks that every policy is opt-in and uses a known action
+func (c SupervisorConfig) Validate() error {
+	for i, p := range c.Policies {
+		if p.Tag == "" {
+			return fmt.Errorf("supervisor policy %d (%s): tag is required", i, p.Name)
+		}
+		switch p.Action {
+		case RecoveryActionReboot, RecoveryActionWiFiRoaming:
+		default:
+			return fmt.Errorf("supervisor policy %d (%s): unknown action %q", i, p.Name, p.Action)
+		}
+	}
+	return nil
+}
+
+// WithDefaults returns the policy with unset thresholds filled in
+func (p RecoveryPolicy) WithDefaults() RecoveryPolicy {
+	if p.Name == "" {
+		p.Name = p.Action + ":" + p.Tag
+	}
+	if p.UnreachableMinutes <= 0 {
+		p.UnreachableMinutes = DefaultRecoveryUnreachable
+	}
+	if p.HealthyNeighbours <= 0 {
+		p.HealthyNeighbours = DefaultRecoveryHealthyNeighbours
+	}
+	if p.Disconnects <= 0 {
+		p.Disconnects = DefaultRecoveryDisconnects
+	}
+	if p.WindowMinutes <= 0 {
+		p.WindowMinutes = DefaultRecoveryWindow
+	}
+	if p.RoamingThreshold == 0 {
+		p.RoamingThreshold = DefaultRecoveryRoamingThreshold
+	}
+	if p.CooldownMinutes <= 0 {
+		p.CooldownMinutes = DefaultRecoveryCooldown
+	}
+	return p
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSupervisorConfig_Validate(t *testing.T) {
+	for _, p := range []RecoveryPolicy{
+		{Action: RecoveryActionReboot},
+		{Tag: "critical", Action: "factory_reset"},
+	} {
+		if err := (SupervisorConfig{Policies: []RecoveryPolicy{p}}).Validate(); err == nil {
+			t.Errorf("Expected validation error for %+v", p)
+		}
+	}
+
+	cfg := SupervisorConfig{Policies: []RecoveryPolicy{{Tag: "critical", Action: RecoveryActionReboot}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	if cfg.IntervalDuration() != DefaultSupervisorInterval*time.Second {
+		t.Errorf("Expected default interval, got %s", cfg.IntervalDuration())
+	}
+	if p := cfg.Policies[0].WithDefaults(); p.Name != "reboot:critical" || p.UnreachableMinutes != DefaultRecoveryUnreachable {
+		t.Errorf("Unexpected defaults: %+v", p)
+	}
+}
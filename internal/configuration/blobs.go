@@ -0,0 +1,213 @@
+package configuration
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConfigBlob stores one configuration document, keyed by the SHA-256 of its
+// compacted JSON. History rows reference blobs by hash, so a configuration
+// that recurs across imports is stored once.
+type ConfigBlob struct {
+	Hash      string          `json:"hash" gorm:"primaryKey;size:64"`
+	Data      json.RawMessage `json:"data" gorm:"type:text;not null"`
+	Size      int             `json:"size"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// historyMigrationBatch is the number of legacy history rows moved per batch
+const historyMigrationBatch = 500
+
+// BeforeCreate moves the old and new configurations into content-addressed
+// blobs and records their hashes on the history row
+func (h *ConfigHistory) BeforeCreate(tx *gorm.DB) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	var err error
+	if h.OldConfigHash, err = putConfigBlob(db, h.OldConfig); err != nil {
+		return err
+	}
+	if h.NewConfigHash, err = putConfigBlob(db, h.NewConfig); err != nil {
+		return err
+	}
+	return nil
+}
+
+// configHash returns the blob hash and stored form of a configuration, or
+// "" for an empty one
+func configHash(config json.RawMessage) (string, json.RawMessage) {
+	if len(config) == 0 || string(config) == "null" {
+		return "", nil
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, config); err == nil {
+		config = compact.Bytes()
+	}
+	sum := sha256.Sum256(config)
+	return hex.EncodeToString(sum[:]), config
+}
+
+// putConfigBlob stores a configuration unless a blob with the same content
+// already exists and returns its hash
+func putConfigBlob(db *gorm.DB, config json.RawMessage) (string, error) {
+	hash, data := configHash(config)
+	if hash == "" {
+		return "", nil
+	}
+	blob := ConfigBlob{Hash: hash, Data: data, Size: len(data), CreatedAt: time.Now()}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&blob).Error; err != nil {
+		return "", fmt.Errorf("failed to store config blob: %w", err)
+	}
+	return hash, nil
+}
+
+// configBlobsCallback names the query callback that fills history rows
+const configBlobsCallback = "configuration:config_blobs"
+
+// configBlobBatch bounds the hashes looked up per blob query
+const configBlobBatch = 500
+
+// registerConfigBlobs fills OldConfig and NewConfig of queried history rows
+// from their blobs, so readers see history rows exactly as they were written
+func registerConfigBlobs(db *gorm.DB) error {
+	if db.Callback().Query().Get(configBlobsCallback) != nil {
+		return nil
+	}
+	return db.Callback().Query().After("gorm:after_query").Register(configBlobsCallback, loadConfigBlobs)
+}
+
+// loadConfigBlobs looks up the blobs of every history row a query returned
+// at once rather than per row
+func loadConfigBlobs(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	var rows []*ConfigHistory
+	switch dest := db.Statement.Dest.(type) {
+	case *ConfigHistory:
+		rows = append(rows, dest)
+	case *[]ConfigHistory:
+		for i := range *dest {
+			rows = append(rows, &(*dest)[i])
+		}
+	case *[]*ConfigHistory:
+		for _, h := range *dest {
+			if h != nil {
+				rows = append(rows, h)
+			}
+		}
+	default:
+		return
+	}
+
+	seen := make(map[string]bool)
+	var hashes []string
+	for _, h := range rows {
+		for _, hash := range []string{h.OldConfigHash, h.NewConfigHash} {
+			if hash != "" && !seen[hash] {
+				seen[hash] = true
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	if len(hashes) == 0 {
+		return
+	}
+
+	data := make(map[string]json.RawMessage, len(hashes))
+	tx := db.Session(&gorm.Session{NewDB: true})
+	for start := 0; start < len(hashes); start += configBlobBatch {
+		end := min(start+configBlobBatch, len(hashes))
+		var blobs []ConfigBlob
+		if err := tx.Where("hash IN ?", hashes[start:end]).Find(&blobs).Error; err != nil {
+			_ = db.AddError(fmt.Errorf("failed to load config blobs: %w", err))
+			return
+		}
+		for _, b := range blobs {
+			data[b.Hash] = b.Data
+		}
+	}
+	for _, h := range rows {
+		if h.OldConfigHash != "" {
+			h.OldConfig = data[h.OldConfigHash]
+		}
+		if h.NewConfigHash != "" {
+			h.NewConfig = data[h.NewConfigHash]
+		}
+	}
+}
+
+// migrateHistoryBlobs moves configurations stored inline by older versions
+// (old_config/new_config columns) into blobs, then drops the inline columns
+func migrateHistoryBlobs(db *gorm.DB) (int, error) {
+	migrator := db.Migrator()
+	hasOld := migrator.HasColumn(&ConfigHistory{}, "old_config")
+	hasNew := migrator.HasColumn(&ConfigHistory{}, "new_config")
+	if !hasOld && !hasNew {
+		return 0, nil
+	}
+
+	type legacyRow struct {
+		ID        uint
+		OldConfig string
+		NewConfig string
+	}
+	columns := []string{"id"}
+	if hasOld {
+		columns = append(columns, "old_config")
+	}
+	if hasNew {
+		columns = append(columns, "new_config")
+	}
+
+	migrated := 0
+	lastID := uint(0)
+	for {
+		var rows []legacyRow
+		if err := db.Table("config_histories").Select(columns).
+			Where("id > ?", lastID).Order("id").Limit(historyMigrationBatch).
+			Find(&rows).Error; err != nil {
+			return migrated, fmt.Errorf("failed to read legacy config history: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				oldHash, err := putConfigBlob(tx, json.RawMessage(row.OldConfig))
+				if err != nil {
+					return err
+				}
+				newHash, err := putConfigBlob(tx, json.RawMessage(row.NewConfig))
+				if err != nil {
+					return err
+				}
+				if err := tx.Table("config_histories").Where("id = ?", row.ID).
+					Updates(map[string]interface{}{"old_config_hash": oldHash, "new_config_hash": newHash}).Error; err != nil {
+					return fmt.Errorf("failed to update config history %d: %w", row.ID, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return migrated, err
+		}
+		migrated += len(rows)
+		lastID = rows[len(rows)-1].ID
+	}
+
+	// Plain ALTER TABLE: the SQLite migrator's table rebuild cannot drop
+	// columns that are no longer part of the model
+	for _, column := range columns[1:] {
+		if err := db.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "config_histories"}, clause.Column{Name: column}).Error; err != nil {
+			return migrated, fmt.Errorf("failed to drop legacy column %s: %w", column, err)
+		}
+	}
+	return migrated, nil
+}
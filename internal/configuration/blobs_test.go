@@ -0,0 +1,88 @@
+package configuration
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+func TestConfigHistory_BlobDeduplication(t *testing.T) {
+	service, db := setupTestService(t)
+
+	config := json.RawMessage(`{"wifi": {"ssid": "home"}, "name": "kitchen"}`)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Create(&ConfigHistory{
+			DeviceID:  1,
+			ConfigID:  1,
+			Action:    "import",
+			OldConfig: config,
+			NewConfig: json.RawMessage(`{"name":"kitchen","wifi":{"ssid":"home"}}`),
+			CreatedAt: time.Now().Add(time.Duration(i) * time.Minute),
+		}).Error)
+	}
+
+	var blobs int64
+	db.Model(&ConfigBlob{}).Count(&blobs)
+	assert.Equal(t, int64(2), blobs, "identical configs must share a blob")
+
+	// All rows are filled from a single blob lookup
+	blobQueries := 0
+	require.NoError(t, db.Callback().Query().Before("gorm:query").Register("test:count_blob_queries", func(tx *gorm.DB) {
+		if tx.Statement.Table == "config_blobs" {
+			blobQueries++
+		}
+	}))
+	history, err := service.GetConfigHistory(1, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, 1, blobQueries)
+	for _, h := range history {
+		assert.JSONEq(t, string(config), string(h.OldConfig))
+		assert.NotEmpty(t, h.NewConfigHash)
+		assert.NotEqual(t, h.OldConfigHash, h.NewConfigHash)
+	}
+}
+
+func TestMigrateHistoryBlobs(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// Table layout written by versions that stored configs inline
+	require.NoError(t, db.Exec(`CREATE TABLE config_histories (
+		id integer PRIMARY KEY AUTOINCREMENT, device_id integer NOT NULL, config_id integer NOT NULL,
+		action text, old_config text, new_config text, changes text, changed_by text, created_at datetime)`).Error)
+	require.NoError(t, db.Exec(`INSERT INTO config_histories (device_id, config_id, action, old_config, new_config, created_at)
+		VALUES (7, 1, 'import', NULL, '{"a": 1}', CURRENT_TIMESTAMP),
+		       (7, 1, 'import', '{"a": 1}', '{"a": 2}', CURRENT_TIMESTAMP)`).Error)
+
+	logger, _ := logging.New(logging.Config{Level: "info", Format: "text"})
+	service := NewService(db, logger)
+
+	assert.False(t, db.Migrator().HasColumn(&ConfigHistory{}, "old_config"))
+	assert.False(t, db.Migrator().HasColumn(&ConfigHistory{}, "new_config"))
+
+	history, err := service.GetConfigHistory(7, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	byID := map[uint]ConfigHistory{}
+	for _, h := range history {
+		byID[h.ID] = h
+	}
+	assert.Empty(t, byID[1].OldConfig)
+	assert.JSONEq(t, `{"a": 1}`, string(byID[1].NewConfig))
+	assert.JSONEq(t, `{"a": 1}`, string(byID[2].OldConfig))
+	assert.JSONEq(t, `{"a": 2}`, string(byID[2].NewConfig))
+	assert.Equal(t, byID[1].NewConfigHash, byID[2].OldConfigHash)
+
+	// A second start finds nothing left to migrate
+	migrated, err := migrateHistoryBlobs(db)
+	require.NoError(t, err)
+	assert.Zero(t, migrated)
+}
@@ -17,6 +17,9 @@ var (
 	ErrDeviceTypeRequired   = errors.New("device_type required when scope is 'device_type'")
 	ErrTemplateIDsNotFound  = errors.New("one or more template IDs not found")
 	ErrStoredConfigNotFound = errors.New("no stored configuration found for device")
+	// ErrVersionConflict is returned when a row changed after the version the
+	// update was based on
+	ErrVersionConflict = errors.New("modified by another request")
 )
 
 type ServiceConfigTemplate struct {
@@ -26,6 +29,7 @@ type ServiceConfigTemplate struct {
 	Scope       string          `json:"scope"`
 	DeviceType  string          `json:"device_type,omitempty"`
 	Config      json.RawMessage `json:"config"`
+	Version     int             `json:"version"`
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
 }
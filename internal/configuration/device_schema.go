@@ -0,0 +1,270 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Device-verified validation codes
+const (
+	CodeUnsupportedComponent = "UNSUPPORTED_COMPONENT"
+	CodeUnsupportedKey       = "UNSUPPORTED_KEY"
+	CodeTypeMismatch         = "TYPE_MISMATCH"
+	CodeNotVerified          = "NOT_VERIFIED"
+	CodeDeviceVerified       = "DEVICE_VERIFIED"
+)
+
+// gen2SchemaPaths maps typed configuration paths onto the Gen2
+// Shelly.GetConfig layout. The longest matching typed path wins and the rest
+// of the path is appended. An empty target marks settings that do not live
+// in Shelly.GetConfig and cannot be checked. {id} is replaced with the id of
+// the relay or input the setting belongs to.
+var gen2SchemaPaths = map[string]string{
+	"wifi":                            "wifi.sta",
+	"wifi.password":                   "wifi.sta.pass",
+	"wifi.static_ip":                  "wifi.sta",
+	"wifi.ap":                         "wifi.ap",
+	"wifi.ap.range_extender":          "wifi.ap.range_extender.enable",
+	"wifi.roam_threshold":             "wifi.roam.rssi_thr",
+	"network.wifi":                    "wifi",
+	"network.wifi.sta.ip":             "wifi.sta",
+	"network.eth":                     "eth",
+	"network.eth.ip":                  "eth",
+	"mqtt":                            "mqtt",
+	"mqtt.id":                         "mqtt.client_id",
+	"cloud":                           "cloud",
+	"location":                        "sys.location",
+	"location.lng":                    "sys.location.lon",
+	"system":                          "sys",
+	"system.device.tz":                "sys.location.tz",
+	"system.device.lat_lon":           "",
+	"system.device.ble":               "ble",
+	"system.location.lng":             "sys.location.lon",
+	"system.debug.mqtt":               "sys.debug.mqtt.enable",
+	"system.debug.websocket":          "sys.debug.websocket.enable",
+	"system.debug.udp":                "",
+	"relay":                           "switch:0",
+	"relay.default_state":             "switch:0.initial_state",
+	"relay.btn_type":                  "switch:0.in_mode",
+	"relay.auto_on":                   "switch:0.auto_on_delay",
+	"relay.auto_off":                  "switch:0.auto_off_delay",
+	"relay.max_power_limit":           "switch:0.power_limit",
+	"relay.has_timer":                 "",
+	"relay.relays":                    "switch:{id}",
+	"relay.relays.default_state":      "switch:{id}.initial_state",
+	"relay.relays.auto_on":            "switch:{id}.auto_on_delay",
+	"relay.relays.auto_off":           "switch:{id}.auto_off_delay",
+	"relay.relays.schedule":           "",
+	"input.inputs":                    "input:{id}",
+	"input.inputs.inverted":           "input:{id}.invert",
+	"input.inputs.single_push_action": "",
+	"input.inputs.long_push_action":   "",
+	"auth":                            "",
+	"raw":                             "",
+}
+
+// gen2ComponentLists are typed lists whose entries are separate Gen2
+// components, addressed by the entry's id
+var gen2ComponentLists = map[string]bool{
+	"relay.relays": true,
+	"input.inputs": true,
+}
+
+// schemaLeaf is a single setting of a typed configuration
+type schemaLeaf struct {
+	field  string // path shown to the user, e.g. relay.relays[1].name
+	lookup string // path used to find the mapping, e.g. relay.relays.name
+	id     string // id of the list entry the setting belongs to
+	value  interface{}
+}
+
+// VerifyAgainstDeviceConfig checks a typed configuration against the
+// configuration a Gen2 device reports from Shelly.GetConfig. Settings the
+// device's firmware does not report, or reports with another type, are
+// errors: the device would ignore them on export. Settings that cannot be
+// located in Shelly.GetConfig are listed as not verified.
+func VerifyAgainstDeviceConfig(config *TypedConfiguration, deviceConfig json.RawMessage, firmware string) (*ValidationResult, error) {
+	var device map[string]interface{}
+	if err := json.Unmarshal(deviceConfig, &device); err != nil || device == nil {
+		return nil, fmt.Errorf("device configuration is not a JSON object")
+	}
+	configJSON, err := config.ToJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize configuration: %w", err)
+	}
+	var typed map[string]interface{}
+	if err := json.Unmarshal(configJSON, &typed); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+
+	var leaves []schemaLeaf
+	flattenSchemaLeaves("", "", "", typed, &leaves)
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].field < leaves[j].field })
+
+	if firmware == "" {
+		firmware = "unknown"
+	}
+	result := &ValidationResult{Valid: true}
+	missingComponents := map[string]bool{}
+	notVerified := map[string]bool{}
+	checked := 0
+	for _, leaf := range leaves {
+		target, ok := gen2SchemaPath(leaf)
+		if !ok {
+			section := strings.SplitN(leaf.lookup, ".", 2)[0]
+			if !notVerified[section] {
+				notVerified[section] = true
+				result.Info = append(result.Info, ValidationInfo{
+					Field:   section,
+					Message: "Not part of the device's Shelly.GetConfig; not verified against the device",
+					Code:    CodeNotVerified,
+				})
+			}
+			continue
+		}
+		checked++
+
+		segments := strings.Split(target, ".")
+		var current interface{} = device
+		for i, segment := range segments {
+			parent, isObject := current.(map[string]interface{})
+			if !isObject {
+				result.Errors = append(result.Errors, ValidationError{
+					Field:   leaf.field,
+					Message: fmt.Sprintf("Device reports %s as %s, not an object", strings.Join(segments[:i], "."), schemaKind(current)),
+					Code:    CodeTypeMismatch,
+				})
+				break
+			}
+			next, exists := parent[segment]
+			if !exists {
+				if i == 0 {
+					if !missingComponents[segment] {
+						missingComponents[segment] = true
+						result.Errors = append(result.Errors, ValidationError{
+							Field:   leaf.field,
+							Message: fmt.Sprintf("Device has no %s component (firmware %s)", segment, firmware),
+							Code:    CodeUnsupportedComponent,
+						})
+					}
+				} else {
+					result.Errors = append(result.Errors, ValidationError{
+						Field:   leaf.field,
+						Message: fmt.Sprintf("Device firmware %s does not support %s; the setting would be ignored", firmware, target),
+						Code:    CodeUnsupportedKey,
+					})
+				}
+				break
+			}
+			if i == len(segments)-1 && next != nil && schemaKind(next) != schemaKind(leaf.value) {
+				result.Errors = append(result.Errors, ValidationError{
+					Field:   leaf.field,
+					Message: fmt.Sprintf("Device expects %s for %s, got %s", schemaKind(next), target, schemaKind(leaf.value)),
+					Code:    CodeTypeMismatch,
+				})
+			}
+			current = next
+		}
+	}
+
+	result.Valid = len(result.Errors) == 0
+	result.Info = append(result.Info, ValidationInfo{
+		Field:   "",
+		Message: fmt.Sprintf("%d settings checked against the device configuration (firmware %s)", checked, firmware),
+		Code:    CodeDeviceVerified,
+	})
+	return result, nil
+}
+
+// Merge adds the findings of another validation to the result
+func (r *ValidationResult) Merge(other *ValidationResult) {
+	if other == nil {
+		return
+	}
+	r.Errors = append(r.Errors, other.Errors...)
+	r.Warnings = append(r.Warnings, other.Warnings...)
+	r.Info = append(r.Info, other.Info...)
+	r.Valid = r.Valid && other.Valid
+}
+
+// flattenSchemaLeaves collects the settings of a typed configuration. Entries
+// of component lists are addressed by their id instead of their position.
+func flattenSchemaLeaves(field, lookup, id string, value interface{}, leaves *[]schemaLeaf) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && field != "" {
+			*leaves = append(*leaves, schemaLeaf{field: field, lookup: lookup, id: id, value: v})
+			return
+		}
+		for key, child := range v {
+			if id != "" && key == "id" && gen2ComponentLists[lookup] {
+				continue
+			}
+			flattenSchemaLeaves(joinSchemaPath(field, key), joinSchemaPath(lookup, key), id, child, leaves)
+		}
+	case []interface{}:
+		if !gen2ComponentLists[lookup] {
+			*leaves = append(*leaves, schemaLeaf{field: field, lookup: lookup, id: id, value: v})
+			return
+		}
+		for i, entry := range v {
+			entryID := strconv.Itoa(i)
+			if m, ok := entry.(map[string]interface{}); ok {
+				if n, ok := m["id"].(float64); ok {
+					entryID = strconv.Itoa(int(n))
+				}
+			}
+			flattenSchemaLeaves(fmt.Sprintf("%s[%d]", field, i), lookup, entryID, entry, leaves)
+		}
+	default:
+		*leaves = append(*leaves, schemaLeaf{field: field, lookup: lookup, id: id, value: v})
+	}
+}
+
+// gen2SchemaPath returns the Gen2 path of a setting, or false if it cannot be
+// verified against Shelly.GetConfig
+func gen2SchemaPath(leaf schemaLeaf) (string, bool) {
+	prefix := leaf.lookup
+	for {
+		if target, ok := gen2SchemaPaths[prefix]; ok {
+			if target == "" {
+				return "", false
+			}
+			target = strings.ReplaceAll(target, "{id}", leaf.id)
+			return target + strings.TrimPrefix(leaf.lookup, prefix), true
+		}
+		i := strings.LastIndex(prefix, ".")
+		if i < 0 {
+			return "", false
+		}
+		prefix = prefix[:i]
+	}
+}
+
+func joinSchemaPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// schemaKind names the JSON type of a value
+func schemaKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,89 @@
+package configuration
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const gen2PlusConfig = `{
+	"sys": {
+		"device": {"name": "Kitchen", "mac": "AABBCCDDEEFF", "fw_id": "20230912-082941/1.0.3", "discoverable": true, "eco_mode": false},
+		"location": {"tz": "Europe/Brussels", "lat": 50.8, "lon": 4.3},
+		"debug": {"level": 2, "mqtt": {"enable": false}, "websocket": {"enable": false}, "udp": {"addr": null}},
+		"sntp": {"server": "time.google.com"}
+	},
+	"wifi": {
+		"sta": {"ssid": "Home", "pass": null, "is_open": false, "enable": true, "ipv4mode": "dhcp", "ip": null, "netmask": null, "gw": null, "nameserver": null},
+		"ap": {"ssid": "ShellyPlus1-AABB", "is_open": true, "enable": false, "range_extender": {"enable": false}},
+		"roam": {"rssi_thr": -80, "interval": 60}
+	},
+	"mqtt": {"enable": true, "server": "broker:1883", "client_id": "shelly", "user": null, "topic_prefix": "shelly", "rpc_ntf": true, "status_ntf": false},
+	"cloud": {"enable": false, "server": "iot.shelly.cloud:6012/jrpc"},
+	"switch:0": {"id": 0, "name": null, "in_mode": "follow", "initial_state": "off", "auto_on": false, "auto_on_delay": 60, "auto_off": false, "auto_off_delay": 60},
+	"input:0": {"id": 0, "name": null, "type": "switch", "invert": false}
+}`
+
+func TestVerifyAgainstDeviceConfig(t *testing.T) {
+	str := func(s string) *string { return &s }
+	yes := true
+	port := 1883
+	delay := 30
+
+	// Settings the device reports pass
+	valid := &TypedConfiguration{
+		WiFi: &WiFiConfiguration{SSID: str("Office"), Password: str("secret"), StaticIP: &StaticIPConfig{IP: str("10.0.0.5")},
+			AccessPoint: &AccessPointConfig{RangeExtender: &yes}},
+		MQTT:     &MQTTConfiguration{Enable: &yes, Server: str("broker:1883"), ClientID: str("kitchen")},
+		Location: &LocationConfiguration{Timezone: str("UTC")},
+		Relay:    &RelayConfig{Relays: []SingleRelayConfig{{ID: 0, Name: str("Light"), DefaultState: str("on"), AutoOff: &delay}}},
+		Auth:     &AuthConfiguration{Enable: &yes},
+	}
+	result, err := VerifyAgainstDeviceConfig(valid, json.RawMessage(gen2PlusConfig), "1.0.3")
+	require.NoError(t, err)
+	assert.True(t, result.Valid, "unexpected errors: %+v", result.Errors)
+	codes := map[string]string{}
+	for _, info := range result.Info {
+		codes[info.Code] = info.Field
+	}
+	assert.Equal(t, "auth", codes[CodeNotVerified])
+	assert.Contains(t, codes, CodeDeviceVerified)
+
+	// Keys the firmware does not have, missing components and wrong types fail
+	invalid := &TypedConfiguration{
+		MQTT:   &MQTTConfiguration{Port: &port},
+		System: &SystemConfiguration{Device: &TypedDeviceConfig{Hostname: str("kitchen")}},
+		Cloud:  &CloudConfiguration{Enable: &yes},
+		Relay:  &RelayConfig{Relays: []SingleRelayConfig{{ID: 1, Name: str("Second")}}},
+		WiFi:   &WiFiConfiguration{RoamThreshold: &delay},
+		Raw:    json.RawMessage(`{"unknown": true}`),
+	}
+	result, err = VerifyAgainstDeviceConfig(invalid, json.RawMessage(gen2PlusConfig), "1.0.3")
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	errs := map[string]string{}
+	for _, e := range result.Errors {
+		errs[e.Field] = e.Code
+	}
+	assert.Equal(t, CodeUnsupportedKey, errs["mqtt.port"])
+	assert.Equal(t, CodeUnsupportedKey, errs["system.device.hostname"])
+	assert.Equal(t, CodeUnsupportedComponent, errs["relay.relays[0].name"])
+	assert.NotContains(t, errs, "wifi.roam_threshold")
+	assert.NotContains(t, errs, "cloud.enable")
+	assert.Len(t, result.Errors, 3)
+
+	// Types are compared with what the device reports
+	result, err = VerifyAgainstDeviceConfig(&TypedConfiguration{
+		System: &SystemConfiguration{Device: &TypedDeviceConfig{EcoMode: &yes, Name: str("x")}, SNTP: &SNTPConfig{Server: "pool.ntp.org"}},
+		Input:  &InputConfig{Inputs: []SingleInputConfig{{ID: 0, Type: str("button"), Inverted: &yes}}},
+	}, json.RawMessage(`{"sys": {"device": {"eco_mode": "off", "name": "k"}, "sntp": {"server": "a"}}, "input:0": {"type": "switch", "invert": false}}`), "")
+	require.NoError(t, err)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, CodeTypeMismatch, result.Errors[0].Code)
+	assert.Equal(t, "system.device.eco_mode", result.Errors[0].Field)
+
+	_, err = VerifyAgainstDeviceConfig(valid, json.RawMessage(`[]`), "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,264 @@
+package configuration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Drift severities, from the drift score
+const (
+	DriftSeverityLow      = "low"
+	DriftSeverityMedium   = "medium"
+	DriftSeverityHigh     = "high"
+	DriftSeverityCritical = "critical"
+)
+
+// ErrInvalidDriftQuery is returned for an unknown severity filter
+var ErrInvalidDriftQuery = errors.New("invalid drift queue query")
+
+// defaultDriftWeight weighs differences no weight matches
+const defaultDriftWeight = 20
+
+// DriftWeight weights the differences under a configuration path. A path
+// covers its subtree; * matches within one key and ** any number of keys.
+type DriftWeight struct {
+	Path   string `json:"path"`
+	Weight int    `json:"weight"` // 0-100
+}
+
+// DefaultDriftWeights rank credentials, static addressing and Wi-Fi highest
+// and names, labels and LEDs lowest. The first matching path wins.
+var DefaultDriftWeights = []DriftWeight{
+	// Credentials
+	{Path: "auth", Weight: 100},
+	{Path: "login", Weight: 100},
+	{Path: "**.pass", Weight: 100},
+	{Path: "**.password", Weight: 100},
+	{Path: "**.user", Weight: 90},
+
+	// Static addressing
+	{Path: "**.ipv4mode", Weight: 90},
+	{Path: "**.ipv4_method", Weight: 90},
+	{Path: "**.ip", Weight: 90},
+	{Path: "**.netmask", Weight: 90},
+	{Path: "**.mask", Weight: 90},
+	{Path: "**.gw", Weight: 90},
+	{Path: "**.nameserver", Weight: 90},
+	{Path: "**.dns", Weight: 90},
+
+	// Wi-Fi and Ethernet
+	{Path: "wifi", Weight: 80},
+	{Path: "wifi_sta", Weight: 80},
+	{Path: "wifi_sta1", Weight: 80},
+	{Path: "wifi_ap", Weight: 80},
+	{Path: "eth", Weight: 80},
+
+	// Names and labels
+	{Path: "name", Weight: 5},
+	{Path: "**.name", Weight: 5},
+	{Path: "**.label", Weight: 5},
+	{Path: "led", Weight: 10},
+	{Path: "**.led", Weight: 10},
+	{Path: "**.led_status_disable", Weight: 10},
+	{Path: "**.led_power_disable", Weight: 10},
+	{Path: "sys.location", Weight: 5},
+
+	// Connectivity and outputs
+	{Path: "mqtt", Weight: 60},
+	{Path: "cloud", Weight: 50},
+	{Path: "ws", Weight: 50},
+	{Path: "coiot", Weight: 40},
+	{Path: "switch:*", Weight: 40},
+	{Path: "cover:*", Weight: 40},
+	{Path: "light:*", Weight: 40},
+	{Path: "relays", Weight: 40},
+	{Path: "rollers", Weight: 40},
+	{Path: "lights", Weight: 40},
+	{Path: "profile", Weight: 40},
+	{Path: "input:*", Weight: 30},
+	{Path: "ble", Weight: 30},
+}
+
+// DriftScorer weights drift differences by their path
+type DriftScorer struct {
+	weights []DriftWeight
+}
+
+// NewDriftScorer creates a scorer checking weights before the defaults
+func NewDriftScorer(weights []DriftWeight) *DriftScorer {
+	all := make([]DriftWeight, 0, len(weights)+len(DefaultDriftWeights))
+	all = append(all, weights...)
+	all = append(all, DefaultDriftWeights...)
+	return &DriftScorer{weights: all}
+}
+
+// Weight returns the weight of a difference at a dotted path
+func (s *DriftScorer) Weight(diffPath string) int {
+	keys := strings.Split(strings.ToLower(diffPath), ".")
+	for _, w := range s.weights {
+		if driftPathMatches(strings.Split(strings.ToLower(w.Path), "."), keys) {
+			return w.Weight
+		}
+	}
+	return defaultDriftWeight
+}
+
+// Score weights each difference of a drift and scores the drift by its
+// heaviest difference
+func (s *DriftScorer) Score(drift *ConfigDrift) {
+	drift.Score = 0
+	for i := range drift.Differences {
+		d := &drift.Differences[i]
+		d.Weight = s.Weight(d.Path)
+		if d.Weight > drift.Score {
+			drift.Score = d.Weight
+		}
+	}
+	drift.Severity = DriftScoreSeverity(drift.Score)
+}
+
+// DriftScoreSeverity maps a drift score to its severity
+func DriftScoreSeverity(score int) string {
+	switch {
+	case score >= 80:
+		return DriftSeverityCritical
+	case score >= 50:
+		return DriftSeverityHigh
+	case score >= 20:
+		return DriftSeverityMedium
+	default:
+		return DriftSeverityLow
+	}
+}
+
+// DriftSeverityRank orders drift severities; higher is more severe and
+// unknown severities rank 0
+func DriftSeverityRank(severity string) int {
+	switch severity {
+	case DriftSeverityCritical:
+		return 4
+	case DriftSeverityHigh:
+		return 3
+	case DriftSeverityMedium:
+		return 2
+	case DriftSeverityLow:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// driftPathMatches reports whether a weight path matches the leading keys
+// of a difference path
+func driftPathMatches(pattern, keys []string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(keys); i++ {
+			if driftPathMatches(pattern[1:], keys[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(keys) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], keys[0]); err != nil || !ok {
+		return false
+	}
+	return driftPathMatches(pattern[1:], keys[1:])
+}
+
+// DriftQueueItem is the latest unresolved drift of a device, awaiting
+// remediation
+type DriftQueueItem struct {
+	ID              uint            `json:"id" gorm:"primaryKey"`
+	DeviceID        uint            `json:"device_id" gorm:"uniqueIndex;not null"`
+	DeviceName      string          `json:"device_name"`
+	Score           int             `json:"score" gorm:"index"`
+	Severity        string          `json:"severity"`
+	TopPath         string          `json:"top_path"` // the heaviest difference
+	DifferenceCount int             `json:"difference_count"`
+	Differences     json.RawMessage `json:"differences" gorm:"type:text"`
+	DetectedAt      time.Time       `json:"detected_at"` // first detected
+	LastSeen        time.Time       `json:"last_seen"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// queueDrift records the drift of a device in the remediation queue,
+// keeping when it was first detected
+func (s *Service) queueDrift(drift *ConfigDrift) error {
+	differences := append([]ConfigDifference(nil), drift.Differences...)
+	sort.SliceStable(differences, func(i, j int) bool { return differences[i].Weight > differences[j].Weight })
+	data, err := json.Marshal(differences)
+	if err != nil {
+		return fmt.Errorf("failed to encode differences: %w", err)
+	}
+	item := DriftQueueItem{
+		DeviceID:        drift.DeviceID,
+		DeviceName:      drift.DeviceName,
+		Score:           drift.Score,
+		Severity:        drift.Severity,
+		DifferenceCount: len(differences),
+		Differences:     data,
+		DetectedAt:      drift.DriftDetected,
+		LastSeen:        drift.DriftDetected,
+	}
+	if len(differences) > 0 {
+		item.TopPath = differences[0].Path
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"device_name", "score", "severity", "top_path", "difference_count", "differences", "last_seen", "updated_at"}),
+	}).Create(&item).Error
+}
+
+// removeQueuedDrift removes a device from the remediation queue
+func (s *Service) removeQueuedDrift(deviceID uint) {
+	if err := s.db.Where("device_id = ?", deviceID).Delete(&DriftQueueItem{}).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": deviceID,
+			"error":     err.Error(),
+			"component": "configuration",
+		}).Warn("Failed to remove drift from the remediation queue")
+	}
+}
+
+// GetDriftQueue returns the devices still in drift, most severe first and
+// longest waiting first within a score. minSeverity leaves out less severe
+// drift; limit <= 0 returns all.
+func (s *Service) GetDriftQueue(minSeverity string, limit int) ([]DriftQueueItem, error) {
+	query := s.db.Model(&DriftQueueItem{}).
+		Joins("JOIN device_configs ON device_configs.device_id = drift_queue_items.device_id AND device_configs.sync_status = ?", "drift")
+	if minSeverity != "" {
+		rank := DriftSeverityRank(minSeverity)
+		if rank == 0 {
+			return nil, fmt.Errorf("%w: unknown severity %q", ErrInvalidDriftQuery, minSeverity)
+		}
+		var severities []string
+		for _, sev := range []string{DriftSeverityLow, DriftSeverityMedium, DriftSeverityHigh, DriftSeverityCritical} {
+			if DriftSeverityRank(sev) >= rank {
+				severities = append(severities, sev)
+			}
+		}
+		query = query.Where("drift_queue_items.severity IN ?", severities)
+	}
+	query = query.Order("drift_queue_items.score DESC").Order("drift_queue_items.detected_at ASC").Order("drift_queue_items.device_id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	items := []DriftQueueItem{}
+	if err := query.Select("drift_queue_items.*").Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to load drift queue: %w", err)
+	}
+	return items, nil
+}
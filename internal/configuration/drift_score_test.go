@@ -0,0 +1,104 @@
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+func TestDriftScorer_Weight(t *testing.T) {
+	scorer := NewDriftScorer([]DriftWeight{{Path: "mqtt.server", Weight: 95}})
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"wifi.sta.pass", 100},
+		{"auth.enabled", 100},
+		{"wifi.sta.ip", 90},
+		{"wifi_sta.ipv4_method", 90},
+		{"wifi.sta.ssid", 80},
+		{"mqtt.server", 95},
+		{"mqtt.enable", 60},
+		{"switch:0.name", 5},
+		{"switch:0.initial_state", 40},
+		{"sys.device.name", 5},
+		{"name", 5},
+		{"sntp.server", defaultDriftWeight},
+	}
+	for _, tt := range tests {
+		if got := scorer.Weight(tt.path); got != tt.want {
+			t.Errorf("Weight(%q) = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+
+	drift := &ConfigDrift{Differences: []ConfigDifference{{Path: "sys.device.name"}, {Path: "mqtt.enable"}}}
+	scorer.Score(drift)
+	if drift.Score != 60 || drift.Severity != DriftSeverityHigh || drift.Differences[0].Weight != 5 {
+		t.Errorf("Expected the drift scored by its heaviest difference, got %d %s", drift.Score, drift.Severity)
+	}
+}
+
+func TestDetectDrift_Queue(t *testing.T) {
+	service, db := setupTestService(t)
+
+	devices := []Device{
+		{IP: "192.168.1.10", MAC: "00:11:22:33:44:55", Type: "Relay", Name: "Named"},
+		{IP: "192.168.1.11", MAC: "00:11:22:33:44:56", Type: "Relay", Name: "Addressed"},
+	}
+	for i := range devices {
+		require.NoError(t, db.Create(&devices[i]).Error)
+		stored := DeviceConfig{DeviceID: devices[i].ID, Config: json.RawMessage(`{"name":"a","wifi":{"sta":{"ip":"10.0.0.2"}}}`), SyncStatus: "synced"}
+		require.NoError(t, db.Create(&stored).Error)
+	}
+
+	var notified []*ConfigDrift
+	service.SetDriftNotifier(func(ctx context.Context, drift *ConfigDrift) {
+		notified = append(notified, drift)
+	})
+
+	rename := &mockShellyClient{}
+	rename.On("GetInfo", mock.Anything).Return(&shelly.DeviceInfo{Generation: 2, Model: "mock"}, nil)
+	rename.On("GetConfig", mock.Anything).Return(&shelly.DeviceConfig{Raw: json.RawMessage(`{"name":"b","wifi":{"sta":{"ip":"10.0.0.2"}}}`)}, nil)
+	readdress := &mockShellyClient{}
+	readdress.On("GetInfo", mock.Anything).Return(&shelly.DeviceInfo{Generation: 2, Model: "mock"}, nil)
+	readdress.On("GetConfig", mock.Anything).Return(&shelly.DeviceConfig{Raw: json.RawMessage(`{"name":"a","wifi":{"sta":{"ip":"10.0.0.9"}}}`)}, nil)
+
+	drift, err := service.DetectDrift(devices[0].ID, rename)
+	require.NoError(t, err)
+	require.Equal(t, DriftSeverityLow, drift.Severity)
+	drift, err = service.DetectDrift(devices[1].ID, readdress)
+	require.NoError(t, err)
+	require.Equal(t, DriftSeverityCritical, drift.Severity)
+	require.Len(t, notified, 2)
+	require.Equal(t, 90, notified[1].Score)
+
+	queue, err := service.GetDriftQueue("", 0)
+	require.NoError(t, err)
+	require.Len(t, queue, 2)
+	require.Equal(t, devices[1].ID, queue[0].DeviceID, "the static IP change comes first")
+	require.Equal(t, "wifi.sta.ip", queue[0].TopPath)
+
+	queue, err = service.GetDriftQueue(DriftSeverityMedium, 0)
+	require.NoError(t, err)
+	require.Len(t, queue, 1)
+	_, err = service.GetDriftQueue("urgent", 0)
+	require.True(t, errors.Is(err, ErrInvalidDriftQuery))
+
+	// A device back in sync leaves the queue
+	require.NoError(t, db.Model(&DeviceConfig{}).Where("device_id = ?", devices[1].ID).
+		Update("config", json.RawMessage(`{"name":"a","wifi":{"sta":{"ip":"10.0.0.9"}}}`)).Error)
+	drift, err = service.DetectDrift(devices[1].ID, readdress)
+	require.NoError(t, err)
+	require.Nil(t, drift)
+	queue, err = service.GetDriftQueue("", 0)
+	require.NoError(t, err)
+	require.Len(t, queue, 1)
+	require.Equal(t, devices[0].ID, queue[0].DeviceID)
+}
@@ -0,0 +1,195 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DriftTimeline is the drift history of one device, oldest event first
+type DriftTimeline struct {
+	DeviceID   uint                 `json:"device_id"`
+	Events     []DriftTimelineEvent `json:"events"`
+	Paths      []string             `json:"paths"` // every path in the events, for one lane each
+	Total      int                  `json:"total"`
+	Remediated int                  `json:"remediated"`
+	Open       int                  `json:"open"`
+}
+
+// DriftTimelineEvent groups the paths that started drifting in the same
+// detection run
+type DriftTimelineEvent struct {
+	Start       time.Time           `json:"start"`
+	End         *time.Time          `json:"end,omitempty"` // when remediated; unset while open
+	LastSeen    time.Time           `json:"last_seen"`
+	Severity    string              `json:"severity"` // most severe path
+	Paths       []DriftTimelinePath `json:"paths"`
+	Remediated  bool                `json:"remediated"`
+	Remediation *DriftRemediation   `json:"remediation,omitempty"`
+}
+
+// DriftTimelinePath is one drifted path of an event. Expected and Actual are
+// set while the device is still queued for remediation.
+type DriftTimelinePath struct {
+	TrendID     uint        `json:"trend_id"`
+	Path        string      `json:"path"`
+	Category    string      `json:"category"`
+	Severity    string      `json:"severity"`
+	Occurrences int         `json:"occurrences"`
+	LastSeen    time.Time   `json:"last_seen"`
+	Resolved    bool        `json:"resolved"`
+	ResolvedAt  *time.Time  `json:"resolved_at,omitempty"`
+	Expected    interface{} `json:"expected,omitempty"`
+	Actual      interface{} `json:"actual,omitempty"`
+}
+
+// DriftRemediation is the configuration change that ended a drift: an
+// export pushed the stored configuration to the device, an import accepted
+// the device's
+type DriftRemediation struct {
+	HistoryID uint      `json:"history_id"`
+	Action    string    `json:"action"`
+	ChangedBy string    `json:"changed_by"`
+	At        time.Time `json:"at"`
+}
+
+// driftTrendSeverityRank orders the severities of drift differences
+func driftTrendSeverityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 3
+	case "warning":
+		return 2
+	case "info":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// GetDriftTimeline joins the drift trends of a device with its
+// configuration history into a timeline. Trends first seen together form
+// one event; an event is remediated when all its paths are resolved or an
+// import or export followed its last sighting. since leaves out earlier
+// events; limit keeps the latest events, all when <= 0.
+func (s *Service) GetDriftTimeline(deviceID uint, since *time.Time, limit int) (*DriftTimeline, error) {
+	query := s.db.Model(&DriftTrend{}).Where("device_id = ?", deviceID)
+	if since != nil {
+		query = query.Where("first_seen >= ?", *since)
+	}
+	var trends []DriftTrend
+	if err := query.Order("first_seen ASC").Order("id ASC").Find(&trends).Error; err != nil {
+		return nil, fmt.Errorf("failed to load drift trends: %w", err)
+	}
+
+	timeline := &DriftTimeline{DeviceID: deviceID, Events: []DriftTimelineEvent{}, Paths: []string{}}
+	if len(trends) == 0 {
+		return timeline, nil
+	}
+
+	var history []ConfigHistory
+	if err := s.db.Model(&ConfigHistory{}).
+		Select("id", "device_id", "action", "changed_by", "created_at").
+		Where("device_id = ? AND action IN ? AND created_at >= ?", deviceID, []string{"import", "export"}, trends[0].FirstSeen).
+		Order("created_at ASC").Find(&history).Error; err != nil {
+		return nil, fmt.Errorf("failed to load configuration history: %w", err)
+	}
+
+	// Values of the drift still awaiting remediation
+	current := make(map[string]ConfigDifference)
+	var queued DriftQueueItem
+	if err := s.db.Where("device_id = ?", deviceID).Limit(1).Find(&queued).Error; err == nil && len(queued.Differences) > 0 {
+		var diffs []ConfigDifference
+		if err := json.Unmarshal(queued.Differences, &diffs); err == nil {
+			for _, d := range diffs {
+				current[d.Path] = d
+			}
+		}
+	}
+
+	for _, t := range trends {
+		start := t.FirstSeen.Truncate(time.Second)
+		if n := len(timeline.Events); n == 0 || !timeline.Events[n-1].Start.Equal(start) {
+			timeline.Events = append(timeline.Events, DriftTimelineEvent{Start: start})
+		}
+		event := &timeline.Events[len(timeline.Events)-1]
+		path := DriftTimelinePath{
+			TrendID:     t.ID,
+			Path:        t.Path,
+			Category:    t.Category,
+			Severity:    t.Severity,
+			Occurrences: t.Occurrences,
+			LastSeen:    t.LastSeen,
+			Resolved:    t.Resolved,
+			ResolvedAt:  t.ResolvedAt,
+		}
+		if d, ok := current[t.Path]; ok && !t.Resolved {
+			path.Expected = d.Expected
+			path.Actual = d.Actual
+		}
+		event.Paths = append(event.Paths, path)
+		if t.LastSeen.After(event.LastSeen) {
+			event.LastSeen = t.LastSeen
+		}
+		if driftTrendSeverityRank(t.Severity) > driftTrendSeverityRank(event.Severity) {
+			event.Severity = t.Severity
+		}
+	}
+
+	for i := range timeline.Events {
+		event := &timeline.Events[i]
+		for _, h := range history {
+			if !h.CreatedAt.Before(event.LastSeen) {
+				at := h.CreatedAt
+				event.Remediation = &DriftRemediation{HistoryID: h.ID, Action: h.Action, ChangedBy: h.ChangedBy, At: at}
+				event.End = &at
+				break
+			}
+		}
+		resolved := true
+		var resolvedAt *time.Time
+		for _, p := range event.Paths {
+			if !p.Resolved {
+				resolved = false
+				break
+			}
+			if p.ResolvedAt != nil && (resolvedAt == nil || p.ResolvedAt.After(*resolvedAt)) {
+				resolvedAt = p.ResolvedAt
+			}
+		}
+		if resolved && event.End == nil {
+			event.End = resolvedAt
+		}
+		event.Remediated = resolved || event.Remediation != nil
+		if event.Remediated {
+			timeline.Remediated++
+		} else {
+			timeline.Open++
+		}
+	}
+
+	if limit > 0 && len(timeline.Events) > limit {
+		for _, e := range timeline.Events[:len(timeline.Events)-limit] {
+			if e.Remediated {
+				timeline.Remediated--
+			} else {
+				timeline.Open--
+			}
+		}
+		timeline.Events = timeline.Events[len(timeline.Events)-limit:]
+	}
+	timeline.Total = len(timeline.Events)
+
+	seenPaths := make(map[string]bool)
+	for _, e := range timeline.Events {
+		for _, p := range e.Paths {
+			if !seenPaths[p.Path] {
+				seenPaths[p.Path] = true
+				timeline.Paths = append(timeline.Paths, p.Path)
+			}
+		}
+	}
+	sort.Strings(timeline.Paths)
+	return timeline, nil
+}
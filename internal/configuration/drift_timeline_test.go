@@ -0,0 +1,66 @@
+package configuration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDriftTimeline(t *testing.T) {
+	service, db := setupTestService(t)
+	createTestDevice(t, db, 1, "Kitchen", "SHSW-1")
+
+	base := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	resolvedAt := base.Add(2 * time.Hour)
+	trends := []DriftTrend{
+		// Remediated by an export
+		{DeviceID: 1, Path: "mqtt.user", Category: "mqtt", Severity: "critical", FirstSeen: base, LastSeen: base.Add(time.Hour), Occurrences: 2},
+		{DeviceID: 1, Path: "sys.device.name", Category: "system", Severity: "info", FirstSeen: base, LastSeen: base, Occurrences: 1},
+		// Resolved by a later detection
+		{DeviceID: 1, Path: "wifi.sta.ssid", Category: "network", Severity: "warning", FirstSeen: base.Add(90 * time.Minute), LastSeen: base.Add(90 * time.Minute), Occurrences: 1, Resolved: true, ResolvedAt: &resolvedAt},
+		// Still open
+		{DeviceID: 1, Path: "mqtt.server", Category: "mqtt", Severity: "critical", FirstSeen: base.Add(24 * time.Hour), LastSeen: base.Add(30 * time.Hour), Occurrences: 4},
+		{DeviceID: 2, Path: "mqtt.server", Category: "mqtt", Severity: "critical", FirstSeen: base, LastSeen: base, Occurrences: 1},
+	}
+	require.NoError(t, db.Create(&trends).Error)
+	require.NoError(t, db.Create(&ConfigHistory{DeviceID: 1, ConfigID: 1, Action: "export", ChangedBy: "operator", CreatedAt: base.Add(80 * time.Minute)}).Error)
+	require.NoError(t, db.Create(&ConfigHistory{DeviceID: 1, ConfigID: 1, Action: "sync", ChangedBy: "system", CreatedAt: base.Add(31 * time.Hour)}).Error)
+	require.NoError(t, db.Create(&DriftQueueItem{DeviceID: 1, Differences: []byte(`[{"path":"mqtt.server","expected":"broker.lan","actual":"10.0.0.9"}]`)}).Error)
+
+	timeline, err := service.GetDriftTimeline(1, nil, 0)
+	require.NoError(t, err)
+	require.Len(t, timeline.Events, 3)
+	assert.Equal(t, 3, timeline.Total)
+	assert.Equal(t, 2, timeline.Remediated)
+	assert.Equal(t, 1, timeline.Open)
+	assert.Equal(t, []string{"mqtt.server", "mqtt.user", "sys.device.name", "wifi.sta.ssid"}, timeline.Paths)
+
+	first := timeline.Events[0]
+	assert.Len(t, first.Paths, 2)
+	assert.Equal(t, "critical", first.Severity)
+	assert.True(t, first.Remediated)
+	require.NotNil(t, first.Remediation)
+	assert.Equal(t, "export", first.Remediation.Action)
+	assert.Nil(t, first.Paths[0].Expected, "only queued drift has current values")
+
+	second := timeline.Events[1]
+	assert.True(t, second.Remediated)
+	assert.Nil(t, second.Remediation)
+	require.NotNil(t, second.End)
+	assert.True(t, second.End.Equal(resolvedAt))
+
+	open := timeline.Events[2]
+	assert.False(t, open.Remediated)
+	assert.Nil(t, open.End)
+	assert.Equal(t, "broker.lan", open.Paths[0].Expected)
+	assert.Equal(t, "10.0.0.9", open.Paths[0].Actual)
+
+	since := base.Add(time.Hour)
+	timeline, err = service.GetDriftTimeline(1, &since, 1)
+	require.NoError(t, err)
+	require.Len(t, timeline.Events, 1)
+	assert.Equal(t, 1, timeline.Open)
+	assert.Equal(t, 0, timeline.Remediated)
+}
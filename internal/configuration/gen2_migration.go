@@ -0,0 +1,465 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Gen2RPCCall is one RPC call that applies part of a migrated configuration
+type Gen2RPCCall struct {
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// UnmappedSetting is a Gen1 setting the migration cannot carry over
+type UnmappedSetting struct {
+	Setting string `json:"setting"`
+	Reason  string `json:"reason"`
+}
+
+// Gen2Migration is a stored Gen1 configuration translated into the Gen2 RPC
+// calls that reproduce it on a replacement device
+type Gen2Migration struct {
+	Calls    []Gen2RPCCall     `json:"calls"`
+	Mapped   []string          `json:"mapped"`
+	Unmapped []UnmappedSetting `json:"unmapped"`
+}
+
+// Gen1 relay default_state and btn_type values and their Gen2 switch
+// equivalents
+var (
+	gen2InitialState = map[string]string{
+		"off":    "off",
+		"on":     "on",
+		"last":   "restore_last",
+		"switch": "match_input",
+	}
+	gen2InputMode = map[string]string{
+		"momentary": "momentary",
+		"toggle":    "follow",
+		"edge":      "flip",
+		"detached":  "detached",
+	}
+)
+
+// gen2WebhookEvents maps Gen1 action URL names to Gen2 webhook events
+var gen2WebhookEvents = map[string]string{
+	"out_on_url":           "switch.on",
+	"out_off_url":          "switch.off",
+	"btn_on_url":           "input.toggle_on",
+	"btn_off_url":          "input.toggle_off",
+	"shortpush_url":        "input.button_push",
+	"longpush_url":         "input.button_longpush",
+	"double_shortpush_url": "input.button_doublepush",
+}
+
+// gen1ScheduleRule matches a time-of-day rule such as "0730-01234-on": time,
+// weekdays with 0 for Monday, and the action
+var gen1ScheduleRule = regexp.MustCompile(`^(\d{2})(\d{2})-([0-6]+)-(on|off)$`)
+
+var gen2Weekdays = []string{"MON", "TUE", "WED", "THU", "FRI", "SAT", "SUN"}
+
+// MigrateGen1ToGen2 translates stored Gen1 /settings JSON into Gen2 RPC calls:
+// system, cloud, MQTT, switch and input configuration, schedules, and action
+// URLs as webhooks. Settings with no Gen2 equivalent, or whose secrets Gen1
+// does not return, are reported as unmapped rather than guessed. Wi-Fi comes
+// last so a network change cannot cut off the calls before it.
+func MigrateGen1ToGen2(settings json.RawMessage) (*Gen2Migration, error) {
+	var gen1 map[string]interface{}
+	if err := json.Unmarshal(settings, &gen1); err != nil {
+		return nil, fmt.Errorf("failed to parse Gen1 settings: %w", err)
+	}
+
+	m := &gen2Migrator{
+		gen1:      gen1,
+		migration: &Gen2Migration{Calls: []Gen2RPCCall{}, Mapped: []string{}, Unmapped: []UnmappedSetting{}},
+	}
+	m.migrateSys()
+	m.migrateCloud()
+	m.migrateMQTT()
+	m.migrateAuth()
+	m.migrateRelays()
+	m.migrateActions()
+	m.migration.Calls = append(m.migration.Calls, m.schedules...)
+	m.migration.Calls = append(m.migration.Calls, m.webhooks...)
+	m.reportUnsupported()
+	m.migrateWiFi()
+	return m.migration, nil
+}
+
+type gen2Migrator struct {
+	gen1      map[string]interface{}
+	migration *Gen2Migration
+	schedules []Gen2RPCCall
+	webhooks  []Gen2RPCCall
+}
+
+func (m *gen2Migrator) call(method string, params map[string]interface{}) {
+	m.migration.Calls = append(m.migration.Calls, Gen2RPCCall{Method: method, Params: params})
+}
+
+func (m *gen2Migrator) mapped(setting string) {
+	m.migration.Mapped = append(m.migration.Mapped, setting)
+}
+
+func (m *gen2Migrator) unmapped(setting, reason string) {
+	m.migration.Unmapped = append(m.migration.Unmapped, UnmappedSetting{Setting: setting, Reason: reason})
+}
+
+func (m *gen2Migrator) migrateSys() {
+	sys := map[string]interface{}{}
+	device := map[string]interface{}{}
+	if name, ok := m.gen1["name"].(string); ok && name != "" {
+		device["name"] = name
+		m.mapped("name")
+	}
+	if eco, ok := m.gen1["eco_mode_enabled"].(bool); ok {
+		device["eco_mode"] = eco
+		m.mapped("eco_mode_enabled")
+	}
+	if discoverable, ok := m.gen1["discoverable"].(bool); ok {
+		device["discoverable"] = discoverable
+		m.mapped("discoverable")
+	}
+	if len(device) > 0 {
+		sys["device"] = device
+	}
+
+	location := map[string]interface{}{}
+	if tz, ok := m.gen1["timezone"].(string); ok && tz != "" {
+		location["tz"] = tz
+		m.mapped("timezone")
+	}
+	if lat, ok := m.gen1["lat"].(float64); ok {
+		location["lat"] = lat
+		m.mapped("lat")
+	}
+	if lng, ok := m.gen1["lng"].(float64); ok {
+		location["lon"] = lng
+		m.mapped("lng")
+	}
+	if len(location) > 0 {
+		sys["location"] = location
+	}
+
+	if sntp, ok := m.gen1["sntp"].(map[string]interface{}); ok {
+		if server, ok := sntp["server"].(string); ok && server != "" {
+			sys["sntp"] = map[string]interface{}{"server": server}
+			m.mapped("sntp.server")
+		}
+	}
+
+	if len(sys) > 0 {
+		m.call("Sys.SetConfig", map[string]interface{}{"config": sys})
+	}
+}
+
+func (m *gen2Migrator) migrateCloud() {
+	cloud, ok := m.gen1["cloud"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if enabled, ok := cloud["enabled"].(bool); ok {
+		m.call("Cloud.SetConfig", map[string]interface{}{"config": map[string]interface{}{"enable": enabled}})
+		m.mapped("cloud.enabled")
+	}
+}
+
+func (m *gen2Migrator) migrateMQTT() {
+	mqtt, ok := m.gen1["mqtt"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	enabled, _ := mqtt["enable"].(bool)
+	config := map[string]interface{}{"enable": enabled}
+	m.mapped("mqtt.enable")
+	if !enabled {
+		m.call("MQTT.SetConfig", map[string]interface{}{"config": config})
+		return
+	}
+
+	if server, ok := mqtt["server"].(string); ok && server != "" {
+		config["server"] = server
+		m.mapped("mqtt.server")
+	}
+	if user, ok := mqtt["user"].(string); ok && user != "" {
+		config["user"] = user
+		m.mapped("mqtt.user")
+		if pass, ok := mqtt["pass"].(string); ok && pass != "" {
+			config["pass"] = pass
+			m.mapped("mqtt.pass")
+		} else {
+			m.unmapped("mqtt.pass", "Gen1 settings do not return the MQTT password; set it on the new device")
+		}
+	}
+	if id, ok := mqtt["id"].(string); ok && id != "" {
+		config["client_id"] = id
+		m.mapped("mqtt.id")
+		m.unmapped("mqtt.topics", fmt.Sprintf("Gen2 publishes under <topic_prefix>/status and <topic_prefix>/events instead of shellies/%s/...; update subscribers", id))
+	}
+	for _, key := range []string{"clean_session", "keep_alive", "max_qos", "retain", "update_period"} {
+		if _, ok := mqtt[key]; ok {
+			m.unmapped("mqtt."+key, "no Gen2 equivalent")
+		}
+	}
+	m.call("MQTT.SetConfig", map[string]interface{}{"config": config})
+}
+
+func (m *gen2Migrator) migrateAuth() {
+	login, ok := m.gen1["login"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if enabled, _ := login["enabled"].(bool); enabled {
+		m.unmapped("login", "Gen2 authentication is digest based with the fixed user admin and is set with Shelly.SetAuth; set the password through the device auth endpoint")
+	}
+}
+
+func (m *gen2Migrator) migrateRelays() {
+	relays, _ := m.gen1["relays"].([]interface{})
+	maxPower, hasMaxPower := m.gen1["max_power"].(float64)
+	for i, item := range relays {
+		relay, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		prefix := fmt.Sprintf("relays[%d]", i)
+		config := map[string]interface{}{}
+
+		if name, ok := relay["name"].(string); ok && name != "" {
+			config["name"] = name
+			m.mapped(prefix + ".name")
+		}
+		if state, ok := relay["default_state"].(string); ok {
+			if mapped, known := gen2InitialState[state]; known {
+				config["initial_state"] = mapped
+				m.mapped(prefix + ".default_state")
+			} else {
+				m.unmapped(prefix+".default_state", fmt.Sprintf("unknown default state %q", state))
+			}
+		}
+		if delay, ok := relay["auto_on"].(float64); ok {
+			config["auto_on"] = delay > 0
+			config["auto_on_delay"] = delay
+			m.mapped(prefix + ".auto_on")
+		}
+		if delay, ok := relay["auto_off"].(float64); ok {
+			config["auto_off"] = delay > 0
+			config["auto_off_delay"] = delay
+			m.mapped(prefix + ".auto_off")
+		}
+		if hasMaxPower && maxPower > 0 {
+			config["power_limit"] = maxPower
+		}
+
+		input := map[string]interface{}{}
+		if btnType, ok := relay["btn_type"].(string); ok {
+			if mode, known := gen2InputMode[btnType]; known {
+				config["in_mode"] = mode
+				if mode == "momentary" {
+					input["type"] = "button"
+				} else {
+					input["type"] = "switch"
+				}
+				m.mapped(prefix + ".btn_type")
+			} else {
+				m.unmapped(prefix+".btn_type", fmt.Sprintf("button type %q has no Gen2 switch input mode", btnType))
+			}
+		}
+		if reverse, ok := relay["btn_reverse"].(float64); ok {
+			input["invert"] = reverse != 0
+			m.mapped(prefix + ".btn_reverse")
+		}
+
+		if len(config) > 0 {
+			m.call("Switch.SetConfig", map[string]interface{}{"id": i, "config": config})
+		}
+		if len(input) > 0 {
+			m.call("Input.SetConfig", map[string]interface{}{"id": i, "config": input})
+		}
+
+		m.migrateSchedules(i, prefix, relay)
+		for _, name := range sortedKeys(gen2WebhookEvents) {
+			if url, ok := relay[name].(string); ok && url != "" {
+				m.webhook(prefix+"."+name, name, i, []string{url}, true)
+			}
+		}
+	}
+	if hasMaxPower && maxPower > 0 {
+		if len(relays) > 0 {
+			m.mapped("max_power")
+		} else {
+			m.unmapped("max_power", "no relay to carry the power limit")
+		}
+	}
+}
+
+// migrateSchedules turns a relay's schedule rules into Schedule.Create calls
+// that switch it. Schedules and webhooks are queued and applied after the
+// component configuration.
+func (m *gen2Migrator) migrateSchedules(id int, prefix string, relay map[string]interface{}) {
+	rules, _ := relay["schedule_rules"].([]interface{})
+	enabled, _ := relay["schedule"].(bool)
+	for j, item := range rules {
+		setting := fmt.Sprintf("%s.schedule_rules[%d]", prefix, j)
+		rule, _ := item.(string)
+		parts := gen1ScheduleRule.FindStringSubmatch(rule)
+		if parts == nil {
+			m.unmapped(setting, fmt.Sprintf("unsupported schedule rule %q; only HHMM rules are translated", rule))
+			continue
+		}
+		days := make([]string, 0, len(parts[3]))
+		for _, d := range parts[3] {
+			days = append(days, gen2Weekdays[d-'0'])
+		}
+		m.schedules = append(m.schedules, Gen2RPCCall{
+			Method: "Schedule.Create",
+			Params: map[string]interface{}{
+				"enable":   enabled,
+				"timespec": fmt.Sprintf("0 %s %s * * %s", parts[2], parts[1], strings.Join(days, ",")),
+				"calls": []interface{}{map[string]interface{}{
+					"method": "Switch.Set",
+					"params": map[string]interface{}{"id": id, "on": parts[4] == "on"},
+				}},
+			},
+		})
+		m.mapped(setting)
+	}
+}
+
+// migrateActions translates the action URLs of /settings/actions, when the
+// stored configuration includes them, into webhooks
+func (m *gen2Migrator) migrateActions() {
+	actions, _ := m.gen1["actions"].(map[string]interface{})
+	for _, name := range sortedKeys(actions) {
+		entries, _ := actions[name].([]interface{})
+		for j, item := range entries {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			setting := fmt.Sprintf("actions.%s[%d]", name, j)
+			var urls []string
+			list, _ := entry["urls"].([]interface{})
+			for _, u := range list {
+				switch v := u.(type) {
+				case string:
+					urls = append(urls, v)
+				case map[string]interface{}:
+					if url, ok := v["url"].(string); ok {
+						urls = append(urls, url)
+					}
+				}
+			}
+			if len(urls) == 0 {
+				continue
+			}
+			index, _ := entry["index"].(float64)
+			enabled, _ := entry["enabled"].(bool)
+			m.webhook(setting, name, int(index), urls, enabled)
+		}
+	}
+}
+
+func (m *gen2Migrator) webhook(setting, action string, cid int, urls []string, enabled bool) {
+	event, ok := gen2WebhookEvents[action]
+	if !ok {
+		m.unmapped(setting, fmt.Sprintf("action %s has no Gen2 webhook event", action))
+		return
+	}
+	m.webhooks = append(m.webhooks, Gen2RPCCall{
+		Method: "Webhook.Create",
+		Params: map[string]interface{}{
+			"cid":    cid,
+			"enable": enabled,
+			"event":  event,
+			"name":   action,
+			"urls":   urls,
+		},
+	})
+	m.mapped(setting)
+}
+
+// reportUnsupported lists Gen1 settings the migration does not translate
+func (m *gen2Migrator) reportUnsupported() {
+	if coiot, ok := m.gen1["coiot"].(map[string]interface{}); ok {
+		if enabled, _ := coiot["enabled"].(bool); enabled {
+			m.unmapped("coiot", "Gen2 devices have no CoIoT; use MQTT or the outbound WebSocket")
+		}
+	}
+	for _, key := range []string{"rollers", "lights"} {
+		if list, ok := m.gen1[key].([]interface{}); ok && len(list) > 0 {
+			m.unmapped(key, "cover and light settings differ per model; configure them on the new device")
+		}
+	}
+	for _, key := range []string{"led_status_disable", "led_power_disable"} {
+		if _, ok := m.gen1[key]; ok {
+			m.unmapped(key, "LED settings are model specific on Gen2")
+		}
+	}
+}
+
+func (m *gen2Migrator) migrateWiFi() {
+	config := map[string]interface{}{}
+
+	if sta, ok := m.gen1["wifi_sta"].(map[string]interface{}); ok {
+		key, _ := sta["key"].(string)
+		if enabled, _ := sta["enabled"].(bool); enabled && key == "" {
+			// Without the password the SSID cannot be set safely; the new
+			// device keeps the network it was provisioned on
+			m.unmapped("wifi_sta", "Gen1 settings do not return the Wi-Fi password; the new device keeps the network it joined during provisioning")
+		} else if enabled {
+			staConfig := map[string]interface{}{"enable": true, "pass": key}
+			if ssid, ok := sta["ssid"].(string); ok {
+				staConfig["ssid"] = ssid
+			}
+			if method, _ := sta["ipv4_method"].(string); method == "static" {
+				staConfig["ipv4mode"] = "static"
+				copyString(sta, staConfig, "ip", "ip")
+				copyString(sta, staConfig, "mask", "netmask")
+				copyString(sta, staConfig, "netmask", "netmask")
+				copyString(sta, staConfig, "gw", "gw")
+				copyString(sta, staConfig, "dns", "nameserver")
+			} else {
+				staConfig["ipv4mode"] = "dhcp"
+			}
+			config["sta"] = staConfig
+			m.mapped("wifi_sta")
+		}
+	}
+
+	if ap, ok := m.gen1["wifi_ap"].(map[string]interface{}); ok {
+		if enabled, ok := ap["enabled"].(bool); ok {
+			apConfig := map[string]interface{}{"enable": enabled}
+			if key, ok := ap["key"].(string); ok && enabled {
+				apConfig["pass"] = key
+				apConfig["is_open"] = key == ""
+			}
+			config["ap"] = apConfig
+			m.mapped("wifi_ap")
+		}
+	}
+
+	if len(config) > 0 {
+		m.call("WiFi.SetConfig", map[string]interface{}{"config": config})
+	}
+}
+
+// copyString copies a non-empty string from src[from] to dst[to]
+func copyString(src, dst map[string]interface{}, from, to string) {
+	if v, ok := src[from].(string); ok && v != "" {
+		dst[to] = v
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
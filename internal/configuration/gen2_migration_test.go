@@ -0,0 +1,119 @@
+package configuration
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestMigrateGen1ToGen2(t *testing.T) {
+	settings := json.RawMessage(`{
+		"name": "Hallway",
+		"timezone": "Europe/Brussels",
+		"sntp": {"server": "pool.ntp.org"},
+		"wifi_sta": {"enabled": true, "ssid": "Home", "ipv4_method": "static", "ip": "10.0.0.5", "mask": "255.255.255.0", "gw": "10.0.0.1"},
+		"mqtt": {"enable": true, "server": "10.0.0.2:1883", "user": "shelly", "id": "shelly1-ABC", "keep_alive": 60},
+		"login": {"enabled": true, "username": "admin"},
+		"cloud": {"enabled": false},
+		"relays": [{
+			"name": "Light",
+			"default_state": "last",
+			"btn_type": "edge",
+			"auto_off": 300,
+			"schedule": true,
+			"schedule_rules": ["0730-01234-on", "sunset-0123456-off"],
+			"out_on_url": "http://10.0.0.9/on"
+		}],
+		"actions": {
+			"longpush_url": [{"index": 0, "enabled": true, "urls": ["http://10.0.0.9/long"]}],
+			"report_url": [{"index": 0, "enabled": true, "urls": ["http://10.0.0.9/report"]}]
+		}
+	}`)
+
+	migration, err := MigrateGen1ToGen2(settings)
+	if err != nil {
+		t.Fatalf("MigrateGen1ToGen2 failed: %v", err)
+	}
+
+	var methods []string
+	calls := map[string][]Gen2RPCCall{}
+	for _, c := range migration.Calls {
+		methods = append(methods, c.Method)
+		calls[c.Method] = append(calls[c.Method], c)
+	}
+	want := []string{"Sys.SetConfig", "Cloud.SetConfig", "MQTT.SetConfig", "Switch.SetConfig", "Input.SetConfig",
+		"Schedule.Create", "Webhook.Create", "Webhook.Create"}
+	if len(methods) != len(want) {
+		t.Fatalf("calls = %v, want %v", methods, want)
+	}
+	for i := range want {
+		if methods[i] != want[i] {
+			t.Fatalf("calls = %v, want %v", methods, want)
+		}
+	}
+
+	sw := calls["Switch.SetConfig"][0].Params["config"].(map[string]interface{})
+	if sw["name"] != "Light" || sw["initial_state"] != "restore_last" || sw["in_mode"] != "flip" ||
+		sw["auto_off"] != true || sw["auto_off_delay"] != float64(300) {
+		t.Errorf("unexpected switch config: %v", sw)
+	}
+	input := calls["Input.SetConfig"][0].Params["config"].(map[string]interface{})
+	if input["type"] != "switch" {
+		t.Errorf("edge button should need a switch input, got %v", input)
+	}
+	schedule := calls["Schedule.Create"][0].Params
+	if schedule["timespec"] != "0 30 07 * * MON,TUE,WED,THU,FRI" || schedule["enable"] != true {
+		t.Errorf("unexpected schedule: %v", schedule)
+	}
+	if ev := calls["Webhook.Create"][0].Params["event"]; ev != "switch.on" {
+		t.Errorf("relay action URL event = %v, want switch.on", ev)
+	}
+	if ev := calls["Webhook.Create"][1].Params["event"]; ev != "input.button_longpush" {
+		t.Errorf("long push event = %v, want input.button_longpush", ev)
+	}
+
+	unmapped := map[string]bool{}
+	for _, u := range migration.Unmapped {
+		unmapped[u.Setting] = true
+	}
+	for _, setting := range []string{"login", "mqtt.pass", "mqtt.keep_alive", "wifi_sta",
+		"relays[0].schedule_rules[1]", "actions.report_url[0]"} {
+		if !unmapped[setting] {
+			t.Errorf("expected %s to be reported as unmapped, got %v", setting, migration.Unmapped)
+		}
+	}
+	if _, ok := calls["WiFi.SetConfig"]; ok {
+		t.Error("Wi-Fi without a stored password must not be migrated")
+	}
+}
+
+func TestMigrateGen1ToGen2_Fixture(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/shplg_s_settings.json")
+	if err != nil {
+		t.Fatalf("failed to load test fixture: %v", err)
+	}
+	migration, err := MigrateGen1ToGen2(fixture)
+	if err != nil {
+		t.Fatalf("MigrateGen1ToGen2 failed: %v", err)
+	}
+
+	last := migration.Calls[len(migration.Calls)-1]
+	if last.Method != "WiFi.SetConfig" {
+		t.Fatalf("Wi-Fi should be applied last, got %s", last.Method)
+	}
+	sta := last.Params["config"].(map[string]interface{})["sta"].(map[string]interface{})
+	if sta["ssid"] != "MyHomeNetwork" || sta["pass"] != "mypassword123" || sta["ipv4mode"] != "dhcp" {
+		t.Errorf("unexpected Wi-Fi config: %v", sta)
+	}
+	for _, c := range migration.Calls {
+		if c.Method == "Switch.SetConfig" {
+			if limit := c.Params["config"].(map[string]interface{})["power_limit"]; limit != float64(2500) {
+				t.Errorf("power_limit = %v, want 2500", limit)
+			}
+		}
+	}
+
+	if _, err := MigrateGen1ToGen2(json.RawMessage(`not json`)); err == nil {
+		t.Error("expected invalid settings to be rejected")
+	}
+}
@@ -0,0 +1,225 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Lint severities, from most to least severe. They match the drift severities.
+const (
+	LintCritical = "critical"
+	LintWarning  = "warning"
+	LintInfo     = "info"
+)
+
+// Lint rule identifiers
+const (
+	LintAuthDisabled    = "auth_disabled"
+	LintDefaultPassword = "default_password"
+	LintCloudEnabled    = "cloud_enabled"
+	LintEcoModeOff      = "eco_mode_off"
+	LintMaxPowerUnset   = "max_power_unset"
+)
+
+// LintFinding is a best-practice warning about a configuration. Unlike
+// validation errors it never blocks saving or applying the configuration.
+type LintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+// LintTarget describes the device a configuration belongs to
+type LintTarget struct {
+	DeviceType  string // Gen1 type or Gen2 model, e.g. SHPLG-S or SNPL-00112EU
+	Model       string // model reported by the device, when it differs from the type
+	AuthEnabled *bool  // from the device inventory when the configuration has no auth section
+}
+
+func (t LintTarget) plug() bool    { return IsPlugDevice(t.DeviceType) || IsPlugDevice(t.Model) }
+func (t LintTarget) battery() bool { return IsBatteryDevice(t.DeviceType) || IsBatteryDevice(t.Model) }
+
+// lintRule checks one best practice; it returns the offending field and a
+// message, or hit=false when the configuration complies or the rule does not
+// apply
+type lintRule struct {
+	id       string
+	severity string
+	check    func(cfg map[string]interface{}, target LintTarget) (field, message string, hit bool)
+}
+
+var lintRules = []lintRule{
+	{LintAuthDisabled, LintCritical, lintAuthDisabled},
+	{LintDefaultPassword, LintCritical, lintDefaultPassword},
+	{LintCloudEnabled, LintWarning, lintCloudEnabled},
+	{LintMaxPowerUnset, LintWarning, lintMaxPowerUnset},
+	{LintEcoModeOff, LintInfo, lintEcoModeOff},
+}
+
+// defaultPasswords are factory or commonly used passwords
+var defaultPasswords = map[string]bool{
+	"admin": true, "password": true, "shelly": true, "12345678": true, "123456": true, "1234": true,
+}
+
+// LintConfiguration checks a stored configuration against best practices.
+// It understands typed configurations as well as raw Gen1 settings and Gen2
+// config documents. Findings are ordered from most to least severe.
+func LintConfiguration(config json.RawMessage, target LintTarget) ([]LintFinding, error) {
+	cfg := map[string]interface{}{}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid configuration JSON: %w", err)
+		}
+	}
+	findings := []LintFinding{}
+	for _, rule := range lintRules {
+		if field, message, hit := rule.check(cfg, target); hit {
+			findings = append(findings, LintFinding{Rule: rule.id, Severity: rule.severity, Field: field, Message: message})
+		}
+	}
+	return findings, nil
+}
+
+// LintSeverityRank orders severities; higher is more severe and unknown
+// severities rank lowest
+func LintSeverityRank(severity string) int {
+	switch severity {
+	case LintCritical:
+		return 3
+	case LintWarning:
+		return 2
+	case LintInfo:
+		return 1
+	}
+	return 0
+}
+
+func lintAuthDisabled(cfg map[string]interface{}, target LintTarget) (string, string, bool) {
+	field, enabled, ok := lintAuthEnabled(cfg)
+	if !ok && target.AuthEnabled != nil {
+		field, enabled, ok = "auth.enable", *target.AuthEnabled, true
+	}
+	if ok && !enabled {
+		return field, "Authentication is disabled; anyone on the network can control the device", true
+	}
+	return "", "", false
+}
+
+func lintDefaultPassword(cfg map[string]interface{}, _ LintTarget) (string, string, bool) {
+	if _, enabled, ok := lintAuthEnabled(cfg); ok && !enabled {
+		return "", "", false
+	}
+	for _, path := range [][]string{{"auth", "pass"}, {"login", "password"}} {
+		pass, ok := lintLookup(cfg, path...).(string)
+		if !ok || pass == "" {
+			continue
+		}
+		user, _ := lintLookup(cfg, path[0], "user").(string)
+		if user == "" {
+			user, _ = lintLookup(cfg, path[0], "username").(string)
+		}
+		if defaultPasswords[strings.ToLower(pass)] || (user != "" && pass == user) {
+			return strings.Join(path, "."), "Authentication uses a default or guessable password", true
+		}
+	}
+	return "", "", false
+}
+
+func lintCloudEnabled(cfg map[string]interface{}, _ LintTarget) (string, string, bool) {
+	for _, path := range [][]string{{"cloud", "enable"}, {"cloud", "enabled"}} {
+		if enabled, ok := lintLookup(cfg, path...).(bool); ok && enabled {
+			return strings.Join(path, "."), "Shelly Cloud is enabled; the device reports to a third-party service", true
+		}
+	}
+	return "", "", false
+}
+
+func lintMaxPowerUnset(cfg map[string]interface{}, target LintTarget) (string, string, bool) {
+	if !target.plug() {
+		return "", "", false
+	}
+	paths := [][]string{
+		{"max_power"},                   // Gen1 settings
+		{"relays", "0", "max_power"},    // Gen1 per relay
+		{"power_metering", "max_power"}, // typed
+		{"relay", "max_power_limit"},    // typed relay
+		{"switch:0", "power_limit"},     // Gen2
+	}
+	for _, path := range paths {
+		if v, ok := lintLookup(cfg, path...).(float64); ok && v > 0 {
+			return "", "", false
+		}
+	}
+	return "power_metering.max_power", "Plug has no maximum power limit; an overloaded socket will not switch off", true
+}
+
+func lintEcoModeOff(cfg map[string]interface{}, target LintTarget) (string, string, bool) {
+	if !target.battery() {
+		return "", "", false
+	}
+	for _, path := range [][]string{{"sys", "device", "eco_mode"}, {"system", "device", "eco_mode"}, {"eco_mode_enabled"}} {
+		if enabled, ok := lintLookup(cfg, path...).(bool); ok && !enabled {
+			return strings.Join(path, "."), "Eco mode is off on a battery powered device, which shortens battery life", true
+		}
+	}
+	return "", "", false
+}
+
+// lintAuthEnabled finds the authentication switch: typed auth.enable or
+// Gen1 login.enabled
+func lintAuthEnabled(cfg map[string]interface{}) (string, bool, bool) {
+	for _, path := range [][]string{{"auth", "enable"}, {"login", "enabled"}} {
+		if enabled, ok := lintLookup(cfg, path...).(bool); ok {
+			return strings.Join(path, "."), enabled, true
+		}
+	}
+	return "", false, false
+}
+
+// lintLookup walks a path of map keys and list indexes
+func lintLookup(v interface{}, path ...string) interface{} {
+	for _, key := range path {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// plugPrefixes and batteryPrefixes identify device families by Gen1 type or
+// Gen2+ model prefix
+var (
+	plugPrefixes    = []string{"SHPLG", "SNPL-", "S3PL-"}
+	batteryPrefixes = []string{"SHHT-", "SHWT-", "SHDW-", "SHBTN-", "SHMOS-", "SHTRV-", "SNSN-", "S3SN-"}
+)
+
+// IsPlugDevice reports whether a device type or model is a smart plug
+func IsPlugDevice(deviceType string) bool {
+	return hasAnyPrefix(strings.ToUpper(deviceType), plugPrefixes)
+}
+
+// IsBatteryDevice reports whether a device type or model runs on battery
+func IsBatteryDevice(deviceType string) bool {
+	return hasAnyPrefix(strings.ToUpper(deviceType), batteryPrefixes)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package configuration
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintConfiguration(t *testing.T) {
+	authOff := false
+	tests := []struct {
+		name   string
+		config string
+		target LintTarget
+		want   []string
+	}{
+		{
+			name:   "clean gen1 switch",
+			config: `{"login": {"enabled": true, "username": "admin"}, "cloud": {"enabled": false}}`,
+			target: LintTarget{DeviceType: "SHSW-1"},
+			want:   nil,
+		},
+		{
+			name:   "gen1 auth disabled and cloud enabled",
+			config: `{"login": {"enabled": false}, "cloud": {"enabled": true}}`,
+			target: LintTarget{DeviceType: "SHSW-1"},
+			want:   []string{LintAuthDisabled, LintCloudEnabled},
+		},
+		{
+			name:   "typed default password",
+			config: `{"auth": {"enable": true, "user": "admin", "pass": "admin"}}`,
+			target: LintTarget{DeviceType: "SHSW-25"},
+			want:   []string{LintDefaultPassword},
+		},
+		{
+			name:   "gen2 auth from inventory",
+			config: `{"cloud": {"enable": false}, "sys": {"device": {"name": "x"}}}`,
+			target: LintTarget{DeviceType: "SNSW-001X16EU", AuthEnabled: &authOff},
+			want:   []string{LintAuthDisabled},
+		},
+		{
+			name:   "plug without max power",
+			config: `{"login": {"enabled": true}, "max_power": 0}`,
+			target: LintTarget{DeviceType: "SHPLG-S"},
+			want:   []string{LintMaxPowerUnset},
+		},
+		{
+			name:   "gen2 plug with power limit",
+			config: `{"switch:0": {"power_limit": 2500}}`,
+			target: LintTarget{DeviceType: "unknown", Model: "SNPL-00112EU"},
+			want:   nil,
+		},
+		{
+			name:   "battery device with eco mode off",
+			config: `{"sys": {"device": {"eco_mode": false}}}`,
+			target: LintTarget{DeviceType: "SNSN-0013A"},
+			want:   []string{LintEcoModeOff},
+		},
+		{
+			name:   "eco mode off ignored on mains devices",
+			config: `{"sys": {"device": {"eco_mode": false}}}`,
+			target: LintTarget{DeviceType: "SNSW-001X16EU"},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := LintConfiguration(json.RawMessage(tt.config), tt.target)
+			require.NoError(t, err)
+			var rules []string
+			for _, f := range findings {
+				rules = append(rules, f.Rule)
+				assert.NotEmpty(t, f.Message)
+				assert.NotZero(t, LintSeverityRank(f.Severity))
+			}
+			assert.Equal(t, tt.want, rules)
+		})
+	}
+}
+
+func TestLintConfiguration_InvalidJSON(t *testing.T) {
+	_, err := LintConfiguration(json.RawMessage(`{`), LintTarget{})
+	assert.Error(t, err)
+}
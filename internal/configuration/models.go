@@ -3,6 +3,9 @@ package configuration
 import (
 	"encoding/json"
 	"time"
+
+	// Registers the serializer of encrypted columns
+	_ "github.com/ginsys/shelly-manager/internal/security/secrets"
 )
 
 // Device represents device information for configuration management
@@ -12,7 +15,7 @@ type Device struct {
 	IP       string    `json:"ip"`
 	Type     string    `json:"type"`
 	Name     string    `json:"name"`
-	Settings string    `json:"settings"`
+	Settings string    `json:"settings" gorm:"serializer:encrypted"`
 	LastSeen time.Time `json:"last_seen"`
 }
 
@@ -48,6 +51,7 @@ type ConfigTemplate struct {
 	Config     json.RawMessage `json:"config" gorm:"type:text;not null"`
 	Variables  json.RawMessage `json:"variables" gorm:"type:text"` // Variable definitions for template
 	IsDefault  bool            `json:"is_default"`                 // Default template for device type
+	Version    int             `json:"version" gorm:"default:1"`   // Bumped by every update, see ErrVersionConflict
 	CreatedAt  time.Time       `json:"created_at"`
 	UpdatedAt  time.Time       `json:"updated_at"`
 }
@@ -59,22 +63,30 @@ type DeviceConfig struct {
 	TemplateID *uint           `json:"template_id" gorm:"index"` // Optional template reference
 	Config     json.RawMessage `json:"config" gorm:"type:text"`
 	LastSynced *time.Time      `json:"last_synced"`
-	SyncStatus string          `json:"sync_status"` // "synced", "pending", "error", "drift"
+	SyncStatus string          `json:"sync_status"`              // "synced", "pending", "error", "drift"
+	Version    int             `json:"version" gorm:"default:1"` // Bumped by every edit, see ErrVersionConflict
 	CreatedAt  time.Time       `json:"created_at"`
 	UpdatedAt  time.Time       `json:"updated_at"`
 }
 
-// ConfigHistory tracks configuration changes
+// ConfigHistory tracks configuration changes. The old and new configurations
+// are stored as content-addressed ConfigBlobs; OldConfig and NewConfig are
+// written to and read from blobs by the GORM hooks in blobs.go.
 type ConfigHistory struct {
-	ID        uint            `json:"id" gorm:"primaryKey"`
-	DeviceID  uint            `json:"device_id" gorm:"index;not null"`
-	ConfigID  uint            `json:"config_id" gorm:"index;not null"`
-	Action    string          `json:"action"` // "import", "export", "sync", "manual"
-	OldConfig json.RawMessage `json:"old_config" gorm:"type:text"`
-	NewConfig json.RawMessage `json:"new_config" gorm:"type:text"`
-	Changes   json.RawMessage `json:"changes" gorm:"type:text"` // Diff between old and new
-	ChangedBy string          `json:"changed_by"`               // User or system
-	CreatedAt time.Time       `json:"created_at"`
+	ID            uint            `json:"id" gorm:"primaryKey"`
+	DeviceID      uint            `json:"device_id" gorm:"index;not null"`
+	ConfigID      uint            `json:"config_id" gorm:"index;not null"`
+	Action        string          `json:"action"` // "import", "export", "sync", "manual", "patch"
+	OldConfig     json.RawMessage `json:"old_config" gorm:"-"`
+	NewConfig     json.RawMessage `json:"new_config" gorm:"-"`
+	OldConfigHash string          `json:"old_config_hash,omitempty" gorm:"size:64;index"`
+	NewConfigHash string          `json:"new_config_hash,omitempty" gorm:"size:64;index"`
+	Changes       json.RawMessage `json:"changes" gorm:"type:text"` // Diff between old and new
+	ChangedBy     string          `json:"changed_by"`               // User or system
+	CreatedAt     time.Time       `json:"created_at"`
+
+	// Patch is the JSON Patch or Merge Patch a "patch" entry was made from
+	Patch json.RawMessage `json:"patch,omitempty" gorm:"type:text"`
 }
 
 // ConfigDrift represents detected configuration differences
@@ -85,6 +97,8 @@ type ConfigDrift struct {
 	DriftDetected  time.Time          `json:"drift_detected"`
 	Differences    []ConfigDifference `json:"differences"`
 	RequiresAction bool               `json:"requires_action"`
+	Score          int                `json:"score"`    // weight of the heaviest difference, 0-100
+	Severity       string             `json:"severity"` // "low", "medium", "high", "critical"
 }
 
 // ConfigDifference represents a single configuration difference
@@ -98,6 +112,7 @@ type ConfigDifference struct {
 	Description string      `json:"description"` // Human-readable description
 	Impact      string      `json:"impact"`      // Potential impact of this change
 	Suggestion  string      `json:"suggestion"`  // Recommended action
+	Weight      int         `json:"weight"`      // Drift score weight of the path, 0-100
 }
 
 // ImportStatus represents the import status for a device
@@ -351,6 +366,7 @@ type DeviceDriftAnalysis struct {
 	Generation        int                `json:"generation"`
 	Status            string             `json:"status"`         // "synced", "drift", "error"
 	DriftSeverity     string             `json:"drift_severity"` // "none", "low", "medium", "high", "critical"
+	DriftScore        int                `json:"drift_score"`    // see DriftScorer
 	TotalDifferences  int                `json:"total_differences"`
 	CriticalCount     int                `json:"critical_count"`
 	WarningCount      int                `json:"warning_count"`
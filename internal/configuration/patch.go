@@ -0,0 +1,457 @@
+package configuration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Media types of configuration patches
+const (
+	PatchTypeJSON  = "application/json-patch+json"  // RFC 6902
+	PatchTypeMerge = "application/merge-patch+json" // RFC 7386
+)
+
+var (
+	// ErrInvalidPatch is returned for a patch document that is not well formed
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPatchFailed is returned when a patch cannot be applied to the
+	// configuration, e.g. a path does not exist or a test operation fails
+	ErrPatchFailed = errors.New("patch could not be applied")
+	// ErrPatchedConfigInvalid is returned when the patched configuration does
+	// not pass validation; nothing is saved
+	ErrPatchedConfigInvalid = errors.New("patched configuration is invalid")
+)
+
+// ApplyPatch applies a JSON Patch or JSON Merge Patch, as named by
+// patchType, to a JSON document
+func ApplyPatch(doc json.RawMessage, patchType string, patch json.RawMessage) (json.RawMessage, error) {
+	switch patchType {
+	case PatchTypeJSON:
+		return ApplyJSONPatch(doc, patch)
+	case PatchTypeMerge:
+		return ApplyMergePatch(doc, patch)
+	default:
+		return nil, fmt.Errorf("%w: unsupported patch type %q", ErrInvalidPatch, patchType)
+	}
+}
+
+// PatchDeviceConfig applies a JSON Patch or JSON Merge Patch to the stored
+// configuration of a device. The patched configuration is validated before
+// it is saved; when it does not pass, the validation result is returned with
+// ErrPatchedConfigInvalid and nothing changes. The patch is kept in the
+// history entry.
+func (s *Service) PatchDeviceConfig(deviceID uint, patchType string, patch json.RawMessage) (*DeviceConfig, *ValidationResult, error) {
+	var config DeviceConfig
+	if err := s.db.Where("device_id = ?", deviceID).First(&config).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, fmt.Errorf("%w: device %d", ErrStoredConfigNotFound, deviceID)
+		}
+		return nil, nil, fmt.Errorf("failed to get stored config: %w", err)
+	}
+
+	patched, err := ApplyPatch(config.Config, patchType, patch)
+	if err != nil {
+		return nil, nil, err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(patched, &object); err != nil || object == nil {
+		return nil, nil, fmt.Errorf("%w: the patched configuration must be a JSON object", ErrPatchFailed)
+	}
+
+	var device Device
+	s.db.First(&device, deviceID)
+	var settings struct {
+		Gen int `json:"gen"`
+	}
+	_ = json.Unmarshal([]byte(device.Settings), &settings)
+	result := NewConfigurationValidator(ValidationLevelBasic, device.Type, settings.Gen, nil).ValidateConfiguration(patched)
+	if !result.Valid {
+		return nil, result, fmt.Errorf("%w: %s", ErrPatchedConfigInvalid, result.GetValidationSummary())
+	}
+
+	history := s.newHistory(deviceID, config.ID, "patch", config.Config, patched, "user")
+	history.Patch = patch
+
+	config.Config = patched
+	config.SyncStatus = "pending"
+	config.UpdatedAt = time.Now()
+	if err := s.saveDeviceConfig(&config); err != nil {
+		return nil, nil, err
+	}
+	s.saveHistory(&history)
+
+	s.logger.WithFields(map[string]any{
+		"device_id":  deviceID,
+		"patch_type": patchType,
+		"component":  "configuration",
+	}).Info("Patched device configuration")
+	return &config, result, nil
+}
+
+// ApplyMergePatch applies an RFC 7386 JSON Merge Patch: objects are merged
+// recursively, null removes a member and any other value replaces it
+func ApplyMergePatch(doc json.RawMessage, patch json.RawMessage) (json.RawMessage, error) {
+	target, err := decodePatchJSON(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+	p, err := decodePatchJSON(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = mergePatch(t[key], value)
+		}
+	}
+	return t
+}
+
+// jsonPatchOp is one operation of an RFC 6902 JSON Patch
+type jsonPatchOp struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch. The operations are applied
+// in order and the patch fails as a whole if any of them fails.
+func ApplyJSONPatch(doc json.RawMessage, patch json.RawMessage) (json.RawMessage, error) {
+	ops, err := parseJSONPatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	target, err := decodePatchJSON(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+	for i, op := range ops {
+		if target, err = applyJSONPatchOp(target, op); err != nil {
+			return nil, fmt.Errorf("%w: operation %d (%s %s): %v", ErrPatchFailed, i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+// parseJSONPatch checks the operations of a JSON Patch and their members
+func parseJSONPatch(patch json.RawMessage) ([]jsonPatchOp, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &raw); err != nil {
+		return nil, fmt.Errorf("%w: a JSON Patch is an array of operations", ErrInvalidPatch)
+	}
+	ops := make([]jsonPatchOp, 0, len(raw))
+	for i, members := range raw {
+		var op jsonPatchOp
+		if err := json.Unmarshal(members["op"], &op.Op); err != nil {
+			return nil, fmt.Errorf("%w: operation %d has no op", ErrInvalidPatch, i)
+		}
+		if err := json.Unmarshal(members["path"], &op.Path); err != nil {
+			return nil, fmt.Errorf("%w: operation %d has no path", ErrInvalidPatch, i)
+		}
+		switch op.Op {
+		case "add", "replace", "test":
+			value, ok := members["value"]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s operation %d has no value", ErrInvalidPatch, op.Op, i)
+			}
+			decoded, err := decodePatchJSON(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidPatch, i, err)
+			}
+			op.Value = decoded
+		case "move", "copy":
+			if err := json.Unmarshal(members["from"], &op.From); err != nil {
+				return nil, fmt.Errorf("%w: %s operation %d has no from", ErrInvalidPatch, op.Op, i)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("%w: operation %d has unknown op %q", ErrInvalidPatch, i, op.Op)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func applyJSONPatchOp(doc interface{}, op jsonPatchOp) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		return pointerAdd(doc, path, op.Value)
+	case "remove":
+		doc, _, err := pointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		if _, err := pointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return op.Value, nil
+		}
+		if doc, _, err = pointerRemove(doc, path); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, op.Value)
+	case "test":
+		current, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(current, op.Value) {
+			return nil, errors.New("test failed: value differs")
+		}
+		return doc, nil
+	}
+
+	from, err := parseJSONPointer(op.From)
+	if err != nil {
+		return nil, err
+	}
+	value, err := pointerGet(doc, from)
+	if err != nil {
+		return nil, err
+	}
+	if op.Op == "move" {
+		if op.Path == op.From {
+			return doc, nil
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("cannot move a value into itself")
+		}
+		if doc, _, err = pointerRemove(doc, from); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	}
+	// copy adds an independent duplicate
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	duplicate, err := decodePatchJSON(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return pointerAdd(doc, path, duplicate)
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into its reference
+// tokens; the empty pointer refers to the whole document
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	current := doc
+	for _, token := range path {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			current = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[i]
+		default:
+			return nil, fmt.Errorf("cannot look up %q in a scalar", token)
+		}
+	}
+	return current, nil
+}
+
+// pointerUpdate applies fn to the container holding the last token of path
+// and returns the document with the updated container
+func pointerUpdate(doc interface{}, path []string, fn func(container interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("member %q does not exist", path[0])
+		}
+		updated, err := pointerUpdate(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = updated
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := pointerUpdate(node[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = updated
+		return node, nil
+	default:
+		return nil, fmt.Errorf("cannot look up %q in a scalar", path[0])
+	}
+}
+
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(doc, path, func(container interface{}, key string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			node[key] = value
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a scalar", key)
+		}
+	})
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	var removed interface{}
+	updated, err := pointerUpdate(doc, path, func(container interface{}, key string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", key)
+			}
+			removed = value
+			delete(node, key)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove %q from a scalar", key)
+		}
+	})
+	return updated, removed, err
+}
+
+// arrayIndex parses an array index token. "-" and the array length refer to
+// the end of the array, which only an add may use.
+func arrayIndex(token string, length int, forAdd bool) (int, error) {
+	if token == "-" {
+		if forAdd {
+			return length, nil
+		}
+		return 0, errors.New("index - refers past the end of the array")
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > length || (i == length && !forAdd) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// decodePatchJSON decodes JSON keeping numbers as written, so large
+// integers survive the round trip
+func decodePatchJSON(data json.RawMessage) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// jsonEqual compares decoded JSON values, numbers by value
+func jsonEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, errA := av.Float64()
+		bf, errB := bv.Float64()
+		return errA == nil && errB == nil && af == bf
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			other, ok := bv[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
@@ -0,0 +1,118 @@
+package configuration
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	doc := json.RawMessage(`{"name":"Hall","wifi":{"ssid":"home","enable":true},"schedules":[1,2],"a~b":{"c/d":1}}`)
+
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"replace", `[{"op":"replace","path":"/wifi/ssid","value":"office"}]`,
+			`{"name":"Hall","wifi":{"ssid":"office","enable":true},"schedules":[1,2],"a~b":{"c/d":1}}`},
+		{"add and remove", `[{"op":"add","path":"/wifi/pass","value":"secret"},{"op":"remove","path":"/name"}]`,
+			`{"wifi":{"ssid":"home","enable":true,"pass":"secret"},"schedules":[1,2],"a~b":{"c/d":1}}`},
+		{"array insert and append", `[{"op":"add","path":"/schedules/0","value":0},{"op":"add","path":"/schedules/-","value":3}]`,
+			`{"name":"Hall","wifi":{"ssid":"home","enable":true},"schedules":[0,1,2,3],"a~b":{"c/d":1}}`},
+		{"move and copy", `[{"op":"copy","from":"/wifi/ssid","path":"/ssid"},{"op":"move","from":"/name","path":"/wifi/name"}]`,
+			`{"ssid":"home","wifi":{"ssid":"home","enable":true,"name":"Hall"},"schedules":[1,2],"a~b":{"c/d":1}}`},
+		{"escaped pointer", `[{"op":"replace","path":"/a~0b/c~1d","value":2}]`,
+			`{"name":"Hall","wifi":{"ssid":"home","enable":true},"schedules":[1,2],"a~b":{"c/d":2}}`},
+		{"passing test", `[{"op":"test","path":"/schedules/1","value":2.0},{"op":"remove","path":"/schedules/1"}]`,
+			`{"name":"Hall","wifi":{"ssid":"home","enable":true},"schedules":[1],"a~b":{"c/d":1}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyJSONPatch(doc, json.RawMessage(tt.patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+
+	failures := map[string]string{
+		"failing test":    `[{"op":"test","path":"/name","value":"Kitchen"}]`,
+		"missing member":  `[{"op":"replace","path":"/mqtt/server","value":"x"}]`,
+		"index too large": `[{"op":"add","path":"/schedules/5","value":1}]`,
+		"move into child": `[{"op":"move","from":"/wifi","path":"/wifi/inner"}]`,
+	}
+	for name, patch := range failures {
+		t.Run(name, func(t *testing.T) {
+			_, err := ApplyJSONPatch(doc, json.RawMessage(patch))
+			assert.ErrorIs(t, err, ErrPatchFailed)
+		})
+	}
+
+	malformed := map[string]string{
+		"not an array":  `{"op":"remove","path":"/name"}`,
+		"unknown op":    `[{"op":"merge","path":"/name"}]`,
+		"missing value": `[{"op":"add","path":"/x"}]`,
+		"missing from":  `[{"op":"copy","path":"/x"}]`,
+	}
+	for name, patch := range malformed {
+		t.Run(name, func(t *testing.T) {
+			_, err := ApplyJSONPatch(doc, json.RawMessage(patch))
+			assert.ErrorIs(t, err, ErrInvalidPatch)
+		})
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	doc := json.RawMessage(`{"name":"Hall","wifi":{"ssid":"home","enable":true},"tags":["a"],"id":12345678901234567}`)
+
+	got, err := ApplyMergePatch(doc, json.RawMessage(`{"name":null,"wifi":{"ssid":"office","ip":{"ipv4mode":"dhcp"}},"tags":["b"]}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"wifi":{"ssid":"office","enable":true,"ip":{"ipv4mode":"dhcp"}},"tags":["b"],"id":12345678901234567}`, string(got))
+	assert.Contains(t, string(got), "12345678901234567", "large integers must survive the round trip")
+
+	_, err = ApplyMergePatch(doc, json.RawMessage(`{"name":`))
+	assert.ErrorIs(t, err, ErrInvalidPatch)
+}
+
+func TestPatchDeviceConfig(t *testing.T) {
+	service, db := setupTestService(t)
+	createTestDevice(t, db, 1, "Test Device", "SHSW-1")
+	require.NoError(t, db.Create(&DeviceConfig{
+		DeviceID:   1,
+		Config:     json.RawMessage(`{"name":"Hall","wifi":{"ssid":"home"}}`),
+		SyncStatus: "synced",
+	}).Error)
+
+	patch := json.RawMessage(`[{"op":"replace","path":"/wifi/ssid","value":"office"}]`)
+	config, result, err := service.PatchDeviceConfig(1, PatchTypeJSON, patch)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.JSONEq(t, `{"name":"Hall","wifi":{"ssid":"office"}}`, string(config.Config))
+	assert.Equal(t, "pending", config.SyncStatus)
+	assert.Equal(t, 2, config.Version)
+
+	var history []ConfigHistory
+	require.NoError(t, db.Where("device_id = ?", 1).Find(&history).Error)
+	require.Len(t, history, 1)
+	assert.Equal(t, "patch", history[0].Action)
+	assert.JSONEq(t, string(patch), string(history[0].Patch))
+	assert.Contains(t, string(history[0].Changes), "wifi.ssid")
+
+	// A patch producing an invalid configuration is refused and not saved
+	_, result, err = service.PatchDeviceConfig(1, PatchTypeMerge, json.RawMessage(`{"wifi":{"ssid":"this-ssid-is-far-too-long-for-any-device"}}`))
+	assert.ErrorIs(t, err, ErrPatchedConfigInvalid)
+	require.NotNil(t, result)
+	assert.False(t, result.Valid)
+	stored, err := service.GetDeviceConfig(1)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"Hall","wifi":{"ssid":"office"}}`, string(stored.Config))
+
+	// Replacing the document with a non-object is refused
+	_, _, err = service.PatchDeviceConfig(1, PatchTypeMerge, json.RawMessage(`"text"`))
+	assert.ErrorIs(t, err, ErrPatchFailed)
+
+	_, _, err = service.PatchDeviceConfig(2, PatchTypeMerge, json.RawMessage(`{}`))
+	assert.ErrorIs(t, err, ErrStoredConfigNotFound)
+}
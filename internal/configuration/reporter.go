@@ -6,10 +6,10 @@ import (
 	"math"
 	"sort"
 	"strings"
-	"time"
 
 	"gorm.io/gorm"
 
+	"github.com/ginsys/shelly-manager/internal/clock"
 	"github.com/ginsys/shelly-manager/internal/logging"
 )
 
@@ -17,6 +17,7 @@ import (
 type Reporter struct {
 	db     *gorm.DB
 	logger *logging.Logger
+	clock  clock.Clock
 }
 
 // NewReporter creates a new drift reporter
@@ -24,6 +25,7 @@ func NewReporter(db *gorm.DB, logger *logging.Logger) *Reporter {
 	return &Reporter{
 		db:     db,
 		logger: logger,
+		clock:  clock.Real,
 	}
 }
 
@@ -41,8 +43,8 @@ func (r *Reporter) GenerateComprehensiveReport(reportType string, deviceID *uint
 		ReportType:  reportType,
 		DeviceID:    deviceID,
 		ScheduleID:  scheduleID,
-		GeneratedAt: time.Now(),
-		CreatedAt:   time.Now(),
+		GeneratedAt: r.clock.Now(),
+		CreatedAt:   r.clock.Now(),
 	}
 
 	// Analyze devices and generate comprehensive analysis
@@ -189,7 +191,7 @@ func (r *Reporter) analyzeDeviceResult(result DriftResult, deviceMap map[uint]*D
 		DeviceName:        result.DeviceName,
 		DeviceIP:          result.DeviceIP,
 		Status:            result.Status,
-		DriftDetectedTime: time.Now(),
+		DriftDetectedTime: r.clock.Now(),
 		Error:             result.Error,
 	}
 
@@ -228,6 +230,11 @@ func (r *Reporter) analyzeDeviceResult(result DriftResult, deviceMap map[uint]*D
 		device.HealthScore = r.calculateHealthScore(device)
 		device.RiskLevel = r.determineRiskLevel(device)
 		device.DriftSeverity = r.calculateDriftSeverity(device)
+		// A scored drift takes its severity from its weighted paths
+		if result.Drift.Severity != "" {
+			device.DriftScore = result.Drift.Score
+			device.DriftSeverity = result.Drift.Severity
+		}
 	} else {
 		device.HealthScore = 100.0
 		device.RiskLevel = "low"
@@ -270,7 +277,9 @@ func (r *Reporter) categorizeDifference(path, diffType string) (category, severi
 	if strings.Contains(path, "wifi") || strings.Contains(path, "ip") ||
 		strings.Contains(path, "network") || strings.Contains(path, "mqtt") ||
 		strings.Contains(path, "cloud") {
-		if strings.Contains(path, "ip") || strings.Contains(path, "wifi.sta.ssid") {
+		// Toggling range extender mode cuts off the devices bridged through it
+		if strings.Contains(path, "ip") || strings.Contains(path, "wifi.sta.ssid") ||
+			strings.Contains(path, "range_extender") {
 			return "network", "warning"
 		}
 		return "network", "info"
@@ -589,7 +598,7 @@ func (r *Reporter) getTopCommonDrifts(patterns map[string]*CommonDrift, limit in
 
 // updateDriftTrends tracks drift patterns over time
 func (r *Reporter) updateDriftTrends(devices []DeviceDriftAnalysis) error {
-	now := time.Now()
+	now := r.clock.Now()
 
 	for _, device := range devices {
 		for _, diff := range device.Differences {
@@ -757,7 +766,7 @@ func (r *Reporter) GetDriftTrends(deviceID *uint, resolved *bool, limit int) ([]
 
 // MarkTrendResolved marks a drift trend as resolved
 func (r *Reporter) MarkTrendResolved(trendID uint) error {
-	now := time.Now()
+	now := r.clock.Now()
 	result := r.db.Model(&DriftTrend{}).Where("id = ?", trendID).Updates(map[string]interface{}{
 		"resolved":    true,
 		"resolved_at": &now,
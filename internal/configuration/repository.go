@@ -26,6 +26,7 @@ type DbConfigTemplate struct {
 	Scope       string          `gorm:"size:191;not null;index" json:"scope"`
 	DeviceType  string          `gorm:"size:191;index" json:"device_type,omitempty"`
 	Config      json.RawMessage `gorm:"type:text;not null" json:"config"`
+	Version     int             `gorm:"default:1" json:"version"`
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
 }
@@ -110,7 +111,15 @@ func (r *GormConfigRepository) GetTemplate(id uint) (*ServiceConfigTemplate, err
 	return dbTemplateToService(&dbTemplate), nil
 }
 
+// UpdateTemplate writes a template if it is still at template.Version and
+// bumps the version; a zero version updates whatever is stored
 func (r *GormConfigRepository) UpdateTemplate(template *ServiceConfigTemplate) error {
+	version := template.Version
+	if version == 0 {
+		if err := r.db.Model(&DbConfigTemplate{}).Where("id = ?", template.ID).Select("version").Scan(&version).Error; err != nil {
+			return fmt.Errorf("failed to update template: %w", err)
+		}
+	}
 	dbTemplate := &DbConfigTemplate{
 		ID:          template.ID,
 		Name:        template.Name,
@@ -118,13 +127,14 @@ func (r *GormConfigRepository) UpdateTemplate(template *ServiceConfigTemplate) e
 		Scope:       template.Scope,
 		DeviceType:  template.DeviceType,
 		Config:      template.Config,
+		Version:     version + 1,
 	}
 
-	result := r.db.Save(dbTemplate)
-	if result.Error != nil {
-		return fmt.Errorf("failed to update template: %w", result.Error)
+	if err := updateIfVersion(r.db, dbTemplate, version); err != nil {
+		return fmt.Errorf("failed to update template: %w", err)
 	}
 
+	template.Version = dbTemplate.Version
 	template.UpdatedAt = dbTemplate.UpdatedAt
 	return nil
 }
@@ -325,6 +335,7 @@ func dbTemplateToService(t *DbConfigTemplate) *ServiceConfigTemplate {
 		Scope:       t.Scope,
 		DeviceType:  t.DeviceType,
 		Config:      t.Config,
+		Version:     t.Version,
 		CreatedAt:   t.CreatedAt,
 		UpdatedAt:   t.UpdatedAt,
 	}
@@ -24,7 +24,9 @@ import (
 // propagated as an error through the service layer.
 var ErrSchedulingNotImplemented = errors.New("drift schedule execution is not implemented in this release")
 
-// Scheduler manages automated drift detection schedules
+// Scheduler manages automated drift detection schedules. It is not started
+// yet (see ErrSchedulingNotImplemented); whoever wires it must run schedules
+// only on the instance holding the cluster scheduler lease.
 type Scheduler struct {
 	db           *gorm.DB
 	service      *Service
@@ -159,7 +161,7 @@ func (s *Scheduler) executeSchedule(scheduleID uint) {
 	run := DriftDetectionRun{
 		ScheduleID: scheduleID,
 		Status:     "running",
-		StartedAt:  time.Now(),
+		StartedAt:  s.service.clock.Now(),
 	}
 
 	if err := s.db.Create(&run).Error; err != nil {
@@ -168,9 +170,9 @@ func (s *Scheduler) executeSchedule(scheduleID uint) {
 	}
 
 	// Execute drift detection
-	startTime := time.Now()
+	startTime := s.service.clock.Now()
 	result, err := s.executeDriftDetection(schedule)
-	duration := time.Since(startTime)
+	duration := s.service.clock.Now().Sub(startTime)
 
 	// Update run record
 	completedAt := startTime.Add(duration)
@@ -201,7 +203,7 @@ func (s *Scheduler) executeSchedule(scheduleID uint) {
 	}
 
 	// Update schedule statistics
-	now := time.Now()
+	now := s.service.clock.Now()
 	updates := map[string]interface{}{
 		"last_run":   now,
 		"run_count":  gorm.Expr("run_count + 1"),
@@ -236,8 +238,8 @@ func (s *Scheduler) executeDriftDetection(schedule DriftDetectionSchedule) (*Bul
 			Drifted:     0,
 			Errors:      0,
 			Results:     []DriftResult{},
-			StartedAt:   time.Now(),
-			CompletedAt: time.Now(),
+			StartedAt:   s.service.clock.Now(),
+			CompletedAt: s.service.clock.Now(),
 			Duration:    0,
 		}, nil
 	}
@@ -0,0 +1,187 @@
+package configuration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Configuration search operators
+const (
+	SearchEqual    = "="
+	SearchNotEqual = "!="
+	SearchContains = "~" // case-insensitive substring of a string value
+)
+
+// ErrInvalidSearchCondition is returned for conditions that cannot be parsed
+var ErrInvalidSearchCondition = errors.New("invalid search condition")
+
+// SearchCondition is one term of a configuration search, such as
+// mqtt.server != "10.0.0.5". Path is a dotted path into the stored
+// configuration; a number selects a list element and * any key or element.
+type SearchCondition struct {
+	Path  string      `json:"path"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+var searchConditionPattern = regexp.MustCompile(`^\s*([^\s=!~]+)\s*(!=|=|~)\s*(.*?)\s*$`)
+
+// ParseSearchCondition parses "path op value". The value is read as JSON
+// when it is a JSON literal ("text", 5, true, null) and as a bare string
+// otherwise.
+func ParseSearchCondition(expr string) (SearchCondition, error) {
+	m := searchConditionPattern.FindStringSubmatch(expr)
+	if m == nil {
+		return SearchCondition{}, fmt.Errorf("%w: %q, expected path =, != or ~ value", ErrInvalidSearchCondition, expr)
+	}
+	cond := SearchCondition{Path: m[1], Op: m[2], Value: m[3]}
+	for _, part := range strings.Split(cond.Path, ".") {
+		if part == "" {
+			return SearchCondition{}, fmt.Errorf("%w: empty segment in path %q", ErrInvalidSearchCondition, cond.Path)
+		}
+	}
+	var literal interface{}
+	if json.Unmarshal([]byte(m[3]), &literal) == nil {
+		cond.Value = literal
+	}
+	if _, ok := cond.Value.(string); cond.Op == SearchContains && !ok {
+		return SearchCondition{}, fmt.Errorf("%w: ~ needs a string value", ErrInvalidSearchCondition)
+	}
+	return cond, nil
+}
+
+// Match reports whether a decoded configuration satisfies the condition and
+// returns the values found at its path. A path that is absent matches
+// neither = nor !=; with a wildcard, = and ~ need one value to match and !=
+// needs every value to differ.
+func (c SearchCondition) Match(config interface{}) (bool, []interface{}) {
+	values := searchLookup(config, strings.Split(c.Path, "."))
+	if len(values) == 0 {
+		return false, nil
+	}
+	switch c.Op {
+	case SearchNotEqual:
+		for _, v := range values {
+			if searchEqual(v, c.Value) {
+				return false, values
+			}
+		}
+		return true, values
+	case SearchContains:
+		needle := strings.ToLower(c.Value.(string))
+		for _, v := range values {
+			if s, ok := v.(string); ok && strings.Contains(strings.ToLower(s), needle) {
+				return true, values
+			}
+		}
+		return false, values
+	default:
+		for _, v := range values {
+			if searchEqual(v, c.Value) {
+				return true, values
+			}
+		}
+		return false, values
+	}
+}
+
+// searchLookup collects the values at a path of map keys, list indexes and
+// wildcards
+func searchLookup(v interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+	key, rest := path[0], path[1:]
+	var out []interface{}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		if key == "*" {
+			for _, child := range node {
+				out = append(out, searchLookup(child, rest)...)
+			}
+		} else if child, ok := node[key]; ok {
+			out = searchLookup(child, rest)
+		}
+	case []interface{}:
+		if key == "*" {
+			for _, child := range node {
+				out = append(out, searchLookup(child, rest)...)
+			}
+		} else if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(node) {
+			out = searchLookup(node[i], rest)
+		}
+	}
+	return out
+}
+
+// FoundValue is a value found in a configuration with its concrete path,
+// one key or list index per segment
+type FoundValue struct {
+	Path  []string
+	Value interface{}
+}
+
+// FindValues returns the values at a dotted path that equal want, compared
+// as in searches, with their concrete paths in path order. * in the path
+// matches any key or element.
+func FindValues(config interface{}, path string, want interface{}) []FoundValue {
+	var found []FoundValue
+	findValues(config, strings.Split(path, "."), nil, want, &found)
+	sort.Slice(found, func(i, j int) bool {
+		return strings.Join(found[i].Path, ".") < strings.Join(found[j].Path, ".")
+	})
+	return found
+}
+
+func findValues(v interface{}, path, at []string, want interface{}, found *[]FoundValue) {
+	if len(path) == 0 {
+		if searchEqual(v, want) {
+			*found = append(*found, FoundValue{Path: append([]string(nil), at...), Value: v})
+		}
+		return
+	}
+	key, rest := path[0], path[1:]
+	switch node := v.(type) {
+	case map[string]interface{}:
+		if key == "*" {
+			for k, child := range node {
+				findValues(child, rest, append(at, k), want, found)
+			}
+		} else if child, ok := node[key]; ok {
+			findValues(child, rest, append(at, key), want, found)
+		}
+	case []interface{}:
+		if key == "*" {
+			for i, child := range node {
+				findValues(child, rest, append(at, strconv.Itoa(i)), want, found)
+			}
+		} else if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(node) {
+			findValues(node[i], rest, append(at, key), want, found)
+		}
+	}
+}
+
+// searchEqual compares a configuration value with a search value. A search
+// string also matches a number or boolean with the same text.
+func searchEqual(actual, want interface{}) bool {
+	if reflect.DeepEqual(actual, want) {
+		return true
+	}
+	s, ok := want.(string)
+	if !ok {
+		return false
+	}
+	switch a := actual.(type) {
+	case float64:
+		return strconv.FormatFloat(a, 'f', -1, 64) == s
+	case bool:
+		return strconv.FormatBool(a) == s
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package configuration
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchCondition(t *testing.T) {
+	var config interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"mqtt": {"enable": true, "server": "10.0.0.5:1883", "port": 1883},
+		"wifi": {"sta": {"ssid": "OldSSID"}},
+		"relays": [{"name": "Pump", "auto_off": 0}, {"name": "Light", "auto_off": 30}]
+	}`), &config))
+
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{`mqtt.server = "10.0.0.5:1883"`, true},
+		{`mqtt.server != "10.0.0.5:1883"`, false},
+		{`mqtt.server != "10.0.0.9:1883"`, true},
+		{`mqtt.server ~ 10.0.0.5`, true},
+		{`wifi.sta.ssid=OldSSID`, true},
+		{`mqtt.enable = true`, true},
+		{`mqtt.port = 1883`, true},
+		{`mqtt.port = "1883"`, true},
+		{`mqtt.port = 1884`, false},
+		{`relays.1.name = Light`, true},
+		{`relays.5.name = Light`, false},
+		{`relays.*.auto_off = 30`, true},
+		{`relays.*.auto_off != 0`, false}, // every value must differ
+		{`mqtt.user != admin`, false},     // absent paths never match
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cond, err := ParseSearchCondition(tt.expr)
+			require.NoError(t, err)
+			ok, _ := cond.Match(config)
+			assert.Equal(t, tt.match, ok)
+		})
+	}
+
+	for _, expr := range []string{"mqtt.server", "= 5", "mqtt..server = x", "mqtt.port ~ 5"} {
+		_, err := ParseSearchCondition(expr)
+		assert.True(t, errors.Is(err, ErrInvalidSearchCondition), expr)
+	}
+}
+
+func TestFindValues(t *testing.T) {
+	var config interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"relays": [{"auto_off": 30}, {"auto_off": 0}, {"auto_off": 30}], "mqtt": {"port": 1883}}`), &config))
+
+	found := FindValues(config, "relays.*.auto_off", 30.0)
+	require.Len(t, found, 2)
+	assert.Equal(t, []string{"relays", "0", "auto_off"}, found[0].Path)
+	assert.Equal(t, []string{"relays", "2", "auto_off"}, found[1].Path)
+
+	assert.Len(t, FindValues(config, "mqtt.port", "1883"), 1)
+	assert.Empty(t, FindValues(config, "mqtt.server", "1883"))
+}
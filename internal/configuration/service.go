@@ -3,6 +3,7 @@ package configuration
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -10,6 +11,7 @@ import (
 
 	"gorm.io/gorm"
 
+	"github.com/ginsys/shelly-manager/internal/clock"
 	"github.com/ginsys/shelly-manager/internal/logging"
 	"github.com/ginsys/shelly-manager/internal/shelly"
 	"github.com/ginsys/shelly-manager/internal/shelly/gen1"
@@ -22,23 +24,53 @@ type Service struct {
 	logger           *logging.Logger
 	reporter         *Reporter
 	templateEngine   *TemplateEngine
-	driftNotifier    func(ctx context.Context, deviceID uint, deviceName string, differenceCount int)
+	driftNotifier    func(ctx context.Context, drift *ConfigDrift)
+	driftCleared     func(ctx context.Context, deviceID uint)
+	driftHook        func(ctx context.Context, drift *ConfigDrift) bool
+	driftScorer      *DriftScorer
+	timeoutResolver  func(deviceID uint) OperationTimeouts
+	recorderResolver func(deviceID uint) *shelly.Recorder
+	userAgent        string
+	network          shelly.NetworkOptions
+	clock            clock.Clock
 	ConfigurationSvc *ConfigurationService
 }
 
+// OperationTimeouts holds the deadlines for device import and export operations
+type OperationTimeouts struct {
+	Import time.Duration
+	Export time.Duration
+}
+
+// Default operation deadlines used when no resolver is configured
+const (
+	defaultImportTimeout = 15 * time.Second
+	defaultExportTimeout = 30 * time.Second
+)
+
 // NewService creates a new configuration service
 func NewService(db *gorm.DB, logger *logging.Logger) *Service {
 	if err := db.AutoMigrate(
 		&ConfigTemplate{},
 		&DeviceConfig{},
+		&ConfigBlob{},
 		&ConfigHistory{},
 		&DriftDetectionSchedule{},
 		&DriftDetectionRun{},
 		&DriftReport{},
 		&DriftTrend{},
+		&DriftQueueItem{},
 	); err != nil && logger != nil {
 		logger.Error("Failed to auto-migrate configuration tables", "error", err)
 	}
+	if err := registerConfigBlobs(db); err != nil && logger != nil {
+		logger.Error("Failed to register config blob loading", "error", err)
+	}
+	if migrated, err := migrateHistoryBlobs(db); err != nil && logger != nil {
+		logger.Error("Failed to migrate config history to blob storage", "error", err)
+	} else if migrated > 0 && logger != nil {
+		logger.Info("Migrated config history to blob storage", "rows", migrated)
+	}
 
 	reporter := NewReporter(db, logger)
 	templateEngine := NewTemplateEngine(logger)
@@ -51,18 +83,87 @@ func NewService(db *gorm.DB, logger *logging.Logger) *Service {
 		logger:           logger,
 		reporter:         reporter,
 		templateEngine:   templateEngine,
+		driftScorer:      NewDriftScorer(nil),
+		clock:            clock.Real,
 		ConfigurationSvc: configurationSvc,
 	}
 }
 
-// SetDriftNotifier sets an optional notifier called when drift is detected
-func (s *Service) SetDriftNotifier(fn func(ctx context.Context, deviceID uint, deviceName string, differenceCount int)) {
+// SetClock replaces the clock used for drift runs, reports and history
+// timestamps
+func (s *Service) SetClock(c clock.Clock) {
+	s.clock = clock.OrReal(c)
+	s.reporter.clock = s.clock
+}
+
+// SetDriftNotifier sets an optional notifier called when drift is detected.
+// The drift carries its score and severity.
+func (s *Service) SetDriftNotifier(fn func(ctx context.Context, drift *ConfigDrift)) {
 	s.driftNotifier = fn
 }
 
+// SetDriftClearedNotifier sets an optional notifier called when a drift check
+// finds a device in sync again
+func (s *Service) SetDriftClearedNotifier(fn func(ctx context.Context, deviceID uint)) {
+	s.driftCleared = fn
+}
+
+// SetDriftHook sets an optional hook run when drift is detected, before it is
+// notified; returning false accepts the drift, which is then not notified
+func (s *Service) SetDriftHook(fn func(ctx context.Context, drift *ConfigDrift) bool) {
+	s.driftHook = fn
+}
+
+// SetDriftScorer replaces the scorer weighting drift differences
+func (s *Service) SetDriftScorer(scorer *DriftScorer) {
+	s.driftScorer = scorer
+}
+
+// SetTimeoutResolver sets an optional resolver for per-device import/export deadlines
+func (s *Service) SetTimeoutResolver(fn func(deviceID uint) OperationTimeouts) {
+	s.timeoutResolver = fn
+}
+
+// SetRecorderResolver sets an optional resolver returning the debug trace
+// recorder of a device, or nil when the device is not being traced
+func (s *Service) SetRecorderResolver(fn func(deviceID uint) *shelly.Recorder) {
+	s.recorderResolver = fn
+}
+
+// SetNetwork sets the User-Agent and the source address and proxy used to
+// reach devices; an empty userAgent keeps the client default
+func (s *Service) SetNetwork(userAgent string, network shelly.NetworkOptions) {
+	s.userAgent = userAgent
+	s.network = network
+}
+
+// recorderFor returns the debug trace recorder of a device, if any
+func (s *Service) recorderFor(deviceID uint) *shelly.Recorder {
+	if s.recorderResolver == nil {
+		return nil
+	}
+	return s.recorderResolver(deviceID)
+}
+
+// timeoutsFor returns the operation deadlines for a device, falling back to defaults
+func (s *Service) timeoutsFor(deviceID uint) OperationTimeouts {
+	timeouts := OperationTimeouts{Import: defaultImportTimeout, Export: defaultExportTimeout}
+	if s.timeoutResolver == nil {
+		return timeouts
+	}
+	resolved := s.timeoutResolver(deviceID)
+	if resolved.Import > 0 {
+		timeouts.Import = resolved.Import
+	}
+	if resolved.Export > 0 {
+		timeouts.Export = resolved.Export
+	}
+	return timeouts
+}
+
 // ImportFromDevice imports configuration from a physical device
 func (s *Service) ImportFromDevice(deviceID uint, client shelly.Client) (*DeviceConfig, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeoutsFor(deviceID).Import)
 	defer cancel()
 
 	s.logger.WithFields(map[string]any{
@@ -118,7 +219,7 @@ func (s *Service) ImportFromDevice(deviceID uint, client shelly.Client) (*Device
 		"model":         info.Model,
 		"firmware":      firmware,
 		"mac":           info.MAC,
-		"imported_at":   time.Now().Format(time.RFC3339),
+		"imported_at":   s.clock.Now().Format(time.RFC3339),
 		"import_source": "device",
 	}
 
@@ -150,7 +251,7 @@ func (s *Service) ImportFromDevice(deviceID uint, client shelly.Client) (*Device
 	var existingConfig DeviceConfig
 	err = s.db.Where("device_id = ?", deviceID).First(&existingConfig).Error
 
-	now := time.Now()
+	now := s.clock.Now()
 
 	if err == gorm.ErrRecordNotFound {
 		// Create new config
@@ -322,7 +423,7 @@ func (s *Service) ExportToDevice(deviceID uint, client shelly.Client) error {
 		return fmt.Errorf("configuration not found: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeoutsFor(deviceID).Export)
 	defer cancel()
 
 	// Get device info to determine generation
@@ -390,7 +491,7 @@ func (s *Service) ExportToDevice(deviceID uint, client shelly.Client) error {
 	}
 
 	// Update sync status
-	now := time.Now()
+	now := s.clock.Now()
 	config.LastSynced = &now
 	config.SyncStatus = "synced"
 
@@ -429,11 +530,16 @@ func (s *Service) DetectDrift(deviceID uint, client shelly.Client) (*ConfigDrift
 	// Compare configurations, ignoring volatile bookkeeping metadata (_metadata, device_info)
 	// that ImportFromDevice re-stamps on every import.
 	differences := s.compareConfigurationsForDrift(storedConfig.Config, currentConfig.Config)
+	differences = collapseProfileChange(storedConfig.Config, currentConfig.Config, differences)
 
 	if len(differences) == 0 {
 		// No drift detected
 		storedConfig.SyncStatus = "synced"
 		s.db.Save(&storedConfig)
+		s.removeQueuedDrift(deviceID)
+		if s.driftCleared != nil {
+			s.driftCleared(context.Background(), deviceID)
+		}
 		return nil, nil
 	}
 
@@ -449,21 +555,39 @@ func (s *Service) DetectDrift(deviceID uint, client shelly.Client) (*ConfigDrift
 		DeviceID:       deviceID,
 		DeviceName:     device.Name,
 		LastSynced:     storedConfig.LastSynced,
-		DriftDetected:  time.Now(),
+		DriftDetected:  s.clock.Now(),
 		Differences:    differences,
 		RequiresAction: true,
 	}
+	s.driftScorer.Score(drift)
 
 	s.logger.WithFields(map[string]any{
 		"device_id":   deviceID,
 		"differences": len(differences),
+		"score":       drift.Score,
+		"severity":    drift.Severity,
 		"component":   "configuration",
 	}).Warn("Configuration drift detected")
 
+	ctx := context.Background()
+	if s.driftHook != nil && !s.driftHook(ctx, drift) {
+		// Accepted drift needs no remediation
+		drift.RequiresAction = false
+		s.removeQueuedDrift(deviceID)
+		return drift, nil
+	}
+
+	if err := s.queueDrift(drift); err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": deviceID,
+			"error":     err.Error(),
+			"component": "configuration",
+		}).Warn("Failed to queue drift for remediation")
+	}
+
 	// Emit notification if configured
 	if s.driftNotifier != nil {
-		ctx := context.Background()
-		s.driftNotifier(ctx, deviceID, device.Name, len(differences))
+		s.driftNotifier(ctx, drift)
 	}
 
 	return drift, nil
@@ -477,7 +601,7 @@ func (s *Service) BulkDetectDrift(deviceIDs []uint, clientGetter func(uint) (she
 		Drifted:   0,
 		Errors:    0,
 		Results:   make([]DriftResult, 0, len(deviceIDs)),
-		StartedAt: time.Now(),
+		StartedAt: s.clock.Now(),
 	}
 
 	s.logger.WithFields(map[string]any{
@@ -548,7 +672,7 @@ func (s *Service) BulkDetectDrift(deviceIDs []uint, clientGetter func(uint) (she
 		result.Results = append(result.Results, driftResult)
 	}
 
-	result.CompletedAt = time.Now()
+	result.CompletedAt = s.clock.Now()
 	result.Duration = result.CompletedAt.Sub(result.StartedAt)
 
 	s.logger.WithFields(map[string]any{
@@ -578,15 +702,12 @@ func (s *Service) ApplyTemplate(deviceID uint, templateID uint, variables map[st
 	}
 
 	// Check device type compatibility
-	if template.DeviceType != "all" && template.DeviceType != device.Type {
+	if !templateCompatible(&template, device.Type) {
 		return fmt.Errorf("template not compatible with device type %s", device.Type)
 	}
 
-	// Apply variable substitution if needed
-	configData := template.Config
-	if len(variables) > 0 {
-		configData = s.substituteVariables(configData, variables)
-	}
+	// Render the template for this device
+	configData := s.substituteVariables(template.Config, templateVariables(deviceID, variables))
 
 	// Check if config exists
 	var config DeviceConfig
@@ -615,6 +736,7 @@ func (s *Service) ApplyTemplate(deviceID uint, templateID uint, variables map[st
 		config.TemplateID = &templateID
 		config.Config = configData
 		config.SyncStatus = "pending"
+		config.Version++
 
 		if err := s.db.Save(&config).Error; err != nil {
 			return fmt.Errorf("failed to update device config: %w", err)
@@ -676,10 +798,10 @@ func (s *Service) UpdateDeviceConfig(deviceID uint, configUpdate map[string]inte
 	// Update the config
 	config.Config = updatedConfig
 	config.SyncStatus = "pending"
-	now := time.Now()
+	now := s.clock.Now()
 	config.UpdatedAt = now
 
-	return s.db.Save(&config).Error
+	return s.saveDeviceConfig(&config)
 }
 
 // UpdateCapabilityConfig updates a specific capability configuration
@@ -713,7 +835,7 @@ func (s *Service) UpdateCapabilityConfig(deviceID uint, capability string, capab
 	// Update the config
 	config.Config = updatedConfig
 	config.SyncStatus = "pending"
-	now := time.Now()
+	now := s.clock.Now()
 	config.UpdatedAt = now
 
 	// Log the update
@@ -723,7 +845,7 @@ func (s *Service) UpdateCapabilityConfig(deviceID uint, capability string, capab
 		"component":  "configuration",
 	}).Info("Updated device capability configuration")
 
-	return s.db.Save(&config).Error
+	return s.saveDeviceConfig(&config)
 }
 
 // GetTemplates gets all configuration templates
@@ -733,6 +855,18 @@ func (s *Service) GetTemplates() ([]ConfigTemplate, error) {
 	return templates, err
 }
 
+// GetTemplate gets a configuration template by ID
+func (s *Service) GetTemplate(templateID uint) (*ConfigTemplate, error) {
+	var template ConfigTemplate
+	if err := s.db.First(&template, templateID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	return &template, nil
+}
+
 // CreateTemplate creates a new configuration template
 func (s *Service) CreateTemplate(template *ConfigTemplate) error {
 	if err := ValidateTemplateScope(template.Scope, template.DeviceType); err != nil {
@@ -741,12 +875,24 @@ func (s *Service) CreateTemplate(template *ConfigTemplate) error {
 	return s.db.Create(template).Error
 }
 
-// UpdateTemplate updates an existing template
+// UpdateTemplate updates an existing template if it is still at
+// template.Version, or at any version when that is 0, and bumps the version
 func (s *Service) UpdateTemplate(template *ConfigTemplate) error {
 	if err := ValidateTemplateScope(template.Scope, template.DeviceType); err != nil {
 		return err
 	}
-	return s.db.Save(template).Error
+	version := template.Version
+	if version == 0 {
+		if err := s.db.Model(&ConfigTemplate{}).Where("id = ?", template.ID).Select("version").Scan(&version).Error; err != nil {
+			return err
+		}
+	}
+	template.Version = version + 1
+	if err := updateIfVersion(s.db, template, version); err != nil {
+		template.Version = version
+		return err
+	}
+	return nil
 }
 
 // DeleteTemplate deletes a template
@@ -802,6 +948,36 @@ func (s *Service) compareConfigurationsFiltered(stored, current json.RawMessage,
 	return differences
 }
 
+// collapseProfileChange replaces the differences caused by a device switching
+// between the switch and cover profiles with a single profile difference.
+// The components of one profile disappear and those of the other appear;
+// listing each of their settings would bury the actual change.
+func collapseProfileChange(stored, current json.RawMessage, differences []ConfigDifference) []ConfigDifference {
+	before, after := shelly.ConfigProfile(stored), shelly.ConfigProfile(current)
+	if before == "" || after == "" || before == after {
+		return differences
+	}
+	kept := []ConfigDifference{{
+		Path:        "profile",
+		Expected:    before,
+		Actual:      after,
+		Type:        "modified",
+		Severity:    "warning",
+		Category:    "device",
+		Description: fmt.Sprintf("Device profile changed from %s to %s", before, after),
+		Impact:      "The stored configuration describes the outputs of the other profile",
+		Suggestion:  "Switch the profile back, or switch it through the manager to re-import the configuration",
+	}}
+	for _, d := range differences {
+		top := strings.SplitN(d.Path, ".", 2)[0]
+		if shelly.IsProfileComponent(top) || d.Path == "sys.device.profile" || d.Path == "mode" {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
 // isDriftMetadataKey reports whether a raw map key names a volatile bookkeeping subtree that
 // drift detection should ignore. It matches the key exactly (not as a substring) so real
 // fields such as device_info_enabled or a key literally named "vendor._metadata" are kept.
@@ -885,6 +1061,21 @@ func (s *Service) compareMapsFiltered(path string, expected, actual map[string]i
 
 // substituteVariables replaces template variables with actual values using the template engine
 func (s *Service) substituteVariables(config json.RawMessage, variables map[string]interface{}) json.RawMessage {
+	result, err := s.renderVariables(config, variables)
+	if err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": variables["device_id"],
+			"error":     err.Error(),
+			"component": "configuration",
+		}).Warn("Template variable substitution failed, returning original config")
+		return config
+	}
+	return result
+}
+
+// renderVariables renders a configuration with the template context built
+// from variables
+func (s *Service) renderVariables(config json.RawMessage, variables map[string]interface{}) (json.RawMessage, error) {
 	// Extract device information from variables if available
 	var device *Device
 	if deviceID, ok := variables["device_id"].(uint); ok {
@@ -972,17 +1163,7 @@ func (s *Service) substituteVariables(config json.RawMessage, variables map[stri
 	}
 
 	// Perform template substitution
-	result, err := s.templateEngine.SubstituteVariables(config, context)
-	if err != nil {
-		s.logger.WithFields(map[string]any{
-			"device_id": context.Device.ID,
-			"error":     err.Error(),
-			"component": "configuration",
-		}).Warn("Template variable substitution failed, returning original config")
-		return config
-	}
-
-	return result
+	return s.templateEngine.SubstituteVariables(config, context)
 }
 
 // SubstituteVariables is a public wrapper for template variable substitution
@@ -1021,7 +1202,7 @@ func (s *Service) validateAndSanitizeConfig(configData json.RawMessage, deviceID
 	sanitizedConfig := make(map[string]interface{})
 	for key, value := range config {
 		// Copy non-sensitive data for logging
-		if !isSensitiveField(key) {
+		if !shelly.IsSensitiveField(key) {
 			sanitizedConfig[key] = value
 		} else {
 			sanitizedConfig[key] = "[REDACTED]"
@@ -1041,25 +1222,6 @@ func (s *Service) validateAndSanitizeConfig(configData json.RawMessage, deviceID
 	return configData, nil
 }
 
-// isSensitiveField checks if a configuration field contains sensitive data
-func isSensitiveField(key string) bool {
-	sensitiveFields := []string{
-		"password", "passwd", "pass", "pwd",
-		"key", "secret", "token", "auth",
-		"wifi_password", "wifi_pass", "wifi_key",
-		"mqtt_password", "mqtt_pass",
-		"username", "user", // Some consider usernames sensitive too
-	}
-
-	keyLower := strings.ToLower(key)
-	for _, sensitive := range sensitiveFields {
-		if strings.Contains(keyLower, sensitive) {
-			return true
-		}
-	}
-	return false
-}
-
 // min returns the minimum of two integers
 func min(a, b int) int {
 	if a < b {
@@ -1070,6 +1232,12 @@ func min(a, b int) int {
 
 // createHistory creates a configuration history entry
 func (s *Service) createHistory(deviceID, configID uint, action string, oldConfig, newConfig json.RawMessage, changedBy string) {
+	history := s.newHistory(deviceID, configID, action, oldConfig, newConfig, changedBy)
+	s.saveHistory(&history)
+}
+
+// newHistory builds a history entry with the differences between the configs
+func (s *Service) newHistory(deviceID, configID uint, action string, oldConfig, newConfig json.RawMessage, changedBy string) ConfigHistory {
 	history := ConfigHistory{
 		DeviceID:  deviceID,
 		ConfigID:  configID,
@@ -1087,11 +1255,15 @@ func (s *Service) createHistory(deviceID, configID uint, action string, oldConfi
 			history.Changes = changes
 		}
 	}
+	return history
+}
 
-	if err := s.db.Create(&history).Error; err != nil {
+// saveHistory stores a history entry; failures are logged, not returned
+func (s *Service) saveHistory(history *ConfigHistory) {
+	if err := s.db.Create(history).Error; err != nil {
 		s.logger.WithFields(map[string]any{
-			"device_id": deviceID,
-			"action":    action,
+			"device_id": history.DeviceID,
+			"action":    history.Action,
 			"error":     err.Error(),
 			"component": "configuration",
 		}).Error("Failed to create configuration history")
@@ -1209,18 +1381,30 @@ func (s *Service) createClientForDevice(deviceID uint) (shelly.Client, error) {
 	switch settings.Gen {
 	case 1:
 		// Gen1 device
-		var opts []gen1.ClientOption
+		opts := []gen1.ClientOption{gen1.WithNetwork(s.network)}
+		if s.userAgent != "" {
+			opts = append(opts, gen1.WithUserAgent(s.userAgent))
+		}
 		if settings.AuthUser != "" && settings.AuthPass != "" {
 			opts = append(opts, gen1.WithAuth(settings.AuthUser, settings.AuthPass))
 		}
+		if rec := s.recorderFor(deviceID); rec != nil {
+			opts = append(opts, gen1.WithRecorder(rec))
+		}
 		return gen1.NewClient(device.IP, opts...), nil
 
 	case 2, 3:
 		// Gen2+ device
-		var opts []gen2.ClientOption
+		opts := []gen2.ClientOption{gen2.WithNetwork(s.network)}
+		if s.userAgent != "" {
+			opts = append(opts, gen2.WithUserAgent(s.userAgent))
+		}
 		if settings.AuthUser != "" && settings.AuthPass != "" {
 			opts = append(opts, gen2.WithAuth(settings.AuthUser, settings.AuthPass))
 		}
+		if rec := s.recorderFor(deviceID); rec != nil {
+			opts = append(opts, gen2.WithRecorder(rec))
+		}
 		return gen2.NewClient(device.IP, opts...), nil
 
 	default:
@@ -1351,7 +1535,7 @@ func (s *Service) UpdateDeviceConfigFromJSON(deviceID uint, configJSON json.RawM
 		"component": "configuration",
 	}).Debug("Updating device configuration from JSON")
 
-	now := time.Now()
+	now := s.clock.Now()
 
 	// Check if config exists
 	var existingConfig DeviceConfig
@@ -1375,7 +1559,7 @@ func (s *Service) UpdateDeviceConfigFromJSON(deviceID uint, configJSON json.RawM
 		existingConfig.Config = configJSON
 		existingConfig.UpdatedAt = now
 
-		if err := s.db.Save(&existingConfig).Error; err != nil {
+		if err := s.saveDeviceConfig(&existingConfig); err != nil {
 			return fmt.Errorf("failed to update device config: %w", err)
 		}
 	}
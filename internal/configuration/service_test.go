@@ -231,10 +231,10 @@ func TestDetectDrift_NotifierCalled(t *testing.T) {
 	notified := false
 	var notedDeviceID uint
 	var notedDiff int
-	service.SetDriftNotifier(func(ctx context.Context, deviceID uint, deviceName string, differenceCount int) {
+	service.SetDriftNotifier(func(ctx context.Context, drift *ConfigDrift) {
 		notified = true
-		notedDeviceID = deviceID
-		notedDiff = differenceCount
+		notedDeviceID = drift.DeviceID
+		notedDiff = len(drift.Differences)
 	})
 
 	// Insert a device and stored config
@@ -256,6 +256,17 @@ func TestDetectDrift_NotifierCalled(t *testing.T) {
 	require.True(t, notified)
 	require.Equal(t, device.ID, notedDeviceID)
 	require.Greater(t, notedDiff, 0)
+
+	// Once the device matches again the cleared notifier fires
+	var cleared uint
+	service.SetDriftClearedNotifier(func(ctx context.Context, deviceID uint) {
+		cleared = deviceID
+	})
+	require.NoError(t, db.Model(&stored).Update("config", json.RawMessage(`{"wifi":{"ssid":"B"}}`)).Error)
+	drift, err = service.DetectDrift(device.ID, mc)
+	require.NoError(t, err)
+	require.Nil(t, drift)
+	require.Equal(t, device.ID, cleared)
 }
 
 func TestImportFromDevice_Gen1(t *testing.T) {
@@ -806,7 +817,7 @@ func TestDetectDrift_MinimalDrift(t *testing.T) {
 
 	// A drift on a truly-in-sync device must NOT fire a notification.
 	notifierCalls := 0
-	service.SetDriftNotifier(func(ctx context.Context, deviceID uint, deviceName string, differenceCount int) {
+	service.SetDriftNotifier(func(ctx context.Context, drift *ConfigDrift) {
 		notifierCalls++
 	})
 
@@ -889,6 +900,41 @@ func TestDetectDrift_WithDrift(t *testing.T) {
 	mockClient.AssertExpectations(t)
 }
 
+func TestDetectDrift_ProfileChange(t *testing.T) {
+	service, db := setupTestService(t)
+	createTestDevice(t, db, 1, "Test Device", "SNSW-102P16EU")
+
+	storedConfig := &DeviceConfig{
+		DeviceID: 1,
+		Config: json.RawMessage(`{"sys": {"device": {"name": "Blinds", "profile": "cover"}},
+			"cover:0": {"id": 0, "name": "Blinds", "maxtime_open": 60, "maxtime_close": 60}}`),
+		SyncStatus: "synced",
+	}
+	require.NoError(t, db.Create(storedConfig).Error)
+
+	mockClient := new(mockShellyClient)
+	mockClient.On("GetInfo", mock.Anything).Return(&shelly.DeviceInfo{ID: "blinds", Generation: 2}, nil)
+	mockClient.On("GetConfig", mock.Anything).Return(&shelly.DeviceConfig{
+		Raw: json.RawMessage(`{"sys": {"device": {"name": "Hall", "profile": "switch"}},
+			"switch:0": {"id": 0, "name": null, "initial_state": "off"},
+			"switch:1": {"id": 1, "name": null, "initial_state": "off"}}`),
+	}, nil)
+
+	// The switched components are reported as one profile change; other
+	// differences are kept
+	drift, err := service.DetectDrift(1, mockClient)
+	require.NoError(t, err)
+	require.NotNil(t, drift)
+	paths := map[string]ConfigDifference{}
+	for _, d := range drift.Differences {
+		paths[d.Path] = d
+	}
+	assert.Len(t, paths, 2)
+	assert.Equal(t, "cover", paths["profile"].Expected)
+	assert.Equal(t, "switch", paths["profile"].Actual)
+	assert.Contains(t, paths, "sys.device.name")
+}
+
 func TestDetectDrift_NoStoredConfig(t *testing.T) {
 	service, db := setupTestService(t)
 	createTestDevice(t, db, 1, "Test Device", "SHSW-1")
@@ -914,7 +960,7 @@ func TestDetectDrift_MetadataOnly(t *testing.T) {
 	createTestDevice(t, db, 1, "Test Device", "SHSW-1")
 
 	notifierCalls := 0
-	service.SetDriftNotifier(func(ctx context.Context, deviceID uint, deviceName string, differenceCount int) {
+	service.SetDriftNotifier(func(ctx context.Context, drift *ConfigDrift) {
 		notifierCalls++
 	})
 
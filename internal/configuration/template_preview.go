@@ -0,0 +1,157 @@
+package configuration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// TemplateApplyPreview is the plan for applying a template to a set of
+// devices: what ApplyTemplate would store for each of them, and how that
+// differs from their current stored config. Nothing is written.
+type TemplateApplyPreview struct {
+	TemplateID   uint                         `json:"template_id"`
+	TemplateName string                       `json:"template_name"`
+	DeviceType   string                       `json:"device_type"`
+	Total        int                          `json:"total"`
+	Changed      int                          `json:"changed"`
+	Unchanged    int                          `json:"unchanged"`
+	Incompatible int                          `json:"incompatible"`
+	Errors       int                          `json:"errors"`
+	Devices      []TemplateApplyDevicePreview `json:"devices"`
+}
+
+// TemplateApplyDevicePreview is the planned change for a single device
+type TemplateApplyDevicePreview struct {
+	DeviceID        uint               `json:"device_id"`
+	DeviceName      string             `json:"device_name"`
+	DeviceType      string             `json:"device_type"`
+	Status          string             `json:"status"` // "changed", "unchanged", "incompatible", "error"
+	Error           string             `json:"error,omitempty"`
+	HasStoredConfig bool               `json:"has_stored_config"`
+	StoredVersion   int                `json:"stored_version,omitempty"`
+	Rendered        json.RawMessage    `json:"rendered,omitempty"`
+	DifferenceCount int                `json:"difference_count"`
+	Differences     []ConfigDifference `json:"differences,omitempty"`
+}
+
+// templateVariables returns the variables a template is rendered with for a
+// device, so its device context is always available
+func templateVariables(deviceID uint, variables map[string]interface{}) map[string]interface{} {
+	vars := make(map[string]interface{}, len(variables)+1)
+	for k, v := range variables {
+		vars[k] = v
+	}
+	vars["device_id"] = deviceID
+	return vars
+}
+
+// templateCompatible reports whether a template can be applied to a device type
+func templateCompatible(template *ConfigTemplate, deviceType string) bool {
+	return template.DeviceType == "all" || template.DeviceType == deviceType
+}
+
+// PreviewTemplateApply renders a template for each device as ApplyTemplate
+// would and diffs it against the device's stored config. Without device IDs
+// every device the template is compatible with is previewed. Device IDs are
+// expected to be resolved by the caller (ShellyService.SelectDevices); IDs
+// without a device are left out. In the differences, expected is the stored
+// value and actual the rendered one.
+func (s *Service) PreviewTemplateApply(templateID uint, deviceIDs []uint, variables map[string]interface{}) (*TemplateApplyPreview, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	query := s.db.Order("id")
+	if len(deviceIDs) > 0 {
+		query = query.Where("id IN ?", deviceIDs)
+	} else if template.DeviceType != "all" {
+		query = query.Where("type = ?", template.DeviceType)
+	}
+	if err := query.Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+
+	preview := &TemplateApplyPreview{
+		TemplateID:   template.ID,
+		TemplateName: template.Name,
+		DeviceType:   template.DeviceType,
+		Total:        len(devices),
+		Devices:      make([]TemplateApplyDevicePreview, 0, len(devices)),
+	}
+	for i := range devices {
+		result := s.previewTemplateForDevice(template, &devices[i], variables)
+		switch result.Status {
+		case "changed":
+			preview.Changed++
+		case "unchanged":
+			preview.Unchanged++
+		case "incompatible":
+			preview.Incompatible++
+		default:
+			preview.Errors++
+		}
+		preview.Devices = append(preview.Devices, result)
+	}
+
+	s.logger.WithFields(map[string]any{
+		"template_id": templateID,
+		"devices":     preview.Total,
+		"changed":     preview.Changed,
+		"component":   "configuration",
+	}).Debug("Previewed template application")
+
+	return preview, nil
+}
+
+// previewTemplateForDevice renders a template for one device and diffs it
+// against the stored config
+func (s *Service) previewTemplateForDevice(template *ConfigTemplate, device *Device, variables map[string]interface{}) TemplateApplyDevicePreview {
+	result := TemplateApplyDevicePreview{
+		DeviceID:   device.ID,
+		DeviceName: device.Name,
+		DeviceType: device.Type,
+	}
+	if !templateCompatible(template, device.Type) {
+		result.Status = "incompatible"
+		result.Error = fmt.Sprintf("template not compatible with device type %s", device.Type)
+		return result
+	}
+
+	// Rendering failures are reported here, where ApplyTemplate would fall
+	// back to storing the unrendered template
+	rendered, err := s.renderVariables(template.Config, templateVariables(device.ID, variables))
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+	result.Rendered = rendered
+
+	stored := json.RawMessage("{}")
+	var config DeviceConfig
+	err = s.db.Where("device_id = ?", device.ID).First(&config).Error
+	switch {
+	case err == nil:
+		result.HasStoredConfig = true
+		result.StoredVersion = config.Version
+		stored = config.Config
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		result.Status = "error"
+		result.Error = fmt.Sprintf("failed to load stored config: %v", err)
+		return result
+	}
+
+	result.Differences = s.compareConfigurations(stored, rendered)
+	result.DifferenceCount = len(result.Differences)
+	if result.DifferenceCount > 0 || !result.HasStoredConfig {
+		result.Status = "changed"
+	} else {
+		result.Status = "unchanged"
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package configuration
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewTemplateApply(t *testing.T) {
+	service, db := setupTestService(t)
+	createTestDevice(t, db, 1, "Kitchen", "SHSW-1")
+	createTestDevice(t, db, 2, "Garage", "SHSW-1")
+	createTestDevice(t, db, 3, "Plug", "SHPLG-S")
+	createTestDevice(t, db, 4, "Hall", "SHSW-1")
+	require.NoError(t, db.Create(&DeviceConfig{DeviceID: 1, Config: json.RawMessage(`{"name": "Kitchen", "wifi": {"ssid": "Home"}}`)}).Error)
+	require.NoError(t, db.Create(&DeviceConfig{DeviceID: 4, Config: json.RawMessage(`{"name": "Hall", "wifi": {"ssid": "Office"}}`)}).Error)
+
+	template := &ConfigTemplate{
+		Name:       "Office WiFi",
+		DeviceType: "SHSW-1",
+		Config:     json.RawMessage(`{"name": "{{.Device.Name}}", "wifi": {"ssid": "Office"}}`),
+	}
+	require.NoError(t, db.Create(template).Error)
+
+	// Without device IDs every compatible device is previewed
+	preview, err := service.PreviewTemplateApply(template.ID, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, preview.Total)
+	assert.Equal(t, 2, preview.Changed)
+	assert.Equal(t, 1, preview.Unchanged)
+	require.Len(t, preview.Devices, 3)
+
+	kitchen := preview.Devices[0]
+	assert.Equal(t, "changed", kitchen.Status)
+	assert.True(t, kitchen.HasStoredConfig)
+	assert.JSONEq(t, `{"name": "Kitchen", "wifi": {"ssid": "Office"}}`, string(kitchen.Rendered))
+	require.Len(t, kitchen.Differences, 1)
+	assert.Equal(t, "wifi.ssid", kitchen.Differences[0].Path)
+	assert.Equal(t, "Home", kitchen.Differences[0].Expected)
+	assert.Equal(t, "Office", kitchen.Differences[0].Actual)
+
+	garage := preview.Devices[1]
+	assert.Equal(t, "changed", garage.Status)
+	assert.False(t, garage.HasStoredConfig)
+	assert.Equal(t, 2, garage.DifferenceCount)
+
+	assert.Equal(t, "unchanged", preview.Devices[2].Status)
+	assert.Empty(t, preview.Devices[2].Differences)
+
+	// The preview writes nothing
+	var history int64
+	db.Model(&ConfigHistory{}).Count(&history)
+	assert.Zero(t, history)
+
+	// Applying stores what the preview rendered
+	require.NoError(t, service.ApplyTemplate(1, template.ID, nil))
+	stored, err := service.GetDeviceConfig(1)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(kitchen.Rendered), string(stored.Config))
+	assert.Equal(t, 2, stored.Version)
+
+	// Explicit targets include incompatible devices
+	preview, err = service.PreviewTemplateApply(template.ID, []uint{1, 3}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, preview.Unchanged)
+	assert.Equal(t, 1, preview.Incompatible)
+	assert.Equal(t, "incompatible", preview.Devices[1].Status)
+	assert.Nil(t, preview.Devices[1].Rendered)
+
+	// IDs are resolved by the caller; unknown ones are left out
+	preview, err = service.PreviewTemplateApply(template.ID, []uint{1, 99}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, preview.Total)
+	_, err = service.PreviewTemplateApply(999, nil, nil)
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+}
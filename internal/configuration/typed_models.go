@@ -63,6 +63,9 @@ type AccessPointConfig struct {
 	SSID     *string `json:"ssid,omitempty"`
 	Password *string `json:"pass,omitempty"`
 	Key      *string `json:"key,omitempty"`
+	// RangeExtender bridges stations on the access point to the station
+	// network (Gen2+)
+	RangeExtender *bool `json:"range_extender,omitempty"`
 }
 
 // MQTTConfiguration represents MQTT settings
@@ -0,0 +1,29 @@
+package configuration
+
+import "gorm.io/gorm"
+
+// updateIfVersion writes every column of model, which carries its primary key
+// and the bumped version, only while the stored row is still at version. It
+// returns ErrVersionConflict when another update got there first.
+func updateIfVersion(db *gorm.DB, model interface{}, version int) error {
+	result := db.Model(model).Where("version = ?", version).Select("*").Omit("created_at").Updates(model)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// saveDeviceConfig writes an edited device config if it is unchanged since it
+// was read, and bumps its version
+func (s *Service) saveDeviceConfig(config *DeviceConfig) error {
+	version := config.Version
+	config.Version++
+	if err := updateIfVersion(s.db, config, version); err != nil {
+		config.Version = version
+		return err
+	}
+	return nil
+}
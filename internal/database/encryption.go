@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security/secrets"
+)
+
+// encryptedColumns lists the columns stored through the encrypted serializer
+var encryptedColumns = []struct {
+	table  string
+	column string
+}{
+	{"devices", "settings"},
+	{"device_intakes", "ap_password"},
+	{"provisioning_profiles", "wifi_password"},
+	{"provisioning_profiles", "auth_password"},
+	{"sync_schedules", "request"},
+	{"sync_plugin_configs", "request"},
+	{"notification_channels", "config"},
+	{"wifi_rotations", "password"},
+	{"operation_hooks", "secret"},
+}
+
+// prepareEncryptedColumns brings the encrypted columns in line with the
+// configured key. With a key, plain values written before encryption was
+// enabled and values under a previous key are rewritten under the current
+// key. Without one, encrypted values could not be read, so startup fails.
+func prepareEncryptedColumns(db *gorm.DB, logger *logging.Logger) error {
+	c := secrets.GetColumnCipher()
+	if c == nil {
+		for _, col := range encryptedColumns {
+			var count int64
+			if err := db.Table(col.table).Where(col.column+" LIKE ?", "enc:%").Count(&count).Error; err != nil {
+				return fmt.Errorf("failed to check %s.%s: %w", col.table, col.column, err)
+			}
+			if count > 0 {
+				return fmt.Errorf("%s.%s holds encrypted values but database.encryption_key is not set", col.table, col.column)
+			}
+		}
+		return nil
+	}
+
+	rewritten, err := encryptColumns(db, c)
+	if err != nil {
+		return err
+	}
+	if rewritten > 0 {
+		logger.WithFields(map[string]any{
+			"values":    rewritten,
+			"key_id":    c.KeyID(),
+			"component": "database",
+		}).Info("Encrypted sensitive columns with the current key")
+	}
+	return nil
+}
+
+// encryptColumns rewrites every value of the encrypted columns that is not
+// encrypted with the current key, and returns how many it rewrote
+func encryptColumns(db *gorm.DB, c *secrets.ColumnCipher) (int, error) {
+	rewritten := 0
+	for _, col := range encryptedColumns {
+		var rows []struct {
+			ID    uint
+			Value sql.NullString
+		}
+		if err := db.Table(col.table).Select("id, " + col.column + " AS value").
+			Where(col.column + " IS NOT NULL AND " + col.column + " <> ''").Scan(&rows).Error; err != nil {
+			return rewritten, fmt.Errorf("failed to read %s.%s: %w", col.table, col.column, err)
+		}
+		for _, row := range rows {
+			if c.EncryptedWithCurrentKey(row.Value.String) {
+				continue
+			}
+			plain, err := c.Decrypt(row.Value.String)
+			if err != nil {
+				return rewritten, fmt.Errorf("failed to decrypt %s.%s of row %d: %w", col.table, col.column, row.ID, err)
+			}
+			encrypted, err := c.Encrypt(plain)
+			if err != nil {
+				return rewritten, err
+			}
+			if err := db.Table(col.table).Where("id = ?", row.ID).UpdateColumn(col.column, encrypted).Error; err != nil {
+				return rewritten, fmt.Errorf("failed to encrypt %s.%s of row %d: %w", col.table, col.column, row.ID, err)
+			}
+			rewritten++
+		}
+	}
+	return rewritten, nil
+}
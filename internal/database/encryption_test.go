@@ -0,0 +1,91 @@
+package database
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/notification"
+	"github.com/ginsys/shelly-manager/internal/security/secrets"
+)
+
+func setColumnKey(t *testing.T, key string, previous ...string) {
+	t.Helper()
+	if key == "" {
+		secrets.SetColumnCipher(nil)
+		return
+	}
+	c, err := secrets.NewColumnCipher(key, previous...)
+	require.NoError(t, err)
+	secrets.SetColumnCipher(c)
+}
+
+func rawColumn(t *testing.T, m *Manager, table, column string) string {
+	t.Helper()
+	var value string
+	require.NoError(t, m.GetDB().Table(table).Select(column).Limit(1).Row().Scan(&value))
+	return value
+}
+
+func TestEncryptedColumns(t *testing.T) {
+	t.Cleanup(func() { secrets.SetColumnCipher(nil) })
+	path := filepath.Join(t.TempDir(), "encrypted.db")
+
+	// Values written before a key is configured are stored in plain text
+	setColumnKey(t, "")
+	m := mustStartManager(t, path)
+	require.NoError(t, m.GetDB().Create(&DeviceIntake{MAC: "aabbcc", APPassword: "ap-secret", Source: "manual"}).Error)
+	require.NoError(t, m.GetDB().Create(&notification.NotificationChannel{
+		Name: "ops", Type: "webhook", Config: json.RawMessage(`{"url":"https://hooks.local","secret":"s3cr3t"}`),
+	}).Error)
+	require.NoError(t, m.GetDB().Create(&Device{MAC: "ddeeff", Settings: `{"auth_pass":"dev-secret"}`}).Error)
+	require.NoError(t, m.GetDB().Create(&OperationHook{Name: "audit", Type: "webhook", Secret: "hook-secret"}).Error)
+	require.Equal(t, "ap-secret", rawColumn(t, m, "device_intakes", "ap_password"))
+	require.NoError(t, m.Close())
+
+	// Startup with a key encrypts them, and reads decrypt transparently
+	setColumnKey(t, "first-key")
+	m = mustStartManager(t, path)
+	require.True(t, secrets.IsEncrypted(rawColumn(t, m, "device_intakes", "ap_password")))
+	raw := rawColumn(t, m, "notification_channels", "config")
+	require.True(t, secrets.IsEncrypted(raw))
+	require.NotContains(t, raw, "s3cr3t")
+	require.NotContains(t, rawColumn(t, m, "devices", "settings"), "dev-secret")
+	require.NotContains(t, rawColumn(t, m, "operation_hooks", "secret"), "hook-secret")
+
+	var intake DeviceIntake
+	require.NoError(t, m.GetDB().First(&intake).Error)
+	require.Equal(t, "ap-secret", intake.APPassword)
+	var channel notification.NotificationChannel
+	require.NoError(t, m.GetDB().First(&channel).Error)
+	require.JSONEq(t, `{"url":"https://hooks.local","secret":"s3cr3t"}`, string(channel.Config))
+	var device Device
+	require.NoError(t, m.GetDB().First(&device).Error)
+	require.JSONEq(t, `{"auth_pass":"dev-secret"}`, device.Settings)
+	var hook OperationHook
+	require.NoError(t, m.GetDB().First(&hook).Error)
+	require.Equal(t, "hook-secret", hook.Secret)
+
+	// New writes are encrypted too, including struct updates
+	require.NoError(t, m.GetDB().Model(&intake).Updates(&DeviceIntake{APPassword: "rotated"}).Error)
+	require.NotContains(t, rawColumn(t, m, "device_intakes", "ap_password"), "rotated")
+	require.NoError(t, m.Close())
+
+	// A rotated key re-encrypts values of the previous key at startup
+	setColumnKey(t, "second-key", "first-key")
+	m = mustStartManager(t, path)
+	c := secrets.GetColumnCipher()
+	require.True(t, c.EncryptedWithCurrentKey(rawColumn(t, m, "device_intakes", "ap_password")))
+	require.NoError(t, m.GetDB().First(&intake).Error)
+	require.Equal(t, "rotated", intake.APPassword)
+	require.NoError(t, m.Close())
+
+	// Without the key the database refuses to start rather than failing reads
+	setColumnKey(t, "")
+	_, err := startManager(t, path)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "encryption_key"), err.Error())
+}
@@ -0,0 +1,306 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+// ErrRelinkTarget is returned when device history cannot be moved to the
+// named device
+var ErrRelinkTarget = errors.New("invalid relink target")
+
+// DeviceReference is a column referring to devices.id. Tables are named
+// rather than typed because several of them belong to the configuration and
+// notification packages.
+type DeviceReference struct {
+	Table  string
+	Column string
+	// Nullable references are cleared when their device goes; the rows are
+	// kept
+	Nullable bool
+	// PerDevice tables hold a device's current state (its stored config,
+	// energy totals, ...) rather than its history; they are only moved to a
+	// device that has none of its own
+	PerDevice bool
+}
+
+// DeviceReferences lists every column that refers to a device
+var DeviceReferences = []DeviceReference{
+	{Table: "device_configs", Column: "device_id", PerDevice: true},
+	{Table: "config_histories", Column: "device_id"},
+	{Table: "drift_trends", Column: "device_id"},
+	{Table: "drift_reports", Column: "device_id", Nullable: true},
+	{Table: "drift_queue_items", Column: "device_id", PerDevice: true}, // latest unresolved drift
+	{Table: "resolution_requests", Column: "device_id"},
+	{Table: "resolution_histories", Column: "device_id"},
+	{Table: "device_tags", Column: "device_id", PerDevice: true},
+	{Table: "recovery_actions", Column: "device_id"},
+	{Table: "identity_conflicts", Column: "device_id"},
+	{Table: "identity_conflicts", Column: "other_device_id", Nullable: true},
+	{Table: "device_reboots", Column: "device_id"},
+	{Table: "protection_trips", Column: "device_id"},
+	{Table: "power_budget_members", Column: "device_id"},
+	{Table: "device_dependencies", Column: "device_id"},
+	{Table: "device_dependencies", Column: "upstream_id"},
+	{Table: "energy_counters", Column: "device_id", PerDevice: true},
+	{Table: "energy_usages", Column: "device_id", PerDevice: true},    // one row per device and hour
+	{Table: "device_latencies", Column: "device_id", PerDevice: true}, // one row per device and hour
+	{Table: "device_maintenances", Column: "device_id", PerDevice: true},
+	{Table: "device_logs", Column: "device_id"},
+	{Table: "device_log_streams", Column: "device_id", PerDevice: true},
+	{Table: "export_device_states", Column: "device_id", PerDevice: true},
+	{Table: "device_intakes", Column: "matched_device_id", Nullable: true},
+	{Table: "new_device_alerts", Column: "device_id", Nullable: true},
+	{Table: "enrollment_tokens", Column: "device_id", Nullable: true},
+	{Table: "notification_histories", Column: "device_id", Nullable: true},
+}
+
+// OrphanedRows counts the rows of one table that refer to deleted devices
+type OrphanedRows struct {
+	Table     string `json:"table"`
+	Column    string `json:"column"`
+	Rows      int64  `json:"rows"`
+	DeviceIDs []uint `json:"device_ids"`
+	Action    string `json:"action"` // delete, or clear for nullable references
+}
+
+// IntegrityReport lists the rows referring to devices that no longer exist
+type IntegrityReport struct {
+	CheckedAt        time.Time      `json:"checked_at"`
+	Orphans          []OrphanedRows `json:"orphans"`
+	OrphanedRows     int64          `json:"orphaned_rows"`
+	OrphanedBlobs    int64          `json:"orphaned_blobs"` // config blobs no history entry refers to
+	CleanedUp        bool           `json:"cleaned_up"`
+	ForeignKeysAdded []string       `json:"foreign_keys_added,omitempty"`
+}
+
+// RelinkedRows counts the rows of one table moved to another device
+type RelinkedRows struct {
+	Table   string `json:"table"`
+	Rows    int64  `json:"rows"`
+	Skipped int64  `json:"skipped,omitempty"` // state rows left because the target has its own
+}
+
+// orphanCondition selects the rows of ref whose device does not exist
+func orphanCondition(ref DeviceReference) string {
+	return fmt.Sprintf("%s IS NOT NULL AND NOT EXISTS (SELECT 1 FROM devices WHERE devices.id = %s.%s)",
+		ref.Column, ref.Table, ref.Column)
+}
+
+// CheckDeviceReferences reports rows that refer to deleted devices and
+// config blobs no longer used by any history entry. With cleanup the rows
+// are deleted (nullable references cleared), the blobs removed, and the
+// foreign keys that the orphans blocked are added.
+func CheckDeviceReferences(db *gorm.DB, cleanup bool, logger *logging.Logger) (*IntegrityReport, error) {
+	report := &IntegrityReport{CheckedAt: time.Now(), Orphans: []OrphanedRows{}}
+	migrator := db.Migrator()
+
+	for _, ref := range DeviceReferences {
+		if !migrator.HasTable(ref.Table) {
+			continue
+		}
+		var rows []struct {
+			DeviceID uint
+			Count    int64
+		}
+		if err := db.Table(ref.Table).
+			Select(fmt.Sprintf("%s AS device_id, COUNT(*) AS count", ref.Column)).
+			Where(orphanCondition(ref)).Group(ref.Column).Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to check %s: %w", ref.Table, err)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		orphans := OrphanedRows{Table: ref.Table, Column: ref.Column, Action: "delete"}
+		if ref.Nullable {
+			orphans.Action = "clear"
+		}
+		for _, r := range rows {
+			orphans.Rows += r.Count
+			orphans.DeviceIDs = append(orphans.DeviceIDs, r.DeviceID)
+		}
+		sort.Slice(orphans.DeviceIDs, func(i, j int) bool { return orphans.DeviceIDs[i] < orphans.DeviceIDs[j] })
+		report.Orphans = append(report.Orphans, orphans)
+		report.OrphanedRows += orphans.Rows
+	}
+
+	blobsUnused := ""
+	if migrator.HasTable("config_blobs") && migrator.HasTable("config_histories") {
+		blobsUnused = "NOT EXISTS (SELECT 1 FROM config_histories WHERE config_histories.old_config_hash = config_blobs.hash OR config_histories.new_config_hash = config_blobs.hash)"
+		if err := db.Table("config_blobs").Where(blobsUnused).Count(&report.OrphanedBlobs).Error; err != nil {
+			return nil, fmt.Errorf("failed to check config_blobs: %w", err)
+		}
+	}
+
+	if !cleanup || (report.OrphanedRows == 0 && report.OrphanedBlobs == 0) {
+		return report, nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, orphans := range report.Orphans {
+			ref := DeviceReference{Table: orphans.Table, Column: orphans.Column}
+			var err error
+			if orphans.Action == "clear" {
+				err = tx.Table(ref.Table).Where(orphanCondition(ref)).Update(ref.Column, nil).Error
+			} else {
+				err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", ref.Table, orphanCondition(ref))).Error
+			}
+			if err != nil {
+				return fmt.Errorf("failed to clean up %s: %w", ref.Table, err)
+			}
+		}
+		// Histories of deleted devices were just removed, so their blobs go too
+		if blobsUnused != "" {
+			if err := tx.Exec("DELETE FROM config_blobs WHERE " + blobsUnused).Error; err != nil {
+				return fmt.Errorf("failed to clean up config_blobs: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.CleanedUp = true
+
+	if report.ForeignKeysAdded, err = EnsureDeviceForeignKeys(db, logger); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// deleteDeviceReferences removes the rows referring to a device, or clears
+// nullable references, before the device itself is deleted
+func deleteDeviceReferences(tx *gorm.DB, deviceID uint) error {
+	migrator := tx.Migrator()
+	for _, ref := range DeviceReferences {
+		if !migrator.HasTable(ref.Table) {
+			continue
+		}
+		var err error
+		if ref.Nullable {
+			err = tx.Table(ref.Table).Where(ref.Column+" = ?", deviceID).Update(ref.Column, nil).Error
+		} else {
+			err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = ?", ref.Table, ref.Column), deviceID).Error
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete %s of device %d: %w", ref.Table, deviceID, err)
+		}
+	}
+	return nil
+}
+
+// RelinkDeviceReferences moves the history of one device to another, e.g.
+// to the device that replaced it. The source may already be deleted, in
+// which case its orphaned rows are moved. State rows (see
+// DeviceReference.PerDevice) are only moved when the target has none.
+func RelinkDeviceReferences(db *gorm.DB, fromID, toID uint) ([]RelinkedRows, error) {
+	if fromID == 0 || toID == 0 || fromID == toID {
+		return nil, fmt.Errorf("%w: source and target must be two different devices", ErrRelinkTarget)
+	}
+	var count int64
+	if err := db.Model(&Device{}).Where("id = ?", toID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to get device %d: %w", toID, err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("%w: device %d does not exist", ErrRelinkTarget, toID)
+	}
+
+	results := []RelinkedRows{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		for _, ref := range DeviceReferences {
+			if !migrator.HasTable(ref.Table) {
+				continue
+			}
+			var rows int64
+			if err := tx.Table(ref.Table).Where(ref.Column+" = ?", fromID).Count(&rows).Error; err != nil {
+				return fmt.Errorf("failed to read %s: %w", ref.Table, err)
+			}
+			if rows == 0 {
+				continue
+			}
+			if ref.PerDevice {
+				var existing int64
+				if err := tx.Table(ref.Table).Where(ref.Column+" = ?", toID).Count(&existing).Error; err != nil {
+					return fmt.Errorf("failed to read %s: %w", ref.Table, err)
+				}
+				if existing > 0 {
+					results = append(results, RelinkedRows{Table: ref.Table, Skipped: rows})
+					continue
+				}
+			}
+			result := tx.Table(ref.Table).Where(ref.Column+" = ?", fromID).Update(ref.Column, toID)
+			if result.Error != nil {
+				return fmt.Errorf("failed to relink %s: %w", ref.Table, result.Error)
+			}
+			results = append(results, RelinkedRows{Table: ref.Table, Rows: result.RowsAffected})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// deviceForeignKeyName is the name of the foreign key on a device reference
+func deviceForeignKeyName(ref DeviceReference) string {
+	return fmt.Sprintf("fk_%s_%s", ref.Table, ref.Column)
+}
+
+// EnsureDeviceForeignKeys adds the foreign keys from the device references
+// to devices.id, cascading deletes (or clearing nullable references), and
+// returns the names of the keys it added. A table that still holds orphaned
+// rows is skipped with a warning until they are cleaned up, and so is a table
+// not created yet. SQLite cannot add a constraint to an existing table, so
+// there Manager.DeleteDevice removing the references is the only guard.
+func EnsureDeviceForeignKeys(db *gorm.DB, logger *logging.Logger) ([]string, error) {
+	if db.Dialector.Name() == "sqlite" {
+		return nil, nil
+	}
+	if logger == nil {
+		logger = logging.GetDefault()
+	}
+	migrator := db.Migrator()
+	added := []string{}
+	for _, ref := range DeviceReferences {
+		name := deviceForeignKeyName(ref)
+		if !migrator.HasTable(ref.Table) || migrator.HasConstraint(ref.Table, name) {
+			continue
+		}
+		var orphans int64
+		if err := db.Table(ref.Table).Where(orphanCondition(ref)).Count(&orphans).Error; err != nil {
+			return added, fmt.Errorf("failed to check %s: %w", ref.Table, err)
+		}
+		if orphans > 0 {
+			logger.WithFields(map[string]any{
+				"table":     ref.Table,
+				"orphans":   orphans,
+				"component": "database",
+			}).Warn("Rows refer to deleted devices; foreign key not added until they are cleaned up")
+			continue
+		}
+		onDelete := "CASCADE"
+		if ref.Nullable {
+			onDelete = "SET NULL"
+		}
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES devices(id) ON DELETE %s",
+			ref.Table, name, ref.Column, onDelete)).Error; err != nil {
+			return added, fmt.Errorf("failed to add foreign key %s: %w", name, err)
+		}
+		added = append(added, name)
+	}
+	if len(added) > 0 {
+		logger.WithFields(map[string]any{
+			"foreign_keys": added,
+			"component":    "database",
+		}).Info("Added device foreign keys")
+	}
+	return added, nil
+}
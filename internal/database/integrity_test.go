@@ -0,0 +1,87 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+)
+
+func TestDeviceReferenceIntegrity(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+	db := manager.GetDB()
+	require.NoError(t, db.AutoMigrate(&configuration.DeviceConfig{}, &configuration.ConfigBlob{}, &configuration.ConfigHistory{},
+		&configuration.DriftQueueItem{}))
+
+	old := &Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Type: "SHSW-1", Name: "Old"}
+	replacement := &Device{IP: "192.0.2.2", MAC: "AABBCCDDEE02", Type: "SNSW-001X16EU", Name: "New"}
+	require.NoError(t, manager.AddDevice(old))
+	require.NoError(t, manager.AddDevice(replacement))
+
+	require.NoError(t, db.Create(&configuration.DeviceConfig{DeviceID: replacement.ID, Config: json.RawMessage(`{"new":true}`)}).Error)
+	require.NoError(t, db.Create(&configuration.DeviceConfig{DeviceID: old.ID, Config: json.RawMessage(`{"old":true}`)}).Error)
+	require.NoError(t, db.Create(&configuration.ConfigHistory{DeviceID: old.ID, ConfigID: 1, Action: "import",
+		NewConfig: json.RawMessage(`{"old":true}`)}).Error)
+	require.NoError(t, db.Create(&RecoveryAction{DeviceID: old.ID, Action: "reboot"}).Error)
+	require.NoError(t, db.Create(&configuration.DriftQueueItem{DeviceID: old.ID, Score: 10}).Error)
+	require.NoError(t, db.Create(&DeviceIntake{MAC: "AABBCCDDEE01", MatchedDeviceID: &old.ID}).Error)
+
+	// A device deleted before its references were removed with it
+	require.NoError(t, db.Exec("DELETE FROM devices WHERE id = ?", old.ID).Error)
+
+	report, err := CheckDeviceReferences(db, false, nil)
+	require.NoError(t, err)
+	assert.False(t, report.CleanedUp)
+	assert.Equal(t, int64(5), report.OrphanedRows)
+	actions := map[string]string{}
+	for _, o := range report.Orphans {
+		actions[o.Table] = o.Action
+		assert.Equal(t, []uint{old.ID}, o.DeviceIDs)
+	}
+	assert.Equal(t, map[string]string{"device_configs": "delete", "config_histories": "delete",
+		"recovery_actions": "delete", "drift_queue_items": "delete", "device_intakes": "clear"}, actions)
+
+	// History moves to the replacement; its own stored config stays
+	_, err = RelinkDeviceReferences(db, old.ID, 999)
+	assert.ErrorIs(t, err, ErrRelinkTarget)
+	relinked, err := RelinkDeviceReferences(db, old.ID, replacement.ID)
+	require.NoError(t, err)
+	moved := map[string]RelinkedRows{}
+	for _, r := range relinked {
+		moved[r.Table] = r
+	}
+	assert.Equal(t, int64(1), moved["device_configs"].Skipped)
+	assert.Equal(t, int64(1), moved["config_histories"].Rows)
+	assert.Equal(t, int64(1), moved["recovery_actions"].Rows)
+	assert.Equal(t, int64(1), moved["drift_queue_items"].Rows)
+
+	report, err = CheckDeviceReferences(db, true, nil)
+	require.NoError(t, err)
+	assert.True(t, report.CleanedUp)
+	require.Len(t, report.Orphans, 1)
+	assert.Equal(t, "device_configs", report.Orphans[0].Table)
+	var configs int64
+	db.Model(&configuration.DeviceConfig{}).Count(&configs)
+	assert.Equal(t, int64(1), configs)
+
+	// Deleting a device removes what refers to it
+	require.NoError(t, manager.DeleteDevice(replacement.ID))
+	report, err = CheckDeviceReferences(db, false, nil)
+	require.NoError(t, err)
+	assert.Zero(t, report.OrphanedRows)
+	assert.Equal(t, int64(1), report.OrphanedBlobs)
+	var intake DeviceIntake
+	require.NoError(t, db.First(&intake).Error)
+	assert.Nil(t, intake.MatchedDeviceID)
+
+	report, err = CheckDeviceReferences(db, true, nil)
+	require.NoError(t, err)
+	assert.True(t, report.CleanedUp)
+	var blobs int64
+	db.Model(&configuration.ConfigBlob{}).Count(&blobs)
+	assert.Zero(t, blobs)
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"context"
+
 	"gorm.io/gorm"
 )
 
@@ -10,12 +12,15 @@ type DatabaseInterface interface {
 	// Core operations
 	GetDB() *gorm.DB
 	Close() error
+	// WithContext returns the same database with every query run with ctx
+	WithContext(ctx context.Context) DatabaseInterface
 
 	// Device operations
 	AddDevice(device *Device) error
 	GetDevices() ([]Device, error)
 	GetDevice(id uint) (*Device, error)
 	UpdateDevice(device *Device) error
+	UpdateDeviceIfVersion(device *Device, version int) error
 	DeleteDevice(id uint) error
 	GetDeviceByMAC(mac string) (*Device, error)
 	UpsertDeviceFromDiscovery(mac string, update DiscoveryUpdate, initialName string) (*Device, error)
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// AcquireLease takes or renews the named lease for holder until ttl from now.
+// It succeeds when the lease is new, already held by holder, or has expired;
+// otherwise it returns false. Both steps are single statements, so two
+// instances racing for a lease cannot both win.
+func (m *Manager) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	lease := SchedulerLease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+
+	result := m.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&lease)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to create lease %s: %w", name, result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return true, nil
+	}
+
+	result = m.GetDB().Model(&SchedulerLease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", name, holder, now).
+		Updates(map[string]interface{}{"holder": holder, "expires_at": lease.ExpiresAt})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to renew lease %s: %w", name, result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseLease drops the named lease if holder still holds it, so another
+// instance can take over without waiting for it to expire
+func (m *Manager) ReleaseLease(name, holder string) error {
+	if err := m.GetDB().Where("name = ? AND holder = ?", name, holder).Delete(&SchedulerLease{}).Error; err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", name, err)
+	}
+	return nil
+}
+
+// GetLeases returns all scheduler leases, including expired ones
+func (m *Manager) GetLeases() ([]SchedulerLease, error) {
+	var leases []SchedulerLease
+	if err := m.GetDB().Order("name").Find(&leases).Error; err != nil {
+		return nil, fmt.Errorf("failed to get leases: %w", err)
+	}
+	return leases, nil
+}
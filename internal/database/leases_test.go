@@ -0,0 +1,50 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerLeases(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	ok, err := manager.AcquireLease("scheduler", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok, "first holder should get the lease")
+
+	ok, err = manager.AcquireLease("scheduler", "b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok, "second holder must not take a live lease")
+
+	ok, err = manager.AcquireLease("scheduler", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok, "holder should renew its lease")
+
+	// Other lease names are independent
+	ok, err = manager.AcquireLease("cleanup", "b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// An expired lease can be taken over
+	require.NoError(t, manager.GetDB().Model(&SchedulerLease{}).Where("name = ?", "scheduler").
+		Update("expires_at", time.Now().Add(-time.Second)).Error)
+	ok, err = manager.AcquireLease("scheduler", "b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok, "expired lease should fail over")
+
+	// Releasing only works for the holder
+	require.NoError(t, manager.ReleaseLease("scheduler", "a"))
+	leases, err := manager.GetLeases()
+	require.NoError(t, err)
+	require.Len(t, leases, 2)
+	assert.Equal(t, "b", leases[1].Holder)
+
+	require.NoError(t, manager.ReleaseLease("scheduler", "b"))
+	ok, err = manager.AcquireLease("scheduler", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok, "released lease should be free")
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -21,6 +22,7 @@ type Manager struct {
 	provider provider.DatabaseProvider
 	factory  *provider.Factory
 	logger   *logging.Logger
+	config   provider.DatabaseConfig
 }
 
 // NewManager creates a new database manager using provider abstraction
@@ -64,29 +66,29 @@ func NewManagerWithLogger(config provider.DatabaseConfig, logger *logging.Logger
 	}
 
 	// Auto-migrate all models to ensure schema is up-to-date
-	if err := dbProvider.Migrate(
-		&Device{},
-		&DiscoveredDevice{},
-		&ExportHistory{},
-		&ImportHistory{},
-		&notification.NotificationChannel{},
-		&notification.NotificationRule{},
-		&notification.NotificationHistory{},
-		&notification.NotificationTemplate{},
-		&configuration.ResolutionPolicy{},
-		&configuration.ResolutionRequest{},
-		&configuration.ResolutionHistory{},
-		&configuration.ResolutionSchedule{},
-		&configuration.ResolutionMetrics{},
-		&ConfigTemplate{},
-		&DeviceTag{},
-	); err != nil {
+	if err := dbProvider.Migrate(schemaModels()...); err != nil {
 		if closeErr := dbProvider.Close(); closeErr != nil {
 			logger.WithFields(map[string]any{"closeError": closeErr}).Error("Failed to close database provider after migration error")
 		}
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	if err := prepareEncryptedColumns(dbProvider.GetDB(), logger); err != nil {
+		if closeErr := dbProvider.Close(); closeErr != nil {
+			logger.WithFields(map[string]any{"closeError": closeErr}).Error("Failed to close database provider after encryption error")
+		}
+		return nil, fmt.Errorf("failed to prepare encrypted columns: %w", err)
+	}
+
+	// Device references get foreign keys where the database can add them to
+	// existing tables; a failure leaves DeleteDevice's own cleanup in charge
+	if _, err := EnsureDeviceForeignKeys(dbProvider.GetDB(), logger); err != nil {
+		logger.WithFields(map[string]any{
+			"error":     err.Error(),
+			"component": "database",
+		}).Error("Failed to add device foreign keys")
+	}
+
 	logger.WithFields(map[string]any{
 		"provider": config.Provider,
 		"version":  dbProvider.Version(),
@@ -96,6 +98,7 @@ func NewManagerWithLogger(config provider.DatabaseConfig, logger *logging.Logger
 		provider: dbProvider,
 		factory:  factory,
 		logger:   logger,
+		config:   config,
 	}, nil
 }
 
@@ -104,6 +107,36 @@ func (m *Manager) GetDB() *gorm.DB {
 	return m.provider.GetDB()
 }
 
+// WithContext returns a manager whose queries run with ctx, so they are
+// logged with the request ID it carries and stop when it is cancelled
+func (m *Manager) WithContext(ctx context.Context) DatabaseInterface {
+	scoped := &Manager{
+		provider: &contextProvider{DatabaseProvider: m.provider, ctx: ctx},
+		factory:  m.factory,
+		logger:   m.logger,
+		config:   m.config,
+	}
+	if m.logger != nil {
+		scoped.logger = m.logger.WithContext(ctx)
+	}
+	return scoped
+}
+
+// contextProvider hands out the provider's database bound to a context
+type contextProvider struct {
+	provider.DatabaseProvider
+	ctx context.Context
+}
+
+// GetDB returns the provider's database bound to the context
+func (p *contextProvider) GetDB() *gorm.DB {
+	db := p.DatabaseProvider.GetDB()
+	if db == nil {
+		return nil
+	}
+	return db.WithContext(p.ctx)
+}
+
 // Close closes the database connection
 func (m *Manager) Close() error {
 	return m.provider.Close()
@@ -144,6 +177,75 @@ func (m *Manager) GetProviderInfo() (string, string) {
 	return m.provider.Name(), m.provider.Version()
 }
 
+// schemaModels lists the models whose tables migration creates
+func schemaModels() []interface{} {
+	return []interface{}{
+		&Device{},
+		&DiscoveredDevice{},
+		&ExportHistory{},
+		&ImportHistory{},
+		&SyncSchedule{},
+		&SyncPluginConfig{},
+		&ExportDeviceState{},
+		&ImportConflict{},
+		&DeviceIntake{},
+		&UserPreference{},
+		&EnrollmentToken{},
+		&ProvisioningProfile{},
+		&ProvisioningTaskTemplate{},
+		&RecoveryAction{},
+		&IdentityConflict{},
+		&DeviceReboot{},
+		&ProtectionTrip{},
+		&PowerBudgetGroup{},
+		&PowerBudgetMember{},
+		&DeviceDependency{},
+		&NewDeviceAlert{},
+		&EnergyCounter{},
+		&EnergyUsage{},
+		&DeviceLatency{},
+		&DeviceMaintenance{},
+		&ChangeRequest{},
+		&OperationHook{},
+		&DeviceLog{},
+		&DeviceLogStream{},
+		&IdempotencyRecord{},
+		&IPSubnet{},
+		&IPReservedRange{},
+		&SchedulerLease{},
+		&WiFiRotationState{},
+		&notification.NotificationChannel{},
+		&notification.NotificationRule{},
+		&notification.NotificationHistory{},
+		&notification.NotificationTemplate{},
+		&configuration.ResolutionPolicy{},
+		&configuration.ResolutionRequest{},
+		&configuration.ResolutionHistory{},
+		&configuration.ResolutionSchedule{},
+		&configuration.ResolutionMetrics{},
+		&ConfigTemplate{},
+		&DeviceTag{},
+	}
+}
+
+// MissingTables returns the tables of the schema the database lacks, e.g.
+// after another instance's migration failed or a partial restore
+func (m *Manager) MissingTables() ([]string, error) {
+	db := m.GetDB()
+	var missing []string
+	for _, model := range schemaModels() {
+		if db.Migrator().HasTable(model) {
+			continue
+		}
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse schema model: %w", err)
+		}
+		missing = append(missing, stmt.Schema.Table)
+	}
+	return missing, nil
+}
+
 // GetSupportedProviders returns a list of supported database providers
 func (m *Manager) GetSupportedProviders() []string {
 	return m.factory.ListSupportedProviders()
@@ -262,8 +364,10 @@ func (m *Manager) GetDevice(id uint) (*Device, error) {
 func (m *Manager) UpdateDevice(device *Device) error {
 	// Note: Device settings validation can be added here if needed
 
+	// The version belongs to API edits (UpdateDeviceIfVersion); a status
+	// refresh saving a copy read earlier must not roll it back
 	start := time.Now()
-	result := m.GetDB().Save(device)
+	result := m.GetDB().Omit("version").Save(device)
 	duration := time.Since(start)
 
 	if result.Error != nil {
@@ -292,22 +396,31 @@ func (m *Manager) UpdateDevice(device *Device) error {
 // DeleteDevice deletes a device (legacy compatibility)
 func (m *Manager) DeleteDevice(id uint) error {
 	start := time.Now()
-	result := m.GetDB().Delete(&Device{}, id)
+	var deleted int64
+	err := m.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&Device{}, id)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		// Configs, history and the like go with the device
+		return deleteDeviceReferences(tx, id)
+	})
 	duration := time.Since(start)
 
-	if result.Error != nil {
+	if err != nil {
 		m.logger.WithFields(map[string]any{
 			"device_id": id,
-			"error":     result.Error.Error(),
+			"error":     err.Error(),
 			"duration":  duration,
 			"operation": "delete",
 			"table":     "devices",
 			"component": "database",
 		}).Error("Database operation failed")
-		return result.Error
+		return err
 	}
 
-	if result.RowsAffected == 0 {
+	if deleted == 0 {
 		m.logger.WithFields(map[string]any{
 			"device_id": id,
 			"duration":  duration,
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -22,9 +23,12 @@ type Device struct {
 	Firmware  string    `json:"firmware"`
 	Status    string    `json:"status" gorm:"size:191;index"`
 	LastSeen  time.Time `json:"last_seen" gorm:"index"`
-	Settings  string    `json:"settings" gorm:"type:text"` // JSON string
+	Settings  string    `json:"settings" gorm:"type:text;serializer:encrypted"` // JSON string, may hold credentials
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// Version is bumped by every edit through the API; clients send it back
+	// (If-Match or the body) so a stale edit is refused instead of applied
+	Version int `json:"version" gorm:"default:1"`
 
 	// These hold JSON documents and are seeded by BeforeSave rather than by a
 	// column DEFAULT: MySQL rejects defaults on TEXT columns, which made
@@ -34,6 +38,35 @@ type Device struct {
 	Overrides     string `json:"overrides" gorm:"type:text"`
 	DesiredConfig string `json:"desired_config" gorm:"type:text"`
 	ConfigApplied bool   `json:"config_applied" gorm:"default:false"`
+
+	// Profile is the active profile of devices whose outputs work either as
+	// relays or as a cover ("switch", "cover"); empty for other devices
+	Profile string `json:"profile,omitempty" gorm:"size:32"`
+
+	// Asset holds purchase and warranty details, changed through
+	// PUT /devices/{id}/asset or the asset CSV import
+	Asset DeviceAsset `json:"asset" gorm:"embedded"`
+}
+
+// DeviceAsset is the asset record of a device
+type DeviceAsset struct {
+	Serial         string     `json:"serial,omitempty" gorm:"size:191;index"`
+	Vendor         string     `json:"vendor,omitempty" gorm:"size:191"`
+	PurchaseDate   *time.Time `json:"purchase_date,omitempty"`
+	WarrantyMonths int        `json:"warranty_months,omitempty"`
+	// WarrantyNotifiedAt is when the approaching expiry was notified; it is
+	// cleared when the warranty details change
+	WarrantyNotifiedAt *time.Time `json:"warranty_notified_at,omitempty"`
+}
+
+// WarrantyExpires returns when the warranty ends, or nil when the purchase
+// date or warranty duration is unknown
+func (a DeviceAsset) WarrantyExpires() *time.Time {
+	if a.PurchaseDate == nil || a.WarrantyMonths <= 0 {
+		return nil
+	}
+	expires := a.PurchaseDate.AddDate(0, a.WarrantyMonths, 0)
+	return &expires
 }
 
 // BeforeSave seeds the JSON text columns so an unset field is stored as an
@@ -91,9 +124,461 @@ type ExportHistory struct {
 	RecordCount  int       `json:"record_count"`
 	FileSize     int64     `json:"file_size"`
 	FilePath     string    `json:"file_path,omitempty" gorm:"type:text"`
+	Checksum     string    `json:"checksum,omitempty"`
 	DurationMs   int64     `json:"duration_ms"`
 	ErrorMessage string    `json:"error_message,omitempty" gorm:"type:text"`
+	Parameters   string    `json:"parameters,omitempty" gorm:"type:text"` // JSON request, sensitive config removed
+	Summary      string    `json:"summary,omitempty" gorm:"type:text"`    // JSON errors, warnings and metadata
 	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+
+	// Storage tier of the artifact: local, object, or deleted past retention.
+	// Empty for exports without a file and for records from before tiers.
+	StorageTier    string     `json:"storage_tier,omitempty" gorm:"size:32;index"`
+	ObjectKey      string     `json:"object_key,omitempty" gorm:"type:text"`
+	ObjectSHA256   string     `json:"-"`                         // of the uploaded file, checked on restore
+	TransitionedAt *time.Time `json:"transitioned_at,omitempty"` // last move between tiers
+	RestoredAt     *time.Time `json:"restored_at,omitempty"`     // last restore to local disk
+}
+
+// ImportConflict is a field-level import conflict queued for manual review
+type ImportConflict struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	ImportID      string     `json:"import_id" gorm:"size:191;index"`
+	Resource      string     `json:"resource"`
+	ResourceID    string     `json:"resource_id" gorm:"size:191;index"`
+	Field         string     `json:"field"`
+	FieldClass    string     `json:"field_class"`
+	ExistingValue string     `json:"existing_value" gorm:"type:text"` // JSON
+	ImportValue   string     `json:"import_value" gorm:"type:text"`   // JSON
+	Status        string     `json:"status" gorm:"size:191;index"`    // pending, accepted, rejected
+	ResolvedBy    string     `json:"resolved_by,omitempty"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"index"`
+}
+
+// DeviceIntake pre-registers a device from its box label or QR code so it can be
+// recognised and named when it first shows up in an AP scan or discovery
+type DeviceIntake struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	MAC             string     `json:"mac" gorm:"size:191;uniqueIndex"` // normalized hex digits, may be a suffix
+	Model           string     `json:"model,omitempty"`
+	Name            string     `json:"name,omitempty"`
+	APSSID          string     `json:"ap_ssid,omitempty" gorm:"column:ap_ssid"`
+	APPassword      string     `json:"-" gorm:"column:ap_password;serializer:encrypted"`
+	Room            string     `json:"room,omitempty"`
+	Source          string     `json:"source"`                       // qr, csv, manual, cloud
+	Status          string     `json:"status" gorm:"size:191;index"` // pending, seen, matched
+	MatchedDeviceID *uint      `json:"matched_device_id,omitempty" gorm:"index"`
+	MatchedAt       *time.Time `json:"matched_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// EnrollmentToken is the one-time token of a provisioning task that the
+// provisioned device presents to enroll itself. Only its SHA-256 hash is
+// stored.
+type EnrollmentToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	TokenHash  string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	TaskID     string     `json:"task_id,omitempty" gorm:"size:191;index"`
+	DeviceMAC  string     `json:"device_mac,omitempty"`  // expected device; empty accepts any
+	TemplateID *uint      `json:"template_id,omitempty"` // configuration template applied on enrollment
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty"`
+	DeviceID   *uint      `json:"device_id,omitempty" gorm:"index"` // device adopted with the token
+	RemoteIP   string     `json:"remote_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// UserPreference is one UI or API preference of a user or API client, such
+// as the dashboard layout or favorite devices. Value holds JSON.
+type UserPreference struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	Owner     string    `json:"owner" gorm:"size:191;not null;uniqueIndex:idx_user_preferences_owner_key"`
+	Key       string    `json:"key" gorm:"column:pref_key;size:191;not null;uniqueIndex:idx_user_preferences_owner_key"`
+	Value     string    `json:"value" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProvisioningProfile holds the provisioning defaults of a site or network,
+// so tasks and provisioner runs can name the profile instead of repeating
+// WiFi and device credentials
+type ProvisioningProfile struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Name         string    `json:"name" gorm:"size:191;uniqueIndex;not null"`
+	Description  string    `json:"description,omitempty"`
+	SSID         string    `json:"ssid" gorm:"column:ssid"`
+	WiFiPassword string    `json:"-" gorm:"column:wifi_password;serializer:encrypted"`
+	EnableAuth   bool      `json:"enable_auth"`
+	AuthUser     string    `json:"auth_user,omitempty"`
+	AuthPassword string    `json:"-" gorm:"serializer:encrypted"`
+	EnableCloud  bool      `json:"enable_cloud"`
+	EnableMQTT   bool      `json:"enable_mqtt" gorm:"column:enable_mqtt"`
+	MQTTServer   string    `json:"mqtt_server,omitempty" gorm:"column:mqtt_server"`
+	NTPServer    string    `json:"ntp_server,omitempty" gorm:"column:ntp_server"`
+	Timezone     string    `json:"timezone,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ProvisioningTaskTemplate is a named recipe for provisioning tasks: target
+// network, auth policy, device naming rule and post-provision template. Its
+// strings may hold {{variable}} placeholders filled when a task is created.
+// Credentials come from the referenced provisioning profile, so tasks never
+// carry them.
+type ProvisioningTaskTemplate struct {
+	ID                      uint            `json:"id" gorm:"primaryKey"`
+	Name                    string          `json:"name" gorm:"size:191;uniqueIndex;not null"`
+	Description             string          `json:"description,omitempty"`
+	Profile                 string          `json:"profile,omitempty"` // provisioning profile with the credentials
+	TargetSSID              string          `json:"target_ssid,omitempty" gorm:"column:target_ssid"`
+	AuthPolicy              string          `json:"auth_policy,omitempty"` // profile, required or disabled
+	NamingRule              string          `json:"naming_rule,omitempty"` // device name, e.g. "{{site}}-plug-{{mac_suffix}}"
+	PostProvisionTemplateID *uint           `json:"post_provision_template_id,omitempty"`
+	Variables               json.RawMessage `json:"variables,omitempty" gorm:"type:text"` // default variable values
+	Config                  json.RawMessage `json:"config,omitempty" gorm:"type:text"`    // further task configuration
+	CreatedAt               time.Time       `json:"created_at"`
+	UpdatedAt               time.Time       `json:"updated_at"`
+}
+
+// RecoveryAction is the audit record of a supervisor recovery action
+type RecoveryAction struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	DeviceID  uint      `json:"device_id" gorm:"index;not null"`
+	Policy    string    `json:"policy"`
+	Action    string    `json:"action"` // reboot, wifi_roaming
+	Reason    string    `json:"reason"`
+	DryRun    bool      `json:"dry_run"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// IdentityConflict is a mismatch between a stored device and what answers
+// at its address that the identity check could not resolve on its own. One
+// open row is kept per device, kind and reported MAC; LastSeen moves on each
+// check that finds it again.
+type IdentityConflict struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	DeviceID      uint       `json:"device_id" gorm:"index;not null"`
+	OtherDeviceID *uint      `json:"other_device_id,omitempty" gorm:"index"` // stored device reporting the MAC, if any
+	Kind          string     `json:"kind" gorm:"size:32;index"`              // wrong_device, address_taken, duplicate
+	IP            string     `json:"ip"`
+	ExpectedMAC   string     `json:"expected_mac"`
+	ReportedMAC   string     `json:"reported_mac,omitempty"`
+	Detail        string     `json:"detail" gorm:"type:text"`
+	Resolved      bool       `json:"resolved" gorm:"index"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+	LastSeen      time.Time  `json:"last_seen"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"index"`
+}
+
+// SchedulerLease is a time-limited lock on a periodic job shared by several
+// server instances. The holder renews it before ExpiresAt; once it lapses any
+// other instance may take it over.
+type SchedulerLease struct {
+	Name      string    `json:"name" gorm:"primaryKey;size:191"`
+	Holder    string    `json:"holder" gorm:"size:191"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DeviceReboot is a reboot detected from a device's uptime going back.
+// Reboots the manager requested itself are Expected.
+type DeviceReboot struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	DeviceID       uint      `json:"device_id" gorm:"index;not null"`
+	BootedAt       time.Time `json:"booted_at"`        // estimated from the reported uptime
+	PreviousBootAt time.Time `json:"previous_boot_at"` // boot before this one
+	DetectedAt     time.Time `json:"detected_at" gorm:"index"`
+	Expected       bool      `json:"expected" gorm:"index"`
+}
+
+// ProtectionTrip is an overpower, overtemperature or other protection a
+// device reported, with the values it measured when the trip was seen.
+// Channel is -1 for protections of the whole device.
+type ProtectionTrip struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	DeviceID    uint       `json:"device_id" gorm:"index;not null"`
+	Channel     int        `json:"channel"`
+	Kind        string     `json:"kind" gorm:"index"` // overpower, overtemperature, overvoltage, undervoltage, overcurrent
+	Power       float64    `json:"power"`             // W
+	Voltage     float64    `json:"voltage"`           // V
+	Current     float64    `json:"current"`           // A
+	Temperature float64    `json:"temperature"`       // °C
+	TrippedAt   time.Time  `json:"tripped_at" gorm:"index"`
+	ClearedAt   *time.Time `json:"cleared_at,omitempty"`
+}
+
+// PowerBudgetGroup caps the summed power of a set of devices, e.g. the loads
+// on one circuit. A group over its limit for SustainSeconds is notified and,
+// with the shed action, its lowest-priority members are switched off until
+// it is back within the limit.
+type PowerBudgetGroup struct {
+	ID             uint                `json:"id" gorm:"primaryKey"`
+	Name           string              `json:"name" gorm:"size:191;uniqueIndex;not null"`
+	Description    string              `json:"description,omitempty"`
+	LimitWatts     float64             `json:"limit_watts,omitempty"`        // W
+	LimitAmps      float64             `json:"limit_amps,omitempty"`         // A, at Voltage; used without limit_watts
+	Voltage        float64             `json:"voltage,omitempty"`            // V, defaults to 230
+	SustainSeconds int                 `json:"sustain_seconds,omitempty"`    // defaults to 60
+	Action         string              `json:"action" gorm:"default:notify"` // notify or shed
+	Enabled        bool                `json:"enabled"`
+	Members        []PowerBudgetMember `json:"members" gorm:"foreignKey:GroupID"`
+	CreatedAt      time.Time           `json:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+}
+
+// PowerBudgetMember counts a device's power towards a group. Shedding
+// switches off Channel of the members with the lowest Priority first;
+// Protected members are never switched off.
+type PowerBudgetMember struct {
+	ID        uint `json:"id" gorm:"primaryKey"`
+	GroupID   uint `json:"group_id" gorm:"index;not null"`
+	DeviceID  uint `json:"device_id" gorm:"index;not null"`
+	Channel   int  `json:"channel"`
+	Priority  int  `json:"priority"`
+	Protected bool `json:"protected,omitempty"`
+}
+
+// NewDeviceAlert is a Shelly device seen by discovery or an announce that is
+// not in the inventory. It stays pending until adopted into the inventory or
+// ignored; an ignored MAC raises no further alerts.
+type NewDeviceAlert struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	MAC        string     `json:"mac" gorm:"size:17;uniqueIndex;not null"` // normalized, without separators
+	IP         string     `json:"ip"`
+	Model      string     `json:"model,omitempty"`
+	Generation int        `json:"generation,omitempty"`
+	Firmware   string     `json:"firmware,omitempty"`
+	ShellyID   string     `json:"shelly_id,omitempty"` // device ID reported by the device, e.g. shellyplus1-a8032ab12345
+	Source     string     `json:"source"`              // discovery or announce
+	Status     string     `json:"status" gorm:"index;default:pending"`
+	Sightings  int        `json:"sightings"`
+	FirstSeen  time.Time  `json:"first_seen"`
+	LastSeen   time.Time  `json:"last_seen"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+	Note       string     `json:"note,omitempty"`
+	DeviceID   *uint      `json:"device_id,omitempty"` // inventory device once adopted
+}
+
+// DeviceDependency records that a device reaches the network through, or is
+// powered by, an upstream device. Reboots and rollouts process the upstream
+// device after the devices depending on it, so they are not cut off midway.
+type DeviceDependency struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	DeviceID   uint      `json:"device_id" gorm:"uniqueIndex:idx_device_dependency;not null"`
+	UpstreamID uint      `json:"upstream_id" gorm:"uniqueIndex:idx_device_dependency;index;not null"`
+	Source     string    `json:"source" gorm:"default:manual"` // manual, or extender when derived from the topology
+	Note       string    `json:"note,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// EnergyCounter is the manager-side energy total of one device channel.
+// Device counters restart from zero after a power loss or firmware reset, or
+// wrap; Cumulative keeps growing across those, so long-term consumption stays
+// accurate. Energies are in Wh.
+type EnergyCounter struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	DeviceID    uint       `json:"device_id" gorm:"uniqueIndex:idx_energy_counter_channel;not null"`
+	Channel     int        `json:"channel" gorm:"uniqueIndex:idx_energy_counter_channel"`
+	DeviceTotal float64    `json:"device_total"` // last counter value the device reported
+	Cumulative  float64    `json:"cumulative"`   // monotonic total across device resets
+	Resets      int        `json:"resets"`
+	LastResetAt *time.Time `json:"last_reset_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// EnergyUsage is the energy a device consumed from Hour on, summed over its
+// channels from the growth of its energy counters. It is the stored history
+// energy comparisons are computed from. Rows cover one hour; hourly rows
+// older than metrics.energy_hourly_days are rolled up into one row per UTC
+// day (Hours 24), which is kept for as long as the device.
+type EnergyUsage struct {
+	ID       uint      `json:"-" gorm:"primaryKey"`
+	DeviceID uint      `json:"device_id" gorm:"uniqueIndex:idx_energy_usage_hour;not null"`
+	Hour     time.Time `json:"hour" gorm:"uniqueIndex:idx_energy_usage_hour;index"`
+	Hours    int       `json:"hours" gorm:"not null;default:1"`
+	Wh       float64   `json:"wh"`
+}
+
+// Span returns how long a row covers
+func (u EnergyUsage) Span() time.Duration {
+	if u.Hours > 1 {
+		return time.Duration(u.Hours) * time.Hour
+	}
+	return time.Hour
+}
+
+// DeviceLatency aggregates the status requests made to a device in one hour:
+// how many were made, how many failed and the round-trip times of the rest.
+// Rows older than metrics.latency_hourly_days are rolled up into daily rows
+// (Hours 24).
+type DeviceLatency struct {
+	ID       uint      `json:"-" gorm:"primaryKey"`
+	DeviceID uint      `json:"device_id" gorm:"uniqueIndex:idx_device_latency_hour;not null"`
+	Hour     time.Time `json:"hour" gorm:"uniqueIndex:idx_device_latency_hour;index"`
+	Hours    int       `json:"hours" gorm:"not null;default:1"`
+	Samples  int       `json:"samples"`
+	Failures int       `json:"failures"`
+	TotalMs  float64   `json:"total_ms"` // sum over the successful requests
+	MaxMs    float64   `json:"max_ms"`
+}
+
+// Span returns how long a row covers
+func (l DeviceLatency) Span() time.Duration {
+	if l.Hours > 1 {
+		return time.Duration(l.Hours) * time.Hour
+	}
+	return time.Hour
+}
+
+// DeviceMaintenance marks a device as under planned maintenance. While the
+// window is active no alerts are sent for the device and reports label it
+// instead of counting it. EndsAt is nil for a window that lasts until cleared.
+type DeviceMaintenance struct {
+	ID        uint       `json:"-" gorm:"primaryKey"`
+	DeviceID  uint       `json:"device_id" gorm:"uniqueIndex;not null"`
+	Reason    string     `json:"reason,omitempty"`
+	StartedAt time.Time  `json:"started_at"`
+	EndsAt    *time.Time `json:"ends_at,omitempty" gorm:"index"`
+}
+
+// Active reports whether the window is still open at t
+func (m *DeviceMaintenance) Active(t time.Time) bool {
+	return m.EndsAt == nil || t.Before(*m.EndsAt)
+}
+
+// ChangeRequest is a configuration change held for approval under the
+// two-person rule. It records who requested, decided and executed the change
+// and when, and serves as the audit trail of the change.
+type ChangeRequest struct {
+	ID          uint            `json:"id" gorm:"primaryKey"`
+	Operation   string          `json:"operation" gorm:"size:64;index"`
+	Fingerprint string          `json:"-" gorm:"size:64;index"`   // hash of the operation, devices and params
+	Summary     json.RawMessage `json:"summary" gorm:"type:text"` // devices and params of the change
+	DeviceCount int             `json:"device_count"`
+	Status      string          `json:"status" gorm:"size:16;index"` // pending, approved, rejected, executed, expired
+	RequestedBy string          `json:"requested_by"`
+	RequestedAt time.Time       `json:"requested_at"`
+	DecidedBy   string          `json:"decided_by,omitempty"`
+	DecidedAt   *time.Time      `json:"decided_at,omitempty"`
+	Comment     string          `json:"comment,omitempty"`
+	ExecutedBy  string          `json:"executed_by,omitempty"`
+	ExecutedAt  *time.Time      `json:"executed_at,omitempty"`
+	ExpiresAt   time.Time       `json:"expires_at" gorm:"index"`
+}
+
+// OperationHook runs before (pre) or after (post) an operation to tag the
+// device or, before it, to veto the operation. Webhook hooks post the event
+// to URL and read the decision from the response; rule hooks decide from
+// Match, field glob patterns over the device, with Veto and Tags.
+type OperationHook struct {
+	ID         uint            `json:"id" gorm:"primaryKey"`
+	Name       string          `json:"name" gorm:"size:191;uniqueIndex"`
+	Event      string          `json:"event" gorm:"size:32;index"` // device.adopted, config.exported, drift.detected
+	Phase      string          `json:"phase" gorm:"size:8"`        // pre or post
+	Type       string          `json:"type" gorm:"size:16"`        // webhook or rule
+	URL        string          `json:"url,omitempty"`
+	Secret     string          `json:"-" gorm:"serializer:encrypted"`    // signs webhook payloads
+	Match      json.RawMessage `json:"match,omitempty" gorm:"type:text"` // rule: field patterns, e.g. {"name": "garage*"}
+	Veto       string          `json:"veto,omitempty"`                   // rule: reason vetoing matching operations
+	Tags       json.RawMessage `json:"tags,omitempty" gorm:"type:text"`  // rule: tags added to matching devices
+	FailClosed bool            `json:"fail_closed"`                      // a failing pre hook vetoes instead of being skipped
+	Priority   int             `json:"priority"`                         // lower runs first
+	Enabled    bool            `json:"enabled"`
+	LastRunAt  *time.Time      `json:"last_run_at,omitempty"`
+	LastError  string          `json:"last_error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// DeviceLog is a debug log line a device streamed to the manager
+type DeviceLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	DeviceID   uint      `json:"device_id" gorm:"index:idx_device_logs_device_time"`
+	ReceivedAt time.Time `json:"received_at" gorm:"index:idx_device_logs_device_time;index"`
+	Level      string    `json:"level" gorm:"size:8"`   // error, warn, info, debug or verbose
+	DeviceTime float64   `json:"device_time,omitempty"` // Unix time of the line once the device clock is set, uptime before
+	Message    string    `json:"message" gorm:"type:text"`
+}
+
+// DeviceLogStream records that a device was configured to stream its debug
+// log to the manager
+type DeviceLogStream struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	DeviceID  uint      `json:"device_id" gorm:"uniqueIndex"`
+	Address   string    `json:"address"` // collector address configured on the device
+	StartedAt time.Time `json:"started_at"`
+}
+
+// IdempotencyRecord is the first response to a request sent with an
+// Idempotency-Key header, replayed when the client retries it. Status is 0
+// while the first request is still running.
+type IdempotencyRecord struct {
+	KeyHash     string    `json:"key_hash" gorm:"primaryKey;size:64"` // hash of the key, caller and route
+	Fingerprint string    `json:"fingerprint" gorm:"size:64"`         // hash of the request body
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index"`
+}
+
+// IPSubnet is a subnet declared for static IP planning
+type IPSubnet struct {
+	ID          uint              `json:"id" gorm:"primaryKey"`
+	Name        string            `json:"name"`
+	CIDR        string            `json:"cidr" gorm:"size:191;uniqueIndex"`
+	Gateway     string            `json:"gateway,omitempty"`
+	DNS         string            `json:"dns,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Ranges      []IPReservedRange `json:"ranges" gorm:"foreignKey:SubnetID"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// IPReservedRange is an address range inside a subnet that must not be
+// assigned to devices, e.g. the DHCP pool or infrastructure addresses
+type IPReservedRange struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	SubnetID    uint      `json:"subnet_id" gorm:"index;not null"`
+	StartIP     string    `json:"start_ip"`
+	EndIP       string    `json:"end_ip"`
+	Purpose     string    `json:"purpose,omitempty"` // dhcp_pool, infrastructure, ...
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WiFiRotationState persists a Wi-Fi credential rotation so its rollout
+// survives a restart. State holds the rotation as JSON without its password,
+// which is kept encrypted on its own.
+type WiFiRotationState struct {
+	ID         uint            `json:"id" gorm:"primaryKey"`
+	RotationID string          `json:"rotation_id" gorm:"size:36;uniqueIndex"`
+	Password   string          `json:"-" gorm:"serializer:encrypted"`
+	State      json.RawMessage `json:"state" gorm:"type:text"`
+	CreatedAt  time.Time       `json:"created_at" gorm:"index"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// TableName specifies the table name for WiFiRotationState
+func (WiFiRotationState) TableName() string {
+	return "wifi_rotations"
+}
+
+// ExportDeviceState records the content hash of each device as last exported by
+// a sync plugin, allowing incremental exports to emit only changed devices
+type ExportDeviceState struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	PluginName  string    `json:"plugin_name" gorm:"size:191;not null;uniqueIndex:idx_export_device_state"`
+	DeviceID    uint      `json:"device_id" gorm:"not null;index;uniqueIndex:idx_export_device_state"`
+	ContentHash string    `json:"content_hash" gorm:"size:64;not null"`
+	ExportID    string    `json:"export_id" gorm:"size:191"`
+	ExportedAt  time.Time `json:"exported_at"`
 }
 
 // ImportHistory stores audit records for import operations
@@ -108,5 +593,49 @@ type ImportHistory struct {
 	RecordsSkipped  int       `json:"records_skipped"`
 	DurationMs      int64     `json:"duration_ms"`
 	ErrorMessage    string    `json:"error_message,omitempty" gorm:"type:text"`
+	Parameters      string    `json:"parameters,omitempty" gorm:"type:text"` // JSON request without inline data, sensitive config removed
+	Summary         string    `json:"summary,omitempty" gorm:"type:text"`    // JSON errors, warnings and change counts
 	CreatedAt       time.Time `json:"created_at" gorm:"index"`
 }
+
+// SyncPluginConfig is a named export plugin configuration set up at runtime.
+// Like a schedule's, Request holds the full export request, sensitive plugin
+// settings included, and is never returned by the API as stored.
+type SyncPluginConfig struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name" gorm:"size:191;uniqueIndex;not null"`
+	Description  string     `json:"description,omitempty"`
+	PluginName   string     `json:"plugin_name" gorm:"size:191;index"`
+	Format       string     `json:"format"`
+	Request      string     `json:"-" gorm:"type:text;serializer:encrypted"`
+	UpdatedBy    string     `json:"updated_by,omitempty"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastStatus   string     `json:"last_status,omitempty"` // success, failed
+	LastExportID string     `json:"last_export_id,omitempty"`
+	LastError    string     `json:"last_error,omitempty" gorm:"type:text"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// SyncSchedule runs an export on a cron expression. Request holds the full
+// export request, sensitive plugin settings included, and is never returned
+// by the API as stored.
+type SyncSchedule struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name" gorm:"size:191;uniqueIndex;not null"`
+	PluginName   string     `json:"plugin_name" gorm:"size:191;index"`
+	Format       string     `json:"format"`
+	CronSpec     string     `json:"cron_spec" gorm:"not null"`
+	Enabled      bool       `json:"enabled" gorm:"index"`
+	Request      string     `json:"-" gorm:"type:text;serializer:encrypted"` // JSON export request, with sensitive plugin settings
+	RunningSince *time.Time `json:"running_since,omitempty"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastStatus   string     `json:"last_status,omitempty"` // success, failed
+	LastExportID string     `json:"last_export_id,omitempty"`
+	LastError    string     `json:"last_error,omitempty" gorm:"type:text"`
+	NextRunAt    *time.Time `json:"next_run_at,omitempty"`
+	RunCount     int        `json:"run_count"`
+	FailureCount int        `json:"failure_count"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
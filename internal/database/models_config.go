@@ -13,6 +13,7 @@ type ConfigTemplate struct {
 	Scope       string          `gorm:"size:191;not null;index" json:"scope"` // "global", "group", "device_type"
 	DeviceType  string          `gorm:"size:191;index" json:"device_type,omitempty"`
 	Config      json.RawMessage `gorm:"type:text;not null" json:"config"`
+	Version     int             `gorm:"default:1" json:"version"`
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
 }
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+// gormLogger sends GORM output through our logger with the context of the
+// query, so queries run with a request context (db.WithContext) carry its
+// request ID
+type gormLogger struct {
+	logger        *logging.Logger
+	level         logger.LogLevel
+	slowThreshold time.Duration
+}
+
+// newGormLogger creates a GORM logger for a provider's log_level and
+// slow_query_threshold settings
+func newGormLogger(l *logging.Logger, level string, slowThreshold time.Duration) logger.Interface {
+	if l == nil {
+		l = logging.GetDefault()
+	}
+	return &gormLogger{logger: l, level: gormLogLevel(level), slowThreshold: slowThreshold}
+}
+
+// gormLogLevel maps the log_level setting to a GORM log level; warn is the
+// default
+func gormLogLevel(level string) logger.LogLevel {
+	switch level {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "info":
+		return logger.Info
+	default:
+		return logger.Warn
+	}
+}
+
+// LogMode implements logger.Interface
+func (g *gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	copied := *g
+	copied.level = level
+	return &copied
+}
+
+// Info implements logger.Interface
+func (g *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if g.level >= logger.Info {
+		g.logger.WithFields(map[string]any{"component": "database"}).InfoContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Warn implements logger.Interface
+func (g *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if g.level >= logger.Warn {
+		g.logger.WithFields(map[string]any{"component": "database"}).WarnContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Error implements logger.Interface
+func (g *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if g.level >= logger.Error {
+		g.logger.WithFields(map[string]any{"component": "database"}).ErrorContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Trace implements logger.Interface. Failed and slow queries are logged as
+// before; other queries are logged at debug level when log_level is info or
+// when they belong to a request, so the recent log of that request shows
+// them.
+func (g *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if g.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	fields := func() map[string]any {
+		sql, rows := fc()
+		return map[string]any{
+			"sql":         sql,
+			"rows":        rows,
+			"duration_ms": elapsed.Milliseconds(),
+			"component":   "database",
+		}
+	}
+
+	switch {
+	case err != nil && g.level >= logger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		f := fields()
+		f["error"] = err.Error()
+		g.logger.WithFields(f).ErrorContext(ctx, "Database query failed")
+	case g.slowThreshold > 0 && elapsed > g.slowThreshold && g.level >= logger.Warn:
+		f := fields()
+		f["threshold_ms"] = g.slowThreshold.Milliseconds()
+		g.logger.WithFields(f).WarnContext(ctx, "Slow database query")
+	case g.level >= logger.Info || logging.GetRequestID(ctx) != "":
+		g.logger.WithFields(fields()).DebugContext(ctx, "Database query completed")
+	}
+}
+
+// ParamsFilter keeps query parameters, which may hold credentials, out of
+// the log unless log_level is info
+func (g *gormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if g.level >= logger.Info {
+		return sql, params
+	}
+	return sql, nil
+}
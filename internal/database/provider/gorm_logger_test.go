@@ -0,0 +1,33 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+func TestGormLoggerRequestQueries(t *testing.T) {
+	gl := newGormLogger(logging.GetDefault(), "warn", time.Second).(*gormLogger)
+
+	// Parameters stay out of the log unless log_level is info
+	if _, params := gl.ParamsFilter(context.Background(), "SELECT ?", "secret"); params != nil {
+		t.Errorf("Expected parameters to be dropped at warn level, got %v", params)
+	}
+	if _, params := newGormLogger(nil, "info", 0).(*gormLogger).ParamsFilter(context.Background(), "SELECT ?", "x"); len(params) != 1 {
+		t.Errorf("Expected parameters to be kept at info level, got %v", params)
+	}
+
+	ctx := logging.WithRequestID(context.Background(), "req-gorm-1")
+	gl.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT * FROM devices", 2 }, nil)
+	gl.Trace(context.Background(), time.Now(), func() (string, int64) {
+		t.Error("Expected queries outside a request not to be formatted at warn level")
+		return "", 0
+	}, nil)
+
+	entries := logging.RecentEntries("req-gorm-1", 0)
+	if len(entries) != 1 || entries[0].Fields["sql"] != "SELECT * FROM devices" {
+		t.Errorf("Expected the query to be logged under its request, got %+v", entries)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
 	"net/url"
 	"os"
 	"regexp"
@@ -529,30 +528,7 @@ func (m *MySQLProvider) updateProviderVersion() error {
 
 // createGormLogger creates a GORM logger instance based on configuration
 func (m *MySQLProvider) createGormLogger() logger.Interface {
-	var logLevel logger.LogLevel
-
-	switch m.config.LogLevel {
-	case "silent":
-		logLevel = logger.Silent
-	case "error":
-		logLevel = logger.Error
-	case "warn":
-		logLevel = logger.Warn
-	case "info":
-		logLevel = logger.Info
-	default:
-		logLevel = logger.Warn
-	}
-
-	return logger.New(
-		log.New(&gormLogWriter{logger: m.logger}, "", 0),
-		logger.Config{
-			SlowThreshold:             m.config.SlowQueryThreshold,
-			LogLevel:                  logLevel,
-			IgnoreRecordNotFoundError: true,
-			Colorful:                  false,
-		},
-	)
+	return newGormLogger(m.logger, m.config.LogLevel, m.config.SlowQueryThreshold)
 }
 
 // updateStats updates runtime database statistics
@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
 	"net/url"
 	"os"
 	"regexp"
@@ -482,30 +481,7 @@ func (p *PostgreSQLProvider) updateProviderVersion() error {
 
 // createGormLogger creates a GORM logger instance based on configuration
 func (p *PostgreSQLProvider) createGormLogger() logger.Interface {
-	var logLevel logger.LogLevel
-
-	switch p.config.LogLevel {
-	case "silent":
-		logLevel = logger.Silent
-	case "error":
-		logLevel = logger.Error
-	case "warn":
-		logLevel = logger.Warn
-	case "info":
-		logLevel = logger.Info
-	default:
-		logLevel = logger.Warn
-	}
-
-	return logger.New(
-		log.New(&gormLogWriter{logger: p.logger}, "", 0),
-		logger.Config{
-			SlowThreshold:             p.config.SlowQueryThreshold,
-			LogLevel:                  logLevel,
-			IgnoreRecordNotFoundError: true,
-			Colorful:                  false,
-		},
-	)
+	return newGormLogger(p.logger, p.config.LogLevel, p.config.SlowQueryThreshold)
 }
 
 // updateStats updates runtime database statistics
@@ -7,7 +7,6 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -272,7 +271,7 @@ func (s *SQLiteProvider) CreateBackup(ctx context.Context, config BackupConfig)
 	if s == nil {
 		return nil, fmt.Errorf("sqlite provider not initialized")
 	}
-	if s.config.DSN == ":memory:" {
+	if IsInMemoryDSN(s.config.DSN) {
 		return nil, fmt.Errorf("cannot back up in-memory SQLite database")
 	}
 	if config.BackupPath == "" {
@@ -348,7 +347,7 @@ func (s *SQLiteProvider) RestoreBackup(ctx context.Context, config RestoreConfig
 	if s == nil {
 		return nil, fmt.Errorf("sqlite provider not initialized")
 	}
-	if s.config.DSN == ":memory:" {
+	if IsInMemoryDSN(s.config.DSN) {
 		return nil, fmt.Errorf("cannot restore into in-memory SQLite database")
 	}
 	if _, err := os.Stat(config.BackupPath); err != nil {
@@ -595,10 +594,16 @@ func fileSHA256(path string) (string, error) {
 	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
+// IsInMemoryDSN reports whether a SQLite DSN names an in-memory database,
+// either ":memory:" or a URI with mode=memory
+func IsInMemoryDSN(dsn string) bool {
+	return dsn == ":memory:" || strings.Contains(dsn, "mode=memory")
+}
+
 // prepareDatabasePath creates the directory structure for the database file
 func (s *SQLiteProvider) prepareDatabasePath(dsn string) error {
 	// Skip for in-memory databases
-	if dsn == ":memory:" {
+	if IsInMemoryDSN(dsn) {
 		return nil
 	}
 
@@ -652,6 +657,13 @@ func (s *SQLiteProvider) configureDatabase() error {
 		sqlDB.SetMaxIdleConns(1)
 	}
 
+	// An in-memory database lives as long as its connection, so the one
+	// connection is never recycled
+	if IsInMemoryDSN(s.config.DSN) {
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+	}
+
 	// Apply SQLite pragmas from options
 	pragmas := s.getSQLitePragmas()
 	for pragma, value := range pragmas {
@@ -707,30 +719,7 @@ func (s *SQLiteProvider) getSQLitePragmas() map[string]string {
 
 // createGormLogger creates a GORM logger instance based on configuration
 func (s *SQLiteProvider) createGormLogger() logger.Interface {
-	var logLevel logger.LogLevel
-
-	switch s.config.LogLevel {
-	case "silent":
-		logLevel = logger.Silent
-	case "error":
-		logLevel = logger.Error
-	case "warn":
-		logLevel = logger.Warn
-	case "info":
-		logLevel = logger.Info
-	default:
-		logLevel = logger.Warn
-	}
-
-	return logger.New(
-		log.New(&gormLogWriter{logger: s.logger}, "", 0),
-		logger.Config{
-			SlowThreshold:             s.config.SlowQueryThreshold,
-			LogLevel:                  logLevel,
-			IgnoreRecordNotFoundError: true,
-			Colorful:                  false,
-		},
-	)
+	return newGormLogger(s.logger, s.config.LogLevel, s.config.SlowQueryThreshold)
 }
 
 // updateStats updates runtime database statistics
@@ -750,7 +739,7 @@ func (s *SQLiteProvider) updateStats() {
 	s.stats.IdleConnections = stats.Idle
 
 	// Get database size
-	if s.config.DSN != ":memory:" {
+	if !IsInMemoryDSN(s.config.DSN) {
 		if stat, err := os.Stat(s.config.DSN); err == nil {
 			s.stats.DatabaseSize = stat.Size()
 		}
@@ -775,19 +764,6 @@ func (t *sqliteTransaction) Rollback() error {
 }
 
 // gormLogWriter adapts our logging.Logger to GORM's log writer interface
-type gormLogWriter struct {
-	logger *logging.Logger
-}
-
-func (w *gormLogWriter) Write(p []byte) (n int, err error) {
-	message := string(p)
-
-	// Log GORM messages through our logger
-	w.logger.Debug(message)
-
-	return len(p), nil
-}
-
 // HealthCheck implements HealthChecker interface
 func (s *SQLiteProvider) HealthCheck(ctx context.Context) HealthStatus {
 	status := HealthStatus{
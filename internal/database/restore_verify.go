@@ -0,0 +1,341 @@
+package database
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database/provider"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security/secrets"
+)
+
+// ErrRestoreVerificationUnsupported is returned when backups of the
+// configured database provider cannot be verified
+var ErrRestoreVerificationUnsupported = errors.New("restore verification is only supported for sqlite backups")
+
+// sqliteHeader starts every unencrypted SQLite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// TableRows counts the rows of one table in a backup
+type TableRows struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+}
+
+// SecretColumnCheck reports whether the encrypted values of one column can
+// be read with the configured keys
+type SecretColumnCheck struct {
+	Table         string `json:"table"`
+	Column        string `json:"column"`
+	Encrypted     int    `json:"encrypted"`
+	Undecryptable int    `json:"undecryptable"`
+}
+
+// RestoreVerification reports whether a backup could be restored. The
+// backup is checked in a temporary copy; the live database is not touched.
+type RestoreVerification struct {
+	BackupPath           string              `json:"backup_path"`
+	VerifiedAt           time.Time           `json:"verified_at"`
+	Duration             time.Duration       `json:"duration"`
+	Restorable           bool                `json:"restorable"`
+	IntegrityCheck       string              `json:"integrity_check,omitempty"`
+	Tables               []TableRows         `json:"tables"`
+	TotalRows            int64               `json:"total_rows"`
+	MissingTables        []string            `json:"missing_tables,omitempty"` // created by migration on restore
+	UnknownTables        []string            `json:"unknown_tables,omitempty"` // not part of this version's schema
+	Migrated             bool                `json:"migrated"`
+	SecretColumns        []SecretColumnCheck `json:"secret_columns,omitempty"`
+	ForeignKeyViolations int64               `json:"foreign_key_violations"`
+	DeviceReferences     *IntegrityReport    `json:"device_references,omitempty"`
+	Errors               []string            `json:"errors"`
+	Warnings             []string            `json:"warnings"`
+}
+
+// VerifyBackupRestore checks that a backup could be restored into this
+// database. The backup is unpacked into a temporary directory and opened
+// there with the live column encryption keys: its integrity, table row
+// counts and encrypted values are checked, the schema is migrated as a
+// restore would, and rows referring to missing devices are counted.
+func (m *Manager) VerifyBackupRestore(ctx context.Context, backupPath string) (*RestoreVerification, error) {
+	return VerifyBackupRestore(ctx, backupPath, m.config, m.logger)
+}
+
+// VerifyBackupRestore checks a backup against a database configured with
+// config; see Manager.VerifyBackupRestore
+func VerifyBackupRestore(ctx context.Context, backupPath string, config provider.DatabaseConfig, logger *logging.Logger) (*RestoreVerification, error) {
+	if config.Provider != "sqlite" {
+		return nil, ErrRestoreVerificationUnsupported
+	}
+	if backupPath == "" {
+		return nil, fmt.Errorf("backup path is required")
+	}
+	if logger == nil {
+		logger = logging.GetDefault()
+	}
+	start := time.Now()
+	result := &RestoreVerification{
+		BackupPath: backupPath,
+		VerifiedAt: start,
+		Tables:     []TableRows{},
+		Errors:     []string{},
+		Warnings:   []string{},
+	}
+	defer func() { result.Duration = time.Since(start) }()
+
+	dir, err := os.MkdirTemp("", "shelly-restore-verify-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create verification directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	dbPath := filepath.Join(dir, "restore.db")
+	if err := unpackBackup(backupPath, dbPath); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	verifyConfig := config
+	verifyConfig.DSN = dbPath
+	if !checkBackupContents(ctx, result, verifyConfig, logger) {
+		return result, nil
+	}
+
+	// Migrate the copy as a restore followed by a restart would
+	verifyManager, err := NewManagerWithLogger(verifyConfig, logger)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("schema migration failed: %v", err))
+		return result, nil
+	}
+	defer func() { _ = verifyManager.Close() }()
+	result.Migrated = true
+
+	db := verifyManager.GetDB().WithContext(ctx)
+	after, err := sqliteTables(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrated tables: %w", err)
+	}
+	before := map[string]bool{}
+	for _, t := range result.Tables {
+		before[t.Table] = true
+	}
+	known := map[string]bool{}
+	for _, table := range after {
+		known[table] = true
+		if !before[table] {
+			result.MissingTables = append(result.MissingTables, table)
+		}
+	}
+	for _, t := range result.Tables {
+		if !known[t.Table] {
+			result.UnknownTables = append(result.UnknownTables, t.Table)
+		}
+	}
+	if len(result.MissingTables) > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("backup predates %d tables; they are created empty on restore", len(result.MissingTables)))
+	}
+	if len(result.UnknownTables) > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("backup holds %d tables this version does not use; it may come from a newer release", len(result.UnknownTables)))
+	}
+
+	var violations []map[string]any
+	if err := db.Raw("PRAGMA foreign_key_check").Scan(&violations).Error; err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("foreign key check failed: %v", err))
+	}
+	result.ForeignKeyViolations = int64(len(violations))
+	if result.ForeignKeyViolations > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%d rows violate foreign keys", result.ForeignKeyViolations))
+	}
+
+	references, err := CheckDeviceReferences(db, false, logger)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("device reference check failed: %v", err))
+	} else {
+		result.DeviceReferences = references
+		if references.OrphanedRows > 0 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%d rows refer to deleted devices", references.OrphanedRows))
+		}
+	}
+
+	result.Restorable = len(result.Errors) == 0
+	logger.WithFields(map[string]any{
+		"backup_path": backupPath,
+		"restorable":  result.Restorable,
+		"tables":      len(result.Tables),
+		"rows":        result.TotalRows,
+		"warnings":    len(result.Warnings),
+		"component":   "database",
+	}).Info("Verified backup restore")
+	return result, nil
+}
+
+// checkBackupContents opens the unpacked backup as it is, before migration,
+// and fills in its integrity, row counts and encrypted values. It returns
+// false when the backup cannot be restored.
+func checkBackupContents(ctx context.Context, result *RestoreVerification, config provider.DatabaseConfig, logger *logging.Logger) bool {
+	header := make([]byte, len(sqliteHeader))
+	f, err := os.Open(config.DSN)
+	if err == nil {
+		_, err = io.ReadFull(f, header)
+		_ = f.Close()
+	}
+	if err != nil || !bytes.Equal(header, sqliteHeader) {
+		result.Errors = append(result.Errors, "backup is not a SQLite database")
+		return false
+	}
+
+	raw := provider.NewSQLiteProvider(logger)
+	if err := raw.Connect(config); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to open backup: %v", err))
+		return false
+	}
+	defer func() { _ = raw.Close() }()
+	db := raw.GetDB().WithContext(ctx)
+
+	if err := db.Raw("PRAGMA integrity_check").Row().Scan(&result.IntegrityCheck); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("integrity check failed: %v", err))
+		return false
+	}
+	if result.IntegrityCheck != "ok" {
+		result.Errors = append(result.Errors, "backup is corrupt: "+result.IntegrityCheck)
+		return false
+	}
+
+	tables, err := sqliteTables(db)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to list tables: %v", err))
+		return false
+	}
+	for _, table := range tables {
+		var rows int64
+		if err := db.Table(table).Count(&rows).Error; err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to count rows of %s: %v", table, err))
+			continue
+		}
+		result.Tables = append(result.Tables, TableRows{Table: table, Rows: rows})
+		result.TotalRows += rows
+	}
+
+	checkSecretColumns(db, result)
+	return len(result.Errors) == 0
+}
+
+// checkSecretColumns tries to decrypt every encrypted value with the
+// configured column keys
+func checkSecretColumns(db *gorm.DB, result *RestoreVerification) {
+	c := secrets.GetColumnCipher()
+	for _, col := range encryptedColumns {
+		if !db.Migrator().HasTable(col.table) {
+			continue
+		}
+		var values []sql.NullString
+		if err := db.Table(col.table).Where(col.column+" LIKE ?", "enc:%").Pluck(col.column, &values).Error; err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to read %s.%s: %v", col.table, col.column, err))
+			continue
+		}
+		check := SecretColumnCheck{Table: col.table, Column: col.column}
+		for _, value := range values {
+			if !secrets.IsEncrypted(value.String) {
+				continue
+			}
+			check.Encrypted++
+			if c == nil {
+				check.Undecryptable++
+				continue
+			}
+			if _, err := c.Decrypt(value.String); err != nil {
+				check.Undecryptable++
+			}
+		}
+		if check.Encrypted == 0 {
+			continue
+		}
+		result.SecretColumns = append(result.SecretColumns, check)
+		switch {
+		case check.Undecryptable > 0 && c == nil:
+			result.Errors = append(result.Errors, fmt.Sprintf("%s.%s holds encrypted values but database.encryption_key is not set", col.table, col.column))
+		case check.Undecryptable > 0:
+			result.Errors = append(result.Errors, fmt.Sprintf("%d values of %s.%s cannot be decrypted with the configured keys", check.Undecryptable, col.table, col.column))
+		}
+	}
+}
+
+// sqliteTables lists the tables of a SQLite database by name
+func sqliteTables(db *gorm.DB) ([]string, error) {
+	var tables []string
+	if err := db.Raw("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'").
+		Scan(&tables).Error; err != nil {
+		return nil, err
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
+// unpackBackup writes the database held by a backup file, a plain copy or
+// one compressed by CreateBackup, to dst
+func unpackBackup(backupPath, dst string) error {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create verification copy: %w", err)
+	}
+	defer func() { _ = out.Close() }()
+
+	switch strings.ToLower(filepath.Ext(backupPath)) {
+	case ".zip":
+		archive, err := zip.OpenReader(backupPath)
+		if err != nil {
+			return fmt.Errorf("failed to open zip backup: %w", err)
+		}
+		defer func() { _ = archive.Close() }()
+		if len(archive.File) != 1 {
+			return fmt.Errorf("zip backup holds %d files, expected one database", len(archive.File))
+		}
+		in, err := archive.File[0].Open()
+		if err != nil {
+			return fmt.Errorf("failed to read zip backup: %w", err)
+		}
+		defer func() { _ = in.Close() }()
+		if _, err := io.Copy(out, in); err != nil {
+			return fmt.Errorf("failed to unpack zip backup: %w", err)
+		}
+	case ".gz":
+		f, err := os.Open(backupPath)
+		if err != nil {
+			return fmt.Errorf("backup file not accessible: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		in, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip backup: %w", err)
+		}
+		defer func() { _ = in.Close() }()
+		if _, err := io.Copy(out, in); err != nil {
+			return fmt.Errorf("failed to unpack gzip backup: %w", err)
+		}
+	default:
+		f, err := os.Open(backupPath)
+		if err != nil {
+			return fmt.Errorf("backup file not accessible: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		if _, err := io.Copy(out, f); err != nil {
+			return fmt.Errorf("failed to copy backup: %w", err)
+		}
+	}
+	return out.Close()
+}
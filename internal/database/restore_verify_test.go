@@ -0,0 +1,99 @@
+package database
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/security/secrets"
+)
+
+func gzipTestFile(t *testing.T, src, dst string) {
+	t.Helper()
+	in, err := os.Open(src)
+	require.NoError(t, err)
+	defer func() { _ = in.Close() }()
+	out, err := os.Create(dst)
+	require.NoError(t, err)
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, out.Close())
+}
+
+func TestVerifyBackupRestore(t *testing.T) {
+	t.Cleanup(func() { secrets.SetColumnCipher(nil) })
+	dir := t.TempDir()
+	path := filepath.Join(dir, "live.db")
+
+	setColumnKey(t, "backup-key")
+	m := mustStartManager(t, path)
+	device := &Device{IP: "192.0.2.10", MAC: "AABBCCDDEE10", Type: "SHSW-1", Name: "Kitchen"}
+	require.NoError(t, m.AddDevice(device))
+	require.NoError(t, m.GetDB().Create(&DeviceIntake{MAC: "aabbcc", APPassword: "ap-secret", Source: "manual"}).Error)
+	require.NoError(t, m.GetDB().Create(&RecoveryAction{DeviceID: device.ID + 100, Action: "reboot"}).Error)
+	require.NoError(t, m.Close())
+
+	backup := filepath.Join(dir, "backup.sqlite.gz")
+	gzipTestFile(t, path, backup)
+	m = mustStartManager(t, path)
+	ctx := context.Background()
+
+	t.Run("restorable backup", func(t *testing.T) {
+		result, err := m.VerifyBackupRestore(ctx, backup)
+		require.NoError(t, err)
+		assert.True(t, result.Restorable, result.Errors)
+		assert.True(t, result.Migrated)
+		assert.Equal(t, "ok", result.IntegrityCheck)
+		rows := map[string]int64{}
+		for _, table := range result.Tables {
+			rows[table.Table] = table.Rows
+		}
+		assert.Equal(t, int64(1), rows["devices"])
+		assert.Equal(t, int64(1), rows["device_intakes"])
+		require.Len(t, result.SecretColumns, 1)
+		assert.Equal(t, 1, result.SecretColumns[0].Encrypted)
+		assert.Zero(t, result.SecretColumns[0].Undecryptable)
+		require.NotNil(t, result.DeviceReferences)
+		assert.Equal(t, int64(1), result.DeviceReferences.OrphanedRows)
+		assert.NotEmpty(t, result.Warnings)
+	})
+
+	t.Run("secrets under an unknown key", func(t *testing.T) {
+		setColumnKey(t, "other-key")
+		defer setColumnKey(t, "backup-key")
+		result, err := m.VerifyBackupRestore(ctx, backup)
+		require.NoError(t, err)
+		assert.False(t, result.Restorable)
+		assert.False(t, result.Migrated)
+		require.Len(t, result.SecretColumns, 1)
+		assert.Equal(t, 1, result.SecretColumns[0].Undecryptable)
+	})
+
+	t.Run("not a database", func(t *testing.T) {
+		garbage := filepath.Join(dir, "garbage.sqlite")
+		require.NoError(t, os.WriteFile(garbage, []byte("definitely not sqlite"), 0600))
+		result, err := m.VerifyBackupRestore(ctx, garbage)
+		require.NoError(t, err)
+		assert.False(t, result.Restorable)
+		assert.NotEmpty(t, result.Errors)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		result, err := m.VerifyBackupRestore(ctx, filepath.Join(dir, "missing.sqlite"))
+		require.NoError(t, err)
+		assert.False(t, result.Restorable)
+	})
+
+	// The live database is left as it was
+	var devices int64
+	require.NoError(t, m.GetDB().Model(&Device{}).Count(&devices).Error)
+	assert.Equal(t, int64(1), devices)
+}
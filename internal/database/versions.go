@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+)
+
+// ErrVersionConflict is returned when a device changed after the version an
+// update was based on. It is the configuration package's error, so callers
+// can match device, config and template conflicts alike.
+var ErrVersionConflict = configuration.ErrVersionConflict
+
+// UpdateDeviceIfVersion replaces a device only while it is still at version,
+// and bumps the version. It is a single statement, so of two edits based on
+// the same version exactly one wins.
+func (m *Manager) UpdateDeviceIfVersion(device *Device, version int) error {
+	device.Version = version + 1
+	result := m.GetDB().Model(device).Where("version = ?", version).
+		Select("*").Omit("created_at").Updates(device)
+	if result.Error != nil {
+		device.Version = version
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		device.Version = version
+		var count int64
+		if err := m.GetDB().Model(&Device{}).Where("id = ?", device.ID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check device %d: %w", device.ID, err)
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return fmt.Errorf("device %d: %w", device.ID, ErrVersionConflict)
+	}
+
+	m.logger.WithFields(map[string]any{
+		"device_id": device.ID,
+		"version":   device.Version,
+		"operation": "update",
+		"table":     "devices",
+		"component": "database",
+	}).Info("Device updated successfully")
+	return nil
+}
@@ -44,16 +44,36 @@ type Scanner struct {
 	timeout         time.Duration
 	concurrentScans int
 	httpClient      *http.Client
+	userAgent       string
+	exclusions      *Exclusions
 	logger          *logging.Logger
 }
 
+// ScannerOption configures a Scanner
+type ScannerOption func(*Scanner)
+
+// WithUserAgent sets the User-Agent of probe requests; empty sends Go's default
+func WithUserAgent(userAgent string) ScannerOption {
+	return func(s *Scanner) {
+		s.userAgent = userAgent
+	}
+}
+
+// WithTransport sets the transport probes are sent through, e.g. one bound
+// to a source address or using a proxy
+func WithTransport(transport http.RoundTripper) ScannerOption {
+	return func(s *Scanner) {
+		s.httpClient.Transport = transport
+	}
+}
+
 // NewScanner creates a new discovery scanner
-func NewScanner(timeout time.Duration, concurrentScans int) *Scanner {
-	return NewScannerWithLogger(timeout, concurrentScans, logging.GetDefault())
+func NewScanner(timeout time.Duration, concurrentScans int, opts ...ScannerOption) *Scanner {
+	return NewScannerWithLogger(timeout, concurrentScans, logging.GetDefault(), opts...)
 }
 
 // NewScannerWithLogger creates a new discovery scanner with custom logger
-func NewScannerWithLogger(timeout time.Duration, concurrentScans int, logger *logging.Logger) *Scanner {
+func NewScannerWithLogger(timeout time.Duration, concurrentScans int, logger *logging.Logger, opts ...ScannerOption) *Scanner {
 	if concurrentScans <= 0 {
 		concurrentScans = 10
 	}
@@ -61,7 +81,7 @@ func NewScannerWithLogger(timeout time.Duration, concurrentScans int, logger *lo
 		timeout = 1 * time.Second // Reduced timeout for faster scanning
 	}
 
-	return &Scanner{
+	s := &Scanner{
 		timeout:         timeout,
 		concurrentScans: concurrentScans,
 		httpClient: &http.Client{
@@ -69,6 +89,23 @@ func NewScannerWithLogger(timeout time.Duration, concurrentScans int, logger *lo
 		},
 		logger: logger,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithExclusions skips hosts matching the exclusion rules
+func WithExclusions(exclusions *Exclusions) ScannerOption {
+	return func(s *Scanner) {
+		s.exclusions = exclusions
+	}
+}
+
+func (s *Scanner) setUserAgent(req *http.Request) {
+	if s.userAgent != "" {
+		req.Header.Set("User-Agent", s.userAgent)
+	}
 }
 
 // ScanNetwork performs HTTP-based discovery on the specified network range
@@ -120,10 +157,15 @@ func (s *Scanner) ScanNetwork(ctx context.Context, cidr string) ([]ShellyDevice,
 		}(i)
 	}
 
-	// Generate IPs to scan
+	// Generate IPs to scan; excluded ranges are never contacted
+	var skipped int32
 	go func() {
 		defer close(ipChan)
 		for currentIP := ip.Mask(ipnet.Mask); ipnet.Contains(currentIP); inc(currentIP) {
+			if s.exclusions.MatchIP(currentIP.String()) != "" {
+				atomic.AddInt32(&skipped, 1)
+				continue
+			}
 			select {
 			case <-ctx.Done():
 				return
@@ -136,20 +178,32 @@ func (s *Scanner) ScanNetwork(ctx context.Context, cidr string) ([]ShellyDevice,
 	duration := time.Since(start).Milliseconds()
 	finalFound := atomic.LoadInt32(&found)
 	finalScanned := atomic.LoadInt32(&scanned)
+	if n := atomic.LoadInt32(&skipped); n > 0 {
+		s.logger.WithFields(map[string]any{
+			"network":   cidr,
+			"skipped":   n,
+			"component": "discovery",
+		}).Info("Skipped excluded addresses")
+	}
 	s.logger.LogDiscoveryOperation("network_scan", cidr, int(finalFound), duration, nil)
 	fmt.Printf("Scan complete: checked %d IPs, found %d devices\n", finalScanned, finalFound)
 	return devices, nil
 }
 
-// ScanHost checks a specific host for Shelly device
-func (s *Scanner) ScanHost(ctx context.Context, host string) (*ShellyDevice, error) {
+// ScanHost checks a specific host for Shelly device. hostnames are names
+// already known for the host, e.g. from a DHCP lease, checked against the
+// exclusions.
+func (s *Scanner) ScanHost(ctx context.Context, host string, hostnames ...string) (*ShellyDevice, error) {
 	start := time.Now()
 	s.logger.WithFields(map[string]any{
 		"host":      host,
 		"component": "discovery",
 	}).Debug("Scanning host")
 
-	device := s.checkDevice(ctx, host)
+	device, rule := s.probe(ctx, host, hostnames...)
+	if rule != "" {
+		return nil, fmt.Errorf("%w: %s (%s)", ErrExcluded, host, rule)
+	}
 	duration := time.Since(start).Milliseconds()
 	devicesFound := 0
 	if device != nil {
@@ -159,8 +213,43 @@ func (s *Scanner) ScanHost(ctx context.Context, host string) (*ShellyDevice, err
 	return device, nil
 }
 
-// checkDevice attempts to identify a Shelly device at the given IP
-func (s *Scanner) checkDevice(ctx context.Context, ip string) *ShellyDevice {
+// checkDevice attempts to identify a Shelly device at the given IP.
+// hostnames are names already known for the host, checked against the
+// exclusions.
+func (s *Scanner) checkDevice(ctx context.Context, ip string, hostnames ...string) *ShellyDevice {
+	device, _ := s.probe(ctx, ip, hostnames...)
+	return device
+}
+
+// probe identifies the device at ip unless it is excluded, in which case the
+// matching rule is returned
+func (s *Scanner) probe(ctx context.Context, ip string, hostnames ...string) (*ShellyDevice, string) {
+	if rule := s.exclusions.Check(ctx, ip, hostnames...); rule != "" {
+		s.logExcluded(ip, rule)
+		return nil, rule
+	}
+	device := s.identify(ctx, ip)
+	if device != nil {
+		// The MAC is only known for sure once the host answered
+		if rule := s.exclusions.MatchMAC(device.MAC); rule != "" {
+			s.logExcluded(ip, rule)
+			return nil, rule
+		}
+		s.logger.LogDeviceOperation("discovered", ip, device.MAC, nil)
+	}
+	return device, ""
+}
+
+func (s *Scanner) logExcluded(ip, rule string) {
+	s.logger.WithFields(map[string]any{
+		"ip":        ip,
+		"rule":      rule,
+		"component": "discovery",
+	}).Info("Skipped excluded host")
+}
+
+// identify queries /shelly at ip and returns the device it describes
+func (s *Scanner) identify(ctx context.Context, ip string) *ShellyDevice {
 	url := fmt.Sprintf("http://%s/shelly", ip)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -172,6 +261,7 @@ func (s *Scanner) checkDevice(ctx context.Context, ip string) *ShellyDevice {
 		}).Debug("Failed to create request")
 		return nil
 	}
+	s.setUserAgent(req)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
@@ -226,8 +316,6 @@ func (s *Scanner) checkDevice(ctx context.Context, ip string) *ShellyDevice {
 	device.IP = ip
 	device.Discovered = time.Now()
 
-	s.logger.LogDeviceOperation("discovered", ip, device.MAC, nil)
-
 	return &device
 }
 
@@ -253,6 +341,7 @@ func (s *Scanner) GetDeviceStatus(ctx context.Context, ip string, gen int) (map[
 		s.logger.LogDeviceOperation("get_status", ip, "", err)
 		return nil, err
 	}
+	s.setUserAgent(req)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
@@ -0,0 +1,234 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrExcluded is returned when a host matches the discovery exclusions
+var ErrExcluded = errors.New("host is excluded from discovery")
+
+// Exclusions lists hosts discovery must never probe, such as printers, PLCs
+// or IDS sensors that alert on scans. Address ranges are checked before any
+// traffic is sent. MAC prefixes are checked against the local ARP cache
+// before probing and against the MAC a host reports; hostname patterns
+// against names from mDNS and reverse DNS.
+type Exclusions struct {
+	ranges      []ipRange
+	macPrefixes []string // upper-case hex digits only
+	hostnames   []string // lower-case glob patterns
+
+	// Lookups, replaceable in tests
+	lookupAddr func(ctx context.Context, ip string) ([]string, error)
+	arpTable   func() map[string]string
+
+	arpMu      sync.Mutex
+	arpCache   map[string]string
+	arpExpires time.Time
+}
+
+type ipRange struct {
+	first, last net.IP
+	text        string
+}
+
+// NewExclusions parses exclusion rules. networks holds CIDRs, single
+// addresses or first-last ranges ("192.168.1.10-192.168.1.20"),
+// macPrefixes MAC or OUI prefixes in any common notation and hostnames
+// glob patterns such as "printer-*" or "*.ids.example.com".
+func NewExclusions(networks, macPrefixes, hostnames []string) (*Exclusions, error) {
+	e := &Exclusions{
+		lookupAddr: net.DefaultResolver.LookupAddr,
+		arpTable:   readARPTable,
+	}
+	for _, n := range networks {
+		r, err := parseIPRange(strings.TrimSpace(n))
+		if err != nil {
+			return nil, err
+		}
+		e.ranges = append(e.ranges, r)
+	}
+	for _, p := range macPrefixes {
+		hex := normalizeMAC(p)
+		if hex == "" || len(hex) > 12 || strings.Trim(hex, "0123456789ABCDEF") != "" {
+			return nil, fmt.Errorf("invalid MAC prefix %q", p)
+		}
+		e.macPrefixes = append(e.macPrefixes, hex)
+	}
+	for _, h := range hostnames {
+		pattern := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(h), "."))
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return nil, fmt.Errorf("invalid hostname pattern %q", h)
+		}
+		e.hostnames = append(e.hostnames, pattern)
+	}
+	return e, nil
+}
+
+func parseIPRange(s string) (ipRange, error) {
+	if _, ipNet, err := net.ParseCIDR(s); err == nil {
+		last := make(net.IP, len(ipNet.IP))
+		for i := range ipNet.IP {
+			last[i] = ipNet.IP[i] | ^ipNet.Mask[i]
+		}
+		return ipRange{first: ipNet.IP, last: last, text: s}, nil
+	}
+	if first, last, ok := strings.Cut(s, "-"); ok {
+		a, b := net.ParseIP(strings.TrimSpace(first)), net.ParseIP(strings.TrimSpace(last))
+		if a == nil || b == nil || (a.To4() == nil) != (b.To4() == nil) || bytes.Compare(a.To16(), b.To16()) > 0 {
+			return ipRange{}, fmt.Errorf("invalid address range %q", s)
+		}
+		return ipRange{first: a, last: b, text: s}, nil
+	}
+	if ip := net.ParseIP(s); ip != nil {
+		return ipRange{first: ip, last: ip, text: s}, nil
+	}
+	return ipRange{}, fmt.Errorf("invalid network %q: expected a CIDR, address or range", s)
+}
+
+func (r ipRange) contains(ip net.IP) bool {
+	ip, first, last := ip.To16(), r.first.To16(), r.last.To16()
+	if (ip.To4() == nil) != (first.To4() == nil) {
+		return false
+	}
+	return bytes.Compare(ip, first) >= 0 && bytes.Compare(ip, last) <= 0
+}
+
+// IsZero reports whether there are no rules
+func (e *Exclusions) IsZero() bool {
+	return e == nil || (len(e.ranges) == 0 && len(e.macPrefixes) == 0 && len(e.hostnames) == 0)
+}
+
+// MatchIP returns the rule excluding the address, or "" if none does
+func (e *Exclusions) MatchIP(ip string) string {
+	if e == nil {
+		return ""
+	}
+	parsed := net.ParseIP(hostOnly(ip))
+	if parsed == nil {
+		return ""
+	}
+	for _, r := range e.ranges {
+		if r.contains(parsed) {
+			return "network " + r.text
+		}
+	}
+	return ""
+}
+
+// MatchMAC returns the rule excluding the MAC address, or "" if none does
+func (e *Exclusions) MatchMAC(mac string) string {
+	if e == nil || mac == "" {
+		return ""
+	}
+	hex := normalizeMAC(mac)
+	for _, p := range e.macPrefixes {
+		if strings.HasPrefix(hex, p) {
+			return "mac_prefix " + p
+		}
+	}
+	return ""
+}
+
+// MatchHostname returns the rule excluding the hostname, or "" if none does
+func (e *Exclusions) MatchHostname(name string) string {
+	if e == nil || name == "" {
+		return ""
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, p := range e.hostnames {
+		if ok, _ := path.Match(p, name); ok {
+			return "hostname " + p
+		}
+	}
+	return ""
+}
+
+// Check returns the rule excluding a host before it is probed, or "" if
+// none does. hostnames are names already known for the host, e.g. from
+// mDNS; reverse DNS is only consulted when hostname patterns are set.
+func (e *Exclusions) Check(ctx context.Context, host string, hostnames ...string) string {
+	if e.IsZero() {
+		return ""
+	}
+	if rule := e.MatchIP(host); rule != "" {
+		return rule
+	}
+	ip := hostOnly(host)
+	if len(e.macPrefixes) > 0 {
+		if rule := e.MatchMAC(e.arpMAC(ip)); rule != "" {
+			return rule
+		}
+	}
+	if len(e.hostnames) > 0 {
+		if net.ParseIP(ip) == nil {
+			hostnames = append(hostnames, ip)
+		} else if e.lookupAddr != nil {
+			lookupCtx, cancel := context.WithTimeout(ctx, time.Second)
+			names, _ := e.lookupAddr(lookupCtx, ip)
+			cancel()
+			hostnames = append(hostnames, names...)
+		}
+		for _, name := range hostnames {
+			if rule := e.MatchHostname(name); rule != "" {
+				return rule
+			}
+		}
+	}
+	return ""
+}
+
+// arpMAC returns the MAC address the ARP cache holds for ip
+func (e *Exclusions) arpMAC(ip string) string {
+	if e.arpTable == nil {
+		return ""
+	}
+	e.arpMu.Lock()
+	defer e.arpMu.Unlock()
+	if e.arpCache == nil || time.Now().After(e.arpExpires) {
+		e.arpCache = e.arpTable()
+		e.arpExpires = time.Now().Add(10 * time.Second)
+	}
+	return e.arpCache[ip]
+}
+
+// readARPTable reads the Linux neighbour cache; elsewhere it is empty and
+// MAC prefixes only apply to the MAC a host reports
+func readARPTable() map[string]string {
+	table := map[string]string{}
+	f, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return table
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 4 && fields[3] != "00:00:00:00:00:00" {
+			table[fields[0]] = fields[3]
+		}
+	}
+	return table
+}
+
+func normalizeMAC(mac string) string {
+	return strings.ToUpper(strings.NewReplacer(":", "", "-", "", ".", "").Replace(strings.TrimSpace(mac)))
+}
+
+// hostOnly strips a port from host:port
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
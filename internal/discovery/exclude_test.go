@@ -0,0 +1,106 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestNewExclusions_Invalid(t *testing.T) {
+	for _, tc := range []struct {
+		networks, macs, hosts []string
+	}{
+		{networks: []string{"192.168.1.0/33"}},
+		{networks: []string{"192.168.1.20-192.168.1.10"}},
+		{networks: []string{"printer"}},
+		{macs: []string{"00:1B:ZZ"}},
+		{macs: []string{"00:11:22:33:44:55:66"}},
+		{hosts: []string{"printer-["}},
+	} {
+		if _, err := NewExclusions(tc.networks, tc.macs, tc.hosts); err == nil {
+			t.Errorf("Expected %+v to be rejected", tc)
+		}
+	}
+}
+
+func TestExclusions_Match(t *testing.T) {
+	e, err := NewExclusions(
+		[]string{"192.168.1.0/28", "192.168.1.200-192.168.1.210", "10.0.0.7"},
+		[]string{"00:1b:a9", "a4-cf-12-34"},
+		[]string{"printer-*", "*.ids.example.com."},
+	)
+	if err != nil {
+		t.Fatalf("NewExclusions failed: %v", err)
+	}
+
+	for ip, excluded := range map[string]bool{
+		"192.168.1.15": true, "192.168.1.16": false,
+		"192.168.1.205": true, "192.168.1.211": false,
+		"10.0.0.7:80": true, "10.0.0.8": false, "not-an-ip": false,
+	} {
+		if got := e.MatchIP(ip) != ""; got != excluded {
+			t.Errorf("MatchIP(%s) = %v, expected %v", ip, got, excluded)
+		}
+	}
+	if e.MatchMAC("00:1B:A9:01:02:03") != "mac_prefix 001BA9" || e.MatchMAC("A4CF12345678") == "" || e.MatchMAC("A4CF12000000") != "" {
+		t.Error("Unexpected MAC prefix matches")
+	}
+	if e.MatchHostname("Printer-2F.local") == "" || e.MatchHostname("sensor1.ids.example.com.") == "" || e.MatchHostname("shellyplus1-a8032ab1e2c4.local") != "" {
+		t.Error("Unexpected hostname matches")
+	}
+
+	// Before probing, the ARP cache and reverse DNS identify the host
+	e.arpTable = func() map[string]string { return map[string]string{"192.168.1.50": "00:1b:a9:aa:bb:cc"} }
+	e.lookupAddr = func(ctx context.Context, ip string) ([]string, error) {
+		if ip == "192.168.1.60" {
+			return []string{"sensor1.ids.example.com."}, nil
+		}
+		return nil, errors.New("no PTR record")
+	}
+	ctx := context.Background()
+	if rule := e.Check(ctx, "192.168.1.50"); rule != "mac_prefix 001BA9" {
+		t.Errorf("Expected the ARP entry to exclude the host, got %q", rule)
+	}
+	if rule := e.Check(ctx, "192.168.1.60"); rule != "hostname *.ids.example.com" {
+		t.Errorf("Expected reverse DNS to exclude the host, got %q", rule)
+	}
+	if rule := e.Check(ctx, "192.168.1.70", "shellyplus1-a8032ab1e2c4.local."); rule != "" {
+		t.Errorf("Did not expect %q to match", rule)
+	}
+	if rule := e.Check(ctx, "192.168.1.70", "printer-hall.local."); rule == "" {
+		t.Error("Expected the mDNS host name to exclude the host")
+	}
+}
+
+func TestScanHost_Excluded(t *testing.T) {
+	testutil.SkipIfNoSocketPermissions(t)
+	server := testutil.MockShellyServer()
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse server URL: %v", err)
+	}
+	ctx := context.Background()
+
+	byIP, _ := NewExclusions([]string{"127.0.0.1"}, nil, nil)
+	if _, err := NewScanner(time.Second, 1, WithExclusions(byIP)).ScanHost(ctx, serverURL.Host); !errors.Is(err, ErrExcluded) {
+		t.Errorf("Expected the address to be excluded, got %v", err)
+	}
+
+	// The mock device reports MAC A4CF12345678
+	byMAC, _ := NewExclusions(nil, []string{"A4:CF:12"}, nil)
+	byMAC.arpTable = nil
+	if _, err := NewScanner(time.Second, 1, WithExclusions(byMAC)).ScanHost(ctx, serverURL.Host); !errors.Is(err, ErrExcluded) {
+		t.Errorf("Expected the reported MAC to be excluded, got %v", err)
+	}
+
+	other, _ := NewExclusions([]string{"10.0.0.0/8"}, []string{"00:1B:A9"}, nil)
+	device, err := NewScanner(time.Second, 1, WithExclusions(other)).ScanHost(ctx, serverURL.Host)
+	if err != nil || device == nil {
+		t.Errorf("Expected the device to be found, got %v, %v", device, err)
+	}
+}
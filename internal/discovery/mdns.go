@@ -16,15 +16,16 @@ type MDNSScanner struct {
 	scanner *Scanner
 }
 
-// NewMDNSScanner creates a new mDNS scanner
-func NewMDNSScanner(timeout time.Duration) *MDNSScanner {
+// NewMDNSScanner creates a new mDNS scanner; opts apply to the HTTP requests
+// verifying the announced devices
+func NewMDNSScanner(timeout time.Duration, opts ...ScannerOption) *MDNSScanner {
 	if timeout <= 0 {
 		timeout = 5 * time.Second
 	}
 
 	return &MDNSScanner{
 		timeout: timeout,
-		scanner: NewScanner(2*time.Second, 5),
+		scanner: NewScanner(2*time.Second, 5, opts...),
 	}
 }
 
@@ -73,7 +74,7 @@ func (m *MDNSScanner) DiscoverDevices(ctx context.Context) ([]ShellyDevice, erro
 		seen[ip] = true
 
 		// Verify it's actually a Shelly device by querying the API
-		device := m.scanner.checkDevice(ctx, ip)
+		device := m.scanner.checkDevice(ctx, ip, entry.Host)
 		if device != nil {
 			devices = append(devices, *device)
 		}
@@ -135,13 +136,13 @@ func (m *MDNSScanner) getBestIP(entry *mdns.ServiceEntry) string {
 }
 
 // CombinedDiscovery performs both HTTP scanning and mDNS discovery
-func CombinedDiscovery(ctx context.Context, networks []string, timeout time.Duration) ([]ShellyDevice, error) {
+func CombinedDiscovery(ctx context.Context, networks []string, timeout time.Duration, opts ...ScannerOption) ([]ShellyDevice, error) {
 	var allDevices []ShellyDevice
 	seen := make(map[string]bool)
 
 	// HTTP scanning for specified networks
 	if len(networks) > 0 {
-		scanner := NewScanner(timeout, 50) // Increased concurrency for faster scanning
+		scanner := NewScanner(timeout, 50, opts...) // Increased concurrency for faster scanning
 		for _, network := range networks {
 			devices, err := scanner.ScanNetwork(ctx, network)
 			if err != nil {
@@ -159,7 +160,7 @@ func CombinedDiscovery(ctx context.Context, networks []string, timeout time.Dura
 	}
 
 	// mDNS discovery
-	mdnsScanner := NewMDNSScanner(timeout)
+	mdnsScanner := NewMDNSScanner(timeout, opts...)
 	mdnsDevices, err := mdnsScanner.DiscoverDevices(ctx)
 	if err != nil {
 		fmt.Printf("mDNS discovery error: %v\n", err)
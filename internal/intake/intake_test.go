@@ -0,0 +1,142 @@
+package intake
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestParseLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Label
+	}{
+		{
+			name:    "wifi qr code",
+			content: "WIFI:S:ShellyPlus1-A8032AB1E2C4;T:WPA;P:label-secret;;",
+			want:    Label{MAC: "A8032AB1E2C4", Model: "ShellyPlus1", APSSID: "ShellyPlus1-A8032AB1E2C4", APPassword: "label-secret"},
+		},
+		{
+			name:    "key value text",
+			content: "MAC: a8:03:2a:b1:e2:c4; Model: SNSW-001X16EU\nname=kitchen",
+			want:    Label{MAC: "A8032AB1E2C4", Model: "SNSW-001X16EU", Name: "kitchen"},
+		},
+		{
+			name:    "device id",
+			content: "ID: shellyplus1-a8032ab1e2c4",
+			want:    Label{MAC: "A8032AB1E2C4", Model: "shellyplus1"},
+		},
+		{
+			name:    "url query",
+			content: "https://control.shelly.cloud/add?mac=A8032AB1E2C4&type=SNSW-001X16EU",
+			want:    Label{MAC: "A8032AB1E2C4", Model: "SNSW-001X16EU"},
+		},
+		{
+			name:    "bare mac",
+			content: "A8-03-2A-B1-E2-C4",
+			want:    Label{MAC: "A8032AB1E2C4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLabel(tt.content)
+			if err != nil {
+				t.Fatalf("ParseLabel failed: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParseLabel = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	for _, content := range []string{"", "hello world", "WIFI:S:my-home-network;P:x;;"} {
+		if _, err := ParseLabel(content); err == nil {
+			t.Errorf("Expected error for %q", content)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	headed := "mac,model,name,qr\n" +
+		"A8032AB1E2C4,,kitchen,\n" +
+		",,porch,\"WIFI:S:shelly1-DDEEFF;P:p1;;\"\n" +
+		"nope,,broken,\n"
+	labels, errs := ParseCSV(strings.NewReader(headed))
+	if len(labels) != 2 || len(errs) != 1 {
+		t.Fatalf("Expected 2 labels and 1 error, got %d and %v", len(labels), errs)
+	}
+	if labels[1].MAC != "DDEEFF" || labels[1].Name != "porch" || labels[1].APPassword != "p1" {
+		t.Errorf("Unexpected QR column label: %+v", labels[1])
+	}
+	if !strings.HasPrefix(errs[0].Error(), "line 4:") {
+		t.Errorf("Expected line number in error, got %v", errs[0])
+	}
+
+	labels, errs = ParseCSV(strings.NewReader("WIFI:S:ShellyPlus1-A8032AB1E2C4;P:x;;,garage\n\n"))
+	if len(errs) != 0 || len(labels) != 1 || labels[0].Name != "garage" {
+		t.Errorf("Unexpected headerless result: %+v %v", labels, errs)
+	}
+}
+
+func TestService_RegisterAndMatch(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	svc := NewService(db.GetDB(), logger)
+	ctx := context.Background()
+
+	label, err := ParseLabel("WIFI:S:shelly1-DDEEFF;T:WPA;P:ap-secret;;")
+	if err != nil {
+		t.Fatalf("ParseLabel failed: %v", err)
+	}
+	if _, err := svc.Register(ctx, *label, SourceQR); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	// Re-registering adds the name but keeps the password
+	entry, err := svc.Register(ctx, Label{MAC: "DDEEFF", Name: "porch"}, SourceManual)
+	if err != nil {
+		t.Fatalf("Register update failed: %v", err)
+	}
+	if entry.Name != "porch" || entry.APPassword != "ap-secret" || entry.Status != StatusPending {
+		t.Errorf("Unexpected updated entry: %+v", entry)
+	}
+
+	// AP scan: matched by SSID suffix
+	found, err := svc.Find(ctx, "", "shelly1-ddeeff")
+	if err != nil || found == nil || found.ID != entry.ID {
+		t.Fatalf("Expected AP scan match, got %+v (%v)", found, err)
+	}
+	if err := svc.MarkSeen(ctx, found); err != nil {
+		t.Fatalf("MarkSeen failed: %v", err)
+	}
+
+	// Discovery: matched by full MAC
+	found, err = svc.Find(ctx, "AA:BB:CC:DD:EE:FF", "")
+	if err != nil || found == nil || found.Status != StatusSeen {
+		t.Fatalf("Expected discovery match, got %+v (%v)", found, err)
+	}
+	if err := svc.MarkMatched(ctx, found, 42); err != nil {
+		t.Fatalf("MarkMatched failed: %v", err)
+	}
+	if found, _ := svc.Find(ctx, "AA:BB:CC:DD:EE:FF", ""); found != nil {
+		t.Errorf("Matched entries should not match again, got %+v", found)
+	}
+
+	matched, err := svc.List(ctx, StatusMatched)
+	if err != nil || len(matched) != 1 || matched[0].MatchedDeviceID == nil || *matched[0].MatchedDeviceID != 42 {
+		t.Fatalf("Expected one matched entry, got %+v (%v)", matched, err)
+	}
+	if err := svc.Delete(ctx, matched[0].ID); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if err := svc.Delete(ctx, matched[0].ID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package intake
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/provisioning"
+)
+
+// minMACDigits is the shortest MAC suffix accepted; Gen1 AP SSIDs show six digits
+const minMACDigits = 6
+
+// Label holds the device details read from a box label or QR code
+type Label struct {
+	MAC        string `json:"mac"`
+	Model      string `json:"model,omitempty"`
+	Name       string `json:"name,omitempty"`
+	APSSID     string `json:"ap_ssid,omitempty"`
+	APPassword string `json:"ap_password,omitempty"`
+	Room       string `json:"room,omitempty"`
+}
+
+// Normalize fills derived fields and validates the label. The MAC is reduced to
+// its hex digits; when missing it is taken from the AP SSID suffix.
+func (l *Label) Normalize() error {
+	l.MAC = config.NormalizeMAC(l.MAC)
+	if l.MAC == "" && l.APSSID != "" {
+		if i := strings.LastIndex(l.APSSID, "-"); i >= 0 {
+			suffix := l.APSSID[i+1:]
+			if digits := config.NormalizeMAC(suffix); len(digits) == len(suffix) {
+				l.MAC = digits
+			}
+		}
+	}
+	if l.Model == "" && l.APSSID != "" {
+		if i := strings.LastIndex(l.APSSID, "-"); i > 0 {
+			l.Model = l.APSSID[:i]
+		}
+	}
+	if len(l.MAC) < minMACDigits || len(l.MAC) > 12 {
+		return fmt.Errorf("label does not contain a valid MAC address")
+	}
+	return nil
+}
+
+// ParseLabel parses the content of a Shelly box QR code or label. Supported
+// forms are WiFi QR codes ("WIFI:S:ShellyPlus1-A8032AB1E2C4;T:WPA;P:secret;;"),
+// URLs with query parameters, key/value text ("MAC: A8032AB1E2C4; Model: SNSW-001X16EU")
+// separated by ';', ',' or newlines, and a bare MAC address.
+func ParseLabel(content string) (*Label, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, errors.New("empty label content")
+	}
+
+	label := &Label{}
+	lower := strings.ToLower(content)
+	switch {
+	case strings.HasPrefix(lower, "wifi:"):
+		qr, err := provisioning.ParseWiFiQRCode(content)
+		if err != nil {
+			return nil, err
+		}
+		label.APSSID = qr.SSID
+		label.APPassword = qr.Password
+	case strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://"):
+		u, err := url.Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label URL: %w", err)
+		}
+		for key, values := range u.Query() {
+			if len(values) > 0 {
+				label.set(key, values[0])
+			}
+		}
+	case isBareMAC(content):
+		label.MAC = content
+	default:
+		fields := strings.FieldsFunc(content, func(r rune) bool {
+			return r == ';' || r == ',' || r == '\n' || r == '\r'
+		})
+		for _, field := range fields {
+			key, value, ok := strings.Cut(field, ":")
+			if eqKey, eqValue, eqOK := strings.Cut(field, "="); eqOK && (!ok || len(eqKey) < len(key)) {
+				key, value, ok = eqKey, eqValue, true
+			}
+			if ok {
+				label.set(key, value)
+			}
+		}
+	}
+
+	if err := label.Normalize(); err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+// set assigns a label field from a key as printed on labels or used in CSV headers
+func (l *Label) set(key, value string) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "mac", "mac_address":
+		l.MAC = value
+	case "id":
+		// Device IDs such as "shellyplus1-a8032ab1e2c4" end with the MAC
+		if i := strings.LastIndex(value, "-"); i > 0 {
+			if l.Model == "" {
+				l.Model = value[:i]
+			}
+			value = value[i+1:]
+		}
+		l.MAC = value
+	case "model", "type", "sku":
+		l.Model = value
+	case "name", "device_name":
+		l.Name = value
+	case "room":
+		l.Room = value
+	case "ssid", "ap_ssid", "s":
+		l.APSSID = value
+	case "password", "pass", "pwd", "ap_password", "p":
+		l.APPassword = value
+	}
+}
+
+// isBareMAC reports whether s is a full MAC address with optional separators
+func isBareMAC(s string) bool {
+	for _, r := range s {
+		if r != ':' && r != '-' && r != '.' && config.NormalizeMAC(string(r)) == "" {
+			return false
+		}
+	}
+	return len(config.NormalizeMAC(s)) == 12
+}
+
+// ParseCSV reads labels from CSV. With a header row containing "mac", "ssid"
+// or "qr", columns are mapped by name (a "qr" column holds raw QR content that
+// other columns may complete). Without a header the first column is QR
+// content and an optional second column the device name. Rows that cannot be
+// parsed are reported as errors with their line number; valid rows are kept.
+func ParseCSV(r io.Reader) ([]Label, []error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, []error{fmt.Errorf("invalid CSV: %w", err)}
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var header []string
+	start := 0
+	for _, col := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(col)) {
+		case "mac", "ssid", "ap_ssid", "qr":
+			header = records[0]
+			start = 1
+		}
+	}
+
+	var labels []Label
+	var errs []error
+	for i := start; i < len(records); i++ {
+		label, err := parseRecord(header, records[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", i+1, err))
+			continue
+		}
+		if label != nil {
+			labels = append(labels, *label)
+		}
+	}
+	return labels, errs
+}
+
+// parseRecord converts one CSV row; blank rows yield nil
+func parseRecord(header, record []string) (*Label, error) {
+	blank := true
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			blank = false
+		}
+	}
+	if blank {
+		return nil, nil
+	}
+
+	if header == nil {
+		label, err := ParseLabel(record[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(record) > 1 && strings.TrimSpace(record[1]) != "" {
+			label.Name = strings.TrimSpace(record[1])
+		}
+		return label, nil
+	}
+
+	label := &Label{}
+	for i, col := range header {
+		if i >= len(record) || strings.TrimSpace(record[i]) == "" {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(col), "qr") {
+			parsed, err := ParseLabel(record[i])
+			if err != nil {
+				return nil, err
+			}
+			label.Merge(parsed)
+			continue
+		}
+		label.set(col, record[i])
+	}
+	if err := label.Normalize(); err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+// Merge copies fields from other that are not yet set
+func (l *Label) Merge(other *Label) {
+	if l.MAC == "" {
+		l.MAC = other.MAC
+	}
+	if l.Model == "" {
+		l.Model = other.Model
+	}
+	if l.Name == "" {
+		l.Name = other.Name
+	}
+	if l.APSSID == "" {
+		l.APSSID = other.APSSID
+	}
+	if l.APPassword == "" {
+		l.APPassword = other.APPassword
+	}
+	if l.Room == "" {
+		l.Room = other.Room
+	}
+}
@@ -0,0 +1,215 @@
+package intake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+// Intake sources
+const (
+	SourceQR     = "qr"
+	SourceCSV    = "csv"
+	SourceManual = "manual"
+	SourceCloud  = "cloud"
+)
+
+// Intake states. An entry is "seen" once its AP shows up in a scan and
+// "matched" once discovery links it to an inventory device.
+const (
+	StatusPending = "pending"
+	StatusSeen    = "seen"
+	StatusMatched = "matched"
+)
+
+// ErrNotFound is returned when an intake entry does not exist
+var ErrNotFound = errors.New("intake entry not found")
+
+// ImportResult summarises a CSV intake
+type ImportResult struct {
+	Registered []database.DeviceIntake `json:"registered"`
+	Errors     []string                `json:"errors,omitempty"`
+}
+
+// Service stores pre-registered devices and matches them against AP scans and
+// network discovery
+type Service struct {
+	db     *gorm.DB
+	logger *logging.Logger
+}
+
+// NewService creates a new intake service
+func NewService(db *gorm.DB, logger *logging.Logger) *Service {
+	if logger == nil {
+		logger = logging.GetDefault()
+	}
+	return &Service{db: db, logger: logger}
+}
+
+// Register stores a label. Registering the same MAC again updates the entry;
+// fields missing from the new label keep their previous values.
+func (s *Service) Register(ctx context.Context, label Label, source string) (*database.DeviceIntake, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("intake storage not available")
+	}
+	if err := label.Normalize(); err != nil {
+		return nil, err
+	}
+
+	entry := database.DeviceIntake{
+		MAC:        label.MAC,
+		Model:      label.Model,
+		Name:       label.Name,
+		APSSID:     label.APSSID,
+		APPassword: label.APPassword,
+		Room:       label.Room,
+		Source:     source,
+		Status:     StatusPending,
+	}
+	var updates []string
+	for column, value := range map[string]string{
+		"model":       label.Model,
+		"name":        label.Name,
+		"ap_ssid":     label.APSSID,
+		"ap_password": label.APPassword,
+		"room":        label.Room,
+	} {
+		if value != "" {
+			updates = append(updates, column)
+		}
+	}
+	updates = append(updates, "source", "updated_at")
+
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "mac"}},
+		DoUpdates: clause.AssignmentColumns(updates),
+	}).Create(&entry).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to register device %s: %w", label.MAC, err)
+	}
+
+	var stored database.DeviceIntake
+	if err := s.db.WithContext(ctx).Where("mac = ?", label.MAC).First(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(map[string]any{
+		"mac":       stored.MAC,
+		"model":     stored.Model,
+		"name":      stored.Name,
+		"source":    source,
+		"component": "intake",
+	}).Info("Device pre-registered")
+	return &stored, nil
+}
+
+// ImportCSV registers every valid row of a CSV file. Invalid rows are reported
+// in the result without aborting the import.
+func (s *Service) ImportCSV(ctx context.Context, r io.Reader) (*ImportResult, error) {
+	labels, parseErrs := ParseCSV(r)
+	result := &ImportResult{Registered: []database.DeviceIntake{}}
+	for _, err := range parseErrs {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	for _, label := range labels {
+		entry, err := s.Register(ctx, label, SourceCSV)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.Registered = append(result.Registered, *entry)
+	}
+	return result, nil
+}
+
+// List returns intake entries, newest first. An empty status returns all.
+func (s *Service) List(ctx context.Context, status string) ([]database.DeviceIntake, error) {
+	items := []database.DeviceIntake{}
+	if s.db == nil {
+		return items, nil
+	}
+	q := s.db.WithContext(ctx).Model(&database.DeviceIntake{})
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if err := q.Order("created_at DESC, id DESC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Delete removes an intake entry
+func (s *Service) Delete(ctx context.Context, id uint) error {
+	if s.db == nil {
+		return ErrNotFound
+	}
+	res := s.db.WithContext(ctx).Delete(&database.DeviceIntake{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Find returns the unmatched entry for a device seen by MAC and/or AP SSID.
+// Labels registered with a MAC suffix match the full MAC and the SSID suffix.
+// It returns nil when no entry applies.
+func (s *Service) Find(ctx context.Context, mac, ssid string) (*database.DeviceIntake, error) {
+	if s == nil || s.db == nil || (mac == "" && ssid == "") {
+		return nil, nil
+	}
+	var entries []database.DeviceIntake
+	if err := s.db.WithContext(ctx).Where("status <> ?", StatusMatched).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		cred := config.APCredential{MAC: entries[i].MAC, SSID: entries[i].APSSID}
+		if cred.Matches(mac, ssid) {
+			return &entries[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// MarkSeen records that an entry's AP was found in a scan
+func (s *Service) MarkSeen(ctx context.Context, entry *database.DeviceIntake) error {
+	if entry.Status != StatusPending {
+		return nil
+	}
+	entry.Status = StatusSeen
+	return s.db.WithContext(ctx).Model(entry).Update("status", StatusSeen).Error
+}
+
+// MarkMatched links an entry to the inventory device it became
+func (s *Service) MarkMatched(ctx context.Context, entry *database.DeviceIntake, deviceID uint) error {
+	now := time.Now()
+	entry.Status = StatusMatched
+	entry.MatchedDeviceID = &deviceID
+	entry.MatchedAt = &now
+	err := s.db.WithContext(ctx).Model(entry).Updates(map[string]any{
+		"status":            StatusMatched,
+		"matched_device_id": deviceID,
+		"matched_at":        now,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	s.logger.WithFields(map[string]any{
+		"mac":       entry.MAC,
+		"device_id": deviceID,
+		"component": "intake",
+	}).Info("Pre-registered device matched")
+	return nil
+}
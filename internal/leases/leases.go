@@ -0,0 +1,150 @@
+// Package leases reads DHCP lease tables from routers to find Shelly devices
+// by MAC vendor prefix or hostname, for networks where subnet scans are not
+// allowed.
+package leases
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+// Ways a lease is recognised as a Shelly device
+const (
+	MatchHostname = "hostname"
+	MatchOUI      = "oui"
+)
+
+// DefaultShellyOUIs are the vendor prefixes of the Espressif radios Shelly
+// devices use. Other ESP based devices share them, so a match is only a
+// candidate until the device answers the Shelly API.
+var DefaultShellyOUIs = []string{
+	"08:3A:F2", "08:B6:1F", "0C:B8:15", "10:52:1C", "24:0A:C4", "24:62:AB",
+	"30:83:98", "30:C6:F7", "34:86:5D", "34:94:54", "34:98:7A", "34:AB:95",
+	"3C:61:05", "40:22:D8", "44:17:93", "48:3F:DA", "48:55:19", "4C:75:25",
+	"5C:CF:7F", "60:01:94", "64:B7:08", "68:C6:3A", "70:03:9F", "78:21:84",
+	"7C:87:CE", "80:64:6F", "84:0D:8E", "84:CC:A8", "84:F3:EB", "8C:AA:B5",
+	"94:B9:7E", "98:CD:AC", "A4:CF:12", "A8:03:2A", "A8:48:FA", "AC:0B:FB",
+	"B0:B2:1C", "B4:8A:0A", "BC:DD:C2", "BC:FF:4D", "C4:4F:33", "C4:5B:BE",
+	"C4:DD:57", "C8:2B:96", "C8:C9:A3", "C8:F0:9E", "CC:50:E3", "D8:BF:C0",
+	"DC:4F:22", "E0:98:06", "E8:68:E7", "E8:DB:84", "EC:62:60", "EC:64:C9",
+	"EC:FA:BC", "F4:CF:A2", "FC:F5:C4",
+}
+
+// Lease is an IPv4 DHCP lease
+type Lease struct {
+	Router   string     `json:"router"`
+	MAC      string     `json:"mac"` // upper case, colon separated
+	IP       string     `json:"ip"`
+	Hostname string     `json:"hostname,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"` // nil for static leases
+}
+
+// Reader reads the lease table of a router
+type Reader interface {
+	Leases(ctx context.Context) ([]Lease, error)
+}
+
+// NewReader creates the reader for a configured router
+func NewReader(router config.DHCPLeaseRouter, logger *logging.Logger) (Reader, error) {
+	if logger == nil {
+		logger = logging.GetDefault()
+	}
+	if router.Name == "" {
+		return nil, fmt.Errorf("router name is required")
+	}
+	base, err := url.Parse(strings.TrimRight(router.URL, "/"))
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("router %s: invalid url %q", router.Name, router.URL)
+	}
+	switch router.Type {
+	case config.DHCPRouterOPNsense:
+		return newOPNsenseReader(router, base, logger)
+	case config.DHCPRouterOpenWrt:
+		return &openWrtReader{router: router, base: base, client: httpClient(router)}, nil
+	case config.DHCPRouterMikroTik:
+		return &mikroTikReader{router: router, base: base, client: httpClient(router)}, nil
+	}
+	return nil, fmt.Errorf("router %s: unsupported type %q", router.Name, router.Type)
+}
+
+// Matcher recognises Shelly devices in lease tables
+type Matcher struct {
+	prefixes []string
+}
+
+// NewMatcher creates a matcher for the vendor prefixes, or for
+// DefaultShellyOUIs when none are given
+func NewMatcher(ouis []string) *Matcher {
+	if len(ouis) == 0 {
+		ouis = DefaultShellyOUIs
+	}
+	m := &Matcher{}
+	for _, oui := range ouis {
+		if p := hexDigits(oui); p != "" {
+			m.prefixes = append(m.prefixes, p)
+		}
+	}
+	return m
+}
+
+// Match tells how a lease is recognised as a Shelly device: by a hostname
+// starting with "shelly", as devices name themselves, or by the vendor
+// prefix of its MAC. It returns "" for other leases.
+func (m *Matcher) Match(lease Lease) string {
+	if strings.HasPrefix(strings.ToLower(lease.Hostname), "shelly") {
+		return MatchHostname
+	}
+	mac := hexDigits(lease.MAC)
+	for _, p := range m.prefixes {
+		if strings.HasPrefix(mac, p) {
+			return MatchOUI
+		}
+	}
+	return ""
+}
+
+// hexDigits reduces a MAC or prefix in any notation to upper case digits
+func hexDigits(mac string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(mac) {
+		if (r >= '0' && r <= '9') || (r >= 'A' && r <= 'F') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// formatMAC writes a MAC as upper case, colon separated pairs; values that
+// are not 12 digits are returned upper cased
+func formatMAC(mac string) string {
+	digits := hexDigits(mac)
+	if len(digits) != 12 {
+		return strings.ToUpper(strings.TrimSpace(mac))
+	}
+	pairs := make([]string, 6)
+	for i := range pairs {
+		pairs[i] = digits[i*2 : i*2+2]
+	}
+	return strings.Join(pairs, ":")
+}
+
+// httpClient creates the HTTP client for a router
+func httpClient(router config.DHCPLeaseRouter) *http.Client {
+	timeout := time.Duration(router.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	transport := &http.Transport{}
+	if router.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402 -- opt-in for self-signed router certificates
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,158 @@
+package leases
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+)
+
+func TestMatcher(t *testing.T) {
+	m := NewMatcher(nil)
+	assert.Equal(t, MatchHostname, m.Match(Lease{MAC: "11:22:33:44:55:66", Hostname: "ShellyPlus1-A8032AB1E2C4"}))
+	assert.Equal(t, MatchOUI, m.Match(Lease{MAC: "e8db84aabbcc", Hostname: "esp"}))
+	assert.Equal(t, "", m.Match(Lease{MAC: "11:22:33:44:55:66", Hostname: "laptop"}))
+
+	custom := NewMatcher([]string{"11-22-33"})
+	assert.Equal(t, MatchOUI, custom.Match(Lease{MAC: "11:22:33:44:55:66"}))
+	assert.Equal(t, "", custom.Match(Lease{MAC: "E8:DB:84:AA:BB:CC"}))
+}
+
+func TestNewReader(t *testing.T) {
+	for _, router := range []config.DHCPLeaseRouter{
+		{Name: "", Type: config.DHCPRouterOpenWrt, URL: "http://10.0.0.1"},
+		{Name: "gw", Type: config.DHCPRouterOpenWrt, URL: "10.0.0.1"},
+		{Name: "gw", Type: "pfsense", URL: "http://10.0.0.1"},
+		{Name: "gw", Type: config.DHCPRouterOPNsense, URL: "https://10.0.0.1"}, // no API key
+	} {
+		_, err := NewReader(router, nil)
+		assert.Error(t, err, "router %+v", router)
+	}
+}
+
+func TestOPNsenseReader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/dhcpv4/leases/searchLease", r.URL.Path)
+		_, _ = w.Write([]byte(`{"total":3,"rows":[
+			{"address":"10.0.0.50","mac":"e8:db:84:aa:bb:cc","hostname":"shelly1-AABBCC","state":"active","type":"dynamic","ends":"2024/05/01 12:00:00"},
+			{"address":"10.0.0.51","mac":"e8:db:84:aa:bb:cd","state":"expired","type":"dynamic"},
+			{"address":"10.0.0.52","mac":"e8:db:84:aa:bb:ce","hostname":"plug","type":"static"}]}`))
+	}))
+	defer server.Close()
+
+	reader, err := NewReader(config.DHCPLeaseRouter{Name: "gw", Type: config.DHCPRouterOPNsense, URL: server.URL,
+		APIKey: "key", APISecret: "secret"}, nil)
+	require.NoError(t, err)
+	leases, err := reader.Leases(context.Background())
+	require.NoError(t, err)
+	require.Len(t, leases, 2)
+	assert.Equal(t, Lease{Router: "gw", MAC: "E8:DB:84:AA:BB:CC", IP: "10.0.0.50", Hostname: "shelly1-AABBCC",
+		Expires: leases[0].Expires}, leases[0])
+	require.NotNil(t, leases[0].Expires)
+	assert.Equal(t, 2024, leases[0].Expires.Year())
+	assert.Nil(t, leases[1].Expires)
+}
+
+func TestOpenWrtReader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ubus", r.URL.Path)
+		var call struct {
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&call))
+		var session, object string
+		_ = json.Unmarshal(call.Params[0], &session)
+		_ = json.Unmarshal(call.Params[1], &object)
+		switch {
+		case object == "session":
+			var args map[string]string
+			_ = json.Unmarshal(call.Params[3], &args)
+			if args["password"] != "secret" {
+				_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[6]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[0,{"ubus_rpc_session":"abc"}]}`))
+		case object == "luci-rpc" && session == "abc":
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[0,{"dhcp_leases":[
+				{"expires":3600,"hostname":"shellyplus1-a8032ab1e2c4","macaddr":"a8:03:2a:b1:e2:c4","ipaddr":"192.168.1.60"},
+				{"expires":-1,"hostname":"nas","macaddr":"11:22:33:44:55:66","ipaddr":"192.168.1.2"}]}]}`))
+		default:
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[6]}`))
+		}
+	}))
+	defer server.Close()
+
+	router := config.DHCPLeaseRouter{Name: "owrt", Type: config.DHCPRouterOpenWrt, URL: server.URL + "/", Username: "root", Password: "secret"}
+	reader, err := NewReader(router, nil)
+	require.NoError(t, err)
+	leases, err := reader.Leases(context.Background())
+	require.NoError(t, err)
+	require.Len(t, leases, 2)
+	assert.Equal(t, "A8:03:2A:B1:E2:C4", leases[0].MAC)
+	assert.Equal(t, "192.168.1.60", leases[0].IP)
+	require.NotNil(t, leases[0].Expires)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *leases[0].Expires, time.Minute)
+	assert.Nil(t, leases[1].Expires)
+
+	router.Password = "wrong"
+	reader, err = NewReader(router, nil)
+	require.NoError(t, err)
+	_, err = reader.Leases(context.Background())
+	assert.ErrorContains(t, err, "ubus login failed")
+}
+
+func TestMikroTikReader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rest/ip/dhcp-server/lease", r.URL.Path)
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`[
+			{".id":"*1","address":"192.168.88.20","active-address":"192.168.88.21","mac-address":"C8:F0:9E:00:00:01","host-name":"shellypro4pm","status":"bound","dynamic":"true","expires-after":"1d2h3m4s"},
+			{".id":"*2","address":"192.168.88.30","mac-address":"C8:F0:9E:00:00:02","status":"waiting","dynamic":"false"},
+			{".id":"*3","address":"192.168.88.40","mac-address":"C8:F0:9E:00:00:03","status":"bound","dynamic":"false"}]`))
+	}))
+	defer server.Close()
+
+	router := config.DHCPLeaseRouter{Name: "mt", Type: config.DHCPRouterMikroTik, URL: server.URL, Username: "admin", Password: "secret"}
+	reader, err := NewReader(router, nil)
+	require.NoError(t, err)
+	leases, err := reader.Leases(context.Background())
+	require.NoError(t, err)
+	require.Len(t, leases, 2)
+	assert.Equal(t, "192.168.88.21", leases[0].IP)
+	assert.Equal(t, "shellypro4pm", leases[0].Hostname)
+	require.NotNil(t, leases[0].Expires)
+	assert.WithinDuration(t, time.Now().Add(26*time.Hour+3*time.Minute+4*time.Second), *leases[0].Expires, time.Minute)
+	assert.Nil(t, leases[1].Expires)
+
+	router.Password = "wrong"
+	reader, err = NewReader(router, nil)
+	require.NoError(t, err)
+	_, err = reader.Leases(context.Background())
+	assert.ErrorContains(t, err, "HTTP 401")
+}
+
+func TestParseRouterOSDuration(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"9m52s": 9*time.Minute + 52*time.Second,
+		"1w":    7 * 24 * time.Hour,
+		"3h":    3 * time.Hour,
+	} {
+		got, ok := parseRouterOSDuration(in)
+		assert.True(t, ok, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"", "never", "5x", "10"} {
+		_, ok := parseRouterOSDuration(in)
+		assert.False(t, ok, in)
+	}
+}
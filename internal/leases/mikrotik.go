@@ -0,0 +1,108 @@
+package leases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+)
+
+// mikroTikReader reads leases through the RouterOS v7 REST API, which is
+// served by the www or www-ssl service
+type mikroTikReader struct {
+	router config.DHCPLeaseRouter
+	base   *url.URL
+	client *http.Client
+}
+
+// mikroTikLease is a /ip/dhcp-server/lease entry; RouterOS returns every
+// value as a string
+type mikroTikLease struct {
+	Address       string `json:"address"`
+	ActiveAddress string `json:"active-address"`
+	MAC           string `json:"mac-address"`
+	ActiveMAC     string `json:"active-mac-address"`
+	HostName      string `json:"host-name"`
+	Status        string `json:"status"` // bound, waiting, offered, ...
+	Dynamic       string `json:"dynamic"`
+	ExpiresAfter  string `json:"expires-after"` // e.g. "9m52s"
+	Disabled      string `json:"disabled"`
+}
+
+// Leases returns the bound leases
+func (r *mikroTikReader) Leases(ctx context.Context) ([]Lease, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.base.String()+"/rest/ip/dhcp-server/lease", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(r.router.Username, r.router.Password)
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DHCP leases: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DHCP leases: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read DHCP leases: HTTP %d", resp.StatusCode)
+	}
+	var rows []mikroTikLease
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("invalid DHCP lease response: %w", err)
+	}
+
+	now := time.Now()
+	leases := make([]Lease, 0, len(rows))
+	for _, row := range rows {
+		if row.Status != "bound" || row.Disabled == "true" {
+			continue
+		}
+		lease := Lease{Router: r.router.Name, MAC: formatMAC(row.MAC), IP: row.Address, Hostname: row.HostName}
+		if row.ActiveAddress != "" {
+			lease.IP = row.ActiveAddress
+		}
+		if row.ActiveMAC != "" {
+			lease.MAC = formatMAC(row.ActiveMAC)
+		}
+		if left, ok := parseRouterOSDuration(row.ExpiresAfter); ok && row.Dynamic == "true" {
+			expires := now.Add(left)
+			lease.Expires = &expires
+		}
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+// parseRouterOSDuration parses RouterOS durations such as "1w2d3h4m5s"
+func parseRouterOSDuration(s string) (time.Duration, bool) {
+	units := map[byte]time.Duration{
+		'w': 7 * 24 * time.Hour, 'd': 24 * time.Hour, 'h': time.Hour, 'm': time.Minute, 's': time.Second,
+	}
+	var total time.Duration
+	start := 0
+	for i := 0; i < len(s); i++ {
+		unit, ok := units[s[i]]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(s[start:i])
+		if err != nil {
+			return 0, false
+		}
+		total += time.Duration(n) * unit
+		start = i + 1
+	}
+	if s == "" || start != len(s) {
+		return 0, false
+	}
+	return total, true
+}
@@ -0,0 +1,121 @@
+package leases
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+)
+
+// ubusNoSession is the anonymous session ID used to log in
+const ubusNoSession = "00000000000000000000000000000000"
+
+// openWrtReader reads leases over the ubus JSON-RPC endpoint of uhttpd. The
+// user needs read access to luci-rpc, as LuCI's status pages do.
+type openWrtReader struct {
+	router config.DHCPLeaseRouter
+	base   *url.URL
+	client *http.Client
+}
+
+// Leases logs in and returns the IPv4 leases of dnsmasq or odhcpd
+func (r *openWrtReader) Leases(ctx context.Context) ([]Lease, error) {
+	var login struct {
+		Session string `json:"ubus_rpc_session"`
+	}
+	if err := r.call(ctx, ubusNoSession, "session", "login",
+		map[string]string{"username": r.router.Username, "password": r.router.Password}, &login); err != nil {
+		return nil, fmt.Errorf("ubus login failed: %w", err)
+	}
+
+	var table struct {
+		Leases []struct {
+			Expires  int64  `json:"expires"` // seconds left, 0 or less for static leases
+			Hostname string `json:"hostname"`
+			MAC      string `json:"macaddr"`
+			IP       string `json:"ipaddr"`
+		} `json:"dhcp_leases"`
+	}
+	if err := r.call(ctx, login.Session, "luci-rpc", "getDHCPLeases", map[string]string{}, &table); err != nil {
+		return nil, fmt.Errorf("failed to read DHCP leases: %w", err)
+	}
+
+	now := time.Now()
+	leases := make([]Lease, 0, len(table.Leases))
+	for _, l := range table.Leases {
+		if l.IP == "" {
+			continue
+		}
+		lease := Lease{Router: r.router.Name, MAC: formatMAC(l.MAC), IP: l.IP, Hostname: l.Hostname}
+		if l.Expires > 0 {
+			expires := now.Add(time.Duration(l.Expires) * time.Second)
+			lease.Expires = &expires
+		}
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+// call invokes a ubus method and decodes its data into out
+func (r *openWrtReader) call(ctx context.Context, session, object, method string, args, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "call",
+		"params":  []interface{}{session, object, method, args},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.base.String()+"/ubus", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	var reply struct {
+		Result []json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return fmt.Errorf("invalid ubus reply: %w", err)
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("ubus error %d: %s", reply.Error.Code, reply.Error.Message)
+	}
+	if len(reply.Result) == 0 {
+		return fmt.Errorf("empty ubus reply")
+	}
+	var code int
+	if err := json.Unmarshal(reply.Result[0], &code); err != nil {
+		return fmt.Errorf("invalid ubus status: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("ubus status %d", code) // 6: permission denied
+	}
+	if len(reply.Result) < 2 {
+		return fmt.Errorf("ubus reply without data")
+	}
+	return json.Unmarshal(reply.Result[1], out)
+}
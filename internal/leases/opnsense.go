@@ -0,0 +1,64 @@
+package leases
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/opnsense"
+)
+
+// opnsenseLeaseTime is the layout of OPNsense lease end times, in the
+// router's local time
+const opnsenseLeaseTime = "2006/01/02 15:04:05"
+
+// opnsenseReader reads leases through the OPNsense API
+type opnsenseReader struct {
+	name string
+	dhcp *opnsense.DHCPManager
+}
+
+func newOPNsenseReader(router config.DHCPLeaseRouter, base *url.URL, logger *logging.Logger) (Reader, error) {
+	port := 0
+	if p := base.Port(); p != "" {
+		port, _ = strconv.Atoi(p)
+	}
+	client, err := opnsense.NewClient(opnsense.ClientConfig{
+		Host:               base.Hostname(),
+		Port:               port,
+		UseHTTPS:           base.Scheme == "https",
+		APIKey:             router.APIKey,
+		APISecret:          router.APISecret,
+		Timeout:            httpClient(router).Timeout,
+		InsecureSkipVerify: router.InsecureSkipVerify,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &opnsenseReader{name: router.Name, dhcp: opnsense.NewDHCPManager(client)}, nil
+}
+
+// Leases returns the leases that have not expired
+func (r *opnsenseReader) Leases(ctx context.Context) ([]Lease, error) {
+	rows, err := r.dhcp.GetLeases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	leases := make([]Lease, 0, len(rows))
+	for _, row := range rows {
+		if row.State == "expired" || row.Address == "" {
+			continue
+		}
+		lease := Lease{Router: r.name, MAC: formatMAC(row.MAC), IP: row.Address, Hostname: row.Hostname}
+		if row.Type != "static" {
+			if ends, err := time.ParseInLocation(opnsenseLeaseTime, row.Ends, time.Local); err == nil {
+				lease.Expires = &ends
+			}
+		}
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// consoleWriter writes to stdout or stderr unless console output is
+// redirected
+type consoleWriter struct {
+	std io.Writer
+}
+
+var (
+	consoleMu       sync.RWMutex
+	consoleRedirect io.Writer
+
+	stdoutWriter = &consoleWriter{std: os.Stdout}
+	stderrWriter = &consoleWriter{std: os.Stderr}
+)
+
+func (c *consoleWriter) Write(p []byte) (int, error) {
+	consoleMu.RLock()
+	defer consoleMu.RUnlock()
+	if consoleRedirect != nil {
+		return consoleRedirect.Write(p)
+	}
+	return c.std.Write(p)
+}
+
+// RedirectConsole sends the output of every logger that writes to stdout or
+// stderr to w, for example while a full-screen terminal UI owns the
+// terminal. The returned function restores console output.
+func RedirectConsole(w io.Writer) (restore func()) {
+	consoleMu.Lock()
+	previous := consoleRedirect
+	consoleRedirect = w
+	consoleMu.Unlock()
+	return func() {
+		consoleMu.Lock()
+		consoleRedirect = previous
+		consoleMu.Unlock()
+	}
+}
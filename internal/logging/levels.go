@@ -0,0 +1,168 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Subsystems groups the component values logged by each subsystem, so one
+// level covers e.g. every API middleware. Levels can be set per subsystem or
+// per component value.
+var Subsystems = map[string][]string{
+	"api": {"api", "api_response", "http", "validation", "request_limits", "rate_limiter",
+		"cors", "security_headers", "notification_api", "provisioner_handler", "provisioning_ui", "admin"},
+	"discovery":     {"discovery", "device", "shelly_factory"},
+	"configuration": {"configuration", "config", "config_service", "config_applier", "config_verifier", "template", "reporter", "resolution"},
+	"metrics":       {"metrics", "metrics_collector", "websocket", "energy"},
+	"provisioning":  {"provisioning", "provision", "shelly_provisioner", "network_interface", "agent", "api_client", "intake", "scan", "status"},
+}
+
+var subsystemOf = func() map[string]string {
+	m := map[string]string{}
+	for subsystem, components := range Subsystems {
+		for _, c := range components {
+			m[c] = subsystem
+		}
+	}
+	return m
+}()
+
+// LevelControl holds a logger's global level and per-component overrides.
+// It is shared by every logger derived from the same New call and can be
+// changed at runtime.
+type LevelControl struct {
+	mu    sync.Mutex // serialises updates
+	state atomic.Pointer[levelState]
+}
+
+type levelState struct {
+	global     slog.Level
+	components map[string]slog.Level
+	min        slog.Level // lowest level anything is logged at
+}
+
+func newLevelControl(global slog.Level) *LevelControl {
+	c := &LevelControl{}
+	c.state.Store(&levelState{global: global, components: map[string]slog.Level{}, min: global})
+	return c
+}
+
+// ParseLevel converts a level name (debug, info, warn, error) to a slog level
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case LevelDebug:
+		return slog.LevelDebug, nil
+	case LevelInfo:
+		return slog.LevelInfo, nil
+	case LevelWarn, "warning":
+		return slog.LevelWarn, nil
+	case LevelError:
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", level)
+}
+
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// Level returns the global level
+func (c *LevelControl) Level() string {
+	return levelName(c.state.Load().global)
+}
+
+// ComponentLevels returns the per-subsystem and per-component overrides
+func (c *LevelControl) ComponentLevels() map[string]string {
+	out := map[string]string{}
+	for name, level := range c.state.Load().components {
+		out[name] = levelName(level)
+	}
+	return out
+}
+
+// SetLevel changes the global level
+func (c *LevelControl) SetLevel(level string) error {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	c.update(func(s *levelState) { s.global = parsed })
+	return nil
+}
+
+// SetComponentLevel overrides the level of a subsystem (see Subsystems) or
+// a single component value; an empty level removes the override
+func (c *LevelControl) SetComponentLevel(component, level string) error {
+	component = strings.ToLower(strings.TrimSpace(component))
+	if component == "" {
+		return fmt.Errorf("component is required")
+	}
+	if level == "" {
+		c.update(func(s *levelState) { delete(s.components, component) })
+		return nil
+	}
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	c.update(func(s *levelState) { s.components[component] = parsed })
+	return nil
+}
+
+// ResetComponents removes every component override
+func (c *LevelControl) ResetComponents() {
+	c.update(func(s *levelState) { s.components = map[string]slog.Level{} })
+}
+
+func (c *LevelControl) update(fn func(*levelState)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.state.Load()
+	next := &levelState{global: old.global, components: make(map[string]slog.Level, len(old.components))}
+	for k, v := range old.components {
+		next.components[k] = v
+	}
+	fn(next)
+	next.min = next.global
+	for _, v := range next.components {
+		if v < next.min {
+			next.min = v
+		}
+	}
+	c.state.Store(next)
+}
+
+// levelFor returns the level records of a component are logged at: an
+// override of the component value, else of its subsystem, else the global
+// level
+func (c *LevelControl) levelFor(component string) slog.Level {
+	s := c.state.Load()
+	if component != "" && len(s.components) > 0 {
+		if level, ok := s.components[component]; ok {
+			return level
+		}
+		if level, ok := s.components[subsystemOf[component]]; ok {
+			return level
+		}
+	}
+	return s.global
+}
+
+// minLevel returns the lowest level any component is logged at
+func (c *LevelControl) minLevel() slog.Level {
+	return c.state.Load().min
+}
+
+// SubsystemNames returns the subsystem names in order
+func SubsystemNames() []string {
+	names := make([]string, 0, len(Subsystems))
+	for name := range Subsystems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLevelControl_Components(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "levels.log")
+	logger, err := New(Config{Level: LevelInfo, Format: "json", Output: logFile})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer func() { _ = logger.Close() }()
+	levels := logger.Levels()
+
+	if err := levels.SetComponentLevel("discovery", "verbose"); err == nil {
+		t.Error("Expected an unknown level to be rejected")
+	}
+	if err := levels.SetComponentLevel("discovery", LevelDebug); err != nil {
+		t.Fatalf("SetComponentLevel failed: %v", err)
+	}
+	if err := levels.SetComponentLevel("metrics_collector", LevelError); err != nil {
+		t.Fatalf("SetComponentLevel failed: %v", err)
+	}
+
+	// Subsystem overrides cover every component of the subsystem
+	logger.WithFields(map[string]any{"component": "discovery"}).Debug("discovery debug")
+	logger.WithFields(map[string]any{"component": "shelly_factory"}).Debug("factory debug")
+	logger.Debug("record component debug", "component", "device")
+	logger.WithFields(map[string]any{"component": "configuration"}).Debug("configuration debug")
+	logger.Debug("no component debug")
+	// A component override wins over its subsystem and the global level
+	logger.WithFields(map[string]any{"component": "metrics_collector"}).Warn("collector warn")
+	logger.WithFields(map[string]any{"component": "metrics"}).Info("metrics info")
+
+	if err := levels.SetLevel(LevelWarn); err != nil {
+		t.Fatalf("SetLevel failed: %v", err)
+	}
+	logger.Info("global info after warn")
+	levels.ResetComponents()
+	logger.WithFields(map[string]any{"component": "discovery"}).Debug("discovery debug after reset")
+
+	if levels.Level() != LevelWarn || len(levels.ComponentLevels()) != 0 {
+		t.Errorf("Unexpected levels: %s %v", levels.Level(), levels.ComponentLevels())
+	}
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	out := string(data)
+	for msg, want := range map[string]bool{
+		"discovery debug":             true,
+		"factory debug":               true,
+		"record component debug":      true,
+		"configuration debug":         false,
+		"no component debug":          false,
+		"collector warn":              false,
+		"metrics info":                true,
+		"global info after warn":      false,
+		"discovery debug after reset": false,
+	} {
+		if got := strings.Contains(out, `"msg":"`+msg+`"`); got != want {
+			t.Errorf("%q written = %v, expected %v", msg, got, want)
+		}
+	}
+}
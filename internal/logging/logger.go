@@ -5,7 +5,6 @@ import (
 	"io"
 	"log/slog"
 	"os"
-	"strings"
 )
 
 // Logger levels
@@ -27,6 +26,7 @@ type Config struct {
 type Logger struct {
 	*slog.Logger
 	level  slog.Level
+	levels *LevelControl // runtime global and per-component levels
 	config Config
 	file   *os.File // Track file handle for proper cleanup
 }
@@ -56,9 +56,11 @@ func New(config Config) (*Logger, error) {
 		return nil, err
 	}
 
-	// Create handler options
+	// Create handler options; levels are applied by the context handler so
+	// they can change at runtime
+	levels := newLevelControl(level)
 	opts := &slog.HandlerOptions{
-		Level: level,
+		Level: slog.LevelDebug,
 		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
 			// Customize timestamp format
 			if a.Key == slog.TimeKey {
@@ -77,39 +79,31 @@ func New(config Config) (*Logger, error) {
 		handler = slog.NewTextHandler(writer, opts)
 	}
 
-	logger := slog.New(handler)
+	logger := slog.New(&contextHandler{next: handler, levels: levels})
 
 	return &Logger{
 		Logger: logger,
 		level:  level,
+		levels: levels,
 		config: config,
 		file:   file,
 	}, nil
 }
 
-// parseLevel converts string level to slog.Level
+// parseLevel converts string level to slog.Level; unknown levels fall back
+// to info
 func parseLevel(levelStr string) (slog.Level, error) {
-	switch strings.ToLower(levelStr) {
-	case LevelDebug:
-		return slog.LevelDebug, nil
-	case LevelInfo:
-		return slog.LevelInfo, nil
-	case LevelWarn:
-		return slog.LevelWarn, nil
-	case LevelError:
-		return slog.LevelError, nil
-	default:
-		return slog.LevelInfo, nil
-	}
+	level, _ := ParseLevel(levelStr)
+	return level, nil
 }
 
 // getWriter returns the appropriate writer for output and file handle for cleanup
 func getWriter(output string) (io.Writer, *os.File, error) {
 	switch output {
 	case "stdout":
-		return os.Stdout, nil, nil
+		return stdoutWriter, nil, nil
 	case "stderr":
-		return os.Stderr, nil, nil
+		return stderrWriter, nil, nil
 	default:
 		// Assume it's a file path
 		file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -128,6 +122,12 @@ func (l *Logger) Close() error {
 	return nil
 }
 
+// Levels returns the runtime level control shared by this logger and the
+// loggers derived from it
+func (l *Logger) Levels() *LevelControl {
+	return l.levels
+}
+
 // WithFields adds structured fields to the logger
 func (l *Logger) WithFields(fields map[string]any) *Logger {
 	// Limit the number of fields to prevent allocation overflow
@@ -151,6 +151,7 @@ func (l *Logger) WithFields(fields map[string]any) *Logger {
 	return &Logger{
 		Logger: l.With(args...),
 		level:  l.level,
+		levels: l.levels,
 		config: l.config,
 		file:   l.file, // Preserve file handle
 	}
@@ -161,11 +162,11 @@ func (l *Logger) WithContext(ctx context.Context) *Logger {
 	// Extract common context values
 	fields := make(map[string]any)
 
-	if requestID := ctx.Value("request_id"); requestID != nil {
+	if requestID := GetRequestID(ctx); requestID != "" {
 		fields["request_id"] = requestID
 	}
 
-	if userID := ctx.Value("user_id"); userID != nil {
+	if userID := ctx.Value(userIDKey); userID != nil {
 		fields["user_id"] = userID
 	}
 
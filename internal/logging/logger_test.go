@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -174,6 +175,29 @@ func TestGetWriter(t *testing.T) {
 	}
 }
 
+func TestRedirectConsole(t *testing.T) {
+	logger, err := New(Config{Level: LevelInfo, Format: "text", Output: "stderr"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	child := logger.WithFields(map[string]any{"component": "test"})
+
+	var buf bytes.Buffer
+	restore := RedirectConsole(&buf)
+	child.Info("captured message")
+	restore()
+
+	if !strings.Contains(buf.String(), "captured message") || !strings.Contains(buf.String(), "component=test") {
+		t.Errorf("Expected redirected output, got %q", buf.String())
+	}
+
+	buf.Reset()
+	child.Info("after restore")
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output after restore, got %q", buf.String())
+	}
+}
+
 func TestWithFields(t *testing.T) {
 	// Create logger with custom output
 	tempFile := filepath.Join(t.TempDir(), "fields-test.log")
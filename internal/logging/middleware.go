@@ -10,6 +10,14 @@ import (
 	"time"
 )
 
+// RequestIDHeader carries the request ID: a client may send one to correlate
+// its own logs, and every response returns the ID the request was logged
+// under
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds a client supplied request ID
+const maxRequestIDLength = 64
+
 // contextKey is a type for context keys to avoid collisions
 type contextKey string
 
@@ -31,6 +39,44 @@ func WithRequestID(ctx context.Context, requestID string) context.Context {
 	return context.WithValue(ctx, requestIDKey, requestID)
 }
 
+// validRequestID reports whether a client supplied request ID is safe to
+// log and echo: 1-64 letters, digits, '-', '_', '.' or ':'
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDMiddleware gives every request an ID, taken from the X-Request-ID
+// header when the client sent a valid one, stores it in the request context
+// for downstream logging and returns it in the X-Request-ID response header.
+// A request that already has an ID keeps it.
+func RequestIDMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := GetRequestID(r.Context())
+			if requestID == "" {
+				requestID = r.Header.Get(RequestIDHeader)
+				if !validRequestID(requestID) {
+					requestID = generateRequestID()
+				}
+				r = r.WithContext(WithRequestID(r.Context(), requestID))
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // responseWriter wraps http.ResponseWriter to capture status code
 type responseWriter struct {
 	http.ResponseWriter
@@ -74,10 +120,11 @@ func HTTPMiddleware(logger *Logger) func(http.Handler) http.Handler {
 
 			// Add request ID to context if not present
 			ctx := r.Context()
-			if ctx.Value(requestIDKey) == nil {
+			if GetRequestID(ctx) == "" {
 				requestID := generateRequestID()
-				ctx = context.WithValue(ctx, requestIDKey, requestID)
+				ctx = WithRequestID(ctx, requestID)
 				r = r.WithContext(ctx)
+				w.Header().Set(RequestIDHeader, requestID)
 			}
 
 			// Call the next handler
@@ -87,7 +134,7 @@ func HTTPMiddleware(logger *Logger) func(http.Handler) http.Handler {
 			duration := time.Since(start).Milliseconds()
 
 			// Log the request
-			logger.LogHTTPRequest(
+			logger.WithContext(ctx).LogHTTPRequest(
 				r.Method,
 				r.URL.Path,
 				r.RemoteAddr,
@@ -131,6 +178,7 @@ func RecoveryMiddleware(logger *Logger) func(http.Handler) http.Handler {
 						"path":        r.URL.Path,
 						"remote_addr": r.RemoteAddr,
 						"panic":       err,
+						"request_id":  w.Header().Get(RequestIDHeader),
 						"component":   "http",
 					}).Error("HTTP request panicked")
 
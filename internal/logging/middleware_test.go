@@ -735,3 +735,31 @@ func TestMultipleMiddleware(t *testing.T) {
 		t.Error("Expected HTTP request log entry")
 	}
 }
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var captured string
+	handler := RequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = GetRequestID(r.Context())
+	}))
+
+	// A valid client ID is kept and echoed
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "client-42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if captured != "client-42" || rec.Header().Get(RequestIDHeader) != "client-42" {
+		t.Errorf("Expected client request ID to be used, got %q / %q", captured, rec.Header().Get(RequestIDHeader))
+	}
+
+	// An unsafe one is replaced
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nInjected: yes")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if captured == "" || strings.ContainsAny(captured, " \n") {
+		t.Errorf("Expected a generated request ID, got %q", captured)
+	}
+	if rec.Header().Get(RequestIDHeader) != captured {
+		t.Errorf("Expected response header %q, got %q", captured, rec.Header().Get(RequestIDHeader))
+	}
+}
@@ -0,0 +1,194 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recent log buffer limits
+const (
+	RecentLogEntries   = 2000
+	DefaultRecentLimit = 200
+)
+
+// requestIDField is the log attribute carrying the request ID
+const requestIDField = "request_id"
+
+// componentField is the log attribute naming the subsystem that logged a
+// record; levels can be set per component
+const componentField = "component"
+
+// RecentEntry is one log record kept in memory for troubleshooting
+type RecentEntry struct {
+	Time      time.Time      `json:"time"`
+	Level     string         `json:"level"`
+	Message   string         `json:"message"`
+	RequestID string         `json:"request_id,omitempty"`
+	Fields    map[string]any `json:"fields,omitempty"`
+}
+
+// recentBuffer keeps the most recent log records of every logger in a ring
+// buffer
+type recentBuffer struct {
+	mu      sync.Mutex
+	entries []RecentEntry
+	next    int
+	full    bool
+}
+
+var recentLogs = &recentBuffer{entries: make([]RecentEntry, RecentLogEntries)}
+
+func (b *recentBuffer) add(entry RecentEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries[b.next] = entry
+	b.next++
+	if b.next == len(b.entries) {
+		b.next = 0
+		b.full = true
+	}
+}
+
+// RecentEntries returns up to limit of the most recent log records, oldest
+// first. With a request ID only the records logged while handling that
+// request, including device calls, queries and jobs it started, are
+// returned. Records logged at debug level are kept for requests even when the
+// logger does not write them.
+func RecentEntries(requestID string, limit int) []RecentEntry {
+	if limit <= 0 {
+		limit = DefaultRecentLimit
+	}
+	recentLogs.mu.Lock()
+	defer recentLogs.mu.Unlock()
+
+	ordered := recentLogs.entries[:recentLogs.next]
+	if recentLogs.full {
+		ordered = append(append([]RecentEntry{}, recentLogs.entries[recentLogs.next:]...), ordered...)
+	}
+	out := []RecentEntry{}
+	for i := len(ordered) - 1; i >= 0 && len(out) < limit; i-- {
+		if requestID == "" || ordered[i].RequestID == requestID {
+			out = append(out, ordered[i])
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// contextHandler adds the request ID from the context to every record
+// logged with one (InfoContext, ...) and copies records into the recent log
+// buffer
+type contextHandler struct {
+	next      slog.Handler
+	attrs     []slog.Attr
+	prefix    string
+	levels    *LevelControl
+	component string // component attribute added with WithAttrs
+}
+
+// Enabled also accepts debug records of a request so they reach the recent
+// buffer
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if GetRequestID(ctx) != "" {
+		return true
+	}
+	if h.levels == nil {
+		return h.next.Enabled(ctx, level)
+	}
+	if h.component != "" {
+		return level >= h.levels.levelFor(h.component)
+	}
+	// The component may still come with the record
+	return level >= h.levels.minLevel()
+}
+
+// writes reports whether a record of the component is written at level
+func (h *contextHandler) writes(ctx context.Context, level slog.Level, component string) bool {
+	if h.levels == nil {
+		return h.next.Enabled(ctx, level)
+	}
+	return level >= h.levels.levelFor(component)
+}
+
+// Handle implements slog.Handler
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	entry := RecentEntry{
+		Time:    r.Time,
+		Level:   strings.ToLower(r.Level.String()),
+		Message: r.Message,
+		Fields:  map[string]any{},
+	}
+	addField := func(key string, a slog.Attr) {
+		value := a.Value.Resolve().Any()
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		if id, ok := value.(string); ok && key == requestIDField {
+			entry.RequestID = id
+			return
+		}
+		entry.Fields[key] = value
+	}
+	// Attributes from WithAttrs already carry their group prefix
+	for _, a := range h.attrs {
+		addField(a.Key, a)
+	}
+	component := h.component
+	r.Attrs(func(a slog.Attr) bool {
+		if component == "" && h.prefix == "" && a.Key == componentField {
+			component = a.Value.String()
+		}
+		addField(h.prefix+a.Key, a)
+		return true
+	})
+
+	if entry.RequestID == "" {
+		if requestID := GetRequestID(ctx); requestID != "" {
+			entry.RequestID = requestID
+			r = r.Clone()
+			r.AddAttrs(slog.String(requestIDField, requestID))
+		}
+	}
+	if len(entry.Fields) == 0 {
+		entry.Fields = nil
+	}
+	write := h.writes(ctx, r.Level, component)
+	if write || entry.RequestID != "" {
+		recentLogs.add(entry)
+	}
+
+	if !write {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	kept := make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	kept = append(kept, h.attrs...)
+	component := h.component
+	for _, a := range attrs {
+		if h.prefix != "" {
+			a.Key = h.prefix + a.Key
+		} else if a.Key == componentField {
+			component = a.Value.String()
+		}
+		kept = append(kept, a)
+	}
+	return &contextHandler{next: h.next.WithAttrs(attrs), attrs: kept, prefix: h.prefix, levels: h.levels, component: component}
+}
+
+// WithGroup implements slog.Handler
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &contextHandler{next: h.next.WithGroup(name), attrs: h.attrs, prefix: h.prefix + name + ".", levels: h.levels, component: h.component}
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecentEntries(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "recent.log")
+	logger, err := New(Config{Level: LevelInfo, Format: "json", Output: logFile})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer func() { _ = logger.Close() }()
+
+	ctx := WithRequestID(context.Background(), "req-recent-1")
+	logger.WithFields(map[string]any{"device_id": 7}).InfoContext(ctx, "Handled request")
+	logger.WithFields(map[string]any{"sql": "SELECT 1"}).DebugContext(ctx, "Query completed")
+	logger.WithContext(WithRequestID(context.Background(), "req-recent-2")).Info("Other request")
+	logger.Debug("Debug without a request")
+
+	entries := RecentEntries("req-recent-1", 0)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries for the request, got %+v", entries)
+	}
+	if entries[0].Message != "Handled request" || entries[0].Fields["device_id"] != int64(7) {
+		t.Errorf("Unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Level != "debug" || entries[1].Fields["sql"] != "SELECT 1" {
+		t.Errorf("Expected the debug record of the request to be kept, got %+v", entries[1])
+	}
+
+	for _, e := range RecentEntries("", RecentLogEntries) {
+		if e.Message == "Debug without a request" {
+			t.Error("Expected debug records outside a request to follow the logger level")
+		}
+	}
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	out := string(data)
+	if !strings.Contains(out, `"request_id":"req-recent-1"`) || !strings.Contains(out, `"request_id":"req-recent-2"`) {
+		t.Errorf("Expected request IDs in the log output, got %s", out)
+	}
+	if strings.Contains(out, "Query completed") {
+		t.Error("Expected debug records to stay out of an info level log")
+	}
+}
@@ -19,6 +19,9 @@ type Collector struct {
 	running bool
 	stopCh  chan struct{}
 	doneCh  chan struct{}
+
+	// leader reports whether this instance runs periodic jobs; nil always runs
+	leader func() bool
 }
 
 // NewCollector creates a new metrics collector
@@ -117,6 +120,21 @@ func (c *Collector) SetInterval(interval time.Duration) {
 	}).Info("Updated metrics collection interval")
 }
 
+// SetLeaderFunc makes periodic collection run only while leader returns true,
+// so one of several instances sharing a database collects
+func (c *Collector) SetLeaderFunc(leader func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leader = leader
+}
+
+func (c *Collector) isLeader() bool {
+	c.mu.RLock()
+	leader := c.leader
+	c.mu.RUnlock()
+	return leader == nil || leader()
+}
+
 // GetInterval returns the current collection interval
 func (c *Collector) GetInterval() time.Duration {
 	c.mu.RLock()
@@ -129,7 +147,11 @@ func (c *Collector) collectLoop(ctx context.Context) {
 	defer close(c.doneCh)
 
 	// Perform initial collection
-	if err := c.service.CollectMetrics(ctx); err != nil {
+	if !c.isLeader() {
+		c.logger.WithFields(map[string]any{
+			"component": "metrics_collector",
+		}).Debug("Skipping initial metrics collection on standby instance")
+	} else if err := c.service.CollectMetrics(ctx); err != nil {
 		c.logger.WithFields(map[string]any{
 			"error":     err.Error(),
 			"component": "metrics_collector",
@@ -170,7 +192,10 @@ func (c *Collector) collectLoop(ctx context.Context) {
 				initialInterval = currentInterval // Update our cached value
 			}
 
-			// Collect metrics
+			// Collect metrics; standby instances leave it to the leader
+			if !c.isLeader() {
+				continue
+			}
 			if err := c.service.CollectMetrics(ctx); err != nil {
 				c.logger.WithFields(map[string]any{
 					"error":     err.Error(),
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -13,6 +14,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
 )
 
 // Handler handles HTTP requests for metrics operations
@@ -23,6 +25,7 @@ type Handler struct {
 	notifier func(ctx context.Context, alertType, severity, message string)
 
 	adminAPIKey string
+	authn       *auth.Authenticator
 }
 
 // NewHandler creates a new metrics handler
@@ -43,6 +46,9 @@ func (h *Handler) SetNotifier(fn func(ctx context.Context, alertType, severity,
 // SetAdminAPIKey enables optional admin-key authentication for metrics endpoints (including WebSocket)
 func (h *Handler) SetAdminAPIKey(key string) { h.adminAPIKey = key }
 
+// SetAuthenticator lets single sign-on users open WebSocket connections
+func (h *Handler) SetAuthenticator(authn *auth.Authenticator) { h.authn = authn }
+
 // requireAdmin enforces admin key when configured
 func (h *Handler) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
 	if h.adminAPIKey == "" {
@@ -269,33 +275,59 @@ func (h *Handler) GetDashboardMetrics(w http.ResponseWriter, r *http.Request) {
 	}).Debug("Returned dashboard metrics")
 }
 
-// HandleWebSocket handles WebSocket connections for real-time metrics
+// HandleWebSocket handles WebSocket connections for real-time metrics. The
+// connection belongs to the API identity it authenticated as, and only that
+// identity can resume its session.
 func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	// Optional admin key enforcement
-	if h.adminAPIKey != "" {
-		token := r.URL.Query().Get("token")
-		auth := r.Header.Get("Authorization")
-		ok := false
-		if token != "" && token == h.adminAPIKey {
-			ok = true
+	identity, ok := h.webSocketIdentity(r)
+	if !ok {
+		h.wsHub.recordConnection(connectRejected)
+		response := map[string]any{
+			"success": false,
+			"error": map[string]string{
+				"code":    "UNAUTHORIZED",
+				"message": "Authorization required",
+			},
+			"timestamp": time.Now().UTC(),
 		}
-		if !ok && len(auth) > 7 && auth[:7] == "Bearer " && auth[7:] == h.adminAPIKey {
-			ok = true
+		writeJSONWithStatus(w, response, http.StatusUnauthorized)
+		return
+	}
+	h.wsHub.HandleWebSocket(w, r.WithContext(withWebSocketIdentity(r.Context(), identity)))
+}
+
+// webSocketIdentity authenticates a WebSocket request: the admin key, or a
+// single sign-on token or session cookie. Browsers cannot set headers on
+// WebSocket requests, so the key or token may be given as ?token=. Requests
+// without credentials are anonymous unless a key is set or sign-on is
+// required.
+func (h *Handler) webSocketIdentity(r *http.Request) (string, bool) {
+	token := r.URL.Query().Get("token")
+	if h.adminAPIKey != "" && (token == h.adminAPIKey || auth.AdminKeyOK(r, h.adminAPIKey)) {
+		return "admin-key", true
+	}
+	if h.authn != nil {
+		req := r
+		if _, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); !bearer && auth.LooksLikeJWT(token) {
+			req = r.Clone(r.Context())
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		principal, err := h.authn.Authenticate(req)
+		if err != nil {
+			return "", false
 		}
-		if !ok {
-			response := map[string]any{
-				"success": false,
-				"error": map[string]string{
-					"code":    "UNAUTHORIZED",
-					"message": "Admin authorization required",
-				},
-				"timestamp": time.Now().UTC(),
+		if principal != nil {
+			name := principal.Username
+			if name == "" {
+				name = principal.Subject
 			}
-			writeJSONWithStatus(w, response, http.StatusUnauthorized)
-			return
+			return "user:" + name, true
 		}
 	}
-	h.wsHub.HandleWebSocket(w, r)
+	if h.adminAPIKey != "" || (h.authn != nil && h.authn.Required()) {
+		return "", false
+	}
+	return anonymousIdentity, true
 }
 
 // SendTestAlert sends a test alert for dashboard testing
@@ -41,8 +41,28 @@ type Service struct {
 	// System health metrics
 	deviceStatus     prometheus.GaugeVec
 	configSyncStatus prometheus.GaugeVec
+	deviceClockSkew  prometheus.GaugeVec
 	systemUptime     prometheus.Counter
 
+	// Device network metrics
+	deviceLatency      prometheus.HistogramVec
+	devicePollFailures prometheus.CounterVec
+
+	// Device request budget metrics, per network and traffic class
+	networkRequests prometheus.CounterVec
+	networkDelayed  prometheus.CounterVec
+	networkRejected prometheus.CounterVec
+	networkWait     prometheus.CounterVec
+
+	// WebSocket client metrics
+	wsSessions    prometheus.GaugeVec
+	wsConnections prometheus.CounterVec
+	wsDropped     prometheus.CounterVec
+	wsDisconnects prometheus.CounterVec
+
+	// Optional collector that polls devices during each collection
+	deviceCollector func(ctx context.Context) error
+
 	// Internal state
 	mu                 sync.RWMutex
 	lastCollectionTime time.Time
@@ -194,6 +214,96 @@ func (s *Service) initializePrometheusMetrics() {
 		[]string{"device_id", "device_name"},
 	)
 
+	s.deviceClockSkew = *promauto.With(s.registry).NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shelly_device_clock_skew_seconds",
+			Help: "Device clock minus server time in seconds",
+		},
+		[]string{"device_id", "device_name"},
+	)
+
+	// Device network metrics
+	s.deviceLatency = *promauto.With(s.registry).NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "shelly_device_latency_seconds",
+			Help:    "Round-trip time of device status requests",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5},
+		},
+		[]string{"device_id", "device_name"},
+	)
+
+	s.devicePollFailures = *promauto.With(s.registry).NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "shelly_device_poll_failures_total",
+			Help: "Total number of device status requests that failed",
+		},
+		[]string{"device_id", "device_name"},
+	)
+
+	s.networkRequests = *promauto.With(s.registry).NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "shelly_network_requests_total",
+			Help: "Total number of device requests let through the rate limit",
+		},
+		[]string{"network", "class"},
+	)
+
+	s.networkDelayed = *promauto.With(s.registry).NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "shelly_network_requests_delayed_total",
+			Help: "Total number of device requests that waited for the rate limit",
+		},
+		[]string{"network", "class"},
+	)
+
+	s.networkRejected = *promauto.With(s.registry).NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "shelly_network_requests_rejected_total",
+			Help: "Total number of device requests that gave up waiting for the rate limit",
+		},
+		[]string{"network", "class"},
+	)
+
+	s.networkWait = *promauto.With(s.registry).NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "shelly_network_wait_seconds_total",
+			Help: "Total time device requests waited for the rate limit",
+		},
+		[]string{"network", "class"},
+	)
+
+	s.wsSessions = *promauto.With(s.registry).NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shelly_websocket_sessions",
+			Help: "Current WebSocket sessions, connected or detached and awaiting resume",
+		},
+		[]string{"state"},
+	)
+
+	s.wsConnections = *promauto.With(s.registry).NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "shelly_websocket_connections_total",
+			Help: "Total number of WebSocket connection attempts by result (new, resumed, rejected)",
+		},
+		[]string{"result"},
+	)
+
+	s.wsDropped = *promauto.With(s.registry).NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "shelly_websocket_messages_dropped_total",
+			Help: "Total number of WebSocket messages dropped for clients with a full queue",
+		},
+		[]string{"policy"},
+	)
+
+	s.wsDisconnects = *promauto.With(s.registry).NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "shelly_websocket_disconnects_total",
+			Help: "Total number of WebSocket clients disconnected by reason (closed, slow, replaced)",
+		},
+		[]string{"reason"},
+	)
+
 	s.systemUptime = promauto.With(s.registry).NewCounter(
 		prometheus.CounterOpts{
 			Name: "shelly_manager_uptime_seconds_total",
@@ -372,6 +482,93 @@ func (s *Service) UpdateConfigSyncStatus(deviceID, deviceName string, synced boo
 	s.configSyncStatus.WithLabelValues(deviceID, deviceName).Set(status)
 }
 
+// RecordClockSkew records how far a device clock is ahead of server time
+func (s *Service) RecordClockSkew(deviceID, deviceName string, skewSeconds float64) {
+	if !s.enabled {
+		return
+	}
+
+	s.deviceClockSkew.WithLabelValues(deviceID, deviceName).Set(skewSeconds)
+}
+
+// RecordDeviceLatency records the round trip of a device status request, or
+// a failed request
+func (s *Service) RecordDeviceLatency(deviceID, deviceName string, latency time.Duration, ok bool) {
+	if !s.enabled {
+		return
+	}
+
+	if !ok {
+		s.devicePollFailures.WithLabelValues(deviceID, deviceName).Inc()
+		return
+	}
+	s.deviceLatency.WithLabelValues(deviceID, deviceName).Observe(latency.Seconds())
+}
+
+// RecordNetworkRequest records a device request passing the rate limit of
+// its network; ok is false when it gave up waiting
+func (s *Service) RecordNetworkRequest(network, class string, wait time.Duration, ok bool) {
+	if !s.enabled {
+		return
+	}
+
+	if !ok {
+		s.networkRejected.WithLabelValues(network, class).Inc()
+		return
+	}
+	s.networkRequests.WithLabelValues(network, class).Inc()
+	if wait > 0 {
+		s.networkDelayed.WithLabelValues(network, class).Inc()
+		s.networkWait.WithLabelValues(network, class).Add(wait.Seconds())
+	}
+}
+
+// RecordWebSocketSessions records the connected WebSocket clients and the
+// detached sessions that can still be resumed
+func (s *Service) RecordWebSocketSessions(connected, detached int) {
+	if !s.enabled {
+		return
+	}
+
+	s.wsSessions.WithLabelValues("connected").Set(float64(connected))
+	s.wsSessions.WithLabelValues("detached").Set(float64(detached))
+}
+
+// RecordWebSocketConnection records a WebSocket connection attempt
+func (s *Service) RecordWebSocketConnection(result string) {
+	if !s.enabled {
+		return
+	}
+
+	s.wsConnections.WithLabelValues(result).Inc()
+}
+
+// RecordWebSocketDrop records a message dropped for a slow WebSocket client
+func (s *Service) RecordWebSocketDrop(policy string) {
+	if !s.enabled {
+		return
+	}
+
+	s.wsDropped.WithLabelValues(policy).Inc()
+}
+
+// RecordWebSocketDisconnect records a WebSocket client disconnecting
+func (s *Service) RecordWebSocketDisconnect(reason string) {
+	if !s.enabled {
+		return
+	}
+
+	s.wsDisconnects.WithLabelValues(reason).Inc()
+}
+
+// SetDeviceCollector sets an optional function called on every collection to
+// poll devices directly, e.g. for clock skew
+func (s *Service) SetDeviceCollector(fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deviceCollector = fn
+}
+
 // StartUptimeCounter starts the uptime counter
 func (s *Service) StartUptimeCounter() {
 	if !s.enabled {
@@ -427,6 +624,16 @@ func (s *Service) CollectMetrics(ctx context.Context) error {
 		}).Error("Failed to collect device metrics")
 	}
 
+	// Poll devices directly if a collector is configured
+	if s.deviceCollector != nil {
+		if err := s.deviceCollector(ctx); err != nil {
+			s.logger.WithFields(map[string]any{
+				"error":     err.Error(),
+				"component": "metrics",
+			}).Error("Failed to collect device-polled metrics")
+		}
+	}
+
 	s.lastCollectionTime = time.Now()
 	duration := time.Since(start)
 
@@ -2,9 +2,12 @@ package metrics
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -26,6 +29,14 @@ type WebSocketHub struct {
 	// Connection limiting per client IP
 	connCounts     map[string]int
 	connLimitPerIP int
+
+	// Latest dashboard snapshot and device tags, for topic filtering
+	lastMetrics *DashboardMetrics
+	groups      map[string]map[string]bool
+
+	// Client sessions by ID, kept for the resume window after a disconnect
+	sessions map[string]*wsSession
+	options  WebSocketOptions
 }
 
 // WebSocketClient represents a connected WebSocket client
@@ -34,6 +45,19 @@ type WebSocketClient struct {
 	conn *websocket.Conn
 	send chan *MetricsUpdate
 	ip   string
+
+	// API identity the client authenticated as, the session it asked to
+	// resume and the session it got
+	identity string
+	resume   string
+	session  *wsSession
+
+	// Messages dropped in a row because the send queue was full
+	drops atomic.Int64
+
+	// Topics the client subscribed to; nil receives everything
+	subMu sync.Mutex
+	sub   *subscription
 }
 
 // MessageType enumerates the WebSocket message types the metrics hub emits.
@@ -55,6 +79,9 @@ const (
 	MessageTypeDeviceStatusChange = "device_status_change"
 	// MessageTypeDriftDetected carries a configuration-drift detection event.
 	MessageTypeDriftDetected = "drift_detected"
+	// MessageTypeSession carries the client's session (session_id, resumed,
+	// topics), sent once right after it connects.
+	MessageTypeSession = "session"
 )
 
 // AllMessageTypes returns every WebSocket message type the hub can emit, in a
@@ -67,6 +94,7 @@ func AllMessageTypes() []string {
 		MessageTypeAlert,
 		MessageTypeDeviceStatusChange,
 		MessageTypeDriftDetected,
+		MessageTypeSession,
 	}
 }
 
@@ -75,6 +103,9 @@ type MetricsUpdate struct {
 	Type      string      `json:"type"`
 	Timestamp time.Time   `json:"timestamp"`
 	Data      interface{} `json:"data"`
+
+	// deviceID scopes the update to the subscribers of one device
+	deviceID string
 }
 
 // Message builders. These centralise the wire payload for each message type so
@@ -104,6 +135,7 @@ func newAlertUpdate(alertType, message, severity string) *MetricsUpdate {
 // newDeviceStatusChangeUpdate builds a device_status_change message.
 func newDeviceStatusChangeUpdate(deviceID, deviceName, oldStatus, newStatus string) *MetricsUpdate {
 	return &MetricsUpdate{
+		deviceID:  deviceID,
 		Type:      MessageTypeDeviceStatusChange,
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
@@ -119,6 +151,7 @@ func newDeviceStatusChangeUpdate(deviceID, deviceName, oldStatus, newStatus stri
 // newDriftDetectedUpdate builds a drift_detected message.
 func newDriftDetectedUpdate(deviceID, deviceName string, driftCount int, severity string) *MetricsUpdate {
 	return &MetricsUpdate{
+		deviceID:  deviceID,
 		Type:      MessageTypeDriftDetected,
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
@@ -206,6 +239,8 @@ func NewWebSocketHub(service *Service, logger *logging.Logger) *WebSocketHub {
 		logger:         logger,
 		connCounts:     make(map[string]int),
 		connLimitPerIP: 5,
+		sessions:       make(map[string]*wsSession),
+		options:        DefaultWebSocketOptions(),
 	}
 }
 
@@ -218,15 +253,28 @@ func (h *WebSocketHub) Run(ctx context.Context) {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
-			h.clients[client] = true
+			resumed := h.attach(client, time.Now())
 			if client.ip != "" {
 				h.connCounts[client.ip]++
 			}
+			client.subMu.Lock()
+			topics := client.sub.topics()
+			client.subMu.Unlock()
+			client.send <- newSessionUpdate(client.session, resumed, topics, h.options.ResumeWindow)
+			h.recordSessions()
+			clients := len(h.clients)
 			h.mu.Unlock()
 
+			result := connectNew
+			if resumed {
+				result = connectResumed
+			}
+			h.recordConnection(result)
 			h.logger.WithFields(map[string]any{
 				"component": "websocket",
-				"clients":   len(h.clients),
+				"clients":   clients,
+				"identity":  client.identity,
+				"resumed":   resumed,
 			}).Info("New WebSocket client connected")
 
 			// Send initial metrics to new client
@@ -237,6 +285,7 @@ func (h *WebSocketHub) Run(ctx context.Context) {
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				close(client.send)
+				h.recordDisconnect(disconnectClosed)
 			}
 			if client.ip != "" && h.connCounts[client.ip] > 0 {
 				h.connCounts[client.ip]--
@@ -244,24 +293,38 @@ func (h *WebSocketHub) Run(ctx context.Context) {
 					delete(h.connCounts, client.ip)
 				}
 			}
+			h.detach(client, time.Now())
+			h.recordSessions()
+			clients := len(h.clients)
 			h.mu.Unlock()
 
 			h.logger.WithFields(map[string]any{
 				"component": "websocket",
-				"clients":   len(h.clients),
+				"clients":   clients,
+				"identity":  client.identity,
 			}).Info("WebSocket client disconnected")
 
 		case update := <-h.broadcast:
-			h.mu.RLock()
+			h.mu.Lock()
 			for client := range h.clients {
-				select {
-				case client.send <- update:
-				default:
+				msg := client.filter(update, h.groups)
+				if msg == nil {
+					continue
+				}
+				if !h.deliver(client, msg) {
+					// Slow client: its session stays resumable
 					delete(h.clients, client)
 					close(client.send)
+					h.recordDisconnect(disconnectSlow)
+					h.logger.WithFields(map[string]any{
+						"component": "websocket",
+						"identity":  client.identity,
+						"policy":    h.options.DropPolicy,
+					}).Warn("Disconnected slow WebSocket client")
 				}
 			}
-			h.mu.RUnlock()
+			h.recordSessions()
+			h.mu.Unlock()
 
 		case <-ctx.Done():
 			h.logger.WithFields(map[string]any{
@@ -340,13 +403,21 @@ func (h *WebSocketHub) collectDashboardMetrics(ctx context.Context) (*DashboardM
 		return nil, fmt.Errorf("failed to get resolution metrics: %w", err)
 	}
 
-	return &DashboardMetrics{
+	metrics := &DashboardMetrics{
 		SystemStatus:        *systemStatus,
 		DeviceMetrics:       deviceMetrics,
 		DriftMetrics:        *driftMetrics,
 		NotificationMetrics: *notificationMetrics,
 		ResolutionMetrics:   *resolutionMetrics,
-	}, nil
+	}
+	groups := h.getGroupMembers(ctx)
+
+	h.mu.Lock()
+	h.lastMetrics = metrics
+	h.groups = groups
+	h.mu.Unlock()
+
+	return metrics, nil
 }
 
 // sendInitialMetrics sends initial metrics to a new client
@@ -361,13 +432,21 @@ func (h *WebSocketHub) sendInitialMetrics(client *WebSocketClient) {
 		return
 	}
 
-	update := newDashboardUpdate(MessageTypeInitialMetrics, metrics)
+	h.sendSnapshot(client, metrics)
+}
 
-	select {
-	case client.send <- update:
-	default:
-		// Client channel full or closed
+// sendSnapshot sends a client the part of a dashboard snapshot its topics
+// cover, unless the client is gone
+func (h *WebSocketHub) sendSnapshot(client *WebSocketClient, metrics *DashboardMetrics) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if !h.clients[client] {
+		return
 	}
+	update := client.filter(newDashboardUpdate(MessageTypeInitialMetrics, metrics), h.groups)
+
+	// A client too slow for this is disconnected on the next broadcast
+	h.deliver(client, update)
 }
 
 // HandleWebSocket handles WebSocket upgrade requests
@@ -399,11 +478,24 @@ func (h *WebSocketHub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		current := h.connCounts[ip]
 		h.mu.RUnlock()
 		if current >= h.connLimitPerIP {
+			h.recordConnection(connectRejected)
 			http.Error(w, "Too many WebSocket connections from this IP", http.StatusTooManyRequests)
 			return
 		}
 	}
 
+	// Topics may be given up front so the first snapshot is already filtered
+	var sub *subscription
+	if topics := r.URL.Query().Get("topics"); topics != "" {
+		sub = newSubscription()
+		for _, topic := range strings.Split(topics, ",") {
+			if err := sub.set(topic, true); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
 	conn, err := localUpgrader.Upgrade(w, r, nil)
 	if err != nil {
 		h.logger.WithFields(map[string]any{
@@ -413,11 +505,15 @@ func (h *WebSocketHub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A client reconnecting with ?session= resumes its topics
 	client := &WebSocketClient{
-		hub:  h,
-		conn: conn,
-		send: make(chan *MetricsUpdate, 256),
-		ip:   ip,
+		hub:      h,
+		conn:     conn,
+		send:     make(chan *MetricsUpdate, h.webSocketOptions().QueueSize),
+		ip:       ip,
+		identity: webSocketIdentity(r.Context()),
+		resume:   r.URL.Query().Get("session"),
+		sub:      sub,
 	}
 
 	client.hub.register <- client
@@ -475,7 +571,7 @@ func (c *WebSocketClient) readPump() {
 		}
 	}()
 
-	c.conn.SetReadLimit(512)
+	c.conn.SetReadLimit(4096)
 	if err := c.conn.SetReadDeadline(time.Now().Add(60 * time.Second)); err != nil {
 		c.hub.logger.WithFields(map[string]any{
 			"error":     err.Error(),
@@ -494,7 +590,7 @@ func (c *WebSocketClient) readPump() {
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				c.hub.logger.WithFields(map[string]any{
@@ -504,9 +600,53 @@ func (c *WebSocketClient) readPump() {
 			}
 			break
 		}
+		c.handleMessage(message)
+	}
+}
+
+// handleMessage applies a subscribe or unsubscribe message and sends the
+// latest snapshot for the new topics. Anything else is ignored.
+func (c *WebSocketClient) handleMessage(message []byte) {
+	var msg subscribeMessage
+	if err := json.Unmarshal(message, &msg); err != nil || (msg.Action != "subscribe" && msg.Action != "unsubscribe") {
+		return
+	}
+
+	c.subMu.Lock()
+	if c.sub == nil {
+		c.sub = newSubscription()
+	}
+	for _, topic := range msg.Topics {
+		if err := c.sub.set(topic, msg.Action == "subscribe"); err != nil {
+			c.hub.logger.WithFields(map[string]any{
+				"error":     err.Error(),
+				"component": "websocket",
+			}).Debug("Ignoring invalid WebSocket topic")
+		}
+	}
+	topics := c.sub.topics()
+	c.subMu.Unlock()
+
+	c.hub.logger.WithFields(map[string]any{
+		"topics":    topics,
+		"component": "websocket",
+	}).Debug("WebSocket client changed subscriptions")
+
+	c.hub.mu.RLock()
+	metrics := c.hub.lastMetrics
+	c.hub.mu.RUnlock()
+	if metrics != nil {
+		c.hub.sendSnapshot(c, metrics)
 	}
 }
 
+// filter returns the part of an update the client's topics cover, or nil
+func (c *WebSocketClient) filter(update *MetricsUpdate, groups map[string]map[string]bool) *MetricsUpdate {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	return c.sub.filter(update, groups)
+}
+
 // writePump pumps messages to the WebSocket connection
 func (c *WebSocketClient) writePump() {
 	ticker := time.NewTicker(54 * time.Second)
@@ -563,8 +703,11 @@ func (c *WebSocketClient) writePump() {
 
 // BroadcastAlert broadcasts an alert to all connected clients
 func (h *WebSocketHub) BroadcastAlert(alertType, message string, severity string) {
-	update := newAlertUpdate(alertType, message, severity)
+	h.broadcastAlert(newAlertUpdate(alertType, message, severity), alertType, severity)
+}
 
+// broadcastAlert queues an alert, which may be scoped to a device
+func (h *WebSocketHub) broadcastAlert(update *MetricsUpdate, alertType, severity string) {
 	select {
 	case h.broadcast <- update:
 		h.logger.WithFields(map[string]any{
@@ -595,7 +738,9 @@ func (h *WebSocketHub) BroadcastDeviceStatusChange(deviceID, deviceName, oldStat
 
 	// Also send as an alert for immediate visibility
 	alertMessage := fmt.Sprintf("Device %s went %s", deviceName, newStatus)
-	h.BroadcastAlert("device_status", alertMessage, severity)
+	alert := newAlertUpdate("device_status", alertMessage, severity)
+	alert.deviceID = deviceID
+	h.broadcastAlert(alert, "device_status", severity)
 
 	select {
 	case h.broadcast <- update:
@@ -610,7 +755,9 @@ func (h *WebSocketHub) BroadcastDriftDetected(deviceID, deviceName string, drift
 
 	// Send alert
 	alertMessage := fmt.Sprintf("Configuration drift detected on %s (%d issues)", deviceName, driftCount)
-	h.BroadcastAlert("drift_detected", alertMessage, severity)
+	alert := newAlertUpdate("drift_detected", alertMessage, severity)
+	alert.deviceID = deviceID
+	h.broadcastAlert(alert, "drift_detected", severity)
 
 	select {
 	case h.broadcast <- update:
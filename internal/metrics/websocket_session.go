@@ -0,0 +1,268 @@
+package metrics
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+)
+
+// Drop policies for clients whose send queue is full
+const (
+	// DropOldest discards the oldest queued message to make room
+	DropOldest = "drop_oldest"
+	// DropNewest discards the message that does not fit
+	DropNewest = "drop_newest"
+	// DropDisconnect disconnects the client; it may resume its session
+	DropDisconnect = "disconnect"
+)
+
+// Results of a WebSocket connection attempt, as counted by Prometheus
+const (
+	connectNew      = "new"      // the client got a new session
+	connectResumed  = "resumed"  // the client resumed its session
+	connectRejected = "rejected" // the client was refused
+)
+
+// Reasons a WebSocket client is disconnected, as counted by Prometheus
+const (
+	disconnectClosed   = "closed"   // the client went away
+	disconnectSlow     = "slow"     // the client did not keep up with its queue
+	disconnectReplaced = "replaced" // the client's session was resumed on a new connection
+)
+
+// anonymousIdentity owns the sessions of unauthenticated clients
+const anonymousIdentity = "anonymous"
+
+// WebSocketOptions tune client sessions and the handling of slow clients
+type WebSocketOptions struct {
+	QueueSize    int           // messages queued per client
+	DropPolicy   string        // what happens to a message for a full queue
+	MaxDrops     int           // messages dropped in a row before the client is disconnected; 0 never
+	ResumeWindow time.Duration // how long a session can be resumed after a disconnect
+}
+
+// DefaultWebSocketOptions returns the options a hub starts with
+func DefaultWebSocketOptions() WebSocketOptions {
+	return WebSocketOptions{
+		QueueSize:    256,
+		DropPolicy:   DropOldest,
+		MaxDrops:     100,
+		ResumeWindow: 2 * time.Minute,
+	}
+}
+
+// ValidDropPolicy reports whether policy is a known drop policy
+func ValidDropPolicy(policy string) bool {
+	return policy == DropOldest || policy == DropNewest || policy == DropDisconnect
+}
+
+// wsSession is the state of a client that outlives its connection: who it
+// belongs to and what it subscribed to. A session whose connection dropped
+// is detached and can be resumed within the resume window.
+type wsSession struct {
+	id         string
+	identity   string
+	client     *WebSocketClient // nil while detached
+	sub        *subscription    // topics at the time the session was detached
+	detachedAt time.Time
+	dropped    atomic.Int64 // messages dropped for the session's clients
+}
+
+// sessionKey carries the API identity of a WebSocket request
+type sessionKey struct{}
+
+// withWebSocketIdentity returns a context naming the API identity a
+// WebSocket connection is made for
+func withWebSocketIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, identity)
+}
+
+// webSocketIdentity returns the API identity of a WebSocket request
+func webSocketIdentity(ctx context.Context) string {
+	if identity, _ := ctx.Value(sessionKey{}).(string); identity != "" {
+		return identity
+	}
+	return anonymousIdentity
+}
+
+// newSessionID returns a random, unguessable session ID
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newSessionUpdate builds a session message.
+func newSessionUpdate(session *wsSession, resumed bool, topics []string, resumeWindow time.Duration) *MetricsUpdate {
+	return &MetricsUpdate{
+		Type:      MessageTypeSession,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"session_id":            session.id,
+			"identity":              session.identity,
+			"resumed":               resumed,
+			"topics":                topics,
+			"dropped":               session.dropped.Load(),
+			"resume_window_seconds": int(resumeWindow.Seconds()),
+		},
+	}
+}
+
+// SetOptions configures client queues, the drop policy and the resume
+// window. It applies to clients connecting afterwards; zero or unknown
+// values keep their defaults.
+func (h *WebSocketHub) SetOptions(opts WebSocketOptions) {
+	defaults := DefaultWebSocketOptions()
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaults.QueueSize
+	}
+	if !ValidDropPolicy(opts.DropPolicy) {
+		opts.DropPolicy = defaults.DropPolicy
+	}
+	if opts.MaxDrops < 0 {
+		opts.MaxDrops = 0
+	}
+	if opts.ResumeWindow < 0 {
+		opts.ResumeWindow = 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.options = opts
+}
+
+// webSocketOptions returns the hub's current options
+func (h *WebSocketHub) webSocketOptions() WebSocketOptions {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.options
+}
+
+// attach registers a client with a session: the one it asked to resume,
+// when the same identity left it within the resume window, or else a new
+// one. A session still held by an older connection is taken over. Returns
+// whether the session was resumed. The caller holds h.mu.
+func (h *WebSocketHub) attach(client *WebSocketClient, now time.Time) bool {
+	h.expireSessions(now)
+
+	session := h.sessions[client.resume]
+	resumed := session != nil && session.identity == client.identity
+	if resumed {
+		sub := session.sub
+		if old := session.client; old != nil {
+			old.subMu.Lock()
+			sub = old.sub
+			old.subMu.Unlock()
+			if h.clients[old] {
+				delete(h.clients, old)
+				close(old.send)
+				h.recordDisconnect(disconnectReplaced)
+			}
+		}
+		client.subMu.Lock()
+		if client.sub == nil {
+			client.sub = sub.clone()
+		}
+		client.subMu.Unlock()
+	} else {
+		session = &wsSession{id: newSessionID(), identity: client.identity}
+		h.sessions[session.id] = session
+	}
+	session.client = client
+	session.detachedAt = time.Time{}
+	client.session = session
+	h.clients[client] = true
+	return resumed
+}
+
+// detach keeps a disconnected client's session for the resume window. The
+// caller holds h.mu.
+func (h *WebSocketHub) detach(client *WebSocketClient, now time.Time) {
+	session := client.session
+	if session == nil || session.client != client {
+		return
+	}
+	client.subMu.Lock()
+	session.sub = client.sub.clone()
+	client.subMu.Unlock()
+	session.client = nil
+	session.detachedAt = now
+	h.expireSessions(now)
+}
+
+// expireSessions forgets the detached sessions past the resume window. The
+// caller holds h.mu.
+func (h *WebSocketHub) expireSessions(now time.Time) {
+	for id, session := range h.sessions {
+		if session.client == nil && now.Sub(session.detachedAt) >= h.options.ResumeWindow {
+			delete(h.sessions, id)
+		}
+	}
+}
+
+// deliver queues a message for a client. When the queue is full the drop
+// policy decides which message is lost, or that the client is disconnected.
+// It returns false when the client is to be disconnected: under the
+// disconnect policy, or after MaxDrops messages dropped in a row. The caller
+// holds h.mu, at least for reading.
+func (h *WebSocketHub) deliver(client *WebSocketClient, msg *MetricsUpdate) bool {
+	select {
+	case client.send <- msg:
+		client.drops.Store(0)
+		return true
+	default:
+	}
+
+	policy := h.options.DropPolicy
+	if policy == DropDisconnect {
+		return false
+	}
+	if policy == DropOldest {
+		select {
+		case <-client.send:
+		default:
+		}
+		select {
+		case client.send <- msg:
+		default:
+		}
+	}
+	if client.session != nil {
+		client.session.dropped.Add(1)
+	}
+	if h.service != nil {
+		h.service.RecordWebSocketDrop(policy)
+	}
+	drops := client.drops.Add(1)
+	return h.options.MaxDrops == 0 || drops < int64(h.options.MaxDrops)
+}
+
+// recordConnection counts a connection attempt by its result
+func (h *WebSocketHub) recordConnection(result string) {
+	if h.service != nil {
+		h.service.RecordWebSocketConnection(result)
+	}
+}
+
+// recordDisconnect counts a disconnect by its reason
+func (h *WebSocketHub) recordDisconnect(reason string) {
+	if h.service != nil {
+		h.service.RecordWebSocketDisconnect(reason)
+	}
+}
+
+// recordSessions reports the connected clients and detached sessions. The
+// caller holds h.mu.
+func (h *WebSocketHub) recordSessions() {
+	if h.service == nil {
+		return
+	}
+	detached := 0
+	for _, session := range h.sessions {
+		if session.client == nil {
+			detached++
+		}
+	}
+	h.service.RecordWebSocketSessions(len(h.clients), detached)
+}
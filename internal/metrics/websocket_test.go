@@ -1,10 +1,19 @@
 package metrics
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
 )
 
 // TestAllMessageTypes pins the exact set and values of WebSocket message types.
@@ -18,6 +27,7 @@ func TestAllMessageTypes(t *testing.T) {
 		"alert",
 		"device_status_change",
 		"drift_detected",
+		"session",
 	}, AllMessageTypes())
 
 	// Constant values are the wire strings and must not drift.
@@ -26,6 +36,7 @@ func TestAllMessageTypes(t *testing.T) {
 	assert.Equal(t, "alert", MessageTypeAlert)
 	assert.Equal(t, "device_status_change", MessageTypeDeviceStatusChange)
 	assert.Equal(t, "drift_detected", MessageTypeDriftDetected)
+	assert.Equal(t, "session", MessageTypeSession)
 
 	// No duplicates.
 	seen := map[string]bool{}
@@ -105,3 +116,232 @@ func keysOf(m map[string]interface{}) []string {
 	}
 	return keys
 }
+
+// TestSubscriptionTopics asserts topic parsing and subscribe/unsubscribe.
+func TestSubscriptionTopics(t *testing.T) {
+	sub := newSubscription()
+	require.NoError(t, sub.set("device:7", true))
+	require.NoError(t, sub.set("group:kitchen", true))
+	require.NoError(t, sub.set(" fleet ", true))
+	require.Error(t, sub.set("device:abc", true))
+	require.Error(t, sub.set("group:", true))
+	require.Error(t, sub.set("room:1", true))
+	assert.ElementsMatch(t, []string{"fleet", "device:7", "group:kitchen"}, sub.topics())
+
+	require.NoError(t, sub.set("fleet", false))
+	require.NoError(t, sub.set("device:7", false))
+	assert.Equal(t, []string{"group:kitchen"}, sub.topics())
+}
+
+// TestSubscriptionFilter asserts server-side filtering per topic.
+func TestSubscriptionFilter(t *testing.T) {
+	groups := map[string]map[string]bool{"kitchen": {"2": true}}
+	snapshot := newDashboardUpdate(MessageTypeMetricsUpdate, &DashboardMetrics{
+		SystemStatus:  SystemStatus{TotalDevices: 3},
+		DeviceMetrics: []DeviceMetric{{ID: "1"}, {ID: "2"}, {ID: "3"}},
+	})
+	deviceIDs := func(u *MetricsUpdate) []string {
+		ids := []string{}
+		for _, d := range u.Data.(*DashboardMetrics).DeviceMetrics {
+			ids = append(ids, d.ID)
+		}
+		return ids
+	}
+
+	// Clients that never subscribed and fleet subscribers get everything
+	var none *subscription
+	assert.Same(t, snapshot, none.filter(snapshot, groups))
+	fleet := newSubscription()
+	require.NoError(t, fleet.set("fleet", true))
+	assert.Same(t, snapshot, fleet.filter(snapshot, groups))
+
+	room := newSubscription()
+	require.NoError(t, room.set("device:1", true))
+	require.NoError(t, room.set("group:kitchen", true))
+	filtered := room.filter(snapshot, groups)
+	require.NotNil(t, filtered)
+	assert.Equal(t, MessageTypeMetricsUpdate, filtered.Type)
+	assert.Equal(t, []string{"1", "2"}, deviceIDs(filtered))
+	assert.Equal(t, 3, filtered.Data.(*DashboardMetrics).SystemStatus.TotalDevices)
+	assert.Len(t, snapshot.Data.(*DashboardMetrics).DeviceMetrics, 3, "snapshot shared by clients must not change")
+
+	// Device messages reach only the device's subscribers
+	assert.NotNil(t, room.filter(newDeviceStatusChangeUpdate("2", "Kettle", "online", "offline"), groups))
+	assert.Nil(t, room.filter(newDriftDetectedUpdate("3", "Garage", 2, "warning"), groups))
+	assert.NotNil(t, room.filter(newAlertUpdate("system", "Database slow", "warning"), groups))
+}
+
+// TestSessionUpdateBuilder asserts the session payload shape.
+func TestSessionUpdateBuilder(t *testing.T) {
+	session := &wsSession{id: "abc", identity: "admin-key"}
+	session.dropped.Store(4)
+	u := newSessionUpdate(session, true, []string{"device:7"}, 2*time.Minute)
+	assert.Equal(t, MessageTypeSession, u.Type)
+
+	data, ok := u.Data.(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "abc", data["session_id"])
+	assert.Equal(t, "admin-key", data["identity"])
+	assert.Equal(t, true, data["resumed"])
+	assert.Equal(t, []string{"device:7"}, data["topics"])
+	assert.Equal(t, int64(4), data["dropped"])
+	assert.Equal(t, 120, data["resume_window_seconds"])
+	assert.ElementsMatch(t,
+		[]string{"session_id", "identity", "resumed", "topics", "dropped", "resume_window_seconds"},
+		keysOf(data))
+}
+
+// TestWebSocketIdentity asserts who may connect and as which identity.
+func TestWebSocketIdentity(t *testing.T) {
+	logger := logging.GetDefault()
+	h := NewHandler(nil, logger)
+
+	identity, ok := h.webSocketIdentity(httptest.NewRequest("GET", "/metrics/ws", nil))
+	assert.True(t, ok)
+	assert.Equal(t, anonymousIdentity, identity)
+
+	h.SetAdminAPIKey("secret")
+	_, ok = h.webSocketIdentity(httptest.NewRequest("GET", "/metrics/ws", nil))
+	assert.False(t, ok, "anonymous clients are refused once a key is set")
+	_, ok = h.webSocketIdentity(httptest.NewRequest("GET", "/metrics/ws?token=wrong", nil))
+	assert.False(t, ok)
+
+	identity, ok = h.webSocketIdentity(httptest.NewRequest("GET", "/metrics/ws?token=secret", nil))
+	assert.True(t, ok)
+	assert.Equal(t, "admin-key", identity)
+	req := httptest.NewRequest("GET", "/metrics/ws", nil)
+	req.Header.Set("X-API-Key", "secret")
+	identity, ok = h.webSocketIdentity(req)
+	assert.True(t, ok)
+	assert.Equal(t, "admin-key", identity)
+}
+
+// TestWebSocketDropPolicies asserts what a full client queue loses under
+// each policy, and when the client is disconnected instead.
+func TestWebSocketDropPolicies(t *testing.T) {
+	service, _ := setupTestService(t)
+	update := func(n int) *MetricsUpdate { return newAlertUpdate("test", string(rune('0'+n)), "info") }
+	queued := func(c *WebSocketClient) []string {
+		out := []string{}
+		for len(c.send) > 0 {
+			out = append(out, (<-c.send).Data.(map[string]interface{})["message"].(string))
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		policy string
+		keep   []string
+		ok     []bool
+	}{
+		{DropOldest, []string{"3", "4"}, []bool{true, true, true, false}},
+		{DropNewest, []string{"1", "2"}, []bool{true, true, true, false}},
+		{DropDisconnect, []string{"1", "2"}, []bool{true, true, false, false}},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			hub := NewWebSocketHub(service, logging.GetDefault())
+			hub.SetOptions(WebSocketOptions{QueueSize: 2, DropPolicy: tc.policy, MaxDrops: 2})
+			client := &WebSocketClient{hub: hub, send: make(chan *MetricsUpdate, 2), session: &wsSession{}}
+			for i, ok := range tc.ok {
+				assert.Equal(t, ok, hub.deliver(client, update(i+1)), "message %d", i+1)
+			}
+			assert.Equal(t, tc.keep, queued(client))
+
+			// Room in the queue ends the run of drops
+			assert.True(t, hub.deliver(client, update(5)))
+			assert.Equal(t, int64(0), client.drops.Load())
+		})
+	}
+	assert.Equal(t, 2.0, testutil.ToFloat64(service.wsDropped.WithLabelValues(DropOldest)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(service.wsDropped.WithLabelValues(DropNewest)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(service.wsDropped.WithLabelValues(DropDisconnect)))
+}
+
+// TestWebSocketSessionResume asserts a client reconnecting with its session
+// ID gets its topics back, and that other identities cannot take it over.
+func TestWebSocketSessionResume(t *testing.T) {
+	service, _ := setupTestService(t)
+	h := NewHandler(service, logging.GetDefault())
+	h.SetAdminAPIKey("secret")
+	hub := h.GetWebSocketHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	server := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+	defer server.Close()
+	base := "ws" + strings.TrimPrefix(server.URL, "http") + "/metrics/ws?token=secret"
+
+	// connect dials and returns the connection with its session message
+	connect := func(query string) (*websocket.Conn, map[string]interface{}) {
+		conn, _, err := websocket.DefaultDialer.Dial(base+query, nil)
+		require.NoError(t, err)
+		var msg struct {
+			Type string                 `json:"type"`
+			Data map[string]interface{} `json:"data"`
+		}
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, conn.ReadJSON(&msg))
+		require.Equal(t, MessageTypeSession, msg.Type)
+		return conn, msg.Data
+	}
+
+	conn, session := connect("&topics=device:7,group:kitchen")
+	id := session["session_id"].(string)
+	assert.Len(t, id, 32)
+	assert.Equal(t, "admin-key", session["identity"])
+	assert.Equal(t, false, session["resumed"])
+	require.NoError(t, conn.Close())
+
+	// The session is kept once the hub notices the disconnect
+	require.Eventually(t, func() bool {
+		hub.mu.RLock()
+		defer hub.mu.RUnlock()
+		return len(hub.clients) == 0 && hub.sessions[id] != nil && hub.sessions[id].client == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1.0, testutil.ToFloat64(service.wsSessions.WithLabelValues("detached")))
+
+	conn, session = connect("&session=" + id)
+	defer conn.Close()
+	assert.Equal(t, id, session["session_id"])
+	assert.Equal(t, true, session["resumed"])
+	assert.ElementsMatch(t, []interface{}{"device:7", "group:kitchen"}, session["topics"])
+	assert.Equal(t, 1.0, testutil.ToFloat64(service.wsConnections.WithLabelValues(connectResumed)))
+
+	// Another identity gets a session of its own
+	hub.mu.Lock()
+	hub.sessions[id].identity = "user:alice"
+	hub.mu.Unlock()
+	other, session := connect("&session=" + id)
+	defer other.Close()
+	assert.NotEqual(t, id, session["session_id"])
+	assert.Equal(t, false, session["resumed"])
+
+	// Unknown clients are refused before the upgrade
+	_, resp, err := websocket.DefaultDialer.Dial(strings.TrimSuffix(base, "?token=secret"), nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, 1.0, testutil.ToFloat64(service.wsConnections.WithLabelValues(connectRejected)))
+}
+
+// TestWebSocketSessionExpiry asserts detached sessions are forgotten after
+// the resume window.
+func TestWebSocketSessionExpiry(t *testing.T) {
+	hub := NewWebSocketHub(nil, logging.GetDefault())
+	hub.SetOptions(WebSocketOptions{ResumeWindow: time.Minute})
+	now := time.Now()
+
+	client := &WebSocketClient{hub: hub, send: make(chan *MetricsUpdate, 1), identity: "admin-key"}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	assert.False(t, hub.attach(client, now))
+	id := client.session.id
+	delete(hub.clients, client)
+	hub.detach(client, now)
+	require.NotNil(t, hub.sessions[id])
+
+	hub.expireSessions(now.Add(59 * time.Second))
+	require.NotNil(t, hub.sessions[id])
+	hub.expireSessions(now.Add(time.Minute))
+	assert.Nil(t, hub.sessions[id])
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WebSocket subscription topics. A client that never subscribes receives
+// every message, as before topics existed.
+const (
+	// TopicFleet receives every device
+	TopicFleet = "fleet"
+	// TopicDevicePrefix followed by a device ID receives that device
+	TopicDevicePrefix = "device:"
+	// TopicGroupPrefix followed by a tag receives the devices carrying it
+	TopicGroupPrefix = "group:"
+)
+
+// subscribeMessage is sent by clients to change their topics
+type subscribeMessage struct {
+	Action string   `json:"action"` // subscribe or unsubscribe
+	Topics []string `json:"topics"`
+}
+
+// subscription is the set of topics a client receives
+type subscription struct {
+	fleet   bool
+	devices map[string]bool
+	groups  map[string]bool
+}
+
+func newSubscription() *subscription {
+	return &subscription{devices: map[string]bool{}, groups: map[string]bool{}}
+}
+
+// parseTopic validates a topic and returns its kind and key
+func parseTopic(topic string) (kind, key string, err error) {
+	topic = strings.TrimSpace(topic)
+	switch {
+	case topic == TopicFleet:
+		return TopicFleet, "", nil
+	case strings.HasPrefix(topic, TopicDevicePrefix):
+		id := strings.TrimPrefix(topic, TopicDevicePrefix)
+		if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+			return "", "", fmt.Errorf("invalid device topic %q", topic)
+		}
+		return TopicDevicePrefix, id, nil
+	case strings.HasPrefix(topic, TopicGroupPrefix) && len(topic) > len(TopicGroupPrefix):
+		return TopicGroupPrefix, strings.TrimPrefix(topic, TopicGroupPrefix), nil
+	}
+	return "", "", fmt.Errorf("unknown topic %q", topic)
+}
+
+// set adds or removes a topic
+func (s *subscription) set(topic string, on bool) error {
+	kind, key, err := parseTopic(topic)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case TopicFleet:
+		s.fleet = on
+	case TopicDevicePrefix:
+		if on {
+			s.devices[key] = true
+		} else {
+			delete(s.devices, key)
+		}
+	case TopicGroupPrefix:
+		if on {
+			s.groups[key] = true
+		} else {
+			delete(s.groups, key)
+		}
+	}
+	return nil
+}
+
+// topics lists the subscribed topics; none for a client that never
+// subscribed
+func (s *subscription) topics() []string {
+	topics := []string{}
+	if s == nil {
+		return topics
+	}
+	if s.fleet {
+		topics = append(topics, TopicFleet)
+	}
+	for id := range s.devices {
+		topics = append(topics, TopicDevicePrefix+id)
+	}
+	for tag := range s.groups {
+		topics = append(topics, TopicGroupPrefix+tag)
+	}
+	return topics
+}
+
+// clone returns a copy of the subscription, nil for nil
+func (s *subscription) clone() *subscription {
+	if s == nil {
+		return nil
+	}
+	c := newSubscription()
+	c.fleet = s.fleet
+	for id := range s.devices {
+		c.devices[id] = true
+	}
+	for tag := range s.groups {
+		c.groups[tag] = true
+	}
+	return c
+}
+
+// matches reports whether a device is covered by the subscription. groups
+// maps each tag to the IDs of the devices carrying it.
+func (s *subscription) matches(deviceID string, groups map[string]map[string]bool) bool {
+	if s.fleet || s.devices[deviceID] {
+		return true
+	}
+	for tag := range s.groups {
+		if groups[tag][deviceID] {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the part of an update a subscription receives, or nil if
+// it receives none of it. Dashboard snapshots keep the fleet-wide totals but
+// list only the subscribed devices; device messages go to subscribers of the
+// device; messages about no device go to everyone.
+func (s *subscription) filter(update *MetricsUpdate, groups map[string]map[string]bool) *MetricsUpdate {
+	if s == nil || s.fleet {
+		return update
+	}
+	if update.deviceID != "" {
+		if s.matches(update.deviceID, groups) {
+			return update
+		}
+		return nil
+	}
+	metrics, ok := update.Data.(*DashboardMetrics)
+	if !ok || metrics == nil {
+		return update
+	}
+	filtered := *metrics
+	filtered.DeviceMetrics = []DeviceMetric{}
+	for _, d := range metrics.DeviceMetrics {
+		if s.matches(d.ID, groups) {
+			filtered.DeviceMetrics = append(filtered.DeviceMetrics, d)
+		}
+	}
+	return &MetricsUpdate{Type: update.Type, Timestamp: update.Timestamp, Data: &filtered}
+}
+
+// getGroupMembers maps each device tag to the IDs of the devices carrying it
+func (h *WebSocketHub) getGroupMembers(ctx context.Context) map[string]map[string]bool {
+	groups := map[string]map[string]bool{}
+	var rows []struct {
+		DeviceID uint
+		Tag      string
+	}
+	if err := h.service.db.WithContext(ctx).Table("device_tags").Select("device_id, tag").Scan(&rows).Error; err != nil {
+		// Without tags only fleet and device topics match
+		return groups
+	}
+	for _, row := range rows {
+		if groups[row.Tag] == nil {
+			groups[row.Tag] = map[string]bool{}
+		}
+		groups[row.Tag][strconv.FormatUint(uint64(row.DeviceID), 10)] = true
+	}
+	return groups
+}
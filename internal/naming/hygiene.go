@@ -0,0 +1,92 @@
+package naming
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// seqSentinel stands in for {{seq}} while a template is turned into a pattern
+const seqSentinel = "\x00"
+
+// minSimilarLength is the shortest key compared for near-duplicates; shorter
+// names differ by one character too easily
+const minSimilarLength = 5
+
+// foldLetters spells out letters that do not decompose into a base letter
+// and a diacritic
+var foldLetters = strings.NewReplacer(
+	"ß", "ss", "æ", "ae", "Æ", "ae", "œ", "oe", "Œ", "oe", "ø", "o", "Ø", "o",
+	"ł", "l", "Ł", "l", "đ", "d", "Đ", "d", "ð", "d", "Ð", "d", "þ", "th", "Þ", "th", "ı", "i",
+)
+
+// Key returns the form of a name used to compare names: case-folded,
+// without diacritics and keeping only letters and digits, so "Küche Licht",
+// "kuche-licht" and "KUCHE_LICHT" share a key
+func Key(name string) string {
+	stripped, _, err := transform.String(transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), name)
+	if err != nil {
+		stripped = name
+	}
+	stripped = cases.Fold().String(foldLetters.Replace(stripped))
+	var b strings.Builder
+	for _, r := range stripped {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Similar reports whether two keys are near-duplicates: one letter inserted,
+// removed or replaced. Edits involving digits do not count, so numbered
+// names such as "light1" and "light2" are not flagged.
+func Similar(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < minSimilarLength || len(rb) < minSimilarLength || a == b {
+		return false
+	}
+	if len(ra) > len(rb) {
+		ra, rb = rb, ra
+	}
+	if len(rb)-len(ra) > 1 {
+		return false
+	}
+	i := 0
+	for i < len(ra) && ra[i] == rb[i] {
+		i++
+	}
+	if len(ra) == len(rb) {
+		if unicode.IsDigit(ra[i]) || unicode.IsDigit(rb[i]) {
+			return false
+		}
+		return string(ra[i+1:]) == string(rb[i+1:])
+	}
+	if unicode.IsDigit(rb[i]) {
+		return false
+	}
+	return string(ra[i:]) == string(rb[i+1:])
+}
+
+// Matches reports whether name is one the policy could have given the
+// subject: its rendered template with any sequence number and, without
+// {{seq}}, an optional collision suffix
+func (p *Policy) Matches(subject Subject, name string) bool {
+	if p.Validate() != nil {
+		return false
+	}
+	vars := p.variables(subject)
+	vars["seq"] = seqSentinel
+	rendered := p.render(vars)
+	pattern := strings.ReplaceAll(regexp.QuoteMeta(rendered), seqSentinel, `[0-9]+`)
+	if !strings.Contains(rendered, seqSentinel) {
+		pattern += `(-[0-9]+)?`
+	}
+	re, err := regexp.Compile("^" + pattern + "$")
+	return err == nil && re.MatchString(name)
+}
@@ -0,0 +1,218 @@
+// Package naming generates device names from configurable templates such as
+// "{{site}}-{{room}}-{{model_short}}-{{seq}}", avoiding collisions with names
+// already in use.
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+)
+
+// maxSequence bounds the search for a free sequence number or collision suffix
+const maxSequence = 10000
+
+var (
+	placeholderRe = regexp.MustCompile(`\{\{\s*([a-z_]+)\s*\}\}`)
+	whitespaceRe  = regexp.MustCompile(`\s+`)
+	separatorsRe  = regexp.MustCompile(`([-_.])[-_.]+`)
+)
+
+// variables lists the supported template placeholders
+var variables = map[string]bool{
+	"site": true, "room": true, "model": true, "model_short": true, "type": true,
+	"gen": true, "mac": true, "mac_suffix": true, "ip_last": true, "seq": true,
+}
+
+// Subject describes the device being named
+type Subject struct {
+	MAC        string
+	Model      string
+	Type       string
+	IP         string
+	Generation int
+	Site       string
+	Room       string
+}
+
+// ApplyTags takes site and room from "site:<name>" and "room:<name>" tags
+func (s *Subject) ApplyTags(tags []string) {
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok || value == "" {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "site":
+			s.Site = value
+		case "room":
+			s.Room = value
+		}
+	}
+}
+
+// NameSet holds names already in use, compared case-insensitively
+type NameSet map[string]struct{}
+
+// Add reserves a name
+func (n NameSet) Add(name string) {
+	n[strings.ToLower(name)] = struct{}{}
+}
+
+// Has reports whether a name is in use
+func (n NameSet) Has(name string) bool {
+	_, ok := n[strings.ToLower(name)]
+	return ok
+}
+
+// Policy renders names from a naming configuration
+type Policy struct {
+	cfg config.NamingConfig
+}
+
+// NewPolicy creates a naming policy
+func NewPolicy(cfg config.NamingConfig) *Policy {
+	return &Policy{cfg: cfg}
+}
+
+// WithTemplate returns a copy of the policy using a different template
+func (p *Policy) WithTemplate(template string) *Policy {
+	cfg := p.cfg
+	cfg.Template = template
+	return &Policy{cfg: cfg}
+}
+
+// Enabled reports whether a template is configured
+func (p *Policy) Enabled() bool {
+	return p != nil && strings.TrimSpace(p.cfg.Template) != ""
+}
+
+// Validate checks that the template only uses known placeholders
+func (p *Policy) Validate() error {
+	if !p.Enabled() {
+		return fmt.Errorf("no naming template configured")
+	}
+	for _, m := range placeholderRe.FindAllStringSubmatch(p.cfg.Template, -1) {
+		if !variables[m[1]] {
+			return fmt.Errorf("unknown naming placeholder: {{%s}}", m[1])
+		}
+	}
+	if strings.Contains(placeholderRe.ReplaceAllString(p.cfg.Template, ""), "{{") {
+		return fmt.Errorf("malformed naming template: %s", p.cfg.Template)
+	}
+	return nil
+}
+
+// Name renders the template for a device and picks the first name not in
+// taken. With {{seq}} the lowest free sequence number is used; otherwise a
+// colliding name gets a "-2", "-3", ... suffix.
+func (p *Policy) Name(subject Subject, taken NameSet) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
+	vars := p.variables(subject)
+	hasSeq := false
+	for _, m := range placeholderRe.FindAllStringSubmatch(p.cfg.Template, -1) {
+		if m[1] == "seq" {
+			hasSeq = true
+		}
+	}
+
+	for n := 1; n <= maxSequence; n++ {
+		var name string
+		if hasSeq {
+			vars["seq"] = p.sequence(n)
+			name = p.render(vars)
+		} else {
+			name = p.render(vars)
+			if n > 1 {
+				name = fmt.Sprintf("%s-%d", name, n)
+			}
+		}
+		if name == "" {
+			return "", fmt.Errorf("naming template %q renders an empty name", p.cfg.Template)
+		}
+		if taken == nil || !taken.Has(name) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no free name for template %q", p.cfg.Template)
+}
+
+// variables resolves the placeholder values for a subject
+func (p *Policy) variables(s Subject) map[string]string {
+	mac := config.NormalizeMAC(s.MAC)
+	suffix := mac
+	if len(suffix) > 6 {
+		suffix = suffix[len(suffix)-6:]
+	}
+	ipLast := ""
+	if i := strings.LastIndex(s.IP, "."); i >= 0 {
+		ipLast = s.IP[i+1:]
+	}
+	gen := ""
+	if s.Generation > 0 {
+		gen = strconv.Itoa(s.Generation)
+	}
+	site := s.Site
+	if site == "" {
+		site = p.cfg.Site
+	}
+	return map[string]string{
+		"site":        site,
+		"room":        s.Room,
+		"model":       s.Model,
+		"model_short": p.modelShort(s.Model, s.Type),
+		"type":        s.Type,
+		"gen":         gen,
+		"mac":         mac,
+		"mac_suffix":  suffix,
+		"ip_last":     ipLast,
+	}
+}
+
+// modelShort returns the configured alias for a model, or the model without
+// its "Shelly" prefix
+func (p *Policy) modelShort(model, deviceType string) string {
+	for key, alias := range p.cfg.ModelAliases {
+		if strings.EqualFold(key, model) || (model == "" && strings.EqualFold(key, deviceType)) {
+			return alias
+		}
+	}
+	short := model
+	if short == "" {
+		short = deviceType
+	}
+	if len(short) > len("shelly") && strings.EqualFold(short[:len("shelly")], "shelly") {
+		short = short[len("shelly"):]
+	}
+	return strings.ToLower(strings.Trim(short, "-_ "))
+}
+
+// sequence formats a sequence number with the configured zero padding
+func (p *Policy) sequence(n int) string {
+	if p.cfg.SeqWidth > 0 {
+		return fmt.Sprintf("%0*d", p.cfg.SeqWidth, n)
+	}
+	return strconv.Itoa(n)
+}
+
+// render substitutes placeholders and tidies the result: whitespace becomes
+// "-", separators left around empty values collapse, and leading or trailing
+// separators are trimmed
+func (p *Policy) render(vars map[string]string) string {
+	name := placeholderRe.ReplaceAllStringFunc(p.cfg.Template, func(m string) string {
+		return vars[placeholderRe.FindStringSubmatch(m)[1]]
+	})
+	name = whitespaceRe.ReplaceAllString(strings.TrimSpace(name), "-")
+	name = separatorsRe.ReplaceAllString(name, "$1")
+	name = strings.Trim(name, "-_.")
+	if p.cfg.Lowercase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
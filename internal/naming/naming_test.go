@@ -0,0 +1,125 @@
+package naming
+
+import (
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+)
+
+func TestPolicy_Name(t *testing.T) {
+	policy := NewPolicy(config.NamingConfig{
+		Template:     "{{site}}-{{room}}-{{model_short}}-{{seq}}",
+		Site:         "home",
+		SeqWidth:     2,
+		Lowercase:    true,
+		ModelAliases: map[string]string{"snsw-001x16eu": "plus1"},
+	})
+
+	taken := NameSet{}
+	subject := Subject{MAC: "A8:03:2A:B1:E2:C4", Model: "SNSW-001X16EU", Room: "Living Room"}
+	first, err := policy.Name(subject, taken)
+	if err != nil {
+		t.Fatalf("Name failed: %v", err)
+	}
+	if first != "home-living-room-plus1-01" {
+		t.Errorf("Unexpected name %q", first)
+	}
+	taken.Add(first)
+	if second, _ := policy.Name(subject, taken); second != "home-living-room-plus1-02" {
+		t.Errorf("Expected next sequence number, got %q", second)
+	}
+
+	// Missing room collapses separators; tags override the configured site
+	noRoom := Subject{Model: "SHSW-1"}
+	noRoom.ApplyTags([]string{"site:cabin", "critical"})
+	if name, _ := policy.Name(noRoom, nil); name != "cabin-shsw-1-01" {
+		t.Errorf("Unexpected name without room %q", name)
+	}
+	if name, _ := policy.Name(Subject{Model: "ShellyPlus2PM"}, nil); name != "home-plus2pm-01" {
+		t.Errorf("Expected Shelly prefix to be stripped, got %q", name)
+	}
+}
+
+func TestPolicy_CollisionSuffix(t *testing.T) {
+	policy := NewPolicy(config.NamingConfig{Template: "Shelly-{{mac_suffix}}"})
+	taken := NameSet{}
+	taken.Add("shelly-B1E2C4")
+
+	name, err := policy.Name(Subject{MAC: "a8032ab1e2c4"}, taken)
+	if err != nil {
+		t.Fatalf("Name failed: %v", err)
+	}
+	if name != "Shelly-B1E2C4-2" {
+		t.Errorf("Expected collision suffix, got %q", name)
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	for _, tmpl := range []string{"", "{{floor}}-{{seq}}", "{{site}-x"} {
+		if err := NewPolicy(config.NamingConfig{Template: tmpl}).Validate(); err == nil {
+			t.Errorf("Expected validation error for %q", tmpl)
+		}
+	}
+	if _, err := NewPolicy(config.NamingConfig{Template: "{{room}}"}).Name(Subject{}, nil); err == nil {
+		t.Error("Expected error for empty rendered name")
+	}
+}
+
+func TestKey(t *testing.T) {
+	for _, name := range []string{"Küche Licht", "kuche-licht", "KUCHE_LICHT", " Kü che.Licht "} {
+		if key := Key(name); key != "kuchelicht" {
+			t.Errorf("Key(%q) = %q", name, key)
+		}
+	}
+	if key := Key("Straße Øst"); key != "strasseost" {
+		t.Errorf("Expected ß and ø spelled out, got %q", key)
+	}
+	if key := Key("Cuisine Éclairage"); key != Key("cuisine eclairage") {
+		t.Errorf("Expected accents ignored, got %q", key)
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"kitchenlight", "kitchenlights", true},
+		{"kitchenlight", "kitchnlight", true},
+		{"kitchenlight", "kitchenfight", true},
+		{"kitchenlight1", "kitchenlight2", false}, // numbered
+		{"kitchenlight", "kitchenlight3", false},
+		{"kitchenlight", "kitchenlamp", false},
+		{"lamp", "lamps", false}, // too short
+	}
+	for _, c := range cases {
+		if got := Similar(c.a, c.b); got != c.want {
+			t.Errorf("Similar(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestPolicy_Matches(t *testing.T) {
+	policy := NewPolicy(config.NamingConfig{Template: "{{site}}-{{room}}-{{model_short}}-{{seq}}", Site: "home", SeqWidth: 2, Lowercase: true})
+	subject := Subject{Model: "SHSW-1", Room: "Kitchen"}
+	for name, want := range map[string]bool{
+		"home-kitchen-shsw-1-01":  true,
+		"home-kitchen-shsw-1-112": true,
+		"home-kitchen-shsw-1":     false,
+		"Home-Kitchen-shsw-1-01":  false,
+		"cabin-kitchen-shsw-1-01": false,
+		"Kitchen light":           false,
+	} {
+		if got := policy.Matches(subject, name); got != want {
+			t.Errorf("Matches(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	suffixed := NewPolicy(config.NamingConfig{Template: "Shelly-{{mac_suffix}}"})
+	if !suffixed.Matches(Subject{MAC: "a8032ab1e2c4"}, "Shelly-B1E2C4-2") {
+		t.Error("Expected a collision suffix to match")
+	}
+	if NewPolicy(config.NamingConfig{}).Matches(subject, "anything") {
+		t.Error("Expected no match without a template")
+	}
+}
@@ -0,0 +1,169 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAlertNotFound is returned for an unknown notification
+	ErrAlertNotFound = errors.New("alert not found")
+
+	// ErrAlertResolved is returned when acknowledging a resolved alert
+	ErrAlertResolved = errors.New("alert is already resolved")
+
+	// ErrNotAnAlert is returned for digests and test notifications, which
+	// have no alert state
+	ErrNotAnAlert = errors.New("notification is not an alert")
+
+	// ErrInvalidAlertState is returned for an unknown alert state filter
+	ErrInvalidAlertState = errors.New("invalid alert state")
+)
+
+// activeAlertStates are the states of alerts still needing attention
+var activeAlertStates = []string{AlertStateOpen, AlertStateAcknowledged}
+
+// AcknowledgeAlert marks an open alert as seen by someone. Acknowledging an
+// acknowledged alert keeps the first acknowledgement.
+func (s *Service) AcknowledgeAlert(id uint, by string) (*NotificationHistory, error) {
+	alert, err := s.getAlert(id)
+	if err != nil {
+		return nil, err
+	}
+	switch alert.AlertState {
+	case AlertStateResolved:
+		return nil, fmt.Errorf("%w: %d", ErrAlertResolved, id)
+	case AlertStateAcknowledged:
+		return alert, nil
+	}
+
+	now := s.clock.Now()
+	alert.AlertState = AlertStateAcknowledged
+	alert.AcknowledgedBy = alertActor(by)
+	alert.AcknowledgedAt = &now
+	if err := s.db.Model(alert).Updates(map[string]interface{}{
+		"alert_state":     alert.AlertState,
+		"acknowledged_by": alert.AcknowledgedBy,
+		"acknowledged_at": alert.AcknowledgedAt,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to acknowledge alert: %w", err)
+	}
+
+	s.logger.WithFields(map[string]any{
+		"alert_id":        id,
+		"acknowledged_by": alert.AcknowledgedBy,
+		"component":       "notification",
+	}).Info("Alert acknowledged")
+	return alert, nil
+}
+
+// ResolveAlert closes an alert by hand. Resolving a resolved alert is a no-op.
+func (s *Service) ResolveAlert(id uint, by string) (*NotificationHistory, error) {
+	alert, err := s.getAlert(id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.AlertState == AlertStateResolved {
+		return alert, nil
+	}
+
+	now := s.clock.Now()
+	alert.AlertState = AlertStateResolved
+	alert.ResolvedBy = alertActor(by)
+	alert.ResolvedAt = &now
+	if err := s.db.Model(alert).Updates(map[string]interface{}{
+		"alert_state": alert.AlertState,
+		"resolved_by": alert.ResolvedBy,
+		"resolved_at": alert.ResolvedAt,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve alert: %w", err)
+	}
+
+	s.logger.WithFields(map[string]any{
+		"alert_id":    id,
+		"resolved_by": alert.ResolvedBy,
+		"component":   "notification",
+	}).Info("Alert resolved")
+	return alert, nil
+}
+
+// ResolveAlerts resolves the active alerts raised by events of eventType for
+// a device, or for no device when deviceID is nil, once the condition behind
+// them has cleared. It returns the number of alerts resolved.
+func (s *Service) ResolveAlerts(eventType string, deviceID *uint) (int64, error) {
+	q := s.db.Model(&NotificationHistory{}).
+		Where("trigger_type = ? AND alert_state IN ?", eventType, activeAlertStates)
+	if deviceID != nil {
+		q = q.Where("device_id = ?", *deviceID)
+	} else {
+		q = q.Where("device_id IS NULL")
+	}
+
+	now := s.clock.Now()
+	result := q.Updates(map[string]interface{}{
+		"alert_state": AlertStateResolved,
+		"resolved_by": "system",
+		"resolved_at": &now,
+	})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to resolve alerts: %w", result.Error)
+	}
+
+	if result.RowsAffected > 0 {
+		s.logger.WithFields(map[string]any{
+			"event_type": eventType,
+			"device_id":  deviceID,
+			"resolved":   result.RowsAffected,
+			"component":  "notification",
+		}).Info("Alerts resolved automatically")
+	}
+	return result.RowsAffected, nil
+}
+
+// getAlert loads a notification that has an alert state
+func (s *Service) getAlert(id uint) (*NotificationHistory, error) {
+	var alert NotificationHistory
+	if err := s.db.First(&alert, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrAlertNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to get alert: %w", err)
+	}
+	if alert.AlertState == "" {
+		return nil, fmt.Errorf("%w: %d", ErrNotAnAlert, id)
+	}
+	return &alert, nil
+}
+
+// alertStateFilter returns the history query condition for a state filter
+func alertStateFilter(state string) (func(*gorm.DB) *gorm.DB, error) {
+	switch state {
+	case "":
+		return func(q *gorm.DB) *gorm.DB { return q }, nil
+	case "active":
+		return func(q *gorm.DB) *gorm.DB {
+			return q.Where("alert_state IN ?", activeAlertStates)
+		}, nil
+	case "historical":
+		return func(q *gorm.DB) *gorm.DB {
+			return q.Where("(alert_state IS NULL OR alert_state NOT IN ?)", activeAlertStates)
+		}, nil
+	case AlertStateOpen, AlertStateAcknowledged, AlertStateResolved:
+		return func(q *gorm.DB) *gorm.DB {
+			return q.Where("alert_state = ?", state)
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAlertState, state)
+	}
+}
+
+// alertActor names who changed an alert, defaulting to the API
+func alertActor(by string) string {
+	if by = strings.TrimSpace(by); by == "" {
+		return "api"
+	}
+	return by
+}
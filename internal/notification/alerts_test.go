@@ -0,0 +1,96 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/clock"
+)
+
+// fixedClock stands still until moved; testutil's fake clock cannot be used
+// here since testutil imports this package through database
+type fixedClock struct{ now time.Time }
+
+func (c *fixedClock) Now() time.Time { return c.now }
+
+func (c *fixedClock) NewTicker(d time.Duration) clock.Ticker { return clock.Real.NewTicker(d) }
+
+func TestNotificationService_AlertLifecycle(t *testing.T) {
+	service, db, cleanup := setupSimpleTestService(t)
+	defer cleanup()
+	service.httpClient = fakeHTTPClient(200)
+	t0 := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	fake := &fixedClock{now: t0}
+	service.SetClock(fake)
+
+	cfg, _ := json.Marshal(WebhookConfig{URL: "https://example.com/webhook"})
+	ch := &NotificationChannel{Name: "Alerts", Type: "webhook", Enabled: true, Config: cfg}
+	require.NoError(t, service.CreateChannel(ch))
+	require.NoError(t, service.CreateRule(&NotificationRule{Name: "All", Enabled: true, ChannelID: ch.ID, AlertLevel: "all", MaxPerHour: 100}))
+
+	plug, relay := uint(7), uint(8)
+	for _, evt := range []*NotificationEvent{
+		{Type: "drift_detected", AlertLevel: AlertLevelWarning, DeviceID: &plug, Title: "Drift on plug"},
+		{Type: "drift_detected", AlertLevel: AlertLevelWarning, DeviceID: &relay, Title: "Drift on relay"},
+		{Type: "offline", AlertLevel: AlertLevelCritical, DeviceID: &plug, Title: "Plug offline"},
+	} {
+		evt.Timestamp = time.Now()
+		require.NoError(t, service.SendNotification(context.Background(), evt))
+	}
+
+	var alerts []NotificationHistory
+	require.NoError(t, db.Order("id ASC").Find(&alerts).Error)
+	require.Len(t, alerts, 3)
+	for _, a := range alerts {
+		assert.Equal(t, AlertStateOpen, a.AlertState)
+	}
+	plugDrift, relayDrift, plugOffline := alerts[0].ID, alerts[1].ID, alerts[2].ID
+
+	// Acknowledge records who and when; a second acknowledgement keeps the first
+	acked, err := service.AcknowledgeAlert(plugOffline, "  alice ")
+	require.NoError(t, err)
+	assert.Equal(t, AlertStateAcknowledged, acked.AlertState)
+	assert.Equal(t, "alice", acked.AcknowledgedBy)
+	require.NotNil(t, acked.AcknowledgedAt)
+	fake.now = t0.Add(time.Minute)
+	acked, err = service.AcknowledgeAlert(plugOffline, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", acked.AcknowledgedBy)
+	assert.True(t, acked.AcknowledgedAt.Equal(t0), "acknowledged at the fake time")
+
+	// The plug's drift clears: only its drift alert resolves
+	resolved, err := service.ResolveAlerts("drift_detected", &plug)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), resolved)
+
+	active, total, err := service.GetHistory(nil, "", "active", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	ids := []uint{active[0].ID, active[1].ID}
+	assert.ElementsMatch(t, []uint{relayDrift, plugOffline}, ids)
+
+	historical, _, err := service.GetHistory(nil, "", "historical", 0, 0)
+	require.NoError(t, err)
+	require.Len(t, historical, 1)
+	assert.Equal(t, plugDrift, historical[0].ID)
+	assert.Equal(t, "system", historical[0].ResolvedBy)
+	assert.NotNil(t, historical[0].ResolvedAt)
+
+	// Resolved alerts cannot be acknowledged; resolving by hand defaults the actor
+	_, err = service.AcknowledgeAlert(plugDrift, "alice")
+	assert.True(t, errors.Is(err, ErrAlertResolved))
+	closed, err := service.ResolveAlert(relayDrift, "")
+	require.NoError(t, err)
+	assert.Equal(t, "api", closed.ResolvedBy)
+
+	_, err = service.AcknowledgeAlert(9999, "alice")
+	assert.True(t, errors.Is(err, ErrAlertNotFound))
+	_, _, err = service.GetHistory(nil, "", "closed", 0, 0)
+	assert.True(t, errors.Is(err, ErrInvalidAlertState))
+}
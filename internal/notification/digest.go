@@ -0,0 +1,221 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Failed digests are retried after digestRetryBase, doubling with each
+// further failure up to digestRetryMax
+const (
+	digestRetryBase = time.Minute
+	digestRetryMax  = time.Hour
+)
+
+// digestBackoff delays the next digest of a channel after failed deliveries
+type digestBackoff struct {
+	failures int
+	next     time.Time
+}
+
+// SetLeaderFunc makes RunDigests flush only while leader returns true, so one
+// of several instances sharing a database sends each digest. Call it before
+// RunDigests.
+func (s *Service) SetLeaderFunc(leader func() bool) {
+	s.leader = leader
+}
+
+// RunDigests flushes due digests every interval until ctx is cancelled; pass
+// a context that ends with the service so the loop stops with it
+func (s *Service) RunDigests(ctx context.Context, interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C():
+			if s.leader != nil && !s.leader() {
+				continue
+			}
+			if _, err := s.FlushDigests(ctx, now); err != nil {
+				s.logger.WithFields(map[string]any{
+					"error":     err.Error(),
+					"component": "notification",
+				}).Error("Failed to flush notification digests")
+			}
+		}
+	}
+}
+
+// FlushDigests sends one summary per enabled digest channel whose oldest
+// queued notification is at least a digest window old, and returns the
+// number of digests sent. Queued notifications stay queued when delivery
+// fails; the channel is retried after a backoff that doubles with each
+// failure, so a broken channel does not add a failed digest every flush.
+func (s *Service) FlushDigests(ctx context.Context, now time.Time) (int, error) {
+	var channels []NotificationChannel
+	if err := s.db.Where("digest_window_minutes > ? AND enabled = ?", 0, true).Find(&channels).Error; err != nil {
+		return 0, fmt.Errorf("failed to get digest channels: %w", err)
+	}
+
+	sent := 0
+	for i := range channels {
+		channel := &channels[i]
+
+		var queued []NotificationHistory
+		if err := s.db.Where("channel_id = ? AND status = ?", channel.ID, "queued").
+			Order("created_at ASC, id ASC").Find(&queued).Error; err != nil {
+			return sent, fmt.Errorf("failed to get queued notifications: %w", err)
+		}
+		window := time.Duration(channel.DigestWindowMinutes) * time.Minute
+		if len(queued) == 0 || now.Before(queued[0].CreatedAt.Add(window)) {
+			continue
+		}
+		s.digestMu.Lock()
+		backoff, failing := s.digestRetry[channel.ID]
+		s.digestMu.Unlock()
+		if failing && now.Before(backoff.next) {
+			continue
+		}
+
+		digest := buildDigest(channel, queued, now)
+		if err := s.db.Create(digest).Error; err != nil {
+			return sent, fmt.Errorf("failed to create digest history: %w", err)
+		}
+
+		if err := s.deliverNotification(ctx, channel, digest); err != nil {
+			s.db.Model(digest).Updates(map[string]interface{}{
+				"status": "failed",
+				"error":  err.Error(),
+			})
+			delay := digestRetryBase << backoff.failures
+			if delay > digestRetryMax || delay <= 0 {
+				delay = digestRetryMax
+			}
+			s.digestMu.Lock()
+			s.digestRetry[channel.ID] = digestBackoff{failures: backoff.failures + 1, next: now.Add(delay)}
+			s.digestMu.Unlock()
+			s.logger.WithFields(map[string]any{
+				"channel_id": channel.ID,
+				"queued":     len(queued),
+				"retry_in":   delay.String(),
+				"error":      err.Error(),
+				"component":  "notification",
+			}).Error("Failed to send notification digest")
+			continue
+		}
+
+		ids := make([]uint, len(queued))
+		for j, h := range queued {
+			ids[j] = h.ID
+		}
+		s.db.Model(digest).Updates(map[string]interface{}{
+			"status":  "sent",
+			"sent_at": &now,
+		})
+		if err := s.db.Model(&NotificationHistory{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":    "sent",
+			"sent_at":   &now,
+			"digest_id": digest.ID,
+		}).Error; err != nil {
+			return sent, fmt.Errorf("failed to mark digested notifications: %w", err)
+		}
+		sent++
+		s.digestMu.Lock()
+		delete(s.digestRetry, channel.ID)
+		s.digestMu.Unlock()
+
+		s.logger.WithFields(map[string]any{
+			"channel_id":    channel.ID,
+			"notifications": len(queued),
+			"component":     "notification",
+		}).Info("Sent notification digest")
+	}
+
+	return sent, nil
+}
+
+// buildDigest summarizes queued notifications grouped by category and device.
+// The digest carries the highest alert level of its notifications.
+func buildDigest(channel *NotificationChannel, queued []NotificationHistory, now time.Time) *NotificationHistory {
+	type groupKey struct {
+		category string
+		deviceID uint
+	}
+	groups := make(map[groupKey]*DigestGroup)
+	var keys []groupKey
+	level := string(AlertLevelInfo)
+	for _, h := range queued {
+		key := groupKey{category: h.Category}
+		if h.DeviceID != nil {
+			key.deviceID = *h.DeviceID
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &DigestGroup{Category: h.Category, DeviceID: h.DeviceID}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.Count++
+		group.Subjects = append(group.Subjects, h.Subject)
+		if alertRank(h.AlertLevel) > alertRank(level) {
+			level = h.AlertLevel
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].category != keys[j].category {
+			return keys[i].category < keys[j].category
+		}
+		return keys[i].deviceID < keys[j].deviceID
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d notifications since %s\n", len(queued), queued[0].CreatedAt.Format(time.RFC3339))
+	digest := &NotificationHistory{
+		ChannelID:   channel.ID,
+		TriggerType: "digest",
+		Subject:     fmt.Sprintf("Digest: %d notifications", len(queued)),
+		AlertLevel:  level,
+		Category:    "digest",
+		Status:      "pending",
+		CreatedAt:   now,
+	}
+	category := ""
+	for _, key := range keys {
+		group := groups[key]
+		if key.category != category || len(digest.Digest) == 0 {
+			category = key.category
+			fmt.Fprintf(&b, "\n%s\n", category)
+		}
+		device := "no device"
+		if group.DeviceID != nil {
+			device = fmt.Sprintf("device %d", *group.DeviceID)
+		}
+		fmt.Fprintf(&b, "  %s (%d)\n", device, group.Count)
+		for _, subject := range group.Subjects {
+			fmt.Fprintf(&b, "    - %s\n", subject)
+		}
+		digest.Digest = append(digest.Digest, *group)
+	}
+	digest.Message = b.String()
+	return digest
+}
+
+// alertRank orders alert levels by severity
+func alertRank(level string) int {
+	switch strings.ToLower(level) {
+	case "info":
+		return 1
+	case "warning":
+		return 2
+	case "critical":
+		return 3
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,148 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationService_DigestMode(t *testing.T) {
+	service, db, cleanup := setupSimpleTestService(t)
+	defer cleanup()
+
+	// Record webhook payloads
+	var mu sync.Mutex
+	var payloads []map[string]interface{}
+	service.httpClient = &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			var payload map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			payloads = append(payloads, payload)
+			mu.Unlock()
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("ok")), Header: make(http.Header), Request: r}, nil
+		}),
+	}
+
+	cfg, _ := json.Marshal(WebhookConfig{URL: "https://example.com/webhook"})
+	ch := &NotificationChannel{Name: "Digest", Type: "webhook", Enabled: true, Config: cfg, DigestWindowMinutes: 60}
+	require.NoError(t, service.CreateChannel(ch))
+	require.NoError(t, service.CreateRule(&NotificationRule{Name: "All", Enabled: true, ChannelID: ch.ID, AlertLevel: "all"}))
+
+	deviceID := uint(7)
+	events := []*NotificationEvent{
+		{Type: "drift_detected", AlertLevel: AlertLevelWarning, DeviceID: &deviceID, Title: "Drift on plug", Categories: []string{"device"}},
+		{Type: "drift_detected", AlertLevel: AlertLevelInfo, DeviceID: &deviceID, Title: "Drift resolved", Categories: []string{"device"}},
+		{Type: "backup", AlertLevel: AlertLevelInfo, Title: "Backup done"},
+		{Type: "offline", AlertLevel: AlertLevelCritical, DeviceID: &deviceID, Title: "Plug offline", Categories: []string{"device"}},
+	}
+	for _, evt := range events {
+		evt.Timestamp = time.Now()
+		require.NoError(t, service.SendNotification(context.Background(), evt))
+	}
+
+	// Critical events bypass the digest
+	require.Len(t, payloads, 1)
+	assert.Equal(t, "Plug offline", payloads[0]["subject"])
+	var queued int64
+	require.NoError(t, db.Model(&NotificationHistory{}).Where("status = ?", "queued").Count(&queued).Error)
+	assert.Equal(t, int64(3), queued)
+
+	// Nothing is due before the window has passed
+	sent, err := service.FlushDigests(context.Background(), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	sent, err = service.FlushDigests(context.Background(), time.Now().Add(61*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	require.Len(t, payloads, 2)
+	assert.Equal(t, "digest", payloads[1]["type"])
+	assert.Equal(t, "warning", payloads[1]["alert_level"])
+	groups, ok := payloads[1]["digest"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, groups, 2)
+	assert.Equal(t, "backup", groups[0].(map[string]interface{})["category"])
+	assert.Equal(t, float64(2), groups[1].(map[string]interface{})["count"])
+	assert.Contains(t, payloads[1]["message"], "device 7 (2)")
+
+	var digested []NotificationHistory
+	require.NoError(t, db.Where("digest_id IS NOT NULL").Find(&digested).Error)
+	assert.Len(t, digested, 3)
+	for _, h := range digested {
+		assert.Equal(t, "sent", h.Status)
+	}
+
+	// Flushing again sends nothing
+	sent, err = service.FlushDigests(context.Background(), time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+}
+
+func TestNotificationService_DigestBackoff(t *testing.T) {
+	service, db, cleanup := setupSimpleTestService(t)
+	defer cleanup()
+
+	var mu sync.Mutex
+	attempts := 0
+	failing := true
+	service.httpClient = &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			status := 200
+			if failing {
+				status = 500
+			}
+			return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header), Request: r}, nil
+		}),
+	}
+
+	cfg, _ := json.Marshal(WebhookConfig{URL: "https://example.com/webhook"})
+	ch := &NotificationChannel{Name: "Digest", Type: "webhook", Enabled: true, Config: cfg, DigestWindowMinutes: 10}
+	require.NoError(t, service.CreateChannel(ch))
+	start := time.Now()
+	require.NoError(t, db.Create(&NotificationHistory{ChannelID: ch.ID, Subject: "queued", Status: "queued", CreatedAt: start}).Error)
+
+	// A disabled channel keeps its queue
+	require.NoError(t, db.Model(ch).Update("enabled", false).Error)
+	sent, err := service.FlushDigests(context.Background(), start.Add(11*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, 0, attempts)
+	require.NoError(t, db.Model(ch).Update("enabled", true).Error)
+
+	// Failures are retried after 1, then 2 minutes, not on every flush
+	flush := func(after time.Duration) {
+		_, err := service.FlushDigests(context.Background(), start.Add(after))
+		require.NoError(t, err)
+	}
+	flush(11 * time.Minute)
+	flush(11*time.Minute + 30*time.Second)
+	assert.Equal(t, 1, attempts)
+	flush(12 * time.Minute)
+	assert.Equal(t, 2, attempts)
+	flush(13 * time.Minute)
+	assert.Equal(t, 2, attempts)
+	var failed int64
+	require.NoError(t, db.Model(&NotificationHistory{}).Where("status = ?", "failed").Count(&failed).Error)
+	assert.Equal(t, int64(2), failed)
+
+	failing = false
+	flush(14 * time.Minute)
+	assert.Equal(t, 3, attempts)
+	var queued int64
+	require.NoError(t, db.Model(&NotificationHistory{}).Where("status = ?", "queued").Count(&queued).Error)
+	assert.Zero(t, queued)
+}
@@ -3,6 +3,7 @@ package notification
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -10,6 +11,7 @@ import (
 
 	apiresp "github.com/ginsys/shelly-manager/internal/api/response"
 	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security/auth"
 )
 
 // Handler handles HTTP requests for notification operations
@@ -31,6 +33,13 @@ func (h *Handler) NotifyEvent(ctx context.Context, event *NotificationEvent) err
 	return h.service.SendNotification(ctx, event)
 }
 
+// ResolveEvent resolves the active alerts of an event type for a device once
+// the condition behind them has cleared
+func (h *Handler) ResolveEvent(eventType string, deviceID *uint) error {
+	_, err := h.service.ResolveAlerts(eventType, deviceID)
+	return err
+}
+
 // Deprecated legacy JSON writer removed in favor of standardized responses.
 
 // CreateChannel handles POST /api/v1/notifications/channels
@@ -204,6 +213,36 @@ func (h *Handler) TestChannel(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetChannelHealth handles GET /api/v1/notifications/channels/health
+func (h *Handler) GetChannelHealth(w http.ResponseWriter, r *http.Request) {
+	health, err := h.service.GetChannelHealth()
+	if err != nil {
+		apiresp.NewResponseWriter(h.logger).WriteInternalError(w, r, err)
+		return
+	}
+
+	apiresp.NewResponseWriter(h.logger).WriteSuccess(w, r, map[string]interface{}{
+		"channels": health,
+	})
+}
+
+// CheckChannelHealth handles POST /api/v1/notifications/channels/health/check
+func (h *Handler) CheckChannelHealth(w http.ResponseWriter, r *http.Request) {
+	health, err := h.service.CheckChannels(r.Context())
+	if err != nil {
+		h.logger.WithFields(map[string]any{
+			"error":     err.Error(),
+			"component": "notification_api",
+		}).Error("Failed to check notification channels")
+		apiresp.NewResponseWriter(h.logger).WriteInternalError(w, r, err)
+		return
+	}
+
+	apiresp.NewResponseWriter(h.logger).WriteSuccess(w, r, map[string]interface{}{
+		"channels": health,
+	})
+}
+
 // GetHistory handles GET /api/v1/notifications/history
 func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
 	// Parse query parameters
@@ -212,6 +251,7 @@ func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
 	offsetStr := query.Get("offset")
 	channelIDStr := query.Get("channel_id")
 	status := query.Get("status")
+	state := query.Get("state")
 
 	limit := 50 // Default limit
 	if limitStr != "" {
@@ -235,7 +275,11 @@ func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	history, total, err := h.service.GetHistory(channelID, status, limit, offset)
+	history, total, err := h.service.GetHistory(channelID, status, state, limit, offset)
+	if errors.Is(err, ErrInvalidAlertState) {
+		apiresp.NewResponseWriter(h.logger).WriteValidationError(w, r, "state must be active, historical, open, acknowledged or resolved")
+		return
+	}
 	if err != nil {
 		h.logger.WithFields(map[string]any{
 			"error":     err.Error(),
@@ -273,3 +317,45 @@ func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
 		"history": history,
 	}, meta)
 }
+
+// AcknowledgeAlert handles POST /api/v1/notifications/history/{id}/acknowledge
+func (h *Handler) AcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	h.changeAlert(w, r, h.service.AcknowledgeAlert)
+}
+
+// ResolveAlert handles POST /api/v1/notifications/history/{id}/resolve
+func (h *Handler) ResolveAlert(w http.ResponseWriter, r *http.Request) {
+	h.changeAlert(w, r, h.service.ResolveAlert)
+}
+
+// changeAlert applies an alert state change by the authenticated requester
+// and writes the updated alert
+func (h *Handler) changeAlert(w http.ResponseWriter, r *http.Request, change func(id uint, by string) (*NotificationHistory, error)) {
+	alertID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		apiresp.NewResponseWriter(h.logger).WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, "Invalid alert ID", nil)
+		return
+	}
+
+	alert, err := change(uint(alertID), auth.Requester(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrAlertNotFound):
+			apiresp.NewResponseWriter(h.logger).WriteNotFoundError(w, r, "Alert")
+		case errors.Is(err, ErrNotAnAlert):
+			apiresp.NewResponseWriter(h.logger).WriteError(w, r, http.StatusBadRequest, apiresp.ErrCodeBadRequest, err.Error(), nil)
+		case errors.Is(err, ErrAlertResolved):
+			apiresp.NewResponseWriter(h.logger).WriteError(w, r, http.StatusConflict, apiresp.ErrCodeConflict, err.Error(), nil)
+		default:
+			h.logger.WithFields(map[string]any{
+				"alert_id":  alertID,
+				"error":     err.Error(),
+				"component": "notification_api",
+			}).Error("Failed to update alert")
+			apiresp.NewResponseWriter(h.logger).WriteInternalError(w, r, err)
+		}
+		return
+	}
+
+	apiresp.NewResponseWriter(h.logger).WriteSuccess(w, r, alert)
+}
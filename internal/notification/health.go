@@ -0,0 +1,280 @@
+package notification
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// Channel health states; a channel that was never checked has none
+const (
+	ChannelHealthy   = "healthy"
+	ChannelUnhealthy = "unhealthy"
+)
+
+// channelHealthTrigger is the trigger type of the alerts raised when a
+// channel starts failing
+const channelHealthTrigger = "channel_unhealthy"
+
+// healthCheckTimeout bounds each channel check
+const healthCheckTimeout = 10 * time.Second
+
+// ChannelHealth is the result of the last health check of a channel
+type ChannelHealth struct {
+	ChannelID      uint       `json:"channel_id"`
+	Name           string     `json:"name"`
+	Type           string     `json:"type"`
+	Enabled        bool       `json:"enabled"`
+	Status         string     `json:"status,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CheckedAt      *time.Time `json:"checked_at,omitempty"`
+	UnhealthySince *time.Time `json:"unhealthy_since,omitempty"`
+}
+
+// RunHealthChecks checks every enabled channel every interval until ctx is
+// cancelled
+func (s *Service) RunHealthChecks(ctx context.Context, interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if s.leader != nil && !s.leader() {
+				continue
+			}
+			if _, err := s.CheckChannels(ctx); err != nil {
+				s.logger.WithFields(map[string]any{
+					"error":     err.Error(),
+					"component": "notification",
+				}).Error("Failed to check notification channels")
+			}
+		}
+	}
+}
+
+// GetChannelHealth returns the last health check result of every channel
+func (s *Service) GetChannelHealth() ([]ChannelHealth, error) {
+	channels, err := s.GetChannels()
+	if err != nil {
+		return nil, err
+	}
+	health := make([]ChannelHealth, 0, len(channels))
+	for i := range channels {
+		health = append(health, channelHealth(&channels[i]))
+	}
+	return health, nil
+}
+
+// CheckChannels verifies every enabled channel without sending a message
+// and stores the results. When a channel starts failing, an alert naming it
+// goes out through the channels that passed, so a broken channel does not
+// fail silently; the alerts resolve once no channel fails any more.
+func (s *Service) CheckChannels(ctx context.Context) ([]ChannelHealth, error) {
+	var channels []NotificationChannel
+	if err := s.db.Where("enabled = ?", true).Order("id ASC").Find(&channels).Error; err != nil {
+		return nil, fmt.Errorf("failed to get notification channels: %w", err)
+	}
+
+	now := s.clock.Now()
+	var healthy, failed []*NotificationChannel
+	for i := range channels {
+		channel := &channels[i]
+		wasUnhealthy := channel.HealthStatus == ChannelUnhealthy
+
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		err := s.checkChannel(checkCtx, channel)
+		cancel()
+
+		channel.HealthCheckedAt = &now
+		if err != nil {
+			channel.HealthStatus = ChannelUnhealthy
+			channel.HealthError = err.Error()
+			if !wasUnhealthy {
+				channel.UnhealthySince = &now
+				failed = append(failed, channel)
+			}
+			s.logger.WithFields(map[string]any{
+				"channel_id": channel.ID,
+				"error":      err.Error(),
+				"component":  "notification",
+			}).Warn("Notification channel health check failed")
+		} else {
+			channel.HealthStatus = ChannelHealthy
+			channel.HealthError = ""
+			channel.UnhealthySince = nil
+			healthy = append(healthy, channel)
+		}
+
+		if err := s.db.Model(channel).Select("health_status", "health_error", "health_checked_at", "unhealthy_since").
+			Updates(channel).Error; err != nil {
+			return nil, fmt.Errorf("failed to store channel health: %w", err)
+		}
+	}
+
+	for _, channel := range failed {
+		s.raiseChannelAlert(ctx, channel, healthy)
+	}
+	if len(healthy) == len(channels) {
+		if _, err := s.ResolveAlerts(channelHealthTrigger, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	health := make([]ChannelHealth, 0, len(channels))
+	for i := range channels {
+		health = append(health, channelHealth(&channels[i]))
+	}
+	return health, nil
+}
+
+// raiseChannelAlert reports a failing channel through the healthy ones
+func (s *Service) raiseChannelAlert(ctx context.Context, failed *NotificationChannel, healthy []*NotificationChannel) {
+	if len(healthy) == 0 {
+		s.logger.WithFields(map[string]any{
+			"channel_id": failed.ID,
+			"component":  "notification",
+		}).Error("Notification channel failing and no healthy channel left to report it")
+		return
+	}
+
+	for _, channel := range healthy {
+		history := &NotificationHistory{
+			ChannelID:   channel.ID,
+			TriggerType: channelHealthTrigger,
+			Subject:     fmt.Sprintf("Notification channel '%s' is failing", failed.Name),
+			Message: fmt.Sprintf("Notifications through the %s channel '%s' cannot be delivered: %s",
+				failed.Type, failed.Name, failed.HealthError),
+			AlertLevel: string(AlertLevelCritical),
+			Category:   "notification",
+			AlertState: AlertStateOpen,
+			Status:     "pending",
+			CreatedAt:  s.clock.Now(),
+		}
+		if err := s.db.Create(history).Error; err != nil {
+			s.logger.WithFields(map[string]any{
+				"channel_id": channel.ID,
+				"error":      err.Error(),
+				"component":  "notification",
+			}).Error("Failed to create channel health alert")
+			continue
+		}
+
+		if err := s.deliverNotification(ctx, channel, history); err != nil {
+			s.db.Model(history).Updates(map[string]interface{}{
+				"status": "failed",
+				"error":  err.Error(),
+			})
+			continue
+		}
+		now := s.clock.Now()
+		s.db.Model(history).Updates(map[string]interface{}{
+			"status":  "sent",
+			"sent_at": &now,
+		})
+	}
+}
+
+// checkChannel verifies that a channel can deliver: the SMTP server accepts
+// a connection and the login for email, and the URL answers for webhooks and
+// Slack. Any HTTP answer below 500 counts, as endpoints may refuse a bodiless
+// probe.
+func (s *Service) checkChannel(ctx context.Context, channel *NotificationChannel) error {
+	switch channel.Type {
+	case "email":
+		return s.checkSMTP(ctx)
+	case "webhook":
+		var config WebhookConfig
+		if err := json.Unmarshal(channel.Config, &config); err != nil {
+			return fmt.Errorf("invalid webhook config: %w", err)
+		}
+		return s.checkURL(ctx, config.URL)
+	case "slack":
+		var config SlackConfig
+		if err := json.Unmarshal(channel.Config, &config); err != nil {
+			return fmt.Errorf("invalid slack config: %w", err)
+		}
+		return s.checkURL(ctx, config.WebhookURL)
+	default:
+		return fmt.Errorf("unsupported channel type: %s", channel.Type)
+	}
+}
+
+// checkURL sends a HEAD request to a delivery URL
+func (s *Service) checkURL(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "shelly-manager/1.0")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unreachable: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// checkSMTP connects to the SMTP server and logs in without sending mail
+func (s *Service) checkSMTP(ctx context.Context) error {
+	cfg := s.emailConfig
+	if cfg.Host == "" {
+		return fmt.Errorf("SMTP configuration not available")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
+	if err != nil {
+		return fmt.Errorf("SMTP server unreachable: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	if err := client.Hello("localhost"); err != nil {
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok && cfg.TLS {
+		if err := client.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
+			return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+		}
+	}
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	return client.Quit()
+}
+
+// channelHealth extracts the health fields of a channel
+func channelHealth(channel *NotificationChannel) ChannelHealth {
+	return ChannelHealth{
+		ChannelID:      channel.ID,
+		Name:           channel.Name,
+		Type:           channel.Type,
+		Enabled:        channel.Enabled,
+		Status:         channel.HealthStatus,
+		Error:          channel.HealthError,
+		CheckedAt:      channel.HealthCheckedAt,
+		UnhealthySince: channel.UnhealthySince,
+	}
+}
@@ -0,0 +1,104 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationService_CheckChannels(t *testing.T) {
+	service, db, cleanup := setupSimpleTestService(t)
+	defer cleanup()
+	service.emailConfig = EmailSMTPConfig{}
+
+	// The broken host fails while down is set; deliveries are recorded
+	var mu sync.Mutex
+	down := true
+	var delivered []string
+	service.httpClient = &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			status := http.StatusOK
+			if r.URL.Host == "broken.example.com" && down {
+				status = http.StatusBadGateway
+			}
+			if r.Method == http.MethodPost {
+				var payload map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					return nil, err
+				}
+				delivered = append(delivered, r.URL.Host+": "+payload["subject"].(string))
+			}
+			return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header), Request: r}, nil
+		}),
+	}
+
+	okCfg, _ := json.Marshal(WebhookConfig{URL: "https://ok.example.com/hook"})
+	brokenCfg, _ := json.Marshal(SlackConfig{WebhookURL: "https://broken.example.com/hook"})
+	ok := &NotificationChannel{Name: "Ops", Type: "webhook", Enabled: true, Config: okCfg}
+	broken := &NotificationChannel{Name: "Chat", Type: "slack", Enabled: true, Config: brokenCfg}
+	mail := &NotificationChannel{Name: "Mail", Type: "email", Enabled: true, Config: json.RawMessage(`{"recipients":["ops@example.com"]}`)}
+	for _, ch := range []*NotificationChannel{ok, broken, mail} {
+		require.NoError(t, service.CreateChannel(ch))
+	}
+
+	health, err := service.CheckChannels(context.Background())
+	require.NoError(t, err)
+	require.Len(t, health, 3)
+	assert.Equal(t, ChannelHealthy, health[0].Status)
+	assert.Equal(t, ChannelUnhealthy, health[1].Status)
+	assert.Contains(t, health[1].Error, "status 502")
+	assert.NotNil(t, health[1].UnhealthySince)
+	assert.Contains(t, health[2].Error, "SMTP configuration not available")
+
+	// Each failing channel is reported once through the healthy channel
+	assert.Equal(t, []string{
+		"ok.example.com: Notification channel 'Chat' is failing",
+		"ok.example.com: Notification channel 'Mail' is failing",
+	}, delivered)
+	var open int64
+	require.NoError(t, db.Model(&NotificationHistory{}).
+		Where("trigger_type = ? AND alert_state = ?", channelHealthTrigger, AlertStateOpen).Count(&open).Error)
+	assert.Equal(t, int64(2), open)
+
+	// Still failing: no new alerts, and the failure start is kept
+	since := *health[1].UnhealthySince
+	health, err = service.CheckChannels(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, delivered, 2)
+	assert.True(t, health[1].UnhealthySince.Equal(since))
+
+	// Stored health is exposed without checking again
+	stored, err := service.GetChannelHealth()
+	require.NoError(t, err)
+	require.Len(t, stored, 3)
+	assert.Equal(t, ChannelUnhealthy, stored[1].Status)
+
+	// Health is not changed through channel updates
+	require.NoError(t, service.UpdateChannel(broken.ID, &NotificationChannel{Type: "slack", Config: brokenCfg, HealthStatus: ChannelHealthy}))
+	stored, err = service.GetChannelHealth()
+	require.NoError(t, err)
+	assert.Equal(t, ChannelUnhealthy, stored[1].Status)
+
+	// Alerts resolve once every channel passes
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	require.NoError(t, db.Model(mail).Update("enabled", false).Error)
+	health, err = service.CheckChannels(context.Background())
+	require.NoError(t, err)
+	require.Len(t, health, 2)
+	assert.Equal(t, ChannelHealthy, health[1].Status)
+	assert.Nil(t, health[1].UnhealthySince)
+	require.NoError(t, db.Model(&NotificationHistory{}).
+		Where("trigger_type = ? AND alert_state = ?", channelHealthTrigger, AlertStateOpen).Count(&open).Error)
+	assert.Equal(t, int64(0), open)
+}
@@ -3,6 +3,9 @@ package notification
 import (
 	"encoding/json"
 	"time"
+
+	// Registers the serializer of encrypted columns
+	_ "github.com/ginsys/shelly-manager/internal/security/secrets"
 )
 
 // NotificationChannel represents a configured notification destination
@@ -11,10 +14,23 @@ type NotificationChannel struct {
 	Name        string          `json:"name" gorm:"size:191;uniqueIndex;not null"`
 	Type        string          `json:"type" gorm:"not null"` // "email", "webhook", "slack", "discord"
 	Enabled     bool            `json:"enabled" gorm:"default:true"`
-	Config      json.RawMessage `json:"config" gorm:"type:text"` // Channel-specific configuration
+	Config      json.RawMessage `json:"config" gorm:"type:text;serializer:encrypted"` // Channel-specific configuration, may hold secrets
 	Description string          `json:"description"`
-	CreatedAt   time.Time       `json:"created_at"`
-	UpdatedAt   time.Time       `json:"updated_at"`
+
+	// Digest delivery: non-critical notifications are batched over this
+	// window (e.g. 60 for hourly, 1440 for daily) and sent as one summary.
+	// Zero delivers every notification immediately.
+	DigestWindowMinutes int `json:"digest_window_minutes"`
+
+	// Health: the result of the last periodic check of the channel, kept
+	// up to date by CheckChannels
+	HealthStatus    string     `json:"health_status,omitempty" gorm:"size:20"` // "healthy", "unhealthy"
+	HealthError     string     `json:"health_error,omitempty"`
+	HealthCheckedAt *time.Time `json:"health_checked_at,omitempty"`
+	UnhealthySince  *time.Time `json:"unhealthy_since,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // EmailConfig represents email notification configuration
@@ -93,11 +109,24 @@ type NotificationHistory struct {
 	Subject             string          `json:"subject"`
 	Message             string          `json:"message"`
 	AlertLevel          string          `json:"alert_level"`
+	Category            string          `json:"category,omitempty"`
 	AffectedDevices     []uint          `json:"affected_devices" gorm:"-"`
 	AffectedDevicesJSON json.RawMessage `json:"-" gorm:"column:affected_devices;type:text"`
 
+	// Digest: queued notifications point at the digest that delivered them
+	DigestID *uint         `json:"digest_id,omitempty" gorm:"index"`
+	Digest   []DigestGroup `json:"digest,omitempty" gorm:"-"`
+
+	// Alert lifecycle: open until acknowledged, resolved when the condition
+	// clears or by hand. Digests and test notifications carry no state.
+	AlertState     string     `json:"alert_state,omitempty" gorm:"size:20;index"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	ResolvedBy     string     `json:"resolved_by,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+
 	// Delivery
-	Status      string     `json:"status"` // "pending", "sent", "failed", "retry"
+	Status      string     `json:"status"` // "pending", "queued", "sent", "failed", "retry"
 	SentAt      *time.Time `json:"sent_at,omitempty"`
 	Error       string     `json:"error,omitempty"`
 	RetryCount  int        `json:"retry_count" gorm:"default:0"`
@@ -107,6 +136,15 @@ type NotificationHistory struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// DigestGroup summarizes the notifications of one category and device in a
+// digest
+type DigestGroup struct {
+	Category string   `json:"category"`
+	DeviceID *uint    `json:"device_id,omitempty"`
+	Count    int      `json:"count"`
+	Subjects []string `json:"subjects"`
+}
+
 // AlertLevel represents notification severity levels
 type AlertLevel string
 
@@ -116,6 +154,13 @@ const (
 	AlertLevelInfo     AlertLevel = "info"
 )
 
+// Alert states of a notification
+const (
+	AlertStateOpen         = "open"
+	AlertStateAcknowledged = "acknowledged"
+	AlertStateResolved     = "resolved"
+)
+
 // NotificationTemplate represents message templates
 type NotificationTemplate struct {
 	ID            uint            `json:"id" gorm:"primaryKey"`
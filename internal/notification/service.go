@@ -16,6 +16,7 @@ import (
 
 	"gorm.io/gorm"
 
+	"github.com/ginsys/shelly-manager/internal/clock"
 	"github.com/ginsys/shelly-manager/internal/logging"
 )
 
@@ -27,6 +28,22 @@ type Service struct {
 	rateLimitMu sync.RWMutex
 	httpClient  *http.Client
 
+	// leader reports whether this instance sends digests; nil always does
+	leader func() bool
+
+	// inMaintenance reports whether a device is under planned maintenance;
+	// events for such a device are not sent. nil sends every event.
+	inMaintenance func(deviceID uint) bool
+
+	// clock drives the digest and health check loops, rate limits, quiet
+	// hours and history timestamps
+	clock clock.Clock
+
+	// Digest channels whose last delivery failed wait before the next
+	// attempt, by channel ID
+	digestMu    sync.Mutex
+	digestRetry map[uint]digestBackoff
+
 	// Configuration
 	emailConfig EmailSMTPConfig
 }
@@ -47,6 +64,8 @@ func NewService(db *gorm.DB, logger *logging.Logger, emailConfig EmailSMTPConfig
 		db:          db,
 		logger:      logger,
 		rateLimits:  make(map[uint]*RateLimitState),
+		digestRetry: make(map[uint]digestBackoff),
+		clock:       clock.Real,
 		emailConfig: emailConfig,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
@@ -54,6 +73,12 @@ func NewService(db *gorm.DB, logger *logging.Logger, emailConfig EmailSMTPConfig
 	}
 }
 
+// SetClock replaces the clock driving the digest and health check loops,
+// rate limits, quiet hours and history timestamps; tests inject a fake clock
+func (s *Service) SetClock(c clock.Clock) {
+	s.clock = clock.OrReal(c)
+}
+
 // CreateChannel creates a new notification channel
 func (s *Service) CreateChannel(channel *NotificationChannel) error {
 	if err := s.validateChannelConfig(channel); err != nil {
@@ -89,7 +114,9 @@ func (s *Service) UpdateChannel(channelID uint, updates *NotificationChannel) er
 		return fmt.Errorf("invalid channel configuration: %w", err)
 	}
 
-	result := s.db.Model(&NotificationChannel{}).Where("id = ?", channelID).Updates(updates)
+	// Health fields belong to the checks, not to the caller
+	result := s.db.Model(&NotificationChannel{}).Where("id = ?", channelID).
+		Omit("health_status", "health_error", "health_checked_at", "unhealthy_since").Updates(updates)
 	if result.Error != nil {
 		return fmt.Errorf("failed to update notification channel: %w", result.Error)
 	}
@@ -200,7 +227,14 @@ func (s *Service) GetRules() ([]NotificationRule, error) {
 	return rules, nil
 }
 
-// SendNotification processes a notification event and sends to matching rules
+// SetMaintenanceFunc sets the check that suppresses the events of devices
+// under planned maintenance
+func (s *Service) SetMaintenanceFunc(inMaintenance func(deviceID uint) bool) {
+	s.inMaintenance = inMaintenance
+}
+
+// SendNotification processes a notification event and sends to matching
+// rules. Events of a device in maintenance are dropped.
 func (s *Service) SendNotification(ctx context.Context, event *NotificationEvent) error {
 	s.logger.WithFields(map[string]any{
 		"event_type":  event.Type,
@@ -210,6 +244,15 @@ func (s *Service) SendNotification(ctx context.Context, event *NotificationEvent
 		"component":   "notification",
 	}).Info("Processing notification event")
 
+	if event.DeviceID != nil && s.inMaintenance != nil && s.inMaintenance(*event.DeviceID) {
+		s.logger.WithFields(map[string]any{
+			"event_type": event.Type,
+			"device_id":  *event.DeviceID,
+			"component":  "notification",
+		}).Info("Notification suppressed: device in maintenance")
+		return nil
+	}
+
 	// Get all enabled rules
 	rules, err := s.getMatchingRules(event)
 	if err != nil {
@@ -256,7 +299,7 @@ func (s *Service) TestChannel(ctx context.Context, channelID uint) error {
 		AlertLevel: AlertLevelInfo,
 		Title:      "Test Notification",
 		Message:    fmt.Sprintf("This is a test notification from channel '%s'", channel.Name),
-		Timestamp:  time.Now(),
+		Timestamp:  s.clock.Now(),
 	}
 
 	// Create temporary history record
@@ -267,7 +310,7 @@ func (s *Service) TestChannel(ctx context.Context, channelID uint) error {
 		Message:     testEvent.Message,
 		AlertLevel:  string(testEvent.AlertLevel),
 		Status:      "pending",
-		CreatedAt:   time.Now(),
+		CreatedAt:   s.clock.Now(),
 	}
 
 	return s.deliverNotification(ctx, &channel, history)
@@ -275,6 +318,10 @@ func (s *Service) TestChannel(ctx context.Context, channelID uint) error {
 
 // validateChannelConfig validates channel configuration
 func (s *Service) validateChannelConfig(channel *NotificationChannel) error {
+	if channel.DigestWindowMinutes < 0 {
+		return fmt.Errorf("digest window must not be negative")
+	}
+
 	switch channel.Type {
 	case "email":
 		var config EmailConfig
@@ -390,7 +437,7 @@ func (s *Service) isRateLimitedFor(rule *NotificationRule) bool {
 		return false
 	}
 
-	now := time.Now()
+	now := s.clock.Now()
 
 	// Enforce min interval (in minutes) if set
 	if rule.MinIntervalMinutes > 0 && !state.LastSentAt.IsZero() {
@@ -420,28 +467,23 @@ func (s *Service) isRateLimitedFor(rule *NotificationRule) bool {
 
 // meetsMinSeverity compares event severity to rule minimum
 func (s *Service) meetsMinSeverity(minSeverity, eventSeverity string) bool {
-	rank := func(level string) int {
-		switch strings.ToLower(level) {
-		case "info":
-			return 1
-		case "warning":
-			return 2
-		case "critical":
-			return 3
-		default:
-			return 0
-		}
-	}
-	return rank(eventSeverity) >= rank(minSeverity)
+	return alertRank(eventSeverity) >= alertRank(minSeverity)
 }
 
-// GetHistory retrieves notification history with optional filters and pagination
-func (s *Service) GetHistory(channelID *uint, status string, limit, offset int) ([]NotificationHistory, int64, error) {
+// GetHistory retrieves notification history with optional filters and pagination.
+// state is an alert state, "active" for open and acknowledged alerts or
+// "historical" for everything else.
+func (s *Service) GetHistory(channelID *uint, status, state string, limit, offset int) ([]NotificationHistory, int64, error) {
 	var (
 		records []NotificationHistory
 		total   int64
 	)
 
+	stateFilter, err := alertStateFilter(state)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	q := s.db.Model(&NotificationHistory{})
 	// Count total with filters
 	if channelID != nil {
@@ -450,6 +492,7 @@ func (s *Service) GetHistory(channelID *uint, status string, limit, offset int)
 	if status != "" {
 		q = q.Where("status = ?", status)
 	}
+	q = stateFilter(q)
 	if err := q.Count(&total).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to count history: %w", err)
 	}
@@ -462,6 +505,7 @@ func (s *Service) GetHistory(channelID *uint, status string, limit, offset int)
 	if status != "" {
 		q2 = q2.Where("status = ?", status)
 	}
+	q2 = stateFilter(q2)
 	if limit > 0 {
 		q2 = q2.Limit(limit)
 	}
@@ -485,7 +529,7 @@ func (s *Service) GetHistory(channelID *uint, status string, limit, offset int)
 
 // isInSchedule checks if current time is within rule schedule
 func (s *Service) isInSchedule(rule *NotificationRule) bool {
-	now := time.Now()
+	now := s.clock.Now()
 
 	// Check day of week
 	if len(rule.ScheduleDaysJSON) > 0 {
@@ -561,18 +605,33 @@ func (s *Service) sendNotificationForRule(ctx context.Context, event *Notificati
 		Subject:     event.Title,
 		Message:     event.Message,
 		AlertLevel:  string(event.AlertLevel),
+		Category:    event.Type,
+		AlertState:  AlertStateOpen,
 		Status:      "pending",
-		CreatedAt:   time.Now(),
+		CreatedAt:   s.clock.Now(),
+	}
+	if len(event.Categories) > 0 {
+		history.Category = event.Categories[0]
 	}
 
 	if affectedJSON, err := json.Marshal(event.AffectedDevices); err == nil {
 		history.AffectedDevicesJSON = affectedJSON
 	}
 
+	// Channels in digest mode collect everything but critical events for the
+	// next summary
+	digest := rule.Channel.DigestWindowMinutes > 0 && event.AlertLevel != AlertLevelCritical
+	if digest {
+		history.Status = "queued"
+	}
+
 	// Save to database
 	if err := s.db.Create(history).Error; err != nil {
 		return fmt.Errorf("failed to create notification history: %w", err)
 	}
+	if digest {
+		return nil
+	}
 
 	// Deliver notification
 	if err := s.deliverNotification(ctx, &rule.Channel, history); err != nil {
@@ -588,7 +647,7 @@ func (s *Service) sendNotificationForRule(ctx context.Context, event *Notificati
 	s.updateRateLimit(rule.ID)
 
 	// Update status to sent
-	now := time.Now()
+	now := s.clock.Now()
 	s.db.Model(history).Updates(map[string]interface{}{
 		"status":  "sent",
 		"sent_at": &now,
@@ -680,6 +739,9 @@ func (s *Service) sendWebhook(ctx context.Context, channel *NotificationChannel,
 	if history.DeviceID != nil {
 		payload["device_id"] = *history.DeviceID
 	}
+	if len(history.Digest) > 0 {
+		payload["digest"] = history.Digest
+	}
 
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
@@ -830,7 +892,7 @@ func (s *Service) updateRateLimit(ruleID uint) {
 	s.rateLimitMu.Lock()
 	defer s.rateLimitMu.Unlock()
 
-	now := time.Now()
+	now := s.clock.Now()
 
 	state, exists := s.rateLimits[ruleID]
 	if !exists {
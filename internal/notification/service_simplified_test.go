@@ -350,6 +350,35 @@ func TestNotificationService_MinSeverityEnforcement(t *testing.T) {
 	assert.Equal(t, int64(1), total)
 }
 
+func TestNotificationService_MaintenanceSuppression(t *testing.T) {
+	service, db, cleanup := setupSimpleTestService(t)
+	defer cleanup()
+	service.httpClient = fakeHTTPClient(200)
+
+	cfg, _ := json.Marshal(WebhookConfig{URL: "https://example.com/webhook"})
+	ch := &NotificationChannel{Name: "Maintenance", Type: "webhook", Enabled: true, Config: cfg}
+	require.NoError(t, service.CreateChannel(ch))
+	rule := &NotificationRule{Name: "All", Enabled: true, ChannelID: ch.ID, AlertLevel: "all", MaxPerHour: 100}
+	require.NoError(t, service.CreateRule(rule))
+	service.SetMaintenanceFunc(func(deviceID uint) bool { return deviceID == 1 })
+
+	inMaintenance, other := uint(1), uint(2)
+	for _, id := range []*uint{&inMaintenance, &other, nil} {
+		evt := &NotificationEvent{Type: "drift_detected", AlertLevel: AlertLevelWarning, DeviceID: id, Title: "t", Message: "m", Timestamp: time.Now()}
+		require.NoError(t, service.SendNotification(context.Background(), evt))
+	}
+
+	// Only the device in maintenance is held back
+	var history []NotificationHistory
+	require.NoError(t, db.Where("rule_id = ?", rule.ID).Find(&history).Error)
+	require.Len(t, history, 2)
+	for _, h := range history {
+		if h.DeviceID != nil {
+			assert.Equal(t, other, *h.DeviceID)
+		}
+	}
+}
+
 func TestNotificationService_GetHistoryFiltersAndPagination(t *testing.T) {
 	service, _, cleanup := setupSimpleTestService(t)
 	defer cleanup()
@@ -375,13 +404,13 @@ func TestNotificationService_GetHistoryFiltersAndPagination(t *testing.T) {
 	_ = service.SendNotification(context.Background(), evt)
 
 	// List only sent, limit 2, offset 0
-	recs, total, err := service.GetHistory(&ch.ID, "sent", 2, 0)
+	recs, total, err := service.GetHistory(&ch.ID, "sent", "", 2, 0)
 	require.NoError(t, err)
 	assert.Equal(t, int64(3), total)
 	assert.Len(t, recs, 2)
 
 	// Next page
-	recs2, total2, err := service.GetHistory(&ch.ID, "sent", 2, 2)
+	recs2, total2, err := service.GetHistory(&ch.ID, "sent", "", 2, 2)
 	require.NoError(t, err)
 	assert.Equal(t, int64(3), total2)
 	assert.Len(t, recs2, 1)
@@ -55,6 +55,25 @@ func (d *DHCPManager) GetReservations(ctx context.Context, interfaceName string)
 	return reservations, nil
 }
 
+// GetLeases retrieves the DHCPv4 lease table, including dynamic leases
+func (d *DHCPManager) GetLeases(ctx context.Context) ([]DHCPLease, error) {
+	d.client.logger.Debug("Fetching DHCP leases")
+
+	queryParams := map[string]string{"current": "1", "rowCount": "-1"}
+	responseBody, err := d.client.makeRequestWithQuery(ctx, "GET", "/api/dhcpv4/leases/searchLease", queryParams, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch DHCP leases: %w", err)
+	}
+
+	var response DHCPLeaseList
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse DHCP leases response: %w", err)
+	}
+
+	d.client.logger.Info("Retrieved DHCP leases", "count", len(response.Rows))
+	return response.Rows, nil
+}
+
 // GetReservation retrieves a specific DHCP reservation by UUID
 func (d *DHCPManager) GetReservation(ctx context.Context, uuid string) (*DHCPReservation, error) {
 	d.client.logger.Debug("Fetching DHCP reservation", "uuid", uuid)
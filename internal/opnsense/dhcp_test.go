@@ -143,6 +143,32 @@ func TestDHCPManager_GetReservations(t *testing.T) {
 	})
 }
 
+func TestDHCPManager_GetLeases(t *testing.T) {
+	dhcpManager, cleanup := setupDHCPTestService(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "/api/dhcpv4/leases/searchLease", r.URL.Path)
+		assert.Equal(t, "-1", r.URL.Query().Get("rowCount"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"total":2,"rowCount":2,"current":1,"rows":[
+			{"address":"192.168.1.50","mac":"e8:db:84:aa:bb:cc","hostname":"shelly1-AABBCC","state":"active","type":"dynamic","ends":"2024/05/01 12:00:00","if":"lan"},
+			{"address":"192.168.1.51","mac":"11:22:33:44:55:66","hostname":"laptop","state":"expired","type":"dynamic","if":"lan"}]}`))
+	}))
+	defer server.Close()
+	dhcpManager.client.baseURL = server.URL
+
+	leases, err := dhcpManager.GetLeases(context.Background())
+	require.NoError(t, err)
+	require.Len(t, leases, 2)
+	assert.Equal(t, "192.168.1.50", leases[0].Address)
+	assert.Equal(t, "shelly1-AABBCC", leases[0].Hostname)
+	assert.Equal(t, "lan", leases[0].Interface)
+	assert.Equal(t, "expired", leases[1].State)
+}
+
 func TestDHCPManager_GetReservation(t *testing.T) {
 	dhcpManager, cleanup := setupDHCPTestService(t)
 	defer cleanup()
@@ -42,6 +42,23 @@ type DHCPReservationList struct {
 	Reservations map[string]DHCPReservation `json:"reservations"`
 }
 
+// DHCPLease represents an entry of the DHCPv4 lease table
+type DHCPLease struct {
+	Address   string `json:"address"`
+	MAC       string `json:"mac"`
+	Hostname  string `json:"hostname"`
+	State     string `json:"state"` // active, expired, ...
+	Type      string `json:"type"`  // dynamic or static
+	Ends      string `json:"ends"`  // local time, e.g. "2024/05/01 12:00:00"
+	Interface string `json:"if"`
+}
+
+// DHCPLeaseList represents the lease search response
+type DHCPLeaseList struct {
+	Total int         `json:"total"`
+	Rows  []DHCPLease `json:"rows"`
+}
+
 // FirewallAlias represents a firewall alias
 type FirewallAlias struct {
 	UUID        string   `json:"uuid,omitempty"`
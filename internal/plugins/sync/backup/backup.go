@@ -353,7 +353,7 @@ func (b *BackupPlugin) Import(ctx context.Context, source sync.ImportSource, con
 // Capabilities returns plugin capabilities
 func (b *BackupPlugin) Capabilities() sync.PluginCapabilities {
 	return sync.PluginCapabilities{
-		SupportsIncremental:    true,
+		SupportsIncremental:    false, // every backup is a full database copy
 		RequiresAuthentication: false,
 		SupportedOutputs:       []string{"file"},
 		MaxDataSize:            1024 * 1024 * 1024 * 10, // 10GB
@@ -385,8 +385,8 @@ func TestBackupExporter_Capabilities(t *testing.T) {
 
 	caps := exporter.Capabilities()
 
-	if !caps.SupportsIncremental {
-		t.Error("Backup should support incremental backups")
+	if caps.SupportsIncremental {
+		t.Error("Backup writes full database copies and should not claim incremental exports")
 	}
 
 	if caps.RequiresAuthentication {
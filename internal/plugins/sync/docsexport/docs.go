@@ -0,0 +1,691 @@
+package docsexport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security"
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+// Defaults used when the plugin configuration does not specify a value
+const (
+	DefaultOutputPath = "./data/exports"
+	DefaultTitle      = "Shelly device inventory"
+	DefaultGroupBy    = "site"
+	DefaultDirName    = "inventory-docs"
+)
+
+// Formats the documentation can be rendered in
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// Options controls what the documentation contains
+type Options struct {
+	Title string
+	// GroupBy selects the page a device is listed on: "site" or "room"
+	// (from site:<name> / room:<name> tags), "group" (the group device
+	// setting) or "model"
+	GroupBy string
+	// IncludeConfig adds a summary of each device's stored configuration
+	IncludeConfig bool
+	// IncludeSnapshots captures the live status of online devices during
+	// the export, SnapshotInterval apart
+	IncludeSnapshots bool
+	SnapshotInterval time.Duration
+	// Snapshots are the captured device states shown on the group pages
+	Snapshots map[uint]*Snapshot
+}
+
+// Page is one page of the generated documentation
+type Page struct {
+	Name   string // file name without extension
+	Title  string
+	Blocks []Block
+}
+
+// Block is a section of a page: an optional heading followed by text, links
+// to other pages, an image, attached files and/or a table
+type Block struct {
+	Heading string
+	Text    string
+	Links   []Link
+	Image   string   // path of an image relative to the pages
+	Files   []string // paths of attached files relative to the pages
+	Table   *Table
+}
+
+// Link points to another page of the documentation
+type Link struct {
+	Text string
+	Page string
+}
+
+// Table is a simple table of text cells
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// configSummary lists the configuration values shown per device, each with
+// the Gen2 path first and the Gen1 path second. Credentials are never shown.
+var configSummary = []struct {
+	label string
+	paths []string
+}{
+	{"Wi-Fi SSID", []string{"wifi.sta.ssid", "wifi_sta.ssid"}},
+	{"Static IP", []string{"wifi.sta.ip", "wifi_sta.ip"}},
+	{"MQTT", []string{"mqtt.enable"}},
+	{"MQTT server", []string{"mqtt.server"}},
+	{"Cloud", []string{"cloud.enable", "cloud.enabled"}},
+	{"NTP server", []string{"sys.sntp.server", "sntp.server"}},
+	{"Timezone", []string{"sys.location.tz", "timezone"}},
+}
+
+// Plugin renders the inventory as Markdown or HTML documentation
+type Plugin struct {
+	logger    *logging.Logger
+	baseDir   string         // Base directory for path validation
+	snapshots SnapshotSource // Captures device state for include_snapshots
+}
+
+func NewPlugin() sync.SyncPlugin { return &Plugin{} }
+
+func (p *Plugin) Info() sync.PluginInfo {
+	return sync.PluginInfo{
+		Name:        "inventory-docs",
+		Version:     "1.0.0",
+		Description: "Render the device inventory, groups, templates and network plan as Markdown or HTML pages",
+		Author:      "Shelly Manager Team",
+		License:     "MIT",
+		SupportedFormats: []string{
+			FormatMarkdown,
+			FormatHTML,
+		},
+		Tags:     []string{"documentation", "markdown", "html", "export"},
+		Category: sync.CategoryCustom,
+	}
+}
+
+func (p *Plugin) ConfigSchema() sync.ConfigSchema {
+	return sync.ConfigSchema{
+		Version: "1.0",
+		Properties: map[string]sync.PropertySchema{
+			"output_path":          {Type: "string", Description: "Directory for the generated documentation", Default: DefaultOutputPath},
+			"format":               {Type: "string", Description: "Page format", Default: FormatMarkdown, Enum: []interface{}{FormatMarkdown, FormatHTML}},
+			"title":                {Type: "string", Description: "Title of the index page", Default: DefaultTitle},
+			"group_by":             {Type: "string", Description: "One page per site or room tag, group setting or model", Default: DefaultGroupBy, Enum: []interface{}{"site", "room", "group", "model"}},
+			"include_config":       {Type: "boolean", Description: "Summarize each device's stored configuration", Default: true},
+			"archive":              {Type: "boolean", Description: "Write a ZIP archive; otherwise write the pages into dir_name, e.g. a wiki checkout", Default: true},
+			"dir_name":             {Type: "string", Description: "Directory under output_path for the pages when archive is off", Default: DefaultDirName},
+			"include_snapshots":    {Type: "boolean", Description: "Capture the live status, and camera or display images, of online devices into the documentation", Default: false},
+			"snapshot_interval_ms": {Type: "number", Description: "Pause between two device snapshots in milliseconds", Default: int(DefaultSnapshotInterval / time.Millisecond)},
+		},
+		Required: []string{},
+	}
+}
+
+func (p *Plugin) ValidateConfig(config map[string]interface{}) error {
+	if v, ok := config["output_path"].(string); ok && v != "" && p.baseDir != "" {
+		if _, err := security.ValidatePath(p.baseDir, v); err != nil {
+			return fmt.Errorf("invalid output_path: %w", err)
+		}
+	}
+	if v, ok := config["format"].(string); ok && v != "" && v != FormatMarkdown && v != FormatHTML {
+		return fmt.Errorf("invalid format: %q", v)
+	}
+	if v, ok := config["group_by"].(string); ok && v != "" {
+		switch v {
+		case "site", "room", "group", "model":
+		default:
+			return fmt.Errorf("invalid group_by: %q", v)
+		}
+	}
+	if v, ok := config["dir_name"].(string); ok && v != "" && security.SanitizeFilename(v) != v {
+		return fmt.Errorf("invalid dir_name: %q", v)
+	}
+	if v, ok := config["snapshot_interval_ms"].(float64); ok && v < 0 {
+		return fmt.Errorf("snapshot_interval_ms must not be negative")
+	}
+	return nil
+}
+
+// SetBaseDir sets the base directory for path validation
+func (p *Plugin) SetBaseDir(baseDir string) {
+	p.baseDir = baseDir
+}
+
+// OptionsFromConfig builds Options from a plugin configuration map
+func OptionsFromConfig(config map[string]interface{}) Options {
+	opts := Options{Title: DefaultTitle, GroupBy: DefaultGroupBy, IncludeConfig: true}
+	if v, ok := config["title"].(string); ok && v != "" {
+		opts.Title = v
+	}
+	if v, ok := config["group_by"].(string); ok && v != "" {
+		opts.GroupBy = v
+	}
+	if v, ok := config["include_config"].(bool); ok {
+		opts.IncludeConfig = v
+	}
+	if v, ok := config["include_snapshots"].(bool); ok {
+		opts.IncludeSnapshots = v
+	}
+	opts.SnapshotInterval = DefaultSnapshotInterval
+	switch v := config["snapshot_interval_ms"].(type) {
+	case float64:
+		opts.SnapshotInterval = time.Duration(v) * time.Millisecond
+	case int:
+		opts.SnapshotInterval = time.Duration(v) * time.Millisecond
+	}
+	return opts
+}
+
+// exportFormat returns the requested page format
+func exportFormat(config sync.ExportConfig) string {
+	if v, ok := config.Config["format"].(string); ok && v != "" {
+		return v
+	}
+	if config.Format == FormatHTML {
+		return FormatHTML
+	}
+	return FormatMarkdown
+}
+
+// BuildPages lays out the documentation: an index, one page per group, the
+// network plan and the configuration templates
+func BuildPages(data *sync.ExportData, opts Options) []Page {
+	devices := append([]sync.DeviceData(nil), data.Devices...)
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Name != devices[j].Name {
+			return devices[i].Name < devices[j].Name
+		}
+		return devices[i].ID < devices[j].ID
+	})
+	configs := make(map[uint]sync.ConfigurationData, len(data.Configurations))
+	for _, c := range data.Configurations {
+		configs[c.DeviceID] = c
+	}
+	templates := make(map[uint]string, len(data.Templates))
+	for _, t := range data.Templates {
+		templates[t.ID] = t.Name
+	}
+
+	// Group devices; the ungrouped page comes last
+	byGroup := map[string][]sync.DeviceData{}
+	for _, d := range devices {
+		key := groupOf(d, opts.GroupBy)
+		byGroup[key] = append(byGroup[key], d)
+	}
+	groupNames := make([]string, 0, len(byGroup))
+	for name := range byGroup {
+		if name != "" {
+			groupNames = append(groupNames, name)
+		}
+	}
+	sort.Strings(groupNames)
+	if _, ok := byGroup[""]; ok {
+		groupNames = append(groupNames, "")
+	}
+
+	index := Page{Name: "index", Title: opts.Title}
+	index.Blocks = append(index.Blocks, Block{Text: fmt.Sprintf("Generated %s from %d devices and %d configuration templates.",
+		data.Timestamp.UTC().Format("2006-01-02 15:04 MST"), len(devices), len(data.Templates))})
+
+	pages := []Page{}
+	used := map[string]bool{"index": true, "network": true, "templates": true}
+	groupLinks := []Link{}
+	overview := &Table{Header: []string{groupLabel(opts.GroupBy), "Devices", "Online"}}
+	pageOf := map[string]string{}
+	for _, name := range groupNames {
+		members := byGroup[name]
+		title := name
+		if name == "" {
+			title = "Ungrouped devices"
+		}
+		pageName := uniquePageName(opts.GroupBy+"-"+slug(name), name == "", used)
+		pageOf[name] = pageName
+		pages = append(pages, groupPage(pageName, title, opts, members, configs, templates))
+
+		online := 0
+		for _, d := range members {
+			if d.Status == "online" {
+				online++
+			}
+		}
+		groupLinks = append(groupLinks, Link{Text: fmt.Sprintf("%s (%d devices)", title, len(members)), Page: pageName})
+		overview.Rows = append(overview.Rows, []string{title, strconv.Itoa(len(members)), strconv.Itoa(online)})
+	}
+	index.Blocks = append(index.Blocks,
+		Block{Heading: groupLabel(opts.GroupBy) + "s", Links: groupLinks, Table: overview},
+		Block{Heading: "Reference", Links: []Link{
+			{Text: "Network plan", Page: "network"},
+			{Text: "Configuration templates", Page: "templates"},
+		}},
+	)
+
+	result := []Page{index}
+	result = append(result, pages...)
+	result = append(result, networkPage(devices, opts, configs), templatesPage(data.Templates))
+	return result
+}
+
+// groupPage lists the devices of one group with their configuration
+func groupPage(name, title string, opts Options, devices []sync.DeviceData, configs map[uint]sync.ConfigurationData, templates map[uint]string) Page {
+	page := Page{Name: name, Title: title}
+	table := &Table{Header: []string{"Name", "Model", "Gen", "IP", "MAC", "Firmware", "Status", "Tags"}}
+	for _, d := range devices {
+		gen := ""
+		if g := settingInt(d.Settings, "gen"); g > 0 {
+			gen = strconv.Itoa(g)
+		}
+		table.Rows = append(table.Rows, []string{deviceName(d), d.Model, gen, d.IP, d.MAC, d.Firmware, d.Status, strings.Join(d.Tags, ", ")})
+	}
+	page.Blocks = append(page.Blocks, Block{Heading: "Devices", Table: table})
+
+	if opts.IncludeConfig {
+		page.Blocks = append(page.Blocks, configBlocks(devices, configs, templates)...)
+	}
+	if opts.Snapshots != nil {
+		for _, d := range devices {
+			page.Blocks = append(page.Blocks, snapshotBlock(d, opts.Snapshots[d.ID]))
+		}
+	}
+	return page
+}
+
+// configBlocks summarize the stored configuration of the devices
+func configBlocks(devices []sync.DeviceData, configs map[uint]sync.ConfigurationData, templates map[uint]string) []Block {
+	var blocks []Block
+	for _, d := range devices {
+		c, ok := configs[d.ID]
+		if !ok {
+			continue
+		}
+		rows := [][]string{}
+		if c.TemplateID != nil {
+			if t, ok := templates[*c.TemplateID]; ok {
+				rows = append(rows, []string{"Template", t})
+			}
+		}
+		rows = append(rows, []string{"Sync status", c.SyncStatus})
+		for _, item := range configSummary {
+			for _, path := range item.paths {
+				if v, ok := lookup(c.Config, path); ok {
+					rows = append(rows, []string{item.label, formatValue(v)})
+					break
+				}
+			}
+		}
+		blocks = append(blocks, Block{
+			Heading: deviceName(d),
+			Table:   &Table{Header: []string{"Setting", "Value"}, Rows: rows},
+		})
+	}
+	return blocks
+}
+
+// networkPage lists devices by address, with a count per /24 subnet
+func networkPage(devices []sync.DeviceData, opts Options, configs map[uint]sync.ConfigurationData) Page {
+	sorted := append([]sync.DeviceData(nil), devices...)
+	sort.SliceStable(sorted, func(i, j int) bool { return ipLess(sorted[i].IP, sorted[j].IP) })
+
+	addresses := &Table{Header: []string{"IP", "Name", "MAC", groupLabel(opts.GroupBy), "Wi-Fi SSID", "Status"}}
+	subnets := map[string]int{}
+	subnetOrder := []string{}
+	for _, d := range sorted {
+		ssid := ""
+		if c, ok := configs[d.ID]; ok {
+			for _, path := range configSummary[0].paths {
+				if v, ok := lookup(c.Config, path); ok {
+					ssid = formatValue(v)
+					break
+				}
+			}
+		}
+		addresses.Rows = append(addresses.Rows, []string{d.IP, deviceName(d), d.MAC, groupOf(d, opts.GroupBy), ssid, d.Status})
+		if ip := net.ParseIP(d.IP).To4(); ip != nil {
+			subnet := fmt.Sprintf("%d.%d.%d.0/24", ip[0], ip[1], ip[2])
+			if subnets[subnet] == 0 {
+				subnetOrder = append(subnetOrder, subnet)
+			}
+			subnets[subnet]++
+		}
+	}
+	subnetTable := &Table{Header: []string{"Subnet", "Devices"}}
+	for _, subnet := range subnetOrder {
+		subnetTable.Rows = append(subnetTable.Rows, []string{subnet, strconv.Itoa(subnets[subnet])})
+	}
+
+	return Page{Name: "network", Title: "Network plan", Blocks: []Block{
+		{Text: "Addresses as recorded in the inventory, in address order."},
+		{Heading: "Subnets", Table: subnetTable},
+		{Heading: "Addresses", Table: addresses},
+	}}
+}
+
+// templatesPage describes the configuration templates
+func templatesPage(templates []sync.TemplateData) Page {
+	page := Page{Name: "templates", Title: "Configuration templates"}
+	if len(templates) == 0 {
+		page.Blocks = append(page.Blocks, Block{Text: "No configuration templates."})
+		return page
+	}
+	sorted := append([]sync.TemplateData(nil), templates...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, t := range sorted {
+		gen := "any"
+		if t.Generation > 0 {
+			gen = strconv.Itoa(t.Generation)
+		}
+		deviceType := t.DeviceType
+		if deviceType == "" {
+			deviceType = "any"
+		}
+		page.Blocks = append(page.Blocks, Block{
+			Heading: t.Name,
+			Text:    t.Description,
+			Table: &Table{Header: []string{"Property", "Value"}, Rows: [][]string{
+				{"Device type", deviceType},
+				{"Generation", gen},
+				{"Default", formatValue(t.IsDefault)},
+				{"Settings", strings.Join(sortedKeys(t.Config), ", ")},
+				{"Variables", strings.Join(sortedKeys(t.Variables), ", ")},
+			}},
+		})
+	}
+	return page
+}
+
+// RenderPages renders the pages in format, keyed by file name
+func RenderPages(pages []Page, format, siteTitle string) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(pages))
+	for _, page := range pages {
+		var buf bytes.Buffer
+		var name string
+		switch format {
+		case FormatHTML:
+			if err := renderHTML(&buf, page, siteTitle); err != nil {
+				return nil, fmt.Errorf("failed to render %s: %w", page.Name, err)
+			}
+			name = page.Name + ".html"
+		default:
+			renderMarkdown(&buf, page)
+			name = page.Name + ".md"
+		}
+		files[name] = buf.Bytes()
+	}
+	return files, nil
+}
+
+func (p *Plugin) Export(ctx context.Context, data *sync.ExportData, config sync.ExportConfig) (*sync.ExportResult, error) {
+	start := time.Now()
+	outputPath, _ := config.Config["output_path"].(string)
+	if outputPath == "" {
+		outputPath = DefaultOutputPath
+	}
+	archive := true
+	if v, ok := config.Config["archive"].(bool); ok {
+		archive = v
+	}
+	dirName, _ := config.Config["dir_name"].(string)
+	if dirName == "" {
+		dirName = DefaultDirName
+	}
+	dirName = security.SanitizeFilename(dirName)
+
+	// Validate output path against base directory to prevent path traversal
+	if p.baseDir != "" {
+		validatedPath, err := security.ValidatePath(p.baseDir, outputPath)
+		if err != nil {
+			return nil, fmt.Errorf("path validation failed: %w", err)
+		}
+		outputPath = validatedPath
+	}
+	if err := os.MkdirAll(outputPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	format := exportFormat(config)
+	opts := OptionsFromConfig(config.Config)
+	if opts.IncludeSnapshots && p.snapshots != nil {
+		opts.Snapshots = CaptureSnapshots(ctx, p.snapshots, data.Devices, opts.SnapshotInterval)
+	}
+	pages := BuildPages(data, opts)
+	files, err := RenderPages(pages, format, opts.Title)
+	if err != nil {
+		return nil, err
+	}
+	for name, content := range snapshotFiles(data.Devices, opts.Snapshots) {
+		files[name] = content
+	}
+
+	var path string
+	var size int64
+	if archive {
+		ts := time.Now().Format("20060102-150405")
+		exportID := uuid.New().String()[:8]
+		path = filepath.Join(outputPath, fmt.Sprintf("shelly-docs-%s-%s.zip", ts, exportID))
+		if err := sync.WriteZip(path, files); err != nil {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil {
+			size = fi.Size()
+		}
+	} else {
+		// Pages are overwritten in place so the directory can be a wiki
+		// checkout; pages of groups that no longer exist are left alone
+		path = filepath.Join(outputPath, dirName)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create documentation directory: %w", err)
+		}
+		if len(opts.Snapshots) > 0 {
+			if err := os.MkdirAll(filepath.Join(path, snapshotDir), 0755); err != nil {
+				return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+			}
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(path, filepath.FromSlash(name)), content, 0644); err != nil {
+				return nil, fmt.Errorf("failed to write %s: %w", name, err)
+			}
+			size += int64(len(content))
+		}
+	}
+
+	result := &sync.ExportResult{
+		Success:     true,
+		OutputPath:  path,
+		RecordCount: len(data.Devices),
+		FileSize:    size,
+		Duration:    time.Since(start),
+		Metadata: map[string]interface{}{
+			"export_id": data.Metadata.ExportID,
+			"format":    format,
+			"pages":     len(pages),
+		},
+	}
+	if opts.Snapshots != nil {
+		result.Metadata["snapshots"] = len(opts.Snapshots)
+	}
+	if archive {
+		result.Checksum, _ = sync.FileSHA256(path)
+	}
+
+	if p.logger != nil {
+		p.logger.Info("Inventory documentation export completed", "path", path, "pages", len(pages), "format", format)
+	}
+	return result, nil
+}
+
+// Preview renders the pages without capturing device snapshots
+func (p *Plugin) Preview(ctx context.Context, data *sync.ExportData, config sync.ExportConfig) (*sync.PreviewResult, error) {
+	opts := OptionsFromConfig(config.Config)
+	pages := BuildPages(data, opts)
+	files, err := RenderPages(pages, exportFormat(config), opts.Title)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, content := range files {
+		size += int64(len(content))
+	}
+	index := files["index.md"]
+	if index == nil {
+		index = files["index.html"]
+	}
+	return &sync.PreviewResult{Success: true, SampleData: index, RecordCount: len(data.Devices), EstimatedSize: size}, nil
+}
+
+func (p *Plugin) Import(ctx context.Context, source sync.ImportSource, config sync.ImportConfig) (*sync.ImportResult, error) {
+	return nil, fmt.Errorf("inventory-docs import is not supported")
+}
+
+func (p *Plugin) Capabilities() sync.PluginCapabilities {
+	return sync.PluginCapabilities{
+		SupportedOutputs: []string{"file"},
+		MaxDataSize:      50 * 1024 * 1024,
+		ConcurrencyLevel: 1,
+	}
+}
+
+func (p *Plugin) Initialize(logger *logging.Logger) error { p.logger = logger; return nil }
+func (p *Plugin) Cleanup() error                          { return nil }
+
+// groupOf returns the group a device is documented under; empty when it
+// has none
+func groupOf(d sync.DeviceData, groupBy string) string {
+	switch groupBy {
+	case "site", "room":
+		prefix := groupBy + ":"
+		for _, tag := range d.Tags {
+			if strings.HasPrefix(tag, prefix) {
+				return strings.TrimPrefix(tag, prefix)
+			}
+		}
+	case "group":
+		group, _ := d.Settings["group"].(string)
+		return group
+	case "model":
+		return d.Model
+	}
+	return ""
+}
+
+func groupLabel(groupBy string) string {
+	switch groupBy {
+	case "room":
+		return "Room"
+	case "group":
+		return "Group"
+	case "model":
+		return "Model"
+	}
+	return "Site"
+}
+
+var slugUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+func slug(name string) string {
+	return strings.Trim(slugUnsafe.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// uniquePageName returns base, or base with a number appended if another
+// group already took it
+func uniquePageName(base string, ungrouped bool, used map[string]bool) string {
+	if ungrouped {
+		base = "ungrouped"
+	} else if strings.HasSuffix(base, "-") {
+		base += "unnamed"
+	}
+	name := base
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	used[name] = true
+	return name
+}
+
+func deviceName(d sync.DeviceData) string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return d.MAC
+}
+
+// lookup reads a dotted path from a configuration map
+func lookup(config map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = config
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	if current == nil || current == "" {
+		return nil, false
+	}
+	return current, true
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case bool:
+		if val {
+			return "yes"
+		}
+		return "no"
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ipLess orders addresses numerically; unparsable addresses go last
+func ipLess(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	switch {
+	case ipA == nil && ipB == nil:
+		return a < b
+	case ipA == nil:
+		return false
+	case ipB == nil:
+		return true
+	}
+	return bytes.Compare(ipA.To16(), ipB.To16()) < 0
+}
+
+// settingInt reads a numeric setting that may have been decoded as float64
+func settingInt(settings map[string]interface{}, key string) int {
+	switch n := settings[key].(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
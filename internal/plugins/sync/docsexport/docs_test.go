@@ -0,0 +1,225 @@
+package docsexport
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+func testData() *sync.ExportData {
+	templateID := uint(7)
+	return &sync.ExportData{
+		Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Devices: []sync.DeviceData{
+			{ID: 1, IP: "192.168.1.20", MAC: "AA:BB:CC:00:00:01", Name: "kitchen", Model: "SNSW-001X16EU", Status: "online",
+				Settings: map[string]interface{}{"gen": float64(2)}, Tags: []string{"site:Home", "room:kitchen"}},
+			{ID: 2, IP: "192.168.1.3", MAC: "AA:BB:CC:00:00:02", Name: "garage", Model: "SHSW-1", Status: "offline",
+				Settings: map[string]interface{}{"gen": float64(1)}, Tags: []string{"site:Home"}},
+			{ID: 3, IP: "10.0.0.5", MAC: "AA:BB:CC:00:00:03", Name: "pump | well", Model: "SHSW-1", Status: "online"},
+		},
+		Configurations: []sync.ConfigurationData{
+			{DeviceID: 1, TemplateID: &templateID, SyncStatus: "synced", Config: map[string]interface{}{
+				"wifi": map[string]interface{}{"sta": map[string]interface{}{"ssid": "IoT", "pass": "wifi-secret"}},
+				"sys":  map[string]interface{}{"location": map[string]interface{}{"tz": "Europe/Brussels"}},
+			}},
+			{DeviceID: 2, SyncStatus: "drift", Config: map[string]interface{}{
+				"wifi_sta": map[string]interface{}{"ssid": "Garage"},
+				"mqtt":     map[string]interface{}{"enable": true, "server": "10.0.0.2:1883", "pass": "mqtt-secret"},
+			}},
+		},
+		Templates: []sync.TemplateData{
+			{ID: 7, Name: "plus-defaults", Description: "Baseline for Plus devices", Generation: 2,
+				Config: map[string]interface{}{"wifi": nil, "sys": nil}},
+		},
+	}
+}
+
+func TestBuildPages(t *testing.T) {
+	pages := BuildPages(testData(), Options{Title: DefaultTitle, GroupBy: "site", IncludeConfig: true})
+
+	names := []string{}
+	for _, p := range pages {
+		names = append(names, p.Name)
+	}
+	if strings.Join(names, ",") != "index,site-home,ungrouped,network,templates" {
+		t.Fatalf("Unexpected pages: %v", names)
+	}
+
+	home := pages[1]
+	if home.Title != "Home" || len(home.Blocks[0].Table.Rows) != 2 {
+		t.Fatalf("Expected both Home devices on the site page, got %+v", home)
+	}
+	// Config summaries: the device with a template shows it; secrets are left out
+	files, err := RenderPages(pages, FormatMarkdown, DefaultTitle)
+	if err != nil {
+		t.Fatalf("RenderPages failed: %v", err)
+	}
+	md := string(files["site-home.md"])
+	for _, want := range []string{"| Template | plus-defaults |", "| Wi-Fi SSID | IoT |", "| Wi-Fi SSID | Garage |",
+		"| MQTT server | 10.0.0.2:1883 |", "| Timezone | Europe/Brussels |", "[← Index](index.md)"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Expected %q in site page:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "secret") {
+		t.Errorf("Site page must not contain credentials:\n%s", md)
+	}
+	if !strings.Contains(string(files["ungrouped.md"]), `pump \| well`) {
+		t.Errorf("Expected pipes in cells to be escaped:\n%s", files["ungrouped.md"])
+	}
+	if !strings.Contains(string(files["index.md"]), "- [Home (2 devices)](site-home.md)") {
+		t.Errorf("Expected the index to link the site page:\n%s", files["index.md"])
+	}
+
+	// The network plan is in numeric address order
+	network := pages[3].Blocks[2].Table.Rows
+	if network[0][0] != "10.0.0.5" || network[1][0] != "192.168.1.3" || network[2][0] != "192.168.1.20" {
+		t.Errorf("Unexpected address order: %v", network)
+	}
+	if subnets := pages[3].Blocks[1].Table.Rows; len(subnets) != 2 || subnets[1][0] != "192.168.1.0/24" || subnets[1][1] != "2" {
+		t.Errorf("Unexpected subnets: %v", subnets)
+	}
+}
+
+func TestBuildPages_GroupByRoom(t *testing.T) {
+	pages := BuildPages(testData(), Options{Title: "Rooms", GroupBy: "room"})
+	if pages[1].Name != "room-kitchen" || pages[2].Name != "ungrouped" || len(pages[2].Blocks[0].Table.Rows) != 2 {
+		t.Errorf("Unexpected room pages: %+v", pages[1:3])
+	}
+	if len(pages[1].Blocks) != 1 {
+		t.Errorf("Expected no config summaries without include_config, got %d blocks", len(pages[1].Blocks))
+	}
+}
+
+func TestRenderPages_HTML(t *testing.T) {
+	files, err := RenderPages(BuildPages(testData(), Options{Title: DefaultTitle, GroupBy: "site"}), FormatHTML, DefaultTitle)
+	if err != nil {
+		t.Fatalf("RenderPages failed: %v", err)
+	}
+	index := string(files["index.html"])
+	if !strings.Contains(index, `<a href="site-home.html">Home (2 devices)</a>`) || strings.Contains(index, "&larr; Index") {
+		t.Errorf("Unexpected index page:\n%s", index)
+	}
+	if !strings.Contains(string(files["ungrouped.html"]), "<td>pump | well</td>") {
+		t.Errorf("Expected the device table in the ungrouped page:\n%s", files["ungrouped.html"])
+	}
+}
+
+func TestPlugin_Export(t *testing.T) {
+	p := NewPlugin()
+	if err := p.Initialize(logging.GetDefault()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	dir := t.TempDir()
+
+	result, err := p.Export(context.Background(), testData(), sync.ExportConfig{Config: map[string]interface{}{"output_path": dir}})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if !strings.HasSuffix(result.OutputPath, ".zip") || result.Checksum == "" || result.RecordCount != 3 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	zr, err := zip.OpenReader(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer func() { _ = zr.Close() }()
+	if len(zr.File) != 5 || zr.File[0].Name != "index.md" {
+		t.Errorf("Unexpected archive contents: %d files, first %s", len(zr.File), zr.File[0].Name)
+	}
+
+	// Without archive the pages are written in place
+	cfg := sync.ExportConfig{Config: map[string]interface{}{"output_path": dir, "archive": false, "dir_name": "wiki", "format": "html"}}
+	if err := p.ValidateConfig(cfg.Config); err != nil {
+		t.Fatalf("ValidateConfig failed: %v", err)
+	}
+	result, err = p.Export(context.Background(), testData(), cfg)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if result.OutputPath != filepath.Join(dir, "wiki") {
+		t.Errorf("Unexpected output path %s", result.OutputPath)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "wiki", "site-home.html")); err != nil {
+		t.Errorf("Expected the site page to be written: %v", err)
+	}
+}
+
+func TestPlugin_ExportSnapshots(t *testing.T) {
+	p := NewPlugin().(*Plugin)
+	if err := p.Initialize(logging.GetDefault()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	captured := []uint{}
+	p.SetSnapshotSource(SnapshotSourceFunc(func(ctx context.Context, deviceID uint) (*Snapshot, error) {
+		captured = append(captured, deviceID)
+		if deviceID == 3 {
+			return nil, errors.New("device did not respond")
+		}
+		return &Snapshot{
+			CapturedAt: time.Date(2024, 5, 1, 12, 0, 5, 0, time.UTC),
+			Status:     []byte(`{"uptime":3600,"wifi_sta":{"ssid":"IoT","rssi":-61},"switches":[{"id":0,"output":true},{"id":1,"output":false}]}`),
+			Image:      []byte("png"),
+			ImageType:  "image/png",
+		}, nil
+	}))
+	dir := t.TempDir()
+
+	cfg := map[string]interface{}{"output_path": dir, "archive": false, "include_snapshots": true, "snapshot_interval_ms": float64(0)}
+	result, err := p.Export(context.Background(), testData(), sync.ExportConfig{Config: cfg})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	// Only online devices are captured
+	if len(captured) != 2 || result.Metadata["snapshots"] != 2 {
+		t.Fatalf("Expected the two online devices to be captured, got %v", captured)
+	}
+	docs := filepath.Join(dir, DefaultDirName)
+	for _, name := range []string{"kitchen-1.json", "kitchen-1.png"} {
+		if _, err := os.Stat(filepath.Join(docs, "snapshots", name)); err != nil {
+			t.Errorf("Expected snapshot file %s: %v", name, err)
+		}
+	}
+	home, _ := os.ReadFile(filepath.Join(docs, "site-home.md"))
+	for _, want := range []string{
+		"## kitchen status snapshot", "Captured 2024-05-01 12:00:05 UTC.", "| Wi-Fi RSSI (dBm) | -61 |",
+		"| Outputs on | 1 of 2 |", "![kitchen status snapshot](snapshots/kitchen-1.png)",
+		"- [snapshots/kitchen-1.json](snapshots/kitchen-1.json)", "Not captured: the device was offline.",
+	} {
+		if !strings.Contains(string(home), want) {
+			t.Errorf("Expected %q in the site page:\n%s", want, home)
+		}
+	}
+	ungrouped, _ := os.ReadFile(filepath.Join(docs, "ungrouped.md"))
+	if !strings.Contains(string(ungrouped), "Not captured: device did not respond") {
+		t.Errorf("Expected the capture error in the ungrouped page:\n%s", ungrouped)
+	}
+
+	// Preview never contacts devices
+	captured = captured[:0]
+	if _, err := p.Preview(context.Background(), testData(), sync.ExportConfig{Config: cfg}); err != nil || len(captured) != 0 {
+		t.Errorf("Expected preview without captures, got %v (%v)", captured, err)
+	}
+}
+
+func TestPlugin_ValidateConfig(t *testing.T) {
+	p := NewPlugin()
+	for _, bad := range []map[string]interface{}{
+		{"format": "pdf"},
+		{"group_by": "floor"},
+		{"dir_name": "../wiki"},
+		{"snapshot_interval_ms": float64(-1)},
+	} {
+		if err := p.ValidateConfig(bad); err == nil {
+			t.Errorf("Expected %v to be rejected", bad)
+		}
+	}
+}
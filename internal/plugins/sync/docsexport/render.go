@@ -0,0 +1,102 @@
+package docsexport
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// renderMarkdown writes a page as GitHub-flavoured Markdown. Links point to
+// the .md file of the target page so they work in wikis and repositories.
+func renderMarkdown(buf *bytes.Buffer, page Page) {
+	fmt.Fprintf(buf, "# %s\n", page.Title)
+	if page.Name != "index" {
+		buf.WriteString("\n[← Index](index.md)\n")
+	}
+	for _, block := range page.Blocks {
+		if block.Heading != "" {
+			fmt.Fprintf(buf, "\n## %s\n", block.Heading)
+		}
+		if block.Text != "" {
+			fmt.Fprintf(buf, "\n%s\n", block.Text)
+		}
+		if len(block.Links) > 0 {
+			buf.WriteString("\n")
+			for _, link := range block.Links {
+				fmt.Fprintf(buf, "- [%s](%s.md)\n", link.Text, link.Page)
+			}
+		}
+		if block.Image != "" {
+			fmt.Fprintf(buf, "\n![%s](%s)\n", block.Heading, block.Image)
+		}
+		if len(block.Files) > 0 {
+			buf.WriteString("\n")
+			for _, file := range block.Files {
+				fmt.Fprintf(buf, "- [%s](%s)\n", file, file)
+			}
+		}
+		if block.Table != nil && len(block.Table.Rows) > 0 {
+			buf.WriteString("\n")
+			writeMarkdownRow(buf, block.Table.Header)
+			buf.WriteString("|" + strings.Repeat(" --- |", len(block.Table.Header)) + "\n")
+			for _, row := range block.Table.Rows {
+				writeMarkdownRow(buf, row)
+			}
+		}
+	}
+}
+
+var markdownCell = strings.NewReplacer("|", "\\|", "\n", " ", "\r", "")
+
+func writeMarkdownRow(buf *bytes.Buffer, cells []string) {
+	buf.WriteString("|")
+	for _, cell := range cells {
+		buf.WriteString(" " + markdownCell.Replace(cell) + " |")
+	}
+	buf.WriteString("\n")
+}
+
+// pageTemplate renders a standalone HTML page that prints cleanly
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Page.Title}} - {{.Site}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #f0f0f0; }
+img { max-width: 480px; border: 1px solid #ccc; }
+nav { margin-bottom: 1em; }
+@media print { nav { display: none; } h2 { page-break-after: avoid; } table { page-break-inside: avoid; } }
+</style>
+</head>
+<body>
+{{if ne .Page.Name "index"}}<nav><a href="index.html">&larr; Index</a></nav>
+{{end}}<h1>{{.Page.Title}}</h1>
+{{range .Page.Blocks}}{{if .Heading}}<h2>{{.Heading}}</h2>
+{{end}}{{if .Text}}<p>{{.Text}}</p>
+{{end}}{{if .Links}}<ul>
+{{range .Links}}<li><a href="{{.Page}}.html">{{.Text}}</a></li>
+{{end}}</ul>
+{{end}}{{if .Image}}<p><img src="{{.Image}}" alt="{{.Heading}}"></p>
+{{end}}{{if .Files}}<ul>
+{{range .Files}}<li><a href="{{.}}">{{.}}</a></li>
+{{end}}</ul>
+{{end}}{{if .Table}}{{if .Table.Rows}}<table>
+<tr>{{range .Table.Header}}<th>{{.}}</th>{{end}}</tr>
+{{range .Table.Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}{{end}}{{end}}</body>
+</html>
+`))
+
+// renderHTML writes a page as a standalone HTML document
+func renderHTML(buf *bytes.Buffer, page Page, siteTitle string) error {
+	return pageTemplate.Execute(buf, struct {
+		Page Page
+		Site string
+	}{page, siteTitle})
+}
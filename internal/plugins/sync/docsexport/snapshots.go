@@ -0,0 +1,180 @@
+package docsexport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+// DefaultSnapshotInterval is the pause between two device snapshots, so a
+// documentation export does not flood the devices
+const DefaultSnapshotInterval = 500 * time.Millisecond
+
+// snapshotDir is the directory of the snapshot files next to the pages
+const snapshotDir = "snapshots"
+
+// Snapshot is the state of a device captured during an export, as evidence
+// of the device state at that point in time
+type Snapshot struct {
+	CapturedAt time.Time
+	Status     json.RawMessage // status JSON as read from the device
+	Image      []byte          // camera or display image, if the device has one
+	ImageType  string          // MIME type of Image
+	Error      string          // why the device could not be captured
+}
+
+// SnapshotSource captures the current state of a device
+type SnapshotSource interface {
+	CaptureSnapshot(ctx context.Context, deviceID uint) (*Snapshot, error)
+}
+
+// SnapshotSourceFunc adapts a function to a SnapshotSource
+type SnapshotSourceFunc func(ctx context.Context, deviceID uint) (*Snapshot, error)
+
+func (f SnapshotSourceFunc) CaptureSnapshot(ctx context.Context, deviceID uint) (*Snapshot, error) {
+	return f(ctx, deviceID)
+}
+
+// SetSnapshotSource sets the source of device snapshots; without one,
+// include_snapshots has no effect
+func (p *Plugin) SetSnapshotSource(src SnapshotSource) {
+	p.snapshots = src
+}
+
+// snapshotSummary lists the status values shown per device
+var snapshotSummary = []struct {
+	label string
+	path  string
+}{
+	{"Uptime (s)", "uptime"},
+	{"Temperature (°C)", "temperature"},
+	{"Wi-Fi SSID", "wifi_sta.ssid"},
+	{"Wi-Fi RSSI (dBm)", "wifi_sta.rssi"},
+	{"Update available", "has_update"},
+}
+
+// CaptureSnapshots captures the online devices one after the other, waiting
+// interval between devices. Devices that fail are recorded with the error;
+// a cancelled context stops the capture and keeps what was captured.
+func CaptureSnapshots(ctx context.Context, src SnapshotSource, devices []sync.DeviceData, interval time.Duration) map[uint]*Snapshot {
+	snapshots := map[uint]*Snapshot{}
+	first := true
+	for _, d := range devices {
+		if d.Status != "online" {
+			continue
+		}
+		if !first && interval > 0 {
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return snapshots
+			case <-timer.C:
+			}
+		}
+		first = false
+		if ctx.Err() != nil {
+			return snapshots
+		}
+		snapshot, err := src.CaptureSnapshot(ctx, d.ID)
+		if err != nil {
+			snapshot = &Snapshot{Error: err.Error()}
+		}
+		snapshots[d.ID] = snapshot
+	}
+	return snapshots
+}
+
+// snapshotBlock shows the captured state of one device
+func snapshotBlock(d sync.DeviceData, snapshot *Snapshot) Block {
+	block := Block{Heading: deviceName(d) + " status snapshot"}
+	if snapshot == nil {
+		block.Text = "Not captured: the device was " + d.Status + "."
+		return block
+	}
+	if snapshot.Error != "" {
+		block.Text = "Not captured: " + snapshot.Error
+		return block
+	}
+	block.Text = "Captured " + snapshot.CapturedAt.UTC().Format("2006-01-02 15:04:05 MST") + "."
+
+	var status map[string]interface{}
+	_ = json.Unmarshal(snapshot.Status, &status)
+	rows := [][]string{}
+	for _, item := range snapshotSummary {
+		if v, ok := lookup(status, item.path); ok {
+			rows = append(rows, []string{item.label, formatValue(v)})
+		}
+	}
+	if switches, ok := status["switches"].([]interface{}); ok && len(switches) > 0 {
+		on := 0
+		for _, sw := range switches {
+			if m, ok := sw.(map[string]interface{}); ok && m["output"] == true {
+				on++
+			}
+		}
+		rows = append(rows, []string{"Outputs on", fmt.Sprintf("%d of %d", on, len(switches))})
+	}
+	if len(rows) > 0 {
+		block.Table = &Table{Header: []string{"Status", "Value"}, Rows: rows}
+	}
+	if len(snapshot.Status) > 0 {
+		block.Files = append(block.Files, snapshotFileName(d, "json"))
+	}
+	if len(snapshot.Image) > 0 {
+		block.Image = snapshotFileName(d, imageExtension(snapshot.ImageType))
+	}
+	return block
+}
+
+// snapshotFiles returns the status JSON and images of the captured devices,
+// keyed by path relative to the pages
+func snapshotFiles(devices []sync.DeviceData, snapshots map[uint]*Snapshot) map[string][]byte {
+	files := map[string][]byte{}
+	for _, d := range devices {
+		snapshot := snapshots[d.ID]
+		if snapshot == nil || snapshot.Error != "" {
+			continue
+		}
+		if len(snapshot.Status) > 0 {
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, snapshot.Status, "", "  "); err != nil {
+				buf.Reset()
+				buf.Write(snapshot.Status)
+			}
+			files[snapshotFileName(d, "json")] = buf.Bytes()
+		}
+		if len(snapshot.Image) > 0 {
+			files[snapshotFileName(d, imageExtension(snapshot.ImageType))] = snapshot.Image
+		}
+	}
+	return files
+}
+
+// snapshotFileName names a snapshot file of a device; the ID keeps devices
+// with the same name apart
+func snapshotFileName(d sync.DeviceData, ext string) string {
+	name := slug(deviceName(d))
+	if name == "" {
+		name = "device"
+	}
+	return snapshotDir + "/" + name + "-" + strconv.FormatUint(uint64(d.ID), 10) + "." + ext
+}
+
+func imageExtension(mimeType string) string {
+	switch strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0])) {
+	case "image/png":
+		return "png"
+	case "image/gif":
+		return "gif"
+	case "image/webp":
+		return "webp"
+	}
+	return "jpg"
+}
@@ -154,13 +154,42 @@ func (g *GitOpsPlugin) Export(ctx context.Context, data *sync.ExportData, config
 	includeTemplates, _ := config.Config["include_templates"].(bool)
 	excludeFields := g.parseExcludeFields(config.Config["exclude_fields"])
 
-	// Clean and create output directory
-	if err := os.RemoveAll(outputPath); err != nil {
+	// A full export replaces the tree. An incremental one carries only the
+	// changed devices: it rewrites their files and deletes those of removed
+	// devices, located through the device index of earlier exports.
+	incremental := data.Metadata.Incremental
+	index := make(map[uint]string)
+	if incremental {
+		var err error
+		if index, err = g.readDeviceIndex(outputPath); err != nil {
+			return nil, err
+		}
+	} else if err := os.RemoveAll(outputPath); err != nil {
 		g.logger.Warn("Failed to clean output directory", "error", err)
 	}
 	if err := os.MkdirAll(outputPath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create output directory: %w", err)
 	}
+	removedFiles := 0
+	writeDevice := func(device sync.DeviceData, dir string) error {
+		devicePath := filepath.Join(dir, g.sanitizeFilename(device.Name)+".yaml")
+		if err := g.writeYAMLFile(devicePath, g.generateDeviceConfig(device, excludeFields)); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(outputPath, devicePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		// A renamed or regrouped device leaves its previous file behind
+		if old, ok := index[device.ID]; ok && old != rel {
+			if g.removeDeviceFile(outputPath, old) {
+				removedFiles++
+			}
+		}
+		index[device.ID] = rel
+		return nil
+	}
 
 	recordCount := 0
 
@@ -168,7 +197,7 @@ func (g *GitOpsPlugin) Export(ctx context.Context, data *sync.ExportData, config
 	deviceGroups := g.groupDevices(data.Devices, groupBy, config.Config["group_mapping"])
 
 	// Generate common configuration
-	if includeCommon {
+	if includeCommon && !(incremental && fileExists(filepath.Join(outputPath, "common.yaml"))) {
 		commonConfig := g.generateCommonConfig(data)
 		commonPath := filepath.Join(outputPath, "common.yaml")
 		if err := g.writeYAMLFile(commonPath, commonConfig); err != nil {
@@ -186,13 +215,16 @@ func (g *GitOpsPlugin) Export(ctx context.Context, data *sync.ExportData, config
 			return nil, fmt.Errorf("failed to create group directory %s: %w", groupPath, err)
 		}
 
-		// Generate group-level configuration
-		groupConfig := g.generateGroupConfig(groupName, devices, data)
+		// Generate group-level configuration. An incremental export sees only
+		// part of the group, so it keeps an existing group file.
 		groupConfigPath := filepath.Join(groupPath, "group.yaml")
-		if err := g.writeYAMLFile(groupConfigPath, groupConfig); err != nil {
-			return nil, fmt.Errorf("failed to write group config: %w", err)
+		if !(incremental && fileExists(groupConfigPath)) {
+			groupConfig := g.generateGroupConfig(groupName, devices, data)
+			if err := g.writeYAMLFile(groupConfigPath, groupConfig); err != nil {
+				return nil, fmt.Errorf("failed to write group config: %w", err)
+			}
+			recordCount++
 		}
-		recordCount++
 
 		// Group devices by type within the group
 		typeGroups := g.groupDevicesByType(devices)
@@ -204,20 +236,18 @@ func (g *GitOpsPlugin) Export(ctx context.Context, data *sync.ExportData, config
 			}
 
 			// Generate type-level common configuration
-			typeCommonConfig := g.generateTypeCommonConfig(deviceType, groupName)
 			typeCommonPath := filepath.Join(typePath, "common.yaml")
-			if err := g.writeYAMLFile(typeCommonPath, typeCommonConfig); err != nil {
-				return nil, fmt.Errorf("failed to write type common config: %w", err)
+			if !(incremental && fileExists(typeCommonPath)) {
+				typeCommonConfig := g.generateTypeCommonConfig(deviceType, groupName)
+				if err := g.writeYAMLFile(typeCommonPath, typeCommonConfig); err != nil {
+					return nil, fmt.Errorf("failed to write type common config: %w", err)
+				}
+				recordCount++
 			}
-			recordCount++
 
 			// Generate individual device configurations
 			for _, device := range typeDevices {
-				deviceConfig := g.generateDeviceConfig(device, excludeFields)
-				deviceFileName := g.sanitizeFilename(device.Name) + ".yaml"
-				devicePath := filepath.Join(typePath, deviceFileName)
-
-				if err := g.writeYAMLFile(devicePath, deviceConfig); err != nil {
+				if err := writeDevice(device, typePath); err != nil {
 					return nil, fmt.Errorf("failed to write device config for %s: %w", device.Name, err)
 				}
 				recordCount++
@@ -242,11 +272,7 @@ func (g *GitOpsPlugin) Export(ctx context.Context, data *sync.ExportData, config
 			}
 
 			for _, device := range typeDevices {
-				deviceConfig := g.generateDeviceConfig(device, excludeFields)
-				deviceFileName := g.sanitizeFilename(device.Name) + ".yaml"
-				devicePath := filepath.Join(typePath, deviceFileName)
-
-				if err := g.writeYAMLFile(devicePath, deviceConfig); err != nil {
+				if err := writeDevice(device, typePath); err != nil {
 					return nil, fmt.Errorf("failed to write ungrouped device config: %w", err)
 				}
 				recordCount++
@@ -283,6 +309,19 @@ func (g *GitOpsPlugin) Export(ctx context.Context, data *sync.ExportData, config
 		}
 	}
 
+	// Delete the files of devices removed since the last export
+	for _, id := range data.Metadata.RemovedDeviceIDs {
+		if old, ok := index[id]; ok {
+			if g.removeDeviceFile(outputPath, old) {
+				removedFiles++
+			}
+			delete(index, id)
+		}
+	}
+	if err := g.writeYAMLFile(filepath.Join(outputPath, deviceIndexFile), index); err != nil {
+		return nil, fmt.Errorf("failed to write device index: %w", err)
+	}
+
 	// Create summary file
 	summary := map[string]interface{}{
 		"export_metadata": data.Metadata,
@@ -293,6 +332,8 @@ func (g *GitOpsPlugin) Export(ctx context.Context, data *sync.ExportData, config
 			"device_files":      totalDeviceFiles,
 			"template_files":    len(data.Templates),
 			"ungrouped_devices": len(ungroupedDevices),
+			"incremental":       incremental,
+			"removed_files":     removedFiles,
 		},
 		"generated_at": time.Now(),
 		"config":       config.Config,
@@ -331,6 +372,7 @@ func (g *GitOpsPlugin) Export(ctx context.Context, data *sync.ExportData, config
 			"device_files":     totalDeviceFiles,
 			"template_files":   len(data.Templates),
 			"grouping_method":  groupBy,
+			"removed_files":    removedFiles,
 		},
 	}, nil
 }
@@ -390,7 +432,7 @@ func (g *GitOpsPlugin) Import(ctx context.Context, source sync.ImportSource, con
 // Capabilities returns plugin capabilities
 func (g *GitOpsPlugin) Capabilities() sync.PluginCapabilities {
 	return sync.PluginCapabilities{
-		SupportsIncremental:    false,
+		SupportsIncremental:    true,
 		RequiresAuthentication: false,
 		SupportedOutputs:       []string{"file"},
 		MaxDataSize:            1024 * 1024 * 100, // 100MB
@@ -557,6 +599,10 @@ func (g *GitOpsPlugin) generateDeviceConfig(device sync.DeviceData, excludeField
 		"type":     device.Type,
 		"firmware": device.Firmware,
 	}
+	// Newest-wins imports compare this with the inventory
+	if !device.UpdatedAt.IsZero() {
+		config["modified_at"] = device.UpdatedAt.UTC().Format(time.RFC3339)
+	}
 
 	// Add settings if available, excluding specified fields
 	if device.Settings != nil {
@@ -610,6 +656,48 @@ func (g *GitOpsPlugin) sanitizeFilename(name string) string {
 	return strings.ToLower(replacer.Replace(name))
 }
 
+// deviceIndexFile maps device IDs to their files, relative to the output path
+const deviceIndexFile = "device-index.yaml"
+
+// readDeviceIndex reads the device index of an earlier export, empty when
+// there is none
+func (g *GitOpsPlugin) readDeviceIndex(outputPath string) (map[uint]string, error) {
+	index := make(map[uint]string)
+	raw, err := os.ReadFile(filepath.Join(outputPath, deviceIndexFile))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device index: %w", err)
+	}
+	if err := yaml.Unmarshal(raw, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse device index: %w", err)
+	}
+	return index, nil
+}
+
+// removeDeviceFile deletes a device file named by the index, refusing paths
+// that leave the output directory. It reports whether a file was deleted.
+func (g *GitOpsPlugin) removeDeviceFile(outputPath, rel string) bool {
+	rel = filepath.FromSlash(rel)
+	if !filepath.IsLocal(rel) {
+		g.logger.Warn("Ignoring device index entry outside the export", "path", rel)
+		return false
+	}
+	if err := os.Remove(filepath.Join(outputPath, rel)); err != nil {
+		if !os.IsNotExist(err) {
+			g.logger.Warn("Failed to remove device file", "path", rel, "error", err)
+		}
+		return false
+	}
+	return true
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
 func (g *GitOpsPlugin) writeYAMLFile(filePath string, data interface{}) error {
 	file, err := os.Create(filePath)
 	if err != nil {
@@ -478,8 +478,8 @@ func TestGitOpsExporter_Capabilities(t *testing.T) {
 
 	caps := exporter.Capabilities()
 
-	if caps.SupportsIncremental {
-		t.Error("GitOps should not support incremental exports")
+	if !caps.SupportsIncremental {
+		t.Error("GitOps should support incremental exports")
 	}
 
 	if caps.RequiresAuthentication {
@@ -1,9 +1,12 @@
 package jsonexport
 
 import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
@@ -112,50 +115,20 @@ func (p *Plugin) Export(ctx context.Context, data *sync.ExportData, config sync.
 	baseName := fmt.Sprintf("shelly-export-%s-%s.json", security.SanitizeFilename(ts), security.SanitizeFilename(exportID))
 	path := filepath.Join(outputPath, baseName)
 
-	env := jsonEnvelope{
-		Metadata:  data.Metadata,
-		Devices:   data.Devices,
-		Templates: data.Templates,
-		CreatedAt: start,
-		Version:   "1.0",
-	}
-	if includeDiscovered {
-		env.Discovered = data.DiscoveredDevices
-	}
+	env := p.envelope(data, includeDiscovered, start)
 
-	// Produce JSON bytes
-	var buf []byte
-	var err error
-	if pretty {
-		buf, err = json.MarshalIndent(&env, "", "  ")
-	} else {
-		buf, err = json.Marshal(&env)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal json: %w", err)
-	}
-
-	// Write with optional compression
+	// Stream the JSON to the file, compressed on the way if requested
 	if compression {
 		switch algo {
 		case "zip":
-			zipPath := filepath.Join(outputPath, fmt.Sprintf("shelly-export-%s-%s.json.zip", ts, exportID))
-			if err := sync.WriteZipSingle(zipPath, baseName, buf); err != nil {
-				return nil, err
-			}
-			path = zipPath
+			path = filepath.Join(outputPath, fmt.Sprintf("shelly-export-%s-%s.json.zip", ts, exportID))
 		default: // gzip
-			gzPath := filepath.Join(outputPath, fmt.Sprintf("shelly-export-%s-%s.json.gz", ts, exportID))
-			if err := sync.WriteGzip(gzPath, buf); err != nil {
-				return nil, err
-			}
-			path = gzPath
-		}
-	} else {
-		if err := os.WriteFile(path, buf, 0644); err != nil {
-			return nil, fmt.Errorf("failed to write file: %w", err)
+			path = filepath.Join(outputPath, fmt.Sprintf("shelly-export-%s-%s.json.gz", ts, exportID))
 		}
 	}
+	if err := p.writeFile(ctx, path, baseName, compression, algo, env, pretty); err != nil {
+		return nil, err
+	}
 
 	fi, _ := os.Stat(path)
 	sum, _ := sync.FileSHA256(path)
@@ -188,6 +161,86 @@ func (p *Plugin) Export(ctx context.Context, data *sync.ExportData, config sync.
 	}, nil
 }
 
+// envelope wraps the export data in the top-level JSON structure
+func (p *Plugin) envelope(data *sync.ExportData, includeDiscovered bool, createdAt time.Time) *jsonEnvelope {
+	env := &jsonEnvelope{
+		Metadata:  data.Metadata,
+		Devices:   data.Devices,
+		Templates: data.Templates,
+		CreatedAt: createdAt,
+		Version:   "1.0",
+	}
+	if includeDiscovered {
+		env.Discovered = data.DiscoveredDevices
+	}
+	return env
+}
+
+// writeFile streams the envelope to path, through gzip or a single-entry
+// zip archive when compression is enabled
+func (p *Plugin) writeFile(ctx context.Context, path, entryName string, compression bool, algo string, env *jsonEnvelope, pretty bool) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write file: %w", closeErr)
+		}
+		if err != nil {
+			_ = os.Remove(path)
+		}
+	}()
+
+	buffered := bufio.NewWriter(sync.ProgressWriter(ctx, f))
+	var w io.Writer = buffered
+	var closer io.Closer
+	if compression {
+		switch algo {
+		case "zip":
+			zw := zip.NewWriter(buffered)
+			entry, err := zw.CreateHeader(&zip.FileHeader{Name: entryName, Method: zip.Deflate})
+			if err != nil {
+				return fmt.Errorf("failed to create zip entry: %w", err)
+			}
+			w, closer = entry, zw
+		default: // gzip
+			gz := gzip.NewWriter(buffered)
+			w, closer = gz, gz
+		}
+	}
+	if _, err := writeEnvelope(ctx, w, env, pretty); err != nil {
+		return err
+	}
+	if closer != nil {
+		if err := closer.Close(); err != nil {
+			return fmt.Errorf("failed to finish compression: %w", err)
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return f.Sync()
+}
+
+// ExportStream implements sync.StreamingPlugin: it writes the uncompressed
+// JSON document to w device by device
+func (p *Plugin) ExportStream(ctx context.Context, data *sync.ExportData, config sync.ExportConfig, w io.Writer) (int, error) {
+	pretty, _ := config.Config["pretty"].(bool)
+	includeDiscovered, _ := config.Config["include_discovered"].(bool)
+	buffered := bufio.NewWriter(w)
+	records, err := writeEnvelope(ctx, buffered, p.envelope(data, includeDiscovered, time.Now()), pretty)
+	if err != nil {
+		return records, err
+	}
+	return records, buffered.Flush()
+}
+
+// StreamFileName implements sync.StreamingPlugin
+func (p *Plugin) StreamFileName(config sync.ExportConfig) string {
+	return fmt.Sprintf("shelly-export-%s.json", time.Now().Format("20060102-150405"))
+}
+
 func (p *Plugin) Preview(ctx context.Context, data *sync.ExportData, config sync.ExportConfig) (*sync.PreviewResult, error) {
 	total := len(data.Devices) + len(data.Templates) + len(data.DiscoveredDevices)
 	// rough size
@@ -1,6 +1,7 @@
 package jsonexport
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"os"
@@ -438,3 +439,57 @@ func TestPlugin_Import_NotImplemented(t *testing.T) {
 		t.Error("Expected Import to return not implemented error")
 	}
 }
+
+func TestWriteEnvelope_MatchesMarshal(t *testing.T) {
+	env := &jsonEnvelope{
+		Metadata: sync.ExportMetadata{ExportID: "stream-1"},
+		Devices: []sync.DeviceData{
+			{ID: 1, Name: "One", Settings: map[string]interface{}{"a": []int{1, 2}}},
+			{ID: 2, Name: "Two"},
+		},
+		Templates:  []sync.TemplateData{{ID: 1, Name: "Base"}},
+		Discovered: []sync.DiscoveredDeviceData{{MAC: "AA:BB:CC:DD:EE:FF"}},
+		CreatedAt:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Version:    "1.0",
+	}
+	for _, pretty := range []bool{false, true} {
+		var want []byte
+		if pretty {
+			want, _ = json.MarshalIndent(env, "", "  ")
+		} else {
+			want, _ = json.Marshal(env)
+		}
+		var got bytes.Buffer
+		records, err := writeEnvelope(context.Background(), &got, env, pretty)
+		if err != nil {
+			t.Fatalf("writeEnvelope failed: %v", err)
+		}
+		if records != 2 {
+			t.Errorf("Expected 2 records, got %d", records)
+		}
+		if got.String() != string(want) {
+			t.Errorf("pretty=%v: streamed JSON differs from json.Marshal\ngot:  %s\nwant: %s", pretty, got.String(), want)
+		}
+	}
+}
+
+func TestPlugin_ExportStream(t *testing.T) {
+	p := NewPlugin().(*Plugin)
+	data := &sync.ExportData{Devices: []sync.DeviceData{{ID: 1, Name: "Test"}, {ID: 2, Name: "Other"}}}
+
+	var out bytes.Buffer
+	records, err := p.ExportStream(context.Background(), data, sync.ExportConfig{Config: map[string]interface{}{}}, &out)
+	if err != nil {
+		t.Fatalf("ExportStream failed: %v", err)
+	}
+	if records != 2 {
+		t.Errorf("Expected 2 records, got %d", records)
+	}
+	var envelope jsonEnvelope
+	if err := json.Unmarshal(out.Bytes(), &envelope); err != nil {
+		t.Fatalf("Streamed output is not valid JSON: %v", err)
+	}
+	if len(envelope.Devices) != 2 || envelope.Devices[1].Name != "Other" {
+		t.Errorf("Unexpected devices in stream: %+v", envelope.Devices)
+	}
+}
@@ -0,0 +1,132 @@
+package jsonexport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+// writeEnvelope writes the JSON document one device at a time, so large
+// fleets are never marshaled into a single buffer. It returns the number of
+// devices written and reports progress after each of them.
+func writeEnvelope(ctx context.Context, w io.Writer, env *jsonEnvelope, pretty bool) (int, error) {
+	s := &jsonStream{w: w, pretty: pretty}
+	s.raw("{")
+	s.field("metadata", env.Metadata, true)
+
+	s.key("devices", false)
+	s.raw("[")
+	for i := range env.Devices {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		s.item(env.Devices[i], i == 0)
+		sync.ReportExportProgress(ctx, i+1, len(env.Devices))
+		if s.err != nil {
+			return i, s.err
+		}
+	}
+	s.closeList(len(env.Devices) == 0)
+
+	s.key("templates", false)
+	s.raw("[")
+	for i := range env.Templates {
+		s.item(env.Templates[i], i == 0)
+	}
+	s.closeList(len(env.Templates) == 0)
+
+	if len(env.Discovered) > 0 {
+		s.key("discovered_devices", false)
+		s.raw("[")
+		for i := range env.Discovered {
+			s.item(env.Discovered[i], i == 0)
+		}
+		s.closeList(false)
+	}
+
+	s.field("created_at", env.CreatedAt, false)
+	s.field("version", env.Version, false)
+	s.newline("")
+	s.raw("}")
+	if s.err != nil {
+		return len(env.Devices), s.err
+	}
+	return len(env.Devices), nil
+}
+
+// jsonStream writes JSON tokens and keeps the first error
+type jsonStream struct {
+	w      io.Writer
+	pretty bool
+	err    error
+}
+
+func (s *jsonStream) raw(text string) {
+	if s.err == nil {
+		_, s.err = io.WriteString(s.w, text)
+	}
+}
+
+// newline starts a new line at indent when pretty-printing
+func (s *jsonStream) newline(indent string) {
+	if s.pretty {
+		s.raw("\n" + indent)
+	}
+}
+
+// key writes an object key at the top level of the envelope
+func (s *jsonStream) key(name string, first bool) {
+	if !first {
+		s.raw(",")
+	}
+	s.newline("  ")
+	s.raw(fmt.Sprintf("%q:", name))
+	if s.pretty {
+		s.raw(" ")
+	}
+}
+
+// field writes a top-level key and its value
+func (s *jsonStream) field(name string, value interface{}, first bool) {
+	s.key(name, first)
+	s.value(value, "  ")
+}
+
+// item writes one element of a top-level list
+func (s *jsonStream) item(value interface{}, first bool) {
+	if !first {
+		s.raw(",")
+	}
+	s.newline("    ")
+	s.value(value, "    ")
+}
+
+// closeList ends a top-level list
+func (s *jsonStream) closeList(empty bool) {
+	if !empty {
+		s.newline("  ")
+	}
+	s.raw("]")
+}
+
+// value marshals a value, indented to match its position when
+// pretty-printing
+func (s *jsonStream) value(v interface{}, indent string) {
+	if s.err != nil {
+		return
+	}
+	var b []byte
+	if s.pretty {
+		b, s.err = json.MarshalIndent(v, indent, "  ")
+	} else {
+		b, s.err = json.Marshal(v)
+	}
+	if s.err != nil {
+		s.err = fmt.Errorf("failed to marshal json: %w", s.err)
+		return
+	}
+	_, s.err = s.w.Write(b)
+}
@@ -0,0 +1,283 @@
+package promsd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/security"
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+// Defaults used when the plugin configuration does not specify a value
+const (
+	DefaultFilename   = "shelly-targets.json"
+	DefaultOutputPath = "./data/exports"
+	DefaultTargetPort = 80
+)
+
+// TargetGroup is a single Prometheus file_sd / http_sd target group
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// TargetOptions controls how devices are mapped to scrape targets
+type TargetOptions struct {
+	Port           int    // port appended to the device IP (0 = omit)
+	IncludeOffline bool   // include devices whose status is "offline"
+	MetricsPath    string // optional __metrics_path__ label
+}
+
+// Plugin exports the device inventory as Prometheus file-based service discovery JSON
+type Plugin struct {
+	logger  *logging.Logger
+	baseDir string // Base directory for path validation
+}
+
+func NewPlugin() sync.SyncPlugin { return &Plugin{} }
+
+func (p *Plugin) Info() sync.PluginInfo {
+	return sync.PluginInfo{
+		Name:        "prometheus-sd",
+		Version:     "1.0.0",
+		Description: "Export devices as Prometheus file_sd targets with model, group and tag labels",
+		Author:      "Shelly Manager Team",
+		License:     "MIT",
+		SupportedFormats: []string{
+			"json",
+		},
+		Tags:     []string{"prometheus", "service-discovery", "monitoring", "export"},
+		Category: sync.CategoryCustom,
+	}
+}
+
+func (p *Plugin) ConfigSchema() sync.ConfigSchema {
+	minPort, maxPort := float64(0), float64(65535)
+	return sync.ConfigSchema{
+		Version: "1.0",
+		Properties: map[string]sync.PropertySchema{
+			"output_path":     {Type: "string", Description: "Directory for the targets file", Default: DefaultOutputPath},
+			"filename":        {Type: "string", Description: "Targets file name (stable so Prometheus can watch it)", Default: DefaultFilename},
+			"target_port":     {Type: "number", Description: "Port appended to each device IP (0 omits the port)", Default: DefaultTargetPort, Minimum: &minPort, Maximum: &maxPort},
+			"include_offline": {Type: "boolean", Description: "Include devices currently marked offline", Default: false},
+			"metrics_path":    {Type: "string", Description: "Optional __metrics_path__ label for per-device exporters", Default: ""},
+		},
+		Required: []string{},
+	}
+}
+
+func (p *Plugin) ValidateConfig(config map[string]interface{}) error {
+	if v, ok := config["output_path"].(string); ok && v != "" && p.baseDir != "" {
+		if _, err := security.ValidatePath(p.baseDir, v); err != nil {
+			return fmt.Errorf("invalid output_path: %w", err)
+		}
+	}
+	if v, ok := config["filename"].(string); ok && v != "" && security.SanitizeFilename(v) != v {
+		return fmt.Errorf("invalid filename: %q", v)
+	}
+	if v, ok := config["target_port"]; ok {
+		port, err := toInt(v)
+		if err != nil || port < 0 || port > 65535 {
+			return fmt.Errorf("invalid target_port: %v", v)
+		}
+	}
+	return nil
+}
+
+// SetBaseDir sets the base directory for path validation
+func (p *Plugin) SetBaseDir(baseDir string) {
+	p.baseDir = baseDir
+}
+
+// OptionsFromConfig builds TargetOptions from a plugin configuration map
+func OptionsFromConfig(config map[string]interface{}) TargetOptions {
+	opts := TargetOptions{Port: DefaultTargetPort}
+	if v, ok := config["target_port"]; ok {
+		if port, err := toInt(v); err == nil {
+			opts.Port = port
+		}
+	}
+	opts.IncludeOffline, _ = config["include_offline"].(bool)
+	opts.MetricsPath, _ = config["metrics_path"].(string)
+	return opts
+}
+
+// BuildTargetGroups maps devices to one target group per device, ordered by
+// device ID so repeated exports produce identical output.
+func BuildTargetGroups(devices []sync.DeviceData, opts TargetOptions) []TargetGroup {
+	sorted := append([]sync.DeviceData(nil), devices...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	groups := make([]TargetGroup, 0, len(sorted))
+	for _, d := range sorted {
+		if d.IP == "" {
+			continue
+		}
+		if !opts.IncludeOffline && d.Status == "offline" {
+			continue
+		}
+		target := d.IP
+		if opts.Port > 0 {
+			target = net.JoinHostPort(d.IP, strconv.Itoa(opts.Port))
+		}
+		groups = append(groups, TargetGroup{
+			Targets: []string{target},
+			Labels:  deviceLabels(d, opts),
+		})
+	}
+	return groups
+}
+
+// deviceLabels returns the labels attached to a device target
+func deviceLabels(d sync.DeviceData, opts TargetOptions) map[string]string {
+	labels := map[string]string{
+		"device_id":   strconv.FormatUint(uint64(d.ID), 10),
+		"device_name": d.Name,
+		"mac":         d.MAC,
+		"model":       d.Model,
+		"type":        d.Type,
+		"firmware":    d.Firmware,
+		"status":      d.Status,
+	}
+	if gen := settingInt(d.Settings, "gen"); gen > 0 {
+		labels["generation"] = strconv.Itoa(gen)
+	}
+	if group, ok := d.Settings["group"].(string); ok && group != "" {
+		labels["group"] = group
+	}
+	if len(d.Tags) > 0 {
+		// Follow the Prometheus convention of comma-delimited lists with
+		// leading and trailing separators so regex matches stay simple.
+		labels["tags"] = "," + strings.Join(d.Tags, ",") + ","
+	}
+	if opts.MetricsPath != "" {
+		labels["__metrics_path__"] = opts.MetricsPath
+	}
+	for k, v := range labels {
+		if v == "" {
+			delete(labels, k)
+		}
+	}
+	return labels
+}
+
+func (p *Plugin) Export(ctx context.Context, data *sync.ExportData, config sync.ExportConfig) (*sync.ExportResult, error) {
+	start := time.Now()
+	outputPath, _ := config.Config["output_path"].(string)
+	if outputPath == "" {
+		outputPath = DefaultOutputPath
+	}
+	filename, _ := config.Config["filename"].(string)
+	if filename == "" {
+		filename = DefaultFilename
+	}
+	filename = security.SanitizeFilename(filename)
+
+	// Validate output path against base directory to prevent path traversal
+	if p.baseDir != "" {
+		validatedPath, err := security.ValidatePath(p.baseDir, outputPath)
+		if err != nil {
+			return nil, fmt.Errorf("path validation failed: %w", err)
+		}
+		outputPath = validatedPath
+	}
+
+	if err := os.MkdirAll(outputPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	groups := BuildTargetGroups(data.Devices, OptionsFromConfig(config.Config))
+	buf, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal targets: %w", err)
+	}
+
+	// Write atomically so Prometheus never reads a partially written file
+	path := filepath.Join(outputPath, filename)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return nil, fmt.Errorf("failed to publish targets file: %w", err)
+	}
+
+	sum, _ := sync.FileSHA256(path)
+
+	if p.logger != nil {
+		p.logger.Info("Prometheus SD export completed", "path", path, "targets", len(groups))
+	}
+
+	return &sync.ExportResult{
+		Success:     true,
+		OutputPath:  path,
+		RecordCount: len(groups),
+		FileSize:    int64(len(buf)),
+		Checksum:    sum,
+		Duration:    time.Since(start),
+		Metadata: map[string]interface{}{
+			"export_id": data.Metadata.ExportID,
+			"format":    "json",
+		},
+	}, nil
+}
+
+func (p *Plugin) Preview(ctx context.Context, data *sync.ExportData, config sync.ExportConfig) (*sync.PreviewResult, error) {
+	groups := BuildTargetGroups(data.Devices, OptionsFromConfig(config.Config))
+	return &sync.PreviewResult{Success: true, RecordCount: len(groups), EstimatedSize: int64(len(groups)) * 300}, nil
+}
+
+func (p *Plugin) Import(ctx context.Context, source sync.ImportSource, config sync.ImportConfig) (*sync.ImportResult, error) {
+	return nil, fmt.Errorf("prometheus-sd import is not supported")
+}
+
+func (p *Plugin) Capabilities() sync.PluginCapabilities {
+	return sync.PluginCapabilities{
+		SupportedOutputs: []string{"file"},
+		MaxDataSize:      10 * 1024 * 1024,
+		ConcurrencyLevel: 1,
+	}
+}
+
+func (p *Plugin) Initialize(logger *logging.Logger) error { p.logger = logger; return nil }
+func (p *Plugin) Cleanup() error                          { return nil }
+
+// settingInt reads a numeric setting that may have been decoded as float64
+func settingInt(settings map[string]interface{}, key string) int {
+	if settings == nil {
+		return 0
+	}
+	n, err := toInt(settings[key])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func toInt(v interface{}) (int, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int64:
+		return int(n), nil
+	case float64:
+		return int(n), nil
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err
+	case string:
+		return strconv.Atoi(n)
+	default:
+		return 0, fmt.Errorf("not a number: %v", v)
+	}
+}
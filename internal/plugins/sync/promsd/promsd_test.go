@@ -0,0 +1,116 @@
+package promsd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/sync"
+)
+
+func testDevices() []sync.DeviceData {
+	return []sync.DeviceData{
+		{ID: 2, IP: "192.168.1.20", MAC: "AA:BB:CC:00:00:02", Name: "kitchen", Model: "SNSW-001X16EU", Type: "SNSW", Status: "online",
+			Settings: map[string]interface{}{"gen": float64(2), "group": "ground-floor"}, Tags: []string{"kitchen", "lights"}},
+		{ID: 1, IP: "192.168.1.10", MAC: "AA:BB:CC:00:00:01", Name: "garage", Model: "SHSW-1", Type: "SHSW-1", Status: "offline",
+			Settings: map[string]interface{}{"gen": float64(1)}},
+		{ID: 3, IP: "", MAC: "AA:BB:CC:00:00:03", Name: "no-ip", Status: "online"},
+	}
+}
+
+func TestBuildTargetGroups(t *testing.T) {
+	groups := BuildTargetGroups(testDevices(), TargetOptions{Port: 9100})
+	if len(groups) != 1 {
+		t.Fatalf("Expected 1 target group (offline and IP-less devices skipped), got %d", len(groups))
+	}
+
+	g := groups[0]
+	if len(g.Targets) != 1 || g.Targets[0] != "192.168.1.20:9100" {
+		t.Errorf("Unexpected targets: %v", g.Targets)
+	}
+	expected := map[string]string{
+		"device_id":   "2",
+		"device_name": "kitchen",
+		"model":       "SNSW-001X16EU",
+		"generation":  "2",
+		"group":       "ground-floor",
+		"tags":        ",kitchen,lights,",
+	}
+	for k, v := range expected {
+		if g.Labels[k] != v {
+			t.Errorf("Label %s: expected %q, got %q", k, v, g.Labels[k])
+		}
+	}
+	if _, ok := g.Labels["__metrics_path__"]; ok {
+		t.Error("Did not expect __metrics_path__ label without metrics_path option")
+	}
+}
+
+func TestBuildTargetGroups_IncludeOfflineOrdered(t *testing.T) {
+	groups := BuildTargetGroups(testDevices(), TargetOptions{IncludeOffline: true, MetricsPath: "/probe"})
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 target groups, got %d", len(groups))
+	}
+	if groups[0].Targets[0] != "192.168.1.10" || groups[1].Targets[0] != "192.168.1.20" {
+		t.Errorf("Expected groups ordered by device ID without port, got %v, %v", groups[0].Targets, groups[1].Targets)
+	}
+	if groups[0].Labels["__metrics_path__"] != "/probe" {
+		t.Errorf("Expected __metrics_path__ label, got %v", groups[0].Labels)
+	}
+	if _, ok := groups[0].Labels["tags"]; ok {
+		t.Error("Did not expect tags label for untagged device")
+	}
+}
+
+func TestPlugin_Export(t *testing.T) {
+	p := NewPlugin()
+	if err := p.Initialize(logging.GetDefault()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	cfg := sync.ExportConfig{Config: map[string]interface{}{
+		"output_path":     dir,
+		"target_port":     float64(80),
+		"include_offline": true,
+	}}
+	if err := p.ValidateConfig(cfg.Config); err != nil {
+		t.Fatalf("ValidateConfig failed: %v", err)
+	}
+
+	result, err := p.Export(context.Background(), &sync.ExportData{Devices: testDevices()}, cfg)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if result.OutputPath != filepath.Join(dir, DefaultFilename) {
+		t.Errorf("Unexpected output path %s", result.OutputPath)
+	}
+	if result.RecordCount != 2 {
+		t.Errorf("Expected 2 records, got %d", result.RecordCount)
+	}
+
+	raw, err := os.ReadFile(result.OutputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	var groups []TargetGroup
+	if err := json.Unmarshal(raw, &groups); err != nil {
+		t.Fatalf("Output is not a valid target group array: %v", err)
+	}
+	if len(groups) != 2 || groups[1].Targets[0] != "192.168.1.20:80" {
+		t.Errorf("Unexpected exported groups: %+v", groups)
+	}
+}
+
+func TestPlugin_ValidateConfig(t *testing.T) {
+	p := NewPlugin()
+	if err := p.ValidateConfig(map[string]interface{}{"target_port": float64(70000)}); err == nil {
+		t.Error("Expected error for out-of-range target_port")
+	}
+	if err := p.ValidateConfig(map[string]interface{}{"filename": "../targets.json"}); err == nil {
+		t.Error("Expected error for filename with path components")
+	}
+}
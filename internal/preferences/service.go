@@ -0,0 +1,211 @@
+// Package preferences stores UI and API preferences per user or API client,
+// such as the dashboard layout, default filters, favorite devices and
+// notification preferences, so they follow the user across machines.
+package preferences
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+// Well-known preference keys; other keys are stored as given
+const (
+	KeyDashboardLayout = "dashboard_layout" // object
+	KeyDefaultFilters  = "default_filters"  // object
+	KeyFavoriteDevices = "favorite_devices" // list of device IDs
+	KeyNotifications   = "notifications"    // object
+)
+
+// Storage limits per owner
+const (
+	MaxValueSize = 64 << 10 // bytes of JSON per preference
+	MaxKeys      = 100
+)
+
+var (
+	// ErrNotFound is returned when a preference is not set
+	ErrNotFound = errors.New("preference not found")
+	// ErrInvalid is returned for malformed keys and values
+	ErrInvalid = errors.New("invalid preference")
+)
+
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,63}$`)
+
+// Service stores preferences by owner, the user name or API client a
+// request is made for
+type Service struct {
+	db     *gorm.DB
+	logger *logging.Logger
+}
+
+// NewService creates a new preferences service
+func NewService(db *gorm.DB, logger *logging.Logger) *Service {
+	if logger == nil {
+		logger = logging.GetDefault()
+	}
+	return &Service{db: db, logger: logger}
+}
+
+// List returns every preference of an owner by key
+func (s *Service) List(ctx context.Context, owner string) (map[string]json.RawMessage, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("preference storage not available")
+	}
+	var rows []database.UserPreference
+	if err := s.db.WithContext(ctx).Where("owner = ?", owner).Order("pref_key").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load preferences: %w", err)
+	}
+	prefs := make(map[string]json.RawMessage, len(rows))
+	for _, row := range rows {
+		prefs[row.Key] = json.RawMessage(row.Value)
+	}
+	return prefs, nil
+}
+
+// Get returns one preference of an owner
+func (s *Service) Get(ctx context.Context, owner, key string) (json.RawMessage, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("preference storage not available")
+	}
+	var row database.UserPreference
+	err := s.db.WithContext(ctx).Where("owner = ? AND pref_key = ?", owner, key).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load preference: %w", err)
+	}
+	return json.RawMessage(row.Value), nil
+}
+
+// Set stores one preference, replacing its previous value
+func (s *Service) Set(ctx context.Context, owner, key string, value json.RawMessage) error {
+	return s.Update(ctx, owner, map[string]json.RawMessage{key: value})
+}
+
+// Update stores several preferences at once; a null value deletes the
+// preference. Nothing is stored when one of them is invalid.
+func (s *Service) Update(ctx context.Context, owner string, values map[string]json.RawMessage) error {
+	if s.db == nil {
+		return fmt.Errorf("preference storage not available")
+	}
+	if owner == "" {
+		return fmt.Errorf("%w: no owner", ErrInvalid)
+	}
+	for key, value := range values {
+		if isNull(value) {
+			continue
+		}
+		if err := Validate(key, value); err != nil {
+			return err
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for key, value := range values {
+			if isNull(value) {
+				if err := tx.Where("owner = ? AND pref_key = ?", owner, key).Delete(&database.UserPreference{}).Error; err != nil {
+					return fmt.Errorf("failed to delete preference: %w", err)
+				}
+				continue
+			}
+			row := database.UserPreference{Owner: owner, Key: key, Value: string(compact(value))}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "owner"}, {Name: "pref_key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+			}).Create(&row).Error; err != nil {
+				return fmt.Errorf("failed to store preference: %w", err)
+			}
+		}
+		var count int64
+		if err := tx.Model(&database.UserPreference{}).Where("owner = ?", owner).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count preferences: %w", err)
+		}
+		if count > MaxKeys {
+			return fmt.Errorf("%w: more than %d preferences", ErrInvalid, MaxKeys)
+		}
+		return nil
+	})
+}
+
+// Delete removes one preference of an owner
+func (s *Service) Delete(ctx context.Context, owner, key string) error {
+	if s.db == nil {
+		return fmt.Errorf("preference storage not available")
+	}
+	result := s.db.WithContext(ctx).Where("owner = ? AND pref_key = ?", owner, key).Delete(&database.UserPreference{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete preference: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Reset removes every preference of an owner and returns how many there were
+func (s *Service) Reset(ctx context.Context, owner string) (int64, error) {
+	if s.db == nil {
+		return 0, fmt.Errorf("preference storage not available")
+	}
+	result := s.db.WithContext(ctx).Where("owner = ?", owner).Delete(&database.UserPreference{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to reset preferences: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Validate checks a key and its JSON value. Well-known keys must hold the
+// documented type.
+func Validate(key string, value json.RawMessage) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("%w: key %q must be lower case letters, digits, '_', '-' or '.'", ErrInvalid, key)
+	}
+	if len(value) > MaxValueSize {
+		return fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalid, key, MaxValueSize)
+	}
+	if !json.Valid(value) {
+		return fmt.Errorf("%w: %s is not valid JSON", ErrInvalid, key)
+	}
+	switch key {
+	case KeyDashboardLayout, KeyDefaultFilters, KeyNotifications:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(value, &obj); err != nil || obj == nil {
+			return fmt.Errorf("%w: %s must be an object", ErrInvalid, key)
+		}
+	case KeyFavoriteDevices:
+		var ids []uint
+		if err := json.Unmarshal(value, &ids); err != nil || ids == nil {
+			return fmt.Errorf("%w: %s must be a list of device IDs", ErrInvalid, key)
+		}
+		for _, id := range ids {
+			if id == 0 {
+				return fmt.Errorf("%w: %s must be a list of device IDs", ErrInvalid, key)
+			}
+		}
+	}
+	return nil
+}
+
+func isNull(value json.RawMessage) bool {
+	return len(value) == 0 || bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
+
+// compact strips insignificant whitespace; value is valid JSON
+func compact(value json.RawMessage) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err != nil {
+		return value
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,96 @@
+package preferences
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		key   string
+		value string
+		valid bool
+	}{
+		{KeyDashboardLayout, `{"columns":3,"widgets":["power","drift"]}`, true},
+		{KeyDashboardLayout, `["power"]`, false},
+		{KeyFavoriteDevices, `[1, 7, 12]`, true},
+		{KeyFavoriteDevices, `[1, 0]`, false},
+		{KeyFavoriteDevices, `["kitchen"]`, false},
+		{KeyNotifications, `null`, false},
+		{"ui.theme", `"dark"`, true},
+		{"UI Theme", `"dark"`, false},
+		{"ui.theme", `{"broken"`, false},
+	} {
+		err := Validate(tc.key, json.RawMessage(tc.value))
+		if tc.valid && err != nil {
+			t.Errorf("Validate(%s, %s) failed: %v", tc.key, tc.value, err)
+		}
+		if !tc.valid && !errors.Is(err, ErrInvalid) {
+			t.Errorf("Validate(%s, %s) = %v, expected ErrInvalid", tc.key, tc.value, err)
+		}
+	}
+}
+
+func TestService_Preferences(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	svc := NewService(db.GetDB(), logger)
+	ctx := context.Background()
+
+	if err := svc.Set(ctx, "alice", KeyFavoriteDevices, json.RawMessage(`[ 3, 5 ]`)); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := svc.Update(ctx, "alice", map[string]json.RawMessage{
+		KeyFavoriteDevices: json.RawMessage(`[5]`),
+		KeyDefaultFilters:  json.RawMessage(`{"status":"online"}`),
+	}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := svc.Set(ctx, "bob", KeyFavoriteDevices, json.RawMessage(`[9]`)); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	prefs, err := svc.List(ctx, "alice")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(prefs) != 2 || string(prefs[KeyFavoriteDevices]) != `[5]` || string(prefs[KeyDefaultFilters]) != `{"status":"online"}` {
+		t.Fatalf("Unexpected preferences: %s", prefs)
+	}
+
+	// An invalid value stores nothing of the update
+	err = svc.Update(ctx, "alice", map[string]json.RawMessage{
+		"ui.theme":         json.RawMessage(`"dark"`),
+		KeyDashboardLayout: json.RawMessage(`[]`),
+	})
+	if !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected invalid update refused, got %v", err)
+	}
+	if _, err := svc.Get(ctx, "alice", "ui.theme"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected nothing stored, got %v", err)
+	}
+
+	// A null value deletes the preference
+	if err := svc.Update(ctx, "alice", map[string]json.RawMessage{KeyDefaultFilters: json.RawMessage(`null`)}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := svc.Delete(ctx, "alice", KeyDefaultFilters); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the preference deleted, got %v", err)
+	}
+
+	if n, err := svc.Reset(ctx, "alice"); err != nil || n != 1 {
+		t.Fatalf("Reset = %d, %v", n, err)
+	}
+	if value, err := svc.Get(ctx, "bob", KeyFavoriteDevices); err != nil || string(value) != `[9]` {
+		t.Errorf("Expected other owners untouched, got %s (%v)", value, err)
+	}
+}
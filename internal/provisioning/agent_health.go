@@ -0,0 +1,173 @@
+package provisioning
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Agent health states
+const (
+	AgentHealthOK       = "ok"
+	AgentHealthDegraded = "degraded"
+)
+
+// AgentHealth is a snapshot of a provisioning agent's internal state. It is
+// served on the agent's local health endpoint and sent to the API server as
+// a heartbeat.
+type AgentHealth struct {
+	AgentID         string               `json:"agent_id"`
+	Status          string               `json:"status"`             // ok or degraded
+	Problems        []string             `json:"problems,omitempty"` // why the agent is degraded
+	StartedAt       time.Time            `json:"started_at"`
+	UptimeSeconds   int64                `json:"uptime_seconds"`
+	Interface       NetworkInterfaceInfo `json:"interface"`
+	CurrentTask     string               `json:"current_task,omitempty"` // task being processed
+	LastScanAt      *time.Time           `json:"last_scan_at,omitempty"`
+	LastScanDevices int                  `json:"last_scan_devices"`
+	LastScanError   string               `json:"last_scan_error,omitempty"`
+	LastPollAt      *time.Time           `json:"last_poll_at,omitempty"`
+	LastTaskAt      *time.Time           `json:"last_task_at,omitempty"`
+	LastTaskID      string               `json:"last_task_id,omitempty"`
+	LastTaskStatus  string               `json:"last_task_status,omitempty"`
+	LastTaskError   string               `json:"last_task_error,omitempty"`
+	Counters        AgentHealthCounters  `json:"counters"`
+}
+
+// AgentHealthCounters count agent activity and errors since it started
+type AgentHealthCounters struct {
+	Scans           int64 `json:"scans"`
+	ScanErrors      int64 `json:"scan_errors"`
+	Polls           int64 `json:"polls"`
+	PollErrors      int64 `json:"poll_errors"`
+	TasksCompleted  int64 `json:"tasks_completed"`
+	TasksFailed     int64 `json:"tasks_failed"`
+	HeartbeatErrors int64 `json:"heartbeat_errors"`
+}
+
+// HealthTracker records what a provisioning agent does so its health can be
+// reported. It is safe for concurrent use.
+type HealthTracker struct {
+	mu      sync.Mutex
+	iface   NetworkInterface
+	health  AgentHealth
+	nowFunc func() time.Time
+}
+
+// NewHealthTracker creates a tracker for the agent; iface, when set, is
+// queried for the Wi-Fi interface state on every snapshot
+func NewHealthTracker(agentID string, iface NetworkInterface) *HealthTracker {
+	return &HealthTracker{
+		iface:   iface,
+		health:  AgentHealth{AgentID: agentID, StartedAt: time.Now()},
+		nowFunc: time.Now,
+	}
+}
+
+// RecordScan records a device scan and how many devices it found
+func (t *HealthTracker) RecordScan(devices int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.nowFunc()
+	t.health.LastScanAt = &now
+	t.health.LastScanDevices = devices
+	t.health.LastScanError = ""
+	t.health.Counters.Scans++
+	if err != nil {
+		t.health.LastScanError = err.Error()
+		t.health.Counters.ScanErrors++
+	}
+}
+
+// RecordPoll records a task poll against the API server
+func (t *HealthTracker) RecordPoll(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.nowFunc()
+	t.health.LastPollAt = &now
+	t.health.Counters.Polls++
+	if err != nil {
+		t.health.Counters.PollErrors++
+	}
+}
+
+// StartTask marks a task as being processed
+func (t *HealthTracker) StartTask(taskID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.health.CurrentTask = taskID
+}
+
+// FinishTask records the outcome of a processed task
+func (t *HealthTracker) FinishTask(taskID string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.nowFunc()
+	t.health.CurrentTask = ""
+	t.health.LastTaskAt = &now
+	t.health.LastTaskID = taskID
+	t.health.LastTaskStatus = "completed"
+	t.health.LastTaskError = ""
+	if err != nil {
+		t.health.LastTaskStatus = "failed"
+		t.health.LastTaskError = err.Error()
+		t.health.Counters.TasksFailed++
+		return
+	}
+	t.health.Counters.TasksCompleted++
+}
+
+// RecordHeartbeat records whether a heartbeat reached the API server
+func (t *HealthTracker) RecordHeartbeat(err error) {
+	if err == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.health.Counters.HeartbeatErrors++
+}
+
+// Snapshot returns the current health. The agent is degraded when its Wi-Fi
+// interface reports an error or is unavailable, or when its last scan failed.
+func (t *HealthTracker) Snapshot() AgentHealth {
+	var info NetworkInterfaceInfo
+	if t.iface != nil {
+		info = t.iface.GetInterfaceInfo()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	health := t.health
+	health.Interface = info
+	health.UptimeSeconds = int64(t.nowFunc().Sub(health.StartedAt).Seconds())
+	health.Problems = nil
+	if t.iface == nil {
+		health.Problems = append(health.Problems, "no Wi-Fi interface")
+	} else if info.Status == "error" || info.Status == "unavailable" {
+		health.Problems = append(health.Problems, "Wi-Fi interface "+info.Status)
+	}
+	if health.LastScanError != "" {
+		health.Problems = append(health.Problems, "last scan failed: "+health.LastScanError)
+	}
+	health.Status = AgentHealthOK
+	if len(health.Problems) > 0 {
+		health.Status = AgentHealthDegraded
+	}
+	return health
+}
+
+// ServeHTTP serves the health snapshot as JSON, with status 503 while the
+// agent is degraded so plain HTTP probes can use it
+func (t *HealthTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	health := t.Snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	if health.Status != AgentHealthOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(health)
+}
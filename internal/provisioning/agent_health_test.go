@@ -0,0 +1,83 @@
+package provisioning
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestHealthTracker(t *testing.T) {
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text", Output: "stdout"})
+	require.NoError(t, err)
+
+	tracker := NewHealthTracker("agent-1", NewTestMockNetworkInterface(logger))
+
+	health := tracker.Snapshot()
+	assert.Equal(t, AgentHealthOK, health.Status)
+	assert.Equal(t, "agent-1", health.AgentID)
+	assert.Equal(t, "available", health.Interface.Status)
+	assert.Nil(t, health.LastScanAt)
+
+	tracker.RecordScan(3, nil)
+	tracker.RecordPoll(errors.New("connection refused"))
+	tracker.StartTask("task-1")
+	assert.Equal(t, "task-1", tracker.Snapshot().CurrentTask)
+	tracker.FinishTask("task-1", nil)
+	tracker.StartTask("task-2")
+	tracker.FinishTask("task-2", errors.New("device not found"))
+
+	health = tracker.Snapshot()
+	assert.Equal(t, AgentHealthOK, health.Status)
+	assert.Equal(t, 3, health.LastScanDevices)
+	assert.Empty(t, health.CurrentTask)
+	assert.Equal(t, "task-2", health.LastTaskID)
+	assert.Equal(t, "failed", health.LastTaskStatus)
+	assert.Equal(t, AgentHealthCounters{Scans: 1, Polls: 1, PollErrors: 1, TasksCompleted: 1, TasksFailed: 1}, health.Counters)
+
+	tracker.RecordScan(0, errors.New("nmcli not found"))
+	health = tracker.Snapshot()
+	assert.Equal(t, AgentHealthDegraded, health.Status)
+	assert.Equal(t, []string{"last scan failed: nmcli not found"}, health.Problems)
+
+	rec := httptest.NewRecorder()
+	tracker.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var served AgentHealth
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&served))
+	assert.Equal(t, int64(2), served.Counters.Scans)
+
+	assert.Equal(t, AgentHealthDegraded, NewHealthTracker("agent-2", nil).Snapshot().Status)
+}
+
+func TestAPIClient_SendHeartbeat(t *testing.T) {
+	testutil.SkipIfNoSocketPermissions(t)
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text", Output: "stdout"})
+	require.NoError(t, err)
+
+	var received AgentHealth
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/api/v1/provisioner/agents/agent-1/heartbeat", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewAPIClient(server.URL, "", "agent-1", logger)
+	assert.Error(t, client.SendHeartbeat(AgentHealth{}), "unregistered agents must not send heartbeats")
+
+	client.registered = true
+	tracker := NewHealthTracker("agent-1", nil)
+	tracker.RecordScan(2, nil)
+	require.NoError(t, client.SendHeartbeat(tracker.Snapshot()))
+	assert.Equal(t, "agent-1", received.AgentID)
+	assert.Equal(t, 2, received.LastScanDevices)
+}
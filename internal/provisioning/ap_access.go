@@ -0,0 +1,259 @@
+package provisioning
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+)
+
+// DefaultAPIP is the address Shelly devices use for their own access point
+const DefaultAPIP = "192.168.33.1"
+
+// ErrCaptivePortal indicates the AP answered like a captive portal (redirect or
+// HTML page) instead of the Shelly device API
+var ErrCaptivePortal = errors.New("access point behaves like a captive portal")
+
+// GatewayDetector is implemented by network interfaces that can report the
+// gateway of the currently connected network
+type GatewayDetector interface {
+	GetGatewayIP(ctx context.Context) (string, error)
+}
+
+// WiFiQRCode holds the fields of a standard "WIFI:" QR code payload as printed
+// on newer Shelly device labels
+type WiFiQRCode struct {
+	SSID     string `json:"ssid"`
+	Security string `json:"security"`
+	Password string `json:"-"`
+	Hidden   bool   `json:"hidden"`
+}
+
+// ParseWiFiQRCode parses QR content such as "WIFI:S:ShellyPlus1-AABBCC;T:WPA;P:secret;;".
+// Backslash escapes for ';', ',', ':', '"' and '\' are honoured.
+func ParseWiFiQRCode(content string) (*WiFiQRCode, error) {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(strings.ToUpper(content), "WIFI:") {
+		return nil, fmt.Errorf("unsupported QR code content: expected WIFI: payload")
+	}
+
+	qr := &WiFiQRCode{}
+	var field strings.Builder
+	escaped := false
+	flush := func() {
+		key, value, ok := strings.Cut(field.String(), ":")
+		field.Reset()
+		if !ok {
+			return
+		}
+		switch strings.ToUpper(key) {
+		case "S":
+			qr.SSID = value
+		case "T":
+			qr.Security = value
+		case "P":
+			qr.Password = value
+		case "H":
+			qr.Hidden = strings.EqualFold(value, "true")
+		}
+	}
+	for _, r := range content[len("WIFI:"):] {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ';':
+			flush()
+		default:
+			field.WriteRune(r)
+		}
+	}
+	flush()
+
+	if qr.SSID == "" {
+		return nil, fmt.Errorf("QR code does not contain an SSID")
+	}
+	return qr, nil
+}
+
+// MatchesDevice reports whether the QR code belongs to the device's AP
+func (qr *WiFiQRCode) MatchesDevice(device UnprovisionedDevice) bool {
+	return strings.EqualFold(qr.SSID, device.SSID)
+}
+
+// resolveAPPassword returns the AP password to use for a device. An explicit
+// request password wins, then a scanned QR code, then configured per-device
+// credentials, and finally the discovered default.
+func resolveAPPassword(device UnprovisionedDevice, request ProvisioningRequest, credentials []config.APCredential) (string, error) {
+	if request.APPassword != "" {
+		return request.APPassword, nil
+	}
+	if request.APQRCode != "" {
+		qr, err := ParseWiFiQRCode(request.APQRCode)
+		if err != nil {
+			return "", err
+		}
+		if !qr.MatchesDevice(device) {
+			return "", fmt.Errorf("QR code is for AP %s, not %s", qr.SSID, device.SSID)
+		}
+		return qr.Password, nil
+	}
+	for _, c := range credentials {
+		if c.Matches(device.MAC, device.SSID) {
+			return c.Password, nil
+		}
+	}
+	return device.Password, nil
+}
+
+// apCandidates lists the addresses to probe for the device API, most likely first
+func (sp *ShellyProvisioner) apCandidates(ctx context.Context, device UnprovisionedDevice) []string {
+	var candidates []string
+	add := func(ip string) {
+		if ip == "" {
+			return
+		}
+		for _, c := range candidates {
+			if c == ip {
+				return
+			}
+		}
+		candidates = append(candidates, ip)
+	}
+
+	if detector, ok := sp.netIface.(GatewayDetector); ok {
+		gateway, err := detector.GetGatewayIP(ctx)
+		if err != nil {
+			sp.logger.WithFields(map[string]any{
+				"component":   "shelly_provisioner",
+				"device_ssid": device.SSID,
+				"error":       err.Error(),
+			}).Debug("Gateway detection failed")
+		}
+		add(gateway)
+	}
+	add(device.IP)
+	add(DefaultAPIP)
+	return candidates
+}
+
+// locateDeviceAPI finds the address answering the Shelly API on the device AP.
+// Captive-portal style answers are skipped so the next candidate is tried.
+func (sp *ShellyProvisioner) locateDeviceAPI(ctx context.Context, device UnprovisionedDevice) (string, error) {
+	var lastErr error
+	for _, ip := range sp.apCandidates(ctx, device) {
+		err := sp.probeShellyAPI(ctx, ip)
+		if err == nil {
+			return ip, nil
+		}
+		fields := map[string]any{
+			"component":   "shelly_provisioner",
+			"device_ssid": device.SSID,
+			"candidate":   ip,
+			"error":       err.Error(),
+		}
+		if errors.Is(err, ErrCaptivePortal) {
+			sp.logger.WithFields(fields).Warn("Captive portal detected on device AP")
+		} else {
+			sp.logger.WithFields(fields).Debug("Device API not reachable at candidate address")
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no candidate addresses")
+	}
+	return "", lastErr
+}
+
+// probeShellyAPI checks that ip serves the Shelly identification endpoint.
+// Redirects are not followed: a redirect or non-JSON body means a captive portal.
+func (sp *ShellyProvisioner) probeShellyAPI(ctx context.Context, ip string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://%s/shelly", ip), nil)
+	if err != nil {
+		return err
+	}
+
+	client := *sp.httpClient
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return fmt.Errorf("%w: redirect to %s", ErrCaptivePortal, resp.Header.Get("Location"))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("device returned status %d", resp.StatusCode)
+	}
+
+	var info map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&info); err != nil {
+		return fmt.Errorf("%w: response is not device JSON", ErrCaptivePortal)
+	}
+	if _, ok := info["mac"]; !ok {
+		if _, ok := info["type"]; !ok {
+			return fmt.Errorf("%w: response lacks device identification", ErrCaptivePortal)
+		}
+	}
+	return nil
+}
+
+// deviceIP returns the located API address for a device, falling back to the
+// address reported at discovery
+func (sp *ShellyProvisioner) deviceIP(device UnprovisionedDevice) string {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	if ip, ok := sp.apIPs[device.SSID]; ok {
+		return ip
+	}
+	if device.IP != "" {
+		return device.IP
+	}
+	return DefaultAPIP
+}
+
+// parseGatewayOutput extracts the gateway from nmcli "IP4.GATEWAY:..." and
+// "IP4.ADDRESS[1]:..." lines
+func parseGatewayOutput(output string) (string, error) {
+	var address string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case key == "IP4.GATEWAY" && value != "" && value != "--":
+			return value, nil
+		case strings.HasPrefix(key, "IP4.ADDRESS") && address == "":
+			address = value
+		}
+	}
+	if address == "" {
+		return "", fmt.Errorf("no IPv4 configuration on WiFi device")
+	}
+	_, subnet, err := net.ParseCIDR(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid IPv4 address %q: %w", address, err)
+	}
+	ip := subnet.IP.To4()
+	if ip == nil {
+		return "", fmt.Errorf("invalid IPv4 address %q", address)
+	}
+	first := make(net.IP, len(ip))
+	copy(first, ip)
+	first[3]++
+	return first.String(), nil
+}
@@ -0,0 +1,119 @@
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+func TestParseWiFiQRCode(t *testing.T) {
+	qr, err := ParseWiFiQRCode(`WIFI:S:ShellyPlus1-A8032AB1E2C4;T:WPA;P:se\;cr\\et;H:false;;`)
+	if err != nil {
+		t.Fatalf("ParseWiFiQRCode failed: %v", err)
+	}
+	if qr.SSID != "ShellyPlus1-A8032AB1E2C4" || qr.Security != "WPA" || qr.Password != `se;cr\et` || qr.Hidden {
+		t.Errorf("Unexpected QR fields: %+v", qr)
+	}
+
+	for _, content := range []string{"https://example.com", "WIFI:T:WPA;P:x;;"} {
+		if _, err := ParseWiFiQRCode(content); err == nil {
+			t.Errorf("Expected error for %q", content)
+		}
+	}
+}
+
+func TestResolveAPPassword(t *testing.T) {
+	device := UnprovisionedDevice{MAC: "C4:00:00:00:00:00", SSID: "shellyplus1-A1B2C3", Password: ""}
+	credentials := []config.APCredential{
+		{MAC: "aa:bb:cc:a1:b2:c3", Password: "from-config"},
+	}
+
+	tests := []struct {
+		name    string
+		request ProvisioningRequest
+		want    string
+		wantErr bool
+	}{
+		{"explicit password wins", ProvisioningRequest{APPassword: "explicit", APQRCode: "WIFI:S:other;P:x;;"}, "explicit", false},
+		{"matching QR code", ProvisioningRequest{APQRCode: "WIFI:S:SHELLYPLUS1-A1B2C3;T:WPA;P:from-qr;;"}, "from-qr", false},
+		{"QR code for another device", ProvisioningRequest{APQRCode: "WIFI:S:shelly1-FFFFFF;P:x;;"}, "", true},
+		{"configured credential by MAC suffix", ProvisioningRequest{}, "from-config", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveAPPassword(device, tt.request, credentials)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveAPPassword error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveAPPassword = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	other := UnprovisionedDevice{SSID: "shelly1-DDEEFF", Password: "default"}
+	if got, _ := resolveAPPassword(other, ProvisioningRequest{}, credentials); got != "default" {
+		t.Errorf("Expected discovered default password, got %q", got)
+	}
+}
+
+func TestShellyProvisioner_LocateDeviceAPI(t *testing.T) {
+	logger, _ := logging.New(logging.Config{Level: "error", Format: "text", Output: "stderr"})
+
+	portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://portal.example/login", http.StatusFound)
+	}))
+	defer portal.Close()
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"type":"SHSW-1","mac":"AABBCCDDEEFF"}`))
+	}))
+	defer device.Close()
+
+	portalAddr := strings.TrimPrefix(portal.URL, "http://")
+	deviceAddr := strings.TrimPrefix(device.URL, "http://")
+
+	sp := NewShellyProvisioner(logger, &gatewayNetwork{TestMockNetworkInterface: NewTestMockNetworkInterface(logger), gateway: portalAddr})
+	sp.httpClient.Timeout = 2 * time.Second
+
+	if err := sp.probeShellyAPI(context.Background(), portalAddr); !errors.Is(err, ErrCaptivePortal) {
+		t.Errorf("Expected captive portal error, got %v", err)
+	}
+
+	ip, err := sp.locateDeviceAPI(context.Background(), UnprovisionedDevice{SSID: "shelly1-AABBCC", IP: deviceAddr})
+	if err != nil {
+		t.Fatalf("locateDeviceAPI failed: %v", err)
+	}
+	if ip != deviceAddr {
+		t.Errorf("Expected device API at %s, got %s", deviceAddr, ip)
+	}
+}
+
+func TestParseGatewayOutput(t *testing.T) {
+	if gw, err := parseGatewayOutput("IP4.GATEWAY:192.168.33.1\nIP4.ADDRESS[1]:192.168.33.2/24\n"); err != nil || gw != "192.168.33.1" {
+		t.Errorf("Expected reported gateway, got %q (%v)", gw, err)
+	}
+	if gw, err := parseGatewayOutput("IP4.GATEWAY:\nIP4.ADDRESS[1]:10.10.0.20/24\n"); err != nil || gw != "10.10.0.1" {
+		t.Errorf("Expected first subnet host, got %q (%v)", gw, err)
+	}
+	if _, err := parseGatewayOutput("IP4.GATEWAY:--\n"); err == nil {
+		t.Error("Expected error without IPv4 configuration")
+	}
+}
+
+// gatewayNetwork adds gateway detection to the test mock interface
+type gatewayNetwork struct {
+	*TestMockNetworkInterface
+	gateway string
+}
+
+func (g *gatewayNetwork) GetGatewayIP(ctx context.Context) (string, error) {
+	return g.gateway, nil
+}
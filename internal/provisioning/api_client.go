@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/ginsys/shelly-manager/internal/logging"
@@ -242,6 +243,24 @@ func (c *APIClient) TestConnectivity() error {
 	return nil
 }
 
+// SendHeartbeat reports the agent's health to the API server, which also
+// counts it as a sign of life
+func (c *APIClient) SendHeartbeat(health AgentHealth) error {
+	if !c.registered {
+		return fmt.Errorf("agent not registered - call RegisterAgent first")
+	}
+
+	endpoint := fmt.Sprintf("/api/v1/provisioner/agents/%s/heartbeat", c.agentID)
+	if err := c.makeRequest("POST", endpoint, health, nil); err != nil {
+		c.logger.WithFields(map[string]any{
+			"agent_id": c.agentID,
+			"error":    err.Error(),
+		}).Warn("Failed to send heartbeat to API server")
+		return fmt.Errorf("failed to send heartbeat: %w", err)
+	}
+	return nil
+}
+
 // IsRegistered returns whether the agent is registered with the API server
 func (c *APIClient) IsRegistered() bool {
 	return c.registered
@@ -295,6 +314,40 @@ func (c *APIClient) ReportDiscoveredDevices(taskID string, devices []*Discovered
 	return nil
 }
 
+// GetProvisioningProfile fetches the configuration of a provisioning profile
+// stored on the API server, including its credentials, for use with
+// ProvisioningRequest.ApplyConfig. It does not need a registered agent.
+func (c *APIClient) GetProvisioningProfile(name string) (map[string]interface{}, error) {
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	endpoint := "/api/v1/provisioner/profiles/" + url.PathEscape(name)
+	if err := c.makeRequest("GET", endpoint, nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to get provisioning profile %q: %w", name, err)
+	}
+	return resp.Data, nil
+}
+
+// ListProvisioningProfiles returns the names of the provisioning profiles
+// stored on the API server. Listing them needs the admin key.
+func (c *APIClient) ListProvisioningProfiles() ([]string, error) {
+	var resp struct {
+		Data struct {
+			Profiles []struct {
+				Name string `json:"name"`
+			} `json:"profiles"`
+		} `json:"data"`
+	}
+	if err := c.makeRequest("GET", "/api/v1/provisioning/profiles", nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list provisioning profiles: %w", err)
+	}
+	names := make([]string, 0, len(resp.Data.Profiles))
+	for _, p := range resp.Data.Profiles {
+		names = append(names, p.Name)
+	}
+	return names, nil
+}
+
 // makeRequest is a helper method to make HTTP requests to the API server
 func (c *APIClient) makeRequest(method, endpoint string, requestBody interface{}, responseBody interface{}) error {
 	url := c.baseURL + endpoint
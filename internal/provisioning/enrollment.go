@@ -0,0 +1,125 @@
+package provisioning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// EnrollmentScriptName names the script installed for zero-touch enrollment
+const EnrollmentScriptName = "shelly-manager-enroll"
+
+// scriptChunkSize bounds the code sent per Script.PutCode call
+const scriptChunkSize = 1024
+
+// enrollmentScript calls the manager until it answers, then disables
+// itself. Tokens the manager refuses (401) will not become valid, so the
+// script stops on those as well.
+const enrollmentScript = `let enrollURL = %s;
+let enrollToken = %s;
+let self = Shelly.getCurrentScriptId();
+function finish() {
+  Shelly.call("Script.SetConfig", {id: self, config: {enable: false}});
+  Shelly.call("Script.Stop", {id: self});
+}
+function enroll() {
+  let wifi = Shelly.getComponentStatus("wifi");
+  if (!wifi || !wifi.sta_ip) return;
+  let info = Shelly.getDeviceInfo();
+  let body = {token: enrollToken, id: info.id, mac: info.mac, model: info.model, gen: info.gen, ver: info.ver, name: info.name, ip: wifi.sta_ip};
+  Shelly.call("HTTP.POST", {url: enrollURL, content_type: "application/json", body: JSON.stringify(body), timeout: 15},
+    function (res, code) {
+      if (code === 0 && res && (res.code === 200 || res.code === 401)) finish();
+    });
+}
+Timer.set(30000, true, enroll);
+enroll();
+`
+
+// EnrollmentScript returns the Shelly script that presents token at url
+// once the device is on its target network
+func EnrollmentScript(url, token string) string {
+	quotedURL, _ := json.Marshal(url)
+	quotedToken, _ := json.Marshal(token)
+	return fmt.Sprintf(enrollmentScript, quotedURL, quotedToken)
+}
+
+// installEnrollmentScript creates the enrollment script on a Gen2 or later
+// device and enables it, so it runs from the next boot on
+func (sp *ShellyProvisioner) installEnrollmentScript(ctx context.Context, device UnprovisionedDevice, url, token string) error {
+	if device.Generation < 2 {
+		return fmt.Errorf("scripts require a Gen2 or later device")
+	}
+	var created struct {
+		ID int `json:"id"`
+	}
+	if err := sp.deviceRPC(ctx, device, "Script.Create", map[string]interface{}{"name": EnrollmentScriptName}, &created); err != nil {
+		return fmt.Errorf("failed to create script: %w", err)
+	}
+	code := EnrollmentScript(url, token)
+	for offset := 0; offset < len(code); offset += scriptChunkSize {
+		end := min(offset+scriptChunkSize, len(code))
+		params := map[string]interface{}{"id": created.ID, "code": code[offset:end], "append": offset > 0}
+		if err := sp.deviceRPC(ctx, device, "Script.PutCode", params, nil); err != nil {
+			return fmt.Errorf("failed to upload script: %w", err)
+		}
+	}
+	params := map[string]interface{}{"id": created.ID, "config": map[string]interface{}{"enable": true}}
+	if err := sp.deviceRPC(ctx, device, "Script.SetConfig", params, nil); err != nil {
+		return fmt.Errorf("failed to enable script: %w", err)
+	}
+	return nil
+}
+
+// deviceRPC calls a Gen2 RPC method on the device and decodes its result
+// into out, when given
+func (sp *ShellyProvisioner) deviceRPC(ctx context.Context, device UnprovisionedDevice, method string, params interface{}, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"id": 1, "method": method, "params": params})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request data: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/rpc", sp.deviceIP(device)), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sp.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var frame struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("device returned error %d: %s", resp.StatusCode, string(data))
+		}
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if frame.Error != nil {
+		return fmt.Errorf("%s failed: %s (code %d)", method, frame.Error.Message, frame.Error.Code)
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("device returned error %d: %s", resp.StatusCode, string(data))
+	}
+	if out != nil && len(frame.Result) > 0 {
+		if err := json.Unmarshal(frame.Result, out); err != nil {
+			return fmt.Errorf("invalid %s result: %w", method, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package provisioning
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestShellyProvisioner_InstallEnrollmentScript(t *testing.T) {
+	testutil.SkipIfNoSocketPermissions(t)
+	logger, _ := logging.New(logging.Config{Level: "error", Format: "text", Output: "stderr"})
+
+	var methods []string
+	var code strings.Builder
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		methods = append(methods, req.Method)
+		switch req.Method {
+		case "Script.Create":
+			_, _ = w.Write([]byte(`{"id":1,"result":{"id":3}}`))
+		case "Script.PutCode":
+			if req.Params["id"] != float64(3) || req.Params["append"] != (code.Len() > 0) {
+				t.Errorf("Unexpected PutCode params: %v", req.Params)
+			}
+			code.WriteString(req.Params["code"].(string))
+			_, _ = w.Write([]byte(`{"id":1,"result":{"len":1}}`))
+		default:
+			_, _ = w.Write([]byte(`{"id":1,"error":{"code":-103,"message":"Resource unavailable"}}`))
+		}
+	}))
+	defer device.Close()
+
+	sp := NewShellyProvisioner(logger, NewTestMockNetworkInterface(logger))
+	target := UnprovisionedDevice{SSID: "ShellyPlus1-AABBCC", IP: strings.TrimPrefix(device.URL, "http://"), Generation: 2}
+	// A long URL makes the script span two PutCode calls
+	url, token := "http://manager.lan:8080/enroll?site="+strings.Repeat("x", 200), strings.Repeat("ab", 24)
+
+	err := sp.installEnrollmentScript(context.Background(), target, url, token)
+	if err == nil || !strings.Contains(err.Error(), "Resource unavailable") {
+		t.Fatalf("Expected the SetConfig error reported, got %v", err)
+	}
+	if code.String() != EnrollmentScript(url, token) || code.Len() <= scriptChunkSize {
+		t.Errorf("Expected the script uploaded in chunks, got %d bytes", code.Len())
+	}
+	if methods[0] != "Script.Create" || methods[len(methods)-1] != "Script.SetConfig" {
+		t.Errorf("Unexpected calls: %v", methods)
+	}
+	if !strings.Contains(code.String(), `let enrollToken = "`+token+`";`) {
+		t.Errorf("Expected the token quoted in the script")
+	}
+
+	target.Generation = 1
+	if err := sp.installEnrollmentScript(context.Background(), target, url, token); err == nil {
+		t.Errorf("Expected Gen1 devices refused")
+	}
+}
@@ -424,6 +424,23 @@ func (ni *LinuxNetworkInterface) IsConnected(ctx context.Context, ssid string) (
 	return current.SSID == ssid, nil
 }
 
+// GetGatewayIP returns the IPv4 gateway of the WiFi device. Some device APs
+// hand out leases without a gateway; the first host of the leased subnet is
+// returned instead.
+func (ni *LinuxNetworkInterface) GetGatewayIP(ctx context.Context) (string, error) {
+	device := ni.GetInterfaceInfo().Name
+	if device == "" || device == "unknown" || device == "no-wifi-device" {
+		return "", fmt.Errorf("no WiFi device available")
+	}
+
+	cmd := exec.CommandContext(ctx, "nmcli", "-t", "-f", "IP4.GATEWAY,IP4.ADDRESS", "device", "show", device)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get IP configuration for %s: %w", device, err)
+	}
+	return parseGatewayOutput(string(output))
+}
+
 // CreateNetworkInterface creates a platform-specific network interface
 func CreateNetworkInterface(logger *logging.Logger) NetworkInterface {
 	return NewLinuxNetworkInterface(logger)
@@ -209,3 +209,11 @@ func CreateNetworkInterface(logger *logging.Logger) NetworkInterface {
 
 	return NewMockNetworkInterface(logger)
 }
+
+// GetGatewayIP returns the standard Shelly AP address when connected
+func (ni *MockNetworkInterface) GetGatewayIP(ctx context.Context) (string, error) {
+	if ni.currentNetwork == nil {
+		return "", fmt.Errorf("not connected")
+	}
+	return DefaultAPIP, nil
+}
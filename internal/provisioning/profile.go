@@ -0,0 +1,45 @@
+package provisioning
+
+// ApplyConfig sets the request fields present in a task or provisioning
+// profile configuration, keyed by their JSON names ("ssid", "password",
+// "mqtt_server", ...). Absent keys and values of the wrong type leave the
+// field unchanged.
+func (r *ProvisioningRequest) ApplyConfig(config map[string]interface{}) {
+	stringFields := map[string]*string{
+		"ssid":             &r.SSID,
+		"password":         &r.Password,
+		"device_name":      &r.DeviceName,
+		"auth_user":        &r.AuthUser,
+		"auth_password":    &r.AuthPassword,
+		"mqtt_server":      &r.MQTTServer,
+		"ntp_server":       &r.NTPServer,
+		"timezone":         &r.Timezone,
+		"ap_password":      &r.APPassword,
+		"ap_qr_code":       &r.APQRCode,
+		"enrollment_url":   &r.EnrollmentURL,
+		"enrollment_token": &r.EnrollmentToken,
+	}
+	for key, field := range stringFields {
+		if v, ok := config[key].(string); ok {
+			*field = v
+		}
+	}
+
+	boolFields := map[string]*bool{
+		"enable_auth":  &r.EnableAuth,
+		"enable_cloud": &r.EnableCloud,
+		"enable_mqtt":  &r.EnableMQTT,
+	}
+	for key, field := range boolFields {
+		if v, ok := config[key].(bool); ok {
+			*field = v
+		}
+	}
+
+	switch v := config["timeout"].(type) {
+	case float64:
+		r.Timeout = int(v)
+	case int:
+		r.Timeout = v
+	}
+}
@@ -33,7 +33,19 @@ type ProvisioningRequest struct {
 	EnableCloud  bool   `json:"enable_cloud"`
 	EnableMQTT   bool   `json:"enable_mqtt"`
 	MQTTServer   string `json:"mqtt_server"`
-	Timeout      int    `json:"timeout"` // seconds
+	NTPServer    string `json:"ntp_server,omitempty"`
+	Timezone     string `json:"timezone,omitempty"` // IANA name, e.g. Europe/Brussels
+	Timeout      int    `json:"timeout"`            // seconds
+
+	// Credentials for a secured device AP: an explicit password or the
+	// content of the WiFi QR code printed on the device label
+	APPassword string `json:"ap_password,omitempty"`
+	APQRCode   string `json:"ap_qr_code,omitempty"`
+
+	// Zero-touch enrollment: Gen2 and later devices get a script that
+	// presents the one-time token at the URL once on the target network
+	EnrollmentURL   string `json:"enrollment_url,omitempty"`
+	EnrollmentToken string `json:"enrollment_token,omitempty"`
 }
 
 // ProvisioningResult contains the outcome of a provisioning operation
@@ -228,6 +240,17 @@ func (pm *ProvisioningManager) ProvisionDevice(ctx context.Context, device Unpro
 		Steps:      make([]ProvisioningStep, 0),
 	}
 
+	// Resolve AP credentials from the request or configured per-device passwords
+	var credentials []config.APCredential
+	if pm.config != nil {
+		credentials = pm.config.Provisioning.APCredentials
+	}
+	apPassword, err := resolveAPPassword(device, request, credentials)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AP credentials: %w", err)
+	}
+	device.Password = apPassword
+
 	pm.currentDevice = &device
 	pm.currentRequest = &request
 	pm.currentResult = result
@@ -250,7 +273,7 @@ func (pm *ProvisioningManager) ProvisionDevice(ctx context.Context, device Unpro
 	}).Info("Starting device provisioning")
 
 	// Execute provisioning steps
-	err := pm.executeProvisioningWorkflow(ctx, device, request, result)
+	err = pm.executeProvisioningWorkflow(ctx, device, request, result)
 
 	// Finalize result
 	result.EndTime = time.Now()
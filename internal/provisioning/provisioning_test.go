@@ -505,3 +505,23 @@ func ExampleProvisioningManager() {
 
 	// Example output: Found 3 unprovisioned devices
 }
+
+func TestProvisioningRequest_ApplyConfig(t *testing.T) {
+	request := ProvisioningRequest{SSID: "Home", AuthUser: "admin", Timeout: 300}
+	request.ApplyConfig(map[string]interface{}{
+		"password":    "secret",
+		"enable_mqtt": true,
+		"mqtt_server": "10.0.0.5:1883",
+		"timezone":    "Europe/Brussels",
+		"timeout":     float64(120),
+		"auth_user":   42, // wrong type, ignored
+	})
+
+	if request.SSID != "Home" || request.AuthUser != "admin" {
+		t.Errorf("Expected absent and mistyped keys to keep their fields, got %+v", request)
+	}
+	if request.Password != "secret" || !request.EnableMQTT || request.MQTTServer != "10.0.0.5:1883" ||
+		request.Timezone != "Europe/Brussels" || request.Timeout != 120 {
+		t.Errorf("Expected configured fields to be set, got %+v", request)
+	}
+}
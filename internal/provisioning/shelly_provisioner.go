@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ginsys/shelly-manager/internal/logging"
@@ -19,6 +20,10 @@ type ShellyProvisioner struct {
 	logger     *logging.Logger
 	httpClient *http.Client
 	netIface   NetworkInterface
+
+	// Device API addresses located after joining each AP, keyed by SSID
+	mu    sync.RWMutex
+	apIPs map[string]string
 }
 
 // NewShellyProvisioner creates a new Shelly device provisioner
@@ -26,6 +31,7 @@ func NewShellyProvisioner(logger *logging.Logger, netIface NetworkInterface) *Sh
 	return &ShellyProvisioner{
 		logger:   logger,
 		netIface: netIface,
+		apIPs:    make(map[string]string),
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
@@ -264,7 +270,7 @@ func (sp *ShellyProvisioner) identifyShellyDevice(ctx context.Context, network W
 		Password:   defaultPassword,
 		Model:      model,
 		Generation: generation,
-		IP:         "192.168.33.1", // Standard Shelly AP IP
+		IP:         DefaultAPIP, // Confirmed or corrected after joining the AP
 		Signal:     network.Signal,
 		Discovered: time.Now(),
 	}
@@ -366,27 +372,29 @@ func (sp *ShellyProvisioner) ConnectToDeviceAP(ctx context.Context, device Unpro
 			"component":   "shelly_provisioner",
 			"device_ssid": device.SSID,
 		}).Debug("Already connected to device AP")
-		return nil
-	}
+	} else {
+		// Connect to the device AP
+		if err := sp.netIface.ConnectToNetwork(ctx, device.SSID, device.Password); err != nil {
+			return fmt.Errorf("failed to connect to device AP %s: %w", device.SSID, err)
+		}
 
-	// Connect to the device AP
-	err := sp.netIface.ConnectToNetwork(ctx, device.SSID, device.Password)
-	if err != nil {
-		return fmt.Errorf("failed to connect to device AP %s: %w", device.SSID, err)
+		// Wait a moment for connection to stabilize
+		time.Sleep(2 * time.Second)
 	}
 
-	// Wait a moment for connection to stabilize
-	time.Sleep(2 * time.Second)
-
-	// Verify connection by trying to reach the device
-	if err := sp.pingDevice(ctx, device.IP); err != nil {
+	// Locate the device API; the AP gateway is not always the default address
+	ip, err := sp.locateDeviceAPI(ctx, device)
+	if err != nil {
 		return fmt.Errorf("device not reachable after connecting to AP: %w", err)
 	}
+	sp.mu.Lock()
+	sp.apIPs[device.SSID] = ip
+	sp.mu.Unlock()
 
 	sp.logger.WithFields(map[string]any{
 		"component":   "shelly_provisioner",
 		"device_ssid": device.SSID,
-		"device_ip":   device.IP,
+		"device_ip":   ip,
 	}).Info("Successfully connected to device AP")
 
 	return nil
@@ -410,7 +418,7 @@ func (sp *ShellyProvisioner) ConfigureWiFi(ctx context.Context, device Unprovisi
 // configureGen1WiFi configures WiFi for Gen1 devices
 func (sp *ShellyProvisioner) configureGen1WiFi(ctx context.Context, device UnprovisionedDevice, request ProvisioningRequest) error {
 	// Gen1 devices use /settings/sta endpoint
-	url := fmt.Sprintf("http://%s/settings/sta", device.IP)
+	url := fmt.Sprintf("http://%s/settings/sta", sp.deviceIP(device))
 
 	params := map[string]interface{}{
 		"enabled": true,
@@ -424,7 +432,7 @@ func (sp *ShellyProvisioner) configureGen1WiFi(ctx context.Context, device Unpro
 // configureGen2WiFi configures WiFi for Gen2+ devices
 func (sp *ShellyProvisioner) configureGen2WiFi(ctx context.Context, device UnprovisionedDevice, request ProvisioningRequest) error {
 	// Gen2+ devices use RPC-style API
-	url := fmt.Sprintf("http://%s/rpc", device.IP)
+	url := fmt.Sprintf("http://%s/rpc", sp.deviceIP(device))
 
 	rpcRequest := map[string]interface{}{
 		"id":     1,
@@ -492,19 +500,42 @@ func (sp *ShellyProvisioner) ConfigureDevice(ctx context.Context, device Unprovi
 		}).Warn("Failed to configure cloud settings")
 	}
 
+	// Configure time settings if requested
+	if request.NTPServer != "" || request.Timezone != "" {
+		if err := sp.configureTime(ctx, device, request.NTPServer, request.Timezone); err != nil {
+			sp.logger.WithFields(map[string]any{
+				"component":  "shelly_provisioner",
+				"device_mac": device.MAC,
+				"error":      err.Error(),
+			}).Warn("Failed to configure time settings")
+		}
+	}
+
+	// Install the call-home script of zero-touch enrollment; without it the
+	// task is only confirmed by the agent
+	if request.EnrollmentURL != "" && request.EnrollmentToken != "" {
+		if err := sp.installEnrollmentScript(ctx, device, request.EnrollmentURL, request.EnrollmentToken); err != nil {
+			sp.logger.WithFields(map[string]any{
+				"component":  "shelly_provisioner",
+				"device_mac": device.MAC,
+				"error":      err.Error(),
+			}).Warn("Failed to install enrollment script")
+		}
+	}
+
 	return nil
 }
 
 // setDeviceName sets the device name
 func (sp *ShellyProvisioner) setDeviceName(ctx context.Context, device UnprovisionedDevice, name string) error {
 	if device.Generation == 1 {
-		url := fmt.Sprintf("http://%s/settings", device.IP)
+		url := fmt.Sprintf("http://%s/settings", sp.deviceIP(device))
 		params := map[string]interface{}{
 			"name": name,
 		}
 		return sp.makeDeviceRequest(ctx, "POST", url, params)
 	} else {
-		url := fmt.Sprintf("http://%s/rpc", device.IP)
+		url := fmt.Sprintf("http://%s/rpc", sp.deviceIP(device))
 		rpcRequest := map[string]interface{}{
 			"id":     1,
 			"method": "Sys.SetConfig",
@@ -523,7 +554,7 @@ func (sp *ShellyProvisioner) setDeviceName(ctx context.Context, device Unprovisi
 // configureAuth configures device authentication
 func (sp *ShellyProvisioner) configureAuth(ctx context.Context, device UnprovisionedDevice, user, password string) error {
 	if device.Generation == 1 {
-		url := fmt.Sprintf("http://%s/settings/login", device.IP)
+		url := fmt.Sprintf("http://%s/settings/login", sp.deviceIP(device))
 		params := map[string]interface{}{
 			"enabled":  true,
 			"username": user,
@@ -539,7 +570,7 @@ func (sp *ShellyProvisioner) configureAuth(ctx context.Context, device Unprovisi
 // configureMQTT configures MQTT settings
 func (sp *ShellyProvisioner) configureMQTT(ctx context.Context, device UnprovisionedDevice, server string) error {
 	if device.Generation == 1 {
-		url := fmt.Sprintf("http://%s/settings", device.IP)
+		url := fmt.Sprintf("http://%s/settings", sp.deviceIP(device))
 		params := map[string]interface{}{
 			"mqtt_server": server,
 			"mqtt_enable": true,
@@ -554,7 +585,7 @@ func (sp *ShellyProvisioner) configureMQTT(ctx context.Context, device Unprovisi
 // configureCloud configures cloud connectivity
 func (sp *ShellyProvisioner) configureCloud(ctx context.Context, device UnprovisionedDevice, enable bool) error {
 	if device.Generation == 1 {
-		url := fmt.Sprintf("http://%s/settings", device.IP)
+		url := fmt.Sprintf("http://%s/settings", sp.deviceIP(device))
 		params := map[string]interface{}{
 			"cloud_enabled": enable,
 		}
@@ -565,6 +596,38 @@ func (sp *ShellyProvisioner) configureCloud(ctx context.Context, device Unprovis
 	}
 }
 
+// configureTime sets the NTP server and timezone; empty values are left
+// unchanged
+func (sp *ShellyProvisioner) configureTime(ctx context.Context, device UnprovisionedDevice, ntpServer, timezone string) error {
+	if device.Generation == 1 {
+		url := fmt.Sprintf("http://%s/settings", sp.deviceIP(device))
+		params := map[string]interface{}{}
+		if ntpServer != "" {
+			params["sntp_server"] = ntpServer
+		}
+		if timezone != "" {
+			params["tz_autodetect"] = false
+			params["timezone"] = timezone
+		}
+		return sp.makeDeviceRequest(ctx, "POST", url, params)
+	}
+
+	config := map[string]interface{}{}
+	if ntpServer != "" {
+		config["sntp"] = map[string]interface{}{"server": ntpServer}
+	}
+	if timezone != "" {
+		config["location"] = map[string]interface{}{"tz": timezone}
+	}
+	url := fmt.Sprintf("http://%s/rpc", sp.deviceIP(device))
+	rpcRequest := map[string]interface{}{
+		"id":     1,
+		"method": "Sys.SetConfig",
+		"params": map[string]interface{}{"config": config},
+	}
+	return sp.makeDeviceRequest(ctx, "POST", url, rpcRequest)
+}
+
 // RebootDevice reboots the device to apply new configuration
 func (sp *ShellyProvisioner) RebootDevice(ctx context.Context, device UnprovisionedDevice) error {
 	sp.logger.WithFields(map[string]any{
@@ -573,10 +636,10 @@ func (sp *ShellyProvisioner) RebootDevice(ctx context.Context, device Unprovisio
 	}).Info("Rebooting device to apply configuration")
 
 	if device.Generation == 1 {
-		url := fmt.Sprintf("http://%s/reboot", device.IP)
+		url := fmt.Sprintf("http://%s/reboot", sp.deviceIP(device))
 		return sp.makeDeviceRequest(ctx, "GET", url, nil)
 	} else {
-		url := fmt.Sprintf("http://%s/rpc", device.IP)
+		url := fmt.Sprintf("http://%s/rpc", sp.deviceIP(device))
 		rpcRequest := map[string]interface{}{
 			"id":     1,
 			"method": "Shelly.Reboot",
@@ -623,33 +686,6 @@ func (sp *ShellyProvisioner) VerifyProvisioning(ctx context.Context, device Unpr
 	return result, nil
 }
 
-// pingDevice checks if a device is reachable
-func (sp *ShellyProvisioner) pingDevice(ctx context.Context, ip string) error {
-	url := fmt.Sprintf("http://%s/shelly", ip)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return err
-	}
-
-	resp, err := sp.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			// Log error if possible but continue
-			_ = err
-		}
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("device returned status %d", resp.StatusCode)
-	}
-
-	return nil
-}
-
 // makeDeviceRequest makes an HTTP request to a Shelly device
 func (sp *ShellyProvisioner) makeDeviceRequest(ctx context.Context, method, url string, params interface{}) error {
 	var body io.Reader
@@ -0,0 +1,286 @@
+// Package auth signs users in through external identity providers (OpenID
+// Connect) and gives them a role from their groups. Authenticated requests
+// carry a Principal in their context; the admin API key keeps working
+// alongside for automation.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+var (
+	// ErrInvalidToken is returned for bearer tokens or sessions that fail
+	// validation
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrNoRole is returned for users in none of the mapped groups when no
+	// default role is configured
+	ErrNoRole = errors.New("user has no role")
+)
+
+// Identity is a user as an identity provider describes them
+type Identity struct {
+	Subject   string
+	Username  string
+	Email     string
+	Groups    []string
+	ExpiresAt time.Time
+}
+
+// Principal is the signed-in user of a request
+type Principal struct {
+	Subject   string    `json:"subject"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email,omitempty"`
+	Groups    []string  `json:"groups,omitempty"`
+	Role      string    `json:"role"`
+	Backend   string    `json:"backend"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IsAdmin reports whether the principal may use the admin endpoints
+func (p *Principal) IsAdmin() bool {
+	return p != nil && p.Role == config.RoleAdmin
+}
+
+// CanWrite reports whether the principal may change anything
+func (p *Principal) CanWrite() bool {
+	return p != nil && (p.Role == config.RoleOperator || p.Role == config.RoleAdmin)
+}
+
+// Backend validates the bearer tokens of an identity provider
+type Backend interface {
+	Name() string
+	VerifyToken(ctx context.Context, token string) (*Identity, error)
+}
+
+// Authenticator resolves the principal of API requests from bearer tokens
+// and browser sessions
+type Authenticator struct {
+	cfg      config.AuthConfig
+	oidc     *OIDCProvider
+	backends []Backend
+	sessions *SessionStore
+	logger   *logging.Logger
+	now      func() time.Time
+}
+
+// New creates an authenticator for the enabled backends; sessions are kept
+// in db so every instance of a cluster accepts them
+func New(cfg config.AuthConfig, db *gorm.DB, logger *logging.Logger) (*Authenticator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.SessionTTL == 0 {
+		cfg.SessionTTL = config.DefaultAuthSessionTTL
+	}
+	if cfg.SessionCookie == "" {
+		cfg.SessionCookie = config.DefaultAuthSessionCookie
+	}
+	sessions, err := NewSessionStore(db)
+	if err != nil {
+		return nil, err
+	}
+	a := &Authenticator{cfg: cfg, sessions: sessions, logger: logger, now: time.Now}
+	if cfg.OIDC.Enabled {
+		a.oidc = NewOIDCProvider(cfg.OIDC, nil)
+		a.backends = append(a.backends, a.oidc)
+	}
+	return a, nil
+}
+
+// OIDC returns the OpenID Connect provider, nil when it is disabled
+func (a *Authenticator) OIDC() *OIDCProvider {
+	return a.oidc
+}
+
+// Required reports whether anonymous API requests are refused
+func (a *Authenticator) Required() bool {
+	return a.cfg.Required
+}
+
+// Role returns the highest role mapped to any of groups, or the default role
+func (a *Authenticator) Role(groups []string) string {
+	rank := map[string]int{config.RoleViewer: 1, config.RoleOperator: 2, config.RoleAdmin: 3}
+	role := ""
+	for _, m := range a.cfg.RoleMappings {
+		for _, g := range groups {
+			if g == m.Group && rank[m.Role] > rank[role] {
+				role = m.Role
+			}
+		}
+	}
+	if role == "" {
+		role = a.cfg.DefaultRole
+	}
+	return role
+}
+
+// Principal gives an identity its role
+func (a *Authenticator) Principal(id *Identity, backend string) (*Principal, error) {
+	role := a.Role(id.Groups)
+	if role == "" {
+		return nil, fmt.Errorf("%w: %s is in none of the mapped groups", ErrNoRole, id.Username)
+	}
+	return &Principal{
+		Subject:   id.Subject,
+		Username:  id.Username,
+		Email:     id.Email,
+		Groups:    id.Groups,
+		Role:      role,
+		Backend:   backend,
+		ExpiresAt: id.ExpiresAt,
+	}, nil
+}
+
+// Authenticate returns the principal of a request from its bearer token or
+// session cookie. Requests with neither, or with a bearer token that is not
+// a JWT (such as the admin API key), have no principal.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && LooksLikeJWT(token) {
+		var lastErr error
+		for _, b := range a.backends {
+			id, err := b.VerifyToken(r.Context(), token)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			return a.Principal(id, b.Name())
+		}
+		if lastErr == nil {
+			lastErr = ErrInvalidToken
+		}
+		return nil, lastErr
+	}
+	if cookie, err := r.Cookie(a.cfg.SessionCookie); err == nil && cookie.Value != "" {
+		return a.sessions.Get(cookie.Value, a.now())
+	}
+	return nil, nil
+}
+
+// StartSession stores a browser session for the principal and sets its
+// cookie
+func (a *Authenticator) StartSession(w http.ResponseWriter, p *Principal) error {
+	p.ExpiresAt = a.now().Add(time.Duration(a.cfg.SessionTTL) * time.Second)
+	token, err := a.sessions.Create(p, a.now())
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, a.cookie(a.cfg.SessionCookie, token, p.ExpiresAt))
+	return nil
+}
+
+// EndSession deletes the request's browser session and clears its cookie
+func (a *Authenticator) EndSession(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, a.cookie(a.cfg.SessionCookie, "", time.Unix(0, 0)))
+	cookie, err := r.Cookie(a.cfg.SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	return a.sessions.Delete(cookie.Value)
+}
+
+// cookie builds an HttpOnly cookie for the whole site
+func (a *Authenticator) cookie(name, value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   !a.cfg.InsecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// LooksLikeJWT reports whether a token has the three dot-separated parts of
+// a JWT, telling SSO tokens from API keys
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && !strings.Contains(token, " ")
+}
+
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	enabledKey
+)
+
+// WithPrincipal returns a context carrying the signed-in user
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// FromContext returns the signed-in user of a request, nil when anonymous
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey).(*Principal)
+	return p
+}
+
+// Requester names who made a request for audit records: the signed-in
+// user, or else the explicit, non-secret audit identity headers.
+func Requester(r *http.Request) string {
+	if p := FromContext(r.Context()); p != nil && p.Username != "" {
+		return p.Username
+	}
+	if v := strings.TrimSpace(r.Header.Get("X-User-ID")); v != "" {
+		return v
+	}
+	if v := strings.TrimSpace(r.Header.Get("X-User")); v != "" {
+		return v
+	}
+	return "api"
+}
+
+// WithEnabled marks a request as handled with single sign-on enabled
+func WithEnabled(ctx context.Context) context.Context {
+	return context.WithValue(ctx, enabledKey, true)
+}
+
+// Enabled reports whether single sign-on handled the request
+func Enabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(enabledKey).(bool)
+	return enabled
+}
+
+// AdminKeyOK reports whether a request carries the admin API key, as a
+// bearer token or in X-API-Key
+func AdminKeyOK(r *http.Request, key string) bool {
+	if key == "" {
+		return false
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token == key {
+		return true
+	}
+	return r.Header.Get("X-API-Key") == key
+}
+
+// AdminAccess decides whether a request may use an admin endpoint and
+// returns http.StatusOK, StatusUnauthorized or StatusForbidden. keyOK
+// reports whether the request carried the admin API key, keySet whether one
+// is configured. Signed-in users need the admin role; without a key and
+// without single sign-on the admin endpoints stay open.
+func AdminAccess(r *http.Request, keySet, keyOK bool) int {
+	if keyOK {
+		return http.StatusOK
+	}
+	if p := FromContext(r.Context()); p != nil {
+		if p.IsAdmin() {
+			return http.StatusOK
+		}
+		return http.StatusForbidden
+	}
+	if !keySet && !Enabled(r.Context()) {
+		return http.StatusOK
+	}
+	return http.StatusUnauthorized
+}
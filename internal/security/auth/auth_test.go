@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+// fakeProvider is an OpenID Connect provider signing with one RSA key
+type fakeProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// idClaims are returned as the ID token of a code exchange
+	idClaims map[string]interface{}
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &fakeProvider{t: t, key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.Form.Get("code") != "good-code" || r.Form.Get("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "opaque-access-token",
+			"token_type":   "Bearer",
+			"id_token":     p.sign(p.idClaims),
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// sign issues an RS256 JWT with the provider's key
+func (p *fakeProvider) sign(claims map[string]interface{}) string {
+	enc := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		require.NoError(p.t, err)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(map[string]string{"alg": "RS256", "kid": "k1", "typ": "JWT"}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	require.NoError(p.t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// claims returns valid claims for the client, overridden by extra
+func (p *fakeProvider) claims(extra map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{
+		"iss":                p.server.URL,
+		"aud":                "shelly-manager",
+		"sub":                "user-1",
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"groups":             []string{"staff"},
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range extra {
+		c[k] = v
+	}
+	return c
+}
+
+func newTestAuthenticator(t *testing.T, p *fakeProvider, required bool) *Authenticator {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text", Output: "stdout"})
+	require.NoError(t, err)
+	cfg := config.AuthConfig{
+		Required: required,
+		RoleMappings: []config.AuthRoleMapping{
+			{Group: "staff", Role: config.RoleViewer},
+			{Group: "ops", Role: config.RoleOperator},
+			{Group: "shelly-admins", Role: config.RoleAdmin},
+		},
+		InsecureCookies: true,
+		OIDC: config.OIDCConfig{
+			Enabled:       true,
+			Issuer:        p.server.URL,
+			ClientID:      "shelly-manager",
+			RedirectURL:   "http://manager.test/api/v1/auth/oidc/callback",
+			UsernameClaim: config.DefaultOIDCUsernameClaim,
+		},
+	}
+	a, err := New(cfg, db, logger)
+	require.NoError(t, err)
+	return a
+}
+
+func TestRoleMapping(t *testing.T) {
+	a := newTestAuthenticator(t, newFakeProvider(t), false)
+
+	assert.Equal(t, config.RoleViewer, a.Role([]string{"staff"}))
+	assert.Equal(t, config.RoleAdmin, a.Role([]string{"staff", "shelly-admins", "ops"}))
+	assert.Equal(t, "", a.Role([]string{"guests"}))
+
+	_, err := a.Principal(&Identity{Username: "bob", Groups: []string{"guests"}}, BackendOIDC)
+	assert.ErrorIs(t, err, ErrNoRole)
+
+	a.cfg.DefaultRole = config.RoleViewer
+	assert.Equal(t, config.RoleViewer, a.Role(nil))
+}
+
+func TestAuthenticateBearerToken(t *testing.T) {
+	p := newFakeProvider(t)
+	a := newTestAuthenticator(t, p, false)
+
+	request := func(token string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/devices", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return r
+	}
+
+	principal, err := a.Authenticate(request(p.sign(p.claims(map[string]interface{}{"groups": []string{"ops"}}))))
+	require.NoError(t, err)
+	require.NotNil(t, principal)
+	assert.Equal(t, "alice", principal.Username)
+	assert.Equal(t, config.RoleOperator, principal.Role)
+	assert.True(t, principal.CanWrite())
+	assert.False(t, principal.IsAdmin())
+
+	for name, claims := range map[string]map[string]interface{}{
+		"expired":        p.claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}),
+		"wrong audience": p.claims(map[string]interface{}{"aud": "someone-else"}),
+		"wrong issuer":   p.claims(map[string]interface{}{"iss": "https://evil.example.com"}),
+	} {
+		_, err := a.Authenticate(request(p.sign(claims)))
+		assert.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+
+	// Tampered payload fails the signature check
+	token := p.sign(p.claims(nil))
+	parts := strings.Split(token, ".")
+	forged, _ := json.Marshal(p.claims(map[string]interface{}{"groups": []string{"shelly-admins"}}))
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+	_, err = a.Authenticate(request(strings.Join(parts, ".")))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// API keys and anonymous requests have no principal
+	principal, err = a.Authenticate(request("plain-admin-key"))
+	assert.NoError(t, err)
+	assert.Nil(t, principal)
+	principal, err = a.Authenticate(request(""))
+	assert.NoError(t, err)
+	assert.Nil(t, principal)
+}
+
+func TestNestedGroupsClaim(t *testing.T) {
+	p := newFakeProvider(t)
+	provider := NewOIDCProvider(config.OIDCConfig{
+		Issuer:      p.server.URL,
+		ClientID:    "shelly-manager",
+		GroupsClaim: "realm_access.roles",
+	}, nil)
+	id, err := provider.VerifyToken(context.Background(), p.sign(p.claims(map[string]interface{}{
+		"realm_access": map[string]interface{}{"roles": []string{"shelly-admins"}},
+	})))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shelly-admins"}, id.Groups)
+	assert.Equal(t, "alice@example.com", id.Username)
+}
+
+func TestBrowserLoginAndSession(t *testing.T) {
+	p := newFakeProvider(t)
+	a := newTestAuthenticator(t, p, true)
+
+	// Start the sign-in
+	w := httptest.NewRecorder()
+	target, err := a.BeginLogin(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil), "/devices")
+	require.NoError(t, err)
+	authURL, err := url.Parse(target)
+	require.NoError(t, err)
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+	loginCookies := w.Result().Cookies()
+	require.Len(t, loginCookies, 1)
+
+	// The provider sends the browser back with the code
+	p.idClaims = p.claims(map[string]interface{}{
+		"nonce":  authURL.Query().Get("nonce"),
+		"groups": []string{"shelly-admins"},
+	})
+	callback := func(state string) (*Principal, string, *httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?code=good-code&state="+state, nil)
+		r.AddCookie(loginCookies[0])
+		w := httptest.NewRecorder()
+		principal, returnTo, err := a.CompleteLogin(w, r)
+		return principal, returnTo, w, err
+	}
+
+	_, _, _, err = callback("forged-state")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	principal, returnTo, w, err := callback(authURL.Query().Get("state"))
+	require.NoError(t, err)
+	assert.Equal(t, "/devices", returnTo)
+	assert.True(t, principal.IsAdmin())
+
+	var session *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == config.DefaultAuthSessionCookie {
+			session = c
+		}
+	}
+	require.NotNil(t, session)
+	assert.True(t, session.HttpOnly)
+
+	// The session cookie authenticates later requests until logout
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/devices", nil)
+	r.AddCookie(session)
+	got, err := a.Authenticate(r)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.Username)
+	assert.Equal(t, []string{"shelly-admins"}, got.Groups)
+
+	require.NoError(t, a.EndSession(httptest.NewRecorder(), r))
+	_, err = a.Authenticate(r)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestAdminAccess(t *testing.T) {
+	anonymous := httptest.NewRequest(http.MethodPost, "/api/v1/admin/rotate-admin-key", nil)
+	assert.Equal(t, http.StatusOK, AdminAccess(anonymous, false, false))
+	assert.Equal(t, http.StatusUnauthorized, AdminAccess(anonymous, true, false))
+	assert.Equal(t, http.StatusOK, AdminAccess(anonymous, true, true))
+
+	sso := anonymous.WithContext(WithEnabled(anonymous.Context()))
+	assert.Equal(t, http.StatusUnauthorized, AdminAccess(sso, false, false))
+
+	viewer := sso.WithContext(WithPrincipal(sso.Context(), &Principal{Role: config.RoleViewer}))
+	assert.Equal(t, http.StatusForbidden, AdminAccess(viewer, false, false))
+	admin := sso.WithContext(WithPrincipal(sso.Context(), &Principal{Role: config.RoleAdmin}))
+	assert.Equal(t, http.StatusOK, AdminAccess(admin, true, false))
+}
+
+func TestSafeReturnPath(t *testing.T) {
+	assert.Equal(t, "/devices?x=1", SafeReturnPath("/devices?x=1"))
+	for _, bad := range []string{"", "https://evil.example.com", "//evil.example.com", "/\\evil.example.com"} {
+		assert.Equal(t, "/", SafeReturnPath(bad), bad)
+	}
+}
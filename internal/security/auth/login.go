@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// loginCookie carries a started browser sign-in back to the callback
+const (
+	loginCookie = "shelly_oidc_login"
+	loginTTL    = 10 * time.Minute
+)
+
+// BeginLogin starts an OpenID Connect sign-in: it remembers the state,
+// nonce and PKCE verifier in a short-lived cookie and returns the provider
+// URL to redirect the browser to. returnTo is where the callback sends the
+// user afterwards; only local paths are kept.
+func (a *Authenticator) BeginLogin(w http.ResponseWriter, r *http.Request, returnTo string) (string, error) {
+	if a.oidc == nil {
+		return "", fmt.Errorf("OIDC sign-in is not enabled")
+	}
+	login, err := a.oidc.StartLogin(r.Context())
+	if err != nil {
+		return "", err
+	}
+	value := strings.Join([]string{
+		login.State,
+		login.Nonce,
+		login.Verifier,
+		base64.RawURLEncoding.EncodeToString([]byte(SafeReturnPath(returnTo))),
+	}, ".")
+	http.SetCookie(w, a.cookie(loginCookie, value, a.now().Add(loginTTL)))
+	return login.URL, nil
+}
+
+// CompleteLogin finishes a sign-in at the OIDC callback: it checks the
+// state, redeems the code, starts a session and returns the path to send
+// the user to
+func (a *Authenticator) CompleteLogin(w http.ResponseWriter, r *http.Request) (*Principal, string, error) {
+	if a.oidc == nil {
+		return nil, "", fmt.Errorf("OIDC sign-in is not enabled")
+	}
+	cookie, err := r.Cookie(loginCookie)
+	http.SetCookie(w, a.cookie(loginCookie, "", time.Unix(0, 0)))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: no sign-in in progress", ErrInvalidToken)
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 4 || parts[0] == "" || parts[0] != r.URL.Query().Get("state") {
+		return nil, "", fmt.Errorf("%w: state mismatch", ErrInvalidToken)
+	}
+	if e := r.URL.Query().Get("error"); e != "" {
+		return nil, "", fmt.Errorf("identity provider refused sign-in: %s %s", e, r.URL.Query().Get("error_description"))
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		return nil, "", fmt.Errorf("%w: no authorization code", ErrInvalidToken)
+	}
+	id, err := a.oidc.Exchange(r.Context(), code, parts[2], parts[1])
+	if err != nil {
+		return nil, "", err
+	}
+	p, err := a.Principal(id, BackendOIDC)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := a.StartSession(w, p); err != nil {
+		return nil, "", err
+	}
+	returnTo, _ := base64.RawURLEncoding.DecodeString(parts[3])
+	return p, SafeReturnPath(string(returnTo)), nil
+}
+
+// SafeReturnPath keeps local absolute paths and falls back to "/", so the
+// sign-in cannot redirect to another site
+func SafeReturnPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+)
+
+// BackendOIDC names the OpenID Connect backend in principals
+const BackendOIDC = "oidc"
+
+// signingAlgs are the algorithms accepted on tokens: the asymmetric ones
+// identity providers sign with
+var signingAlgs = []string{
+	oidc.RS256, oidc.RS384, oidc.RS512,
+	oidc.ES256, oidc.ES384, oidc.ES512,
+	oidc.PS256, oidc.PS384, oidc.PS512,
+}
+
+// OIDCProvider signs users in with the authorization code flow and verifies
+// bearer tokens against the provider's signing keys. Discovery and key
+// handling are left to go-oidc; the discovery document is fetched on first
+// use.
+type OIDCProvider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDCProvider creates a provider; a nil client uses a client with a
+// 10 second timeout
+func NewOIDCProvider(cfg config.OIDCConfig, client *http.Client) *OIDCProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = config.DefaultOIDCGroupsClaim
+	}
+	return &OIDCProvider{cfg: cfg, client: client, now: time.Now}
+}
+
+// Name implements Backend
+func (p *OIDCProvider) Name() string {
+	return BackendOIDC
+}
+
+// LoginRequest is a started sign-in: the provider URL to redirect to and
+// the values to check when the user comes back
+type LoginRequest struct {
+	URL      string
+	State    string
+	Nonce    string
+	Verifier string // PKCE code verifier
+}
+
+// StartLogin builds the authorization URL of a new sign-in
+func (p *OIDCProvider) StartLogin(ctx context.Context) (*LoginRequest, error) {
+	oauth, err := p.oauthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	login := &LoginRequest{State: randomToken(), Nonce: randomToken(), Verifier: oauth2.GenerateVerifier()}
+	login.URL = oauth.AuthCodeURL(login.State, oidc.Nonce(login.Nonce), oauth2.S256ChallengeOption(login.Verifier))
+	return login, nil
+}
+
+// Exchange redeems an authorization code and returns the user of its ID
+// token, which must carry the nonce of the sign-in
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	oauth, err := p.oauthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := oauth.Exchange(p.clientContext(ctx), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	raw, _ := token.Extra("id_token").(string)
+	if raw == "" {
+		return nil, fmt.Errorf("token exchange failed: no id_token in response")
+	}
+	idToken, claims, err := p.verify(ctx, raw, []string{p.cfg.ClientID})
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	return p.identity(claims), nil
+}
+
+// VerifyToken implements Backend: it accepts ID and access tokens issued
+// for the client ID or one of the configured audiences
+func (p *OIDCProvider) VerifyToken(ctx context.Context, token string) (*Identity, error) {
+	_, claims, err := p.verify(ctx, token, append([]string{p.cfg.ClientID}, p.cfg.Audiences...))
+	if err != nil {
+		return nil, err
+	}
+	return p.identity(claims), nil
+}
+
+// verify checks a JWT's signature, issuer and lifetime with go-oidc, and
+// its audience against audiences, which go-oidc limits to one client ID
+func (p *OIDCProvider) verify(ctx context.Context, raw string, audiences []string) (*oidc.IDToken, map[string]interface{}, error) {
+	provider, err := p.getProvider(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	verifier := provider.Verifier(&oidc.Config{
+		SkipClientIDCheck:    true,
+		SupportedSigningAlgs: signingAlgs,
+		Now:                  p.now,
+	})
+	token, err := verifier.Verify(p.clientContext(ctx), raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !slices.ContainsFunc(token.Audience, func(aud string) bool {
+		return slices.Contains(audiences, aud)
+	}) {
+		return nil, nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	var claims map[string]interface{}
+	if err := token.Claims(&claims); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return token, claims, nil
+}
+
+// identity reads the user from verified claims
+func (p *OIDCProvider) identity(claims map[string]interface{}) *Identity {
+	id := &Identity{Groups: stringList(claimPath(claims, p.cfg.GroupsClaim))}
+	id.Subject, _ = claims["sub"].(string)
+	id.Email, _ = claims["email"].(string)
+	if p.cfg.UsernameClaim != "" {
+		id.Username, _ = claimPath(claims, p.cfg.UsernameClaim).(string)
+	}
+	if id.Username == "" {
+		id.Username = id.Email
+	}
+	if id.Username == "" {
+		id.Username = id.Subject
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		id.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return id
+}
+
+// oauthConfig returns the OAuth2 client of the browser sign-in
+func (p *OIDCProvider) oauthConfig(ctx context.Context) (*oauth2.Config, error) {
+	provider, err := p.getProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("auth.oidc.redirect_url is required for browser sign-in")
+	}
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.cfg.Scopes,
+	}, nil
+}
+
+// getProvider discovers the provider once. go-oidc keeps the context it is
+// discovered with for fetching signing keys later, so the discovery does
+// not run under the (short-lived) request context.
+func (p *OIDCProvider) getProvider(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != nil {
+		return p.provider, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	provider, err := oidc.NewProvider(p.clientContext(context.Background()), strings.TrimSuffix(p.cfg.Issuer, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	p.provider = provider
+	return p.provider, nil
+}
+
+// clientContext makes go-oidc and oauth2 use the provider's HTTP client
+func (p *OIDCProvider) clientContext(ctx context.Context) context.Context {
+	return oidc.ClientContext(ctx, p.client)
+}
+
+// claimPath reads a claim by a dotted path such as "realm_access.roles"
+func claimPath(claims map[string]interface{}, path string) interface{} {
+	if v, ok := claims[path]; ok {
+		return v
+	}
+	var cur interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+// stringList reads a claim that is a string or a list of strings
+func stringList(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		if t == "" {
+			return nil
+		}
+		return []string{t}
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// randomToken returns 32 random bytes, URL-safe encoded
+func randomToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is a browser session of a signed-in user. Only the hash of the
+// cookie value is stored, so the table cannot be replayed.
+type Session struct {
+	ID        string    `gorm:"primaryKey;size:64"` // SHA-256 of the session cookie
+	Subject   string    `gorm:"size:191"`
+	Username  string    `gorm:"size:191;index"`
+	Email     string    `gorm:"size:191"`
+	Groups    string    `gorm:"type:text"` // JSON list
+	Role      string    `gorm:"size:16"`
+	Backend   string    `gorm:"size:16"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// TableName keeps sessions apart from other tables
+func (Session) TableName() string {
+	return "auth_sessions"
+}
+
+// SessionStore keeps browser sessions in the database
+type SessionStore struct {
+	db *gorm.DB
+}
+
+// NewSessionStore creates the sessions table when needed
+func NewSessionStore(db *gorm.DB) (*SessionStore, error) {
+	if err := db.AutoMigrate(&Session{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate sessions: %w", err)
+	}
+	return &SessionStore{db: db}, nil
+}
+
+// Create stores a session for the principal, until its ExpiresAt, and
+// returns the cookie value. Expired sessions are removed on the way.
+func (s *SessionStore) Create(p *Principal, now time.Time) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate session: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	groups, err := json.Marshal(p.Groups)
+	if err != nil {
+		return "", err
+	}
+	session := Session{
+		ID:        sessionID(token),
+		Subject:   p.Subject,
+		Username:  p.Username,
+		Email:     p.Email,
+		Groups:    string(groups),
+		Role:      p.Role,
+		Backend:   p.Backend,
+		ExpiresAt: p.ExpiresAt,
+		CreatedAt: now,
+	}
+	if err := s.db.Where("expires_at < ?", now).Delete(&Session{}).Error; err != nil {
+		return "", fmt.Errorf("failed to remove expired sessions: %w", err)
+	}
+	if err := s.db.Create(&session).Error; err != nil {
+		return "", fmt.Errorf("failed to store session: %w", err)
+	}
+	return token, nil
+}
+
+// Get returns the principal of a session cookie
+func (s *SessionStore) Get(token string, now time.Time) (*Principal, error) {
+	var session Session
+	if err := s.db.Where("id = ?", sessionID(token)).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: unknown session", ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	if !now.Before(session.ExpiresAt) {
+		return nil, fmt.Errorf("%w: session expired", ErrInvalidToken)
+	}
+	p := &Principal{
+		Subject:   session.Subject,
+		Username:  session.Username,
+		Email:     session.Email,
+		Role:      session.Role,
+		Backend:   session.Backend,
+		ExpiresAt: session.ExpiresAt,
+	}
+	_ = json.Unmarshal([]byte(session.Groups), &p.Groups)
+	return p, nil
+}
+
+// Delete ends a session
+func (s *SessionStore) Delete(token string) error {
+	if err := s.db.Where("id = ?", sessionID(token)).Delete(&Session{}).Error; err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// sessionID hashes a session cookie into its stored ID
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
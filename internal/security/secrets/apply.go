@@ -14,6 +14,9 @@ import (
 // - SHELLY_OPNSENSE_API_SECRET
 // - SHELLY_SECURITY_ADMIN_API_KEY
 // - SHELLY_API_KEY (used by provisioner agent config)
+// - SHELLY_PROVISIONING_AUTH_PASSWORD (device credentials)
+// - SHELLY_DATABASE_ENCRYPTION_KEY (column encryption)
+// - SHELLY_EXPORT_SIGNING_KEY (backup and GitOps artifact signing)
 //
 // Note: Viper already supports direct env overrides (SHELLY_*). This function
 // adds the common *_FILE convention and centralizes sensitive-field handling.
@@ -44,9 +47,55 @@ func ApplyToConfig(cfg *config.Config) {
 		"SHELLY_SECURITY_ADMIN_API_KEY",
 	)
 
+	// OIDC client secret for single sign-on
+	cfg.Auth.OIDC.ClientSecret = OverrideIfPresent(
+		cfg.Auth.OIDC.ClientSecret,
+		"SHELLY_AUTH_OIDC_CLIENT_SECRET",
+	)
+
+	// Device credentials used for provisioning and authentication challenges
+	cfg.Provisioning.AuthPassword = OverrideIfPresent(
+		cfg.Provisioning.AuthPassword,
+		"SHELLY_PROVISIONING_AUTH_PASSWORD",
+	)
+
+	// Database encryption key
+	cfg.Database.EncryptionKey = OverrideIfPresent(
+		cfg.Database.EncryptionKey,
+		"SHELLY_DATABASE_ENCRYPTION_KEY",
+	)
+
+	// Export artifact signing key
+	cfg.Export.Signing.Key = OverrideIfPresent(
+		cfg.Export.Signing.Key,
+		"SHELLY_EXPORT_SIGNING_KEY",
+	)
+
+	// Object storage credentials of the export artifact lifecycle
+	cfg.Export.Lifecycle.ObjectStorage.SecretKey = OverrideIfPresent(
+		cfg.Export.Lifecycle.ObjectStorage.SecretKey,
+		"SHELLY_EXPORT_LIFECYCLE_OBJECT_STORAGE_SECRET_KEY",
+	)
+
 	// Provisioner/Agent API key (when running provisioner binary)
 	cfg.API.Key = OverrideIfPresent(
 		cfg.API.Key,
 		"SHELLY_API_KEY",
 	)
 }
+
+// ConfigureColumnCipher sets up column encryption from database.encryption_key
+// and database.previous_encryption_keys. Without a key, columns are stored in
+// plain text.
+func ConfigureColumnCipher(cfg *config.Config) error {
+	if cfg == nil || cfg.Database.EncryptionKey == "" {
+		SetColumnCipher(nil)
+		return nil
+	}
+	c, err := NewColumnCipher(cfg.Database.EncryptionKey, cfg.Database.PreviousEncryptionKeys...)
+	if err != nil {
+		return err
+	}
+	SetColumnCipher(c)
+	return nil
+}
@@ -0,0 +1,227 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm/schema"
+)
+
+// ColumnSerializer is the GORM serializer name for encrypted columns. Tag a
+// string or []byte field with `gorm:"serializer:encrypted"` to store it
+// encrypted with the configured column key.
+const ColumnSerializer = "encrypted"
+
+// columnPrefix marks an encrypted value; the key ID and the base64 nonce and
+// ciphertext follow it
+const columnPrefix = "enc:v1:"
+
+// ErrNoColumnKey is returned when an encrypted value is read without a key
+// able to decrypt it
+var ErrNoColumnKey = errors.New("no column encryption key for encrypted value")
+
+// ColumnCipher encrypts column values with AES-256-GCM. Values written under
+// previous keys can still be read, so keys can be rotated.
+type ColumnCipher struct {
+	current *columnKey
+	keys    map[string]*columnKey
+}
+
+type columnKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewColumnCipher creates a cipher that encrypts with key and decrypts with
+// key or any of the previous keys
+func NewColumnCipher(key string, previous ...string) (*ColumnCipher, error) {
+	if key == "" {
+		return nil, errors.New("column encryption key is empty")
+	}
+	c := &ColumnCipher{keys: map[string]*columnKey{}}
+	for i, k := range append([]string{key}, previous...) {
+		if k == "" {
+			continue
+		}
+		ck, err := newColumnKey(k)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			c.current = ck
+		}
+		c.keys[ck.id] = ck
+	}
+	return c, nil
+}
+
+// newColumnKey derives an AES-256 key and a short key ID from a passphrase
+func newColumnKey(passphrase string) (*columnKey, error) {
+	sum := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create column cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create column cipher: %w", err)
+	}
+	id := sha256.Sum256(sum[:])
+	return &columnKey{id: hex.EncodeToString(id[:4]), aead: aead}, nil
+}
+
+// KeyID identifies the key new values are encrypted with
+func (c *ColumnCipher) KeyID() string {
+	return c.current.id
+}
+
+// Encrypt encrypts a value with the current key
+func (c *ColumnCipher) Encrypt(plain []byte) (string, error) {
+	nonce := make([]byte, c.current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := c.current.aead.Seal(nonce, nonce, plain, nil)
+	return columnPrefix + c.current.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value written by Encrypt with any known key. Values
+// that are not encrypted are returned unchanged.
+func (c *ColumnCipher) Decrypt(value string) ([]byte, error) {
+	if !IsEncrypted(value) {
+		return []byte(value), nil
+	}
+	id, data, ok := strings.Cut(strings.TrimPrefix(value, columnPrefix), ":")
+	if !ok {
+		return nil, errors.New("malformed encrypted value")
+	}
+	key := c.keys[id]
+	if key == nil {
+		return nil, fmt.Errorf("%w: key %s", ErrNoColumnKey, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < key.aead.NonceSize() {
+		return nil, errors.New("malformed encrypted value")
+	}
+	plain, err := key.aead.Open(nil, sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return plain, nil
+}
+
+// IsEncrypted reports whether a stored value is encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, columnPrefix)
+}
+
+// EncryptedWithCurrentKey reports whether a stored value is encrypted with
+// the current key, i.e. needs no rewrite after a key rotation
+func (c *ColumnCipher) EncryptedWithCurrentKey(value string) bool {
+	return strings.HasPrefix(value, columnPrefix+c.current.id+":")
+}
+
+var (
+	columnMu     sync.RWMutex
+	columnCipher *ColumnCipher
+)
+
+// SetColumnCipher sets the cipher used by encrypted columns. Nil stores new
+// values in plain text; encrypted values then fail to load.
+func SetColumnCipher(c *ColumnCipher) {
+	columnMu.Lock()
+	defer columnMu.Unlock()
+	columnCipher = c
+}
+
+// GetColumnCipher returns the cipher used by encrypted columns, if any
+func GetColumnCipher() *ColumnCipher {
+	columnMu.RLock()
+	defer columnMu.RUnlock()
+	return columnCipher
+}
+
+func init() {
+	schema.RegisterSerializer(ColumnSerializer, encryptedSerializer{})
+}
+
+// encryptedSerializer stores string and []byte fields through the column
+// cipher. Plain values written before a key was configured are still read,
+// and are encrypted when next written.
+type encryptedSerializer struct{}
+
+// Scan implements schema.SerializerInterface
+func (encryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	value := reflect.New(field.FieldType).Elem()
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("unsupported value %T for encrypted column %s", dbValue, field.Name)
+	}
+	if dbValue != nil {
+		plain := []byte(stored)
+		if IsEncrypted(stored) {
+			c := GetColumnCipher()
+			if c == nil {
+				return fmt.Errorf("%w: column %s", ErrNoColumnKey, field.Name)
+			}
+			var err error
+			if plain, err = c.Decrypt(stored); err != nil {
+				return fmt.Errorf("column %s: %w", field.Name, err)
+			}
+		}
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString(string(plain))
+		case reflect.Slice:
+			value.SetBytes(plain)
+		default:
+			return fmt.Errorf("unsupported field type %s for encrypted column %s", field.FieldType, field.Name)
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(value)
+	return nil
+}
+
+// Value implements schema.SerializerInterface
+func (encryptedSerializer) Value(_ context.Context, field *schema.Field, _ reflect.Value, fieldValue interface{}) (interface{}, error) {
+	var plain []byte
+	switch v := fieldValue.(type) {
+	case string:
+		plain = []byte(v)
+	case []byte:
+		if v == nil {
+			return nil, nil
+		}
+		plain = v
+	default:
+		rv := reflect.ValueOf(fieldValue)
+		if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, fmt.Errorf("unsupported field type %T for encrypted column %s", fieldValue, field.Name)
+		}
+		if rv.IsNil() {
+			return nil, nil
+		}
+		plain = rv.Bytes()
+	}
+	c := GetColumnCipher()
+	if c == nil || len(plain) == 0 {
+		return string(plain), nil
+	}
+	return c.Encrypt(plain)
+}
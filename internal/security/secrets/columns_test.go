@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+)
+
+func TestColumnCipher_RoundTripAndRotation(t *testing.T) {
+	old, err := NewColumnCipher("old-key")
+	if err != nil {
+		t.Fatalf("NewColumnCipher: %v", err)
+	}
+	stored, err := old.Encrypt([]byte(`{"password":"hunter2"}`))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !IsEncrypted(stored) || strings.Contains(stored, "hunter2") {
+		t.Fatalf("expected an encrypted value, got %q", stored)
+	}
+	if again, _ := old.Encrypt([]byte(`{"password":"hunter2"}`)); again == stored {
+		t.Fatalf("expected a fresh nonce per value")
+	}
+
+	// A rotated cipher reads values of the previous key, but not the other way
+	rotated, err := NewColumnCipher("new-key", "old-key")
+	if err != nil {
+		t.Fatalf("NewColumnCipher: %v", err)
+	}
+	plain, err := rotated.Decrypt(stored)
+	if err != nil || string(plain) != `{"password":"hunter2"}` {
+		t.Fatalf("expected the old value to decrypt, got %q, %v", plain, err)
+	}
+	if rotated.EncryptedWithCurrentKey(stored) || !old.EncryptedWithCurrentKey(stored) {
+		t.Errorf("expected the value to belong to the old key only")
+	}
+	other, _ := NewColumnCipher("other-key")
+	if _, err := other.Decrypt(stored); !errors.Is(err, ErrNoColumnKey) {
+		t.Errorf("expected ErrNoColumnKey for an unknown key, got %v", err)
+	}
+
+	// Values stored before encryption was enabled read as they are
+	if plain, err := rotated.Decrypt("plain"); err != nil || string(plain) != "plain" {
+		t.Errorf("expected plain values to pass through, got %q, %v", plain, err)
+	}
+	if _, err := NewColumnCipher(""); err == nil {
+		t.Errorf("expected an empty key to be rejected")
+	}
+}
+
+func TestConfigureColumnCipher_FromEnv(t *testing.T) {
+	t.Setenv("SHELLY_DATABASE_ENCRYPTION_KEY", "env-key")
+	t.Cleanup(func() { SetColumnCipher(nil) })
+
+	cfg := &config.Config{}
+	ApplyToConfig(cfg)
+	if err := ConfigureColumnCipher(cfg); err != nil {
+		t.Fatalf("ConfigureColumnCipher: %v", err)
+	}
+	want, _ := NewColumnCipher("env-key")
+	if c := GetColumnCipher(); c == nil || c.KeyID() != want.KeyID() {
+		t.Fatalf("expected the cipher of the env key, got %+v", c)
+	}
+
+	if err := ConfigureColumnCipher(&config.Config{}); err != nil || GetColumnCipher() != nil {
+		t.Fatalf("expected no cipher without a key, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// Kinds of API clients, from the most to the least specific identity
+const (
+	APIClientUser        = "user"        // signed-in user
+	APIClientIntegration = "integration" // named by X-User-ID or X-User
+	APIClientAPIKey      = "api_key"     // admin API key
+	APIClientUserAgent   = "user_agent"  // anonymous, by User-Agent
+	APIClientAddress     = "address"     // anonymous, by remote address
+	APIClientOther       = "other"       // clients beyond maxAPIUsageClients
+)
+
+// maxAPIUsageClients bounds the clients tracked separately, so clients that
+// vary their User-Agent cannot grow the tracker without limit
+const maxAPIUsageClients = 200
+
+// APIClient identifies the dashboard, script or user behind an API request
+type APIClient struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// APIUsageReport is the device traffic caused by each API client since
+// Since, busiest first
+type APIUsageReport struct {
+	Since   time.Time        `json:"since"`
+	Clients []APIClientUsage `json:"clients"`
+}
+
+// APIClientUsage is the traffic of one API client
+type APIClientUsage struct {
+	APIClient
+	Requests        int64            `json:"requests"`
+	DeviceRequests  int64            `json:"device_requests"` // requests to /devices/{id}
+	DeviceCalls     int64            `json:"device_calls"`    // device requests they caused
+	CallsPerRequest float64          `json:"calls_per_request"`
+	FirstSeen       time.Time        `json:"first_seen"`
+	LastSeen        time.Time        `json:"last_seen"`
+	Devices         []APIDeviceUsage `json:"devices"` // busiest first
+}
+
+// APIDeviceUsage is the traffic of one API client to one device. Calls to
+// addresses that are not in the inventory carry only the address.
+type APIDeviceUsage struct {
+	DeviceID uint   `json:"device_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Address  string `json:"address"`
+	Requests int64  `json:"requests"`
+	Calls    int64  `json:"calls"`
+}
+
+// apiUsage counts the traffic of one API client
+type apiUsage struct {
+	requests       int64
+	deviceRequests map[uint]int64
+	deviceCalls    map[string]int64 // by device address
+	firstSeen      time.Time
+	lastSeen       time.Time
+}
+
+// apiUsageCounter counts the device calls of one API client
+type apiUsageCounter struct {
+	s      *ShellyService
+	client APIClient
+}
+
+// CountDeviceCall implements shelly.CallCounter
+func (c apiUsageCounter) CountDeviceCall(host string) {
+	c.s.usageMu.Lock()
+	defer c.s.usageMu.Unlock()
+	if usage := c.s.usage[c.client]; usage != nil {
+		usage.deviceCalls[host]++
+	}
+}
+
+// TrackAPIRequest counts an API request of client, naming deviceID when it
+// targets one device, and returns ctx counting the device calls made with it
+// against the client
+func (s *ShellyService) TrackAPIRequest(ctx context.Context, client APIClient, deviceID uint) context.Context {
+	now := s.clock.Now()
+	s.usageMu.Lock()
+	if s.usage == nil {
+		s.usage = make(map[APIClient]*apiUsage)
+	}
+	if s.usageSince.IsZero() {
+		s.usageSince = now
+	}
+	usage, ok := s.usage[client]
+	if !ok && len(s.usage) >= maxAPIUsageClients {
+		client = APIClient{Name: APIClientOther, Kind: APIClientOther}
+		usage, ok = s.usage[client]
+	}
+	if !ok {
+		usage = &apiUsage{deviceRequests: make(map[uint]int64), deviceCalls: make(map[string]int64), firstSeen: now}
+		s.usage[client] = usage
+	}
+	usage.requests++
+	usage.lastSeen = now
+	if deviceID != 0 {
+		usage.deviceRequests[deviceID]++
+	}
+	s.usageMu.Unlock()
+
+	return shelly.WithCallCounter(ctx, apiUsageCounter{s: s, client: client})
+}
+
+// APIUsage reports the device traffic of every API client since the manager
+// started or the counters were reset, the clients causing the most device
+// calls first
+func (s *ShellyService) APIUsage() (*APIUsageReport, error) {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*database.Device, len(devices))
+	byAddress := make(map[string]*database.Device, len(devices))
+	for i := range devices {
+		byID[devices[i].ID] = &devices[i]
+		byAddress[devices[i].IP] = &devices[i]
+	}
+	deviceAt := func(address string) *database.Device {
+		if device, ok := byAddress[address]; ok {
+			return device
+		}
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			return byAddress[host]
+		}
+		return nil
+	}
+
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	report := &APIUsageReport{Since: s.usageSince, Clients: []APIClientUsage{}}
+	if report.Since.IsZero() {
+		report.Since = s.clock.Now()
+	}
+	for client, usage := range s.usage {
+		entry := APIClientUsage{
+			APIClient: client,
+			Requests:  usage.requests,
+			FirstSeen: usage.firstSeen,
+			LastSeen:  usage.lastSeen,
+		}
+		perDevice := make(map[uint]*APIDeviceUsage)
+		var unknown []APIDeviceUsage
+		deviceEntry := func(device *database.Device) *APIDeviceUsage {
+			if d, ok := perDevice[device.ID]; ok {
+				return d
+			}
+			d := &APIDeviceUsage{DeviceID: device.ID, Name: device.Name, Address: device.IP}
+			perDevice[device.ID] = d
+			return d
+		}
+		for id, n := range usage.deviceRequests {
+			entry.DeviceRequests += n
+			if device, ok := byID[id]; ok {
+				deviceEntry(device).Requests += n
+			} else {
+				unknown = append(unknown, APIDeviceUsage{DeviceID: id, Requests: n})
+			}
+		}
+		for address, n := range usage.deviceCalls {
+			entry.DeviceCalls += n
+			if device := deviceAt(address); device != nil {
+				deviceEntry(device).Calls += n
+			} else {
+				unknown = append(unknown, APIDeviceUsage{Address: address, Calls: n})
+			}
+		}
+		if entry.Requests > 0 {
+			entry.CallsPerRequest = roundHundredth(float64(entry.DeviceCalls) / float64(entry.Requests))
+		}
+
+		entry.Devices = unknown
+		for _, d := range perDevice {
+			entry.Devices = append(entry.Devices, *d)
+		}
+		sort.Slice(entry.Devices, func(i, j int) bool {
+			a, b := entry.Devices[i], entry.Devices[j]
+			if a.Calls != b.Calls {
+				return a.Calls > b.Calls
+			}
+			if a.Requests != b.Requests {
+				return a.Requests > b.Requests
+			}
+			return a.DeviceID < b.DeviceID || a.DeviceID == b.DeviceID && a.Address < b.Address
+		})
+		report.Clients = append(report.Clients, entry)
+	}
+	sort.Slice(report.Clients, func(i, j int) bool {
+		a, b := report.Clients[i], report.Clients[j]
+		if a.DeviceCalls != b.DeviceCalls {
+			return a.DeviceCalls > b.DeviceCalls
+		}
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Name < b.Name
+	})
+	return report, nil
+}
+
+// ResetAPIUsage clears the API client counters
+func (s *ShellyService) ResetAPIUsage() {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	s.usage = nil
+	s.usageSince = s.clock.Now()
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestShellyService_APIUsage(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	server := createMockShellyServer()
+	defer server.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+	device := createTestDevice(t, db, server.URL[len("http://"):])
+
+	dashboard := APIClient{Name: "wall-dashboard", Kind: APIClientIntegration}
+	for i := 0; i < 3; i++ {
+		ctx := service.TrackAPIRequest(context.Background(), dashboard, device.ID)
+		if _, err := service.GetDeviceStatusContext(ctx, device.ID); err != nil {
+			t.Fatalf("GetDeviceStatusContext failed: %v", err)
+		}
+	}
+	service.TrackAPIRequest(context.Background(), APIClient{Name: "alice", Kind: APIClientUser}, 0)
+
+	report, err := service.APIUsage()
+	if err != nil {
+		t.Fatalf("APIUsage failed: %v", err)
+	}
+	if len(report.Clients) != 2 {
+		t.Fatalf("Expected 2 clients, got %+v", report.Clients)
+	}
+	busiest := report.Clients[0]
+	if busiest.APIClient != dashboard || busiest.Requests != 3 || busiest.DeviceRequests != 3 || busiest.DeviceCalls < 3 {
+		t.Errorf("Expected the dashboard first with its status calls, got %+v", busiest)
+	}
+	if len(busiest.Devices) != 1 || busiest.Devices[0].DeviceID != device.ID || busiest.Devices[0].Calls != busiest.DeviceCalls {
+		t.Errorf("Expected the calls attributed to the device, got %+v", busiest.Devices)
+	}
+	if idle := report.Clients[1]; idle.Name != "alice" || idle.Requests != 1 || idle.DeviceCalls != 0 {
+		t.Errorf("Expected alice without device calls, got %+v", idle)
+	}
+
+	// Clients beyond the limit are counted together
+	for i := 0; i < maxAPIUsageClients; i++ {
+		service.TrackAPIRequest(context.Background(), APIClient{Name: fmt.Sprintf("script-%d", i), Kind: APIClientUserAgent}, 0)
+	}
+	report, _ = service.APIUsage()
+	if len(report.Clients) != maxAPIUsageClients+1 {
+		t.Errorf("Expected %d clients, got %d", maxAPIUsageClients+1, len(report.Clients))
+	}
+
+	service.ResetAPIUsage()
+	if report, _ = service.APIUsage(); len(report.Clients) != 0 {
+		t.Errorf("Expected no clients after a reset, got %d", len(report.Clients))
+	}
+}
@@ -0,0 +1,427 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// maxWarrantyMonths bounds the warranty duration of an asset (50 years)
+const maxWarrantyMonths = 600
+
+// Warranty states in the asset report
+const (
+	WarrantyActive   = "active"
+	WarrantyExpiring = "expiring" // within assets.notice_days of expiry
+	WarrantyExpired  = "expired"
+	WarrantyUnknown  = "unknown" // no purchase date or duration recorded
+)
+
+// ErrInvalidAsset wraps asset validation errors
+var ErrInvalidAsset = errors.New("invalid asset details")
+
+// WarrantyNotifier is told when the warranty of a device approaches expiry
+type WarrantyNotifier func(ctx context.Context, device database.Device, expires time.Time)
+
+// SetWarrantyNotifier sets the callback told about expiring warranties
+func (s *ShellyService) SetWarrantyNotifier(fn WarrantyNotifier) {
+	s.assetMu.Lock()
+	defer s.assetMu.Unlock()
+	s.warrantyNotifier = fn
+}
+
+// assetsConfig returns the configured asset settings
+func (s *ShellyService) assetsConfig() config.AssetsConfig {
+	if s.Config == nil {
+		return config.AssetsConfig{}
+	}
+	return s.Config.Assets
+}
+
+// assetColumns are the device columns of the asset record
+var assetColumns = []string{"serial", "vendor", "purchase_date", "warranty_months", "warranty_notified_at"}
+
+// SetDeviceAsset replaces the asset record of a device. A change of the
+// purchase date or warranty duration re-arms the expiry notification.
+func (s *ShellyService) SetDeviceAsset(deviceID uint, asset database.DeviceAsset) (*database.Device, error) {
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	asset.Serial = strings.TrimSpace(asset.Serial)
+	asset.Vendor = strings.TrimSpace(asset.Vendor)
+	if err := validateAsset(asset); err != nil {
+		return nil, err
+	}
+	if err := s.saveAsset(device, asset); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// saveAsset stores asset on device, keeping the notification state unless
+// the warranty changed
+func (s *ShellyService) saveAsset(device *database.Device, asset database.DeviceAsset) error {
+	asset.WarrantyNotifiedAt = nil
+	if sameTime(asset.PurchaseDate, device.Asset.PurchaseDate) && asset.WarrantyMonths == device.Asset.WarrantyMonths {
+		asset.WarrantyNotifiedAt = device.Asset.WarrantyNotifiedAt
+	}
+	device.Asset = asset
+	if err := s.DB.GetDB().Model(&database.Device{}).Where("id = ?", device.ID).
+		Select(assetColumns).Updates(device).Error; err != nil {
+		return fmt.Errorf("failed to store asset of device %d: %w", device.ID, err)
+	}
+	return nil
+}
+
+// validateAsset checks an asset record
+func validateAsset(asset database.DeviceAsset) error {
+	if len(asset.Serial) > 191 || len(asset.Vendor) > 191 {
+		return fmt.Errorf("%w: serial and vendor are limited to 191 characters", ErrInvalidAsset)
+	}
+	if asset.WarrantyMonths < 0 || asset.WarrantyMonths > maxWarrantyMonths {
+		return fmt.Errorf("%w: warranty_months must be between 0 and %d", ErrInvalidAsset, maxWarrantyMonths)
+	}
+	if asset.PurchaseDate != nil && asset.PurchaseDate.After(time.Now().Add(24*time.Hour)) {
+		return fmt.Errorf("%w: purchase_date is in the future", ErrInvalidAsset)
+	}
+	return nil
+}
+
+// AssetImportResult reports an asset CSV import
+type AssetImportResult struct {
+	Updated   int      `json:"updated"`
+	DeviceIDs []uint   `json:"device_ids"`
+	Errors    []string `json:"errors"`
+}
+
+// ImportDeviceAssets reads asset records from CSV with a header row. Each
+// row names its device in an id, mac or ip column and sets any of serial,
+// vendor, purchase_date (YYYY-MM-DD) and warranty_months; empty cells keep
+// the stored value. Rows that cannot be applied are reported with their
+// line number and the others are still stored.
+func (s *ShellyService) ImportDeviceAssets(r io.Reader) (*AssetImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid CSV: %v", ErrInvalidAsset, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: the CSV is empty", ErrInvalidAsset)
+	}
+
+	columns := map[string]int{}
+	for i, col := range records[0] {
+		name := strings.ToLower(strings.TrimSpace(col))
+		if name == "device_id" {
+			name = "id"
+		}
+		columns[name] = i
+	}
+	_, hasID := columns["id"]
+	_, hasMAC := columns["mac"]
+	_, hasIP := columns["ip"]
+	if !hasID && !hasMAC && !hasIP {
+		return nil, fmt.Errorf("%w: the header must name an id, mac or ip column", ErrInvalidAsset)
+	}
+
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	byID := make(map[string]*database.Device, len(devices))
+	byMAC := make(map[string]*database.Device, len(devices))
+	byIP := make(map[string]*database.Device, len(devices))
+	for i := range devices {
+		d := &devices[i]
+		byID[strconv.FormatUint(uint64(d.ID), 10)] = d
+		byMAC[normalizeMAC(d.MAC)] = d
+		byIP[d.IP] = d
+	}
+
+	result := &AssetImportResult{DeviceIDs: []uint{}, Errors: []string{}}
+	for i, record := range records[1:] {
+		line := i + 2
+		cell := func(name string) string {
+			if idx, ok := columns[name]; ok && idx < len(record) {
+				return strings.TrimSpace(record[idx])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		var device *database.Device
+		switch {
+		case cell("id") != "":
+			device = byID[cell("id")]
+		case cell("mac") != "":
+			device = byMAC[normalizeMAC(cell("mac"))]
+		case cell("ip") != "":
+			device = byIP[cell("ip")]
+		}
+		if device == nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: no matching device", line))
+			continue
+		}
+
+		asset := device.Asset
+		if v := cell("serial"); v != "" {
+			asset.Serial = v
+		}
+		if v := cell("vendor"); v != "" {
+			asset.Vendor = v
+		}
+		if v := cell("purchase_date"); v != "" {
+			date, err := ParseAssetDate(v)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("line %d: %v", line, err))
+				continue
+			}
+			asset.PurchaseDate = &date
+		}
+		if v := cell("warranty_months"); v != "" {
+			months, err := strconv.Atoi(v)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("line %d: invalid warranty_months %q", line, v))
+				continue
+			}
+			asset.WarrantyMonths = months
+		}
+		if err := validateAsset(asset); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		if err := s.saveAsset(device, asset); err != nil {
+			return nil, err
+		}
+		result.Updated++
+		result.DeviceIDs = append(result.DeviceIDs, device.ID)
+	}
+
+	s.logger.WithFields(map[string]any{
+		"updated":   result.Updated,
+		"errors":    len(result.Errors),
+		"component": "assets",
+	}).Info("Device assets imported")
+	return result, nil
+}
+
+// ParseAssetDate reads a date as YYYY-MM-DD or RFC 3339
+func ParseAssetDate(v string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", v); err == nil {
+		return date, nil
+	}
+	if date, err := time.Parse(time.RFC3339, v); err == nil {
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid purchase_date %q, expected YYYY-MM-DD", v)
+}
+
+// AssetReportRow is the asset record of one device with its warranty state
+type AssetReportRow struct {
+	DeviceID        uint       `json:"device_id"`
+	Name            string     `json:"name"`
+	Type            string     `json:"type"`
+	MAC             string     `json:"mac"`
+	IP              string     `json:"ip"`
+	Serial          string     `json:"serial,omitempty"`
+	Vendor          string     `json:"vendor,omitempty"`
+	PurchaseDate    *time.Time `json:"purchase_date,omitempty"`
+	WarrantyMonths  int        `json:"warranty_months,omitempty"`
+	WarrantyExpires *time.Time `json:"warranty_expires,omitempty"`
+	DaysLeft        *int       `json:"days_left,omitempty"` // negative once expired
+	Warranty        string     `json:"warranty"`
+}
+
+// AssetReport lists the asset record of every device
+type AssetReport struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	Total       int              `json:"total"`
+	Expiring    int              `json:"expiring"`
+	Expired     int              `json:"expired"`
+	Unknown     int              `json:"unknown"`
+	Devices     []AssetReportRow `json:"devices"`
+}
+
+// GetAssetReport lists the asset records of all devices, soonest warranty
+// expiry first and devices without warranty details last
+func (s *ShellyService) GetAssetReport() (*AssetReport, error) {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	now := time.Now()
+	notice := s.assetsConfig().NoticeDuration()
+	report := &AssetReport{GeneratedAt: now, Devices: make([]AssetReportRow, 0, len(devices))}
+	for _, d := range devices {
+		row := AssetReportRow{
+			DeviceID:        d.ID,
+			Name:            d.Name,
+			Type:            d.Type,
+			MAC:             d.MAC,
+			IP:              d.IP,
+			Serial:          d.Asset.Serial,
+			Vendor:          d.Asset.Vendor,
+			PurchaseDate:    d.Asset.PurchaseDate,
+			WarrantyMonths:  d.Asset.WarrantyMonths,
+			WarrantyExpires: d.Asset.WarrantyExpires(),
+			Warranty:        WarrantyUnknown,
+		}
+		if row.WarrantyExpires != nil {
+			left := int(row.WarrantyExpires.Sub(now).Hours() / 24)
+			row.DaysLeft = &left
+			row.Warranty = warrantyState(*row.WarrantyExpires, now, notice)
+		}
+		switch row.Warranty {
+		case WarrantyExpiring:
+			report.Expiring++
+		case WarrantyExpired:
+			report.Expired++
+		case WarrantyUnknown:
+			report.Unknown++
+		}
+		report.Devices = append(report.Devices, row)
+	}
+	sort.SliceStable(report.Devices, func(i, j int) bool {
+		a, b := report.Devices[i].WarrantyExpires, report.Devices[j].WarrantyExpires
+		if a == nil || b == nil {
+			if a == nil && b == nil {
+				return report.Devices[i].DeviceID < report.Devices[j].DeviceID
+			}
+			return a != nil
+		}
+		return a.Before(*b)
+	})
+	report.Total = len(report.Devices)
+	return report, nil
+}
+
+// WriteAssetReportCSV writes the rows of an asset report as CSV
+func WriteAssetReportCSV(w io.Writer, report *AssetReport) error {
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"device_id", "name", "type", "mac", "ip", "serial", "vendor", "purchase_date", "warranty_months", "warranty_expires", "days_left", "warranty"})
+	date := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	}
+	for _, row := range report.Devices {
+		months, daysLeft := "", ""
+		if row.WarrantyMonths > 0 {
+			months = strconv.Itoa(row.WarrantyMonths)
+		}
+		if row.DaysLeft != nil {
+			daysLeft = strconv.Itoa(*row.DaysLeft)
+		}
+		_ = out.Write([]string{
+			strconv.FormatUint(uint64(row.DeviceID), 10), row.Name, row.Type, row.MAC, row.IP,
+			row.Serial, row.Vendor, date(row.PurchaseDate), months, date(row.WarrantyExpires), daysLeft, row.Warranty,
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// CheckWarranties notifies once for every device whose warranty expires
+// within assets.notice_days, and returns the devices notified
+func (s *ShellyService) CheckWarranties(ctx context.Context, now time.Time) ([]uint, error) {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	notice := s.assetsConfig().NoticeDuration()
+	s.assetMu.Lock()
+	notify := s.warrantyNotifier
+	s.assetMu.Unlock()
+
+	notified := []uint{}
+	for _, d := range devices {
+		expires := d.Asset.WarrantyExpires()
+		if expires == nil || d.Asset.WarrantyNotifiedAt != nil || warrantyState(*expires, now, notice) == WarrantyActive {
+			continue
+		}
+		if err := s.DB.GetDB().Model(&database.Device{}).Where("id = ?", d.ID).
+			Update("warranty_notified_at", now).Error; err != nil {
+			return notified, fmt.Errorf("failed to record warranty notice of device %d: %w", d.ID, err)
+		}
+		if notify != nil {
+			notify(ctx, d, *expires)
+		}
+		notified = append(notified, d.ID)
+		s.logger.WithFields(map[string]any{
+			"device_id": d.ID,
+			"expires":   expires.Format("2006-01-02"),
+			"component": "assets",
+		}).Info("Device warranty expiring")
+	}
+	return notified, nil
+}
+
+// StartWarrantyChecks checks warranties periodically (assets.warranty_checks)
+func (s *ShellyService) StartWarrantyChecks() {
+	cfg := s.assetsConfig()
+	if !cfg.WarrantyChecks {
+		return
+	}
+	interval := cfg.IntervalDuration()
+
+	go func() {
+		ticker := s.clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if s.leader == nil || s.leader() {
+				if _, err := s.CheckWarranties(s.ctx, s.clock.Now()); err != nil && s.ctx.Err() == nil {
+					s.logger.WithFields(map[string]any{
+						"error":     err.Error(),
+						"component": "assets",
+					}).Warn("Warranty check failed")
+				}
+			}
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]any{
+		"interval":    interval.String(),
+		"notice_days": cfg.NoticeDays,
+		"component":   "assets",
+	}).Info("Started warranty checks")
+}
+
+// warrantyState classifies a warranty expiring at expires
+func warrantyState(expires, now time.Time, notice time.Duration) string {
+	switch {
+	case !expires.After(now):
+		return WarrantyExpired
+	case expires.Sub(now) <= notice:
+		return WarrantyExpiring
+	default:
+		return WarrantyActive
+	}
+}
+
+// sameTime reports whether two optional times are equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_DeviceAssets(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	devices := []*database.Device{
+		{IP: "192.0.2.1", MAC: "AA:BB:CC:DD:EE:01", Name: "Porch", Type: "SHSW-1"},
+		{IP: "192.0.2.2", MAC: "AABBCCDDEE02", Name: "Hall", Type: "SHSW-1"},
+		{IP: "192.0.2.3", MAC: "AABBCCDDEE03", Name: "Garage", Type: "SHSW-1"},
+	}
+	for _, d := range devices {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+
+	if _, err := service.SetDeviceAsset(devices[0].ID, database.DeviceAsset{WarrantyMonths: -1}); !errors.Is(err, ErrInvalidAsset) {
+		t.Errorf("Expected a negative warranty refused, got %v", err)
+	}
+	if _, err := service.SetDeviceAsset(999, database.DeviceAsset{}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected an unknown device refused, got %v", err)
+	}
+
+	// Expires in about 10 days, inside the default 30 day notice
+	purchased := time.Now().AddDate(-2, 0, 10)
+	if _, err := service.SetDeviceAsset(devices[0].ID, database.DeviceAsset{Serial: " SN-1 ", Vendor: "Allterco", PurchaseDate: &purchased, WarrantyMonths: 24}); err != nil {
+		t.Fatalf("SetDeviceAsset failed: %v", err)
+	}
+
+	result, err := service.ImportDeviceAssets(strings.NewReader(strings.Join([]string{
+		"mac,serial,purchase_date,warranty_months",
+		"aa-bb-cc-dd-ee-02,SN-2,2020-01-15,12",
+		"AABBCCDDEE03,SN-3,15/01/2024,24",
+		"AABBCCDDEE09,SN-9,,",
+		"aabbccddee01,,,",
+	}, "\n")))
+	if err != nil {
+		t.Fatalf("ImportDeviceAssets failed: %v", err)
+	}
+	if result.Updated != 2 || len(result.Errors) != 2 || !strings.HasPrefix(result.Errors[0], "line 3:") {
+		t.Fatalf("Expected two rows stored and two reported, got %+v", result)
+	}
+	porch, _ := db.GetDevice(devices[0].ID)
+	if porch.Asset.Serial != "SN-1" || porch.Asset.WarrantyMonths != 24 {
+		t.Errorf("Expected empty cells to keep the stored values, got %+v", porch.Asset)
+	}
+	if _, err := service.ImportDeviceAssets(strings.NewReader("serial\nSN-1")); !errors.Is(err, ErrInvalidAsset) {
+		t.Errorf("Expected a CSV without a device column refused, got %v", err)
+	}
+
+	report, err := service.GetAssetReport()
+	if err != nil {
+		t.Fatalf("GetAssetReport failed: %v", err)
+	}
+	if report.Expired != 1 || report.Expiring != 1 || report.Unknown != 1 ||
+		report.Devices[0].DeviceID != devices[1].ID || report.Devices[1].Warranty != WarrantyExpiring || report.Devices[2].Warranty != WarrantyUnknown {
+		t.Errorf("Expected the expired, expiring and unknown warranties in order, got %+v", report)
+	}
+	var csv bytes.Buffer
+	if err := WriteAssetReportCSV(&csv, report); err != nil {
+		t.Fatalf("WriteAssetReportCSV failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(csv.String()), "\n"); len(lines) != 4 || !strings.Contains(lines[1], "2020-01-15,12,2021-01-15") {
+		t.Errorf("Expected a header and one row per device, got %q", csv.String())
+	}
+
+	var notified []string
+	service.SetWarrantyNotifier(func(ctx context.Context, device database.Device, expires time.Time) {
+		notified = append(notified, device.Name)
+	})
+	ids, err := service.CheckWarranties(context.Background(), time.Now())
+	if err != nil || len(ids) != 2 || len(notified) != 2 {
+		t.Fatalf("Expected the expired and expiring warranties notified, got %v, %v", notified, err)
+	}
+	if ids, _ := service.CheckWarranties(context.Background(), time.Now()); len(ids) != 0 {
+		t.Errorf("Expected each warranty notified once, got %v", ids)
+	}
+
+	// Extending the warranty re-arms the notice
+	if _, err := service.SetDeviceAsset(devices[0].ID, database.DeviceAsset{Serial: "SN-1", PurchaseDate: &purchased, WarrantyMonths: 36}); err != nil {
+		t.Fatalf("SetDeviceAsset failed: %v", err)
+	}
+	if ids, _ := service.CheckWarranties(context.Background(), time.Now().AddDate(1, 0, 0)); len(ids) != 1 || ids[0] != devices[0].ID {
+		t.Errorf("Expected the extended warranty notified again, got %v", ids)
+	}
+}
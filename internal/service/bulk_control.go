@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+const (
+	// defaultBulkControlWorkers bounds concurrent device calls in BulkControl
+	defaultBulkControlWorkers = 10
+	// maxBulkControlWorkers caps the concurrency a request may ask for
+	maxBulkControlWorkers = 50
+	// maxBulkControlJobs bounds the async jobs kept in memory
+	maxBulkControlJobs = 100
+)
+
+// Bulk control job states
+const (
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+)
+
+var (
+	// ErrJobNotFound is returned for unknown bulk control job IDs
+	ErrJobNotFound = errors.New("job not found")
+	// ErrInvalidControlRequest wraps bulk control validation failures
+	ErrInvalidControlRequest = errors.New("invalid control request")
+)
+
+// BulkControlRequest selects devices and the action run on each of them
+type BulkControlRequest struct {
+	DeviceIDs   []uint                 `json:"device_ids,omitempty"`
+	Tag         string                 `json:"tag,omitempty"` // select devices carrying this tag
+	Action      string                 `json:"action"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	Concurrency int                    `json:"concurrency,omitempty"` // defaults to 10
+	Async       bool                   `json:"async"`
+	// Force attempts the action on devices marked offline; the API passes it
+	// on as the force parameter
+	Force bool `json:"force,omitempty"`
+}
+
+// BulkControlResult reports the outcome for one device
+type BulkControlResult struct {
+	DeviceID uint   `json:"device_id"`
+	Name     string `json:"name"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BulkControlJob tracks an asynchronous bulk control run
+type BulkControlJob struct {
+	ID          string              `json:"id"`
+	Status      string              `json:"status"`
+	Action      string              `json:"action"`
+	Total       int                 `json:"total"`
+	Succeeded   int                 `json:"succeeded"`
+	Failed      int                 `json:"failed"`
+	Results     []BulkControlResult `json:"results,omitempty"`
+	StartedAt   time.Time           `json:"started_at"`
+	CompletedAt *time.Time          `json:"completed_at,omitempty"`
+	RequestID   string              `json:"request_id,omitempty"` // request that started the job
+}
+
+// BulkControl runs a control action on every selected device through a
+// bounded worker pool and returns per-device results in device ID order
+func (s *ShellyService) BulkControl(ctx context.Context, req BulkControlRequest) ([]BulkControlResult, error) {
+	devices, err := s.BulkControlTargets(req)
+	if err != nil {
+		return nil, err
+	}
+	return s.runBulkControl(ctx, devices, req), nil
+}
+
+// StartBulkControl validates the selection and runs the action in the
+// background, returning a job that can be polled with GetBulkControlJob. The
+// job is logged under the request ID of ctx.
+func (s *ShellyService) StartBulkControl(ctx context.Context, req BulkControlRequest) (*BulkControlJob, error) {
+	devices, err := s.BulkControlTargets(req)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &BulkControlJob{
+		ID:        uuid.New().String(),
+		Status:    JobStatusRunning,
+		Action:    req.Action,
+		Total:     len(devices),
+		StartedAt: time.Now(),
+		RequestID: logging.GetRequestID(ctx),
+	}
+	s.storeControlJob(job)
+
+	jobCtx := s.jobContext(ctx)
+	go func() {
+		results := s.runBulkControl(jobCtx, devices, req)
+		s.jobsMu.Lock()
+		defer s.jobsMu.Unlock()
+		now := time.Now()
+		job.Results = results
+		job.Status = JobStatusCompleted
+		job.CompletedAt = &now
+		for _, r := range results {
+			if r.Success {
+				job.Succeeded++
+			} else {
+				job.Failed++
+			}
+		}
+	}()
+
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	return job.snapshot(), nil
+}
+
+// GetBulkControlJob returns a snapshot of an async bulk control job
+func (s *ShellyService) GetBulkControlJob(id string) (*BulkControlJob, error) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	for _, job := range s.controlJobs {
+		if job.ID == id {
+			return job.snapshot(), nil
+		}
+	}
+	return nil, ErrJobNotFound
+}
+
+// BulkControlTargets validates the request and resolves its selector to the
+// devices the action runs on
+func (s *ShellyService) BulkControlTargets(req BulkControlRequest) ([]database.Device, error) {
+	switch req.Action {
+	case "on", "off", "toggle", "reboot":
+	case "":
+		return nil, fmt.Errorf("%w: action is required", ErrInvalidControlRequest)
+	default:
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidControlRequest, req.Action)
+	}
+	if len(req.DeviceIDs) == 0 && req.Tag == "" {
+		return nil, fmt.Errorf("%w: device_ids or tag is required", ErrInvalidControlRequest)
+	}
+
+	return s.SelectDevices(req.DeviceIDs, req.Tag)
+}
+
+// runBulkControl fans the action out to a pool of workers. Reboots run in
+// dependency waves: a device is rebooted only after the devices depending on
+// it, so they are not cut off before their own command.
+func (s *ShellyService) runBulkControl(ctx context.Context, devices []database.Device, req BulkControlRequest) []BulkControlResult {
+	workers := req.Concurrency
+	if workers <= 0 {
+		workers = defaultBulkControlWorkers
+	}
+	if workers > maxBulkControlWorkers {
+		workers = maxBulkControlWorkers
+	}
+
+	position := make(map[uint]int, len(devices))
+	for i, d := range devices {
+		position[d.ID] = i
+	}
+	waves := [][]database.Device{devices}
+	if req.Action == "reboot" {
+		ordered, err := s.orderByDependency(devices)
+		if err != nil {
+			s.logger.WithContext(ctx).WithFields(map[string]any{
+				"error":     err.Error(),
+				"component": "service",
+			}).Warn("Failed to order devices by dependency, rebooting at once")
+		} else {
+			waves = ordered
+		}
+	}
+
+	results := make([]BulkControlResult, len(devices))
+	for _, wave := range waves {
+		fanOut(workers, len(wave), func(j int) {
+			i := position[wave[j].ID]
+			device := devices[i]
+			result := BulkControlResult{DeviceID: device.ID, Name: device.Name}
+			if err := ctx.Err(); err != nil {
+				result.Error = err.Error()
+			} else if err := s.ControlDeviceContext(ctx, device.ID, req.Action, req.Params); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Success = true
+			}
+			results[i] = result
+		})
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.Success {
+			failed++
+		}
+	}
+	s.logger.WithContext(ctx).WithFields(map[string]any{
+		"action":    req.Action,
+		"devices":   len(results),
+		"failed":    failed,
+		"component": "service",
+	}).Info("Bulk control completed")
+	return results
+}
+
+// storeControlJob records a job, dropping the oldest beyond maxBulkControlJobs
+func (s *ShellyService) storeControlJob(job *BulkControlJob) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	s.controlJobs = append(s.controlJobs, job)
+	if len(s.controlJobs) > maxBulkControlJobs {
+		s.controlJobs = s.controlJobs[len(s.controlJobs)-maxBulkControlJobs:]
+	}
+}
+
+// snapshot copies a job; callers hold jobsMu
+func (j *BulkControlJob) snapshot() *BulkControlJob {
+	c := *j
+	c.Results = append([]BulkControlResult(nil), j.Results...)
+	return &c
+}
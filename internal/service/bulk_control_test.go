@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_BulkControl(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	server := createMockShellyServer()
+	defer server.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	device := createTestDevice(t, db, server.URL[len("http://"):])
+	offline := &database.Device{IP: "192.0.2.50", MAC: "68C63A000050", Name: "porch", Status: "offline"}
+	if err := db.AddDevice(offline); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	for _, id := range []uint{device.ID, offline.ID} {
+		if err := db.AddDeviceTag(id, "lights"); err != nil {
+			t.Fatalf("Failed to tag device: %v", err)
+		}
+	}
+
+	results, err := service.BulkControl(context.Background(), BulkControlRequest{Tag: "lights", Action: "on"})
+	if err != nil {
+		t.Fatalf("BulkControl failed: %v", err)
+	}
+	if len(results) != 2 || !results[0].Success || results[1].Success || results[1].Error != ErrDeviceOffline.Error() {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+
+	job, err := service.StartBulkControl(context.Background(), BulkControlRequest{DeviceIDs: []uint{device.ID}, Action: "off"})
+	if err != nil {
+		t.Fatalf("StartBulkControl failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != JobStatusCompleted && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if job, err = service.GetBulkControlJob(job.ID); err != nil {
+			t.Fatalf("GetBulkControlJob failed: %v", err)
+		}
+	}
+	if job.Status != JobStatusCompleted || job.Succeeded != 1 || len(job.Results) != 1 {
+		t.Errorf("Unexpected job: %+v", job)
+	}
+
+	if _, err := service.BulkControl(context.Background(), BulkControlRequest{DeviceIDs: []uint{device.ID}, Action: "explode"}); !errors.Is(err, ErrInvalidControlRequest) {
+		t.Errorf("Expected ErrInvalidControlRequest, got %v", err)
+	}
+	if _, err := service.GetBulkControlJob("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
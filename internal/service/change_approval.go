@@ -0,0 +1,261 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// Change request states
+const (
+	ChangePending  = "pending"
+	ChangeApproved = "approved"
+	ChangeRejected = "rejected"
+	ChangeExecuted = "executed"
+	ChangeExpired  = "expired"
+)
+
+var (
+	// ErrApprovalRequired is returned with a pending change request when an
+	// operation must be approved by another identity before it runs
+	ErrApprovalRequired = errors.New("approval required")
+	// ErrChangeRequestNotFound is returned for an unknown change request
+	ErrChangeRequestNotFound = errors.New("change request not found")
+	// ErrChangeRequestState is wrapped when a change request cannot be
+	// decided or executed in its current state, or for another operation
+	ErrChangeRequestState = errors.New("change request cannot be used")
+	// ErrApprovalIdentity is wrapped when the caller has no identity, or
+	// approves a change they requested
+	ErrApprovalIdentity = errors.New("invalid approval identity")
+	// ErrInvalidChangeStatus is returned for an unknown status filter
+	ErrInvalidChangeStatus = errors.New("invalid change request status")
+)
+
+// anonymousIdentity is the requester of calls without a signed-in user
+const anonymousIdentity = "api"
+
+// changeSummary is the stored description of a change
+type changeSummary struct {
+	Devices []ConfirmationDevice `json:"devices"`
+	Params  any                  `json:"params,omitempty"`
+}
+
+// changeApprovalConfig returns the configured approval settings
+func (s *ShellyService) changeApprovalConfig() config.ChangeApprovalConfig {
+	if s.Config == nil {
+		return config.ChangeApprovalConfig{}
+	}
+	return s.Config.ChangeApproval
+}
+
+// RequireApproval enforces the two-person rule on an operation. It returns no
+// error when the operation may run: approval is off, it affects fewer devices
+// than change_approval.min_devices, or changeID names an approved, unexpired
+// request for exactly this operation, which is then marked executed by caller
+// and returned. Otherwise it returns the pending change request for the
+// operation, creating it, with ErrApprovalRequired.
+func (s *ShellyService) RequireApproval(op BulkOperation, caller string, changeID uint) (*database.ChangeRequest, error) {
+	cfg := s.changeApprovalConfig()
+	if !cfg.Enabled || len(op.DeviceIDs) < max(cfg.MinDevices, 1) {
+		return nil, nil
+	}
+	caller = identity(caller)
+	fingerprint, err := operationFingerprint(op)
+	if err != nil {
+		return nil, err
+	}
+	db := s.DB.GetDB()
+	now := time.Now()
+	if err := s.expireChangeRequests(now); err != nil {
+		return nil, err
+	}
+
+	if changeID != 0 {
+		change, err := s.GetChangeRequest(changeID)
+		if err != nil {
+			return nil, err
+		}
+		if change.Status != ChangeApproved || change.Fingerprint != fingerprint {
+			return nil, fmt.Errorf("%w: change request %d is %s or for another request", ErrChangeRequestState, changeID, change.Status)
+		}
+		result := db.Model(&database.ChangeRequest{}).
+			Where("id = ? AND status = ?", change.ID, ChangeApproved).
+			Updates(map[string]interface{}{"status": ChangeExecuted, "executed_by": caller, "executed_at": &now})
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to record change execution: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil, fmt.Errorf("%w: change request %d was already executed", ErrChangeRequestState, changeID)
+		}
+		s.logger.WithFields(map[string]any{
+			"change_id":   change.ID,
+			"operation":   op.Operation,
+			"executed_by": caller,
+			"component":   "change_approval",
+		}).Info("Approved change executed")
+		change.Status, change.ExecutedBy, change.ExecutedAt = ChangeExecuted, caller, &now
+		return change, nil
+	}
+
+	if caller == anonymousIdentity {
+		return nil, fmt.Errorf("%w: the requester must be signed in", ErrApprovalIdentity)
+	}
+
+	// Repeating a pending request does not open another one
+	var change database.ChangeRequest
+	if err := db.Where("fingerprint = ? AND requested_by = ? AND status = ?", fingerprint, caller, ChangePending).
+		Order("id DESC").Limit(1).Find(&change).Error; err != nil {
+		return nil, fmt.Errorf("failed to load change requests: %w", err)
+	}
+	if change.ID == 0 {
+		devices, err := s.confirmationDevices(op.DeviceIDs)
+		if err != nil {
+			return nil, err
+		}
+		summary, err := json.Marshal(changeSummary{Devices: devices, Params: op.Params})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode change summary: %w", err)
+		}
+		change = database.ChangeRequest{
+			Operation:   op.Operation,
+			Fingerprint: fingerprint,
+			Summary:     summary,
+			DeviceCount: len(op.DeviceIDs),
+			Status:      ChangePending,
+			RequestedBy: caller,
+			RequestedAt: now,
+			ExpiresAt:   now.Add(cfg.TTLDuration()),
+		}
+		if err := db.Create(&change).Error; err != nil {
+			return nil, fmt.Errorf("failed to create change request: %w", err)
+		}
+		s.logger.WithFields(map[string]any{
+			"change_id":    change.ID,
+			"operation":    op.Operation,
+			"devices":      len(op.DeviceIDs),
+			"requested_by": caller,
+			"component":    "change_approval",
+		}).Info("Change request created")
+	}
+	return &change, fmt.Errorf("%w: change request %d for %s must be approved by another user", ErrApprovalRequired, change.ID, op.Operation)
+}
+
+// ApproveChangeRequest approves a pending change request. The approver must
+// be identified and must not be its requester.
+func (s *ShellyService) ApproveChangeRequest(id uint, approver, comment string) (*database.ChangeRequest, error) {
+	approver = identity(approver)
+	if approver == anonymousIdentity {
+		return nil, fmt.Errorf("%w: the approver must be signed in", ErrApprovalIdentity)
+	}
+	change, err := s.GetChangeRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(change.RequestedBy, approver) {
+		return nil, fmt.Errorf("%w: %s cannot approve their own change request", ErrApprovalIdentity, approver)
+	}
+	return s.decideChangeRequest(change, ChangeApproved, approver, comment)
+}
+
+// RejectChangeRequest rejects a pending change request; the requester may
+// reject it to withdraw the change
+func (s *ShellyService) RejectChangeRequest(id uint, by, comment string) (*database.ChangeRequest, error) {
+	change, err := s.GetChangeRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.decideChangeRequest(change, ChangeRejected, identity(by), comment)
+}
+
+// GetChangeRequest returns a change request, expiring it when overdue
+func (s *ShellyService) GetChangeRequest(id uint) (*database.ChangeRequest, error) {
+	if err := s.expireChangeRequests(time.Now()); err != nil {
+		return nil, err
+	}
+	var change database.ChangeRequest
+	if err := s.DB.GetDB().First(&change, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrChangeRequestNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to load change request: %w", err)
+	}
+	return &change, nil
+}
+
+// ChangeRequests returns the change requests in a state, or all when status
+// is empty, newest first
+func (s *ShellyService) ChangeRequests(status string, limit int) ([]database.ChangeRequest, error) {
+	switch status {
+	case "", ChangePending, ChangeApproved, ChangeRejected, ChangeExecuted, ChangeExpired:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidChangeStatus, status)
+	}
+	if err := s.expireChangeRequests(time.Now()); err != nil {
+		return nil, err
+	}
+	q := s.DB.GetDB().Order("id DESC")
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	changes := []database.ChangeRequest{}
+	if err := q.Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load change requests: %w", err)
+	}
+	return changes, nil
+}
+
+// decideChangeRequest moves a pending change request to approved or rejected
+func (s *ShellyService) decideChangeRequest(change *database.ChangeRequest, status, by, comment string) (*database.ChangeRequest, error) {
+	if change.Status != ChangePending {
+		return nil, fmt.Errorf("%w: change request %d is %s", ErrChangeRequestState, change.ID, change.Status)
+	}
+	now := time.Now()
+	result := s.DB.GetDB().Model(&database.ChangeRequest{}).
+		Where("id = ? AND status = ?", change.ID, ChangePending).
+		Updates(map[string]interface{}{"status": status, "decided_by": by, "decided_at": &now, "comment": comment})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update change request: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: change request %d was decided meanwhile", ErrChangeRequestState, change.ID)
+	}
+	change.Status, change.DecidedBy, change.DecidedAt, change.Comment = status, by, &now, comment
+
+	s.logger.WithFields(map[string]any{
+		"change_id":  change.ID,
+		"operation":  change.Operation,
+		"status":     status,
+		"decided_by": by,
+		"component":  "change_approval",
+	}).Info("Change request decided")
+	return change, nil
+}
+
+// expireChangeRequests expires the requests that were not approved or not
+// executed in time
+func (s *ShellyService) expireChangeRequests(now time.Time) error {
+	if err := s.DB.GetDB().Model(&database.ChangeRequest{}).
+		Where("status IN ? AND expires_at <= ?", []string{ChangePending, ChangeApproved}, now).
+		Update("status", ChangeExpired).Error; err != nil {
+		return fmt.Errorf("failed to expire change requests: %w", err)
+	}
+	return nil
+}
+
+// identity normalises a caller identity, naming anonymous callers
+func identity(caller string) string {
+	if caller = strings.TrimSpace(caller); caller == "" {
+		return anonymousIdentity
+	}
+	return caller
+}
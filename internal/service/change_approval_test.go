@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_RequireApproval(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	for i, mac := range []string{"AABBCCDDEE01", "AABBCCDDEE02"} {
+		device := &database.Device{IP: "192.0.2." + string(rune('1'+i)), MAC: mac, Name: mac}
+		if err := db.AddDevice(device); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	op := BulkOperation{Operation: "config.bulk_export", DeviceIDs: []uint{1, 2}}
+
+	// Approval is off by default
+	if change, err := service.RequireApproval(op, "alice", 0); change != nil || err != nil {
+		t.Fatalf("Expected no approval needed while disabled, got %v, %v", change, err)
+	}
+
+	cfg.ChangeApproval.Enabled = true
+	cfg.ChangeApproval.MinDevices = 2
+	if _, err := service.RequireApproval(BulkOperation{Operation: "config.export", DeviceIDs: []uint{1}}, "alice", 0); err != nil {
+		t.Errorf("Expected a change below min_devices to run, got %v", err)
+	}
+	if _, err := service.RequireApproval(op, "", 0); !errors.Is(err, ErrApprovalIdentity) {
+		t.Errorf("Expected an anonymous request refused, got %v", err)
+	}
+
+	change, err := service.RequireApproval(op, "alice", 0)
+	if !errors.Is(err, ErrApprovalRequired) || change == nil || change.Status != ChangePending {
+		t.Fatalf("Expected a pending change request, got %+v, %v", change, err)
+	}
+	again, _ := service.RequireApproval(op, "alice", 0)
+	if again == nil || again.ID != change.ID {
+		t.Errorf("Expected the repeated request to reuse change request %d, got %+v", change.ID, again)
+	}
+	if _, err := service.RequireApproval(op, "alice", change.ID); !errors.Is(err, ErrChangeRequestState) {
+		t.Errorf("Expected a pending change request not to run, got %v", err)
+	}
+
+	if _, err := service.ApproveChangeRequest(change.ID, "Alice", ""); !errors.Is(err, ErrApprovalIdentity) {
+		t.Errorf("Expected self-approval refused, got %v", err)
+	}
+	if _, err := service.ApproveChangeRequest(change.ID, "", ""); !errors.Is(err, ErrApprovalIdentity) {
+		t.Errorf("Expected anonymous approval refused, got %v", err)
+	}
+	approved, err := service.ApproveChangeRequest(change.ID, "bob", "looks good")
+	if err != nil {
+		t.Fatalf("ApproveChangeRequest failed: %v", err)
+	}
+	if approved.Status != ChangeApproved || approved.DecidedBy != "bob" || approved.Comment != "looks good" {
+		t.Errorf("Unexpected approved change request: %+v", approved)
+	}
+	if _, err := service.RejectChangeRequest(change.ID, "carol", ""); !errors.Is(err, ErrChangeRequestState) {
+		t.Errorf("Expected a decided change request not to be rejected, got %v", err)
+	}
+
+	// The approval only runs the operation it was requested for, once
+	other := BulkOperation{Operation: "config.bulk_export", DeviceIDs: []uint{1, 2}, Params: map[string]any{"x": 1}}
+	if _, err := service.RequireApproval(other, "alice", change.ID); !errors.Is(err, ErrChangeRequestState) {
+		t.Errorf("Expected the approval refused for another operation, got %v", err)
+	}
+	executed, err := service.RequireApproval(op, "alice", change.ID)
+	if err != nil || executed == nil || executed.Status != ChangeExecuted {
+		t.Fatalf("Expected the approved change to run, got %+v, %v", executed, err)
+	}
+	if _, err := service.RequireApproval(op, "alice", change.ID); !errors.Is(err, ErrChangeRequestState) {
+		t.Errorf("Expected an executed change request not to run again, got %v", err)
+	}
+
+	stored, err := service.GetChangeRequest(change.ID)
+	if err != nil {
+		t.Fatalf("GetChangeRequest failed: %v", err)
+	}
+	if stored.RequestedBy != "alice" || stored.DecidedBy != "bob" || stored.ExecutedBy != "alice" || stored.ExecutedAt == nil {
+		t.Errorf("Expected the audit trail recorded, got %+v", stored)
+	}
+
+	// Overdue requests expire
+	expiring, _ := service.RequireApproval(other, "alice", 0)
+	if err := db.GetDB().Model(&database.ChangeRequest{}).Where("id = ?", expiring.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("Failed to expire change request: %v", err)
+	}
+	expired, err := service.ChangeRequests(ChangeExpired, 0)
+	if err != nil {
+		t.Fatalf("ChangeRequests failed: %v", err)
+	}
+	if len(expired) != 1 || expired[0].ID != expiring.ID {
+		t.Errorf("Expected change request %d expired, got %+v", expiring.ID, expired)
+	}
+	if _, err := service.ApproveChangeRequest(expiring.ID, "bob", ""); !errors.Is(err, ErrChangeRequestState) {
+		t.Errorf("Expected an expired change request not to be approved, got %v", err)
+	}
+	if _, err := service.ChangeRequests("bogus", 0); !errors.Is(err, ErrInvalidChangeStatus) {
+		t.Errorf("Expected an unknown status refused, got %v", err)
+	}
+}
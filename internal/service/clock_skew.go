@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// Clock skew defaults used when the configuration leaves them unset
+const (
+	defaultClockSkewThreshold = 30 // seconds
+	defaultClockSkewSNTP      = "pool.ntp.org"
+	clockSkewWorkers          = 10
+)
+
+// ClockSkewEntry is one device's clock compared with server time
+type ClockSkewEntry struct {
+	DeviceID    uint       `json:"device_id"`
+	Name        string     `json:"name"`
+	IP          string     `json:"ip"`
+	DeviceTime  *time.Time `json:"device_time,omitempty"`
+	SkewSeconds float64    `json:"skew_seconds"` // device minus server; positive runs ahead
+	Synced      bool       `json:"synced"`       // the device reports a valid clock
+	Flagged     bool       `json:"flagged"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// ClockSkewReport lists devices with their clock skew
+type ClockSkewReport struct {
+	CheckedAt        time.Time        `json:"checked_at"`
+	ThresholdSeconds int              `json:"threshold_seconds"`
+	Devices          []ClockSkewEntry `json:"devices"`
+	Flagged          int              `json:"flagged"`
+}
+
+// ClockSkewRemediation pushes an SNTP server to devices with a skewed clock
+type ClockSkewRemediation struct {
+	DeviceIDs  []uint `json:"device_ids,omitempty"` // empty selects flagged devices from the last report
+	SNTPServer string `json:"sntp_server,omitempty"`
+	DryRun     bool   `json:"dry_run"`
+}
+
+// ClockSkewCorrection is the remediation outcome for one device
+type ClockSkewCorrection struct {
+	DeviceID   uint   `json:"device_id"`
+	Name       string `json:"name"`
+	SNTPServer string `json:"sntp_server"`
+	Changed    bool   `json:"changed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// sntpSetter is implemented by device clients that can change their SNTP server
+type sntpSetter interface {
+	SetSNTPServer(ctx context.Context, server string) error
+}
+
+// clockSkewThreshold returns the skew above which a device is flagged
+func (s *ShellyService) clockSkewThreshold() int {
+	if s.Config == nil || s.Config.Metrics.ClockSkewThreshold <= 0 {
+		return defaultClockSkewThreshold
+	}
+	return s.Config.Metrics.ClockSkewThreshold
+}
+
+// CheckClockSkew reads the clock of every device marked online and compares
+// it with server time, taking the midpoint of the status request as reference.
+// Devices without a valid clock or off by more than the threshold are
+// flagged. The report is kept for ClockSkew and remediation.
+func (s *ShellyService) CheckClockSkew(ctx context.Context) (*ClockSkewReport, error) {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	targets := []database.Device{}
+	for _, d := range devices {
+		if d.Status == "online" {
+			targets = append(targets, d)
+		}
+	}
+
+	threshold := s.clockSkewThreshold()
+	entries := make([]ClockSkewEntry, len(targets))
+	fanOut(s.pollWorkers(clockSkewWorkers), len(targets), func(i int) {
+		s.recoveryPause(ctx)
+		entries[i] = s.deviceClockSkew(ctx, &targets[i], threshold)
+	})
+
+	report := &ClockSkewReport{CheckedAt: time.Now(), ThresholdSeconds: threshold, Devices: entries}
+	for _, e := range entries {
+		if e.Flagged {
+			report.Flagged++
+		}
+	}
+
+	s.skewMu.Lock()
+	s.clockSkew = report
+	s.skewMu.Unlock()
+
+	if report.Flagged > 0 {
+		s.logger.WithFields(map[string]any{
+			"devices":   len(entries),
+			"flagged":   report.Flagged,
+			"threshold": threshold,
+			"component": "service",
+		}).Warn("Devices with clock skew detected")
+	}
+	return report, nil
+}
+
+// ClockSkew returns the latest clock skew report, or nil before the first check
+func (s *ShellyService) ClockSkew() *ClockSkewReport {
+	s.skewMu.Lock()
+	defer s.skewMu.Unlock()
+	return s.clockSkew
+}
+
+// deviceClockSkew reads one device's clock
+func (s *ShellyService) deviceClockSkew(ctx context.Context, device *database.Device, threshold int) ClockSkewEntry {
+	entry := ClockSkewEntry{DeviceID: device.ID, Name: device.Name, IP: device.IP}
+	client, err := s.getClient(device)
+	if err != nil {
+		entry.Error = fmt.Sprintf("failed to create client: %v", err)
+		return entry
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+
+	before := time.Now()
+	status, err := s.readStatus(ctx, client, device)
+	if err != nil {
+		entry.Error = fmt.Sprintf("failed to read status: %v", err)
+		return entry
+	}
+	server := before.Add(time.Since(before) / 2)
+	s.recordUptime(device.ID, status)
+	s.recordProtection(device.ID, status)
+	s.recordEnergy(device.ID, status)
+
+	unix, _ := status.Raw["unixtime"].(float64)
+	if sys := mapAt(status.Raw, "sys"); sys != nil {
+		unix, _ = sys["unixtime"].(float64)
+	}
+	if unix <= 0 {
+		entry.Flagged = true
+		return entry
+	}
+	deviceTime := time.Unix(int64(unix), 0)
+	entry.DeviceTime = &deviceTime
+	entry.Synced = true
+	entry.SkewSeconds = math.Round(deviceTime.Sub(server).Seconds())
+	entry.Flagged = math.Abs(entry.SkewSeconds) > float64(threshold)
+	return entry
+}
+
+// CorrectClockSkew pushes an SNTP server to the selected devices, by default
+// those flagged in the latest report. Devices whose client cannot set SNTP
+// are reported with an error.
+func (s *ShellyService) CorrectClockSkew(ctx context.Context, req ClockSkewRemediation) ([]ClockSkewCorrection, error) {
+	server := req.SNTPServer
+	if server == "" && s.Config != nil {
+		server = s.Config.Metrics.ClockSkewSNTPServer
+	}
+	if server == "" {
+		server = defaultClockSkewSNTP
+	}
+
+	ids := req.DeviceIDs
+	if len(ids) == 0 {
+		if report := s.ClockSkew(); report != nil {
+			for _, e := range report.Devices {
+				if e.Flagged && e.Error == "" {
+					ids = append(ids, e.DeviceID)
+				}
+			}
+		}
+	}
+
+	results := make([]ClockSkewCorrection, 0, len(ids))
+	for _, id := range ids {
+		device, err := s.DB.GetDevice(id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, id)
+		}
+		result := ClockSkewCorrection{DeviceID: device.ID, Name: device.Name, SNTPServer: server}
+		if req.DryRun {
+			result.Changed = true
+			results = append(results, result)
+			continue
+		}
+		if err := s.setSNTPServer(ctx, device, server); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Changed = true
+		}
+		results = append(results, result)
+	}
+
+	if !req.DryRun && len(results) > 0 {
+		s.logger.WithFields(map[string]any{
+			"devices":     len(results),
+			"sntp_server": server,
+			"component":   "service",
+		}).Info("Pushed SNTP server to devices with clock skew")
+	}
+	return results, nil
+}
+
+// setSNTPServer changes one device's SNTP server
+func (s *ShellyService) setSNTPServer(ctx context.Context, device *database.Device, server string) error {
+	client, err := s.getClient(device)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	setter, ok := client.(sntpSetter)
+	if !ok {
+		return fmt.Errorf("device client does not support SNTP settings")
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	return setter.SetSNTPServer(ctx, server)
+}
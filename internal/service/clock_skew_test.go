@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+)
+
+func TestShellyService_ClockSkew(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	server := createMockShellyServer()
+	defer server.Close()
+
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	cfg.DeviceClient.Timeout = config.IntPtr(1)
+	cfg.DeviceClient.RetryAttempts = config.IntPtr(1)
+	cfg.DeviceClient.RetryDelay = config.IntPtr(1)
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	device := createTestDevice(t, db, server.URL[len("http://"):])
+	device.Status = "online"
+	if err := db.UpdateDevice(device); err != nil {
+		t.Fatalf("Failed to update device: %v", err)
+	}
+
+	if service.ClockSkew() != nil {
+		t.Fatal("Expected no report before the first check")
+	}
+	report, err := service.CheckClockSkew(context.Background())
+	if err != nil {
+		t.Fatalf("CheckClockSkew failed: %v", err)
+	}
+	// The mock device reports a clock from 2022
+	if len(report.Devices) != 1 || report.Flagged != 1 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	entry := report.Devices[0]
+	if !entry.Synced || entry.SkewSeconds >= 0 || entry.DeviceTime == nil {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if service.ClockSkew() != report {
+		t.Error("Expected the report to be cached")
+	}
+
+	results, err := service.CorrectClockSkew(context.Background(), ClockSkewRemediation{DryRun: true})
+	if err != nil {
+		t.Fatalf("CorrectClockSkew dry run failed: %v", err)
+	}
+	if len(results) != 1 || results[0].DeviceID != device.ID || results[0].SNTPServer != "pool.ntp.org" {
+		t.Fatalf("Unexpected dry run results: %+v", results)
+	}
+
+	results, err = service.CorrectClockSkew(context.Background(), ClockSkewRemediation{SNTPServer: "ntp.lan"})
+	if err != nil {
+		t.Fatalf("CorrectClockSkew failed: %v", err)
+	}
+	if len(results) != 1 || !results[0].Changed || results[0].Error != "" {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+
+	if _, err := service.CorrectClockSkew(context.Background(), ClockSkewRemediation{DeviceIDs: []uint{999}}); err == nil {
+		t.Error("Expected error for unknown device")
+	}
+}
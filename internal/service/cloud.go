@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// CloudRequiredTag exempts a device from fleet-wide cloud disabling, e.g.
+// when it is still updated or controlled through Shelly Cloud
+const CloudRequiredTag = "cloud:required"
+
+// CloudDisableRequest selects the devices audited by DisableCloud
+type CloudDisableRequest struct {
+	DeviceIDs []uint `json:"device_ids,omitempty"` // empty selects every device
+	Tag       string `json:"tag,omitempty"`        // restrict to devices carrying this tag
+	DryRun    bool   `json:"dry_run"`              // only audit cloud.enable
+	Force     bool   `json:"force"`                // also try devices marked offline
+}
+
+// CloudDisableResult reports the cloud state of one device
+type CloudDisableResult struct {
+	DeviceID      uint   `json:"device_id"`
+	Name          string `json:"name"`
+	CloudEnabled  *bool  `json:"cloud_enabled,omitempty"` // state before the change, nil when unknown
+	Changed       bool   `json:"changed"`
+	RequiresCloud bool   `json:"requires_cloud,omitempty"`
+	Skipped       string `json:"skipped,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// gen1CloudSetter and gen2CloudSetter are implemented by the device clients
+type gen1CloudSetter interface {
+	SetCloudConfig(ctx context.Context, enabled bool, server string) error
+}
+
+type gen2CloudSetter interface {
+	SetCloudConfig(ctx context.Context, config map[string]interface{}) error
+}
+
+// DisableCloud audits cloud.enable on the selected devices and turns Shelly
+// Cloud off where it is on. Devices tagged cloud:required are reported but
+// left alone; with DryRun nothing is changed.
+func (s *ShellyService) DisableCloud(ctx context.Context, req CloudDisableRequest) ([]CloudDisableResult, error) {
+	devices, err := s.SelectDevices(req.DeviceIDs, req.Tag)
+	if err != nil {
+		return nil, err
+	}
+	tags := s.deviceTags()
+
+	results := []CloudDisableResult{}
+	for i := range devices {
+		device := &devices[i]
+		required := containsFold(tags[device.ID], CloudRequiredTag)
+		results = append(results, s.disableDeviceCloud(ctx, device, required, req))
+	}
+
+	changed := 0
+	for _, r := range results {
+		if r.Changed {
+			changed++
+		}
+	}
+	s.logger.WithFields(map[string]any{
+		"devices":   len(results),
+		"changed":   changed,
+		"dry_run":   req.DryRun,
+		"component": "service",
+	}).Info("Fleet cloud disable completed")
+	return results, nil
+}
+
+// disableDeviceCloud audits and, unless exempt, disables cloud on one device
+func (s *ShellyService) disableDeviceCloud(ctx context.Context, device *database.Device, required bool, req CloudDisableRequest) CloudDisableResult {
+	result := CloudDisableResult{DeviceID: device.ID, Name: device.Name, RequiresCloud: required}
+	if device.Status == "offline" && !req.Force {
+		result.Skipped = "device offline"
+		return result
+	}
+
+	client, err := s.getClient(device)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create client: %v", err)
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+
+	cfg, err := client.GetConfig(ctx)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to read cloud settings: %v", err)
+		return result
+	}
+	if cfg.Cloud == nil {
+		result.Skipped = "device does not report cloud settings"
+		return result
+	}
+	enabled := cfg.Cloud.Enable
+	result.CloudEnabled = &enabled
+	if !enabled {
+		return result
+	}
+	if required {
+		result.Skipped = "tagged " + CloudRequiredTag
+		return result
+	}
+
+	result.Changed = true
+	if req.DryRun {
+		return result
+	}
+	switch c := client.(type) {
+	case gen1CloudSetter:
+		err = c.SetCloudConfig(ctx, false, "")
+	case gen2CloudSetter:
+		err = c.SetCloudConfig(ctx, map[string]interface{}{"enable": false})
+	default:
+		err = fmt.Errorf("device client does not support cloud settings")
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to disable cloud: %v", err)
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/intake"
+	"github.com/ginsys/shelly-manager/internal/shellycloud"
+)
+
+// Cloud import suggestions
+const (
+	CloudInInventory = "in_inventory" // already managed
+	CloudAdopt       = "adopt"        // seen on the local network, ready to adopt
+	CloudNotFound    = "not_found"    // not seen locally yet
+)
+
+// CloudImportRequest names the Shelly Cloud account to import, defaulting to
+// the configured one. A key given here is only used for this request and
+// never stored.
+type CloudImportRequest struct {
+	Server  string `json:"server"`
+	AuthKey string `json:"auth_key"`
+	DryRun  bool   `json:"dry_run"`
+}
+
+// CloudImportDevice is a cloud device with its adoption suggestion
+type CloudImportDevice struct {
+	shellycloud.Device
+	Suggestion string `json:"suggestion"`
+	DeviceID   uint   `json:"device_id,omitempty"`   // inventory device
+	DeviceName string `json:"device_name,omitempty"` // inventory name when it differs from the cloud
+	LocalIP    string `json:"local_ip,omitempty"`    // address seen by discovery
+	IntakeID   uint   `json:"intake_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// CloudImportResult summarises a cloud import
+type CloudImportResult struct {
+	DryRun      bool                `json:"dry_run"`
+	Devices     []CloudImportDevice `json:"devices"`
+	InInventory int                 `json:"in_inventory"`
+	Adoptable   int                 `json:"adoptable"`
+	NotFound    int                 `json:"not_found"`
+	Registered  int                 `json:"registered"`
+}
+
+// ImportCloudDevices reads the devices registered to a Shelly Cloud account
+// and suggests what to do with each. Devices not yet in the inventory are
+// pre-registered for intake with their cloud name and room, so discovery
+// adopts them under those names; inventory devices get their cloud room as
+// a "room:<name>" tag. A dry run only reports the suggestions.
+func (s *ShellyService) ImportCloudDevices(ctx context.Context, req CloudImportRequest) (*CloudImportResult, error) {
+	client, err := s.cloudClient(req.Server, req.AuthKey)
+	if err != nil {
+		return nil, err
+	}
+	cloudDevices, err := client.Devices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	inventory := make(map[string]*database.Device, len(devices))
+	for i := range devices {
+		inventory[normalizeMAC(devices[i].MAC)] = &devices[i]
+	}
+	discovered, err := s.DB.GetDiscoveredDevices("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load discovered devices: %w", err)
+	}
+	seen := make(map[string]string, len(discovered))
+	for _, d := range discovered {
+		// Newest first; keep the latest address
+		if mac := normalizeMAC(d.MAC); seen[mac] == "" {
+			seen[mac] = d.IP
+		}
+	}
+
+	result := &CloudImportResult{DryRun: req.DryRun, Devices: make([]CloudImportDevice, 0, len(cloudDevices))}
+	for _, cd := range cloudDevices {
+		item := CloudImportDevice{Device: cd}
+		if device, ok := inventory[cd.MAC]; ok {
+			item.Suggestion = CloudInInventory
+			item.DeviceID = device.ID
+			if device.Name != cd.Name {
+				item.DeviceName = device.Name
+			}
+			result.InInventory++
+			if !req.DryRun && cd.Room != "" {
+				if err := s.tagDevice(device.ID, "room:"+cd.Room); err != nil {
+					item.Error = err.Error()
+				}
+			}
+			result.Devices = append(result.Devices, item)
+			continue
+		}
+
+		if ip, ok := seen[cd.MAC]; ok {
+			item.Suggestion = CloudAdopt
+			item.LocalIP = ip
+			result.Adoptable++
+		} else {
+			item.Suggestion = CloudNotFound
+			result.NotFound++
+		}
+		if !req.DryRun {
+			entry, err := s.Intake.Register(ctx, intake.Label{
+				MAC:   cd.MAC,
+				Model: cd.Model,
+				Name:  cd.Name,
+				Room:  cd.Room,
+			}, intake.SourceCloud)
+			if err != nil {
+				item.Error = err.Error()
+			} else {
+				item.IntakeID = entry.ID
+				result.Registered++
+			}
+		}
+		result.Devices = append(result.Devices, item)
+	}
+
+	s.logger.WithFields(map[string]any{
+		"cloud_devices": len(cloudDevices),
+		"in_inventory":  result.InInventory,
+		"adoptable":     result.Adoptable,
+		"not_found":     result.NotFound,
+		"registered":    result.Registered,
+		"dry_run":       req.DryRun,
+		"component":     "cloud_import",
+	}).Info("Shelly Cloud account imported")
+	return result, nil
+}
+
+// tagDevice adds a tag to a device unless it is already set
+func (s *ShellyService) tagDevice(deviceID uint, tag string) error {
+	t := database.DeviceTag{DeviceID: deviceID, Tag: tag}
+	if err := s.DB.GetDB().Where("device_id = ? AND tag = ?", deviceID, tag).FirstOrCreate(&t).Error; err != nil {
+		return fmt.Errorf("failed to tag device %d: %w", deviceID, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/intake"
+)
+
+func TestShellyService_ImportCloudDevices(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	cloud := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/interface/room/list":
+			_, _ = w.Write([]byte(`{"isok":true,"data":{"rooms":{"1":{"id":1,"name":"Hall"}}}}`))
+		case "/interface/device/list":
+			_, _ = w.Write([]byte(`{"isok":true,"data":{"devices":{
+				"aabbccddee01":{"id":"aabbccddee01","type":"SHSW-1","name":"Hall light","room_id":1},
+				"aabbccddee02":{"id":"aabbccddee02","type":"SNSW-001X16EU","name":"Porch","room_id":1},
+				"aabbccddee03":{"id":"aabbccddee03","type":"SHPLG-S","name":"Heater"}
+			}}}`))
+		}
+	}))
+	defer cloud.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	managed := &database.Device{IP: "192.0.2.1", MAC: "AA:BB:CC:DD:EE:01", Name: "hall-1"}
+	if err := db.AddDevice(managed); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	err := db.UpsertDiscoveredDevice(&database.DiscoveredDevice{
+		MAC: "aa:bb:cc:dd:ee:02", IP: "192.0.2.2", AgentID: "agent", Discovered: time.Now(), ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to store discovered device: %v", err)
+	}
+
+	ctx := context.Background()
+	req := CloudImportRequest{Server: cloud.URL, AuthKey: "secret", DryRun: true}
+	result, err := service.ImportCloudDevices(ctx, req)
+	if err != nil {
+		t.Fatalf("ImportCloudDevices failed: %v", err)
+	}
+	if result.InInventory != 1 || result.Adoptable != 1 || result.NotFound != 1 || result.Registered != 0 {
+		t.Fatalf("Expected one device of each kind and nothing registered, got %+v", result)
+	}
+	if d := result.Devices[0]; d.Suggestion != CloudInInventory || d.DeviceID != managed.ID || d.DeviceName != "hall-1" {
+		t.Errorf("Expected the managed device matched, got %+v", d)
+	}
+	if d := result.Devices[1]; d.Suggestion != CloudAdopt || d.LocalIP != "192.0.2.2" {
+		t.Errorf("Expected the porch device adoptable, got %+v", d)
+	}
+	if entries, _ := service.Intake.List(ctx, ""); len(entries) != 0 {
+		t.Errorf("Did not expect a dry run to register devices, got %+v", entries)
+	}
+
+	req.DryRun = false
+	if result, err = service.ImportCloudDevices(ctx, req); err != nil || result.Registered != 2 {
+		t.Fatalf("Expected two devices registered, got %+v, %v", result, err)
+	}
+	entries, _ := service.Intake.List(ctx, "")
+	if len(entries) != 2 || entries[0].Source != intake.SourceCloud {
+		t.Fatalf("Expected two cloud intake entries, got %+v", entries)
+	}
+	for _, e := range entries {
+		if e.MAC == "AABBCCDDEE02" && (e.Name != "Porch" || e.Room != "Hall") {
+			t.Errorf("Expected the cloud name and room kept, got %+v", e)
+		}
+	}
+	if tags := service.deviceTags()[managed.ID]; len(tags) != 1 || tags[0] != "room:Hall" {
+		t.Errorf("Expected the managed device tagged with its room, got %v", tags)
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ginsys/shelly-manager/internal/naming"
+	"github.com/ginsys/shelly-manager/internal/shellycloud"
+)
+
+// CloudSyncRequest selects the devices whose Shelly Cloud name and room are
+// aligned with the inventory by SyncCloud. Names and Rooms default to
+// shelly_cloud.sync_names and sync_rooms; Server and AuthKey to the
+// configured account.
+type CloudSyncRequest struct {
+	DeviceIDs []uint `json:"device_ids,omitempty"` // empty selects every device
+	Tag       string `json:"tag,omitempty"`        // restrict to devices carrying this tag
+	DryRun    bool   `json:"dry_run"`
+	Names     *bool  `json:"names,omitempty"`
+	Rooms     *bool  `json:"rooms,omitempty"`
+	Server    string `json:"server,omitempty"`
+	AuthKey   string `json:"auth_key,omitempty"`
+}
+
+// CloudSyncResult reports the outcome for one device
+type CloudSyncResult struct {
+	DeviceID    uint   `json:"device_id"`
+	Name        string `json:"name"`           // inventory name
+	Room        string `json:"room,omitempty"` // from the room:<name> tag
+	CloudID     string `json:"cloud_id,omitempty"`
+	CloudName   string `json:"cloud_name,omitempty"` // before the sync
+	CloudRoom   string `json:"cloud_room,omitempty"` // before the sync
+	NameChanged bool   `json:"name_changed"`
+	RoomChanged bool   `json:"room_changed"`
+	RoomMissing bool   `json:"room_missing,omitempty"` // the room does not exist in the cloud
+	Skipped     string `json:"skipped,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// cloudClient returns a client for the given account, falling back to the
+// configured one
+func (s *ShellyService) cloudClient(server, authKey string) (*shellycloud.Client, error) {
+	if server == "" && authKey == "" && s.Config != nil {
+		server, authKey = s.Config.ShellyCloud.Server, s.Config.ShellyCloud.AuthKey
+	}
+	return shellycloud.NewClient(shellycloud.ClientConfig{Server: server, AuthKey: authKey}, s.logger)
+}
+
+// SyncCloud pushes inventory names and rooms ("room:<name>" tags) to the
+// Shelly Cloud account, so the Shelly app shows the same names and rooms as
+// the manager. Rooms are matched by name and never created; devices not
+// registered to the account are skipped. With DryRun only the differences
+// are reported.
+func (s *ShellyService) SyncCloud(ctx context.Context, req CloudSyncRequest) ([]CloudSyncResult, error) {
+	syncNames, syncRooms := true, true
+	if s.Config != nil {
+		syncNames, syncRooms = s.Config.ShellyCloud.SyncNames, s.Config.ShellyCloud.SyncRooms
+	}
+	if req.Names != nil {
+		syncNames = *req.Names
+	}
+	if req.Rooms != nil {
+		syncRooms = *req.Rooms
+	}
+
+	devices, err := s.SelectDevices(req.DeviceIDs, req.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.cloudClient(req.Server, req.AuthKey)
+	if err != nil {
+		return nil, err
+	}
+	cloudDevices, err := client.Devices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byMAC := make(map[string]shellycloud.Device, len(cloudDevices))
+	for _, cd := range cloudDevices {
+		byMAC[cd.MAC] = cd
+	}
+	rooms, err := client.Rooms(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sync := cloudSync{client: client, rooms: rooms, dryRun: req.DryRun, syncNames: syncNames, syncRooms: syncRooms}
+	tags := s.deviceTags()
+	results := []CloudSyncResult{}
+	for i := range devices {
+		device := &devices[i]
+		var subject naming.Subject
+		subject.ApplyTags(tags[device.ID])
+		result := CloudSyncResult{DeviceID: device.ID, Name: device.Name, Room: subject.Room}
+		if cd, ok := byMAC[normalizeMAC(device.MAC)]; ok {
+			sync.device(ctx, cd, &result)
+		} else {
+			result.Skipped = "not registered in Shelly Cloud"
+		}
+		results = append(results, result)
+	}
+
+	changed := 0
+	for _, r := range results {
+		if r.NameChanged || r.RoomChanged {
+			changed++
+		}
+	}
+	s.logger.WithFields(map[string]any{
+		"devices":   len(results),
+		"changed":   changed,
+		"dry_run":   req.DryRun,
+		"component": "cloud_sync",
+	}).Info("Shelly Cloud sync completed")
+	return results, nil
+}
+
+// cloudSync applies the changes of one sync. Once the server turns out not
+// to support a change, the remaining devices report it without calling.
+type cloudSync struct {
+	client    *shellycloud.Client
+	rooms     []shellycloud.Room
+	dryRun    bool
+	syncNames bool
+	syncRooms bool
+	nameErr   error
+	roomErr   error
+}
+
+// device aligns the cloud name and room of a single device
+func (c *cloudSync) device(ctx context.Context, cd shellycloud.Device, result *CloudSyncResult) {
+	result.CloudID = cd.ID
+	result.CloudName = cd.Name
+	result.CloudRoom = cd.Room
+	var errs []string
+
+	if c.syncNames && result.Name != "" && result.Name != cd.Name {
+		result.NameChanged = true
+		if err := c.apply(&c.nameErr, func() error { return c.client.SetDeviceName(ctx, cd.ID, result.Name) }); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to set cloud name: %v", err))
+		}
+	}
+
+	if c.syncRooms && result.Room != "" && !strings.EqualFold(result.Room, cd.Room) {
+		roomID := int64(-1)
+		for _, r := range c.rooms {
+			if strings.EqualFold(r.Name, result.Room) {
+				roomID = r.ID
+				break
+			}
+		}
+		if roomID < 0 {
+			result.RoomMissing = true
+		} else {
+			result.RoomChanged = true
+			if err := c.apply(&c.roomErr, func() error { return c.client.SetDeviceRoom(ctx, cd.ID, roomID) }); err != nil {
+				errs = append(errs, fmt.Sprintf("failed to set cloud room: %v", err))
+			}
+		}
+	}
+	result.Error = strings.Join(errs, "; ")
+}
+
+// apply runs a change unless this is a dry run or the server already
+// reported the change as unsupported
+func (c *cloudSync) apply(unsupported *error, change func() error) error {
+	if c.dryRun {
+		return nil
+	}
+	if *unsupported != nil {
+		return *unsupported
+	}
+	err := change()
+	if errors.Is(err, shellycloud.ErrNotSupported) {
+		*unsupported = err
+	}
+	return err
+}
+
+// StartCloudSync periodically pushes names and rooms to Shelly Cloud when
+// shelly_cloud.sync_enabled is set and an account is configured
+func (s *ShellyService) StartCloudSync() {
+	if s.Config == nil || !s.Config.ShellyCloud.SyncEnabled {
+		return
+	}
+	if !s.Config.ShellyCloud.Configured() {
+		s.logger.WithFields(map[string]any{
+			"component": "cloud_sync",
+		}).Warn("Shelly Cloud sync enabled without shelly_cloud.server and auth_key; not started")
+		return
+	}
+	interval := s.Config.ShellyCloud.SyncIntervalDuration()
+
+	go func() {
+		ticker := s.clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if s.leader == nil || s.leader() {
+				if _, err := s.SyncCloud(s.ctx, CloudSyncRequest{}); err != nil && s.ctx.Err() == nil {
+					s.logger.WithFields(map[string]any{
+						"error":     err.Error(),
+						"component": "cloud_sync",
+					}).Warn("Shelly Cloud sync failed")
+				}
+			}
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]any{
+		"interval":  interval.String(),
+		"component": "cloud_sync",
+	}).Info("Started Shelly Cloud sync")
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_SyncCloud(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	var mu sync.Mutex
+	var calls []string
+	cloud := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		switch r.URL.Path {
+		case "/interface/room/list":
+			_, _ = w.Write([]byte(`{"isok":true,"data":{"rooms":{"1":{"id":1,"name":"Hall"},"2":{"id":2,"name":"Kitchen"}}}}`))
+		case "/interface/device/list":
+			_, _ = w.Write([]byte(`{"isok":true,"data":{"devices":{
+				"aabbccddee01":{"id":"aabbccddee01","type":"SHSW-1","name":"shelly1-aabbccddee01","room_id":1},
+				"aabbccddee02":{"id":"aabbccddee02","type":"SHSW-1","name":"porch","room_id":1}
+			}}}`))
+		case "/interface/device/set_name", "/interface/device/set_room":
+			mu.Lock()
+			calls = append(calls, r.URL.Path+" "+r.PostForm.Get("id")+" "+r.PostForm.Get("name")+r.PostForm.Get("room_id"))
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"isok":true,"data":{}}`))
+		}
+	}))
+	defer cloud.Close()
+
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	cfg.ShellyCloud.Server = cloud.URL
+	cfg.ShellyCloud.AuthKey = "secret"
+	cfg.ShellyCloud.SyncNames = true
+	cfg.ShellyCloud.SyncRooms = true
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	kitchen := &database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Name: "kitchen-light"}
+	porch := &database.Device{IP: "192.0.2.2", MAC: "AABBCCDDEE02", Name: "porch"}
+	local := &database.Device{IP: "192.0.2.3", MAC: "AABBCCDDEE03", Name: "local-only"}
+	for _, d := range []*database.Device{kitchen, porch, local} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	if err := service.tagDevice(kitchen.ID, "room:Kitchen"); err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+	if err := service.tagDevice(porch.ID, "room:Garden"); err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+
+	ctx := context.Background()
+	results, err := service.SyncCloud(ctx, CloudSyncRequest{DryRun: true})
+	if err != nil {
+		t.Fatalf("SyncCloud failed: %v", err)
+	}
+	if len(results) != 3 || len(calls) != 0 {
+		t.Fatalf("Expected three results and no changes on a dry run, got %+v, %v", results, calls)
+	}
+	if r := results[0]; !r.NameChanged || !r.RoomChanged || r.CloudName != "shelly1-aabbccddee01" || r.CloudRoom != "Hall" {
+		t.Errorf("Expected the kitchen light renamed and moved, got %+v", r)
+	}
+	if r := results[1]; r.NameChanged || r.RoomChanged || !r.RoomMissing {
+		t.Errorf("Expected the porch in sync with a missing room, got %+v", r)
+	}
+	if r := results[2]; r.Skipped == "" {
+		t.Errorf("Expected the local device skipped, got %+v", r)
+	}
+
+	if _, err := service.SyncCloud(ctx, CloudSyncRequest{}); err != nil {
+		t.Fatalf("SyncCloud failed: %v", err)
+	}
+	want := []string{
+		"/interface/device/set_name aabbccddee01 kitchen-light",
+		"/interface/device/set_room aabbccddee01 2",
+	}
+	if len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] {
+		t.Errorf("Expected %v, got %v", want, calls)
+	}
+
+	if _, err := service.SyncCloud(ctx, CloudSyncRequest{DeviceIDs: []uint{999}}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected an unknown device to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_DisableCloud(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+
+	var mu sync.Mutex
+	cloudEnabled := true
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shelly", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"type": "SHSW-25", "mac": "68C63A123456", "auth": false, "fw": "1.14.0"}`)
+	})
+	mux.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"name": "Test Device", "cloud": {"enabled": %t, "connected": false}}`, cloudEnabled)
+	})
+	mux.HandleFunc("/settings/cloud", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = r.ParseForm()
+		cloudEnabled = r.Form.Get("enabled") == "true"
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"enabled": %t, "connected": false}`, cloudEnabled)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	device := createTestDevice(t, db, server.URL[len("http://"):])
+	offline := &database.Device{IP: "192.0.2.50", MAC: "68C63A000050", Name: "porch", Status: "offline"}
+	if err := db.AddDevice(offline); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+
+	results, err := service.DisableCloud(context.Background(), CloudDisableRequest{DryRun: true})
+	if err != nil {
+		t.Fatalf("DisableCloud failed: %v", err)
+	}
+	if len(results) != 2 || !results[0].Changed || results[0].CloudEnabled == nil || !*results[0].CloudEnabled ||
+		results[1].Skipped != "device offline" {
+		t.Fatalf("Unexpected preview: %+v", results)
+	}
+	if !cloudEnabled {
+		t.Fatal("Dry run must not change the device")
+	}
+
+	// Devices that need the cloud are reported but left alone
+	if err := db.AddDeviceTag(device.ID, CloudRequiredTag); err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+	results, _ = service.DisableCloud(context.Background(), CloudDisableRequest{DeviceIDs: []uint{device.ID}})
+	if len(results) != 1 || results[0].Changed || !results[0].RequiresCloud || !cloudEnabled {
+		t.Fatalf("Expected exempt device to keep cloud, got %+v", results)
+	}
+
+	if err := db.RemoveDeviceTag(device.ID, CloudRequiredTag); err != nil {
+		t.Fatalf("Failed to untag device: %v", err)
+	}
+	results, _ = service.DisableCloud(context.Background(), CloudDisableRequest{DeviceIDs: []uint{device.ID}})
+	if len(results) != 1 || !results[0].Changed || results[0].Error != "" || cloudEnabled {
+		t.Errorf("Expected cloud to be disabled, got %+v", results)
+	}
+}
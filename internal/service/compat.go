@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+var (
+	// ErrCompatDisabled is returned when the Gen1 compatibility layer, or
+	// the requested endpoint, is switched off
+	ErrCompatDisabled = errors.New("gen1 compatibility endpoint is disabled")
+	// ErrCompatRequest is returned for Gen1 requests the layer cannot
+	// translate, e.g. an unknown turn value or a relay the device lacks
+	ErrCompatRequest = errors.New("invalid gen1 request")
+)
+
+// CompatRelayStatus is the Gen1 /relay/{n} answer
+type CompatRelayStatus struct {
+	IsOn           bool    `json:"ison"`
+	HasTimer       bool    `json:"has_timer"`
+	TimerStarted   int64   `json:"timer_started"`
+	TimerDuration  float64 `json:"timer_duration"`
+	TimerRemaining float64 `json:"timer_remaining"`
+	Overpower      bool    `json:"overpower,omitempty"`
+	Source         string  `json:"source"`
+}
+
+// CompatMeter is a Gen1 /status meter
+type CompatMeter struct {
+	Power     float64 `json:"power"`
+	IsValid   bool    `json:"is_valid"`
+	Timestamp int64   `json:"timestamp"`
+	Total     int64   `json:"total"` // watt-minutes, as Gen1 reports them
+}
+
+// CompatWiFiStatus is the Gen1 /status wifi_sta section
+type CompatWiFiStatus struct {
+	Connected bool   `json:"connected"`
+	SSID      string `json:"ssid"`
+	IP        string `json:"ip"`
+	RSSI      int    `json:"rssi"`
+}
+
+// CompatStatus is the Gen1 /status answer
+type CompatStatus struct {
+	WiFiStatus      CompatWiFiStatus    `json:"wifi_sta"`
+	Time            string              `json:"time"`
+	Unixtime        int64               `json:"unixtime"`
+	HasUpdate       bool                `json:"has_update"`
+	MAC             string              `json:"mac"`
+	Relays          []CompatRelayStatus `json:"relays"`
+	Meters          []CompatMeter       `json:"meters"`
+	Temperature     float64             `json:"temperature"`
+	Overtemperature bool                `json:"overtemperature"`
+	RAMTotal        int                 `json:"ram_total"`
+	RAMFree         int                 `json:"ram_free"`
+	FSSize          int                 `json:"fs_size"`
+	FSFree          int                 `json:"fs_free"`
+	Uptime          int                 `json:"uptime"`
+}
+
+// CompatShelly is the Gen1 /shelly answer
+type CompatShelly struct {
+	Type     string `json:"type"`
+	MAC      string `json:"mac"`
+	Auth     bool   `json:"auth"`
+	FW       string `json:"fw"`
+	Name     string `json:"name,omitempty"`
+	DeviceID uint   `json:"device_id"` // the managed device's ID
+}
+
+// compatDevice checks the endpoint is exposed and resolves a device from its
+// ID, MAC or name, as legacy scripts address devices in any of these ways
+func (s *ShellyService) compatDevice(ctx context.Context, endpoint, ident string) (*database.Device, error) {
+	var compatCfg config.CompatConfig
+	if s.Config != nil {
+		compatCfg = s.Config.Compat
+	}
+	if !compatCfg.Allows(endpoint) {
+		return nil, fmt.Errorf("%w: %s", ErrCompatDisabled, endpoint)
+	}
+
+	db := s.DB.WithContext(ctx)
+	if id, err := strconv.ParseUint(ident, 10, 32); err == nil {
+		if device, err := db.GetDevice(uint(id)); err == nil {
+			return device, nil
+		}
+	}
+	devices, err := db.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	mac := normalizeMAC(ident)
+	for i := range devices {
+		if normalizeMAC(devices[i].MAC) == mac {
+			return &devices[i], nil
+		}
+	}
+	for i := range devices {
+		if devices[i].Name != "" && strings.EqualFold(devices[i].Name, ident) {
+			return &devices[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, ident)
+}
+
+// compatStatus reads the live status of a device
+func (s *ShellyService) compatStatus(ctx context.Context, device *database.Device) (*shelly.DeviceStatus, error) {
+	if device.Status == "offline" {
+		return nil, ErrDeviceOffline
+	}
+	client, err := s.getClient(device)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	status, err := client.GetStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+	return status, nil
+}
+
+// CompatRelay answers a Gen1 /relay/{channel} request. turn is on, off,
+// toggle or empty to only read the relay; the command goes through the
+// device's own client, so Gen2 and later devices are switched over RPC.
+func (s *ShellyService) CompatRelay(ctx context.Context, ident string, channel int, turn string) (*CompatRelayStatus, error) {
+	device, err := s.compatDevice(ctx, config.CompatEndpointRelay, ident)
+	if err != nil {
+		return nil, err
+	}
+	switch turn {
+	case "":
+	case "on", "off", "toggle":
+		if err := s.ControlDeviceContext(ctx, device.ID, turn, map[string]interface{}{"channel": float64(channel)}); err != nil {
+			return nil, err
+		}
+		s.logger.WithContext(ctx).WithFields(map[string]any{
+			"device_id": device.ID,
+			"channel":   channel,
+			"turn":      turn,
+			"component": "compat",
+		}).Info("Gen1 relay request translated")
+	default:
+		return nil, fmt.Errorf("%w: bad turn %q", ErrCompatRequest, turn)
+	}
+
+	status, err := s.compatStatus(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+	for _, sw := range status.Switches {
+		if sw.ID == channel {
+			relay := compatRelay(sw)
+			return &relay, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: device %d has no relay %d", ErrCompatRequest, device.ID, channel)
+}
+
+// CompatStatus answers a Gen1 /status request from the device's live
+// status. Devices without meters report one per relay from its power
+// readings.
+func (s *ShellyService) CompatStatus(ctx context.Context, ident string) (*CompatStatus, error) {
+	device, err := s.compatDevice(ctx, config.CompatEndpointStatus, ident)
+	if err != nil {
+		return nil, err
+	}
+	status, err := s.compatStatus(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := &CompatStatus{
+		Time:            now.Format("15:04"),
+		Unixtime:        status.Unixtime,
+		HasUpdate:       status.HasUpdate,
+		MAC:             normalizeMAC(device.MAC),
+		Relays:          []CompatRelayStatus{},
+		Meters:          []CompatMeter{},
+		Temperature:     status.Temperature,
+		Overtemperature: status.Overtemperature,
+		RAMTotal:        status.RAMTotal,
+		RAMFree:         status.RAMFree,
+		FSSize:          status.FSSize,
+		FSFree:          status.FSFree,
+		Uptime:          status.Uptime,
+	}
+	if result.Unixtime == 0 {
+		result.Unixtime = now.Unix()
+	}
+	if w := status.WiFiStatus; w != nil {
+		result.WiFiStatus = CompatWiFiStatus{Connected: w.Connected, SSID: w.SSID, IP: w.IP, RSSI: w.RSSI}
+	}
+	for _, sw := range status.Switches {
+		result.Relays = append(result.Relays, compatRelay(sw))
+	}
+	if len(status.Meters) > 0 {
+		for _, m := range status.Meters {
+			result.Meters = append(result.Meters, CompatMeter{
+				Power: m.Power, IsValid: m.IsValid, Timestamp: result.Unixtime, Total: int64(m.Total * 60),
+			})
+		}
+	} else {
+		for _, sw := range status.Switches {
+			result.Meters = append(result.Meters, CompatMeter{
+				Power: sw.APower, IsValid: true, Timestamp: result.Unixtime, Total: int64(sw.Energy * 60),
+			})
+		}
+	}
+	return result, nil
+}
+
+// CompatShelly answers a Gen1 /shelly request from the stored device, without
+// contacting it
+func (s *ShellyService) CompatShelly(ctx context.Context, ident string) (*CompatShelly, error) {
+	device, err := s.compatDevice(ctx, config.CompatEndpointShelly, ident)
+	if err != nil {
+		return nil, err
+	}
+	return &CompatShelly{
+		Type:     device.Type,
+		MAC:      normalizeMAC(device.MAC),
+		FW:       device.Firmware,
+		Name:     device.Name,
+		DeviceID: device.ID,
+	}, nil
+}
+
+// compatRelay converts a switch status to its Gen1 relay form. Timers are
+// not tracked by the manager, so none is reported.
+func compatRelay(sw shelly.SwitchStatus) CompatRelayStatus {
+	relay := CompatRelayStatus{IsOn: sw.Output, Source: sw.Source}
+	if relay.Source == "" {
+		relay.Source = "http"
+	}
+	for _, e := range sw.Errors {
+		if e == "overpower" {
+			relay.Overpower = true
+		}
+	}
+	return relay
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_Compat(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+
+	var mu sync.Mutex
+	ison := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/shelly":
+			_, _ = w.Write([]byte(`{"type":"SHSW-1","mac":"AABBCCDDEE41"}`))
+		case "/relay/0":
+			_ = r.ParseForm()
+			ison = r.FormValue("turn") == "on"
+			_, _ = w.Write([]byte(`{"ison":` + map[bool]string{true: "true", false: "false"}[ison] + `}`))
+		case "/status":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"relays":[{"ison":` + map[bool]string{true: "true", false: "false"}[ison] + `,"source":"http"}],` +
+				`"meters":[{"power":12.5,"is_valid":true,"total":2}],"wifi_sta":{"connected":true,"ssid":"lan","ip":"10.0.0.5","rssi":-60},"uptime":300}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	device := &database.Device{IP: server.URL[len("http://"):], MAC: "AA:BB:CC:DD:EE:41", Type: "SHSW-1",
+		Name: "Porch", Firmware: "1.14.0", Status: "online", Settings: `{"model":"SHSW-1","gen":1}`}
+	if err := db.AddDevice(device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := service.CompatStatus(ctx, "Porch"); !errors.Is(err, ErrCompatDisabled) {
+		t.Fatalf("Expected the disabled layer to refuse, got %v", err)
+	}
+	cfg.Compat.Enabled = true
+
+	// Devices are addressed by ID, MAC in any notation or name
+	for _, ident := range []string{strconv.FormatUint(uint64(device.ID), 10), "aabbccddee41", "AA-BB-CC-DD-EE-41", "porch"} {
+		info, err := service.CompatShelly(ctx, ident)
+		if err != nil {
+			t.Fatalf("CompatShelly(%q) failed: %v", ident, err)
+		}
+		if info.DeviceID != device.ID || info.MAC != "AABBCCDDEE41" || info.FW != "1.14.0" {
+			t.Errorf("Unexpected /shelly answer for %q: %+v", ident, info)
+		}
+	}
+	if _, err := service.CompatShelly(ctx, "Garage"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected an unknown device refused, got %v", err)
+	}
+
+	relay, err := service.CompatRelay(ctx, "Porch", 0, "on")
+	if err != nil {
+		t.Fatalf("CompatRelay failed: %v", err)
+	}
+	if !relay.IsOn || relay.HasTimer || relay.Source != "http" {
+		t.Errorf("Expected the relay switched on, got %+v", relay)
+	}
+	if _, err := service.CompatRelay(ctx, "Porch", 0, "blink"); !errors.Is(err, ErrCompatRequest) {
+		t.Errorf("Expected a bad turn refused, got %v", err)
+	}
+	if _, err := service.CompatRelay(ctx, "Porch", 3, ""); !errors.Is(err, ErrCompatRequest) {
+		t.Errorf("Expected a missing relay refused, got %v", err)
+	}
+
+	status, err := service.CompatStatus(ctx, "Porch")
+	if err != nil {
+		t.Fatalf("CompatStatus failed: %v", err)
+	}
+	if len(status.Relays) != 1 || !status.Relays[0].IsOn || status.WiFiStatus.IP != "10.0.0.5" || status.Uptime != 300 {
+		t.Errorf("Unexpected /status answer: %+v", status)
+	}
+	if len(status.Meters) != 1 || status.Meters[0].Power != 12.5 || status.Meters[0].Total != 120 {
+		t.Errorf("Expected the meter with its total in watt-minutes, got %+v", status.Meters)
+	}
+
+	// Endpoints can be exposed selectively
+	cfg.Compat.Endpoints = []string{"status"}
+	if _, err := service.CompatRelay(ctx, "Porch", 0, "off"); !errors.Is(err, ErrCompatDisabled) {
+		t.Errorf("Expected the relay endpoint refused, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// ErrInvalidLintRequest wraps lint request validation errors
+var ErrInvalidLintRequest = errors.New("invalid lint request")
+
+// ConfigLintRequest selects the devices and findings of a fleet lint run
+type ConfigLintRequest struct {
+	DeviceIDs   []uint `json:"device_ids,omitempty"`   // empty selects every device
+	Tag         string `json:"tag,omitempty"`          // restrict to devices carrying this tag
+	MinSeverity string `json:"min_severity,omitempty"` // drop findings below critical, warning or info
+}
+
+// DeviceLintReport lists the best-practice findings for one device
+type DeviceLintReport struct {
+	DeviceID  uint                        `json:"device_id"`
+	Name      string                      `json:"name"`
+	Type      string                      `json:"type"`
+	HasConfig bool                        `json:"has_config"` // false when no configuration is stored yet
+	Findings  []configuration.LintFinding `json:"findings"`
+	Error     string                      `json:"error,omitempty"`
+	// InMaintenance reports keep their findings, but fleet totals skip them
+	InMaintenance bool `json:"in_maintenance,omitempty"`
+}
+
+// ConfigLintSummary is the fleet view of configuration lint findings
+type ConfigLintSummary struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Devices     int                `json:"devices"`
+	Affected    int                `json:"affected"` // devices with at least one finding
+	BySeverity  map[string]int     `json:"by_severity"`
+	ByRule      map[string]int     `json:"by_rule"`
+	Reports     []DeviceLintReport `json:"reports"`
+	// InMaintenance counts the devices in maintenance, which are left out of
+	// Affected and the totals
+	InMaintenance int `json:"in_maintenance"`
+}
+
+// LintDeviceConfig checks the stored configuration of one device against
+// best practices. The findings are advisory and separate from validation.
+func (s *ShellyService) LintDeviceConfig(deviceID uint) (*DeviceLintReport, error) {
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	var stored configuration.DeviceConfig
+	err = s.DB.GetDB().Where("device_id = ?", deviceID).First(&stored).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load device configuration: %w", err)
+	}
+	var config json.RawMessage
+	if err == nil {
+		config = stored.Config
+	}
+	report := lintDevice(*device, config)
+	report.InMaintenance = s.InMaintenance(deviceID)
+	return &report, nil
+}
+
+// LintFleetConfig lints the stored configuration of the selected devices and
+// totals the findings by severity and rule
+func (s *ShellyService) LintFleetConfig(req ConfigLintRequest) (*ConfigLintSummary, error) {
+	minRank := 0
+	if req.MinSeverity != "" {
+		if minRank = configuration.LintSeverityRank(req.MinSeverity); minRank == 0 {
+			return nil, fmt.Errorf("%w: unknown severity %q", ErrInvalidLintRequest, req.MinSeverity)
+		}
+	}
+
+	devices, err := s.SelectDevices(req.DeviceIDs, req.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []configuration.DeviceConfig
+	if err := s.DB.GetDB().Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load device configurations: %w", err)
+	}
+	stored := make(map[uint]json.RawMessage, len(configs))
+	for _, c := range configs {
+		stored[c.DeviceID] = c.Config
+	}
+
+	maintenance := s.maintenanceSet()
+	summary := &ConfigLintSummary{
+		GeneratedAt: time.Now(),
+		BySeverity:  map[string]int{},
+		ByRule:      map[string]int{},
+		Reports:     []DeviceLintReport{},
+	}
+	for _, d := range devices {
+		report := lintDevice(d, stored[d.ID])
+		report.InMaintenance = maintenance[d.ID]
+		kept := report.Findings[:0]
+		for _, f := range report.Findings {
+			if configuration.LintSeverityRank(f.Severity) >= minRank {
+				kept = append(kept, f)
+				if !report.InMaintenance {
+					summary.BySeverity[f.Severity]++
+					summary.ByRule[f.Rule]++
+				}
+			}
+		}
+		report.Findings = kept
+		summary.Devices++
+		switch {
+		case report.InMaintenance:
+			summary.InMaintenance++
+		case len(kept) > 0:
+			summary.Affected++
+		}
+		summary.Reports = append(summary.Reports, report)
+	}
+	return summary, nil
+}
+
+// lintDevice lints one device's stored configuration; devices without one
+// have nothing to lint. The inventory auth flag covers configurations without
+// an auth section, such as Gen2 configs.
+func lintDevice(device database.Device, config json.RawMessage) DeviceLintReport {
+	report := DeviceLintReport{
+		DeviceID:  device.ID,
+		Name:      device.Name,
+		Type:      device.Type,
+		HasConfig: len(config) > 0,
+		Findings:  []configuration.LintFinding{},
+	}
+	if !report.HasConfig {
+		return report
+	}
+	target := configuration.LintTarget{DeviceType: device.Type}
+	var settings map[string]interface{}
+	if json.Unmarshal([]byte(device.Settings), &settings) == nil {
+		target.Model, _ = settings["model"].(string)
+		if auth, ok := settings["auth_enabled"].(bool); ok {
+			target.AuthEnabled = &auth
+		}
+	}
+
+	findings, err := configuration.LintConfiguration(config, target)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.Findings = findings
+	return report
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_LintFleetConfig(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	devices := []struct {
+		typ, settings, config string
+	}{
+		{"SHPLG-S", `{"gen":1}`, `{"login": {"enabled": false}, "cloud": {"enabled": true}}`},
+		{"SHSW-1", `{"gen":1}`, `{"login": {"enabled": true}, "cloud": {"enabled": false}}`},
+		{"SNSW-001X16EU", `{"gen":2,"auth_enabled":false}`, `{"cloud": {"enable": false}}`},
+		{"SHSW-1", `{"gen":1}`, ""}, // no stored configuration
+	}
+	ids := make([]uint, len(devices))
+	for i, d := range devices {
+		device := &database.Device{IP: "192.168.1." + string(rune('1'+i)), MAC: "68C63A00000" + string(rune('1'+i)), Type: d.typ, Name: d.typ, Settings: d.settings}
+		if err := db.AddDevice(device); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		ids[i] = device.ID
+		if d.config == "" {
+			continue
+		}
+		if err := db.GetDB().Create(&configuration.DeviceConfig{DeviceID: device.ID, Config: json.RawMessage(d.config)}).Error; err != nil {
+			t.Fatalf("Failed to store device config: %v", err)
+		}
+	}
+
+	summary, err := service.LintFleetConfig(ConfigLintRequest{})
+	if err != nil {
+		t.Fatalf("LintFleetConfig failed: %v", err)
+	}
+	if summary.Devices != 4 || summary.Affected != 2 {
+		t.Errorf("Expected 4 devices with 2 affected, got %d and %d", summary.Devices, summary.Affected)
+	}
+	if summary.ByRule[configuration.LintAuthDisabled] != 2 {
+		t.Errorf("Expected 2 devices with auth disabled, got %d", summary.ByRule[configuration.LintAuthDisabled])
+	}
+	if summary.ByRule[configuration.LintMaxPowerUnset] != 1 || summary.ByRule[configuration.LintCloudEnabled] != 1 {
+		t.Errorf("Unexpected rule totals: %v", summary.ByRule)
+	}
+	if summary.Reports[3].HasConfig || len(summary.Reports[3].Findings) != 0 {
+		t.Errorf("Expected device without configuration to have no findings, got %+v", summary.Reports[3])
+	}
+
+	critical, err := service.LintFleetConfig(ConfigLintRequest{MinSeverity: configuration.LintCritical})
+	if err != nil {
+		t.Fatalf("LintFleetConfig failed: %v", err)
+	}
+	if critical.BySeverity[configuration.LintWarning] != 0 || critical.BySeverity[configuration.LintCritical] != 2 {
+		t.Errorf("Expected only critical findings, got %v", critical.BySeverity)
+	}
+
+	if _, err := service.LintFleetConfig(ConfigLintRequest{MinSeverity: "fatal"}); !errors.Is(err, ErrInvalidLintRequest) {
+		t.Errorf("Expected unknown severity to be rejected, got %v", err)
+	}
+	if _, err := service.LintFleetConfig(ConfigLintRequest{DeviceIDs: []uint{999}}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected unknown device to be rejected, got %v", err)
+	}
+
+	report, err := service.LintDeviceConfig(ids[0])
+	if err != nil {
+		t.Fatalf("LintDeviceConfig failed: %v", err)
+	}
+	if len(report.Findings) != 3 || report.Findings[0].Severity != configuration.LintCritical {
+		t.Errorf("Expected 3 findings led by a critical one, got %+v", report.Findings)
+	}
+}
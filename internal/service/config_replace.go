@@ -0,0 +1,245 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+)
+
+var (
+	// ErrInvalidConfigReplace wraps configuration replace validation errors
+	ErrInvalidConfigReplace = errors.New("invalid configuration replace")
+	// ErrReplacePlanNotFound is returned for an unknown, expired or already
+	// applied replace plan
+	ErrReplacePlanNotFound = errors.New("replace plan not found or expired")
+)
+
+// ConfigReplaceRequest replaces a value at a path in the stored
+// configuration of every selected device holding it
+type ConfigReplaceRequest struct {
+	Path      string          `json:"path"` // dotted path such as mqtt.server, * matches any key
+	From      json.RawMessage `json:"from"`
+	To        json.RawMessage `json:"to"`
+	DeviceIDs []uint          `json:"device_ids,omitempty"` // restrict to these devices
+	Tag       string          `json:"tag,omitempty"`        // restrict to devices carrying this tag
+}
+
+// ConfigReplaceChange is one value replaced in a device configuration
+type ConfigReplaceChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// ConfigReplaceDevice lists the changes planned for one device
+type ConfigReplaceDevice struct {
+	DeviceID uint                  `json:"device_id"`
+	Name     string                `json:"name"`
+	IP       string                `json:"ip"`
+	Changes  []ConfigReplaceChange `json:"changes"`
+
+	patch json.RawMessage
+}
+
+// ConfigReplacePlan is a reviewed set of replacements, applied once by its ID
+type ConfigReplacePlan struct {
+	PlanID    string                `json:"plan_id"`
+	Path      string                `json:"path"`
+	From      interface{}           `json:"from"`
+	To        interface{}           `json:"to"`
+	Searched  int                   `json:"searched"` // devices with a stored configuration
+	Total     int                   `json:"total"`    // devices with changes
+	Devices   []ConfigReplaceDevice `json:"devices"`
+	CreatedAt time.Time             `json:"created_at"`
+	ExpiresAt time.Time             `json:"expires_at"`
+}
+
+// ConfigReplaceResult is the outcome of staging a plan for one device
+type ConfigReplaceResult struct {
+	DeviceID uint   `json:"device_id"`
+	Name     string `json:"name"`
+	Status   string `json:"status"` // staged or failed
+	Error    string `json:"error,omitempty"`
+}
+
+// ConfigReplaceOutcome reports the devices staged by an applied plan
+type ConfigReplaceOutcome struct {
+	PlanID  string                `json:"plan_id"`
+	Staged  int                   `json:"staged"`
+	Failed  int                   `json:"failed"`
+	Results []ConfigReplaceResult `json:"results"`
+}
+
+// PlanConfigReplace finds the selected devices whose stored configuration
+// holds req.From at req.Path and plans replacing it with req.To. An unknown
+// device ID is reported with ErrDeviceNotFound. Nothing is changed until the
+// plan is applied with ApplyConfigReplace before it expires after
+// bulk_confirmation.ttl.
+func (s *ShellyService) PlanConfigReplace(req ConfigReplaceRequest) (*ConfigReplacePlan, error) {
+	if strings.TrimSpace(req.Path) == "" {
+		return nil, fmt.Errorf("%w: path is required", ErrInvalidConfigReplace)
+	}
+	if len(req.From) == 0 || len(req.To) == 0 {
+		return nil, fmt.Errorf("%w: from and to are required", ErrInvalidConfigReplace)
+	}
+	var from, to interface{}
+	if err := json.Unmarshal(req.From, &from); err != nil {
+		return nil, fmt.Errorf("%w: from is not valid JSON: %v", ErrInvalidConfigReplace, err)
+	}
+	if err := json.Unmarshal(req.To, &to); err != nil {
+		return nil, fmt.Errorf("%w: to is not valid JSON: %v", ErrInvalidConfigReplace, err)
+	}
+	if bytes.Equal(compactJSON(req.From), compactJSON(req.To)) {
+		return nil, fmt.Errorf("%w: from and to are equal", ErrInvalidConfigReplace)
+	}
+
+	devices, err := s.SelectDevices(req.DeviceIDs, req.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []configuration.DeviceConfig
+	if err := s.DB.GetDB().Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load device configurations: %w", err)
+	}
+	stored := make(map[uint]json.RawMessage, len(configs))
+	for _, c := range configs {
+		stored[c.DeviceID] = c.Config
+	}
+
+	now := time.Now()
+	plan := &ConfigReplacePlan{
+		Path:      req.Path,
+		From:      from,
+		To:        to,
+		Devices:   []ConfigReplaceDevice{},
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.bulkConfirmationConfig().TTLDuration()),
+	}
+	for _, d := range devices {
+		raw, ok := stored[d.ID]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		var config interface{}
+		if err := json.Unmarshal(raw, &config); err != nil {
+			continue
+		}
+		plan.Searched++
+
+		found := configuration.FindValues(config, req.Path, from)
+		if len(found) == 0 {
+			continue
+		}
+		device := ConfigReplaceDevice{DeviceID: d.ID, Name: d.Name, IP: d.IP}
+		ops := make([]map[string]interface{}, 0, 2*len(found))
+		for _, f := range found {
+			device.Changes = append(device.Changes, ConfigReplaceChange{Path: strings.Join(f.Path, "."), Old: f.Value, New: to})
+			// The test guards against the value changing after review
+			pointer := jsonPointer(f.Path)
+			ops = append(ops,
+				map[string]interface{}{"op": "test", "path": pointer, "value": f.Value},
+				map[string]interface{}{"op": "replace", "path": pointer, "value": to})
+		}
+		if device.patch, err = json.Marshal(ops); err != nil {
+			return nil, fmt.Errorf("failed to encode patch: %w", err)
+		}
+		plan.Devices = append(plan.Devices, device)
+	}
+	plan.Total = len(plan.Devices)
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate plan ID: %w", err)
+	}
+	plan.PlanID = hex.EncodeToString(id)
+
+	s.replaceMu.Lock()
+	if s.replacePlans == nil {
+		s.replacePlans = make(map[string]*ConfigReplacePlan)
+	}
+	for planID, p := range s.replacePlans {
+		if now.After(p.ExpiresAt) {
+			delete(s.replacePlans, planID)
+		}
+	}
+	s.replacePlans[plan.PlanID] = plan
+	s.replaceMu.Unlock()
+
+	s.logger.WithFields(map[string]any{
+		"plan_id":   plan.PlanID,
+		"path":      req.Path,
+		"devices":   plan.Total,
+		"component": "config_replace",
+	}).Info("Configuration replace planned")
+	return plan, nil
+}
+
+// ApplyConfigReplace stages the changes of a plan on each of its devices as
+// a pending configuration patch, to be exported or synced as usual. A plan
+// is applied once. Devices whose value changed since the plan fail and are
+// left as they are.
+func (s *ShellyService) ApplyConfigReplace(planID string) (*ConfigReplaceOutcome, error) {
+	s.replaceMu.Lock()
+	plan, ok := s.replacePlans[planID]
+	if ok {
+		delete(s.replacePlans, planID)
+	}
+	s.replaceMu.Unlock()
+	if !ok || time.Now().After(plan.ExpiresAt) {
+		return nil, ErrReplacePlanNotFound
+	}
+
+	outcome := &ConfigReplaceOutcome{PlanID: planID, Results: make([]ConfigReplaceResult, 0, len(plan.Devices))}
+	for _, d := range plan.Devices {
+		result := ConfigReplaceResult{DeviceID: d.DeviceID, Name: d.Name, Status: "staged"}
+		if _, _, err := s.PatchDeviceConfig(d.DeviceID, configuration.PatchTypeJSON, d.patch); err != nil {
+			result.Status = "failed"
+			if errors.Is(err, configuration.ErrPatchFailed) {
+				result.Error = "configuration changed since the plan"
+			} else {
+				result.Error = err.Error()
+			}
+			outcome.Failed++
+		} else {
+			outcome.Staged++
+		}
+		outcome.Results = append(outcome.Results, result)
+	}
+
+	s.logger.WithFields(map[string]any{
+		"plan_id":   planID,
+		"path":      plan.Path,
+		"staged":    outcome.Staged,
+		"failed":    outcome.Failed,
+		"component": "config_replace",
+	}).Info("Configuration replace applied")
+	return outcome, nil
+}
+
+// jsonPointer builds an RFC 6901 pointer from path segments
+func jsonPointer(path []string) string {
+	var b strings.Builder
+	for _, p := range path {
+		b.WriteByte('/')
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(p))
+	}
+	return b.String()
+}
+
+// compactJSON returns data without insignificant whitespace, or data itself
+// when it is not valid JSON
+func compactJSON(data json.RawMessage) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
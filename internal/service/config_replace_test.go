@@ -0,0 +1,78 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_ConfigReplace(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	configs := []string{
+		`{"mqtt": {"enable": true, "server": "10.0.0.5:1883"}}`,
+		`{"mqtt": {"enable": true, "server": "10.0.0.9:1883"}}`,
+		`{"mqtt": {"enable": true, "server": "10.0.0.5:1883"}}`,
+	}
+	ids := make([]uint, len(configs))
+	for i, config := range configs {
+		device := &database.Device{IP: "192.168.1." + string(rune('1'+i)), MAC: "68C63A00020" + string(rune('1'+i)), Type: "SHSW-1", Name: "Switch", Settings: `{"gen":1}`}
+		if err := db.AddDevice(device); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		ids[i] = device.ID
+		if err := db.GetDB().Create(&configuration.DeviceConfig{DeviceID: device.ID, Config: json.RawMessage(config)}).Error; err != nil {
+			t.Fatalf("Failed to store device config: %v", err)
+		}
+	}
+
+	if _, err := service.PlanConfigReplace(ConfigReplaceRequest{Path: "mqtt.server", From: json.RawMessage(`"a"`), To: json.RawMessage(` "a"`)}); !errors.Is(err, ErrInvalidConfigReplace) {
+		t.Errorf("Expected an identical replacement refused, got %v", err)
+	}
+
+	req := ConfigReplaceRequest{Path: "mqtt.server", From: json.RawMessage(`"10.0.0.5:1883"`), To: json.RawMessage(`"10.0.0.9:1883"`)}
+	plan, err := service.PlanConfigReplace(req)
+	if err != nil {
+		t.Fatalf("PlanConfigReplace failed: %v", err)
+	}
+	if plan.Searched != 3 || plan.Total != 2 || plan.Devices[0].DeviceID != ids[0] || plan.Devices[1].DeviceID != ids[2] {
+		t.Fatalf("Expected the first and last device planned, got %+v", plan)
+	}
+	if c := plan.Devices[0].Changes; len(c) != 1 || c[0].Path != "mqtt.server" || c[0].Old != "10.0.0.5:1883" || c[0].New != "10.0.0.9:1883" {
+		t.Errorf("Expected the planned change listed, got %+v", c)
+	}
+
+	// Planning changes nothing; a device edited after review is not staged
+	var stored configuration.DeviceConfig
+	if err := db.GetDB().Where("device_id = ?", ids[0]).First(&stored).Error; err != nil || string(stored.Config) != configs[0] {
+		t.Fatalf("Expected the plan not to change the configuration, got %s, %v", stored.Config, err)
+	}
+	if err := db.GetDB().Model(&configuration.DeviceConfig{}).Where("device_id = ?", ids[2]).
+		Update("config", json.RawMessage(`{"mqtt": {"enable": true, "server": "10.0.0.7:1883"}}`)).Error; err != nil {
+		t.Fatalf("Failed to edit device config: %v", err)
+	}
+
+	outcome, err := service.ApplyConfigReplace(plan.PlanID)
+	if err != nil {
+		t.Fatalf("ApplyConfigReplace failed: %v", err)
+	}
+	if outcome.Staged != 1 || outcome.Failed != 1 || outcome.Results[1].Error != "configuration changed since the plan" {
+		t.Errorf("Expected one device staged and the edited one failed, got %+v", outcome)
+	}
+	if err := db.GetDB().Where("device_id = ?", ids[0]).First(&stored).Error; err != nil {
+		t.Fatalf("Failed to load device config: %v", err)
+	}
+	var config map[string]map[string]interface{}
+	if err := json.Unmarshal(stored.Config, &config); err != nil || config["mqtt"]["server"] != "10.0.0.9:1883" || stored.SyncStatus != "pending" {
+		t.Errorf("Expected the new value staged for export, got %s (%s)", stored.Config, stored.SyncStatus)
+	}
+
+	if _, err := service.ApplyConfigReplace(plan.PlanID); !errors.Is(err, ErrReplacePlanNotFound) {
+		t.Errorf("Expected a plan to be applied once, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+)
+
+// ErrInvalidConfigSearch wraps configuration search validation errors
+var ErrInvalidConfigSearch = errors.New("invalid configuration search")
+
+// ConfigSearchRequest selects devices by values in their stored
+// configuration. All conditions must hold.
+type ConfigSearchRequest struct {
+	Where []string `json:"where"`         // conditions such as mqtt.server != "10.0.0.5"
+	Tag   string   `json:"tag,omitempty"` // restrict to devices carrying this tag
+}
+
+// ConfigSearchMatch is a device whose stored configuration satisfies every
+// condition, with the values found at each condition's path
+type ConfigSearchMatch struct {
+	DeviceID uint                     `json:"device_id"`
+	Name     string                   `json:"name"`
+	Type     string                   `json:"type"`
+	IP       string                   `json:"ip"`
+	Values   map[string][]interface{} `json:"values"`
+}
+
+// ConfigSearchResult lists the devices matching a configuration search
+type ConfigSearchResult struct {
+	GeneratedAt time.Time                       `json:"generated_at"`
+	Conditions  []configuration.SearchCondition `json:"conditions"`
+	Searched    int                             `json:"searched"` // devices with a stored configuration
+	Total       int                             `json:"total"`
+	Matches     []ConfigSearchMatch             `json:"matches"`
+}
+
+// SearchFleetConfig finds the devices whose stored configuration satisfies
+// every condition of the request, e.g. every device still using a
+// decommissioned MQTT broker. Devices without a stored configuration are
+// not searched.
+func (s *ShellyService) SearchFleetConfig(req ConfigSearchRequest) (*ConfigSearchResult, error) {
+	if len(req.Where) == 0 {
+		return nil, fmt.Errorf("%w: at least one condition is required", ErrInvalidConfigSearch)
+	}
+	result := &ConfigSearchResult{
+		GeneratedAt: time.Now(),
+		Conditions:  make([]configuration.SearchCondition, 0, len(req.Where)),
+		Matches:     []ConfigSearchMatch{},
+	}
+	for _, expr := range req.Where {
+		cond, err := configuration.ParseSearchCondition(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidConfigSearch, err)
+		}
+		result.Conditions = append(result.Conditions, cond)
+	}
+
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	var tags map[uint][]string
+	if req.Tag != "" {
+		tags = s.deviceTags()
+	}
+
+	var configs []configuration.DeviceConfig
+	if err := s.DB.GetDB().Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load device configurations: %w", err)
+	}
+	stored := make(map[uint]json.RawMessage, len(configs))
+	for _, c := range configs {
+		stored[c.DeviceID] = c.Config
+	}
+
+	for _, d := range devices {
+		if req.Tag != "" && !containsFold(tags[d.ID], req.Tag) {
+			continue
+		}
+		raw, ok := stored[d.ID]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		var config interface{}
+		if err := json.Unmarshal(raw, &config); err != nil {
+			continue
+		}
+		result.Searched++
+
+		match := ConfigSearchMatch{DeviceID: d.ID, Name: d.Name, Type: d.Type, IP: d.IP, Values: map[string][]interface{}{}}
+		matched := true
+		for _, cond := range result.Conditions {
+			ok, values := cond.Match(config)
+			if !ok {
+				matched = false
+				break
+			}
+			match.Values[cond.Path] = values
+		}
+		if matched {
+			result.Matches = append(result.Matches, match)
+		}
+	}
+	result.Total = len(result.Matches)
+	return result, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_SearchFleetConfig(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	configs := []string{
+		`{"mqtt": {"enable": true, "server": "10.0.0.5:1883"}}`,
+		`{"mqtt": {"enable": true, "server": "10.0.0.9:1883"}}`,
+		`{"mqtt": {"enable": false, "server": "10.0.0.5:1883"}}`,
+		"", // no stored configuration
+	}
+	ids := make([]uint, len(configs))
+	for i, config := range configs {
+		device := &database.Device{IP: "192.168.1." + string(rune('1'+i)), MAC: "68C63A00010" + string(rune('1'+i)), Type: "SHSW-1", Name: "Switch", Settings: `{"gen":1}`}
+		if err := db.AddDevice(device); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		ids[i] = device.ID
+		if config == "" {
+			continue
+		}
+		if err := db.GetDB().Create(&configuration.DeviceConfig{DeviceID: device.ID, Config: json.RawMessage(config)}).Error; err != nil {
+			t.Fatalf("Failed to store device config: %v", err)
+		}
+	}
+
+	result, err := service.SearchFleetConfig(ConfigSearchRequest{Where: []string{`mqtt.server ~ 10.0.0.5`, `mqtt.enable = true`}})
+	if err != nil {
+		t.Fatalf("SearchFleetConfig failed: %v", err)
+	}
+	if result.Searched != 3 || result.Total != 1 || result.Matches[0].DeviceID != ids[0] {
+		t.Fatalf("Expected only the first device to match, got %+v", result)
+	}
+	if v := result.Matches[0].Values["mqtt.server"]; len(v) != 1 || v[0] != "10.0.0.5:1883" {
+		t.Errorf("Expected the matched value to be reported, got %v", v)
+	}
+
+	result, err = service.SearchFleetConfig(ConfigSearchRequest{Where: []string{`mqtt.server != "10.0.0.9:1883"`}})
+	if err != nil {
+		t.Fatalf("SearchFleetConfig failed: %v", err)
+	}
+	if result.Total != 2 {
+		t.Errorf("Expected 2 devices not using the new broker, got %d", result.Total)
+	}
+
+	if err := db.GetDB().Create(&database.DeviceTag{DeviceID: ids[2], Tag: "garden"}).Error; err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+	result, err = service.SearchFleetConfig(ConfigSearchRequest{Where: []string{`mqtt.server != "10.0.0.9:1883"`}, Tag: "Garden"})
+	if err != nil {
+		t.Fatalf("SearchFleetConfig failed: %v", err)
+	}
+	if result.Total != 1 || result.Matches[0].DeviceID != ids[2] {
+		t.Errorf("Expected only the tagged device, got %+v", result.Matches)
+	}
+
+	for _, req := range []ConfigSearchRequest{{}, {Where: []string{"mqtt.server"}}} {
+		if _, err := service.SearchFleetConfig(req); !errors.Is(err, ErrInvalidConfigSearch) {
+			t.Errorf("Expected %+v to be refused, got %v", req, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+var (
+	// ErrConfirmationRequired is returned when a bulk operation must be
+	// confirmed with the token of the returned challenge before it runs
+	ErrConfirmationRequired = errors.New("confirmation required")
+	// ErrConfirmationInvalid is wrapped when the token sent is unknown,
+	// expired, already used or issued for a different operation
+	ErrConfirmationInvalid = errors.New("confirmation token is invalid, expired or issued for another request")
+)
+
+// BulkOperation describes a bulk operation for confirmation. The token of a
+// challenge is only accepted for the same operation, devices and params.
+type BulkOperation struct {
+	Operation string `json:"operation"` // e.g. "devices.control"
+	DeviceIDs []uint `json:"device_ids"`
+	Params    any    `json:"params,omitempty"`
+}
+
+// ConfirmationDevice names a device in a confirmation summary
+type ConfirmationDevice struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	IP   string `json:"ip,omitempty"`
+}
+
+// ConfirmationChallenge summarises the changes of a bulk operation and
+// carries the one-time token that confirms it
+type ConfirmationChallenge struct {
+	Token       string               `json:"confirmation_token"`
+	Operation   string               `json:"operation"`
+	Params      any                  `json:"params,omitempty"`
+	DeviceCount int                  `json:"device_count"`
+	Devices     []ConfirmationDevice `json:"devices"`
+	Threshold   int                  `json:"threshold"`
+	ExpiresAt   time.Time            `json:"expires_at"`
+}
+
+// pendingConfirmation is an issued token
+type pendingConfirmation struct {
+	fingerprint string
+	expiresAt   time.Time
+}
+
+// bulkConfirmationConfig returns the configured confirmation settings
+func (s *ShellyService) bulkConfirmationConfig() config.BulkConfirmationConfig {
+	if s.Config == nil {
+		return config.BulkConfirmationConfig{Threshold: config.DefaultBulkConfirmationThreshold}
+	}
+	return s.Config.BulkConfirmation
+}
+
+// ConfirmBulkOperation enforces the confirmation of bulk operations. It
+// returns nil when the operation may run: it affects no more devices than
+// bulk_confirmation.threshold, or token confirms exactly this operation (a
+// token is accepted once). Otherwise it returns a new challenge with
+// ErrConfirmationRequired, wrapping ErrConfirmationInvalid when a token was
+// sent but not accepted.
+func (s *ShellyService) ConfirmBulkOperation(op BulkOperation, token string) (*ConfirmationChallenge, error) {
+	cfg := s.bulkConfirmationConfig()
+	if cfg.Threshold <= 0 || len(op.DeviceIDs) <= cfg.Threshold {
+		return nil, nil
+	}
+	fingerprint, err := operationFingerprint(op)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s.confirmMu.Lock()
+	if s.confirmations == nil {
+		s.confirmations = make(map[string]pendingConfirmation)
+	}
+	for t, p := range s.confirmations {
+		if now.After(p.expiresAt) {
+			delete(s.confirmations, t)
+		}
+	}
+	if token != "" {
+		pending, ok := s.confirmations[token]
+		if ok && pending.fingerprint == fingerprint {
+			delete(s.confirmations, token)
+			s.confirmMu.Unlock()
+			s.logger.WithFields(map[string]any{
+				"operation": op.Operation,
+				"devices":   len(op.DeviceIDs),
+				"component": "confirmation",
+			}).Info("Bulk operation confirmed")
+			return nil, nil
+		}
+	}
+	s.confirmMu.Unlock()
+
+	challenge, err := s.issueConfirmation(op, fingerprint, cfg, now)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		return challenge, fmt.Errorf("%w: %w", ErrConfirmationRequired, ErrConfirmationInvalid)
+	}
+	return challenge, fmt.Errorf("%w: %s affects %d devices", ErrConfirmationRequired, op.Operation, len(op.DeviceIDs))
+}
+
+// issueConfirmation stores a new token and builds its challenge
+func (s *ShellyService) issueConfirmation(op BulkOperation, fingerprint string, cfg config.BulkConfirmationConfig, now time.Time) (*ConfirmationChallenge, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate confirmation token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+	expiresAt := now.Add(cfg.TTLDuration())
+
+	s.confirmMu.Lock()
+	s.confirmations[token] = pendingConfirmation{fingerprint: fingerprint, expiresAt: expiresAt}
+	s.confirmMu.Unlock()
+
+	devices, err := s.confirmationDevices(op.DeviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	return &ConfirmationChallenge{
+		Token:       token,
+		Operation:   op.Operation,
+		Params:      op.Params,
+		DeviceCount: len(op.DeviceIDs),
+		Devices:     devices,
+		Threshold:   cfg.Threshold,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// confirmationDevices names the devices of an operation in ID order
+func (s *ShellyService) confirmationDevices(ids []uint) ([]ConfirmationDevice, error) {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	byID := make(map[uint]*database.Device, len(devices))
+	for i := range devices {
+		byID[devices[i].ID] = &devices[i]
+	}
+	named := make([]ConfirmationDevice, 0, len(ids))
+	for _, id := range sortedIDs(ids) {
+		entry := ConfirmationDevice{ID: id}
+		if d, ok := byID[id]; ok {
+			entry.Name, entry.IP = d.Name, d.IP
+		}
+		named = append(named, entry)
+	}
+	return named, nil
+}
+
+// operationFingerprint identifies an operation independent of device order
+func operationFingerprint(op BulkOperation) (string, error) {
+	op.DeviceIDs = sortedIDs(op.DeviceIDs)
+	data, err := json.Marshal(op)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode operation: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// sortedIDs returns a sorted copy of ids
+func sortedIDs(ids []uint) []uint {
+	sorted := append([]uint(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// SelectDevices returns the devices with the given IDs, or all devices when
+// none are given, restricted to those carrying tag when set, in ID order. An
+// unknown ID is reported with ErrDeviceNotFound.
+func (s *ShellyService) SelectDevices(deviceIDs []uint, tag string) ([]database.Device, error) {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+
+	selected := make(map[uint]bool, len(deviceIDs))
+	for _, id := range deviceIDs {
+		selected[id] = true
+	}
+	found := make(map[uint]bool, len(devices))
+	for _, d := range devices {
+		found[d.ID] = true
+	}
+	for id := range selected {
+		if !found[id] {
+			return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, id)
+		}
+	}
+	var tags map[uint][]string
+	if tag != "" {
+		tags = s.deviceTags()
+	}
+
+	targets := []database.Device{}
+	for _, d := range devices {
+		if len(selected) > 0 && !selected[d.ID] {
+			continue
+		}
+		if tag != "" && !containsFold(tags[d.ID], tag) {
+			continue
+		}
+		targets = append(targets, d)
+	}
+	return targets, nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_ConfirmBulkOperation(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	cfg.BulkConfirmation.Threshold = 2
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	var ids []uint
+	for i, mac := range []string{"AABBCCDDEE01", "AABBCCDDEE02", "AABBCCDDEE03"} {
+		d := &database.Device{IP: fmt.Sprintf("192.0.2.%d", i+1), MAC: mac, Name: "dev-" + mac[10:]}
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+		ids = append(ids, d.ID)
+	}
+	reboot := BulkOperation{Operation: "devices.control", DeviceIDs: ids, Params: map[string]any{"action": "reboot"}}
+
+	if challenge, err := service.ConfirmBulkOperation(BulkOperation{Operation: "devices.control", DeviceIDs: ids[:2]}, ""); err != nil || challenge != nil {
+		t.Fatalf("Expected two devices to pass without confirmation, got %+v, %v", challenge, err)
+	}
+
+	challenge, err := service.ConfirmBulkOperation(reboot, "")
+	if !errors.Is(err, ErrConfirmationRequired) || challenge == nil || challenge.Token == "" {
+		t.Fatalf("Expected a confirmation challenge, got %+v, %v", challenge, err)
+	}
+	if challenge.DeviceCount != 3 || challenge.Devices[2].Name != "dev-03" {
+		t.Errorf("Expected the three devices summarised, got %+v", challenge)
+	}
+
+	// The token only confirms the same operation, in any device order
+	other := reboot
+	other.Params = map[string]any{"action": "off"}
+	if _, err := service.ConfirmBulkOperation(other, challenge.Token); !errors.Is(err, ErrConfirmationInvalid) {
+		t.Errorf("Expected the token rejected for another action, got %v", err)
+	}
+	reversed := reboot
+	reversed.DeviceIDs = []uint{ids[2], ids[1], ids[0]}
+	if _, err := service.ConfirmBulkOperation(reversed, challenge.Token); err != nil {
+		t.Fatalf("Expected the token accepted, got %v", err)
+	}
+	if _, err := service.ConfirmBulkOperation(reboot, challenge.Token); !errors.Is(err, ErrConfirmationInvalid) {
+		t.Errorf("Expected a used token rejected, got %v", err)
+	}
+
+	cfg.BulkConfirmation.Threshold = 0
+	if _, err := service.ConfirmBulkOperation(reboot, ""); err != nil {
+		t.Errorf("Expected no confirmation with the threshold disabled, got %v", err)
+	}
+}
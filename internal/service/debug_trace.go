@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// Debug trace errors, mapped to HTTP status codes by the API
+var (
+	ErrInvalidTraceRequest = errors.New("invalid debug trace request")
+	ErrTraceNotEnabled     = errors.New("debug trace is not enabled for this device")
+)
+
+// DebugTraceRequest enables recording of a device's HTTP/RPC exchanges
+type DebugTraceRequest struct {
+	MaxEntries   int `json:"max_entries,omitempty"`    // default 100, at most 1000
+	MaxBodyBytes int `json:"max_body_bytes,omitempty"` // per body; default 16 KiB, at most 1 MiB
+}
+
+// DebugTrace is the recording state and captured exchanges of one device
+type DebugTrace struct {
+	DeviceID     uint                `json:"device_id"`
+	StartedAt    time.Time           `json:"started_at"`
+	MaxEntries   int                 `json:"max_entries"`
+	MaxBodyBytes int                 `json:"max_body_bytes"`
+	Entries      []shelly.TraceEntry `json:"entries"`
+}
+
+// deviceTrace is an active recording
+type deviceTrace struct {
+	recorder *shelly.Recorder
+	trace    DebugTrace
+}
+
+// StartDebugTrace records every HTTP exchange with the device until
+// StopDebugTrace. Restarting a trace discards what was recorded so far.
+func (s *ShellyService) StartDebugTrace(deviceID uint, req DebugTraceRequest) (*DebugTrace, error) {
+	if req.MaxEntries < 0 || req.MaxEntries > shelly.MaxTraceEntries {
+		return nil, fmt.Errorf("%w: max_entries must be between 1 and %d", ErrInvalidTraceRequest, shelly.MaxTraceEntries)
+	}
+	if req.MaxBodyBytes < 0 || req.MaxBodyBytes > shelly.MaxTraceBodyBytes {
+		return nil, fmt.Errorf("%w: max_body_bytes must be between 1 and %d", ErrInvalidTraceRequest, shelly.MaxTraceBodyBytes)
+	}
+	if req.MaxEntries == 0 {
+		req.MaxEntries = shelly.DefaultTraceEntries
+	}
+	if req.MaxBodyBytes == 0 {
+		req.MaxBodyBytes = shelly.DefaultTraceBodyBytes
+	}
+
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+
+	active := &deviceTrace{
+		recorder: shelly.NewRecorder(req.MaxEntries, req.MaxBodyBytes),
+		trace: DebugTrace{
+			DeviceID:     deviceID,
+			StartedAt:    time.Now(),
+			MaxEntries:   req.MaxEntries,
+			MaxBodyBytes: req.MaxBodyBytes,
+		},
+	}
+	s.traceMu.Lock()
+	if s.traces == nil {
+		s.traces = make(map[uint]*deviceTrace)
+	}
+	s.traces[deviceID] = active
+	s.traceMu.Unlock()
+
+	// The next client for the device is built with the recorder
+	s.ClearClientCache(device.IP)
+
+	s.logger.WithFields(map[string]any{
+		"device_id":   deviceID,
+		"max_entries": req.MaxEntries,
+		"component":   "service",
+	}).Info("Started device debug trace")
+
+	trace := active.trace
+	trace.Entries = []shelly.TraceEntry{}
+	return &trace, nil
+}
+
+// GetDebugTrace returns the exchanges recorded for the device, oldest first
+func (s *ShellyService) GetDebugTrace(deviceID uint) (*DebugTrace, error) {
+	active := s.traceRecorder(deviceID)
+	if active == nil {
+		if _, err := s.DB.GetDevice(deviceID); err != nil {
+			return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+		}
+		return nil, ErrTraceNotEnabled
+	}
+	trace := active.trace
+	trace.Entries = active.recorder.Entries()
+	return &trace, nil
+}
+
+// StopDebugTrace stops recording for the device and discards the trace
+func (s *ShellyService) StopDebugTrace(deviceID uint) error {
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+
+	s.traceMu.Lock()
+	_, active := s.traces[deviceID]
+	delete(s.traces, deviceID)
+	s.traceMu.Unlock()
+	if !active {
+		return ErrTraceNotEnabled
+	}
+
+	s.ClearClientCache(device.IP)
+
+	s.logger.WithFields(map[string]any{
+		"device_id": deviceID,
+		"component": "service",
+	}).Info("Stopped device debug trace")
+	return nil
+}
+
+// traceRecorder returns the active trace of a device, or nil
+func (s *ShellyService) traceRecorder(deviceID uint) *deviceTrace {
+	s.traceMu.Lock()
+	defer s.traceMu.Unlock()
+	return s.traces[deviceID]
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestShellyService_DebugTrace(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	server := createMockShellyServer()
+	defer server.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+	device := createTestDevice(t, db, server.URL[len("http://"):])
+
+	if _, err := service.GetDebugTrace(device.ID); !errors.Is(err, ErrTraceNotEnabled) {
+		t.Fatalf("Expected no trace before it is started, got %v", err)
+	}
+	if _, err := service.StartDebugTrace(device.ID, DebugTraceRequest{MaxEntries: 5000}); !errors.Is(err, ErrInvalidTraceRequest) {
+		t.Errorf("Expected oversized trace to be rejected, got %v", err)
+	}
+	if _, err := service.StartDebugTrace(999, DebugTraceRequest{}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected unknown device to be rejected, got %v", err)
+	}
+
+	if _, err := service.GetDeviceStatus(device.ID); err != nil {
+		t.Fatalf("GetDeviceStatus failed: %v", err)
+	}
+	trace, err := service.StartDebugTrace(device.ID, DebugTraceRequest{MaxEntries: 2})
+	if err != nil {
+		t.Fatalf("StartDebugTrace failed: %v", err)
+	}
+	if trace.MaxBodyBytes != 16*1024 || len(trace.Entries) != 0 {
+		t.Errorf("Unexpected new trace: %+v", trace)
+	}
+
+	// The cached client is replaced by one that records
+	for i := 0; i < 3; i++ {
+		if _, err := service.GetDeviceStatus(device.ID); err != nil {
+			t.Fatalf("GetDeviceStatus failed: %v", err)
+		}
+	}
+	trace, err = service.GetDebugTrace(device.ID)
+	if err != nil {
+		t.Fatalf("GetDebugTrace failed: %v", err)
+	}
+	if len(trace.Entries) != 2 {
+		t.Fatalf("Expected the ring buffer to keep 2 entries, got %d", len(trace.Entries))
+	}
+	last := trace.Entries[1]
+	if last.Method != "GET" || !strings.HasSuffix(last.URL, "/status") || last.StatusCode != 200 || last.ResponseBody == "" {
+		t.Errorf("Unexpected trace entry: %+v", last)
+	}
+
+	if err := service.StopDebugTrace(device.ID); err != nil {
+		t.Fatalf("StopDebugTrace failed: %v", err)
+	}
+	if err := service.StopDebugTrace(device.ID); !errors.Is(err, ErrTraceNotEnabled) {
+		t.Errorf("Expected stopped trace to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// Sources of device dependencies
+const (
+	DependencySourceManual   = "manual"
+	DependencySourceExtender = "extender" // derived from the range extender topology
+)
+
+var (
+	// ErrDependencyNotFound is returned for unknown device dependencies
+	ErrDependencyNotFound = errors.New("device dependency not found")
+	// ErrInvalidDependency wraps device dependency validation failures
+	ErrInvalidDependency = errors.New("invalid device dependency")
+)
+
+// DependencySyncResult reports a refresh of the extender-derived dependencies
+type DependencySyncResult struct {
+	Added   []database.DeviceDependency `json:"added"`
+	Removed []database.DeviceDependency `json:"removed"`
+	Kept    int                         `json:"kept"`
+	Skipped []string                    `json:"skipped,omitempty"` // links that would form a cycle
+	// Unreachable lists devices whose extender state could not be read;
+	// their derived dependencies are kept
+	Unreachable []uint `json:"unreachable,omitempty"`
+}
+
+// ListDeviceDependencies returns every device dependency by device and upstream
+func (s *ShellyService) ListDeviceDependencies() ([]database.DeviceDependency, error) {
+	var deps []database.DeviceDependency
+	if err := s.DB.GetDB().Order("device_id, upstream_id").Find(&deps).Error; err != nil {
+		return nil, fmt.Errorf("failed to load device dependencies: %w", err)
+	}
+	return deps, nil
+}
+
+// AddDeviceDependency records that deviceID depends on upstreamID. A
+// dependency that would make a device its own upstream, directly or through
+// others, is refused.
+func (s *ShellyService) AddDeviceDependency(deviceID, upstreamID uint, note string) (*database.DeviceDependency, error) {
+	if deviceID == 0 || upstreamID == 0 {
+		return nil, fmt.Errorf("%w: device_id and upstream_id are required", ErrInvalidDependency)
+	}
+	if deviceID == upstreamID {
+		return nil, fmt.Errorf("%w: a device cannot depend on itself", ErrInvalidDependency)
+	}
+	for _, id := range []uint{deviceID, upstreamID} {
+		if _, err := s.DB.GetDevice(id); err != nil {
+			return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, id)
+		}
+	}
+	deps, err := s.ListDeviceDependencies()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deps {
+		if d.DeviceID == deviceID && d.UpstreamID == upstreamID {
+			return nil, fmt.Errorf("%w: device %d already depends on %d", ErrInvalidDependency, deviceID, upstreamID)
+		}
+	}
+	if createsCycle(deps, deviceID, upstreamID) {
+		return nil, fmt.Errorf("%w: device %d is upstream of %d", ErrInvalidDependency, deviceID, upstreamID)
+	}
+
+	dep := &database.DeviceDependency{DeviceID: deviceID, UpstreamID: upstreamID, Source: DependencySourceManual, Note: strings.TrimSpace(note)}
+	if err := s.DB.GetDB().Create(dep).Error; err != nil {
+		return nil, fmt.Errorf("failed to save device dependency: %w", err)
+	}
+	return dep, nil
+}
+
+// RemoveDeviceDependency deletes a device dependency
+func (s *ShellyService) RemoveDeviceDependency(id uint) error {
+	res := s.DB.GetDB().Delete(&database.DeviceDependency{}, id)
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete device dependency: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrDependencyNotFound
+	}
+	return nil
+}
+
+// SyncExtenderDependencies reads the range extender topology and makes the
+// extender-derived dependencies match it: every inventory device bridged
+// through an extender depends on that extender. Manual dependencies are
+// left alone, as are derived ones of extenders that could not be read.
+func (s *ShellyService) SyncExtenderDependencies(ctx context.Context) (*DependencySyncResult, error) {
+	topology, err := s.RangeExtenderTopology(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := s.ListDeviceDependencies()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DependencySyncResult{Added: []database.DeviceDependency{}, Removed: []database.DeviceDependency{}}
+	unreachable := map[uint]bool{}
+	for _, e := range topology.Errors {
+		unreachable[e.DeviceID] = true
+		result.Unreachable = append(result.Unreachable, e.DeviceID)
+	}
+	type edge struct{ device, upstream uint }
+	linked := map[edge]bool{}
+	for _, link := range topology.Links {
+		linked[edge{link.DeviceID, link.ExtenderID}] = true
+	}
+
+	kept := []database.DeviceDependency{}
+	existing := map[edge]bool{}
+	for _, d := range deps {
+		existing[edge{d.DeviceID, d.UpstreamID}] = true
+		if d.Source == DependencySourceExtender && !linked[edge{d.DeviceID, d.UpstreamID}] && !unreachable[d.UpstreamID] {
+			if err := s.DB.GetDB().Delete(&database.DeviceDependency{}, d.ID).Error; err != nil {
+				return nil, fmt.Errorf("failed to delete device dependency: %w", err)
+			}
+			result.Removed = append(result.Removed, d)
+			continue
+		}
+		kept = append(kept, d)
+	}
+	for _, link := range topology.Links {
+		if existing[edge{link.DeviceID, link.ExtenderID}] {
+			result.Kept++
+			continue
+		}
+		if createsCycle(kept, link.DeviceID, link.ExtenderID) {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s (%d) through %s (%d)", link.DeviceName, link.DeviceID, link.ExtenderName, link.ExtenderID))
+			continue
+		}
+		dep := database.DeviceDependency{DeviceID: link.DeviceID, UpstreamID: link.ExtenderID, Source: DependencySourceExtender}
+		if err := s.DB.GetDB().Create(&dep).Error; err != nil {
+			return nil, fmt.Errorf("failed to save device dependency: %w", err)
+		}
+		kept = append(kept, dep)
+		result.Added = append(result.Added, dep)
+	}
+
+	s.logger.WithFields(map[string]any{
+		"added":     len(result.Added),
+		"removed":   len(result.Removed),
+		"kept":      result.Kept,
+		"component": "service",
+	}).Info("Extender dependencies synchronized")
+	return result, nil
+}
+
+// DependencyWaves orders devices for a fleet operation: each wave may run
+// at once, and a device comes in a later wave than every device depending
+// on it, directly or through devices that are not selected. Devices keep
+// their given order within a wave.
+func (s *ShellyService) DependencyWaves(deviceIDs []uint) ([][]uint, error) {
+	deps, err := s.ListDeviceDependencies()
+	if err != nil {
+		return nil, err
+	}
+	return dependencyWaves(deviceIDs, deps), nil
+}
+
+// orderByDependency sorts devices so that upstream devices come after the
+// devices depending on them, stable otherwise
+func (s *ShellyService) orderByDependency(devices []database.Device) ([][]database.Device, error) {
+	ids := make([]uint, len(devices))
+	byID := make(map[uint]database.Device, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+		byID[d.ID] = d
+	}
+	waves, err := s.DependencyWaves(ids)
+	if err != nil {
+		return nil, err
+	}
+	ordered := make([][]database.Device, len(waves))
+	for i, wave := range waves {
+		for _, id := range wave {
+			ordered[i] = append(ordered[i], byID[id])
+		}
+	}
+	return ordered, nil
+}
+
+// dependencyWaves groups ids by their depth below the furthest dependent:
+// devices nothing depends on come first
+func dependencyWaves(ids []uint, deps []database.DeviceDependency) [][]uint {
+	dependents := map[uint][]uint{}
+	for _, d := range deps {
+		dependents[d.UpstreamID] = append(dependents[d.UpstreamID], d.DeviceID)
+	}
+	height := map[uint]int{}
+	visiting := map[uint]bool{}
+	var heightOf func(id uint) int
+	heightOf = func(id uint) int {
+		if h, ok := height[id]; ok {
+			return h
+		}
+		if visiting[id] { // cycles are refused when recorded; never loop on one
+			return 0
+		}
+		visiting[id] = true
+		h := 0
+		for _, child := range dependents[id] {
+			if ch := heightOf(child) + 1; ch > h {
+				h = ch
+			}
+		}
+		visiting[id] = false
+		height[id] = h
+		return h
+	}
+
+	byHeight := map[int][]uint{}
+	seen := map[uint]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		h := heightOf(id)
+		byHeight[h] = append(byHeight[h], id)
+	}
+	heights := make([]int, 0, len(byHeight))
+	for h := range byHeight {
+		heights = append(heights, h)
+	}
+	sort.Ints(heights)
+	waves := make([][]uint, 0, len(heights))
+	for _, h := range heights {
+		waves = append(waves, byHeight[h])
+	}
+	return waves
+}
+
+// createsCycle reports whether making deviceID depend on upstreamID would
+// make deviceID its own upstream
+func createsCycle(deps []database.DeviceDependency, deviceID, upstreamID uint) bool {
+	upstreams := map[uint][]uint{}
+	for _, d := range deps {
+		upstreams[d.DeviceID] = append(upstreams[d.DeviceID], d.UpstreamID)
+	}
+	seen := map[uint]bool{}
+	queue := []uint{upstreamID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == deviceID {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		queue = append(queue, upstreams[id]...)
+	}
+	return false
+}
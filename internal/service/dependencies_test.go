@@ -0,0 +1,79 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_DeviceDependencies(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	// router <- extender <- plug; lamp stands alone
+	ids := map[string]uint{}
+	for i, name := range []string{"router", "extender", "plug", "lamp"} {
+		d := &database.Device{IP: fmt.Sprintf("10.0.0.%d", i+10), MAC: fmt.Sprintf("AA:BB:CC:DD:EE:%02X", i+0x60), Type: "SHSW-1", Name: name, Status: "online"}
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+		ids[name] = d.ID
+	}
+	if _, err := service.AddDeviceDependency(ids["extender"], ids["router"], "powered by the router relay"); err != nil {
+		t.Fatalf("AddDeviceDependency failed: %v", err)
+	}
+	dep, err := service.AddDeviceDependency(ids["plug"], ids["extender"], "")
+	if err != nil {
+		t.Fatalf("AddDeviceDependency failed: %v", err)
+	}
+	if dep.Source != DependencySourceManual {
+		t.Errorf("Expected a manual dependency, got %+v", dep)
+	}
+
+	for _, bad := range [][2]uint{
+		{ids["router"], ids["plug"]},   // would close the chain into a cycle
+		{ids["lamp"], ids["lamp"]},     // self
+		{ids["plug"], ids["extender"]}, // duplicate
+		{ids["lamp"], 0},               // missing upstream
+	} {
+		if _, err := service.AddDeviceDependency(bad[0], bad[1], ""); !errors.Is(err, ErrInvalidDependency) {
+			t.Errorf("Expected %v to be refused, got %v", bad, err)
+		}
+	}
+	if _, err := service.AddDeviceDependency(ids["lamp"], 999, ""); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected an unknown upstream refused, got %v", err)
+	}
+
+	// Upstream devices come last, also when the device between them is not selected
+	waves, err := service.DependencyWaves([]uint{ids["router"], ids["plug"], ids["lamp"]})
+	if err != nil {
+		t.Fatalf("DependencyWaves failed: %v", err)
+	}
+	if want := [][]uint{{ids["plug"], ids["lamp"]}, {ids["router"]}}; !reflect.DeepEqual(waves, want) {
+		t.Errorf("Expected waves %v, got %v", want, waves)
+	}
+
+	// Wi-Fi rotations reach dependents before the devices they go through
+	rotation, err := service.StageWiFiRotation(WiFiRotationRequest{SSID: "new-lan", Password: "new-secret"})
+	if err != nil {
+		t.Fatalf("StageWiFiRotation failed: %v", err)
+	}
+	order := []string{}
+	for _, d := range rotation.Devices {
+		order = append(order, d.Name)
+	}
+	if want := []string{"plug", "lamp", "extender", "router"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected rotation order %v, got %v", want, order)
+	}
+
+	if err := service.RemoveDeviceDependency(dep.ID); err != nil {
+		t.Fatalf("RemoveDeviceDependency failed: %v", err)
+	}
+	if err := service.RemoveDeviceDependency(dep.ID); !errors.Is(err, ErrDependencyNotFound) {
+		t.Errorf("Expected a removed dependency to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,385 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+var (
+	// ErrDeviceLogsDisabled is returned while device_logs is not enabled
+	ErrDeviceLogsDisabled = errors.New("device log collection is not enabled")
+	// ErrDeviceLogsUnsupported is returned for devices that cannot stream
+	// their debug log
+	ErrDeviceLogsUnsupported = errors.New("debug log streaming requires a Gen2 or later device")
+	// ErrInvalidDeviceLogQuery wraps log filter validation errors
+	ErrInvalidDeviceLogQuery = errors.New("invalid device log query")
+)
+
+const (
+	// maxDeviceLogPacket is the largest log datagram read
+	maxDeviceLogPacket = 4096
+	// deviceLogSourceRefresh limits how often an unknown source address
+	// reloads the device addresses
+	deviceLogSourceRefresh = 30 * time.Second
+	// deviceLogPruneInterval is how often old log lines are removed
+	deviceLogPruneInterval = time.Hour
+	// defaultDeviceLogLimit and maxDeviceLogLimit bound the lines returned
+	defaultDeviceLogLimit = 200
+	maxDeviceLogLimit     = 5000
+)
+
+// deviceLogLevels are the Gen2 debug log levels by number, most severe first
+var deviceLogLevels = []string{"error", "warn", "info", "debug", "verbose"}
+
+// DeviceLogQuery filters the log lines of a device
+type DeviceLogQuery struct {
+	Since  *time.Time
+	Until  *time.Time
+	Level  string // lines at this level or more severe
+	Search string // case-insensitive substring of the message
+	Limit  int    // most recent lines returned, default 200
+}
+
+// DeviceLogStatus describes the log streaming of a device
+type DeviceLogStatus struct {
+	DeviceID  uint       `json:"device_id"`
+	Streaming bool       `json:"streaming"`
+	Address   string     `json:"address,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Stored    int64      `json:"stored"` // log lines kept for the device
+}
+
+// deviceLogsConfig returns the configured log collection settings
+func (s *ShellyService) deviceLogsConfig() config.DeviceLogsConfig {
+	if s.Config == nil {
+		return config.DeviceLogsConfig{}
+	}
+	return s.Config.DeviceLogs
+}
+
+// StartDeviceLogCollector listens for device debug logs on
+// device_logs.listen and prunes old lines; it does nothing unless
+// device_logs.enabled is set
+func (s *ShellyService) StartDeviceLogCollector() error {
+	cfg := s.deviceLogsConfig()
+	if !cfg.Enabled {
+		return nil
+	}
+	listen := cfg.Listen
+	if listen == "" {
+		listen = config.DefaultDeviceLogsListen
+	}
+	conn, err := net.ListenPacket("udp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen for device logs on %s: %w", listen, err)
+	}
+	go func() {
+		<-s.ctx.Done()
+		_ = conn.Close()
+	}()
+	go s.collectDeviceLogs(conn)
+
+	go func() {
+		ticker := s.clock.NewTicker(deviceLogPruneInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C():
+			}
+			if s.leader != nil && !s.leader() {
+				continue
+			}
+			if _, err := s.PruneDeviceLogs(s.clock.Now()); err != nil {
+				s.logger.WithFields(map[string]any{
+					"error":     err.Error(),
+					"component": "device_logs",
+				}).Warn("Failed to prune device logs")
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]any{
+		"listen":    conn.LocalAddr().String(),
+		"retention": cfg.RetentionDuration().String(),
+		"component": "device_logs",
+	}).Info("Started device log collector")
+	return nil
+}
+
+// collectDeviceLogs stores the datagrams read from conn until it is closed
+func (s *ShellyService) collectDeviceLogs(conn net.PacketConn) {
+	buf := make([]byte, maxDeviceLogPacket)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				s.logger.WithFields(map[string]any{
+					"error":     err.Error(),
+					"component": "device_logs",
+				}).Warn("Device log collector stopped")
+			}
+			return
+		}
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			continue
+		}
+		if err := s.storeDeviceLogPacket(host, buf[:n], s.clock.Now()); err != nil {
+			s.logger.WithFields(map[string]any{
+				"source":    host,
+				"error":     err.Error(),
+				"component": "device_logs",
+			}).Debug("Dropped device log packet")
+		}
+	}
+}
+
+// storeDeviceLogPacket stores the log lines of a datagram sent from ip
+func (s *ShellyService) storeDeviceLogPacket(ip string, packet []byte, now time.Time) error {
+	deviceID, ok := s.deviceLogSource(ip)
+	if !ok {
+		return fmt.Errorf("no device has address %s", ip)
+	}
+	var entries []database.DeviceLog
+	for _, line := range strings.Split(string(packet), "\n") {
+		if entry, ok := parseDeviceLogLine(line); ok {
+			entry.DeviceID = deviceID
+			entry.ReceivedAt = now
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := s.DB.GetDB().Create(&entries).Error; err != nil {
+		return fmt.Errorf("failed to store device log: %w", err)
+	}
+	return nil
+}
+
+// deviceLogSource returns the device using an address. Unknown addresses
+// reload the device addresses at most every deviceLogSourceRefresh.
+func (s *ShellyService) deviceLogSource(ip string) (uint, bool) {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	if id, ok := s.logSources[ip]; ok {
+		return id, true
+	}
+	if time.Since(s.logSourcesAt) < deviceLogSourceRefresh {
+		return 0, false
+	}
+	s.logSourcesAt = time.Now()
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return 0, false
+	}
+	s.logSources = make(map[string]uint, len(devices))
+	for _, d := range devices {
+		if d.IP != "" {
+			s.logSources[d.IP] = d.ID
+		}
+	}
+	id, ok := s.logSources[ip]
+	return id, ok
+}
+
+// parseDeviceLogLine parses a Gen2 debug log line,
+// "<device id> <seq> <time> <level>|<message>"; lines in another format are
+// kept whole at info level
+func parseDeviceLogLine(line string) (database.DeviceLog, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return database.DeviceLog{}, false
+	}
+	entry := database.DeviceLog{Level: "info", Message: line}
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 {
+		return entry, true
+	}
+	if _, err := strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return entry, true
+	}
+	ts, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return entry, true
+	}
+	entry.DeviceTime = ts
+	entry.Message = fields[3]
+	if level, msg, ok := strings.Cut(fields[3], "|"); ok && len(level) == 1 && level[0] >= '0' && int(level[0]-'0') < len(deviceLogLevels) {
+		entry.Level = deviceLogLevels[level[0]-'0']
+		entry.Message = msg
+	}
+	return entry, true
+}
+
+// SetDeviceLogStreaming points a Gen2 device's debug log at the collector, or
+// stops it
+func (s *ShellyService) SetDeviceLogStreaming(ctx context.Context, deviceID uint, enable bool) (*DeviceLogStatus, error) {
+	cfg := s.deviceLogsConfig()
+	if enable && (!cfg.Enabled || cfg.Address == "") {
+		return nil, fmt.Errorf("%w: set device_logs.enabled and device_logs.address", ErrDeviceLogsDisabled)
+	}
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	if deviceGenerationOf(device) < 2 {
+		return nil, fmt.Errorf("%w: device %d", ErrDeviceLogsUnsupported, deviceID)
+	}
+	client, err := s.getClient(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	caller, ok := client.(rpcCaller)
+	if !ok {
+		return nil, fmt.Errorf("%w: device %d does not accept RPC calls", ErrDeviceLogsUnsupported, deviceID)
+	}
+
+	var addr interface{}
+	if enable {
+		addr = cfg.Address
+	}
+	callCtx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	debug := map[string]interface{}{"udp": map[string]interface{}{"addr": addr}}
+	if err := caller.CallRPC(callCtx, "Sys.SetConfig", map[string]interface{}{"config": map[string]interface{}{"debug": debug}}); err != nil {
+		return nil, fmt.Errorf("failed to configure debug log: %w", err)
+	}
+
+	db := s.DB.GetDB()
+	if enable {
+		stream := database.DeviceLogStream{DeviceID: deviceID}
+		if err := db.Where("device_id = ?", deviceID).Limit(1).Find(&stream).Error; err != nil {
+			return nil, fmt.Errorf("failed to load log stream: %w", err)
+		}
+		stream.Address = cfg.Address
+		stream.StartedAt = time.Now()
+		if err := db.Save(&stream).Error; err != nil {
+			return nil, fmt.Errorf("failed to store log stream: %w", err)
+		}
+	} else if err := db.Where("device_id = ?", deviceID).Delete(&database.DeviceLogStream{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to remove log stream: %w", err)
+	}
+
+	s.logger.WithFields(map[string]any{
+		"device_id": deviceID,
+		"enable":    enable,
+		"address":   cfg.Address,
+		"component": "device_logs",
+	}).Info("Configured device debug log streaming")
+	return s.DeviceLogStatus(deviceID)
+}
+
+// DeviceLogStatus returns whether a device streams its log and how many
+// lines are kept
+func (s *ShellyService) DeviceLogStatus(deviceID uint) (*DeviceLogStatus, error) {
+	if _, err := s.DB.GetDevice(deviceID); err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	db := s.DB.GetDB()
+	status := &DeviceLogStatus{DeviceID: deviceID}
+	var stream database.DeviceLogStream
+	if err := db.Where("device_id = ?", deviceID).Limit(1).Find(&stream).Error; err != nil {
+		return nil, fmt.Errorf("failed to load log stream: %w", err)
+	}
+	if stream.ID != 0 {
+		status.Streaming, status.Address, status.StartedAt = true, stream.Address, &stream.StartedAt
+	}
+	if err := db.Model(&database.DeviceLog{}).Where("device_id = ?", deviceID).Count(&status.Stored).Error; err != nil {
+		return nil, fmt.Errorf("failed to count device logs: %w", err)
+	}
+	return status, nil
+}
+
+// DeviceLogs returns the most recent log lines of a device matching the
+// query, oldest first
+func (s *ShellyService) DeviceLogs(deviceID uint, q DeviceLogQuery) ([]database.DeviceLog, error) {
+	if _, err := s.DB.GetDevice(deviceID); err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultDeviceLogLimit
+	}
+	if limit > maxDeviceLogLimit {
+		return nil, fmt.Errorf("%w: limit must not exceed %d", ErrInvalidDeviceLogQuery, maxDeviceLogLimit)
+	}
+
+	query := s.DB.GetDB().Where("device_id = ?", deviceID)
+	if q.Since != nil {
+		query = query.Where("received_at >= ?", *q.Since)
+	}
+	if q.Until != nil {
+		query = query.Where("received_at < ?", *q.Until)
+	}
+	if q.Level != "" {
+		levels := []string{}
+		for _, l := range deviceLogLevels {
+			levels = append(levels, l)
+			if l == q.Level {
+				break
+			}
+		}
+		if levels[len(levels)-1] != q.Level {
+			return nil, fmt.Errorf("%w: level must be one of %s", ErrInvalidDeviceLogQuery, strings.Join(deviceLogLevels, ", "))
+		}
+		query = query.Where("level IN ?", levels)
+	}
+	if q.Search != "" {
+		query = query.Where("LOWER(message) LIKE ?", "%"+strings.ToLower(q.Search)+"%")
+	}
+
+	logs := []database.DeviceLog{}
+	if err := query.Order("id DESC").Limit(limit).Find(&logs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load device logs: %w", err)
+	}
+	for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+		logs[i], logs[j] = logs[j], logs[i]
+	}
+	return logs, nil
+}
+
+// PruneDeviceLogs removes log lines older than device_logs.retention and
+// those beyond device_logs.max_entries per device, returning how many were
+// removed
+func (s *ShellyService) PruneDeviceLogs(now time.Time) (int64, error) {
+	cfg := s.deviceLogsConfig()
+	db := s.DB.GetDB()
+	res := db.Where("received_at < ?", now.Add(-cfg.RetentionDuration())).Delete(&database.DeviceLog{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to remove old device logs: %w", res.Error)
+	}
+	removed := res.RowsAffected
+
+	var counts []struct {
+		DeviceID uint
+		Count    int64
+	}
+	keep := cfg.MaxEntriesPerDevice()
+	if err := db.Model(&database.DeviceLog{}).Select("device_id, COUNT(*) AS count").
+		Group("device_id").Having("COUNT(*) > ?", keep).Scan(&counts).Error; err != nil {
+		return removed, fmt.Errorf("failed to count device logs: %w", err)
+	}
+	for _, c := range counts {
+		var oldestKept database.DeviceLog
+		if err := db.Where("device_id = ?", c.DeviceID).Order("id DESC").Offset(keep - 1).Limit(1).Find(&oldestKept).Error; err != nil {
+			return removed, fmt.Errorf("failed to find device log cutoff: %w", err)
+		}
+		res := db.Where("device_id = ? AND id < ?", c.DeviceID, oldestKept.ID).Delete(&database.DeviceLog{})
+		if res.Error != nil {
+			return removed, fmt.Errorf("failed to cap device logs: %w", res.Error)
+		}
+		removed += res.RowsAffected
+	}
+	return removed, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestParseDeviceLogLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		level   string
+		message string
+		time    float64
+	}{
+		{"shellyplus1-a8032ab12345 42 1700000000.125 1|shelly_ws.cpp:120 Connection lost", "warn", "shelly_ws.cpp:120 Connection lost", 1700000000.125},
+		{"shellyplus1-a8032ab12345 43 18.500 0|mgos_http.c:50 boom", "error", "mgos_http.c:50 boom", 18.5},
+		{"shellyplus1-a8032ab12345 44 19.000 plain message", "info", "plain message", 19},
+		{"free form text", "info", "free form text", 0},
+	}
+	for _, tt := range tests {
+		entry, ok := parseDeviceLogLine(tt.line)
+		if !ok || entry.Level != tt.level || entry.Message != tt.message || entry.DeviceTime != tt.time {
+			t.Errorf("parseDeviceLogLine(%q) = %+v", tt.line, entry)
+		}
+	}
+	if _, ok := parseDeviceLogLine("  "); ok {
+		t.Error("Expected a blank line to be skipped")
+	}
+}
+
+func TestShellyService_DeviceLogs(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	gen2 := &database.Device{IP: "127.0.0.1", MAC: "AABBCCDDEE01", Name: "Plus 1", Settings: `{"gen":2}`}
+	gen1 := &database.Device{IP: "192.0.2.2", MAC: "AABBCCDDEE02", Name: "Relay", Settings: `{"gen":1}`}
+	for _, d := range []*database.Device{gen2, gen1} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+
+	if _, err := service.SetDeviceLogStreaming(context.Background(), gen2.ID, true); !errors.Is(err, ErrDeviceLogsDisabled) {
+		t.Errorf("Expected streaming refused while disabled, got %v", err)
+	}
+	cfg.DeviceLogs.Enabled, cfg.DeviceLogs.Address = true, "192.0.2.100:5514"
+	if _, err := service.SetDeviceLogStreaming(context.Background(), gen1.ID, true); !errors.Is(err, ErrDeviceLogsUnsupported) {
+		t.Errorf("Expected streaming refused for a Gen1 device, got %v", err)
+	}
+
+	// Datagrams are stored for the device sending them
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+	go service.collectDeviceLogs(conn)
+	sender, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial collector: %v", err)
+	}
+	defer sender.Close()
+	for _, line := range []string{
+		"shellyplus1-a8032ab12345 1 10.0 2|shelly_notification:164 Status change of switch:0",
+		"shellyplus1-a8032ab12345 2 11.0 3|shos_rpc_inst.c:243 Switch.Set via HTTP",
+		"shellyplus1-a8032ab12345 3 12.0 0|shelly_ws.cpp:88 WebSocket error\nshellyplus1-a8032ab12345 4 12.5 1|wifi weak signal",
+	} {
+		if _, err := sender.Write([]byte(line)); err != nil {
+			t.Fatalf("Failed to send log line: %v", err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := service.DeviceLogStatus(gen2.ID)
+		if err != nil {
+			t.Fatalf("DeviceLogStatus failed: %v", err)
+		}
+		if status.Stored == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 4 log lines stored, got %d", status.Stored)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	logs, err := service.DeviceLogs(gen2.ID, DeviceLogQuery{Level: "warn"})
+	if err != nil {
+		t.Fatalf("DeviceLogs failed: %v", err)
+	}
+	if len(logs) != 2 || logs[0].Level != "error" || logs[1].Message != "wifi weak signal" {
+		t.Errorf("Expected the error and warning oldest first, got %+v", logs)
+	}
+	logs, _ = service.DeviceLogs(gen2.ID, DeviceLogQuery{Search: "SWITCH"})
+	if len(logs) != 2 {
+		t.Errorf("Expected a case-insensitive message search, got %+v", logs)
+	}
+	logs, _ = service.DeviceLogs(gen2.ID, DeviceLogQuery{Limit: 1})
+	if len(logs) != 1 || logs[0].Message != "wifi weak signal" {
+		t.Errorf("Expected the most recent line, got %+v", logs)
+	}
+	if _, err := service.DeviceLogs(gen2.ID, DeviceLogQuery{Level: "trace"}); !errors.Is(err, ErrInvalidDeviceLogQuery) {
+		t.Errorf("Expected an unknown level refused, got %v", err)
+	}
+
+	// Lines beyond the per-device cap and past the retention are pruned
+	cfg.DeviceLogs.MaxEntries = 3
+	removed, err := service.PruneDeviceLogs(time.Now())
+	if err != nil || removed != 1 {
+		t.Fatalf("Expected the oldest line pruned, got %d, %v", removed, err)
+	}
+	removed, err = service.PruneDeviceLogs(time.Now().Add(cfg.DeviceLogs.RetentionDuration() + time.Minute))
+	if err != nil || removed != 3 {
+		t.Errorf("Expected the expired lines pruned, got %d, %v", removed, err)
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+)
+
+var (
+	// ErrProxyDisabled is returned when the device proxy is switched off
+	ErrProxyDisabled = errors.New("device proxy is disabled")
+	// ErrProxyPathNotAllowed is returned for paths the proxy does not forward
+	ErrProxyPathNotAllowed = errors.New("path not allowed by the device proxy")
+	// ErrProxyResponseTooLarge is returned when a device response exceeds
+	// device_proxy.max_response_size
+	ErrProxyResponseTooLarge = errors.New("device response too large")
+	// ErrProxyUnsupported is returned when the device's client cannot pass
+	// requests through
+	ErrProxyUnsupported = errors.New("device does not support proxied requests")
+)
+
+// deviceForwarder is implemented by device clients that can pass requests
+// through to the device
+type deviceForwarder interface {
+	Forward(ctx context.Context, method, path, rawQuery string, body []byte, contentType string) (*http.Response, error)
+}
+
+// DeviceProxyRequest is a request for a page or API hosted by a device
+type DeviceProxyRequest struct {
+	Method      string
+	Path        string
+	RawQuery    string
+	Body        []byte
+	ContentType string
+}
+
+// DeviceProxyResponse is the device's answer to a proxied request
+type DeviceProxyResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// ProxyDeviceRequest forwards a request to a device through its client, so
+// device credentials are applied by the server. Only paths allowed by
+// device_proxy are forwarded.
+func (s *ShellyService) ProxyDeviceRequest(ctx context.Context, deviceID uint, req DeviceProxyRequest) (*DeviceProxyResponse, error) {
+	var proxyCfg config.DeviceProxyConfig
+	if s.Config != nil {
+		proxyCfg = s.Config.DeviceProxy
+	}
+	if !proxyCfg.Enabled {
+		return nil, ErrProxyDisabled
+	}
+	target := path.Clean("/" + strings.TrimPrefix(req.Path, "/"))
+	if !proxyCfg.Allows(req.Method, target, req.RawQuery) {
+		return nil, fmt.Errorf("%w: %s %s", ErrProxyPathNotAllowed, req.Method, target)
+	}
+
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	client, err := s.getClient(device)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+	forwarder, ok := client.(deviceForwarder)
+	if !ok {
+		return nil, fmt.Errorf("%w: device %d", ErrProxyUnsupported, deviceID)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	resp, err := forwarder.Forward(callCtx, req.Method, target, req.RawQuery, req.Body, req.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	limit := proxyCfg.MaxResponseBytes()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrProxyResponseTooLarge, limit)
+	}
+
+	s.logger.WithContext(ctx).WithFields(map[string]any{
+		"device_id": deviceID,
+		"method":    req.Method,
+		"path":      target,
+		"status":    resp.StatusCode,
+		"bytes":     len(body),
+		"component": "device_proxy",
+	}).Debug("Proxied device request")
+
+	return &DeviceProxyResponse{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        body,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_ProxyDeviceRequest(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+
+	var lastQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastQuery = r.URL.RawQuery
+		switch r.URL.Path {
+		case "/shelly":
+			_, _ = w.Write([]byte(`{"type":"SHSW-1","mac":"AABBCCDDEE40"}`))
+		case "/status":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"relays":[{"ison":true}]}`))
+		case "/settings":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"name":"` + r.URL.Query().Get("name") + `"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	device := &database.Device{IP: server.URL[len("http://"):], MAC: "AABBCCDDEE40", Type: "SHSW-1",
+		Name: "Porch", Status: "online", Settings: `{"model":"SHSW-1","gen":1}`}
+	if err := db.AddDevice(device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	ctx := context.Background()
+	get := func(path, query string) (*DeviceProxyResponse, error) {
+		return service.ProxyDeviceRequest(ctx, device.ID, DeviceProxyRequest{Method: http.MethodGet, Path: path, RawQuery: query})
+	}
+
+	if _, err := get("/status", ""); !errors.Is(err, ErrProxyDisabled) {
+		t.Fatalf("Expected the disabled proxy to refuse, got %v", err)
+	}
+	cfg.DeviceProxy.Enabled = true
+
+	resp, err := get("status", "")
+	if err != nil {
+		t.Fatalf("ProxyDeviceRequest failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.ContentType != "application/json" || string(resp.Body) != `{"relays":[{"ison":true}]}` {
+		t.Errorf("Unexpected proxied response: %d %s %s", resp.StatusCode, resp.ContentType, resp.Body)
+	}
+
+	for _, path := range []string{"/relay/0", "/debug/../relay/0"} {
+		if _, err := get(path, "turn=on"); !errors.Is(err, ErrProxyPathNotAllowed) {
+			t.Errorf("Expected %s to be refused, got %v", path, err)
+		}
+	}
+	if _, err := service.ProxyDeviceRequest(ctx, device.ID, DeviceProxyRequest{Method: http.MethodPost, Path: "/status"}); !errors.Is(err, ErrProxyPathNotAllowed) {
+		t.Errorf("Expected POST to be refused without write paths, got %v", err)
+	}
+
+	// Gen1 settings change through GET with a query string
+	if _, err := get("/settings", "name=Garden"); !errors.Is(err, ErrProxyPathNotAllowed) {
+		t.Errorf("Expected a settings change to need a write path, got %v", err)
+	}
+	cfg.DeviceProxy.WritePaths = []string{"/settings"}
+	resp, err = get("/settings", "name=Garden")
+	if err != nil {
+		t.Fatalf("ProxyDeviceRequest failed: %v", err)
+	}
+	if lastQuery != "name=Garden" || string(resp.Body) != `{"name":"Garden"}` {
+		t.Errorf("Expected the query to reach the device, got %q and %s", lastQuery, resp.Body)
+	}
+
+	// Device errors are passed through with their status
+	cfg.DeviceProxy.ReadPaths = []string{"/debug/*"}
+	resp, err = get("/debug/missing", "")
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the device's 404, got %+v, %v", resp, err)
+	}
+
+	cfg.DeviceProxy.ReadPaths = nil
+	cfg.DeviceProxy.MaxResponseSize = 4
+	if _, err := get("/status", ""); !errors.Is(err, ErrProxyResponseTooLarge) {
+		t.Errorf("Expected an oversized response to be refused, got %v", err)
+	}
+
+	if _, err := service.ProxyDeviceRequest(ctx, 999, DeviceProxyRequest{Method: http.MethodGet, Path: "/status"}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected unknown device to be refused, got %v", err)
+	}
+}
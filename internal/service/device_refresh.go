@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/discovery"
+)
+
+var (
+	// ErrDeviceNotResponding is returned when a device does not answer a probe
+	ErrDeviceNotResponding = errors.New("device did not respond")
+
+	// ErrDeviceMismatch is returned when another device answers at a device's address
+	ErrDeviceMismatch = errors.New("a different device answers at this address")
+)
+
+// DeviceSettingChange is a device property changed by a refresh
+type DeviceSettingChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// DeviceRefresh reports the outcome of re-probing a device
+type DeviceRefresh struct {
+	Device  *database.Device      `json:"device"`
+	Changes []DeviceSettingChange `json:"changes"`
+}
+
+// RefreshDevice re-probes a device and updates what discovery recorded about
+// it: model, generation and auth in the settings, the type and the firmware
+// version. Firmware upgrades change these, and with them the capabilities
+// derived from the model and generation. Saved credentials and other
+// settings are kept. The cached client is dropped so the next request uses
+// the client for the current generation.
+func (s *ShellyService) RefreshDevice(ctx context.Context, deviceID uint) (*DeviceRefresh, error) {
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+
+	timeout := s.deviceClientSettings(device).RequestTimeout()
+	opts, err := s.discoveryOptions()
+	if err != nil {
+		return nil, err
+	}
+	probed, err := discovery.NewScannerWithLogger(timeout, 1, s.logger, opts...).ScanHost(ctx, device.IP)
+	if errors.Is(err, discovery.ErrExcluded) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+	if probed == nil {
+		return nil, fmt.Errorf("%w at %s", ErrDeviceNotResponding, device.IP)
+	}
+	if device.MAC != "" && normalizeMAC(probed.MAC) != normalizeMAC(device.MAC) {
+		return nil, fmt.Errorf("%w: %s has MAC %s, expected %s", ErrDeviceMismatch, device.IP, probed.MAC, device.MAC)
+	}
+
+	settings := make(map[string]interface{})
+	if device.Settings != "" {
+		if err := json.Unmarshal([]byte(device.Settings), &settings); err != nil {
+			settings = make(map[string]interface{})
+		}
+	}
+
+	refresh := &DeviceRefresh{Device: device, Changes: []DeviceSettingChange{}}
+	change := func(field string, before, after interface{}) {
+		oldStr, newStr := fmt.Sprint(before), fmt.Sprint(after)
+		if before == nil {
+			oldStr = ""
+		}
+		if oldStr != newStr {
+			refresh.Changes = append(refresh.Changes, DeviceSettingChange{Field: field, Old: oldStr, New: newStr})
+		}
+	}
+
+	change("model", settings["model"], probed.Model)
+	change("gen", deviceGeneration(settings), probed.Generation)
+	change("auth_enabled", settings["auth_enabled"], probed.AuthEn)
+	settings["model"] = probed.Model
+	settings["gen"] = probed.Generation
+	settings["auth_enabled"] = probed.AuthEn
+
+	deviceType := discovery.GetDeviceType(probed.Model)
+	change("type", device.Type, deviceType)
+	change("firmware", device.Firmware, probed.Version)
+	device.Type = deviceType
+	device.Firmware = probed.Version
+	device.Status = "online"
+	device.LastSeen = time.Now()
+
+	updated, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	device.Settings = string(updated)
+	if err := s.DB.UpdateDevice(device); err != nil {
+		return nil, fmt.Errorf("failed to save device: %w", err)
+	}
+	s.ClearClientCache(device.IP)
+
+	s.logger.WithFields(map[string]any{
+		"device_id": device.ID,
+		"device_ip": device.IP,
+		"changes":   len(refresh.Changes),
+		"component": "service",
+	}).Info("Refreshed device settings")
+	return refresh, nil
+}
+
+// normalizeMAC returns a MAC address in upper case without separators
+func normalizeMAC(mac string) string {
+	return strings.ToUpper(strings.NewReplacer(":", "", "-", "").Replace(mac))
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_RefreshDevice(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+
+	var mu sync.Mutex
+	mac := "AABBCCDDEE01"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/shelly" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id": "shellyplus1pm-aabbccddee01", "mac": mac, "model": "SNSW-001P16EU",
+			"gen": 2, "ver": "1.4.2", "auth_en": true,
+		})
+	}))
+	defer server.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	device := &database.Device{IP: server.URL[len("http://"):], MAC: "aa:bb:cc:dd:ee:01", Type: "Unknown", Name: "Boiler",
+		Firmware: "1.0.0", Settings: `{"model":"SNSW-001P16EU","gen":2,"auth_enabled":false,"auth_user":"admin","auth_pass":"secret"}`}
+	if err := db.AddDevice(device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	refresh, err := service.RefreshDevice(context.Background(), device.ID)
+	if err != nil {
+		t.Fatalf("RefreshDevice failed: %v", err)
+	}
+	changed := map[string]DeviceSettingChange{}
+	for _, c := range refresh.Changes {
+		changed[c.Field] = c
+	}
+	if len(changed) != 3 || changed["firmware"].New != "1.4.2" || changed["auth_enabled"].New != "true" || changed["type"].Old != "Unknown" {
+		t.Errorf("Expected firmware, auth and type changes, got %+v", refresh.Changes)
+	}
+
+	stored, err := db.GetDevice(device.ID)
+	if err != nil {
+		t.Fatalf("GetDevice failed: %v", err)
+	}
+	var settings map[string]any
+	_ = json.Unmarshal([]byte(stored.Settings), &settings)
+	if stored.Firmware != "1.4.2" || settings["auth_enabled"] != true || settings["auth_pass"] != "secret" {
+		t.Errorf("Expected refreshed settings with credentials kept, got %s (firmware %s)", stored.Settings, stored.Firmware)
+	}
+
+	// Nothing changes on a second refresh
+	if refresh, err = service.RefreshDevice(context.Background(), device.ID); err != nil || len(refresh.Changes) != 0 {
+		t.Errorf("Expected no changes, got %+v, %v", refresh, err)
+	}
+
+	// Another device at the address is not taken for this one
+	mu.Lock()
+	mac = "AABBCCDDEE99"
+	mu.Unlock()
+	if _, err := service.RefreshDevice(context.Background(), device.ID); !errors.Is(err, ErrDeviceMismatch) {
+		t.Errorf("Expected ErrDeviceMismatch, got %v", err)
+	}
+
+	if _, err := service.RefreshDevice(context.Background(), 9999); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+}
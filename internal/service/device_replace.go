@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// ErrInvalidReplacement is returned when a device cannot replace another
+var ErrInvalidReplacement = errors.New("invalid device replacement")
+
+// DeviceReplaceRequest names the Gen2 device that replaces a Gen1 device
+type DeviceReplaceRequest struct {
+	NewDeviceID uint `json:"new_device_id"`
+	DryRun      bool `json:"dry_run"` // only translate the configuration
+}
+
+// MigrationCallResult is the outcome of one migration RPC call
+type MigrationCallResult struct {
+	Method string `json:"method"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DeviceReplacement reports a Gen1 to Gen2 device replacement
+type DeviceReplacement struct {
+	OldDeviceID uint                         `json:"old_device_id"`
+	NewDeviceID uint                         `json:"new_device_id"`
+	DryRun      bool                         `json:"dry_run"`
+	Migration   *configuration.Gen2Migration `json:"migration"`
+	Results     []MigrationCallResult        `json:"results,omitempty"`
+	Applied     int                          `json:"applied"`
+	Failed      int                          `json:"failed"`
+	Name        string                       `json:"name,omitempty"` // name carried over to the new device
+	Tags        []string                     `json:"tags,omitempty"` // tags carried over to the new device
+}
+
+// rpcCaller is implemented by the Gen2 device client
+type rpcCaller interface {
+	CallRPC(ctx context.Context, method string, params map[string]interface{}) error
+}
+
+// ReplaceDevice moves a Gen1 device's role to the Gen2 device that replaces
+// it: the stored Gen1 configuration is translated and applied to the new
+// device, and the old device's name and tags are carried over. Calls that
+// fail are reported and the rest still applied; settings that cannot be
+// translated are listed in the migration. The old device stays in the
+// inventory until it is deleted. With DryRun only the translation is done.
+func (s *ShellyService) ReplaceDevice(ctx context.Context, oldID uint, req DeviceReplaceRequest) (*DeviceReplacement, error) {
+	if req.NewDeviceID == 0 || req.NewDeviceID == oldID {
+		return nil, fmt.Errorf("%w: new_device_id must name another device", ErrInvalidReplacement)
+	}
+	oldDevice, err := s.DB.GetDevice(oldID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, oldID)
+	}
+	newDevice, err := s.DB.GetDevice(req.NewDeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, req.NewDeviceID)
+	}
+	if gen := deviceGenerationOf(oldDevice); gen != 1 {
+		return nil, fmt.Errorf("%w: device %d is Gen%d, not Gen1", ErrInvalidReplacement, oldID, gen)
+	}
+	if gen := deviceGenerationOf(newDevice); gen < 2 {
+		return nil, fmt.Errorf("%w: device %d is not a Gen2 or later device", ErrInvalidReplacement, req.NewDeviceID)
+	}
+
+	stored, err := s.ConfigSvc.GetDeviceConfig(oldID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: device %d has no stored configuration; import it first", ErrInvalidReplacement, oldID)
+	}
+	migration, err := configuration.MigrateGen1ToGen2(stored.Config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReplacement, err)
+	}
+
+	result := &DeviceReplacement{
+		OldDeviceID: oldID,
+		NewDeviceID: req.NewDeviceID,
+		DryRun:      req.DryRun,
+		Migration:   migration,
+	}
+	if req.DryRun {
+		return result, nil
+	}
+
+	client, err := s.getClient(newDevice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	caller, ok := client.(rpcCaller)
+	if !ok {
+		return nil, fmt.Errorf("%w: device %d does not accept RPC calls", ErrInvalidReplacement, req.NewDeviceID)
+	}
+	timeout := s.deviceClientSettings(newDevice).ControlTimeoutDuration()
+	for _, call := range migration.Calls {
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := caller.CallRPC(callCtx, call.Method, call.Params)
+		cancel()
+		res := MigrationCallResult{Method: call.Method}
+		if err != nil {
+			res.Error = err.Error()
+			result.Failed++
+		} else {
+			result.Applied++
+		}
+		result.Results = append(result.Results, res)
+	}
+
+	if err := s.carryOverIdentity(oldDevice, newDevice, result); err != nil {
+		return result, err
+	}
+
+	s.logger.WithFields(map[string]any{
+		"old_device_id": oldID,
+		"new_device_id": req.NewDeviceID,
+		"applied":       result.Applied,
+		"failed":        result.Failed,
+		"unmapped":      len(migration.Unmapped),
+		"component":     "service",
+	}).Info("Replaced Gen1 device with Gen2 device")
+	return result, nil
+}
+
+// carryOverIdentity gives the new device the old device's name and tags
+func (s *ShellyService) carryOverIdentity(oldDevice, newDevice *database.Device, result *DeviceReplacement) error {
+	if oldDevice.Name != "" && oldDevice.Name != newDevice.Name {
+		newDevice.Name = oldDevice.Name
+		if err := s.DB.UpdateDevice(newDevice); err != nil {
+			return fmt.Errorf("failed to rename device %d: %w", newDevice.ID, err)
+		}
+		result.Name = oldDevice.Name
+	}
+
+	db := s.DB.GetDB()
+	var tags []database.DeviceTag
+	if err := db.Where("device_id = ?", oldDevice.ID).Order("tag").Find(&tags).Error; err != nil {
+		return fmt.Errorf("failed to load tags of device %d: %w", oldDevice.ID, err)
+	}
+	for _, t := range tags {
+		tag := database.DeviceTag{DeviceID: newDevice.ID, Tag: t.Tag}
+		if err := db.Where("device_id = ? AND tag = ?", newDevice.ID, t.Tag).FirstOrCreate(&tag).Error; err != nil {
+			return fmt.Errorf("failed to tag device %d: %w", newDevice.ID, err)
+		}
+		result.Tags = append(result.Tags, t.Tag)
+	}
+	return nil
+}
+
+// deviceGenerationOf returns the generation recorded in the device settings
+func deviceGenerationOf(device *database.Device) int {
+	var settings map[string]interface{}
+	_ = json.Unmarshal([]byte(device.Settings), &settings)
+	return deviceGeneration(settings)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_ReplaceDevice(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+
+	var mu sync.Mutex
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		if req.Method == "Shelly.GetDeviceInfo" {
+			_, _ = w.Write([]byte(`{"id":1,"result":{"id":"shellyplus1-aabbccddee02","gen":2}}`))
+			return
+		}
+		mu.Lock()
+		methods = append(methods, req.Method)
+		mu.Unlock()
+		if req.Method == "Webhook.Create" {
+			_, _ = w.Write([]byte(`{"id":1,"error":{"code":-103,"message":"Invalid argument"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":1,"result":{}}`))
+	}))
+	defer server.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	oldDevice := &database.Device{IP: "192.0.2.10", MAC: "AABBCCDDEE01", Type: "SHSW-1", Name: "Garage Light",
+		Settings: `{"model":"SHSW-1","gen":1}`}
+	newDevice := &database.Device{IP: server.URL[len("http://"):], MAC: "AABBCCDDEE02", Type: "SNSW-001X16EU",
+		Name: "shellyplus1-aabbccddee02", Settings: `{"model":"SNSW-001X16EU","gen":2}`}
+	for _, d := range []*database.Device{oldDevice, newDevice} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	if err := db.AddDeviceTag(oldDevice.ID, "garage"); err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := service.ReplaceDevice(ctx, oldDevice.ID, DeviceReplaceRequest{NewDeviceID: newDevice.ID}); !errors.Is(err, ErrInvalidReplacement) {
+		t.Fatalf("Expected a device without stored configuration to be rejected, got %v", err)
+	}
+	if _, err := service.ReplaceDevice(ctx, newDevice.ID, DeviceReplaceRequest{NewDeviceID: oldDevice.ID}); !errors.Is(err, ErrInvalidReplacement) {
+		t.Errorf("Expected a Gen2 device to be rejected as the old device, got %v", err)
+	}
+	if _, err := service.ReplaceDevice(ctx, oldDevice.ID, DeviceReplaceRequest{NewDeviceID: 999}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected unknown new device to be rejected, got %v", err)
+	}
+
+	settings := `{"name":"Garage Light","relays":[{"name":"Light","default_state":"off","out_on_url":"http://192.0.2.50/on"}],"login":{"enabled":true}}`
+	if err := db.GetDB().Create(&configuration.DeviceConfig{DeviceID: oldDevice.ID, Config: json.RawMessage(settings)}).Error; err != nil {
+		t.Fatalf("Failed to store config: %v", err)
+	}
+
+	preview, err := service.ReplaceDevice(ctx, oldDevice.ID, DeviceReplaceRequest{NewDeviceID: newDevice.ID, DryRun: true})
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if len(preview.Migration.Calls) != 3 || len(preview.Migration.Unmapped) != 1 || len(methods) != 0 {
+		t.Fatalf("Unexpected dry run: %+v, device calls %v", preview.Migration, methods)
+	}
+
+	result, err := service.ReplaceDevice(ctx, oldDevice.ID, DeviceReplaceRequest{NewDeviceID: newDevice.ID})
+	if err != nil {
+		t.Fatalf("ReplaceDevice failed: %v", err)
+	}
+	if result.Applied != 2 || result.Failed != 1 || result.Results[2].Error == "" {
+		t.Errorf("Expected the failing webhook to be reported, got %+v", result.Results)
+	}
+	if len(methods) != 3 || methods[0] != "Sys.SetConfig" || methods[1] != "Switch.SetConfig" {
+		t.Errorf("Unexpected device calls: %v", methods)
+	}
+
+	updated, err := db.GetDevice(newDevice.ID)
+	if err != nil {
+		t.Fatalf("GetDevice failed: %v", err)
+	}
+	if updated.Name != "Garage Light" || result.Name != "Garage Light" {
+		t.Errorf("Expected the name to be carried over, got %q", updated.Name)
+	}
+	tags, _ := db.GetDeviceTags(newDevice.ID)
+	if len(tags) != 1 || tags[0] != "garage" {
+		t.Errorf("Expected the tags to be carried over, got %v", tags)
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+)
+
+// ErrDeviceSchemaUnsupported is returned when a device cannot report its
+// configuration in the Gen2 Shelly.GetConfig layout
+var ErrDeviceSchemaUnsupported = errors.New("device-verified validation requires a Gen2 or later device")
+
+// VerifyTypedConfigOnDevice checks a typed configuration against the config
+// keys and types the device reports from Shelly.GetConfig, so settings its
+// firmware does not support are flagged before they are exported and
+// silently ignored. Nothing is written to the device.
+func (s *ShellyService) VerifyTypedConfigOnDevice(ctx context.Context, deviceID uint, config *configuration.TypedConfiguration) (*configuration.ValidationResult, error) {
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+
+	client, err := s.getClient(device)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+	if client.GetGeneration() < 2 {
+		return nil, ErrDeviceSchemaUnsupported
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	cfg, err := client.GetConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+
+	result, err := configuration.VerifyAgainstDeviceConfig(config, cfg.Raw, device.Firmware)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.WithFields(map[string]any{
+		"device_id": device.ID,
+		"firmware":  device.Firmware,
+		"valid":     result.Valid,
+		"errors":    len(result.Errors),
+		"component": "service",
+	}).Debug("Verified typed configuration against device")
+	return result, nil
+}
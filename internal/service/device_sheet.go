@@ -0,0 +1,364 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// ErrInvalidDeviceSheet is returned for a device sheet that cannot be read
+var ErrInvalidDeviceSheet = errors.New("invalid device sheet")
+
+// Tag prefixes of the group and room columns of the device sheet; the tags
+// column holds the other tags
+const (
+	deviceGroupTagPrefix = "group:"
+	deviceRoomTagPrefix  = "room:"
+)
+
+// deviceSheetColumns is the header of the device editing sheet. id and
+// version are read only; version refuses rows of devices edited since the
+// sheet was exported.
+var deviceSheetColumns = []string{"id", "version", "name", "group", "tags", "room"}
+
+// deviceSheetSeparator separates the values of a multi-valued cell
+const deviceSheetSeparator = ";"
+
+// sheetCell guards a cell against formula injection: spreadsheet programs
+// evaluate a cell starting with =, +, - or @, so such cells are exported
+// with a leading ' that makes them plain text
+func sheetCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// sheetValue undoes sheetCell on import
+func sheetValue(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune("=+-@", rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// DeviceSheetRow is one device of the editing sheet
+type DeviceSheetRow struct {
+	ID      uint     `json:"id"`
+	Version int      `json:"version"`
+	Name    string   `json:"name"`
+	Groups  []string `json:"groups"`
+	Tags    []string `json:"tags"`
+	Rooms   []string `json:"rooms"`
+}
+
+// DeviceSheetChange is the diff of one device between the stored state and
+// its sheet row
+type DeviceSheetChange struct {
+	DeviceID   uint     `json:"device_id"`
+	Line       int      `json:"line"`
+	OldName    string   `json:"old_name"`
+	NewName    string   `json:"new_name,omitempty"` // empty when the name is unchanged
+	AddTags    []string `json:"add_tags,omitempty"`
+	RemoveTags []string `json:"remove_tags,omitempty"`
+}
+
+// DeviceSheetResult reports a device sheet import. With errors, or as a dry
+// run, nothing is applied.
+type DeviceSheetResult struct {
+	DryRun    bool                `json:"dry_run"`
+	Applied   bool                `json:"applied"`
+	Rows      int                 `json:"rows"`
+	Unchanged int                 `json:"unchanged"`
+	Changes   []DeviceSheetChange `json:"changes"`
+	Errors    []string            `json:"errors"`
+}
+
+// DeviceSheet returns the editing sheet rows of all devices by ID. Group
+// and room come from "group:<name>" and "room:<name>" tags.
+func (s *ShellyService) DeviceSheet() ([]DeviceSheetRow, error) {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	tags := s.deviceTags()
+
+	rows := make([]DeviceSheetRow, 0, len(devices))
+	for _, d := range devices {
+		row := DeviceSheetRow{ID: d.ID, Version: d.Version, Name: d.Name, Groups: []string{}, Tags: []string{}, Rooms: []string{}}
+		for _, tag := range tags[d.ID] {
+			switch {
+			case strings.HasPrefix(tag, deviceGroupTagPrefix):
+				row.Groups = append(row.Groups, strings.TrimPrefix(tag, deviceGroupTagPrefix))
+			case strings.HasPrefix(tag, deviceRoomTagPrefix):
+				row.Rooms = append(row.Rooms, strings.TrimPrefix(tag, deviceRoomTagPrefix))
+			default:
+				row.Tags = append(row.Tags, tag)
+			}
+		}
+		sort.Strings(row.Groups)
+		sort.Strings(row.Tags)
+		sort.Strings(row.Rooms)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// WriteDeviceSheetCSV writes the editing sheet as CSV; multiple groups,
+// tags or rooms share a cell separated by ";". Cells that a spreadsheet
+// would run as a formula are prefixed with ', which the import strips.
+func WriteDeviceSheetCSV(w io.Writer, rows []DeviceSheetRow) error {
+	out := csv.NewWriter(w)
+	_ = out.Write(deviceSheetColumns)
+	for _, row := range rows {
+		_ = out.Write([]string{
+			strconv.FormatUint(uint64(row.ID), 10),
+			strconv.Itoa(row.Version),
+			sheetCell(row.Name),
+			sheetCell(strings.Join(row.Groups, deviceSheetSeparator)),
+			sheetCell(strings.Join(row.Tags, deviceSheetSeparator)),
+			sheetCell(strings.Join(row.Rooms, deviceSheetSeparator)),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// ImportDeviceSheet applies an edited device sheet. Rows name their device
+// by id; the name, group, tags and room columns present in the header
+// replace the stored values, so an empty cell clears them, and absent
+// columns are left alone. A version column refuses rows of devices edited
+// since the export. The sheet is applied as a whole: with any error, or
+// with dryRun, only the diff is returned.
+func (s *ShellyService) ImportDeviceSheet(r io.Reader, dryRun bool) (*DeviceSheetResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid CSV: %v", ErrInvalidDeviceSheet, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: the CSV is empty", ErrInvalidDeviceSheet)
+	}
+
+	columns := map[string]int{}
+	for i, col := range records[0] {
+		name := strings.ToLower(strings.TrimSpace(col))
+		switch name {
+		case "device_id":
+			name = "id"
+		case "groups":
+			name = "group"
+		case "rooms":
+			name = "room"
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["id"]; !ok {
+		return nil, fmt.Errorf("%w: the header must name an id column", ErrInvalidDeviceSheet)
+	}
+	has := func(name string) bool { _, ok := columns[name]; return ok }
+
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	byID := make(map[uint]*database.Device, len(devices))
+	for i := range devices {
+		byID[devices[i].ID] = &devices[i]
+	}
+	tags := s.deviceTags()
+
+	result := &DeviceSheetResult{DryRun: dryRun, Changes: []DeviceSheetChange{}, Errors: []string{}}
+	names := make(map[uint]string, len(devices))
+	for _, d := range devices {
+		names[d.ID] = d.Name
+	}
+	seen := map[uint]int{}
+	for i, record := range records[1:] {
+		line := i + 2
+		cell := func(name string) string {
+			if idx, ok := columns[name]; ok && idx < len(record) {
+				return sheetValue(strings.TrimSpace(record[idx]))
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		result.Rows++
+
+		id, err := strconv.ParseUint(cell("id"), 10, 32)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: invalid id %q", line, cell("id")))
+			continue
+		}
+		device := byID[uint(id)]
+		if device == nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: no device with id %d", line, id))
+			continue
+		}
+		if first, dup := seen[device.ID]; dup {
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: device %d is already on line %d", line, device.ID, first))
+			continue
+		}
+		seen[device.ID] = line
+		if v := cell("version"); v != "" {
+			version, err := strconv.Atoi(v)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("line %d: invalid version %q", line, v))
+				continue
+			}
+			if version != device.Version {
+				result.Errors = append(result.Errors, fmt.Sprintf("line %d: device %d changed since the sheet was exported (version %d, now %d)", line, device.ID, version, device.Version))
+				continue
+			}
+		}
+
+		change := DeviceSheetChange{DeviceID: device.ID, Line: line, OldName: device.Name}
+		if has("name") {
+			name := cell("name")
+			if name == "" {
+				result.Errors = append(result.Errors, fmt.Sprintf("line %d: name is required", line))
+				continue
+			}
+			if name != device.Name {
+				change.NewName = name
+				names[device.ID] = name
+			}
+		}
+
+		current := map[string]bool{}
+		for _, tag := range tags[device.ID] {
+			current[tag] = true
+		}
+		wanted := map[string]bool{}
+		for tag := range current {
+			switch {
+			case strings.HasPrefix(tag, deviceGroupTagPrefix) && has("group"),
+				strings.HasPrefix(tag, deviceRoomTagPrefix) && has("room"),
+				!strings.HasPrefix(tag, deviceGroupTagPrefix) && !strings.HasPrefix(tag, deviceRoomTagPrefix) && has("tags"):
+			default:
+				wanted[tag] = true
+			}
+		}
+		for _, group := range splitSheetCell(cell("group")) {
+			wanted[deviceGroupTagPrefix+group] = true
+		}
+		for _, room := range splitSheetCell(cell("room")) {
+			wanted[deviceRoomTagPrefix+room] = true
+		}
+		for _, tag := range splitSheetCell(cell("tags")) {
+			wanted[tag] = true
+		}
+		for tag := range wanted {
+			if !current[tag] {
+				change.AddTags = append(change.AddTags, tag)
+			}
+		}
+		for tag := range current {
+			if !wanted[tag] {
+				change.RemoveTags = append(change.RemoveTags, tag)
+			}
+		}
+		sort.Strings(change.AddTags)
+		sort.Strings(change.RemoveTags)
+
+		if change.NewName == "" && len(change.AddTags) == 0 && len(change.RemoveTags) == 0 {
+			result.Unchanged++
+			continue
+		}
+		result.Changes = append(result.Changes, change)
+	}
+
+	// A new name must not be used by another device once the sheet is applied
+	owners := map[string][]uint{}
+	for id, name := range names {
+		key := strings.ToLower(name)
+		owners[key] = append(owners[key], id)
+	}
+	for _, change := range result.Changes {
+		if change.NewName == "" {
+			continue
+		}
+		for _, other := range owners[strings.ToLower(change.NewName)] {
+			if other != change.DeviceID {
+				result.Errors = append(result.Errors, fmt.Sprintf("line %d: name %q is also used by device %d", change.Line, change.NewName, other))
+				break
+			}
+		}
+	}
+
+	if dryRun || len(result.Errors) > 0 || len(result.Changes) == 0 {
+		return result, nil
+	}
+	if err := s.applyDeviceSheet(result.Changes, byID); err != nil {
+		return nil, err
+	}
+	result.Applied = true
+
+	s.logger.WithFields(map[string]any{
+		"changed":   len(result.Changes),
+		"unchanged": result.Unchanged,
+		"component": "service",
+	}).Info("Device sheet imported")
+	return result, nil
+}
+
+// applyDeviceSheet stores the changes in one transaction. A renamed device
+// gets a new version, as with other edits through the API.
+func (s *ShellyService) applyDeviceSheet(changes []DeviceSheetChange, devices map[uint]*database.Device) error {
+	return s.DB.GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, change := range changes {
+			if change.NewName != "" {
+				device := devices[change.DeviceID]
+				res := tx.Model(&database.Device{}).
+					Where("id = ? AND version = ?", device.ID, device.Version).
+					Updates(map[string]interface{}{"name": change.NewName, "version": gorm.Expr("version + 1")})
+				if res.Error != nil {
+					return fmt.Errorf("failed to rename device %d: %w", device.ID, res.Error)
+				}
+				if res.RowsAffected == 0 {
+					return fmt.Errorf("device %d: %w", device.ID, database.ErrVersionConflict)
+				}
+			}
+			for _, tag := range change.AddTags {
+				if err := tx.Create(&database.DeviceTag{DeviceID: change.DeviceID, Tag: tag}).Error; err != nil {
+					return fmt.Errorf("failed to tag device %d: %w", change.DeviceID, err)
+				}
+			}
+			if len(change.RemoveTags) > 0 {
+				if err := tx.Where("device_id = ? AND tag IN ?", change.DeviceID, change.RemoveTags).
+					Delete(&database.DeviceTag{}).Error; err != nil {
+					return fmt.Errorf("failed to untag device %d: %w", change.DeviceID, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// splitSheetCell returns the distinct values of a multi-valued cell
+func splitSheetCell(v string) []string {
+	var values []string
+	seen := map[string]bool{}
+	for _, part := range strings.Split(v, deviceSheetSeparator) {
+		part = strings.TrimSpace(part)
+		if part == "" || seen[part] {
+			continue
+		}
+		seen[part] = true
+		values = append(values, part)
+	}
+	return values
+}
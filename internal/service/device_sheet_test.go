@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_DeviceSheetRoundTrip(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	porch := &database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Name: "Porch"}
+	hall := &database.Device{IP: "192.0.2.2", MAC: "AABBCCDDEE02", Name: "Hall"}
+	for _, d := range []*database.Device{porch, hall} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	for _, tag := range []string{"group:outdoor", "room:porch", "lights", "site:home"} {
+		if err := service.tagDevice(porch.ID, tag); err != nil {
+			t.Fatalf("Failed to tag device: %v", err)
+		}
+	}
+
+	rows, err := service.DeviceSheet()
+	if err != nil {
+		t.Fatalf("DeviceSheet failed: %v", err)
+	}
+	var sheet bytes.Buffer
+	if err := WriteDeviceSheetCSV(&sheet, rows); err != nil {
+		t.Fatalf("WriteDeviceSheetCSV failed: %v", err)
+	}
+	wantSheet := fmt.Sprintf("id,version,name,group,tags,room\n%d,1,Porch,outdoor,lights;site:home,porch\n%d,1,Hall,,,\n", porch.ID, hall.ID)
+	if sheet.String() != wantSheet {
+		t.Fatalf("Unexpected sheet:\n%s", sheet.String())
+	}
+
+	// The sheet as exported changes nothing
+	result, err := service.ImportDeviceSheet(strings.NewReader(sheet.String()), false)
+	if err != nil {
+		t.Fatalf("ImportDeviceSheet failed: %v", err)
+	}
+	if result.Unchanged != 2 || len(result.Changes) != 0 || result.Applied {
+		t.Fatalf("Expected an unedited sheet to change nothing, got %+v", result)
+	}
+
+	edited := fmt.Sprintf("id,version,name,group,tags,room\n%d,1,Front door,outdoor;entrance,lights,\n%d,1,Hallway,indoor,,hall\n", porch.ID, hall.ID)
+	preview, err := service.ImportDeviceSheet(strings.NewReader(edited), true)
+	if err != nil {
+		t.Fatalf("ImportDeviceSheet failed: %v", err)
+	}
+	if preview.Applied || len(preview.Changes) != 2 || len(preview.Errors) != 0 {
+		t.Fatalf("Expected a preview of two changes, got %+v", preview)
+	}
+	change := preview.Changes[0]
+	if change.NewName != "Front door" ||
+		strings.Join(change.AddTags, ",") != "group:entrance" ||
+		strings.Join(change.RemoveTags, ",") != "room:porch,site:home" {
+		t.Errorf("Unexpected diff for the porch: %+v", change)
+	}
+	if d, _ := db.GetDevice(porch.ID); d.Name != "Porch" {
+		t.Errorf("Expected a dry run to leave the device alone, got %q", d.Name)
+	}
+
+	result, err = service.ImportDeviceSheet(strings.NewReader(edited), false)
+	if err != nil || !result.Applied {
+		t.Fatalf("Expected the sheet applied, got %+v, %v", result, err)
+	}
+	rows, _ = service.DeviceSheet()
+	if rows[0].Name != "Front door" || rows[0].Version != 2 || strings.Join(rows[0].Groups, ",") != "entrance,outdoor" ||
+		len(rows[0].Rooms) != 0 || rows[1].Name != "Hallway" || strings.Join(rows[1].Rooms, ",") != "hall" {
+		t.Errorf("Unexpected sheet after import: %+v", rows)
+	}
+
+	// The old sheet is stale now, and invalid rows refuse the whole sheet
+	invalid := fmt.Sprintf("id,version,name\n%d,1,Porch\n%d,2,\n%d,,Hall\n999,,Ghost\n", porch.ID, hall.ID, hall.ID)
+	result, err = service.ImportDeviceSheet(strings.NewReader(invalid), false)
+	if err != nil {
+		t.Fatalf("ImportDeviceSheet failed: %v", err)
+	}
+	if result.Applied || len(result.Errors) != 4 {
+		t.Fatalf("Expected four errors and nothing applied, got %+v", result)
+	}
+	for i, want := range []string{"changed since", "name is required", "is already on line", "no device"} {
+		if !strings.Contains(result.Errors[i], want) {
+			t.Errorf("Expected error %d to mention %q, got %q", i, want, result.Errors[i])
+		}
+	}
+
+	// Renaming onto a name another device keeps is refused
+	result, _ = service.ImportDeviceSheet(strings.NewReader(fmt.Sprintf("id,name\n%d,front DOOR\n", hall.ID)), false)
+	if result.Applied || len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "also used by") {
+		t.Errorf("Expected a duplicate name refused, got %+v", result)
+	}
+
+	if _, err := service.ImportDeviceSheet(strings.NewReader("name\nPorch"), false); !errors.Is(err, ErrInvalidDeviceSheet) {
+		t.Errorf("Expected a sheet without ids refused, got %v", err)
+	}
+}
+
+func TestDeviceSheetFormulaCells(t *testing.T) {
+	var sheet bytes.Buffer
+	rows := []DeviceSheetRow{{ID: 1, Version: 1, Name: "=HYPERLINK(\"http://x\")", Tags: []string{"+1", "ok"}, Rooms: []string{"@home"}, Groups: []string{"-x"}}}
+	if err := WriteDeviceSheetCSV(&sheet, rows); err != nil {
+		t.Fatalf("WriteDeviceSheetCSV failed: %v", err)
+	}
+	want := "id,version,name,group,tags,room\n1,1,\"'=HYPERLINK(\"\"http://x\"\")\",'-x,'+1;ok,'@home\n"
+	if sheet.String() != want {
+		t.Fatalf("Expected formula cells prefixed, got:\n%s", sheet.String())
+	}
+
+	for cell, want := range map[string]string{
+		"'=SUM(A1)": "=SUM(A1)",
+		"'@home":    "@home",
+		"'quoted":   "'quoted",
+		"'":         "'",
+		"plain":     "plain",
+	} {
+		if got := sheetValue(cell); got != want {
+			t.Errorf("sheetValue(%q) = %q, want %q", cell, got, want)
+		}
+	}
+}
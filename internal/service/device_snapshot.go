@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// DeviceSnapshot is the state of a device at a point in time, as evidence
+// for documentation
+type DeviceSnapshot struct {
+	DeviceID   uint                 `json:"device_id"`
+	CapturedAt time.Time            `json:"captured_at"`
+	Status     *shelly.DeviceStatus `json:"status"`
+	Image      []byte               `json:"image,omitempty"`      // camera or display image
+	ImageType  string               `json:"image_type,omitempty"` // MIME type of Image
+}
+
+// deviceImager is implemented by device clients of devices with a camera or
+// display that can return the current picture
+type deviceImager interface {
+	Snapshot(ctx context.Context) ([]byte, string, error)
+}
+
+// CaptureDeviceSnapshot reads the live status of a device and, when its
+// client supports it, the current camera or display image. A failing image
+// read is not an error; the status is still returned.
+func (s *ShellyService) CaptureDeviceSnapshot(ctx context.Context, deviceID uint) (*DeviceSnapshot, error) {
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	if device.Status == "offline" {
+		return nil, ErrDeviceOffline
+	}
+	client, err := s.getClient(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+
+	status, err := s.readStatus(ctx, client, device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status: %w", err)
+	}
+	snapshot := &DeviceSnapshot{DeviceID: device.ID, CapturedAt: s.clock.Now().UTC(), Status: status}
+	if imager, ok := client.(deviceImager); ok {
+		image, imageType, err := imager.Snapshot(ctx)
+		if err != nil {
+			s.logger.WithFields(map[string]any{
+				"device_id": device.ID,
+				"error":     err.Error(),
+				"component": "service",
+			}).Warn("Failed to capture device image")
+		} else {
+			snapshot.Image, snapshot.ImageType = image, imageType
+		}
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestShellyService_CaptureDeviceSnapshot(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/shelly":
+			_, _ = w.Write([]byte(`{"type":"SHSW-1","mac":"AABBCCDDEE51"}`))
+		case "/status":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"relays":[{"ison":true}],"wifi_sta":{"connected":true,"ssid":"lan","rssi":-58},"uptime":900}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	service.SetClock(testutil.NewFakeClock(now))
+
+	device := &database.Device{IP: server.URL[len("http://"):], MAC: "AA:BB:CC:DD:EE:51", Type: "SHSW-1",
+		Name: "Hall", Status: "online", Settings: `{"model":"SHSW-1","gen":1}`}
+	offline := &database.Device{IP: "10.0.0.99", MAC: "AA:BB:CC:DD:EE:52", Type: "SHSW-1", Name: "Shed", Status: "offline"}
+	for _, d := range []*database.Device{device, offline} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	ctx := context.Background()
+
+	snapshot, err := service.CaptureDeviceSnapshot(ctx, device.ID)
+	if err != nil {
+		t.Fatalf("CaptureDeviceSnapshot failed: %v", err)
+	}
+	if !snapshot.CapturedAt.Equal(now) || snapshot.Status == nil || snapshot.Status.Uptime != 900 ||
+		snapshot.Status.WiFiStatus == nil || snapshot.Status.WiFiStatus.RSSI != -58 || snapshot.Image != nil {
+		t.Errorf("Unexpected snapshot: %+v", snapshot)
+	}
+	if _, err := service.CaptureDeviceSnapshot(ctx, offline.ID); !errors.Is(err, ErrDeviceOffline) {
+		t.Errorf("Expected an offline device refused, got %v", err)
+	}
+	if _, err := service.CaptureDeviceSnapshot(ctx, 999); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected an unknown device refused, got %v", err)
+	}
+}
@@ -0,0 +1,467 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+var (
+	// ErrDeviceSocketDisabled is returned while device_socket is not enabled
+	ErrDeviceSocketDisabled = errors.New("device WebSocket is not enabled")
+	// ErrDeviceSocketUnauthorized is returned for connections that fail
+	// authentication or cannot be matched to a device
+	ErrDeviceSocketUnauthorized = errors.New("device WebSocket connection not authorized")
+	// ErrDeviceSocketUnsupported is returned for devices without an
+	// outbound WebSocket
+	ErrDeviceSocketUnsupported = errors.New("outbound WebSocket requires a Gen2 or later device")
+
+	errDeviceSocketClosed = errors.New("device WebSocket closed")
+)
+
+const (
+	// deviceSocketSource identifies the manager in frames sent to devices
+	deviceSocketSource = "shelly-manager"
+	// deviceSocketHelloTimeout bounds the wait for a device's first frame,
+	// which identifies it
+	deviceSocketHelloTimeout = 30 * time.Second
+	// deviceSocketSeenInterval limits how often pushed frames update the
+	// device's last_seen
+	deviceSocketSeenInterval = 30 * time.Second
+)
+
+// DeviceSocketConn is a WebSocket connection opened by a device;
+// *websocket.Conn implements it
+type DeviceSocketConn interface {
+	ReadJSON(v interface{}) error
+	WriteJSON(v interface{}) error
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// DeviceSocketStatus describes a device's outbound WebSocket connection and
+// the status it last pushed
+type DeviceSocketStatus struct {
+	DeviceID    uint                   `json:"device_id"`
+	Connected   bool                   `json:"connected"`
+	Source      string                 `json:"source,omitempty"`
+	ConnectedAt *time.Time             `json:"connected_at,omitempty"`
+	LastMessage *time.Time             `json:"last_message,omitempty"`
+	Status      map[string]interface{} `json:"status,omitempty"`
+}
+
+// socketFrame is a Gen2 JSON-RPC frame: a request or notification when
+// Method is set, otherwise the response to the request with the same ID
+type socketFrame struct {
+	ID     *int64            `json:"id,omitempty"`
+	Src    string            `json:"src,omitempty"`
+	Dst    string            `json:"dst,omitempty"`
+	Method string            `json:"method,omitempty"`
+	Params json.RawMessage   `json:"params,omitempty"`
+	Result json.RawMessage   `json:"result,omitempty"`
+	Error  *socketFrameError `json:"error,omitempty"`
+}
+
+type socketFrameError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// deviceSocket is the connection of one device
+type deviceSocket struct {
+	deviceID    uint
+	source      string
+	conn        DeviceSocketConn
+	connectedAt time.Time
+
+	writeMu sync.Mutex
+
+	mu          sync.Mutex
+	closed      bool
+	nextID      int64
+	pending     map[int64]chan socketFrame
+	lastMessage time.Time
+	lastSaved   time.Time
+	status      map[string]interface{}
+}
+
+// AuthorizeDeviceSocket checks the token a connecting device presents
+func (s *ShellyService) AuthorizeDeviceSocket(token string) error {
+	cfg := s.deviceSocketConfig()
+	if !cfg.Enabled {
+		return ErrDeviceSocketDisabled
+	}
+	if cfg.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+		return fmt.Errorf("%w: invalid token", ErrDeviceSocketUnauthorized)
+	}
+	return nil
+}
+
+// ServeDeviceSocket runs a connection opened by a device until it closes.
+// The device's first frame (NotifyFullStatus on connect) identifies it by
+// the MAC in its source ID; without a token the connection must come from
+// the device's known IP. Pushed status marks the device online, and control
+// commands for it go over the connection while it is open.
+func (s *ShellyService) ServeDeviceSocket(conn DeviceSocketConn, remoteIP string) error {
+	defer func() { _ = conn.Close() }()
+
+	_ = conn.SetReadDeadline(time.Now().Add(deviceSocketHelloTimeout))
+	var hello socketFrame
+	if err := conn.ReadJSON(&hello); err != nil {
+		return fmt.Errorf("failed to read device hello: %w", err)
+	}
+	device, err := s.deviceForSocketSource(hello.Src)
+	if err != nil {
+		return err
+	}
+	if s.deviceSocketConfig().Token == "" && remoteIP != device.IP {
+		return fmt.Errorf("%w: device %d connected from %s, expected %s", ErrDeviceSocketUnauthorized, device.ID, remoteIP, device.IP)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	sock := &deviceSocket{
+		deviceID:    device.ID,
+		source:      hello.Src,
+		conn:        conn,
+		connectedAt: time.Now(),
+		pending:     make(map[int64]chan socketFrame),
+	}
+	s.registerDeviceSocket(sock)
+	defer s.unregisterDeviceSocket(sock)
+
+	s.logger.WithFields(map[string]any{
+		"device_id": device.ID,
+		"source":    hello.Src,
+		"remote_ip": remoteIP,
+		"component": "device_socket",
+	}).Info("Device connected over WebSocket")
+
+	s.handleSocketFrame(sock, hello)
+	for {
+		var frame socketFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			s.logger.WithFields(map[string]any{
+				"device_id": device.ID,
+				"error":     err.Error(),
+				"component": "device_socket",
+			}).Info("Device WebSocket disconnected")
+			return nil
+		}
+		s.handleSocketFrame(sock, frame)
+	}
+}
+
+// GetDeviceSocketStatus reports whether a device is connected over its
+// outbound WebSocket and the status it last pushed
+func (s *ShellyService) GetDeviceSocketStatus(deviceID uint) (*DeviceSocketStatus, error) {
+	if _, err := s.DB.GetDevice(deviceID); err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	result := &DeviceSocketStatus{DeviceID: deviceID}
+	sock := s.deviceSocket(deviceID)
+	if sock == nil {
+		return result, nil
+	}
+
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	connectedAt, lastMessage := sock.connectedAt, sock.lastMessage
+	result.Connected = true
+	result.Source = sock.source
+	result.ConnectedAt = &connectedAt
+	result.LastMessage = &lastMessage
+	if sock.status != nil {
+		// Copy, as later frames update the map in place
+		if data, err := json.Marshal(sock.status); err == nil {
+			_ = json.Unmarshal(data, &result.Status)
+		}
+	}
+	return result, nil
+}
+
+// ConfigureDeviceSocket points a Gen2 device's outbound WebSocket at the
+// manager, or turns it off, and reboots the device to apply the change
+func (s *ShellyService) ConfigureDeviceSocket(ctx context.Context, deviceID uint, enable bool) error {
+	cfg := s.deviceSocketConfig()
+	if enable && (!cfg.Enabled || cfg.URL == "") {
+		return fmt.Errorf("%w: set device_socket.enabled and device_socket.url", ErrDeviceSocketDisabled)
+	}
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	if deviceGenerationOf(device) < 2 {
+		return fmt.Errorf("%w: device %d", ErrDeviceSocketUnsupported, deviceID)
+	}
+
+	client, err := s.getClient(device)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	caller, ok := client.(rpcCaller)
+	if !ok {
+		return fmt.Errorf("%w: device %d does not accept RPC calls", ErrDeviceSocketUnsupported, deviceID)
+	}
+
+	wsConfig := map[string]interface{}{"enable": enable}
+	if enable {
+		wsConfig["server"] = cfg.DeviceURL()
+	}
+	callCtx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	if err := caller.CallRPC(callCtx, "WS.SetConfig", map[string]interface{}{"config": wsConfig}); err != nil {
+		return fmt.Errorf("failed to configure outbound WebSocket: %w", err)
+	}
+	s.expectReboot(device.ID)
+	if err := caller.CallRPC(callCtx, "Shelly.Reboot", nil); err != nil {
+		return fmt.Errorf("failed to reboot device: %w", err)
+	}
+
+	s.logger.WithFields(map[string]any{
+		"device_id": deviceID,
+		"enable":    enable,
+		"component": "device_socket",
+	}).Info("Configured device outbound WebSocket")
+	return nil
+}
+
+// controlOverSocket runs a control action over the device's WebSocket
+func (s *ShellyService) controlOverSocket(ctx context.Context, sock *deviceSocket, device *database.Device, action string, params map[string]interface{}) error {
+	channel := 0
+	if ch, ok := params["channel"].(float64); ok {
+		channel = int(ch)
+	}
+	var method string
+	var rpcParams map[string]interface{}
+	switch action {
+	case "on", "off":
+		method = "Switch.Set"
+		rpcParams = map[string]interface{}{"id": channel, "on": action == "on"}
+	case "toggle":
+		method = "Switch.Toggle"
+		rpcParams = map[string]interface{}{"id": channel}
+	case "reboot":
+		method = "Shelly.Reboot"
+		s.expectReboot(device.ID)
+	default:
+		return fmt.Errorf("unknown action: %s", action)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	_, err := sock.call(ctx, method, rpcParams)
+	return err
+}
+
+func (s *ShellyService) deviceSocketConfig() config.DeviceSocketConfig {
+	if s.Config == nil {
+		return config.DeviceSocketConfig{}
+	}
+	return s.Config.DeviceSocket
+}
+
+// deviceForSocketSource finds the device of a Gen2 source ID such as
+// "shellyplus1pm-a8032ab1e2c4", which ends in the device's MAC
+func (s *ShellyService) deviceForSocketSource(src string) (*database.Device, error) {
+	i := strings.LastIndex(src, "-")
+	mac := normalizeMAC(src[i+1:])
+	if len(mac) != 12 {
+		return nil, fmt.Errorf("%w: unknown source %q", ErrDeviceSocketUnauthorized, src)
+	}
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	for i := range devices {
+		if normalizeMAC(devices[i].MAC) == mac {
+			return &devices[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no device with MAC %s", ErrDeviceSocketUnauthorized, mac)
+}
+
+// deviceSocket returns the open connection of a device, if any
+func (s *ShellyService) deviceSocket(deviceID uint) *deviceSocket {
+	s.socketMu.Lock()
+	defer s.socketMu.Unlock()
+	return s.sockets[deviceID]
+}
+
+// registerDeviceSocket makes sock the device's connection, closing the one
+// it replaces
+func (s *ShellyService) registerDeviceSocket(sock *deviceSocket) {
+	s.socketMu.Lock()
+	if s.sockets == nil {
+		s.sockets = make(map[uint]*deviceSocket)
+	}
+	previous := s.sockets[sock.deviceID]
+	s.sockets[sock.deviceID] = sock
+	s.socketMu.Unlock()
+	if previous != nil {
+		previous.close()
+	}
+}
+
+func (s *ShellyService) unregisterDeviceSocket(sock *deviceSocket) {
+	s.socketMu.Lock()
+	if s.sockets[sock.deviceID] == sock {
+		delete(s.sockets, sock.deviceID)
+	}
+	s.socketMu.Unlock()
+	sock.close()
+}
+
+// handleSocketFrame processes a frame from a device: responses complete
+// pending calls, status notifications update the pushed status
+func (s *ShellyService) handleSocketFrame(sock *deviceSocket, frame socketFrame) {
+	if frame.ID != nil && frame.Method == "" {
+		sock.resolve(*frame.ID, frame)
+	}
+	switch frame.Method {
+	case "NotifyFullStatus":
+		sock.updateStatus(frame.Params, true)
+	case "NotifyStatus":
+		sock.updateStatus(frame.Params, false)
+	}
+
+	sock.mu.Lock()
+	now := time.Now()
+	sock.lastMessage = now
+	save := now.Sub(sock.lastSaved) >= deviceSocketSeenInterval
+	if save {
+		sock.lastSaved = now
+	}
+	sock.mu.Unlock()
+	if !save {
+		return
+	}
+
+	device, err := s.DB.GetDevice(sock.deviceID)
+	if err != nil {
+		return
+	}
+	device.Status = "online"
+	device.LastSeen = now
+	if err := s.DB.UpdateDevice(device); err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": device.ID,
+			"error":     err.Error(),
+		}).Error("Failed to update device")
+	}
+}
+
+// call sends an RPC request to the device and waits for its response. A
+// device that does not answer in time is likely gone, so the connection is
+// dropped and later commands use HTTP again.
+func (d *deviceSocket) call(ctx context.Context, method string, params map[string]interface{}) (json.RawMessage, error) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil, errDeviceSocketClosed
+	}
+	d.nextID++
+	id := d.nextID
+	ch := make(chan socketFrame, 1)
+	d.pending[id] = ch
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, id)
+		d.mu.Unlock()
+	}()
+
+	req := socketFrame{ID: &id, Src: deviceSocketSource, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s params: %w", method, err)
+		}
+		req.Params = data
+	}
+	d.writeMu.Lock()
+	err := d.conn.WriteJSON(req)
+	d.writeMu.Unlock()
+	if err != nil {
+		d.close()
+		return nil, fmt.Errorf("failed to send %s: %w", method, err)
+	}
+
+	select {
+	case frame, ok := <-ch:
+		if !ok {
+			return nil, errDeviceSocketClosed
+		}
+		if frame.Error != nil {
+			return nil, fmt.Errorf("%s failed: %s (code %d)", method, frame.Error.Message, frame.Error.Code)
+		}
+		return frame.Result, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			d.close()
+		}
+		return nil, fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+// resolve hands a response to the call waiting for it
+func (d *deviceSocket) resolve(id int64, frame socketFrame) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ch, ok := d.pending[id]; ok {
+		delete(d.pending, id)
+		ch <- frame
+	}
+}
+
+// updateStatus applies a pushed status: NotifyFullStatus replaces it,
+// NotifyStatus carries only the changed fields
+func (d *deviceSocket) updateStatus(params json.RawMessage, full bool) {
+	var update map[string]interface{}
+	if err := json.Unmarshal(params, &update); err != nil {
+		return
+	}
+	delete(update, "ts")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if full || d.status == nil {
+		d.status = update
+		return
+	}
+	mergeStatus(d.status, update)
+}
+
+func mergeStatus(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if changes, ok := value.(map[string]interface{}); ok {
+			if current, ok := dst[key].(map[string]interface{}); ok {
+				mergeStatus(current, changes)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// close closes the connection and fails the calls waiting on it
+func (d *deviceSocket) close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	for id, ch := range d.pending {
+		delete(d.pending, id)
+		close(ch)
+	}
+	d.mu.Unlock()
+	_ = d.conn.Close()
+}
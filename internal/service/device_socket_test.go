@@ -0,0 +1,137 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// fakeSocketConn is a device connection fed from in; frames the manager
+// sends arrive on out
+type fakeSocketConn struct {
+	in  chan string
+	out chan socketFrame
+}
+
+func newFakeSocketConn() *fakeSocketConn {
+	return &fakeSocketConn{in: make(chan string, 4), out: make(chan socketFrame, 4)}
+}
+
+func (c *fakeSocketConn) ReadJSON(v interface{}) error {
+	frame, ok := <-c.in
+	if !ok {
+		return io.EOF
+	}
+	return json.Unmarshal([]byte(frame), v)
+}
+
+func (c *fakeSocketConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var frame socketFrame
+	_ = json.Unmarshal(data, &frame)
+	c.out <- frame
+	return nil
+}
+
+func (c *fakeSocketConn) SetReadDeadline(time.Time) error { return nil }
+func (c *fakeSocketConn) Close() error                    { return nil }
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestShellyService_DeviceSocket(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	cfg.DeviceSocket.Enabled = true
+	cfg.DeviceSocket.Token = "secret"
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	if err := service.AuthorizeDeviceSocket("wrong"); !errors.Is(err, ErrDeviceSocketUnauthorized) {
+		t.Errorf("Expected a wrong token to be rejected, got %v", err)
+	}
+	if err := service.AuthorizeDeviceSocket("secret"); err != nil {
+		t.Fatalf("Expected the token to be accepted, got %v", err)
+	}
+
+	device := &database.Device{IP: "192.0.2.10", MAC: "A8:03:2A:B1:E2:C4", Type: "SNSW-001P16EU",
+		Name: "Porch", Status: "offline", Settings: `{"model":"SNSW-001P16EU","gen":2}`}
+	if err := db.AddDevice(device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	// A device that is not in the inventory is turned away
+	stranger := newFakeSocketConn()
+	stranger.in <- `{"src":"shellyplus1-000000000001","method":"NotifyFullStatus","params":{}}`
+	if err := service.ServeDeviceSocket(stranger, "192.0.2.99"); !errors.Is(err, ErrDeviceSocketUnauthorized) {
+		t.Errorf("Expected an unknown device to be rejected, got %v", err)
+	}
+
+	conn := newFakeSocketConn()
+	done := make(chan error, 1)
+	go func() { done <- service.ServeDeviceSocket(conn, "192.0.2.99") }()
+	conn.in <- `{"src":"shellyplus1pm-a8032ab1e2c4","dst":"shelly-manager","method":"NotifyFullStatus",
+		"params":{"ts":1700000000,"switch:0":{"id":0,"output":false,"apower":0,"aenergy":{"total":12.5}}}}`
+	conn.in <- `{"src":"shellyplus1pm-a8032ab1e2c4","method":"NotifyStatus","params":{"ts":1700000010,"switch:0":{"output":true}}}`
+
+	var status *DeviceSocketStatus
+	waitFor(t, "pushed status", func() bool {
+		status, _ = service.GetDeviceSocketStatus(device.ID)
+		sw, _ := status.Status["switch:0"].(map[string]interface{})
+		return sw["output"] == true
+	})
+	if !status.Connected || status.Source != "shellyplus1pm-a8032ab1e2c4" {
+		t.Errorf("Expected the device to be connected, got %+v", status)
+	}
+	if sw := status.Status["switch:0"].(map[string]interface{}); sw["aenergy"] == nil {
+		t.Errorf("Expected NotifyStatus to keep unchanged fields, got %v", sw)
+	}
+	if stored, _ := db.GetDevice(device.ID); stored.Status != "online" {
+		t.Errorf("Expected pushed status to mark the device online, got %s", stored.Status)
+	}
+
+	// Control commands go over the connection
+	result := make(chan error, 1)
+	go func() {
+		result <- service.ControlDevice(device.ID, "on", map[string]interface{}{"channel": float64(0)})
+	}()
+	var req socketFrame
+	select {
+	case req = <-conn.out:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the command to be sent over the WebSocket")
+	}
+	var params map[string]interface{}
+	_ = json.Unmarshal(req.Params, &params)
+	if req.Method != "Switch.Set" || req.Src != deviceSocketSource || params["on"] != true || req.ID == nil {
+		t.Fatalf("Unexpected request %+v with params %v", req, params)
+	}
+	resp, _ := json.Marshal(socketFrame{ID: req.ID, Src: "shellyplus1pm-a8032ab1e2c4", Result: json.RawMessage(`{"was_on":false}`)})
+	conn.in <- string(resp)
+	if err := <-result; err != nil {
+		t.Errorf("ControlDevice failed: %v", err)
+	}
+
+	close(conn.in)
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean disconnect, got %v", err)
+	}
+	if status, _ := service.GetDeviceSocketStatus(device.ID); status.Connected {
+		t.Error("Expected the device to be disconnected")
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/discovery"
+	"github.com/ginsys/shelly-manager/internal/leases"
+	"github.com/ginsys/shelly-manager/internal/naming"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// DHCP lease candidate states
+const (
+	LeaseCandidateKnown         = "known" // the MAC is in the inventory
+	LeaseCandidateNew           = "new"   // not probed yet
+	LeaseCandidateAdopted       = "adopted"
+	LeaseCandidateHeld          = "held" // recorded as a new device alert
+	LeaseCandidateVetoed        = "vetoed"
+	LeaseCandidateExcluded      = "excluded"
+	LeaseCandidateNotResponding = "not_responding" // no Shelly API at the lease address
+	LeaseCandidateFailed        = "failed"
+)
+
+// ErrNoDHCPRouters is returned when discovery.dhcp_leases lists no routers
+var ErrNoDHCPRouters = errors.New("no DHCP lease routers configured")
+
+// DHCPLeaseCandidate is a lease that looks like a Shelly device
+type DHCPLeaseCandidate struct {
+	leases.Lease
+	MatchedBy string `json:"matched_by"` // hostname or oui
+	Status    string `json:"status"`
+	DeviceID  uint   `json:"device_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DHCPRouterError reports a router whose leases could not be read
+type DHCPRouterError struct {
+	Router string `json:"router"`
+	Error  string `json:"error"`
+}
+
+// DHCPLeaseReport lists the Shelly candidates in the router lease tables
+type DHCPLeaseReport struct {
+	Leases     int                  `json:"leases"` // leases read, Shelly or not
+	Candidates []DHCPLeaseCandidate `json:"candidates"`
+	Errors     []DHCPRouterError    `json:"errors,omitempty"`
+}
+
+// DHCPLeaseCandidates reads the lease tables of the routers in
+// discovery.dhcp_leases and returns the leases of Shelly devices, by MAC
+// vendor prefix or hostname. Routers that cannot be read are reported
+// without failing the others.
+func (s *ShellyService) DHCPLeaseCandidates(ctx context.Context) (*DHCPLeaseReport, error) {
+	var cfg config.DiscoveryDHCPLeases
+	if s.Config != nil {
+		cfg = s.Config.Discovery.DHCPLeases
+	}
+	if len(cfg.Routers) == 0 {
+		return nil, ErrNoDHCPRouters
+	}
+	inventory, err := s.inventoryByMAC()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DHCPLeaseReport{Candidates: []DHCPLeaseCandidate{}}
+	matcher := leases.NewMatcher(cfg.ShellyOUIs)
+	seen := map[string]bool{}
+	for _, router := range cfg.Routers {
+		reader, err := leases.NewReader(router, s.logger)
+		if err == nil {
+			var table []leases.Lease
+			table, err = reader.Leases(ctx)
+			report.Leases += len(table)
+			for _, lease := range table {
+				mac := normalizeMAC(lease.MAC)
+				matched := matcher.Match(lease)
+				if matched == "" || seen[mac] {
+					continue
+				}
+				seen[mac] = true
+				candidate := DHCPLeaseCandidate{Lease: lease, MatchedBy: matched, Status: LeaseCandidateNew}
+				if device, ok := inventory[mac]; ok {
+					candidate.Status = LeaseCandidateKnown
+					candidate.DeviceID = device.ID
+				}
+				report.Candidates = append(report.Candidates, candidate)
+			}
+		}
+		if err != nil {
+			s.logger.WithFields(map[string]any{
+				"router":    router.Name,
+				"error":     err.Error(),
+				"component": "discovery",
+			}).Warn("Failed to read DHCP leases")
+			report.Errors = append(report.Errors, DHCPRouterError{Router: router.Name, Error: err.Error()})
+		}
+	}
+	return report, nil
+}
+
+// ImportDHCPLeases probes the lease address of every candidate not in the
+// inventory and adopts the Shelly devices found as discovery does, holding
+// them as new device alerts with discovery.new_device_alerts. Only the lease
+// addresses are probed, so no subnet is scanned.
+func (s *ShellyService) ImportDHCPLeases(ctx context.Context) (*DHCPLeaseReport, error) {
+	report, err := s.DHCPLeaseCandidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := s.discoveryOptions()
+	if err != nil {
+		return nil, err
+	}
+	timeout := s.discoveryTimeout()
+	limit := s.Config.Discovery.ConcurrentScans
+	if limit <= 0 {
+		limit = 10
+	}
+	ctx = shelly.WithTrafficClass(ctx, shelly.TrafficDiscovery)
+	targets := s.discoveryTargets("")
+
+	// Probe concurrently, adopt in lease order so generated names are stable
+	found := make([]*discoveredDevice, len(report.Candidates))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	for i := range report.Candidates {
+		c := &report.Candidates[i]
+		if c.Status != LeaseCandidateNew {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, c *DHCPLeaseCandidate) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			found[i] = s.probeLease(ctx, c, targets, opts, timeout)
+		}(i, c)
+	}
+	wg.Wait()
+
+	var takenNames naming.NameSet
+	holdNew := s.newDeviceAlertsEnabled()
+	adopted := 0
+	for i, d := range found {
+		if d == nil {
+			continue
+		}
+		c := &report.Candidates[i]
+		device, err := s.adoptDiscovered(ctx, *d, &takenNames, holdNew, NewDeviceSourceDHCP)
+		switch {
+		case err != nil:
+			c.Status, c.Error = LeaseCandidateFailed, err.Error()
+		case device == nil && holdNew:
+			c.Status = LeaseCandidateHeld
+		case device == nil:
+			c.Status = LeaseCandidateVetoed
+		default:
+			c.Status, c.DeviceID = LeaseCandidateAdopted, device.ID
+			adopted++
+		}
+	}
+
+	s.logger.WithFields(map[string]any{
+		"leases":     report.Leases,
+		"candidates": len(report.Candidates),
+		"adopted":    adopted,
+		"component":  "discovery",
+	}).Info("DHCP lease import complete")
+	return report, nil
+}
+
+// probeLease probes a candidate's lease address for the Shelly API, with the
+// exclusions of the discovery network containing it
+func (s *ShellyService) probeLease(ctx context.Context, c *DHCPLeaseCandidate, targets []config.DiscoveryNetwork, opts []discovery.ScannerOption, timeout time.Duration) *discoveredDevice {
+	network := networkContaining(targets, c.IP)
+	var scope config.DiscoveryNetwork
+	if network != nil {
+		scope = *network
+	}
+	exclusions, err := s.networkExclusions(scope)
+	if err != nil {
+		c.Status, c.Error = LeaseCandidateFailed, err.Error()
+		return nil
+	}
+	if rule := exclusions.MatchMAC(c.MAC); rule != "" {
+		c.Status, c.Error = LeaseCandidateExcluded, rule
+		return nil
+	}
+	scanOpts := append(append([]discovery.ScannerOption(nil), opts...), discovery.WithExclusions(exclusions))
+	var hostnames []string
+	if c.Hostname != "" {
+		hostnames = append(hostnames, c.Hostname)
+	}
+	sd, err := discovery.NewScannerWithLogger(timeout, 1, s.logger, scanOpts...).ScanHost(ctx, c.IP, hostnames...)
+	switch {
+	case errors.Is(err, discovery.ErrExcluded):
+		c.Status, c.Error = LeaseCandidateExcluded, err.Error()
+		return nil
+	case err != nil:
+		c.Status, c.Error = LeaseCandidateFailed, err.Error()
+		return nil
+	case sd == nil || sd.MAC == "":
+		c.Status = LeaseCandidateNotResponding
+		return nil
+	}
+	return &discoveredDevice{ShellyDevice: *sd, network: network}
+}
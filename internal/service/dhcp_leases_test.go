@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_ImportDHCPLeases(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/shelly" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"type":"SHSW-1","mac":"E8DB84000061","fw":"v1.14.0"}`))
+	}))
+	defer device.Close()
+	silent := httptest.NewServer(http.NotFoundHandler())
+	defer silent.Close()
+	deviceHost, silentHost := device.URL[len("http://"):], silent.URL[len("http://"):]
+
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `[
+			{"address":%q,"mac-address":"E8:DB:84:00:00:61","host-name":"shelly1-000061","status":"bound","dynamic":"true","expires-after":"10m"},
+			{"address":%q,"mac-address":"11:22:33:00:00:62","host-name":"shellyplug-s-000062","status":"bound","dynamic":"true"},
+			{"address":"10.0.0.63","mac-address":"E8:DB:84:00:00:63","status":"bound","dynamic":"false"},
+			{"address":"10.0.0.64","mac-address":"11:22:33:00:00:64","host-name":"laptop","status":"bound","dynamic":"true"}]`,
+			deviceHost, silentHost)
+	}))
+	defer router.Close()
+
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	service := NewService(db, cfg)
+	defer service.Stop()
+	ctx := context.Background()
+
+	if _, err := service.DHCPLeaseCandidates(ctx); !errors.Is(err, ErrNoDHCPRouters) {
+		t.Fatalf("Expected no routers refused, got %v", err)
+	}
+
+	known := &database.Device{IP: "10.0.0.63", MAC: "E8:DB:84:00:00:63", Type: "SHSW-1", Name: "Known"}
+	if err := db.AddDevice(known); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	cfg.Discovery.DHCPLeases.Routers = []config.DHCPLeaseRouter{
+		{Name: "mt", Type: config.DHCPRouterMikroTik, URL: router.URL, Username: "admin"},
+		{Name: "broken", Type: "pfsense", URL: router.URL},
+	}
+
+	report, err := service.DHCPLeaseCandidates(ctx)
+	if err != nil {
+		t.Fatalf("DHCPLeaseCandidates failed: %v", err)
+	}
+	if report.Leases != 4 || len(report.Candidates) != 3 || len(report.Errors) != 1 || report.Errors[0].Router != "broken" {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	if c := report.Candidates[2]; c.Status != LeaseCandidateKnown || c.DeviceID != known.ID || c.MatchedBy != "oui" {
+		t.Errorf("Expected the inventory device known, got %+v", c)
+	}
+
+	report, err = service.ImportDHCPLeases(ctx)
+	if err != nil {
+		t.Fatalf("ImportDHCPLeases failed: %v", err)
+	}
+	adopted, quiet := report.Candidates[0], report.Candidates[1]
+	if adopted.Status != LeaseCandidateAdopted || adopted.DeviceID == 0 || adopted.MatchedBy != "hostname" {
+		t.Fatalf("Expected the Shelly lease adopted, got %+v", adopted)
+	}
+	if quiet.Status != LeaseCandidateNotResponding {
+		t.Errorf("Expected the silent host not responding, got %+v", quiet)
+	}
+	stored, err := db.GetDevice(adopted.DeviceID)
+	if err != nil || stored.IP != deviceHost || stored.Firmware != "v1.14.0" {
+		t.Errorf("Unexpected adopted device: %+v (%v)", stored, err)
+	}
+
+	// Adopted devices are known on the next import
+	report, err = service.ImportDHCPLeases(ctx)
+	if err != nil || report.Candidates[0].Status != LeaseCandidateKnown {
+		t.Errorf("Expected the adopted device known, got %+v (%v)", report, err)
+	}
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/discovery"
+)
+
+var (
+	// ErrInvalidDiscoveryNetwork is returned for discovery networks that
+	// fail validation
+	ErrInvalidDiscoveryNetwork = errors.New("invalid discovery network")
+	// ErrDiscoveryNetworkNotFound is returned for networks not configured
+	ErrDiscoveryNetworkNotFound = errors.New("discovery network not found")
+	// ErrDiscoveryNetworkExists is returned when adding a network already
+	// configured
+	ErrDiscoveryNetworkExists = errors.New("discovery network already configured")
+)
+
+// discoveryScheduleTick is how often scheduled networks are checked for a
+// due scan
+const discoveryScheduleTick = time.Minute
+
+// discoveredDevice is a device found by discovery with the network it was
+// found on, nil when it is on none of the scanned networks
+type discoveredDevice struct {
+	discovery.ShellyDevice
+	network *config.DiscoveryNetwork
+}
+
+// DiscoveryNetworks returns the networks discovery scans: discovery.networks,
+// or the list set at runtime
+func (s *ShellyService) DiscoveryNetworks() []config.DiscoveryNetwork {
+	s.discoveryNetMu.Lock()
+	defer s.discoveryNetMu.Unlock()
+	return s.discoveryNetworksLocked()
+}
+
+func (s *ShellyService) discoveryNetworksLocked() []config.DiscoveryNetwork {
+	if s.discoveryNetworksSet {
+		return append([]config.DiscoveryNetwork(nil), s.discoveryNetworks...)
+	}
+	if s.Config == nil {
+		return nil
+	}
+	return append([]config.DiscoveryNetwork(nil), s.Config.Discovery.Networks...)
+}
+
+// SetDiscoveryNetworks replaces the networks discovery scans until the next
+// restart
+func (s *ShellyService) SetDiscoveryNetworks(networks []config.DiscoveryNetwork) error {
+	if err := s.validateDiscoveryNetworks(networks); err != nil {
+		return err
+	}
+	s.discoveryNetMu.Lock()
+	defer s.discoveryNetMu.Unlock()
+	s.discoveryNetworks = append([]config.DiscoveryNetwork(nil), networks...)
+	s.discoveryNetworksSet = true
+	s.logger.WithFields(map[string]any{
+		"networks":  config.DiscoveryCIDRs(networks),
+		"component": "discovery",
+	}).Info("Discovery networks replaced")
+	return nil
+}
+
+// AddDiscoveryNetwork adds a network to the ones discovery scans
+func (s *ShellyService) AddDiscoveryNetwork(network config.DiscoveryNetwork) error {
+	s.discoveryNetMu.Lock()
+	networks := s.discoveryNetworksLocked()
+	s.discoveryNetMu.Unlock()
+	if findDiscoveryNetwork(networks, network.CIDR) >= 0 {
+		return fmt.Errorf("%w: %s", ErrDiscoveryNetworkExists, network.CIDR)
+	}
+	return s.SetDiscoveryNetworks(append(networks, network))
+}
+
+// UpdateDiscoveryNetwork replaces the options of the network cidr; the
+// network may be given a new CIDR
+func (s *ShellyService) UpdateDiscoveryNetwork(cidr string, network config.DiscoveryNetwork) error {
+	s.discoveryNetMu.Lock()
+	networks := s.discoveryNetworksLocked()
+	s.discoveryNetMu.Unlock()
+	i := findDiscoveryNetwork(networks, cidr)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrDiscoveryNetworkNotFound, cidr)
+	}
+	networks[i] = network
+	return s.SetDiscoveryNetworks(networks)
+}
+
+// RemoveDiscoveryNetwork stops discovery scanning the network cidr
+func (s *ShellyService) RemoveDiscoveryNetwork(cidr string) error {
+	s.discoveryNetMu.Lock()
+	networks := s.discoveryNetworksLocked()
+	s.discoveryNetMu.Unlock()
+	i := findDiscoveryNetwork(networks, cidr)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrDiscoveryNetworkNotFound, cidr)
+	}
+	return s.SetDiscoveryNetworks(append(networks[:i], networks[i+1:]...))
+}
+
+// validateDiscoveryNetworks checks the networks and that their exclusions
+// parse and credentials profiles exist
+func (s *ShellyService) validateDiscoveryNetworks(networks []config.DiscoveryNetwork) error {
+	if err := config.ValidateDiscoveryNetworks(networks); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDiscoveryNetwork, err)
+	}
+	for _, n := range networks {
+		if _, err := s.networkExclusions(n); err != nil {
+			return fmt.Errorf("%w: network %s: %v", ErrInvalidDiscoveryNetwork, n.CIDR, err)
+		}
+		if n.CredentialsProfile != "" {
+			if _, err := s.GetProvisioningProfile(n.CredentialsProfile); err != nil {
+				return fmt.Errorf("%w: network %s: %v", ErrInvalidDiscoveryNetwork, n.CIDR, err)
+			}
+		}
+	}
+	return nil
+}
+
+// findDiscoveryNetwork returns the index of the network cidr, or -1
+func findDiscoveryNetwork(networks []config.DiscoveryNetwork, cidr string) int {
+	key := config.DiscoveryNetworkKey(cidr)
+	for i, n := range networks {
+		if config.DiscoveryNetworkKey(n.CIDR) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// discoveryTargets returns the networks to scan for a discovery request: the
+// enabled networks for "auto", otherwise the given network with its
+// configured options, if any
+func (s *ShellyService) discoveryTargets(network string) []config.DiscoveryNetwork {
+	networks := s.DiscoveryNetworks()
+	if network != "" && network != "auto" {
+		if i := findDiscoveryNetwork(networks, network); i >= 0 {
+			target := networks[i]
+			target.CIDR = network
+			return []config.DiscoveryNetwork{target}
+		}
+		return []config.DiscoveryNetwork{{CIDR: network}}
+	}
+	var targets []config.DiscoveryNetwork
+	for _, n := range networks {
+		if !n.Disabled {
+			targets = append(targets, n)
+		}
+	}
+	return targets
+}
+
+// networkExclusions combines discovery.exclude with a network's own
+// exclusions
+func (s *ShellyService) networkExclusions(n config.DiscoveryNetwork) (*discovery.Exclusions, error) {
+	var exclude config.DiscoveryExclude
+	if s.Config != nil {
+		exclude = s.Config.Discovery.Exclude
+	}
+	return discovery.NewExclusions(
+		append(append([]string(nil), exclude.Networks...), n.Exclude.Networks...),
+		append(append([]string(nil), exclude.MACPrefixes...), n.Exclude.MACPrefixes...),
+		append(append([]string(nil), exclude.Hostnames...), n.Exclude.Hostnames...),
+	)
+}
+
+// scanDiscoveryNetworks probes the networks enabling the HTTP scanner and
+// listens for mDNS announcements when any network enables it, or when no
+// network is given. Devices announced on a network that does not enable
+// mDNS, or excludes them, are dropped.
+func (s *ShellyService) scanDiscoveryNetworks(ctx context.Context, targets []config.DiscoveryNetwork, timeout time.Duration) ([]discoveredDevice, error) {
+	opts, err := s.discoveryOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []discoveredDevice
+	seen := make(map[string]bool)
+	useMDNS := len(targets) == 0
+	for i := range targets {
+		n := &targets[i]
+		if n.UsesScanner(config.DiscoveryScannerMDNS) {
+			useMDNS = true
+		}
+		if !n.UsesScanner(config.DiscoveryScannerHTTP) {
+			continue
+		}
+		scanOpts := opts
+		if len(n.Exclude.Networks)+len(n.Exclude.MACPrefixes)+len(n.Exclude.Hostnames) > 0 {
+			exclusions, err := s.networkExclusions(*n)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exclusions for network %s: %w", n.CIDR, err)
+			}
+			scanOpts = append(append([]discovery.ScannerOption(nil), opts...), discovery.WithExclusions(exclusions))
+		}
+		devices, err := discovery.NewScanner(timeout, 50, scanOpts...).ScanNetwork(ctx, n.CIDR)
+		if err != nil {
+			s.logger.WithFields(map[string]any{
+				"network":   n.CIDR,
+				"error":     err.Error(),
+				"component": "discovery",
+			}).Warn("Failed to scan network")
+			continue
+		}
+		for _, d := range devices {
+			if !seen[d.MAC] {
+				seen[d.MAC] = true
+				found = append(found, discoveredDevice{ShellyDevice: d, network: n})
+			}
+		}
+	}
+
+	if useMDNS {
+		devices, err := discovery.NewMDNSScanner(timeout, opts...).DiscoverDevices(ctx)
+		if err != nil {
+			s.logger.WithFields(map[string]any{
+				"error":     err.Error(),
+				"component": "discovery",
+			}).Warn("mDNS discovery failed")
+		}
+		for _, d := range devices {
+			if seen[d.MAC] {
+				continue
+			}
+			n := networkContaining(targets, d.IP)
+			if n != nil {
+				if !n.UsesScanner(config.DiscoveryScannerMDNS) {
+					continue
+				}
+				if exclusions, err := s.networkExclusions(*n); err == nil && (exclusions.MatchIP(d.IP) != "" || exclusions.MatchMAC(d.MAC) != "") {
+					continue
+				}
+			}
+			seen[d.MAC] = true
+			found = append(found, discoveredDevice{ShellyDevice: d, network: n})
+		}
+	}
+	return found, nil
+}
+
+// networkContaining returns the target network containing ip, or nil
+func networkContaining(targets []config.DiscoveryNetwork, ip string) *config.DiscoveryNetwork {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+	for i := range targets {
+		if _, ipnet, err := net.ParseCIDR(targets[i].CIDR); err == nil && ipnet.Contains(addr) {
+			return &targets[i]
+		}
+	}
+	return nil
+}
+
+// applyDiscoveryNetwork stores the network's credentials for a device
+// requiring authentication that has none, and tags it with the network's
+// site
+func (s *ShellyService) applyDiscoveryNetwork(deviceID uint, n *config.DiscoveryNetwork, authEnabled bool, settings map[string]interface{}) {
+	if n == nil {
+		return
+	}
+	if n.CredentialsProfile != "" && authEnabled && settings["auth_user"] == "" {
+		profile, err := s.GetProvisioningProfile(n.CredentialsProfile)
+		if err != nil {
+			s.logger.WithFields(map[string]any{
+				"device_id": deviceID,
+				"network":   n.CIDR,
+				"error":     err.Error(),
+				"component": "discovery",
+			}).Warn("Failed to load the network's credentials profile")
+		} else if profile.AuthUser != "" {
+			settings["auth_user"] = profile.AuthUser
+			settings["auth_pass"] = profile.AuthPassword
+		}
+	}
+	if n.Site != "" {
+		if err := s.tagDevice(deviceID, "site:"+n.Site); err != nil {
+			s.logger.WithFields(map[string]any{
+				"device_id": deviceID,
+				"error":     err.Error(),
+				"component": "discovery",
+			}).Warn("Failed to tag device with its network's site")
+		}
+	}
+}
+
+// StartDiscoverySchedule rescans networks with an interval when they are
+// due. Networks without one are only scanned on request.
+func (s *ShellyService) StartDiscoverySchedule() {
+	if s.Config == nil || !s.Config.Discovery.Enabled {
+		return
+	}
+
+	go func() {
+		ticker := s.clock.NewTicker(discoveryScheduleTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C():
+			}
+			if s.leader == nil || s.leader() {
+				s.runDueDiscovery(s.clock.Now())
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]any{
+		"component": "discovery",
+	}).Info("Started scheduled network discovery")
+}
+
+// runDueDiscovery scans the enabled networks whose interval has passed since
+// their last scan and returns their CIDRs
+func (s *ShellyService) runDueDiscovery(now time.Time) []string {
+	var due []string
+	s.discoveryNetMu.Lock()
+	if s.discoveryScannedAt == nil {
+		s.discoveryScannedAt = make(map[string]time.Time)
+	}
+	for _, n := range s.discoveryNetworksLocked() {
+		if n.Disabled || n.Interval <= 0 {
+			continue
+		}
+		key := config.DiscoveryNetworkKey(n.CIDR)
+		if last, ok := s.discoveryScannedAt[key]; ok && now.Sub(last) < time.Duration(n.Interval)*time.Second {
+			continue
+		}
+		s.discoveryScannedAt[key] = now
+		due = append(due, n.CIDR)
+	}
+	s.discoveryNetMu.Unlock()
+
+	for _, cidr := range due {
+		if s.ctx.Err() != nil {
+			break
+		}
+		devices, err := s.DiscoverDevices(cidr)
+		if err != nil {
+			s.logger.WithFields(map[string]any{
+				"network":   cidr,
+				"error":     err.Error(),
+				"component": "discovery",
+			}).Warn("Scheduled discovery failed")
+			continue
+		}
+		s.logger.WithFields(map[string]any{
+			"network":       cidr,
+			"devices_found": len(devices),
+			"component":     "discovery",
+		}).Info("Scheduled discovery complete")
+	}
+	return due
+}
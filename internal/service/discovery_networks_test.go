@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_DiscoveryNetworks(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	if networks := service.DiscoveryNetworks(); len(networks) != 1 || networks[0].CIDR != "192.168.1.0/24" {
+		t.Fatalf("Expected the configured networks, got %+v", networks)
+	}
+
+	profile := &database.ProvisioningProfile{Name: "branch", SSID: "IoT", EnableAuth: true, AuthUser: "admin", AuthPassword: "device-secret"}
+	if err := service.SaveProvisioningProfile(profile); err != nil {
+		t.Fatalf("SaveProvisioningProfile failed: %v", err)
+	}
+	branch := config.DiscoveryNetwork{CIDR: "10.20.0.0/24", Interval: 600, Scanners: []string{"http"}, CredentialsProfile: "branch", Site: "branch"}
+	if err := service.AddDiscoveryNetwork(branch); err != nil {
+		t.Fatalf("AddDiscoveryNetwork failed: %v", err)
+	}
+	if err := service.AddDiscoveryNetwork(config.DiscoveryNetwork{CIDR: "10.20.0.9/24"}); !errors.Is(err, ErrDiscoveryNetworkExists) {
+		t.Errorf("Expected the same network refused, got %v", err)
+	}
+	for _, bad := range []config.DiscoveryNetwork{
+		{CIDR: "10.30.0.0"},
+		{CIDR: "10.30.0.0/24", Scanners: []string{"arp"}},
+		{CIDR: "10.30.0.0/24", CredentialsProfile: "missing"},
+		{CIDR: "10.30.0.0/24", Exclude: config.DiscoveryExclude{Networks: []string{"not-an-address"}}},
+	} {
+		if err := service.AddDiscoveryNetwork(bad); !errors.Is(err, ErrInvalidDiscoveryNetwork) {
+			t.Errorf("Expected %+v refused, got %v", bad, err)
+		}
+	}
+
+	// The runtime list replaces the configured one
+	cfg.Discovery.Networks = nil
+	if networks := service.DiscoveryNetworks(); len(networks) != 2 {
+		t.Fatalf("Expected both networks, got %+v", networks)
+	}
+	if err := service.UpdateDiscoveryNetwork("192.168.1.0/24", config.DiscoveryNetwork{CIDR: "192.168.1.0/24", Disabled: true}); err != nil {
+		t.Fatalf("UpdateDiscoveryNetwork failed: %v", err)
+	}
+	targets := service.discoveryTargets("auto")
+	if len(targets) != 1 || targets[0].CIDR != "10.20.0.0/24" {
+		t.Errorf("Expected only the enabled network scanned, got %+v", targets)
+	}
+	if targets := service.discoveryTargets("10.20.0.0/24"); targets[0].Site != "branch" {
+		t.Errorf("Expected a requested network scanned with its options, got %+v", targets)
+	}
+	if err := service.RemoveDiscoveryNetwork("172.16.0.0/12"); !errors.Is(err, ErrDiscoveryNetworkNotFound) {
+		t.Errorf("Expected an unknown network reported, got %v", err)
+	}
+	if err := service.RemoveDiscoveryNetwork("192.168.1.0/24"); err != nil {
+		t.Fatalf("RemoveDiscoveryNetwork failed: %v", err)
+	}
+
+	// Devices found on the network get its credentials and site
+	device := &database.Device{IP: "10.20.0.5", MAC: "AABBCCDDEE50", Type: "SHSW-1", Name: "Shed"}
+	if err := db.AddDevice(device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	settings := map[string]interface{}{"auth_user": "", "auth_pass": ""}
+	service.applyDiscoveryNetwork(device.ID, &targets[0], true, settings)
+	if settings["auth_user"] != "admin" || settings["auth_pass"] != "device-secret" {
+		t.Errorf("Expected the profile's credentials stored, got %v", settings)
+	}
+	var tags []database.DeviceTag
+	if err := db.GetDB().Where("device_id = ?", device.ID).Find(&tags).Error; err != nil || len(tags) != 1 || tags[0].Tag != "site:branch" {
+		t.Errorf("Expected the device tagged with its site, got %+v (%v)", tags, err)
+	}
+	settings = map[string]interface{}{"auth_user": "owner", "auth_pass": "kept"}
+	service.applyDiscoveryNetwork(device.ID, &targets[0], true, settings)
+	if settings["auth_user"] != "owner" {
+		t.Errorf("Expected stored credentials kept, got %v", settings)
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+)
+
+// ErrInvalidRemediationPlan wraps drift remediation dry-run validation errors
+var ErrInvalidRemediationPlan = errors.New("invalid drift remediation plan")
+
+// Drift remediation policies
+const (
+	RemediationExport = "export" // write the stored configuration to the device
+	RemediationImport = "import" // accept the device configuration into the database
+)
+
+// Risk flags of a planned remediation
+const (
+	RemediationRiskNetwork     = "network"     // writes wifi or ethernet settings; the device may drop off the network
+	RemediationRiskAuth        = "auth"        // writes login settings; the manager may be locked out
+	RemediationRiskIntegration = "integration" // writes mqtt, cloud or coiot settings; status reporting may stop
+	RemediationRiskUnreachable = "unreachable" // the device misses requests; remediation may fail
+	RemediationRiskMaintenance = "maintenance" // the device is in a maintenance window
+)
+
+const (
+	// remediationRequests is how many device requests remediating a device
+	// takes: the connection check, GetInfo and SetConfig or GetConfig
+	remediationRequests = 3
+	// remediationNetworkSettle is how long a device takes to rejoin the
+	// network after its network settings are written
+	remediationNetworkSettle = 30 * time.Second
+)
+
+// DriftRemediationRequest selects the drifted devices to plan for and the
+// policy to remediate them with
+type DriftRemediationRequest struct {
+	Policy    string `json:"policy"`               // export or import
+	DeviceIDs []uint `json:"device_ids,omitempty"` // restrict to these devices
+	Severity  string `json:"severity,omitempty"`   // leave out less severe drift
+}
+
+// DriftRemediationField is one value remediation would change
+type DriftRemediationField struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"` // value in the target before remediation
+	New  interface{} `json:"new"`
+	Risk string      `json:"risk,omitempty"`
+}
+
+// DriftRemediationDevice is the projected remediation of one device
+type DriftRemediationDevice struct {
+	DeviceID         uint                    `json:"device_id"`
+	Name             string                  `json:"name"`
+	IP               string                  `json:"ip"`
+	Severity         string                  `json:"severity"`
+	Score            int                     `json:"score"`
+	Target           string                  `json:"target"` // device or database
+	Fields           []DriftRemediationField `json:"fields"`
+	Untouched        int                     `json:"untouched"` // device-only values an export leaves as they are
+	Link             string                  `json:"link"`
+	EstimatedSeconds float64                 `json:"estimated_seconds"`
+	Risks            []string                `json:"risks"`
+}
+
+// DriftRemediationPlan is the projected outcome of remediating the drift
+// queue under a policy. It is computed without contacting any device.
+type DriftRemediationPlan struct {
+	Policy           string                   `json:"policy"`
+	DryRun           bool                     `json:"dry_run"`
+	Total            int                      `json:"total"`  // devices remediated
+	Fields           int                      `json:"fields"` // values changed across them
+	EstimatedSeconds float64                  `json:"estimated_seconds"`
+	Risks            map[string]int           `json:"risks"` // devices per risk flag
+	Devices          []DriftRemediationDevice `json:"devices"`
+	GeneratedAt      time.Time                `json:"generated_at"`
+}
+
+// PlanDriftRemediation computes which fields remediating the queued drift
+// would write to which devices, or import into the database, how long it
+// would take and what could go wrong. Devices are remediated one after the
+// other, so the estimate is the sum of the per-device estimates, each from
+// the device's average latency over the last day.
+func (s *ShellyService) PlanDriftRemediation(req DriftRemediationRequest) (*DriftRemediationPlan, error) {
+	if req.Policy != RemediationExport && req.Policy != RemediationImport {
+		return nil, fmt.Errorf("%w: policy must be export or import", ErrInvalidRemediationPlan)
+	}
+	queue, err := s.GetDriftQueue(req.Severity, 0)
+	if err != nil {
+		if errors.Is(err, configuration.ErrInvalidDriftQuery) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRemediationPlan, err)
+		}
+		return nil, err
+	}
+	selected := make(map[uint]bool, len(req.DeviceIDs))
+	for _, id := range req.DeviceIDs {
+		selected[id] = true
+	}
+
+	avgMs := map[uint]float64{}
+	summaries, err := s.LatencySummaries(24)
+	if err != nil {
+		return nil, err
+	}
+	for _, sum := range summaries {
+		if sum.AvgMs > 0 {
+			avgMs[sum.DeviceID] = sum.AvgMs
+		}
+	}
+	maintenance := s.maintenanceSet()
+
+	plan := &DriftRemediationPlan{
+		Policy:      req.Policy,
+		DryRun:      true,
+		Risks:       map[string]int{},
+		Devices:     []DriftRemediationDevice{},
+		GeneratedAt: s.clock.Now(),
+	}
+	for _, item := range queue {
+		if len(selected) > 0 && !selected[item.DeviceID] {
+			continue
+		}
+		device, err := s.DB.GetDevice(item.DeviceID)
+		if err != nil {
+			continue
+		}
+		var differences []configuration.ConfigDifference
+		if err := json.Unmarshal(item.Differences, &differences); err != nil {
+			return nil, fmt.Errorf("failed to decode drift of device %d: %w", item.DeviceID, err)
+		}
+
+		link, _ := s.DeviceLink(device.ID)
+		projected := DriftRemediationDevice{
+			DeviceID: device.ID,
+			Name:     device.Name,
+			IP:       device.IP,
+			Severity: item.Severity,
+			Score:    item.Score,
+			Target:   "database",
+			Fields:   []DriftRemediationField{},
+			Link:     link,
+			Risks:    []string{},
+		}
+		risks := map[string]bool{}
+		for _, d := range differences {
+			if req.Policy == RemediationImport {
+				projected.Fields = append(projected.Fields, DriftRemediationField{Path: d.Path, Old: d.Expected, New: d.Actual})
+				continue
+			}
+			// An export writes the stored configuration; values only on
+			// the device have nothing to be written back with
+			if d.Type == "added" {
+				projected.Untouched++
+				continue
+			}
+			field := DriftRemediationField{Path: d.Path, Old: d.Actual, New: d.Expected, Risk: remediationPathRisk(d.Path)}
+			if field.Risk != "" {
+				risks[field.Risk] = true
+			}
+			projected.Fields = append(projected.Fields, field)
+		}
+		sort.Slice(projected.Fields, func(i, j int) bool { return projected.Fields[i].Path < projected.Fields[j].Path })
+
+		settings := s.deviceClientSettings(device)
+		timeout := settings.ImportTimeoutDuration()
+		if req.Policy == RemediationExport {
+			projected.Target = "device"
+			timeout = settings.ExportTimeoutDuration()
+			if link == LinkLossy || link == LinkDead {
+				risks[RemediationRiskUnreachable] = true
+			}
+		}
+		if maintenance[device.ID] {
+			risks[RemediationRiskMaintenance] = true
+		}
+
+		latency := avgMs[device.ID]
+		if latency == 0 {
+			latency = float64(s.latencySlowMs())
+		}
+		estimate := time.Duration(remediationRequests * latency * float64(time.Millisecond))
+		if estimate > timeout {
+			estimate = timeout
+		}
+		if risks[RemediationRiskNetwork] {
+			estimate += remediationNetworkSettle
+		}
+		projected.EstimatedSeconds = roundTenth(estimate.Seconds())
+
+		for risk := range risks {
+			projected.Risks = append(projected.Risks, risk)
+			plan.Risks[risk]++
+		}
+		sort.Strings(projected.Risks)
+
+		plan.Fields += len(projected.Fields)
+		plan.EstimatedSeconds += projected.EstimatedSeconds
+		plan.Devices = append(plan.Devices, projected)
+	}
+	plan.Total = len(plan.Devices)
+	plan.EstimatedSeconds = roundTenth(plan.EstimatedSeconds)
+
+	s.logger.WithFields(map[string]any{
+		"policy":    req.Policy,
+		"devices":   plan.Total,
+		"fields":    plan.Fields,
+		"component": "drift_remediation",
+	}).Info("Drift remediation dry run")
+	return plan, nil
+}
+
+// remediationPathRisk returns the risk of writing the value at a
+// configuration path, or "" for none
+func remediationPathRisk(path string) string {
+	top := strings.ToLower(strings.SplitN(path, ".", 2)[0])
+	switch {
+	case strings.HasPrefix(top, "wifi"), strings.HasPrefix(top, "eth"), top == "ap_roaming":
+		return RemediationRiskNetwork
+	case top == "login", top == "auth":
+		return RemediationRiskAuth
+	case top == "mqtt", top == "cloud", top == "coiot", top == "ws":
+		return RemediationRiskIntegration
+	default:
+		return ""
+	}
+}
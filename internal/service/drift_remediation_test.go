@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_PlanDriftRemediation(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	drift := []struct {
+		score       int
+		severity    string
+		differences string
+	}{
+		{40, "medium", `[{"path":"mqtt.server","expected":"broker.lan:1883","actual":"10.0.0.9:1883","type":"modified"},
+			{"path":"name","expected":"Kitchen","actual":"shelly1-01","type":"modified"}]`},
+		{90, "critical", `[{"path":"wifi_sta.ssid","expected":"iot","actual":"guest","type":"modified"},
+			{"path":"debug_enable","expected":null,"actual":true,"type":"added"}]`},
+	}
+	ids := make([]uint, len(drift))
+	for i, d := range drift {
+		device := &database.Device{IP: "192.168.1." + string(rune('1'+i)), MAC: "68C63A00030" + string(rune('1'+i)), Type: "SHSW-1", Name: "Switch", Settings: `{"gen":1}`}
+		if err := db.AddDevice(device); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		ids[i] = device.ID
+		if err := db.GetDB().Create(&configuration.DeviceConfig{DeviceID: device.ID, Config: json.RawMessage(`{}`), SyncStatus: "drift"}).Error; err != nil {
+			t.Fatalf("Failed to store device config: %v", err)
+		}
+		item := configuration.DriftQueueItem{DeviceID: device.ID, Score: d.score, Severity: d.severity, Differences: json.RawMessage(d.differences), DetectedAt: time.Now()}
+		if err := db.GetDB().Create(&item).Error; err != nil {
+			t.Fatalf("Failed to queue drift: %v", err)
+		}
+	}
+	hour := time.Now().Truncate(time.Hour)
+	if err := db.GetDB().Create(&database.DeviceLatency{DeviceID: ids[0], Hour: hour, Samples: 4, TotalMs: 800, MaxMs: 300}).Error; err != nil {
+		t.Fatalf("Failed to store latency: %v", err)
+	}
+	if _, err := service.SetMaintenance(MaintenanceRequest{DeviceIDs: []uint{ids[1]}}); err != nil {
+		t.Fatalf("SetMaintenance failed: %v", err)
+	}
+
+	if _, err := service.PlanDriftRemediation(DriftRemediationRequest{Policy: "overwrite"}); !errors.Is(err, ErrInvalidRemediationPlan) {
+		t.Errorf("Expected an unknown policy refused, got %v", err)
+	}
+
+	plan, err := service.PlanDriftRemediation(DriftRemediationRequest{Policy: RemediationExport})
+	if err != nil {
+		t.Fatalf("PlanDriftRemediation failed: %v", err)
+	}
+	if !plan.DryRun || plan.Total != 2 || plan.Fields != 3 || plan.Devices[0].DeviceID != ids[1] {
+		t.Fatalf("Expected both devices planned, most severe first, got %+v", plan)
+	}
+	critical := plan.Devices[0]
+	if critical.Target != "device" || len(critical.Fields) != 1 || critical.Untouched != 1 {
+		t.Fatalf("Expected only the stored value written, got %+v", critical)
+	}
+	if f := critical.Fields[0]; f.Path != "wifi_sta.ssid" || f.Old != "guest" || f.New != "iot" || f.Risk != RemediationRiskNetwork {
+		t.Errorf("Expected the ssid written back as a network change, got %+v", f)
+	}
+	if len(critical.Risks) != 2 || critical.Risks[0] != RemediationRiskMaintenance || critical.Risks[1] != RemediationRiskNetwork {
+		t.Errorf("Expected maintenance and network risks, got %v", critical.Risks)
+	}
+	// No latency recorded: the slow threshold per request plus rejoining
+	if critical.EstimatedSeconds != 33 {
+		t.Errorf("Expected 33 seconds for the critical device, got %v", critical.EstimatedSeconds)
+	}
+	medium := plan.Devices[1]
+	if len(medium.Fields) != 2 || medium.Fields[0].Path != "mqtt.server" || medium.Fields[0].Risk != RemediationRiskIntegration || medium.EstimatedSeconds != 0.6 {
+		t.Errorf("Expected both values written in 0.6 seconds, got %+v", medium)
+	}
+	if plan.EstimatedSeconds != 33.6 || plan.Risks[RemediationRiskNetwork] != 1 || plan.Risks[RemediationRiskIntegration] != 1 {
+		t.Errorf("Expected the totals summed, got %v seconds, risks %v", plan.EstimatedSeconds, plan.Risks)
+	}
+
+	plan, err = service.PlanDriftRemediation(DriftRemediationRequest{Policy: RemediationImport, DeviceIDs: []uint{ids[1]}})
+	if err != nil {
+		t.Fatalf("PlanDriftRemediation failed: %v", err)
+	}
+	if plan.Total != 1 || plan.Devices[0].Target != "database" || len(plan.Devices[0].Fields) != 2 || plan.Risks[RemediationRiskNetwork] != 0 {
+		t.Fatalf("Expected every device value imported without network risk, got %+v", plan)
+	}
+	if f := plan.Devices[0].Fields[0]; f.Path != "debug_enable" || f.Old != nil || f.New != true {
+		t.Errorf("Expected the device-only value imported, got %+v", f)
+	}
+
+	if _, err := service.PlanDriftRemediation(DriftRemediationRequest{Policy: RemediationImport, Severity: "severe"}); !errors.Is(err, ErrInvalidRemediationPlan) {
+		t.Errorf("Expected an unknown severity refused, got %v", err)
+	}
+	var stored configuration.DeviceConfig
+	if err := db.GetDB().Where("device_id = ?", ids[0]).First(&stored).Error; err != nil || stored.SyncStatus != "drift" {
+		t.Errorf("Expected the dry run to change nothing, got %s, %v", stored.SyncStatus, err)
+	}
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+const (
+	// energyResetTolerance is how far, in Wh, a device counter may go back
+	// before it is taken as a reset rather than rounding between readings
+	energyResetTolerance = 1.0
+	// defaultEnergyHourlyDays is how long hourly energy rows are kept before
+	// they are rolled up into daily rows
+	defaultEnergyHourlyDays = 90
+)
+
+// DeviceEnergyTotals is the manager-side energy consumption of a device
+type DeviceEnergyTotals struct {
+	DeviceID   uint                     `json:"device_id"`
+	Cumulative float64                  `json:"cumulative"` // Wh, all channels
+	Counters   []database.EnergyCounter `json:"counters"`
+}
+
+// energyReadings returns the energy counters in a status read by channel.
+// Meter readings are used when present, otherwise those of the switches.
+func energyReadings(status *shelly.DeviceStatus) map[int]float64 {
+	readings := map[int]float64{}
+	if len(status.Meters) > 0 {
+		for _, m := range status.Meters {
+			if m.Total > 0 {
+				readings[m.ID] = m.Total
+			}
+		}
+		return readings
+	}
+	for _, sw := range status.Switches {
+		if sw.Energy > 0 {
+			readings[sw.ID] = sw.Energy
+		}
+	}
+	return readings
+}
+
+// recordEnergy adds the energy counters in a status read to the manager-side
+// totals
+func (s *ShellyService) recordEnergy(deviceID uint, status *shelly.DeviceStatus) {
+	if status == nil {
+		return
+	}
+	for channel, total := range energyReadings(status) {
+		s.recordEnergyReading(deviceID, channel, total)
+	}
+}
+
+// recordEnergyReading adds the growth of a device's energy counter since the
+// previous reading to its manager-side total. A counter that went back was
+// reset or wrapped; everything it counted since then is added.
+func (s *ShellyService) recordEnergyReading(deviceID uint, channel int, total float64) {
+	db := s.DB.GetDB()
+	if db == nil {
+		return
+	}
+	s.energyMu.Lock()
+	defer s.energyMu.Unlock()
+
+	var counter database.EnergyCounter
+	err := db.Where("device_id = ? AND channel = ?", deviceID, channel).First(&counter).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The device's own total so far is the starting point
+		counter = database.EnergyCounter{DeviceID: deviceID, Channel: channel, DeviceTotal: total, Cumulative: total}
+		if err := db.Create(&counter).Error; err != nil {
+			s.logger.WithFields(map[string]any{
+				"device_id": deviceID,
+				"channel":   channel,
+				"error":     err.Error(),
+				"component": "energy",
+			}).Warn("Failed to create energy counter")
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	now := s.clock.Now()
+	delta := total - counter.DeviceTotal
+	grown := delta
+	switch {
+	case delta > 0:
+		counter.Cumulative += delta
+	case delta == 0 || -delta <= energyResetTolerance:
+		// Unchanged, or rounding; keep the higher reading
+		return
+	default:
+		grown = total
+		counter.Cumulative += total
+		counter.Resets++
+		counter.LastResetAt = &now
+		s.logger.WithFields(map[string]any{
+			"device_id": deviceID,
+			"channel":   channel,
+			"previous":  counter.DeviceTotal,
+			"current":   total,
+			"component": "energy",
+		}).Info("Device energy counter reset detected")
+	}
+	counter.DeviceTotal = total
+	if err := db.Save(&counter).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": deviceID,
+			"channel":   channel,
+			"error":     err.Error(),
+			"component": "energy",
+		}).Warn("Failed to update energy counter")
+		return
+	}
+	s.recordEnergyUsage(db, deviceID, now, grown)
+}
+
+// recordEnergyUsage adds energy a device consumed to its hourly history.
+// Called with energyMu held.
+func (s *ShellyService) recordEnergyUsage(db *gorm.DB, deviceID uint, now time.Time, wh float64) {
+	if wh <= 0 {
+		return
+	}
+	// Stored in UTC so ranges in any time zone compare correctly
+	hour := now.Truncate(time.Hour).UTC()
+	var row database.EnergyUsage
+	err := db.Where("device_id = ? AND hour = ?", deviceID, hour).First(&row).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		row = database.EnergyUsage{DeviceID: deviceID, Hour: hour}
+	case err != nil:
+		return
+	}
+	row.Wh += wh
+	if err := db.Save(&row).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": deviceID,
+			"error":     err.Error(),
+			"component": "energy",
+		}).Warn("Failed to record energy usage")
+	}
+}
+
+// energyHourlyRetention returns how long hourly energy rows are kept
+func (s *ShellyService) energyHourlyRetention() time.Duration {
+	days := defaultEnergyHourlyDays
+	if s.Config != nil && s.Config.Metrics.EnergyHourlyDays > 0 {
+		days = s.Config.Metrics.EnergyHourlyDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// compactEnergyUsage rolls the hourly energy rows of whole UTC days past the
+// hourly retention up into one row per device and day, so the history stays
+// bounded while long-term comparisons keep working. Called with energyMu
+// held.
+func (s *ShellyService) compactEnergyUsage(db *gorm.DB, now time.Time) error {
+	cutoff := now.Add(-s.energyHourlyRetention()).UTC().Truncate(24 * time.Hour)
+	var rows []database.EnergyUsage
+	if err := db.Where("hour < ? AND hours <= 1", cutoff).Order("device_id, hour").Find(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	type dayKey struct {
+		deviceID uint
+		day      time.Time
+	}
+	days := map[dayKey]float64{}
+	ids := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		days[dayKey{row.DeviceID, row.Hour.UTC().Truncate(24 * time.Hour)}] += row.Wh
+		ids = append(ids, row.ID)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Hourly rows go first: the one at midnight holds the day's key
+		if err := tx.Where("id IN ?", ids).Delete(&database.EnergyUsage{}).Error; err != nil {
+			return err
+		}
+		for key, wh := range days {
+			var daily database.EnergyUsage
+			err := tx.Where("device_id = ? AND hour = ?", key.deviceID, key.day).First(&daily).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				daily = database.EnergyUsage{DeviceID: key.deviceID, Hour: key.day}
+			case err != nil:
+				return err
+			}
+			daily.Hours = 24
+			daily.Wh += wh
+			if err := tx.Save(&daily).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeviceEnergyTotals returns the manager-side energy totals of a device per
+// channel. They grow with every status read, across device counter resets.
+func (s *ShellyService) DeviceEnergyTotals(deviceID uint) (*DeviceEnergyTotals, error) {
+	totals := &DeviceEnergyTotals{DeviceID: deviceID, Counters: []database.EnergyCounter{}}
+	if err := s.DB.GetDB().Where("device_id = ?", deviceID).Order("channel").Find(&totals.Counters).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range totals.Counters {
+		totals.Cumulative += c.Cumulative
+	}
+	return totals, nil
+}
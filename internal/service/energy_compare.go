@@ -0,0 +1,425 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+var (
+	// ErrInvalidEnergyComparison is returned for a comparison that cannot be
+	// computed as requested
+	ErrInvalidEnergyComparison = errors.New("invalid energy comparison")
+	// ErrEnergySubjectNotFound is returned when no device carries a compared
+	// tag, or a compared group does not exist
+	ErrEnergySubjectNotFound = errors.New("energy comparison subject not found")
+)
+
+// Energy comparison bucket sizes
+const (
+	EnergyIntervalHour  = "hour"
+	EnergyIntervalDay   = "day"
+	EnergyIntervalMonth = "month"
+)
+
+// EnergyPeriodPrevious names the period before the current one
+const EnergyPeriodPrevious = "previous"
+
+// maxEnergyBuckets bounds the points of a comparison
+const maxEnergyBuckets = 2000
+
+// EnergySubject selects the devices one side of a comparison sums: a single
+// device, the devices carrying a tag (room:kitchen, ...) or the members of a
+// power budget group. Exactly one is set.
+type EnergySubject struct {
+	DeviceID uint   `json:"device_id,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+	Group    string `json:"group,omitempty"`
+}
+
+func (e EnergySubject) isZero() bool {
+	return e == EnergySubject{}
+}
+
+// EnergyCompareSide is one side of a comparison. Period names a calendar
+// period (today, yesterday, this_week, last_week, this_month, last_month,
+// this_year, last_year); without one, From and To give the range.
+type EnergyCompareSide struct {
+	Subject EnergySubject
+	Period  string
+	From    time.Time
+	To      time.Time
+}
+
+// EnergyCompareRequest compares the energy of a subject over two periods, or
+// of two subjects. Without a baseline subject the current one is used; the
+// baseline period defaults to the one before the current period when the
+// subject is the same, and to the current period otherwise.
+type EnergyCompareRequest struct {
+	Current  EnergyCompareSide
+	Baseline EnergyCompareSide
+	Interval string         // hour, day or month; chosen from the period length when empty
+	Location *time.Location // calendar periods and buckets; local time when nil
+}
+
+// EnergySeries is one side of a comparison
+type EnergySeries struct {
+	Label     string        `json:"label"`
+	Subject   EnergySubject `json:"subject"`
+	DeviceIDs []uint        `json:"device_ids"`
+	Period    string        `json:"period,omitempty"`
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	TotalWh   float64       `json:"total_wh"` // up to now
+}
+
+// EnergyComparePoint pairs the buckets at the same offset in both periods.
+// A value is nil for a bucket its period does not have, or that has not
+// started yet.
+type EnergyComparePoint struct {
+	Index         int        `json:"index"`
+	CurrentStart  *time.Time `json:"current_start,omitempty"`
+	BaselineStart *time.Time `json:"baseline_start,omitempty"`
+	CurrentWh     *float64   `json:"current_wh"`
+	BaselineWh    *float64   `json:"baseline_wh"`
+	DeltaWh       *float64   `json:"delta_wh"`
+	DeltaPercent  *float64   `json:"delta_percent"` // nil without baseline consumption
+}
+
+// EnergyDelta compares the totals over the buckets both sides have values
+// for, so a period in progress is compared like for like
+type EnergyDelta struct {
+	CurrentWh    float64  `json:"current_wh"`
+	BaselineWh   float64  `json:"baseline_wh"`
+	DeltaWh      float64  `json:"delta_wh"`
+	DeltaPercent *float64 `json:"delta_percent"`
+}
+
+// EnergyComparison holds two aligned energy series and their differences
+type EnergyComparison struct {
+	Interval string               `json:"interval"`
+	Current  EnergySeries         `json:"current"`
+	Baseline EnergySeries         `json:"baseline"`
+	Points   []EnergyComparePoint `json:"points"`
+	Total    EnergyDelta          `json:"total"`
+	// HistoryFrom is the oldest stored hour of the compared devices; buckets
+	// before it have no history rather than no consumption
+	HistoryFrom *time.Time `json:"history_from,omitempty"`
+	// HourlyFrom is where hourly history starts. Older history is kept as
+	// daily totals, spread evenly over the hours of their UTC day.
+	HourlyFrom *time.Time `json:"hourly_from,omitempty"`
+}
+
+// CompareEnergy computes two energy series from the stored hourly history,
+// aligned bucket by bucket, with their differences
+func (s *ShellyService) CompareEnergy(req EnergyCompareRequest) (*EnergyComparison, error) {
+	db := s.DB.GetDB()
+	if db == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+	loc := req.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	now := s.clock.Now().In(loc)
+
+	baseline := req.Baseline
+	if baseline.Subject.isZero() {
+		baseline.Subject = req.Current.Subject
+	}
+	curFrom, curTo, err := energyPeriod(req.Current, now)
+	if err != nil {
+		return nil, err
+	}
+	var baseFrom, baseTo time.Time
+	switch {
+	case baseline.Period == EnergyPeriodPrevious ||
+		baseline.Period == "" && baseline.From.IsZero() && baseline.Subject == req.Current.Subject:
+		baseFrom, baseTo = previousEnergyPeriod(req.Current.Period, curFrom, curTo)
+		baseline.Period = EnergyPeriodPrevious
+	case baseline.Period == "" && baseline.From.IsZero():
+		baseline.Period, baseFrom, baseTo = req.Current.Period, curFrom, curTo
+	default:
+		if baseFrom, baseTo, err = energyPeriod(baseline, now); err != nil {
+			return nil, err
+		}
+	}
+
+	interval := req.Interval
+	if interval == "" {
+		interval = defaultEnergyInterval(curTo.Sub(curFrom))
+	}
+	curBounds, err := energyBuckets(curFrom, curTo, interval)
+	if err != nil {
+		return nil, err
+	}
+	baseBounds, err := energyBuckets(baseFrom, baseTo, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	current := EnergySeries{Subject: req.Current.Subject, Period: req.Current.Period, From: curFrom, To: curTo}
+	if current.Label, current.DeviceIDs, err = s.energySubjectDevices(current.Subject); err != nil {
+		return nil, err
+	}
+	base := EnergySeries{Subject: baseline.Subject, Period: baseline.Period, From: baseFrom, To: baseTo}
+	if base.Label, base.DeviceIDs, err = s.energySubjectDevices(base.Subject); err != nil {
+		return nil, err
+	}
+	curValues, err := energyBucketValues(db, current.DeviceIDs, curBounds, now)
+	if err != nil {
+		return nil, err
+	}
+	baseValues, err := energyBucketValues(db, base.DeviceIDs, baseBounds, now)
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := &EnergyComparison{Interval: interval, Points: []EnergyComparePoint{}}
+	for i := 0; i < max(len(curValues), len(baseValues)); i++ {
+		p := EnergyComparePoint{Index: i}
+		if i < len(curValues) {
+			p.CurrentStart = &curBounds[i]
+			p.CurrentWh = curValues[i]
+		}
+		if i < len(baseValues) {
+			p.BaselineStart = &baseBounds[i]
+			p.BaselineWh = baseValues[i]
+		}
+		if p.CurrentWh != nil {
+			current.TotalWh += *p.CurrentWh
+		}
+		if p.BaselineWh != nil {
+			base.TotalWh += *p.BaselineWh
+		}
+		if p.CurrentWh != nil && p.BaselineWh != nil {
+			delta := roundHundredth(*p.CurrentWh - *p.BaselineWh)
+			p.DeltaWh = &delta
+			p.DeltaPercent = energyPercent(*p.CurrentWh, *p.BaselineWh)
+			cmp.Total.CurrentWh += *p.CurrentWh
+			cmp.Total.BaselineWh += *p.BaselineWh
+		}
+		cmp.Points = append(cmp.Points, p)
+	}
+	current.TotalWh = roundHundredth(current.TotalWh)
+	base.TotalWh = roundHundredth(base.TotalWh)
+	cmp.Current, cmp.Baseline = current, base
+	cmp.Total.CurrentWh = roundHundredth(cmp.Total.CurrentWh)
+	cmp.Total.BaselineWh = roundHundredth(cmp.Total.BaselineWh)
+	cmp.Total.DeltaWh = roundHundredth(cmp.Total.CurrentWh - cmp.Total.BaselineWh)
+	cmp.Total.DeltaPercent = energyPercent(cmp.Total.CurrentWh, cmp.Total.BaselineWh)
+
+	var oldest database.EnergyUsage
+	ids := append(append([]uint{}, current.DeviceIDs...), base.DeviceIDs...)
+	if err := db.Where("device_id IN ?", ids).Order("hour").First(&oldest).Error; err == nil {
+		from := oldest.Hour.In(loc)
+		cmp.HistoryFrom = &from
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load energy history: %w", err)
+	}
+	var newestDaily database.EnergyUsage
+	if err := db.Where("device_id IN ? AND hours > 1", ids).Order("hour DESC").First(&newestDaily).Error; err == nil {
+		from := newestDaily.Hour.Add(newestDaily.Span()).In(loc)
+		cmp.HourlyFrom = &from
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load energy history: %w", err)
+	}
+	return cmp, nil
+}
+
+// energySubjectDevices returns a subject's label and the devices it sums
+func (s *ShellyService) energySubjectDevices(subject EnergySubject) (string, []uint, error) {
+	set := 0
+	for _, ok := range []bool{subject.DeviceID != 0, subject.Tag != "", subject.Group != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return "", nil, fmt.Errorf("%w: name exactly one device, tag or group", ErrInvalidEnergyComparison)
+	}
+
+	db := s.DB.GetDB()
+	var ids []uint
+	switch {
+	case subject.DeviceID != 0:
+		device, err := s.DB.GetDevice(subject.DeviceID)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, subject.DeviceID)
+		}
+		return device.Name, []uint{device.ID}, nil
+	case subject.Tag != "":
+		if err := db.Model(&database.DeviceTag{}).Where("LOWER(tag) = ?", strings.ToLower(subject.Tag)).
+			Distinct().Order("device_id").Pluck("device_id", &ids).Error; err != nil {
+			return "", nil, fmt.Errorf("failed to load tagged devices: %w", err)
+		}
+		if len(ids) == 0 {
+			return "", nil, fmt.Errorf("%w: no device tagged %s", ErrEnergySubjectNotFound, subject.Tag)
+		}
+		return subject.Tag, ids, nil
+	default:
+		var group database.PowerBudgetGroup
+		err := db.Preload("Members").Where("LOWER(name) = ?", strings.ToLower(subject.Group)).First(&group).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil, fmt.Errorf("%w: group %s", ErrEnergySubjectNotFound, subject.Group)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to load group: %w", err)
+		}
+		seen := map[uint]bool{}
+		for _, m := range group.Members {
+			if !seen[m.DeviceID] {
+				seen[m.DeviceID] = true
+				ids = append(ids, m.DeviceID)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return group.Name, ids, nil
+	}
+}
+
+// energyPeriod resolves a side's named calendar period, or its range. Weeks
+// start on Monday.
+func energyPeriod(side EnergyCompareSide, now time.Time) (time.Time, time.Time, error) {
+	loc := now.Location()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	week := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	year := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, loc)
+
+	switch side.Period {
+	case "today":
+		return day, day.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return day.AddDate(0, 0, -1), day, nil
+	case "this_week":
+		return week, week.AddDate(0, 0, 7), nil
+	case "last_week":
+		return week.AddDate(0, 0, -7), week, nil
+	case "this_month":
+		return month, month.AddDate(0, 1, 0), nil
+	case "last_month":
+		return month.AddDate(0, -1, 0), month, nil
+	case "this_year":
+		return year, year.AddDate(1, 0, 0), nil
+	case "last_year":
+		return year.AddDate(-1, 0, 0), year, nil
+	case "":
+		if side.From.IsZero() || side.To.IsZero() || !side.To.After(side.From) {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: a period or a from-to range is required", ErrInvalidEnergyComparison)
+		}
+		return side.From.In(loc), side.To.In(loc), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("%w: unknown period %q", ErrInvalidEnergyComparison, side.Period)
+}
+
+// previousEnergyPeriod returns the period before from-to: the previous
+// calendar day, week, month or year for named periods, the same length
+// before for ranges
+func previousEnergyPeriod(period string, from, to time.Time) (time.Time, time.Time) {
+	switch period {
+	case "today", "yesterday":
+		return from.AddDate(0, 0, -1), from
+	case "this_week", "last_week":
+		return from.AddDate(0, 0, -7), from
+	case "this_month", "last_month":
+		return from.AddDate(0, -1, 0), from
+	case "this_year", "last_year":
+		return from.AddDate(-1, 0, 0), from
+	}
+	return from.Add(-to.Sub(from)), from
+}
+
+// defaultEnergyInterval picks the bucket size for a period length
+func defaultEnergyInterval(span time.Duration) string {
+	switch {
+	case span < 48*time.Hour:
+		return EnergyIntervalHour
+	case span <= 92*24*time.Hour:
+		return EnergyIntervalDay
+	}
+	return EnergyIntervalMonth
+}
+
+// energyBuckets returns the bucket boundaries of from-to, the last bucket
+// ending at to
+func energyBuckets(from, to time.Time, interval string) ([]time.Time, error) {
+	var next func(time.Time) time.Time
+	switch interval {
+	case EnergyIntervalHour:
+		next = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	case EnergyIntervalDay:
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case EnergyIntervalMonth:
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default:
+		return nil, fmt.Errorf("%w: unknown interval %q", ErrInvalidEnergyComparison, interval)
+	}
+	bounds := []time.Time{from}
+	for t := next(from); t.Before(to); t = next(t) {
+		if len(bounds) >= maxEnergyBuckets {
+			return nil, fmt.Errorf("%w: more than %d %s buckets", ErrInvalidEnergyComparison, maxEnergyBuckets, interval)
+		}
+		bounds = append(bounds, t)
+	}
+	return append(bounds, to), nil
+}
+
+// energyBucketValues sums the history of devices into buckets. A daily row
+// is spread evenly over its hours, so each bucket gets the share it overlaps.
+// Buckets that have not started are nil.
+func energyBucketValues(db *gorm.DB, deviceIDs []uint, bounds []time.Time, now time.Time) ([]*float64, error) {
+	n := len(bounds) - 1
+	sums := make([]float64, n)
+	if len(deviceIDs) > 0 {
+		var rows []database.EnergyUsage
+		// Daily rows starting up to a day early reach into the first bucket
+		if err := db.Where("device_id IN ? AND hour >= ? AND hour < ?", deviceIDs, bounds[0].Add(-24*time.Hour).UTC(), bounds[n].UTC()).
+			Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to load energy history: %w", err)
+		}
+		for _, row := range rows {
+			start, span := row.Hour, row.Span()
+			end := start.Add(span)
+			for i := sort.Search(n, func(i int) bool { return bounds[i+1].After(start) }); i < n && bounds[i].Before(end); i++ {
+				from, to := start, end
+				if bounds[i].After(from) {
+					from = bounds[i]
+				}
+				if bounds[i+1].Before(to) {
+					to = bounds[i+1]
+				}
+				sums[i] += row.Wh * float64(to.Sub(from)) / float64(span)
+			}
+		}
+	}
+	values := make([]*float64, n)
+	for i := range values {
+		if bounds[i].Before(now) {
+			v := roundHundredth(sums[i])
+			values[i] = &v
+		}
+	}
+	return values, nil
+}
+
+// energyPercent returns the change from baseline to current in percent, nil
+// without baseline consumption
+func energyPercent(current, baseline float64) *float64 {
+	if baseline <= 0 {
+		return nil
+	}
+	p := roundTenth((current - baseline) / baseline * 100)
+	return &p
+}
+
+func roundHundredth(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestShellyService_CompareEnergy(t *testing.T) {
+	db, cleanup := testutil.TestDatabaseMemory(t)
+	defer cleanup()
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+	// Monday of last week
+	clock := testutil.NewFakeClock(time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC))
+	service.SetClock(clock)
+
+	fridge := &database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Name: "Fridge"}
+	heater := &database.Device{IP: "192.0.2.2", MAC: "AABBCCDDEE02", Name: "Heater"}
+	for _, d := range []*database.Device{fridge, heater} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	if err := db.GetDB().Create(&database.DeviceTag{DeviceID: fridge.ID, Tag: "room:kitchen"}).Error; err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+
+	at := func(day, hour int) {
+		clock.Set(time.Date(2026, 10, day, hour, 0, 0, 0, time.UTC))
+	}
+	service.recordEnergyReading(fridge.ID, 0, 100) // starting point, no usage
+	at(5, 11)
+	service.recordEnergyReading(fridge.ID, 0, 150) // last Monday: 50
+	at(6, 11)
+	service.recordEnergyReading(fridge.ID, 0, 250) // last Tuesday: 100
+	at(12, 11)
+	service.recordEnergyReading(fridge.ID, 0, 330) // Monday: 80
+	service.recordEnergyReading(heater.ID, 0, 1000)
+	at(13, 11)
+	service.recordEnergyReading(fridge.ID, 0, 480) // Tuesday: 150
+	service.recordEnergyReading(heater.ID, 0, 40)  // counter reset: 40
+	at(14, 12)
+
+	cmp, err := service.CompareEnergy(EnergyCompareRequest{
+		Current:  EnergyCompareSide{Subject: EnergySubject{Tag: "Room:Kitchen"}, Period: "this_week"},
+		Location: time.UTC,
+	})
+	if err != nil {
+		t.Fatalf("CompareEnergy failed: %v", err)
+	}
+	if cmp.Interval != EnergyIntervalDay || len(cmp.Points) != 7 || cmp.Baseline.Period != EnergyPeriodPrevious {
+		t.Fatalf("Expected 7 daily points against the previous week, got %+v", cmp)
+	}
+	if !cmp.Baseline.From.Equal(time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected last week as baseline, got %s", cmp.Baseline.From)
+	}
+	monday, tuesday, wednesday, thursday := cmp.Points[0], cmp.Points[1], cmp.Points[2], cmp.Points[3]
+	if *monday.CurrentWh != 80 || *monday.BaselineWh != 50 || *monday.DeltaWh != 30 || *monday.DeltaPercent != 60 {
+		t.Errorf("Unexpected Monday point: %+v", monday)
+	}
+	if *tuesday.CurrentWh != 150 || *tuesday.DeltaPercent != 50 {
+		t.Errorf("Unexpected Tuesday point: %+v", tuesday)
+	}
+	if *wednesday.CurrentWh != 0 || wednesday.DeltaPercent != nil {
+		t.Errorf("Expected no percentage without baseline consumption: %+v", wednesday)
+	}
+	if thursday.CurrentWh != nil || thursday.BaselineWh == nil || thursday.DeltaWh != nil {
+		t.Errorf("Expected the future day left out: %+v", thursday)
+	}
+	if cmp.Total.CurrentWh != 230 || cmp.Total.BaselineWh != 150 || cmp.Total.DeltaWh != 80 || *cmp.Total.DeltaPercent != 53.3 {
+		t.Errorf("Unexpected totals: %+v", cmp.Total)
+	}
+	if cmp.HistoryFrom == nil || !cmp.HistoryFrom.Equal(time.Date(2026, 10, 5, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the history to start at the first usage, got %v", cmp.HistoryFrom)
+	}
+
+	// Device against device uses the same period for both
+	cmp, err = service.CompareEnergy(EnergyCompareRequest{
+		Current:  EnergyCompareSide{Subject: EnergySubject{DeviceID: fridge.ID}, Period: "yesterday"},
+		Baseline: EnergyCompareSide{Subject: EnergySubject{DeviceID: heater.ID}},
+		Location: time.UTC,
+	})
+	if err != nil {
+		t.Fatalf("CompareEnergy failed: %v", err)
+	}
+	if cmp.Interval != EnergyIntervalHour || len(cmp.Points) != 24 || cmp.Current.Label != "Fridge" || cmp.Baseline.Label != "Heater" {
+		t.Fatalf("Expected 24 hourly points of both devices, got %+v", cmp)
+	}
+	if cmp.Current.TotalWh != 150 || cmp.Baseline.TotalWh != 40 || *cmp.Total.DeltaPercent != 275 {
+		t.Errorf("Unexpected device comparison: %+v %+v", cmp.Current, cmp.Total)
+	}
+
+	for _, req := range []EnergyCompareRequest{
+		{Current: EnergyCompareSide{Subject: EnergySubject{Tag: "room:kitchen", Group: "Kitchen"}, Period: "today"}},
+		{Current: EnergyCompareSide{Subject: EnergySubject{Tag: "room:kitchen"}, Period: "fortnight"}},
+		{Current: EnergyCompareSide{Subject: EnergySubject{Tag: "room:kitchen"}, Period: "this_year"}, Interval: "minute"},
+	} {
+		if _, err := service.CompareEnergy(req); !errors.Is(err, ErrInvalidEnergyComparison) {
+			t.Errorf("Expected %+v refused, got %v", req, err)
+		}
+	}
+	_, err = service.CompareEnergy(EnergyCompareRequest{Current: EnergyCompareSide{Subject: EnergySubject{Group: "Garage"}, Period: "today"}})
+	if !errors.Is(err, ErrEnergySubjectNotFound) {
+		t.Errorf("Expected an unknown group reported, got %v", err)
+	}
+}
+
+func TestShellyService_EnergyUsageRollup(t *testing.T) {
+	db, cleanup := testutil.TestDatabaseMemory(t)
+	defer cleanup()
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	service.SetClock(testutil.NewFakeClock(now))
+
+	device := &database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Name: "Fridge"}
+	if err := db.AddDevice(device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	old := now.AddDate(0, 0, -defaultEnergyHourlyDays-5).Truncate(24 * time.Hour)
+	for hour := 0; hour < 24; hour++ {
+		row := database.EnergyUsage{DeviceID: device.ID, Hour: old.Add(time.Duration(hour) * time.Hour), Wh: 2}
+		if err := db.GetDB().Create(&row).Error; err != nil {
+			t.Fatalf("Failed to seed energy usage: %v", err)
+		}
+	}
+	recent := database.EnergyUsage{DeviceID: device.ID, Hour: now.Add(-2 * time.Hour), Wh: 5}
+	if err := db.GetDB().Create(&recent).Error; err != nil {
+		t.Fatalf("Failed to seed energy usage: %v", err)
+	}
+
+	if err := service.compactEnergyUsage(db.GetDB(), now); err != nil {
+		t.Fatalf("compactEnergyUsage failed: %v", err)
+	}
+	var rows []database.EnergyUsage
+	if err := db.GetDB().Order("hour").Find(&rows).Error; err != nil {
+		t.Fatalf("Failed to load energy usage: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Hours != 24 || rows[0].Wh != 48 || !rows[0].Hour.Equal(old) || rows[1].Wh != 5 {
+		t.Fatalf("Expected one daily row of 48 Wh and the recent hour, got %+v", rows)
+	}
+
+	// Hourly buckets over a rolled-up day share its total evenly
+	cmp, err := service.CompareEnergy(EnergyCompareRequest{
+		Current:  EnergyCompareSide{Subject: EnergySubject{DeviceID: device.ID}, From: old.Add(6 * time.Hour), To: old.Add(18 * time.Hour)},
+		Interval: EnergyIntervalHour,
+		Location: time.UTC,
+	})
+	if err != nil {
+		t.Fatalf("CompareEnergy failed: %v", err)
+	}
+	if len(cmp.Points) != 12 || *cmp.Points[0].CurrentWh != 2 || cmp.Current.TotalWh != 24 {
+		t.Errorf("Expected the daily total spread over the hours, got %+v", cmp.Current)
+	}
+	if cmp.HourlyFrom == nil || !cmp.HourlyFrom.Equal(old.Add(24*time.Hour)) {
+		t.Errorf("Expected hourly history to start after the rolled-up day, got %v", cmp.HourlyFrom)
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+func TestShellyService_EnergyTotals(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	read := func(ch0, ch1 float64) {
+		service.recordEnergy(1, &shelly.DeviceStatus{Switches: []shelly.SwitchStatus{
+			{ID: 0, Energy: ch0}, {ID: 1, Energy: ch1},
+		}})
+	}
+	read(1000, 50)
+	read(1150, 60)
+	read(1149.5, 60) // rounding, not a reset
+	read(20, 0)      // power loss: channel 0 restarts, channel 1 reports nothing yet
+	read(70, 10)     // channel 1 restarted too
+
+	totals, err := service.DeviceEnergyTotals(1)
+	if err != nil {
+		t.Fatalf("DeviceEnergyTotals failed: %v", err)
+	}
+	if len(totals.Counters) != 2 {
+		t.Fatalf("Expected 2 counters, got %+v", totals.Counters)
+	}
+	ch0, ch1 := totals.Counters[0], totals.Counters[1]
+	if ch0.Channel != 0 || ch0.Cumulative != 1220 || ch0.DeviceTotal != 70 || ch0.Resets != 1 || ch0.LastResetAt == nil {
+		t.Errorf("Unexpected channel 0 counter: %+v", ch0)
+	}
+	if ch1.Channel != 1 || ch1.Cumulative != 70 || ch1.Resets != 1 {
+		t.Errorf("Unexpected channel 1 counter: %+v", ch1)
+	}
+	if totals.Cumulative != 1290 {
+		t.Errorf("Expected 1290 Wh in total, got %v", totals.Cumulative)
+	}
+
+	// Meters take precedence over switches, as for power
+	service.recordEnergy(2, &shelly.DeviceStatus{
+		Switches: []shelly.SwitchStatus{{ID: 0, Energy: 5}},
+		Meters:   []shelly.MeterStatus{{ID: 0, Total: 300}},
+	})
+	totals, _ = service.DeviceEnergyTotals(2)
+	if len(totals.Counters) != 1 || totals.Cumulative != 300 {
+		t.Errorf("Expected the meter reading, got %+v", totals)
+	}
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/discovery"
+	"github.com/ginsys/shelly-manager/internal/naming"
+)
+
+// NewDeviceSourceEnrollment marks devices that enrolled themselves
+const NewDeviceSourceEnrollment = "enrollment"
+
+var (
+	// ErrEnrollmentDisabled is returned while enrollment is not enabled
+	ErrEnrollmentDisabled = errors.New("device enrollment is not enabled")
+	// ErrEnrollmentUnauthorized is returned for unknown, used or expired
+	// tokens, and for devices other than the one a token was issued for
+	ErrEnrollmentUnauthorized = errors.New("device enrollment not authorized")
+	// ErrInvalidEnrollment wraps enrollment requests that cannot be used
+	ErrInvalidEnrollment = errors.New("invalid device enrollment")
+)
+
+// EnrollmentRequest is what an enrolling device reports along with its
+// token, from Shelly.GetDeviceInfo and its Wi-Fi status
+type EnrollmentRequest struct {
+	Token string `json:"token"`
+	ID    string `json:"id"`
+	MAC   string `json:"mac"`
+	Model string `json:"model"`
+	Gen   int    `json:"gen"`
+	Ver   string `json:"ver"`
+	Name  string `json:"name,omitempty"`
+	IP    string `json:"ip,omitempty"` // station address; must be the request's source
+}
+
+// EnrollmentResult tells what an enrollment led to
+type EnrollmentResult struct {
+	DeviceID      uint   `json:"device_id"`
+	Name          string `json:"name"`
+	TaskID        string `json:"task_id,omitempty"`
+	TemplateID    *uint  `json:"template_id,omitempty"`
+	TemplateError string `json:"template_error,omitempty"`
+}
+
+// EnrollmentTicket is an issued token with the URL devices present it at
+type EnrollmentTicket struct {
+	URL   string
+	Token string
+}
+
+func (s *ShellyService) enrollmentConfig() config.EnrollmentConfig {
+	if s.Config == nil {
+		return config.EnrollmentConfig{}
+	}
+	return s.Config.Enrollment
+}
+
+// EnrollmentEnabled reports whether provisioning tasks get enrollment tokens
+func (s *ShellyService) EnrollmentEnabled() bool {
+	cfg := s.enrollmentConfig()
+	return cfg.Enabled && cfg.URL != ""
+}
+
+// IssueEnrollmentToken creates the one-time token of a provisioning task.
+// With mac set only that device can use it; templateID is the configuration
+// template applied once the device enrolled.
+func (s *ShellyService) IssueEnrollmentToken(taskID, mac string, templateID *uint) (*EnrollmentTicket, error) {
+	if !s.EnrollmentEnabled() {
+		return nil, ErrEnrollmentDisabled
+	}
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate enrollment token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	cfg := s.enrollmentConfig()
+	row := database.EnrollmentToken{
+		TokenHash:  enrollmentTokenHash(token),
+		TaskID:     taskID,
+		DeviceMAC:  normalizeMAC(mac),
+		TemplateID: templateID,
+		ExpiresAt:  s.clock.Now().Add(cfg.TokenTTLDuration()),
+	}
+	if err := s.DB.GetDB().Create(&row).Error; err != nil {
+		return nil, fmt.Errorf("failed to store enrollment token: %w", err)
+	}
+	return &EnrollmentTicket{URL: cfg.URL, Token: token}, nil
+}
+
+// Enroll adopts the device presenting a valid token, as discovery does but
+// without holding it as a new device alert, and applies the token's
+// configuration template. The template is pushed to the device in the
+// background, once the device has its answer. The device is adopted at
+// remoteIP, the request's source, so a token holder cannot have the
+// template, with its Wi-Fi and login settings, sent to another address.
+// A device reporting a different address is refused.
+func (s *ShellyService) Enroll(ctx context.Context, req EnrollmentRequest, remoteIP string) (*EnrollmentResult, error) {
+	if !s.enrollmentConfig().Enabled {
+		return nil, ErrEnrollmentDisabled
+	}
+	mac := normalizeMAC(req.MAC)
+	if req.Token == "" || mac == "" {
+		return nil, fmt.Errorf("%w: token and mac are required", ErrInvalidEnrollment)
+	}
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return nil, fmt.Errorf("%w: invalid request source %q", ErrInvalidEnrollment, remoteIP)
+	}
+	if req.IP != "" && !ip.Equal(net.ParseIP(req.IP)) {
+		return nil, fmt.Errorf("%w: ip %s is not the request source %s", ErrInvalidEnrollment, req.IP, remoteIP)
+	}
+
+	var token database.EnrollmentToken
+	err := s.DB.GetDB().Where("token_hash = ?", enrollmentTokenHash(req.Token)).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: unknown token", ErrEnrollmentUnauthorized)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load enrollment token: %w", err)
+	}
+	now := s.clock.Now()
+	switch {
+	case token.UsedAt != nil:
+		return nil, fmt.Errorf("%w: token already used", ErrEnrollmentUnauthorized)
+	case now.After(token.ExpiresAt):
+		return nil, fmt.Errorf("%w: token expired", ErrEnrollmentUnauthorized)
+	case token.DeviceMAC != "" && token.DeviceMAC != mac:
+		return nil, fmt.Errorf("%w: token was issued for another device", ErrEnrollmentUnauthorized)
+	}
+
+	// Claim the token before adopting, so a replayed request cannot enroll
+	// a second device
+	claim := s.DB.GetDB().Model(&database.EnrollmentToken{}).
+		Where("id = ? AND used_at IS NULL", token.ID).
+		Updates(map[string]interface{}{"used_at": now, "remote_ip": remoteIP})
+	if claim.Error != nil {
+		return nil, fmt.Errorf("failed to claim enrollment token: %w", claim.Error)
+	}
+	if claim.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: token already used", ErrEnrollmentUnauthorized)
+	}
+
+	sd := discovery.ShellyDevice{
+		ID:         req.ID,
+		Model:      req.Model,
+		Generation: req.Gen,
+		Version:    req.Ver,
+		MAC:        mac,
+		IP:         ip.String(),
+		Discovered: now,
+	}
+	if sd.ID == "" {
+		sd.ID = mac
+	}
+	device, err := s.adoptDiscovered(ctx, discoveredDevice{ShellyDevice: sd}, &naming.NameSet{}, false, NewDeviceSourceEnrollment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to adopt device: %w", err)
+	}
+	if device == nil {
+		return nil, fmt.Errorf("%w: adoption was vetoed by a hook", ErrInvalidEnrollment)
+	}
+
+	// Devices named after their Shelly ID take the name provisioning gave them
+	if req.Name != "" && device.Name == sd.ID {
+		device.Name = req.Name
+		if err := s.DB.UpdateDevice(device); err != nil {
+			s.logger.WithFields(map[string]any{
+				"device_id": device.ID,
+				"error":     err.Error(),
+				"component": "enrollment",
+			}).Warn("Failed to name enrolled device")
+		}
+	}
+	if err := s.DB.GetDB().Model(&token).Update("device_id", device.ID).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": device.ID,
+			"error":     err.Error(),
+			"component": "enrollment",
+		}).Warn("Failed to record enrolled device")
+	}
+
+	result := &EnrollmentResult{DeviceID: device.ID, Name: device.Name, TaskID: token.TaskID, TemplateID: token.TemplateID}
+	if token.TemplateID != nil {
+		if err := s.ApplyConfigTemplate(device.ID, *token.TemplateID, nil); err != nil {
+			result.TemplateError = err.Error()
+		} else {
+			go s.pushEnrollmentConfig(device.ID)
+		}
+	}
+
+	s.logger.WithFields(map[string]any{
+		"device_id":      device.ID,
+		"mac":            mac,
+		"ip":             ip.String(),
+		"task_id":        token.TaskID,
+		"template_id":    token.TemplateID,
+		"template_error": result.TemplateError,
+		"component":      "enrollment",
+	}).Info("Device enrolled")
+	return result, nil
+}
+
+// pushEnrollmentConfig writes the configuration applied at enrollment to the
+// device
+func (s *ShellyService) pushEnrollmentConfig(deviceID uint) {
+	if err := s.ExportDeviceConfig(deviceID); err != nil && s.ctx.Err() == nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": deviceID,
+			"error":     err.Error(),
+			"component": "enrollment",
+		}).Warn("Failed to push configuration to enrolled device")
+	}
+}
+
+// enrollmentTokenHash is the stored form of a token
+func enrollmentTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestShellyService_Enrollment(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	service := NewService(db, cfg)
+	defer service.Stop()
+	clk := testutil.NewFakeClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	service.SetClock(clk)
+	ctx := context.Background()
+
+	if _, err := service.IssueEnrollmentToken("task_1", "", nil); !errors.Is(err, ErrEnrollmentDisabled) {
+		t.Fatalf("Expected enrollment disabled, got %v", err)
+	}
+	cfg.Enrollment = config.EnrollmentConfig{Enabled: true, URL: "http://manager.lan:8080/enroll", TokenTTL: 1}
+	// New device alerts do not hold devices that enroll with a token
+	cfg.Discovery.NewDeviceAlerts = true
+
+	ticket, err := service.IssueEnrollmentToken("task_1", "aa:bb:cc:00:00:31", nil)
+	if err != nil {
+		t.Fatalf("IssueEnrollmentToken failed: %v", err)
+	}
+	if ticket.URL != cfg.Enrollment.URL || len(ticket.Token) != 48 {
+		t.Fatalf("Unexpected ticket: %+v", ticket)
+	}
+	var stored database.EnrollmentToken
+	if err := db.GetDB().First(&stored).Error; err != nil || stored.TokenHash == ticket.Token || stored.DeviceMAC != "AABBCC000031" {
+		t.Fatalf("Expected the token stored hashed, got %+v (%v)", stored, err)
+	}
+
+	req := EnrollmentRequest{Token: ticket.Token, ID: "shellyplus1-aabbcc000031", MAC: "AABBCC000031", Model: "SNSW-001X16EU", Gen: 2, Ver: "1.4.0", Name: "hall-plug", IP: "10.0.0.31"}
+	if _, err := service.Enroll(ctx, EnrollmentRequest{Token: "bogus", MAC: req.MAC}, "10.0.0.31"); !errors.Is(err, ErrEnrollmentUnauthorized) {
+		t.Errorf("Expected an unknown token refused, got %v", err)
+	}
+	other := req
+	other.MAC = "AABBCC000099"
+	other.IP = "10.0.0.99"
+	if _, err := service.Enroll(ctx, other, "10.0.0.99"); !errors.Is(err, ErrEnrollmentUnauthorized) {
+		t.Errorf("Expected another device refused, got %v", err)
+	}
+
+	// The device is adopted at the request's source, not at an address it claims
+	if _, err := service.Enroll(ctx, req, "10.0.0.1"); !errors.Is(err, ErrInvalidEnrollment) {
+		t.Errorf("Expected an address other than the request source refused, got %v", err)
+	}
+
+	result, err := service.Enroll(ctx, req, "10.0.0.31")
+	if err != nil {
+		t.Fatalf("Enroll failed: %v", err)
+	}
+	if result.TaskID != "task_1" || result.Name != "hall-plug" || result.DeviceID == 0 {
+		t.Fatalf("Unexpected enrollment result: %+v", result)
+	}
+	device, err := db.GetDevice(result.DeviceID)
+	if err != nil || device.IP != "10.0.0.31" || device.Firmware != "1.4.0" || device.Name != "hall-plug" {
+		t.Fatalf("Unexpected enrolled device: %+v (%v)", device, err)
+	}
+	if alerts, _ := service.ListNewDeviceAlerts(""); len(alerts) != 0 {
+		t.Errorf("Expected no new device alert, got %+v", alerts)
+	}
+	if err := db.GetDB().First(&stored, stored.ID).Error; err != nil || stored.UsedAt == nil || stored.DeviceID == nil || *stored.DeviceID != device.ID || stored.RemoteIP != "10.0.0.31" {
+		t.Errorf("Expected the token used by the device, got %+v (%v)", stored, err)
+	}
+
+	// Tokens are single use and expire
+	if _, err := service.Enroll(ctx, req, "10.0.0.31"); !errors.Is(err, ErrEnrollmentUnauthorized) {
+		t.Errorf("Expected a used token refused, got %v", err)
+	}
+	ticket, err = service.IssueEnrollmentToken("task_2", "", nil)
+	if err != nil {
+		t.Fatalf("IssueEnrollmentToken failed: %v", err)
+	}
+	clk.Advance(2 * time.Hour)
+	if _, err := service.Enroll(ctx, EnrollmentRequest{Token: ticket.Token, MAC: "AABBCC000032"}, "10.0.0.32"); !errors.Is(err, ErrEnrollmentUnauthorized) {
+		t.Errorf("Expected an expired token refused, got %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package service
+
+import "sync"
+
+// fanOut calls fn with every index from 0 to n-1 on at most workers
+// goroutines and returns once all calls have returned. Device jobs use it to
+// bound how many devices they contact at once.
+func fanOut(workers, n int, fn func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
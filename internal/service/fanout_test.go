@@ -0,0 +1,40 @@
+package service
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFanOut(t *testing.T) {
+	var running, peak, calls atomic.Int32
+	seen := make([]atomic.Bool, 20)
+	fanOut(3, len(seen), func(i int) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		seen[i].Store(true)
+		calls.Add(1)
+		running.Add(-1)
+	})
+
+	if calls.Load() != 20 {
+		t.Errorf("Expected 20 calls, got %d", calls.Load())
+	}
+	for i := range seen {
+		if !seen[i].Load() {
+			t.Errorf("Index %d was not called", i)
+		}
+	}
+	if peak.Load() > 3 {
+		t.Errorf("Expected at most 3 concurrent calls, got %d", peak.Load())
+	}
+
+	// No work returns at once
+	fanOut(5, 0, func(int) { t.Error("Unexpected call") })
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// ErrUnsupportedCapability is returned when an operation is refused because
+// the device's model, generation or firmware does not support it
+var ErrUnsupportedCapability = errors.New("operation not supported by device")
+
+// DeviceOperations returns the operations a device supports, derived from
+// the model and generation in its settings, its firmware version and its
+// active profile. known is false when the model is not in the registry.
+func DeviceOperations(device *database.Device) (ops []string, known bool) {
+	ops, known = shelly.SupportedOperations(deviceModelOf(device), deviceGenerationOf(device), device.Firmware)
+	return shelly.ProfileOperations(ops, device.Profile), known
+}
+
+// deviceModelOf returns the model in a device's settings, or its type when
+// discovery recorded no model
+func deviceModelOf(device *database.Device) string {
+	var settings struct {
+		Model string `json:"model"`
+	}
+	_ = json.Unmarshal([]byte(device.Settings), &settings)
+	if settings.Model == "" {
+		return device.Type
+	}
+	return settings.Model
+}
+
+// requireOperation refuses an operation the device is known not to support.
+// With several operations any one of them suffices.
+func requireOperation(device *database.Device, ops ...string) error {
+	supported, known := DeviceOperations(device)
+	if !known {
+		return nil
+	}
+	for _, op := range ops {
+		for _, s := range supported {
+			if s == op {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: device %d does not support %s", ErrUnsupportedCapability, device.ID, ops[0])
+}
+
+// requireDeviceOperation is requireOperation for a device looked up by ID
+func (s *ShellyService) requireDeviceOperation(deviceID uint, ops ...string) error {
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	return requireOperation(device, ops...)
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_UnsupportedOperation(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	sensor := &database.Device{IP: "192.0.2.20", MAC: "AABBCCDDEE20", Type: "SHHT-1", Name: "Attic",
+		Firmware: "1.11.0", Settings: `{"model":"SHHT-1","gen":1}`}
+	unknown := &database.Device{IP: "192.0.2.21", MAC: "AABBCCDDEE21", Type: "Unknown", Name: "New",
+		Settings: `{"model":"XYZ-1","gen":2}`}
+	for _, d := range []*database.Device{sensor, unknown} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+
+	if ops, known := DeviceOperations(sensor); !known || len(ops) != 0 {
+		t.Errorf("Expected no operations for a sensor, got %v (known %v)", ops, known)
+	}
+	if err := service.ControlDevice(sensor.ID, "on", map[string]interface{}{"force": true}); !errors.Is(err, ErrUnsupportedCapability) {
+		t.Errorf("Expected ErrUnsupportedCapability, got %v", err)
+	}
+	if _, err := service.GetDeviceEnergy(sensor.ID, 0); !errors.Is(err, ErrUnsupportedCapability) {
+		t.Errorf("Expected ErrUnsupportedCapability, got %v", err)
+	}
+
+	// Unknown models are not refused
+	if err := requireOperation(unknown, "roller"); err != nil {
+		t.Errorf("Expected unknown model to pass, got %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/notification"
+)
+
+const (
+	// summaryListLimit bounds the drifted devices and recent alerts listed
+	summaryListLimit = 10
+	// summaryAlertWindow is the period alerts are counted over
+	summaryAlertWindow = 24 * time.Hour
+)
+
+// FleetSummary holds the fleet statistics shown on the dashboard. Every
+// section comes from aggregate queries; no device is contacted. A section
+// that could not be loaded is empty and its error is listed in Errors.
+type FleetSummary struct {
+	GeneratedAt time.Time            `json:"generated_at"`
+	Devices     FleetDeviceCounts    `json:"devices"`
+	Power       *FleetPower          `json:"power"`
+	Config      FleetConfigSummary   `json:"config"`
+	Alerts      FleetAlertSummary    `json:"alerts"`
+	Schedules   []FleetScheduleEntry `json:"schedules"`
+	Errors      map[string]string    `json:"errors,omitempty"`
+}
+
+// FleetDeviceCounts counts the devices by status, generation and model
+type FleetDeviceCounts struct {
+	Total        int64            `json:"total"`
+	ByStatus     map[string]int64 `json:"by_status"`
+	ByGeneration map[string]int64 `json:"by_generation"` // gen1, gen2, ...
+	ByModel      map[string]int64 `json:"by_model"`
+	// Flapping lists devices rebooting unexpectedly more often than
+	// metrics.reboot_threshold in the last 24 hours, most reboots first
+	Flapping []FleetSummaryDevice `json:"flapping"`
+	// InMaintenance counts the devices under planned maintenance
+	InMaintenance int `json:"in_maintenance"`
+}
+
+// FleetPower is the average power the metered devices drew over the last
+// complete hour, taken from the stored energy history
+type FleetPower struct {
+	Watts   float64   `json:"watts"`
+	Devices int64     `json:"devices"` // devices that consumed energy in that hour
+	Hour    time.Time `json:"hour"`    // start of the hour, UTC
+}
+
+// FleetConfigSummary counts stored device configurations by sync status
+type FleetConfigSummary struct {
+	BySyncStatus   map[string]int64     `json:"by_sync_status"`
+	Drifted        int64                `json:"drifted"`
+	PendingSync    int64                `json:"pending_sync"`
+	DriftedDevices []FleetSummaryDevice `json:"drifted_devices"` // most recently changed first
+}
+
+// FleetSummaryDevice names a device listed in the summary
+type FleetSummaryDevice struct {
+	ID            uint   `json:"id"`
+	Name          string `json:"name"`
+	InMaintenance bool   `json:"in_maintenance,omitempty"`
+}
+
+// FleetAlertSummary counts recent notifications and lists the latest ones
+type FleetAlertSummary struct {
+	Last24h int64                    `json:"last_24h"`
+	ByLevel map[string]int64         `json:"by_level"` // alert level counts over the last 24 hours
+	Recent  []FleetSummaryAlertEntry `json:"recent"`
+}
+
+// FleetSummaryAlertEntry is one recent notification
+type FleetSummaryAlertEntry struct {
+	ID         uint      `json:"id"`
+	Subject    string    `json:"subject"`
+	AlertLevel string    `json:"alert_level"`
+	DeviceID   *uint     `json:"device_id,omitempty"`
+	Status     string    `json:"status"`
+	AlertState string    `json:"alert_state,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FleetScheduleEntry is an enabled schedule and when it runs next
+type FleetScheduleEntry struct {
+	Type    string     `json:"type"` // drift_detection, resolution or sync
+	ID      uint       `json:"id"`
+	Name    string     `json:"name"`
+	LastRun *time.Time `json:"last_run,omitempty"`
+	NextRun *time.Time `json:"next_run,omitempty"`
+}
+
+// groupCount is one row of a GROUP BY count query
+type groupCount struct {
+	Label string
+	Total int64
+}
+
+// FleetSummary returns device counts by status, generation and model, the
+// power of the metered devices, configuration drift and pending syncs,
+// recent alerts and the next runs of the schedules. Only a missing database
+// is an error; sections that fail to load are reported in Errors.
+func (s *ShellyService) FleetSummary(ctx context.Context) (*FleetSummary, error) {
+	db := s.DB.GetDB()
+	if db == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+	db = db.WithContext(ctx)
+	now := s.clock.Now()
+
+	summary := &FleetSummary{
+		GeneratedAt: now.UTC(),
+		Devices: FleetDeviceCounts{
+			ByStatus:     map[string]int64{},
+			ByGeneration: map[string]int64{},
+			ByModel:      map[string]int64{},
+			Flapping:     []FleetSummaryDevice{},
+		},
+		Config: FleetConfigSummary{
+			BySyncStatus:   map[string]int64{},
+			DriftedDevices: []FleetSummaryDevice{},
+		},
+		Alerts: FleetAlertSummary{
+			ByLevel: map[string]int64{},
+			Recent:  []FleetSummaryAlertEntry{},
+		},
+		Schedules: []FleetScheduleEntry{},
+		Errors:    map[string]string{},
+	}
+
+	if err := summarizeDevices(db, &summary.Devices); err != nil {
+		summary.Errors["devices"] = err.Error()
+	}
+
+	if power, err := fleetPower(db, now); err != nil {
+		summary.Errors["power"] = err.Error()
+	} else {
+		summary.Power = power
+	}
+
+	if report, err := s.RebootReport(); err != nil {
+		summary.Errors["reboots"] = err.Error()
+	} else {
+		for _, d := range report.Devices {
+			if d.Flapping && len(summary.Devices.Flapping) < summaryListLimit {
+				summary.Devices.Flapping = append(summary.Devices.Flapping, FleetSummaryDevice{ID: d.DeviceID, Name: d.Name})
+			}
+		}
+	}
+
+	// Maintenance labels the devices listed
+	maintenance := map[uint]bool{}
+	if windows, err := s.MaintenanceWindows(); err != nil {
+		summary.Errors["maintenance"] = err.Error()
+	} else {
+		for _, m := range windows {
+			maintenance[m.DeviceID] = true
+		}
+		summary.Devices.InMaintenance = len(windows)
+	}
+	for i := range summary.Devices.Flapping {
+		summary.Devices.Flapping[i].InMaintenance = maintenance[summary.Devices.Flapping[i].ID]
+	}
+
+	if err := summarizeConfigs(db, &summary.Config); err != nil {
+		summary.Errors["config"] = err.Error()
+	}
+	for i := range summary.Config.DriftedDevices {
+		summary.Config.DriftedDevices[i].InMaintenance = maintenance[summary.Config.DriftedDevices[i].ID]
+	}
+
+	if err := summarizeAlerts(db, now.Add(-summaryAlertWindow), &summary.Alerts); err != nil {
+		summary.Errors["alerts"] = err.Error()
+	}
+
+	schedules, err := enabledSchedules(db)
+	if err != nil {
+		summary.Errors["schedules"] = err.Error()
+	}
+	summary.Schedules = append(summary.Schedules, schedules...)
+
+	if len(summary.Errors) == 0 {
+		summary.Errors = nil
+	}
+	return summary, nil
+}
+
+// fleetPower returns the average power of the metered devices over the last
+// complete hour before now. Energy is recorded whenever a device status is
+// read, so the figure is the same on every instance and needs no device
+// request; Wh consumed in one hour equal the average W drawn.
+func fleetPower(db *gorm.DB, now time.Time) (*FleetPower, error) {
+	hour := now.UTC().Truncate(time.Hour).Add(-time.Hour)
+	var row struct {
+		Devices int64
+		Wh      float64
+	}
+	if err := db.Model(&database.EnergyUsage{}).
+		Select("COUNT(DISTINCT device_id) AS devices, COALESCE(SUM(wh), 0) AS wh").
+		Where("hour = ? AND hours <= 1", hour).
+		Scan(&row).Error; err != nil {
+		return nil, err
+	}
+	return &FleetPower{Watts: row.Wh, Devices: row.Devices, Hour: hour}, nil
+}
+
+// summarizeDevices counts the devices by status, model and generation
+func summarizeDevices(db *gorm.DB, counts *FleetDeviceCounts) error {
+	var byStatus, byModel []groupCount
+	var devices []database.Device
+	if err := db.Model(&database.Device{}).Select("status AS label, COUNT(*) AS total").Group("status").Scan(&byStatus).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&database.Device{}).Select("type AS label, COUNT(*) AS total").Group("type").Scan(&byModel).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&database.Device{}).Select("id", "settings").Find(&devices).Error; err != nil {
+		return err
+	}
+	for _, g := range byStatus {
+		counts.ByStatus[labelOrUnknown(g.Label)] += g.Total
+		counts.Total += g.Total
+	}
+	for _, g := range byModel {
+		counts.ByModel[labelOrUnknown(g.Label)] += g.Total
+	}
+	// The generation is only recorded in the settings document
+	for _, d := range devices {
+		counts.ByGeneration[fmt.Sprintf("gen%d", SettingsGeneration(d.Settings))]++
+	}
+	return nil
+}
+
+// summarizeConfigs counts the stored configurations by sync status and lists
+// the most recently drifted devices
+func summarizeConfigs(db *gorm.DB, config *FleetConfigSummary) error {
+	var bySync []groupCount
+	if err := db.Model(&configuration.DeviceConfig{}).Select("sync_status AS label, COUNT(*) AS total").Group("sync_status").Scan(&bySync).Error; err != nil {
+		return err
+	}
+	for _, g := range bySync {
+		config.BySyncStatus[labelOrUnknown(g.Label)] += g.Total
+	}
+	config.Drifted = config.BySyncStatus["drift"]
+	config.PendingSync = config.BySyncStatus["pending"]
+	return db.Table("device_configs").
+		Select("devices.id AS id, devices.name AS name").
+		Joins("JOIN devices ON devices.id = device_configs.device_id").
+		Where("device_configs.sync_status = ?", "drift").
+		Order("device_configs.updated_at DESC").
+		Limit(summaryListLimit).
+		Scan(&config.DriftedDevices).Error
+}
+
+// summarizeAlerts counts the notifications since a time by alert level and
+// lists the latest ones
+func summarizeAlerts(db *gorm.DB, since time.Time, alerts *FleetAlertSummary) error {
+	var byLevel []groupCount
+	var recent []notification.NotificationHistory
+	if err := db.Model(&notification.NotificationHistory{}).Select("alert_level AS label, COUNT(*) AS total").
+		Where("created_at >= ?", since).Group("alert_level").Scan(&byLevel).Error; err != nil {
+		return err
+	}
+	if err := db.Order("created_at DESC").Limit(summaryListLimit).Find(&recent).Error; err != nil {
+		return err
+	}
+	for _, g := range byLevel {
+		alerts.ByLevel[labelOrUnknown(g.Label)] += g.Total
+		alerts.Last24h += g.Total
+	}
+	for _, n := range recent {
+		alerts.Recent = append(alerts.Recent, FleetSummaryAlertEntry{
+			ID:         n.ID,
+			Subject:    n.Subject,
+			AlertLevel: n.AlertLevel,
+			DeviceID:   n.DeviceID,
+			Status:     n.Status,
+			AlertState: n.AlertState,
+			CreatedAt:  n.CreatedAt,
+		})
+	}
+	return nil
+}
+
+// enabledSchedules lists the enabled drift detection, resolution and sync
+// schedules, soonest first; schedules without a next run come last. The
+// schedules that could be loaded are returned along with the last error.
+func enabledSchedules(db *gorm.DB) ([]FleetScheduleEntry, error) {
+	var entries []FleetScheduleEntry
+	var lastErr error
+
+	var driftSchedules []configuration.DriftDetectionSchedule
+	if err := db.Where("enabled = ?", true).Find(&driftSchedules).Error; err != nil {
+		lastErr = err
+	}
+	for _, s := range driftSchedules {
+		entries = append(entries, FleetScheduleEntry{Type: "drift_detection", ID: s.ID, Name: s.Name, LastRun: s.LastRun, NextRun: s.NextRun})
+	}
+	var resolutionSchedules []configuration.ResolutionSchedule
+	if err := db.Where("enabled = ?", true).Find(&resolutionSchedules).Error; err != nil {
+		lastErr = err
+	}
+	for _, s := range resolutionSchedules {
+		entries = append(entries, FleetScheduleEntry{Type: "resolution", ID: s.ID, Name: s.Name, LastRun: s.LastRun, NextRun: s.NextRun})
+	}
+	var syncSchedules []database.SyncSchedule
+	if err := db.Where("enabled = ?", true).Find(&syncSchedules).Error; err != nil {
+		lastErr = err
+	}
+	for _, s := range syncSchedules {
+		entries = append(entries, FleetScheduleEntry{Type: "sync", ID: s.ID, Name: s.Name, LastRun: s.LastRunAt, NextRun: s.NextRunAt})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].NextRun, entries[j].NextRun
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.Before(*b)
+	})
+	return entries, lastErr
+}
+
+// labelOrUnknown names an empty group label
+func labelOrUnknown(key string) string {
+	if key == "" {
+		return "unknown"
+	}
+	return key
+}
+
+// SettingsGeneration returns the generation recorded in a device settings
+// document, defaulting to Gen1 like the device clients do
+func SettingsGeneration(settings string) int {
+	var s struct {
+		Gen int `json:"gen"`
+	}
+	if err := json.Unmarshal([]byte(settings), &s); err != nil || s.Gen <= 0 {
+		return 1
+	}
+	return s.Gen
+}
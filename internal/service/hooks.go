@@ -0,0 +1,458 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// Hook events
+const (
+	HookDeviceAdopted  = "device.adopted"  // a device is discovered for the first time
+	HookConfigExported = "config.exported" // a stored config is exported to a device
+	HookDriftDetected  = "drift.detected"  // a drift check finds a device out of sync
+)
+
+// Hook phases: pre hooks run before the operation and may veto it, post
+// hooks run after it
+const (
+	HookPre  = "pre"
+	HookPost = "post"
+)
+
+// Hook types
+const (
+	HookTypeWebhook = "webhook"
+	HookTypeRule    = "rule"
+)
+
+// maxHookResponse bounds the webhook answer read
+const maxHookResponse = 64 << 10
+
+var (
+	// ErrHookNotFound is returned for unknown hook IDs
+	ErrHookNotFound = errors.New("hook not found")
+	// ErrInvalidHook wraps hook validation failures
+	ErrInvalidHook = errors.New("invalid hook")
+	// ErrHookVeto is wrapped when a pre hook vetoes an operation
+	ErrHookVeto = errors.New("operation vetoed by hook")
+)
+
+// hookMatchFields are the device fields rule hooks match
+var hookMatchFields = map[string]bool{"name": true, "ip": true, "mac": true, "type": true, "firmware": true, "tag": true}
+
+// HookDevice is the device an event is about. ID is 0 before a device is
+// adopted.
+type HookDevice struct {
+	ID       uint     `json:"id,omitempty"`
+	Name     string   `json:"name"`
+	IP       string   `json:"ip"`
+	MAC      string   `json:"mac"`
+	Type     string   `json:"type"`
+	Firmware string   `json:"firmware,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// HookEvent is posted to webhook hooks
+type HookEvent struct {
+	Event     string     `json:"event"`
+	Phase     string     `json:"phase"`
+	Hook      string     `json:"hook"`
+	Device    HookDevice `json:"device"`
+	Data      any        `json:"data,omitempty"` // e.g. the differences of a drift
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// HookDecision is the answer of a hook; an empty answer lets the operation
+// continue unchanged
+type HookDecision struct {
+	Veto   bool     `json:"veto"`
+	Reason string   `json:"reason,omitempty"`
+	Tags   []string `json:"tags,omitempty"` // added to the device
+}
+
+// HookOutcome is the combined decision of the hooks run for an event
+type HookOutcome struct {
+	Vetoed   bool     `json:"vetoed"`
+	VetoedBy string   `json:"vetoed_by,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// Err returns the veto as an error wrapping ErrHookVeto, or nil
+func (o HookOutcome) Err() error {
+	if !o.Vetoed {
+		return nil
+	}
+	return fmt.Errorf("%w %s: %s", ErrHookVeto, o.VetoedBy, o.Reason)
+}
+
+// ListHooks returns the registered hooks in the order they run
+func (s *ShellyService) ListHooks() ([]database.OperationHook, error) {
+	hooks := []database.OperationHook{}
+	if err := s.DB.GetDB().Order("event, phase, priority, id").Find(&hooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to load hooks: %w", err)
+	}
+	return hooks, nil
+}
+
+// GetHook returns a registered hook
+func (s *ShellyService) GetHook(id uint) (*database.OperationHook, error) {
+	var hook database.OperationHook
+	if err := s.DB.GetDB().Limit(1).Find(&hook, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to load hook: %w", err)
+	}
+	if hook.ID == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrHookNotFound, id)
+	}
+	return &hook, nil
+}
+
+// CreateHook registers a hook
+func (s *ShellyService) CreateHook(hook *database.OperationHook) error {
+	if err := validateHook(hook); err != nil {
+		return err
+	}
+	hook.ID = 0
+	hook.LastRunAt, hook.LastError = nil, ""
+	if err := s.DB.GetDB().Create(hook).Error; err != nil {
+		return fmt.Errorf("failed to create hook: %w", err)
+	}
+	return nil
+}
+
+// UpdateHook replaces a hook's definition; an empty secret keeps the stored
+// one
+func (s *ShellyService) UpdateHook(id uint, hook *database.OperationHook) error {
+	existing, err := s.GetHook(id)
+	if err != nil {
+		return err
+	}
+	if err := validateHook(hook); err != nil {
+		return err
+	}
+	if hook.Secret == "" {
+		hook.Secret = existing.Secret
+	}
+	hook.ID = existing.ID
+	hook.CreatedAt = existing.CreatedAt
+	hook.LastRunAt, hook.LastError = existing.LastRunAt, existing.LastError
+	if err := s.DB.GetDB().Save(hook).Error; err != nil {
+		return fmt.Errorf("failed to update hook: %w", err)
+	}
+	return nil
+}
+
+// DeleteHook removes a hook
+func (s *ShellyService) DeleteHook(id uint) error {
+	res := s.DB.GetDB().Delete(&database.OperationHook{}, id)
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete hook: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: %d", ErrHookNotFound, id)
+	}
+	return nil
+}
+
+// RunHooks runs the enabled hooks of an event phase in priority order. In the
+// pre phase the first veto stops the remaining hooks; post hooks cannot veto.
+// A failing hook is skipped, or vetoes when it is a fail-closed pre hook. The
+// tags the hooks return are added to the device unless vetoed; before a
+// device is stored they are only returned, for the caller to add.
+func (s *ShellyService) RunHooks(event, phase string, device *database.Device, data any) HookOutcome {
+	var outcome HookOutcome
+	db := s.DB.GetDB()
+	if db == nil {
+		return outcome
+	}
+	var hooks []database.OperationHook
+	if err := db.Where("event = ? AND phase = ? AND enabled = ?", event, phase, true).
+		Order("priority, id").Find(&hooks).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"event":     event,
+			"error":     err.Error(),
+			"component": "hooks",
+		}).Warn("Failed to load hooks")
+		return outcome
+	}
+	if len(hooks) == 0 {
+		return outcome
+	}
+
+	subject := HookDevice{ID: device.ID, Name: device.Name, IP: device.IP, MAC: device.MAC, Type: device.Type, Firmware: device.Firmware}
+	if device.ID != 0 {
+		var tags []database.DeviceTag
+		if err := db.Where("device_id = ?", device.ID).Order("tag").Find(&tags).Error; err == nil {
+			for _, t := range tags {
+				subject.Tags = append(subject.Tags, t.Tag)
+			}
+		}
+	}
+	for _, hook := range hooks {
+		ev := HookEvent{Event: event, Phase: phase, Hook: hook.Name, Device: subject, Data: data, Timestamp: time.Now()}
+		decision, err := s.runHook(hook, ev)
+		s.recordHookRun(hook.ID, err)
+		if err != nil {
+			s.logger.WithFields(map[string]any{
+				"hook":      hook.Name,
+				"event":     event,
+				"device_id": device.ID,
+				"error":     err.Error(),
+				"component": "hooks",
+			}).Warn("Hook failed")
+			if phase == HookPre && hook.FailClosed {
+				outcome.Vetoed, outcome.VetoedBy, outcome.Reason = true, hook.Name, "hook failed: "+err.Error()
+				break
+			}
+			continue
+		}
+		outcome.Tags = append(outcome.Tags, decision.Tags...)
+		subject.Tags = append(subject.Tags, decision.Tags...)
+		if decision.Veto && phase == HookPre {
+			outcome.Vetoed, outcome.VetoedBy, outcome.Reason = true, hook.Name, decision.Reason
+			break
+		}
+	}
+
+	if outcome.Vetoed {
+		s.logger.WithFields(map[string]any{
+			"hook":      outcome.VetoedBy,
+			"event":     event,
+			"device_id": device.ID,
+			"mac":       device.MAC,
+			"reason":    outcome.Reason,
+			"component": "hooks",
+		}).Info("Operation vetoed by hook")
+	}
+	if device.ID != 0 && !outcome.Vetoed {
+		s.applyHookTags(device.ID, outcome.Tags)
+	}
+	return outcome
+}
+
+// runHook asks one hook for its decision
+func (s *ShellyService) runHook(hook database.OperationHook, ev HookEvent) (HookDecision, error) {
+	if hook.Type == HookTypeRule {
+		return ruleDecision(hook, ev.Device)
+	}
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return HookDecision{}, fmt.Errorf("failed to encode hook event: %w", err)
+	}
+	timeout := s.hookTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return HookDecision{}, fmt.Errorf("failed to create hook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "shelly-manager/1.0")
+	req.Header.Set("X-Hook-Event", ev.Event)
+	if hook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(hook.Secret))
+		mac.Write(payload)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil {
+		return HookDecision{}, fmt.Errorf("failed to call hook: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 400 {
+		return HookDecision{}, fmt.Errorf("hook returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHookResponse))
+	if err != nil {
+		return HookDecision{}, fmt.Errorf("failed to read hook response: %w", err)
+	}
+	var decision HookDecision
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &decision); err != nil {
+			return HookDecision{}, fmt.Errorf("invalid hook response: %w", err)
+		}
+	}
+	return decision, nil
+}
+
+// recordHookRun stores when a hook last ran and its error
+func (s *ShellyService) recordHookRun(id uint, runErr error) {
+	lastError := ""
+	if runErr != nil {
+		lastError = runErr.Error()
+	}
+	if err := s.DB.GetDB().Model(&database.OperationHook{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_run_at": time.Now(), "last_error": lastError}).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"hook_id":   id,
+			"error":     err.Error(),
+			"component": "hooks",
+		}).Warn("Failed to record hook run")
+	}
+}
+
+// applyHookTags adds the tags hooks returned to a device
+func (s *ShellyService) applyHookTags(deviceID uint, tags []string) {
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag == "" {
+			continue
+		}
+		if err := s.tagDevice(deviceID, tag); err != nil {
+			s.logger.WithFields(map[string]any{
+				"device_id": deviceID,
+				"tag":       tag,
+				"error":     err.Error(),
+				"component": "hooks",
+			}).Warn("Failed to add hook tag")
+		}
+	}
+}
+
+// driftHook runs the drift hooks of a drifted device. It reports whether the
+// drift is alerted: a pre hook veto accepts the drift instead.
+func (s *ShellyService) driftHook(_ context.Context, drift *configuration.ConfigDrift) bool {
+	device, err := s.DB.GetDevice(drift.DeviceID)
+	if err != nil {
+		return true
+	}
+	data := map[string]any{"differences": drift.Differences}
+	if outcome := s.RunHooks(HookDriftDetected, HookPre, device, data); outcome.Vetoed {
+		return false
+	}
+	s.RunHooks(HookDriftDetected, HookPost, device, data)
+	return true
+}
+
+// hookTimeout returns the configured webhook hook timeout
+func (s *ShellyService) hookTimeout() time.Duration {
+	if s.Config == nil {
+		return config.HooksConfig{}.TimeoutDuration()
+	}
+	return s.Config.Hooks.TimeoutDuration()
+}
+
+// ruleDecision applies a rule hook to a device. Every pattern in Match must
+// match, case-insensitively; "tag" matches any of the device's tags.
+func ruleDecision(hook database.OperationHook, device HookDevice) (HookDecision, error) {
+	match, tags, err := parseRule(hook)
+	if err != nil {
+		return HookDecision{}, err
+	}
+	values := map[string]string{"name": device.Name, "ip": device.IP, "mac": device.MAC, "type": device.Type, "firmware": device.Firmware}
+	for field, pattern := range match {
+		pattern = strings.ToLower(pattern)
+		if field == "tag" {
+			found := false
+			for _, t := range device.Tags {
+				if ok, _ := path.Match(pattern, strings.ToLower(t)); ok {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return HookDecision{}, nil
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, strings.ToLower(values[field])); !ok {
+			return HookDecision{}, nil
+		}
+	}
+	return HookDecision{Veto: hook.Veto != "", Reason: hook.Veto, Tags: tags}, nil
+}
+
+// parseRule decodes the match patterns and tags of a rule hook
+func parseRule(hook database.OperationHook) (map[string]string, []string, error) {
+	var match map[string]string
+	if len(hook.Match) > 0 {
+		if err := json.Unmarshal(hook.Match, &match); err != nil {
+			return nil, nil, fmt.Errorf("%w: match must map fields to patterns", ErrInvalidHook)
+		}
+	}
+	var tags []string
+	if len(hook.Tags) > 0 {
+		if err := json.Unmarshal(hook.Tags, &tags); err != nil {
+			return nil, nil, fmt.Errorf("%w: tags must be a list of strings", ErrInvalidHook)
+		}
+	}
+	return match, tags, nil
+}
+
+// validateHook checks a hook definition
+func validateHook(hook *database.OperationHook) error {
+	hook.Name = strings.TrimSpace(hook.Name)
+	if hook.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidHook)
+	}
+	switch hook.Event {
+	case HookDeviceAdopted, HookConfigExported, HookDriftDetected:
+	default:
+		return fmt.Errorf("%w: event must be %s, %s or %s", ErrInvalidHook, HookDeviceAdopted, HookConfigExported, HookDriftDetected)
+	}
+	if hook.Phase != HookPre && hook.Phase != HookPost {
+		return fmt.Errorf("%w: phase must be %s or %s", ErrInvalidHook, HookPre, HookPost)
+	}
+
+	switch hook.Type {
+	case HookTypeWebhook:
+		u, err := url.Parse(hook.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: url must be an http or https URL", ErrInvalidHook)
+		}
+		if len(hook.Match) > 0 || hook.Veto != "" || len(hook.Tags) > 0 {
+			return fmt.Errorf("%w: match, veto and tags apply to rule hooks", ErrInvalidHook)
+		}
+	case HookTypeRule:
+		if hook.URL != "" || hook.Secret != "" {
+			return fmt.Errorf("%w: url and secret apply to webhook hooks", ErrInvalidHook)
+		}
+		match, tags, err := parseRule(*hook)
+		if err != nil {
+			return err
+		}
+		for field, pattern := range match {
+			if !hookMatchFields[field] {
+				return fmt.Errorf("%w: unknown match field %q", ErrInvalidHook, field)
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%w: invalid pattern %q for %s", ErrInvalidHook, pattern, field)
+			}
+		}
+		if hook.Veto == "" && len(tags) == 0 {
+			return fmt.Errorf("%w: a rule needs a veto reason or tags", ErrInvalidHook)
+		}
+		if hook.Veto != "" && hook.Phase == HookPost {
+			return fmt.Errorf("%w: only pre hooks can veto", ErrInvalidHook)
+		}
+	default:
+		return fmt.Errorf("%w: type must be %s or %s", ErrInvalidHook, HookTypeWebhook, HookTypeRule)
+	}
+	return nil
+}
+
+// isNewDevice reports whether no device with the MAC is stored yet
+func (s *ShellyService) isNewDevice(mac string) bool {
+	var count int64
+	if err := s.DB.GetDB().Model(&database.Device{}).Where("mac = ?", mac).Count(&count).Error; err != nil {
+		return false
+	}
+	return count == 0
+}
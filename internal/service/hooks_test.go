@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_HookValidation(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	for _, hook := range []database.OperationHook{
+		{Event: HookConfigExported, Phase: HookPre, Type: HookTypeRule, Veto: "no"},
+		{Name: "x", Event: "device.deleted", Phase: HookPre, Type: HookTypeRule, Veto: "no"},
+		{Name: "x", Event: HookConfigExported, Phase: "during", Type: HookTypeRule, Veto: "no"},
+		{Name: "x", Event: HookConfigExported, Phase: HookPre, Type: "starlark"},
+		{Name: "x", Event: HookConfigExported, Phase: HookPre, Type: HookTypeWebhook, URL: "ftp://example.com"},
+		{Name: "x", Event: HookConfigExported, Phase: HookPre, Type: HookTypeRule},
+		{Name: "x", Event: HookConfigExported, Phase: HookPost, Type: HookTypeRule, Veto: "no"},
+		{Name: "x", Event: HookConfigExported, Phase: HookPre, Type: HookTypeRule, Veto: "no", Match: json.RawMessage(`{"room": "*"}`)},
+		{Name: "x", Event: HookConfigExported, Phase: HookPre, Type: HookTypeRule, Veto: "no", Match: json.RawMessage(`{"name": "[a"}`)},
+	} {
+		if err := service.CreateHook(&hook); !errors.Is(err, ErrInvalidHook) {
+			t.Errorf("Expected %+v to be rejected, got %v", hook, err)
+		}
+	}
+}
+
+func TestShellyService_RunHooks(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	garage := &database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Name: "Garage door", Type: "SHSW-1"}
+	hall := &database.Device{IP: "192.0.2.2", MAC: "AABBCCDDEE02", Name: "Hall", Type: "SHSW-1"}
+	for _, d := range []*database.Device{garage, hall} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+
+	var received HookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		_, _ = w.Write([]byte(`{"tags": ["site:main"]}`))
+	}))
+	defer server.Close()
+
+	hooks := []database.OperationHook{
+		{Name: "tag-site", Event: HookConfigExported, Phase: HookPre, Type: HookTypeWebhook, URL: server.URL, Enabled: true},
+		{Name: "no-garage", Event: HookConfigExported, Phase: HookPre, Type: HookTypeRule, Priority: 1, Enabled: true,
+			Match: json.RawMessage(`{"name": "garage*", "tag": "site:*"}`), Veto: "garage doors are managed by hand"},
+		{Name: "disabled", Event: HookConfigExported, Phase: HookPre, Type: HookTypeRule, Veto: "never", Enabled: false},
+	}
+	for i := range hooks {
+		if err := service.CreateHook(&hooks[i]); err != nil {
+			t.Fatalf("CreateHook failed: %v", err)
+		}
+	}
+
+	// The webhook tags the device first, so the rule sees the tag
+	outcome := service.RunHooks(HookConfigExported, HookPre, garage, nil)
+	if !outcome.Vetoed || outcome.VetoedBy != "no-garage" || !errors.Is(outcome.Err(), ErrHookVeto) {
+		t.Errorf("Expected the garage export vetoed by the rule, got %+v", outcome)
+	}
+	if received.Event != HookConfigExported || received.Device.MAC != garage.MAC {
+		t.Errorf("Expected the webhook to receive the event, got %+v", received)
+	}
+
+	outcome = service.RunHooks(HookConfigExported, HookPre, hall, nil)
+	if outcome.Vetoed || len(outcome.Tags) != 1 {
+		t.Fatalf("Expected the hall export allowed and tagged, got %+v", outcome)
+	}
+	var tag database.DeviceTag
+	if err := db.GetDB().Where("device_id = ? AND tag = ?", hall.ID, "site:main").First(&tag).Error; err != nil {
+		t.Errorf("Expected the hook tag added to the device: %v", err)
+	}
+
+	stored, err := service.GetHook(hooks[0].ID)
+	if err != nil {
+		t.Fatalf("GetHook failed: %v", err)
+	}
+	if stored.LastRunAt == nil || stored.LastError != "" {
+		t.Errorf("Expected the webhook run recorded, got %+v", stored)
+	}
+
+	// A failing fail-closed pre hook vetoes; others are skipped
+	server.Close()
+	hooks[0].FailClosed = true
+	if err := service.UpdateHook(hooks[0].ID, &hooks[0]); err != nil {
+		t.Fatalf("UpdateHook failed: %v", err)
+	}
+	if outcome := service.RunHooks(HookConfigExported, HookPre, hall, nil); !outcome.Vetoed || outcome.VetoedBy != "tag-site" {
+		t.Errorf("Expected the failing fail-closed hook to veto, got %+v", outcome)
+	}
+	stored, _ = service.GetHook(hooks[0].ID)
+	if stored.LastError == "" {
+		t.Error("Expected the hook failure recorded")
+	}
+
+	if err := service.DeleteHook(hooks[0].ID); err != nil {
+		t.Fatalf("DeleteHook failed: %v", err)
+	}
+	if err := service.DeleteHook(hooks[0].ID); !errors.Is(err, ErrHookNotFound) {
+		t.Errorf("Expected a deleted hook to be unknown, got %v", err)
+	}
+}
+
+func TestShellyService_DriftHook(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	device := &database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Name: "Lab relay"}
+	if err := db.AddDevice(device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	drift := &configuration.ConfigDrift{DeviceID: device.ID, DeviceName: device.Name}
+	if !service.driftHook(context.Background(), drift) {
+		t.Error("Expected drift alerted without hooks")
+	}
+
+	accept := database.OperationHook{Name: "lab", Event: HookDriftDetected, Phase: HookPre, Type: HookTypeRule, Enabled: true,
+		Match: json.RawMessage(`{"name": "lab *"}`), Veto: "lab devices drift on purpose"}
+	if err := service.CreateHook(&accept); err != nil {
+		t.Fatalf("CreateHook failed: %v", err)
+	}
+	if service.driftHook(context.Background(), drift) {
+		t.Error("Expected the vetoed drift not to be alerted")
+	}
+}
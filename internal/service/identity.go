@@ -0,0 +1,452 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/discovery"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// identityProbeWorkers bounds concurrent probes per identity check
+const identityProbeWorkers = 10
+
+// Identity conflict kinds
+const (
+	// IdentityWrongDevice: another device answers at the stored address and
+	// the stored device was not found elsewhere
+	IdentityWrongDevice = "wrong_device"
+	// IdentityAddressTaken: the device answers at an address stored for
+	// another device whose own new address is unknown
+	IdentityAddressTaken = "address_taken"
+	// IdentityDuplicate: several rows hold the MAC and none of them is
+	// confirmed at its address
+	IdentityDuplicate = "duplicate"
+)
+
+// ErrIdentityConflictNotFound is returned for an unknown conflict ID
+var ErrIdentityConflictNotFound = errors.New("identity conflict not found")
+
+// IdentityMove is the address change of a device DHCP moved
+type IdentityMove struct {
+	DeviceID uint   `json:"device_id"`
+	Name     string `json:"name"`
+	MAC      string `json:"mac"`
+	OldIP    string `json:"old_ip"`
+	NewIP    string `json:"new_ip"`
+}
+
+// IdentityMerge is a duplicate row of a device folded into the row kept
+type IdentityMerge struct {
+	DeviceID    uint                    `json:"device_id"`
+	DuplicateID uint                    `json:"duplicate_id"`
+	MAC         string                  `json:"mac"`
+	Tables      []database.RelinkedRows `json:"tables,omitempty"`
+}
+
+// IdentityReport is the outcome of one identity check. Without Fixed, Moved
+// and Merged list what the check would have changed.
+type IdentityReport struct {
+	CheckedAt   time.Time                   `json:"checked_at"`
+	Devices     int                         `json:"devices"`
+	Confirmed   int                         `json:"confirmed"`
+	Unreachable int                         `json:"unreachable"`
+	Excluded    int                         `json:"excluded"`
+	Fixed       bool                        `json:"fixed"`
+	Moved       []IdentityMove              `json:"moved"`
+	Merged      []IdentityMerge             `json:"merged"`
+	Conflicts   []database.IdentityConflict `json:"conflicts"`
+}
+
+// VerifyDeviceIdentities probes the address of every stored device and
+// compares the MAC address that answers. A device found at another stored
+// or unused address is moved there, and duplicate rows of one device are
+// merged into the row confirmed at its address, but only with fix and only
+// when nothing else claims the address. What cannot be settled is recorded as
+// an identity conflict for review.
+func (s *ShellyService) VerifyDeviceIdentities(ctx context.Context, fix bool) (*IdentityReport, error) {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+	report := &IdentityReport{
+		CheckedAt: time.Now(),
+		Fixed:     fix,
+		Moved:     []IdentityMove{},
+		Merged:    []IdentityMerge{},
+		Conflicts: []database.IdentityConflict{},
+	}
+
+	observed, excluded, err := s.probeIdentities(ctx, devices)
+	if err != nil {
+		return nil, err
+	}
+	report.Devices = len(devices)
+	report.Excluded = excluded
+
+	// Where each MAC answered; a MAC answering at two addresses is ambiguous
+	macAt := map[string]string{}
+	ambiguous := map[string]bool{}
+	for ip, mac := range observed {
+		if mac == "" {
+			continue
+		}
+		if _, seen := macAt[mac]; seen {
+			ambiguous[mac] = true
+		}
+		macAt[mac] = ip
+	}
+
+	rowAt := map[string]*database.Device{}
+	byMAC := map[string][]*database.Device{}
+	for i := range devices {
+		d := &devices[i]
+		rowAt[d.IP] = d
+		mac := normalizeMAC(d.MAC)
+		byMAC[mac] = append(byMAC[mac], d)
+	}
+
+	var conflicts []database.IdentityConflict
+	removed := map[uint]bool{} // duplicates merged away
+	skip := map[uint]bool{}    // rows left to review
+	settled := []uint{}        // devices whose open conflicts are resolved
+
+	// Rows sharing a MAC (stored in different notations) describe one device
+	for mac, rows := range byMAC {
+		if len(rows) < 2 {
+			continue
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+		var keep []*database.Device
+		for _, d := range rows {
+			if observed[d.IP] == mac {
+				keep = append(keep, d)
+			}
+		}
+		if len(keep) != 1 {
+			for _, d := range rows[1:] {
+				skip[d.ID] = true
+				other := rows[0].ID
+				conflicts = append(conflicts, database.IdentityConflict{
+					DeviceID: d.ID, OtherDeviceID: &other, Kind: IdentityDuplicate, IP: d.IP, ExpectedMAC: d.MAC,
+					Detail: fmt.Sprintf("devices %d and %d both have MAC %s and neither is confirmed at its address", rows[0].ID, d.ID, d.MAC),
+				})
+			}
+			skip[rows[0].ID] = true
+			continue
+		}
+		for _, d := range rows {
+			if d.ID != keep[0].ID {
+				removed[d.ID] = true
+				report.Merged = append(report.Merged, IdentityMerge{DeviceID: keep[0].ID, DuplicateID: d.ID, MAC: keep[0].MAC})
+			}
+		}
+	}
+
+	// Devices answering at another address move there
+	moves := map[uint]string{}
+	for i := range devices {
+		d := &devices[i]
+		if removed[d.ID] || skip[d.ID] {
+			continue
+		}
+		mac := normalizeMAC(d.MAC)
+		if observed[d.IP] == mac {
+			report.Confirmed++
+			settled = append(settled, d.ID)
+			continue
+		}
+		if ip, ok := macAt[mac]; ok && !ambiguous[mac] {
+			moves[d.ID] = ip
+		}
+	}
+	// A move is only unambiguous when the row holding the new address moves
+	// away too; dropping one move can block another, so repeat until stable
+	blocked := map[uint]*database.Device{}
+	for changed := true; changed; {
+		changed = false
+		for id, ip := range moves {
+			occupant := rowAt[ip]
+			if occupant == nil || occupant.ID == id || removed[occupant.ID] {
+				continue
+			}
+			if _, moving := moves[occupant.ID]; !moving {
+				blocked[id] = occupant
+				delete(moves, id)
+				changed = true
+			}
+		}
+	}
+
+	for i := range devices {
+		d := &devices[i]
+		if removed[d.ID] || skip[d.ID] || observed[d.IP] == normalizeMAC(d.MAC) {
+			continue
+		}
+		if ip, ok := moves[d.ID]; ok {
+			report.Moved = append(report.Moved, IdentityMove{DeviceID: d.ID, Name: d.Name, MAC: d.MAC, OldIP: d.IP, NewIP: ip})
+			if fix {
+				settled = append(settled, d.ID)
+			}
+			continue
+		}
+		if occupant, ok := blocked[d.ID]; ok {
+			other := occupant.ID
+			ip := macAt[normalizeMAC(d.MAC)]
+			conflicts = append(conflicts, database.IdentityConflict{
+				DeviceID: d.ID, OtherDeviceID: &other, Kind: IdentityAddressTaken, IP: ip, ExpectedMAC: d.MAC, ReportedMAC: d.MAC,
+				Detail: fmt.Sprintf("device moved from %s to %s, which is stored for device %d (%s)", d.IP, ip, occupant.ID, occupant.Name),
+			})
+			continue
+		}
+		reported := observed[d.IP]
+		if reported == "" {
+			report.Unreachable++
+			continue
+		}
+		conflict := database.IdentityConflict{
+			DeviceID: d.ID, Kind: IdentityWrongDevice, IP: d.IP, ExpectedMAC: d.MAC, ReportedMAC: reported,
+			Detail: fmt.Sprintf("%s answers with MAC %s, expected %s", d.IP, reported, d.MAC),
+		}
+		if others := byMAC[reported]; len(others) > 0 {
+			other := others[0].ID
+			conflict.OtherDeviceID = &other
+			conflict.Detail += fmt.Sprintf(" (stored as device %d, %s)", others[0].ID, others[0].Name)
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	sort.Slice(report.Moved, func(i, j int) bool { return report.Moved[i].DeviceID < report.Moved[j].DeviceID })
+
+	if fix {
+		if err := s.applyIdentityFixes(report); err != nil {
+			return nil, err
+		}
+	}
+	if report.Conflicts, err = s.recordIdentityConflicts(conflicts, settled); err != nil {
+		return nil, err
+	}
+
+	if len(report.Moved) > 0 || len(report.Merged) > 0 || len(report.Conflicts) > 0 {
+		s.logger.WithFields(map[string]any{
+			"devices":   report.Devices,
+			"moved":     len(report.Moved),
+			"merged":    len(report.Merged),
+			"conflicts": len(report.Conflicts),
+			"fixed":     fix,
+			"component": "identity",
+		}).Warn("Device identity check found mismatches")
+	}
+	return report, nil
+}
+
+// probeIdentities asks every stored address which device answers and returns
+// the normalized MAC per address ("" when nothing answered) and the number of
+// addresses skipped as excluded from discovery
+func (s *ShellyService) probeIdentities(ctx context.Context, devices []database.Device) (map[string]string, int, error) {
+	opts, err := s.discoveryOptions()
+	if err != nil {
+		return nil, 0, err
+	}
+	ctx = shelly.WithTrafficClass(ctx, shelly.TrafficHealth)
+	observed := make(map[string]string, len(devices))
+	excluded := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.pollWorkers(identityProbeWorkers))
+	for i := range devices {
+		d := &devices[i]
+		if d.IP == "" {
+			continue
+		}
+		if !s.recoveryPause(ctx) {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			timeout := s.deviceClientSettings(d).RequestTimeout()
+			probed, err := discovery.NewScannerWithLogger(timeout, 1, s.logger, opts...).ScanHost(ctx, d.IP)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, discovery.ErrExcluded):
+				excluded++
+				observed[d.IP] = ""
+			case err != nil || probed == nil:
+				observed[d.IP] = ""
+			default:
+				observed[d.IP] = normalizeMAC(probed.MAC)
+			}
+		}()
+	}
+	wg.Wait()
+	return observed, excluded, ctx.Err()
+}
+
+// applyIdentityFixes merges the duplicate rows and moves the addresses of a
+// report. Moves run in one transaction through placeholder addresses, so two
+// devices that swapped addresses do not collide on the unique index.
+func (s *ShellyService) applyIdentityFixes(report *IdentityReport) error {
+	for i, m := range report.Merged {
+		relinked, err := database.RelinkDeviceReferences(s.DB.GetDB(), m.DuplicateID, m.DeviceID)
+		if err != nil {
+			return fmt.Errorf("failed to merge device %d: %w", m.DuplicateID, err)
+		}
+		if err := s.DB.DeleteDevice(m.DuplicateID); err != nil {
+			return fmt.Errorf("failed to delete duplicate device %d: %w", m.DuplicateID, err)
+		}
+		report.Merged[i].Tables = relinked
+		s.logger.WithFields(map[string]any{
+			"device_id":    m.DeviceID,
+			"duplicate_id": m.DuplicateID,
+			"mac":          m.MAC,
+			"component":    "identity",
+		}).Info("Merged duplicate device row")
+	}
+	if len(report.Moved) == 0 {
+		return nil
+	}
+	err := s.DB.GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, m := range report.Moved {
+			if err := tx.Model(&database.Device{}).Where("id = ?", m.DeviceID).Update("ip", fmt.Sprintf("moving-%d", m.DeviceID)).Error; err != nil {
+				return err
+			}
+		}
+		for _, m := range report.Moved {
+			if err := tx.Model(&database.Device{}).Where("id = ?", m.DeviceID).Update("ip", m.NewIP).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update device addresses: %w", err)
+	}
+	for _, m := range report.Moved {
+		s.logger.WithFields(map[string]any{
+			"device_id": m.DeviceID,
+			"mac":       m.MAC,
+			"old_ip":    m.OldIP,
+			"new_ip":    m.NewIP,
+			"component": "identity",
+		}).Info("Updated address of moved device")
+	}
+	return nil
+}
+
+// recordIdentityConflicts stores new conflicts, refreshes open ones found
+// again and resolves the open conflicts of the settled devices
+func (s *ShellyService) recordIdentityConflicts(conflicts []database.IdentityConflict, settled []uint) ([]database.IdentityConflict, error) {
+	db := s.DB.GetDB()
+	now := time.Now()
+	if len(settled) > 0 {
+		if err := db.Model(&database.IdentityConflict{}).Where("resolved = ? AND device_id IN ?", false, settled).
+			Updates(map[string]any{"resolved": true, "resolved_at": now}).Error; err != nil {
+			return nil, fmt.Errorf("failed to resolve identity conflicts: %w", err)
+		}
+	}
+	recorded := make([]database.IdentityConflict, 0, len(conflicts))
+	for _, c := range conflicts {
+		var existing database.IdentityConflict
+		err := db.Where("resolved = ? AND device_id = ? AND kind = ? AND ip = ? AND reported_mac = ?",
+			false, c.DeviceID, c.Kind, c.IP, c.ReportedMAC).First(&existing).Error
+		switch {
+		case err == nil:
+			existing.OtherDeviceID = c.OtherDeviceID
+			existing.Detail = c.Detail
+			existing.LastSeen = now
+			err = db.Save(&existing).Error
+			c = existing
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.LastSeen = now
+			err = db.Create(&c).Error
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to record identity conflict: %w", err)
+		}
+		recorded = append(recorded, c)
+	}
+	return recorded, nil
+}
+
+// ListIdentityConflicts returns the open identity conflicts, newest first,
+// or every conflict with all
+func (s *ShellyService) ListIdentityConflicts(all bool) ([]database.IdentityConflict, error) {
+	conflicts := []database.IdentityConflict{}
+	query := s.DB.GetDB().Order("id DESC")
+	if !all {
+		query = query.Where("resolved = ?", false)
+	}
+	if err := query.Find(&conflicts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list identity conflicts: %w", err)
+	}
+	return conflicts, nil
+}
+
+// ResolveIdentityConflict marks a conflict as reviewed; a check finding the
+// mismatch again opens a new one
+func (s *ShellyService) ResolveIdentityConflict(id uint) (*database.IdentityConflict, error) {
+	db := s.DB.GetDB()
+	var conflict database.IdentityConflict
+	if err := db.First(&conflict, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrIdentityConflictNotFound, id)
+		}
+		return nil, err
+	}
+	if !conflict.Resolved {
+		now := time.Now()
+		conflict.Resolved = true
+		conflict.ResolvedAt = &now
+		if err := db.Save(&conflict).Error; err != nil {
+			return nil, fmt.Errorf("failed to resolve identity conflict %d: %w", id, err)
+		}
+	}
+	return &conflict, nil
+}
+
+// StartIdentityChecks runs VerifyDeviceIdentities at startup and then every
+// identity.interval until the service stops, fixing what it can only when
+// identity.auto_fix is set. It does nothing when the check is disabled.
+func (s *ShellyService) StartIdentityChecks() {
+	if s.Config == nil || !s.Config.Identity.Enabled {
+		return
+	}
+	interval := s.Config.Identity.IntervalDuration()
+	fix := s.Config.Identity.AutoFix
+
+	go func() {
+		ticker := s.clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if s.leader == nil || s.leader() {
+				if _, err := s.VerifyDeviceIdentities(s.ctx, fix); err != nil && s.ctx.Err() == nil {
+					s.logger.WithFields(map[string]any{
+						"error":     err.Error(),
+						"component": "identity",
+					}).Warn("Device identity check failed")
+				}
+			}
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]any{
+		"interval":  interval.String(),
+		"auto_fix":  fix,
+		"component": "identity",
+	}).Info("Started device identity checks")
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_VerifyDeviceIdentities(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+
+	device := func(mac string) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"id": "shellyplus1-" + mac, "mac": mac, "model": "SNSW-001X16EU", "gen": 2, "ver": "1.4.2",
+			})
+		}))
+		t.Cleanup(server.Close)
+		return server.URL[len("http://"):]
+	}
+	addrA, addrB, addrC, addrD := device("AABBCCDDEE01"), device("AABBCCDDEE02"), device("AABBCCDDEE03"), device("AABBCCDDEE99")
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	// 1 and 2 swapped addresses, 4 is a duplicate of 3 at a dead address and
+	// a device nobody stored answers at 5's address
+	rows := []*database.Device{
+		{IP: addrB, MAC: "AABBCCDDEE01", Name: "One"},
+		{IP: addrA, MAC: "AABBCCDDEE02", Name: "Two"},
+		{IP: addrC, MAC: "aa:bb:cc:dd:ee:03", Name: "Three"},
+		{IP: "127.0.0.1:1", MAC: "AABBCCDDEE03", Name: "Three again"},
+		{IP: addrD, MAC: "AABBCCDDEE05", Name: "Five"},
+	}
+	for _, d := range rows {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	db.GetDB().Create(&database.DeviceReboot{DeviceID: rows[3].ID})
+
+	ctx := context.Background()
+	report, err := service.VerifyDeviceIdentities(ctx, false)
+	if err != nil {
+		t.Fatalf("VerifyDeviceIdentities failed: %v", err)
+	}
+	if len(report.Moved) != 2 || len(report.Merged) != 1 || report.Confirmed != 1 {
+		t.Fatalf("Expected a swap and a merge, got %+v", report)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Kind != IdentityWrongDevice || report.Conflicts[0].DeviceID != rows[4].ID {
+		t.Fatalf("Expected device 5 flagged, got %+v", report.Conflicts)
+	}
+	if stored, _ := db.GetDevice(rows[0].ID); stored.IP != addrB {
+		t.Errorf("Expected nothing changed without fix, got %s", stored.IP)
+	}
+
+	report, err = service.VerifyDeviceIdentities(ctx, true)
+	if err != nil {
+		t.Fatalf("VerifyDeviceIdentities failed: %v", err)
+	}
+	one, _ := db.GetDevice(rows[0].ID)
+	two, _ := db.GetDevice(rows[1].ID)
+	if one.IP != addrA || two.IP != addrB {
+		t.Errorf("Expected the addresses swapped, got %s and %s", one.IP, two.IP)
+	}
+	if _, err := db.GetDevice(rows[3].ID); err == nil {
+		t.Error("Expected the duplicate row to be removed")
+	}
+	var reboots int64
+	db.GetDB().Model(&database.DeviceReboot{}).Where("device_id = ?", rows[2].ID).Count(&reboots)
+	if reboots != 1 {
+		t.Errorf("Expected the duplicate's history moved, got %d rows", reboots)
+	}
+
+	// The open conflict is kept, not duplicated, until it is resolved
+	conflicts, err := service.ListIdentityConflicts(false)
+	if err != nil || len(conflicts) != 1 || conflicts[0].ID != report.Conflicts[0].ID {
+		t.Fatalf("Expected one open conflict, got %+v, %v", conflicts, err)
+	}
+	if _, err := service.ResolveIdentityConflict(conflicts[0].ID); err != nil {
+		t.Fatalf("ResolveIdentityConflict failed: %v", err)
+	}
+	if conflicts, _ = service.ListIdentityConflicts(false); len(conflicts) != 0 {
+		t.Errorf("Expected no open conflicts, got %+v", conflicts)
+	}
+	if _, err := service.ResolveIdentityConflict(999); !errors.Is(err, ErrIdentityConflictNotFound) {
+		t.Errorf("Expected an unknown conflict to be reported, got %v", err)
+	}
+
+	// Nothing is left to move once every device is where it is stored
+	if report, err = service.VerifyDeviceIdentities(ctx, true); err != nil || len(report.Moved) != 0 || report.Confirmed != 3 {
+		t.Errorf("Expected every device confirmed, got %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// CheckIntegrity reports stored configs, history and other rows that refer
+// to deleted devices; with cleanup they are deleted
+func (s *ShellyService) CheckIntegrity(cleanup bool) (*database.IntegrityReport, error) {
+	report, err := database.CheckDeviceReferences(s.DB.GetDB(), cleanup, s.logger)
+	if err != nil {
+		return nil, err
+	}
+	if report.OrphanedRows > 0 || report.OrphanedBlobs > 0 {
+		msg := "Found rows referring to deleted devices"
+		if report.CleanedUp {
+			msg = "Removed rows referring to deleted devices"
+		}
+		s.logger.WithFields(map[string]any{
+			"orphaned_rows":  report.OrphanedRows,
+			"orphaned_blobs": report.OrphanedBlobs,
+			"tables":         len(report.Orphans),
+			"component":      "integrity",
+		}).Warn(msg)
+	}
+	return report, nil
+}
+
+// RelinkDeviceHistory moves the history of a device, which may already be
+// deleted, to the device that replaced it
+func (s *ShellyService) RelinkDeviceHistory(fromID, toID uint) ([]database.RelinkedRows, error) {
+	relinked, err := database.RelinkDeviceReferences(s.DB.GetDB(), fromID, toID)
+	if err != nil {
+		if errors.Is(err, database.ErrRelinkTarget) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to relink device %d: %w", fromID, err)
+	}
+	s.logger.WithFields(map[string]any{
+		"from_device_id": fromID,
+		"to_device_id":   toID,
+		"tables":         len(relinked),
+		"component":      "integrity",
+	}).Info("Moved device history to another device")
+	return relinked, nil
+}
+
+// StartIntegrityChecks runs CheckIntegrity at startup and then every
+// integrity.interval until the service stops, deleting what it finds only
+// when integrity.cleanup is set. It does nothing when the check is disabled.
+func (s *ShellyService) StartIntegrityChecks() {
+	if s.Config == nil || !s.Config.Integrity.Enabled {
+		return
+	}
+	interval := s.Config.Integrity.IntervalDuration()
+	cleanup := s.Config.Integrity.Cleanup
+
+	go func() {
+		ticker := s.clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if s.leader == nil || s.leader() {
+				if _, err := s.CheckIntegrity(cleanup); err != nil {
+					s.logger.WithFields(map[string]any{
+						"error":     err.Error(),
+						"component": "integrity",
+					}).Warn("Integrity check failed")
+				}
+			}
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]any{
+		"interval":  interval.String(),
+		"cleanup":   cleanup,
+		"component": "integrity",
+	}).Info("Started integrity checks")
+}
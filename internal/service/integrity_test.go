@@ -0,0 +1,58 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_CheckIntegrity(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	old := &database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Type: "SHSW-1", Name: "Old"}
+	replacement := &database.Device{IP: "192.0.2.2", MAC: "AABBCCDDEE02", Type: "SNSW-001X16EU", Name: "New"}
+	for _, d := range []*database.Device{old, replacement} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	gdb := db.GetDB()
+	gdb.Create(&configuration.DeviceConfig{DeviceID: old.ID, Config: json.RawMessage(`{}`)})
+	gdb.Create(&configuration.DriftTrend{DeviceID: old.ID, Path: "wifi.ssid"})
+	gdb.Create(&database.DeviceReboot{DeviceID: old.ID})
+	gdb.Exec("DELETE FROM devices WHERE id = ?", old.ID)
+
+	report, err := service.CheckIntegrity(false)
+	if err != nil {
+		t.Fatalf("CheckIntegrity failed: %v", err)
+	}
+	if report.OrphanedRows != 3 || report.CleanedUp {
+		t.Fatalf("Expected 3 orphaned rows reported, got %+v", report)
+	}
+
+	if _, err := service.RelinkDeviceHistory(old.ID, old.ID); !errors.Is(err, database.ErrRelinkTarget) {
+		t.Errorf("Expected relinking a device to itself to be refused, got %v", err)
+	}
+	relinked, err := service.RelinkDeviceHistory(old.ID, replacement.ID)
+	if err != nil {
+		t.Fatalf("RelinkDeviceHistory failed: %v", err)
+	}
+	if len(relinked) != 3 {
+		t.Errorf("Expected 3 tables relinked, got %+v", relinked)
+	}
+
+	report, err = service.CheckIntegrity(true)
+	if err != nil || report.OrphanedRows != 0 {
+		t.Errorf("Expected no orphans after relinking, got %+v, %v", report, err)
+	}
+	var trends int64
+	gdb.Model(&configuration.DriftTrend{}).Where("device_id = ?", replacement.ID).Count(&trends)
+	if trends != 1 {
+		t.Errorf("Expected the drift trend to follow the replacement, got %d", trends)
+	}
+}
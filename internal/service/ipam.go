@@ -0,0 +1,644 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/opnsense"
+)
+
+const (
+	// defaultFreeAddresses is the number of suggestions FreeAddresses returns by default
+	defaultFreeAddresses = 10
+	// maxFreeAddresses caps the suggestions per request
+	maxFreeAddresses = 256
+	// minSubnetBits and maxSubnetBits bound subnet sizes: plans walk every
+	// address of a subnet, so a /16 (65536 addresses) is the largest
+	minSubnetBits = 16
+	maxSubnetBits = 30
+)
+
+// IP plan conflict types
+const (
+	IPConflictDuplicate     = "duplicate"      // several devices use or are configured with the address
+	IPConflictOutsideSubnet = "outside_subnet" // static address in no declared subnet
+	IPConflictReservedRange = "reserved_range" // static address inside a reserved range
+	IPConflictGateway       = "gateway"        // static address is the subnet gateway
+	IPConflictNetwork       = "network"        // static address is the network or broadcast address
+)
+
+var (
+	// ErrSubnetNotFound is returned for unknown subnet or reserved range IDs
+	ErrSubnetNotFound = errors.New("subnet not found")
+	// ErrInvalidIPPlan wraps subnet, range and plan validation failures
+	ErrInvalidIPPlan = errors.New("invalid ip plan")
+)
+
+// IPPlanDevice is the addressing of one inventory device
+type IPPlanDevice struct {
+	DeviceID  uint   `json:"device_id"`
+	Name      string `json:"name"`
+	MAC       string `json:"mac"`
+	CurrentIP string `json:"current_ip"`
+	Mode      string `json:"mode"` // static, dhcp or unknown when no configuration is stored
+	StaticIP  string `json:"static_ip,omitempty"`
+	Subnet    string `json:"subnet,omitempty"`
+}
+
+// IPConflict is an addressing problem found in the plan
+type IPConflict struct {
+	Type      string `json:"type"`
+	IP        string `json:"ip"`
+	DeviceIDs []uint `json:"device_ids"`
+	Detail    string `json:"detail"`
+}
+
+// IPPlanSubnet is a declared subnet with its address usage
+type IPPlanSubnet struct {
+	database.IPSubnet
+	Size     int `json:"size"`     // usable host addresses
+	Used     int `json:"used"`     // addresses used or configured by devices
+	Reserved int `json:"reserved"` // addresses in reserved ranges
+	Free     int `json:"free"`
+}
+
+// IPPlanReport is the address management view over the inventory
+type IPPlanReport struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Subnets     []IPPlanSubnet `json:"subnets"`
+	Devices     []IPPlanDevice `json:"devices"`
+	Conflicts   []IPConflict   `json:"conflicts"`
+}
+
+// IPPlanRequest selects devices that get a static address in a subnet
+type IPPlanRequest struct {
+	SubnetID  uint   `json:"subnet_id"`
+	DeviceIDs []uint `json:"device_ids,omitempty"` // empty selects every device
+	Tag       string `json:"tag,omitempty"`        // restrict to devices carrying this tag
+}
+
+// IPPlanChange is the generated static addressing for one device
+type IPPlanChange struct {
+	DeviceID    uint                      `json:"device_id"`
+	Name        string                    `json:"name"`
+	MAC         string                    `json:"mac"`
+	CurrentIP   string                    `json:"current_ip"`
+	AssignedIP  string                    `json:"assigned_ip,omitempty"`
+	Changed     bool                      `json:"changed"` // the device is not yet configured this way
+	Config      map[string]interface{}    `json:"config,omitempty"`
+	Reservation *opnsense.DHCPReservation `json:"dhcp_reservation,omitempty"`
+	Error       string                    `json:"error,omitempty"`
+}
+
+// ipamSubnet is a declared subnet with parsed addresses
+type ipamSubnet struct {
+	subnet  database.IPSubnet
+	prefix  netip.Prefix
+	gateway netip.Addr
+	ranges  [][2]netip.Addr
+}
+
+// ipamDevice is an inventory device with parsed addresses
+type ipamDevice struct {
+	device   database.Device
+	current  netip.Addr
+	static   netip.Addr
+	mode     string
+	settings map[string]interface{}
+}
+
+// ListSubnets returns the declared subnets with their reserved ranges
+func (s *ShellyService) ListSubnets() ([]database.IPSubnet, error) {
+	subnets := []database.IPSubnet{}
+	if err := s.DB.GetDB().Preload("Ranges").Order("id").Find(&subnets).Error; err != nil {
+		return nil, fmt.Errorf("failed to load subnets: %w", err)
+	}
+	return subnets, nil
+}
+
+// CreateSubnet declares an IPv4 subnet between /16 and /30. Overlapping
+// subnets are rejected.
+func (s *ShellyService) CreateSubnet(subnet *database.IPSubnet) error {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(subnet.CIDR))
+	if err != nil || !prefix.Addr().Is4() || prefix.Bits() < minSubnetBits || prefix.Bits() > maxSubnetBits {
+		return fmt.Errorf("%w: cidr must be an IPv4 network between /%d and /%d", ErrInvalidIPPlan, minSubnetBits, maxSubnetBits)
+	}
+	prefix = prefix.Masked()
+	subnet.CIDR = prefix.String()
+	if subnet.Gateway != "" {
+		gw, err := netip.ParseAddr(subnet.Gateway)
+		if err != nil || !prefix.Contains(gw) {
+			return fmt.Errorf("%w: gateway %s is not in %s", ErrInvalidIPPlan, subnet.Gateway, subnet.CIDR)
+		}
+	}
+	if subnet.DNS != "" {
+		if _, err := netip.ParseAddr(subnet.DNS); err != nil {
+			return fmt.Errorf("%w: invalid dns address %s", ErrInvalidIPPlan, subnet.DNS)
+		}
+	}
+	if subnet.Name == "" {
+		subnet.Name = subnet.CIDR
+	}
+
+	existing, err := s.ListSubnets()
+	if err != nil {
+		return err
+	}
+	for _, e := range existing {
+		if other, err := netip.ParsePrefix(e.CIDR); err == nil && other.Overlaps(prefix) {
+			return fmt.Errorf("%w: %s overlaps subnet %s", ErrInvalidIPPlan, subnet.CIDR, e.CIDR)
+		}
+	}
+	subnet.ID = 0
+	subnet.Ranges = nil
+	if err := s.DB.GetDB().Create(subnet).Error; err != nil {
+		return fmt.Errorf("failed to create subnet: %w", err)
+	}
+	subnet.Ranges = []database.IPReservedRange{}
+	return nil
+}
+
+// DeleteSubnet removes a subnet and its reserved ranges
+func (s *ShellyService) DeleteSubnet(id uint) error {
+	db := s.DB.GetDB()
+	if err := db.Where("subnet_id = ?", id).Delete(&database.IPReservedRange{}).Error; err != nil {
+		return fmt.Errorf("failed to delete reserved ranges: %w", err)
+	}
+	res := db.Delete(&database.IPSubnet{}, id)
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete subnet: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrSubnetNotFound
+	}
+	return nil
+}
+
+// AddReservedRange reserves an address range inside a subnet
+func (s *ShellyService) AddReservedRange(subnetID uint, r *database.IPReservedRange) error {
+	var subnet database.IPSubnet
+	if err := s.DB.GetDB().First(&subnet, subnetID).Error; err != nil {
+		return ErrSubnetNotFound
+	}
+	prefix, err := netip.ParsePrefix(subnet.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid stored subnet %s: %w", subnet.CIDR, err)
+	}
+	start, err1 := netip.ParseAddr(r.StartIP)
+	end, err2 := netip.ParseAddr(r.EndIP)
+	if err1 != nil || err2 != nil || !prefix.Contains(start) || !prefix.Contains(end) {
+		return fmt.Errorf("%w: range must lie within %s", ErrInvalidIPPlan, subnet.CIDR)
+	}
+	if end.Less(start) {
+		return fmt.Errorf("%w: start_ip must not be after end_ip", ErrInvalidIPPlan)
+	}
+	r.ID = 0
+	r.SubnetID = subnetID
+	if err := s.DB.GetDB().Create(r).Error; err != nil {
+		return fmt.Errorf("failed to create reserved range: %w", err)
+	}
+	return nil
+}
+
+// DeleteReservedRange removes a reserved range from a subnet
+func (s *ShellyService) DeleteReservedRange(subnetID, rangeID uint) error {
+	res := s.DB.GetDB().Where("subnet_id = ?", subnetID).Delete(&database.IPReservedRange{}, rangeID)
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete reserved range: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrSubnetNotFound
+	}
+	return nil
+}
+
+// FreeAddresses suggests up to count addresses in a subnet that no device
+// uses or is configured with and that are outside reserved ranges
+func (s *ShellyService) FreeAddresses(subnetID uint, count int) ([]string, error) {
+	if count <= 0 {
+		count = defaultFreeAddresses
+	}
+	if count > maxFreeAddresses {
+		count = maxFreeAddresses
+	}
+	subnets, devices, err := s.loadIPAM()
+	if err != nil {
+		return nil, err
+	}
+	subnet := findIPAMSubnet(subnets, subnetID)
+	if subnet == nil {
+		return nil, ErrSubnetNotFound
+	}
+	used := usedAddresses(devices)
+	free := []string{}
+	for addr := firstHost(subnet.prefix); len(free) < count && subnet.prefix.Contains(addr); addr = addr.Next() {
+		if subnet.assignable(addr) && len(used[addr]) == 0 {
+			free = append(free, addr.String())
+		}
+	}
+	return free, nil
+}
+
+// IPPlan reports subnet usage and the addressing of every device, with
+// duplicate and misplaced static addresses as conflicts. Static addresses are
+// read from the device configurations stored at import.
+func (s *ShellyService) IPPlan() (*IPPlanReport, error) {
+	subnets, devices, err := s.loadIPAM()
+	if err != nil {
+		return nil, err
+	}
+	used := usedAddresses(devices)
+	report := &IPPlanReport{GeneratedAt: time.Now(), Subnets: []IPPlanSubnet{}, Devices: []IPPlanDevice{}, Conflicts: []IPConflict{}}
+
+	for _, sn := range subnets {
+		entry := IPPlanSubnet{IPSubnet: sn.subnet}
+		for addr := firstHost(sn.prefix); sn.prefix.Contains(addr) && addr != lastAddr(sn.prefix); addr = addr.Next() {
+			entry.Size++
+			switch {
+			case len(used[addr]) > 0:
+				entry.Used++
+			case sn.inReservedRange(addr):
+				entry.Reserved++
+			case sn.assignable(addr):
+				entry.Free++
+			}
+		}
+		report.Subnets = append(report.Subnets, entry)
+	}
+
+	for _, d := range devices {
+		entry := IPPlanDevice{DeviceID: d.device.ID, Name: d.device.Name, MAC: d.device.MAC, Mode: d.mode}
+		if d.current.IsValid() {
+			entry.CurrentIP = d.current.String()
+		}
+		addr := d.current
+		if d.static.IsValid() {
+			entry.StaticIP = d.static.String()
+			addr = d.static
+		}
+		if sn := subnetFor(subnets, addr); sn != nil {
+			entry.Subnet = sn.subnet.Name
+		}
+		report.Devices = append(report.Devices, entry)
+	}
+
+	addrs := make([]netip.Addr, 0, len(used))
+	for addr := range used {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Less(addrs[j]) })
+	for _, addr := range addrs {
+		if ids := used[addr]; len(ids) > 1 {
+			report.Conflicts = append(report.Conflicts, IPConflict{
+				Type: IPConflictDuplicate, IP: addr.String(), DeviceIDs: ids,
+				Detail: fmt.Sprintf("%d devices use or are configured with this address", len(ids)),
+			})
+		}
+	}
+	for _, d := range devices {
+		if !d.static.IsValid() {
+			continue
+		}
+		ids := []uint{d.device.ID}
+		sn := subnetFor(subnets, d.static)
+		switch {
+		case sn == nil && len(subnets) > 0:
+			report.Conflicts = append(report.Conflicts, IPConflict{Type: IPConflictOutsideSubnet, IP: d.static.String(), DeviceIDs: ids,
+				Detail: "static address is not in any declared subnet"})
+		case sn == nil:
+		case d.static == sn.prefix.Addr() || d.static == lastAddr(sn.prefix):
+			report.Conflicts = append(report.Conflicts, IPConflict{Type: IPConflictNetwork, IP: d.static.String(), DeviceIDs: ids,
+				Detail: fmt.Sprintf("static address is the network or broadcast address of %s", sn.subnet.CIDR)})
+		case d.static == sn.gateway:
+			report.Conflicts = append(report.Conflicts, IPConflict{Type: IPConflictGateway, IP: d.static.String(), DeviceIDs: ids,
+				Detail: fmt.Sprintf("static address is the gateway of %s", sn.subnet.CIDR)})
+		case sn.inReservedRange(d.static):
+			report.Conflicts = append(report.Conflicts, IPConflict{Type: IPConflictReservedRange, IP: d.static.String(), DeviceIDs: ids,
+				Detail: fmt.Sprintf("static address is in a reserved range of %s", sn.subnet.CIDR)})
+		}
+	}
+	return report, nil
+}
+
+// GenerateIPPlan assigns each selected device a static address in a subnet
+// and returns the device network configuration and DHCP reservation for it.
+// A device keeps its static or current address when that is usable in the
+// subnet; otherwise the next free address is taken. Nothing is applied.
+func (s *ShellyService) GenerateIPPlan(req IPPlanRequest) ([]IPPlanChange, error) {
+	subnets, devices, err := s.loadIPAM()
+	if err != nil {
+		return nil, err
+	}
+	subnet := findIPAMSubnet(subnets, req.SubnetID)
+	if subnet == nil {
+		return nil, ErrSubnetNotFound
+	}
+
+	selected, err := s.SelectDevices(req.DeviceIDs, req.Tag)
+	if err != nil {
+		return nil, err
+	}
+	inPlan := make(map[uint]bool, len(selected))
+	for _, d := range selected {
+		inPlan[d.ID] = true
+	}
+	targets := []ipamDevice{}
+	for _, d := range devices {
+		if inPlan[d.device.ID] {
+			targets = append(targets, d)
+		}
+	}
+
+	// Addresses devices hold now and static addresses of devices left out of
+	// the plan are taken; the static addresses of planned devices are replaced
+	planned := make(map[uint]bool, len(targets))
+	for _, d := range targets {
+		planned[d.device.ID] = true
+	}
+	taken := map[netip.Addr][]uint{}
+	for _, d := range devices {
+		if d.current.IsValid() && !d.current.IsLoopback() {
+			taken[d.current] = append(taken[d.current], d.device.ID)
+		}
+		if d.static.IsValid() && d.static != d.current && !planned[d.device.ID] {
+			taken[d.static] = append(taken[d.static], d.device.ID)
+		}
+	}
+	usable := func(addr netip.Addr, id uint) bool {
+		if !addr.IsValid() || !subnet.prefix.Contains(addr) || !subnet.assignable(addr) {
+			return false
+		}
+		for _, other := range taken[addr] {
+			if other != id {
+				return false
+			}
+		}
+		return true
+	}
+	mask := net.IP(net.CIDRMask(subnet.prefix.Bits(), 32)).String()
+
+	changes := []IPPlanChange{}
+	for _, d := range targets {
+		change := IPPlanChange{DeviceID: d.device.ID, Name: d.device.Name, MAC: d.device.MAC}
+		if d.current.IsValid() {
+			change.CurrentIP = d.current.String()
+		}
+
+		var addr netip.Addr
+		switch {
+		case usable(d.static, d.device.ID):
+			addr = d.static
+		case usable(d.current, d.device.ID):
+			addr = d.current
+		default:
+			for a := firstHost(subnet.prefix); subnet.prefix.Contains(a); a = a.Next() {
+				if len(taken[a]) == 0 && subnet.assignable(a) {
+					addr = a
+					break
+				}
+			}
+		}
+		if !addr.IsValid() {
+			change.Error = fmt.Sprintf("no free address left in %s", subnet.subnet.CIDR)
+			changes = append(changes, change)
+			continue
+		}
+		taken[addr] = append(taken[addr], d.device.ID)
+
+		change.AssignedIP = addr.String()
+		change.Changed = d.mode != "static" || d.static != addr
+		change.Config = staticIPConfig(deviceGeneration(d.settings), addr.String(), mask, subnet.subnet.Gateway, subnet.subnet.DNS)
+		change.Reservation = &opnsense.DHCPReservation{
+			MAC:         d.device.MAC,
+			IP:          addr.String(),
+			Hostname:    reservationHostname(d.device),
+			Description: d.device.Name,
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// loadIPAM reads the declared subnets and every device with its addresses
+func (s *ShellyService) loadIPAM() ([]ipamSubnet, []ipamDevice, error) {
+	stored, err := s.ListSubnets()
+	if err != nil {
+		return nil, nil, err
+	}
+	subnets := make([]ipamSubnet, 0, len(stored))
+	for _, sn := range stored {
+		prefix, err := netip.ParsePrefix(sn.CIDR)
+		if err != nil {
+			continue
+		}
+		entry := ipamSubnet{subnet: sn, prefix: prefix}
+		entry.gateway, _ = netip.ParseAddr(sn.Gateway)
+		for _, r := range sn.Ranges {
+			start, err1 := netip.ParseAddr(r.StartIP)
+			end, err2 := netip.ParseAddr(r.EndIP)
+			if err1 == nil && err2 == nil {
+				entry.ranges = append(entry.ranges, [2]netip.Addr{start, end})
+			}
+		}
+		subnets = append(subnets, entry)
+	}
+
+	list, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	var configs []configuration.DeviceConfig
+	if err := s.DB.GetDB().Find(&configs).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load device configurations: %w", err)
+	}
+	configured := make(map[uint]map[string]interface{}, len(configs))
+	for _, c := range configs {
+		var cfg map[string]interface{}
+		if json.Unmarshal(c.Config, &cfg) == nil {
+			configured[c.DeviceID] = cfg
+		}
+	}
+
+	devices := make([]ipamDevice, 0, len(list))
+	for _, d := range list {
+		entry := ipamDevice{device: d, mode: "unknown"}
+		host := d.IP
+		if h, _, err := net.SplitHostPort(d.IP); err == nil {
+			host = h
+		}
+		entry.current, _ = netip.ParseAddr(host)
+		if cfg, ok := configured[d.ID]; ok {
+			var static string
+			entry.mode, static = configuredIPv4(cfg)
+			entry.static, _ = netip.ParseAddr(static)
+		}
+		_ = json.Unmarshal([]byte(d.Settings), &entry.settings)
+		devices = append(devices, entry)
+	}
+	return subnets, devices, nil
+}
+
+// configuredIPv4 returns the IPv4 mode and static address of a stored device
+// configuration: Gen1 wifi_sta, Gen2 wifi.sta or eth
+func configuredIPv4(cfg map[string]interface{}) (string, string) {
+	mode := "unknown"
+	if sta := mapAt(cfg, "wifi_sta"); sta != nil {
+		switch stringAt(sta, "ipv4_method") {
+		case "static":
+			return "static", stringAt(sta, "ip")
+		case "dhcp":
+			mode = "dhcp"
+		}
+	}
+	for _, path := range [][]string{{"wifi", "sta"}, {"eth"}} {
+		c := mapAt(cfg, path...)
+		if c == nil {
+			continue
+		}
+		switch stringAt(c, "ipv4mode") {
+		case "static":
+			return "static", stringAt(c, "ip")
+		case "dhcp":
+			mode = "dhcp"
+		}
+	}
+	return mode, ""
+}
+
+// staticIPConfig returns the configuration change that sets a static address
+// on the station interface, in the device generation's layout
+func staticIPConfig(gen int, ip, mask, gateway, dns string) map[string]interface{} {
+	if gen >= 2 {
+		sta := map[string]interface{}{"ipv4mode": "static", "ip": ip, "netmask": mask}
+		if gateway != "" {
+			sta["gw"] = gateway
+		}
+		if dns != "" {
+			sta["nameserver"] = dns
+		}
+		return map[string]interface{}{"wifi": map[string]interface{}{"sta": sta}}
+	}
+	sta := map[string]interface{}{"ipv4_method": "static", "ip": ip, "mask": mask}
+	if gateway != "" {
+		sta["gw"] = gateway
+	}
+	if dns != "" {
+		sta["dns"] = dns
+	}
+	return map[string]interface{}{"wifi_sta": sta}
+}
+
+// deviceGeneration returns the generation recorded in device settings, 1 if unknown
+func deviceGeneration(settings map[string]interface{}) int {
+	if gen, ok := settings["gen"].(float64); ok && gen > 0 {
+		return int(gen)
+	}
+	return 1
+}
+
+var hostnameUnsafe = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// reservationHostname derives a DHCP hostname from the device name, falling
+// back to shelly-<last six MAC digits>
+func reservationHostname(device database.Device) string {
+	name := strings.Trim(hostnameUnsafe.ReplaceAllString(strings.ToLower(device.Name), "-"), "-")
+	if name != "" {
+		if len(name) > 63 {
+			name = strings.TrimRight(name[:63], "-")
+		}
+		return name
+	}
+	mac := strings.ToLower(strings.NewReplacer(":", "", "-", "").Replace(device.MAC))
+	if len(mac) > 6 {
+		mac = mac[len(mac)-6:]
+	}
+	return "shelly-" + mac
+}
+
+// usedAddresses maps each address a device uses or is configured with to
+// the device IDs
+func usedAddresses(devices []ipamDevice) map[netip.Addr][]uint {
+	used := map[netip.Addr][]uint{}
+	for _, d := range devices {
+		for _, addr := range []netip.Addr{d.current, d.static} {
+			if !addr.IsValid() || addr.IsLoopback() {
+				continue
+			}
+			ids := used[addr]
+			if len(ids) == 0 || ids[len(ids)-1] != d.device.ID {
+				used[addr] = append(ids, d.device.ID)
+			}
+		}
+	}
+	return used
+}
+
+// findIPAMSubnet returns the subnet with the given ID, or nil
+func findIPAMSubnet(subnets []ipamSubnet, id uint) *ipamSubnet {
+	for i := range subnets {
+		if subnets[i].subnet.ID == id {
+			return &subnets[i]
+		}
+	}
+	return nil
+}
+
+// subnetFor returns the subnet containing addr, or nil
+func subnetFor(subnets []ipamSubnet, addr netip.Addr) *ipamSubnet {
+	if !addr.IsValid() {
+		return nil
+	}
+	for i := range subnets {
+		if subnets[i].prefix.Contains(addr) {
+			return &subnets[i]
+		}
+	}
+	return nil
+}
+
+// inReservedRange reports whether addr lies in one of the subnet's reserved ranges
+func (sn *ipamSubnet) inReservedRange(addr netip.Addr) bool {
+	for _, r := range sn.ranges {
+		if !addr.Less(r[0]) && !r[1].Less(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// assignable reports whether addr may be given to a device: a host address
+// that is not the gateway, the DNS server or in a reserved range
+func (sn *ipamSubnet) assignable(addr netip.Addr) bool {
+	if addr == sn.prefix.Addr() || addr == lastAddr(sn.prefix) || addr == sn.gateway {
+		return false
+	}
+	if sn.subnet.DNS != "" && addr.String() == sn.subnet.DNS {
+		return false
+	}
+	return !sn.inReservedRange(addr)
+}
+
+// firstHost returns the first host address of an IPv4 prefix
+func firstHost(prefix netip.Prefix) netip.Addr {
+	return prefix.Masked().Addr().Next()
+}
+
+// lastAddr returns the broadcast address of an IPv4 prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	a := prefix.Masked().Addr().As4()
+	hostBits := 32 - prefix.Bits()
+	v := uint32(a[0])<<24 | uint32(a[1])<<16 | uint32(a[2])<<8 | uint32(a[3])
+	v |= uint32(1)<<hostBits - 1
+	return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
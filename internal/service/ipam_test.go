@@ -0,0 +1,127 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_IPPlan(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	subnet := &database.IPSubnet{Name: "iot", CIDR: "192.168.10.7/24", Gateway: "192.168.10.1"}
+	if err := service.CreateSubnet(subnet); err != nil {
+		t.Fatalf("CreateSubnet failed: %v", err)
+	}
+	if subnet.CIDR != "192.168.10.0/24" {
+		t.Errorf("Expected masked CIDR, got %s", subnet.CIDR)
+	}
+	if err := service.CreateSubnet(&database.IPSubnet{CIDR: "192.168.0.0/16"}); !errors.Is(err, ErrInvalidIPPlan) {
+		t.Errorf("Expected overlap to be rejected, got %v", err)
+	}
+	for _, cidr := range []string{"10.0.0.0/8", "0.0.0.0/0", "10.1.1.0/31"} {
+		if err := service.CreateSubnet(&database.IPSubnet{CIDR: cidr}); !errors.Is(err, ErrInvalidIPPlan) {
+			t.Errorf("Expected %s to be rejected as too large or too small, got %v", cidr, err)
+		}
+	}
+	if err := service.AddReservedRange(subnet.ID, &database.IPReservedRange{StartIP: "192.168.10.100", EndIP: "192.168.10.199", Purpose: "dhcp_pool"}); err != nil {
+		t.Fatalf("AddReservedRange failed: %v", err)
+	}
+	if err := service.AddReservedRange(subnet.ID, &database.IPReservedRange{StartIP: "192.168.11.1", EndIP: "192.168.11.2"}); !errors.Is(err, ErrInvalidIPPlan) {
+		t.Errorf("Expected range outside the subnet to be rejected, got %v", err)
+	}
+
+	gen1Static := func(ip string) string {
+		return `{"wifi_sta": {"enabled": true, "ipv4_method": "static", "ip": "` + ip + `"}}`
+	}
+	devices := []struct {
+		ip, mac, settings, config string
+	}{
+		{"192.168.10.20", "68C63A000001", `{"gen":1}`, gen1Static("192.168.10.20")},
+		{"192.168.10.150", "68C63A000002", `{"gen":1}`, `{"wifi_sta": {"ipv4_method": "dhcp"}}`},
+		{"192.168.10.21", "68C63A000003", `{"gen":1}`, gen1Static("192.168.10.20")},
+		{"192.168.10.120", "68C63A000004", `{"gen":1}`, gen1Static("192.168.10.120")},
+		{"10.0.0.5", "68C63A000005", `{"gen":2}`, `{"wifi": {"sta": {"ipv4mode": "static", "ip": "10.0.0.5"}}}`},
+	}
+	for i, d := range devices {
+		device := &database.Device{IP: d.ip, MAC: d.mac, Name: "Plug " + string(rune('A'+i)), Settings: d.settings}
+		if err := db.AddDevice(device); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		if err := db.GetDB().Create(&configuration.DeviceConfig{DeviceID: device.ID, Config: json.RawMessage(d.config)}).Error; err != nil {
+			t.Fatalf("Failed to store device config: %v", err)
+		}
+	}
+
+	report, err := service.IPPlan()
+	if err != nil {
+		t.Fatalf("IPPlan failed: %v", err)
+	}
+	conflicts := map[string]string{}
+	for _, c := range report.Conflicts {
+		conflicts[c.Type] = c.IP
+	}
+	want := map[string]string{
+		IPConflictDuplicate:     "192.168.10.20",
+		IPConflictReservedRange: "192.168.10.120",
+		IPConflictOutsideSubnet: "10.0.0.5",
+	}
+	for typ, ip := range want {
+		if conflicts[typ] != ip {
+			t.Errorf("Expected %s conflict on %s, got %v", typ, ip, report.Conflicts)
+		}
+	}
+	if len(report.Subnets) != 1 || report.Subnets[0].Size != 254 || report.Subnets[0].Used != 4 {
+		t.Errorf("Unexpected subnet usage: %+v", report.Subnets)
+	}
+
+	free, err := service.FreeAddresses(subnet.ID, 3)
+	if err != nil {
+		t.Fatalf("FreeAddresses failed: %v", err)
+	}
+	if len(free) != 3 || free[0] != "192.168.10.2" || free[2] != "192.168.10.4" {
+		t.Errorf("Unexpected free addresses: %v", free)
+	}
+
+	changes, err := service.GenerateIPPlan(IPPlanRequest{SubnetID: subnet.ID})
+	if err != nil {
+		t.Fatalf("GenerateIPPlan failed: %v", err)
+	}
+	assigned := []string{}
+	for _, c := range changes {
+		assigned = append(assigned, c.AssignedIP)
+	}
+	expected := []string{"192.168.10.20", "192.168.10.2", "192.168.10.21", "192.168.10.3", "192.168.10.4"}
+	for i := range expected {
+		if i >= len(assigned) || assigned[i] != expected[i] {
+			t.Fatalf("Expected assignments %v, got %v", expected, assigned)
+		}
+	}
+	if changes[0].Changed || !changes[1].Changed {
+		t.Errorf("Unexpected changed flags: %+v", changes[:2])
+	}
+	if sta := mapAt(changes[1].Config, "wifi_sta"); sta["ipv4_method"] != "static" || sta["mask"] != "255.255.255.0" || sta["gw"] != "192.168.10.1" {
+		t.Errorf("Unexpected Gen1 config: %v", changes[1].Config)
+	}
+	if sta := mapAt(changes[4].Config, "wifi", "sta"); sta["ipv4mode"] != "static" || sta["ip"] != "192.168.10.4" {
+		t.Errorf("Unexpected Gen2 config: %v", changes[4].Config)
+	}
+	if r := changes[1].Reservation; r == nil || r.MAC != "68C63A000002" || r.IP != "192.168.10.2" || r.Hostname != "plug-b" {
+		t.Errorf("Unexpected reservation: %+v", r)
+	}
+
+	if _, err := service.GenerateIPPlan(IPPlanRequest{SubnetID: 99}); !errors.Is(err, ErrSubnetNotFound) {
+		t.Errorf("Expected ErrSubnetNotFound, got %v", err)
+	}
+	if err := service.DeleteSubnet(subnet.ID); err != nil {
+		t.Fatalf("DeleteSubnet failed: %v", err)
+	}
+	if subnets, _ := service.ListSubnets(); len(subnets) != 0 {
+		t.Errorf("Expected no subnets, got %v", subnets)
+	}
+}
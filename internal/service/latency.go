@@ -0,0 +1,529 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// Latency tracking defaults
+const (
+	defaultLatencySlowMs     = 1000
+	defaultLatencyDays       = 30
+	defaultLatencyHourlyDays = 7
+
+	// latencyWindow is how many recent requests per device the link state
+	// is derived from
+	latencyWindow = 12
+
+	// latencyDeadAfter consecutive failed requests make a device dead
+	latencyDeadAfter = 3
+
+	// latencyLossyPercent of failed requests in the window make a device
+	// that still answers lossy
+	latencyLossyPercent = 20
+)
+
+// Link states of a device, derived from its recent status requests
+const (
+	LinkUnknown = "unknown" // no requests yet
+	LinkHealthy = "healthy"
+	LinkSlow    = "slow"  // answers, but slower than the threshold
+	LinkLossy   = "lossy" // answers, but misses requests
+	LinkDead    = "dead"  // the latest requests all failed
+)
+
+// Resolutions of a latency trend
+const (
+	LatencyResolutionHour = "hour"
+	LatencyResolutionDay  = "day"
+)
+
+// ErrInvalidLatencyResolution is returned for a trend resolution other than
+// hour or day
+var ErrInvalidLatencyResolution = errors.New("invalid latency resolution: use hour or day")
+
+// linkRank orders link states worst first
+var linkRank = map[string]int{LinkDead: 0, LinkLossy: 1, LinkSlow: 2, LinkHealthy: 3, LinkUnknown: 4}
+
+// latencySample is one timed status request
+type latencySample struct {
+	ms float64
+	ok bool
+}
+
+// latencyHistory is a device's recent status requests, oldest first
+type latencyHistory struct {
+	samples     []latencySample
+	lastSuccess time.Time
+}
+
+// LatencyRecorder is told about every timed status request, e.g. to export it
+// as a metric
+type LatencyRecorder func(deviceID uint, deviceName string, latency time.Duration, ok bool)
+
+// LatencyPoint is one hour or day of a device's status requests, starting
+// at Hour
+type LatencyPoint struct {
+	Hour        time.Time `json:"hour"`
+	SpanHours   int       `json:"span_hours"`
+	Samples     int       `json:"samples"`
+	Failures    int       `json:"failures"`
+	LossPercent float64   `json:"loss_percent"`
+	AvgMs       float64   `json:"avg_ms"`
+	MaxMs       float64   `json:"max_ms"`
+}
+
+// DeviceLatencyTrend is a device's latency and failures per hour or day,
+// oldest first
+type DeviceLatencyTrend struct {
+	DeviceID   uint           `json:"device_id"`
+	Name       string         `json:"name"`
+	Link       string         `json:"link"`
+	Hours      int            `json:"hours"`
+	Resolution string         `json:"resolution"`
+	Points     []LatencyPoint `json:"points"`
+}
+
+// LatencySummary sums up a device's status requests over a period
+type LatencySummary struct {
+	DeviceID    uint       `json:"device_id"`
+	Name        string     `json:"name"`
+	IP          string     `json:"ip"`
+	Link        string     `json:"link"`
+	Samples     int        `json:"samples"`
+	Failures    int        `json:"failures"`
+	LossPercent float64    `json:"loss_percent"`
+	AvgMs       float64    `json:"avg_ms"`
+	MaxMs       float64    `json:"max_ms"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	// InMaintenance devices are listed last and left out of the counts
+	InMaintenance bool `json:"in_maintenance,omitempty"`
+}
+
+// NetworkReport lists the devices with the worst network performance: dead
+// devices first, then by packet loss and average latency
+type NetworkReport struct {
+	GeneratedAt     time.Time        `json:"generated_at"`
+	Hours           int              `json:"hours"`
+	SlowThresholdMs int              `json:"slow_threshold_ms"`
+	Devices         []LatencySummary `json:"devices"`
+	Dead            int              `json:"dead"`
+	Lossy           int              `json:"lossy"`
+	Slow            int              `json:"slow"`
+	InMaintenance   int              `json:"in_maintenance"`
+}
+
+// SetLatencyRecorder sets the callback told about every timed status request
+func (s *ShellyService) SetLatencyRecorder(fn LatencyRecorder) {
+	s.latencyMu.Lock()
+	defer s.latencyMu.Unlock()
+	s.latencyRecorder = fn
+}
+
+// latencySlowMs returns the average round trip above which a device is slow
+func (s *ShellyService) latencySlowMs() int {
+	if s.Config == nil || s.Config.Metrics.LatencySlowThreshold <= 0 {
+		return defaultLatencySlowMs
+	}
+	return s.Config.Metrics.LatencySlowThreshold
+}
+
+// latencyRetention returns how long latency rows are kept
+func (s *ShellyService) latencyRetention() time.Duration {
+	days := defaultLatencyDays
+	if s.Config != nil && s.Config.Metrics.RetentionDays > 0 {
+		days = s.Config.Metrics.RetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// latencyHourlyFrom returns the UTC day from which latency rows are still
+// hourly; older ones are rolled up into daily rows
+func (s *ShellyService) latencyHourlyFrom(now time.Time) time.Time {
+	days := defaultLatencyHourlyDays
+	if s.Config != nil && s.Config.Metrics.LatencyHourlyDays > 0 {
+		days = s.Config.Metrics.LatencyHourlyDays
+	}
+	return now.AddDate(0, 0, -days).UTC().Truncate(24 * time.Hour)
+}
+
+// readStatus reads a device's status and records the round trip for the
+// latency trends
+func (s *ShellyService) readStatus(ctx context.Context, client shelly.Client, device *database.Device) (*shelly.DeviceStatus, error) {
+	start := time.Now()
+	status, err := client.GetStatus(ctx)
+	// A request cut short by shutdown says nothing about the device
+	if !errors.Is(err, context.Canceled) {
+		s.recordLatency(device, time.Since(start), err == nil)
+	}
+	return status, err
+}
+
+// recordLatency adds a status request to the device's recent history and
+// its hourly row
+func (s *ShellyService) recordLatency(device *database.Device, latency time.Duration, ok bool) {
+	now := s.clock.Now()
+	ms := float64(latency.Microseconds()) / 1000
+
+	s.latencyMu.Lock()
+	if s.latency == nil {
+		s.latency = make(map[uint]*latencyHistory)
+	}
+	h := s.latency[device.ID]
+	if h == nil {
+		h = &latencyHistory{}
+		s.latency[device.ID] = h
+	}
+	wasDead := linkState(h.samples, 0) == LinkDead
+	h.samples = append(h.samples, latencySample{ms: ms, ok: ok})
+	if len(h.samples) > latencyWindow {
+		h.samples = h.samples[len(h.samples)-latencyWindow:]
+	}
+	dead := linkState(h.samples, 0) == LinkDead
+	if ok {
+		h.lastSuccess = now
+	}
+	recorder := s.latencyRecorder
+	s.latencyMu.Unlock()
+
+	if recorder != nil {
+		recorder(device.ID, device.Name, latency, ok)
+	}
+	if dead != wasDead {
+		s.noteLinkChange(device, dead, now)
+	}
+
+	db := s.DB.GetDB()
+	if db == nil {
+		return
+	}
+	// Stored in UTC so the rows of a day roll up under one key
+	hour := now.Truncate(time.Hour).UTC()
+	var row database.DeviceLatency
+	err := db.Where("device_id = ? AND hour = ?", device.ID, hour).First(&row).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		row = database.DeviceLatency{DeviceID: device.ID, Hour: hour}
+	case err != nil:
+		return
+	}
+	row.Samples++
+	if ok {
+		row.TotalMs += ms
+		if ms > row.MaxMs {
+			row.MaxMs = ms
+		}
+	} else {
+		row.Failures++
+	}
+	if err := db.Save(&row).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": device.ID,
+			"error":     err.Error(),
+			"component": "latency",
+		}).Warn("Failed to record device latency")
+	}
+}
+
+// compactDeviceLatency drops latency rows past metrics.retention_days and
+// rolls the hourly rows of whole UTC days past metrics.latency_hourly_days up
+// into one row per device and day
+func (s *ShellyService) compactDeviceLatency(db *gorm.DB, now time.Time) error {
+	if err := db.Where("hour < ?", now.Add(-s.latencyRetention())).Delete(&database.DeviceLatency{}).Error; err != nil {
+		return err
+	}
+	var rows []database.DeviceLatency
+	if err := db.Where("hour < ? AND hours <= 1", s.latencyHourlyFrom(now)).Order("device_id, hour").Find(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	type dayKey struct {
+		deviceID uint
+		day      time.Time
+	}
+	days := map[dayKey]*database.DeviceLatency{}
+	ids := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		key := dayKey{row.DeviceID, row.Hour.UTC().Truncate(24 * time.Hour)}
+		if days[key] == nil {
+			days[key] = &database.DeviceLatency{}
+		}
+		addLatency(days[key], row)
+		ids = append(ids, row.ID)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Hourly rows go first: the one at midnight holds the day's key
+		if err := tx.Where("id IN ?", ids).Delete(&database.DeviceLatency{}).Error; err != nil {
+			return err
+		}
+		for key, sum := range days {
+			var daily database.DeviceLatency
+			err := tx.Where("device_id = ? AND hour = ?", key.deviceID, key.day).First(&daily).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				daily = database.DeviceLatency{DeviceID: key.deviceID, Hour: key.day}
+			case err != nil:
+				return err
+			}
+			daily.Hours = 24
+			addLatency(&daily, *sum)
+			if err := tx.Save(&daily).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// addLatency adds the requests of row to total
+func addLatency(total *database.DeviceLatency, row database.DeviceLatency) {
+	total.Samples += row.Samples
+	total.Failures += row.Failures
+	total.TotalMs += row.TotalMs
+	if row.MaxMs > total.MaxMs {
+		total.MaxMs = row.MaxMs
+	}
+}
+
+// linkState classifies a device's recent requests
+func linkState(samples []latencySample, slowMs float64) string {
+	if len(samples) == 0 {
+		return LinkUnknown
+	}
+	failedInRow := 0
+	for i := len(samples) - 1; i >= 0 && !samples[i].ok; i-- {
+		failedInRow++
+	}
+	if failedInRow == len(samples) || failedInRow >= latencyDeadAfter {
+		return LinkDead
+	}
+	failures, total := 0, 0.0
+	for _, sample := range samples {
+		if sample.ok {
+			total += sample.ms
+		} else {
+			failures++
+		}
+	}
+	if failures*100 >= latencyLossyPercent*len(samples) {
+		return LinkLossy
+	}
+	if total/float64(len(samples)-failures) > slowMs {
+		return LinkSlow
+	}
+	return LinkHealthy
+}
+
+// DeviceLink returns the link state of a device from its recent status
+// requests and when it last answered one
+func (s *ShellyService) DeviceLink(deviceID uint) (string, time.Time) {
+	s.latencyMu.Lock()
+	defer s.latencyMu.Unlock()
+	h := s.latency[deviceID]
+	if h == nil {
+		return LinkUnknown, time.Time{}
+	}
+	return linkState(h.samples, float64(s.latencySlowMs())), h.lastSuccess
+}
+
+// latencyPoint turns a row into a trend point
+func latencyPoint(row database.DeviceLatency) LatencyPoint {
+	p := LatencyPoint{
+		Hour: row.Hour, SpanHours: int(row.Span() / time.Hour),
+		Samples: row.Samples, Failures: row.Failures, MaxMs: row.MaxMs,
+	}
+	if row.Samples > 0 {
+		p.LossPercent = roundTenth(float64(row.Failures) * 100 / float64(row.Samples))
+	}
+	if answered := row.Samples - row.Failures; answered > 0 {
+		p.AvgMs = roundTenth(row.TotalMs / float64(answered))
+	}
+	return p
+}
+
+func roundTenth(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// DeviceLatencyTrend returns a device's latency and failures over the last
+// hours, per hour or per UTC day. Without a resolution it is hourly unless
+// the period reaches back into rolled-up days. Hourly trends show the
+// rolled-up days as they are stored, one point per day.
+func (s *ShellyService) DeviceLatencyTrend(deviceID uint, hours int, resolution string) (*DeviceLatencyTrend, error) {
+	since := s.latencySince(hours)
+	switch resolution {
+	case LatencyResolutionHour, LatencyResolutionDay:
+	case "":
+		resolution = LatencyResolutionHour
+		if since.Before(s.latencyHourlyFrom(s.clock.Now())) {
+			resolution = LatencyResolutionDay
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidLatencyResolution, resolution)
+	}
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	link, _ := s.DeviceLink(deviceID)
+	trend := &DeviceLatencyTrend{
+		DeviceID: deviceID, Name: device.Name, Link: link, Hours: hours,
+		Resolution: resolution, Points: []LatencyPoint{},
+	}
+	db := s.DB.GetDB()
+	if db == nil {
+		return trend, nil
+	}
+	// From the start of the first day, so a rolled-up day the period
+	// begins in is included
+	var rows []database.DeviceLatency
+	if err := db.Where("device_id = ? AND hour >= ?", deviceID, since.UTC().Truncate(24*time.Hour)).Order("hour").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load device latency: %w", err)
+	}
+	if resolution == LatencyResolutionHour {
+		for _, row := range rows {
+			if row.Span() == time.Hour && row.Hour.Before(since) {
+				continue
+			}
+			trend.Points = append(trend.Points, latencyPoint(row))
+		}
+		return trend, nil
+	}
+	var days []database.DeviceLatency
+	for _, row := range rows {
+		day := row.Hour.UTC().Truncate(24 * time.Hour)
+		if len(days) == 0 || !days[len(days)-1].Hour.Equal(day) {
+			days = append(days, database.DeviceLatency{Hour: day, Hours: 24})
+		}
+		addLatency(&days[len(days)-1], row)
+	}
+	for _, day := range days {
+		trend.Points = append(trend.Points, latencyPoint(day))
+	}
+	return trend, nil
+}
+
+// latencySince returns the start of the hour hours-1 hours ago, so the
+// current hour counts as one
+func (s *ShellyService) latencySince(hours int) time.Time {
+	return s.clock.Now().Truncate(time.Hour).Add(-time.Duration(hours-1) * time.Hour)
+}
+
+// LatencySummaries sums up the status requests of every device with
+// requests in the last hours, in device ID order
+func (s *ShellyService) LatencySummaries(hours int) ([]LatencySummary, error) {
+	summaries := []LatencySummary{}
+	db := s.DB.GetDB()
+	if db == nil {
+		return summaries, nil
+	}
+	var rows []database.DeviceLatency
+	if err := db.Where("hour >= ?", s.latencySince(hours)).Order("device_id, hour").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load device latency: %w", err)
+	}
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	byID := make(map[uint]*database.Device, len(devices))
+	for i := range devices {
+		byID[devices[i].ID] = &devices[i]
+	}
+
+	totals := map[uint]*database.DeviceLatency{}
+	order := []uint{}
+	for _, row := range rows {
+		if byID[row.DeviceID] == nil {
+			continue
+		}
+		t := totals[row.DeviceID]
+		if t == nil {
+			t = &database.DeviceLatency{DeviceID: row.DeviceID}
+			totals[row.DeviceID] = t
+			order = append(order, row.DeviceID)
+		}
+		addLatency(t, row)
+	}
+	for _, id := range order {
+		p := latencyPoint(*totals[id])
+		link, lastSuccess := s.DeviceLink(id)
+		summary := LatencySummary{
+			DeviceID: id, Name: byID[id].Name, IP: byID[id].IP, Link: link,
+			Samples: p.Samples, Failures: p.Failures, LossPercent: p.LossPercent, AvgMs: p.AvgMs, MaxMs: p.MaxMs,
+		}
+		if !lastSuccess.IsZero() {
+			summary.LastSuccess = &lastSuccess
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// NetworkReport returns the limit devices with the worst network
+// performance over the last hours; a limit of zero returns every device.
+// Devices in maintenance are labelled and ranked after the others.
+func (s *ShellyService) NetworkReport(hours, limit int) (*NetworkReport, error) {
+	summaries, err := s.LatencySummaries(hours)
+	if err != nil {
+		return nil, err
+	}
+	slowMs := s.latencySlowMs()
+	maintenance := s.maintenanceSet()
+	report := &NetworkReport{GeneratedAt: s.clock.Now(), Hours: hours, SlowThresholdMs: slowMs}
+	for i := range summaries {
+		sum := &summaries[i]
+		sum.InMaintenance = maintenance[sum.DeviceID]
+		// Without recent requests, e.g. after a restart, judge by the period
+		if sum.Link == LinkUnknown {
+			switch {
+			case sum.Failures == sum.Samples:
+				sum.Link = LinkDead
+			case sum.LossPercent >= latencyLossyPercent:
+				sum.Link = LinkLossy
+			case sum.AvgMs > float64(slowMs):
+				sum.Link = LinkSlow
+			default:
+				sum.Link = LinkHealthy
+			}
+		}
+		switch {
+		case sum.InMaintenance:
+			report.InMaintenance++
+		case sum.Link == LinkDead:
+			report.Dead++
+		case sum.Link == LinkLossy:
+			report.Lossy++
+		case sum.Link == LinkSlow:
+			report.Slow++
+		}
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.InMaintenance != b.InMaintenance {
+			return b.InMaintenance
+		}
+		if linkRank[a.Link] != linkRank[b.Link] {
+			return linkRank[a.Link] < linkRank[b.Link]
+		}
+		if a.LossPercent != b.LossPercent {
+			return a.LossPercent > b.LossPercent
+		}
+		return a.AvgMs > b.AvgMs
+	})
+	if limit > 0 && len(summaries) > limit {
+		summaries = summaries[:limit]
+	}
+	report.Devices = summaries
+	return report, nil
+}
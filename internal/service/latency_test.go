@@ -0,0 +1,197 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestLinkState(t *testing.T) {
+	ok := func(ms float64) latencySample { return latencySample{ms: ms, ok: true} }
+	failed := latencySample{}
+	for _, tc := range []struct {
+		samples []latencySample
+		want    string
+	}{
+		{nil, LinkUnknown},
+		{[]latencySample{ok(40), ok(60)}, LinkHealthy},
+		{[]latencySample{ok(1500), ok(1800), ok(900)}, LinkSlow},
+		{[]latencySample{ok(40), failed, ok(50), failed, ok(40)}, LinkLossy},
+		{[]latencySample{ok(40), failed, failed, failed}, LinkDead},
+		{[]latencySample{failed}, LinkDead},
+	} {
+		if got := linkState(tc.samples, 1000); got != tc.want {
+			t.Errorf("linkState(%v) = %s, expected %s", tc.samples, got, tc.want)
+		}
+	}
+}
+
+func TestShellyService_NetworkReport(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	fast := &database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Name: "Fast"}
+	slow := &database.Device{IP: "192.0.2.2", MAC: "AABBCCDDEE02", Name: "Slow"}
+	dead := &database.Device{IP: "192.0.2.3", MAC: "AABBCCDDEE03", Name: "Dead"}
+	for _, d := range []*database.Device{fast, slow, dead} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	var recorded int
+	service.SetLatencyRecorder(func(uint, string, time.Duration, bool) { recorded++ })
+	for i := 0; i < 4; i++ {
+		service.recordLatency(fast, 30*time.Millisecond, true)
+		service.recordLatency(slow, 2*time.Second, true)
+		service.recordLatency(dead, 0, false)
+	}
+	if recorded != 12 {
+		t.Errorf("Expected every request passed to the recorder, got %d", recorded)
+	}
+
+	report, err := service.NetworkReport(24, 2)
+	if err != nil {
+		t.Fatalf("NetworkReport failed: %v", err)
+	}
+	if report.Dead != 1 || report.Slow != 1 || len(report.Devices) != 2 {
+		t.Fatalf("Expected one dead and one slow device, got %+v", report)
+	}
+	if report.Devices[0].DeviceID != dead.ID || report.Devices[0].LossPercent != 100 || report.Devices[1].DeviceID != slow.ID {
+		t.Errorf("Expected the dead device first, then the slow one, got %+v", report.Devices)
+	}
+
+	trend, err := service.DeviceLatencyTrend(slow.ID, 24, "")
+	if err != nil {
+		t.Fatalf("DeviceLatencyTrend failed: %v", err)
+	}
+	if trend.Link != LinkSlow || len(trend.Points) != 1 || trend.Points[0].Samples != 4 || trend.Points[0].AvgMs != 2000 {
+		t.Errorf("Expected one hour of four slow requests, got %+v", trend)
+	}
+	if _, err := service.DeviceLatencyTrend(999, 24, ""); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected an unknown device to be reported, got %v", err)
+	}
+}
+
+func TestShellyService_LatencyRollup(t *testing.T) {
+	db, cleanup := testutil.TestDatabaseMemory(t)
+	defer cleanup()
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	service.SetClock(testutil.NewFakeClock(now))
+
+	device := &database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Name: "Plug"}
+	if err := db.AddDevice(device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	expired := now.AddDate(0, 0, -defaultLatencyDays-2)
+	old := now.AddDate(0, 0, -defaultLatencyHourlyDays-3).Truncate(24 * time.Hour)
+	seed := []database.DeviceLatency{{DeviceID: device.ID, Hour: expired, Samples: 1, TotalMs: 10}}
+	for hour := 0; hour < 24; hour++ {
+		seed = append(seed, database.DeviceLatency{
+			DeviceID: device.ID, Hour: old.Add(time.Duration(hour) * time.Hour),
+			Samples: 4, Failures: 1, TotalMs: 300, MaxMs: float64(100 + hour),
+		})
+	}
+	seed = append(seed, database.DeviceLatency{DeviceID: device.ID, Hour: now.Add(-2 * time.Hour), Samples: 2, TotalMs: 80, MaxMs: 50})
+	if err := db.GetDB().Create(&seed).Error; err != nil {
+		t.Fatalf("Failed to seed device latency: %v", err)
+	}
+
+	if err := service.CompactMetrics(now); err != nil {
+		t.Fatalf("CompactMetrics failed: %v", err)
+	}
+	var rows []database.DeviceLatency
+	if err := db.GetDB().Order("hour").Find(&rows).Error; err != nil {
+		t.Fatalf("Failed to load device latency: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Hours != 24 || !rows[0].Hour.Equal(old) || rows[0].Samples != 96 ||
+		rows[0].Failures != 24 || rows[0].TotalMs != 7200 || rows[0].MaxMs != 123 || rows[1].Samples != 2 {
+		t.Fatalf("Expected the expired hour dropped, one daily row and the recent hour, got %+v", rows)
+	}
+
+	// A period reaching into rolled-up days defaults to daily points
+	hours := int(now.Sub(old)/time.Hour) + 1
+	trend, err := service.DeviceLatencyTrend(device.ID, hours, "")
+	if err != nil {
+		t.Fatalf("DeviceLatencyTrend failed: %v", err)
+	}
+	if trend.Resolution != LatencyResolutionDay || len(trend.Points) != 2 || trend.Points[0].SpanHours != 24 ||
+		trend.Points[0].AvgMs != 100 || trend.Points[0].LossPercent != 25 || trend.Points[1].SpanHours != 24 {
+		t.Errorf("Expected two daily points, got %+v", trend)
+	}
+	trend, err = service.DeviceLatencyTrend(device.ID, hours, LatencyResolutionHour)
+	if err != nil {
+		t.Fatalf("DeviceLatencyTrend failed: %v", err)
+	}
+	if len(trend.Points) != 2 || trend.Points[0].SpanHours != 24 || trend.Points[1].SpanHours != 1 {
+		t.Errorf("Expected the rolled-up day and the recent hour, got %+v", trend)
+	}
+	trend, err = service.DeviceLatencyTrend(device.ID, 24, "")
+	if err != nil {
+		t.Fatalf("DeviceLatencyTrend failed: %v", err)
+	}
+	if trend.Resolution != LatencyResolutionHour || len(trend.Points) != 1 {
+		t.Errorf("Expected a recent period to stay hourly, got %+v", trend)
+	}
+	if _, err := service.DeviceLatencyTrend(device.ID, 24, "minute"); !errors.Is(err, ErrInvalidLatencyResolution) {
+		t.Errorf("Expected an unknown resolution refused, got %v", err)
+	}
+}
+
+func TestRecoveryReason_SlowButAlive(t *testing.T) {
+	p := config.RecoveryPolicy{Action: config.RecoveryActionReboot, UnreachableMinutes: 15}
+	now := time.Now()
+	h := &deviceHealth{lastReachable: now.Add(-time.Hour), link: LinkDead}
+	if recoveryReason(p, h, 0, now) == "" {
+		t.Fatal("Expected a dead device to be rebooted")
+	}
+	for _, link := range []string{LinkSlow, LinkLossy} {
+		h.link = link
+		if reason := recoveryReason(p, h, 0, now); reason != "" {
+			t.Errorf("Did not expect a %s device to be rebooted: %s", link, reason)
+		}
+	}
+}
+
+func TestShellyService_LatencyRetentionWithFakeClock(t *testing.T) {
+	db, cleanup := testutil.TestDatabaseMemory(t)
+	defer cleanup()
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+	clock := testutil.NewFakeClock(time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC))
+	service.SetClock(clock)
+
+	device := &database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Name: "Plug"}
+	if err := db.AddDevice(device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	service.recordLatency(device, 30*time.Millisecond, true)
+
+	// Past the retention, the rollup job drops the old hour
+	clock.Advance(time.Duration(defaultLatencyDays+1) * 24 * time.Hour)
+	service.recordLatency(device, 40*time.Millisecond, true)
+	if err := service.CompactMetrics(clock.Now()); err != nil {
+		t.Fatalf("CompactMetrics failed: %v", err)
+	}
+
+	var rows []database.DeviceLatency
+	if err := db.GetDB().Order("hour").Find(&rows).Error; err != nil {
+		t.Fatalf("Failed to load latency rows: %v", err)
+	}
+	if len(rows) != 1 || !rows[0].Hour.Equal(clock.Now().Truncate(time.Hour)) {
+		t.Fatalf("Expected only the current hour to be kept, got %+v", rows)
+	}
+	report, err := service.NetworkReport(1, 2)
+	if err != nil {
+		t.Fatalf("NetworkReport failed: %v", err)
+	}
+	if !report.GeneratedAt.Equal(clock.Now()) {
+		t.Errorf("Expected the report stamped with the fake time, got %s", report.GeneratedAt)
+	}
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// ErrInvalidMaintenanceRequest wraps maintenance request validation errors
+var ErrInvalidMaintenanceRequest = errors.New("invalid maintenance request")
+
+// MaintenanceRequest selects devices by ID or tag and, when setting, how long
+// they stay in maintenance. Without Until or Minutes the devices stay in
+// maintenance until cleared.
+type MaintenanceRequest struct {
+	DeviceIDs []uint     `json:"device_ids,omitempty"`
+	Tag       string     `json:"tag,omitempty"` // every device carrying this tag, e.g. "room:kitchen"
+	Reason    string     `json:"reason,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+	Minutes   int        `json:"minutes,omitempty"` // alternative to Until
+}
+
+// MaintenanceWindow is an active maintenance window of a device
+type MaintenanceWindow struct {
+	DeviceID  uint       `json:"device_id"`
+	Name      string     `json:"name"`
+	IP        string     `json:"ip"`
+	Reason    string     `json:"reason,omitempty"`
+	StartedAt time.Time  `json:"started_at"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+}
+
+// SetMaintenance puts the selected devices into maintenance. While in
+// maintenance no alerts are sent for a device, its reboots count as expected
+// and reports label it instead of counting it. A device already in
+// maintenance gets the new reason and expiry but keeps its start.
+func (s *ShellyService) SetMaintenance(req MaintenanceRequest) ([]MaintenanceWindow, error) {
+	now := time.Now()
+	endsAt, err := maintenanceEnd(req, now)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.maintenanceTargets(req)
+	if err != nil {
+		return nil, err
+	}
+
+	db := s.DB.GetDB()
+	windows := make([]MaintenanceWindow, 0, len(devices))
+	for _, d := range devices {
+		var entry database.DeviceMaintenance
+		if err := db.Where("device_id = ?", d.ID).Limit(1).Find(&entry).Error; err != nil {
+			return nil, fmt.Errorf("failed to load maintenance of device %d: %w", d.ID, err)
+		}
+		if entry.ID == 0 || !entry.Active(now) {
+			entry.DeviceID = d.ID
+			entry.StartedAt = now
+		}
+		entry.Reason = req.Reason
+		entry.EndsAt = endsAt
+		if err := db.Save(&entry).Error; err != nil {
+			return nil, fmt.Errorf("failed to store maintenance of device %d: %w", d.ID, err)
+		}
+		windows = append(windows, maintenanceWindow(entry, d))
+	}
+
+	s.logger.WithFields(map[string]any{
+		"devices":   len(windows),
+		"reason":    req.Reason,
+		"ends_at":   endsAt,
+		"component": "maintenance",
+	}).Info("Devices put into maintenance")
+	return windows, nil
+}
+
+// ClearMaintenance ends the maintenance of the selected devices and returns
+// how many were in maintenance
+func (s *ShellyService) ClearMaintenance(req MaintenanceRequest) (int, error) {
+	devices, err := s.maintenanceTargets(req)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]uint, 0, len(devices))
+	for _, d := range devices {
+		ids = append(ids, d.ID)
+	}
+	active := s.maintenanceSet()
+	cleared := 0
+	for _, id := range ids {
+		if active[id] {
+			cleared++
+		}
+	}
+	if err := s.DB.GetDB().Where("device_id IN ?", ids).Delete(&database.DeviceMaintenance{}).Error; err != nil {
+		return 0, fmt.Errorf("failed to clear maintenance: %w", err)
+	}
+
+	s.logger.WithFields(map[string]any{
+		"devices":   cleared,
+		"component": "maintenance",
+	}).Info("Device maintenance cleared")
+	return cleared, nil
+}
+
+// MaintenanceWindows returns the active maintenance windows in device ID
+// order. Expired windows are removed.
+func (s *ShellyService) MaintenanceWindows() ([]MaintenanceWindow, error) {
+	entries, err := s.activeMaintenance()
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	byID := make(map[uint]database.Device, len(devices))
+	for _, d := range devices {
+		byID[d.ID] = d
+	}
+
+	windows := []MaintenanceWindow{}
+	for _, entry := range entries {
+		if d, ok := byID[entry.DeviceID]; ok {
+			windows = append(windows, maintenanceWindow(entry, d))
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].DeviceID < windows[j].DeviceID })
+	return windows, nil
+}
+
+// DeviceMaintenance returns the active maintenance window of a device, or nil
+// when it is not in maintenance
+func (s *ShellyService) DeviceMaintenance(deviceID uint) (*MaintenanceWindow, error) {
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	var entry database.DeviceMaintenance
+	if err := s.DB.GetDB().Where("device_id = ?", deviceID).Limit(1).Find(&entry).Error; err != nil {
+		return nil, fmt.Errorf("failed to load maintenance: %w", err)
+	}
+	if entry.ID == 0 || !entry.Active(time.Now()) {
+		return nil, nil
+	}
+	window := maintenanceWindow(entry, *device)
+	return &window, nil
+}
+
+// InMaintenance reports whether a device is in an active maintenance window.
+// A failed lookup counts as not in maintenance, so alerts are not lost.
+func (s *ShellyService) InMaintenance(deviceID uint) bool {
+	if s.DB == nil {
+		return false
+	}
+	db := s.DB.GetDB()
+	if db == nil {
+		return false
+	}
+	var entry database.DeviceMaintenance
+	if err := db.Where("device_id = ?", deviceID).Limit(1).Find(&entry).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": deviceID,
+			"error":     err.Error(),
+			"component": "maintenance",
+		}).Warn("Failed to check device maintenance")
+		return false
+	}
+	return entry.ID != 0 && entry.Active(time.Now())
+}
+
+// maintenanceSet returns the IDs of the devices in maintenance, for
+// labelling reports; a failed lookup labels none
+func (s *ShellyService) maintenanceSet() map[uint]bool {
+	set := map[uint]bool{}
+	entries, err := s.activeMaintenance()
+	if err != nil {
+		s.logger.WithFields(map[string]any{
+			"error":     err.Error(),
+			"component": "maintenance",
+		}).Warn("Failed to load device maintenance")
+		return set
+	}
+	for _, entry := range entries {
+		set[entry.DeviceID] = true
+	}
+	return set
+}
+
+// activeMaintenance loads the active windows and deletes the expired ones
+func (s *ShellyService) activeMaintenance() ([]database.DeviceMaintenance, error) {
+	db := s.DB.GetDB()
+	if db == nil {
+		return nil, nil
+	}
+	now := time.Now()
+	if err := db.Where("ends_at IS NOT NULL AND ends_at <= ?", now).Delete(&database.DeviceMaintenance{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to remove expired maintenance: %w", err)
+	}
+	var entries []database.DeviceMaintenance
+	if err := db.Order("device_id").Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to load maintenance: %w", err)
+	}
+	return entries, nil
+}
+
+// maintenanceTargets resolves the selector of a request; one is required so
+// a request cannot cover the whole fleet by omission
+func (s *ShellyService) maintenanceTargets(req MaintenanceRequest) ([]database.Device, error) {
+	if len(req.DeviceIDs) == 0 && req.Tag == "" {
+		return nil, fmt.Errorf("%w: device_ids or tag is required", ErrInvalidMaintenanceRequest)
+	}
+	return s.SelectDevices(req.DeviceIDs, req.Tag)
+}
+
+// maintenanceEnd returns the expiry requested, nil for none
+func maintenanceEnd(req MaintenanceRequest, now time.Time) (*time.Time, error) {
+	switch {
+	case req.Minutes < 0:
+		return nil, fmt.Errorf("%w: minutes must not be negative", ErrInvalidMaintenanceRequest)
+	case req.Until != nil && req.Minutes > 0:
+		return nil, fmt.Errorf("%w: set either until or minutes", ErrInvalidMaintenanceRequest)
+	case req.Until != nil:
+		if !req.Until.After(now) {
+			return nil, fmt.Errorf("%w: until must be in the future", ErrInvalidMaintenanceRequest)
+		}
+		return req.Until, nil
+	case req.Minutes > 0:
+		endsAt := now.Add(time.Duration(req.Minutes) * time.Minute)
+		return &endsAt, nil
+	}
+	return nil, nil
+}
+
+// maintenanceWindow describes a stored window of a device
+func maintenanceWindow(entry database.DeviceMaintenance, device database.Device) MaintenanceWindow {
+	return MaintenanceWindow{
+		DeviceID:  device.ID,
+		Name:      device.Name,
+		IP:        device.IP,
+		Reason:    entry.Reason,
+		StartedAt: entry.StartedAt,
+		EndsAt:    entry.EndsAt,
+	}
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+func TestShellyService_Maintenance(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	kitchen1 := &database.Device{IP: "192.0.2.1", MAC: "AABBCCDDEE01", Name: "Kitchen 1"}
+	kitchen2 := &database.Device{IP: "192.0.2.2", MAC: "AABBCCDDEE02", Name: "Kitchen 2"}
+	hall := &database.Device{IP: "192.0.2.3", MAC: "AABBCCDDEE03", Name: "Hall"}
+	for _, d := range []*database.Device{kitchen1, kitchen2, hall} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	for _, d := range []*database.Device{kitchen1, kitchen2} {
+		if err := db.AddDeviceTag(d.ID, "room:kitchen"); err != nil {
+			t.Fatalf("Failed to tag device: %v", err)
+		}
+	}
+
+	past := time.Now().Add(-time.Hour)
+	for _, req := range []MaintenanceRequest{
+		{},
+		{Tag: "room:kitchen", Until: &past},
+		{Tag: "room:kitchen", Minutes: -1},
+		{Tag: "room:kitchen", Until: &past, Minutes: 30},
+	} {
+		if _, err := service.SetMaintenance(req); !errors.Is(err, ErrInvalidMaintenanceRequest) {
+			t.Errorf("Expected %+v to be rejected, got %v", req, err)
+		}
+	}
+
+	windows, err := service.SetMaintenance(MaintenanceRequest{Tag: "room:kitchen", Reason: "rewiring", Minutes: 60})
+	if err != nil {
+		t.Fatalf("SetMaintenance failed: %v", err)
+	}
+	if len(windows) != 2 || windows[0].EndsAt == nil || windows[0].Reason != "rewiring" {
+		t.Fatalf("Expected both kitchen devices in maintenance for an hour, got %+v", windows)
+	}
+	if !service.InMaintenance(kitchen1.ID) || service.InMaintenance(hall.ID) {
+		t.Error("Expected only the kitchen devices in maintenance")
+	}
+
+	// Setting it again keeps the start; without an end it lasts until cleared
+	started := windows[0].StartedAt
+	windows, err = service.SetMaintenance(MaintenanceRequest{DeviceIDs: []uint{kitchen1.ID}})
+	if err != nil {
+		t.Fatalf("SetMaintenance failed: %v", err)
+	}
+	if !windows[0].StartedAt.Equal(started) || windows[0].EndsAt != nil {
+		t.Errorf("Expected the window extended indefinitely from its start, got %+v", windows[0])
+	}
+
+	// An expired window no longer counts and is removed
+	if err := db.GetDB().Model(&database.DeviceMaintenance{}).Where("device_id = ?", kitchen2.ID).
+		Update("ends_at", past).Error; err != nil {
+		t.Fatalf("Failed to expire window: %v", err)
+	}
+	if service.InMaintenance(kitchen2.ID) {
+		t.Error("Expected an expired window to end the maintenance")
+	}
+	windows, err = service.MaintenanceWindows()
+	if err != nil {
+		t.Fatalf("MaintenanceWindows failed: %v", err)
+	}
+	if len(windows) != 1 || windows[0].DeviceID != kitchen1.ID || windows[0].Name != "Kitchen 1" {
+		t.Errorf("Expected only kitchen 1 listed, got %+v", windows)
+	}
+
+	// Reboots during maintenance are expected
+	service.recordUptime(kitchen1.ID, &shelly.DeviceStatus{Uptime: 7200})
+	service.recordUptime(kitchen1.ID, &shelly.DeviceStatus{Uptime: 5})
+	var reboot database.DeviceReboot
+	if err := db.GetDB().Where("device_id = ?", kitchen1.ID).First(&reboot).Error; err != nil {
+		t.Fatalf("Expected the reboot recorded: %v", err)
+	}
+	if !reboot.Expected {
+		t.Error("Expected a reboot during maintenance to count as expected")
+	}
+
+	cleared, err := service.ClearMaintenance(MaintenanceRequest{Tag: "room:kitchen"})
+	if err != nil {
+		t.Fatalf("ClearMaintenance failed: %v", err)
+	}
+	if cleared != 1 || service.InMaintenance(kitchen1.ID) {
+		t.Errorf("Expected kitchen 1 cleared, got %d cleared", cleared)
+	}
+}
+
+func TestShellyService_MaintenanceReports(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	ids := make([]uint, 2)
+	for i := range ids {
+		device := &database.Device{IP: "192.0.2." + string(rune('1'+i)), MAC: "AABBCCDDEE0" + string(rune('1'+i)), Type: "SHSW-1", Name: "Relay", Settings: `{"gen":1}`}
+		if err := db.AddDevice(device); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+		ids[i] = device.ID
+		config := json.RawMessage(`{"login": {"enabled": false}, "cloud": {"enabled": false}}`)
+		if err := db.GetDB().Create(&configuration.DeviceConfig{DeviceID: device.ID, Config: config}).Error; err != nil {
+			t.Fatalf("Failed to store device config: %v", err)
+		}
+		service.recordLatency(device, 0, false)
+	}
+	if _, err := service.SetMaintenance(MaintenanceRequest{DeviceIDs: []uint{ids[0]}}); err != nil {
+		t.Fatalf("SetMaintenance failed: %v", err)
+	}
+
+	summary, err := service.LintFleetConfig(ConfigLintRequest{})
+	if err != nil {
+		t.Fatalf("LintFleetConfig failed: %v", err)
+	}
+	if summary.Affected != 1 || summary.InMaintenance != 1 || summary.ByRule[configuration.LintAuthDisabled] != 1 {
+		t.Errorf("Expected the device in maintenance left out of the totals, got %+v", summary)
+	}
+	if !summary.Reports[0].InMaintenance || len(summary.Reports[0].Findings) == 0 {
+		t.Errorf("Expected the device in maintenance labelled with its findings, got %+v", summary.Reports[0])
+	}
+
+	report, err := service.NetworkReport(24, 0)
+	if err != nil {
+		t.Fatalf("NetworkReport failed: %v", err)
+	}
+	if report.Dead != 1 || report.InMaintenance != 1 {
+		t.Errorf("Expected one dead device and one in maintenance, got %+v", report)
+	}
+	if report.Devices[0].DeviceID != ids[1] || !report.Devices[1].InMaintenance {
+		t.Errorf("Expected the device in maintenance ranked last, got %+v", report.Devices)
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ginsys/shelly-manager/internal/naming"
+)
+
+// Kinds of name groups in a hygiene report
+const (
+	NameGroupDuplicate     = "duplicate"      // names equal but for case, diacritics or spacing on one site
+	NameGroupCrossSite     = "cross_site"     // the same name on different sites
+	NameGroupNearDuplicate = "near_duplicate" // names one letter apart
+)
+
+// NameHygieneDevice is a device named in a hygiene finding
+type NameHygieneDevice struct {
+	DeviceID  uint   `json:"device_id"`
+	Name      string `json:"name"`
+	Site      string `json:"site,omitempty"`
+	Suggested string `json:"suggested,omitempty"` // proposed new name
+}
+
+// NameHygieneGroup is a set of devices whose names collide
+type NameHygieneGroup struct {
+	Kind    string              `json:"kind"`
+	Key     string              `json:"key"` // normalized name
+	Devices []NameHygieneDevice `json:"devices"`
+}
+
+// NameHygieneReport lists the device names needing attention. Rename, when
+// set, is the request for POST /devices/rename that applies the suggested
+// names.
+type NameHygieneReport struct {
+	Devices    int                 `json:"devices"`
+	Template   string              `json:"template,omitempty"`
+	Groups     []NameHygieneGroup  `json:"groups"`
+	Violations []NameHygieneDevice `json:"violations"` // names the naming template could not have produced
+	Rename     *RenameRequest      `json:"rename,omitempty"`
+}
+
+// NameHygiene checks the device names of the fleet. Names are compared by
+// their normalized key, so case, diacritics and spacing do not tell them
+// apart. Equal names form a duplicate group, or a cross-site group when every
+// device is on a different site; names a letter apart are near-duplicates.
+// With a naming template, names it could not have produced are violations.
+// The lowest device ID of a group keeps its name; the other devices and the
+// violations get suggested names from the rename workflow, or without a
+// template a numbered variant of their name.
+func (s *ShellyService) NameHygiene(ctx context.Context) (*NameHygieneReport, error) {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	tags := s.deviceTags()
+	policy := s.NamingPolicy()
+	if policy.Validate() != nil {
+		policy = nil
+	}
+	defaultSite := ""
+	if s.Config != nil {
+		defaultSite = s.Config.Naming.Site
+	}
+
+	report := &NameHygieneReport{Devices: len(devices), Groups: []NameHygieneGroup{}, Violations: []NameHygieneDevice{}}
+	if policy != nil {
+		report.Template = s.Config.Naming.Template
+	}
+
+	entries := make([]NameHygieneDevice, len(devices))
+	violates := make([]bool, len(devices))
+	byKey := map[string][]int{}
+	keys := []string{}
+	fix := []uint{}
+	for i := range devices {
+		device := &devices[i]
+		subject := namingSubject(device, tags[device.ID])
+		site := subject.Site
+		if site == "" {
+			site = defaultSite
+		}
+		entries[i] = NameHygieneDevice{DeviceID: device.ID, Name: device.Name, Site: site}
+		if key := naming.Key(device.Name); key != "" {
+			if len(byKey[key]) == 0 {
+				keys = append(keys, key)
+			}
+			byKey[key] = append(byKey[key], i)
+		}
+		if policy != nil && !policy.Matches(subject, device.Name) {
+			violates[i] = true
+			fix = append(fix, device.ID)
+		}
+	}
+	sort.Strings(keys)
+
+	type group struct {
+		kind    string
+		key     string
+		members []int
+	}
+	var groups []group
+	for _, key := range keys {
+		members := byKey[key]
+		if len(members) < 2 {
+			continue
+		}
+		kind := NameGroupCrossSite
+		sites := map[string]bool{}
+		for _, i := range members {
+			if sites[entries[i].Site] {
+				kind = NameGroupDuplicate
+			}
+			sites[entries[i].Site] = true
+		}
+		groups = append(groups, group{kind: kind, key: key, members: members})
+		for _, i := range members[1:] {
+			fix = append(fix, entries[i].DeviceID)
+		}
+	}
+	for a := range keys {
+		for b := a + 1; b < len(keys); b++ {
+			if naming.Similar(keys[a], keys[b]) {
+				members := append(append([]int{}, byKey[keys[a]]...), byKey[keys[b]]...)
+				sort.Ints(members)
+				groups = append(groups, group{kind: NameGroupNearDuplicate, key: keys[a], members: members})
+			}
+		}
+	}
+
+	fix = uniqueIDs(fix)
+	suggested := map[uint]string{}
+	if len(fix) > 0 && policy != nil {
+		results, err := s.RenameDevices(ctx, RenameRequest{DeviceIDs: fix, DryRun: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			if r.Changed {
+				suggested[r.DeviceID] = r.NewName
+			}
+		}
+		report.Rename = &RenameRequest{DeviceIDs: fix}
+	} else if len(fix) > 0 {
+		// Without a template, number the names that collide
+		index := make(map[uint]int, len(entries))
+		for i, e := range entries {
+			index[e.DeviceID] = i
+		}
+		for _, id := range fix {
+			name := entries[index[id]].Name
+			for n := 2; ; n++ {
+				candidate := fmt.Sprintf("%s-%d", name, n)
+				if key := naming.Key(candidate); len(byKey[key]) == 0 {
+					byKey[key] = []int{index[id]}
+					suggested[id] = candidate
+					break
+				}
+			}
+		}
+	}
+
+	withSuggestion := func(i int) NameHygieneDevice {
+		e := entries[i]
+		e.Suggested = suggested[e.DeviceID]
+		return e
+	}
+	for _, g := range groups {
+		out := NameHygieneGroup{Kind: g.kind, Key: g.key}
+		for _, i := range g.members {
+			out.Devices = append(out.Devices, withSuggestion(i))
+		}
+		report.Groups = append(report.Groups, out)
+	}
+	for i := range entries {
+		if violates[i] {
+			report.Violations = append(report.Violations, withSuggestion(i))
+		}
+	}
+
+	s.logger.WithFields(map[string]any{
+		"devices":    report.Devices,
+		"groups":     len(report.Groups),
+		"violations": len(report.Violations),
+		"component":  "service",
+	}).Info("Device name hygiene checked")
+	return report, nil
+}
+
+// uniqueIDs returns ids sorted without repeats
+func uniqueIDs(ids []uint) []uint {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	out := ids[:0]
+	for _, id := range ids {
+		if len(out) == 0 || id != out[len(out)-1] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
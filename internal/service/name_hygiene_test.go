@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_NameHygiene(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfig()
+	service := NewServiceWithLogger(db, cfg, createTestLogger(t))
+	defer service.Stop()
+
+	ids := map[string]uint{}
+	for i, name := range []string{"Küche Licht", "kuche-licht", "Porch", "porch", "Garage Light", "Garage Lights", "Desk 1", "Desk 2"} {
+		d := database.Device{MAC: "AA:BB:CC:00:00:0" + string(rune('1'+i)), IP: "192.0.2." + string(rune('1'+i)), Name: name, Type: "SHSW-1", Settings: `{"model":"SHSW-1","gen":1}`}
+		if err := db.AddDevice(&d); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		ids[name] = d.ID
+	}
+	if err := db.AddDeviceTag(ids["Porch"], "site:home"); err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+	if err := db.AddDeviceTag(ids["porch"], "site:cabin"); err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+
+	report, err := service.NameHygiene(context.Background())
+	if err != nil {
+		t.Fatalf("NameHygiene failed: %v", err)
+	}
+	if report.Devices != 8 || len(report.Groups) != 3 || len(report.Violations) != 0 || report.Rename != nil {
+		t.Fatalf("Expected three groups and no template findings, got %+v", report)
+	}
+	kinds := map[string]NameHygieneGroup{}
+	for _, g := range report.Groups {
+		kinds[g.Kind] = g
+	}
+	dup := kinds[NameGroupDuplicate]
+	if dup.Key != "kuchelicht" || len(dup.Devices) != 2 || dup.Devices[0].Suggested != "" || dup.Devices[1].Suggested != "kuche-licht-2" {
+		t.Errorf("Expected the second Küche Licht numbered, got %+v", dup)
+	}
+	if cross := kinds[NameGroupCrossSite]; cross.Key != "porch" || cross.Devices[1].Site != "cabin" {
+		t.Errorf("Expected porch on two sites, got %+v", cross)
+	}
+	if near := kinds[NameGroupNearDuplicate]; len(near.Devices) != 2 || near.Devices[1].Name != "Garage Lights" {
+		t.Errorf("Expected the garage lights as near-duplicates, got %+v", near)
+	}
+
+	// With a template the rename workflow suggests the names
+	cfg.Naming.Template = "{{site}}-{{model_short}}-{{seq}}"
+	cfg.Naming.Site = "home"
+	cfg.Naming.Lowercase = true
+	report, err = service.NameHygiene(context.Background())
+	if err != nil {
+		t.Fatalf("NameHygiene failed: %v", err)
+	}
+	if len(report.Violations) != 8 || report.Rename == nil || len(report.Rename.DeviceIDs) != 8 {
+		t.Fatalf("Expected every name to violate the template, got %+v", report)
+	}
+	if v := report.Violations[0]; v.Suggested != "home-shsw-1-1" {
+		t.Errorf("Expected the suggestion from the rename workflow, got %+v", v)
+	}
+	if stored, _ := db.GetDevice(ids["porch"]); stored.Name != "porch" {
+		t.Errorf("Expected the check to rename nothing, got %q", stored.Name)
+	}
+}
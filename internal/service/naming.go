@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/discovery"
+	"github.com/ginsys/shelly-manager/internal/naming"
+)
+
+// RenameRequest selects the devices renamed by RenameDevices
+type RenameRequest struct {
+	DeviceIDs []uint `json:"device_ids,omitempty"` // empty renames every device
+	Template  string `json:"template,omitempty"`   // overrides naming.template
+	DryRun    bool   `json:"dry_run"`
+	Push      bool   `json:"push"` // also set the new name on the device itself
+}
+
+// RenameResult reports the outcome for one device
+type RenameResult struct {
+	DeviceID uint   `json:"device_id"`
+	OldName  string `json:"old_name"`
+	NewName  string `json:"new_name"`
+	Changed  bool   `json:"changed"`
+	Pushed   bool   `json:"pushed,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// deviceNamer is implemented by device clients that can set the device name
+type deviceNamer interface {
+	SetDeviceName(ctx context.Context, name string) error
+}
+
+// NamingPolicy returns the configured naming policy
+func (s *ShellyService) NamingPolicy() *naming.Policy {
+	if s.Config == nil {
+		return naming.NewPolicy(config.NamingConfig{})
+	}
+	return naming.NewPolicy(s.Config.Naming)
+}
+
+// namingSubject describes an inventory device for the naming policy
+func namingSubject(device *database.Device, tags []string) naming.Subject {
+	subject := naming.Subject{MAC: device.MAC, Type: device.Type, IP: device.IP}
+	var settings map[string]interface{}
+	if err := json.Unmarshal([]byte(device.Settings), &settings); err == nil {
+		if model, ok := settings["model"].(string); ok {
+			subject.Model = model
+		}
+		if gen, ok := settings["gen"].(float64); ok {
+			subject.Generation = int(gen)
+		}
+	}
+	subject.ApplyTags(tags)
+	return subject
+}
+
+// adoptionName generates a name for a device discovered for the first time
+// when a naming template is configured. taken is loaded on first use and the
+// generated name is reserved in it. It returns "" when no name applies.
+func (s *ShellyService) adoptionName(sd discovery.ShellyDevice, taken *naming.NameSet) string {
+	policy := s.NamingPolicy()
+	if !policy.Enabled() {
+		return ""
+	}
+	if _, err := s.DB.GetDeviceByMAC(sd.MAC); err == nil {
+		return ""
+	}
+	if *taken == nil {
+		*taken = naming.NameSet{}
+		if devices, err := s.DB.GetDevices(); err == nil {
+			for _, d := range devices {
+				taken.Add(d.Name)
+			}
+		}
+	}
+
+	name, err := policy.Name(naming.Subject{
+		MAC:        sd.MAC,
+		Model:      sd.Model,
+		Type:       discovery.GetDeviceType(sd.Model),
+		IP:         sd.IP,
+		Generation: sd.Generation,
+	}, *taken)
+	if err != nil {
+		s.logger.WithFields(map[string]any{
+			"mac":       sd.MAC,
+			"error":     err.Error(),
+			"component": "service",
+		}).Warn("Failed to generate device name")
+		return ""
+	}
+	taken.Add(name)
+	return name
+}
+
+// RenameDevices renames devices using the naming policy. Devices are processed
+// in ID order so sequence numbers are stable across runs; names of devices
+// outside the selection are treated as taken.
+func (s *ShellyService) RenameDevices(ctx context.Context, req RenameRequest) ([]RenameResult, error) {
+	policy := s.NamingPolicy()
+	if req.Template != "" {
+		policy = policy.WithTemplate(req.Template)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	devices, err := s.SelectDevices(req.DeviceIDs, "")
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	inScope := make(map[uint]bool, len(devices))
+	for _, d := range devices {
+		inScope[d.ID] = true
+	}
+	taken := naming.NameSet{}
+	for _, d := range all {
+		if !inScope[d.ID] {
+			taken.Add(d.Name)
+		}
+	}
+
+	tags := s.deviceTags()
+	results := []RenameResult{}
+	for i := range devices {
+		device := &devices[i]
+		result := RenameResult{DeviceID: device.ID, OldName: device.Name}
+		name, err := policy.Name(namingSubject(device, tags[device.ID]), taken)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		taken.Add(name)
+		result.NewName = name
+		result.Changed = name != device.Name
+
+		if !req.DryRun && result.Changed {
+			device.Name = name
+			if err := s.DB.UpdateDevice(device); err != nil {
+				result.Error = err.Error()
+				results = append(results, result)
+				continue
+			}
+			if req.Push {
+				if err := s.PushDeviceName(ctx, device); err != nil {
+					result.Error = fmt.Sprintf("renamed but push failed: %v", err)
+				} else {
+					result.Pushed = true
+				}
+			}
+		}
+		results = append(results, result)
+	}
+
+	s.logger.WithFields(map[string]any{
+		"devices":   len(results),
+		"dry_run":   req.DryRun,
+		"push":      req.Push,
+		"component": "service",
+	}).Info("Bulk rename completed")
+	return results, nil
+}
+
+// PushDeviceName sets the device's own name (Gen1 settings name, Gen2
+// Sys.SetConfig device.name) to the inventory name
+func (s *ShellyService) PushDeviceName(ctx context.Context, device *database.Device) error {
+	if device.Status == "offline" {
+		return ErrDeviceOffline
+	}
+	client, err := s.getClient(device)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	namer, ok := client.(deviceNamer)
+	if !ok {
+		return fmt.Errorf("device client does not support setting the name")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	return namer.SetDeviceName(ctx, device.Name)
+}
+
+// NameSyncRequest selects the devices whose own name is aligned with the
+// inventory name by SyncDeviceNames
+type NameSyncRequest struct {
+	DeviceIDs []uint `json:"device_ids,omitempty"` // empty selects every device
+	Tag       string `json:"tag,omitempty"`        // restrict to devices carrying this tag
+	DryRun    bool   `json:"dry_run"`
+	Force     bool   `json:"force"` // also try devices marked offline
+}
+
+// NameSyncResult reports the outcome for one device
+type NameSyncResult struct {
+	DeviceID   uint   `json:"device_id"`
+	Name       string `json:"name"`                  // inventory name
+	DeviceName string `json:"device_name,omitempty"` // name reported by the device before the sync
+	Changed    bool   `json:"changed"`
+	Skipped    string `json:"skipped,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// SyncDeviceNames sets the name stored on each selected device to its
+// inventory name so mDNS announcements, the device web UI and router client
+// lists show the same name as the manager. Devices already in sync are left
+// untouched; with DryRun only the differences are reported.
+func (s *ShellyService) SyncDeviceNames(ctx context.Context, req NameSyncRequest) ([]NameSyncResult, error) {
+	devices, err := s.SelectDevices(req.DeviceIDs, req.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []NameSyncResult{}
+	for i := range devices {
+		device := &devices[i]
+		results = append(results, s.syncDeviceName(ctx, device, req))
+	}
+
+	changed := 0
+	for _, r := range results {
+		if r.Changed {
+			changed++
+		}
+	}
+	s.logger.WithFields(map[string]any{
+		"devices":   len(results),
+		"changed":   changed,
+		"dry_run":   req.DryRun,
+		"component": "service",
+	}).Info("Device name sync completed")
+	return results, nil
+}
+
+// syncDeviceName aligns a single device
+func (s *ShellyService) syncDeviceName(ctx context.Context, device *database.Device, req NameSyncRequest) NameSyncResult {
+	result := NameSyncResult{DeviceID: device.ID, Name: device.Name}
+	if device.Name == "" {
+		result.Skipped = "no inventory name"
+		return result
+	}
+	if device.Status == "offline" && !req.Force {
+		result.Skipped = "device offline"
+		return result
+	}
+
+	client, err := s.getClient(device)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create client: %v", err)
+		return result
+	}
+	namer, ok := client.(deviceNamer)
+	if !ok {
+		result.Error = "device client does not support setting the name"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+
+	cfg, err := client.GetConfig(ctx)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to read device name: %v", err)
+		return result
+	}
+	result.DeviceName = cfg.Name
+	if cfg.Name == device.Name {
+		return result
+	}
+
+	result.Changed = true
+	if req.DryRun {
+		return result
+	}
+	if err := namer.SetDeviceName(ctx, device.Name); err != nil {
+		result.Error = fmt.Sprintf("failed to set device name: %v", err)
+	}
+	return result
+}
+
+// containsFold reports whether values contains s, ignoring case
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceTags returns the tags of every device keyed by device ID
+func (s *ShellyService) deviceTags() map[uint][]string {
+	out := map[uint][]string{}
+	db := s.DB.GetDB()
+	if db == nil {
+		return out
+	}
+	var tags []database.DeviceTag
+	if err := db.Find(&tags).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"error":     err.Error(),
+			"component": "service",
+		}).Warn("Failed to load device tags for naming")
+		return out
+	}
+	for _, t := range tags {
+		out[t.DeviceID] = append(out[t.DeviceID], t.Tag)
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_RenameDevices(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfig()
+	cfg.Naming.Template = "{{site}}-{{room}}-{{model_short}}-{{seq}}"
+	cfg.Naming.Site = "home"
+	cfg.Naming.SeqWidth = 2
+	service := NewServiceWithLogger(db, cfg, createTestLogger(t))
+	defer service.Stop()
+
+	for _, d := range []database.Device{
+		{MAC: "AA:BB:CC:AA:AA:AA", IP: "192.0.2.1", Name: "Shelly-AAAAAA"},
+		{MAC: "AA:BB:CC:BB:BB:BB", IP: "192.0.2.2", Name: "Shelly-BBBBBB"},
+		{MAC: "AA:BB:CC:CC:CC:CC", IP: "192.0.2.3", Name: "home-plus1-01"},
+	} {
+		d.Type = "Plus 1"
+		d.Settings = `{"model":"SNSW-001X16EU","gen":2}`
+		if err := db.AddDevice(&d); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+	}
+	devices, _ := db.GetDevices()
+	if err := db.AddDeviceTag(devices[0].ID, "room:kitchen"); err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+
+	// Only the first two devices: the third keeps its name, which is taken
+	cfg.Naming.ModelAliases = map[string]string{"snsw-001x16eu": "plus1"}
+	results, err := service.RenameDevices(context.Background(), RenameRequest{
+		DeviceIDs: []uint{devices[0].ID, devices[1].ID},
+		DryRun:    true,
+	})
+	if err != nil {
+		t.Fatalf("RenameDevices failed: %v", err)
+	}
+	if len(results) != 2 || results[0].NewName != "home-kitchen-plus1-01" || results[1].NewName != "home-plus1-02" {
+		t.Fatalf("Unexpected rename plan: %+v", results)
+	}
+	if stored, _ := db.GetDevice(devices[1].ID); stored.Name != "Shelly-BBBBBB" {
+		t.Errorf("Dry run must not rename, got %q", stored.Name)
+	}
+
+	if _, err := service.RenameDevices(context.Background(), RenameRequest{DeviceIDs: []uint{devices[1].ID}}); err != nil {
+		t.Fatalf("RenameDevices failed: %v", err)
+	}
+	if stored, _ := db.GetDevice(devices[1].ID); stored.Name != "home-plus1-02" {
+		t.Errorf("Expected device to be renamed, got %q", stored.Name)
+	}
+
+	if _, err := service.RenameDevices(context.Background(), RenameRequest{DeviceIDs: []uint{9999}}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+}
+
+func TestShellyService_SyncDeviceNames(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	server := createMockShellyServer()
+	defer server.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	device := createTestDevice(t, db, server.URL[len("http://"):])
+	offline := &database.Device{IP: "192.0.2.50", MAC: "68C63A000050", Name: "porch", Status: "offline"}
+	if err := db.AddDevice(offline); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+
+	// The mock device reports "Test Device", matching the inventory name
+	results, err := service.SyncDeviceNames(context.Background(), NameSyncRequest{})
+	if err != nil {
+		t.Fatalf("SyncDeviceNames failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Changed || results[0].Error != "" || results[1].Skipped != "device offline" {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+
+	device.Name = "hallway"
+	if err := db.UpdateDevice(device); err != nil {
+		t.Fatalf("Failed to rename device: %v", err)
+	}
+	results, err = service.SyncDeviceNames(context.Background(), NameSyncRequest{DeviceIDs: []uint{device.ID}})
+	if err != nil {
+		t.Fatalf("SyncDeviceNames failed: %v", err)
+	}
+	if len(results) != 1 || !results[0].Changed || results[0].DeviceName != "Test Device" || results[0].Error != "" {
+		t.Errorf("Expected name to be pushed, got %+v", results)
+	}
+}
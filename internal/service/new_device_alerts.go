@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/discovery"
+	"github.com/ginsys/shelly-manager/internal/naming"
+)
+
+// Sources of new device alerts
+const (
+	NewDeviceSourceDiscovery = "discovery"
+	NewDeviceSourceAnnounce  = "announce" // MQTT announce relayed to the API
+	NewDeviceSourceDHCP      = "dhcp_lease"
+)
+
+// New device alert states
+const (
+	NewDevicePending = "pending"
+	NewDeviceAdopted = "adopted"
+	NewDeviceIgnored = "ignored"
+)
+
+var (
+	// ErrNewDeviceAlertNotFound is returned for unknown new device alerts
+	ErrNewDeviceAlertNotFound = errors.New("new device alert not found")
+	// ErrInvalidNewDeviceAlert wraps actions an alert's state does not allow
+	ErrInvalidNewDeviceAlert = errors.New("invalid new device alert action")
+	// ErrInvalidAnnounce wraps device announces that cannot be used
+	ErrInvalidAnnounce = errors.New("invalid device announce")
+)
+
+// NewDeviceNotifier is told when a device not in the inventory is first
+// seen, or seen again after its inventory device was deleted
+type NewDeviceNotifier func(ctx context.Context, alert database.NewDeviceAlert)
+
+// SetNewDeviceNotifier sets the callback told about new device alerts
+func (s *ShellyService) SetNewDeviceNotifier(fn NewDeviceNotifier) {
+	s.alertMu.Lock()
+	defer s.alertMu.Unlock()
+	s.newDeviceNotifier = fn
+}
+
+// DeviceAnnounce is the announce a Shelly device publishes over MQTT:
+// shellies/announce for Gen1, the reply to shellies/command "announce" for
+// Gen2 and later
+type DeviceAnnounce struct {
+	ID    string `json:"id"`
+	Model string `json:"model"`
+	MAC   string `json:"mac"`
+	IP    string `json:"ip"`
+	Gen   int    `json:"gen"`
+	FWVer string `json:"fw_ver"` // Gen1
+	Ver   string `json:"ver"`    // Gen2 and later
+}
+
+// AnnounceResult tells what an announce led to
+type AnnounceResult struct {
+	Status   string `json:"status"` // known, adopted, pending or ignored
+	DeviceID uint   `json:"device_id,omitempty"`
+	AlertID  uint   `json:"alert_id,omitempty"`
+}
+
+// newDeviceAlertsEnabled reports whether unknown devices are held as alerts
+func (s *ShellyService) newDeviceAlertsEnabled() bool {
+	return s.Config != nil && s.Config.Discovery.NewDeviceAlerts
+}
+
+// ListNewDeviceAlerts returns the alerts in status, or all alerts when status
+// is empty, most recently seen first
+func (s *ShellyService) ListNewDeviceAlerts(status string) ([]database.NewDeviceAlert, error) {
+	query := s.DB.GetDB().Order("last_seen DESC, id DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var alerts []database.NewDeviceAlert
+	if err := query.Find(&alerts).Error; err != nil {
+		return nil, fmt.Errorf("failed to load new device alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// AdoptNewDevice adds the device of a pending or ignored alert to the
+// inventory, as discovery does for unknown devices with alerts off
+func (s *ShellyService) AdoptNewDevice(ctx context.Context, id uint, actor string) (*database.NewDeviceAlert, *database.Device, error) {
+	alert, err := s.newDeviceAlert(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if alert.Status == NewDeviceAdopted {
+		return nil, nil, fmt.Errorf("%w: the device was already adopted", ErrInvalidNewDeviceAlert)
+	}
+
+	found := discoveredDevice{ShellyDevice: discovery.ShellyDevice{
+		ID:         alert.ShellyID,
+		Model:      alert.Model,
+		Generation: alert.Generation,
+		Version:    alert.Firmware,
+		MAC:        alert.MAC,
+		IP:         alert.IP,
+		Discovered: alert.LastSeen,
+	}}
+	device, err := s.adoptDiscovered(ctx, found, &naming.NameSet{}, false, alert.Source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to adopt device: %w", err)
+	}
+	if device == nil {
+		return nil, nil, fmt.Errorf("%w: adoption was vetoed by a hook", ErrInvalidNewDeviceAlert)
+	}
+
+	now := s.clock.Now()
+	alert.Status = NewDeviceAdopted
+	alert.ResolvedAt = &now
+	alert.ResolvedBy = actor
+	alert.DeviceID = &device.ID
+	if err := s.DB.GetDB().Save(alert).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to save new device alert: %w", err)
+	}
+	s.logger.WithFields(map[string]any{
+		"alert_id":  alert.ID,
+		"device_id": device.ID,
+		"mac":       alert.MAC,
+		"actor":     actor,
+		"component": "service",
+	}).Info("New device adopted")
+	return alert, device, nil
+}
+
+// IgnoreNewDevice marks a pending alert as ignored; the device raises no
+// further alerts
+func (s *ShellyService) IgnoreNewDevice(id uint, actor, note string) (*database.NewDeviceAlert, error) {
+	alert, err := s.newDeviceAlert(id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status != NewDevicePending {
+		return nil, fmt.Errorf("%w: the alert is %s", ErrInvalidNewDeviceAlert, alert.Status)
+	}
+	now := s.clock.Now()
+	alert.Status = NewDeviceIgnored
+	alert.ResolvedAt = &now
+	alert.ResolvedBy = actor
+	alert.Note = strings.TrimSpace(note)
+	if err := s.DB.GetDB().Save(alert).Error; err != nil {
+		return nil, fmt.Errorf("failed to save new device alert: %w", err)
+	}
+	s.logger.WithFields(map[string]any{
+		"alert_id":  alert.ID,
+		"mac":       alert.MAC,
+		"actor":     actor,
+		"component": "service",
+	}).Info("New device ignored")
+	return alert, nil
+}
+
+// ReportDeviceAnnounce handles a device announce relayed from MQTT. A device
+// not in the inventory is held as an alert with discovery.new_device_alerts,
+// and adopted like a discovered device otherwise.
+func (s *ShellyService) ReportDeviceAnnounce(ctx context.Context, announce DeviceAnnounce) (*AnnounceResult, error) {
+	if normalizeMAC(announce.MAC) == "" {
+		return nil, fmt.Errorf("%w: mac is required", ErrInvalidAnnounce)
+	}
+	if net.ParseIP(announce.IP) == nil {
+		return nil, fmt.Errorf("%w: invalid ip %q", ErrInvalidAnnounce, announce.IP)
+	}
+	inventory, err := s.inventoryByMAC()
+	if err != nil {
+		return nil, err
+	}
+	if device, ok := inventory[normalizeMAC(announce.MAC)]; ok {
+		return &AnnounceResult{Status: "known", DeviceID: device.ID}, nil
+	}
+
+	sd := discovery.ShellyDevice{
+		ID:         announce.ID,
+		Model:      announce.Model,
+		Generation: announce.Gen,
+		Version:    announce.Ver,
+		MAC:        normalizeMAC(announce.MAC),
+		IP:         announce.IP,
+		Discovered: s.clock.Now(),
+	}
+	if sd.Version == "" {
+		sd.Version = announce.FWVer
+	}
+	if sd.Generation == 0 {
+		sd.Generation = 1 // Gen1 announces carry no generation
+	}
+
+	if s.newDeviceAlertsEnabled() {
+		alert, err := s.recordNewDevice(ctx, sd, NewDeviceSourceAnnounce)
+		if err != nil {
+			return nil, err
+		}
+		return &AnnounceResult{Status: alert.Status, AlertID: alert.ID}, nil
+	}
+	device, err := s.adoptDiscovered(ctx, discoveredDevice{ShellyDevice: sd}, &naming.NameSet{}, false, NewDeviceSourceAnnounce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to adopt device: %w", err)
+	}
+	if device == nil {
+		return &AnnounceResult{Status: "vetoed"}, nil
+	}
+	return &AnnounceResult{Status: NewDeviceAdopted, DeviceID: device.ID}, nil
+}
+
+// recordNewDevice records a sighting of a device not in the inventory. A
+// first sighting, or one after the adopted device left the inventory, raises
+// a pending alert and notifies; later sightings only update it.
+func (s *ShellyService) recordNewDevice(ctx context.Context, sd discovery.ShellyDevice, source string) (*database.NewDeviceAlert, error) {
+	s.alertMu.Lock()
+	notify := s.newDeviceNotifier
+	alert, raised, err := s.saveNewDeviceSighting(sd, source)
+	s.alertMu.Unlock()
+	if err != nil {
+		s.logger.WithFields(map[string]any{
+			"mac":       sd.MAC,
+			"ip":        sd.IP,
+			"error":     err.Error(),
+			"component": "service",
+		}).Error("Failed to record new device")
+		return nil, err
+	}
+
+	if raised {
+		s.logger.WithFields(map[string]any{
+			"alert_id":  alert.ID,
+			"mac":       alert.MAC,
+			"ip":        alert.IP,
+			"model":     alert.Model,
+			"source":    source,
+			"component": "service",
+		}).Warn("Device not in the inventory detected")
+		if notify != nil {
+			notify(ctx, *alert)
+		}
+	}
+	return alert, nil
+}
+
+// saveNewDeviceSighting stores a sighting and reports whether it raised the
+// alert; callers hold alertMu
+func (s *ShellyService) saveNewDeviceSighting(sd discovery.ShellyDevice, source string) (*database.NewDeviceAlert, bool, error) {
+	now := s.clock.Now()
+	mac := normalizeMAC(sd.MAC)
+	var alert database.NewDeviceAlert
+	err := s.DB.GetDB().Where("mac = ?", mac).First(&alert).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		alert = database.NewDeviceAlert{MAC: mac, Status: NewDevicePending, FirstSeen: now}
+	case err != nil:
+		return nil, false, err
+	}
+
+	raised := alert.ID == 0
+	if alert.Status == NewDeviceAdopted {
+		// Adopted before, but no longer in the inventory
+		alert.Status = NewDevicePending
+		alert.FirstSeen = now
+		alert.Sightings = 0
+		alert.ResolvedAt = nil
+		alert.ResolvedBy = ""
+		alert.DeviceID = nil
+		raised = true
+	}
+	alert.IP = sd.IP
+	alert.Model = sd.Model
+	alert.Generation = sd.Generation
+	alert.Firmware = sd.Version
+	alert.ShellyID = sd.ID
+	alert.Source = source
+	alert.LastSeen = now
+	alert.Sightings++
+	if err := s.DB.GetDB().Save(&alert).Error; err != nil {
+		return nil, false, err
+	}
+	return &alert, raised, nil
+}
+
+// markNewDeviceAdopted resolves the pending alert of a device that was
+// added to the inventory by other means
+func (s *ShellyService) markNewDeviceAdopted(mac string, deviceID uint, actor string) {
+	now := s.clock.Now()
+	err := s.DB.GetDB().Model(&database.NewDeviceAlert{}).
+		Where("mac = ? AND status = ?", normalizeMAC(mac), NewDevicePending).
+		Updates(map[string]interface{}{"status": NewDeviceAdopted, "resolved_at": now, "resolved_by": actor, "device_id": deviceID}).Error
+	if err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": deviceID,
+			"error":     err.Error(),
+			"component": "service",
+		}).Warn("Failed to resolve new device alert")
+	}
+}
+
+// newDeviceAlert loads one alert
+func (s *ShellyService) newDeviceAlert(id uint) (*database.NewDeviceAlert, error) {
+	var alert database.NewDeviceAlert
+	if err := s.DB.GetDB().First(&alert, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNewDeviceAlertNotFound
+		}
+		return nil, fmt.Errorf("failed to load new device alert: %w", err)
+	}
+	return &alert, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_NewDeviceAlerts(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	service := NewService(db, cfg)
+	defer service.Stop()
+	ctx := context.Background()
+
+	notified := []database.NewDeviceAlert{}
+	service.SetNewDeviceNotifier(func(ctx context.Context, alert database.NewDeviceAlert) {
+		notified = append(notified, alert)
+	})
+
+	// Without the option, announced devices are adopted like discovered ones
+	result, err := service.ReportDeviceAnnounce(ctx, DeviceAnnounce{ID: "shelly1-AABBCC000001", Model: "SHSW-1", MAC: "AABBCC000001", IP: "10.0.0.21", FWVer: "v1.14.0"})
+	if err != nil {
+		t.Fatalf("ReportDeviceAnnounce failed: %v", err)
+	}
+	if result.Status != NewDeviceAdopted || result.DeviceID == 0 {
+		t.Fatalf("Expected the device adopted, got %+v", result)
+	}
+	if result, _ := service.ReportDeviceAnnounce(ctx, DeviceAnnounce{MAC: "AA:BB:CC:00:00:01", IP: "10.0.0.21"}); result == nil || result.Status != "known" {
+		t.Errorf("Expected a known device, got %+v", result)
+	}
+
+	cfg.Discovery.NewDeviceAlerts = true
+	rogue := DeviceAnnounce{ID: "shellyplus1-aabbcc000002", Model: "SNSW-001X16EU", MAC: "aabbcc000002", IP: "10.0.0.22", Gen: 2, Ver: "1.4.0"}
+	for i := 0; i < 2; i++ {
+		result, err = service.ReportDeviceAnnounce(ctx, rogue)
+		if err != nil {
+			t.Fatalf("ReportDeviceAnnounce failed: %v", err)
+		}
+	}
+	if result.Status != NewDevicePending || result.AlertID == 0 || result.DeviceID != 0 {
+		t.Fatalf("Expected a pending alert, got %+v", result)
+	}
+	if len(notified) != 1 || notified[0].MAC != "AABBCC000002" || notified[0].Model != "SNSW-001X16EU" || notified[0].Source != NewDeviceSourceAnnounce {
+		t.Fatalf("Expected one notification for the unknown device, got %+v", notified)
+	}
+	alerts, err := service.ListNewDeviceAlerts(NewDevicePending)
+	if err != nil || len(alerts) != 1 || alerts[0].Sightings != 2 || alerts[0].IP != "10.0.0.22" {
+		t.Fatalf("Unexpected pending alerts: %+v (%v)", alerts, err)
+	}
+
+	// Ignored devices stay out of the inventory and raise nothing
+	if _, err := service.IgnoreNewDevice(result.AlertID, "alice", "neighbour's plug"); err != nil {
+		t.Fatalf("IgnoreNewDevice failed: %v", err)
+	}
+	if _, err := service.IgnoreNewDevice(result.AlertID, "alice", ""); !errors.Is(err, ErrInvalidNewDeviceAlert) {
+		t.Errorf("Expected a second ignore refused, got %v", err)
+	}
+	if result, _ := service.ReportDeviceAnnounce(ctx, rogue); result == nil || result.Status != NewDeviceIgnored {
+		t.Errorf("Expected the device to stay ignored, got %+v", result)
+	}
+	if len(notified) != 1 {
+		t.Errorf("Expected no notification for an ignored device, got %d", len(notified))
+	}
+
+	// Adopting adds the device and records who did
+	alert, device, err := service.AdoptNewDevice(ctx, result.AlertID, "bob")
+	if err != nil {
+		t.Fatalf("AdoptNewDevice failed: %v", err)
+	}
+	if alert.Status != NewDeviceAdopted || alert.ResolvedBy != "bob" || alert.DeviceID == nil || *alert.DeviceID != device.ID {
+		t.Errorf("Unexpected adopted alert: %+v", alert)
+	}
+	if device.IP != "10.0.0.22" || device.MAC != "AABBCC000002" || device.Firmware != "1.4.0" {
+		t.Errorf("Unexpected adopted device: %+v", device)
+	}
+	if _, _, err := service.AdoptNewDevice(ctx, result.AlertID, "bob"); !errors.Is(err, ErrInvalidNewDeviceAlert) {
+		t.Errorf("Expected a second adoption refused, got %v", err)
+	}
+	if _, _, err := service.AdoptNewDevice(ctx, 999, "bob"); !errors.Is(err, ErrNewDeviceAlertNotFound) {
+		t.Errorf("Expected an unknown alert, got %v", err)
+	}
+	if _, err := service.ReportDeviceAnnounce(ctx, DeviceAnnounce{MAC: "AABBCC000003", IP: "not-an-ip"}); !errors.Is(err, ErrInvalidAnnounce) {
+		t.Errorf("Expected an invalid announce refused, got %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// outageCheckInterval is how often held offline alerts and the end of an
+// outage are checked between device requests
+const outageCheckInterval = 15 * time.Second
+
+// Outage event kinds
+const (
+	OutageStarted = "started"
+	OutageEnded   = "ended"
+)
+
+// OutageEvent reports the start or end of an outage
+type OutageEvent struct {
+	Kind      string     `json:"kind"` // started or ended
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Devices   int        `json:"devices"` // devices lost in the outage
+	Recovered int        `json:"recovered"`
+	Fleet     int        `json:"fleet"`
+}
+
+// OutageStatus is the outage detector's current view
+type OutageStatus struct {
+	Enabled   bool       `json:"enabled"`
+	Active    bool       `json:"active"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Devices   []uint     `json:"devices"` // devices lost in the active outage
+	Recovered int        `json:"recovered"`
+	Offline   int        `json:"offline"` // devices offline now
+	// HeldAlerts are offline alerts waiting out the detection window
+	HeldAlerts int `json:"held_alerts"`
+}
+
+// DeviceOfflineNotifier is told when a device goes offline outside an outage
+type DeviceOfflineNotifier func(ctx context.Context, deviceID uint, deviceName string, since time.Time)
+
+// OutageNotifier is told when an outage starts and ends
+type OutageNotifier func(ctx context.Context, event OutageEvent)
+
+// offlineDevice is a device whose link went dead
+type offlineDevice struct {
+	name    string
+	since   time.Time
+	alerted bool // alert sent, or folded into an outage
+}
+
+// outage is an outage in progress
+type outage struct {
+	startedAt time.Time
+	lost      map[uint]bool
+}
+
+// SetDeviceOfflineNotifier sets the callback told when a device goes offline
+// and no outage explains it
+func (s *ShellyService) SetDeviceOfflineNotifier(fn DeviceOfflineNotifier) {
+	s.outageMu.Lock()
+	defer s.outageMu.Unlock()
+	s.offlineNotifier = fn
+}
+
+// SetOutageNotifier sets the callback told when an outage starts and ends
+func (s *ShellyService) SetOutageNotifier(fn OutageNotifier) {
+	s.outageMu.Lock()
+	defer s.outageMu.Unlock()
+	s.outageNotifier = fn
+}
+
+// outageConfig returns the outage settings with defaults filled in
+func (s *ShellyService) outageConfig() config.OutageConfig {
+	if s.Config == nil {
+		return config.OutageConfig{}.WithDefaults()
+	}
+	return s.Config.Outage.WithDefaults()
+}
+
+// InOutage reports whether an outage is in progress
+func (s *ShellyService) InOutage() bool {
+	s.outageMu.Lock()
+	defer s.outageMu.Unlock()
+	return s.outage != nil
+}
+
+// pollWorkers returns how many devices a health or metrics job reads at
+// once: normal, or one during an outage
+func (s *ShellyService) pollWorkers(normal int) int {
+	if s.InOutage() {
+		return 1
+	}
+	return normal
+}
+
+// recoveryPause staggers device requests during an outage, so devices still
+// booting are not all asked at once. It returns false when ctx ends first.
+func (s *ShellyService) recoveryPause(ctx context.Context) bool {
+	if !s.InOutage() {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(s.outageConfig().ProbeDelayDuration())
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// noteLinkChange is told when a device's link goes dead or answers again
+func (s *ShellyService) noteLinkChange(device *database.Device, dead bool, now time.Time) {
+	s.outageMu.Lock()
+	if s.offline == nil {
+		s.offline = make(map[uint]*offlineDevice)
+	}
+	if dead {
+		if _, ok := s.offline[device.ID]; !ok {
+			s.offline[device.ID] = &offlineDevice{name: device.Name, since: now}
+		}
+	} else {
+		delete(s.offline, device.ID)
+	}
+	s.outageMu.Unlock()
+	s.evaluateOutage(now)
+}
+
+// evaluateOutage declares an outage when enough devices went offline within
+// the window, ends it once enough of them answer again, and sends the
+// offline alerts that waited out the window without an outage
+func (s *ShellyService) evaluateOutage(now time.Time) {
+	cfg := s.outageConfig()
+	enabled := s.Config != nil && s.Config.Outage.Enabled
+	fleet := s.fleetSize()
+
+	type alert struct {
+		id    uint
+		name  string
+		since time.Time
+	}
+	var alerts []alert
+	var event *OutageEvent
+
+	s.outageMu.Lock()
+	switch {
+	case s.outage != nil:
+		// Devices lost during the outage belong to it
+		for id, d := range s.offline {
+			if !d.alerted {
+				d.alerted = true
+				s.outage.lost[id] = true
+			}
+		}
+		recovered := 0
+		for id := range s.outage.lost {
+			if s.offline[id] == nil {
+				recovered++
+			}
+		}
+		if recovered*100 >= cfg.RecoveredPercent*len(s.outage.lost) {
+			ended := now
+			event = &OutageEvent{Kind: OutageEnded, StartedAt: s.outage.startedAt, EndedAt: &ended,
+				Devices: len(s.outage.lost), Recovered: recovered, Fleet: fleet}
+			s.outage = nil
+		}
+	case enabled:
+		recent := []uint{}
+		for id, d := range s.offline {
+			if !d.alerted && now.Sub(d.since) <= cfg.WindowDuration() {
+				recent = append(recent, id)
+			}
+		}
+		if len(recent) >= cfg.MinDevices && len(recent)*100 >= cfg.Percent*fleet {
+			s.outage = &outage{startedAt: now, lost: make(map[uint]bool, len(recent))}
+			for _, id := range recent {
+				s.offline[id].alerted = true
+				s.outage.lost[id] = true
+			}
+			event = &OutageEvent{Kind: OutageStarted, StartedAt: now, Devices: len(recent), Fleet: fleet}
+			break
+		}
+		fallthrough
+	default:
+		// Without outage detection offline alerts are not held
+		for id, d := range s.offline {
+			if !d.alerted && (!enabled || now.Sub(d.since) >= cfg.WindowDuration()) {
+				d.alerted = true
+				alerts = append(alerts, alert{id: id, name: d.name, since: d.since})
+			}
+		}
+	}
+	offlineNotify, outageNotify := s.offlineNotifier, s.outageNotifier
+	s.outageMu.Unlock()
+
+	if event != nil {
+		fields := map[string]any{
+			"devices":   event.Devices,
+			"recovered": event.Recovered,
+			"fleet":     fleet,
+			"component": "outage",
+		}
+		if event.Kind == OutageStarted {
+			s.logger.WithFields(fields).Warn("Outage detected, polling devices at recovery rate")
+		} else {
+			s.logger.WithFields(fields).Info("Outage over, resuming normal polling")
+		}
+		if outageNotify != nil {
+			outageNotify(s.ctx, *event)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].id < alerts[j].id })
+	for _, a := range alerts {
+		s.logger.WithFields(map[string]any{
+			"device_id": a.id,
+			"since":     a.since,
+			"component": "outage",
+		}).Warn("Device offline")
+		if offlineNotify != nil {
+			offlineNotify(s.ctx, a.id, a.name, a.since)
+		}
+	}
+}
+
+// fleetSize returns how many devices are in the inventory
+func (s *ShellyService) fleetSize() int {
+	if db := s.DB.GetDB(); db != nil {
+		var count int64
+		if err := db.Model(&database.Device{}).Count(&count).Error; err == nil {
+			return int(count)
+		}
+	}
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return 0
+	}
+	return len(devices)
+}
+
+// OutageStatus returns whether an outage is in progress and the offline
+// devices the detector knows about
+func (s *ShellyService) OutageStatus() OutageStatus {
+	status := OutageStatus{Enabled: s.Config != nil && s.Config.Outage.Enabled, Devices: []uint{}}
+	s.outageMu.Lock()
+	defer s.outageMu.Unlock()
+	status.Offline = len(s.offline)
+	for _, d := range s.offline {
+		if !d.alerted {
+			status.HeldAlerts++
+		}
+	}
+	if s.outage != nil {
+		status.Active = true
+		started := s.outage.startedAt
+		status.StartedAt = &started
+		for id := range s.outage.lost {
+			status.Devices = append(status.Devices, id)
+			if s.offline[id] == nil {
+				status.Recovered++
+			}
+		}
+		sort.Slice(status.Devices, func(i, j int) bool { return status.Devices[i] < status.Devices[j] })
+	}
+	return status
+}
+
+// StartOutageMonitor sends held offline alerts and ends outages between
+// device requests
+func (s *ShellyService) StartOutageMonitor() {
+	go func() {
+		ticker := s.clock.NewTicker(outageCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C():
+				if s.leader == nil || s.leader() {
+					s.evaluateOutage(s.clock.Now())
+				}
+			}
+		}
+	}()
+}
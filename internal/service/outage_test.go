@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestShellyService_OutageDetection(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	cfg.Outage = config.OutageConfig{Enabled: true, MinDevices: 3, Percent: 30, Window: 60, RecoveredPercent: 75, ProbeDelay: 1}
+	service := NewService(db, cfg)
+	defer service.Stop()
+	clk := testutil.NewFakeClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	service.SetClock(clk)
+
+	devices := make([]*database.Device, 10)
+	for i := range devices {
+		devices[i] = &database.Device{IP: fmt.Sprintf("192.0.2.%d", i+1), MAC: fmt.Sprintf("AABBCCDDEE%02d", i), Name: fmt.Sprintf("d%d", i)}
+		if err := db.AddDevice(devices[i]); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	var offline []uint
+	var events []OutageEvent
+	service.SetDeviceOfflineNotifier(func(_ context.Context, deviceID uint, _ string, _ time.Time) {
+		offline = append(offline, deviceID)
+	})
+	service.SetOutageNotifier(func(_ context.Context, event OutageEvent) { events = append(events, event) })
+
+	// A single device going offline is alerted once the window has passed
+	service.recordLatency(devices[0], 0, false)
+	if len(offline) != 0 || service.OutageStatus().HeldAlerts != 1 {
+		t.Fatalf("Expected the offline alert held, got %v", offline)
+	}
+	clk.Advance(2 * time.Minute)
+	service.evaluateOutage(clk.Now())
+	if len(offline) != 1 || offline[0] != devices[0].ID {
+		t.Fatalf("Expected one offline alert, got %v", offline)
+	}
+	service.recordLatency(devices[0], 20*time.Millisecond, true)
+
+	// Many devices going dark together are one outage
+	for _, d := range devices[1:5] {
+		service.recordLatency(d, 0, false)
+	}
+	if len(events) != 1 || events[0].Kind != OutageStarted || events[0].Devices != 3 || events[0].Fleet != 10 {
+		t.Fatalf("Expected one outage started, got %+v", events)
+	}
+	if !service.InOutage() || service.pollWorkers(rebootWorkers) != 1 {
+		t.Errorf("Expected polling throttled during the outage")
+	}
+	clk.Advance(2 * time.Minute)
+	service.evaluateOutage(clk.Now())
+	status := service.OutageStatus()
+	if len(offline) != 1 || !status.Active || len(status.Devices) != 4 {
+		t.Fatalf("Expected offline alerts folded into the outage, got %v %+v", offline, status)
+	}
+
+	// The outage ends once enough of the lost devices answer again; the
+	// rest are not alerted individually
+	for _, d := range devices[1:4] {
+		service.recordLatency(d, 20*time.Millisecond, true)
+	}
+	if len(events) != 2 || events[1].Kind != OutageEnded || events[1].Recovered != 3 || events[1].Devices != 4 {
+		t.Fatalf("Expected the outage over, got %+v", events)
+	}
+	clk.Advance(2 * time.Minute)
+	service.evaluateOutage(clk.Now())
+	if service.InOutage() || len(offline) != 1 {
+		t.Errorf("Expected no alerts after the outage, got %v", offline)
+	}
+}
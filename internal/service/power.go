@@ -0,0 +1,50 @@
+package service
+
+import (
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// powerReading is the power of each channel of a device in its last status
+type powerReading struct {
+	channels map[int]float64 // channel -> Watts
+	at       time.Time
+}
+
+// powerChannel is one metered output of a device
+type powerChannel struct {
+	deviceID uint
+	channel  int
+}
+
+// recordPower keeps the power of each channel a device reported in a status
+// read. Meter readings are used when present, meters[i] being channel i,
+// otherwise the power of each switch:N; a device without either is not
+// metered and is forgotten.
+func (s *ShellyService) recordPower(deviceID uint, status *shelly.DeviceStatus) {
+	if status == nil {
+		return
+	}
+	channels := map[int]float64{}
+	if len(status.Meters) > 0 {
+		for i, m := range status.Meters {
+			channels[i] = m.Power
+		}
+	} else {
+		for _, sw := range status.Switches {
+			channels[sw.ID] = sw.APower
+		}
+	}
+
+	s.powerMu.Lock()
+	defer s.powerMu.Unlock()
+	if len(channels) == 0 {
+		delete(s.power, deviceID)
+		return
+	}
+	if s.power == nil {
+		s.power = make(map[uint]powerReading)
+	}
+	s.power[deviceID] = powerReading{channels: channels, at: s.clock.Now()}
+}
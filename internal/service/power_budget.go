@@ -0,0 +1,598 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// Power budget actions
+const (
+	PowerBudgetActionNotify = "notify" // notify only
+	PowerBudgetActionShed   = "shed"   // notify and switch off the lowest-priority loads
+)
+
+// Power budget defaults
+const (
+	defaultPowerBudgetVoltage = 230.0
+	defaultPowerBudgetSustain = 60 // seconds
+)
+
+var (
+	// ErrPowerBudgetNotFound is returned for unknown power budget groups
+	ErrPowerBudgetNotFound = errors.New("power budget group not found")
+	// ErrPowerBudgetExists is returned when another group has the name
+	ErrPowerBudgetExists = errors.New("power budget group already exists")
+	// ErrInvalidPowerBudget wraps power budget group validation failures
+	ErrInvalidPowerBudget = errors.New("invalid power budget group")
+)
+
+// PowerBudgetNotifier is told when a group has been over its limit for its
+// sustain period, and with Resolved set once it is back within the limit
+type PowerBudgetNotifier func(ctx context.Context, event PowerBudgetEvent)
+
+// PowerBudgetEvent reports a group exceeding its limit or recovering
+type PowerBudgetEvent struct {
+	GroupID    uint              `json:"group_id"`
+	Name       string            `json:"name"`
+	Watts      float64           `json:"watts"`
+	LimitWatts float64           `json:"limit_watts"`
+	Shed       []PowerBudgetShed `json:"shed,omitempty"`
+	Resolved   bool              `json:"resolved"`
+	// Exceeded is the number of groups still over their limit after this
+	// event
+	Exceeded int       `json:"exceeded"`
+	At       time.Time `json:"at"`
+}
+
+// PowerBudgetShed is a load switched off to bring a group within its limit
+type PowerBudgetShed struct {
+	DeviceID uint      `json:"device_id"`
+	Name     string    `json:"name,omitempty"`
+	Channel  int       `json:"channel"`
+	Priority int       `json:"priority"`
+	Watts    float64   `json:"watts"` // power of the device before it was shed
+	At       time.Time `json:"at"`
+	Error    string    `json:"error,omitempty"` // the relay could not be switched off
+}
+
+// PowerBudgetStatus is a group's summed power and enforcement state
+type PowerBudgetStatus struct {
+	GroupID    uint              `json:"group_id"`
+	Name       string            `json:"name"`
+	Enabled    bool              `json:"enabled"`
+	Action     string            `json:"action"`
+	LimitWatts float64           `json:"limit_watts"`
+	Watts      float64           `json:"watts"`
+	Usage      float64           `json:"usage_percent"`
+	Metered    int               `json:"metered"`   // members with a recent reading
+	Unmetered  []uint            `json:"unmetered"` // members without one
+	OverSince  *time.Time        `json:"over_since,omitempty"`
+	Exceeded   bool              `json:"exceeded"`       // over for the sustain period
+	Shed       []PowerBudgetShed `json:"shed,omitempty"` // loads shed since the limit was exceeded
+	CheckedAt  *time.Time        `json:"checked_at,omitempty"`
+}
+
+// powerBudgetState is what the checks remember about a group between runs
+type powerBudgetState struct {
+	overSince *time.Time
+	exceeded  bool
+	shed      []PowerBudgetShed
+	watts     float64
+	checkedAt time.Time
+}
+
+// SetPowerBudgetNotifier sets the callback told about exceeded power budgets
+func (s *ShellyService) SetPowerBudgetNotifier(fn PowerBudgetNotifier) {
+	s.budgetMu.Lock()
+	defer s.budgetMu.Unlock()
+	s.budgetNotifier = fn
+}
+
+// powerBudgetConfig returns the configured power budget settings
+func (s *ShellyService) powerBudgetConfig() config.PowerBudgetConfig {
+	if s.Config == nil {
+		return config.PowerBudgetConfig{}
+	}
+	return s.Config.PowerBudgets
+}
+
+// powerBudgetMaxAge is how old a reading may be to count towards a group
+func (s *ShellyService) powerBudgetMaxAge() time.Duration {
+	return 3 * s.powerBudgetConfig().IntervalDuration()
+}
+
+// BudgetLimitWatts returns the limit of a group in W: limit_watts, or
+// limit_amps at the group's voltage
+func BudgetLimitWatts(group *database.PowerBudgetGroup) float64 {
+	if group.LimitWatts > 0 {
+		return group.LimitWatts
+	}
+	voltage := group.Voltage
+	if voltage <= 0 {
+		voltage = defaultPowerBudgetVoltage
+	}
+	return group.LimitAmps * voltage
+}
+
+// budgetSustain returns how long a group may exceed its limit before acting
+func budgetSustain(group *database.PowerBudgetGroup) time.Duration {
+	if group.SustainSeconds <= 0 {
+		return defaultPowerBudgetSustain * time.Second
+	}
+	return time.Duration(group.SustainSeconds) * time.Second
+}
+
+// ListPowerBudgets returns the power budget groups with their members by
+// name
+func (s *ShellyService) ListPowerBudgets() ([]database.PowerBudgetGroup, error) {
+	groups := []database.PowerBudgetGroup{}
+	if err := s.DB.GetDB().Preload("Members").Order("name").Find(&groups).Error; err != nil {
+		return nil, fmt.Errorf("failed to load power budget groups: %w", err)
+	}
+	return groups, nil
+}
+
+// GetPowerBudget returns a power budget group with its members
+func (s *ShellyService) GetPowerBudget(id uint) (*database.PowerBudgetGroup, error) {
+	var group database.PowerBudgetGroup
+	if err := s.DB.GetDB().Preload("Members").First(&group, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrPowerBudgetNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to load power budget group: %w", err)
+	}
+	return &group, nil
+}
+
+// SavePowerBudget validates a power budget group and creates it, or replaces
+// the group with its ID and all of its members. Enforcement state is kept
+// across updates.
+func (s *ShellyService) SavePowerBudget(group *database.PowerBudgetGroup) error {
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPowerBudget)
+	}
+	if group.LimitWatts < 0 || group.LimitAmps < 0 || group.Voltage < 0 || group.SustainSeconds < 0 {
+		return fmt.Errorf("%w: limits, voltage and sustain_seconds must not be negative", ErrInvalidPowerBudget)
+	}
+	if BudgetLimitWatts(group) <= 0 {
+		return fmt.Errorf("%w: limit_watts or limit_amps is required", ErrInvalidPowerBudget)
+	}
+	switch group.Action {
+	case "":
+		group.Action = PowerBudgetActionNotify
+	case PowerBudgetActionNotify, PowerBudgetActionShed:
+	default:
+		return fmt.Errorf("%w: unknown action %q (expected notify or shed)", ErrInvalidPowerBudget, group.Action)
+	}
+	seen := map[uint]bool{}
+	for i := range group.Members {
+		m := &group.Members[i]
+		if seen[m.DeviceID] {
+			return fmt.Errorf("%w: device %d is listed twice", ErrInvalidPowerBudget, m.DeviceID)
+		}
+		seen[m.DeviceID] = true
+		if m.Channel < 0 {
+			return fmt.Errorf("%w: channel of device %d must not be negative", ErrInvalidPowerBudget, m.DeviceID)
+		}
+		if _, err := s.DB.GetDevice(m.DeviceID); err != nil {
+			return fmt.Errorf("%w: device %d not found", ErrInvalidPowerBudget, m.DeviceID)
+		}
+	}
+
+	var conflict int64
+	if err := s.DB.GetDB().Model(&database.PowerBudgetGroup{}).
+		Where("name = ? AND id <> ?", group.Name, group.ID).Count(&conflict).Error; err != nil {
+		return fmt.Errorf("failed to save power budget group: %w", err)
+	}
+	if conflict > 0 {
+		return fmt.Errorf("%w: %s", ErrPowerBudgetExists, group.Name)
+	}
+
+	members := group.Members
+	err := s.DB.GetDB().Transaction(func(tx *gorm.DB) error {
+		if group.ID != 0 {
+			var existing database.PowerBudgetGroup
+			if err := tx.First(&existing, group.ID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return fmt.Errorf("%w: %d", ErrPowerBudgetNotFound, group.ID)
+				}
+				return err
+			}
+			group.CreatedAt = existing.CreatedAt
+		}
+		if err := tx.Omit("Members").Save(group).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&database.PowerBudgetMember{}).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			members[i].ID = 0
+			members[i].GroupID = group.ID
+		}
+		if len(members) > 0 {
+			return tx.Create(&members).Error
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrPowerBudgetNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to save power budget group: %w", err)
+	}
+	group.Members = members
+	return nil
+}
+
+// DeletePowerBudget removes a power budget group and its members
+func (s *ShellyService) DeletePowerBudget(id uint) error {
+	err := s.DB.GetDB().Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&database.PowerBudgetGroup{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("%w: %d", ErrPowerBudgetNotFound, id)
+		}
+		return tx.Where("group_id = ?", id).Delete(&database.PowerBudgetMember{}).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrPowerBudgetNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete power budget group: %w", err)
+	}
+	s.budgetMu.Lock()
+	delete(s.budgets, id)
+	s.budgetMu.Unlock()
+	return nil
+}
+
+// PowerBudgetStatus sums the recent power readings of a group's members and
+// reports its enforcement state
+func (s *ShellyService) PowerBudgetStatus(id uint) (*PowerBudgetStatus, error) {
+	group, err := s.GetPowerBudget(id)
+	if err != nil {
+		return nil, err
+	}
+	readings := s.powerReadings(s.powerBudgetMaxAge())
+	status := budgetStatus(group, readings)
+
+	s.budgetMu.Lock()
+	defer s.budgetMu.Unlock()
+	if state := s.budgets[id]; state != nil {
+		status.OverSince = state.overSince
+		status.Exceeded = state.exceeded
+		status.Shed = append([]PowerBudgetShed(nil), state.shed...)
+		checkedAt := state.checkedAt
+		status.CheckedAt = &checkedAt
+	}
+	return status, nil
+}
+
+// powerReadings returns the channel power readings no older than maxAge
+func (s *ShellyService) powerReadings(maxAge time.Duration) map[powerChannel]float64 {
+	cutoff := s.clock.Now().Add(-maxAge)
+	s.powerMu.Lock()
+	defer s.powerMu.Unlock()
+	readings := make(map[powerChannel]float64, len(s.power))
+	for id, r := range s.power {
+		if r.at.Before(cutoff) {
+			continue
+		}
+		for channel, watts := range r.channels {
+			readings[powerChannel{id, channel}] = watts
+		}
+	}
+	return readings
+}
+
+// budgetStatus sums the readings of a group's members, each the power of
+// its own channel
+func budgetStatus(group *database.PowerBudgetGroup, readings map[powerChannel]float64) *PowerBudgetStatus {
+	status := &PowerBudgetStatus{
+		GroupID:    group.ID,
+		Name:       group.Name,
+		Enabled:    group.Enabled,
+		Action:     group.Action,
+		LimitWatts: BudgetLimitWatts(group),
+		Unmetered:  []uint{},
+	}
+	for _, m := range group.Members {
+		watts, ok := readings[powerChannel{m.DeviceID, m.Channel}]
+		if !ok {
+			status.Unmetered = append(status.Unmetered, m.DeviceID)
+			continue
+		}
+		status.Watts += watts
+		status.Metered++
+	}
+	if status.LimitWatts > 0 {
+		status.Usage = status.Watts / status.LimitWatts * 100
+	}
+	return status
+}
+
+// CheckPowerBudgets compares every enabled group's summed power with its
+// limit. A group over its limit for its sustain period is notified and, with
+// the shed action, switched-on members are switched off lowest priority
+// first until the group's estimated power is within the limit. A group that
+// stays over its limit sheds again after another sustain period. Shed loads
+// are not switched back on.
+func (s *ShellyService) CheckPowerBudgets(ctx context.Context, now time.Time) ([]PowerBudgetStatus, error) {
+	var groups []database.PowerBudgetGroup
+	if err := s.DB.GetDB().Preload("Members").Where("enabled = ?", true).Order("id").Find(&groups).Error; err != nil {
+		return nil, fmt.Errorf("failed to load power budget groups: %w", err)
+	}
+	readings := s.powerReadings(s.powerBudgetMaxAge())
+
+	s.budgetMu.Lock()
+	if s.budgets == nil {
+		s.budgets = make(map[uint]*powerBudgetState)
+	}
+	active := make(map[uint]bool, len(groups))
+	for _, g := range groups {
+		active[g.ID] = true
+	}
+	// Groups deleted or disabled since the last check are no longer over
+	// their limit
+	for id := range s.budgets {
+		if !active[id] {
+			delete(s.budgets, id)
+		}
+	}
+	notify := s.budgetNotifier
+	s.budgetMu.Unlock()
+
+	statuses := make([]PowerBudgetStatus, 0, len(groups))
+	events := []PowerBudgetEvent{}
+	for i := range groups {
+		group := &groups[i]
+		status := budgetStatus(group, readings)
+
+		s.budgetMu.Lock()
+		state := s.budgets[group.ID]
+		if state == nil {
+			state = &powerBudgetState{}
+			s.budgets[group.ID] = state
+		}
+		state.watts = status.Watts
+		state.checkedAt = now
+		over := status.Watts > status.LimitWatts
+		var act, first, resolved bool
+		switch {
+		case !over:
+			resolved = state.exceeded
+			state.overSince = nil
+			state.exceeded = false
+		case state.overSince == nil:
+			overSince := now
+			state.overSince = &overSince
+		case now.Sub(*state.overSince) >= budgetSustain(group):
+			first = !state.exceeded
+			if first {
+				state.shed = nil
+			}
+			act = first || group.Action == PowerBudgetActionShed
+			state.exceeded = true
+		}
+		s.budgetMu.Unlock()
+
+		if act {
+			var shed []PowerBudgetShed
+			if group.Action == PowerBudgetActionShed {
+				shed = s.shedLoads(ctx, group, readings, status.Watts-status.LimitWatts, now)
+			}
+			s.budgetMu.Lock()
+			state.shed = append(state.shed, shed...)
+			// Shedding waits for another sustain period before going further
+			overSince := now
+			state.overSince = &overSince
+			s.budgetMu.Unlock()
+
+			if first || len(shed) > 0 {
+				events = append(events, PowerBudgetEvent{
+					GroupID:    group.ID,
+					Name:       group.Name,
+					Watts:      status.Watts,
+					LimitWatts: status.LimitWatts,
+					Shed:       shed,
+					At:         now,
+				})
+			}
+			s.logger.WithFields(map[string]any{
+				"group":     group.Name,
+				"watts":     status.Watts,
+				"limit":     status.LimitWatts,
+				"shed":      len(shed),
+				"component": "power_budget",
+			}).Warn("Power budget exceeded")
+		}
+		if resolved {
+			events = append(events, PowerBudgetEvent{
+				GroupID:    group.ID,
+				Name:       group.Name,
+				Watts:      status.Watts,
+				LimitWatts: status.LimitWatts,
+				Resolved:   true,
+				At:         now,
+			})
+			s.logger.WithFields(map[string]any{
+				"group":     group.Name,
+				"watts":     status.Watts,
+				"limit":     status.LimitWatts,
+				"component": "power_budget",
+			}).Info("Power budget back within its limit")
+		}
+
+		s.budgetMu.Lock()
+		status.OverSince = state.overSince
+		status.Exceeded = state.exceeded
+		status.Shed = append([]PowerBudgetShed(nil), state.shed...)
+		checkedAt := state.checkedAt
+		status.CheckedAt = &checkedAt
+		s.budgetMu.Unlock()
+		statuses = append(statuses, *status)
+	}
+
+	if notify != nil && len(events) > 0 {
+		exceeded := 0
+		for _, st := range statuses {
+			if st.Exceeded {
+				exceeded++
+			}
+		}
+		for _, event := range events {
+			event.Exceeded = exceeded
+			notify(ctx, event)
+		}
+	}
+	return statuses, nil
+}
+
+// shedLoads switches off the unprotected members of a group that draw power,
+// lowest priority and then highest power first, until at least excess W is
+// shed. A shed channel's reading drops to zero until the device reports
+// again; its other channels keep theirs.
+func (s *ShellyService) shedLoads(ctx context.Context, group *database.PowerBudgetGroup, readings map[powerChannel]float64, excess float64, now time.Time) []PowerBudgetShed {
+	watts := func(m database.PowerBudgetMember) float64 {
+		return readings[powerChannel{m.DeviceID, m.Channel}]
+	}
+	candidates := []database.PowerBudgetMember{}
+	for _, m := range group.Members {
+		if !m.Protected && watts(m) > 0 {
+			candidates = append(candidates, m)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return watts(a) > watts(b)
+	})
+
+	shed := []PowerBudgetShed{}
+	for _, m := range candidates {
+		if excess <= 0 {
+			break
+		}
+		load := PowerBudgetShed{
+			DeviceID: m.DeviceID,
+			Channel:  m.Channel,
+			Priority: m.Priority,
+			Watts:    watts(m),
+			At:       now,
+		}
+		if device, err := s.DB.GetDevice(m.DeviceID); err == nil {
+			load.Name = device.Name
+		}
+		err := s.ControlDeviceContext(ctx, m.DeviceID, "off", map[string]interface{}{"channel": float64(m.Channel)})
+		if err != nil {
+			load.Error = err.Error()
+			s.logger.WithFields(map[string]any{
+				"group":     group.Name,
+				"device_id": m.DeviceID,
+				"channel":   m.Channel,
+				"error":     err.Error(),
+				"component": "power_budget",
+			}).Warn("Failed to shed load")
+			shed = append(shed, load)
+			continue
+		}
+		excess -= load.Watts
+		s.powerMu.Lock()
+		if r, ok := s.power[m.DeviceID]; ok {
+			channels := make(map[int]float64, len(r.channels))
+			for channel, w := range r.channels {
+				channels[channel] = w
+			}
+			channels[m.Channel] = 0
+			s.power[m.DeviceID] = powerReading{channels: channels, at: r.at}
+		}
+		s.powerMu.Unlock()
+		s.logger.WithFields(map[string]any{
+			"group":     group.Name,
+			"device_id": m.DeviceID,
+			"channel":   m.Channel,
+			"watts":     load.Watts,
+			"component": "power_budget",
+		}).Warn("Shed load to keep within power budget")
+		shed = append(shed, load)
+	}
+	return shed
+}
+
+// refreshBudgetReadings reads the status of enabled groups' members whose
+// last reading is older than two check intervals, so groups are monitored
+// even when nothing else reads their devices
+func (s *ShellyService) refreshBudgetReadings() {
+	var members []database.PowerBudgetMember
+	err := s.DB.GetDB().
+		Joins("JOIN power_budget_groups ON power_budget_groups.id = power_budget_members.group_id").
+		Where("power_budget_groups.enabled = ?", true).
+		Find(&members).Error
+	if err != nil {
+		return
+	}
+	fresh := s.powerReadings(2 * s.powerBudgetConfig().IntervalDuration())
+	refreshed := map[uint]bool{}
+	for _, m := range members {
+		if _, ok := fresh[powerChannel{m.DeviceID, m.Channel}]; ok || refreshed[m.DeviceID] {
+			continue
+		}
+		refreshed[m.DeviceID] = true
+		if s.ctx.Err() != nil {
+			return
+		}
+		_, _ = s.GetDeviceStatus(m.DeviceID)
+	}
+}
+
+// StartPowerBudgetChecks checks the power budget groups every
+// power_budgets.interval until the service stops
+func (s *ShellyService) StartPowerBudgetChecks() {
+	cfg := s.powerBudgetConfig()
+	if !cfg.Enabled {
+		return
+	}
+	interval := cfg.IntervalDuration()
+
+	go func() {
+		ticker := s.clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C():
+			}
+			if s.leader != nil && !s.leader() {
+				continue
+			}
+			s.refreshBudgetReadings()
+			if _, err := s.CheckPowerBudgets(s.ctx, s.clock.Now()); err != nil && s.ctx.Err() == nil {
+				s.logger.WithFields(map[string]any{
+					"error":     err.Error(),
+					"component": "power_budget",
+				}).Warn("Power budget check failed")
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]any{
+		"interval":  interval.String(),
+		"component": "power_budget",
+	}).Info("Started power budget checks")
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_PowerBudgets(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	server := createMockShellyServer()
+	defer server.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	heater := createTestDevice(t, db, server.URL[len("http://"):])
+	charger := &database.Device{IP: "192.0.2.60", MAC: "68C63A000060", Name: "charger", Status: "offline"}
+	freezer := &database.Device{IP: "192.0.2.61", MAC: "68C63A000061", Name: "freezer", Status: "online"}
+	for _, d := range []*database.Device{charger, freezer} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+	}
+
+	for name, group := range map[string]database.PowerBudgetGroup{
+		"no limit":       {Name: "garage"},
+		"unknown action": {Name: "garage", LimitWatts: 100, Action: "explode"},
+		"unknown device": {Name: "garage", LimitWatts: 100, Members: []database.PowerBudgetMember{{DeviceID: 999}}},
+		"duplicate": {Name: "garage", LimitWatts: 100, Members: []database.PowerBudgetMember{
+			{DeviceID: heater.ID}, {DeviceID: heater.ID},
+		}},
+	} {
+		if err := service.SavePowerBudget(&group); !errors.Is(err, ErrInvalidPowerBudget) {
+			t.Errorf("%s: expected ErrInvalidPowerBudget, got %v", name, err)
+		}
+	}
+
+	group := &database.PowerBudgetGroup{
+		Name:      "garage circuit 16A",
+		LimitAmps: 16,
+		Action:    PowerBudgetActionShed,
+		Enabled:   true,
+		Members: []database.PowerBudgetMember{
+			{DeviceID: heater.ID, Priority: 1},
+			{DeviceID: charger.ID, Priority: 0},
+			{DeviceID: freezer.ID, Priority: 0, Protected: true},
+		},
+	}
+	if err := service.SavePowerBudget(group); err != nil {
+		t.Fatalf("SavePowerBudget failed: %v", err)
+	}
+	if BudgetLimitWatts(group) != 3680 {
+		t.Errorf("Expected 16 A at 230 V, got %.0f W", BudgetLimitWatts(group))
+	}
+	if err := service.SavePowerBudget(&database.PowerBudgetGroup{Name: group.Name, LimitWatts: 1}); !errors.Is(err, ErrPowerBudgetExists) {
+		t.Errorf("Expected duplicate names to be rejected, got %v", err)
+	}
+
+	var events []PowerBudgetEvent
+	service.SetPowerBudgetNotifier(func(ctx context.Context, event PowerBudgetEvent) {
+		events = append(events, event)
+	})
+	setPower := func(deviceID uint, watts float64) {
+		service.powerMu.Lock()
+		defer service.powerMu.Unlock()
+		if service.power == nil {
+			service.power = map[uint]powerReading{}
+		}
+		service.power[deviceID] = powerReading{channels: map[int]float64{0: watts}, at: time.Now()}
+	}
+	setPower(heater.ID, 2000)
+	setPower(charger.ID, 2500)
+	setPower(freezer.ID, 150)
+
+	check := func(at time.Time) PowerBudgetStatus {
+		statuses, err := service.CheckPowerBudgets(context.Background(), at)
+		if err != nil || len(statuses) != 1 {
+			t.Fatalf("CheckPowerBudgets failed: %v %+v", err, statuses)
+		}
+		return statuses[0]
+	}
+
+	// Short peaks are tolerated for the sustain period
+	start := time.Now()
+	if status := check(start); status.Watts != 4650 || status.OverSince == nil || status.Exceeded {
+		t.Fatalf("Expected the group to be over its limit, got %+v", status)
+	}
+	if status := check(start.Add(30 * time.Second)); status.Exceeded || len(events) != 0 {
+		t.Fatalf("Expected no action within the sustain period, got %+v", status)
+	}
+
+	// The offline charger cannot be switched off, so the heater is shed next;
+	// the protected freezer is kept
+	status := check(start.Add(61 * time.Second))
+	if !status.Exceeded || len(status.Shed) != 2 {
+		t.Fatalf("Expected two loads tried, got %+v", status)
+	}
+	if status.Shed[0].DeviceID != charger.ID || status.Shed[0].Error == "" ||
+		status.Shed[1].DeviceID != heater.ID || status.Shed[1].Error != "" {
+		t.Errorf("Unexpected shed loads: %+v", status.Shed)
+	}
+	if len(events) != 1 || events[0].Resolved || events[0].Exceeded != 1 || len(events[0].Shed) != 2 {
+		t.Fatalf("Expected one exceeded event, got %+v", events)
+	}
+
+	// The heater's reading dropped to zero, bringing the group within budget
+	status = check(start.Add(75 * time.Second))
+	if status.Exceeded || status.Watts != 2650 {
+		t.Errorf("Expected the group back within its limit, got %+v", status)
+	}
+	if len(events) != 2 || !events[1].Resolved || events[1].Exceeded != 0 {
+		t.Errorf("Expected a resolved event, got %+v", events)
+	}
+
+	if err := service.DeletePowerBudget(group.ID); err != nil {
+		t.Fatalf("DeletePowerBudget failed: %v", err)
+	}
+	if _, err := service.GetPowerBudget(group.ID); !errors.Is(err, ErrPowerBudgetNotFound) {
+		t.Errorf("Expected ErrPowerBudgetNotFound, got %v", err)
+	}
+}
+
+func TestBudgetStatus_PerChannel(t *testing.T) {
+	group := &database.PowerBudgetGroup{
+		Name:       "kitchen",
+		LimitWatts: 1000,
+		Members: []database.PowerBudgetMember{
+			{DeviceID: 1, Channel: 0},
+			{DeviceID: 1, Channel: 2},
+		},
+	}
+	// Channel 1 of the same device is on another circuit
+	readings := map[powerChannel]float64{{1, 0}: 300, {1, 1}: 2000}
+
+	status := budgetStatus(group, readings)
+	if status.Watts != 300 || status.Metered != 1 {
+		t.Errorf("Expected only the member channels to count, got %+v", status)
+	}
+	if len(status.Unmetered) != 1 || status.Unmetered[0] != 1 {
+		t.Errorf("Expected the unreported channel to be unmetered, got %+v", status.Unmetered)
+	}
+}
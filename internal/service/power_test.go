@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+func TestShellyService_RecordPower(t *testing.T) {
+	service := NewService(createTestDB(t), createTestConfigBusiness())
+	defer service.Stop()
+
+	service.recordPower(1, &shelly.DeviceStatus{Meters: []shelly.MeterStatus{{Power: 40}, {Power: 2.5}},
+		Switches: []shelly.SwitchStatus{{APower: 1000}}})
+	service.recordPower(2, &shelly.DeviceStatus{Switches: []shelly.SwitchStatus{{APower: 7.5}}})
+	service.recordPower(3, &shelly.DeviceStatus{Inputs: []shelly.InputStatus{{}}})
+
+	readings := service.powerReadings(time.Minute)
+	want := map[powerChannel]float64{{1, 0}: 40, {1, 1}: 2.5, {2, 0}: 7.5}
+	if len(readings) != len(want) {
+		t.Errorf("Expected meter and switch power per channel, got %v", readings)
+	}
+	for key, watts := range want {
+		if readings[key] != watts {
+			t.Errorf("Expected %.1f W on %v, got %v", watts, key, readings)
+		}
+	}
+
+	// Switches are keyed by their switch:N ID
+	service.recordPower(2, &shelly.DeviceStatus{Switches: []shelly.SwitchStatus{{ID: 1, APower: 3}}})
+	if readings := service.powerReadings(time.Minute); readings[powerChannel{2, 1}] != 3 {
+		t.Errorf("Expected switch:1 power on channel 1, got %v", readings)
+	}
+
+	// A status without any power reading forgets the device
+	service.recordPower(2, &shelly.DeviceStatus{})
+	if readings := service.powerReadings(time.Minute); len(readings) != 2 {
+		t.Errorf("Expected the channels of one device left, got %v", readings)
+	}
+
+	service.powerMu.Lock()
+	service.power[1] = powerReading{channels: map[int]float64{0: 42.5}, at: time.Now().Add(-time.Hour)}
+	service.powerMu.Unlock()
+	if readings := service.powerReadings(time.Minute); len(readings) != 0 {
+		t.Errorf("Expected stale readings to be ignored, got %v", readings)
+	}
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// Pre-flight checks and their outcomes
+const (
+	PreflightGateway = "gateway"
+	PreflightMQTT    = "mqtt"
+	PreflightSNTP    = "sntp"
+
+	PreflightOK       = "ok"
+	PreflightFailed   = "failed"
+	PreflightDisabled = "disabled"
+	PreflightUnknown  = "unknown"
+)
+
+// preflightWorkers bounds concurrent device reads during a pre-flight run
+const preflightWorkers = 10
+
+// PreflightRequest selects the devices checked by Preflight
+type PreflightRequest struct {
+	DeviceIDs []uint `json:"device_ids,omitempty"` // empty selects every device
+	Tag       string `json:"tag,omitempty"`
+}
+
+// PreflightCheck is one cell of the connectivity matrix
+type PreflightCheck struct {
+	Result string `json:"result"` // ok, failed, disabled, unknown
+	Target string `json:"target,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// PreflightDevice is one row of the connectivity matrix
+type PreflightDevice struct {
+	DeviceID uint                      `json:"device_id"`
+	Name     string                    `json:"name"`
+	IP       string                    `json:"ip"`
+	Checks   map[string]PreflightCheck `json:"checks,omitempty"`
+	Error    string                    `json:"error,omitempty"`
+}
+
+// PreflightTarget aggregates one infrastructure endpoint across devices. A
+// target most devices fail to reach is likely broken itself.
+type PreflightTarget struct {
+	Check  string `json:"check"`
+	Target string `json:"target"`
+	OK     int    `json:"ok"`
+	Failed int    `json:"failed"`
+}
+
+// PreflightReport is the connectivity matrix for a set of devices
+type PreflightReport struct {
+	GeneratedAt time.Time                 `json:"generated_at"`
+	Devices     []PreflightDevice         `json:"devices"`
+	Targets     []PreflightTarget         `json:"targets"`
+	Summary     map[string]map[string]int `json:"summary"` // check -> result -> count
+	Unreachable int                       `json:"unreachable"`
+}
+
+// Preflight reads status and configuration from each selected device and
+// derives whether it reaches its gateway, MQTT broker and SNTP server. The
+// result is a connectivity matrix plus per-target totals, so broken shared
+// infrastructure shows up as one failing target rather than as scattered drift
+// or missing metrics.
+func (s *ShellyService) Preflight(ctx context.Context, req PreflightRequest) (*PreflightReport, error) {
+	targets, err := s.SelectDevices(req.DeviceIDs, req.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]PreflightDevice, len(targets))
+	fanOut(preflightWorkers, len(targets), func(i int) {
+		rows[i] = s.preflightDevice(ctx, &targets[i])
+	})
+
+	report := buildPreflightReport(rows)
+	s.logger.WithFields(map[string]any{
+		"devices":     len(rows),
+		"unreachable": report.Unreachable,
+		"component":   "service",
+	}).Info("Pre-flight connectivity check completed")
+	return report, nil
+}
+
+// preflightDevice reads one device and evaluates its checks
+func (s *ShellyService) preflightDevice(ctx context.Context, device *database.Device) PreflightDevice {
+	row := PreflightDevice{DeviceID: device.ID, Name: device.Name, IP: device.IP}
+	client, err := s.getClient(device)
+	if err != nil {
+		row.Error = fmt.Sprintf("failed to create client: %v", err)
+		return row
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+
+	status, err := client.GetStatus(ctx)
+	if err != nil {
+		row.Error = fmt.Sprintf("failed to read status: %v", err)
+		return row
+	}
+	cfg, err := client.GetConfig(ctx)
+	if err != nil {
+		row.Error = fmt.Sprintf("failed to read configuration: %v", err)
+		return row
+	}
+	var rawConfig map[string]interface{}
+	_ = json.Unmarshal(cfg.Raw, &rawConfig)
+
+	row.Checks = evaluatePreflight(status.Raw, rawConfig, s.expectedMQTTServer())
+	return row
+}
+
+// expectedMQTTServer returns the broker devices are provisioned with, if any
+func (s *ShellyService) expectedMQTTServer() string {
+	if s.Config == nil || !s.Config.Provisioning.MQTTEnabled {
+		return ""
+	}
+	return s.Config.Provisioning.MQTTServer
+}
+
+// evaluatePreflight derives the connectivity checks from a device's raw status
+// and configuration. Gen1 and Gen2 layouts are both understood.
+func evaluatePreflight(status, cfg map[string]interface{}, expectedMQTT string) map[string]PreflightCheck {
+	checks := map[string]PreflightCheck{}
+
+	// Gateway: the device holds a station IP and answered us
+	gateway := PreflightCheck{Result: PreflightUnknown}
+	if wifi := mapAt(status, "wifi_sta"); wifi != nil {
+		gateway.Result = boolResult(wifi["connected"] == true)
+	} else if wifi := mapAt(status, "wifi"); wifi != nil {
+		ip, _ := wifi["sta_ip"].(string)
+		gateway.Result = boolResult(ip != "")
+	}
+	if eth := mapAt(status, "eth"); eth != nil && gateway.Result != PreflightOK {
+		if ip, _ := eth["ip"].(string); ip != "" {
+			gateway.Result = PreflightOK
+		}
+	}
+	gateway.Target = "dhcp"
+	if gw := stringAt(cfg, "wifi_sta", "gw"); gw != "" {
+		gateway.Target = gw
+	} else if gw := stringAt(cfg, "wifi", "sta", "gw"); gw != "" {
+		gateway.Target = gw
+	}
+	checks[PreflightGateway] = gateway
+
+	// MQTT: enabled in the configuration and connected in the status
+	mqttCfg := mapAt(cfg, "mqtt")
+	mqtt := PreflightCheck{Result: PreflightDisabled, Target: stringAt(cfg, "mqtt", "server")}
+	if mqttCfg != nil && mqttCfg["enable"] == true {
+		mqtt.Result = PreflightUnknown
+		if st := mapAt(status, "mqtt"); st != nil {
+			mqtt.Result = boolResult(st["connected"] == true)
+		}
+		if expectedMQTT != "" && mqtt.Target != "" && !strings.EqualFold(mqtt.Target, expectedMQTT) {
+			mqtt.Detail = fmt.Sprintf("configured broker differs from %s", expectedMQTT)
+		}
+	} else if expectedMQTT != "" {
+		mqtt.Result = PreflightFailed
+		mqtt.Target = expectedMQTT
+		mqtt.Detail = "MQTT is not enabled on the device"
+	}
+	checks[PreflightMQTT] = mqtt
+
+	// SNTP: the device has a valid wall clock
+	sntp := PreflightCheck{Result: PreflightUnknown, Target: stringAt(cfg, "sntp", "server")}
+	if sntp.Target == "" {
+		sntp.Target = stringAt(cfg, "sys", "sntp", "server")
+	}
+	if enabled, ok := mapAt(cfg, "sntp")["enabled"].(bool); ok && !enabled {
+		sntp.Result = PreflightDisabled
+	} else if sys := mapAt(status, "sys"); sys != nil {
+		unix, _ := sys["unixtime"].(float64)
+		sntp.Result = boolResult(unix > 0)
+	} else if _, ok := status["unixtime"]; ok {
+		unix, _ := status["unixtime"].(float64)
+		timeStr, _ := status["time"].(string)
+		sntp.Result = boolResult(unix > 0 && timeStr != "")
+	}
+	checks[PreflightSNTP] = sntp
+
+	return checks
+}
+
+// buildPreflightReport assembles totals per check and per target
+func buildPreflightReport(rows []PreflightDevice) *PreflightReport {
+	report := &PreflightReport{
+		GeneratedAt: time.Now(),
+		Devices:     rows,
+		Summary:     map[string]map[string]int{},
+	}
+	byTarget := map[[2]string]*PreflightTarget{}
+	for _, row := range rows {
+		if row.Error != "" {
+			report.Unreachable++
+			continue
+		}
+		for name, check := range row.Checks {
+			if report.Summary[name] == nil {
+				report.Summary[name] = map[string]int{}
+			}
+			report.Summary[name][check.Result]++
+			if check.Target == "" || (check.Result != PreflightOK && check.Result != PreflightFailed) {
+				continue
+			}
+			key := [2]string{name, check.Target}
+			t := byTarget[key]
+			if t == nil {
+				t = &PreflightTarget{Check: name, Target: check.Target}
+				byTarget[key] = t
+			}
+			if check.Result == PreflightOK {
+				t.OK++
+			} else {
+				t.Failed++
+			}
+		}
+	}
+	report.Targets = make([]PreflightTarget, 0, len(byTarget))
+	for _, t := range byTarget {
+		report.Targets = append(report.Targets, *t)
+	}
+	sort.Slice(report.Targets, func(i, j int) bool {
+		if report.Targets[i].Check != report.Targets[j].Check {
+			return report.Targets[i].Check < report.Targets[j].Check
+		}
+		return report.Targets[i].Target < report.Targets[j].Target
+	})
+	return report
+}
+
+// boolResult maps a check outcome to ok or failed
+func boolResult(ok bool) string {
+	if ok {
+		return PreflightOK
+	}
+	return PreflightFailed
+}
+
+// mapAt returns the nested object at path, or nil
+func mapAt(m map[string]interface{}, path ...string) map[string]interface{} {
+	for _, key := range path {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		m = next
+	}
+	return m
+}
+
+// stringAt returns the string at path, or ""
+func stringAt(m map[string]interface{}, path ...string) string {
+	parent := mapAt(m, path[:len(path)-1]...)
+	if parent == nil {
+		return ""
+	}
+	v, _ := parent[path[len(path)-1]].(string)
+	return v
+}
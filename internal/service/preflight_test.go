@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_Preflight(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	server := createMockShellyServer()
+	defer server.Close()
+
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	cfg.DeviceClient.Timeout = config.IntPtr(1)
+	cfg.DeviceClient.RetryAttempts = config.IntPtr(1)
+	cfg.DeviceClient.RetryDelay = config.IntPtr(1)
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	createTestDevice(t, db, server.URL[len("http://"):])
+	offline := &database.Device{IP: "127.0.0.1:1", MAC: "68C63A000060", Name: "porch", Status: "offline",
+		Settings: `{"model":"SHSW-1","gen":1}`}
+	if err := db.AddDevice(offline); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+
+	report, err := service.Preflight(context.Background(), PreflightRequest{})
+	if err != nil {
+		t.Fatalf("Preflight failed: %v", err)
+	}
+	if len(report.Devices) != 2 || report.Unreachable != 1 || report.Devices[1].Error == "" {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	checks := report.Devices[0].Checks
+	if checks[PreflightGateway].Result != PreflightOK || checks[PreflightGateway].Target != "dhcp" {
+		t.Errorf("Unexpected gateway check: %+v", checks[PreflightGateway])
+	}
+	if checks[PreflightMQTT].Result != PreflightDisabled {
+		t.Errorf("Unexpected MQTT check: %+v", checks[PreflightMQTT])
+	}
+	if checks[PreflightSNTP].Result != PreflightOK || checks[PreflightSNTP].Target != "time.google.com" {
+		t.Errorf("Unexpected SNTP check: %+v", checks[PreflightSNTP])
+	}
+
+	if _, err := service.Preflight(context.Background(), PreflightRequest{DeviceIDs: []uint{999}}); err == nil {
+		t.Error("Expected error for unknown device")
+	}
+}
+
+func TestEvaluatePreflight_Gen2(t *testing.T) {
+	status := map[string]interface{}{
+		"wifi": map[string]interface{}{"sta_ip": "10.0.0.5", "status": "got ip"},
+		"mqtt": map[string]interface{}{"connected": false},
+		"sys":  map[string]interface{}{"unixtime": nil},
+	}
+	cfg := map[string]interface{}{
+		"wifi": map[string]interface{}{"sta": map[string]interface{}{"gw": "10.0.0.1"}},
+		"mqtt": map[string]interface{}{"enable": true, "server": "broker.lan:1883"},
+		"sys":  map[string]interface{}{"sntp": map[string]interface{}{"server": "ntp.lan"}},
+	}
+
+	checks := evaluatePreflight(status, cfg, "broker.lan:1883")
+	if c := checks[PreflightGateway]; c.Result != PreflightOK || c.Target != "10.0.0.1" {
+		t.Errorf("Unexpected gateway check: %+v", c)
+	}
+	if c := checks[PreflightMQTT]; c.Result != PreflightFailed || c.Target != "broker.lan:1883" || c.Detail != "" {
+		t.Errorf("Unexpected MQTT check: %+v", c)
+	}
+	if c := checks[PreflightSNTP]; c.Result != PreflightFailed || c.Target != "ntp.lan" {
+		t.Errorf("Unexpected SNTP check: %+v", c)
+	}
+
+	report := buildPreflightReport([]PreflightDevice{{DeviceID: 1, Checks: checks}, {DeviceID: 2, Checks: checks}})
+	for _, target := range report.Targets {
+		if target.Check == PreflightMQTT && target.Failed != 2 {
+			t.Errorf("Expected the broker to fail for both devices, got %+v", target)
+		}
+	}
+}
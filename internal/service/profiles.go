@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/configuration"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// profileReimportTimeout bounds the wait for a device to come back after a
+// profile switch before its configuration is re-imported
+const profileReimportTimeout = 60 * time.Second
+
+// profileReimportInterval is the delay between import attempts after a
+// profile switch; tests shorten it
+var profileReimportInterval = 3 * time.Second
+
+// ErrProfileUnsupported is returned when a device cannot switch to a profile
+var ErrProfileUnsupported = errors.New("profile not supported by device")
+
+// DeviceProfileChange describes a profile switch. Without confirmation it
+// only lists what would change.
+type DeviceProfileChange struct {
+	DeviceID         uint                        `json:"device_id"`
+	From             string                      `json:"from"`
+	To               string                      `json:"to"`
+	Profiles         []string                    `json:"profiles"` // profiles the device can switch between
+	OperationsBefore []string                    `json:"operations_before"`
+	OperationsAfter  []string                    `json:"operations_after"`
+	Confirmed        bool                        `json:"confirmed"`
+	Changed          bool                        `json:"changed"`
+	Device           *database.Device            `json:"device,omitempty"`
+	Config           *configuration.DeviceConfig `json:"config,omitempty"` // re-imported configuration
+	ReimportError    string                      `json:"reimport_error,omitempty"`
+}
+
+// recordDeviceProfile stores the profile named in an imported configuration
+// on the device, so capabilities follow a profile changed on the device
+// itself
+func (s *ShellyService) recordDeviceProfile(device *database.Device, config json.RawMessage) {
+	profile := shelly.ConfigProfile(config)
+	if profile == "" || profile == device.Profile || shelly.SupportedProfiles(deviceModelOf(device)) == nil {
+		return
+	}
+	previous := device.Profile
+	device.Profile = profile
+	if err := s.DB.UpdateDevice(device); err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": device.ID,
+			"error":     err.Error(),
+			"component": "service",
+		}).Warn("Failed to record device profile")
+		return
+	}
+	s.logger.WithFields(map[string]any{
+		"device_id": device.ID,
+		"from":      previous,
+		"to":        profile,
+		"component": "service",
+	}).Info("Recorded device profile")
+}
+
+// SetDeviceProfile switches a device with relay and cover profiles to
+// another profile. Without confirm nothing is sent and the result lists the
+// operations the device gains and loses. After the switch the device
+// restarts; its configuration is re-imported once it answers again, so the
+// stored configuration describes the new components instead of showing up
+// as drift.
+func (s *ShellyService) SetDeviceProfile(ctx context.Context, deviceID uint, profile string, confirm bool) (*DeviceProfileChange, error) {
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	profiles := shelly.SupportedProfiles(deviceModelOf(device))
+	if profiles == nil {
+		return nil, fmt.Errorf("%w: device %d has a single profile", ErrProfileUnsupported, deviceID)
+	}
+	target := shelly.NormalizeProfile(profile)
+	if target == "" {
+		return nil, fmt.Errorf("%w: unknown profile %q", ErrProfileUnsupported, profile)
+	}
+
+	change := &DeviceProfileChange{DeviceID: deviceID, From: device.Profile, To: target, Profiles: profiles}
+	change.OperationsBefore, _ = DeviceOperations(device)
+	after := *device
+	after.Profile = target
+	change.OperationsAfter, _ = DeviceOperations(&after)
+	if device.Profile == target || !confirm {
+		change.Device = device
+		return change, nil
+	}
+	change.Confirmed = true
+
+	client, err := s.getClient(device)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	if client.GetGeneration() >= 2 {
+		caller, ok := client.(rpcCaller)
+		if !ok {
+			cancel()
+			return nil, fmt.Errorf("%w: device %d does not accept RPC calls", ErrProfileUnsupported, deviceID)
+		}
+		s.expectReboot(device.ID)
+		err = caller.CallRPC(callCtx, "Shelly.SetProfile", map[string]interface{}{"name": target})
+	} else {
+		mode := "relay"
+		if target == shelly.ProfileCover {
+			mode = "roller"
+		}
+		err = client.SetConfig(callCtx, map[string]interface{}{"mode": mode})
+	}
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to switch profile: %w", err)
+	}
+	change.Changed = true
+
+	device.Profile = target
+	if err := s.DB.UpdateDevice(device); err != nil {
+		return nil, fmt.Errorf("failed to save device: %w", err)
+	}
+	s.logger.WithFields(map[string]any{
+		"device_id": device.ID,
+		"from":      change.From,
+		"to":        target,
+		"component": "service",
+	}).Info("Switched device profile")
+
+	config, err := s.reimportAfterProfileSwitch(ctx, device.ID, target)
+	if err != nil {
+		change.ReimportError = err.Error()
+	}
+	change.Config = config
+	// The import records the profile the device reports
+	change.Device = device
+	if updated, err := s.DB.GetDevice(deviceID); err == nil {
+		change.Device = updated
+	}
+	return change, nil
+}
+
+// reimportAfterProfileSwitch imports the configuration of a device that is
+// restarting into a new profile, retrying until the import reports that
+// profile or the timeout passes
+func (s *ShellyService) reimportAfterProfileSwitch(ctx context.Context, deviceID uint, profile string) (*configuration.DeviceConfig, error) {
+	deadline := time.Now().Add(profileReimportTimeout)
+	for {
+		config, err := s.ImportDeviceConfig(deviceID)
+		if err == nil {
+			if reported := shelly.ConfigProfile(config.Config); reported == "" || reported == profile {
+				return config, nil
+			}
+			err = fmt.Errorf("device still reports the %s profile", shelly.ConfigProfile(config.Config))
+		}
+		if time.Now().Add(profileReimportInterval).After(deadline) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(profileReimportInterval):
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+func TestShellyService_SetDeviceProfile(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	defer func(d time.Duration) { profileReimportInterval = d }(profileReimportInterval)
+	profileReimportInterval = 10 * time.Millisecond
+
+	var mu sync.Mutex
+	profile := "switch"
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Method {
+		case "Shelly.GetDeviceInfo":
+			_, _ = fmt.Fprintf(w, `{"id":1,"result":{"id":"shellyplus2pm-aabbccddee01","model":"SNSW-102P16EU","gen":2,"profile":%q}}`, profile)
+		case "Shelly.SetProfile":
+			calls++
+			profile = req.Params["name"].(string)
+			_, _ = w.Write([]byte(`{"id":1,"result":{"profile_was":"switch"}}`))
+		case "Shelly.GetConfig":
+			component := `"switch:0":{"id":0,"name":null},"switch:1":{"id":1,"name":null}`
+			if profile == "cover" {
+				component = `"cover:0":{"id":0,"name":null,"maxtime_open":60}`
+			}
+			_, _ = fmt.Fprintf(w, `{"id":1,"result":{"sys":{"device":{"name":"Hall","profile":%q}},%s}}`, profile, component)
+		default:
+			_, _ = w.Write([]byte(`{"id":1,"result":{}}`))
+		}
+	}))
+	defer server.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	device := &database.Device{IP: server.URL[len("http://"):], MAC: "AABBCCDDEE01", Type: "SNSW-102P16EU",
+		Name: "Hall", Firmware: "1.0.0", Settings: `{"model":"SNSW-102P16EU","gen":2}`}
+	single := &database.Device{IP: "192.0.2.20", MAC: "AABBCCDDEE02", Type: "SNSW-001X16EU",
+		Settings: `{"model":"SNSW-001X16EU","gen":2}`}
+	for _, d := range []*database.Device{device, single} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := service.SetDeviceProfile(ctx, single.ID, "cover", true); !errors.Is(err, ErrProfileUnsupported) {
+		t.Errorf("Expected a single-profile device to be refused, got %v", err)
+	}
+	if _, err := service.SetDeviceProfile(ctx, device.ID, "light", true); !errors.Is(err, ErrProfileUnsupported) {
+		t.Errorf("Expected an unknown profile to be refused, got %v", err)
+	}
+	if _, err := service.SetDeviceProfile(ctx, 999, "cover", true); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected unknown device to be refused, got %v", err)
+	}
+
+	// Importing the configuration records the profile the device reports
+	if _, err := service.ImportDeviceConfig(device.ID); err != nil {
+		t.Fatalf("ImportDeviceConfig failed: %v", err)
+	}
+	stored, _ := db.GetDevice(device.ID)
+	if stored.Profile != shelly.ProfileSwitch {
+		t.Fatalf("Expected the switch profile to be recorded, got %q", stored.Profile)
+	}
+	if err := requireOperation(stored, shelly.OpRoller); !errors.Is(err, ErrUnsupportedCapability) {
+		t.Errorf("Expected roller control to be refused in the switch profile, got %v", err)
+	}
+
+	// Without confirmation only the effect is reported
+	preview, err := service.SetDeviceProfile(ctx, device.ID, "roller", false)
+	if err != nil {
+		t.Fatalf("SetDeviceProfile preview failed: %v", err)
+	}
+	if preview.Changed || preview.Confirmed || calls != 0 {
+		t.Errorf("Expected the preview to change nothing, got %+v with %d calls", preview, calls)
+	}
+	if preview.From != "switch" || preview.To != "cover" {
+		t.Errorf("Unexpected preview profiles %q -> %q", preview.From, preview.To)
+	}
+	if got := strings.Join(preview.OperationsAfter, ","); strings.Contains(got, shelly.OpSwitch) || !strings.Contains(got, shelly.OpRoller) {
+		t.Errorf("Unexpected operations after the switch: %s", got)
+	}
+
+	change, err := service.SetDeviceProfile(ctx, device.ID, "cover", true)
+	if err != nil {
+		t.Fatalf("SetDeviceProfile failed: %v", err)
+	}
+	if !change.Changed || calls != 1 || change.ReimportError != "" {
+		t.Fatalf("Expected the profile to be switched, got %+v with %d calls", change, calls)
+	}
+	if change.Device.Profile != shelly.ProfileCover {
+		t.Errorf("Expected the cover profile to be stored, got %q", change.Device.Profile)
+	}
+	if change.Config == nil || !strings.Contains(string(change.Config.Config), `"cover:0"`) {
+		t.Errorf("Expected the cover configuration to be re-imported, got %+v", change.Config)
+	}
+
+	// Switching to the active profile does nothing
+	again, err := service.SetDeviceProfile(ctx, device.ID, "cover", true)
+	if err != nil || again.Changed || calls != 1 {
+		t.Errorf("Expected no switch to the active profile, got %+v, %v", again, err)
+	}
+}
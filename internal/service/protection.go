@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// Protection report defaults
+const (
+	defaultProtectionDays     = 30
+	defaultProtectionMinTrips = 3
+)
+
+// protectionKinds maps the protection names devices report to the kinds
+// stored. Other errors a device reports are not protection trips.
+var protectionKinds = map[string]string{
+	"overpower":       "overpower",
+	"overtemp":        "overtemperature",
+	"overtemperature": "overtemperature",
+	"overvoltage":     "overvoltage",
+	"undervoltage":    "undervoltage",
+	"overcurrent":     "overcurrent",
+}
+
+// tripKey identifies a protection on one channel of a device
+type tripKey struct {
+	Channel int
+	Kind    string
+}
+
+// ProtectionNotifier is told when a device trips a protection, and with
+// ClearedAt set once none of its protections are tripped any more
+type ProtectionNotifier func(ctx context.Context, trip database.ProtectionTrip, deviceName string)
+
+// ProtectionDevice is a device's protection trips in the report window
+type ProtectionDevice struct {
+	DeviceID       uint           `json:"device_id"`
+	Name           string         `json:"name,omitempty"`
+	Trips          int            `json:"trips"`
+	ByKind         map[string]int `json:"by_kind"`
+	Channels       []int          `json:"channels"`
+	Active         int            `json:"active"` // trips not cleared yet
+	MaxPower       float64        `json:"max_power"`
+	MaxTemperature float64        `json:"max_temperature"`
+	LastTrip       time.Time      `json:"last_trip"`
+	Repeated       bool           `json:"repeated"` // at least min_trips trips
+}
+
+// ProtectionReport lists devices that tripped a protection in the last days,
+// most trips first. Devices that trip repeatedly likely drive a load too
+// large for their relay.
+type ProtectionReport struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Days        int                `json:"days"`
+	MinTrips    int                `json:"min_trips"`
+	Devices     []ProtectionDevice `json:"devices"`
+	Repeated    int                `json:"repeated"`
+}
+
+// SetProtectionNotifier sets the callback told about protection trips
+func (s *ShellyService) SetProtectionNotifier(fn ProtectionNotifier) {
+	s.protectionMu.Lock()
+	defer s.protectionMu.Unlock()
+	s.protectionNotifier = fn
+}
+
+// activeProtections returns the protections tripped in a status read, with
+// the values measured on the tripped channel
+func activeProtections(deviceID uint, status *shelly.DeviceStatus, now time.Time) map[tripKey]database.ProtectionTrip {
+	active := map[tripKey]database.ProtectionTrip{}
+	power := 0.0
+	for _, sw := range status.Switches {
+		power += sw.APower
+		for _, name := range sw.Errors {
+			kind, ok := protectionKinds[name]
+			if !ok {
+				continue
+			}
+			active[tripKey{Channel: sw.ID, Kind: kind}] = database.ProtectionTrip{
+				DeviceID:    deviceID,
+				Channel:     sw.ID,
+				Kind:        kind,
+				Power:       sw.APower,
+				Voltage:     sw.Voltage,
+				Current:     sw.Current,
+				Temperature: sw.Temperature,
+				TrippedAt:   now,
+			}
+		}
+	}
+	for _, m := range status.Meters {
+		power += m.Power
+	}
+
+	// Gen1 devices report overtemperature for the device as a whole
+	if status.Overtemperature {
+		covered := false
+		for key := range active {
+			covered = covered || key.Kind == "overtemperature"
+		}
+		if !covered {
+			active[tripKey{Channel: -1, Kind: "overtemperature"}] = database.ProtectionTrip{
+				DeviceID:    deviceID,
+				Channel:     -1,
+				Kind:        "overtemperature",
+				Power:       power,
+				Temperature: status.Temperature,
+				TrippedAt:   now,
+			}
+		}
+	}
+	return active
+}
+
+// recordProtection stores the protections a device newly tripped in a status
+// read and clears those no longer reported. Trips left open by a previous
+// run are picked up on the first read of a device.
+func (s *ShellyService) recordProtection(deviceID uint, status *shelly.DeviceStatus) {
+	if status == nil {
+		return
+	}
+	db := s.DB.GetDB()
+	if db == nil {
+		return
+	}
+	now := s.clock.Now()
+	active := activeProtections(deviceID, status, now)
+
+	s.protectionMu.Lock()
+	if s.activeTrips == nil {
+		s.activeTrips = make(map[uint]map[tripKey]uint)
+	}
+	open, seen := s.activeTrips[deviceID]
+	if seen && len(open) == 0 && len(active) == 0 {
+		s.protectionMu.Unlock()
+		return
+	}
+	if !seen {
+		open = map[tripKey]uint{}
+		var stored []database.ProtectionTrip
+		if err := db.Where("device_id = ? AND cleared_at IS NULL", deviceID).Find(&stored).Error; err != nil {
+			s.protectionMu.Unlock()
+			return
+		}
+		for _, t := range stored {
+			open[tripKey{Channel: t.Channel, Kind: t.Kind}] = t.ID
+		}
+		s.activeTrips[deviceID] = open
+	}
+
+	tripped := []database.ProtectionTrip{}
+	for key, trip := range active {
+		if _, ok := open[key]; ok {
+			continue
+		}
+		if err := db.Create(&trip).Error; err != nil {
+			s.logger.WithFields(map[string]any{
+				"device_id": deviceID,
+				"error":     err.Error(),
+				"component": "protection",
+			}).Warn("Failed to record protection trip")
+			continue
+		}
+		open[key] = trip.ID
+		tripped = append(tripped, trip)
+	}
+	cleared := 0
+	for key, id := range open {
+		if _, ok := active[key]; ok {
+			continue
+		}
+		if err := db.Model(&database.ProtectionTrip{}).Where("id = ?", id).Update("cleared_at", now).Error; err != nil {
+			continue
+		}
+		delete(open, key)
+		cleared++
+	}
+	resolved := cleared > 0 && len(open) == 0
+	notify := s.protectionNotifier
+	s.protectionMu.Unlock()
+
+	for _, trip := range tripped {
+		s.logger.WithFields(map[string]any{
+			"device_id":   deviceID,
+			"channel":     trip.Channel,
+			"kind":        trip.Kind,
+			"power":       trip.Power,
+			"temperature": trip.Temperature,
+			"component":   "protection",
+		}).Warn("Device protection tripped")
+	}
+	if notify == nil || (len(tripped) == 0 && !resolved) {
+		return
+	}
+	name := ""
+	if device, err := s.DB.GetDevice(deviceID); err == nil {
+		name = device.Name
+	}
+	for _, trip := range tripped {
+		notify(s.ctx, trip, name)
+	}
+	if resolved {
+		notify(s.ctx, database.ProtectionTrip{DeviceID: deviceID, ClearedAt: &now}, name)
+	}
+}
+
+// DeviceProtectionTrips returns a device's protection trips, newest first. A
+// limit of zero returns all trips.
+func (s *ShellyService) DeviceProtectionTrips(deviceID uint, limit int) ([]database.ProtectionTrip, error) {
+	trips := []database.ProtectionTrip{}
+	db := s.DB.GetDB()
+	if db == nil {
+		return trips, nil
+	}
+	query := db.Where("device_id = ?", deviceID).Order("tripped_at DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&trips).Error; err != nil {
+		return nil, fmt.Errorf("failed to load protection trips: %w", err)
+	}
+	return trips, nil
+}
+
+// ProtectionReport lists the devices that tripped a protection in the last
+// days, flagging those with at least minTrips trips. Zero values use the
+// defaults of 30 days and 3 trips.
+func (s *ShellyService) ProtectionReport(days, minTrips int) (*ProtectionReport, error) {
+	if days <= 0 {
+		days = defaultProtectionDays
+	}
+	if minTrips <= 0 {
+		minTrips = defaultProtectionMinTrips
+	}
+	report := &ProtectionReport{GeneratedAt: s.clock.Now(), Days: days, MinTrips: minTrips, Devices: []ProtectionDevice{}}
+	db := s.DB.GetDB()
+	if db == nil {
+		return report, nil
+	}
+	var trips []database.ProtectionTrip
+	since := report.GeneratedAt.AddDate(0, 0, -days)
+	if err := db.Where("tripped_at >= ?", since).Find(&trips).Error; err != nil {
+		return nil, fmt.Errorf("failed to load protection trips: %w", err)
+	}
+
+	byDevice := map[uint]*ProtectionDevice{}
+	channels := map[uint]map[int]bool{}
+	for _, t := range trips {
+		d, ok := byDevice[t.DeviceID]
+		if !ok {
+			d = &ProtectionDevice{DeviceID: t.DeviceID, ByKind: map[string]int{}, Channels: []int{}}
+			byDevice[t.DeviceID] = d
+			channels[t.DeviceID] = map[int]bool{}
+		}
+		d.Trips++
+		d.ByKind[t.Kind]++
+		if t.ClearedAt == nil {
+			d.Active++
+		}
+		if !channels[t.DeviceID][t.Channel] {
+			channels[t.DeviceID][t.Channel] = true
+			d.Channels = append(d.Channels, t.Channel)
+		}
+		if t.Power > d.MaxPower {
+			d.MaxPower = t.Power
+		}
+		if t.Temperature > d.MaxTemperature {
+			d.MaxTemperature = t.Temperature
+		}
+		if t.TrippedAt.After(d.LastTrip) {
+			d.LastTrip = t.TrippedAt
+		}
+	}
+	for id, d := range byDevice {
+		if device, err := s.DB.GetDevice(id); err == nil {
+			d.Name = device.Name
+		}
+		sort.Ints(d.Channels)
+		d.Repeated = d.Trips >= minTrips
+		if d.Repeated {
+			report.Repeated++
+		}
+		report.Devices = append(report.Devices, *d)
+	}
+	sort.Slice(report.Devices, func(i, j int) bool {
+		a, b := report.Devices[i], report.Devices[j]
+		if a.Trips != b.Trips {
+			return a.Trips > b.Trips
+		}
+		return a.DeviceID < b.DeviceID
+	})
+	return report, nil
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+func TestShellyService_ProtectionTrips(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	var notified []database.ProtectionTrip
+	service.SetProtectionNotifier(func(_ context.Context, trip database.ProtectionTrip, _ string) {
+		notified = append(notified, trip)
+	})
+
+	healthy := &shelly.DeviceStatus{Switches: []shelly.SwitchStatus{{ID: 0, APower: 900}}}
+	tripped := &shelly.DeviceStatus{Switches: []shelly.SwitchStatus{
+		{ID: 0, APower: 3650, Voltage: 231, Current: 15.8, Temperature: 71, Errors: []string{"overpower", "cal_abort"}},
+	}}
+
+	service.recordProtection(1, healthy)
+	if trips, _ := service.DeviceProtectionTrips(1, 0); len(trips) != 0 {
+		t.Fatalf("Expected no trips, got %+v", trips)
+	}
+
+	// A trip is stored once while it stays active, then cleared
+	for i := 0; i < 3; i++ {
+		service.recordProtection(1, tripped)
+		service.recordProtection(1, tripped)
+		service.recordProtection(1, healthy)
+	}
+	trips, err := service.DeviceProtectionTrips(1, 0)
+	if err != nil {
+		t.Fatalf("DeviceProtectionTrips failed: %v", err)
+	}
+	if len(trips) != 3 {
+		t.Fatalf("Expected 3 trips, got %+v", trips)
+	}
+	trip := trips[0]
+	if trip.Kind != "overpower" || trip.Channel != 0 || trip.Power != 3650 || trip.Current != 15.8 || trip.ClearedAt == nil {
+		t.Errorf("Unexpected trip: %+v", trip)
+	}
+	if len(notified) != 6 || notified[0].Kind != "overpower" || notified[0].ClearedAt != nil || notified[1].ClearedAt == nil {
+		t.Errorf("Expected a trip and a clear notification per trip, got %+v", notified)
+	}
+
+	// Device wide overtemperature, still active after a restart
+	service.recordProtection(2, &shelly.DeviceStatus{Temperature: 94, Overtemperature: true})
+	restarted := NewService(db, cfg)
+	defer restarted.Stop()
+	restarted.recordProtection(2, &shelly.DeviceStatus{Temperature: 95, Overtemperature: true})
+	trips, _ = restarted.DeviceProtectionTrips(2, 0)
+	if len(trips) != 1 || trips[0].Channel != -1 || trips[0].Kind != "overtemperature" || trips[0].Temperature != 94 || trips[0].ClearedAt != nil {
+		t.Errorf("Expected one open overtemperature trip, got %+v", trips)
+	}
+
+	report, err := service.ProtectionReport(0, 0)
+	if err != nil {
+		t.Fatalf("ProtectionReport failed: %v", err)
+	}
+	if report.Days != 30 || report.MinTrips != 3 || len(report.Devices) != 2 || report.Repeated != 1 {
+		t.Fatalf("Unexpected protection report: %+v", report)
+	}
+	first, second := report.Devices[0], report.Devices[1]
+	if first.DeviceID != 1 || first.Trips != 3 || !first.Repeated || first.ByKind["overpower"] != 3 || first.MaxPower != 3650 || first.Active != 0 {
+		t.Errorf("Unexpected report entry: %+v", first)
+	}
+	if second.DeviceID != 2 || second.Repeated || second.Active != 1 || second.MaxTemperature != 94 {
+		t.Errorf("Unexpected report entry: %+v", second)
+	}
+}
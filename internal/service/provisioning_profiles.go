@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+var (
+	// ErrProvisioningProfileNotFound is returned for unknown profile names
+	ErrProvisioningProfileNotFound = errors.New("provisioning profile not found")
+	// ErrInvalidProvisioningProfile wraps profile validation failures
+	ErrInvalidProvisioningProfile = errors.New("invalid provisioning profile")
+)
+
+// profileNamePattern keeps profile names usable in URLs and on the command line
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ListProvisioningProfiles returns the stored provisioning profiles by name
+func (s *ShellyService) ListProvisioningProfiles() ([]database.ProvisioningProfile, error) {
+	profiles := []database.ProvisioningProfile{}
+	if err := s.DB.GetDB().Order("name").Find(&profiles).Error; err != nil {
+		return nil, fmt.Errorf("failed to load provisioning profiles: %w", err)
+	}
+	return profiles, nil
+}
+
+// GetProvisioningProfile returns the profile with the given name
+func (s *ShellyService) GetProvisioningProfile(name string) (*database.ProvisioningProfile, error) {
+	var profile database.ProvisioningProfile
+	if err := s.DB.GetDB().Where("name = ?", name).First(&profile).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrProvisioningProfileNotFound, name)
+		}
+		return nil, fmt.Errorf("failed to load provisioning profile: %w", err)
+	}
+	return &profile, nil
+}
+
+// SaveProvisioningProfile creates the profile or replaces the one with the
+// same name. Empty passwords keep the stored ones, so a profile can be
+// changed without sending its credentials again.
+func (s *ShellyService) SaveProvisioningProfile(profile *database.ProvisioningProfile) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+	if !profileNamePattern.MatchString(profile.Name) {
+		return fmt.Errorf("%w: name must be letters, digits, '.', '_' or '-'", ErrInvalidProvisioningProfile)
+	}
+
+	existing, err := s.GetProvisioningProfile(profile.Name)
+	if err != nil && !errors.Is(err, ErrProvisioningProfileNotFound) {
+		return err
+	}
+	if existing != nil {
+		profile.ID = existing.ID
+		profile.CreatedAt = existing.CreatedAt
+		if profile.WiFiPassword == "" {
+			profile.WiFiPassword = existing.WiFiPassword
+		}
+		if profile.AuthPassword == "" {
+			profile.AuthPassword = existing.AuthPassword
+		}
+	} else {
+		profile.ID = 0
+		profile.CreatedAt = time.Time{}
+	}
+
+	if profile.SSID == "" {
+		return fmt.Errorf("%w: ssid is required", ErrInvalidProvisioningProfile)
+	}
+	if profile.EnableAuth && (profile.AuthUser == "" || profile.AuthPassword == "") {
+		return fmt.Errorf("%w: enable_auth needs auth_user and auth_password", ErrInvalidProvisioningProfile)
+	}
+	if profile.EnableMQTT && profile.MQTTServer == "" {
+		return fmt.Errorf("%w: enable_mqtt needs mqtt_server", ErrInvalidProvisioningProfile)
+	}
+	if profile.Timezone != "" {
+		if _, err := time.LoadLocation(profile.Timezone); err != nil {
+			return fmt.Errorf("%w: unknown timezone %s", ErrInvalidProvisioningProfile, profile.Timezone)
+		}
+	}
+
+	if err := s.DB.GetDB().Save(profile).Error; err != nil {
+		return fmt.Errorf("failed to save provisioning profile: %w", err)
+	}
+	return nil
+}
+
+// DeleteProvisioningProfile removes the profile with the given name
+func (s *ShellyService) DeleteProvisioningProfile(name string) error {
+	res := s.DB.GetDB().Where("name = ?", name).Delete(&database.ProvisioningProfile{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete provisioning profile: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrProvisioningProfileNotFound, name)
+	}
+	return nil
+}
+
+// ProvisioningProfileConfig returns a profile as provisioning task
+// configuration, credentials included, keyed like the provisioner's request
+// ("ssid", "password", "mqtt_server", ...)
+func (s *ShellyService) ProvisioningProfileConfig(name string) (map[string]interface{}, error) {
+	profile, err := s.GetProvisioningProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{
+		"ssid":         profile.SSID,
+		"enable_auth":  profile.EnableAuth,
+		"enable_cloud": profile.EnableCloud,
+		"enable_mqtt":  profile.EnableMQTT,
+	}
+	for key, value := range map[string]string{
+		"password":      profile.WiFiPassword,
+		"auth_user":     profile.AuthUser,
+		"auth_password": profile.AuthPassword,
+		"mqtt_server":   profile.MQTTServer,
+		"ntp_server":    profile.NTPServer,
+		"timezone":      profile.Timezone,
+	} {
+		if value != "" {
+			config[key] = value
+		}
+	}
+	return config, nil
+}
+
+// ApplyProvisioningProfile fills a task configuration with the values of a
+// profile. Values already set in config take precedence.
+func (s *ShellyService) ApplyProvisioningProfile(name string, config map[string]interface{}) (map[string]interface{}, error) {
+	merged, err := s.ProvisioningProfileConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range config {
+		merged[key] = value
+	}
+	merged["profile"] = name
+	return merged, nil
+}
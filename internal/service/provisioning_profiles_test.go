@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_ProvisioningProfiles(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	profile := &database.ProvisioningProfile{
+		Name: "site-a", SSID: "IoT", WiFiPassword: "wifi-secret",
+		EnableAuth: true, AuthUser: "admin", AuthPassword: "device-secret",
+		EnableMQTT: true, MQTTServer: "10.0.0.5:1883", NTPServer: "pool.ntp.org", Timezone: "Europe/Brussels",
+	}
+	if err := service.SaveProvisioningProfile(profile); err != nil {
+		t.Fatalf("SaveProvisioningProfile failed: %v", err)
+	}
+
+	for _, bad := range []*database.ProvisioningProfile{
+		{Name: "site b", SSID: "IoT"},
+		{Name: "site-b"},
+		{Name: "site-b", SSID: "IoT", EnableAuth: true, AuthUser: "admin"},
+		{Name: "site-b", SSID: "IoT", EnableMQTT: true},
+		{Name: "site-b", SSID: "IoT", Timezone: "Mars/Olympus"},
+	} {
+		if err := service.SaveProvisioningProfile(bad); !errors.Is(err, ErrInvalidProvisioningProfile) {
+			t.Errorf("Expected %+v to be rejected, got %v", bad, err)
+		}
+	}
+
+	// Saving again without passwords keeps the stored ones
+	update := &database.ProvisioningProfile{Name: "site-a", SSID: "IoT-2", EnableAuth: true, AuthUser: "admin"}
+	if err := service.SaveProvisioningProfile(update); err != nil {
+		t.Fatalf("SaveProvisioningProfile update failed: %v", err)
+	}
+	if update.ID != profile.ID {
+		t.Errorf("Expected the profile to be replaced, got ID %d for %d", update.ID, profile.ID)
+	}
+
+	config, err := service.ProvisioningProfileConfig("site-a")
+	if err != nil {
+		t.Fatalf("ProvisioningProfileConfig failed: %v", err)
+	}
+	if config["ssid"] != "IoT-2" || config["password"] != "wifi-secret" || config["auth_password"] != "device-secret" {
+		t.Errorf("Unexpected profile config: %v", config)
+	}
+	if _, ok := config["mqtt_server"]; ok || config["enable_mqtt"] != false {
+		t.Errorf("Expected the replaced profile to drop MQTT, got %v", config)
+	}
+
+	merged, err := service.ApplyProvisioningProfile("site-a", map[string]interface{}{"ssid": "Lab", "device_name": "porch"})
+	if err != nil {
+		t.Fatalf("ApplyProvisioningProfile failed: %v", err)
+	}
+	if merged["ssid"] != "Lab" || merged["device_name"] != "porch" || merged["password"] != "wifi-secret" || merged["profile"] != "site-a" {
+		t.Errorf("Expected task values to take precedence over the profile, got %v", merged)
+	}
+
+	profiles, err := service.ListProvisioningProfiles()
+	if err != nil || len(profiles) != 1 {
+		t.Fatalf("Expected one profile, got %v, %v", profiles, err)
+	}
+
+	if err := service.DeleteProvisioningProfile("site-a"); err != nil {
+		t.Fatalf("DeleteProvisioningProfile failed: %v", err)
+	}
+	if _, err := service.ApplyProvisioningProfile("site-a", nil); !errors.Is(err, ErrProvisioningProfileNotFound) {
+		t.Errorf("Expected a deleted profile to be unknown, got %v", err)
+	}
+	if err := service.DeleteProvisioningProfile("site-a"); !errors.Is(err, ErrProvisioningProfileNotFound) {
+		t.Errorf("Expected deleting twice to fail, got %v", err)
+	}
+}
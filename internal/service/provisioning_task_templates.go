@@ -0,0 +1,245 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+var (
+	// ErrProvisioningTaskTemplateNotFound is returned for unknown task
+	// template names
+	ErrProvisioningTaskTemplateNotFound = errors.New("provisioning task template not found")
+	// ErrInvalidProvisioningTaskTemplate wraps task template validation
+	// failures, and templates that cannot be expanded for a task
+	ErrInvalidProvisioningTaskTemplate = errors.New("invalid provisioning task template")
+)
+
+// Auth policies of a provisioning task template
+const (
+	TaskAuthPolicyProfile  = "profile"  // keep the profile's auth settings
+	TaskAuthPolicyRequired = "required" // enable auth; the credentials must be known
+	TaskAuthPolicyDisabled = "disabled" // provision without auth
+)
+
+// taskVariablePattern matches {{variable}} placeholders, as in naming
+// templates
+var taskVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+// ListProvisioningTaskTemplates returns the stored task templates by name
+func (s *ShellyService) ListProvisioningTaskTemplates() ([]database.ProvisioningTaskTemplate, error) {
+	templates := []database.ProvisioningTaskTemplate{}
+	if err := s.DB.GetDB().Order("name").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to load provisioning task templates: %w", err)
+	}
+	return templates, nil
+}
+
+// GetProvisioningTaskTemplate returns the task template with the given name
+func (s *ShellyService) GetProvisioningTaskTemplate(name string) (*database.ProvisioningTaskTemplate, error) {
+	var template database.ProvisioningTaskTemplate
+	if err := s.DB.GetDB().Where("name = ?", name).First(&template).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrProvisioningTaskTemplateNotFound, name)
+		}
+		return nil, fmt.Errorf("failed to load provisioning task template: %w", err)
+	}
+	return &template, nil
+}
+
+// SaveProvisioningTaskTemplate validates a task template and creates it or
+// replaces the one with the same name
+func (s *ShellyService) SaveProvisioningTaskTemplate(template *database.ProvisioningTaskTemplate) error {
+	template.Name = strings.TrimSpace(template.Name)
+	if !profileNamePattern.MatchString(template.Name) {
+		return fmt.Errorf("%w: name must be letters, digits, '.', '_' or '-'", ErrInvalidProvisioningTaskTemplate)
+	}
+	switch template.AuthPolicy {
+	case "", TaskAuthPolicyProfile, TaskAuthPolicyRequired, TaskAuthPolicyDisabled:
+	default:
+		return fmt.Errorf("%w: unknown auth_policy %q (expected profile, required or disabled)", ErrInvalidProvisioningTaskTemplate, template.AuthPolicy)
+	}
+	if template.Profile != "" {
+		if _, err := s.GetProvisioningProfile(template.Profile); err != nil {
+			if errors.Is(err, ErrProvisioningProfileNotFound) {
+				return fmt.Errorf("%w: %v", ErrInvalidProvisioningTaskTemplate, err)
+			}
+			return err
+		}
+	}
+	if template.PostProvisionTemplateID != nil {
+		if _, err := s.ConfigSvc.GetTemplate(*template.PostProvisionTemplateID); err != nil {
+			return fmt.Errorf("%w: configuration template %d not found", ErrInvalidProvisioningTaskTemplate, *template.PostProvisionTemplateID)
+		}
+	}
+	if _, err := taskTemplateVariables(template); err != nil {
+		return err
+	}
+	if _, err := taskTemplateConfig(template); err != nil {
+		return err
+	}
+	for _, text := range []string{template.TargetSSID, template.NamingRule} {
+		if strings.Contains(taskVariablePattern.ReplaceAllString(text, ""), "{{") {
+			return fmt.Errorf("%w: malformed placeholder in %q", ErrInvalidProvisioningTaskTemplate, text)
+		}
+	}
+
+	existing, err := s.GetProvisioningTaskTemplate(template.Name)
+	if err != nil && !errors.Is(err, ErrProvisioningTaskTemplateNotFound) {
+		return err
+	}
+	if existing != nil {
+		template.ID = existing.ID
+		template.CreatedAt = existing.CreatedAt
+	} else {
+		template.ID = 0
+		template.CreatedAt = time.Time{}
+	}
+	if err := s.DB.GetDB().Save(template).Error; err != nil {
+		return fmt.Errorf("failed to save provisioning task template: %w", err)
+	}
+	return nil
+}
+
+// DeleteProvisioningTaskTemplate removes the task template with the given
+// name
+func (s *ShellyService) DeleteProvisioningTaskTemplate(name string) error {
+	res := s.DB.GetDB().Where("name = ?", name).Delete(&database.ProvisioningTaskTemplate{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete provisioning task template: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrProvisioningTaskTemplateNotFound, name)
+	}
+	return nil
+}
+
+// ApplyProvisioningTaskTemplate expands a task template for the device with
+// the given MAC into a target SSID and task configuration. Variables
+// override the template's defaults; "mac" and "mac_suffix" are filled from
+// the device. Values set on the task (targetSSID, config) take precedence
+// over the template, which takes precedence over its profile.
+func (s *ShellyService) ApplyProvisioningTaskTemplate(name string, vars map[string]string, mac, targetSSID string, taskConfig map[string]interface{}) (string, map[string]interface{}, error) {
+	template, err := s.GetProvisioningTaskTemplate(name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	values, err := taskTemplateVariables(template)
+	if err != nil {
+		return "", nil, err
+	}
+	if normalized := config.NormalizeMAC(mac); normalized != "" {
+		values["mac"] = normalized
+		values["mac_suffix"] = normalized
+		if len(normalized) > 6 {
+			values["mac_suffix"] = normalized[len(normalized)-6:]
+		}
+	}
+	for key, value := range vars {
+		values[key] = value
+	}
+	expand := func(text string) (string, error) {
+		var missing string
+		out := taskVariablePattern.ReplaceAllStringFunc(text, func(m string) string {
+			key := taskVariablePattern.FindStringSubmatch(m)[1]
+			value, ok := values[key]
+			if !ok && missing == "" {
+				missing = key
+			}
+			return value
+		})
+		if missing != "" {
+			return "", fmt.Errorf("%w: variable %q is not set", ErrInvalidProvisioningTaskTemplate, missing)
+		}
+		return out, nil
+	}
+
+	templateConfig, err := taskTemplateConfig(template)
+	if err != nil {
+		return "", nil, err
+	}
+	merged := map[string]interface{}{}
+	if template.Profile != "" {
+		if merged, err = s.ApplyProvisioningProfile(template.Profile, nil); err != nil {
+			return "", nil, err
+		}
+	}
+	for key, value := range templateConfig {
+		if text, ok := value.(string); ok {
+			if value, err = expand(text); err != nil {
+				return "", nil, err
+			}
+		}
+		merged[key] = value
+	}
+	if template.NamingRule != "" {
+		deviceName, err := expand(template.NamingRule)
+		if err != nil {
+			return "", nil, err
+		}
+		merged["device_name"] = deviceName
+	}
+	if template.PostProvisionTemplateID != nil {
+		merged["post_provision_template_id"] = *template.PostProvisionTemplateID
+	}
+	for key, value := range taskConfig {
+		merged[key] = value
+	}
+
+	switch template.AuthPolicy {
+	case TaskAuthPolicyRequired:
+		merged["enable_auth"] = true
+		if merged["auth_user"] == nil || merged["auth_password"] == nil {
+			return "", nil, fmt.Errorf("%w: auth is required but the task has no auth_user and auth_password", ErrInvalidProvisioningTaskTemplate)
+		}
+	case TaskAuthPolicyDisabled:
+		merged["enable_auth"] = false
+		delete(merged, "auth_user")
+		delete(merged, "auth_password")
+	}
+
+	if targetSSID == "" && template.TargetSSID != "" {
+		if targetSSID, err = expand(template.TargetSSID); err != nil {
+			return "", nil, err
+		}
+	}
+	if ssid, ok := merged["ssid"].(string); ok {
+		if targetSSID == "" {
+			targetSSID = ssid
+		}
+		delete(merged, "ssid")
+	}
+	merged["task_template"] = name
+	return targetSSID, merged, nil
+}
+
+// taskTemplateVariables decodes the default variables of a task template
+func taskTemplateVariables(template *database.ProvisioningTaskTemplate) (map[string]string, error) {
+	values := map[string]string{}
+	if len(template.Variables) > 0 && string(template.Variables) != "null" {
+		if err := json.Unmarshal(template.Variables, &values); err != nil {
+			return nil, fmt.Errorf("%w: variables must map names to strings", ErrInvalidProvisioningTaskTemplate)
+		}
+	}
+	return values, nil
+}
+
+// taskTemplateConfig decodes the further task configuration of a template
+func taskTemplateConfig(template *database.ProvisioningTaskTemplate) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if len(template.Config) > 0 && string(template.Config) != "null" {
+		if err := json.Unmarshal(template.Config, &values); err != nil {
+			return nil, fmt.Errorf("%w: config must be an object", ErrInvalidProvisioningTaskTemplate)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_ProvisioningTaskTemplates(t *testing.T) {
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	profile := &database.ProvisioningProfile{
+		Name: "site-a", SSID: "IoT", WiFiPassword: "wifi-secret",
+		EnableAuth: true, AuthUser: "admin", AuthPassword: "device-secret",
+	}
+	if err := service.SaveProvisioningProfile(profile); err != nil {
+		t.Fatalf("SaveProvisioningProfile failed: %v", err)
+	}
+
+	missingTemplate := uint(999)
+	for _, bad := range []*database.ProvisioningTaskTemplate{
+		{Name: "plugs a"},
+		{Name: "plugs", AuthPolicy: "sometimes"},
+		{Name: "plugs", Profile: "site-z"},
+		{Name: "plugs", PostProvisionTemplateID: &missingTemplate},
+		{Name: "plugs", NamingRule: "{{site}-plug"},
+		{Name: "plugs", Variables: json.RawMessage(`{"floor": 2}`)},
+	} {
+		if err := service.SaveProvisioningTaskTemplate(bad); !errors.Is(err, ErrInvalidProvisioningTaskTemplate) {
+			t.Errorf("Expected %+v to be rejected, got %v", bad, err)
+		}
+	}
+
+	template := &database.ProvisioningTaskTemplate{
+		Name:       "plugs",
+		Profile:    "site-a",
+		TargetSSID: "{{site}}-iot",
+		AuthPolicy: TaskAuthPolicyRequired,
+		NamingRule: "{{site}}-{{room}}-plug-{{mac_suffix}}",
+		Variables:  json.RawMessage(`{"site": "hq"}`),
+		Config:     json.RawMessage(`{"mqtt_topic": "shellies/{{site}}/{{mac}}"}`),
+	}
+	if err := service.SaveProvisioningTaskTemplate(template); err != nil {
+		t.Fatalf("SaveProvisioningTaskTemplate failed: %v", err)
+	}
+
+	ssid, config, err := service.ApplyProvisioningTaskTemplate("plugs", map[string]string{"room": "kitchen"}, "aa:bb:cc:dd:ee:ff", "", nil)
+	if err != nil {
+		t.Fatalf("ApplyProvisioningTaskTemplate failed: %v", err)
+	}
+	if ssid != "hq-iot" {
+		t.Errorf("Expected the target SSID expanded, got %q", ssid)
+	}
+	if config["device_name"] != "hq-kitchen-plug-DDEEFF" || config["mqtt_topic"] != "shellies/hq/AABBCCDDEEFF" {
+		t.Errorf("Expected the naming rule and config expanded, got %v", config)
+	}
+	if config["password"] != "wifi-secret" || config["auth_password"] != "device-secret" || config["enable_auth"] != true {
+		t.Errorf("Expected the profile's credentials in the task, got %v", config)
+	}
+
+	// Values set on the task win; unset variables are refused
+	ssid, config, err = service.ApplyProvisioningTaskTemplate("plugs", map[string]string{"site": "lab", "room": "bench"}, "aabbccddeeff", "Other", map[string]interface{}{"device_name": "Bench plug"})
+	if err != nil || ssid != "Other" || config["device_name"] != "Bench plug" || config["mqtt_topic"] != "shellies/lab/AABBCCDDEEFF" {
+		t.Errorf("Expected task values to take precedence, got %q %v (%v)", ssid, config, err)
+	}
+	if _, _, err := service.ApplyProvisioningTaskTemplate("plugs", nil, "aabbccddeeff", "", nil); !errors.Is(err, ErrInvalidProvisioningTaskTemplate) {
+		t.Errorf("Expected an unset variable refused, got %v", err)
+	}
+
+	template.AuthPolicy = TaskAuthPolicyDisabled
+	if err := service.SaveProvisioningTaskTemplate(template); err != nil {
+		t.Fatalf("SaveProvisioningTaskTemplate update failed: %v", err)
+	}
+	_, config, err = service.ApplyProvisioningTaskTemplate("plugs", map[string]string{"room": "hall"}, "aabbccddeeff", "", nil)
+	if err != nil || config["enable_auth"] != false || config["auth_password"] != nil {
+		t.Errorf("Expected auth left out, got %v (%v)", config, err)
+	}
+
+	if templates, err := service.ListProvisioningTaskTemplates(); err != nil || len(templates) != 1 {
+		t.Errorf("Expected one template, got %d (%v)", len(templates), err)
+	}
+	if err := service.DeleteProvisioningTaskTemplate("plugs"); err != nil {
+		t.Fatalf("DeleteProvisioningTaskTemplate failed: %v", err)
+	}
+	if _, _, err := service.ApplyProvisioningTaskTemplate("plugs", nil, "", "", nil); !errors.Is(err, ErrProvisioningTaskTemplateNotFound) {
+		t.Errorf("Expected a deleted template reported, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/discovery"
+	"github.com/ginsys/shelly-manager/internal/naming"
+)
+
+// NewDeviceSourceProvisioning marks devices adopted by provisioning
+// verification
+const NewDeviceSourceProvisioning = "provisioning"
+
+// Provisioning verification results
+const (
+	ProvisioningVerified          = "verified"           // found by MAC, answered the probes and adopted
+	ProvisioningJoinedUnreachable = "joined_unreachable" // seen on the network but never answered the probes
+	ProvisioningNotJoined         = "not_joined"         // never seen on the target network
+	ProvisioningVetoed            = "vetoed"             // answered, but a hook vetoed its adoption
+)
+
+// Where a provisioned device was found
+const (
+	provisionedSeenInventory = "inventory"
+	provisionedSeenLease     = "dhcp_lease"
+	provisionedSeenMDNS      = "mdns"
+)
+
+// ProvisioningVerification is the outcome of checking a provisioned device
+// on its target network
+type ProvisioningVerification struct {
+	MAC        string    `json:"mac"`
+	Result     string    `json:"result"`
+	DeviceID   uint      `json:"device_id,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	SeenBy     string    `json:"seen_by,omitempty"` // inventory, dhcp_lease or mdns
+	SSID       string    `json:"ssid,omitempty"`    // station SSID the device reported
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error,omitempty"` // last failure
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// provisionedAddress is an address a provisioned device may answer at
+type provisionedAddress struct {
+	ip     string
+	seenBy string
+}
+
+// ProvisioningVerificationEnabled reports whether provisioned devices are
+// verified before their provisioning tasks complete
+func (s *ShellyService) ProvisioningVerificationEnabled() bool {
+	return s.Config != nil && s.Config.Provisioning.Verification.Enabled
+}
+
+// StartProvisioningVerification verifies a provisioned device in the
+// background and passes the outcome to done
+func (s *ShellyService) StartProvisioningVerification(ctx context.Context, mac, ssid string, done func(*ProvisioningVerification)) {
+	ctx = s.jobContext(ctx)
+	go func() {
+		done(s.VerifyProvisionedDevice(ctx, mac, ssid))
+	}()
+}
+
+// VerifyProvisionedDevice waits for a provisioned device on its target
+// network. Each attempt looks its MAC up in the inventory, the DHCP leases
+// and mDNS, confirms the MAC of the device answering there, adopts it and
+// reads its status and config. A device reporting its station SSID must be
+// on ssid. A device that was seen, by its lease, mDNS or by answering, but
+// never passed the probes ends as joined but unreachable.
+func (s *ShellyService) VerifyProvisionedDevice(ctx context.Context, mac, ssid string) *ProvisioningVerification {
+	var cfg config.ProvisioningVerificationConfig
+	if s.Config != nil {
+		cfg = s.Config.Provisioning.Verification
+	}
+	v := &ProvisioningVerification{MAC: normalizeMAC(mac), StartedAt: s.clock.Now()}
+	deadline := time.Now().Add(cfg.TimeoutDuration())
+	joined := false
+	for {
+		v.Attempts++
+		done, seen := s.verifyProvisionedOnce(ctx, v, ssid)
+		joined = joined || seen
+		if done {
+			break
+		}
+		if time.Now().Add(cfg.IntervalDuration()).After(deadline) {
+			v.Result = ProvisioningNotJoined
+			if joined {
+				v.Result = ProvisioningJoinedUnreachable
+			}
+			break
+		}
+		select {
+		case <-ctx.Done():
+			v.Result, v.Error = ProvisioningNotJoined, ctx.Err().Error()
+			if joined {
+				v.Result = ProvisioningJoinedUnreachable
+			}
+		case <-time.After(cfg.IntervalDuration()):
+			continue
+		}
+		break
+	}
+	v.FinishedAt = s.clock.Now()
+
+	s.logger.WithFields(map[string]any{
+		"mac":       v.MAC,
+		"result":    v.Result,
+		"device_id": v.DeviceID,
+		"ip":        v.IP,
+		"seen_by":   v.SeenBy,
+		"attempts":  v.Attempts,
+		"error":     v.Error,
+		"component": "provisioning",
+	}).Info("Provisioned device verification finished")
+	return v
+}
+
+// verifyProvisionedOnce tries every address the device may have. It reports
+// whether verification is over, and whether the device was seen on the
+// network.
+func (s *ShellyService) verifyProvisionedOnce(ctx context.Context, v *ProvisioningVerification, ssid string) (bool, bool) {
+	seen := false
+	for _, addr := range s.provisionedAddresses(ctx, v.MAC) {
+		if addr.seenBy != provisionedSeenInventory {
+			// A lease or an mDNS announcement shows the device joined
+			seen = true
+			v.IP, v.SeenBy = addr.ip, addr.seenBy
+		}
+		found, err := s.identifyProvisioned(ctx, addr.ip)
+		if err != nil {
+			v.Error = err.Error()
+			continue
+		}
+		if normalizeMAC(found.MAC) != v.MAC {
+			v.Error = fmt.Sprintf("%s answers with MAC %s", addr.ip, found.MAC)
+			continue
+		}
+		seen = true
+		v.IP, v.SeenBy = addr.ip, addr.seenBy
+
+		device, err := s.adoptDiscovered(ctx, *found, &naming.NameSet{}, false, NewDeviceSourceProvisioning)
+		if err != nil {
+			v.Error = fmt.Sprintf("failed to adopt device: %v", err)
+			return false, true
+		}
+		if device == nil {
+			v.Result, v.Error = ProvisioningVetoed, "adoption was vetoed by a hook"
+			return true, true
+		}
+		v.DeviceID = device.ID
+		reported, err := s.probeProvisioned(ctx, device)
+		if err != nil {
+			v.Error = err.Error()
+			return false, true
+		}
+		v.SSID = reported
+		if ssid != "" && reported != "" && reported != ssid {
+			// Reachable, but not on the network it was provisioned for
+			v.Error = fmt.Sprintf("device is connected to %s instead of %s", reported, ssid)
+			return false, false
+		}
+		v.Result, v.Error = ProvisioningVerified, ""
+		return true, true
+	}
+	if v.Error == "" {
+		v.Error = "device not found on the network"
+	}
+	return false, seen
+}
+
+// provisionedAddresses returns the addresses a device may answer at: its
+// inventory address, its DHCP lease and its mDNS announcement
+func (s *ShellyService) provisionedAddresses(ctx context.Context, mac string) []provisionedAddress {
+	var addrs []provisionedAddress
+	add := func(ip, seenBy string) {
+		for _, a := range addrs {
+			if a.ip == ip {
+				return
+			}
+		}
+		if ip != "" {
+			addrs = append(addrs, provisionedAddress{ip: ip, seenBy: seenBy})
+		}
+	}
+
+	// Fresh sightings first: the inventory address may be an old one
+	if report, err := s.DHCPLeaseCandidates(ctx); err == nil {
+		for _, c := range report.Candidates {
+			if normalizeMAC(c.MAC) == mac {
+				add(c.IP, provisionedSeenLease)
+			}
+		}
+	} else if !errors.Is(err, ErrNoDHCPRouters) {
+		s.logger.WithFields(map[string]any{
+			"mac":       mac,
+			"error":     err.Error(),
+			"component": "provisioning",
+		}).Debug("Failed to read DHCP leases for verification")
+	}
+	if s.Config != nil && s.Config.Discovery.EnableMDNS {
+		if opts, err := s.discoveryOptions(); err == nil {
+			devices, _ := discovery.NewMDNSScanner(s.discoveryTimeout(), opts...).DiscoverDevices(ctx)
+			for _, d := range devices {
+				if normalizeMAC(d.MAC) == mac {
+					add(d.IP, provisionedSeenMDNS)
+				}
+			}
+		}
+	}
+	if inventory, err := s.inventoryByMAC(); err == nil {
+		if device, ok := inventory[mac]; ok {
+			add(device.IP, provisionedSeenInventory)
+		}
+	}
+	return addrs
+}
+
+// identifyProvisioned asks the device at ip who it is, honouring the
+// discovery exclusions
+func (s *ShellyService) identifyProvisioned(ctx context.Context, ip string) (*discoveredDevice, error) {
+	opts, err := s.discoveryOptions()
+	if err != nil {
+		return nil, err
+	}
+	network := networkContaining(s.discoveryTargets(""), ip)
+	if network != nil {
+		exclusions, err := s.networkExclusions(*network)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, discovery.WithExclusions(exclusions))
+	}
+	sd, err := discovery.NewScannerWithLogger(s.discoveryTimeout(), 1, s.logger, opts...).ScanHost(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	if sd == nil || sd.MAC == "" {
+		return nil, fmt.Errorf("no Shelly device answers at %s", ip)
+	}
+	return &discoveredDevice{ShellyDevice: *sd, network: network}, nil
+}
+
+// probeProvisioned reads the status and config of an adopted device and
+// returns the station SSID it reports
+func (s *ShellyService) probeProvisioned(ctx context.Context, device *database.Device) (string, error) {
+	client, err := s.getClient(device)
+	if err != nil {
+		return "", fmt.Errorf("failed to create client: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	status, err := client.GetStatus(ctx)
+	if err != nil {
+		return "", fmt.Errorf("status probe failed: %w", err)
+	}
+	if _, err := client.GetConfig(ctx); err != nil {
+		return "", fmt.Errorf("config probe failed: %w", err)
+	}
+	if status.WiFiStatus == nil {
+		return "", nil
+	}
+	return status.WiFiStatus.SSID, nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+)
+
+func TestShellyService_VerifyProvisionedDevice(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/shelly":
+			_, _ = w.Write([]byte(`{"type":"SHSW-1","mac":"E8DB84000071","auth":false,"fw":"v1.14.0"}`))
+		case "/status":
+			_, _ = w.Write([]byte(`{"wifi_sta":{"connected":true,"ssid":"Home","ip":"10.0.0.71"}}`))
+		case "/settings":
+			_, _ = w.Write([]byte(`{"name":"porch"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer device.Close()
+	silent := httptest.NewServer(http.NotFoundHandler())
+	defer silent.Close()
+	deviceHost := strings.TrimPrefix(device.URL, "http://")
+
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `[
+			{"address":%q,"mac-address":"E8:DB:84:00:00:71","status":"bound","dynamic":"true"},
+			{"address":%q,"mac-address":"E8:DB:84:00:00:72","status":"bound","dynamic":"true"}]`,
+			deviceHost, strings.TrimPrefix(silent.URL, "http://"))
+	}))
+	defer router.Close()
+
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	cfg.Discovery.EnableMDNS = false
+	cfg.Discovery.DHCPLeases.Routers = []config.DHCPLeaseRouter{{Name: "mt", Type: config.DHCPRouterMikroTik, URL: router.URL}}
+	cfg.Provisioning.Verification = config.ProvisioningVerificationConfig{Enabled: true, Timeout: 1, Interval: 1}
+	service := NewService(db, cfg)
+	defer service.Stop()
+	ctx := context.Background()
+
+	v := service.VerifyProvisionedDevice(ctx, "E8:DB:84:00:00:71", "Home")
+	if v.Result != ProvisioningVerified || v.SeenBy != "dhcp_lease" || v.SSID != "Home" || v.DeviceID == 0 {
+		t.Fatalf("Expected the device verified, got %+v", v)
+	}
+	adopted, err := db.GetDevice(v.DeviceID)
+	if err != nil || adopted.IP != deviceHost {
+		t.Errorf("Expected the device adopted at its lease address, got %+v (%v)", adopted, err)
+	}
+
+	// Reachable, but on another network than the one provisioned
+	v = service.VerifyProvisionedDevice(ctx, "E8DB84000071", "Garage")
+	if v.Result != ProvisioningNotJoined || !strings.Contains(v.Error, "instead of Garage") {
+		t.Errorf("Expected the wrong network reported, got %+v", v)
+	}
+
+	// A lease but no answer: joined, yet unreachable
+	v = service.VerifyProvisionedDevice(ctx, "E8DB84000072", "Home")
+	if v.Result != ProvisioningJoinedUnreachable || v.DeviceID != 0 {
+		t.Errorf("Expected the device joined but unreachable, got %+v", v)
+	}
+
+	v = service.VerifyProvisionedDevice(ctx, "E8DB84000073", "Home")
+	if v.Result != ProvisioningNotJoined || v.Attempts != 1 {
+		t.Errorf("Expected the device not joined, got %+v", v)
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// rangeExtenderWorkers bounds the devices read at once for the topology
+const rangeExtenderWorkers = 10
+
+// ErrRangeExtenderUnsupported is returned for devices that cannot run as a
+// range extender
+var ErrRangeExtenderUnsupported = errors.New("range extender mode requires a Gen2 or later device")
+
+// apClientLister is implemented by device clients that can list the stations
+// connected to their access point
+type apClientLister interface {
+	ListAPClients(ctx context.Context) ([]shelly.APClient, error)
+}
+
+// ExtenderClient is a station connected through a range extender. Stations
+// that are inventory devices carry their ID and name.
+type ExtenderClient struct {
+	MAC        string     `json:"mac"`
+	IP         string     `json:"ip"`
+	StaticIP   bool       `json:"static_ip"`
+	Port       int        `json:"port,omitempty"` // port on the extender forwarded to the client
+	Since      *time.Time `json:"since,omitempty"`
+	DeviceID   uint       `json:"device_id,omitempty"`
+	DeviceName string     `json:"device_name,omitempty"`
+}
+
+// RangeExtenderStatus is the access point and range extender state of a device
+type RangeExtenderStatus struct {
+	DeviceID   uint             `json:"device_id"`
+	DeviceName string           `json:"device_name"`
+	APEnabled  bool             `json:"ap_enabled"`
+	SSID       string           `json:"ssid,omitempty"`
+	Enabled    bool             `json:"enabled"` // range extender mode
+	Clients    []ExtenderClient `json:"clients"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// ExtenderLink is an inventory device reaching the network through another
+type ExtenderLink struct {
+	ExtenderID   uint   `json:"extender_id"`
+	ExtenderName string `json:"extender_name"`
+	DeviceID     uint   `json:"device_id"`
+	DeviceName   string `json:"device_name"`
+}
+
+// ExtenderTopology shows which devices are bridged through which extender
+type ExtenderTopology struct {
+	CheckedAt time.Time             `json:"checked_at"`
+	Extenders []RangeExtenderStatus `json:"extenders"`
+	Links     []ExtenderLink        `json:"links"`
+	Errors    []RangeExtenderStatus `json:"errors,omitempty"` // devices that could not be read
+}
+
+// DeviceRangeExtender reads whether a device runs as a range extender and
+// the stations connected to its access point. Connected stations that are
+// inventory devices are identified by MAC address.
+func (s *ShellyService) DeviceRangeExtender(ctx context.Context, deviceID uint) (*RangeExtenderStatus, error) {
+	device, err := s.DB.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	inventory, err := s.inventoryByMAC()
+	if err != nil {
+		return nil, err
+	}
+	return s.readRangeExtender(ctx, device, inventory)
+}
+
+// RangeExtenderTopology reads every online Gen2+ device and lists the range
+// extenders with their clients and the inventory devices bridged through
+// each of them
+func (s *ShellyService) RangeExtenderTopology(ctx context.Context) (*ExtenderTopology, error) {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	inventory := make(map[string]*database.Device, len(devices))
+	targets := []database.Device{}
+	for i := range devices {
+		inventory[normalizeMAC(devices[i].MAC)] = &devices[i]
+		if devices[i].Status == "online" && deviceGenerationOf(&devices[i]) >= 2 {
+			targets = append(targets, devices[i])
+		}
+	}
+
+	statuses := make([]*RangeExtenderStatus, len(targets))
+	fanOut(rangeExtenderWorkers, len(targets), func(i int) {
+		status, err := s.readRangeExtender(ctx, &targets[i], inventory)
+		if err != nil {
+			status = &RangeExtenderStatus{DeviceID: targets[i].ID, DeviceName: targets[i].Name, Error: err.Error()}
+		}
+		statuses[i] = status
+	})
+
+	topology := &ExtenderTopology{CheckedAt: time.Now(), Extenders: []RangeExtenderStatus{}, Links: []ExtenderLink{}}
+	for _, status := range statuses {
+		switch {
+		case status.Error != "":
+			topology.Errors = append(topology.Errors, *status)
+		case status.Enabled:
+			topology.Extenders = append(topology.Extenders, *status)
+			for _, c := range status.Clients {
+				if c.DeviceID != 0 {
+					topology.Links = append(topology.Links, ExtenderLink{
+						ExtenderID:   status.DeviceID,
+						ExtenderName: status.DeviceName,
+						DeviceID:     c.DeviceID,
+						DeviceName:   c.DeviceName,
+					})
+				}
+			}
+		}
+	}
+	return topology, nil
+}
+
+// readRangeExtender reads a device's access point configuration and, in
+// range extender mode, its connected stations
+func (s *ShellyService) readRangeExtender(ctx context.Context, device *database.Device, inventory map[string]*database.Device) (*RangeExtenderStatus, error) {
+	client, err := s.getClient(device)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+	if client.GetGeneration() < 2 {
+		return nil, ErrRangeExtenderUnsupported
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+
+	cfg, err := client.GetConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+	var raw map[string]interface{}
+	_ = json.Unmarshal(cfg.Raw, &raw)
+
+	status := &RangeExtenderStatus{DeviceID: device.ID, DeviceName: device.Name, Clients: []ExtenderClient{}}
+	if ap := mapAt(raw, "wifi", "ap"); ap != nil {
+		status.APEnabled, _ = ap["enable"].(bool)
+		status.SSID, _ = ap["ssid"].(string)
+	}
+	if extender := mapAt(raw, "wifi", "ap", "range_extender"); extender != nil {
+		status.Enabled, _ = extender["enable"].(bool)
+	}
+	if !status.Enabled {
+		return status, nil
+	}
+
+	lister, ok := client.(apClientLister)
+	if !ok {
+		return status, nil
+	}
+	clients, err := lister.ListAPClients(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceNotResponding, err)
+	}
+	for _, c := range clients {
+		entry := ExtenderClient{MAC: c.MAC, IP: c.IP, StaticIP: c.IPStatic, Port: c.Port}
+		if c.Since > 0 {
+			since := time.Unix(c.Since, 0)
+			entry.Since = &since
+		}
+		if d, ok := inventory[normalizeMAC(c.MAC)]; ok && c.MAC != "" {
+			entry.DeviceID = d.ID
+			entry.DeviceName = d.Name
+		}
+		status.Clients = append(status.Clients, entry)
+	}
+	return status, nil
+}
+
+// inventoryByMAC returns the inventory devices keyed by normalized MAC
+func (s *ShellyService) inventoryByMAC() (map[string]*database.Device, error) {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	inventory := make(map[string]*database.Device, len(devices))
+	for i := range devices {
+		inventory[normalizeMAC(devices[i].MAC)] = &devices[i]
+	}
+	return inventory, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_RangeExtender(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		switch req.Method {
+		case "Shelly.GetDeviceInfo":
+			_, _ = w.Write([]byte(`{"id":1,"result":{"id":"shellyplus1-aabbccddee01","gen":2}}`))
+		case "Shelly.GetConfig":
+			_, _ = w.Write([]byte(`{"id":1,"result":{"wifi":{"ap":{"ssid":"ShellyPlus1-EE01","enable":true,"range_extender":{"enable":true}}}}}`))
+		case "WiFi.ListAPClients":
+			_, _ = w.Write([]byte(`{"id":1,"result":{"ts":1700000100,"ap_clients":[
+				{"mac":"aa:bb:cc:dd:ee:02","ip":"192.168.33.2","ip_static":false,"mport":8001,"since":1700000000},
+				{"mac":"11:22:33:44:55:66","ip":"192.168.33.3","ip_static":true,"mport":8002,"since":0}]}}`))
+		default:
+			_, _ = w.Write([]byte(`{"id":1,"result":{}}`))
+		}
+	}))
+	defer server.Close()
+
+	db := createTestDB(t)
+	service := NewService(db, createTestConfigBusiness())
+	defer service.Stop()
+
+	extender := &database.Device{IP: server.URL[len("http://"):], MAC: "AABBCCDDEE01", Type: "SNSW-001X16EU",
+		Name: "Shed Extender", Status: "online", Settings: `{"model":"SNSW-001X16EU","gen":2}`}
+	bridged := &database.Device{IP: "192.0.2.30", MAC: "AABBCCDDEE02", Type: "SNSW-001X16EU",
+		Name: "Shed Light", Status: "offline", Settings: `{"model":"SNSW-001X16EU","gen":2}`}
+	for _, d := range []*database.Device{extender, bridged} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	status, err := service.DeviceRangeExtender(ctx, extender.ID)
+	if err != nil {
+		t.Fatalf("DeviceRangeExtender failed: %v", err)
+	}
+	if !status.Enabled || !status.APEnabled || status.SSID != "ShellyPlus1-EE01" {
+		t.Errorf("Unexpected extender state: %+v", status)
+	}
+	if len(status.Clients) != 2 {
+		t.Fatalf("Expected 2 clients, got %+v", status.Clients)
+	}
+	if c := status.Clients[0]; c.DeviceID != bridged.ID || c.DeviceName != "Shed Light" || c.Port != 8001 || c.Since == nil {
+		t.Errorf("Expected the first client to be matched to the inventory device, got %+v", c)
+	}
+	if c := status.Clients[1]; c.DeviceID != 0 || !c.StaticIP || c.Since != nil {
+		t.Errorf("Expected an unknown static client, got %+v", c)
+	}
+
+	if _, err := service.DeviceRangeExtender(ctx, 999); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected unknown device to be refused, got %v", err)
+	}
+
+	topology, err := service.RangeExtenderTopology(ctx)
+	if err != nil {
+		t.Fatalf("RangeExtenderTopology failed: %v", err)
+	}
+	if len(topology.Extenders) != 1 || len(topology.Errors) != 0 {
+		t.Fatalf("Expected one extender and no errors, got %+v", topology)
+	}
+	if len(topology.Links) != 1 || topology.Links[0].ExtenderID != extender.ID || topology.Links[0].DeviceID != bridged.ID {
+		t.Errorf("Expected the bridged device to be linked to the extender, got %+v", topology.Links)
+	}
+}
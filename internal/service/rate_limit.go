@@ -0,0 +1,36 @@
+package service
+
+import (
+	"net"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// newDeviceRateLimiter builds the request budget shared by every device
+// client and discovery probe, or nil when none is configured
+func newDeviceRateLimiter(cfg *config.Config) *shelly.RateLimiter {
+	if cfg == nil || !cfg.DeviceClient.RateLimit.Enabled() {
+		return nil
+	}
+	limit := cfg.DeviceClient.RateLimit
+	networks := make([]shelly.NetworkRate, 0, len(limit.Networks))
+	for _, n := range limit.Networks {
+		_, network, err := net.ParseCIDR(n.CIDR)
+		if err != nil {
+			// Validated when the configuration is loaded
+			continue
+		}
+		networks = append(networks, shelly.NetworkRate{Network: network, RequestsPerSecond: n.RequestsPerSecond, Burst: n.Burst})
+	}
+	return shelly.NewRateLimiter(limit.RequestsPerSecond, limit.Burst, networks)
+}
+
+// SetRateLimitRecorder sets the callback told about every device request
+// passing the rate limit, e.g. to export it as a metric. It does nothing
+// when no rate limit is configured.
+func (s *ShellyService) SetRateLimitRecorder(fn shelly.RateLimitRecorder) {
+	if s.rateLimiter != nil {
+		s.rateLimiter.SetRecorder(fn)
+	}
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// Reboot tracking defaults
+const (
+	defaultRebootThreshold = 3 // unexpected reboots per rebootWindow
+	rebootWindow           = 24 * time.Hour
+	rebootWorkers          = 10
+
+	// rebootTolerance absorbs request latency and whole-second uptimes when
+	// comparing boot times estimated from different status reads
+	rebootTolerance = time.Minute
+
+	// expectedRebootWindow is how long after the manager reboots a device a
+	// detected reboot is attributed to it
+	expectedRebootWindow = 15 * time.Minute
+)
+
+// RebootStatus is a device's recent reboot activity
+type RebootStatus struct {
+	DeviceID   uint       `json:"device_id"`
+	Name       string     `json:"name,omitempty"`
+	Reboots    int        `json:"reboots_24h"` // unexpected reboots in the last 24 hours
+	Threshold  int        `json:"threshold"`
+	Flapping   bool       `json:"flapping"` // more reboots than the threshold
+	LastReboot *time.Time `json:"last_reboot,omitempty"`
+}
+
+// RebootReport lists devices that rebooted unexpectedly in the last 24
+// hours, most reboots first
+type RebootReport struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Threshold   int            `json:"threshold"`
+	Devices     []RebootStatus `json:"devices"`
+	Flapping    int            `json:"flapping"`
+}
+
+// RebootNotifier is told when a device starts flapping
+type RebootNotifier func(ctx context.Context, deviceID uint, deviceName string, reboots int)
+
+// SetRebootNotifier sets the callback told when a device exceeds the reboot
+// threshold
+func (s *ShellyService) SetRebootNotifier(fn RebootNotifier) {
+	s.rebootMu.Lock()
+	defer s.rebootMu.Unlock()
+	s.rebootNotifier = fn
+}
+
+// rebootThreshold returns the unexpected reboots per day above which a
+// device is flapping
+func (s *ShellyService) rebootThreshold() int {
+	if s.Config == nil || s.Config.Metrics.RebootThreshold <= 0 {
+		return defaultRebootThreshold
+	}
+	return s.Config.Metrics.RebootThreshold
+}
+
+// expectReboot notes that the manager is about to reboot a device, so the
+// reboot is not counted against it
+func (s *ShellyService) expectReboot(deviceID uint) {
+	s.rebootMu.Lock()
+	defer s.rebootMu.Unlock()
+	if s.expectedReboots == nil {
+		s.expectedReboots = make(map[uint]time.Time)
+	}
+	s.expectedReboots[deviceID] = s.clock.Now()
+}
+
+// recordUptime estimates when a device booted from the uptime in a status
+// read. A boot later than the one seen before is a reboot and is stored.
+// The first read of a device after the server starts only sets the baseline.
+func (s *ShellyService) recordUptime(deviceID uint, status *shelly.DeviceStatus) {
+	if status == nil || status.Uptime <= 0 {
+		return
+	}
+	now := s.clock.Now()
+	booted := now.Add(-time.Duration(status.Uptime) * time.Second)
+
+	s.rebootMu.Lock()
+	if s.bootTimes == nil {
+		s.bootTimes = make(map[uint]time.Time)
+	}
+	previous, seen := s.bootTimes[deviceID]
+	if seen && booted.Sub(previous).Abs() <= rebootTolerance {
+		s.rebootMu.Unlock()
+		return
+	}
+	s.bootTimes[deviceID] = booted
+	rebooted := seen && booted.After(previous)
+	expected := false
+	if at, ok := s.expectedReboots[deviceID]; ok && rebooted {
+		expected = now.Sub(at) <= expectedRebootWindow && !booted.Before(at.Add(-rebootTolerance))
+		delete(s.expectedReboots, deviceID)
+	}
+	notify := s.rebootNotifier
+	s.rebootMu.Unlock()
+
+	// Devices under maintenance are expected to lose power
+	if rebooted && !expected {
+		expected = s.InMaintenance(deviceID)
+	}
+	if rebooted {
+		s.saveReboot(database.DeviceReboot{
+			DeviceID:       deviceID,
+			BootedAt:       booted,
+			PreviousBootAt: previous,
+			DetectedAt:     now,
+			Expected:       expected,
+		}, notify)
+	}
+}
+
+// saveReboot stores a detected reboot and reports a device that starts
+// flapping
+func (s *ShellyService) saveReboot(reboot database.DeviceReboot, notify RebootNotifier) {
+	db := s.DB.GetDB()
+	if db == nil {
+		return
+	}
+	if err := db.Create(&reboot).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": reboot.DeviceID,
+			"error":     err.Error(),
+			"component": "reboots",
+		}).Warn("Failed to record device reboot")
+		return
+	}
+	if reboot.Expected {
+		s.logger.WithFields(map[string]any{
+			"device_id": reboot.DeviceID,
+			"component": "reboots",
+		}).Debug("Requested device reboot completed")
+		return
+	}
+
+	var count int64
+	if err := db.Model(&database.DeviceReboot{}).
+		Where("device_id = ? AND expected = ? AND detected_at >= ?", reboot.DeviceID, false, reboot.DetectedAt.Add(-rebootWindow)).
+		Count(&count).Error; err != nil {
+		return
+	}
+	threshold := s.rebootThreshold()
+	s.logger.WithFields(map[string]any{
+		"device_id":   reboot.DeviceID,
+		"booted_at":   reboot.BootedAt,
+		"reboots_24h": count,
+		"component":   "reboots",
+	}).Warn("Unexpected device reboot detected")
+
+	// Notify once, when the threshold is first exceeded
+	if int(count) == threshold+1 && notify != nil {
+		name := ""
+		if device, err := s.DB.GetDevice(reboot.DeviceID); err == nil {
+			name = device.Name
+		}
+		notify(s.ctx, reboot.DeviceID, name, int(count))
+	}
+}
+
+// CheckReboots reads the uptime of every device marked online. Reboots and
+// request latency are recorded as a side effect, as with every other status
+// read. During an outage devices are read one at a time.
+func (s *ShellyService) CheckReboots(ctx context.Context) error {
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return fmt.Errorf("failed to load devices: %w", err)
+	}
+	targets := []database.Device{}
+	for _, d := range devices {
+		if d.Status == "online" {
+			targets = append(targets, d)
+		}
+	}
+
+	fanOut(s.pollWorkers(rebootWorkers), len(targets), func(i int) {
+		if s.recoveryPause(ctx) {
+			s.readUptime(ctx, &targets[i])
+		}
+	})
+	return nil
+}
+
+// readUptime reads one device's status for reboot tracking
+func (s *ShellyService) readUptime(ctx context.Context, device *database.Device) {
+	client, err := s.getClient(device)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	status, err := s.readStatus(ctx, client, device)
+	if err != nil {
+		return
+	}
+	s.recordPower(device.ID, status)
+	s.recordUptime(device.ID, status)
+	s.recordProtection(device.ID, status)
+	s.recordEnergy(device.ID, status)
+}
+
+// DeviceRebootStatus returns a device's unexpected reboots in the last 24
+// hours and whether it is flapping
+func (s *ShellyService) DeviceRebootStatus(deviceID uint) (*RebootStatus, error) {
+	status := &RebootStatus{DeviceID: deviceID, Threshold: s.rebootThreshold()}
+	db := s.DB.GetDB()
+	if db == nil {
+		return status, nil
+	}
+	var reboots []database.DeviceReboot
+	if err := db.Where("device_id = ? AND expected = ? AND detected_at >= ?", deviceID, false, s.clock.Now().Add(-rebootWindow)).
+		Order("booted_at DESC").Find(&reboots).Error; err != nil {
+		return nil, fmt.Errorf("failed to load device reboots: %w", err)
+	}
+	status.Reboots = len(reboots)
+	status.Flapping = status.Reboots > status.Threshold
+	if len(reboots) > 0 {
+		status.LastReboot = &reboots[0].BootedAt
+	}
+	return status, nil
+}
+
+// DeviceReboots returns a device's reboot history, newest first. A limit of
+// zero returns all reboots.
+func (s *ShellyService) DeviceReboots(deviceID uint, limit int) ([]database.DeviceReboot, error) {
+	reboots := []database.DeviceReboot{}
+	db := s.DB.GetDB()
+	if db == nil {
+		return reboots, nil
+	}
+	query := db.Where("device_id = ?", deviceID).Order("booted_at DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&reboots).Error; err != nil {
+		return nil, fmt.Errorf("failed to load device reboots: %w", err)
+	}
+	return reboots, nil
+}
+
+// RebootReport lists the devices with unexpected reboots in the last 24
+// hours
+func (s *ShellyService) RebootReport() (*RebootReport, error) {
+	report := &RebootReport{GeneratedAt: s.clock.Now(), Threshold: s.rebootThreshold(), Devices: []RebootStatus{}}
+	db := s.DB.GetDB()
+	if db == nil {
+		return report, nil
+	}
+	var reboots []database.DeviceReboot
+	if err := db.Where("expected = ? AND detected_at >= ?", false, report.GeneratedAt.Add(-rebootWindow)).
+		Find(&reboots).Error; err != nil {
+		return nil, fmt.Errorf("failed to load device reboots: %w", err)
+	}
+
+	byDevice := map[uint]*RebootStatus{}
+	for i := range reboots {
+		r := &reboots[i]
+		status, ok := byDevice[r.DeviceID]
+		if !ok {
+			status = &RebootStatus{DeviceID: r.DeviceID, Threshold: report.Threshold}
+			byDevice[r.DeviceID] = status
+		}
+		status.Reboots++
+		if status.LastReboot == nil || r.BootedAt.After(*status.LastReboot) {
+			status.LastReboot = &r.BootedAt
+		}
+	}
+	for id, status := range byDevice {
+		if device, err := s.DB.GetDevice(id); err == nil {
+			status.Name = device.Name
+		}
+		status.Flapping = status.Reboots > report.Threshold
+		if status.Flapping {
+			report.Flapping++
+		}
+		report.Devices = append(report.Devices, *status)
+	}
+	sort.Slice(report.Devices, func(i, j int) bool {
+		a, b := report.Devices[i], report.Devices[j]
+		if a.Reboots != b.Reboots {
+			return a.Reboots > b.Reboots
+		}
+		return a.DeviceID < b.DeviceID
+	})
+	return report, nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+func TestShellyService_RebootTracking(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	cfg.Metrics.RebootThreshold = 2
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	var notified []int
+	service.SetRebootNotifier(func(_ context.Context, deviceID uint, _ string, reboots int) {
+		notified = append(notified, reboots)
+	})
+
+	// The first read sets the baseline; uptime growing as expected is no reboot
+	service.recordUptime(1, &shelly.DeviceStatus{Uptime: 7200})
+	service.recordUptime(1, &shelly.DeviceStatus{Uptime: 7230})
+	service.recordUptime(1, &shelly.DeviceStatus{}) // no uptime reported
+	if reboots, _ := service.DeviceReboots(1, 0); len(reboots) != 0 {
+		t.Fatalf("Expected no reboots, got %+v", reboots)
+	}
+
+	// A reboot requested by the manager is recorded but not counted
+	service.expectReboot(1)
+	service.recordUptime(1, &shelly.DeviceStatus{Uptime: 5})
+	status, err := service.DeviceRebootStatus(1)
+	if err != nil {
+		t.Fatalf("DeviceRebootStatus failed: %v", err)
+	}
+	if status.Reboots != 0 || status.Flapping {
+		t.Errorf("Expected the requested reboot not to count, got %+v", status)
+	}
+
+	// Each boot later than the last is an unexpected reboot
+	for _, booted := range []time.Duration{3 * time.Minute, 2 * time.Minute, time.Minute / 2} {
+		service.rebootMu.Lock()
+		service.bootTimes[1] = time.Now().Add(-time.Hour)
+		service.rebootMu.Unlock()
+		service.recordUptime(1, &shelly.DeviceStatus{Uptime: int(booted.Seconds())})
+	}
+	status, _ = service.DeviceRebootStatus(1)
+	if status.Reboots != 3 || !status.Flapping || status.Threshold != 2 || status.LastReboot == nil {
+		t.Errorf("Expected a flapping device, got %+v", status)
+	}
+	if len(notified) != 1 || notified[0] != 3 {
+		t.Errorf("Expected one notification on exceeding the threshold, got %v", notified)
+	}
+
+	reboots, _ := service.DeviceReboots(1, 2)
+	if len(reboots) != 2 || !reboots[0].Expected || reboots[1].Expected || reboots[0].BootedAt.Before(reboots[1].BootedAt) {
+		t.Errorf("Expected the requested and the latest unexpected reboot, newest first, got %+v", reboots)
+	}
+
+	service.recordUptime(2, &shelly.DeviceStatus{Uptime: 100000})
+	service.rebootMu.Lock()
+	service.bootTimes[2] = time.Now().Add(-48 * time.Hour)
+	service.rebootMu.Unlock()
+	service.recordUptime(2, &shelly.DeviceStatus{Uptime: 100000})
+
+	report, err := service.RebootReport()
+	if err != nil {
+		t.Fatalf("RebootReport failed: %v", err)
+	}
+	if len(report.Devices) != 2 || report.Flapping != 1 || report.Devices[0].DeviceID != 1 || report.Devices[1].Reboots != 1 {
+		t.Errorf("Unexpected reboot report: %+v", report)
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// metricsRollupInterval is how often the stored metric series are compacted
+const metricsRollupInterval = time.Hour
+
+// metricsRollup compacts one stored metric series: hourly rows of whole UTC
+// days past the series' hourly retention become one row per device and day,
+// and rows past its total retention, if it has one, are dropped
+type metricsRollup struct {
+	series  string
+	compact func(db *gorm.DB, now time.Time) error
+}
+
+// metricsRollups returns the stored metric series CompactMetrics covers
+func (s *ShellyService) metricsRollups() []metricsRollup {
+	return []metricsRollup{
+		{series: "energy", compact: func(db *gorm.DB, now time.Time) error {
+			s.energyMu.Lock()
+			defer s.energyMu.Unlock()
+			return s.compactEnergyUsage(db, now)
+		}},
+		{series: "latency", compact: s.compactDeviceLatency},
+	}
+}
+
+// CompactMetrics rolls up and prunes every stored metric series once. A
+// series that fails does not keep the others from being compacted.
+func (s *ShellyService) CompactMetrics(now time.Time) error {
+	db := s.DB.GetDB()
+	if db == nil {
+		return nil
+	}
+	var errs []error
+	for _, r := range s.metricsRollups() {
+		if err := r.compact(db, now); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.series, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StartMetricsRollups runs CompactMetrics at startup and then every hour
+// until the service stops
+func (s *ShellyService) StartMetricsRollups() {
+	go func() {
+		ticker := s.clock.NewTicker(metricsRollupInterval)
+		defer ticker.Stop()
+		for {
+			if s.leader == nil || s.leader() {
+				if err := s.CompactMetrics(s.clock.Now()); err != nil {
+					s.logger.WithFields(map[string]any{
+						"error":     err.Error(),
+						"component": "metrics",
+					}).Warn("Failed to roll up metric history")
+				}
+			}
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+}
@@ -9,11 +9,15 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ginsys/shelly-manager/internal/clock"
 	"github.com/ginsys/shelly-manager/internal/config"
 	"github.com/ginsys/shelly-manager/internal/configuration"
 	"github.com/ginsys/shelly-manager/internal/database"
 	"github.com/ginsys/shelly-manager/internal/discovery"
+	"github.com/ginsys/shelly-manager/internal/intake"
 	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/naming"
+	"github.com/ginsys/shelly-manager/internal/preferences"
 	"github.com/ginsys/shelly-manager/internal/shelly"
 	"github.com/ginsys/shelly-manager/internal/shelly/gen1"
 	"github.com/ginsys/shelly-manager/internal/shelly/gen2"
@@ -22,18 +26,129 @@ import (
 // ErrDeviceOffline is returned when a device is known to be offline and communication is skipped.
 var ErrDeviceOffline = errors.New("device is offline")
 
+// ErrDeviceNotFound is returned when a requested device does not exist.
+var ErrDeviceNotFound = errors.New("device not found")
+
 // ShellyService handles the core business logic
 type ShellyService struct {
 	DB        database.DatabaseInterface
 	Config    *config.Config
 	ConfigSvc *configuration.Service
-	logger    *logging.Logger
-	ctx       context.Context
-	cancel    context.CancelFunc
+	Intake    *intake.Service
+	// Preferences stores UI and API preferences per user
+	Preferences *preferences.Service
+	logger      *logging.Logger
+	ctx         context.Context
+	cancel      context.CancelFunc
 
 	// Client cache for device connections
 	clientMu sync.RWMutex
 	clients  map[string]shelly.Client
+
+	// Async bulk control jobs, oldest first
+	jobsMu      sync.Mutex
+	controlJobs []*BulkControlJob
+
+	// Supervisor health tracking and last recovery action per device
+	superMu      sync.Mutex
+	health       map[uint]*deviceHealth
+	lastRecovery map[uint]time.Time
+
+	// Latest clock skew report
+	skewMu    sync.Mutex
+	clockSkew *ClockSkewReport
+
+	// Wi-Fi credential rotations, oldest first, loaded from the database on
+	// first use and written back on every change
+	rotationMu      sync.Mutex
+	rotations       []*WiFiRotation
+	rotationsLoaded bool
+
+	// Active device debug traces by device ID
+	traceMu sync.Mutex
+	traces  map[uint]*deviceTrace
+
+	// Last power reported by metered devices, by device ID
+	powerMu sync.Mutex
+	power   map[uint]powerReading
+
+	// Boot times estimated from device uptime, and reboots the manager
+	// requested, by device ID
+	rebootMu        sync.Mutex
+	bootTimes       map[uint]time.Time
+	expectedReboots map[uint]time.Time
+	rebootNotifier  RebootNotifier
+
+	// Recent status requests by device ID, for the link state
+	latencyMu       sync.Mutex
+	latency         map[uint]*latencyHistory
+	latencyRecorder LatencyRecorder
+
+	// Devices whose link went dead, and the outage in progress
+	outageMu        sync.Mutex
+	offline         map[uint]*offlineDevice
+	outage          *outage
+	offlineNotifier DeviceOfflineNotifier
+	outageNotifier  OutageNotifier
+
+	// Serializes updates of the manager-side energy counters
+	energyMu sync.Mutex
+
+	// Protection trips open per device and channel
+	protectionMu       sync.Mutex
+	activeTrips        map[uint]map[tripKey]uint
+	protectionNotifier ProtectionNotifier
+
+	// State of the power budget groups over their limit, by group ID
+	budgetMu       sync.Mutex
+	budgets        map[uint]*powerBudgetState
+	budgetNotifier PowerBudgetNotifier
+
+	// Outbound WebSocket connections of Gen2 devices, by device ID
+	socketMu sync.Mutex
+	sockets  map[uint]*deviceSocket
+
+	// Device addresses of streamed debug logs, reloaded for unknown sources
+	logMu        sync.Mutex
+	logSources   map[string]uint
+	logSourcesAt time.Time
+
+	// Outstanding bulk confirmation tokens
+	confirmMu     sync.Mutex
+	confirmations map[string]pendingConfirmation
+
+	// Reviewed configuration replace plans awaiting apply, by plan ID
+	replaceMu    sync.Mutex
+	replacePlans map[string]*ConfigReplacePlan
+
+	// Told when device warranties approach expiry
+	assetMu          sync.Mutex
+	warrantyNotifier WarrantyNotifier
+
+	// Told about devices found on the network that are not in the inventory
+	alertMu           sync.Mutex
+	newDeviceNotifier NewDeviceNotifier
+
+	// Requests and device calls by API client, counted since usageSince
+	usageMu    sync.Mutex
+	usage      map[APIClient]*apiUsage
+	usageSince time.Time
+
+	// Budgets device requests per network; nil leaves them unlimited
+	rateLimiter *shelly.RateLimiter
+
+	// Discovery networks changed at runtime, replacing discovery.networks
+	// once set, and when each scheduled network was last scanned
+	discoveryNetMu       sync.Mutex
+	discoveryNetworks    []config.DiscoveryNetwork
+	discoveryNetworksSet bool
+	discoveryScannedAt   map[string]time.Time
+
+	// leader reports whether this instance runs periodic jobs; nil always runs
+	leader func() bool
+
+	// clock drives the periodic jobs, retention and report timestamps
+	clock clock.Clock
 }
 
 // NewService creates a new Shelly service
@@ -48,20 +163,149 @@ func NewServiceWithLogger(db database.DatabaseInterface, cfg *config.Config, log
 	// Create configuration service
 	configSvc := configuration.NewService(db.GetDB(), logger)
 
-	return &ShellyService{
-		DB:        db,
-		Config:    cfg,
-		ConfigSvc: configSvc,
-		logger:    logger,
-		ctx:       ctx,
-		cancel:    cancel,
-		clients:   make(map[string]shelly.Client),
+	s := &ShellyService{
+		DB:          db,
+		Config:      cfg,
+		ConfigSvc:   configSvc,
+		Intake:      intake.NewService(db.GetDB(), logger),
+		Preferences: preferences.NewService(db.GetDB(), logger),
+		logger:      logger,
+		ctx:         ctx,
+		cancel:      cancel,
+		clients:     make(map[string]shelly.Client),
+		clock:       clock.Real,
+	}
+	s.rateLimiter = newDeviceRateLimiter(cfg)
+
+	// Resolve import/export deadlines per device (class and device overrides)
+	configSvc.SetTimeoutResolver(func(deviceID uint) configuration.OperationTimeouts {
+		device, err := s.DB.GetDevice(deviceID)
+		if err != nil {
+			return configuration.OperationTimeouts{}
+		}
+		settings := s.deviceClientSettings(device)
+		return configuration.OperationTimeouts{
+			Import: settings.ImportTimeoutDuration(),
+			Export: settings.ExportTimeoutDuration(),
+		}
+	})
+
+	// Configuration import/export reaches devices the same way
+	configSvc.SetNetwork(s.deviceUserAgent(), s.deviceNetwork())
+
+	// Trace configuration import/export calls of devices being debugged
+	configSvc.SetRecorderResolver(func(deviceID uint) *shelly.Recorder {
+		if trace := s.traceRecorder(deviceID); trace != nil {
+			return trace.recorder
+		}
+		return nil
+	})
+
+	// Operation hooks decide whether drift is alerted
+	configSvc.SetDriftHook(s.driftHook)
+
+	// Drift is scored by the configured path weights before the defaults
+	if cfg != nil {
+		weights := make([]configuration.DriftWeight, 0, len(cfg.DriftScoring.Weights))
+		for _, w := range cfg.DriftScoring.Weights {
+			weights = append(weights, configuration.DriftWeight{Path: w.Path, Weight: w.Weight})
+		}
+		configSvc.SetDriftScorer(configuration.NewDriftScorer(weights))
 	}
+
+	return s
+}
+
+// SetClock replaces the clock driving the periodic jobs, retention, reports
+// and the configuration service's drift runs; tests inject a fake clock
+func (s *ShellyService) SetClock(c clock.Clock) {
+	s.clock = clock.OrReal(c)
+	s.ConfigSvc.SetClock(s.clock)
+}
+
+// deviceClientSettings resolves the timeout and retry settings for a device.
+// Global defaults are overlaid with matching class overrides from the config and
+// finally with the optional "client" object stored in the device settings,
+// whose invalid values (non-positive timeouts, negative retries) are ignored.
+func (s *ShellyService) deviceClientSettings(device *database.Device) config.DeviceClientSettings {
+	var settings struct {
+		Model  string                      `json:"model"`
+		Gen    int                         `json:"gen"`
+		Client config.DeviceClientSettings `json:"client"`
+	}
+	if device.Settings != "" {
+		_ = json.Unmarshal([]byte(device.Settings), &settings)
+	}
+	if settings.Model == "" {
+		settings.Model = device.Type
+	}
+
+	var clientCfg config.DeviceClientConfig
+	if s.Config != nil {
+		clientCfg = s.Config.DeviceClient
+	}
+	return clientCfg.Resolve(settings.Model, settings.Gen).Merge(settings.Client.ValidOnly())
+}
+
+// deviceNetwork returns the source address and proxy for device requests
+func (s *ShellyService) deviceNetwork() shelly.NetworkOptions {
+	if s.Config == nil {
+		return shelly.NetworkOptions{}
+	}
+	return shelly.NetworkOptions{
+		SourceIP:  s.Config.DeviceClient.SourceIP,
+		Interface: s.Config.DeviceClient.Interface,
+		Proxy:     s.Config.DeviceClient.Proxy,
+		Limiter:   s.rateLimiter,
+	}
+}
+
+// deviceUserAgent returns the configured User-Agent, or "" for the client default
+func (s *ShellyService) deviceUserAgent() string {
+	if s.Config == nil {
+		return ""
+	}
+	return s.Config.DeviceClient.UserAgent
+}
+
+// discoveryOptions applies the device client identity and route and the
+// discovery exclusions to discovery probes
+func (s *ShellyService) discoveryOptions() ([]discovery.ScannerOption, error) {
+	var opts []discovery.ScannerOption
+	if s.Config != nil {
+		exclude := s.Config.Discovery.Exclude
+		exclusions, err := discovery.NewExclusions(exclude.Networks, exclude.MACPrefixes, exclude.Hostnames)
+		if err != nil {
+			return nil, fmt.Errorf("invalid discovery exclusions: %w", err)
+		}
+		if !exclusions.IsZero() {
+			opts = append(opts, discovery.WithExclusions(exclusions))
+		}
+	}
+	if ua := s.deviceUserAgent(); ua != "" {
+		opts = append(opts, discovery.WithUserAgent(ua))
+	}
+	if network := s.deviceNetwork(); !network.IsZero() {
+		transport, err := shelly.NewTransport(network, false)
+		if err != nil {
+			transport = shelly.FailingTransport(err)
+		}
+		opts = append(opts, discovery.WithTransport(transport))
+	}
+	return opts, nil
+}
+
+// discoveryTimeout returns the per-host timeout of targeted probes
+func (s *ShellyService) discoveryTimeout() time.Duration {
+	if s.Config == nil || s.Config.Discovery.Timeout <= 0 {
+		return 2 * time.Second
+	}
+	return time.Duration(s.Config.Discovery.Timeout) * time.Second
 }
 
 // DiscoverDevices performs device discovery using HTTP and mDNS
 func (s *ShellyService) DiscoverDevices(network string) ([]database.Device, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(shelly.WithTrafficClass(context.Background(), shelly.TrafficDiscovery), 30*time.Second)
 	defer cancel()
 
 	s.logger.WithFields(map[string]any{
@@ -69,16 +313,11 @@ func (s *ShellyService) DiscoverDevices(network string) ([]database.Device, erro
 		"component": "service",
 	}).Info("Starting device discovery")
 
-	// Determine networks to scan
-	var networks []string
-	if network != "" && network != "auto" {
-		networks = []string{network}
-	} else if len(s.Config.Discovery.Networks) > 0 {
-		networks = s.Config.Discovery.Networks
-	}
+	// Determine networks to scan, each with its own options
+	targets := s.discoveryTargets(network)
 
 	s.logger.WithFields(map[string]any{
-		"networks":  networks,
+		"networks":  config.DiscoveryCIDRs(targets),
 		"timeout":   s.Config.Discovery.Timeout,
 		"component": "service",
 	}).Debug("Discovery configuration")
@@ -90,14 +329,16 @@ func (s *ShellyService) DiscoverDevices(network string) ([]database.Device, erro
 	}
 
 	// Perform combined discovery (HTTP + mDNS)
-	shellyDevices, err := discovery.CombinedDiscovery(ctx, networks, timeout)
+	shellyDevices, err := s.scanDiscoveryNetworks(ctx, targets, timeout)
 	if err != nil {
 		return nil, fmt.Errorf("discovery failed: %w", err)
 	}
 
 	// Upsert discovered devices to preserve existing data
 	var devices []database.Device
-	for _, sd := range shellyDevices {
+	var takenNames naming.NameSet
+	for _, found := range shellyDevices {
+		sd := found.ShellyDevice
 		// Skip devices without MAC address (can't use as unique identifier)
 		if sd.MAC == "" {
 			s.logger.WithFields(map[string]any{
@@ -108,69 +349,148 @@ func (s *ShellyService) DiscoverDevices(network string) ([]database.Device, erro
 			continue
 		}
 
-		// Prepare discovery update data
-		update := database.DiscoveryUpdate{
-			IP:       sd.IP,
-			Type:     discovery.GetDeviceType(sd.Model),
-			Firmware: sd.Version,
-			Status:   "online",
-			LastSeen: sd.Discovered,
-		}
-
-		// Use UpsertDeviceFromDiscovery to preserve existing data
-		device, err := s.DB.UpsertDeviceFromDiscovery(sd.MAC, update, sd.ID)
-		if err != nil {
-			s.logger.WithFields(map[string]any{
-				"mac":       sd.MAC,
-				"ip":        sd.IP,
-				"error":     err.Error(),
-				"component": "service",
-			}).Error("Failed to upsert device from discovery")
+		device, err := s.adoptDiscovered(ctx, found, &takenNames, s.newDeviceAlertsEnabled(), NewDeviceSourceDiscovery)
+		if err != nil || device == nil {
 			continue
 		}
+		devices = append(devices, *device)
+	}
 
-		// Update device settings with latest discovery info (preserve existing settings)
-		var existingSettings map[string]interface{}
-		if err := json.Unmarshal([]byte(device.Settings), &existingSettings); err != nil {
-			// If parsing fails, create new settings
-			existingSettings = make(map[string]interface{})
-		}
+	s.logger.WithFields(map[string]any{
+		"devices_found": len(devices),
+		"component":     "service",
+	}).Info("Discovery complete")
+
+	log.Printf("Discovery complete. Found %d devices", len(devices))
+	return devices, nil
+}
 
-		// Update discovery-related settings only
-		existingSettings["model"] = sd.Model
-		existingSettings["gen"] = sd.Generation
-		existingSettings["auth_enabled"] = sd.AuthEn
+// adoptDiscovered adds a discovered device to the inventory, or updates the
+// inventory device with its MAC. With holdNew, a device not yet in the
+// inventory is recorded as a new device alert instead. It returns nil for
+// devices that were held or vetoed by a hook.
+func (s *ShellyService) adoptDiscovered(ctx context.Context, found discoveredDevice, takenNames *naming.NameSet, holdNew bool, source string) (*database.Device, error) {
+	sd := found.ShellyDevice
+
+	// Prepare discovery update data
+	update := database.DiscoveryUpdate{
+		IP:       sd.IP,
+		Type:     discovery.GetDeviceType(sd.Model),
+		Firmware: sd.Version,
+		Status:   "online",
+		LastSeen: sd.Discovered,
+	}
 
-		// Preserve existing auth credentials if they exist
-		if _, hasUser := existingSettings["auth_user"]; !hasUser {
-			existingSettings["auth_user"] = ""
+	// Pre-registered devices are named from their intake entry
+	initialName := sd.ID
+	entry, err := s.Intake.Find(ctx, sd.MAC, "")
+	if err != nil {
+		s.logger.WithFields(map[string]any{
+			"mac":       sd.MAC,
+			"error":     err.Error(),
+			"component": "service",
+		}).Warn("Failed to look up device intake")
+	} else if entry != nil && entry.Name != "" {
+		initialName = entry.Name
+	}
+	// Unknown devices without an intake entry wait for an operator
+	if holdNew && entry == nil && s.isNewDevice(sd.MAC) {
+		s.recordNewDevice(ctx, sd, source)
+		return nil, nil
+	}
+	if entry == nil || entry.Name == "" {
+		if name := s.adoptionName(sd, takenNames); name != "" {
+			initialName = name
 		}
-		if _, hasPass := existingSettings["auth_pass"]; !hasPass {
-			existingSettings["auth_pass"] = ""
+	}
+
+	// Hooks decide on devices discovered for the first time
+	var adoption *HookOutcome
+	if s.isNewDevice(sd.MAC) {
+		candidate := &database.Device{MAC: sd.MAC, IP: sd.IP, Type: update.Type, Name: initialName, Firmware: sd.Version}
+		outcome := s.RunHooks(HookDeviceAdopted, HookPre, candidate, nil)
+		if outcome.Vetoed {
+			return nil, nil
 		}
+		adoption = &outcome
+	}
 
-		updatedSettings, _ := json.Marshal(existingSettings)
-		device.Settings = string(updatedSettings)
+	// Use UpsertDeviceFromDiscovery to preserve existing data
+	device, err := s.DB.UpsertDeviceFromDiscovery(sd.MAC, update, initialName)
+	if err != nil {
+		s.logger.WithFields(map[string]any{
+			"mac":       sd.MAC,
+			"ip":        sd.IP,
+			"error":     err.Error(),
+			"component": "service",
+		}).Error("Failed to upsert device from discovery")
+		return nil, err
+	}
 
-		// Save updated settings
-		if err := s.DB.UpdateDevice(device); err != nil {
+	// Update device settings with latest discovery info (preserve existing settings)
+	var existingSettings map[string]interface{}
+	if err := json.Unmarshal([]byte(device.Settings), &existingSettings); err != nil {
+		// If parsing fails, create new settings
+		existingSettings = make(map[string]interface{})
+	}
+
+	// Update discovery-related settings only
+	existingSettings["model"] = sd.Model
+	existingSettings["gen"] = sd.Generation
+	existingSettings["auth_enabled"] = sd.AuthEn
+
+	// Preserve existing auth credentials if they exist
+	if _, hasUser := existingSettings["auth_user"]; !hasUser {
+		existingSettings["auth_user"] = ""
+	}
+	if _, hasPass := existingSettings["auth_pass"]; !hasPass {
+		existingSettings["auth_pass"] = ""
+	}
+	s.applyDiscoveryNetwork(device.ID, found.network, sd.AuthEn, existingSettings)
+
+	updatedSettings, _ := json.Marshal(existingSettings)
+	device.Settings = string(updatedSettings)
+
+	// Save updated settings
+	if err := s.DB.UpdateDevice(device); err != nil {
+		s.logger.WithFields(map[string]any{
+			"device_id": device.ID,
+			"error":     err.Error(),
+			"component": "service",
+		}).Error("Failed to update device settings")
+	}
+
+	if entry != nil {
+		if err := s.Intake.MarkMatched(ctx, entry, device.ID); err != nil {
 			s.logger.WithFields(map[string]any{
 				"device_id": device.ID,
 				"error":     err.Error(),
 				"component": "service",
-			}).Error("Failed to update device settings")
+			}).Warn("Failed to mark device intake as matched")
+		}
+		if entry.Room != "" {
+			if err := s.tagDevice(device.ID, "room:"+entry.Room); err != nil {
+				s.logger.WithFields(map[string]any{
+					"device_id": device.ID,
+					"error":     err.Error(),
+					"component": "service",
+				}).Warn("Failed to tag device with its intake room")
+			}
 		}
-
-		devices = append(devices, *device)
 	}
 
-	s.logger.WithFields(map[string]any{
-		"devices_found": len(devices),
-		"component":     "service",
-	}).Info("Discovery complete")
+	if adoption != nil {
+		s.applyHookTags(device.ID, adoption.Tags)
+		s.RunHooks(HookDeviceAdopted, HookPost, device, nil)
+		s.markNewDeviceAdopted(sd.MAC, device.ID, "")
+	}
+	return device, nil
+}
 
-	log.Printf("Discovery complete. Found %d devices", len(devices))
-	return devices, nil
+// Context is cancelled when the service stops; loops started alongside the
+// service run under it so they end together
+func (s *ShellyService) Context() context.Context {
+	return s.ctx
 }
 
 // Stop gracefully stops the service
@@ -179,6 +499,16 @@ func (s *ShellyService) Stop() {
 		"component": "service",
 	}).Info("Stopping Shelly service")
 	s.cancel()
+
+	// Device connections are hijacked from the HTTP server and outlive its
+	// shutdown
+	s.socketMu.Lock()
+	sockets := s.sockets
+	s.sockets = nil
+	s.socketMu.Unlock()
+	for _, sock := range sockets {
+		sock.close()
+	}
 }
 
 // ClearClientCache clears the cached client for a specific device or all devices
@@ -328,6 +658,32 @@ func (s *ShellyService) getClientWithAuthRetry(device *database.Device) (shelly.
 	return client, testErr // Return the client anyway, let the caller handle the auth error
 }
 
+// deviceCredentials returns the credential source for a device client. On
+// every challenge it reloads the credentials saved with the device and falls
+// back to the provisioning credentials, which may come from the secrets
+// environment (SHELLY_PROVISIONING_AUTH_PASSWORD or its _FILE variant). The
+// fleet-wide password is only offered to Digest challenges, which do not
+// reveal it, unless the device opts in with provisioning_auth in its
+// settings: any host answering Basic at a device's address would receive it.
+func (s *ShellyService) deviceCredentials(deviceID uint) shelly.CredentialSource {
+	return func(scheme string) (string, string) {
+		var settings struct {
+			AuthUser         string `json:"auth_user,omitempty"`
+			AuthPass         string `json:"auth_pass,omitempty"`
+			ProvisioningAuth bool   `json:"provisioning_auth,omitempty"`
+		}
+		if device, err := s.DB.GetDevice(deviceID); err == nil && device.Settings != "" {
+			if json.Unmarshal([]byte(device.Settings), &settings) == nil && settings.AuthPass != "" {
+				return settings.AuthUser, settings.AuthPass
+			}
+		}
+		if s.Config.Provisioning.AuthEnabled && (scheme == shelly.AuthSchemeDigest || settings.ProvisioningAuth) {
+			return s.Config.Provisioning.AuthUser, s.Config.Provisioning.AuthPassword
+		}
+		return "", ""
+	}
+}
+
 // getClientWithRetry returns a cached client or creates a new one with retry logic
 func (s *ShellyService) getClientWithRetry(device *database.Device, allowRetry bool) (shelly.Client, error) {
 	s.clientMu.RLock()
@@ -424,22 +780,51 @@ func (s *ShellyService) getClientWithRetry(device *database.Device, allowRetry b
 		}
 	}
 
+	// Resolve per-device timeout and retry settings
+	clientSettings := s.deviceClientSettings(device)
+
 	// Create appropriate client based on generation
 	switch settings.Gen {
 	case 1:
 		// Gen1 device
-		var opts []gen1.ClientOption
+		opts := []gen1.ClientOption{
+			gen1.WithTimeout(clientSettings.RequestTimeout()),
+			gen1.WithRetry(clientSettings.Retries(), clientSettings.RetryDelayDuration()),
+			gen1.WithNetwork(s.deviceNetwork()),
+		}
+		if ua := s.deviceUserAgent(); ua != "" {
+			opts = append(opts, gen1.WithUserAgent(ua))
+		}
 		if authUser != "" && authPass != "" {
 			opts = append(opts, gen1.WithAuth(authUser, authPass))
 		}
+		// The client detects whether the device requires auth and with
+		// which scheme; credentials are resolved on the first challenge
+		opts = append(opts, gen1.WithCredentialSource(s.deviceCredentials(device.ID)))
+		if trace := s.traceRecorder(device.ID); trace != nil {
+			opts = append(opts, gen1.WithRecorder(trace.recorder))
+		}
 		client = gen1.NewClient(device.IP, opts...)
 
 	case 2, 3:
 		// Gen2+ device
-		var opts []gen2.ClientOption
+		opts := []gen2.ClientOption{
+			gen2.WithTimeout(clientSettings.RequestTimeout()),
+			gen2.WithRetry(clientSettings.Retries(), clientSettings.RetryDelayDuration()),
+			gen2.WithNetwork(s.deviceNetwork()),
+		}
+		if ua := s.deviceUserAgent(); ua != "" {
+			opts = append(opts, gen2.WithUserAgent(ua))
+		}
 		if authUser != "" && authPass != "" {
 			opts = append(opts, gen2.WithAuth(authUser, authPass))
 		}
+		// Answer challenges of devices that enabled auth after discovery
+		// and pick up rotated credentials without recreating the client
+		opts = append(opts, gen2.WithCredentialSource(s.deviceCredentials(device.ID)))
+		if trace := s.traceRecorder(device.ID); trace != nil {
+			opts = append(opts, gen2.WithRecorder(trace.recorder))
+		}
 		client = gen2.NewClient(device.IP, opts...)
 
 	default:
@@ -526,10 +911,30 @@ func (s *ShellyService) getClientWithRetry(device *database.Device, allowRetry b
 	return client, nil
 }
 
+// jobContext is the context for background work started by a request: it
+// lives as long as the service but keeps the request ID, so the work is
+// logged under the request that started it
+func (s *ShellyService) jobContext(ctx context.Context) context.Context {
+	job := s.ctx
+	if requestID := logging.GetRequestID(ctx); requestID != "" {
+		job = logging.WithRequestID(job, requestID)
+	}
+	if counter := shelly.CallCounterFrom(ctx); counter != nil {
+		job = shelly.WithCallCounter(job, counter)
+	}
+	return job
+}
+
 // ControlDevice sends a control command to a device
 func (s *ShellyService) ControlDevice(deviceID uint, action string, params map[string]interface{}) error {
+	return s.ControlDeviceContext(s.ctx, deviceID, action, params)
+}
+
+// ControlDeviceContext is ControlDevice for an API request or job: the
+// command stops when ctx is cancelled and is logged under its request ID
+func (s *ShellyService) ControlDeviceContext(ctx context.Context, deviceID uint, action string, params map[string]interface{}) error {
 	// Get device from database
-	device, err := s.DB.GetDevice(deviceID)
+	device, err := s.DB.WithContext(ctx).GetDevice(deviceID)
 	if err != nil {
 		return fmt.Errorf("device not found: %w", err)
 	}
@@ -540,13 +945,40 @@ func (s *ShellyService) ControlDevice(deviceID uint, action string, params map[s
 		return ErrDeviceOffline
 	}
 
+	switch action {
+	case "on", "off", "toggle":
+		if err := requireOperation(device, shelly.OpSwitch, shelly.OpDimming, shelly.OpRGBW); err != nil {
+			return err
+		}
+	}
+
+	// Devices connected over their outbound WebSocket get the command there;
+	// HTTP remains the fallback
+	if sock := s.deviceSocket(device.ID); sock != nil {
+		err := s.controlOverSocket(ctx, sock, device, action, params)
+		if err == nil {
+			s.logger.WithContext(ctx).WithFields(map[string]any{
+				"device_id": deviceID,
+				"action":    action,
+				"component": "service",
+			}).Info("Device control executed over WebSocket")
+			return nil
+		}
+		s.logger.WithContext(ctx).WithFields(map[string]any{
+			"device_id": deviceID,
+			"action":    action,
+			"error":     err.Error(),
+			"component": "service",
+		}).Warn("Device control over WebSocket failed, falling back to HTTP")
+	}
+
 	// Get or create client
 	client, err := s.getClient(device)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
 	defer cancel()
 
 	// Execute action with auth retry
@@ -584,6 +1016,7 @@ func (s *ShellyService) ControlDevice(deviceID uint, action string, params map[s
 		}
 
 	case "reboot":
+		s.expectReboot(device.ID)
 		err = client.Reboot(ctx)
 
 	default:
@@ -594,7 +1027,7 @@ func (s *ShellyService) ControlDevice(deviceID uint, action string, params map[s
 
 	// If auth failed, retry with cleared credentials
 	if actionErr != nil && shelly.IsAuthError(actionErr) {
-		s.logger.WithFields(map[string]any{
+		s.logger.WithContext(ctx).WithFields(map[string]any{
 			"device_id": deviceID,
 			"device_ip": device.IP,
 			"action":    action,
@@ -611,7 +1044,7 @@ func (s *ShellyService) ControlDevice(deviceID uint, action string, params map[s
 				updatedSettings, _ := json.Marshal(settings)
 				device.Settings = string(updatedSettings)
 				if updateErr := s.DB.UpdateDevice(device); updateErr != nil {
-					s.logger.WithFields(map[string]any{
+					s.logger.WithContext(ctx).WithFields(map[string]any{
 						"device_id": device.ID,
 						"error":     updateErr.Error(),
 					}).Error("Failed to update device")
@@ -657,7 +1090,7 @@ func (s *ShellyService) ControlDevice(deviceID uint, action string, params map[s
 					}
 
 					if actionErr == nil {
-						s.logger.WithFields(map[string]any{
+						s.logger.WithContext(ctx).WithFields(map[string]any{
 							"device_id": deviceID,
 							"device_ip": device.IP,
 							"action":    action,
@@ -677,13 +1110,13 @@ func (s *ShellyService) ControlDevice(deviceID uint, action string, params map[s
 	device.Status = "online"
 	device.LastSeen = time.Now()
 	if err := s.DB.UpdateDevice(device); err != nil {
-		s.logger.WithFields(map[string]any{
+		s.logger.WithContext(ctx).WithFields(map[string]any{
 			"device_id": device.ID,
 			"error":     err.Error(),
 		}).Error("Failed to update device")
 	}
 
-	s.logger.WithFields(map[string]any{
+	s.logger.WithContext(ctx).WithFields(map[string]any{
 		"device_id": deviceID,
 		"device_ip": device.IP,
 		"action":    action,
@@ -695,6 +1128,12 @@ func (s *ShellyService) ControlDevice(deviceID uint, action string, params map[s
 
 // GetDeviceStatus retrieves the current status of a device
 func (s *ShellyService) GetDeviceStatus(deviceID uint) (map[string]interface{}, error) {
+	return s.GetDeviceStatusContext(s.ctx, deviceID)
+}
+
+// GetDeviceStatusContext is GetDeviceStatus for an API request: the device
+// calls stop when ctx is cancelled and are counted against its client
+func (s *ShellyService) GetDeviceStatusContext(ctx context.Context, deviceID uint) (map[string]interface{}, error) {
 	// Get device from database
 	device, err := s.DB.GetDevice(deviceID)
 	if err != nil {
@@ -706,9 +1145,13 @@ func (s *ShellyService) GetDeviceStatus(deviceID uint) (map[string]interface{},
 		if time.Since(device.LastSeen) <= 5*time.Minute {
 			client, clientErr := s.getClient(device)
 			if clientErr == nil {
-				probeCtx, probeCancel := context.WithTimeout(s.ctx, 3*time.Second)
+				probeCtx, probeCancel := context.WithTimeout(ctx, 3*time.Second)
 				defer probeCancel()
 				if status, probeErr := client.GetStatus(probeCtx); probeErr == nil {
+					s.recordPower(deviceID, status)
+					s.recordUptime(deviceID, status)
+					s.recordProtection(deviceID, status)
+					s.recordEnergy(deviceID, status)
 					device.Status = "online"
 					device.LastSeen = time.Now()
 					_ = s.DB.UpdateDevice(device)
@@ -733,7 +1176,7 @@ func (s *ShellyService) GetDeviceStatus(deviceID uint) (map[string]interface{},
 		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	// Get status from device
@@ -741,6 +1184,10 @@ func (s *ShellyService) GetDeviceStatus(deviceID uint) (map[string]interface{},
 	if err != nil {
 		return nil, fmt.Errorf("failed to get status: %w", err)
 	}
+	s.recordPower(deviceID, status)
+	s.recordUptime(deviceID, status)
+	s.recordProtection(deviceID, status)
+	s.recordEnergy(deviceID, status)
 
 	// Convert to map for JSON response
 	result := map[string]interface{}{
@@ -768,6 +1215,11 @@ func (s *ShellyService) GetDeviceStatus(deviceID uint) (map[string]interface{},
 
 // GetDeviceEnergy retrieves energy consumption data
 func (s *ShellyService) GetDeviceEnergy(deviceID uint, channel int) (*shelly.EnergyData, error) {
+	return s.GetDeviceEnergyContext(s.ctx, deviceID, channel)
+}
+
+// GetDeviceEnergyContext is GetDeviceEnergy for an API request
+func (s *ShellyService) GetDeviceEnergyContext(ctx context.Context, deviceID uint, channel int) (*shelly.EnergyData, error) {
 	// Get device from database
 	device, err := s.DB.GetDevice(deviceID)
 	if err != nil {
@@ -777,6 +1229,9 @@ func (s *ShellyService) GetDeviceEnergy(deviceID uint, channel int) (*shelly.Ene
 	if device.Status == "offline" {
 		return nil, ErrDeviceOffline
 	}
+	if err := requireOperation(device, shelly.OpPowerMetering); err != nil {
+		return nil, err
+	}
 
 	// Get or create client
 	client, err := s.getClient(device)
@@ -784,7 +1239,7 @@ func (s *ShellyService) GetDeviceEnergy(deviceID uint, channel int) (*shelly.Ene
 		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	// Get energy data
@@ -792,6 +1247,9 @@ func (s *ShellyService) GetDeviceEnergy(deviceID uint, channel int) (*shelly.Ene
 	if err != nil {
 		return nil, fmt.Errorf("failed to get energy data: %w", err)
 	}
+	if energy.Total > 0 {
+		s.recordEnergyReading(deviceID, channel, energy.Total*1000)
+	}
 
 	return energy, nil
 }
@@ -829,7 +1287,12 @@ func (s *ShellyService) ImportDeviceConfig(deviceID uint) (*configuration.Device
 	}).Debug("ImportDeviceConfig: Got client, proceeding to import")
 
 	// Import configuration
-	return s.ConfigSvc.ImportFromDevice(deviceID, client)
+	config, err := s.ConfigSvc.ImportFromDevice(deviceID, client)
+	if err != nil {
+		return nil, err
+	}
+	s.recordDeviceProfile(device, config.Config)
+	return config, nil
 }
 
 // GetDeviceConfig gets the stored configuration for a device
@@ -842,6 +1305,12 @@ func (s *ShellyService) UpdateDeviceConfig(deviceID uint, configUpdate map[strin
 	return s.ConfigSvc.UpdateDeviceConfig(deviceID, configUpdate)
 }
 
+// PatchDeviceConfig applies a JSON Patch or JSON Merge Patch to the stored
+// configuration for a device
+func (s *ShellyService) PatchDeviceConfig(deviceID uint, patchType string, patch json.RawMessage) (*configuration.DeviceConfig, *configuration.ValidationResult, error) {
+	return s.ConfigSvc.PatchDeviceConfig(deviceID, patchType, patch)
+}
+
 // GetImportStatus gets the import status for a device
 func (s *ShellyService) GetImportStatus(deviceID uint) (*configuration.ImportStatus, error) {
 	return s.ConfigSvc.GetImportStatus(deviceID)
@@ -854,16 +1323,25 @@ func (s *ShellyService) UpdateRelayConfig(deviceID uint, config *configuration.R
 
 // UpdateDimmingConfig updates dimming-specific configuration
 func (s *ShellyService) UpdateDimmingConfig(deviceID uint, config *configuration.DimmingConfig) error {
+	if err := s.requireDeviceOperation(deviceID, shelly.OpDimming); err != nil {
+		return err
+	}
 	return s.ConfigSvc.UpdateCapabilityConfig(deviceID, "dimming", config)
 }
 
 // UpdateRollerConfig updates roller-specific configuration
 func (s *ShellyService) UpdateRollerConfig(deviceID uint, config *configuration.RollerConfig) error {
+	if err := s.requireDeviceOperation(deviceID, shelly.OpRoller); err != nil {
+		return err
+	}
 	return s.ConfigSvc.UpdateCapabilityConfig(deviceID, "roller", config)
 }
 
 // UpdatePowerMeteringConfig updates power metering configuration
 func (s *ShellyService) UpdatePowerMeteringConfig(deviceID uint, config *configuration.PowerMeteringConfig) error {
+	if err := s.requireDeviceOperation(deviceID, shelly.OpPowerMetering); err != nil {
+		return err
+	}
 	return s.ConfigSvc.UpdateCapabilityConfig(deviceID, "power_metering", config)
 }
 
@@ -919,8 +1397,16 @@ func (s *ShellyService) ExportDeviceConfig(deviceID uint) error {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
 
+	if err := s.RunHooks(HookConfigExported, HookPre, device, nil).Err(); err != nil {
+		return err
+	}
+
 	// Export configuration
-	return s.ConfigSvc.ExportToDevice(deviceID, client)
+	if err := s.ConfigSvc.ExportToDevice(deviceID, client); err != nil {
+		return err
+	}
+	s.RunHooks(HookConfigExported, HookPost, device, nil)
+	return nil
 }
 
 // DetectConfigDrift checks for configuration drift on a device
@@ -986,6 +1472,23 @@ func (s *ShellyService) BulkDetectConfigDrift() (*configuration.BulkDriftResult,
 	return s.ConfigSvc.BulkDetectDrift(deviceIDs, clientGetter)
 }
 
+// PreviewConfigTemplateApply previews a template on the selected devices, or
+// on every compatible device when none are given. An unknown ID is reported
+// with ErrDeviceNotFound.
+func (s *ShellyService) PreviewConfigTemplateApply(templateID uint, deviceIDs []uint, variables map[string]interface{}) (*configuration.TemplateApplyPreview, error) {
+	var ids []uint
+	if len(deviceIDs) > 0 {
+		devices, err := s.SelectDevices(deviceIDs, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range devices {
+			ids = append(ids, d.ID)
+		}
+	}
+	return s.ConfigSvc.PreviewTemplateApply(templateID, ids, variables)
+}
+
 // ApplyConfigTemplate applies a configuration template to a device
 func (s *ShellyService) ApplyConfigTemplate(deviceID uint, templateID uint, variables map[string]interface{}) error {
 	return s.ConfigSvc.ApplyTemplate(deviceID, templateID, variables)
@@ -1041,6 +1544,20 @@ func (s *ShellyService) GenerateDeviceDriftReport(deviceID uint) (*configuration
 	return s.ConfigSvc.GenerateDeviceDriftReport(deviceID, client)
 }
 
+// GetDriftQueue returns the devices awaiting drift remediation, most severe
+// first
+func (s *ShellyService) GetDriftQueue(minSeverity string, limit int) ([]configuration.DriftQueueItem, error) {
+	return s.ConfigSvc.GetDriftQueue(minSeverity, limit)
+}
+
+// GetDriftTimeline returns the drift events of a device, oldest first
+func (s *ShellyService) GetDriftTimeline(deviceID uint, since *time.Time, limit int) (*configuration.DriftTimeline, error) {
+	if _, err := s.DB.GetDevice(deviceID); err != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	return s.ConfigSvc.GetDriftTimeline(deviceID, since, limit)
+}
+
 // GetDriftTrends returns drift trends with optional filtering
 func (s *ShellyService) GetDriftTrends(deviceID *uint, resolved *bool, limit int) ([]configuration.DriftTrend, error) {
 	return s.ConfigSvc.GetDriftTrends(deviceID, resolved, limit)
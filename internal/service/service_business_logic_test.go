@@ -549,15 +549,18 @@ func TestShellyService_ConcurrentAccess(t *testing.T) {
 func createTestConfigBusiness() *config.Config {
 	return &config.Config{
 		Discovery: struct {
-			Enabled         bool     `mapstructure:"enabled"`
-			Networks        []string `mapstructure:"networks"`
-			Interval        int      `mapstructure:"interval"`
-			Timeout         int      `mapstructure:"timeout"`
-			EnableMDNS      bool     `mapstructure:"enable_mdns"`
-			EnableSSDP      bool     `mapstructure:"enable_ssdp"`
-			ConcurrentScans int      `mapstructure:"concurrent_scans"`
+			Enabled         bool                       `mapstructure:"enabled"`
+			Networks        []config.DiscoveryNetwork  `mapstructure:"networks"`
+			Interval        int                        `mapstructure:"interval"`
+			Timeout         int                        `mapstructure:"timeout"`
+			EnableMDNS      bool                       `mapstructure:"enable_mdns"`
+			EnableSSDP      bool                       `mapstructure:"enable_ssdp"`
+			ConcurrentScans int                        `mapstructure:"concurrent_scans"`
+			Exclude         config.DiscoveryExclude    `mapstructure:"exclude"`
+			NewDeviceAlerts bool                       `mapstructure:"new_device_alerts"`
+			DHCPLeases      config.DiscoveryDHCPLeases `mapstructure:"dhcp_leases"`
 		}{
-			Networks: []string{"192.168.1.0/24"},
+			Networks: []config.DiscoveryNetwork{{CIDR: "192.168.1.0/24"}},
 			Timeout:  5,
 			Enabled:  true,
 		},
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -380,6 +381,16 @@ func TestShellyService_UpdateDimmingConfig(t *testing.T) {
 		DefaultState:      configuration.BoolPtr(true),
 	}
 
+	// The SHSW-25 has no dimmer
+	err = service.UpdateDimmingConfig(device.ID, dimmingConfig)
+	if !errors.Is(err, ErrUnsupportedCapability) {
+		t.Fatalf("Expected ErrUnsupportedCapability, got %v", err)
+	}
+
+	device.Settings = `{"model":"SHDM-2","gen":1}`
+	if err := db.UpdateDevice(device); err != nil {
+		t.Fatalf("UpdateDevice failed: %v", err)
+	}
 	err = service.UpdateDimmingConfig(device.ID, dimmingConfig)
 	if err != nil {
 		t.Fatalf("UpdateDimmingConfig failed: %v", err)
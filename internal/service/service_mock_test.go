@@ -86,7 +86,7 @@ func TestShellyService_ConfigHandling(t *testing.T) {
 			setupConfig: func() *config.Config {
 				cfg := &config.Config{}
 				cfg.Discovery.Enabled = true
-				cfg.Discovery.Networks = []string{}
+				cfg.Discovery.Networks = []config.DiscoveryNetwork{}
 				cfg.Discovery.Timeout = 1
 				return cfg
 			},
@@ -96,7 +96,7 @@ func TestShellyService_ConfigHandling(t *testing.T) {
 			setupConfig: func() *config.Config {
 				cfg := &config.Config{}
 				cfg.Discovery.Enabled = true
-				cfg.Discovery.Networks = []string{"203.0.113.0/30"}
+				cfg.Discovery.Networks = []config.DiscoveryNetwork{{CIDR: "203.0.113.0/30"}}
 				cfg.Discovery.Timeout = 0
 				return cfg
 			},
@@ -106,7 +106,7 @@ func TestShellyService_ConfigHandling(t *testing.T) {
 			setupConfig: func() *config.Config {
 				cfg := &config.Config{}
 				cfg.Discovery.Enabled = false
-				cfg.Discovery.Networks = []string{"203.0.113.0/24"}
+				cfg.Discovery.Networks = []config.DiscoveryNetwork{{CIDR: "203.0.113.0/24"}}
 				cfg.Discovery.Timeout = 5
 				return cfg
 			},
@@ -437,9 +437,9 @@ func TestShellyService_InitializationEdgeCases(t *testing.T) {
 	// Test with extreme config values
 	extremeConfig := &config.Config{}
 	extremeConfig.Discovery.Enabled = true
-	extremeConfig.Discovery.Networks = make([]string, 1000) // Very large network list
+	extremeConfig.Discovery.Networks = make([]config.DiscoveryNetwork, 1000) // Very large network list
 	for i := range extremeConfig.Discovery.Networks {
-		extremeConfig.Discovery.Networks[i] = "203.0.113.0/30"
+		extremeConfig.Discovery.Networks[i] = config.DiscoveryNetwork{CIDR: "203.0.113.0/30"}
 	}
 	extremeConfig.Discovery.Timeout = -1           // Negative timeout
 	extremeConfig.Discovery.ConcurrentScans = -100 // Negative concurrency
@@ -8,6 +8,7 @@ import (
 	"github.com/ginsys/shelly-manager/internal/config"
 	"github.com/ginsys/shelly-manager/internal/database"
 	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/shelly"
 )
 
 // Helper function to create test database
@@ -72,7 +73,7 @@ func createTestDBNoCleanup(t *testing.T) *database.Manager {
 func createTestConfig() *config.Config {
 	cfg := &config.Config{}
 	cfg.Discovery.Enabled = true
-	cfg.Discovery.Networks = []string{"203.0.113.0/30"} // TEST-NET-3 range for testing
+	cfg.Discovery.Networks = []config.DiscoveryNetwork{{CIDR: "203.0.113.0/30"}} // TEST-NET-3 range for testing
 	cfg.Discovery.Interval = 60
 	cfg.Discovery.Timeout = 1 // Short timeout for tests
 	cfg.Discovery.EnableMDNS = false
@@ -308,7 +309,7 @@ func TestShellyService_DiscoverDevices_NoConfigNetworks(t *testing.T) {
 	// Create config with no discovery networks
 	cfg := &config.Config{}
 	cfg.Discovery.Enabled = true
-	cfg.Discovery.Networks = []string{} // Empty networks
+	cfg.Discovery.Networks = []config.DiscoveryNetwork{} // Empty networks
 	cfg.Discovery.Interval = 60
 	cfg.Discovery.Timeout = 1
 	cfg.Discovery.EnableMDNS = false
@@ -345,7 +346,7 @@ func TestShellyService_DiscoverDevices_ZeroTimeout(t *testing.T) {
 	// Create config with zero timeout (should use default)
 	cfg := &config.Config{}
 	cfg.Discovery.Enabled = true
-	cfg.Discovery.Networks = []string{"203.0.113.0/30"} // TEST-NET-3
+	cfg.Discovery.Networks = []config.DiscoveryNetwork{{CIDR: "203.0.113.0/30"}} // TEST-NET-3
 	cfg.Discovery.Interval = 60
 	cfg.Discovery.Timeout = 0 // Zero timeout - should use default
 	cfg.Discovery.EnableMDNS = false
@@ -663,3 +664,64 @@ func TestShellyService_EdgeCases(t *testing.T) {
 		}
 	}
 }
+
+func TestShellyService_DeviceCredentials(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfig()
+	cfg.Provisioning.AuthEnabled = true
+	cfg.Provisioning.AuthUser = "admin"
+	cfg.Provisioning.AuthPassword = "fleet-secret"
+	service := NewServiceWithLogger(db, cfg, createTestLogger(t))
+
+	saved := &database.Device{IP: "192.168.1.61", MAC: "AA:BB:CC:DD:EE:61", Name: "saved", Settings: `{"auth_user":"admin","auth_pass":"own-secret"}`}
+	plain := &database.Device{IP: "192.168.1.62", MAC: "AA:BB:CC:DD:EE:62", Name: "plain", Settings: `{"gen":1}`}
+	optIn := &database.Device{IP: "192.168.1.63", MAC: "AA:BB:CC:DD:EE:63", Name: "opt-in", Settings: `{"gen":1,"provisioning_auth":true}`}
+	for _, device := range []*database.Device{saved, plain, optIn} {
+		if err := db.AddDevice(device); err != nil {
+			t.Fatalf("AddDevice failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		device *database.Device
+		scheme string
+		want   string
+	}{
+		{saved, shelly.AuthSchemeBasic, "own-secret"},
+		{plain, shelly.AuthSchemeDigest, "fleet-secret"},
+		{plain, shelly.AuthSchemeBasic, ""}, // not sent in clear text without opting in
+		{optIn, shelly.AuthSchemeBasic, "fleet-secret"},
+	}
+	for _, tt := range tests {
+		if _, pass := service.deviceCredentials(tt.device.ID)(tt.scheme); pass != tt.want {
+			t.Errorf("%s over %s: expected password %q, got %q", tt.device.Name, tt.scheme, tt.want, pass)
+		}
+	}
+}
+
+func TestShellyService_DeviceClientSettings(t *testing.T) {
+	db := createTestDB(t)
+	cfg := createTestConfig()
+	cfg.DeviceClient.Timeout = config.IntPtr(8)
+	cfg.DeviceClient.RetryAttempts = config.IntPtr(2)
+	service := NewServiceWithLogger(db, cfg, createTestLogger(t))
+
+	tests := []struct {
+		name     string
+		settings string
+		timeout  time.Duration
+		control  time.Duration
+		retries  int
+	}{
+		{"inherited", `{"gen":1}`, 8 * time.Second, config.DefaultDeviceControlTimeout * time.Second, 2},
+		{"zero retries apply", `{"client":{"retry_attempts":0,"timeout":5}}`, 5 * time.Second, config.DefaultDeviceControlTimeout * time.Second, 0},
+		{"zero timeout ignored", `{"client":{"timeout":0}}`, 8 * time.Second, config.DefaultDeviceControlTimeout * time.Second, 2},
+		{"negative values ignored", `{"client":{"control_timeout":-3,"retry_attempts":-1}}`, 8 * time.Second, config.DefaultDeviceControlTimeout * time.Second, 2},
+	}
+	for _, tt := range tests {
+		settings := service.deviceClientSettings(&database.Device{Type: "SHSW-1", Settings: tt.settings})
+		if settings.RequestTimeout() != tt.timeout || settings.ControlTimeoutDuration() != tt.control || settings.Retries() != tt.retries {
+			t.Errorf("%s: got timeout %v, control %v, %d retries", tt.name, settings.RequestTimeout(), settings.ControlTimeoutDuration(), settings.Retries())
+		}
+	}
+}
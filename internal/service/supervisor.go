@@ -0,0 +1,372 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// supervisorProbeWorkers bounds concurrent health probes per supervisor round
+const supervisorProbeWorkers = 10
+
+// deviceHealth is the supervisor's view of one device across rounds
+type deviceHealth struct {
+	reachable     bool
+	lastReachable time.Time
+	drops         []time.Time // reachable -> unreachable transitions
+	link          string      // link state from recent status requests
+}
+
+// apRoamer is implemented by device clients that support AP roaming (Gen1)
+type apRoamer interface {
+	SetAPRoaming(ctx context.Context, enabled bool, threshold int) error
+}
+
+// SetLeaderFunc makes periodic jobs such as the supervisor run only while
+// leader returns true, so one of several instances sharing a database runs
+// them. Call it before StartSupervisor.
+func (s *ShellyService) SetLeaderFunc(leader func() bool) {
+	s.leader = leader
+}
+
+// StartSupervisor runs SuperviseOnce every supervisor.interval until the
+// service stops. It does nothing when the supervisor is disabled.
+func (s *ShellyService) StartSupervisor() error {
+	if s.Config == nil || !s.Config.Supervisor.Enabled {
+		return nil
+	}
+	if err := s.Config.Supervisor.Validate(); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := s.clock.NewTicker(s.Config.Supervisor.IntervalDuration())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C():
+				if s.leader != nil && !s.leader() {
+					continue
+				}
+				if _, err := s.SuperviseOnce(s.ctx, false); err != nil {
+					s.logger.WithFields(map[string]any{
+						"error":     err.Error(),
+						"component": "supervisor",
+					}).Warn("Supervisor round failed")
+				}
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]any{
+		"interval":  s.Config.Supervisor.IntervalDuration().String(),
+		"policies":  len(s.Config.Supervisor.Policies),
+		"component": "supervisor",
+	}).Info("Started device supervisor")
+	return nil
+}
+
+// SuperviseOnce probes the devices selected by the recovery policies and their
+// subnet neighbours, then takes the recovery actions that are due. Every action
+// is written to the recovery audit log; with dryRun the probes still update
+// the health history but actions are only returned, not taken or logged.
+// During an outage no actions are due.
+func (s *ShellyService) SuperviseOnce(ctx context.Context, dryRun bool) ([]database.RecoveryAction, error) {
+	if s.Config == nil || len(s.Config.Supervisor.Policies) == 0 {
+		return []database.RecoveryAction{}, nil
+	}
+	if err := s.Config.Supervisor.Validate(); err != nil {
+		return nil, err
+	}
+	policies := make([]config.RecoveryPolicy, len(s.Config.Supervisor.Policies))
+	maxWindow := time.Duration(0)
+	for i, p := range s.Config.Supervisor.Policies {
+		policies[i] = p.WithDefaults()
+		if w := time.Duration(policies[i].WindowMinutes) * time.Minute; w > maxWindow {
+			maxWindow = w
+		}
+	}
+
+	devices, err := s.DB.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	tags := s.deviceTags()
+
+	// Devices in scope of a policy, and everything sharing their subnet
+	inScope := map[uint]bool{}
+	subnets := map[string]bool{}
+	for _, d := range devices {
+		for _, p := range policies {
+			if containsFold(tags[d.ID], p.Tag) {
+				inScope[d.ID] = true
+				subnets[subnetOf(d.IP)] = true
+			}
+		}
+	}
+	probe := []database.Device{}
+	for _, d := range devices {
+		if subnets[subnetOf(d.IP)] {
+			probe = append(probe, d)
+		}
+	}
+
+	now := time.Now()
+	reachable := s.probeDevices(shelly.WithTrafficClass(ctx, shelly.TrafficHealth), probe)
+	healthyBySubnet := map[string]int{}
+	for _, d := range probe {
+		if reachable[d.ID] {
+			healthyBySubnet[subnetOf(d.IP)]++
+		}
+	}
+
+	s.superMu.Lock()
+	if s.health == nil {
+		s.health = map[uint]*deviceHealth{}
+		s.lastRecovery = map[uint]time.Time{}
+	}
+	for _, d := range probe {
+		h, ok := s.health[d.ID]
+		if !ok {
+			h = &deviceHealth{lastReachable: d.LastSeen}
+			s.health[d.ID] = h
+		}
+		if reachable[d.ID] {
+			h.reachable = true
+			h.lastReachable = now
+		} else {
+			if h.reachable {
+				h.drops = append(h.drops, now)
+			}
+			h.reachable = false
+		}
+		// Status requests made for metrics count too: a device answering
+		// those, however slowly, is not down
+		link, lastSuccess := s.DeviceLink(d.ID)
+		h.link = link
+		if lastSuccess.After(h.lastReachable) {
+			h.lastReachable = lastSuccess
+		}
+		for len(h.drops) > 0 && now.Sub(h.drops[0]) > maxWindow {
+			h.drops = h.drops[1:]
+		}
+	}
+
+	type pending struct {
+		device *database.Device
+		policy config.RecoveryPolicy
+		reason string
+	}
+	due := []pending{}
+	// Rebooting devices that lost power does not bring them back
+	outage := s.InOutage()
+	for i := range probe {
+		device := &probe[i]
+		if !inScope[device.ID] || outage {
+			continue
+		}
+		h := s.health[device.ID]
+		for _, p := range policies {
+			if !containsFold(tags[device.ID], p.Tag) {
+				continue
+			}
+			if reason := recoveryReason(p, h, healthyBySubnet[subnetOf(device.IP)], now); reason != "" {
+				if last, ok := s.lastRecovery[device.ID]; ok && now.Sub(last) < time.Duration(p.CooldownMinutes)*time.Minute {
+					break
+				}
+				due = append(due, pending{device: device, policy: p, reason: reason})
+				break
+			}
+		}
+	}
+	if !dryRun {
+		for _, d := range due {
+			s.lastRecovery[d.device.ID] = now
+		}
+	}
+	s.superMu.Unlock()
+
+	actions := []database.RecoveryAction{}
+	for _, d := range due {
+		action := database.RecoveryAction{
+			DeviceID:  d.device.ID,
+			Policy:    d.policy.Name,
+			Action:    d.policy.Action,
+			Reason:    d.reason,
+			DryRun:    dryRun,
+			CreatedAt: now,
+		}
+		if !dryRun {
+			if err := s.takeRecoveryAction(ctx, d.device, d.policy); err != nil {
+				action.Error = err.Error()
+			} else {
+				action.Success = true
+			}
+			s.recordRecoveryAction(&action)
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// recoveryReason returns why a policy applies to a device, or "" when it does not
+func recoveryReason(p config.RecoveryPolicy, h *deviceHealth, healthyNeighbours int, now time.Time) string {
+	switch p.Action {
+	case config.RecoveryActionReboot:
+		down := now.Sub(h.lastReachable)
+		if h.reachable || h.lastReachable.IsZero() || down < time.Duration(p.UnreachableMinutes)*time.Minute {
+			return ""
+		}
+		// Slow but alive: a reboot does not fix the network
+		if h.link == LinkSlow || h.link == LinkLossy {
+			return ""
+		}
+		if healthyNeighbours < p.HealthyNeighbours {
+			return ""
+		}
+		return fmt.Sprintf("unreachable for %s while %d neighbour(s) respond", down.Round(time.Minute), healthyNeighbours)
+	case config.RecoveryActionWiFiRoaming:
+		if !h.reachable {
+			return ""
+		}
+		window := now.Add(-time.Duration(p.WindowMinutes) * time.Minute)
+		recent := 0
+		for _, t := range h.drops {
+			if t.After(window) {
+				recent++
+			}
+		}
+		if recent < p.Disconnects {
+			return ""
+		}
+		return fmt.Sprintf("%d disconnects in %d minutes", recent, p.WindowMinutes)
+	}
+	return ""
+}
+
+// takeRecoveryAction performs a policy action using the device's stored credentials
+func (s *ShellyService) takeRecoveryAction(ctx context.Context, device *database.Device, p config.RecoveryPolicy) error {
+	client, err := s.getClient(device)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+
+	switch p.Action {
+	case config.RecoveryActionReboot:
+		s.expectReboot(device.ID)
+		return client.Reboot(ctx)
+	case config.RecoveryActionWiFiRoaming:
+		roamer, ok := client.(apRoamer)
+		if !ok || client.GetGeneration() != 1 {
+			return fmt.Errorf("AP roaming is only supported on Gen1 devices")
+		}
+		if err := roamer.SetAPRoaming(ctx, true, p.RoamingThreshold); err != nil {
+			return err
+		}
+		s.superMu.Lock()
+		if h := s.health[device.ID]; h != nil {
+			h.drops = nil
+		}
+		s.superMu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("unknown recovery action: %s", p.Action)
+}
+
+// recordRecoveryAction writes a recovery action to the audit log
+func (s *ShellyService) recordRecoveryAction(action *database.RecoveryAction) {
+	fields := map[string]any{
+		"device_id": action.DeviceID,
+		"policy":    action.Policy,
+		"action":    action.Action,
+		"reason":    action.Reason,
+		"success":   action.Success,
+		"component": "supervisor",
+	}
+	if action.Error != "" {
+		fields["error"] = action.Error
+	}
+	s.logger.WithFields(fields).Warn("Supervisor recovery action taken")
+
+	if db := s.DB.GetDB(); db != nil {
+		if err := db.Create(action).Error; err != nil {
+			s.logger.WithFields(map[string]any{
+				"device_id": action.DeviceID,
+				"error":     err.Error(),
+				"component": "supervisor",
+			}).Error("Failed to record recovery action")
+		}
+	}
+}
+
+// RecoveryActions returns recorded recovery actions, newest first. A zero
+// deviceID returns actions for every device.
+func (s *ShellyService) RecoveryActions(deviceID uint, limit int) ([]database.RecoveryAction, error) {
+	actions := []database.RecoveryAction{}
+	db := s.DB.GetDB()
+	if db == nil {
+		return actions, nil
+	}
+	query := db.Order("created_at DESC, id DESC")
+	if deviceID != 0 {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&actions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load recovery actions: %w", err)
+	}
+	return actions, nil
+}
+
+// probeDevices checks which devices answer a status request
+func (s *ShellyService) probeDevices(ctx context.Context, devices []database.Device) map[uint]bool {
+	reachable := make(map[uint]bool, len(devices))
+	var mu sync.Mutex
+	fanOut(s.pollWorkers(supervisorProbeWorkers), len(devices), func(i int) {
+		device := &devices[i]
+		ok := s.recoveryPause(ctx) && s.probeDevice(ctx, device)
+		mu.Lock()
+		reachable[device.ID] = ok
+		mu.Unlock()
+	})
+	return reachable
+}
+
+// probeDevice reports whether a device answers a status request
+func (s *ShellyService) probeDevice(ctx context.Context, device *database.Device) bool {
+	client, err := s.getClient(device)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	status, err := s.readStatus(ctx, client, device)
+	if err != nil {
+		return false
+	}
+	s.recordPower(device.ID, status)
+	s.recordUptime(device.ID, status)
+	s.recordProtection(device.ID, status)
+	s.recordEnergy(device.ID, status)
+	return true
+}
+
+// subnetOf returns the /24 prefix of an IPv4 address, or the address itself
+func subnetOf(ip string) string {
+	if i := strings.LastIndex(ip, "."); i >= 0 {
+		return ip[:i]
+	}
+	return ip
+}
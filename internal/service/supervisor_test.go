@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+func TestShellyService_SuperviseOnce(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	server := createMockShellyServer()
+	defer server.Close()
+
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	cfg.DeviceClient.Timeout = config.IntPtr(1)
+	cfg.DeviceClient.RetryAttempts = config.IntPtr(1)
+	cfg.DeviceClient.RetryDelay = config.IntPtr(1)
+	cfg.Supervisor.Policies = []config.RecoveryPolicy{
+		{Name: "reboot-critical", Tag: "critical", Action: config.RecoveryActionReboot},
+		{Name: "roam-flaky", Tag: "flaky", Action: config.RecoveryActionWiFiRoaming, Disconnects: 2},
+	}
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	// The healthy neighbour answers; the hung device shares its subnet
+	neighbour := createTestDevice(t, db, server.URL[len("http://"):])
+	hung := &database.Device{IP: "127.0.0.1:1", MAC: "68C63A000051", Name: "hung", Status: "online",
+		LastSeen: time.Now().Add(-time.Hour), Settings: `{"model":"SHSW-1","gen":1}`}
+	if err := db.AddDevice(hung); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	if err := db.AddDeviceTag(hung.ID, "critical"); err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+
+	actions, err := service.SuperviseOnce(context.Background(), true)
+	if err != nil {
+		t.Fatalf("SuperviseOnce failed: %v", err)
+	}
+	if len(actions) != 1 || actions[0].DeviceID != hung.ID || actions[0].Action != config.RecoveryActionReboot || !actions[0].DryRun {
+		t.Fatalf("Unexpected dry-run actions: %+v", actions)
+	}
+	if logged, _ := service.RecoveryActions(0, 0); len(logged) != 0 {
+		t.Fatalf("Dry run must not be audit-logged, got %+v", logged)
+	}
+
+	// The reboot is attempted and audit-logged even though it fails
+	if actions, _ = service.SuperviseOnce(context.Background(), false); len(actions) != 1 || actions[0].Success {
+		t.Fatalf("Unexpected actions: %+v", actions)
+	}
+	if logged, _ := service.RecoveryActions(hung.ID, 10); len(logged) != 1 || logged[0].Policy != "reboot-critical" {
+		t.Fatalf("Expected one audit record, got %+v", logged)
+	}
+	if actions, _ = service.SuperviseOnce(context.Background(), false); len(actions) != 0 {
+		t.Errorf("Expected cooldown to suppress repeated action, got %+v", actions)
+	}
+
+	// Repeated drop-outs of a reachable Gen1 device trigger AP roaming
+	if err := db.AddDeviceTag(neighbour.ID, "flaky"); err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+	service.superMu.Lock()
+	service.health[neighbour.ID].drops = []time.Time{time.Now().Add(-10 * time.Minute), time.Now().Add(-5 * time.Minute)}
+	service.superMu.Unlock()
+	actions, _ = service.SuperviseOnce(context.Background(), true)
+	if len(actions) != 1 || actions[0].DeviceID != neighbour.ID || actions[0].Action != config.RecoveryActionWiFiRoaming {
+		t.Errorf("Expected AP roaming action, got %+v", actions)
+	}
+}
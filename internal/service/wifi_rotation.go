@@ -0,0 +1,621 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+const (
+	// defaultWiFiVerifyTimeout is how long a device may take to reappear
+	// after its credentials were changed
+	defaultWiFiVerifyTimeout = 90 * time.Second
+	// maxWiFiRotations bounds the rotations kept
+	maxWiFiRotations = 20
+)
+
+// wifiVerifyInterval is the delay between probes while waiting for a device
+// to reappear; tests shorten it
+var wifiVerifyInterval = 3 * time.Second
+
+// Wi-Fi rotation states
+const (
+	WiFiRotationStaged    = "staged"
+	WiFiRotationRunning   = "running"
+	WiFiRotationCompleted = "completed"
+)
+
+// Per-device Wi-Fi rotation states
+const (
+	WiFiDevicePending   = "pending"
+	WiFiDeviceVerified  = "verified"  // back on the network with the new SSID
+	WiFiDeviceStraggler = "straggler" // credentials pushed but the device did not reappear
+	WiFiDeviceFailed    = "failed"    // push rejected; the device keeps its old credentials
+	WiFiDeviceRescuing  = "rescuing"  // a provisioning agent re-provisions it from AP mode
+	WiFiDeviceRescued   = "rescued"   // the provisioning agent reported success
+)
+
+var (
+	// ErrWiFiRotationNotFound is returned for unknown rotation IDs
+	ErrWiFiRotationNotFound = errors.New("wifi rotation not found")
+	// ErrInvalidWiFiRotation wraps rotation validation and state errors
+	ErrInvalidWiFiRotation = errors.New("invalid wifi rotation")
+)
+
+// WiFiRotationRequest stages new station credentials for a set of devices
+type WiFiRotationRequest struct {
+	SSID          string `json:"ssid"`
+	Password      string `json:"password"`
+	DeviceIDs     []uint `json:"device_ids,omitempty"`     // empty selects every device
+	Tag           string `json:"tag,omitempty"`            // restrict to devices carrying this tag
+	VerifyTimeout int    `json:"verify_timeout,omitempty"` // seconds, defaults to 90
+}
+
+// WiFiRotationDevice tracks the rollout on one device
+type WiFiRotationDevice struct {
+	DeviceID     uint       `json:"device_id"`
+	Name         string     `json:"name"`
+	IP           string     `json:"ip"`
+	MAC          string     `json:"mac"`
+	State        string     `json:"state"`
+	Error        string     `json:"error,omitempty"`
+	PushedAt     *time.Time `json:"pushed_at,omitempty"`
+	VerifiedAt   *time.Time `json:"verified_at,omitempty"`
+	RescueTaskID string     `json:"rescue_task_id,omitempty"`
+}
+
+// WiFiRotation is a staged or running Wi-Fi credential rollout. The
+// password is stored encrypted with the rotation and never returned.
+type WiFiRotation struct {
+	ID            string               `json:"id"`
+	Status        string               `json:"status"`
+	SSID          string               `json:"ssid"`
+	Password      string               `json:"-"`
+	VerifyTimeout int                  `json:"verify_timeout"`
+	Devices       []WiFiRotationDevice `json:"devices"`
+	Summary       map[string]int       `json:"summary"`
+	CreatedAt     time.Time            `json:"created_at"`
+	StartedAt     *time.Time           `json:"started_at,omitempty"`
+	CompletedAt   *time.Time           `json:"completed_at,omitempty"`
+	RequestID     string               `json:"request_id,omitempty"` // request that last started the rollout
+}
+
+// StageWiFiRotation validates new credentials and records the devices that
+// must receive them. Nothing is pushed until StartWiFiRotation.
+func (s *ShellyService) StageWiFiRotation(req WiFiRotationRequest) (*WiFiRotation, error) {
+	if req.SSID == "" || len(req.SSID) > 32 {
+		return nil, fmt.Errorf("%w: ssid must be 1-32 characters", ErrInvalidWiFiRotation)
+	}
+	if req.Password != "" && (len(req.Password) < 8 || len(req.Password) > 63) {
+		return nil, fmt.Errorf("%w: password must be 8-63 characters", ErrInvalidWiFiRotation)
+	}
+	if req.VerifyTimeout < 0 {
+		return nil, fmt.Errorf("%w: verify_timeout must not be negative", ErrInvalidWiFiRotation)
+	}
+	timeout := req.VerifyTimeout
+	if timeout == 0 {
+		timeout = int(defaultWiFiVerifyTimeout.Seconds())
+	}
+
+	devices, err := s.SelectDevices(req.DeviceIDs, req.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	rotation := &WiFiRotation{
+		ID:            uuid.New().String(),
+		Status:        WiFiRotationStaged,
+		SSID:          req.SSID,
+		Password:      req.Password,
+		VerifyTimeout: timeout,
+		Devices:       []WiFiRotationDevice{},
+		CreatedAt:     time.Now(),
+	}
+	for _, d := range devices {
+		rotation.Devices = append(rotation.Devices, WiFiRotationDevice{
+			DeviceID: d.ID, Name: d.Name, IP: d.IP, MAC: d.MAC, State: WiFiDevicePending,
+		})
+	}
+	if len(rotation.Devices) == 0 {
+		return nil, fmt.Errorf("%w: no devices selected", ErrInvalidWiFiRotation)
+	}
+	// Devices reaching the network through another device get the new
+	// credentials before it, while they can still be reached
+	if err := s.orderRotationByDependency(rotation); err != nil {
+		return nil, err
+	}
+	rotation.summarize()
+
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	s.loadRotations()
+	s.rotations = append(s.rotations, rotation)
+	if len(s.rotations) > maxWiFiRotations {
+		s.rotations = s.rotations[len(s.rotations)-maxWiFiRotations:]
+	}
+	s.saveRotation(rotation)
+	s.pruneRotations()
+
+	s.logger.WithFields(map[string]any{
+		"rotation_id": rotation.ID,
+		"ssid":        rotation.SSID,
+		"devices":     len(rotation.Devices),
+		"component":   "service",
+	}).Info("Wi-Fi credential rotation staged")
+	return rotation.snapshot(), nil
+}
+
+// orderRotationByDependency moves upstream devices after their dependents
+func (s *ShellyService) orderRotationByDependency(rotation *WiFiRotation) error {
+	ids := make([]uint, len(rotation.Devices))
+	byID := make(map[uint]WiFiRotationDevice, len(rotation.Devices))
+	for i, d := range rotation.Devices {
+		ids[i] = d.DeviceID
+		byID[d.DeviceID] = d
+	}
+	waves, err := s.DependencyWaves(ids)
+	if err != nil {
+		return err
+	}
+	rotation.Devices = rotation.Devices[:0]
+	for _, wave := range waves {
+		for _, id := range wave {
+			rotation.Devices = append(rotation.Devices, byID[id])
+		}
+	}
+	return nil
+}
+
+// ListWiFiRotations returns snapshots of the rotations kept, newest first
+func (s *ShellyService) ListWiFiRotations() []*WiFiRotation {
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	s.loadRotations()
+	list := make([]*WiFiRotation, 0, len(s.rotations))
+	for i := len(s.rotations) - 1; i >= 0; i-- {
+		list = append(list, s.rotations[i].snapshot())
+	}
+	return list
+}
+
+// GetWiFiRotation returns a snapshot of one rotation
+func (s *ShellyService) GetWiFiRotation(id string) (*WiFiRotation, error) {
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	rotation := s.findRotation(id)
+	if rotation == nil {
+		return nil, ErrWiFiRotationNotFound
+	}
+	return rotation.snapshot(), nil
+}
+
+// StartWiFiRotation pushes the staged credentials in the background, one
+// device at a time, waiting for each device to reappear with the new SSID
+// before moving on. Pending and failed devices are (re)tried, so starting a
+// completed rotation again retries devices whose push was rejected. The
+// rollout is logged under the request ID of ctx.
+func (s *ShellyService) StartWiFiRotation(ctx context.Context, id string) (*WiFiRotation, error) {
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	rotation := s.findRotation(id)
+	if rotation == nil {
+		return nil, ErrWiFiRotationNotFound
+	}
+	if rotation.Status == WiFiRotationRunning {
+		return nil, fmt.Errorf("%w: rotation is already running", ErrInvalidWiFiRotation)
+	}
+	for _, r := range s.rotations {
+		if r.Status == WiFiRotationRunning {
+			return nil, fmt.Errorf("%w: rotation %s is running", ErrInvalidWiFiRotation, r.ID)
+		}
+	}
+
+	now := time.Now()
+	rotation.Status = WiFiRotationRunning
+	rotation.StartedAt = &now
+	rotation.CompletedAt = nil
+	rotation.RequestID = logging.GetRequestID(ctx)
+	s.saveRotation(rotation)
+	go s.runWiFiRotation(s.jobContext(ctx), rotation)
+	return rotation.snapshot(), nil
+}
+
+// runWiFiRotation pushes and verifies each device in turn
+func (s *ShellyService) runWiFiRotation(ctx context.Context, rotation *WiFiRotation) {
+	s.rotationMu.Lock()
+	devices := append([]WiFiRotationDevice(nil), rotation.Devices...)
+	s.rotationMu.Unlock()
+	timeout := time.Duration(rotation.VerifyTimeout) * time.Second
+
+	for i, d := range devices {
+		if d.State != WiFiDevicePending && d.State != WiFiDeviceFailed {
+			continue
+		}
+		d.Error = ""
+		d.PushedAt = nil
+		if err := ctx.Err(); err != nil {
+			d.State = WiFiDeviceFailed
+			d.Error = err.Error()
+		} else if err := s.pushWiFiCredentials(ctx, d.DeviceID, rotation.SSID, rotation.Password); err != nil {
+			d.State = WiFiDeviceFailed
+			d.Error = err.Error()
+		} else {
+			pushed := time.Now()
+			d.PushedAt = &pushed
+			if s.waitForWiFi(ctx, d.DeviceID, rotation.SSID, timeout) {
+				verified := time.Now()
+				d.State = WiFiDeviceVerified
+				d.VerifiedAt = &verified
+			} else {
+				d.State = WiFiDeviceStraggler
+				d.Error = fmt.Sprintf("device did not reappear on %q within %s", rotation.SSID, timeout)
+			}
+		}
+
+		s.rotationMu.Lock()
+		rotation.Devices[i] = d
+		rotation.summarize()
+		s.saveRotation(rotation)
+		s.rotationMu.Unlock()
+
+		s.logger.WithContext(ctx).WithFields(map[string]any{
+			"rotation_id": rotation.ID,
+			"device_id":   d.DeviceID,
+			"state":       d.State,
+			"error":       d.Error,
+			"component":   "service",
+		}).Info("Wi-Fi credentials rolled out to device")
+	}
+
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	now := time.Now()
+	rotation.Status = WiFiRotationCompleted
+	rotation.CompletedAt = &now
+	rotation.summarize()
+	s.saveRotation(rotation)
+	s.logger.WithContext(ctx).WithFields(map[string]any{
+		"rotation_id": rotation.ID,
+		"summary":     rotation.Summary,
+		"component":   "service",
+	}).Info("Wi-Fi credential rotation completed")
+}
+
+// pushWiFiCredentials sets the station SSID and password on one device
+func (s *ShellyService) pushWiFiCredentials(ctx context.Context, deviceID uint, ssid, password string) error {
+	device, err := s.DB.WithContext(ctx).GetDevice(deviceID)
+	if err != nil {
+		return fmt.Errorf("%w: %d", ErrDeviceNotFound, deviceID)
+	}
+	client, err := s.getClient(device)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	setter, ok := client.(wifiSetter)
+	if !ok {
+		return fmt.Errorf("device client does not support Wi-Fi settings")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	if client.GetGeneration() == 1 {
+		return setter.SetWiFiConfig(ctx, map[string]interface{}{"enabled": true, "ssid": ssid, "key": password})
+	}
+	return setter.SetWiFiConfig(ctx, map[string]interface{}{
+		"sta": map[string]interface{}{"enable": true, "ssid": ssid, "pass": password},
+	})
+}
+
+// wifiSetter is implemented by device clients that can change station settings
+type wifiSetter interface {
+	SetWiFiConfig(ctx context.Context, config map[string]interface{}) error
+}
+
+// waitForWiFi probes the device until it reports the new SSID or the timeout
+// passes
+func (s *ShellyService) waitForWiFi(ctx context.Context, deviceID uint, ssid string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if s.probeWiFi(ctx, deviceID, ssid) {
+			return true
+		}
+		if time.Now().Add(wifiVerifyInterval).After(deadline) {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wifiVerifyInterval):
+		}
+	}
+}
+
+// probeWiFi reports whether the device answers and, where it reports its
+// station SSID, is connected to ssid
+func (s *ShellyService) probeWiFi(ctx context.Context, deviceID uint, ssid string) bool {
+	device, err := s.DB.WithContext(ctx).GetDevice(deviceID)
+	if err != nil {
+		return false
+	}
+	client, err := s.getClient(device)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.deviceClientSettings(device).ControlTimeoutDuration())
+	defer cancel()
+	status, err := client.GetStatus(ctx)
+	if err != nil {
+		return false
+	}
+	if status.WiFiStatus == nil || status.WiFiStatus.SSID == "" {
+		return true
+	}
+	return status.WiFiStatus.SSID == ssid
+}
+
+// VerifyWiFiRotation probes stragglers and rescued devices once and marks
+// those back on the new network as verified
+func (s *ShellyService) VerifyWiFiRotation(ctx context.Context, id string) (*WiFiRotation, error) {
+	s.rotationMu.Lock()
+	rotation := s.findRotation(id)
+	if rotation == nil {
+		s.rotationMu.Unlock()
+		return nil, ErrWiFiRotationNotFound
+	}
+	if rotation.Status != WiFiRotationCompleted {
+		s.rotationMu.Unlock()
+		return nil, fmt.Errorf("%w: rotation is %s", ErrInvalidWiFiRotation, rotation.Status)
+	}
+	devices := append([]WiFiRotationDevice(nil), rotation.Devices...)
+	ssid := rotation.SSID
+	s.rotationMu.Unlock()
+
+	verified := map[uint]time.Time{}
+	for _, d := range devices {
+		switch d.State {
+		case WiFiDeviceStraggler, WiFiDeviceRescuing, WiFiDeviceRescued:
+			if s.probeWiFi(ctx, d.DeviceID, ssid) {
+				verified[d.DeviceID] = time.Now()
+			}
+		}
+	}
+
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	for i := range rotation.Devices {
+		if at, ok := verified[rotation.Devices[i].DeviceID]; ok {
+			rotation.Devices[i].State = WiFiDeviceVerified
+			rotation.Devices[i].Error = ""
+			rotation.Devices[i].VerifiedAt = &at
+		}
+	}
+	rotation.summarize()
+	s.saveRotation(rotation)
+	return rotation.snapshot(), nil
+}
+
+// WiFiRescueFunc hands a straggler to a provisioning agent, which
+// re-provisions it from AP mode with the given credentials, and returns the
+// agent task ID
+type WiFiRescueFunc func(device WiFiRotationDevice, ssid, password string) (string, error)
+
+// RescueWiFiStragglers enqueues a provisioning task for every straggler of a
+// completed rotation. Devices that do not reappear usually fall back to AP
+// mode, where only a provisioning agent can reach them.
+func (s *ShellyService) RescueWiFiStragglers(id string, enqueue WiFiRescueFunc) (*WiFiRotation, error) {
+	s.rotationMu.Lock()
+	rotation := s.findRotation(id)
+	if rotation == nil {
+		s.rotationMu.Unlock()
+		return nil, ErrWiFiRotationNotFound
+	}
+	if rotation.Status != WiFiRotationCompleted {
+		s.rotationMu.Unlock()
+		return nil, fmt.Errorf("%w: rotation is %s", ErrInvalidWiFiRotation, rotation.Status)
+	}
+	stragglers := []WiFiRotationDevice{}
+	for _, d := range rotation.Devices {
+		if d.State == WiFiDeviceStraggler {
+			stragglers = append(stragglers, d)
+		}
+	}
+	ssid, password := rotation.SSID, rotation.Password
+	s.rotationMu.Unlock()
+
+	// Enqueue without holding rotationMu: agents report back through
+	// CompleteWiFiRescue while the task registry is locked
+	taskIDs := map[uint]string{}
+	failures := map[uint]string{}
+	for _, d := range stragglers {
+		taskID, err := enqueue(d, ssid, password)
+		if err != nil {
+			failures[d.DeviceID] = fmt.Sprintf("failed to enqueue rescue: %v", err)
+			continue
+		}
+		taskIDs[d.DeviceID] = taskID
+	}
+
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	for i := range rotation.Devices {
+		d := &rotation.Devices[i]
+		if d.State != WiFiDeviceStraggler {
+			continue
+		}
+		if taskID, ok := taskIDs[d.DeviceID]; ok {
+			d.State = WiFiDeviceRescuing
+			d.RescueTaskID = taskID
+			d.Error = ""
+		} else if msg, ok := failures[d.DeviceID]; ok {
+			d.Error = msg
+		}
+	}
+	rotation.summarize()
+	s.saveRotation(rotation)
+
+	s.logger.WithFields(map[string]any{
+		"rotation_id": rotation.ID,
+		"rescuing":    len(taskIDs),
+		"failed":      len(failures),
+		"component":   "service",
+	}).Info("Wi-Fi rotation stragglers handed to provisioning agents")
+	return rotation.snapshot(), nil
+}
+
+// CompleteWiFiRescue records the outcome of a rescue task reported by a
+// provisioning agent. Unknown task IDs are ignored.
+func (s *ShellyService) CompleteWiFiRescue(taskID string, success bool, message string) {
+	s.rotationMu.Lock()
+	defer s.rotationMu.Unlock()
+	s.loadRotations()
+	for _, rotation := range s.rotations {
+		for i := range rotation.Devices {
+			d := &rotation.Devices[i]
+			if d.RescueTaskID != taskID || d.State != WiFiDeviceRescuing {
+				continue
+			}
+			if success {
+				d.State = WiFiDeviceRescued
+				d.Error = ""
+			} else {
+				d.State = WiFiDeviceStraggler
+				d.Error = "rescue failed: " + message
+			}
+			rotation.summarize()
+			s.saveRotation(rotation)
+			return
+		}
+	}
+}
+
+// findRotation returns the rotation with the given ID; callers hold rotationMu
+func (s *ShellyService) findRotation(id string) *WiFiRotation {
+	s.loadRotations()
+	for _, r := range s.rotations {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// loadRotations reads the kept rotations from the database once. A rotation
+// that was running when the manager stopped is completed, with the devices
+// it had not reached marked failed, so starting it again retries them.
+// Callers hold rotationMu.
+func (s *ShellyService) loadRotations() {
+	if s.rotationsLoaded || s.DB == nil {
+		return
+	}
+	s.rotationsLoaded = true
+
+	var rows []database.WiFiRotationState
+	if err := s.DB.GetDB().Order("created_at DESC, id DESC").Limit(maxWiFiRotations).Find(&rows).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"error":     err.Error(),
+			"component": "service",
+		}).Warn("Failed to load Wi-Fi rotations")
+		return
+	}
+	loaded := make([]*WiFiRotation, 0, len(rows))
+	for i := len(rows) - 1; i >= 0; i-- {
+		var rotation WiFiRotation
+		if err := json.Unmarshal(rows[i].State, &rotation); err != nil {
+			s.logger.WithFields(map[string]any{
+				"rotation_id": rows[i].RotationID,
+				"error":       err.Error(),
+				"component":   "service",
+			}).Warn("Skipping unreadable Wi-Fi rotation")
+			continue
+		}
+		rotation.Password = rows[i].Password
+		if rotation.Status == WiFiRotationRunning {
+			now := time.Now()
+			for j := range rotation.Devices {
+				if rotation.Devices[j].State == WiFiDevicePending {
+					rotation.Devices[j].State = WiFiDeviceFailed
+					rotation.Devices[j].Error = "rollout interrupted by a restart"
+				}
+			}
+			rotation.Status = WiFiRotationCompleted
+			rotation.CompletedAt = &now
+			rotation.summarize()
+			s.saveRotation(&rotation)
+		}
+		loaded = append(loaded, &rotation)
+	}
+	s.rotations = append(loaded, s.rotations...)
+}
+
+// saveRotation writes a rotation to the database. The password is only
+// written when the rotation is first stored. Callers hold rotationMu.
+func (s *ShellyService) saveRotation(rotation *WiFiRotation) {
+	if s.DB == nil {
+		return
+	}
+	state, err := json.Marshal(rotation)
+	if err == nil {
+		db := s.DB.GetDB()
+		result := db.Model(&database.WiFiRotationState{}).Where("rotation_id = ?", rotation.ID).Update("state", state)
+		err = result.Error
+		if err == nil && result.RowsAffected == 0 {
+			err = db.Create(&database.WiFiRotationState{
+				RotationID: rotation.ID,
+				Password:   rotation.Password,
+				State:      state,
+				CreatedAt:  rotation.CreatedAt,
+			}).Error
+		}
+	}
+	if err != nil {
+		s.logger.WithFields(map[string]any{
+			"rotation_id": rotation.ID,
+			"error":       err.Error(),
+			"component":   "service",
+		}).Warn("Failed to save Wi-Fi rotation")
+	}
+}
+
+// pruneRotations deletes the stored rotations no longer kept. Callers hold
+// rotationMu.
+func (s *ShellyService) pruneRotations() {
+	if s.DB == nil || len(s.rotations) < maxWiFiRotations {
+		return
+	}
+	ids := make([]string, len(s.rotations))
+	for i, r := range s.rotations {
+		ids[i] = r.ID
+	}
+	if err := s.DB.GetDB().Where("rotation_id NOT IN ?", ids).Delete(&database.WiFiRotationState{}).Error; err != nil {
+		s.logger.WithFields(map[string]any{
+			"error":     err.Error(),
+			"component": "service",
+		}).Warn("Failed to prune Wi-Fi rotations")
+	}
+}
+
+// summarize counts devices per state; callers hold rotationMu
+func (r *WiFiRotation) summarize() {
+	r.Summary = map[string]int{}
+	for _, d := range r.Devices {
+		r.Summary[d.State]++
+	}
+}
+
+// snapshot copies a rotation; callers hold rotationMu
+func (r *WiFiRotation) snapshot() *WiFiRotation {
+	c := *r
+	c.Devices = append([]WiFiRotationDevice(nil), r.Devices...)
+	c.Summary = make(map[string]int, len(r.Summary))
+	for k, v := range r.Summary {
+		c.Summary[k] = v
+	}
+	return &c
+}
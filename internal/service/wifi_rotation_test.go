@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/config"
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// newWiFiMockServer emulates a Gen1 device; with join set it reports the SSID
+// last written to /settings/sta, otherwise it stays on its old network
+func newWiFiMockServer(mac string, join bool) *httptest.Server {
+	var mu sync.Mutex
+	ssid := "OldNetwork"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/shelly", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"type": "SHSW-1", "mac": %q, "auth": false, "fw": "1.14.0"}`, mac)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"wifi_sta": {"connected": true, "ssid": %q, "ip": "192.168.1.100"}}`, ssid)
+	})
+	mux.HandleFunc("/settings/sta", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if join {
+			mu.Lock()
+			ssid = r.Form.Get("ssid")
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"enabled": true}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestShellyService_WiFiRotation(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	defer func(d time.Duration) { wifiVerifyInterval = d }(wifiVerifyInterval)
+	wifiVerifyInterval = 10 * time.Millisecond
+
+	joining := newWiFiMockServer("68C63A000001", true)
+	defer joining.Close()
+	stuck := newWiFiMockServer("68C63A000002", false)
+	defer stuck.Close()
+
+	db := createTestDB(t)
+	cfg := createTestConfigBusiness()
+	cfg.DeviceClient.Timeout = config.IntPtr(1)
+	cfg.DeviceClient.RetryAttempts = config.IntPtr(1)
+	cfg.DeviceClient.RetryDelay = config.IntPtr(1)
+	service := NewService(db, cfg)
+	defer service.Stop()
+
+	for i, d := range []*database.Device{
+		{IP: joining.URL[len("http://"):], MAC: "68C63A000001", Name: "kitchen", Settings: `{"model":"SHSW-1","gen":1}`},
+		{IP: stuck.URL[len("http://"):], MAC: "68C63A000002", Name: "garage", Settings: `{"model":"SHSW-1","gen":1}`},
+		{IP: "127.0.0.1:1", MAC: "68C63A000003", Name: "porch", Settings: `{"model":"SHSW-1","gen":1}`},
+	} {
+		if err := db.AddDevice(d); err != nil {
+			t.Fatalf("Failed to add device %d: %v", i, err)
+		}
+	}
+
+	if _, err := service.StageWiFiRotation(WiFiRotationRequest{SSID: "NewNetwork", Password: "short"}); err == nil {
+		t.Error("Expected error for a short password")
+	}
+	staged, err := service.StageWiFiRotation(WiFiRotationRequest{SSID: "NewNetwork", Password: "correct horse", VerifyTimeout: 1})
+	if err != nil {
+		t.Fatalf("StageWiFiRotation failed: %v", err)
+	}
+	if staged.Status != WiFiRotationStaged || staged.Summary[WiFiDevicePending] != 3 {
+		t.Fatalf("Unexpected staged rotation: %+v", staged)
+	}
+
+	if _, err := service.StartWiFiRotation(context.Background(), staged.ID); err != nil {
+		t.Fatalf("StartWiFiRotation failed: %v", err)
+	}
+	var rotation *WiFiRotation
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if rotation, err = service.GetWiFiRotation(staged.ID); err != nil {
+			t.Fatalf("GetWiFiRotation failed: %v", err)
+		}
+		if rotation.Status == WiFiRotationCompleted {
+			break
+		}
+	}
+	if rotation.Status != WiFiRotationCompleted {
+		t.Fatalf("Rotation did not complete: %+v", rotation)
+	}
+	states := map[string]string{}
+	for _, d := range rotation.Devices {
+		states[d.Name] = d.State
+	}
+	if states["kitchen"] != WiFiDeviceVerified || states["garage"] != WiFiDeviceStraggler || states["porch"] != WiFiDeviceFailed {
+		t.Fatalf("Unexpected device states: %v", states)
+	}
+
+	var rescued []string
+	rotation, err = service.RescueWiFiStragglers(staged.ID, func(d WiFiRotationDevice, ssid, password string) (string, error) {
+		if ssid != "NewNetwork" || password != "correct horse" {
+			t.Errorf("Unexpected rescue credentials %q/%q", ssid, password)
+		}
+		rescued = append(rescued, d.MAC)
+		return "task_1", nil
+	})
+	if err != nil {
+		t.Fatalf("RescueWiFiStragglers failed: %v", err)
+	}
+	if len(rescued) != 1 || rescued[0] != "68C63A000002" || rotation.Summary[WiFiDeviceRescuing] != 1 {
+		t.Fatalf("Unexpected rescue: %v %+v", rescued, rotation.Summary)
+	}
+
+	service.CompleteWiFiRescue("task_1", true, "")
+	rotation, _ = service.GetWiFiRotation(staged.ID)
+	if rotation.Summary[WiFiDeviceRescued] != 1 {
+		t.Errorf("Expected rescued device, got %+v", rotation.Summary)
+	}
+
+	if _, err := service.VerifyWiFiRotation(context.Background(), "unknown"); err != ErrWiFiRotationNotFound {
+		t.Errorf("Expected ErrWiFiRotationNotFound, got %v", err)
+	}
+
+	// Rotations survive a restart, with their password
+	restarted := NewService(db, cfg)
+	defer restarted.Stop()
+	rotation, err = restarted.GetWiFiRotation(staged.ID)
+	if err != nil || rotation.Summary[WiFiDeviceRescued] != 1 || rotation.Summary[WiFiDeviceVerified] != 1 {
+		t.Fatalf("Expected the rotation restored, got %+v (%v)", rotation, err)
+	}
+	restarted.rotationMu.Lock()
+	password := restarted.findRotation(staged.ID).Password
+	restarted.rotationMu.Unlock()
+	if password != "correct horse" {
+		t.Errorf("Expected the password restored, got %q", password)
+	}
+
+	// A rollout interrupted by a restart is completed with its devices failed
+	interrupted, err := restarted.StageWiFiRotation(WiFiRotationRequest{SSID: "NewNetwork", Password: "correct horse", DeviceIDs: []uint{1}})
+	if err != nil {
+		t.Fatalf("StageWiFiRotation failed: %v", err)
+	}
+	restarted.rotationMu.Lock()
+	running := restarted.findRotation(interrupted.ID)
+	running.Status = WiFiRotationRunning
+	restarted.saveRotation(running)
+	restarted.rotationMu.Unlock()
+
+	again := NewService(db, cfg)
+	defer again.Stop()
+	rotation, err = again.GetWiFiRotation(interrupted.ID)
+	if err != nil || rotation.Status != WiFiRotationCompleted || rotation.Summary[WiFiDeviceFailed] != 1 {
+		t.Fatalf("Expected the interrupted rotation completed with a failed device, got %+v (%v)", rotation, err)
+	}
+	if list := again.ListWiFiRotations(); len(list) != 2 || list[0].ID != interrupted.ID {
+		t.Errorf("Expected both rotations newest first, got %d", len(list))
+	}
+}
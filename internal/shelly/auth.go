@@ -0,0 +1,285 @@
+package shelly
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAuthUser is the user of devices whose credentials name none. It is
+// the only user Gen2+ devices know and the factory default of Gen1.
+const DefaultAuthUser = "admin"
+
+// Authentication schemes detected by HTTPAuth
+const (
+	AuthSchemeBasic  = "basic"
+	AuthSchemeDigest = "digest"
+)
+
+// CredentialSource returns the credentials to answer an authentication
+// challenge with. It is asked on every challenge, so credentials changed
+// after the client was created are picked up on the next re-authentication.
+// scheme is the one the device challenged with, so a source can withhold
+// credentials from Basic, which sends them in clear text.
+type CredentialSource func(scheme string) (username, password string)
+
+// HTTPAuth answers the authentication challenges of a device. The scheme is
+// taken from the challenge rather than configured: Basic for most Gen1
+// firmware, Digest with MD5 or SHA-256 for Gen2+ and some Gen1 firmware.
+// Once a device has challenged, later requests are authorized up front, with
+// the cached nonce for digest; a request rejected with a new challenge is
+// answered once more before giving up. It is safe for concurrent use.
+type HTTPAuth struct {
+	mu       sync.Mutex
+	username string
+	password string
+	source   CredentialSource
+
+	// Last challenge and the credentials it is answered with
+	scheme    string
+	user      string
+	pass      string
+	realm     string
+	nonce     string
+	qop       string
+	opaque    string
+	algorithm string
+	nc        int
+}
+
+// NewHTTPAuth creates an authenticator with static credentials and an
+// optional source consulted on every challenge, which takes precedence when
+// it returns a password
+func NewHTTPAuth(username, password string, source CredentialSource) *HTTPAuth {
+	return &HTTPAuth{
+		username: username,
+		password: password,
+		source:   source,
+	}
+}
+
+// Scheme returns the scheme the device challenged with, or an empty string
+// if it has not asked for authentication (yet)
+func (a *HTTPAuth) Scheme() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.scheme
+}
+
+// ParseChallenge parses a WWW-Authenticate header into its lower-case scheme
+// and parameters. Values may be quoted and contain commas. An empty header is
+// an error: without a challenge there is no telling which scheme the device
+// expects, and credentials are not sent blindly.
+func ParseChallenge(challenge string) (string, map[string]string, error) {
+	challenge = strings.TrimSpace(challenge)
+	if challenge == "" {
+		return "", nil, fmt.Errorf("missing authentication challenge")
+	}
+	scheme, rest, _ := strings.Cut(challenge, " ")
+	scheme = strings.ToLower(scheme)
+	if scheme != AuthSchemeBasic && scheme != AuthSchemeDigest {
+		return "", nil, fmt.Errorf("unsupported authentication scheme %q", scheme)
+	}
+
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimLeft(rest, ", ") {
+		key, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		after = strings.TrimSpace(after)
+
+		var value string
+		if strings.HasPrefix(after, `"`) {
+			end := strings.Index(after[1:], `"`)
+			if end < 0 {
+				return "", nil, fmt.Errorf("unterminated value for %s", key)
+			}
+			value, rest = after[1:end+1], after[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(after, ",")
+			value = strings.TrimSpace(value)
+		}
+		params[key] = value
+	}
+
+	if scheme == AuthSchemeDigest && (params["realm"] == "" || params["nonce"] == "") {
+		return "", nil, fmt.Errorf("incomplete digest challenge")
+	}
+	return scheme, params, nil
+}
+
+// challenge replaces the cached challenge with a new one and resolves the
+// credentials to answer it with
+func (a *HTTPAuth) challenge(header string) error {
+	scheme, params, err := ParseChallenge(header)
+	if err != nil {
+		return err
+	}
+
+	var algorithm, qop string
+	if scheme == AuthSchemeDigest {
+		algorithm = strings.ToUpper(params["algorithm"])
+		switch algorithm {
+		case "":
+			algorithm = "MD5"
+		case "MD5", "SHA-256":
+		default:
+			return fmt.Errorf("unsupported digest algorithm %q", params["algorithm"])
+		}
+
+		// Only qop=auth is supported; the body is not part of the digest
+		if offered := params["qop"]; offered != "" {
+			for _, q := range strings.Split(offered, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					qop = "auth"
+				}
+			}
+			if qop == "" {
+				return fmt.Errorf("unsupported qop %q", offered)
+			}
+		}
+	}
+
+	user, pass := a.username, a.password
+	if a.source != nil {
+		if u, p := a.source(scheme); p != "" {
+			user, pass = u, p
+		}
+	}
+	if pass == "" {
+		return ErrAuthRequired
+	}
+	if user == "" {
+		user = DefaultAuthUser
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.scheme = scheme
+	a.user, a.pass = user, pass
+	a.realm = params["realm"]
+	a.nonce = params["nonce"]
+	a.opaque = params["opaque"]
+	a.qop = qop
+	a.algorithm = algorithm
+	a.nc = 0
+	return nil
+}
+
+// generateCnonce generates a client nonce
+func generateCnonce() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		// Fallback to time-based randomness if crypto/rand fails
+		return hex.EncodeToString([]byte(fmt.Sprintf("%x", time.Now().UnixNano())))
+	}
+	return hex.EncodeToString(b)
+}
+
+// digestHex hashes data with the digest algorithm of the challenge
+func digestHex(algorithm, data string) string {
+	var h hash.Hash
+	if algorithm == "SHA-256" {
+		h = sha256.New()
+	} else {
+		h = md5.New()
+	}
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// authorize sets the Authorization header for the cached challenge. It
+// reports false when the device has not challenged yet.
+func (a *HTTPAuth) authorize(req *http.Request) bool {
+	a.mu.Lock()
+	switch a.scheme {
+	case AuthSchemeBasic:
+		req.SetBasicAuth(a.user, a.pass)
+		a.mu.Unlock()
+		return true
+	case AuthSchemeDigest:
+	default:
+		a.mu.Unlock()
+		return false
+	}
+	a.nc++
+	nc := fmt.Sprintf("%08x", a.nc)
+	user, realm, nonce, qop, opaque, algorithm := a.user, a.realm, a.nonce, a.qop, a.opaque, a.algorithm
+	ha1 := digestHex(algorithm, fmt.Sprintf("%s:%s:%s", user, realm, a.pass))
+	a.mu.Unlock()
+
+	uri := req.URL.RequestURI()
+	ha2 := digestHex(algorithm, fmt.Sprintf("%s:%s", req.Method, uri))
+	cnonce := generateCnonce()
+
+	var response string
+	if qop != "" {
+		response = digestHex(algorithm, fmt.Sprintf("%s:%s:%s:%s:%s:%s", ha1, nonce, nc, cnonce, qop, ha2))
+	} else {
+		response = digestHex(algorithm, fmt.Sprintf("%s:%s:%s", ha1, nonce, ha2))
+	}
+
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, response="%s"`,
+		user, realm, nonce, uri, algorithm, response)
+	if qop != "" {
+		auth += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	if opaque != "" {
+		auth += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+
+	req.Header.Set("Authorization", auth)
+	return true
+}
+
+// Do performs a request built by newRequest, answering an authentication
+// challenge. The request is authorized up front when the device challenged
+// before; on a 401 the new challenge is taken and the request is sent once
+// more, which covers the first request as well as expired nonces and changed
+// passwords. A 401 to that retry means the credentials were rejected and is
+// returned to the caller. Without credentials a challenge fails with
+// ErrAuthRequired.
+func (a *HTTPAuth) Do(client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	a.authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if err := a.challenge(challenge); err != nil {
+		if errors.Is(err, ErrAuthRequired) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to parse auth challenge: %w", err)
+	}
+
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
+	a.authorize(req)
+	return client.Do(req)
+}
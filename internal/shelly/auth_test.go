@@ -0,0 +1,30 @@
+package shelly
+
+import (
+	"testing"
+)
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params, err := ParseChallenge(`Digest realm="shellyplus1-test", qop="auth,auth-int", nonce="123", algorithm=SHA-256, opaque="a b"`)
+	assertNoError(t, err)
+	assertEqual(t, AuthSchemeDigest, scheme)
+	assertEqual(t, "shellyplus1-test", params["realm"])
+	assertEqual(t, "auth,auth-int", params["qop"])
+	assertEqual(t, "123", params["nonce"])
+	assertEqual(t, "SHA-256", params["algorithm"])
+	assertEqual(t, "a b", params["opaque"])
+
+	scheme, params, err = ParseChallenge(`Basic realm="shelly1-test"`)
+	assertNoError(t, err)
+	assertEqual(t, AuthSchemeBasic, scheme)
+	assertEqual(t, "shelly1-test", params["realm"])
+
+	// A 401 without a challenge does not default to Basic
+	_, _, err = ParseChallenge("")
+	assertError(t, err)
+
+	_, _, err = ParseChallenge(`Digest realm="device"`)
+	assertError(t, err)
+	_, _, err = ParseChallenge(`Bearer realm="device"`)
+	assertError(t, err)
+}
@@ -0,0 +1,185 @@
+package shelly
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operations a device may support
+const (
+	OpSwitch        = "switch"
+	OpDimming       = "dimming"
+	OpRoller        = "roller"
+	OpRGBW          = "rgbw"
+	OpPowerMetering = "power_metering"
+	OpSchedules     = "schedules"
+	OpScripts       = "scripts"
+	OpBLE           = "ble"
+)
+
+// modelFeatures are the operations of the models whose identifier starts
+// with prefix. Battery devices sleep and cannot run schedules or scripts.
+type modelFeatures struct {
+	prefix  string
+	ops     []string
+	battery bool
+}
+
+// hasOutput reports whether the model switches, dims or moves something
+func (m *modelFeatures) hasOutput() bool {
+	for _, op := range m.ops {
+		if op != OpPowerMetering {
+			return true
+		}
+	}
+	return false
+}
+
+// modelRegistry lists the known models by identifier prefix; the longest
+// matching prefix wins
+var modelRegistry = []modelFeatures{
+	// Gen1
+	{prefix: "SHSW-25", ops: []string{OpSwitch, OpRoller, OpPowerMetering}},
+	{prefix: "SHSW-PM", ops: []string{OpSwitch, OpPowerMetering}},
+	{prefix: "SHSW-", ops: []string{OpSwitch}},
+	{prefix: "SHPLG", ops: []string{OpSwitch, OpPowerMetering}},
+	{prefix: "SHDM", ops: []string{OpDimming, OpPowerMetering}},
+	{prefix: "SHRGBW2", ops: []string{OpRGBW, OpDimming, OpPowerMetering}},
+	{prefix: "SHBLB", ops: []string{OpRGBW, OpDimming}},
+	{prefix: "SHCB", ops: []string{OpRGBW, OpDimming}},
+	{prefix: "SHBDUO", ops: []string{OpDimming}},
+	{prefix: "SHVIN", ops: []string{OpDimming}},
+	{prefix: "SHEM", ops: []string{OpPowerMetering}},
+	{prefix: "SHIX3"},
+	{prefix: "SHBTN", battery: true},
+	{prefix: "SHHT", battery: true},
+	{prefix: "SHWT", battery: true},
+	{prefix: "SHDW", battery: true},
+	{prefix: "SHMOS", battery: true},
+	{prefix: "SHSM", battery: true},
+	{prefix: "SHGS"},
+
+	// Gen2 Plus and Pro
+	{prefix: "SNSW-001X", ops: []string{OpSwitch}},
+	{prefix: "SNSW-002P", ops: []string{OpSwitch, OpRoller, OpPowerMetering}},
+	{prefix: "SNSW-102P", ops: []string{OpSwitch, OpRoller, OpPowerMetering}},
+	{prefix: "SNSW-", ops: []string{OpSwitch, OpPowerMetering}},
+	{prefix: "SNPL", ops: []string{OpSwitch, OpPowerMetering}},
+	{prefix: "SNPM", ops: []string{OpPowerMetering}},
+	{prefix: "SNDC-0D4P10WW", ops: []string{OpRGBW, OpDimming, OpPowerMetering}},
+	{prefix: "SNDC", ops: []string{OpDimming}},
+	{prefix: "SNDM", ops: []string{OpDimming, OpPowerMetering}},
+	{prefix: "SNSN", battery: true},
+	{prefix: "SNBU", battery: true},
+	{prefix: "SPSW-001X", ops: []string{OpSwitch}},
+	{prefix: "SPSW-002P", ops: []string{OpSwitch, OpRoller, OpPowerMetering}},
+	{prefix: "SPSW-102P", ops: []string{OpSwitch, OpRoller, OpPowerMetering}},
+	{prefix: "SPSW-202P", ops: []string{OpSwitch, OpRoller, OpPowerMetering}},
+	{prefix: "SPSW-", ops: []string{OpSwitch, OpPowerMetering}},
+	{prefix: "SPDM", ops: []string{OpDimming, OpPowerMetering}},
+	{prefix: "SPEM", ops: []string{OpPowerMetering}},
+
+	// Gen3
+	{prefix: "S3SW-001X", ops: []string{OpSwitch}},
+	{prefix: "S3SW-002P", ops: []string{OpSwitch, OpRoller, OpPowerMetering}},
+	{prefix: "S3SW", ops: []string{OpSwitch, OpPowerMetering}},
+	{prefix: "S3PL", ops: []string{OpSwitch, OpPowerMetering}},
+	{prefix: "S3PM", ops: []string{OpPowerMetering}},
+	{prefix: "S3DM", ops: []string{OpDimming, OpPowerMetering}},
+	{prefix: "S3SN", battery: true},
+}
+
+// minScriptsFirmware is the first Gen2 firmware with scripting
+var minScriptsFirmware = [3]int{0, 9, 0}
+
+// SupportedOperations returns the operations a device supports, from its
+// model, generation and firmware version. known is false for models missing
+// from the registry; their operations are unknown and nothing should be
+// refused because of them.
+func SupportedOperations(model string, generation int, firmware string) (ops []string, known bool) {
+	match := lookupModel(model)
+	if match == nil {
+		return nil, false
+	}
+
+	ops = append([]string{}, match.ops...)
+	if !match.battery {
+		if generation >= 2 {
+			ops = append(ops, OpSchedules, OpBLE)
+			if v, ok := FirmwareVersion(firmware); !ok || !versionBefore(v, minScriptsFirmware) {
+				ops = append(ops, OpScripts)
+			}
+		} else if match.hasOutput() {
+			// Gen1 schedules switch outputs on and off
+			ops = append(ops, OpSchedules)
+		}
+	}
+	sort.Strings(ops)
+	return ops, true
+}
+
+// lookupModel returns the registry entry with the longest prefix matching
+// model, or nil
+func lookupModel(model string) *modelFeatures {
+	model = strings.ToUpper(strings.TrimSpace(model))
+	var match *modelFeatures
+	for i := range modelRegistry {
+		m := &modelRegistry[i]
+		if strings.HasPrefix(model, m.prefix) && (match == nil || len(m.prefix) > len(match.prefix)) {
+			match = m
+		}
+	}
+	return match
+}
+
+// SupportsOperation reports whether a device supports op. Devices of models
+// missing from the registry are assumed to support it.
+func SupportsOperation(model string, generation int, firmware, op string) bool {
+	ops, known := SupportedOperations(model, generation, firmware)
+	if !known {
+		return true
+	}
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// FirmwareVersion extracts major, minor and patch from a firmware string
+// such as "1.4.2", "1.0.3-geb51a17" or Gen1's
+// "20230913-112003/v1.14.0-gcb84623".
+func FirmwareVersion(firmware string) ([3]int, bool) {
+	var v [3]int
+	if i := strings.LastIndex(firmware, "/"); i >= 0 {
+		firmware = firmware[i+1:]
+	}
+	firmware = strings.TrimPrefix(strings.TrimSpace(firmware), "v")
+	if i := strings.IndexAny(firmware, "-@+ "); i >= 0 {
+		firmware = firmware[:i]
+	}
+	parts := strings.Split(firmware, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+// versionBefore reports whether version a is older than b
+func versionBefore(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
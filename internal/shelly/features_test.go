@@ -0,0 +1,53 @@
+package shelly
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSupportedOperations(t *testing.T) {
+	tests := []struct {
+		model    string
+		gen      int
+		firmware string
+		want     string
+		known    bool
+	}{
+		{"SHSW-25", 1, "20230913-112003/v1.14.0-gcb84623", "power_metering,roller,schedules,switch", true},
+		{"SHSW-1", 1, "", "schedules,switch", true},
+		{"SHEM", 1, "", "power_metering", true},
+		{"SHHT-1", 1, "", "", true},
+		{"SHRGBW2", 1, "", "dimming,power_metering,rgbw,schedules", true},
+		{"SNSW-001P16EU", 2, "1.4.2", "ble,power_metering,schedules,scripts,switch", true},
+		{"SNSW-001P16EU", 2, "0.8.1", "ble,power_metering,schedules,switch", true},
+		{"SNSW-102P16EU", 2, "1.0.0", "ble,power_metering,roller,schedules,scripts,switch", true},
+		{"SNSN-0013A", 2, "1.0.3", "", true},
+		{"S3DM-0A101WWL", 3, "1.3.0", "ble,dimming,power_metering,schedules,scripts", true},
+		{"XYZ-1", 2, "1.0.0", "", false},
+	}
+	for _, tt := range tests {
+		ops, known := SupportedOperations(tt.model, tt.gen, tt.firmware)
+		assertEqual(t, tt.known, known)
+		assertEqual(t, tt.want, strings.Join(ops, ","))
+	}
+
+	assertTrue(t, SupportsOperation("XYZ-1", 2, "", OpRoller))
+	assertTrue(t, !SupportsOperation("SNSW-001X16EU", 2, "1.0.0", OpRoller))
+	assertTrue(t, SupportsOperation("SHSW-25", 1, "", OpRoller))
+}
+
+func TestFirmwareVersion(t *testing.T) {
+	for fw, want := range map[string][3]int{
+		"1.4.2":                            {1, 4, 2},
+		"1.0.3-geb51a17":                   {1, 0, 3},
+		"20230913-112003/v1.14.0-gcb84623": {1, 14, 0},
+		"v1.9.5@ba3d9d1":                   {1, 9, 5},
+		"0.9":                              {0, 9, 0},
+	} {
+		v, ok := FirmwareVersion(fw)
+		assertTrue(t, ok)
+		assertEqual(t, want, v)
+	}
+	_, ok := FirmwareVersion("unknown")
+	assertTrue(t, !ok)
+}
@@ -1,8 +1,8 @@
 package gen1
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -21,6 +21,7 @@ type Client struct {
 	config     *clientConfig
 	logger     *logging.Logger
 	generation int
+	auth       *shelly.HTTPAuth // nil when no credentials are configured
 }
 
 // clientConfig holds configuration for the Gen1 client
@@ -32,6 +33,9 @@ type clientConfig struct {
 	retryDelay    time.Duration
 	skipTLSVerify bool
 	userAgent     string
+	recorder      *shelly.Recorder
+	network       shelly.NetworkOptions
+	credentials   shelly.CredentialSource
 }
 
 // ClientOption represents a configuration option for Gen1 client
@@ -45,6 +49,15 @@ func WithAuth(username, password string) ClientOption {
 	}
 }
 
+// WithCredentialSource sets where the credentials for authentication
+// challenges come from. The source is asked on every challenge and takes
+// precedence over WithAuth when it returns a password.
+func WithCredentialSource(source shelly.CredentialSource) ClientOption {
+	return func(c *clientConfig) {
+		c.credentials = source
+	}
+}
+
 // WithTimeout sets the HTTP timeout
 func WithTimeout(timeout time.Duration) ClientOption {
 	return func(c *clientConfig) {
@@ -74,6 +87,20 @@ func WithUserAgent(userAgent string) ClientOption {
 	}
 }
 
+// WithNetwork sets the source address and proxy used to reach the device
+func WithNetwork(opts shelly.NetworkOptions) ClientOption {
+	return func(c *clientConfig) {
+		c.network = opts
+	}
+}
+
+// WithRecorder records every HTTP exchange with the device in rec
+func WithRecorder(rec *shelly.Recorder) ClientOption {
+	return func(c *clientConfig) {
+		c.recorder = rec
+	}
+}
+
 // NewClient creates a new Gen1 Shelly client
 func NewClient(ip string, opts ...ClientOption) *Client {
 	cfg := &clientConfig{
@@ -87,10 +114,21 @@ func NewClient(ip string, opts ...ClientOption) *Client {
 		opt(cfg)
 	}
 
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: cfg.skipTLSVerify,
-		},
+	transport, err := shelly.NewTransport(cfg.network, cfg.skipTLSVerify)
+	if err != nil {
+		// Options are validated at startup; fail requests rather than
+		// reach the device through another route
+		transport = shelly.FailingTransport(err)
+	}
+	if cfg.recorder != nil {
+		transport = shelly.NewRecordingTransport(transport, cfg.recorder)
+	}
+	transport = shelly.NewCallCountingTransport(transport)
+	transport = shelly.NewLoggingTransport(transport, logging.GetDefault())
+
+	var auth *shelly.HTTPAuth
+	if cfg.password != "" || cfg.credentials != nil {
+		auth = shelly.NewHTTPAuth(cfg.username, cfg.password, cfg.credentials)
 	}
 
 	return &Client{
@@ -102,6 +140,7 @@ func NewClient(ip string, opts ...ClientOption) *Client {
 		config:     cfg,
 		logger:     logging.GetDefault(),
 		generation: 1,
+		auth:       auth,
 	}
 }
 
@@ -200,6 +239,9 @@ func (c *Client) GetStatus(ctx context.Context) (*shelly.DeviceStatus, error) {
 				if source, ok := relayData["source"].(string); ok {
 					sw.Source = source
 				}
+				if overpower, ok := relayData["overpower"].(bool); ok && overpower {
+					sw.Errors = append(sw.Errors, "overpower")
+				}
 				status.Switches = append(status.Switches, sw)
 			}
 		}
@@ -680,18 +722,38 @@ func (c *Client) GetIP() string {
 
 // Helper methods for HTTP operations
 
-func (c *Client) getJSON(ctx context.Context, url string, result interface{}) error {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// do sends a request built by newRequest. Whether the device requires
+// authentication, and with which scheme, is detected from its challenge, so
+// it need not be declared in the device settings.
+func (c *Client) do(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	if c.auth != nil {
+		return c.auth.Do(c.httpClient, newRequest)
+	}
+	req, err := newRequest()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return c.httpClient.Do(req)
+}
 
-	// Add authentication if configured
-	if c.config.username != "" && c.config.password != "" {
-		req.SetBasicAuth(c.config.username, c.config.password)
+// authError maps a 401 response: credentials were rejected if the client
+// has any, otherwise the device requires them
+func (c *Client) authError() error {
+	if c.auth != nil {
+		return shelly.ErrAuthFailed
 	}
+	return shelly.ErrAuthRequired
+}
 
-	req.Header.Set("User-Agent", c.config.userAgent)
+func (c *Client) getJSON(ctx context.Context, url string, result interface{}) error {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", c.config.userAgent)
+		return req, nil
+	}
 
 	// Retry logic
 	var lastErr error
@@ -700,7 +762,10 @@ func (c *Client) getJSON(ctx context.Context, url string, result interface{}) er
 			time.Sleep(c.config.retryDelay)
 		}
 
-		resp, err := c.httpClient.Do(req)
+		resp, err := c.do(newRequest)
+		if shelly.IsAuthError(err) {
+			return err
+		}
 		if err != nil {
 			lastErr = err
 			continue
@@ -713,7 +778,7 @@ func (c *Client) getJSON(ctx context.Context, url string, result interface{}) er
 		}()
 
 		if resp.StatusCode == http.StatusUnauthorized {
-			return shelly.ErrAuthRequired
+			return c.authError()
 		}
 
 		if resp.StatusCode != http.StatusOK {
@@ -766,20 +831,20 @@ func (c *Client) postForm(ctx context.Context, endpoint string, params map[strin
 			time.Sleep(c.config.retryDelay)
 		}
 
-		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(formData.Encode()))
-		if err != nil {
-			return err
+		newRequest := func() (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(formData.Encode()))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("User-Agent", c.config.userAgent)
+			return req, nil
 		}
 
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-		req.Header.Set("User-Agent", c.config.userAgent)
-
-		// Add authentication if configured
-		if c.config.username != "" && c.config.password != "" {
-			req.SetBasicAuth(c.config.username, c.config.password)
+		resp, err := c.do(newRequest)
+		if shelly.IsAuthError(err) {
+			return err
 		}
-
-		resp, err := c.httpClient.Do(req)
 		if err != nil {
 			lastErr = err
 			continue
@@ -792,7 +857,7 @@ func (c *Client) postForm(ctx context.Context, endpoint string, params map[strin
 		}()
 
 		if resp.StatusCode == http.StatusUnauthorized {
-			return shelly.ErrAuthRequired
+			return c.authError()
 		}
 
 		if resp.StatusCode != http.StatusOK {
@@ -875,6 +940,24 @@ func (c *Client) SetCloudConfig(ctx context.Context, enabled bool, server string
 	return c.postForm(ctx, url, params)
 }
 
+// SetAPRoaming configures roaming to a stronger access point once the signal
+// drops below threshold (dBm)
+func (c *Client) SetAPRoaming(ctx context.Context, enabled bool, threshold int) error {
+	url := fmt.Sprintf("http://%s/settings/ap_roaming", c.ip)
+	return c.postForm(ctx, url, map[string]interface{}{
+		"enabled":   enabled,
+		"threshold": threshold,
+	})
+}
+
+// SetSNTPServer sets the time server the device synchronises its clock with
+func (c *Client) SetSNTPServer(ctx context.Context, server string) error {
+	url := fmt.Sprintf("http://%s/settings", c.ip)
+	return c.postForm(ctx, url, map[string]interface{}{
+		"sntp_server": server,
+	})
+}
+
 // SetTimezone sets the device timezone
 func (c *Client) SetTimezone(ctx context.Context, timezone string) error {
 	url := fmt.Sprintf("http://%s/settings", c.ip)
@@ -924,3 +1007,32 @@ func (c *Client) GetSystemInfo(ctx context.Context) (map[string]interface{}, err
 	}
 	return result, nil
 }
+
+// Forward sends a request for path on the device, answering authentication
+// challenges with the client's credentials, and returns the device's
+// response as is. The caller closes its body.
+func (c *Client) Forward(ctx context.Context, method, path, rawQuery string, body []byte, contentType string) (*http.Response, error) {
+	target := fmt.Sprintf("http://%s%s", c.ip, path)
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+	resp, err := c.do(func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", c.config.userAgent)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		_ = resp.Body.Close()
+		return nil, c.authError()
+	}
+	return resp, nil
+}
@@ -2,12 +2,18 @@ package gen1
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/ginsys/shelly-manager/internal/shelly"
 )
 
 // mockGen1Server creates a test server that mimics a Gen1 Shelly device
@@ -382,6 +388,7 @@ func TestGen1Client_AuthRequired(t *testing.T) {
 		// Check for basic auth
 		user, pass, ok := r.BasicAuth()
 		if !ok || user != "admin" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="shelly1-test"`)
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
@@ -420,6 +427,65 @@ func TestGen1Client_AuthRequired(t *testing.T) {
 	}
 }
 
+func TestGen1Client_AuthDetection(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	md5Hex := func(data string) string {
+		sum := md5.Sum([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+
+	for _, scheme := range []string{shelly.AuthSchemeBasic, shelly.AuthSchemeDigest} {
+		t.Run(scheme, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorized := false
+				if scheme == shelly.AuthSchemeBasic {
+					user, pass, ok := r.BasicAuth()
+					authorized = ok && user == "admin" && pass == "secret"
+				} else if got, params, err := shelly.ParseChallenge(r.Header.Get("Authorization")); err == nil && got == shelly.AuthSchemeDigest {
+					ha1 := md5Hex("admin:shelly1-test:secret")
+					ha2 := md5Hex(r.Method + ":" + params["uri"])
+					authorized = params["response"] == md5Hex(fmt.Sprintf("%s:abc:%s:%s:auth:%s", ha1, params["nc"], params["cnonce"], ha2))
+				}
+				if !authorized {
+					if scheme == shelly.AuthSchemeBasic {
+						w.Header().Set("WWW-Authenticate", `Basic realm="shelly1-test"`)
+					} else {
+						w.Header().Set("WWW-Authenticate", `Digest qop="auth", realm="shelly1-test", nonce="abc"`)
+					}
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"relays": []interface{}{}})
+			}))
+			defer server.Close()
+			ip := server.URL[7:]
+			ctx := context.Background()
+
+			// Auth need not be declared: credentials answer the challenge
+			client := NewClient(ip, WithCredentialSource(func(string) (string, string) { return "", "secret" }), WithRetry(0, 0))
+			if _, err := client.GetStatus(ctx); err != nil {
+				t.Fatalf("GetStatus failed: %v", err)
+			}
+			if client.auth.Scheme() != scheme {
+				t.Errorf("Expected scheme %s, got %q", scheme, client.auth.Scheme())
+			}
+
+			_, err := NewClient(ip, WithAuth("admin", "wrong"), WithRetry(0, 0)).GetStatus(ctx)
+			if !errors.Is(err, shelly.ErrAuthFailed) {
+				t.Errorf("Expected authentication failed, got %v", err)
+			}
+			_, err = NewClient(ip, WithRetry(0, 0)).GetStatus(ctx)
+			if !errors.Is(err, shelly.ErrAuthRequired) {
+				t.Errorf("Expected authentication required, got %v", err)
+			}
+		})
+	}
+}
+
 func TestGen1Client_Retry(t *testing.T) {
 	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
 		t.Skipf("Skipping due to restricted socket permissions: %v", err)
@@ -0,0 +1,137 @@
+package gen2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ginsys/shelly-manager/internal/shelly"
+)
+
+// digestServer is a Gen2 device requiring SHA-256 digest authentication
+type digestServer struct {
+	mu         sync.Mutex
+	password   string
+	nonce      int
+	challenges int
+	lastNC     string
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *digestServer) rotateNonce() {
+	s.mu.Lock()
+	s.nonce++
+	s.mu.Unlock()
+}
+
+func (s *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nonce := fmt.Sprintf("%d", 1700000000+s.nonce)
+	scheme, params, err := shelly.ParseChallenge(r.Header.Get("Authorization"))
+	if err == nil && scheme == shelly.AuthSchemeDigest && params["nonce"] == nonce && params["algorithm"] == "SHA-256" {
+		ha1 := sha256Hex("admin:shellyplus1-test:" + s.password)
+		ha2 := sha256Hex(r.Method + ":" + params["uri"])
+		expected := sha256Hex(fmt.Sprintf("%s:%s:%s:%s:auth:%s", ha1, nonce, params["nc"], params["cnonce"], ha2))
+		if params["username"] == "admin" && params["response"] == expected {
+			var req RPCRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "Shelly.GetStatus" {
+				http.Error(w, "bad request body", http.StatusBadRequest)
+				return
+			}
+			s.lastNC = params["nc"]
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": map[string]any{}})
+			return
+		}
+	}
+
+	s.challenges++
+	w.Header().Set("WWW-Authenticate",
+		fmt.Sprintf(`Digest qop="auth", realm="shellyplus1-test", nonce="%s", algorithm=SHA-256`, nonce))
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func TestClient_DigestAuth(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	device := &digestServer{password: "secret"}
+	server := httptest.NewServer(device)
+	defer server.Close()
+	serverIP := server.URL[len("http://"):]
+	ctx := context.Background()
+
+	client := NewClient(serverIP, WithAuth("admin", "secret"), WithRetry(0, 0))
+	_, err := client.GetStatus(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, device.challenges)
+
+	// The cached nonce is reused with an increasing nonce count
+	_, err = client.GetStatus(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 1, device.challenges)
+	assertEqual(t, "00000002", device.lastNC)
+
+	// An expired nonce is answered with the new challenge
+	device.rotateNonce()
+	_, err = client.GetStatus(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 2, device.challenges)
+	assertEqual(t, "00000001", device.lastNC)
+
+	// Wrong credentials and missing credentials
+	_, err = NewClient(serverIP, WithAuth("admin", "wrong"), WithRetry(0, 0)).GetStatus(ctx)
+	assertTrue(t, errors.Is(err, shelly.ErrAuthFailed))
+	_, err = NewClient(serverIP, WithRetry(0, 0)).GetStatus(ctx)
+	assertTrue(t, errors.Is(err, shelly.ErrAuthRequired))
+}
+
+func TestClient_DigestAuthCredentialSource(t *testing.T) {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	device := &digestServer{password: "secret"}
+	server := httptest.NewServer(device)
+	defer server.Close()
+
+	var mu sync.Mutex
+	password := "secret"
+	source := func(string) (string, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		return "", password // the username defaults to admin
+	}
+	client := NewClient(server.URL[len("http://"):], WithCredentialSource(source), WithRetry(0, 0))
+	ctx := context.Background()
+
+	_, err := client.GetStatus(ctx)
+	assertNoError(t, err)
+
+	// A rotated password is picked up on the next challenge
+	device.mu.Lock()
+	device.password = "rotated"
+	device.mu.Unlock()
+	mu.Lock()
+	password = "rotated"
+	mu.Unlock()
+	_, err = client.GetStatus(ctx)
+	assertNoError(t, err)
+	assertEqual(t, 2, device.challenges)
+}
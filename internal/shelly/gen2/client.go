@@ -3,7 +3,6 @@ package gen2
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -20,6 +19,7 @@ type Client struct {
 	config     *clientConfig
 	logger     *logging.Logger
 	generation int
+	auth       *shelly.HTTPAuth // nil when no credentials are configured
 }
 
 // clientConfig holds configuration for the Gen2 client
@@ -31,6 +31,9 @@ type clientConfig struct {
 	retryDelay    time.Duration
 	skipTLSVerify bool
 	userAgent     string
+	recorder      *shelly.Recorder
+	network       shelly.NetworkOptions
+	credentials   shelly.CredentialSource
 }
 
 // ClientOption represents a configuration option for Gen2 client
@@ -44,6 +47,15 @@ func WithAuth(username, password string) ClientOption {
 	}
 }
 
+// WithCredentialSource sets where the credentials for authentication
+// challenges come from. The source is asked on every challenge and takes
+// precedence over WithAuth when it returns a password.
+func WithCredentialSource(source shelly.CredentialSource) ClientOption {
+	return func(c *clientConfig) {
+		c.credentials = source
+	}
+}
+
 // WithTimeout sets the HTTP timeout
 func WithTimeout(timeout time.Duration) ClientOption {
 	return func(c *clientConfig) {
@@ -73,6 +85,20 @@ func WithUserAgent(userAgent string) ClientOption {
 	}
 }
 
+// WithNetwork sets the source address and proxy used to reach the device
+func WithNetwork(opts shelly.NetworkOptions) ClientOption {
+	return func(c *clientConfig) {
+		c.network = opts
+	}
+}
+
+// WithRecorder records every HTTP exchange with the device in rec
+func WithRecorder(rec *shelly.Recorder) ClientOption {
+	return func(c *clientConfig) {
+		c.recorder = rec
+	}
+}
+
 // NewClient creates a new Gen2+ Shelly client
 func NewClient(ip string, opts ...ClientOption) *Client {
 	cfg := &clientConfig{
@@ -86,10 +112,21 @@ func NewClient(ip string, opts ...ClientOption) *Client {
 		opt(cfg)
 	}
 
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: cfg.skipTLSVerify,
-		},
+	transport, err := shelly.NewTransport(cfg.network, cfg.skipTLSVerify)
+	if err != nil {
+		// Options are validated at startup; fail requests rather than
+		// reach the device through another route
+		transport = shelly.FailingTransport(err)
+	}
+	if cfg.recorder != nil {
+		transport = shelly.NewRecordingTransport(transport, cfg.recorder)
+	}
+	transport = shelly.NewCallCountingTransport(transport)
+	transport = shelly.NewLoggingTransport(transport, logging.GetDefault())
+
+	var auth *shelly.HTTPAuth
+	if cfg.password != "" || cfg.credentials != nil {
+		auth = shelly.NewHTTPAuth(cfg.username, cfg.password, cfg.credentials)
 	}
 
 	return &Client{
@@ -101,6 +138,7 @@ func NewClient(ip string, opts ...ClientOption) *Client {
 		config:     cfg,
 		logger:     logging.GetDefault(),
 		generation: 2, // Default to Gen2, can be updated after GetInfo
+		auth:       auth,
 	}
 }
 
@@ -244,6 +282,18 @@ func (c *Client) GetStatus(ctx context.Context) (*shelly.DeviceStatus, error) {
 				if source, ok := switchData["source"].(string); ok {
 					sw.Source = source
 				}
+				if aenergy, ok := switchData["aenergy"].(map[string]interface{}); ok {
+					if total, ok := aenergy["total"].(float64); ok {
+						sw.Energy = total
+					}
+				}
+				if errs, ok := switchData["errors"].([]interface{}); ok {
+					for _, e := range errs {
+						if name, ok := e.(string); ok {
+							sw.Errors = append(sw.Errors, name)
+						}
+					}
+				}
 
 				status.Switches = append(status.Switches, sw)
 			}
@@ -420,6 +470,28 @@ func (c *Client) GetIP() string {
 	return c.ip
 }
 
+// do sends a request built by newRequest, answering the SHA-256 digest
+// challenge of a secured device with the client's credentials
+func (c *Client) do(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	if c.auth != nil {
+		return c.auth.Do(c.httpClient, newRequest)
+	}
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	return c.httpClient.Do(req)
+}
+
+// authError maps a 401 response: credentials were rejected if the client
+// has any, otherwise the device requires them
+func (c *Client) authError() error {
+	if c.auth != nil {
+		return shelly.ErrAuthFailed
+	}
+	return shelly.ErrAuthRequired
+}
+
 // rpcCall performs a JSON-RPC call to the device
 func (c *Client) rpcCall(ctx context.Context, method string, params interface{}, result interface{}) error {
 	url := fmt.Sprintf("http://%s/rpc", c.ip)
@@ -442,20 +514,19 @@ func (c *Client) rpcCall(ctx context.Context, method string, params interface{},
 			time.Sleep(c.config.retryDelay)
 		}
 
-		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
-		if err != nil {
-			return err
+		newRequest := func() (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("User-Agent", c.config.userAgent)
+			return req, nil
 		}
 
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("User-Agent", c.config.userAgent)
-
-		var resp *http.Response
-		// Use digest auth if configured
-		if c.config.username != "" && c.config.password != "" {
-			resp, err = doRequestWithDigestAuth(c.httpClient, req, c.config.username, c.config.password)
-		} else {
-			resp, err = c.httpClient.Do(req)
+		resp, err := c.do(newRequest)
+		if shelly.IsAuthError(err) {
+			return err
 		}
 		if err != nil {
 			lastErr = err
@@ -464,7 +535,7 @@ func (c *Client) rpcCall(ctx context.Context, method string, params interface{},
 		defer func() { _ = resp.Body.Close() }()
 
 		if resp.StatusCode == http.StatusUnauthorized {
-			return shelly.ErrAuthRequired
+			return c.authError()
 		}
 
 		if resp.StatusCode != http.StatusOK {
@@ -721,6 +792,16 @@ func (c *Client) SetLEDSettings(ctx context.Context, settings map[string]interfa
 	return c.rpcCall(ctx, "Sys.SetConfig", params, nil)
 }
 
+// SetSNTPServer sets the time server the device synchronises its clock with
+func (c *Client) SetSNTPServer(ctx context.Context, server string) error {
+	params := map[string]interface{}{
+		"config": map[string]interface{}{
+			"sntp": map[string]interface{}{"server": server},
+		},
+	}
+	return c.rpcCall(ctx, "Sys.SetConfig", params, nil)
+}
+
 // RGBW Operations for Gen2+ devices
 
 // SetWhiteChannel controls white channel for RGBW devices
@@ -742,3 +823,34 @@ func (c *Client) SetColorMode(ctx context.Context, mode string) error {
 	// in Light.Set calls. This is a compatibility method.
 	return nil
 }
+
+// Forward sends a request for path on the device, answering authentication
+// challenges with the client's credentials, and returns the device's
+// response as is. The caller closes its body.
+func (c *Client) Forward(ctx context.Context, method, path, rawQuery string, body []byte, contentType string) (*http.Response, error) {
+	target := fmt.Sprintf("http://%s%s", c.ip, path)
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", c.config.userAgent)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return req, nil
+	}
+
+	resp, err := c.do(newRequest)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		_ = resp.Body.Close()
+		return nil, c.authError()
+	}
+	return resp, nil
+}
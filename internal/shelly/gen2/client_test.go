@@ -163,6 +163,10 @@ func mockGen2Server() *httptest.Server {
 					"temperature": map[string]interface{}{
 						"tC": 45.2,
 					},
+					"errors": []interface{}{"overpower"},
+					"aenergy": map[string]interface{}{
+						"total": 1234.5,
+					},
 				},
 			}
 		case "Shelly.GetConfig":
@@ -371,6 +375,9 @@ func TestClient_GetStatus(t *testing.T) {
 	assertEqual(t, 0.11, status.Switches[0].Current)
 	assertEqual(t, 45.2, status.Switches[0].Temperature)
 	assertEqual(t, "input", status.Switches[0].Source)
+	assertEqual(t, 1, len(status.Switches[0].Errors))
+	assertEqual(t, "overpower", status.Switches[0].Errors[0])
+	assertEqual(t, 1234.5, status.Switches[0].Energy)
 }
 
 func TestClient_GetConfig(t *testing.T) {
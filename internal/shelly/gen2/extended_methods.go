@@ -2,6 +2,8 @@ package gen2
 
 import (
 	"context"
+
+	"github.com/ginsys/shelly-manager/internal/shelly"
 )
 
 // Power Monitoring Methods
@@ -224,6 +226,15 @@ func (c *Client) SetSysConfig(ctx context.Context, config map[string]interface{}
 	return c.rpcCall(ctx, "Sys.SetConfig", params, nil)
 }
 
+// SetDeviceName sets the device name (Sys.SetConfig device.name)
+func (c *Client) SetDeviceName(ctx context.Context, name string) error {
+	return c.SetSysConfig(ctx, map[string]interface{}{
+		"device": map[string]interface{}{
+			"name": name,
+		},
+	})
+}
+
 // GetSysStatus retrieves system status
 func (c *Client) GetSysStatus(ctx context.Context) (map[string]interface{}, error) {
 	var result map[string]interface{}
@@ -449,6 +460,18 @@ func (c *Client) ScanWiFi(ctx context.Context) ([]interface{}, error) {
 	return result.Results, nil
 }
 
+// ListAPClients lists the stations connected to the access point of a
+// device running as a range extender
+func (c *Client) ListAPClients(ctx context.Context) ([]shelly.APClient, error) {
+	var result struct {
+		APClients []shelly.APClient `json:"ap_clients"`
+	}
+	if err := c.rpcCall(ctx, "WiFi.ListAPClients", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.APClients, nil
+}
+
 // KVS (Key-Value Store) Methods
 
 // KVSSet sets a value in the key-value store
@@ -684,3 +707,11 @@ func (c *Client) GetWSStatus(ctx context.Context) (map[string]interface{}, error
 	}
 	return result, nil
 }
+
+// Generic RPC
+
+// CallRPC invokes an arbitrary RPC method, e.g. a call prepared by a
+// configuration migration, and discards its result
+func (c *Client) CallRPC(ctx context.Context, method string, params map[string]interface{}) error {
+	return c.rpcCall(ctx, method, params, nil)
+}
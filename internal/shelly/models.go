@@ -98,6 +98,16 @@ type WiFiStatus struct {
 	RSSI      int    `json:"rssi,omitempty"`
 }
 
+// APClient is a station connected to the access point of a device running
+// as a range extender
+type APClient struct {
+	MAC      string `json:"mac"`
+	IP       string `json:"ip"`
+	IPStatic bool   `json:"ip_static"`
+	Port     int    `json:"mport"` // port forwarded to the client
+	Since    int64  `json:"since"` // unix time the client connected
+}
+
 // WiFiConfig represents WiFi configuration
 type WiFiConfig struct {
 	Enable   bool   `json:"enable"`
@@ -166,6 +176,9 @@ type SwitchStatus struct {
 	Current     float64 `json:"current,omitempty"`
 	Temperature float64 `json:"temperature,omitempty"`
 	Source      string  `json:"source,omitempty"` // Source of last command
+	Energy      float64 `json:"energy,omitempty"` // Energy counter in Watt-hours, restarts on device resets
+	// Errors lists active protections, e.g. "overpower" or "overtemp"
+	Errors []string `json:"errors,omitempty"`
 }
 
 // SwitchConfig represents switch/relay configuration
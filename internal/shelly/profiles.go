@@ -0,0 +1,97 @@
+package shelly
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Profiles of devices whose outputs work either as relays or as a cover
+const (
+	ProfileSwitch = "switch"
+	ProfileCover  = "cover"
+)
+
+// profileComponentKey matches the top-level configuration keys that exist in
+// one profile only: Gen2 switch and cover components, Gen1 relays and rollers
+var profileComponentKey = regexp.MustCompile(`^((switch|cover):\d+|relays|rollers)$`)
+
+// NormalizeProfile returns the profile for a Gen2 profile name or a Gen1
+// mode ("relay", "roller"), or "" for anything else
+func NormalizeProfile(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "switch", "relay":
+		return ProfileSwitch
+	case "cover", "roller":
+		return ProfileCover
+	default:
+		return ""
+	}
+}
+
+// SupportedProfiles returns the profiles a model can switch between, or nil
+// for models with a single profile
+func SupportedProfiles(model string) []string {
+	match := lookupModel(model)
+	if match == nil {
+		return nil
+	}
+	var hasSwitch, hasRoller bool
+	for _, op := range match.ops {
+		hasSwitch = hasSwitch || op == OpSwitch
+		hasRoller = hasRoller || op == OpRoller
+	}
+	if !hasSwitch || !hasRoller {
+		return nil
+	}
+	return []string{ProfileCover, ProfileSwitch}
+}
+
+// ProfileOperations removes the operations the active profile turns off: a
+// device in the switch profile has no roller, one in the cover profile no
+// switches. An unknown profile leaves the operations as they are.
+func ProfileOperations(ops []string, profile string) []string {
+	var drop string
+	switch NormalizeProfile(profile) {
+	case ProfileSwitch:
+		drop = OpRoller
+	case ProfileCover:
+		drop = OpSwitch
+	default:
+		return ops
+	}
+	filtered := make([]string, 0, len(ops))
+	for _, op := range ops {
+		if op != drop {
+			filtered = append(filtered, op)
+		}
+	}
+	return filtered
+}
+
+// ConfigProfile returns the active profile recorded in a device
+// configuration: sys.device.profile on Gen2, mode on Gen1. It is "" when the
+// configuration names no profile.
+func ConfigProfile(config json.RawMessage) string {
+	var raw struct {
+		Mode string `json:"mode"`
+		Sys  struct {
+			Device struct {
+				Profile string `json:"profile"`
+			} `json:"device"`
+		} `json:"sys"`
+	}
+	if err := json.Unmarshal(config, &raw); err != nil {
+		return ""
+	}
+	if raw.Sys.Device.Profile != "" {
+		return NormalizeProfile(raw.Sys.Device.Profile)
+	}
+	return NormalizeProfile(raw.Mode)
+}
+
+// IsProfileComponent reports whether a top-level configuration key belongs
+// to the components of one profile
+func IsProfileComponent(key string) bool {
+	return profileComponentKey.MatchString(key)
+}
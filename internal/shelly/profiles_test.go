@@ -0,0 +1,32 @@
+package shelly
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	assertEqual(t, "cover,switch", strings.Join(SupportedProfiles("SNSW-102P16EU"), ","))
+	assertEqual(t, "cover,switch", strings.Join(SupportedProfiles("SHSW-25"), ","))
+	assertTrue(t, SupportedProfiles("SNSW-001X16EU") == nil)
+	assertTrue(t, SupportedProfiles("XYZ-1") == nil)
+
+	assertEqual(t, ProfileCover, NormalizeProfile("roller"))
+	assertEqual(t, ProfileSwitch, NormalizeProfile(" Relay "))
+	assertEqual(t, "", NormalizeProfile("light"))
+
+	ops, _ := SupportedOperations("SNSW-102P16EU", 2, "1.0.0")
+	assertEqual(t, "ble,power_metering,schedules,scripts,switch", strings.Join(ProfileOperations(ops, ProfileSwitch), ","))
+	assertEqual(t, "ble,power_metering,roller,schedules,scripts", strings.Join(ProfileOperations(ops, "roller"), ","))
+	assertEqual(t, strings.Join(ops, ","), strings.Join(ProfileOperations(ops, ""), ","))
+
+	assertEqual(t, ProfileCover, ConfigProfile(json.RawMessage(`{"sys":{"device":{"profile":"cover"}}}`)))
+	assertEqual(t, ProfileSwitch, ConfigProfile(json.RawMessage(`{"mode":"relay","relays":[]}`)))
+	assertEqual(t, "", ConfigProfile(json.RawMessage(`{"sys":{"device":{"name":"x"}}}`)))
+	assertEqual(t, "", ConfigProfile(json.RawMessage(`not json`)))
+
+	for key, want := range map[string]bool{"switch:0": true, "cover:1": true, "rollers": true, "relays": true, "input:0": false, "switch": false} {
+		assertEqual(t, want, IsProfileComponent(key))
+	}
+}
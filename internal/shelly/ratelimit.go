@@ -0,0 +1,249 @@
+package shelly
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Traffic classes of device requests, counted separately by the rate limiter
+const (
+	TrafficDiscovery = "discovery"
+	TrafficMetrics   = "metrics"
+	TrafficHealth    = "health"
+	TrafficOther     = "other"
+)
+
+type trafficClassKey struct{}
+
+// WithTrafficClass marks the device requests made with ctx as class
+func WithTrafficClass(ctx context.Context, class string) context.Context {
+	return context.WithValue(ctx, trafficClassKey{}, class)
+}
+
+// TrafficClass returns the traffic class of ctx, TrafficOther when unset
+func TrafficClass(ctx context.Context) string {
+	if class, ok := ctx.Value(trafficClassKey{}).(string); ok && class != "" {
+		return class
+	}
+	return TrafficOther
+}
+
+// NetworkRate budgets the requests to every device in a network
+type NetworkRate struct {
+	Network           *net.IPNet
+	RequestsPerSecond float64 // 0 leaves the network unlimited
+	Burst             int
+}
+
+// RateLimitRecorder is told about every request passing the rate limiter,
+// e.g. to export it as a metric. ok is false when the request gave up
+// waiting for its turn.
+type RateLimitRecorder func(network, class string, wait time.Duration, ok bool)
+
+// RateLimitStats counts the requests of one traffic class to one network
+type RateLimitStats struct {
+	Network     string  `json:"network"`
+	Class       string  `json:"class"`
+	Requests    int64   `json:"requests"`
+	Delayed     int64   `json:"delayed"`  // had to wait for their turn
+	Rejected    int64   `json:"rejected"` // gave up waiting
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+// RateLimiter spreads device requests over time with a token bucket per
+// network, shared by every client using it. Listed networks have their own
+// budget; other devices share one per /24 (IPv4) or /64 (IPv6) subnet at the
+// default rate.
+type RateLimiter struct {
+	rate     float64
+	burst    int
+	networks []NetworkRate
+	now      func() time.Time
+
+	mu       sync.Mutex
+	buckets  map[string]*tokenBucket
+	stats    map[[2]string]*RateLimitStats
+	recorder RateLimitRecorder
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing rate requests per second with
+// bursts of burst per subnet, and the listed budgets for their networks.
+// A rate of 0 leaves subnets without a listed network unlimited.
+func NewRateLimiter(rate float64, burst int, networks []NetworkRate) *RateLimiter {
+	return &RateLimiter{
+		rate:     rate,
+		burst:    burst,
+		networks: networks,
+		now:      time.Now,
+		buckets:  make(map[string]*tokenBucket),
+		stats:    make(map[[2]string]*RateLimitStats),
+	}
+}
+
+// SetRecorder sets the callback told about every request
+func (l *RateLimiter) SetRecorder(fn RateLimitRecorder) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recorder = fn
+}
+
+// Wait blocks until a request to host may be sent within its network's
+// budget. It fails without waiting when ctx ends before the request's turn.
+func (l *RateLimiter) Wait(ctx context.Context, host string) error {
+	network, rate, burst := l.budget(host)
+	class := TrafficClass(ctx)
+
+	l.mu.Lock()
+	wait := time.Duration(0)
+	var bucket *tokenBucket
+	if rate > 0 {
+		bucket = l.buckets[network]
+		if bucket == nil {
+			bucket = &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: l.now()}
+			l.buckets[network] = bucket
+		}
+		wait = bucket.take(l.now())
+	}
+	l.mu.Unlock()
+
+	if wait > 0 {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			l.cancel(bucket)
+			l.record(network, class, wait, false)
+			return fmt.Errorf("rate limit for %s: request would wait %s past its deadline", network, wait.Round(time.Millisecond))
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			l.cancel(bucket)
+			l.record(network, class, wait, false)
+			return fmt.Errorf("rate limit for %s: %w", network, ctx.Err())
+		}
+	}
+	l.record(network, class, wait, true)
+	return nil
+}
+
+// Stats returns the request counters per network and traffic class
+func (l *RateLimiter) Stats() []RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := make([]RateLimitStats, 0, len(l.stats))
+	for _, s := range l.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Network != stats[j].Network {
+			return stats[i].Network < stats[j].Network
+		}
+		return stats[i].Class < stats[j].Class
+	})
+	return stats
+}
+
+// budget returns the network a host is budgeted under with its rate and
+// burst
+func (l *RateLimiter) budget(host string) (string, float64, int) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host, l.rate, burstFor(l.rate, l.burst)
+	}
+	for _, n := range l.networks {
+		if n.Network.Contains(ip) {
+			return n.Network.String(), n.RequestsPerSecond, burstFor(n.RequestsPerSecond, n.Burst)
+		}
+	}
+	subnet := &net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}
+	if v4 := ip.To4(); v4 != nil {
+		subnet = &net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+	}
+	return subnet.String(), l.rate, burstFor(l.rate, l.burst)
+}
+
+// burstFor defaults the burst to one second of requests
+func burstFor(rate float64, burst int) int {
+	if burst > 0 {
+		return burst
+	}
+	return int(math.Max(1, math.Ceil(rate)))
+}
+
+// cancel returns the token of a request that gave up waiting
+func (l *RateLimiter) cancel(bucket *tokenBucket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket.tokens = math.Min(bucket.burst, bucket.tokens+1)
+}
+
+func (l *RateLimiter) record(network, class string, wait time.Duration, ok bool) {
+	l.mu.Lock()
+	key := [2]string{network, class}
+	s := l.stats[key]
+	if s == nil {
+		s = &RateLimitStats{Network: network, Class: class}
+		l.stats[key] = s
+	}
+	if ok {
+		s.Requests++
+		if wait > 0 {
+			s.Delayed++
+			s.WaitSeconds += wait.Seconds()
+		}
+	} else {
+		s.Rejected++
+	}
+	recorder := l.recorder
+	l.mu.Unlock()
+
+	if recorder != nil {
+		recorder(network, class, wait, ok)
+	}
+}
+
+// take reserves a token and returns how long to wait for it. Tokens may go
+// negative so waiting requests queue in order.
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// NewRateLimitedTransport holds every request until the limiter lets it
+// through to next
+func NewRateLimitedTransport(next http.RoundTripper, limiter *RateLimiter) http.RoundTripper {
+	return &rateLimitedTransport{next: next, limiter: limiter}
+}
+
+type rateLimitedTransport struct {
+	next    http.RoundTripper
+	limiter *RateLimiter
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context(), req.URL.Hostname()); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,91 @@
+package shelly
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Budgets(t *testing.T) {
+	_, vpn, _ := net.ParseCIDR("10.20.0.0/16")
+	limiter := NewRateLimiter(10, 2, []NetworkRate{{Network: vpn, RequestsPerSecond: 1, Burst: 1}})
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	// The burst of a subnet passes at once, the next request waits
+	ctx := WithTrafficClass(context.Background(), TrafficDiscovery)
+	for i := 0; i < 2; i++ {
+		if err := limiter.Wait(ctx, "192.168.1.10"); err != nil {
+			t.Fatalf("Expected the burst to pass, got %v", err)
+		}
+	}
+	start := time.Now()
+	if err := limiter.Wait(ctx, "192.168.1.11"); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if waited := time.Since(start); waited < 80*time.Millisecond {
+		t.Errorf("Expected the third request to wait about 100ms, waited %s", waited)
+	}
+
+	// Another subnet has its own budget
+	if err := limiter.Wait(ctx, "192.168.2.10"); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+
+	// A listed network shares one budget; a deadline before the turn fails
+	// without waiting
+	health := WithTrafficClass(context.Background(), TrafficHealth)
+	if err := limiter.Wait(health, "10.20.1.1"); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	short, cancel := context.WithTimeout(health, 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if err := limiter.Wait(short, "10.20.9.9"); err == nil {
+		t.Error("Expected the request refused past its deadline")
+	}
+	if waited := time.Since(start); waited > 40*time.Millisecond {
+		t.Errorf("Expected an immediate refusal, waited %s", waited)
+	}
+
+	stats := limiter.Stats()
+	if len(stats) != 3 {
+		t.Fatalf("Expected counters for three networks, got %+v", stats)
+	}
+	if s := stats[0]; s.Network != "10.20.0.0/16" || s.Class != TrafficHealth || s.Requests != 1 || s.Rejected != 1 {
+		t.Errorf("Unexpected VPN counters: %+v", s)
+	}
+	if s := stats[1]; s.Network != "192.168.1.0/24" || s.Requests != 3 || s.Delayed != 1 || s.WaitSeconds <= 0 {
+		t.Errorf("Unexpected subnet counters: %+v", s)
+	}
+}
+
+func TestNewTransport_RateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	limiter := NewRateLimiter(1, 1, nil)
+	var recorded []string
+	limiter.SetRecorder(func(network, class string, wait time.Duration, ok bool) {
+		recorded = append(recorded, network+" "+class)
+	})
+	transport, err := NewTransport(NetworkOptions{Limiter: limiter}, false)
+	if err != nil {
+		t.Fatalf("NewTransport failed: %v", err)
+	}
+	client := &http.Client{Transport: transport, Timeout: 100 * time.Millisecond}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Error("Expected the second request to exceed its timeout waiting for the budget")
+	}
+	if len(recorded) != 2 || recorded[0] != "127.0.0.0/24 other" {
+		t.Errorf("Expected both requests recorded, got %v", recorded)
+	}
+}
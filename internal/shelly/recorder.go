@@ -0,0 +1,248 @@
+package shelly
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+// Recorder defaults and limits
+const (
+	DefaultTraceEntries   = 100
+	DefaultTraceBodyBytes = 16 * 1024
+	MaxTraceEntries       = 1000
+	MaxTraceBodyBytes     = 1024 * 1024
+)
+
+// redacted replaces secret values in recorded traces
+const redacted = "[REDACTED]"
+
+// sensitiveFields are the name fragments of fields holding secrets. Gen1
+// passes Wi-Fi keys and login passwords as query parameters, Gen2 in RPC
+// params, under names such as mqtt_pass or wifi_key.
+var sensitiveFields = []string{
+	"password", "passwd", "pass", "pwd", "psk", "ha1",
+	"key", "secret", "token", "auth",
+	"wifi_password", "wifi_pass", "wifi_key",
+	"mqtt_password", "mqtt_pass",
+	"username", "user", // Some consider usernames sensitive too
+}
+
+// IsSensitiveField reports whether a configuration field, JSON key or query
+// parameter holds sensitive data, by a case-insensitive match of any known
+// secret name fragment
+func IsSensitiveField(key string) bool {
+	keyLower := strings.ToLower(key)
+	for _, sensitive := range sensitiveFields {
+		if strings.Contains(keyLower, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// TraceEntry is one recorded HTTP exchange with a device
+type TraceEntry struct {
+	Time         time.Time `json:"time"`
+	Method       string    `json:"method"`
+	URL          string    `json:"url"`
+	RequestBody  string    `json:"request_body,omitempty"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	DurationMS   int64     `json:"duration_ms"`
+	Error        string    `json:"error,omitempty"`
+	Truncated    bool      `json:"truncated,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"` // API request or job that made the call
+}
+
+// Recorder keeps the most recent device HTTP exchanges in a ring buffer.
+// Secrets are redacted and bodies truncated before they are stored.
+type Recorder struct {
+	mu           sync.Mutex
+	entries      []TraceEntry
+	next         int
+	full         bool
+	maxBodyBytes int
+}
+
+// NewRecorder creates a recorder keeping maxEntries exchanges with bodies of
+// at most maxBodyBytes each; zero uses the defaults
+func NewRecorder(maxEntries, maxBodyBytes int) *Recorder {
+	if maxEntries <= 0 {
+		maxEntries = DefaultTraceEntries
+	}
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = DefaultTraceBodyBytes
+	}
+	return &Recorder{
+		entries:      make([]TraceEntry, maxEntries),
+		maxBodyBytes: maxBodyBytes,
+	}
+}
+
+// Entries returns the recorded exchanges, oldest first
+func (r *Recorder) Entries() []TraceEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]TraceEntry{}, r.entries[:r.next]...)
+	}
+	out := make([]TraceEntry, 0, len(r.entries))
+	out = append(out, r.entries[r.next:]...)
+	return append(out, r.entries[:r.next]...)
+}
+
+func (r *Recorder) add(entry TraceEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[r.next] = entry
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// body redacts and truncates a recorded body
+func (r *Recorder) body(data []byte, contentType string) (string, bool) {
+	if len(data) == 0 {
+		return "", false
+	}
+	text := redactBody(data, contentType)
+	if len(text) > r.maxBodyBytes {
+		return text[:r.maxBodyBytes], true
+	}
+	return text, false
+}
+
+// NewRecordingTransport wraps base so every exchange is added to rec. Request
+// and response bodies are buffered so the caller still reads them in full.
+func NewRecordingTransport(base http.RoundTripper, rec *Recorder) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &recordingTransport{base: base, rec: rec}
+}
+
+type recordingTransport struct {
+	base http.RoundTripper
+	rec  *Recorder
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := TraceEntry{
+		Time:      time.Now(),
+		Method:    req.Method,
+		URL:       redactURL(req.URL),
+		RequestID: logging.GetRequestID(req.Context()),
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		clone := req.Clone(req.Context())
+		clone.Body = io.NopCloser(bytes.NewReader(data))
+		clone.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+		req = clone
+		var truncated bool
+		entry.RequestBody, truncated = t.rec.body(data, req.Header.Get("Content-Type"))
+		entry.Truncated = entry.Truncated || truncated
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	entry.DurationMS = time.Since(entry.Time).Milliseconds()
+	if err != nil {
+		entry.Error = err.Error()
+		t.rec.add(entry)
+		return nil, err
+	}
+
+	entry.StatusCode = resp.StatusCode
+	if resp.Body != nil {
+		data, readErr := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		if readErr != nil {
+			entry.Error = readErr.Error()
+		}
+		var truncated bool
+		entry.ResponseBody, truncated = t.rec.body(data, resp.Header.Get("Content-Type"))
+		entry.Truncated = entry.Truncated || truncated
+	}
+	t.rec.add(entry)
+	return resp, nil
+}
+
+// redactURL returns the URL with secret query parameters and user info
+// replaced
+func redactURL(u *url.URL) string {
+	clean := *u
+	if clean.User != nil {
+		clean.User = url.User(redacted)
+	}
+	if clean.RawQuery != "" {
+		query := clean.Query()
+		for name := range query {
+			if IsSensitiveField(name) {
+				query.Set(name, redacted)
+			}
+		}
+		clean.RawQuery = query.Encode()
+	}
+	return clean.String()
+}
+
+// redactBody replaces secret values in JSON and form bodies; other bodies
+// are returned as they are
+func redactBody(data []byte, contentType string) string {
+	var doc interface{}
+	if json.Unmarshal(data, &doc) == nil {
+		if out, err := json.Marshal(redactJSON(doc)); err == nil {
+			return string(out)
+		}
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(data)); err == nil {
+			for name := range form {
+				if IsSensitiveField(name) {
+					form.Set(name, redacted)
+				}
+			}
+			return form.Encode()
+		}
+	}
+	return string(data)
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if _, isString := child.(string); isString && IsSensitiveField(k) {
+				val[k] = redacted
+				continue
+			}
+			val[k] = redactJSON(child)
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = redactJSON(child)
+		}
+	}
+	return v
+}
@@ -0,0 +1,67 @@
+package shelly
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecordingTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"echo":` + string(body) + `,"wifi_sta":{"ssid":"home","pass":"hunter2"}}`))
+	}))
+	defer server.Close()
+
+	rec := NewRecorder(2, 0)
+	client := &http.Client{Transport: NewRecordingTransport(http.DefaultTransport, rec)}
+
+	resp, err := client.Post(server.URL+"/rpc?key=wifi-secret&ssid=home&mqtt_pass=broker-secret", "application/json",
+		strings.NewReader(`{"method":"WiFi.SetConfig","params":{"config":{"sta":{"pass":"s3cret","wifi_key":"psk-secret"}}}}`))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	// The caller still sees the full, unredacted exchange
+	if !strings.Contains(string(body), `"s3cret"`) || !strings.Contains(string(body), "hunter2") {
+		t.Fatalf("Expected body to pass through unchanged, got %s", body)
+	}
+
+	entries := rec.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	for _, secret := range []string{"wifi-secret", "broker-secret", "s3cret", "psk-secret", "hunter2"} {
+		if strings.Contains(e.URL+e.RequestBody+e.ResponseBody, secret) {
+			t.Errorf("Secret %q was recorded: %+v", secret, e)
+		}
+	}
+	if !strings.Contains(e.URL, "ssid=home") || !strings.Contains(e.ResponseBody, `"ssid":"home"`) {
+		t.Errorf("Expected non-secret values to be kept: %+v", e)
+	}
+	if e.StatusCode != http.StatusOK || e.Method != http.MethodPost {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+}
+
+func TestRecorderRingAndTruncation(t *testing.T) {
+	rec := NewRecorder(2, 4)
+	for _, url := range []string{"a", "b", "c"} {
+		rec.add(TraceEntry{URL: url})
+	}
+	entries := rec.Entries()
+	if len(entries) != 2 || entries[0].URL != "b" || entries[1].URL != "c" {
+		t.Errorf("Expected the two newest entries oldest first, got %+v", entries)
+	}
+
+	text, truncated := rec.body([]byte("plain text body"), "text/plain")
+	if text != "plai" || !truncated {
+		t.Errorf("Expected body truncated to 4 bytes, got %q (%v)", text, truncated)
+	}
+}
@@ -0,0 +1,47 @@
+package shelly
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+// NewLoggingTransport wraps base so every exchange with a device is logged at
+// debug level with the context of its request, which ties device calls to
+// the API request (or job) that made them
+func NewLoggingTransport(base http.RoundTripper, logger *logging.Logger) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if logger == nil {
+		logger = logging.GetDefault()
+	}
+	return &loggingTransport{base: base, logger: logger}
+}
+
+type loggingTransport struct {
+	base   http.RoundTripper
+	logger *logging.Logger
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	fields := map[string]any{
+		"method":      req.Method,
+		"url":         redactURL(req.URL),
+		"duration_ms": time.Since(start).Milliseconds(),
+		"component":   "device",
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		t.logger.WithFields(fields).DebugContext(req.Context(), "Device request failed")
+		return nil, err
+	}
+	fields["status_code"] = resp.StatusCode
+	t.logger.WithFields(fields).DebugContext(req.Context(), "Device request completed")
+	return resp, nil
+}
@@ -0,0 +1,148 @@
+package shelly
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// NetworkOptions selects how requests to devices leave the host. The zero
+// value uses the system routing table and no proxy.
+type NetworkOptions struct {
+	// SourceIP binds outbound connections to a local address, for
+	// multi-homed servers
+	SourceIP string
+	// Interface binds outbound connections to the first address of a
+	// network interface, looked up on every dial so address changes are
+	// picked up. Ignored when SourceIP is set.
+	Interface string
+	// Proxy reaches devices through an http://, https://, socks5:// or
+	// socks5h:// proxy, e.g. a jump host on a routed segment
+	Proxy string
+	// Limiter budgets the requests per network, shared by every transport
+	// using it
+	Limiter *RateLimiter
+}
+
+// IsZero reports whether no options are set
+func (o NetworkOptions) IsZero() bool {
+	return o.SourceIP == "" && o.Interface == "" && o.Proxy == "" && o.Limiter == nil
+}
+
+// Validate checks the source address and proxy URL
+func (o NetworkOptions) Validate() error {
+	if o.SourceIP != "" && net.ParseIP(o.SourceIP) == nil {
+		return fmt.Errorf("invalid source IP %q", o.SourceIP)
+	}
+	if o.Proxy != "" {
+		if _, err := parseProxy(o.Proxy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", raw)
+	}
+	return u, nil
+}
+
+// NewTransport returns an HTTP transport for device requests honouring the
+// network options
+func NewTransport(opts NetworkOptions, skipTLSVerify bool) (http.RoundTripper, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: skipTLSVerify,
+		},
+	}
+	if opts.IsZero() {
+		return transport, nil
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	switch {
+	case opts.SourceIP != "":
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(opts.SourceIP)}
+		transport.DialContext = dialer.DialContext
+	case opts.Interface != "":
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			local, err := interfaceAddr(opts.Interface, addr)
+			if err != nil {
+				return nil, err
+			}
+			d := *dialer
+			d.LocalAddr = local
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+	if opts.Proxy != "" {
+		proxyURL, _ := parseProxy(opts.Proxy)
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if opts.Limiter != nil {
+		return NewRateLimitedTransport(transport, opts.Limiter), nil
+	}
+	return transport, nil
+}
+
+// interfaceAddr returns the address of the named interface in the same
+// family as the destination
+func interfaceAddr(name, dest string) (*net.TCPAddr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", name, err)
+	}
+	wantV4 := true
+	if host, _, err := net.SplitHostPort(dest); err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			wantV4 = false
+		}
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if (ipNet.IP.To4() != nil) == wantV4 {
+			return &net.TCPAddr{IP: ipNet.IP}, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no usable address", name)
+}
+
+// FailingTransport returns a transport that fails every request with err,
+// so devices are not silently reached through another route when the
+// network options are invalid
+func FailingTransport(err error) http.RoundTripper {
+	return failingTransport{err: err}
+}
+
+type failingTransport struct{ err error }
+
+func (t failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	return nil, t.err
+}
@@ -0,0 +1,47 @@
+package shelly
+
+import (
+	"context"
+	"net/http"
+)
+
+// CallCounter is told about every device request made with a context
+// carrying it, e.g. to attribute device traffic to the API client that
+// caused it
+type CallCounter interface {
+	CountDeviceCall(host string)
+}
+
+type callCounterKey struct{}
+
+// WithCallCounter counts the device requests made with ctx in counter
+func WithCallCounter(ctx context.Context, counter CallCounter) context.Context {
+	return context.WithValue(ctx, callCounterKey{}, counter)
+}
+
+// CallCounterFrom returns the call counter of ctx, nil when unset
+func CallCounterFrom(ctx context.Context) CallCounter {
+	counter, _ := ctx.Value(callCounterKey{}).(CallCounter)
+	return counter
+}
+
+// NewCallCountingTransport wraps base so every request made with a context
+// carrying a CallCounter is counted there, whether or not the device answers
+func NewCallCountingTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &callCountingTransport{base: base}
+}
+
+type callCountingTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *callCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if counter := CallCounterFrom(req.Context()); counter != nil {
+		counter.CountDeviceCall(req.URL.Host)
+	}
+	return t.base.RoundTrip(req)
+}
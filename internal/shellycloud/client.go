@@ -0,0 +1,327 @@
+// Package shellycloud reads the devices registered to a Shelly Cloud account,
+// so existing cloud users can bootstrap the inventory from it.
+package shellycloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+var (
+	// ErrInvalidAccount is returned when the server or key is missing or malformed
+	ErrInvalidAccount = errors.New("invalid shelly cloud account")
+	// ErrUnauthorized is returned when the cloud rejects the authorization key
+	ErrUnauthorized = errors.New("shelly cloud rejected the authorization key")
+	// ErrUnavailable is returned when the cloud cannot be reached or answers
+	// with something other than a device list
+	ErrUnavailable = errors.New("shelly cloud unavailable")
+	// ErrNotSupported is returned when the cloud server does not offer a change
+	ErrNotSupported = errors.New("not supported by the shelly cloud server")
+)
+
+// maxResponseSize bounds a cloud response
+const maxResponseSize = 8 << 20
+
+// Client reads an account through the Shelly Cloud API. Server is the
+// account's server URI and AuthKey its authorization cloud key, both shown
+// in the Shelly app under User settings.
+type Client struct {
+	server     string
+	authKey    string
+	httpClient *http.Client
+	logger     *logging.Logger
+}
+
+// ClientConfig holds the account to read
+type ClientConfig struct {
+	Server  string        `json:"server"`
+	AuthKey string        `json:"auth_key"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+// Device is a device registered to the account. Multi-channel devices are
+// listed once, named after their first channel.
+type Device struct {
+	ID       string `json:"id"`
+	MAC      string `json:"mac"` // hex digits, upper case
+	Name     string `json:"name"`
+	Model    string `json:"model"`
+	Gen      int    `json:"gen,omitempty"`
+	Category string `json:"category,omitempty"`
+	Room     string `json:"room,omitempty"`
+	RoomID   int64  `json:"room_id,omitempty"`
+	IP       string `json:"ip,omitempty"`       // last address the device reported to the cloud
+	Online   bool   `json:"cloud_online"`       // connected to the cloud
+	Channels int    `json:"channels,omitempty"` // channels listed separately by the cloud
+}
+
+// NewClient creates a client for the account. The server may be given with
+// or without scheme ("shelly-49-eu.shelly.cloud"); https is assumed.
+//
+// The server is supplied by an administrator through an admin-only
+// endpoint; any host is accepted so regional and self-hosted servers work.
+func NewClient(cfg ClientConfig, logger *logging.Logger) (*Client, error) {
+	server := strings.TrimRight(strings.TrimSpace(cfg.Server), "/")
+	if server == "" {
+		return nil, fmt.Errorf("%w: server is required", ErrInvalidAccount)
+	}
+	if cfg.AuthKey == "" {
+		return nil, fmt.Errorf("%w: auth_key is required", ErrInvalidAccount)
+	}
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("%w: invalid server %q", ErrInvalidAccount, cfg.Server)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if logger == nil {
+		logger = logging.GetDefault()
+	}
+	return &Client{
+		server:     server,
+		authKey:    cfg.AuthKey,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		logger:     logger,
+	}, nil
+}
+
+// envelope is the response wrapper of every cloud call
+type envelope struct {
+	IsOK   bool            `json:"isok"`
+	Data   json.RawMessage `json:"data"`
+	Errors json.RawMessage `json:"errors"`
+}
+
+type cloudDevice struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Category    string `json:"category"`
+	Name        string `json:"name"`
+	RoomID      int64  `json:"room_id"`
+	Gen         any    `json:"gen"` // a number, or "G2" on some accounts
+	IP          string `json:"ip"`
+	MAC         string `json:"mac"`
+	CloudOnline bool   `json:"cloud_online"`
+}
+
+// Room is a room of the account
+type Room struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// Rooms returns the rooms of the account, ordered by ID
+func (c *Client) Rooms(ctx context.Context) ([]Room, error) {
+	var list struct {
+		Rooms map[string]Room `json:"rooms"`
+	}
+	if err := c.call(ctx, "/interface/room/list", nil, &list); err != nil {
+		return nil, err
+	}
+	rooms := make([]Room, 0, len(list.Rooms))
+	for key, r := range list.Rooms {
+		if r.ID == 0 {
+			r.ID, _ = strconv.ParseInt(key, 10, 64)
+		}
+		rooms = append(rooms, r)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+	return rooms, nil
+}
+
+// Devices returns the devices registered to the account, ordered by MAC
+func (c *Client) Devices(ctx context.Context) ([]Device, error) {
+	rooms, err := c.Rooms(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roomNames := make(map[int64]string, len(rooms))
+	for _, r := range rooms {
+		roomNames[r.ID] = r.Name
+	}
+
+	var list struct {
+		Devices map[string]cloudDevice `json:"devices"`
+	}
+	if err := c.call(ctx, "/interface/device/list", nil, &list); err != nil {
+		return nil, err
+	}
+
+	// Channels of one device are listed as "<id>_<channel>"
+	byID := map[string]*Device{}
+	firstChannel := map[string]int{}
+	for key, d := range list.Devices {
+		if d.ID == "" {
+			d.ID = key
+		}
+		base, channel := d.ID, 0
+		if i := strings.LastIndex(d.ID, "_"); i > 0 {
+			if n, err := strconv.Atoi(d.ID[i+1:]); err == nil {
+				base, channel = d.ID[:i], n
+			}
+		}
+		device := byID[base]
+		if device == nil {
+			device = &Device{ID: base}
+			byID[base] = device
+			firstChannel[base] = channel
+		}
+		device.Channels++
+		if channel > firstChannel[base] {
+			continue
+		}
+		firstChannel[base] = channel
+		mac := normalizeMAC(d.MAC)
+		if mac == "" {
+			mac = normalizeMAC(base)
+		}
+		device.MAC = mac
+		device.Name = strings.TrimSpace(d.Name)
+		device.Model = d.Type
+		device.Gen = generation(d.Gen)
+		device.Category = d.Category
+		device.Room = roomNames[d.RoomID]
+		device.RoomID = d.RoomID
+		device.IP = d.IP
+		device.Online = d.CloudOnline
+	}
+
+	devices := make([]Device, 0, len(byID))
+	for _, d := range byID {
+		if len(d.MAC) != 12 {
+			c.logger.WithFields(map[string]any{
+				"cloud_id":  d.ID,
+				"component": "shelly_cloud",
+			}).Warn("Skipping cloud device without a MAC address")
+			continue
+		}
+		if d.Channels == 1 {
+			d.Channels = 0
+		}
+		devices = append(devices, *d)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].MAC < devices[j].MAC })
+	return devices, nil
+}
+
+// SetDeviceName renames a device. The public control API has no rename, so
+// this uses the interface call of the Shelly web app; servers without it
+// return ErrNotSupported.
+func (c *Client) SetDeviceName(ctx context.Context, id, name string) error {
+	return c.change(ctx, "/interface/device/set_name", url.Values{"id": {id}, "name": {name}})
+}
+
+// SetDeviceRoom moves a device to an existing room, through the same
+// interface calls as SetDeviceName
+func (c *Client) SetDeviceRoom(ctx context.Context, id string, roomID int64) error {
+	return c.change(ctx, "/interface/device/set_room", url.Values{"id": {id}, "room_id": {strconv.FormatInt(roomID, 10)}})
+}
+
+// change performs a call that returns no data, mapping a missing endpoint
+// to ErrNotSupported
+func (c *Client) change(ctx context.Context, path string, params url.Values) error {
+	err := c.call(ctx, path, params, nil)
+	var status statusError
+	if errors.As(err, &status) && (status == http.StatusNotFound || status == http.StatusMethodNotAllowed) {
+		return fmt.Errorf("%w: %s", ErrNotSupported, path)
+	}
+	return err
+}
+
+// statusError is an unexpected HTTP status of the cloud
+type statusError int
+
+func (e statusError) Error() string { return fmt.Sprintf("HTTP %d", int(e)) }
+
+// call posts the authorization key and params to an API path and decodes
+// the data of the response into out, unless out is nil
+func (c *Client) call(ctx context.Context, path string, params url.Values, out any) error {
+	form := url.Values{"auth_key": {c.authKey}}
+	for key, values := range params {
+		form[key] = values
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.server+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	c.logger.WithFields(map[string]any{
+		"server":    c.server,
+		"path":      path,
+		"component": "shelly_cloud",
+	}).Debug("Calling Shelly Cloud API")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: request failed: %v", ErrUnavailable, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("%w: failed to read response: %v", ErrUnavailable, err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return ErrUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %w for %s", ErrUnavailable, statusError(resp.StatusCode), path)
+	}
+
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return fmt.Errorf("%w: invalid response for %s: %v", ErrUnavailable, path, err)
+	}
+	if !env.IsOK {
+		msg := strings.TrimSpace(string(env.Errors))
+		if strings.Contains(strings.ToLower(msg), "unauthorized") || strings.Contains(strings.ToLower(msg), "invalid_token") {
+			return ErrUnauthorized
+		}
+		return fmt.Errorf("%w: %s refused: %s", ErrUnavailable, path, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return fmt.Errorf("%w: invalid data for %s: %v", ErrUnavailable, path, err)
+	}
+	return nil
+}
+
+// generation reads the generation, given as a number or as "G2"
+func generation(v any) int {
+	switch g := v.(type) {
+	case float64:
+		return int(g)
+	case string:
+		n, _ := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(g), "G"))
+		return n
+	}
+	return 0
+}
+
+// normalizeMAC reduces a MAC or cloud device ID to upper-case hex digits; it
+// returns "" when anything else is left
+func normalizeMAC(s string) string {
+	hex := strings.ToUpper(strings.NewReplacer(":", "", "-", "").Replace(strings.TrimSpace(s)))
+	if strings.Trim(hex, "0123456789ABCDEF") != "" {
+		return ""
+	}
+	return hex
+}
@@ -0,0 +1,119 @@
+package shellycloud
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const roomList = `{"isok":true,"data":{"rooms":{"7":{"id":7,"name":"Kitchen"},"9":{"id":9,"name":"Garage"}}}}`
+
+const deviceList = `{"isok":true,"data":{"devices":{
+	"a8032ab1e2c4":{"id":"a8032ab1e2c4","type":"SNSW-001X16EU","name":"Kitchen light","room_id":7,"gen":2,"ip":"192.168.1.20","cloud_online":true},
+	"e868e7123456":{"id":"e868e7123456","type":"SHSW-25","name":"Gate","room_id":9,"gen":"G1","cloud_online":false},
+	"e868e7123456_1":{"id":"e868e7123456_1","type":"SHSW-25","name":"Garage door","room_id":9,"gen":"G1"},
+	"broken":{"id":"broken","type":"SHSW-1","name":"No MAC"}
+}}}`
+
+func newTestServer(t *testing.T, handler http.HandlerFunc) string {
+	if ln, err := net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+		t.Skipf("Skipping due to restricted socket permissions: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := NewClient(ClientConfig{Server: "shelly-49-eu.shelly.cloud/", AuthKey: "key"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://shelly-49-eu.shelly.cloud", client.server)
+
+	for _, cfg := range []ClientConfig{
+		{AuthKey: "key"},
+		{Server: "shelly-49-eu.shelly.cloud"},
+		{Server: "ftp://example.com", AuthKey: "key"},
+	} {
+		_, err := NewClient(cfg, nil)
+		assert.ErrorIs(t, err, ErrInvalidAccount, "config %+v", cfg)
+	}
+}
+
+func TestClient_Devices(t *testing.T) {
+	url := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.FormValue("auth_key") != "secret" {
+			_, _ = w.Write([]byte(`{"isok":false,"errors":{"wrong_token":"unauthorized"}}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/interface/room/list":
+			_, _ = w.Write([]byte(roomList))
+		case "/interface/device/list":
+			_, _ = w.Write([]byte(deviceList))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	client, err := NewClient(ClientConfig{Server: url, AuthKey: "secret"}, nil)
+	require.NoError(t, err)
+	devices, err := client.Devices(context.Background())
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+
+	assert.Equal(t, Device{
+		ID: "a8032ab1e2c4", MAC: "A8032AB1E2C4", Name: "Kitchen light", Model: "SNSW-001X16EU",
+		Gen: 2, Room: "Kitchen", RoomID: 7, IP: "192.168.1.20", Online: true,
+	}, devices[0])
+	assert.Equal(t, "E868E7123456", devices[1].MAC)
+	assert.Equal(t, "Gate", devices[1].Name, "expected the first channel to name the device")
+	assert.Equal(t, "Garage", devices[1].Room)
+	assert.Equal(t, 1, devices[1].Gen)
+	assert.Equal(t, 2, devices[1].Channels)
+
+	client, err = NewClient(ClientConfig{Server: url, AuthKey: "wrong"}, nil)
+	require.NoError(t, err)
+	_, err = client.Devices(context.Background())
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestClient_Unavailable(t *testing.T) {
+	url := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	client, err := NewClient(ClientConfig{Server: url, AuthKey: "secret"}, nil)
+	require.NoError(t, err)
+	_, err = client.Devices(context.Background())
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestClient_SetDeviceName(t *testing.T) {
+	var got url.Values
+	url := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/interface/device/set_name" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = r.ParseForm()
+		got = r.PostForm
+		_, _ = w.Write([]byte(`{"isok":true,"data":{}}`))
+	})
+	client, err := NewClient(ClientConfig{Server: url, AuthKey: "secret"}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, client.SetDeviceName(context.Background(), "a8032ab1e2c4", "Kitchen light"))
+	assert.Equal(t, "secret", got.Get("auth_key"))
+	assert.Equal(t, "a8032ab1e2c4", got.Get("id"))
+	assert.Equal(t, "Kitchen light", got.Get("name"))
+
+	err = client.SetDeviceRoom(context.Background(), "a8032ab1e2c4", 7)
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
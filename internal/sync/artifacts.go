@@ -0,0 +1,516 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// Storage tiers of export artifacts
+const (
+	ArtifactTierLocal   = "local"   // on local disk
+	ArtifactTierObject  = "object"  // moved to object storage
+	ArtifactTierDeleted = "deleted" // removed past retention; the record stays
+)
+
+var (
+	// ErrArtifactNotFound is returned for exports without a stored artifact
+	ErrArtifactNotFound = errors.New("artifact not found")
+	// ErrArtifactUnavailable is wrapped when an artifact cannot be read or
+	// restored in its tier, e.g. once deleted past retention
+	ErrArtifactUnavailable = errors.New("artifact unavailable")
+	// ErrObjectStorage is wrapped when reading an artifact from object
+	// storage fails
+	ErrObjectStorage = errors.New("object storage request failed")
+	// ErrInvalidArtifactTier is wrapped for unknown tier filters
+	ErrInvalidArtifactTier = errors.New("invalid artifact tier")
+)
+
+// ArtifactLifecycle moves artifacts between storage tiers. Artifacts older
+// than LocalFor move to Store, those older than RetainFor are deleted; zero
+// durations and a nil Store leave them where they are.
+type ArtifactLifecycle struct {
+	Store     ObjectStore
+	Prefix    string // prepended to object keys
+	LocalFor  time.Duration
+	RetainFor time.Duration
+}
+
+// Artifact is the file of a successful export, in whichever tier it is
+type Artifact struct {
+	ExportID       string     `json:"export_id"`
+	Plugin         string     `json:"plugin"`
+	Format         string     `json:"format"`
+	Name           string     `json:"name,omitempty"`
+	Tier           string     `json:"tier"`
+	Location       string     `json:"location,omitempty"` // local path, or s3://bucket/key
+	Size           int64      `json:"size"`
+	Checksum       string     `json:"checksum,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	TransitionedAt *time.Time `json:"transitioned_at,omitempty"`
+	RestoredAt     *time.Time `json:"restored_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"` // deletion under retention
+	Restorable     bool       `json:"restorable"`
+}
+
+// ArtifactFilter narrows the artifact list. Deleted artifacts are listed
+// only when Tier asks for them.
+type ArtifactFilter struct {
+	Tier   string
+	Plugin string
+}
+
+// ArtifactLifecycleReport is the outcome of one lifecycle run
+type ArtifactLifecycleReport struct {
+	Transitioned int                        `json:"transitioned"`
+	Deleted      int                        `json:"deleted"`
+	Failed       []ArtifactLifecycleFailure `json:"failed"`
+}
+
+// ArtifactLifecycleFailure is an artifact a lifecycle run could not move
+type ArtifactLifecycleFailure struct {
+	ExportID string `json:"export_id"`
+	Error    string `json:"error"`
+}
+
+// SetArtifactLifecycle sets the tiers and ages artifacts move through
+func (e *SyncEngine) SetArtifactLifecycle(lifecycle ArtifactLifecycle) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.lifecycle = lifecycle
+}
+
+func (e *SyncEngine) artifactLifecycle() ArtifactLifecycle {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.lifecycle
+}
+
+// artifactTier returns the tier of a record; records from before tiers are
+// local
+func artifactTier(rec *database.ExportHistory) string {
+	if rec.StorageTier == "" {
+		return ArtifactTierLocal
+	}
+	return rec.StorageTier
+}
+
+// toArtifact describes the artifact of rec under lifecycle
+func toArtifact(rec *database.ExportHistory, lifecycle ArtifactLifecycle) Artifact {
+	a := Artifact{
+		ExportID:       rec.ExportID,
+		Plugin:         rec.PluginName,
+		Format:         rec.Format,
+		Name:           rec.Name,
+		Tier:           artifactTier(rec),
+		Size:           rec.FileSize,
+		Checksum:       rec.Checksum,
+		CreatedAt:      rec.CreatedAt,
+		TransitionedAt: rec.TransitionedAt,
+		RestoredAt:     rec.RestoredAt,
+	}
+	switch a.Tier {
+	case ArtifactTierLocal:
+		a.Location = rec.FilePath
+	case ArtifactTierObject:
+		a.Location = rec.ObjectKey
+		if lifecycle.Store != nil {
+			a.Location = lifecycle.Store.Location(rec.ObjectKey)
+			a.Restorable = true
+		}
+	}
+	if lifecycle.RetainFor > 0 && a.Tier != ArtifactTierDeleted {
+		expires := rec.CreatedAt.Add(lifecycle.RetainFor)
+		a.ExpiresAt = &expires
+	}
+	return a
+}
+
+// artifactQuery selects the export records with an artifact
+func (e *SyncEngine) artifactQuery(ctx context.Context) *gorm.DB {
+	db := e.dbManager.GetDB()
+	if db == nil {
+		return nil
+	}
+	return db.WithContext(ctx).Model(&database.ExportHistory{}).Where("success = ? AND file_path <> ?", true, "")
+}
+
+// ListArtifacts returns the artifacts of successful exports, newest first
+func (e *SyncEngine) ListArtifacts(ctx context.Context, filter ArtifactFilter, page, pageSize int) ([]Artifact, int, error) {
+	q := e.artifactQuery(ctx)
+	if q == nil {
+		return []Artifact{}, 0, nil
+	}
+	switch filter.Tier {
+	case "":
+		q = q.Where("storage_tier IS NULL OR storage_tier <> ?", ArtifactTierDeleted)
+	case ArtifactTierLocal:
+		q = q.Where("storage_tier IS NULL OR storage_tier IN ?", []string{"", ArtifactTierLocal})
+	case ArtifactTierObject, ArtifactTierDeleted:
+		q = q.Where("storage_tier = ?", filter.Tier)
+	default:
+		return nil, 0, fmt.Errorf("%w: %q", ErrInvalidArtifactTier, filter.Tier)
+	}
+	if filter.Plugin != "" {
+		q = q.Where("plugin_name = ?", filter.Plugin)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var records []database.ExportHistory
+	if err := q.Order("created_at desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+	lifecycle := e.artifactLifecycle()
+	artifacts := make([]Artifact, 0, len(records))
+	for i := range records {
+		artifacts = append(artifacts, toArtifact(&records[i], lifecycle))
+	}
+	return artifacts, int(total), nil
+}
+
+// artifactRecord loads the export record of an artifact
+func (e *SyncEngine) artifactRecord(ctx context.Context, exportID string) (*database.ExportHistory, error) {
+	q := e.artifactQuery(ctx)
+	if q == nil {
+		return nil, ErrArtifactNotFound
+	}
+	var rec database.ExportHistory
+	if err := q.Where("export_id = ?", exportID).First(&rec).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrArtifactNotFound
+		}
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// GetArtifact returns the artifact of an export
+func (e *SyncEngine) GetArtifact(ctx context.Context, exportID string) (*Artifact, error) {
+	rec, err := e.artifactRecord(ctx, exportID)
+	if err != nil {
+		return nil, err
+	}
+	a := toArtifact(rec, e.artifactLifecycle())
+	return &a, nil
+}
+
+// OpenArtifact opens the artifact file of an export from its tier. Artifacts
+// that are directories can only be read locally.
+func (e *SyncEngine) OpenArtifact(ctx context.Context, exportID string) (io.ReadCloser, *Artifact, error) {
+	rec, err := e.artifactRecord(ctx, exportID)
+	if err != nil {
+		return nil, nil, err
+	}
+	lifecycle := e.artifactLifecycle()
+	a := toArtifact(rec, lifecycle)
+	switch a.Tier {
+	case ArtifactTierLocal:
+		f, err := os.Open(rec.FilePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrArtifactUnavailable, err)
+		}
+		return f, &a, nil
+	case ArtifactTierObject:
+		if lifecycle.Store == nil {
+			return nil, nil, fmt.Errorf("%w: object storage is not configured", ErrArtifactUnavailable)
+		}
+		body, err := lifecycle.Store.Get(ctx, rec.ObjectKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrObjectStorage, err)
+		}
+		return body, &a, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: deleted past retention", ErrArtifactUnavailable)
+	}
+}
+
+// RestoreArtifact brings an artifact back from object storage to its local
+// path, checking it against the hash taken on upload, and removes the object.
+// A restored artifact stays local for another lifecycle LocalFor.
+func (e *SyncEngine) RestoreArtifact(ctx context.Context, exportID string) (*Artifact, error) {
+	rec, err := e.artifactRecord(ctx, exportID)
+	if err != nil {
+		return nil, err
+	}
+	lifecycle := e.artifactLifecycle()
+	switch artifactTier(rec) {
+	case ArtifactTierLocal:
+		a := toArtifact(rec, lifecycle)
+		return &a, nil
+	case ArtifactTierDeleted:
+		return nil, fmt.Errorf("%w: deleted past retention", ErrArtifactUnavailable)
+	}
+	if lifecycle.Store == nil {
+		return nil, fmt.Errorf("%w: object storage is not configured", ErrArtifactUnavailable)
+	}
+
+	if err := downloadObject(ctx, lifecycle.Store, rec.ObjectKey, rec.FilePath, rec.ObjectSHA256); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrObjectStorage, err)
+	}
+	manifestKey := rec.ObjectKey + ManifestSuffix
+	if err := downloadObject(ctx, lifecycle.Store, manifestKey, rec.FilePath+ManifestSuffix, ""); err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return nil, fmt.Errorf("%w: manifest: %v", ErrObjectStorage, err)
+	}
+
+	now := e.clock.Now()
+	objectKey := rec.ObjectKey
+	if err := e.dbManager.GetDB().WithContext(ctx).Model(rec).Updates(map[string]interface{}{
+		"storage_tier":    ArtifactTierLocal,
+		"object_key":      "",
+		"object_sha256":   "",
+		"transitioned_at": now,
+		"restored_at":     now,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to record restore: %w", err)
+	}
+	e.deleteObjects(ctx, lifecycle.Store, rec.ExportID, objectKey)
+
+	e.logger.WithFields(map[string]any{
+		"export_id": rec.ExportID,
+		"path":      rec.FilePath,
+		"component": "artifact_lifecycle",
+	}).Info("Artifact restored from object storage")
+	a := toArtifact(rec, lifecycle)
+	return &a, nil
+}
+
+// RunArtifactLifecycle moves local artifacts older than LocalFor to object
+// storage and deletes artifacts older than RetainFor from every tier.
+// Directory artifacts stay local until retention.
+func (e *SyncEngine) RunArtifactLifecycle(ctx context.Context) (*ArtifactLifecycleReport, error) {
+	report := &ArtifactLifecycleReport{Failed: []ArtifactLifecycleFailure{}}
+	q := e.artifactQuery(ctx)
+	if q == nil {
+		return report, nil
+	}
+	lifecycle := e.artifactLifecycle()
+	now := e.clock.Now()
+	fail := func(rec *database.ExportHistory, err error) {
+		report.Failed = append(report.Failed, ArtifactLifecycleFailure{ExportID: rec.ExportID, Error: err.Error()})
+		e.logger.WithFields(map[string]any{
+			"export_id": rec.ExportID,
+			"error":     err.Error(),
+			"component": "artifact_lifecycle",
+		}).Warn("Artifact lifecycle step failed")
+	}
+
+	if lifecycle.RetainFor > 0 {
+		var expired []database.ExportHistory
+		if err := q.Session(&gorm.Session{}).
+			Where("storage_tier IS NULL OR storage_tier <> ?", ArtifactTierDeleted).
+			Where("created_at < ?", now.Add(-lifecycle.RetainFor)).
+			Find(&expired).Error; err != nil {
+			return nil, fmt.Errorf("failed to load expired artifacts: %w", err)
+		}
+		for i := range expired {
+			if err := e.expireArtifact(ctx, &expired[i], lifecycle); err != nil {
+				fail(&expired[i], err)
+				continue
+			}
+			report.Deleted++
+		}
+	}
+
+	if lifecycle.Store != nil && lifecycle.LocalFor > 0 {
+		cutoff := now.Add(-lifecycle.LocalFor)
+		var aged []database.ExportHistory
+		if err := q.Session(&gorm.Session{}).
+			Where("storage_tier IS NULL OR storage_tier IN ?", []string{"", ArtifactTierLocal}).
+			Where("created_at < ?", cutoff).
+			Order("created_at").
+			Find(&aged).Error; err != nil {
+			return nil, fmt.Errorf("failed to load local artifacts: %w", err)
+		}
+		for i := range aged {
+			rec := &aged[i]
+			if rec.RestoredAt != nil && rec.RestoredAt.After(cutoff) {
+				continue // restored recently; give it another LocalFor
+			}
+			moved, err := e.transitionArtifact(ctx, rec, lifecycle)
+			if err != nil {
+				fail(rec, err)
+				continue
+			}
+			if moved {
+				report.Transitioned++
+			}
+		}
+	}
+
+	if report.Transitioned > 0 || report.Deleted > 0 || len(report.Failed) > 0 {
+		e.logger.WithFields(map[string]any{
+			"transitioned": report.Transitioned,
+			"deleted":      report.Deleted,
+			"failed":       len(report.Failed),
+			"component":    "artifact_lifecycle",
+		}).Info("Artifact lifecycle run finished")
+	}
+	return report, nil
+}
+
+// transitionArtifact uploads a local artifact file and its manifest to
+// object storage, then removes them locally. It reports false for
+// directory artifacts, which are left in place.
+func (e *SyncEngine) transitionArtifact(ctx context.Context, rec *database.ExportHistory, lifecycle ArtifactLifecycle) (bool, error) {
+	info, err := os.Stat(rec.FilePath)
+	if err != nil {
+		return false, fmt.Errorf("artifact file: %w", err)
+	}
+	if info.IsDir() {
+		return false, nil
+	}
+
+	key := lifecycle.Prefix + rec.PluginName + "/" + rec.ExportID + "/" + filepath.Base(rec.FilePath)
+	sum, err := uploadFile(ctx, lifecycle.Store, key, rec.FilePath)
+	if err != nil {
+		return false, err
+	}
+	manifest := rec.FilePath + ManifestSuffix
+	if _, err := os.Stat(manifest); err == nil {
+		if _, err := uploadFile(ctx, lifecycle.Store, key+ManifestSuffix, manifest); err != nil {
+			return false, err
+		}
+	}
+
+	if err := e.dbManager.GetDB().WithContext(ctx).Model(rec).Updates(map[string]interface{}{
+		"storage_tier":    ArtifactTierObject,
+		"object_key":      key,
+		"object_sha256":   sum,
+		"transitioned_at": e.clock.Now(),
+	}).Error; err != nil {
+		return false, fmt.Errorf("failed to record transition: %w", err)
+	}
+	_ = os.Remove(manifest)
+	_ = os.Remove(rec.FilePath)
+	e.forgetExportResult(rec.ExportID)
+
+	e.logger.WithFields(map[string]any{
+		"export_id": rec.ExportID,
+		"location":  lifecycle.Store.Location(key),
+		"size":      info.Size(),
+		"component": "artifact_lifecycle",
+	}).Info("Artifact moved to object storage")
+	return true, nil
+}
+
+// expireArtifact deletes an artifact past retention from its tier and keeps
+// its record as deleted
+func (e *SyncEngine) expireArtifact(ctx context.Context, rec *database.ExportHistory, lifecycle ArtifactLifecycle) error {
+	switch artifactTier(rec) {
+	case ArtifactTierObject:
+		if lifecycle.Store == nil {
+			return fmt.Errorf("object storage is not configured")
+		}
+		if err := lifecycle.Store.Delete(ctx, rec.ObjectKey); err != nil {
+			return err
+		}
+		_ = lifecycle.Store.Delete(ctx, rec.ObjectKey+ManifestSuffix)
+	default:
+		if err := os.Remove(rec.FilePath + ManifestSuffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Remove(rec.FilePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := e.dbManager.GetDB().WithContext(ctx).Model(rec).Updates(map[string]interface{}{
+		"storage_tier":    ArtifactTierDeleted,
+		"transitioned_at": e.clock.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record deletion: %w", err)
+	}
+	e.forgetExportResult(rec.ExportID)
+
+	e.logger.WithFields(map[string]any{
+		"export_id": rec.ExportID,
+		"component": "artifact_lifecycle",
+	}).Info("Artifact deleted past retention")
+	return nil
+}
+
+// deleteObjects removes an artifact and its manifest from object storage,
+// logging failures
+func (e *SyncEngine) deleteObjects(ctx context.Context, store ObjectStore, exportID, key string) {
+	for _, k := range []string{key, key + ManifestSuffix} {
+		if err := store.Delete(ctx, k); err != nil {
+			e.logger.WithFields(map[string]any{
+				"export_id": exportID,
+				"key":       k,
+				"error":     err.Error(),
+				"component": "artifact_lifecycle",
+			}).Warn("Failed to delete artifact object")
+		}
+	}
+}
+
+// forgetExportResult drops the in-memory result of an export, so downloads
+// go through its stored record
+func (e *SyncEngine) forgetExportResult(exportID string) {
+	e.mutex.Lock()
+	delete(e.exportResults, exportID)
+	e.mutex.Unlock()
+}
+
+// uploadFile stores the file at path under key and returns its SHA-256
+func uploadFile(ctx context.Context, store ObjectStore, key, path string) (string, error) {
+	sum, err := FileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if err := store.Put(ctx, key, f, info.Size(), sum); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// downloadObject writes the object under key to path through a temporary
+// file, checking it against sum when set
+func downloadObject(ctx context.Context, store ObjectStore, key, path, sum string) error {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".restore-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if got := fmt.Sprintf("%x", hash.Sum(nil)); sum != "" && got != sum {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", key, got, sum)
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,162 @@
+package sync_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	syncengine "github.com/ginsys/shelly-manager/internal/sync"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+// fakeObjectStorage is an S3-compatible bucket in memory that insists on
+// signed requests
+type fakeObjectStorage struct {
+	mu      gosync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeObjectStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/artifacts/")
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if fmt.Sprintf("%x", sha256.Sum256(body)) != r.Header.Get("X-Amz-Content-Sha256") {
+			http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = body
+	case http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestArtifactLifecycle(t *testing.T) {
+	db, cleanup := testutil.TestDatabaseMemory(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+
+	bucket := &fakeObjectStorage{objects: map[string][]byte{}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+	store, err := syncengine.NewS3Store(server.URL, "", "artifacts", "AK", "SK")
+	require.NoError(t, err)
+
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := testutil.NewFakeClock(now)
+	engine := syncengine.NewSyncEngine(db, logger)
+	engine.SetClock(clock)
+	engine.SetArtifactLifecycle(syncengine.ArtifactLifecycle{
+		Store:     store,
+		Prefix:    "sm/",
+		LocalFor:  30 * 24 * time.Hour,
+		RetainFor: 365 * 24 * time.Hour,
+	})
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	artifact := func(id string, age time.Duration) string {
+		path := filepath.Join(dir, id+".db.gz")
+		require.NoError(t, os.WriteFile(path, []byte("backup "+id), 0o600))
+		require.NoError(t, db.GetDB().Create(&database.ExportHistory{
+			ExportID: id, PluginName: "backup", Format: "sqlite", Success: true,
+			FilePath: path, FileSize: int64(len("backup " + id)), StorageTier: syncengine.ArtifactTierLocal,
+			CreatedAt: now.Add(-age),
+		}).Error)
+		return path
+	}
+	recent := artifact("recent", 24*time.Hour)
+	old := artifact("old", 40*24*time.Hour)
+	require.NoError(t, os.WriteFile(old+syncengine.ManifestSuffix, []byte(`{"version":1}`), 0o600))
+	ancient := artifact("ancient", 400*24*time.Hour)
+
+	report, err := engine.RunArtifactLifecycle(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Transitioned)
+	require.Equal(t, 1, report.Deleted)
+	require.Empty(t, report.Failed)
+	require.NoFileExists(t, old)
+	require.NoFileExists(t, ancient)
+	require.FileExists(t, recent)
+	require.Equal(t, []byte("backup old"), bucket.objects["sm/backup/old/old.db.gz"])
+	require.Contains(t, bucket.objects, "sm/backup/old/old.db.gz"+syncengine.ManifestSuffix)
+
+	// Deleted artifacts are only listed on request
+	listed, total, err := engine.ListArtifacts(ctx, syncengine.ArtifactFilter{}, 1, 20)
+	require.NoError(t, err)
+	require.Equal(t, 2, total)
+	require.Equal(t, "recent", listed[0].ExportID)
+	moved, _, err := engine.ListArtifacts(ctx, syncengine.ArtifactFilter{Tier: syncengine.ArtifactTierObject}, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, moved, 1)
+	require.Equal(t, "s3://artifacts/sm/backup/old/old.db.gz", moved[0].Location)
+	require.True(t, moved[0].Restorable)
+	gone, _, err := engine.ListArtifacts(ctx, syncengine.ArtifactFilter{Tier: syncengine.ArtifactTierDeleted}, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, gone, 1)
+	_, _, err = engine.ListArtifacts(ctx, syncengine.ArtifactFilter{Tier: "glacier"}, 1, 20)
+	require.ErrorIs(t, err, syncengine.ErrInvalidArtifactTier)
+
+	// Moved artifacts are read from the bucket
+	body, _, err := engine.OpenArtifact(ctx, "old")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	_ = body.Close()
+	require.Equal(t, "backup old", string(data))
+	_, _, err = engine.OpenArtifact(ctx, "ancient")
+	require.ErrorIs(t, err, syncengine.ErrArtifactUnavailable)
+
+	restored, err := engine.RestoreArtifact(ctx, "old")
+	require.NoError(t, err)
+	require.Equal(t, syncengine.ArtifactTierLocal, restored.Tier)
+	require.FileExists(t, old)
+	require.FileExists(t, old+syncengine.ManifestSuffix)
+	require.Empty(t, bucket.objects)
+
+	// A restored artifact stays local for another 30 days
+	report, err = engine.RunArtifactLifecycle(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, report.Transitioned)
+
+	clock.Advance(31 * 24 * time.Hour)
+	report, err = engine.RunArtifactLifecycle(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Transitioned)
+
+	// A corrupted object is not restored
+	bucket.objects["sm/backup/old/old.db.gz"] = []byte("tampered")
+	_, err = engine.RestoreArtifact(ctx, "old")
+	require.ErrorIs(t, err, syncengine.ErrObjectStorage)
+	require.NoFileExists(t, old)
+
+	_, err = engine.GetArtifact(ctx, "missing")
+	require.ErrorIs(t, err, syncengine.ErrArtifactNotFound)
+}
@@ -0,0 +1,200 @@
+package sync
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+)
+
+// jsonSchemaDialect is the JSON Schema version JSONSchema produces
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// FieldError is a problem with one configuration setting; Field is empty for
+// problems with the configuration as a whole
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// JSONSchema renders the schema as a JSON Schema object, so UIs can build
+// forms from it. Sensitive settings are marked writeOnly, and strings among
+// them use the password format.
+func (s ConfigSchema) JSONSchema() map[string]interface{} {
+	schema := map[string]interface{}{
+		"$schema":    jsonSchemaDialect,
+		"type":       "object",
+		"properties": jsonSchemaProperties(s.Properties),
+	}
+	if len(s.Required) > 0 {
+		schema["required"] = s.Required
+	}
+	if s.Version != "" {
+		schema["$comment"] = "version " + s.Version
+	}
+	if len(s.Examples) > 0 {
+		schema["examples"] = s.Examples
+	}
+	return schema
+}
+
+func jsonSchemaProperties(properties map[string]PropertySchema) map[string]interface{} {
+	out := make(map[string]interface{}, len(properties))
+	for name, prop := range properties {
+		out[name] = prop.jsonSchema()
+	}
+	return out
+}
+
+func (p PropertySchema) jsonSchema() map[string]interface{} {
+	schema := map[string]interface{}{}
+	if p.Type != "" {
+		schema["type"] = p.Type
+	}
+	if p.Description != "" {
+		schema["description"] = p.Description
+	}
+	if p.Default != nil {
+		schema["default"] = p.Default
+	}
+	if len(p.Enum) > 0 {
+		schema["enum"] = p.Enum
+	}
+	if p.Pattern != "" {
+		schema["pattern"] = p.Pattern
+	}
+	if p.Minimum != nil {
+		schema["minimum"] = *p.Minimum
+	}
+	if p.Maximum != nil {
+		schema["maximum"] = *p.Maximum
+	}
+	if p.Items != nil {
+		schema["items"] = p.Items.jsonSchema()
+	}
+	if len(p.Properties) > 0 {
+		schema["properties"] = jsonSchemaProperties(p.Properties)
+	}
+	if p.Sensitive {
+		schema["writeOnly"] = true
+		if p.Type == "string" {
+			schema["format"] = "password"
+		}
+	}
+	return schema
+}
+
+// Validate checks config against the schema: required settings, types,
+// enums, patterns and bounds. Settings the schema does not describe are left
+// to the plugin. Problems are reported by setting, in name order.
+func (s ConfigSchema) Validate(config map[string]interface{}) []FieldError {
+	var problems []FieldError
+	for _, name := range s.Required {
+		if v, ok := config[name]; !ok || v == nil {
+			problems = append(problems, FieldError{Field: name, Message: "is required"})
+		}
+	}
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if prop, ok := s.Properties[name]; ok && config[name] != nil {
+			problems = append(problems, prop.validate(name, config[name])...)
+		}
+	}
+	return problems
+}
+
+func (p PropertySchema) validate(field string, value interface{}) []FieldError {
+	fail := func(format string, args ...interface{}) []FieldError {
+		return []FieldError{{Field: field, Message: fmt.Sprintf(format, args...)}}
+	}
+	switch p.Type {
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fail("must be a string")
+		}
+		if p.Pattern != "" {
+			re, err := regexp.Compile(p.Pattern)
+			if err == nil && !re.MatchString(str) {
+				return fail("must match %s", p.Pattern)
+			}
+		}
+	case "number", "integer":
+		n, ok := toFloat(value)
+		if !ok {
+			return fail("must be a number")
+		}
+		if p.Type == "integer" && n != math.Trunc(n) {
+			return fail("must be a whole number")
+		}
+		if p.Minimum != nil && n < *p.Minimum {
+			return fail("must be at least %v", *p.Minimum)
+		}
+		if p.Maximum != nil && n > *p.Maximum {
+			return fail("must be at most %v", *p.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("must be true or false")
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			if _, isStrings := value.([]string); isStrings {
+				return nil
+			}
+			return fail("must be a list")
+		}
+		if p.Items != nil {
+			var problems []FieldError
+			for i, item := range items {
+				problems = append(problems, p.Items.validate(fmt.Sprintf("%s[%d]", field, i), item)...)
+			}
+			return problems
+		}
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fail("must be an object")
+		}
+		var problems []FieldError
+		for _, e := range (ConfigSchema{Properties: p.Properties}).Validate(obj) {
+			problems = append(problems, FieldError{Field: field + "." + e.Field, Message: e.Message})
+		}
+		return problems
+	}
+	if len(p.Enum) > 0 {
+		for _, allowed := range p.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return nil
+			}
+		}
+		return fail("must be one of %v", p.Enum)
+	}
+	return nil
+}
+
+// toFloat converts the numbers JSON decoding and Go callers produce
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,361 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// MergeStrategy decides which side wins when an imported field differs from
+// the value already in the inventory
+type MergeStrategy string
+
+const (
+	MergePreferImport   MergeStrategy = "prefer-import"
+	MergePreferExisting MergeStrategy = "prefer-existing"
+	MergeNewestWins     MergeStrategy = "newest-wins"
+	MergeManualReview   MergeStrategy = "manual-review"
+)
+
+// FieldClass groups device fields that share a merge strategy
+type FieldClass string
+
+const (
+	FieldClassIdentity FieldClass = "identity" // type
+	FieldClassNetwork  FieldClass = "network"  // ip
+	FieldClassConfig   FieldClass = "config"   // settings, per key
+	FieldClassMetadata FieldClass = "metadata" // name
+)
+
+// Conflict decision outcomes
+const (
+	DecisionImport   = "import"
+	DecisionExisting = "existing"
+	DecisionReview   = "review"
+)
+
+// Import conflict review states
+const (
+	ConflictStatusPending  = "pending"
+	ConflictStatusAccepted = "accepted"
+	ConflictStatusRejected = "rejected"
+)
+
+// ConflictPolicy selects a merge strategy per field class. Classes without an
+// explicit strategy use Default, which itself defaults to prefer-import.
+type ConflictPolicy struct {
+	Default MergeStrategy                `json:"default,omitempty"`
+	Fields  map[FieldClass]MergeStrategy `json:"fields,omitempty"`
+}
+
+// ConflictDecision records how a single conflicting field was resolved
+type ConflictDecision struct {
+	ResourceID    string        `json:"resource_id"`
+	Field         string        `json:"field"`
+	FieldClass    FieldClass    `json:"field_class"`
+	Strategy      MergeStrategy `json:"strategy"`
+	Outcome       string        `json:"outcome"` // "import", "existing", "review"
+	ExistingValue interface{}   `json:"existing_value,omitempty"`
+	ImportValue   interface{}   `json:"import_value,omitempty"`
+	Reason        string        `json:"reason"`
+}
+
+func validMergeStrategy(s MergeStrategy) bool {
+	switch s {
+	case MergePreferImport, MergePreferExisting, MergeNewestWins, MergeManualReview:
+		return true
+	}
+	return false
+}
+
+// Validate checks that every strategy and field class is known
+func (p *ConflictPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Default != "" && !validMergeStrategy(p.Default) {
+		return fmt.Errorf("unknown merge strategy: %s", p.Default)
+	}
+	for class, strategy := range p.Fields {
+		switch class {
+		case FieldClassIdentity, FieldClassNetwork, FieldClassConfig, FieldClassMetadata:
+		default:
+			return fmt.Errorf("unknown field class: %s", class)
+		}
+		if !validMergeStrategy(strategy) {
+			return fmt.Errorf("unknown merge strategy for %s: %s", class, strategy)
+		}
+	}
+	return nil
+}
+
+// StrategyFor returns the strategy applied to a field class
+func (p *ConflictPolicy) StrategyFor(class FieldClass) MergeStrategy {
+	if p == nil {
+		return MergePreferImport
+	}
+	if s, ok := p.Fields[class]; ok && s != "" {
+		return s
+	}
+	if p.Default != "" {
+		return p.Default
+	}
+	return MergePreferImport
+}
+
+// decide resolves a conflict for the given strategy. existingAt and importAt
+// are only consulted by newest-wins; importAt is the modified_at timestamp
+// the artifact carries, and without one the existing value is kept.
+func decide(strategy MergeStrategy, existingAt, importAt time.Time) (string, string) {
+	switch strategy {
+	case MergePreferExisting:
+		return DecisionExisting, "existing value preferred"
+	case MergeManualReview:
+		return DecisionReview, "queued for manual review"
+	case MergeNewestWins:
+		if importAt.IsZero() {
+			return DecisionExisting, "import carries no modified_at timestamp"
+		}
+		if importAt.After(existingAt) {
+			return DecisionImport, "import is newer"
+		}
+		return DecisionExisting, "existing value is newer"
+	default:
+		return DecisionImport, "imported value preferred"
+	}
+}
+
+// planDeviceMerge compares an existing device with its imported counterpart
+// and returns one decision per conflicting field. Settings are compared per
+// key, as settings.<key>, so keys the import leaves out, e.g. through the
+// GitOps exclude_fields, are kept. Empty imported values mean "not
+// specified" and never conflict.
+func planDeviceMerge(existing *database.Device, imported GitOpsDevice, policy *ConflictPolicy, forceOverwrite bool) []ConflictDecision {
+	type conflict struct {
+		field         string
+		class         FieldClass
+		existingValue interface{}
+		importValue   interface{}
+	}
+	var conflicts []conflict
+
+	if imported.Type != "" && imported.Type != existing.Type {
+		conflicts = append(conflicts, conflict{"type", FieldClassIdentity, existing.Type, imported.Type})
+	}
+	if imported.IP != "" && imported.IP != existing.IP {
+		conflicts = append(conflicts, conflict{"ip", FieldClassNetwork, existing.IP, imported.IP})
+	}
+	if imported.Name != "" && imported.Name != existing.Name {
+		conflicts = append(conflicts, conflict{"name", FieldClassMetadata, existing.Name, imported.Name})
+	}
+	if settings := normalizeJSONMap(imported.Settings()); len(settings) > 0 {
+		var current map[string]interface{}
+		_ = json.Unmarshal([]byte(existing.Settings), &current)
+		keys := make([]string, 0, len(settings))
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if value, ok := current[key]; !ok || !reflect.DeepEqual(settings[key], value) {
+				conflicts = append(conflicts, conflict{"settings." + key, FieldClassConfig, current[key], settings[key]})
+			}
+		}
+	}
+
+	decisions := make([]ConflictDecision, 0, len(conflicts))
+	for _, c := range conflicts {
+		d := ConflictDecision{
+			ResourceID:    existing.MAC,
+			Field:         c.field,
+			FieldClass:    c.class,
+			ExistingValue: c.existingValue,
+			ImportValue:   c.importValue,
+		}
+		if forceOverwrite {
+			d.Strategy = MergePreferImport
+			d.Outcome, d.Reason = DecisionImport, "force_overwrite set"
+		} else {
+			d.Strategy = policy.StrategyFor(c.class)
+			d.Outcome, d.Reason = decide(d.Strategy, existing.UpdatedAt, imported.ModifiedAt)
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions
+}
+
+// applyDeviceField sets an imported value on a device. settings merges the
+// imported keys into the device settings and settings.<key> sets one key;
+// other keys are kept either way.
+func applyDeviceField(device *database.Device, field string, value interface{}) error {
+	if key, ok := strings.CutPrefix(field, "settings."); ok {
+		return mergeDeviceSettings(device, map[string]interface{}{key: value})
+	}
+	switch field {
+	case "name", "type", "ip":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("invalid value for %s", field)
+		}
+		switch field {
+		case "name":
+			device.Name = s
+		case "type":
+			device.Type = s
+		case "ip":
+			device.IP = s
+		}
+	case "settings":
+		settings, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid value for %s", field)
+		}
+		return mergeDeviceSettings(device, settings)
+	default:
+		return fmt.Errorf("unsupported field: %s", field)
+	}
+	return nil
+}
+
+// mergeDeviceSettings sets the given keys in the device settings
+func mergeDeviceSettings(device *database.Device, values map[string]interface{}) error {
+	current := map[string]interface{}{}
+	if device.Settings != "" {
+		if err := json.Unmarshal([]byte(device.Settings), &current); err != nil || current == nil {
+			current = map[string]interface{}{}
+		}
+	}
+	for key, value := range values {
+		current[key] = value
+	}
+	buf, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("invalid settings: %w", err)
+	}
+	device.Settings = string(buf)
+	return nil
+}
+
+// newImportConflict builds the review queue record for a decision
+func newImportConflict(importID string, d ConflictDecision) (*database.ImportConflict, error) {
+	existing, err := json.Marshal(d.ExistingValue)
+	if err != nil {
+		return nil, err
+	}
+	imported, err := json.Marshal(d.ImportValue)
+	if err != nil {
+		return nil, err
+	}
+	return &database.ImportConflict{
+		ImportID:      importID,
+		Resource:      "device",
+		ResourceID:    d.ResourceID,
+		Field:         d.Field,
+		FieldClass:    string(d.FieldClass),
+		ExistingValue: string(existing),
+		ImportValue:   string(imported),
+		Status:        ConflictStatusPending,
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+// normalizeJSONMap round-trips a map through JSON so YAML-decoded values
+// compare equal to values decoded from the database
+func normalizeJSONMap(m map[string]interface{}) map[string]interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(buf, &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+// ListImportConflicts returns queued import conflicts, newest first. An empty
+// status returns conflicts in every state.
+func (e *SyncEngine) ListImportConflicts(ctx context.Context, status string) ([]database.ImportConflict, error) {
+	items := []database.ImportConflict{}
+	db := e.dbManager.GetDB()
+	if db == nil {
+		return items, nil
+	}
+	q := db.WithContext(ctx).Model(&database.ImportConflict{})
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if err := q.Order("created_at DESC, id DESC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ResolveImportConflict accepts or rejects a queued conflict. Accepting applies
+// the imported value to the device; rejecting keeps the existing value.
+func (e *SyncEngine) ResolveImportConflict(ctx context.Context, id uint, accept bool, resolvedBy string) (*database.ImportConflict, error) {
+	db := e.dbManager.GetDB()
+	if db == nil {
+		return nil, ErrConflictNotFound
+	}
+
+	var item database.ImportConflict
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&item, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrConflictNotFound
+			}
+			return err
+		}
+		if item.Status != ConflictStatusPending {
+			return ErrConflictResolved
+		}
+
+		item.Status = ConflictStatusRejected
+		if accept {
+			var device database.Device
+			if err := tx.Where("mac = ?", item.ResourceID).First(&device).Error; err != nil {
+				return fmt.Errorf("failed to load device %s: %w", item.ResourceID, err)
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(item.ImportValue), &value); err != nil {
+				return fmt.Errorf("invalid queued value: %w", err)
+			}
+			if err := applyDeviceField(&device, item.Field, value); err != nil {
+				return err
+			}
+			if err := tx.Save(&device).Error; err != nil {
+				return err
+			}
+			item.Status = ConflictStatusAccepted
+		}
+
+		now := time.Now()
+		item.ResolvedBy = resolvedBy
+		item.ResolvedAt = &now
+		return tx.Save(&item).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.logger.Info("Import conflict resolved",
+		"conflict_id", item.ID,
+		"device", item.ResourceID,
+		"field", item.Field,
+		"status", item.Status,
+	)
+	return &item, nil
+}
@@ -0,0 +1,200 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestConflictPolicy_StrategyFor(t *testing.T) {
+	var nilPolicy *ConflictPolicy
+	if got := nilPolicy.StrategyFor(FieldClassConfig); got != MergePreferImport {
+		t.Errorf("Expected prefer-import for nil policy, got %s", got)
+	}
+
+	policy := &ConflictPolicy{
+		Default: MergePreferExisting,
+		Fields:  map[FieldClass]MergeStrategy{FieldClassMetadata: MergeNewestWins},
+	}
+	if got := policy.StrategyFor(FieldClassMetadata); got != MergeNewestWins {
+		t.Errorf("Expected newest-wins for metadata, got %s", got)
+	}
+	if got := policy.StrategyFor(FieldClassNetwork); got != MergePreferExisting {
+		t.Errorf("Expected default prefer-existing for network, got %s", got)
+	}
+
+	if err := (&ConflictPolicy{Default: "coin-flip"}).Validate(); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+	if err := (&ConflictPolicy{Fields: map[FieldClass]MergeStrategy{"location": MergePreferImport}}).Validate(); err == nil {
+		t.Error("Expected error for unknown field class")
+	}
+}
+
+func TestPlanDeviceMerge(t *testing.T) {
+	now := time.Now()
+	existing := &database.Device{
+		MAC:       "AA:BB:CC:00:00:01",
+		IP:        "192.0.2.10",
+		Type:      "SHSW-1",
+		Name:      "old-name",
+		Settings:  `{"eco_mode":false,"led":"on"}`,
+		UpdatedAt: now,
+	}
+	imported := GitOpsDevice{
+		MAC:          existing.MAC,
+		IP:           "192.0.2.10",
+		Type:         "SHSW-1",
+		Name:         "new-name",
+		MergedConfig: map[string]interface{}{"settings": map[string]interface{}{"eco_mode": true, "led": "on"}},
+		ModifiedAt:   now.Add(-time.Hour),
+	}
+
+	policy := &ConflictPolicy{Fields: map[FieldClass]MergeStrategy{
+		FieldClassMetadata: MergeNewestWins,
+		FieldClassConfig:   MergeManualReview,
+	}}
+	decisions := planDeviceMerge(existing, imported, policy, false)
+	if len(decisions) != 2 {
+		t.Fatalf("Expected 2 decisions (name, settings), got %d: %+v", len(decisions), decisions)
+	}
+	byField := map[string]ConflictDecision{}
+	for _, d := range decisions {
+		byField[d.Field] = d
+	}
+	if d := byField["name"]; d.Outcome != DecisionExisting || d.FieldClass != FieldClassMetadata {
+		t.Errorf("Expected older import name to keep existing value, got %+v", d)
+	}
+	if d := byField["settings.eco_mode"]; d.Outcome != DecisionReview || d.Strategy != MergeManualReview {
+		t.Errorf("Expected settings conflict queued for review, got %+v", d)
+	}
+
+	for _, d := range planDeviceMerge(existing, imported, policy, true) {
+		if d.Outcome != DecisionImport {
+			t.Errorf("Expected force_overwrite to import %s, got %s", d.Field, d.Outcome)
+		}
+	}
+}
+
+func TestGitOpsImport_ConflictReviewQueue(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	device := database.Device{MAC: "AA:BB:CC:00:00:02", IP: "192.0.2.20", Type: "SHSW-1", Name: "hallway", Status: "online"}
+	if err := db.GetDB().Create(&device).Error; err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	data := &GitOpsData{Devices: []GitOpsDevice{
+		{MAC: device.MAC, Type: "SHSW-PM", Name: "hallway-light", IP: "192.0.2.21"},
+	}}
+	result, err := NewGitOpsImporter(db, logger).Import(context.Background(), data, GitOpsImportOptions{
+		ImportID: "imp-1",
+		ConflictPolicy: &ConflictPolicy{
+			Default: MergePreferImport,
+			Fields: map[FieldClass]MergeStrategy{
+				FieldClassIdentity: MergePreferExisting,
+				FieldClassNetwork:  MergeManualReview,
+			},
+		},
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("Import failed: %v %+v", err, result)
+	}
+	if len(result.Decisions) != 3 || result.ReviewQueued != 1 {
+		t.Fatalf("Expected 3 decisions and 1 queued review, got %d and %d", len(result.Decisions), result.ReviewQueued)
+	}
+
+	var stored database.Device
+	if err := db.GetDB().First(&stored, device.ID).Error; err != nil {
+		t.Fatalf("Failed to reload device: %v", err)
+	}
+	if stored.Name != "hallway-light" || stored.Type != "SHSW-1" || stored.IP != "192.0.2.20" {
+		t.Errorf("Unexpected merged device: name=%s type=%s ip=%s", stored.Name, stored.Type, stored.IP)
+	}
+
+	engine := NewSyncEngine(db, logger)
+	pending, err := engine.ListImportConflicts(context.Background(), ConflictStatusPending)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("Expected 1 pending conflict, got %d (%v)", len(pending), err)
+	}
+	if pending[0].ImportID != "imp-1" || pending[0].Field != "ip" {
+		t.Errorf("Unexpected queued conflict: %+v", pending[0])
+	}
+
+	resolved, err := engine.ResolveImportConflict(context.Background(), pending[0].ID, true, "admin")
+	if err != nil {
+		t.Fatalf("ResolveImportConflict failed: %v", err)
+	}
+	if resolved.Status != ConflictStatusAccepted || resolved.ResolvedAt == nil {
+		t.Errorf("Unexpected resolved conflict: %+v", resolved)
+	}
+	if err := db.GetDB().First(&stored, device.ID).Error; err != nil {
+		t.Fatalf("Failed to reload device: %v", err)
+	}
+	if stored.IP != "192.0.2.21" {
+		t.Errorf("Expected accepted IP to be applied, got %s", stored.IP)
+	}
+
+	if _, err := engine.ResolveImportConflict(context.Background(), pending[0].ID, false, "admin"); err != ErrConflictResolved {
+		t.Errorf("Expected ErrConflictResolved, got %v", err)
+	}
+}
+
+func TestApplyDeviceField_MergesSettings(t *testing.T) {
+	device := &database.Device{Settings: `{"auth_user":"admin","led":"on","eco_mode":false}`}
+	// Exported settings leave out excluded keys; importing them keeps those keys
+	imported := GitOpsDevice{MergedConfig: map[string]interface{}{"settings": map[string]interface{}{"led": "off", "eco_mode": false}}}
+	decisions := planDeviceMerge(device, imported, nil, false)
+	if len(decisions) != 1 || decisions[0].Field != "settings.led" {
+		t.Fatalf("Expected one settings.led decision, got %+v", decisions)
+	}
+	if err := applyDeviceField(device, decisions[0].Field, decisions[0].ImportValue); err != nil {
+		t.Fatalf("applyDeviceField failed: %v", err)
+	}
+	if device.Settings != `{"auth_user":"admin","eco_mode":false,"led":"off"}` {
+		t.Errorf("Expected the led key merged into the settings, got %s", device.Settings)
+	}
+}
+
+func TestArtifactModifiedAt(t *testing.T) {
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	if got := artifactModifiedAt(map[string]interface{}{"modified_at": "2026-05-01T12:00:00Z"}); !got.Equal(at) {
+		t.Errorf("Expected %v from a string, got %v", at, got)
+	}
+	if got := artifactModifiedAt(map[string]interface{}{"modified_at": at}); !got.Equal(at) {
+		t.Errorf("Expected %v from a YAML timestamp, got %v", at, got)
+	}
+	if got := artifactModifiedAt(map[string]interface{}{}); !got.IsZero() {
+		t.Errorf("Expected no timestamp, got %v", got)
+	}
+	if outcome, _ := decide(MergeNewestWins, at, time.Time{}); outcome != DecisionExisting {
+		t.Errorf("Expected an import without modified_at to keep the existing value, got %s", outcome)
+	}
+}
+
+func TestBackupImport_RefusesConflictPolicy(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	_, err = NewImportEngine(nil, db, logger).Import(context.Background(), ImportRequest{
+		PluginName: "backup",
+		Source:     ImportSource{Type: "file", Path: "backup.db"},
+		Options:    ImportOptions{ConflictPolicy: &ConflictPolicy{Default: MergePreferExisting}},
+	})
+	if !errors.Is(err, ErrInvalidImportData) {
+		t.Errorf("Expected a conflict policy refused for backup imports, got %v", err)
+	}
+}
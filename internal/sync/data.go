@@ -18,6 +18,8 @@ var (
 	ErrInvalidImportData    = errors.New("invalid import data")
 	ErrInvalidExportData    = errors.New("invalid export data")
 	ErrInvalidExportPath    = errors.New("invalid export path")
+	ErrConflictNotFound     = errors.New("import conflict not found")
+	ErrConflictResolved     = errors.New("import conflict already resolved")
 )
 
 // ExportData contains all data that can be exported
@@ -42,6 +44,7 @@ type DeviceData struct {
 	Status        string                 `json:"status"`
 	LastSeen      time.Time              `json:"last_seen"`
 	Settings      map[string]interface{} `json:"settings"`
+	Tags          []string               `json:"tags,omitempty"`
 	Configuration *ConfigurationData     `json:"configuration,omitempty"`
 	CreatedAt     time.Time              `json:"created_at"`
 	UpdatedAt     time.Time              `json:"updated_at"`
@@ -87,13 +90,18 @@ type DiscoveredDeviceData struct {
 type ExportMetadata struct {
 	ExportID       string `json:"export_id"`
 	RequestedBy    string `json:"requested_by"`
-	ExportType     string `json:"export_type"` // "manual", "api"
+	ExportType     string `json:"export_type"` // "manual", "api", "scheduled"
 	TotalDevices   int    `json:"total_devices"`
 	TotalConfigs   int    `json:"total_configs"`
 	FilterApplied  bool   `json:"filter_applied"`
 	FilterCriteria string `json:"filter_criteria,omitempty"`
 	SystemVersion  string `json:"system_version"`
 	DatabaseType   string `json:"database_type"`
+
+	// Set for incremental exports: Devices holds only changed records and
+	// RemovedDeviceIDs lists devices deleted since the previous export.
+	Incremental      bool   `json:"incremental,omitempty"`
+	RemovedDeviceIDs []uint `json:"removed_device_ids,omitempty"`
 }
 
 // ExportRequest represents a request to export data
@@ -143,6 +151,12 @@ type ImportOptions struct {
 	ForceOverwrite bool `json:"force_overwrite"`
 	ValidateOnly   bool `json:"validate_only"`
 	BackupBefore   bool `json:"backup_before"`
+
+	// ConflictPolicy selects per-field-class merge strategies when imported
+	// devices already exist. ForceOverwrite takes precedence and always
+	// prefers the imported value. Only GitOps imports merge fields; backup
+	// imports refuse a policy.
+	ConflictPolicy *ConflictPolicy `json:"conflict_policy,omitempty"`
 }
 
 // ImportResult contains the result of an import operation
@@ -155,6 +169,7 @@ type ImportResult struct {
 	RecordsSkipped  int                    `json:"records_skipped"`
 	Duration        time.Duration          `json:"duration"`
 	Changes         []ImportChange         `json:"changes,omitempty"`
+	Decisions       []ConflictDecision     `json:"decisions,omitempty"`
 	Errors          []string               `json:"errors,omitempty"`
 	Warnings        []string               `json:"warnings,omitempty"`
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
@@ -13,6 +13,7 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"github.com/ginsys/shelly-manager/internal/clock"
 	"github.com/ginsys/shelly-manager/internal/configuration"
 	"github.com/ginsys/shelly-manager/internal/database"
 	"github.com/ginsys/shelly-manager/internal/database/provider"
@@ -42,6 +43,20 @@ type SyncEngine struct {
 	// If set, file imports/exports are restricted to these directories
 	importBaseDir string
 	exportBaseDir string
+
+	// Signs backup and GitOps artifacts and verifies them before import
+	signer        *ArtifactSigner
+	requireSigned bool
+
+	// Storage tiers artifacts move through as they age
+	lifecycle ArtifactLifecycle
+
+	// clock stamps results and history; tests inject a fake clock
+	clock clock.Clock
+
+	// Background export jobs, newest last
+	jobsMu     sync.Mutex
+	exportJobs []*ExportJob
 }
 
 // ExportEngine provides backward compatibility
@@ -55,9 +70,17 @@ func NewSyncEngine(dbManager DatabaseManagerInterface, logger *logging.Logger) *
 		logger:        logger,
 		exportResults: make(map[string]*ExportResult),
 		importResults: make(map[string]*ImportResult),
+		clock:         clock.Real,
 	}
 }
 
+// SetClock replaces the clock stamping results and history
+func (e *SyncEngine) SetClock(c clock.Clock) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.clock = clock.OrReal(c)
+}
+
 // SetImportBaseDir sets the base directory for import path validation.
 // If set, file-based imports are restricted to paths within this directory.
 func (e *SyncEngine) SetImportBaseDir(dir string) {
@@ -84,6 +107,87 @@ func (e *SyncEngine) SetExportBaseDir(dir string) {
 	}
 }
 
+// SetArtifactSigner signs the artifacts of signed plugins after export and
+// verifies them before import. With requireSigned an artifact without a
+// valid manifest is refused; otherwise a missing manifest only warns.
+func (e *SyncEngine) SetArtifactSigner(signer *ArtifactSigner, requireSigned bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.signer = signer
+	e.requireSigned = requireSigned
+}
+
+// signArtifact writes the signed manifest of a successful export
+func (e *SyncEngine) signArtifact(result *ExportResult) {
+	e.mutex.RLock()
+	signer := e.signer
+	e.mutex.RUnlock()
+	if signer == nil || !signedPlugins[result.PluginName] || result.OutputPath == "" {
+		return
+	}
+	if !signer.CanSign() {
+		result.Warnings = append(result.Warnings, "artifact not signed: only a verification key is configured")
+		return
+	}
+	manifest, err := signer.Sign(result.OutputPath, result.PluginName, result.ExportID)
+	if err != nil {
+		e.logger.Error("Failed to sign export artifact",
+			"export_id", result.ExportID,
+			"path", result.OutputPath,
+			"error", err,
+		)
+		result.Warnings = append(result.Warnings, fmt.Sprintf("artifact not signed: %v", err))
+		return
+	}
+	if result.Metadata == nil {
+		result.Metadata = map[string]interface{}{}
+	}
+	result.Metadata["signature"] = map[string]interface{}{
+		"algorithm": manifest.Algorithm,
+		"key_id":    manifest.KeyID,
+		"files":     len(manifest.Files),
+	}
+}
+
+// verifyArtifact checks the manifest of an artifact to be imported by a
+// signed plugin. It returns a warning when an unsigned artifact is allowed.
+func (e *SyncEngine) verifyArtifact(plugin, path string) (string, error) {
+	e.mutex.RLock()
+	signer, require := e.signer, e.requireSigned
+	e.mutex.RUnlock()
+	if signer == nil || !signedPlugins[plugin] || path == "" {
+		return "", nil
+	}
+	manifest, err := signer.Verify(path)
+	if err != nil {
+		if !require && !manifestExists(path) {
+			return "artifact has no signed manifest; imported unverified", nil
+		}
+		e.logger.Warn("Refused artifact with an invalid signature",
+			"plugin", plugin,
+			"path", path,
+			"error", err,
+		)
+		return "", err
+	}
+	e.logger.Info("Verified artifact signature",
+		"plugin", plugin,
+		"export_id", manifest.ExportID,
+		"key_id", manifest.KeyID,
+	)
+	return "", nil
+}
+
+// manifestExists reports whether the artifact at path has a manifest
+func manifestExists(path string) bool {
+	manifestPath, err := ManifestPath(path)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(manifestPath)
+	return err == nil
+}
+
 // GetExportResult retrieves a stored export result by ID
 func (e *SyncEngine) GetExportResult(id string) (*ExportResult, bool) {
 	e.mutex.RLock()
@@ -95,23 +199,31 @@ func (e *SyncEngine) GetExportResult(id string) (*ExportResult, bool) {
 // DeleteExport removes an export record from memory and history; optionally removes the file.
 func (e *SyncEngine) DeleteExport(ctx context.Context, exportID string, removeFile bool) error {
 	// Attempt to get in-memory result for path info
-	var path string
+	var path, objectKey string
 	if res, ok := e.GetExportResult(exportID); ok && res != nil {
 		path = res.OutputPath
-	} else {
-		// Try history for path
-		if db := e.dbManager.GetDB(); db != nil {
-			var rec database.ExportHistory
-			if err := db.WithContext(ctx).Where("export_id = ?", exportID).First(&rec).Error; err == nil {
+	}
+	// History has the path of older exports and the object of moved ones
+	if db := e.dbManager.GetDB(); db != nil {
+		var rec database.ExportHistory
+		if err := db.WithContext(ctx).Where("export_id = ?", exportID).First(&rec).Error; err == nil {
+			if path == "" {
 				path = rec.FilePath
 			}
+			if rec.StorageTier == ArtifactTierObject {
+				objectKey = rec.ObjectKey
+			}
 		}
 	}
 
-	// Remove file if requested
+	// Remove file and its manifest if requested
 	if removeFile && path != "" {
+		_ = os.Remove(path + ManifestSuffix)
 		_ = os.Remove(path)
 	}
+	if store := e.artifactLifecycle().Store; removeFile && objectKey != "" && store != nil {
+		e.deleteObjects(ctx, store, exportID, objectKey)
+	}
 
 	// Delete DB history
 	if db := e.dbManager.GetDB(); db != nil {
@@ -241,14 +353,15 @@ func (e *SyncEngine) Export(ctx context.Context, request ExportRequest) (*Export
 
 	plugin, err := e.validateRequest(&request, true)
 	if err != nil {
-		return failedExportResult(exportID, request, startTime, err), err
+		return e.failedExportResult(exportID, request, startTime, err), err
 	}
 
 	// Load data from database
+	reportPhase(ctx, ExportPhaseLoading)
 	data, err := e.loadExportData(ctx, request.Filters)
 	if err != nil {
 		wrapped := fmt.Errorf("failed to load data: %w", err)
-		return failedExportResult(exportID, request, startTime, wrapped), wrapped
+		return e.failedExportResult(exportID, request, startTime, wrapped), wrapped
 	}
 
 	// Enhance metadata with export information
@@ -261,12 +374,50 @@ func (e *SyncEngine) Export(ctx context.Context, request ExportRequest) (*Export
 	if data.Metadata.ExportType == "" {
 		data.Metadata.ExportType = "manual"
 	}
-	data.Timestamp = time.Now()
+	data.Timestamp = e.clock.Now()
+
+	// Change tracking for incremental exports
+	var changes *deviceChanges
+	tracking := request.Options.Incremental || request.Options.ForceFull
+	if tracking {
+		changes, err = e.diffExportState(ctx, request.PluginName, data.Devices, !e.hasFilters(request.Filters))
+		if err != nil {
+			wrapped := fmt.Errorf("failed to load export state: %w", err)
+			return e.failedExportResult(exportID, request, startTime, wrapped), wrapped
+		}
+		if request.Options.ForceFull {
+			for id := range changes.hashes {
+				changes.changed[id] = true
+			}
+		} else {
+			applyIncremental(data, changes)
+			if len(data.Devices) == 0 && len(changes.removed) == 0 {
+				e.logger.Info("Incremental export skipped, no device changes",
+					"export_id", exportID,
+					"plugin", request.PluginName,
+				)
+				result := &ExportResult{
+					Success:    true,
+					ExportID:   exportID,
+					PluginName: request.PluginName,
+					Format:     request.Format,
+					Warnings:   []string{"no device changes since last export"},
+					Metadata:   map[string]interface{}{"incremental": true, "changed_devices": 0, "removed_devices": 0},
+					Duration:   time.Since(startTime),
+					CreatedAt:  e.clock.Now(),
+				}
+				e.storeExportResult(result)
+				return result, nil
+			}
+		}
+	}
 
 	// Create export config
 	config := exportConfigFromRequest(request)
 
 	// Perform the export
+	reportPhase(ctx, ExportPhaseWriting)
+	ReportExportProgress(ctx, 0, len(data.Devices))
 	result, err := plugin.Export(ctx, data, config)
 	if err != nil {
 		e.logger.Error("Export operation failed",
@@ -274,15 +425,39 @@ func (e *SyncEngine) Export(ctx context.Context, request ExportRequest) (*Export
 			"plugin", request.PluginName,
 			"error", err,
 		)
-		return failedExportResult(exportID, request, startTime, err), err
+		return e.failedExportResult(exportID, request, startTime, err), err
 	}
 
 	// Update result with common fields
 	result.ExportID = exportID
 	result.PluginName = request.PluginName
 	result.Format = request.Format
+	if result.Success && !request.Options.DryRun {
+		reportPhase(ctx, ExportPhaseSigning)
+		e.signArtifact(result)
+	}
 	result.Duration = time.Since(startTime)
-	result.CreatedAt = time.Now()
+	result.CreatedAt = e.clock.Now()
+
+	if tracking {
+		if result.Metadata == nil {
+			result.Metadata = map[string]interface{}{}
+		}
+		result.Metadata["incremental"] = !request.Options.ForceFull
+		result.Metadata["changed_devices"] = len(changes.changed)
+		result.Metadata["removed_devices"] = len(changes.removed)
+		if result.Success && !request.Options.DryRun {
+			reset := request.Options.ForceFull && !e.hasFilters(request.Filters)
+			if err := e.saveExportState(ctx, request.PluginName, exportID, changes, reset); err != nil {
+				e.logger.Warn("Failed to save export change-tracking state",
+					"export_id", exportID,
+					"plugin", request.PluginName,
+					"error", err,
+				)
+				result.Warnings = append(result.Warnings, "change tracking state not saved; next incremental export may repeat devices")
+			}
+		}
+	}
 
 	e.logger.Info("Export operation completed",
 		"export_id", exportID,
@@ -293,19 +468,24 @@ func (e *SyncEngine) Export(ctx context.Context, request ExportRequest) (*Export
 	)
 
 	// Store result for later retrieval/download
+	e.storeExportResult(result)
+
+	return result, nil
+}
+
+// storeExportResult keeps a result in memory for later retrieval/download
+func (e *SyncEngine) storeExportResult(result *ExportResult) {
 	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	e.exportResults[result.ExportID] = result
 	// Optional: cap memory usage by trimming old entries (simple heuristic)
 	if len(e.exportResults) > 2000 {
 		// Best-effort cleanup: reset the map when too large
 		e.exportResults = map[string]*ExportResult{result.ExportID: result}
 	}
-	e.mutex.Unlock()
-
-	return result, nil
 }
 
-func failedExportResult(exportID string, request ExportRequest, started time.Time, err error) *ExportResult {
+func (e *SyncEngine) failedExportResult(exportID string, request ExportRequest, started time.Time, err error) *ExportResult {
 	return &ExportResult{
 		Success:    false,
 		ExportID:   exportID,
@@ -313,7 +493,7 @@ func failedExportResult(exportID string, request ExportRequest, started time.Tim
 		Format:     request.Format,
 		Errors:     []string{err.Error()},
 		Duration:   time.Since(started),
-		CreatedAt:  time.Now(),
+		CreatedAt:  e.clock.Now(),
 	}
 }
 
@@ -395,7 +575,7 @@ func (e *SyncEngine) Import(ctx context.Context, request ImportRequest) (*Import
 			Success:   false,
 			ImportID:  importID,
 			Errors:    []string{pluginErr.Error()},
-			CreatedAt: time.Now(),
+			CreatedAt: e.clock.Now(),
 		}, pluginErr
 	}
 
@@ -404,7 +584,7 @@ func (e *SyncEngine) Import(ctx context.Context, request ImportRequest) (*Import
 			Success:   false,
 			ImportID:  importID,
 			Errors:    []string{err.Error()},
-			CreatedAt: time.Now(),
+			CreatedAt: e.clock.Now(),
 		}, err
 	}
 
@@ -414,7 +594,7 @@ func (e *SyncEngine) Import(ctx context.Context, request ImportRequest) (*Import
 			Success:   false,
 			ImportID:  importID,
 			Errors:    []string{err.Error()},
-			CreatedAt: time.Now(),
+			CreatedAt: e.clock.Now(),
 		}, err
 	}
 
@@ -425,12 +605,28 @@ func (e *SyncEngine) Import(ctx context.Context, request ImportRequest) (*Import
 				Success:   false,
 				ImportID:  importID,
 				Errors:    []string{fmt.Sprintf("path validation failed: %v", pathErr)},
-				CreatedAt: time.Now(),
+				CreatedAt: e.clock.Now(),
 			}, pathErr
 		}
 		request.Source.Path = validatedPath
 	}
 
+	var warnings []string
+	if request.Source.Type == "file" {
+		warning, err := e.verifyArtifact(request.PluginName, request.Source.Path)
+		if err != nil {
+			return &ImportResult{
+				Success:   false,
+				ImportID:  importID,
+				Errors:    []string{err.Error()},
+				CreatedAt: e.clock.Now(),
+			}, err
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+
 	// Create import config
 	config := ImportConfig{
 		PluginName: request.PluginName,
@@ -452,7 +648,7 @@ func (e *SyncEngine) Import(ctx context.Context, request ImportRequest) (*Import
 			ImportID:  importID,
 			Errors:    []string{err.Error()},
 			Duration:  time.Since(startTime),
-			CreatedAt: time.Now(),
+			CreatedAt: e.clock.Now(),
 		}, err
 	}
 
@@ -460,8 +656,9 @@ func (e *SyncEngine) Import(ctx context.Context, request ImportRequest) (*Import
 	result.ImportID = importID
 	result.PluginName = request.PluginName
 	result.Format = request.Format
+	result.Warnings = append(result.Warnings, warnings...)
 	result.Duration = time.Since(startTime)
-	result.CreatedAt = time.Now()
+	result.CreatedAt = e.clock.Now()
 
 	e.logger.Info("Import operation completed",
 		"import_id", importID,
@@ -483,6 +680,29 @@ func (e *SyncEngine) Import(ctx context.Context, request ImportRequest) (*Import
 	return result, nil
 }
 
+// restoreVerifier is implemented by database managers that can check a
+// backup in a temporary copy
+type restoreVerifier interface {
+	VerifyBackupRestore(ctx context.Context, backupPath string) (*database.RestoreVerification, error)
+}
+
+// VerifyBackupRestore reports whether a backup file could be restored,
+// without touching the live database
+func (e *SyncEngine) VerifyBackupRestore(ctx context.Context, backupPath string) (*database.RestoreVerification, error) {
+	validatedPath, err := e.validateImportPath(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImportData, err)
+	}
+	if _, err := e.verifyArtifact("backup", validatedPath); err != nil {
+		return nil, err
+	}
+	verifier, ok := e.dbManager.(restoreVerifier)
+	if !ok {
+		return nil, database.ErrRestoreVerificationUnsupported
+	}
+	return verifier.VerifyBackupRestore(ctx, validatedPath)
+}
+
 // ValidateExport validates an export configuration without performing the export
 func (e *SyncEngine) ValidateExport(request ExportRequest) error {
 	_, err := e.validateRequest(&request, true)
@@ -511,6 +731,11 @@ func (e *SyncEngine) validateRequest(request *ExportRequest, normalizePaths bool
 	if err := plugin.ValidateConfig(request.Config); err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrInvalidPluginConfig, err)
 	}
+	// A plugin writing complete snapshots would replace its output with the
+	// changed devices alone
+	if request.Options.Incremental && !request.Options.ForceFull && !plugin.Capabilities().SupportsIncremental {
+		return nil, fmt.Errorf("%w: plugin %s does not support incremental exports", ErrInvalidPluginConfig, request.PluginName)
+	}
 	if outputPath, ok := request.Config["output_path"].(string); ok && outputPath != "" {
 		validated, err := e.validateOutputPath(outputPath)
 		if err != nil {
@@ -561,10 +786,12 @@ func (e *SyncEngine) SaveExportHistory(ctx context.Context, request ExportReques
 		return nil
 	}
 	var fileSize int64
+	var storageTier string
 	if result.OutputPath != "" {
 		if fi, err := os.Stat(result.OutputPath); err == nil {
 			fileSize = fi.Size()
 		}
+		storageTier = ArtifactTierLocal
 	}
 	rec := &database.ExportHistory{
 		ExportID:   result.ExportID,
@@ -591,6 +818,8 @@ func (e *SyncEngine) SaveExportHistory(ctx context.Context, request ExportReques
 		RecordCount: result.RecordCount,
 		FileSize:    fileSize,
 		FilePath:    result.OutputPath,
+		StorageTier: storageTier,
+		Checksum:    result.Checksum,
 		DurationMs:  result.Duration.Milliseconds(),
 		ErrorMessage: func() string {
 			if len(result.Errors) > 0 {
@@ -598,7 +827,14 @@ func (e *SyncEngine) SaveExportHistory(ctx context.Context, request ExportReques
 			}
 			return ""
 		}(),
-		CreatedAt: time.Now(),
+		Parameters: e.exportRunParameters(request),
+		Summary: runJSON(map[string]interface{}{
+			"errors":       result.Errors,
+			"warnings":     result.Warnings,
+			"webhook_sent": result.WebhookSent,
+			"metadata":     result.Metadata,
+		}),
+		CreatedAt: e.clock.Now(),
 	}
 	if err := db.WithContext(ctx).Create(rec).Error; err != nil {
 		e.logger.WithFields(map[string]any{"error": err.Error(), "component": "sync_engine"}).Warn("Failed to save export history")
@@ -628,7 +864,14 @@ func (e *SyncEngine) SaveImportHistory(ctx context.Context, request ImportReques
 			}
 			return ""
 		}(),
-		CreatedAt: time.Now(),
+		Parameters: e.importRunParameters(request),
+		Summary: runJSON(map[string]interface{}{
+			"errors":    result.Errors,
+			"warnings":  result.Warnings,
+			"changes":   len(result.Changes),
+			"decisions": len(result.Decisions),
+		}),
+		CreatedAt: e.clock.Now(),
 	}
 	if err := db.WithContext(ctx).Create(rec).Error; err != nil {
 		e.logger.WithFields(map[string]any{"error": err.Error(), "component": "sync_engine"}).Warn("Failed to save import history")
@@ -774,6 +1017,12 @@ func (e *SyncEngine) GetImportStatistics(ctx context.Context) (map[string]interf
 	}, nil
 }
 
+// LoadExportData loads the exportable inventory without running a plugin.
+// It is used by read-only consumers such as service discovery endpoints.
+func (e *SyncEngine) LoadExportData(ctx context.Context, filters ExportFilters) (*ExportData, error) {
+	return e.loadExportData(ctx, filters)
+}
+
 // loadExportData loads data from the database based on filters
 func (e *SyncEngine) loadExportData(ctx context.Context, filters ExportFilters) (*ExportData, error) {
 	db := e.dbManager.GetDB()
@@ -786,7 +1035,7 @@ func (e *SyncEngine) loadExportData(ctx context.Context, filters ExportFilters)
 			DiscoveredDevices: []DiscoveredDeviceData{},
 			Templates:         []TemplateData{},
 			Metadata:          ExportMetadata{},
-			Timestamp:         time.Now(),
+			Timestamp:         e.clock.Now(),
 		}, nil
 	}
 
@@ -839,6 +1088,28 @@ func (e *SyncEngine) loadExportData(ctx context.Context, filters ExportFilters)
 		}
 	}
 
+	// Attach device tags so exporters can surface grouping information.
+	if db.Migrator().HasTable(&database.DeviceTag{}) && len(devices) > 0 {
+		deviceIDs := make([]uint, len(devices))
+		for i := range devices {
+			deviceIDs[i] = devices[i].ID
+		}
+		var deviceTags []database.DeviceTag
+		if err := db.WithContext(ctx).
+			Where("device_id IN ?", deviceIDs).
+			Order("tag").
+			Find(&deviceTags).Error; err != nil {
+			return nil, fmt.Errorf("failed to load device tags: %w", err)
+		}
+		tagsByDevice := make(map[uint][]string, len(devices))
+		for _, t := range deviceTags {
+			tagsByDevice[t.DeviceID] = append(tagsByDevice[t.DeviceID], t.Tag)
+		}
+		for i := range exportDevices {
+			exportDevices[i].Tags = tagsByDevice[exportDevices[i].ID]
+		}
+	}
+
 	// Load the persisted per-device configuration rows. DesiredConfig is the
 	// authoritative export payload when present; the older device_configs row
 	// supplies its synchronization metadata and remains the fallback for
@@ -990,7 +1261,7 @@ func (e *SyncEngine) loadExportData(ctx context.Context, filters ExportFilters)
 		Templates:         templates,
 		DiscoveredDevices: discoveredDevices,
 		Metadata:          metadata,
-		Timestamp:         time.Now(),
+		Timestamp:         e.clock.Now(),
 	}, nil
 }
 
@@ -0,0 +1,192 @@
+package sync_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	"github.com/ginsys/shelly-manager/internal/plugins/sync/gitops"
+	syncengine "github.com/ginsys/shelly-manager/internal/sync"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+// capturePlugin records the data passed to its last export
+type capturePlugin struct {
+	last *syncengine.ExportData
+}
+
+func (p *capturePlugin) Info() syncengine.PluginInfo {
+	return syncengine.PluginInfo{Name: "capture", Version: "1.0.0", SupportedFormats: []string{"json"}}
+}
+func (p *capturePlugin) ConfigSchema() syncengine.ConfigSchema       { return syncengine.ConfigSchema{} }
+func (p *capturePlugin) ValidateConfig(map[string]interface{}) error { return nil }
+func (p *capturePlugin) Export(_ context.Context, data *syncengine.ExportData, _ syncengine.ExportConfig) (*syncengine.ExportResult, error) {
+	p.last = data
+	return &syncengine.ExportResult{Success: true, RecordCount: len(data.Devices)}, nil
+}
+func (p *capturePlugin) Preview(context.Context, *syncengine.ExportData, syncengine.ExportConfig) (*syncengine.PreviewResult, error) {
+	return &syncengine.PreviewResult{Success: true}, nil
+}
+func (p *capturePlugin) Import(context.Context, syncengine.ImportSource, syncengine.ImportConfig) (*syncengine.ImportResult, error) {
+	return nil, nil
+}
+func (p *capturePlugin) Capabilities() syncengine.PluginCapabilities {
+	return syncengine.PluginCapabilities{SupportsIncremental: true}
+}
+func (p *capturePlugin) Initialize(*logging.Logger) error { return nil }
+func (p *capturePlugin) Cleanup() error                   { return nil }
+
+// snapshotPlugin writes complete snapshots and cannot export incrementally
+type snapshotPlugin struct {
+	capturePlugin
+}
+
+func (p *snapshotPlugin) Info() syncengine.PluginInfo {
+	return syncengine.PluginInfo{Name: "snapshot", Version: "1.0.0", SupportedFormats: []string{"json"}}
+}
+func (p *snapshotPlugin) Capabilities() syncengine.PluginCapabilities {
+	return syncengine.PluginCapabilities{}
+}
+
+func TestSyncEngineIncrementalExport(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+
+	first := database.Device{MAC: "aabbccddee11", IP: "192.0.2.31", Type: "SHSW-1", Name: "hall", Status: "online"}
+	second := database.Device{MAC: "aabbccddee12", IP: "192.0.2.32", Type: "SHSW-1", Name: "porch", Status: "online"}
+	require.NoError(t, db.GetDB().Create(&first).Error)
+	require.NoError(t, db.GetDB().Create(&second).Error)
+
+	plugin := &capturePlugin{}
+	engine := syncengine.NewSyncEngine(db, logger)
+	require.NoError(t, engine.RegisterPlugin(plugin))
+
+	ctx := context.Background()
+	incremental := syncengine.ExportRequest{PluginName: "capture", Format: "json", Options: syncengine.ExportOptions{Incremental: true}}
+
+	// No baseline yet: everything is exported
+	_, err = engine.Export(ctx, incremental)
+	require.NoError(t, err)
+	require.Len(t, plugin.last.Devices, 2)
+	require.True(t, plugin.last.Metadata.Incremental)
+
+	// Nothing changed: the plugin is not invoked
+	plugin.last = nil
+	result, err := engine.Export(ctx, incremental)
+	require.NoError(t, err)
+	require.True(t, result.Success)
+	require.Nil(t, plugin.last)
+
+	// Status changes alone are not content changes; renames are
+	require.NoError(t, db.GetDB().Model(&first).Updates(map[string]any{"status": "offline"}).Error)
+	require.NoError(t, db.GetDB().Model(&second).Updates(map[string]any{"name": "porch-light"}).Error)
+	_, err = engine.Export(ctx, incremental)
+	require.NoError(t, err)
+	require.Len(t, plugin.last.Devices, 1)
+	require.Equal(t, second.ID, plugin.last.Devices[0].ID)
+
+	// Deleted devices are reported once
+	require.NoError(t, db.GetDB().Unscoped().Delete(&first).Error)
+	_, err = engine.Export(ctx, incremental)
+	require.NoError(t, err)
+	require.Empty(t, plugin.last.Devices)
+	require.Equal(t, []uint{first.ID}, plugin.last.Metadata.RemovedDeviceIDs)
+
+	// Force-full exports everything regardless of tracking state
+	_, err = engine.Export(ctx, syncengine.ExportRequest{PluginName: "capture", Format: "json", Options: syncengine.ExportOptions{Incremental: true, ForceFull: true}})
+	require.NoError(t, err)
+	require.Len(t, plugin.last.Devices, 1)
+	require.False(t, plugin.last.Metadata.Incremental)
+
+	// Plugins without incremental support refuse incremental exports
+	snapshot := &snapshotPlugin{}
+	require.NoError(t, engine.RegisterPlugin(snapshot))
+	_, err = engine.Export(ctx, syncengine.ExportRequest{PluginName: "snapshot", Format: "json", Options: syncengine.ExportOptions{Incremental: true}})
+	require.ErrorIs(t, err, syncengine.ErrInvalidPluginConfig)
+	require.Nil(t, snapshot.last)
+	_, err = engine.Export(ctx, syncengine.ExportRequest{PluginName: "snapshot", Format: "json"})
+	require.NoError(t, err)
+	require.Len(t, snapshot.last.Devices, 1)
+}
+
+func TestSyncEngineIncrementalGitOpsExport(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+
+	kitchen := database.Device{MAC: "aabbccddee21", IP: "192.0.2.41", Type: "SHSW-1", Name: "kitchen light", Status: "online"}
+	hall := database.Device{MAC: "aabbccddee22", IP: "192.0.2.42", Type: "SHSW-1", Name: "hall", Status: "online"}
+	porch := database.Device{MAC: "aabbccddee23", IP: "192.0.2.43", Type: "SHPLG-S", Name: "porch", Status: "online"}
+	for _, d := range []*database.Device{&kitchen, &hall, &porch} {
+		require.NoError(t, db.GetDB().Create(d).Error)
+	}
+
+	plugin := gitops.NewPlugin()
+	require.NoError(t, plugin.Initialize(logger))
+	engine := syncengine.NewSyncEngine(db, logger)
+	require.NoError(t, engine.RegisterPlugin(plugin))
+
+	out := filepath.Join(t.TempDir(), "gitops")
+	request := syncengine.ExportRequest{PluginName: "gitops", Format: "yaml",
+		Config: map[string]interface{}{"output_path": out}, Options: syncengine.ExportOptions{Incremental: true}}
+	ctx := context.Background()
+
+	// First run: no baseline, every device is written
+	_, err = engine.Export(ctx, request)
+	require.NoError(t, err)
+	kitchenFile := filepath.Join(out, "groups", "kitchen", "shsw-1", "kitchen-light.yaml")
+	hallFile := filepath.Join(out, "ungrouped", "shsw-1", "hall.yaml")
+	porchFile := filepath.Join(out, "groups", "porch", "shplg-s", "porch.yaml")
+	for _, f := range []string{kitchenFile, hallFile, porchFile} {
+		require.FileExists(t, f)
+	}
+	// Marks the unchanged device's file to show the second run leaves it alone
+	require.NoError(t, os.WriteFile(kitchenFile, []byte("name: untouched\n"), 0o644))
+
+	// Second run: one device renamed, one deleted
+	require.NoError(t, db.GetDB().Model(&porch).Update("name", "porch plug").Error)
+	require.NoError(t, db.GetDB().Unscoped().Delete(&hall).Error)
+	result, err := engine.Export(ctx, request)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Metadata["changed_devices"])
+	require.Equal(t, 1, result.Metadata["removed_devices"])
+
+	kitchenYAML, err := os.ReadFile(kitchenFile)
+	require.NoError(t, err)
+	require.Equal(t, "name: untouched\n", string(kitchenYAML))
+	require.NoFileExists(t, hallFile)
+	require.NoFileExists(t, porchFile)
+	require.FileExists(t, filepath.Join(out, "groups", "porch", "shplg-s", "porch-plug.yaml"))
+
+	var summary struct {
+		Structure struct {
+			TotalDevices int  `yaml:"total_devices"`
+			Incremental  bool `yaml:"incremental"`
+			RemovedFiles int  `yaml:"removed_files"`
+		} `yaml:"structure"`
+	}
+	raw, err := os.ReadFile(filepath.Join(out, "export-summary.yaml"))
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(raw, &summary))
+	require.True(t, summary.Structure.Incremental)
+	require.Equal(t, 1, summary.Structure.TotalDevices)
+	require.Equal(t, 2, summary.Structure.RemovedFiles)
+
+	var index map[uint]string
+	raw, err = os.ReadFile(filepath.Join(out, "device-index.yaml"))
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(raw, &index))
+	require.Equal(t, map[uint]string{
+		kitchen.ID: "groups/kitchen/shsw-1/kitchen-light.yaml",
+		porch.ID:   "groups/porch/shplg-s/porch-plug.yaml",
+	}, index)
+}
@@ -0,0 +1,39 @@
+package sync_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	syncengine "github.com/ginsys/shelly-manager/internal/sync"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestSyncEngineLoadExportDataIncludesTags(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+
+	tagged := database.Device{MAC: "aabbccddee01", IP: "192.0.2.21", Type: "SHSW-1", Status: "online"}
+	untagged := database.Device{MAC: "aabbccddee02", IP: "192.0.2.22", Type: "SHSW-1", Status: "online"}
+	require.NoError(t, db.GetDB().Create(&tagged).Error)
+	require.NoError(t, db.GetDB().Create(&untagged).Error)
+	require.NoError(t, db.GetDB().Create(&database.DeviceTag{DeviceID: tagged.ID, Tag: "upstairs"}).Error)
+	require.NoError(t, db.GetDB().Create(&database.DeviceTag{DeviceID: tagged.ID, Tag: "bedroom"}).Error)
+
+	engine := syncengine.NewSyncEngine(db, logger)
+	data, err := engine.LoadExportData(context.Background(), syncengine.ExportFilters{})
+	require.NoError(t, err)
+	require.Len(t, data.Devices, 2)
+
+	tags := map[uint][]string{}
+	for _, d := range data.Devices {
+		tags[d.ID] = d.Tags
+	}
+	require.Equal(t, []string{"bedroom", "upstairs"}, tags[tagged.ID])
+	require.Empty(t, tags[untagged.ID])
+}
@@ -0,0 +1,126 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxExportJobs bounds the export jobs kept in memory
+const maxExportJobs = 100
+
+// Export job states
+const (
+	ExportJobRunning   = "running"
+	ExportJobCompleted = "completed"
+	ExportJobFailed    = "failed"
+)
+
+// ErrExportJobNotFound is returned for unknown export job IDs
+var ErrExportJobNotFound = errors.New("export job not found")
+
+// ExportJob tracks an export running in the background. Once completed, its
+// artifact is downloaded through the export ID of its result.
+type ExportJob struct {
+	ID          string         `json:"id"`
+	Status      string         `json:"status"`
+	PluginName  string         `json:"plugin_name"`
+	Format      string         `json:"format"`
+	Progress    ExportProgress `json:"progress"`
+	Result      *ExportResult  `json:"result,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	RequestedBy string         `json:"requested_by,omitempty"`
+	StartedAt   time.Time      `json:"started_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+
+	tracker *progressTracker
+}
+
+// StartExportJob validates an export request and runs it in the
+// background, returning a job to poll for progress. The job outlives the
+// request that started it and is recorded in the export history when done.
+func (e *SyncEngine) StartExportJob(ctx context.Context, request ExportRequest, requestedBy string) (*ExportJob, error) {
+	if err := e.ValidateExport(request); err != nil {
+		return nil, err
+	}
+	job := &ExportJob{
+		ID:          uuid.New().String(),
+		Status:      ExportJobRunning,
+		PluginName:  request.PluginName,
+		Format:      request.Format,
+		RequestedBy: requestedBy,
+		StartedAt:   e.clock.Now(),
+		tracker:     &progressTracker{progress: ExportProgress{Phase: ExportPhaseLoading}},
+	}
+	e.storeExportJob(job)
+
+	jobCtx := withProgress(context.WithoutCancel(ctx), job.tracker)
+	go func() {
+		result, err := e.Export(jobCtx, request)
+		if result != nil {
+			if saveErr := e.SaveExportHistory(jobCtx, request, result, requestedBy); saveErr != nil {
+				e.logger.Warn("Failed to save export job history", "job_id", job.ID, "error", saveErr)
+			}
+		}
+		e.jobsMu.Lock()
+		defer e.jobsMu.Unlock()
+		now := e.clock.Now()
+		job.Result = result
+		job.CompletedAt = &now
+		if err != nil {
+			job.Status = ExportJobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = ExportJobCompleted
+		job.tracker.mu.Lock()
+		job.tracker.progress.Phase = ExportPhaseDone
+		job.tracker.mu.Unlock()
+	}()
+
+	e.jobsMu.Lock()
+	defer e.jobsMu.Unlock()
+	return job.snapshot(), nil
+}
+
+// GetExportJob returns a snapshot of an export job
+func (e *SyncEngine) GetExportJob(id string) (*ExportJob, error) {
+	e.jobsMu.Lock()
+	defer e.jobsMu.Unlock()
+	for _, job := range e.exportJobs {
+		if job.ID == id {
+			return job.snapshot(), nil
+		}
+	}
+	return nil, ErrExportJobNotFound
+}
+
+// ListExportJobs returns snapshots of the recent export jobs, newest first
+func (e *SyncEngine) ListExportJobs() []*ExportJob {
+	e.jobsMu.Lock()
+	defer e.jobsMu.Unlock()
+	jobs := make([]*ExportJob, 0, len(e.exportJobs))
+	for i := len(e.exportJobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, e.exportJobs[i].snapshot())
+	}
+	return jobs
+}
+
+func (e *SyncEngine) storeExportJob(job *ExportJob) {
+	e.jobsMu.Lock()
+	defer e.jobsMu.Unlock()
+	e.exportJobs = append(e.exportJobs, job)
+	if len(e.exportJobs) > maxExportJobs {
+		e.exportJobs = e.exportJobs[len(e.exportJobs)-maxExportJobs:]
+	}
+}
+
+// snapshot copies a job with its current progress; callers hold jobsMu
+func (j *ExportJob) snapshot() *ExportJob {
+	c := *j
+	c.Progress = j.tracker.snapshot()
+	c.tracker = nil
+	return &c
+}
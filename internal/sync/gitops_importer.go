@@ -50,8 +50,34 @@ type GitOpsDevice struct {
 	MAC          string                 `json:"mac"`
 	Type         string                 `json:"type"`
 	Group        string                 `json:"group"`
+	IP           string                 `json:"ip,omitempty"`
 	Config       map[string]interface{} `json:"config"`
-	MergedConfig map[string]interface{} `json:"merged_config"` // Final configuration after inheritance
+	MergedConfig map[string]interface{} `json:"merged_config"`         // Final configuration after inheritance
+	ModifiedAt   time.Time              `json:"modified_at,omitempty"` // modified_at timestamp of the device file
+}
+
+// Settings returns the device settings after inheritance
+func (d GitOpsDevice) Settings() map[string]interface{} {
+	source := d.MergedConfig
+	if source == nil {
+		source = d.Config
+	}
+	settings, _ := source["settings"].(map[string]interface{})
+	return settings
+}
+
+// artifactModifiedAt reads the modified_at timestamp a device file carries.
+// File modification times are not used: a checkout or copy resets them.
+func artifactModifiedAt(config map[string]interface{}) time.Time {
+	switch v := config["modified_at"].(type) {
+	case time.Time:
+		return v
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
 }
 
 // GitOpsTemplate represents a configuration template
@@ -67,20 +93,24 @@ type GitOpsTemplate struct {
 
 // GitOpsImportOptions provides options for GitOps import
 type GitOpsImportOptions struct {
-	DryRun         bool `json:"dry_run"`
-	ForceOverwrite bool `json:"force_overwrite"`
-	BackupBefore   bool `json:"backup_before"`
+	DryRun         bool            `json:"dry_run"`
+	ForceOverwrite bool            `json:"force_overwrite"`
+	BackupBefore   bool            `json:"backup_before"`
+	ConflictPolicy *ConflictPolicy `json:"conflict_policy,omitempty"`
+	ImportID       string          `json:"import_id,omitempty"` // recorded on queued review items
 }
 
 // GitOpsImportResult contains the result of a GitOps import
 type GitOpsImportResult struct {
-	Success         bool           `json:"success"`
-	DevicesImported int            `json:"devices_imported"`
-	DevicesSkipped  int            `json:"devices_skipped"`
-	ConfigsApplied  int            `json:"configs_applied"`
-	Changes         []ImportChange `json:"changes"`
-	Errors          []string       `json:"errors"`
-	Warnings        []string       `json:"warnings"`
+	Success         bool               `json:"success"`
+	DevicesImported int                `json:"devices_imported"`
+	DevicesSkipped  int                `json:"devices_skipped"`
+	ConfigsApplied  int                `json:"configs_applied"`
+	ReviewQueued    int                `json:"review_queued"`
+	Changes         []ImportChange     `json:"changes"`
+	Decisions       []ConflictDecision `json:"decisions"`
+	Errors          []string           `json:"errors"`
+	Warnings        []string           `json:"warnings"`
 }
 
 // NewGitOpsImporter creates a new GitOps importer
@@ -234,6 +264,34 @@ func (g *GitOpsImporter) PreviewChanges(ctx context.Context, gitopsData *GitOpsD
 	return changes
 }
 
+// PreviewDecisions reports how conflicts with existing devices would be
+// resolved under the given options, without changing anything
+func (g *GitOpsImporter) PreviewDecisions(ctx context.Context, gitopsData *GitOpsData, options GitOpsImportOptions) []ConflictDecision {
+	decisions := []ConflictDecision{}
+
+	db := g.dbManager.GetDB()
+	if db == nil {
+		return decisions
+	}
+
+	var existingDevices []database.Device
+	if err := db.WithContext(ctx).Find(&existingDevices).Error; err != nil {
+		g.logger.Error("Failed to load existing devices for conflict preview", "error", err)
+		return decisions
+	}
+	deviceByMAC := make(map[string]*database.Device, len(existingDevices))
+	for i := range existingDevices {
+		deviceByMAC[existingDevices[i].MAC] = &existingDevices[i]
+	}
+
+	for _, gitopsDevice := range gitopsData.Devices {
+		if existing, found := deviceByMAC[gitopsDevice.MAC]; found {
+			decisions = append(decisions, planDeviceMerge(existing, gitopsDevice, options.ConflictPolicy, options.ForceOverwrite)...)
+		}
+	}
+	return decisions
+}
+
 // Import performs the GitOps import
 func (g *GitOpsImporter) Import(ctx context.Context, gitopsData *GitOpsData, options GitOpsImportOptions) (*GitOpsImportResult, error) {
 	g.logger.Info("Starting GitOps import",
@@ -242,15 +300,21 @@ func (g *GitOpsImporter) Import(ctx context.Context, gitopsData *GitOpsData, opt
 	)
 
 	result := &GitOpsImportResult{
-		Success:  true,
-		Changes:  []ImportChange{},
-		Errors:   []string{},
-		Warnings: []string{},
+		Success:   true,
+		Changes:   []ImportChange{},
+		Decisions: []ConflictDecision{},
+		Errors:    []string{},
+		Warnings:  []string{},
+	}
+
+	if err := options.ConflictPolicy.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImportData, err)
 	}
 
 	if options.DryRun {
 		// For dry run, just generate preview
 		result.Changes = g.PreviewChanges(ctx, gitopsData)
+		result.Decisions = g.PreviewDecisions(ctx, gitopsData, options)
 		return result, nil
 	}
 
@@ -259,10 +323,11 @@ func (g *GitOpsImporter) Import(ctx context.Context, gitopsData *GitOpsData, opt
 	// Handle nil database (testing mode)
 	if db == nil {
 		return &GitOpsImportResult{
-			Success:  true,
-			Changes:  []ImportChange{},
-			Errors:   []string{},
-			Warnings: []string{},
+			Success:   true,
+			Changes:   []ImportChange{},
+			Decisions: []ConflictDecision{},
+			Errors:    []string{},
+			Warnings:  []string{},
 		}, nil
 	}
 
@@ -289,33 +354,40 @@ func (g *GitOpsImporter) Import(ctx context.Context, gitopsData *GitOpsData, opt
 	// Process each GitOps device
 	for _, gitopsDevice := range gitopsData.Devices {
 		if existing, found := deviceByMAC[gitopsDevice.MAC]; found {
-			// Update existing device
+			// Update existing device, resolving each conflicting field
 			updated := false
 
-			if gitopsDevice.Name != existing.Name {
-				existing.Name = gitopsDevice.Name
-				updated = true
-				result.Changes = append(result.Changes, ImportChange{
-					Type:       "update",
-					Resource:   "device",
-					ResourceID: gitopsDevice.MAC,
-					Field:      "name",
-					OldValue:   existing.Name,
-					NewValue:   gitopsDevice.Name,
-				})
-			}
-
-			if gitopsDevice.Type != existing.Type {
-				existing.Type = gitopsDevice.Type
-				updated = true
-				result.Changes = append(result.Changes, ImportChange{
-					Type:       "update",
-					Resource:   "device",
-					ResourceID: gitopsDevice.MAC,
-					Field:      "type",
-					OldValue:   existing.Type,
-					NewValue:   gitopsDevice.Type,
-				})
+			decisions := planDeviceMerge(existing, gitopsDevice, options.ConflictPolicy, options.ForceOverwrite)
+			result.Decisions = append(result.Decisions, decisions...)
+			for _, decision := range decisions {
+				switch decision.Outcome {
+				case DecisionImport:
+					if err := applyDeviceField(existing, decision.Field, decision.ImportValue); err != nil {
+						result.Errors = append(result.Errors, fmt.Sprintf("failed to apply %s to device %s: %v", decision.Field, gitopsDevice.Name, err))
+						result.Success = false
+						continue
+					}
+					updated = true
+					result.Changes = append(result.Changes, ImportChange{
+						Type:       "update",
+						Resource:   "device",
+						ResourceID: gitopsDevice.MAC,
+						Field:      decision.Field,
+						OldValue:   decision.ExistingValue,
+						NewValue:   decision.ImportValue,
+					})
+				case DecisionReview:
+					item, err := newImportConflict(options.ImportID, decision)
+					if err == nil {
+						err = tx.Create(item).Error
+					}
+					if err != nil {
+						result.Errors = append(result.Errors, fmt.Sprintf("failed to queue %s conflict for device %s: %v", decision.Field, gitopsDevice.Name, err))
+						result.Success = false
+						continue
+					}
+					result.ReviewQueued++
+				}
 			}
 
 			if updated {
@@ -340,8 +412,12 @@ func (g *GitOpsImporter) Import(ctx context.Context, gitopsData *GitOpsData, opt
 				Type:     gitopsDevice.Type,
 				Status:   "pending", // Will be updated by discovery
 				LastSeen: time.Now(),
+				IP:       gitopsDevice.IP,
 				Settings: "{}", // Will be populated when device is discovered
 			}
+			if settings := gitopsDevice.Settings(); len(settings) > 0 {
+				_ = applyDeviceField(&newDevice, "settings", settings)
+			}
 
 			if err := tx.Create(&newDevice).Error; err != nil {
 				result.Errors = append(result.Errors, fmt.Sprintf("failed to create device %s: %v", gitopsDevice.Name, err))
@@ -375,6 +451,7 @@ func (g *GitOpsImporter) Import(ctx context.Context, gitopsData *GitOpsData, opt
 		"success", result.Success,
 		"imported", result.DevicesImported,
 		"skipped", result.DevicesSkipped,
+		"review_queued", result.ReviewQueued,
 		"errors", len(result.Errors),
 	)
 
@@ -494,6 +571,10 @@ func (g *GitOpsImporter) loadDevicesInType(typePath string, deviceType *GitOpsDe
 		if deviceType, ok := deviceConfig["type"].(string); ok {
 			device.Type = deviceType
 		}
+		if ip, ok := deviceConfig["ip"].(string); ok {
+			device.IP = ip
+		}
+		device.ModifiedAt = artifactModifiedAt(deviceConfig)
 
 		deviceType.Devices = append(deviceType.Devices, device)
 		return nil
@@ -542,6 +623,10 @@ func (g *GitOpsImporter) loadUngroupedDevices(ungroupedPath string, gitopsData *
 			if mac, ok := deviceConfig["mac"].(string); ok {
 				device.MAC = mac
 			}
+			if ip, ok := deviceConfig["ip"].(string); ok {
+				device.IP = ip
+			}
+			device.ModifiedAt = artifactModifiedAt(deviceConfig)
 
 			devices = append(devices, device)
 			return nil
@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -121,3 +122,42 @@ func WriteZipSingle(path string, entryName string, data []byte) error {
 	// Let defer handle zw.Close()
 	return f.Sync()
 }
+
+// WriteZip creates a ZIP archive with one entry per file, in name order so
+// repeated exports of the same data produce the same entries.
+//
+// Example:
+//
+//	err := sync.WriteZip("/tmp/docs.zip", map[string][]byte{"index.md": index})
+func WriteZip(path string, files map[string][]byte) error {
+	path, err := cleanPath(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zw := zip.NewWriter(f)
+	for _, name := range names {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			return fmt.Errorf("failed to create zip entry: %w", err)
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			return fmt.Errorf("failed to write zip entry: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish zip: %w", err)
+	}
+	return f.Sync()
+}
@@ -39,6 +39,19 @@ func (i *ImportEngine) Import(ctx context.Context, request ImportRequest) (*Impo
 		"dry_run", request.Options.DryRun,
 	)
 
+	// Refuse tampered or unsigned artifacts before reading them
+	if i.exportEngine != nil && request.Source.Type == "file" {
+		if _, err := i.exportEngine.verifyArtifact(request.PluginName, request.Source.Path); err != nil {
+			return &ImportResult{
+				Success:   false,
+				ImportID:  importID,
+				Errors:    []string{err.Error()},
+				Duration:  time.Since(startTime),
+				CreatedAt: time.Now(),
+			}, err
+		}
+	}
+
 	// Handle different plugin types
 	switch request.PluginName {
 	case "backup":
@@ -65,6 +78,18 @@ func (i *ImportEngine) importBackup(ctx context.Context, request ImportRequest,
 	// For now, backup import is handled using the database provider directly
 	// TODO: Integrate with proper backup plugin interface when available
 
+	// A restore replaces whole tables, so there are no fields to merge
+	if request.Options.ConflictPolicy != nil {
+		err := fmt.Errorf("%w: conflict_policy is only supported for GitOps imports; backup imports restore whole tables", ErrInvalidImportData)
+		return &ImportResult{
+			Success:   false,
+			ImportID:  importID,
+			Errors:    []string{err.Error()},
+			Duration:  time.Since(startTime),
+			CreatedAt: time.Now(),
+		}, err
+	}
+
 	// Get backup provider from database manager
 	dbProvider := i.dbManager.GetProvider()
 	backupProvider, ok := dbProvider.(provider.BackupProvider)
@@ -197,11 +222,16 @@ func (i *ImportEngine) importGitOps(ctx context.Context, request ImportRequest,
 	// If validation only, return success with preview
 	if request.Options.ValidateOnly {
 		changes := gitopsImporter.PreviewChanges(ctx, gitopsData)
+		decisions := gitopsImporter.PreviewDecisions(ctx, gitopsData, GitOpsImportOptions{
+			ForceOverwrite: request.Options.ForceOverwrite,
+			ConflictPolicy: request.Options.ConflictPolicy,
+		})
 		return &ImportResult{
 			Success:         true,
 			ImportID:        importID,
 			RecordsImported: 0,
 			Changes:         changes,
+			Decisions:       decisions,
 			Duration:        time.Since(startTime),
 			Metadata: map[string]interface{}{
 				"validation_only": true,
@@ -217,6 +247,8 @@ func (i *ImportEngine) importGitOps(ctx context.Context, request ImportRequest,
 		DryRun:         request.Options.DryRun,
 		ForceOverwrite: request.Options.ForceOverwrite,
 		BackupBefore:   request.Options.BackupBefore,
+		ConflictPolicy: request.Options.ConflictPolicy,
+		ImportID:       importID,
 	})
 	if err != nil {
 		return &ImportResult{
@@ -238,12 +270,14 @@ func (i *ImportEngine) importGitOps(ctx context.Context, request ImportRequest,
 		RecordsSkipped:  importResult.DevicesSkipped,
 		Duration:        time.Since(startTime),
 		Changes:         importResult.Changes,
+		Decisions:       importResult.Decisions,
 		Errors:          importResult.Errors,
 		Warnings:        importResult.Warnings,
 		Metadata: map[string]interface{}{
 			"devices_imported": importResult.DevicesImported,
 			"devices_skipped":  importResult.DevicesSkipped,
 			"configs_applied":  importResult.ConfigsApplied,
+			"review_queued":    importResult.ReviewQueued,
 			"dry_run":          request.Options.DryRun,
 		},
 		CreatedAt: time.Now(),
@@ -0,0 +1,153 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+// deviceContentHash returns a stable hash of the exportable content of a device.
+// Volatile runtime fields (status, last seen, timestamps) are excluded so that
+// routine polling does not mark every device as changed.
+func deviceContentHash(d DeviceData) string {
+	d.Status = ""
+	d.LastSeen = time.Time{}
+	d.CreatedAt = time.Time{}
+	d.UpdatedAt = time.Time{}
+	if d.Configuration != nil {
+		cfg := *d.Configuration
+		cfg.LastSynced = nil
+		cfg.SyncStatus = ""
+		cfg.UpdatedAt = time.Time{}
+		d.Configuration = &cfg
+	}
+	// encoding/json sorts map keys, so the encoding is deterministic
+	buf, err := json.Marshal(d)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// deviceChanges describes the difference between the current inventory and a
+// plugin's last exported state
+type deviceChanges struct {
+	hashes  map[uint]string
+	changed map[uint]bool
+	removed []uint
+}
+
+// diffExportState compares the loaded devices against the stored per-plugin
+// hashes. Removed devices are only reported for unfiltered exports, since a
+// filtered load cannot distinguish deleted devices from excluded ones.
+func (e *SyncEngine) diffExportState(ctx context.Context, pluginName string, devices []DeviceData, detectRemoved bool) (*deviceChanges, error) {
+	changes := &deviceChanges{
+		hashes:  make(map[uint]string, len(devices)),
+		changed: make(map[uint]bool),
+	}
+	for _, d := range devices {
+		changes.hashes[d.ID] = deviceContentHash(d)
+	}
+
+	db := e.dbManager.GetDB()
+	if db == nil {
+		for id := range changes.hashes {
+			changes.changed[id] = true
+		}
+		return changes, nil
+	}
+
+	var states []database.ExportDeviceState
+	if err := db.WithContext(ctx).Where("plugin_name = ?", pluginName).Find(&states).Error; err != nil {
+		return nil, err
+	}
+	previous := make(map[uint]string, len(states))
+	for _, s := range states {
+		previous[s.DeviceID] = s.ContentHash
+	}
+
+	for id, hash := range changes.hashes {
+		if previous[id] != hash {
+			changes.changed[id] = true
+		}
+	}
+	if detectRemoved {
+		for id := range previous {
+			if _, ok := changes.hashes[id]; !ok {
+				changes.removed = append(changes.removed, id)
+			}
+		}
+		sort.Slice(changes.removed, func(i, j int) bool { return changes.removed[i] < changes.removed[j] })
+	}
+	return changes, nil
+}
+
+// applyIncremental trims the export data down to changed devices and their
+// configurations
+func applyIncremental(data *ExportData, changes *deviceChanges) {
+	devices := make([]DeviceData, 0, len(changes.changed))
+	for _, d := range data.Devices {
+		if changes.changed[d.ID] {
+			devices = append(devices, d)
+		}
+	}
+	configs := make([]ConfigurationData, 0, len(devices))
+	for _, c := range data.Configurations {
+		if changes.changed[c.DeviceID] {
+			configs = append(configs, c)
+		}
+	}
+	data.Devices = devices
+	data.Configurations = configs
+	data.Metadata.TotalDevices = len(devices)
+	data.Metadata.TotalConfigs = len(configs)
+	data.Metadata.Incremental = true
+	data.Metadata.RemovedDeviceIDs = changes.removed
+}
+
+// saveExportState records the hashes of the exported devices as the plugin's
+// new baseline and forgets removed devices
+func (e *SyncEngine) saveExportState(ctx context.Context, pluginName, exportID string, changes *deviceChanges, reset bool) error {
+	db := e.dbManager.GetDB()
+	if db == nil {
+		return nil
+	}
+	tx := db.WithContext(ctx)
+	if reset {
+		if err := tx.Where("plugin_name = ?", pluginName).Delete(&database.ExportDeviceState{}).Error; err != nil {
+			return err
+		}
+	} else if len(changes.removed) > 0 {
+		if err := tx.Where("plugin_name = ? AND device_id IN ?", pluginName, changes.removed).
+			Delete(&database.ExportDeviceState{}).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	states := make([]database.ExportDeviceState, 0, len(changes.changed))
+	for id := range changes.changed {
+		states = append(states, database.ExportDeviceState{
+			PluginName:  pluginName,
+			DeviceID:    id,
+			ContentHash: changes.hashes[id],
+			ExportID:    exportID,
+			ExportedAt:  now,
+		})
+	}
+	if len(states) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "plugin_name"}, {Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content_hash", "export_id", "exported_at"}),
+	}).CreateInBatches(states, 200).Error
+}
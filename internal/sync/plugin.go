@@ -157,6 +157,12 @@ type ExportOptions struct {
 	ValidateOnly    bool `json:"validate_only"`
 	CompactOutput   bool `json:"compact_output"`
 	IncludeMetadata bool `json:"include_metadata"`
+
+	// Incremental exports only devices whose content changed since the
+	// plugin's last successful export; ForceFull exports everything and
+	// resets the change-tracking baseline.
+	Incremental bool `json:"incremental"`
+	ForceFull   bool `json:"force_full"`
 }
 
 // ExportResult contains the result of an export operation
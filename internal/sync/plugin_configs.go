@@ -0,0 +1,351 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+var (
+	ErrPluginConfigNotFound = errors.New("plugin configuration not found")
+	ErrPluginConfigExists   = errors.New("plugin configuration name already in use")
+)
+
+// Outcomes of a plugin configuration run
+const (
+	PluginConfigStatusSuccess = "success"
+	PluginConfigStatusFailed  = "failed"
+)
+
+// PluginDescriptor describes a plugin for UI driven setup: its details,
+// capabilities and its configuration as JSON Schema
+type PluginDescriptor struct {
+	PluginInfo
+	Capabilities PluginCapabilities     `json:"capabilities"`
+	ConfigSchema map[string]interface{} `json:"config_schema"`
+}
+
+// PluginConfigSpec creates or updates a named plugin configuration. On
+// update, an empty name and a nil Description or Request keep their stored
+// values.
+type PluginConfigSpec struct {
+	Name        string         `json:"name"`
+	Description *string        `json:"description,omitempty"`
+	Request     *ExportRequest `json:"request,omitempty"`
+}
+
+// PluginConfigInfo is a plugin configuration with its export request,
+// sensitive plugin settings removed
+type PluginConfigInfo struct {
+	database.SyncPluginConfig
+	Request json.RawMessage `json:"request,omitempty"`
+}
+
+// PluginConfigValidation reports whether an export request would be accepted
+type PluginConfigValidation struct {
+	Valid  bool         `json:"valid"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// DescribePlugins returns every plugin with its configuration schema, by name
+func (e *SyncEngine) DescribePlugins() []PluginDescriptor {
+	e.mutex.RLock()
+	plugins := make([]SyncPlugin, 0, len(e.plugins))
+	for _, plugin := range e.plugins {
+		plugins = append(plugins, plugin)
+	}
+	e.mutex.RUnlock()
+
+	descriptors := make([]PluginDescriptor, 0, len(plugins))
+	for _, plugin := range plugins {
+		descriptors = append(descriptors, PluginDescriptor{
+			PluginInfo:   plugin.Info(),
+			Capabilities: plugin.Capabilities(),
+			ConfigSchema: plugin.ConfigSchema().JSONSchema(),
+		})
+	}
+	sort.Slice(descriptors, func(i, j int) bool { return descriptors[i].Name < descriptors[j].Name })
+	return descriptors
+}
+
+// ValidatePluginConfig checks an export request against its plugin's schema
+// and, when that passes, the checks an export makes: format, plugin
+// validation and paths
+func (e *SyncEngine) ValidatePluginConfig(request ExportRequest) PluginConfigValidation {
+	plugin, err := e.GetPlugin(request.PluginName)
+	if err != nil {
+		return PluginConfigValidation{Errors: []FieldError{{Field: "plugin_name", Message: err.Error()}}}
+	}
+	if problems := plugin.ConfigSchema().Validate(request.Config); len(problems) > 0 {
+		for i := range problems {
+			problems[i].Field = "config." + problems[i].Field
+		}
+		return PluginConfigValidation{Errors: problems}
+	}
+	if err := e.ValidateExport(request); err != nil {
+		return PluginConfigValidation{Errors: []FieldError{{Message: err.Error()}}}
+	}
+	return PluginConfigValidation{Valid: true}
+}
+
+// ListPluginConfigs returns all plugin configurations by name
+func (e *SyncEngine) ListPluginConfigs(ctx context.Context) ([]PluginConfigInfo, error) {
+	db, err := e.configDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var configs []database.SyncPluginConfig
+	if err := db.Order("name ASC").Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list plugin configurations: %w", err)
+	}
+	infos := make([]PluginConfigInfo, 0, len(configs))
+	for i := range configs {
+		infos = append(infos, e.pluginConfigInfo(&configs[i]))
+	}
+	return infos, nil
+}
+
+// GetPluginConfig returns a plugin configuration by ID
+func (e *SyncEngine) GetPluginConfig(ctx context.Context, id uint) (*PluginConfigInfo, error) {
+	config, err := e.loadPluginConfig(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	info := e.pluginConfigInfo(config)
+	return &info, nil
+}
+
+// CreatePluginConfig validates and stores a named plugin configuration
+func (e *SyncEngine) CreatePluginConfig(ctx context.Context, spec PluginConfigSpec, actor string) (*PluginConfigInfo, error) {
+	db, err := e.configDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Request == nil {
+		return nil, fmt.Errorf("%w: request is required", ErrInvalidPluginConfig)
+	}
+	config := database.SyncPluginConfig{UpdatedBy: actor}
+	if err := e.applyPluginConfig(db, &config, spec, true); err != nil {
+		return nil, err
+	}
+	if err := db.Create(&config).Error; err != nil {
+		return nil, fmt.Errorf("failed to create plugin configuration: %w", err)
+	}
+
+	e.logger.WithFields(map[string]any{
+		"config_id": config.ID,
+		"name":      config.Name,
+		"plugin":    config.PluginName,
+		"actor":     actor,
+		"component": "sync_engine",
+	}).Info("Plugin configuration created")
+	info := e.pluginConfigInfo(&config)
+	return &info, nil
+}
+
+// UpdatePluginConfig changes a plugin configuration. Sensitive plugin
+// settings left out of a new request for the same plugin keep their stored
+// values, since they are never returned by the API.
+func (e *SyncEngine) UpdatePluginConfig(ctx context.Context, id uint, spec PluginConfigSpec, actor string) (*PluginConfigInfo, error) {
+	db, err := e.configDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config, err := e.loadPluginConfig(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.applyPluginConfig(db, config, spec, false); err != nil {
+		return nil, err
+	}
+	config.UpdatedBy = actor
+	if err := db.Model(config).
+		Select("name", "description", "plugin_name", "format", "request", "updated_by").
+		Updates(config).Error; err != nil {
+		return nil, fmt.Errorf("failed to update plugin configuration: %w", err)
+	}
+	info := e.pluginConfigInfo(config)
+	return &info, nil
+}
+
+// DeletePluginConfig removes a plugin configuration; its past runs stay in
+// the run history
+func (e *SyncEngine) DeletePluginConfig(ctx context.Context, id uint) error {
+	db, err := e.configDB(ctx)
+	if err != nil {
+		return err
+	}
+	result := db.Delete(&database.SyncPluginConfig{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete plugin configuration: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %d", ErrPluginConfigNotFound, id)
+	}
+	return nil
+}
+
+// RunPluginConfig runs the export of a plugin configuration now. The export
+// is recorded in the run history as requested by the configuration, and its
+// outcome on the configuration.
+func (e *SyncEngine) RunPluginConfig(ctx context.Context, id uint, actor string) (*ExportResult, error) {
+	db, err := e.configDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config, err := e.loadPluginConfig(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *ExportResult
+	var request ExportRequest
+	if err = json.Unmarshal([]byte(config.Request), &request); err != nil {
+		err = fmt.Errorf("%w: stored request is unreadable: %v", ErrInvalidPluginConfig, err)
+	} else {
+		request.CreatedBy = actor
+		request.ExportType = "api"
+		result, err = e.Export(ctx, request)
+		if result != nil {
+			_ = e.SaveExportHistory(ctx, request, result, "config:"+config.Name)
+		}
+	}
+
+	updates := map[string]interface{}{
+		"last_run_at": e.clock.Now(),
+		"last_status": PluginConfigStatusSuccess,
+		"last_error":  "",
+	}
+	if result != nil {
+		updates["last_export_id"] = result.ExportID
+	}
+	switch {
+	case err != nil:
+		updates["last_status"], updates["last_error"] = PluginConfigStatusFailed, err.Error()
+	case !result.Success:
+		message := strings.Join(result.Errors, "; ")
+		if message == "" {
+			message = "export failed"
+		}
+		updates["last_status"], updates["last_error"] = PluginConfigStatusFailed, message
+	}
+	if updateErr := db.WithContext(context.WithoutCancel(ctx)).Model(&database.SyncPluginConfig{}).
+		Where("id = ?", id).Updates(updates).Error; updateErr != nil {
+		e.logger.WithFields(map[string]any{
+			"config_id": id,
+			"error":     updateErr.Error(),
+			"component": "sync_engine",
+		}).Error("Failed to record plugin configuration run")
+	}
+	return result, err
+}
+
+// applyPluginConfig validates spec and copies it onto config
+func (e *SyncEngine) applyPluginConfig(db *gorm.DB, config *database.SyncPluginConfig, spec PluginConfigSpec, create bool) error {
+	if name := strings.TrimSpace(spec.Name); name != "" || create {
+		if name == "" {
+			return fmt.Errorf("%w: name is required", ErrInvalidPluginConfig)
+		}
+		var count int64
+		if err := db.Model(&database.SyncPluginConfig{}).
+			Where("name = ? AND id <> ?", name, config.ID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check plugin configuration name: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s", ErrPluginConfigExists, name)
+		}
+		config.Name = name
+	}
+	if spec.Description != nil {
+		config.Description = strings.TrimSpace(*spec.Description)
+	}
+
+	if spec.Request != nil {
+		request := *spec.Request
+		if !create {
+			var stored ExportRequest
+			if json.Unmarshal([]byte(config.Request), &stored) == nil && stored.PluginName == request.PluginName {
+				request.Config = e.keepSensitive(request.PluginName, stored.Config, request.Config)
+			}
+		}
+		if validation := e.ValidatePluginConfig(request); !validation.Valid {
+			messages := make([]string, 0, len(validation.Errors))
+			for _, fe := range validation.Errors {
+				if fe.Field != "" {
+					messages = append(messages, fe.Field+" "+fe.Message)
+				} else {
+					messages = append(messages, fe.Message)
+				}
+			}
+			return fmt.Errorf("%w: %s", ErrInvalidPluginConfig, strings.Join(messages, "; "))
+		}
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPluginConfig, err)
+		}
+		config.Request = string(data)
+		config.PluginName = request.PluginName
+		config.Format = request.Format
+	}
+	return nil
+}
+
+// keepSensitive copies the sensitive settings of stored into config where
+// config leaves them out
+func (e *SyncEngine) keepSensitive(pluginName string, stored, config map[string]interface{}) map[string]interface{} {
+	plugin, err := e.GetPlugin(pluginName)
+	if err != nil || len(stored) == 0 {
+		return config
+	}
+	merged := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		merged[k] = v
+	}
+	for k, prop := range plugin.ConfigSchema().Properties {
+		if _, set := merged[k]; prop.Sensitive && !set {
+			if v, ok := stored[k]; ok {
+				merged[k] = v
+			}
+		}
+	}
+	return merged
+}
+
+func (e *SyncEngine) pluginConfigInfo(config *database.SyncPluginConfig) PluginConfigInfo {
+	info := PluginConfigInfo{SyncPluginConfig: *config}
+	var request ExportRequest
+	if json.Unmarshal([]byte(config.Request), &request) == nil {
+		info.Request = rawJSON(e.exportRunParameters(request))
+	}
+	return info
+}
+
+func (e *SyncEngine) loadPluginConfig(ctx context.Context, id uint) (*database.SyncPluginConfig, error) {
+	db, err := e.configDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var config database.SyncPluginConfig
+	if err := db.First(&config, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrPluginConfigNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to get plugin configuration: %w", err)
+	}
+	return &config, nil
+}
+
+func (e *SyncEngine) configDB(ctx context.Context) (*gorm.DB, error) {
+	db := e.dbManager.GetDB()
+	if db == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+	return db.WithContext(ctx), nil
+}
@@ -0,0 +1,137 @@
+package sync_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/logging"
+	syncengine "github.com/ginsys/shelly-manager/internal/sync"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+func TestPluginConfigs(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+
+	plugin := &gatePlugin{}
+	engine := syncengine.NewSyncEngine(db, logger)
+	require.NoError(t, engine.RegisterPlugin(plugin))
+	ctx := context.Background()
+
+	// Plugins are described with their JSON Schema
+	plugins := engine.DescribePlugins()
+	require.Len(t, plugins, 1)
+	require.Equal(t, "gate", plugins[0].Name)
+	properties := plugins[0].ConfigSchema["properties"].(map[string]interface{})
+	token := properties["token"].(map[string]interface{})
+	require.Equal(t, true, token["writeOnly"])
+	require.Equal(t, "password", token["format"])
+
+	// Validation reports problems by setting
+	validation := engine.ValidatePluginConfig(syncengine.ExportRequest{PluginName: "gate", Format: "json",
+		Config: map[string]interface{}{"target": 42.0, "token": "t0ken"}})
+	require.False(t, validation.Valid)
+	require.Equal(t, []syncengine.FieldError{{Field: "config.target", Message: "must be a string"}}, validation.Errors)
+	validation = engine.ValidatePluginConfig(syncengine.ExportRequest{PluginName: "nope", Format: "json"})
+	require.False(t, validation.Valid)
+	require.Equal(t, "plugin_name", validation.Errors[0].Field)
+
+	request := &syncengine.ExportRequest{
+		PluginName: "gate",
+		Format:     "json",
+		Config:     map[string]interface{}{"target": "git.local", "token": "t0ken"},
+	}
+	require.True(t, engine.ValidatePluginConfig(*request).Valid)
+	_, err = engine.CreatePluginConfig(ctx, syncengine.PluginConfigSpec{Name: "gitops",
+		Request: &syncengine.ExportRequest{PluginName: "gate", Format: "json"}}, "alice")
+	require.ErrorIs(t, err, syncengine.ErrInvalidPluginConfig)
+
+	description := "Nightly GitOps push"
+	created, err := engine.CreatePluginConfig(ctx, syncengine.PluginConfigSpec{Name: "gitops", Description: &description, Request: request}, "alice")
+	require.NoError(t, err)
+	require.Equal(t, "gate", created.PluginName)
+	require.Equal(t, "alice", created.UpdatedBy)
+	require.NotContains(t, string(created.Request), "t0ken")
+	require.Contains(t, string(created.Request), "git.local")
+
+	_, err = engine.CreatePluginConfig(ctx, syncengine.PluginConfigSpec{Name: "gitops", Request: request}, "alice")
+	require.ErrorIs(t, err, syncengine.ErrPluginConfigExists)
+
+	// A new request without the token keeps the stored one
+	updated, err := engine.UpdatePluginConfig(ctx, created.ID, syncengine.PluginConfigSpec{
+		Request: &syncengine.ExportRequest{PluginName: "gate", Format: "json", Config: map[string]interface{}{"target": "git2.local"}},
+	}, "bob")
+	require.NoError(t, err)
+	require.Equal(t, "gitops", updated.Name)
+	require.Equal(t, description, updated.Description)
+	require.Equal(t, "bob", updated.UpdatedBy)
+
+	result, err := engine.RunPluginConfig(ctx, created.ID, "bob")
+	require.NoError(t, err)
+	require.True(t, result.Success)
+	require.Equal(t, []interface{}{"t0ken"}, plugin.tokens)
+
+	got, err := engine.GetPluginConfig(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, syncengine.PluginConfigStatusSuccess, got.LastStatus)
+	require.Equal(t, result.ExportID, got.LastExportID)
+	require.NotNil(t, got.LastRunAt)
+	require.Contains(t, string(got.Request), "git2.local")
+
+	runs, _, err := engine.ListSyncRuns(ctx, syncengine.SyncRunFilter{Plugin: "gate"}, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	require.Equal(t, "config:gitops", runs[0].RequestedBy)
+
+	plugin.fail = true
+	_, err = engine.RunPluginConfig(ctx, created.ID, "bob")
+	require.Error(t, err)
+	got, err = engine.GetPluginConfig(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, syncengine.PluginConfigStatusFailed, got.LastStatus)
+	require.Contains(t, got.LastError, "target unreachable")
+
+	configs, err := engine.ListPluginConfigs(ctx)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	require.NoError(t, engine.DeletePluginConfig(ctx, created.ID))
+	require.ErrorIs(t, engine.DeletePluginConfig(ctx, created.ID), syncengine.ErrPluginConfigNotFound)
+	_, err = engine.GetPluginConfig(ctx, created.ID)
+	require.ErrorIs(t, err, syncengine.ErrPluginConfigNotFound)
+}
+
+func TestConfigSchemaValidate(t *testing.T) {
+	minimum, maximum := 1.0, 10.0
+	schema := syncengine.ConfigSchema{
+		Required: []string{"name"},
+		Properties: map[string]syncengine.PropertySchema{
+			"name":    {Type: "string", Pattern: "^[a-z]+$"},
+			"retries": {Type: "integer", Minimum: &minimum, Maximum: &maximum},
+			"mode":    {Type: "string", Enum: []interface{}{"fast", "safe"}},
+			"tags":    {Type: "array", Items: &syncengine.PropertySchema{Type: "string"}},
+			"remote":  {Type: "object", Properties: map[string]syncengine.PropertySchema{"push": {Type: "boolean"}}},
+		},
+	}
+	require.Empty(t, schema.Validate(map[string]interface{}{
+		"name": "backup", "retries": 3.0, "mode": "safe", "tags": []interface{}{"a"},
+		"remote": map[string]interface{}{"push": true}, "extra": 1,
+	}))
+	require.Equal(t, []syncengine.FieldError{
+		{Field: "name", Message: "is required"},
+		{Field: "mode", Message: "must be one of [fast safe]"},
+		{Field: "remote.push", Message: "must be true or false"},
+		{Field: "retries", Message: "must be a whole number"},
+		{Field: "tags[1]", Message: "must be a string"},
+	}, schema.Validate(map[string]interface{}{
+		"retries": 2.5, "mode": "slow", "tags": []interface{}{"a", 1.0},
+		"remote": map[string]interface{}{"push": "yes"},
+	}))
+	require.Equal(t, []syncengine.FieldError{
+		{Field: "name", Message: "must match ^[a-z]+$"},
+		{Field: "retries", Message: "must be at most 10"},
+	}, schema.Validate(map[string]interface{}{"name": "Backup", "retries": 11}))
+}
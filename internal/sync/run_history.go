@@ -0,0 +1,282 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+)
+
+var (
+	ErrRunNotFound      = errors.New("sync run not found")
+	ErrRunNotRerunnable = errors.New("sync run cannot be re-run")
+	ErrInvalidRunKind   = errors.New("invalid sync run kind")
+)
+
+// Kinds of sync runs
+const (
+	RunKindExport = "export"
+	RunKindImport = "import"
+)
+
+// SyncRun is one export or import from the run history
+type SyncRun struct {
+	ID          string `json:"id"`
+	Kind        string `json:"kind"`
+	PluginName  string `json:"plugin_name"`
+	Format      string `json:"format"`
+	RequestedBy string `json:"requested_by"`
+	Success     bool   `json:"success"`
+	DurationMs  int64  `json:"duration_ms"`
+	// Records is the number exported, or imported for imports
+	Records        int    `json:"records"`
+	RecordsSkipped int    `json:"records_skipped,omitempty"`
+	ArtifactPath   string `json:"artifact_path,omitempty"`
+	ArtifactSize   int64  `json:"artifact_size,omitempty"`
+	Checksum       string `json:"checksum,omitempty"`
+	Error          string `json:"error,omitempty"`
+	// Rerunnable is set for exports whose parameters were recorded
+	Rerunnable bool            `json:"rerunnable"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	Summary    json.RawMessage `json:"summary,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// SyncRunFilter narrows the run history; empty fields match everything
+type SyncRunFilter struct {
+	Kind    string
+	Plugin  string
+	Success *bool
+}
+
+// ListSyncRuns returns exports and imports newest first, paginated across
+// both, with the total number of matching runs.
+func (e *SyncEngine) ListSyncRuns(ctx context.Context, filter SyncRunFilter, page, pageSize int) ([]SyncRun, int, error) {
+	db := e.dbManager.GetDB()
+	if db == nil {
+		return []SyncRun{}, 0, nil
+	}
+	if filter.Kind != "" && filter.Kind != RunKindExport && filter.Kind != RunKindImport {
+		return nil, 0, fmt.Errorf("%w: %q", ErrInvalidRunKind, filter.Kind)
+	}
+
+	// Each kind contributes at most the runs up to the end of the page
+	window := page * pageSize
+	runs := []SyncRun{}
+	total := 0
+	if filter.Kind != RunKindImport {
+		q := db.WithContext(ctx).Model(&database.ExportHistory{})
+		if filter.Plugin != "" {
+			q = q.Where("plugin_name = ?", filter.Plugin)
+		}
+		if filter.Success != nil {
+			q = q.Where("success = ?", *filter.Success)
+		}
+		var count int64
+		if err := q.Count(&count).Error; err != nil {
+			return nil, 0, err
+		}
+		var items []database.ExportHistory
+		if err := q.Order("created_at desc").Limit(window).Find(&items).Error; err != nil {
+			return nil, 0, err
+		}
+		total += int(count)
+		for i := range items {
+			runs = append(runs, exportRun(&items[i]))
+		}
+	}
+	if filter.Kind != RunKindExport {
+		q := db.WithContext(ctx).Model(&database.ImportHistory{})
+		if filter.Plugin != "" {
+			q = q.Where("plugin_name = ?", filter.Plugin)
+		}
+		if filter.Success != nil {
+			q = q.Where("success = ?", *filter.Success)
+		}
+		var count int64
+		if err := q.Count(&count).Error; err != nil {
+			return nil, 0, err
+		}
+		var items []database.ImportHistory
+		if err := q.Order("created_at desc").Limit(window).Find(&items).Error; err != nil {
+			return nil, 0, err
+		}
+		total += int(count)
+		for i := range items {
+			runs = append(runs, importRun(&items[i]))
+		}
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].CreatedAt.After(runs[j].CreatedAt) })
+	start := (page - 1) * pageSize
+	if start > len(runs) {
+		start = len(runs)
+	}
+	end := start + pageSize
+	if end > len(runs) {
+		end = len(runs)
+	}
+	return runs[start:end], total, nil
+}
+
+// GetSyncRun fetches an export or import run by its ID. It returns nil when
+// no run has the ID.
+func (e *SyncEngine) GetSyncRun(ctx context.Context, id string) (*SyncRun, error) {
+	exp, err := e.GetExportHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if exp != nil {
+		run := exportRun(exp)
+		return &run, nil
+	}
+	imp, err := e.GetImportHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if imp != nil {
+		run := importRun(imp)
+		return &run, nil
+	}
+	return nil, nil
+}
+
+// RerunRequest rebuilds the export request of a recorded export run.
+// Sensitive plugin settings are never recorded, so config supplies them and
+// overrides any recorded setting. Imports are not re-run: their inline data
+// is not kept and replaying them would apply the same changes twice.
+func (e *SyncEngine) RerunRequest(ctx context.Context, id string, config map[string]interface{}) (ExportRequest, error) {
+	var request ExportRequest
+	run, err := e.GetSyncRun(ctx, id)
+	if err != nil {
+		return request, err
+	}
+	if run == nil {
+		return request, fmt.Errorf("%w: %s", ErrRunNotFound, id)
+	}
+	if run.Kind != RunKindExport {
+		return request, fmt.Errorf("%w: imports are not re-run", ErrRunNotRerunnable)
+	}
+	if !run.Rerunnable {
+		return request, fmt.Errorf("%w: no parameters were recorded for %s", ErrRunNotRerunnable, id)
+	}
+	if err := json.Unmarshal(run.Parameters, &request); err != nil {
+		return request, fmt.Errorf("%w: %v", ErrRunNotRerunnable, err)
+	}
+	if request.Config == nil {
+		request.Config = map[string]interface{}{}
+	}
+	for k, v := range config {
+		request.Config[k] = v
+	}
+	return request, nil
+}
+
+// exportRunParameters records an export request for the run history
+func (e *SyncEngine) exportRunParameters(request ExportRequest) string {
+	request.Config = e.withoutSensitive(request.PluginName, request.Config)
+	request.Output.Headers = nil
+	if request.Output.Webhook != nil {
+		webhook := *request.Output.Webhook
+		webhook.Headers = nil
+		webhook.AuthConfig = nil
+		request.Output.Webhook = &webhook
+	}
+	return runJSON(request)
+}
+
+// importRunParameters records an import request for the run history
+func (e *SyncEngine) importRunParameters(request ImportRequest) string {
+	request.Config = e.withoutSensitive(request.PluginName, request.Config)
+	request.Source.Data = nil
+	return runJSON(request)
+}
+
+// withoutSensitive copies a plugin config without the settings the plugin's
+// schema marks sensitive
+func (e *SyncEngine) withoutSensitive(pluginName string, config map[string]interface{}) map[string]interface{} {
+	if config == nil {
+		return nil
+	}
+	var properties map[string]PropertySchema
+	if plugin, err := e.GetPlugin(pluginName); err == nil {
+		properties = plugin.ConfigSchema().Properties
+	}
+	return dropSensitive(config, properties)
+}
+
+func dropSensitive(config map[string]interface{}, properties map[string]PropertySchema) map[string]interface{} {
+	clean := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		prop, ok := properties[k]
+		if ok && prop.Sensitive {
+			continue
+		}
+		if nested, isMap := v.(map[string]interface{}); isMap && ok && len(prop.Properties) > 0 {
+			v = dropSensitive(nested, prop.Properties)
+		}
+		clean[k] = v
+	}
+	return clean
+}
+
+// runJSON encodes a run record field; it is empty when encoding fails
+func runJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func exportRun(h *database.ExportHistory) SyncRun {
+	return SyncRun{
+		ID:           h.ExportID,
+		Kind:         RunKindExport,
+		PluginName:   h.PluginName,
+		Format:       h.Format,
+		RequestedBy:  h.RequestedBy,
+		Success:      h.Success,
+		DurationMs:   h.DurationMs,
+		Records:      h.RecordCount,
+		ArtifactPath: h.FilePath,
+		ArtifactSize: h.FileSize,
+		Checksum:     h.Checksum,
+		Error:        h.ErrorMessage,
+		Rerunnable:   h.Parameters != "",
+		Parameters:   rawJSON(h.Parameters),
+		Summary:      rawJSON(h.Summary),
+		CreatedAt:    h.CreatedAt,
+	}
+}
+
+func importRun(h *database.ImportHistory) SyncRun {
+	return SyncRun{
+		ID:             h.ImportID,
+		Kind:           RunKindImport,
+		PluginName:     h.PluginName,
+		Format:         h.Format,
+		RequestedBy:    h.RequestedBy,
+		Success:        h.Success,
+		DurationMs:     h.DurationMs,
+		Records:        h.RecordsImported,
+		RecordsSkipped: h.RecordsSkipped,
+		Error:          h.ErrorMessage,
+		Parameters:     rawJSON(h.Parameters),
+		Summary:        rawJSON(h.Summary),
+		CreatedAt:      h.CreatedAt,
+	}
+}
+
+// rawJSON returns stored JSON for embedding in a response, or nil when the
+// field is empty or not valid JSON
+func rawJSON(s string) json.RawMessage {
+	if s == "" || !json.Valid([]byte(s)) {
+		return nil
+	}
+	return json.RawMessage(s)
+}
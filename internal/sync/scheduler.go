@@ -0,0 +1,555 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("sync schedule not found")
+	ErrScheduleExists   = errors.New("sync schedule name already in use")
+	ErrScheduleRunning  = errors.New("sync schedule is already running")
+	ErrInvalidSchedule  = errors.New("invalid sync schedule")
+)
+
+const (
+	// scheduleReloadInterval is how often schedules changed by other
+	// instances sharing the database are picked up
+	scheduleReloadInterval = time.Minute
+
+	// staleRunAfter releases the claim of a run whose instance died mid-run
+	staleRunAfter = 6 * time.Hour
+)
+
+// Outcomes of a scheduled run
+const (
+	ScheduleStatusSuccess = "success"
+	ScheduleStatusFailed  = "failed"
+)
+
+// scheduleParser accepts standard five-field expressions, an optional
+// leading seconds field and descriptors such as @daily or @every 1h
+var scheduleParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// ScheduleSpec creates or updates a sync schedule. On update, empty fields
+// and a nil Request keep their stored values.
+type ScheduleSpec struct {
+	Name     string         `json:"name"`
+	CronSpec string         `json:"cron_spec"`
+	Enabled  *bool          `json:"enabled,omitempty"`
+	Request  *ExportRequest `json:"request,omitempty"`
+}
+
+// SyncScheduleInfo is a schedule with its export request, sensitive plugin
+// settings removed
+type SyncScheduleInfo struct {
+	database.SyncSchedule
+	Request json.RawMessage `json:"request,omitempty"`
+}
+
+// ScheduleFailureNotifier is told about every scheduled or manual run that
+// fails
+type ScheduleFailureNotifier func(ctx context.Context, schedule database.SyncSchedule, message string)
+
+// Scheduler runs exports on per-schedule cron expressions. A schedule never
+// runs twice at once, also not across instances sharing the database. It
+// follows the clock of its engine.
+type Scheduler struct {
+	engine   *SyncEngine
+	logger   *logging.Logger
+	cron     *cron.Cron
+	mu       sync.RWMutex
+	entries  map[uint]scheduleEntry
+	leader   func() bool // nil runs schedules on every instance
+	notifier ScheduleFailureNotifier
+	stop     chan struct{}
+	// reloadErr is the error of the last failed schedule reload
+	reloadErr error
+}
+
+type scheduleEntry struct {
+	id   cron.EntryID
+	spec string
+}
+
+// NewScheduler creates a sync scheduler for the engine's plugins
+func NewScheduler(engine *SyncEngine, logger *logging.Logger) *Scheduler {
+	return &Scheduler{
+		engine:  engine,
+		logger:  logger,
+		cron:    cron.New(cron.WithParser(scheduleParser)),
+		entries: make(map[uint]scheduleEntry),
+	}
+}
+
+// SetLeaderFunc makes cron runs happen only while leader returns true, so
+// one of several instances sharing a database runs them. Manual runs are
+// not affected.
+func (s *Scheduler) SetLeaderFunc(leader func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leader = leader
+}
+
+// SetFailureNotifier sets the callback told about failed runs
+func (s *Scheduler) SetFailureNotifier(fn ScheduleFailureNotifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifier = fn
+}
+
+// Start loads the enabled schedules and runs them until ctx is done or Stop
+// is called
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("sync scheduler is already running")
+	}
+	stop := make(chan struct{})
+	s.stop = stop
+	s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		s.mu.Lock()
+		s.stop = nil
+		s.mu.Unlock()
+		return fmt.Errorf("failed to load sync schedules: %w", err)
+	}
+	s.cron.Start()
+	s.mu.RLock()
+	count := len(s.entries)
+	s.mu.RUnlock()
+
+	go func() {
+		ticker := s.engine.clock.NewTicker(scheduleReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.Stop()
+				return
+			case <-stop:
+				return
+			case <-ticker.C():
+				s.reloadQuietly()
+			}
+		}
+	}()
+
+	s.logger.WithFields(map[string]any{
+		"schedules": count,
+		"component": "sync_scheduler",
+	}).Info("Sync scheduler started")
+	return nil
+}
+
+// Ready reports why the scheduler is not running its schedules: it was not
+// started, or its last reload of the schedules failed
+func (s *Scheduler) Ready() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.stop == nil {
+		return fmt.Errorf("sync scheduler is not running")
+	}
+	if s.reloadErr != nil {
+		return fmt.Errorf("failed to reload sync schedules: %w", s.reloadErr)
+	}
+	return nil
+}
+
+// Stop stops scheduling and waits for running jobs to finish
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if s.stop == nil {
+		s.mu.Unlock()
+		return
+	}
+	close(s.stop)
+	s.stop = nil
+	s.mu.Unlock()
+
+	<-s.cron.Stop().Done()
+	s.logger.WithFields(map[string]any{"component": "sync_scheduler"}).Info("Sync scheduler stopped")
+}
+
+// ListSchedules returns all schedules by name
+func (s *Scheduler) ListSchedules(ctx context.Context) ([]SyncScheduleInfo, error) {
+	db, err := s.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var schedules []database.SyncSchedule
+	if err := db.Order("name ASC").Find(&schedules).Error; err != nil {
+		return nil, fmt.Errorf("failed to list sync schedules: %w", err)
+	}
+	infos := make([]SyncScheduleInfo, 0, len(schedules))
+	for i := range schedules {
+		infos = append(infos, s.info(&schedules[i]))
+	}
+	return infos, nil
+}
+
+// GetSchedule returns a schedule by ID
+func (s *Scheduler) GetSchedule(ctx context.Context, id uint) (*SyncScheduleInfo, error) {
+	schedule, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	info := s.info(schedule)
+	return &info, nil
+}
+
+// CreateSchedule validates and stores a new schedule. Schedules are enabled
+// unless spec says otherwise.
+func (s *Scheduler) CreateSchedule(ctx context.Context, spec ScheduleSpec) (*SyncScheduleInfo, error) {
+	db, err := s.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Request == nil {
+		return nil, fmt.Errorf("%w: request is required", ErrInvalidSchedule)
+	}
+	schedule := database.SyncSchedule{Enabled: spec.Enabled == nil || *spec.Enabled}
+	if err := s.apply(db, &schedule, spec, true); err != nil {
+		return nil, err
+	}
+	if err := db.Create(&schedule).Error; err != nil {
+		return nil, fmt.Errorf("failed to create sync schedule: %w", err)
+	}
+	s.reloadQuietly()
+
+	s.logger.WithFields(map[string]any{
+		"schedule_id": schedule.ID,
+		"name":        schedule.Name,
+		"plugin":      schedule.PluginName,
+		"cron":        schedule.CronSpec,
+		"component":   "sync_scheduler",
+	}).Info("Sync schedule created")
+	info := s.info(&schedule)
+	return &info, nil
+}
+
+// UpdateSchedule changes a schedule. Sensitive plugin settings left out of
+// a new request for the same plugin keep their stored values, since they
+// are never returned by the API.
+func (s *Scheduler) UpdateSchedule(ctx context.Context, id uint, spec ScheduleSpec) (*SyncScheduleInfo, error) {
+	db, err := s.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Enabled != nil {
+		schedule.Enabled = *spec.Enabled
+	}
+	if err := s.apply(db, schedule, spec, false); err != nil {
+		return nil, err
+	}
+	// Run state is left alone, a run may be in progress
+	if err := db.Model(schedule).
+		Select("name", "cron_spec", "enabled", "request", "plugin_name", "format", "next_run_at").
+		Updates(schedule).Error; err != nil {
+		return nil, fmt.Errorf("failed to update sync schedule: %w", err)
+	}
+	s.reloadQuietly()
+
+	info := s.info(schedule)
+	return &info, nil
+}
+
+// DeleteSchedule removes a schedule; its past runs stay in the run history
+func (s *Scheduler) DeleteSchedule(ctx context.Context, id uint) error {
+	db, err := s.db(ctx)
+	if err != nil {
+		return err
+	}
+	result := db.Delete(&database.SyncSchedule{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete sync schedule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %d", ErrScheduleNotFound, id)
+	}
+	s.reloadQuietly()
+	return nil
+}
+
+// RunSchedule runs a schedule's export now, whether or not it is enabled.
+// It returns ErrScheduleRunning while a run of the schedule is in progress.
+// The export is recorded in the run history as requested by the schedule.
+func (s *Scheduler) RunSchedule(ctx context.Context, id uint) (*ExportResult, error) {
+	db, err := s.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.engine.clock.Now()
+	claim := db.Model(&database.SyncSchedule{}).
+		Where("id = ? AND (running_since IS NULL OR running_since < ?)", id, now.Add(-staleRunAfter)).
+		Update("running_since", now)
+	if claim.Error != nil {
+		return nil, fmt.Errorf("failed to claim sync schedule: %w", claim.Error)
+	}
+	if claim.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrScheduleRunning, schedule.Name)
+	}
+
+	var result *ExportResult
+	var request ExportRequest
+	if err = json.Unmarshal([]byte(schedule.Request), &request); err != nil {
+		err = fmt.Errorf("%w: stored request is unreadable: %v", ErrInvalidSchedule, err)
+	} else {
+		request.CreatedBy = "scheduler"
+		request.ExportType = "scheduled"
+		result, err = s.engine.Export(ctx, request)
+		if result != nil {
+			_ = s.engine.SaveExportHistory(ctx, request, result, "schedule:"+schedule.Name)
+		}
+	}
+
+	updates := map[string]interface{}{
+		"running_since": nil,
+		"last_run_at":   now,
+		"last_status":   ScheduleStatusSuccess,
+		"last_error":    "",
+		"run_count":     gorm.Expr("run_count + 1"),
+		"next_run_at":   nextRun(schedule.CronSpec, schedule.Enabled, s.engine.clock.Now()),
+	}
+	if result != nil {
+		updates["last_export_id"] = result.ExportID
+	}
+	message := ""
+	switch {
+	case err != nil:
+		message = err.Error()
+	case !result.Success:
+		message = strings.Join(result.Errors, "; ")
+		if message == "" {
+			message = "export failed"
+		}
+	}
+	if message != "" {
+		updates["last_status"] = ScheduleStatusFailed
+		updates["last_error"] = message
+		updates["failure_count"] = gorm.Expr("failure_count + 1")
+	}
+	// The claim is released even when the request was cancelled
+	if updateErr := db.WithContext(context.WithoutCancel(ctx)).Model(&database.SyncSchedule{}).
+		Where("id = ?", id).Updates(updates).Error; updateErr != nil {
+		s.logger.WithFields(map[string]any{
+			"schedule_id": id,
+			"error":       updateErr.Error(),
+			"component":   "sync_scheduler",
+		}).Error("Failed to record sync schedule run")
+	}
+
+	fields := map[string]any{
+		"schedule_id": id,
+		"name":        schedule.Name,
+		"plugin":      schedule.PluginName,
+		"component":   "sync_scheduler",
+	}
+	if message == "" {
+		fields["export_id"] = result.ExportID
+		s.logger.WithFields(fields).Info("Scheduled sync completed")
+		return result, nil
+	}
+	fields["error"] = message
+	s.logger.WithFields(fields).Warn("Scheduled sync failed")
+
+	s.mu.RLock()
+	notify := s.notifier
+	s.mu.RUnlock()
+	if notify != nil {
+		notify(context.WithoutCancel(ctx), *schedule, message)
+	}
+	return result, err
+}
+
+// runScheduled is the cron job of a schedule
+func (s *Scheduler) runScheduled(id uint) {
+	s.mu.RLock()
+	leader := s.leader
+	s.mu.RUnlock()
+	if leader != nil && !leader() {
+		return
+	}
+	if _, err := s.RunSchedule(context.Background(), id); errors.Is(err, ErrScheduleRunning) {
+		s.logger.WithFields(map[string]any{
+			"schedule_id": id,
+			"component":   "sync_scheduler",
+		}).Warn("Skipping scheduled sync, previous run still in progress")
+	}
+}
+
+// reload brings the cron entries in line with the enabled schedules
+func (s *Scheduler) reload() error {
+	db := s.engine.dbManager.GetDB()
+	if db == nil {
+		return nil
+	}
+	var schedules []database.SyncSchedule
+	if err := db.Where("enabled = ?", true).Find(&schedules).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[uint]bool, len(schedules))
+	for _, schedule := range schedules {
+		seen[schedule.ID] = true
+		entry, ok := s.entries[schedule.ID]
+		if ok && entry.spec == schedule.CronSpec {
+			continue
+		}
+		if ok {
+			s.cron.Remove(entry.id)
+			delete(s.entries, schedule.ID)
+		}
+		id := schedule.ID
+		entryID, err := s.cron.AddFunc(schedule.CronSpec, func() { s.runScheduled(id) })
+		if err != nil {
+			s.logger.WithFields(map[string]any{
+				"schedule_id": id,
+				"cron":        schedule.CronSpec,
+				"error":       err.Error(),
+				"component":   "sync_scheduler",
+			}).Warn("Skipping sync schedule with invalid cron expression")
+			continue
+		}
+		s.entries[id] = scheduleEntry{id: entryID, spec: schedule.CronSpec}
+	}
+	for id, entry := range s.entries {
+		if !seen[id] {
+			s.cron.Remove(entry.id)
+			delete(s.entries, id)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) reloadQuietly() {
+	err := s.reload()
+	s.mu.Lock()
+	s.reloadErr = err
+	s.mu.Unlock()
+	if err != nil {
+		s.logger.WithFields(map[string]any{
+			"error":     err.Error(),
+			"component": "sync_scheduler",
+		}).Warn("Failed to reload sync schedules")
+	}
+}
+
+// apply validates spec and copies it onto schedule
+func (s *Scheduler) apply(db *gorm.DB, schedule *database.SyncSchedule, spec ScheduleSpec, create bool) error {
+	if name := strings.TrimSpace(spec.Name); name != "" || create {
+		if name == "" {
+			return fmt.Errorf("%w: name is required", ErrInvalidSchedule)
+		}
+		var count int64
+		if err := db.Model(&database.SyncSchedule{}).
+			Where("name = ? AND id <> ?", name, schedule.ID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check sync schedule name: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s", ErrScheduleExists, name)
+		}
+		schedule.Name = name
+	}
+
+	if cronSpec := strings.TrimSpace(spec.CronSpec); cronSpec != "" || create {
+		if _, err := scheduleParser.Parse(cronSpec); err != nil {
+			return fmt.Errorf("%w: cron_spec %q: %v", ErrInvalidSchedule, cronSpec, err)
+		}
+		schedule.CronSpec = cronSpec
+	}
+
+	if spec.Request != nil {
+		request := *spec.Request
+		if !create {
+			var stored ExportRequest
+			if json.Unmarshal([]byte(schedule.Request), &stored) == nil && stored.PluginName == request.PluginName {
+				request.Config = s.engine.keepSensitive(request.PluginName, stored.Config, request.Config)
+			}
+		}
+		if err := s.engine.ValidateExport(request); err != nil {
+			return err
+		}
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+		schedule.Request = string(data)
+		schedule.PluginName = request.PluginName
+		schedule.Format = request.Format
+	}
+
+	schedule.NextRunAt = nextRun(schedule.CronSpec, schedule.Enabled, s.engine.clock.Now())
+	return nil
+}
+
+func (s *Scheduler) info(schedule *database.SyncSchedule) SyncScheduleInfo {
+	info := SyncScheduleInfo{SyncSchedule: *schedule}
+	var request ExportRequest
+	if json.Unmarshal([]byte(schedule.Request), &request) == nil {
+		info.Request = rawJSON(s.engine.exportRunParameters(request))
+	}
+	return info
+}
+
+func (s *Scheduler) load(ctx context.Context, id uint) (*database.SyncSchedule, error) {
+	db, err := s.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var schedule database.SyncSchedule
+	if err := db.First(&schedule, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrScheduleNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to get sync schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+func (s *Scheduler) db(ctx context.Context) (*gorm.DB, error) {
+	db := s.engine.dbManager.GetDB()
+	if db == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+	return db.WithContext(ctx), nil
+}
+
+// nextRun is the next time an enabled schedule fires
+func nextRun(cronSpec string, enabled bool, now time.Time) *time.Time {
+	if !enabled {
+		return nil
+	}
+	schedule, err := scheduleParser.Parse(cronSpec)
+	if err != nil {
+		return nil
+	}
+	next := schedule.Next(now)
+	return &next
+}
@@ -0,0 +1,191 @@
+package sync_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ginsys/shelly-manager/internal/database"
+	"github.com/ginsys/shelly-manager/internal/logging"
+	syncengine "github.com/ginsys/shelly-manager/internal/sync"
+	"github.com/ginsys/shelly-manager/internal/testutil"
+)
+
+// gatePlugin needs a sensitive token, fails on demand and can hold an
+// export until released
+type gatePlugin struct {
+	fail    bool
+	started chan struct{}
+	release chan struct{}
+	tokens  []interface{}
+}
+
+func (p *gatePlugin) Info() syncengine.PluginInfo {
+	return syncengine.PluginInfo{Name: "gate", Version: "1.0.0", SupportedFormats: []string{"json"}}
+}
+func (p *gatePlugin) ConfigSchema() syncengine.ConfigSchema {
+	return syncengine.ConfigSchema{Properties: map[string]syncengine.PropertySchema{
+		"target": {Type: "string"},
+		"token":  {Type: "string", Sensitive: true},
+	}}
+}
+func (p *gatePlugin) ValidateConfig(cfg map[string]interface{}) error {
+	if cfg["token"] == nil {
+		return fmt.Errorf("token is required")
+	}
+	return nil
+}
+func (p *gatePlugin) Export(_ context.Context, _ *syncengine.ExportData, cfg syncengine.ExportConfig) (*syncengine.ExportResult, error) {
+	p.tokens = append(p.tokens, cfg.Config["token"])
+	if p.started != nil {
+		p.started <- struct{}{}
+		<-p.release
+	}
+	if p.fail {
+		return nil, errors.New("target unreachable")
+	}
+	return &syncengine.ExportResult{Success: true}, nil
+}
+func (p *gatePlugin) Preview(context.Context, *syncengine.ExportData, syncengine.ExportConfig) (*syncengine.PreviewResult, error) {
+	return &syncengine.PreviewResult{Success: true}, nil
+}
+func (p *gatePlugin) Import(context.Context, syncengine.ImportSource, syncengine.ImportConfig) (*syncengine.ImportResult, error) {
+	return nil, nil
+}
+func (p *gatePlugin) Capabilities() syncengine.PluginCapabilities {
+	return syncengine.PluginCapabilities{}
+}
+func (p *gatePlugin) Initialize(*logging.Logger) error { return nil }
+func (p *gatePlugin) Cleanup() error                   { return nil }
+
+func TestSchedulerRuns(t *testing.T) {
+	db, cleanup := testutil.TestDatabase(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+
+	plugin := &gatePlugin{}
+	engine := syncengine.NewSyncEngine(db, logger)
+	require.NoError(t, engine.RegisterPlugin(plugin))
+	scheduler := syncengine.NewScheduler(engine, logger)
+	var failures []string
+	scheduler.SetFailureNotifier(func(_ context.Context, s database.SyncSchedule, message string) {
+		failures = append(failures, s.Name+": "+message)
+	})
+	ctx := context.Background()
+
+	// Readiness follows the scheduler's lifecycle
+	require.Error(t, scheduler.Ready())
+	require.NoError(t, scheduler.Start(ctx))
+	require.NoError(t, scheduler.Ready())
+	scheduler.Stop()
+	require.Error(t, scheduler.Ready())
+
+	request := &syncengine.ExportRequest{
+		PluginName: "gate",
+		Format:     "json",
+		Config:     map[string]interface{}{"target": "git.local", "token": "t0ken"},
+	}
+	_, err = scheduler.CreateSchedule(ctx, syncengine.ScheduleSpec{Name: "bad", CronSpec: "every night", Request: request})
+	require.ErrorIs(t, err, syncengine.ErrInvalidSchedule)
+	_, err = scheduler.CreateSchedule(ctx, syncengine.ScheduleSpec{Name: "bad", CronSpec: "@daily", Request: &syncengine.ExportRequest{PluginName: "gate", Format: "json"}})
+	require.ErrorIs(t, err, syncengine.ErrInvalidPluginConfig)
+
+	created, err := scheduler.CreateSchedule(ctx, syncengine.ScheduleSpec{Name: "gitops", CronSpec: "0 * * * *", Request: request})
+	require.NoError(t, err)
+	require.True(t, created.Enabled)
+	require.NotNil(t, created.NextRunAt)
+	require.NotContains(t, string(created.Request), "t0ken")
+	require.Contains(t, string(created.Request), "git.local")
+
+	_, err = scheduler.CreateSchedule(ctx, syncengine.ScheduleSpec{Name: "gitops", CronSpec: "@weekly", Request: request})
+	require.ErrorIs(t, err, syncengine.ErrScheduleExists)
+
+	// A new request without the token keeps the stored one
+	disabled := false
+	updated, err := scheduler.UpdateSchedule(ctx, created.ID, syncengine.ScheduleSpec{
+		Enabled: &disabled,
+		Request: &syncengine.ExportRequest{PluginName: "gate", Format: "json", Config: map[string]interface{}{"target": "git2.local"}},
+	})
+	require.NoError(t, err)
+	require.False(t, updated.Enabled)
+	require.Nil(t, updated.NextRunAt)
+	require.Equal(t, "0 * * * *", updated.CronSpec)
+
+	// Disabled schedules still run by hand and are recorded in the run history
+	result, err := scheduler.RunSchedule(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"t0ken"}, plugin.tokens)
+	run, err := engine.GetSyncRun(ctx, result.ExportID)
+	require.NoError(t, err)
+	require.Equal(t, "schedule:gitops", run.RequestedBy)
+
+	plugin.fail = true
+	_, err = scheduler.RunSchedule(ctx, created.ID)
+	require.Error(t, err)
+	require.Equal(t, []string{"gitops: target unreachable"}, failures)
+
+	got, err := scheduler.GetSchedule(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, 2, got.RunCount)
+	require.Equal(t, 1, got.FailureCount)
+	require.Equal(t, syncengine.ScheduleStatusFailed, got.LastStatus)
+	require.Equal(t, "target unreachable", got.LastError)
+	require.Nil(t, got.RunningSince)
+
+	// A run in progress blocks another
+	plugin.fail = false
+	plugin.started = make(chan struct{})
+	plugin.release = make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := scheduler.RunSchedule(ctx, created.ID)
+		done <- err
+	}()
+	<-plugin.started
+	_, err = scheduler.RunSchedule(ctx, created.ID)
+	require.ErrorIs(t, err, syncengine.ErrScheduleRunning)
+	close(plugin.release)
+	require.NoError(t, <-done)
+
+	require.NoError(t, scheduler.DeleteSchedule(ctx, created.ID))
+	_, err = scheduler.RunSchedule(ctx, created.ID)
+	require.ErrorIs(t, err, syncengine.ErrScheduleNotFound)
+}
+
+func TestSchedulerFakeClock(t *testing.T) {
+	db, cleanup := testutil.TestDatabaseMemory(t)
+	defer cleanup()
+	logger, err := logging.New(logging.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+
+	now := time.Date(2026, 3, 1, 10, 30, 0, 0, time.Local)
+	clock := testutil.NewFakeClock(now)
+	engine := syncengine.NewSyncEngine(db, logger)
+	engine.SetClock(clock)
+	require.NoError(t, engine.RegisterPlugin(&gatePlugin{}))
+	scheduler := syncengine.NewScheduler(engine, logger)
+	ctx := context.Background()
+
+	created, err := scheduler.CreateSchedule(ctx, syncengine.ScheduleSpec{
+		Name:     "hourly",
+		CronSpec: "0 * * * *",
+		Request:  &syncengine.ExportRequest{PluginName: "gate", Format: "json", Config: map[string]interface{}{"token": "t0ken"}},
+	})
+	require.NoError(t, err)
+	require.True(t, created.NextRunAt.Equal(now.Truncate(time.Hour).Add(time.Hour)))
+
+	clock.Advance(2 * time.Hour)
+	result, err := scheduler.RunSchedule(ctx, created.ID)
+	require.NoError(t, err)
+	require.True(t, result.CreatedAt.Equal(clock.Now()))
+
+	got, err := scheduler.GetSchedule(ctx, created.ID)
+	require.NoError(t, err)
+	require.True(t, got.LastRunAt.Equal(clock.Now()))
+	require.True(t, got.NextRunAt.Equal(now.Truncate(time.Hour).Add(3*time.Hour)))
+}
@@ -0,0 +1,312 @@
+package sync
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signature algorithms of artifact manifests
+const (
+	SignatureHMACSHA256 = "hmac-sha256"
+	SignatureEd25519    = "ed25519"
+)
+
+const (
+	// ManifestFile is the manifest of a directory artifact, at its root
+	ManifestFile = "manifest.json"
+	// ManifestSuffix is appended to a file artifact's path for its manifest
+	ManifestSuffix = ".manifest.json"
+
+	manifestVersion  = 1
+	minHMACKeyLength = 16
+)
+
+// signedPlugins are the plugins whose artifacts are signed and verified
+var signedPlugins = map[string]bool{"backup": true, "gitops": true}
+
+// ErrArtifactSignature is wrapped when an artifact has no manifest, or its
+// signature or file hashes do not match
+var ErrArtifactSignature = errors.New("artifact signature verification failed")
+
+// ArtifactFile is a file of a signed artifact
+type ArtifactFile struct {
+	Path   string `json:"path"` // slash-separated, relative to the artifact
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ArtifactManifest lists the files of an export artifact with their hashes
+// and carries the signature over them
+type ArtifactManifest struct {
+	Version   int            `json:"version"`
+	ExportID  string         `json:"export_id,omitempty"`
+	Plugin    string         `json:"plugin"`
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []ArtifactFile `json:"files"`
+	Algorithm string         `json:"algorithm"`
+	KeyID     string         `json:"key_id"`
+	Signature string         `json:"signature"`
+}
+
+// SigningKeys configures an ArtifactSigner. Key is the HMAC secret or the
+// base64 Ed25519 private key (32 byte seed or 64 byte key); PublicKey is a
+// base64 Ed25519 public key for verifying only.
+type SigningKeys struct {
+	Algorithm string
+	Key       string
+	PublicKey string
+}
+
+// ArtifactSigner writes and checks artifact manifests
+type ArtifactSigner struct {
+	algorithm string
+	hmacKey   []byte
+	private   ed25519.PrivateKey
+	public    ed25519.PublicKey
+	keyID     string
+}
+
+// NewArtifactSigner creates a signer from keys. It returns nil without a key.
+func NewArtifactSigner(keys SigningKeys) (*ArtifactSigner, error) {
+	if keys.Key == "" && keys.PublicKey == "" {
+		return nil, nil
+	}
+	algorithm := strings.ToLower(strings.TrimSpace(keys.Algorithm))
+	if algorithm == "" {
+		algorithm = SignatureHMACSHA256
+	}
+	s := &ArtifactSigner{algorithm: algorithm}
+	switch algorithm {
+	case SignatureHMACSHA256:
+		if len(keys.Key) < minHMACKeyLength {
+			return nil, fmt.Errorf("hmac-sha256 signing key must be at least %d characters", minHMACKeyLength)
+		}
+		s.hmacKey = []byte(keys.Key)
+		sum := sha256.Sum256(append([]byte("shelly-manager export key\x00"), s.hmacKey...))
+		s.keyID = hex.EncodeToString(sum[:8])
+	case SignatureEd25519:
+		if keys.Key != "" {
+			raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(keys.Key))
+			if err != nil {
+				return nil, fmt.Errorf("ed25519 signing key is not base64: %w", err)
+			}
+			switch len(raw) {
+			case ed25519.SeedSize:
+				s.private = ed25519.NewKeyFromSeed(raw)
+			case ed25519.PrivateKeySize:
+				s.private = ed25519.PrivateKey(raw)
+			default:
+				return nil, fmt.Errorf("ed25519 signing key must be %d or %d bytes", ed25519.SeedSize, ed25519.PrivateKeySize)
+			}
+			s.public = s.private.Public().(ed25519.PublicKey)
+		} else {
+			raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(keys.PublicKey))
+			if err != nil || len(raw) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("ed25519 public key must be %d base64 bytes", ed25519.PublicKeySize)
+			}
+			s.public = ed25519.PublicKey(raw)
+		}
+		sum := sha256.Sum256(s.public)
+		s.keyID = hex.EncodeToString(sum[:8])
+	default:
+		return nil, fmt.Errorf("unknown signing algorithm %q", keys.Algorithm)
+	}
+	return s, nil
+}
+
+// CanSign reports whether the signer holds a signing key
+func (s *ArtifactSigner) CanSign() bool {
+	return s.hmacKey != nil || s.private != nil
+}
+
+// KeyID identifies the key without revealing it
+func (s *ArtifactSigner) KeyID() string {
+	return s.keyID
+}
+
+// ManifestPath returns where the manifest of the artifact at path is kept
+func ManifestPath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return filepath.Join(path, ManifestFile), nil
+	}
+	return path + ManifestSuffix, nil
+}
+
+// Sign hashes the files of the artifact at path and writes its signed
+// manifest
+func (s *ArtifactSigner) Sign(path, plugin, exportID string) (*ArtifactManifest, error) {
+	if !s.CanSign() {
+		return nil, fmt.Errorf("no signing key configured")
+	}
+	manifestPath, err := ManifestPath(path)
+	if err != nil {
+		return nil, err
+	}
+	files, err := artifactFiles(path, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &ArtifactManifest{
+		Version:   manifestVersion,
+		ExportID:  exportID,
+		Plugin:    plugin,
+		CreatedAt: time.Now().UTC(),
+		Files:     files,
+		Algorithm: s.algorithm,
+		KeyID:     s.keyID,
+	}
+	payload, err := manifestPayload(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if s.algorithm == SignatureEd25519 {
+		manifest.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.private, payload))
+	} else {
+		mac := hmac.New(sha256.New, s.hmacKey)
+		mac.Write(payload)
+		manifest.Signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(manifestPath, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// Verify checks the manifest of the artifact at path: the signature must be
+// made with this signer's key and every file must be present, unchanged and
+// listed. Failures wrap ErrArtifactSignature.
+func (s *ArtifactSigner) Verify(path string) (*ArtifactManifest, error) {
+	manifestPath, err := ManifestPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrArtifactSignature, err)
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: no manifest at %s", ErrArtifactSignature, manifestPath)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrArtifactSignature, err)
+	}
+	var manifest ArtifactManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %v", ErrArtifactSignature, err)
+	}
+	if manifest.Algorithm != s.algorithm || manifest.KeyID != s.keyID {
+		return nil, fmt.Errorf("%w: signed with %s key %s, expected %s key %s", ErrArtifactSignature, manifest.Algorithm, manifest.KeyID, s.algorithm, s.keyID)
+	}
+	signature, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding", ErrArtifactSignature)
+	}
+	payload, err := manifestPayload(&manifest)
+	if err != nil {
+		return nil, err
+	}
+	valid := false
+	if s.algorithm == SignatureEd25519 {
+		valid = ed25519.Verify(s.public, payload, signature)
+	} else {
+		mac := hmac.New(sha256.New, s.hmacKey)
+		mac.Write(payload)
+		valid = hmac.Equal(mac.Sum(nil), signature)
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: the manifest signature does not match", ErrArtifactSignature)
+	}
+
+	files, err := artifactFiles(path, manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrArtifactSignature, err)
+	}
+	present := make(map[string]ArtifactFile, len(files))
+	for _, f := range files {
+		present[f.Path] = f
+	}
+	for _, want := range manifest.Files {
+		got, ok := present[want.Path]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("%w: %s is missing", ErrArtifactSignature, want.Path)
+		case got.Size != want.Size:
+			return nil, fmt.Errorf("%w: %s is %d bytes, signed with %d", ErrArtifactSignature, want.Path, got.Size, want.Size)
+		case got.SHA256 != want.SHA256:
+			return nil, fmt.Errorf("%w: %s was modified", ErrArtifactSignature, want.Path)
+		}
+		delete(present, want.Path)
+	}
+	for extra := range present {
+		return nil, fmt.Errorf("%w: %s is not in the manifest", ErrArtifactSignature, extra)
+	}
+	return &manifest, nil
+}
+
+// manifestPayload is the signed encoding of a manifest: its JSON without
+// the signature
+func manifestPayload(manifest *ArtifactManifest) ([]byte, error) {
+	unsigned := *manifest
+	unsigned.Signature = ""
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return data, nil
+}
+
+// artifactFiles hashes the regular files of the artifact at path, leaving
+// out its manifest, in path order
+func artifactFiles(path, manifestPath string) ([]ArtifactFile, error) {
+	var files []ArtifactFile
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || p == manifestPath {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", p)
+		}
+		rel := filepath.Base(p)
+		if p != path {
+			if rel, err = filepath.Rel(path, p); err != nil {
+				return err
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := FileSHA256(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, ArtifactFile{Path: filepath.ToSlash(rel), Size: info.Size(), SHA256: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash artifact: %w", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
@@ -0,0 +1,138 @@
+package sync
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeArtifactFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
+
+func TestArtifactSigner_HMAC(t *testing.T) {
+	signer, err := NewArtifactSigner(SigningKeys{Key: "0123456789abcdef-secret"})
+	if err != nil || signer == nil || !signer.CanSign() {
+		t.Fatalf("Expected an HMAC signer, got %v", err)
+	}
+	if _, err := NewArtifactSigner(SigningKeys{Key: "short"}); err == nil {
+		t.Error("Expected a short HMAC key refused")
+	}
+	if s, err := NewArtifactSigner(SigningKeys{}); s != nil || err != nil {
+		t.Errorf("Expected no signer without a key, got %v, %v", s, err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "gitops")
+	writeArtifactFile(t, filepath.Join(dir, "common.yaml"), "mqtt: {}\n")
+	writeArtifactFile(t, filepath.Join(dir, "kitchen", "switch.yaml"), "name: switch\n")
+
+	manifest, err := signer.Sign(dir, "gitops", "exp-1")
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if len(manifest.Files) != 2 || manifest.Files[1].Path != "kitchen/switch.yaml" {
+		t.Fatalf("Expected both files listed in order, got %+v", manifest.Files)
+	}
+	if _, err := signer.Verify(dir); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	other, _ := NewArtifactSigner(SigningKeys{Key: "another-secret-of-16"})
+	if _, err := other.Verify(dir); !errors.Is(err, ErrArtifactSignature) {
+		t.Errorf("Expected another key refused, got %v", err)
+	}
+
+	tamper := []struct {
+		name string
+		edit func()
+		undo func()
+	}{
+		{
+			name: "modified file",
+			edit: func() { writeArtifactFile(t, filepath.Join(dir, "common.yaml"), "mqtt: {x}\n") },
+			undo: func() { writeArtifactFile(t, filepath.Join(dir, "common.yaml"), "mqtt: {}\n") },
+		},
+		{
+			name: "truncated file",
+			edit: func() { writeArtifactFile(t, filepath.Join(dir, "common.yaml"), "mqtt") },
+			undo: func() { writeArtifactFile(t, filepath.Join(dir, "common.yaml"), "mqtt: {}\n") },
+		},
+		{
+			name: "extra file",
+			edit: func() { writeArtifactFile(t, filepath.Join(dir, "extra.yaml"), "x: 1\n") },
+			undo: func() { _ = os.Remove(filepath.Join(dir, "extra.yaml")) },
+		},
+		{
+			name: "missing file",
+			edit: func() { _ = os.Rename(filepath.Join(dir, "common.yaml"), filepath.Join(dir, "..", "common.yaml")) },
+			undo: func() { _ = os.Rename(filepath.Join(dir, "..", "common.yaml"), filepath.Join(dir, "common.yaml")) },
+		},
+	}
+	for _, tt := range tamper {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.edit()
+			defer tt.undo()
+			if _, err := signer.Verify(dir); !errors.Is(err, ErrArtifactSignature) {
+				t.Errorf("Expected the %s detected, got %v", tt.name, err)
+			}
+		})
+	}
+	if _, err := signer.Verify(dir); err != nil {
+		t.Errorf("Expected the restored artifact verified, got %v", err)
+	}
+
+	// A single file keeps its manifest alongside
+	file := filepath.Join(t.TempDir(), "backup.db")
+	writeArtifactFile(t, file, "SQLite format 3")
+	if _, err := signer.Verify(file); !errors.Is(err, ErrArtifactSignature) {
+		t.Errorf("Expected an unsigned file refused, got %v", err)
+	}
+	if _, err := signer.Sign(file, "backup", "exp-2"); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if _, err := os.Stat(file + ManifestSuffix); err != nil {
+		t.Errorf("Expected the manifest next to the file: %v", err)
+	}
+	if _, err := signer.Verify(file); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
+
+func TestArtifactSigner_Ed25519(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := NewArtifactSigner(SigningKeys{Algorithm: "ed25519", Key: base64.StdEncoding.EncodeToString(private.Seed())})
+	if err != nil {
+		t.Fatalf("NewArtifactSigner failed: %v", err)
+	}
+	verifier, err := NewArtifactSigner(SigningKeys{Algorithm: "ed25519", PublicKey: base64.StdEncoding.EncodeToString(public)})
+	if err != nil {
+		t.Fatalf("NewArtifactSigner failed: %v", err)
+	}
+	if verifier.CanSign() || verifier.KeyID() != signer.KeyID() {
+		t.Fatalf("Expected a verify-only signer with the same key ID")
+	}
+
+	file := filepath.Join(t.TempDir(), "backup.db")
+	writeArtifactFile(t, file, "SQLite format 3")
+	if _, err := verifier.Sign(file, "backup", ""); err == nil {
+		t.Error("Expected signing refused without a private key")
+	}
+	if _, err := signer.Sign(file, "backup", ""); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if _, err := verifier.Verify(file); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Export phases reported in ExportProgress
+const (
+	ExportPhaseLoading = "loading"
+	ExportPhaseWriting = "writing"
+	ExportPhaseSigning = "signing"
+	ExportPhaseDone    = "done"
+)
+
+// StreamingPlugin is an optional interface for plugins that write their
+// artifact record by record instead of building it in memory. Such plugins
+// can be streamed straight to an HTTP response.
+type StreamingPlugin interface {
+	// ExportStream writes the artifact to w and returns the number of
+	// records written
+	ExportStream(ctx context.Context, data *ExportData, config ExportConfig, w io.Writer) (int, error)
+	// StreamFileName names a streamed artifact for downloads
+	StreamFileName(config ExportConfig) string
+}
+
+// ExportProgress reports how far a running export got
+type ExportProgress struct {
+	Phase        string `json:"phase"`
+	RecordsTotal int    `json:"records_total"`
+	RecordsDone  int    `json:"records_done"`
+	BytesWritten int64  `json:"bytes_written"`
+}
+
+// progressTracker collects the progress an export reports through its
+// context
+type progressTracker struct {
+	mu       sync.Mutex
+	progress ExportProgress
+}
+
+type progressKey struct{}
+
+// withProgress returns a context whose export reports to t
+func withProgress(ctx context.Context, t *progressTracker) context.Context {
+	return context.WithValue(ctx, progressKey{}, t)
+}
+
+func progressFrom(ctx context.Context) *progressTracker {
+	t, _ := ctx.Value(progressKey{}).(*progressTracker)
+	return t
+}
+
+// snapshot returns the current progress
+func (t *progressTracker) snapshot() ExportProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.progress
+}
+
+// reportPhase records the phase an export entered
+func reportPhase(ctx context.Context, phase string) {
+	if t := progressFrom(ctx); t != nil {
+		t.mu.Lock()
+		t.progress.Phase = phase
+		t.mu.Unlock()
+	}
+}
+
+// ReportExportProgress lets plugins report the records written so far out
+// of total; it does nothing outside a tracked export
+func ReportExportProgress(ctx context.Context, done, total int) {
+	if t := progressFrom(ctx); t != nil {
+		t.mu.Lock()
+		t.progress.RecordsDone = done
+		t.progress.RecordsTotal = total
+		t.mu.Unlock()
+	}
+}
+
+// ProgressWriter wraps w so the bytes written through it count towards the
+// export's progress; outside a tracked export it returns w
+func ProgressWriter(ctx context.Context, w io.Writer) io.Writer {
+	t := progressFrom(ctx)
+	if t == nil {
+		return w
+	}
+	return &progressWriter{w: w, t: t}
+}
+
+type progressWriter struct {
+	w io.Writer
+	t *progressTracker
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.t.mu.Lock()
+	p.t.progress.BytesWritten += int64(n)
+	p.t.mu.Unlock()
+	return n, err
+}
+
+// streamingPlugin returns the plugin of a request when it can stream
+func (e *SyncEngine) streamingPlugin(request *ExportRequest) (StreamingPlugin, error) {
+	plugin, err := e.validateRequest(request, true)
+	if err != nil {
+		return nil, err
+	}
+	streamer, ok := plugin.(StreamingPlugin)
+	if !ok {
+		return nil, fmt.Errorf("%w: plugin %s does not support streaming", ErrUnsupportedFormat, request.PluginName)
+	}
+	return streamer, nil
+}
+
+// StreamFileName validates a streamed export request and names its
+// artifact, so callers can send headers before the first byte
+func (e *SyncEngine) StreamFileName(request ExportRequest) (string, error) {
+	streamer, err := e.streamingPlugin(&request)
+	if err != nil {
+		return "", err
+	}
+	return streamer.StreamFileName(exportConfigFromRequest(request)), nil
+}
+
+// ExportStream writes an export straight to w without storing a file, for
+// plugins implementing StreamingPlugin. The result carries the size and
+// SHA-256 of the bytes written; streamed artifacts are not signed.
+func (e *SyncEngine) ExportStream(ctx context.Context, request ExportRequest, w io.Writer) (*ExportResult, error) {
+	startTime := time.Now()
+	exportID := uuid.New().String()
+
+	streamer, err := e.streamingPlugin(&request)
+	if err != nil {
+		return e.failedExportResult(exportID, request, startTime, err), err
+	}
+
+	e.logger.Info("Starting streamed export",
+		"export_id", exportID,
+		"plugin", request.PluginName,
+		"format", request.Format,
+	)
+
+	reportPhase(ctx, ExportPhaseLoading)
+	data, err := e.loadExportData(ctx, request.Filters)
+	if err != nil {
+		wrapped := fmt.Errorf("failed to load data: %w", err)
+		return e.failedExportResult(exportID, request, startTime, wrapped), wrapped
+	}
+	data.Metadata.ExportID = exportID
+	data.Metadata.RequestedBy = strings.TrimSpace(request.CreatedBy)
+	if data.Metadata.RequestedBy == "" {
+		data.Metadata.RequestedBy = "shelly-manager"
+	}
+	data.Metadata.ExportType = "stream"
+	data.Timestamp = e.clock.Now()
+
+	reportPhase(ctx, ExportPhaseWriting)
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(w, hash)}
+	records, err := streamer.ExportStream(ctx, data, exportConfigFromRequest(request), ProgressWriter(ctx, counter))
+	if err != nil {
+		e.logger.Error("Streamed export failed",
+			"export_id", exportID,
+			"plugin", request.PluginName,
+			"bytes", counter.n,
+			"error", err,
+		)
+		return e.failedExportResult(exportID, request, startTime, err), err
+	}
+	reportPhase(ctx, ExportPhaseDone)
+
+	result := &ExportResult{
+		Success:     true,
+		ExportID:    exportID,
+		PluginName:  request.PluginName,
+		Format:      request.Format,
+		RecordCount: records,
+		FileSize:    counter.n,
+		Checksum:    fmt.Sprintf("%x", hash.Sum(nil)),
+		Duration:    time.Since(startTime),
+		Metadata:    map[string]interface{}{"streamed": true},
+		CreatedAt:   e.clock.Now(),
+	}
+	e.logger.Info("Streamed export completed",
+		"export_id", exportID,
+		"plugin", request.PluginName,
+		"bytes", result.FileSize,
+		"records", records,
+		"duration", result.Duration,
+	)
+	e.storeExportResult(result)
+	return result, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
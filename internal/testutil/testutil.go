@@ -42,20 +42,26 @@ func TestConfig() *config.Config {
 			SlowQueryTime   int               `mapstructure:"slow_query_time"`
 			LogLevel        string            `mapstructure:"log_level"`
 			Options         map[string]string `mapstructure:"options"`
+
+			EncryptionKey          string   `mapstructure:"encryption_key"`
+			PreviousEncryptionKeys []string `mapstructure:"previous_encryption_keys"`
 		}{
 			Path: ":memory:", // Use in-memory SQLite for tests
 		},
 		Discovery: struct {
-			Enabled         bool     `mapstructure:"enabled"`
-			Networks        []string `mapstructure:"networks"`
-			Interval        int      `mapstructure:"interval"`
-			Timeout         int      `mapstructure:"timeout"`
-			EnableMDNS      bool     `mapstructure:"enable_mdns"`
-			EnableSSDP      bool     `mapstructure:"enable_ssdp"`
-			ConcurrentScans int      `mapstructure:"concurrent_scans"`
+			Enabled         bool                       `mapstructure:"enabled"`
+			Networks        []config.DiscoveryNetwork  `mapstructure:"networks"`
+			Interval        int                        `mapstructure:"interval"`
+			Timeout         int                        `mapstructure:"timeout"`
+			EnableMDNS      bool                       `mapstructure:"enable_mdns"`
+			EnableSSDP      bool                       `mapstructure:"enable_ssdp"`
+			ConcurrentScans int                        `mapstructure:"concurrent_scans"`
+			Exclude         config.DiscoveryExclude    `mapstructure:"exclude"`
+			NewDeviceAlerts bool                       `mapstructure:"new_device_alerts"`
+			DHCPLeases      config.DiscoveryDHCPLeases `mapstructure:"dhcp_leases"`
 		}{
 			Enabled:         true,
-			Networks:        []string{"192.168.1.0/24"},
+			Networks:        []config.DiscoveryNetwork{{CIDR: "192.168.1.0/24"}},
 			Interval:        300,
 			Timeout:         2,
 			EnableMDNS:      true,
@@ -67,8 +73,22 @@ func TestConfig() *config.Config {
 
 var testDbMutex sync.Mutex
 
-// TestDatabase creates a test database using provider abstraction
+// TestDatabaseEnv names the environment variable that switches TestDatabase
+// to in-memory SQLite for every test: SHELLY_TEST_DB=memory go test ./...
+const TestDatabaseEnv = "SHELLY_TEST_DB"
+
+// InMemoryTestDatabases reports whether TestDatabaseEnv asks for in-memory
+// test databases
+func InMemoryTestDatabases() bool {
+	return os.Getenv(TestDatabaseEnv) == "memory"
+}
+
+// TestDatabase creates a test database using provider abstraction. It is
+// backed by a temporary file, or by memory when InMemoryTestDatabases.
 func TestDatabase(t *testing.T) (*database.Manager, func()) {
+	if InMemoryTestDatabases() {
+		return TestDatabaseMemory(t)
+	}
 	testDbMutex.Lock()
 	defer testDbMutex.Unlock()
 
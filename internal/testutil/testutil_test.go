@@ -47,8 +47,8 @@ func TestTestConfig(t *testing.T) {
 		t.Error("Expected discovery networks to be configured")
 	}
 
-	if cfg.Discovery.Networks[0] != "192.168.1.0/24" {
-		t.Errorf("Expected first network 192.168.1.0/24, got %s", cfg.Discovery.Networks[0])
+	if cfg.Discovery.Networks[0].CIDR != "192.168.1.0/24" {
+		t.Errorf("Expected first network 192.168.1.0/24, got %s", cfg.Discovery.Networks[0].CIDR)
 	}
 
 	if cfg.Discovery.Interval != 300 {
@@ -72,6 +72,24 @@ func TestTestConfig(t *testing.T) {
 	}
 }
 
+func TestTestDatabaseInMemorySwitch(t *testing.T) {
+	t.Setenv(TestDatabaseEnv, "memory")
+	db, cleanup := TestDatabase(t)
+	defer cleanup()
+
+	// An in-memory main database has no file
+	var file string
+	if err := db.GetDB().Raw("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&file).Error; err != nil {
+		t.Fatalf("Failed to list databases: %v", err)
+	}
+	if file != "" {
+		t.Errorf("Expected an in-memory database, got file %q", file)
+	}
+	if err := db.AddDevice(&database.Device{IP: "192.168.1.201", MAC: "BB:CC:DD:EE:FF:01", Name: "Memory"}); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+}
+
 func TestTestDatabase(t *testing.T) {
 	db, cleanup := TestDatabase(t)
 	defer cleanup()
@@ -651,3 +669,34 @@ func TestLogTestNetUsage(t *testing.T) {
 	// Should not log for non-TEST-NET addresses
 	LogTestNetUsage(t, "192.168.1.1")
 }
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	ticker := clock.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	clock.Advance(30 * time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("Ticker fired before its period elapsed")
+	default:
+	}
+
+	clock.Advance(30 * time.Second)
+	select {
+	case tick := <-ticker.C():
+		AssertTrue(t, tick.Equal(start.Add(time.Minute)))
+	default:
+		t.Fatal("Ticker did not fire after its period")
+	}
+
+	// Set jumps without firing
+	clock.Set(start.Add(24 * time.Hour))
+	AssertTrue(t, clock.Now().Equal(start.Add(24*time.Hour)))
+	select {
+	case <-ticker.C():
+		t.Fatal("Set fired the ticker")
+	default:
+	}
+}
@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogBuffer keeps the last lines written to it for the log tail pane. It is
+// an io.Writer, so application logs can be redirected to it, and is safe for
+// concurrent use.
+type LogBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+	size    int
+}
+
+// NewLogBuffer creates a buffer keeping the last size lines
+func NewLogBuffer(size int) *LogBuffer {
+	if size <= 0 {
+		size = 200
+	}
+	return &LogBuffer{size: size}
+}
+
+// Write splits p into lines; an unterminated last line is kept until the
+// rest of it is written
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data := append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		b.add(strings.TrimRight(string(data[:i]), "\r"))
+		data = data[i+1:]
+	}
+	b.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// Logf adds a timestamped line
+func (b *LogBuffer) Logf(format string, args ...interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.add(time.Now().Format("15:04:05") + " " + fmt.Sprintf(format, args...))
+}
+
+// Lines returns up to the last n lines, oldest first
+func (b *LogBuffer) Lines(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > len(b.lines) {
+		n = len(b.lines)
+	}
+	return append([]string(nil), b.lines[len(b.lines)-n:]...)
+}
+
+func (b *LogBuffer) add(line string) {
+	// Control characters would corrupt the screen
+	line = strings.Map(func(r rune) rune {
+		if r < ' ' && r != '\t' {
+			return -1
+		}
+		return r
+	}, line)
+	b.lines = append(b.lines, strings.ReplaceAll(line, "\t", " "))
+	if len(b.lines) > b.size {
+		b.lines = b.lines[len(b.lines)-b.size:]
+	}
+}
@@ -0,0 +1,293 @@
+// Package tui implements the interactive terminal dashboard of the
+// shelly-manager CLI: a live device table with status, power and drift
+// indicators, device control keys and a log tail, for operators who work
+// over SSH without the web dashboard.
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Device is one row of the device table
+type Device struct {
+	ID     uint
+	Name   string
+	IP     string
+	Type   string
+	Status string   // online, offline or unknown
+	Output *bool    // state of the first switch, nil when unknown
+	Power  *float64 // current power in Watts, nil when not metered
+	Drift  string   // sync status of the stored configuration; empty when none is stored
+	Err    string   // why the live status could not be read
+}
+
+// Command is what the dashboard program does after a key press
+type Command struct {
+	Quit     bool
+	Refresh  bool
+	Action   string // on, off or toggle
+	DeviceID uint
+}
+
+// ANSI styles
+const (
+	styleReset   = "\x1b[0m"
+	styleBold    = "\x1b[1m"
+	styleReverse = "\x1b[7m"
+	styleRed     = "\x1b[31m"
+	styleGreen   = "\x1b[32m"
+	styleYellow  = "\x1b[33m"
+	styleDim     = "\x1b[2m"
+)
+
+// logPaneLines is the height of the log tail pane
+const logPaneLines = 8
+
+// Model is the dashboard state. It is not safe for concurrent use; the
+// dashboard program owns it.
+type Model struct {
+	Source   string // shown in the title, e.g. the server URL
+	devices  []Device
+	cursor   int
+	offset   int
+	showLogs bool
+	message  string
+	loadErr  string
+	updated  time.Time
+	logs     *LogBuffer
+}
+
+// NewModel creates a dashboard model showing the log tail of logs
+func NewModel(source string, logs *LogBuffer) *Model {
+	if logs == nil {
+		logs = NewLogBuffer(200)
+	}
+	return &Model{Source: source, logs: logs, showLogs: true}
+}
+
+// SetDevices replaces the device table, keeping the selected device
+func (m *Model) SetDevices(devices []Device, at time.Time) {
+	var selected uint
+	if d := m.Selected(); d != nil {
+		selected = d.ID
+	}
+	m.devices = devices
+	m.updated = at
+	m.loadErr = ""
+	m.cursor = 0
+	for i, d := range devices {
+		if d.ID == selected {
+			m.cursor = i
+			break
+		}
+	}
+}
+
+// SetLoadError records a failed refresh; the last table stays visible
+func (m *Model) SetLoadError(err error) {
+	m.loadErr = err.Error()
+}
+
+// SetMessage sets the status line message
+func (m *Model) SetMessage(format string, args ...interface{}) {
+	m.message = fmt.Sprintf(format, args...)
+}
+
+// Selected returns the selected device, or nil when the table is empty
+func (m *Model) Selected() *Device {
+	if m.cursor < 0 || m.cursor >= len(m.devices) {
+		return nil
+	}
+	return &m.devices[m.cursor]
+}
+
+// HandleKey applies a key press and returns what the dashboard program must
+// do
+func (m *Model) HandleKey(key string) Command {
+	switch key {
+	case "q", "ctrl+c":
+		return Command{Quit: true}
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-10)
+	case "pgdown":
+		m.move(10)
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.devices) - 1
+	case "r":
+		m.SetMessage("Refreshing...")
+		return Command{Refresh: true}
+	case "l":
+		m.showLogs = !m.showLogs
+	case "t", " ", "o", "f":
+		d := m.Selected()
+		if d == nil {
+			return Command{}
+		}
+		action := map[string]string{"t": "toggle", " ": "toggle", "o": "on", "f": "off"}[key]
+		m.SetMessage("Sending %s to %s...", action, displayName(*d))
+		return Command{Action: action, DeviceID: d.ID}
+	}
+	return Command{}
+}
+
+func (m *Model) move(delta int) {
+	m.cursor += delta
+	if m.cursor >= len(m.devices) {
+		m.cursor = len(m.devices) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+// Render draws the dashboard as lines fitting width x height
+func (m *Model) Render(width, height int) []string {
+	if width < 20 || height < 6 {
+		return []string{"Terminal too small"}
+	}
+
+	var online, drifted int
+	for _, d := range m.devices {
+		if d.Status == "online" {
+			online++
+		}
+		if d.Drift == "drift" {
+			drifted++
+		}
+	}
+	title := fmt.Sprintf("Shelly Manager %s - %d devices, %d online, %d drifted", m.Source, len(m.devices), online, drifted)
+	if !m.updated.IsZero() {
+		title += " - updated " + m.updated.Format("15:04:05")
+	}
+	lines := []string{styleBold + fit(title, width) + styleReset}
+
+	logLines := 0
+	if m.showLogs {
+		logLines = logPaneLines
+		if limit := (height - 4) / 2; logLines > limit {
+			logLines = limit
+		}
+	}
+	// title, header, status line, help line and the log pane separator
+	rows := height - 4 - logLines
+	if logLines > 0 {
+		rows--
+	}
+
+	lines = append(lines, styleBold+fit(formatRow("ID", "NAME", "IP", "TYPE", "STATUS", "OUT", "POWER", "DRIFT"), width)+styleReset)
+	m.scrollTo(rows)
+	for i := m.offset; i < m.offset+rows; i++ {
+		if i >= len(m.devices) {
+			lines = append(lines, "")
+			continue
+		}
+		lines = append(lines, m.renderDevice(m.devices[i], i == m.cursor, width))
+	}
+
+	if logLines > 0 {
+		lines = append(lines, styleDim+fit("--- log "+strings.Repeat("-", width), width)+styleReset)
+		tail := m.logs.Lines(logLines)
+		for i := 0; i < logLines; i++ {
+			if i < len(tail) {
+				lines = append(lines, fit(tail[i], width))
+			} else {
+				lines = append(lines, "")
+			}
+		}
+	}
+
+	status := m.message
+	if m.loadErr != "" {
+		status = styleRed + fit("Refresh failed: "+m.loadErr, width) + styleReset
+	} else if d := m.Selected(); d != nil && d.Err != "" && status == "" {
+		status = fit(displayName(*d)+": "+d.Err, width)
+	} else {
+		status = fit(status, width)
+	}
+	lines = append(lines, status)
+	lines = append(lines, styleDim+fit("up/down select  t/space toggle  o on  f off  r refresh  l logs  q quit", width)+styleReset)
+	return lines
+}
+
+// scrollTo keeps the cursor within the visible rows
+func (m *Model) scrollTo(rows int) {
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+	if m.offset < 0 {
+		m.offset = 0
+	}
+}
+
+func (m *Model) renderDevice(d Device, selected bool, width int) string {
+	out := "-"
+	if d.Output != nil {
+		out = "off"
+		if *d.Output {
+			out = "on"
+		}
+	}
+	power := "-"
+	if d.Power != nil {
+		power = fmt.Sprintf("%.1fW", *d.Power)
+	}
+	drift := d.Drift
+	if drift == "" {
+		drift = "-"
+	}
+	row := fit(formatRow(fmt.Sprint(d.ID), d.Name, d.IP, d.Type, d.Status, out, power, drift), width)
+	if selected {
+		return styleReverse + row + styleReset
+	}
+	switch {
+	case d.Status == "offline" || d.Drift == "error":
+		return styleRed + row + styleReset
+	case d.Drift == "drift":
+		return styleYellow + row + styleReset
+	case d.Status == "online":
+		return styleGreen + row + styleReset
+	}
+	return row
+}
+
+// formatRow lays out the table columns
+func formatRow(id, name, ip, typ, status, out, power, drift string) string {
+	return fmt.Sprintf("%-5s %-24s %-15s %-14s %-8s %-4s %9s  %s",
+		clip(id, 5), clip(name, 24), clip(ip, 15), clip(typ, 14), clip(status, 8), clip(out, 4), clip(power, 9), drift)
+}
+
+// fit pads or truncates s to exactly width runes
+func fit(s string, width int) string {
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return s + strings.Repeat(" ", width-len(r))
+}
+
+// clip truncates s to n runes
+func clip(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+func displayName(d Device) string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return d.IP
+}
@@ -0,0 +1,187 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDevices() []Device {
+	on := true
+	power := 42.5
+	return []Device{
+		{ID: 1, Name: "Kitchen", IP: "10.0.0.11", Type: "SHSW-1", Status: "online", Output: &on, Power: &power, Drift: "synced"},
+		{ID: 2, Name: "Garage", IP: "10.0.0.12", Type: "SNSW-001X16EU", Status: "online", Drift: "drift"},
+		{ID: 3, Name: "Shed", IP: "10.0.0.13", Type: "SHPLG-S", Status: "offline"},
+	}
+}
+
+func TestModel_Keys(t *testing.T) {
+	m := NewModel("local", nil)
+	assert.Equal(t, Command{}, m.HandleKey("t"), "no device to control yet")
+
+	m.SetDevices(testDevices(), time.Now())
+	assert.Equal(t, uint(1), m.Selected().ID)
+
+	m.HandleKey("down")
+	m.HandleKey("j")
+	m.HandleKey("down")
+	assert.Equal(t, uint(3), m.Selected().ID, "cursor stops at the last device")
+	m.HandleKey("g")
+	m.HandleKey("k")
+	assert.Equal(t, uint(1), m.Selected().ID)
+
+	m.HandleKey("G")
+	assert.Equal(t, Command{Action: "toggle", DeviceID: 3}, m.HandleKey(" "))
+	assert.Equal(t, Command{Action: "on", DeviceID: 3}, m.HandleKey("o"))
+	assert.Equal(t, Command{Action: "off", DeviceID: 3}, m.HandleKey("f"))
+	assert.True(t, m.HandleKey("r").Refresh)
+	assert.True(t, m.HandleKey("q").Quit)
+	assert.True(t, m.HandleKey("ctrl+c").Quit)
+
+	// The selection follows the device across refreshes
+	m.SetDevices(testDevices()[1:], time.Now())
+	assert.Equal(t, uint(3), m.Selected().ID)
+}
+
+func TestModel_Render(t *testing.T) {
+	logs := NewLogBuffer(10)
+	logs.Logf("Garage toggle")
+	m := NewModel("http://server:8080", logs)
+	m.SetDevices(testDevices(), time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC))
+
+	lines := m.Render(100, 20)
+	require.Len(t, lines, 20)
+	screen := strings.Join(lines, "\n")
+	assert.Contains(t, lines[0], "3 devices, 2 online, 1 drifted - updated 15:04:05")
+	assert.Contains(t, screen, "42.5W")
+	assert.Contains(t, screen, "Garage toggle")
+	assert.True(t, strings.HasPrefix(lines[2], styleReverse), "selected row is highlighted")
+	assert.True(t, strings.HasPrefix(lines[3], styleYellow), "drifted device is highlighted")
+	assert.True(t, strings.HasPrefix(lines[4], styleRed), "offline device is highlighted")
+
+	m.HandleKey("l")
+	assert.NotContains(t, strings.Join(m.Render(100, 20), "\n"), "Garage toggle")
+
+	m.SetLoadError(errors.New("connection refused"))
+	lines = m.Render(100, 20)
+	assert.Contains(t, lines[len(lines)-2], "Refresh failed: connection refused")
+	assert.Contains(t, lines[2], "Kitchen", "the last table stays visible")
+
+	// The cursor scrolls the table when it leaves the visible rows
+	m.HandleKey("G")
+	lines = m.Render(100, 6)
+	assert.Contains(t, lines[2], "Garage")
+	assert.Contains(t, lines[3], "Shed")
+}
+
+// blockingSource answers nothing until its context ends
+type blockingSource struct {
+	started, done chan struct{}
+}
+
+func (s *blockingSource) Devices(ctx context.Context) ([]Device, error) {
+	close(s.started)
+	<-ctx.Done()
+	close(s.done)
+	return nil, ctx.Err()
+}
+
+func (s *blockingSource) Control(ctx context.Context, id uint, action string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestDashboard_Update(t *testing.T) {
+	d := &dashboard{ctx: context.Background(), src: &blockingSource{}, opts: Options{Refresh: time.Second, Logs: NewLogBuffer(10)}, model: NewModel("local", nil)}
+	d.Update(loadedMsg{devices: testDevices(), at: time.Now()})
+	d.Update(tea.WindowSizeMsg{Width: 100, Height: 20})
+	assert.Len(t, strings.Split(d.View(), "\n"), 20)
+
+	d.Update(tea.KeyMsg{Type: tea.KeyDown})
+	assert.Equal(t, uint(2), d.model.Selected().ID)
+	_, cmd := d.Update(tea.KeyMsg{Type: tea.KeySpace})
+	assert.NotNil(t, cmd, "toggling starts a control command")
+	d.Update(controlledMsg{action: "toggle", name: "Garage", err: errors.New("timeout")})
+	assert.Contains(t, d.View(), "Garage toggle failed: timeout")
+
+	_, cmd = d.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+	require.NotNil(t, cmd)
+	assert.Equal(t, tea.Quit(), cmd())
+}
+
+func TestRun_QuitEndsPendingLoads(t *testing.T) {
+	src := &blockingSource{started: make(chan struct{}), done: make(chan struct{})}
+	in, keys := io.Pipe()
+	defer func() { _ = keys.Close() }()
+	errs := make(chan error, 1)
+	go func() { errs <- run(context.Background(), src, in, io.Discard, Options{Refresh: time.Hour}) }()
+
+	<-src.started
+	_, err := keys.Write([]byte("q"))
+	require.NoError(t, err)
+	require.NoError(t, <-errs)
+	select {
+	case <-src.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the device load outlived the dashboard")
+	}
+}
+
+func TestLogBuffer(t *testing.T) {
+	b := NewLogBuffer(2)
+	_, _ = b.Write([]byte("first\nsec"))
+	_, _ = b.Write([]byte("ond\tline\r\nthird\x1b[31m\n"))
+	assert.Equal(t, []string{"second line", "third[31m"}, b.Lines(5))
+	assert.Equal(t, []string{"third[31m"}, b.Lines(1))
+}
+
+type fakeStatus map[uint]map[string]interface{}
+
+func TestFillLive(t *testing.T) {
+	devices := testDevices()
+	for i := range devices {
+		devices[i].Output, devices[i].Power, devices[i].Drift = nil, nil, ""
+	}
+	statuses := fakeStatus{
+		1: {"switches": []map[string]interface{}{{"output": false, "apower": 3.5}, {"output": true, "apower": 1.5}}},
+		2: {"switches": []map[string]interface{}{{"output": true}}, "meters": []map[string]interface{}{{"power": 100.0}}},
+	}
+	var offlineRead bool
+	fillLive(context.Background(), devices,
+		func(id uint) (map[string]interface{}, error) {
+			if id == 3 {
+				offlineRead = true
+			}
+			return statuses[id], nil
+		},
+		func(id uint) (string, error) {
+			if id == 2 {
+				return "drift", nil
+			}
+			return "", errors.New("no configuration")
+		})
+
+	assert.False(t, offlineRead, "offline devices are not contacted")
+	require.NotNil(t, devices[0].Output)
+	assert.False(t, *devices[0].Output)
+	assert.Equal(t, 5.0, *devices[0].Power)
+	assert.Equal(t, 100.0, *devices[1].Power, "meter readings are preferred")
+	assert.Equal(t, "drift", devices[1].Drift)
+	assert.Empty(t, devices[0].Drift)
+	assert.Nil(t, devices[2].Output)
+
+	devices = []Device{{ID: 4, Status: "online"}}
+	fillLive(context.Background(), devices,
+		func(uint) (map[string]interface{}, error) { return nil, errors.New("timeout") },
+		func(uint) (string, error) { return "synced", nil })
+	assert.Equal(t, "timeout", devices[0].Err)
+	assert.Nil(t, devices[0].Power)
+}
@@ -0,0 +1,171 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/term"
+)
+
+// controlTimeout bounds a control action started from the dashboard
+const controlTimeout = 15 * time.Second
+
+// Options configure the dashboard
+type Options struct {
+	Title   string        // shown in the title, e.g. the server URL
+	Refresh time.Duration // device table refresh interval
+	Logs    *LogBuffer    // log tail; application logs should be written to it
+}
+
+// Run shows the dashboard on the terminal until the user quits or ctx is
+// cancelled. in must be a terminal; it is switched to raw mode and restored
+// on return.
+func Run(ctx context.Context, src Source, in *os.File, out io.Writer, opts Options) error {
+	if !term.IsTerminal(int(in.Fd())) {
+		return errors.New("the dashboard needs an interactive terminal")
+	}
+	return run(ctx, src, in, out, opts, tea.WithAltScreen())
+}
+
+// run drives the dashboard as a bubbletea program reading keys from in.
+// Device loads and control actions run as commands under a context that
+// ends with the program, so none outlive it.
+func run(ctx context.Context, src Source, in io.Reader, out io.Writer, opts Options, extra ...tea.ProgramOption) error {
+	if opts.Refresh <= 0 {
+		opts.Refresh = 5 * time.Second
+	}
+	if opts.Logs == nil {
+		opts.Logs = NewLogBuffer(200)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	d := &dashboard{ctx: ctx, src: src, opts: opts, model: NewModel(opts.Title, opts.Logs), width: 80, height: 24}
+	popts := append([]tea.ProgramOption{tea.WithContext(ctx), tea.WithInput(in), tea.WithOutput(out)}, extra...)
+	_, err := tea.NewProgram(d, popts...).Run()
+	if errors.Is(err, tea.ErrProgramKilled) && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// Messages of the dashboard program
+type (
+	loadedMsg struct {
+		devices []Device
+		err     error
+		at      time.Time
+	}
+	controlledMsg struct {
+		action string
+		name   string
+		err    error
+	}
+	refreshTickMsg struct{}
+	redrawTickMsg  struct{}
+)
+
+// dashboard adapts Model to bubbletea: key presses go to HandleKey and
+// View draws Render at the terminal size
+type dashboard struct {
+	ctx        context.Context
+	src        Source
+	opts       Options
+	model      *Model
+	refreshing bool
+	width      int
+	height     int
+}
+
+func (d *dashboard) Init() tea.Cmd {
+	return tea.Batch(d.refresh(), d.refreshTick(), redrawTick())
+}
+
+func (d *dashboard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		cmd := d.model.HandleKey(msg.String())
+		switch {
+		case cmd.Quit:
+			return d, tea.Quit
+		case cmd.Refresh:
+			return d, d.refresh()
+		case cmd.Action != "":
+			return d, d.control(cmd)
+		}
+	case tea.WindowSizeMsg:
+		d.width, d.height = msg.Width, msg.Height
+	case loadedMsg:
+		d.refreshing = false
+		if msg.err != nil {
+			d.model.SetLoadError(msg.err)
+			d.opts.Logs.Logf("Refresh failed: %v", msg.err)
+		} else {
+			d.model.SetDevices(msg.devices, msg.at)
+			if d.model.message == "Refreshing..." {
+				d.model.SetMessage("")
+			}
+		}
+	case controlledMsg:
+		if msg.err != nil {
+			d.model.SetMessage("%s %s failed: %v", msg.name, msg.action, msg.err)
+			d.opts.Logs.Logf("%s %s failed: %v", msg.name, msg.action, msg.err)
+		} else {
+			d.model.SetMessage("%s %s done", msg.name, msg.action)
+			d.opts.Logs.Logf("%s %s", msg.name, msg.action)
+		}
+		return d, d.refresh()
+	case refreshTickMsg:
+		return d, tea.Batch(d.refresh(), d.refreshTick())
+	case redrawTickMsg:
+		// Redraw regularly for the log tail
+		return d, redrawTick()
+	}
+	return d, nil
+}
+
+func (d *dashboard) View() string {
+	return strings.Join(d.model.Render(d.width, d.height), "\n")
+}
+
+// refresh loads the device table unless a load is in progress
+func (d *dashboard) refresh() tea.Cmd {
+	if d.refreshing {
+		return nil
+	}
+	d.refreshing = true
+	ctx, src, timeout := d.ctx, d.src, d.opts.Refresh+10*time.Second
+	return func() tea.Msg {
+		rctx, rcancel := context.WithTimeout(ctx, timeout)
+		defer rcancel()
+		devices, err := src.Devices(rctx)
+		return loadedMsg{devices: devices, err: err, at: time.Now()}
+	}
+}
+
+// control sends a control action to the selected device
+func (d *dashboard) control(cmd Command) tea.Cmd {
+	name := ""
+	if sel := d.model.Selected(); sel != nil {
+		name = displayName(*sel)
+	}
+	ctx, src := d.ctx, d.src
+	return func() tea.Msg {
+		cctx, ccancel := context.WithTimeout(ctx, controlTimeout)
+		defer ccancel()
+		return controlledMsg{action: cmd.Action, name: name, err: src.Control(cctx, cmd.DeviceID, cmd.Action)}
+	}
+}
+
+func (d *dashboard) refreshTick() tea.Cmd {
+	return tea.Tick(d.opts.Refresh, func(time.Time) tea.Msg { return refreshTickMsg{} })
+}
+
+func redrawTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return redrawTickMsg{} })
+}
@@ -0,0 +1,174 @@
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/ginsys/shelly-manager/api/client"
+	"github.com/ginsys/shelly-manager/internal/service"
+)
+
+// liveWorkers bounds the concurrent device status reads of a refresh
+const liveWorkers = 8
+
+// Source provides the devices shown on the dashboard and runs control actions
+type Source interface {
+	Devices(ctx context.Context) ([]Device, error)
+	Control(ctx context.Context, id uint, action string) error
+}
+
+// serviceSource reads the local database and devices through the service
+type serviceSource struct {
+	svc *service.ShellyService
+}
+
+// NewServiceSource creates a source using the local service
+func NewServiceSource(svc *service.ShellyService) Source {
+	return &serviceSource{svc: svc}
+}
+
+func (s *serviceSource) Devices(ctx context.Context) ([]Device, error) {
+	stored, err := s.svc.DB.GetDevices()
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]Device, len(stored))
+	for i, d := range stored {
+		devices[i] = Device{ID: d.ID, Name: d.Name, IP: d.IP, Type: d.Type, Status: d.Status}
+	}
+	fillLive(ctx, devices,
+		func(id uint) (map[string]interface{}, error) { return s.svc.GetDeviceStatus(id) },
+		func(id uint) (string, error) {
+			cfg, err := s.svc.GetDeviceConfig(id)
+			if err != nil {
+				return "", err
+			}
+			return cfg.SyncStatus, nil
+		})
+	return devices, nil
+}
+
+func (s *serviceSource) Control(ctx context.Context, id uint, action string) error {
+	return s.svc.ControlDevice(id, action, nil)
+}
+
+// clientSource calls the API of a running server
+type clientSource struct {
+	client *client.Client
+}
+
+// NewClientSource creates a source using the API client
+func NewClientSource(c *client.Client) Source {
+	return &clientSource{client: c}
+}
+
+func (s *clientSource) Devices(ctx context.Context) ([]Device, error) {
+	list, err := s.client.ListDevices(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]Device, len(list.Devices))
+	for i, d := range list.Devices {
+		devices[i] = Device{ID: d.ID, Name: d.Name, IP: d.IP, Type: d.Type, Status: d.Status}
+	}
+	fillLive(ctx, devices,
+		func(id uint) (map[string]interface{}, error) { return s.client.DeviceStatus(ctx, id) },
+		func(id uint) (string, error) {
+			cfg, err := s.client.DeviceConfig(ctx, id)
+			if err != nil {
+				return "", err
+			}
+			return cfg.SyncStatus, nil
+		})
+	return devices, nil
+}
+
+func (s *clientSource) Control(ctx context.Context, id uint, action string) error {
+	_, err := s.client.ControlDevice(ctx, id, action, nil, false)
+	return err
+}
+
+// fillLive reads the drift state of every device and the live status of the
+// devices not known to be offline. Errors are recorded on the row so one
+// unreachable device does not hide the others.
+func fillLive(ctx context.Context, devices []Device,
+	status func(id uint) (map[string]interface{}, error), syncStatus func(id uint) (string, error)) {
+	sem := make(chan struct{}, liveWorkers)
+	var wg sync.WaitGroup
+	for i := range devices {
+		d := &devices[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			// A device without a stored configuration has no drift state
+			if drift, err := syncStatus(d.ID); err == nil {
+				d.Drift = drift
+			}
+			if d.Status == "offline" {
+				return
+			}
+			live, err := status(d.ID)
+			if err != nil {
+				d.Err = err.Error()
+				return
+			}
+			applyStatus(d, live)
+		}()
+	}
+	wg.Wait()
+}
+
+// liveStatus is the part of a device status the dashboard shows. Gen1 and
+// Gen2 statuses are both normalised to switches and meters by the service.
+type liveStatus struct {
+	Switches []struct {
+		Output bool     `json:"output"`
+		APower *float64 `json:"apower"`
+	} `json:"switches"`
+	Meters []struct {
+		Power float64 `json:"power"`
+	} `json:"meters"`
+}
+
+// applyStatus sets the switch output and power of a device from its status.
+// Meter readings are preferred; otherwise the switch power is summed.
+func applyStatus(d *Device, status map[string]interface{}) {
+	raw, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	var live liveStatus
+	if err := json.Unmarshal(raw, &live); err != nil {
+		return
+	}
+	d.Status = "online"
+	if len(live.Switches) > 0 {
+		output := live.Switches[0].Output
+		d.Output = &output
+	}
+	var power float64
+	metered := false
+	if len(live.Meters) > 0 {
+		for _, m := range live.Meters {
+			power += m.Power
+		}
+		metered = true
+	} else {
+		for _, sw := range live.Switches {
+			if sw.APower != nil {
+				power += *sw.APower
+				metered = true
+			}
+		}
+	}
+	if metered {
+		d.Power = &power
+	}
+}
@@ -82,6 +82,15 @@ export interface DriftDetectedPayload {
   timestamp: string
 }
 
+export interface SessionPayload {
+  session_id: string
+  identity: string
+  resumed: boolean
+  topics: string[]
+  dropped: number
+  resume_window_seconds: number
+}
+
 // --- Discriminated union envelope ---
 
 interface Envelope<T extends MetricsWsMessageType, D> {
@@ -96,6 +105,7 @@ export type MetricsWsMessage =
   | Envelope<'alert', AlertPayload>
   | Envelope<'device_status_change', DeviceStatusChangePayload>
   | Envelope<'drift_detected', DriftDetectedPayload>
+  | Envelope<'session', SessionPayload>
 
 /** A metrics snapshot message (initial hydrate or periodic update). */
 export type DashboardMessage = Extract<MetricsWsMessage, { type: 'initial_metrics' | 'metrics_update' }>
@@ -230,6 +240,19 @@ function validDriftDetected(v: unknown): boolean {
   )
 }
 
+function validSession(v: unknown): boolean {
+  return (
+    isObj(v) &&
+    isStr(v.session_id) &&
+    isStr(v.identity) &&
+    isBool(v.resumed) &&
+    Array.isArray(v.topics) &&
+    v.topics.every(isStr) &&
+    isNum(v.dropped) &&
+    isNum(v.resume_window_seconds)
+  )
+}
+
 export interface ParseOk {
   ok: true
   message: MetricsWsMessage
@@ -270,6 +293,9 @@ export function parseMetricsWsMessage(raw: unknown): ParseResult {
     case 'drift_detected':
       if (!validDriftDetected(data)) return { ok: false, reason: 'invalid drift_detected payload', type }
       break
+    case 'session':
+      if (!validSession(data)) return { ok: false, reason: 'invalid session payload', type }
+      break
     default:
       // Exhaustiveness: a manifest type without a validation case above fails
       // vue-tsc here (t is no longer `never`), forcing a case to be added.
@@ -17,6 +17,7 @@ export const METRICS_WS_MESSAGE_TYPES = [
   'alert',
   'device_status_change',
   'drift_detected',
+  'session',
 ] as const
 
 /** Union of every metrics WebSocket message type the backend can emit. */
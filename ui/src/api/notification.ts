@@ -30,8 +30,15 @@ export interface NotificationHistory {
   status: 'sent' | 'failed' | 'pending'
   sentAt: string
   error?: string
+  alertState?: AlertState
+  acknowledgedBy?: string
+  acknowledgedAt?: string
+  resolvedBy?: string
+  resolvedAt?: string
 }
 
+export type AlertState = 'open' | 'acknowledged' | 'resolved'
+
 // Channels
 export async function getChannels(): Promise<NotificationChannel[]> {
   const res = await api.get<APIResponse<{ channels: NotificationChannel[] }>>('/notifications/channels')
@@ -108,6 +115,8 @@ export async function deleteRule(id: string): Promise<void> {
 export interface GetHistoryParams {
   page?: number
   limit?: number
+  // 'active' is open and acknowledged alerts, 'historical' everything else
+  state?: AlertState | 'active' | 'historical'
 }
 
 export async function getHistory(params: GetHistoryParams = {}): Promise<NotificationHistory[]> {
@@ -118,3 +127,21 @@ export async function getHistory(params: GetHistoryParams = {}): Promise<Notific
   }
   return res.data.data?.history || []
 }
+
+export async function acknowledgeAlert(id: string): Promise<NotificationHistory> {
+  const res = await api.post<APIResponse<NotificationHistory>>(`/notifications/history/${id}/acknowledge`)
+  if (!res.data.success || !res.data.data) {
+    const msg = res.data.error?.message || 'Failed to acknowledge alert'
+    throw new Error(msg)
+  }
+  return res.data.data
+}
+
+export async function resolveAlert(id: string): Promise<NotificationHistory> {
+  const res = await api.post<APIResponse<NotificationHistory>>(`/notifications/history/${id}/resolve`)
+  if (!res.data.success || !res.data.data) {
+    const msg = res.data.error?.message || 'Failed to resolve alert'
+    throw new Error(msg)
+  }
+  return res.data.data
+}
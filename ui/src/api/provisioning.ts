@@ -14,6 +14,31 @@ export interface ProvisioningTask {
   updatedAt: string
 }
 
+export interface ProvisioningAgentHealth {
+  status: 'ok' | 'degraded'
+  problems: string[]
+  reportedAt: string
+  uptimeSeconds: number
+  interface: string
+  interfaceStatus: string
+  currentTask?: string
+  lastScanAt?: string
+  lastScanDevices: number
+  lastScanError?: string
+  lastTaskAt?: string
+  lastTaskStatus?: 'completed' | 'failed'
+  lastTaskError?: string
+  counters: {
+    scans: number
+    scanErrors: number
+    polls: number
+    pollErrors: number
+    tasksCompleted: number
+    tasksFailed: number
+    heartbeatErrors: number
+  }
+}
+
 export interface ProvisioningAgent {
   id: string
   name: string
@@ -21,6 +46,7 @@ export interface ProvisioningAgent {
   version: string
   capabilities: string[]
   lastSeen: string
+  health?: ProvisioningAgentHealth
 }
 
 export interface GetTasksParams {
@@ -0,0 +1,67 @@
+import api from './client'
+import type { APIResponse } from './types'
+
+export interface FleetSummaryDevice {
+  id: number
+  name: string
+  in_maintenance?: boolean
+}
+
+export interface FleetSummaryAlert {
+  id: number
+  subject: string
+  alert_level: string
+  device_id?: number
+  status: string
+  alert_state?: string
+  created_at: string
+}
+
+export interface FleetScheduleEntry {
+  type: 'drift_detection' | 'resolution' | 'sync'
+  id: number
+  name: string
+  last_run?: string
+  next_run?: string
+}
+
+export interface FleetSummary {
+  generated_at: string
+  devices: {
+    total: number
+    by_status: Record<string, number>
+    by_generation: Record<string, number>
+    by_model: Record<string, number>
+    // Devices rebooting more often than metrics.reboot_threshold per 24 hours
+    flapping: FleetSummaryDevice[]
+    in_maintenance: number
+  }
+  // Average power of the metered devices over the last complete hour
+  power: {
+    watts: number
+    devices: number
+    hour: string
+  } | null
+  config: {
+    by_sync_status: Record<string, number>
+    drifted: number
+    pending_sync: number
+    drifted_devices: FleetSummaryDevice[]
+  }
+  alerts: {
+    last_24h: number
+    by_level: Record<string, number>
+    recent: FleetSummaryAlert[]
+  }
+  schedules: FleetScheduleEntry[]
+  errors?: Record<string, string>
+}
+
+export async function getFleetSummary(signal?: AbortSignal): Promise<FleetSummary> {
+  const res = await api.get<APIResponse<FleetSummary>>('/summary', { signal })
+  if (!res.data.success || !res.data.data) {
+    const msg = res.data.error?.message || 'Failed to load fleet summary'
+    throw new Error(msg)
+  }
+  return res.data.data
+}
@@ -52,8 +52,23 @@ export interface Device {
   settings?: string
   created_at?: string
   updated_at?: string
+  // Bumped by every edit; sent back so a stale edit gets 409 instead of
+  // overwriting a newer one
+  version?: number
+  // Absent for models the server does not know; treat as all supported
+  supported_operations?: DeviceOperation[]
 }
 
+export type DeviceOperation =
+  | 'switch'
+  | 'dimming'
+  | 'roller'
+  | 'rgbw'
+  | 'power_metering'
+  | 'schedules'
+  | 'scripts'
+  | 'ble'
+
 // Device Status Types
 export interface WiFiStatus {
   connected: boolean
@@ -4,6 +4,7 @@ import { createTestingPinia } from '@pinia/testing'
 import MetricsDashboardPage from '../MetricsDashboardPage.vue'
 import { useMetricsStore } from '@/stores/metrics'
 import * as metricsApi from '@/api/metrics'
+import * as summaryApi from '@/api/summary'
 
 // Mock the API module
 vi.mock('@/api/metrics', () => ({
@@ -24,6 +25,10 @@ vi.mock('@/api/metrics', () => ({
   getDriftSummary: vi.fn()
 }))
 
+vi.mock('@/api/summary', () => ({
+  getFleetSummary: vi.fn()
+}))
+
 describe('MetricsDashboardPage', () => {
   let wrapper: any
   let store: any
@@ -60,8 +65,25 @@ describe('MetricsDashboardPage', () => {
     rateLimit: { triggered: 1, blocked: 0 }
   }
 
+  const mockFleetSummary = {
+    generated_at: '2026-01-01T12:00:00Z',
+    devices: {
+      total: 10,
+      by_status: { online: 8, offline: 2 },
+      by_generation: { gen1: 4, gen2: 6 },
+      by_model: {},
+      flapping: [],
+      in_maintenance: 1
+    },
+    power: { watts: 321.5, devices: 3, hour: '2026-01-01T11:00:00Z' },
+    config: { by_sync_status: { drift: 1 }, drifted: 1, pending_sync: 0, drifted_devices: [{ id: 1, name: 'Kitchen' }] },
+    alerts: { last_24h: 4, by_level: { warning: 4 }, recent: [] },
+    schedules: [{ type: 'sync' as const, id: 1, name: 'Nightly export', next_run: '2026-01-02T03:00:00Z' }]
+  }
+
   beforeEach(() => {
     // Setup default mock implementations
+    vi.mocked(summaryApi.getFleetSummary).mockResolvedValue(mockFleetSummary)
     vi.mocked(metricsApi.getDashboardSummary).mockResolvedValue(mockDashboardSummary)
     vi.mocked(metricsApi.getNotificationMetrics).mockResolvedValue(mockNotificationMetrics)
     vi.mocked(metricsApi.getResolutionMetrics).mockResolvedValue(mockResolutionMetrics)
@@ -163,6 +185,17 @@ describe('MetricsDashboardPage', () => {
       expect(wrapper.text()).toContain('Offline: 2')
     })
 
+    it('displays the fleet summary', async () => {
+      await flushPromises()
+
+      expect(summaryApi.getFleetSummary).toHaveBeenCalled()
+      expect(wrapper.text()).toContain('Fleet Summary')
+      expect(wrapper.text()).toContain('Average: 321.5 W')
+      expect(wrapper.text()).toContain('gen2: 6')
+      expect(wrapper.text()).toContain('Kitchen')
+      expect(wrapper.text()).toContain('Nightly export')
+    })
+
     it('displays notification metrics', async () => {
       await flushPromises()
 
@@ -19,12 +19,15 @@ class StubWebSocket {
   static OPEN = 1
   static CLOSING = 2
   static CLOSED = 3
+  static last: StubWebSocket | null = null
   readyState = StubWebSocket.CONNECTING
   onopen: ((e: Event) => void) | null = null
   onclose: ((e: CloseEvent) => void) | null = null
   onerror: ((e: Event) => void) | null = null
   onmessage: ((e: MessageEvent) => void) | null = null
-  constructor(public url: string) {}
+  constructor(public url: string) {
+    StubWebSocket.last = this
+  }
   close() {}
   send() {}
 }
@@ -223,6 +226,33 @@ describe('useMetricsStore', () => {
     })
   })
 
+  describe('session resume', () => {
+    it('reconnects with the session the server assigned', () => {
+      store.connectWS()
+      expect(StubWebSocket.last?.url).not.toContain('session=')
+      store.disconnectWS()
+
+      store.handleWSMessage(msg('session', {
+        session_id: 'abc123', identity: 'anonymous', resumed: false, topics: [], dropped: 0,
+        resume_window_seconds: 120,
+      }))
+      expect(store.sessionId).toBe('abc123')
+      // A session message is not metrics data.
+      expect(store.isRealtimeActive).toBe(false)
+
+      store.connectWS()
+      expect(StubWebSocket.last?.url).toContain('session=abc123')
+    })
+
+    it('rejects a session frame without an ID', () => {
+      const spy = vi.spyOn(console, 'error').mockImplementation(() => {})
+      store.handleWSMessage(msg('session', { identity: 'anonymous', resumed: false, topics: [] }))
+      expect(store.sessionId).toBe(null)
+      expect(store.invalidMessageCount).toBe(1)
+      spy.mockRestore()
+    })
+  })
+
   describe('REST fallback and stale-REST protection', () => {
     it('polls until the first snapshot is applied, then pauses while live', async () => {
       vi.useFakeTimers()
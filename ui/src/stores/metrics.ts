@@ -98,15 +98,21 @@ export const useMetricsStore = defineStore('metrics', () => {
   const _timer = ref<ReturnType<typeof setInterval> | null>(null)
   const _watchdog = ref<ReturnType<typeof setInterval> | null>(null)
 
-  // WebSocket URL generator
+  // Server-side session of the WebSocket; reconnecting with it resumes the
+  // subscriptions instead of starting over.
+  const sessionId = ref<string | null>(null)
+
+  // WebSocket URL generator, evaluated on every (re)connect
   function getWebSocketUrl(): string {
     const base = (window as unknown as { __API_BASE__?: string }).__API_BASE__ || '/api/v1'
     const loc = window.location
     const proto = loc.protocol === 'https:' ? 'wss' : 'ws'
     const token = (window as unknown as { __ADMIN_KEY__?: string }).__ADMIN_KEY__
-    return `${proto}://${loc.host}${base.replace('/api/v1', '')}/metrics/ws${
-      token ? `?token=${encodeURIComponent(token)}` : ''
-    }`
+    const params = new URLSearchParams()
+    if (token) params.set('token', token)
+    if (sessionId.value) params.set('session', sessionId.value)
+    const query = params.toString()
+    return `${proto}://${loc.host}${base.replace('/api/v1', '')}/metrics/ws${query ? `?${query}` : ''}`
   }
 
   const ws = useWebSocket<unknown>({
@@ -227,6 +233,9 @@ export const useMetricsStore = defineStore('metrics', () => {
       case 'drift_detected':
         appendEvent(msg)
         break
+      case 'session':
+        sessionId.value = msg.data.session_id
+        break
       default:
         assertNever(msg)
     }
@@ -349,6 +358,7 @@ export const useMetricsStore = defineStore('metrics', () => {
     // would show a false LIVE badge and skip the initial REST fetch).
     feedState.value = 'idle'
     lastAppliedMetricsAt.value = null
+    sessionId.value = null
   }
 
   return {
@@ -366,6 +376,7 @@ export const useMetricsStore = defineStore('metrics', () => {
     lastAppliedMetricsAt,
     lastInvalidReason,
     invalidMessageCount,
+    sessionId,
 
     // WebSocket state
     wsConnected,